@@ -17,16 +17,30 @@ import (
 	"github.com/agentkube/operator/config"
 	"github.com/agentkube/operator/internal/handlers"
 	"github.com/agentkube/operator/internal/routes"
+	"github.com/agentkube/operator/pkg/budget"
 	"github.com/agentkube/operator/pkg/cache"
+	"github.com/agentkube/operator/pkg/client"
 	internalconfig "github.com/agentkube/operator/pkg/config"
 	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/demo"
 	"github.com/agentkube/operator/pkg/dispatchers"
 	"github.com/agentkube/operator/pkg/dispatchers/webhook"
 	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/selfupdate"
+	"github.com/agentkube/operator/pkg/shutdown"
 	"github.com/agentkube/operator/pkg/vul"
 )
 
+// drainTimeout bounds the draining of in-flight work at shutdown, within the usual 30s grace period
+const drainTimeout = 15 * time.Second
+
+// Set with -ldflags at build time
+var (
+	version   = "dev"
+	buildTime = ""
+)
+
 type Settings struct {
 	Kubeconfig struct {
 		ExternalPaths []string `json:"externalPaths"`
@@ -35,6 +49,8 @@ type Settings struct {
 }
 
 func main() {
+	selfupdate.SetBuild(version, buildTime)
+
 	cfg, err := internalconfig.Parse(os.Args)
 	if err != nil {
 		log.Fatalf("Failed to parse config: %v", err)
@@ -91,6 +107,17 @@ func main() {
 		logger.Log(logger.LevelError, nil, err, "loading uploaded kubeconfigs on startup")
 	}
 
+	// Add the demo cluster when asked for
+	if cfg.Demo {
+		if _, err := demo.Start(contextStore); err != nil {
+			logger.Log(logger.LevelError, nil, err, "starting demo cluster")
+		}
+	}
+
+	// Account the resources spent on each cluster, before the watchers build their clients
+	kubeconfig.AddTransportHook(budget.Wrap)
+	budget.GetManager().Start()
+
 	// Track if watcher was started
 	var watcherStarted bool
 
@@ -108,15 +135,26 @@ func main() {
 			if watcherConfig.Handler.Webhook.Url == "" {
 				watcherConfig.Handler.Webhook.Url = internalconfig.OperatorWebhook
 			}
-			webhookHandler := &webhook.Webhook{}
-			err := webhookHandler.Init(watcherConfig)
-			if err != nil {
-				logger.Log(logger.LevelError, nil, err, "initializing webhook handler")
-				// Fall back to default handler if webhook fails
-				eventHandler = &dispatchers.Default{}
+			if len(watcherConfig.Handler.Chain) > 0 {
+				// Events fan out to the configured dispatchers, the webhook only when it is a link
+				chain, err := client.NewChain(watcherConfig)
+				if err != nil {
+					logger.Log(logger.LevelError, nil, err, "initializing dispatcher chain")
+				} else {
+					eventHandler = chain
+					logger.Log(logger.LevelInfo, map[string]string{"dispatchers": fmt.Sprintf("%d", len(chain.Links))}, nil, "Dispatcher chain initialized")
+				}
 			} else {
-				eventHandler = webhookHandler
-				logger.Log(logger.LevelInfo, map[string]string{"webhook_url": watcherConfig.Handler.Webhook.Url}, nil, "Webhook handler initialized")
+				webhookHandler := &webhook.Webhook{}
+				err := webhookHandler.Init(watcherConfig)
+				if err != nil {
+					logger.Log(logger.LevelError, nil, err, "initializing webhook handler")
+					// Fall back to default handler if webhook fails
+					eventHandler = &dispatchers.Default{}
+				} else {
+					eventHandler = webhookHandler
+					logger.Log(logger.LevelInfo, map[string]string{"webhook_url": watcherConfig.Handler.Webhook.Url}, nil, "Webhook handler initialized")
+				}
 			}
 
 			if len(watcherConfig.SkipClusters) > 0 {
@@ -180,6 +218,26 @@ func main() {
 		<-stop
 	}
 
+	// Stop accepting requests first, so that no new work starts while in-flight work drains
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Log(logger.LevelError, nil, err, "Server forced to shutdown")
+	} else {
+		logger.Log(logger.LevelInfo, nil, nil, "Server gracefully stopped")
+	}
+
+	// Finish or checkpoint operations, deliver queued events and wait for scans, in that order
+	shutdown.Register("operations", shutdown.PriorityOperations, shutdown.DrainOperations)
+	if watcherStarted {
+		shutdown.Register("dispatcher", shutdown.PriorityDeliveries, controller.DrainEvents)
+	}
+	if vul.ImgScanner != nil {
+		shutdown.Register("image-scans", shutdown.PriorityScans, vul.ImgScanner.Drain)
+	}
+	shutdown.Drain(drainTimeout)
+
 	// Stop controllers only if started (prevents blockage when watcher is disabled)
 	if watcherStarted {
 		controller.Stop()
@@ -189,14 +247,4 @@ func main() {
 	if vul.ImgScanner != nil {
 		vul.ImgScanner.Stop()
 	}
-
-	// Shutdown HTTP server with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Log(logger.LevelError, nil, err, "Server forced to shutdown")
-	} else {
-		logger.Log(logger.LevelInfo, nil, nil, "Server gracefully stopped")
-	}
 }
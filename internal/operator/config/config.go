@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -31,6 +32,23 @@ type Handler struct {
 	MSTeams      MSTeams      `json:"msteams,omitempty" yaml:"msteams,omitempty"`
 	SMTP         SMTP         `json:"smtp,omitempty" yaml:"smtp,omitempty"`
 	Lark         Lark         `json:"lark,omitempty" yaml:"lark,omitempty"`
+	PagerDuty    PagerDuty    `json:"pagerduty,omitempty" yaml:"pagerduty,omitempty"`
+	Opsgenie     Opsgenie     `json:"opsgenie,omitempty" yaml:"opsgenie,omitempty"`
+	// Chain lists the dispatchers events fan out to, each configured by its section above.
+	// When empty events go to the webhook only.
+	Chain []ChainLink `json:"chain,omitempty" yaml:"chain,omitempty"`
+}
+
+// ChainLink is a dispatcher of the chain and the events it receives. Empty filters match every event.
+type ChainLink struct {
+	// Dispatcher name: default, slack, slackwebhook, webhook, ms-teams, smtp, pagerduty or opsgenie.
+	Dispatcher string `json:"dispatcher" yaml:"dispatcher"`
+	// Resource types, e.g. Pod or Deployment.
+	ResourceTypes []string `json:"resourcetypes,omitempty" yaml:"resourcetypes,omitempty"`
+	// Namespaces of the objects.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Severities: Normal, Warning or Danger.
+	Severities []string `json:"severities,omitempty" yaml:"severities,omitempty"`
 }
 
 // Resource contains resource configuration
@@ -63,6 +81,17 @@ type CRD struct {
 	Resource string `json:"resource"`
 }
 
+// CRDDiscovery selects the CRDs whose custom resources are watched, by their name: the plural
+// resource and the group, e.g. certificates.cert-manager.io. Watchers start and stop as CRDs are
+// installed and removed.
+type CRDDiscovery struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Glob patterns of the CRDs to watch, e.g. *.cert-manager.io. Every CRD when empty.
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Glob patterns of the CRDs not to watch, taking precedence over Include.
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
 type Config struct {
 	// Handlers know how to send notifications to specific services.
 	Handler Handler `json:"handler"`
@@ -75,6 +104,14 @@ type Config struct {
 	// CustomResources to Watch
 	CustomResources []CRD `json:"customresources"`
 
+	// Watch the custom resources of the CRDs each cluster serves, in addition to CustomResources.
+	CRDDiscovery CRDDiscovery `json:"crddiscovery,omitempty" yaml:"crddiscovery,omitempty"`
+
+	// Resources watched metadata-only, keeping names, labels, annotations and owners in memory
+	// but not specs, statuses or data: pod, replicaset, job, secret and configmap.
+	// Pods watched this way are not analyzed for restart loops or incidents.
+	MetadataOnly []string `json:"metadataonly,omitempty" yaml:"metadataonly,omitempty"`
+
 	// For watching specific namespace, leave it empty for watching all.
 	// this config is ignored when watching namespaces
 	Namespace string `json:"namespace,omitempty"`
@@ -87,6 +124,36 @@ type Config struct {
 
 	// Clusters to include (if specified, only watch these clusters)
 	IncludeClusters []string `json:"includeClusters,omitempty" yaml:"includeClusters,omitempty"`
+
+	// Start the watchers of a cluster on its first request instead of at startup.
+	// Clusters never opened send no notifications.
+	LazyWatchers bool `json:"lazywatchers,omitempty" yaml:"lazywatchers,omitempty"`
+
+	// Stop the watchers of clusters without requests for this many minutes, they start again on
+	// the next request. 0 keeps them running.
+	IdleMinutes int `json:"idleminutes,omitempty" yaml:"idleminutes,omitempty"`
+
+	// Rules assigning the severity of events, the first matching rule applies.
+	// Events no rule matches keep the built-in severity.
+	SeverityRules []SeverityRule `json:"severityrules,omitempty" yaml:"severityrules,omitempty"`
+}
+
+// SeverityRule assigns a severity to the events it matches, or suppresses them. Empty fields match every event.
+type SeverityRule struct {
+	// Resource types, e.g. Pod or Deployment.
+	Kinds []string `json:"kinds,omitempty" yaml:"kinds,omitempty"`
+	// Reasons: Created, Updated or Deleted.
+	Reasons []string `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+	// Namespaces of the objects.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Labels the objects must have, with these values.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Field values of the objects by dotted path, e.g. status.phase: Failed.
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+	// Severity: Normal, Warning or Danger.
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+	// Suppress drops the matching events instead of notifying.
+	Suppress bool `json:"suppress,omitempty" yaml:"suppress,omitempty"`
 }
 
 // Slack contains slack configuration
@@ -140,6 +207,8 @@ type Webhook struct {
 	Url     string `json:"url"`
 	Cert    string `json:"cert"`
 	TlsSkip bool   `json:"tlsskip"`
+	// SchemaVersion pins the payload version sent, v1 when empty, "latest" follows new versions.
+	SchemaVersion string `json:"schemaversion,omitempty" yaml:"schemaversion,omitempty"`
 }
 
 // Lark contains lark configuration
@@ -148,6 +217,24 @@ type Lark struct {
 	WebhookURL string `json:"webhookurl"`
 }
 
+// PagerDuty contains PagerDuty configuration
+type PagerDuty struct {
+	// Integration key of an Events API v2 integration.
+	RoutingKey string `json:"routingkey"`
+	// Events API URL, the PagerDuty endpoint when empty.
+	Url string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// Opsgenie contains Opsgenie configuration
+type Opsgenie struct {
+	// API key of an API integration.
+	ApiKey string `json:"apikey"`
+	// API URL, https://api.eu.opsgenie.com for the EU instance. The US instance when empty.
+	Url string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Priority of the alerts, P1 to P5. P3 when empty.
+	Priority string `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
 // CloudEvent contains CloudEvent configuration
 type CloudEvent struct {
 	Url string `json:"url"`
@@ -260,6 +347,16 @@ func (c *Config) Write() error {
 	return enc.Encode(c)
 }
 
+// WatchesMetadataOnly reports whether a resource, named as in the resource section, is watched metadata-only
+func (c *Config) WatchesMetadataOnly(resource string) bool {
+	for _, name := range c.MetadataOnly {
+		if strings.EqualFold(name, resource) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetWatcherConfigFile() string {
 	// Use ~/.agentkube/watcher.yaml path
 	return filepath.Join(configDir(), ConfigFileName)
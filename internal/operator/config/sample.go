@@ -81,6 +81,16 @@ resource:
   secret: false
   configmap: false
   ing: false
+# Watch the custom resources of the CRDs each cluster serves, selected by glob patterns of the
+# CRD names, e.g. *.cert-manager.io. Exclude takes precedence, an empty include selects every CRD.
+crddiscovery:
+  enabled: false
+  include: []
+  exclude: []
+# Resources watched metadata-only, keeping names, labels, annotations and owners in memory
+# but not specs, statuses or data: pod, replicaset, job, secret and configmap.
+# Pods watched this way are not analyzed for restart loops or incidents.
+metadataonly: []
 # For watching specific namespace, leave it empty for watching all.
 # this config is ignored when watching namespaces
 namespace: ""
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GetWhoCan handles requests for the subjects allowed a request by RBAC, given by the verb, group,
+// resource, subresource, name, namespace and nonResourceURL query parameters. Resources may be
+// given as resource/subresource, e.g. pods/exec.
+func GetWhoCan(c *gin.Context) {
+	query := canvas.AccessQuery{
+		Verb:           c.Query("verb"),
+		Group:          c.Query("group"),
+		Resource:       c.Query("resource"),
+		Subresource:    c.Query("subresource"),
+		Name:           c.Query("name"),
+		Namespace:      c.Query("namespace"),
+		NonResourceURL: c.Query("nonResourceURL"),
+	}
+
+	canvasController, ok := requestCanvasController(c)
+	if !ok {
+		return
+	}
+	response, err := canvasController.WhoCan(c.Request.Context(), query)
+	if err != nil {
+		writeAccessError(c, err, "evaluating who can")
+		return
+	}
+
+	writeList(c, "subjects", response.Subjects, gin.H{"query": response.Query, "warnings": response.Warnings})
+}
+
+// GetSubjectPermissions handles requests for what a subject may do, as a row per namespace, API
+// group and resource with the verbs allowed. The subject is given by the kind (ServiceAccount,
+// User or Group), name and namespace query parameters; groups lists the groups of a user.
+func GetSubjectPermissions(c *gin.Context) {
+	subject := canvas.AccessSubject{
+		Kind:      c.DefaultQuery("kind", "ServiceAccount"),
+		Name:      c.Query("name"),
+		Namespace: c.Query("namespace"),
+	}
+	var groups []string
+	if value := c.Query("groups"); value != "" {
+		groups = strings.Split(value, ",")
+	}
+
+	canvasController, ok := requestCanvasController(c)
+	if !ok {
+		return
+	}
+	matrix, err := canvasController.SubjectPermissions(c.Request.Context(), subject, groups)
+	if err != nil {
+		writeAccessError(c, err, "evaluating subject permissions")
+		return
+	}
+
+	writeList(c, "rows", matrix.Rows, gin.H{
+		"subject":      matrix.Subject,
+		"groups":       matrix.Groups,
+		"clusterAdmin": matrix.ClusterAdmin,
+		"warnings":     matrix.Warnings,
+	})
+}
+
+func writeAccessError(c *gin.Context, err error, action string) {
+	if errors.Is(err, canvas.ErrInvalidAccessQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Log(logger.LevelError, map[string]string{"clusterName": c.Param("clusterName")}, err, action)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed %s: %v", action, err)})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/agentkube/operator/pkg/addons"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AddonHandler struct {
+	manager *addons.Manager
+}
+
+func NewAddonHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *AddonHandler {
+	manager := addons.NewManager(kubeConfigStore, queue)
+
+	processor := addons.NewProcessor(manager)
+	queue.RegisterProcessor(addons.OperationInstall, processor)
+	queue.RegisterProcessor(addons.OperationUninstall, processor)
+
+	return &AddonHandler{
+		manager: manager,
+	}
+}
+
+// ListCatalog returns the addons the installer can deploy
+func (h *AddonHandler) ListCatalog(c *gin.Context) {
+	writeList(c, "addons", addons.Catalog(), nil)
+}
+
+// ListStatuses returns the state of every addon in a cluster
+func (h *AddonHandler) ListStatuses(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	statuses, err := h.manager.Statuses(c.Request.Context(), clusterName)
+	if err != nil {
+		writeAddonError(c, err)
+		return
+	}
+
+	writeList(c, "addons", statuses, gin.H{"cluster": clusterName})
+}
+
+// GetInventory returns the well-known components of a cluster (metrics, monitoring, certificates,
+// ingress, service meshes, GitOps) with their version and health, ?category= filters them
+func (h *AddonHandler) GetInventory(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	detections, err := h.manager.Inventory(c.Request.Context(), clusterName)
+	if err != nil {
+		writeAddonError(c, err)
+		return
+	}
+	if category := c.Query("category"); category != "" {
+		filtered := []addons.Detection{}
+		for _, detection := range detections {
+			if detection.Category == category {
+				filtered = append(filtered, detection)
+			}
+		}
+		detections = filtered
+	}
+
+	writeList(c, "components", detections, gin.H{"cluster": clusterName})
+}
+
+// GetStatus returns the state of an addon in a cluster
+func (h *AddonHandler) GetStatus(c *gin.Context) {
+	status, err := h.manager.Status(c.Request.Context(), c.Param("clusterName"), c.Param("addon"))
+	if err != nil {
+		writeAddonError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Install queues the installation of an addon
+func (h *AddonHandler) Install(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	operation, err := h.manager.Install(clusterName, c.Param("addon"))
+	if err != nil {
+		writeAddonError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     c.Param("addon") + " installation started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":  operation.Status,
+			"cluster": clusterName,
+		},
+	})
+}
+
+// Uninstall queues the removal of an addon installed by agentkube, ?removeCRDs=true also deletes
+// its CustomResourceDefinitions and the resources of their kinds
+func (h *AddonHandler) Uninstall(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	removeCRDs, err := strconv.ParseBool(c.DefaultQuery("removeCRDs", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "removeCRDs must be true or false"})
+		return
+	}
+
+	operation, err := h.manager.Uninstall(clusterName, c.Param("addon"), removeCRDs)
+	if err != nil {
+		writeAddonError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     c.Param("addon") + " uninstallation started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":  operation.Status,
+			"cluster": clusterName,
+		},
+	})
+}
+
+func writeAddonError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, addons.ErrUnknownAddon), errors.Is(err, addons.ErrUnknownCluster):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		logger.Log(logger.LevelError, map[string]string{"cluster": c.Param("clusterName")}, err, "Failed to detect addons")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agentkube/operator/pkg/apply"
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// applyTimeout bounds applying the objects of a manifest
+const applyTimeout = 2 * time.Minute
+
+type ApplyHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewApplyHandler(kubeConfigStore kubeconfig.ContextStore) *ApplyHandler {
+	return &ApplyHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// ApplyManifest applies the YAML or JSON objects of a manifest to a cluster, with server-side apply
+// or create and merge patch, and returns the outcome of every object with its changes to the live
+// state. Dry-runs are allowed on read-only clusters and need no approval.
+func (h *ApplyHandler) ApplyManifest(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req apply.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid apply request: " + err.Error()})
+		return
+	}
+	if req.Force && !req.ServerSide {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "force only applies to server-side apply"})
+		return
+	}
+	objects, err := apply.Decode(req.Manifest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.DryRun {
+		if rejectReadOnly(c, clusterName) {
+			return
+		}
+		if requireApproval(c, approvals.NewApplyAction(clusterName, apply.Objects(objects))) {
+			return
+		}
+	}
+
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get REST config: " + err.Error()})
+		return
+	}
+	applier, err := apply.NewApplier(restConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), applyTimeout)
+	defer cancel()
+	result := applier.Apply(ctx, objects, req)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":      clusterName,
+		"fieldManager": result.FieldManager,
+		"dryRun":       strconv.FormatBool(result.DryRun),
+		"failed":       strconv.Itoa(result.Failed),
+	}, nil, "applied manifest")
+	c.JSON(http.StatusOK, result)
+}
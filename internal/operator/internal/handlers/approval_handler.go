@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/breakglass"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// approvalReasonHeader optionally explains why a dangerous operation is requested
+const approvalReasonHeader = "X-Agentkube-Approval-Reason"
+
+type ApprovalHandler struct {
+	manager *approvals.Manager
+}
+
+func NewApprovalHandler() *ApprovalHandler {
+	manager := approvals.GetManager()
+	manager.Start()
+
+	return &ApprovalHandler{
+		manager: manager,
+	}
+}
+
+// requireApproval guards a dangerous action. It answers the request and returns true when the
+// action may not run: a pending approval was created, or the supplied approval cannot be used.
+func requireApproval(c *gin.Context, action approvals.Action) bool {
+	if breakGlassApproval(c, action) {
+		return false
+	}
+
+	approval, err := approvals.GetManager().Guard(
+		action,
+		approvals.Identity(c.Request),
+		c.GetHeader(approvals.ApprovalHeader),
+		c.GetHeader(approvalReasonHeader),
+	)
+
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, approvals.ErrApprovalRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error": fmt.Sprintf("%s requires approval by a second user, retry with the %s header once approved",
+				approval.Summary, approvals.ApprovalHeader),
+			"approval": approval,
+		})
+	case errors.Is(err, approvals.ErrApprovalInvalid):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		logger.Log(logger.LevelError, nil, err, "checking operation approval")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check operation approval: " + err.Error()})
+	}
+	return true
+}
+
+// breakGlassApproval reports whether the request carries break-glass tokens for every cluster of
+// an action that needs approval, letting it run without one
+func breakGlassApproval(c *gin.Context, action approvals.Action) bool {
+	if c.GetHeader(breakglass.TokenHeader) == "" {
+		return false
+	}
+	if required, err := approvals.GetManager().Required(action); err != nil || !required {
+		return false
+	}
+	for _, cluster := range action.Clusters {
+		if !breakGlass(c, cluster, breakglass.RestrictionApproval) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetSettings returns the approval settings
+func (h *ApprovalHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the approval settings
+func (h *ApprovalHandler) UpdateSettings(c *gin.Context) {
+	var settings approvals.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListApprovals lists approvals with their audit trail, filtered by the query parameters
+func (h *ApprovalHandler) ListApprovals(c *gin.Context) {
+	items, err := h.manager.List(approvals.Filter{
+		Status:    c.Query("status"),
+		Cluster:   c.Query("cluster"),
+		Rule:      c.Query("rule"),
+		Requester: c.Query("requester"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "approvals", items, nil)
+}
+
+// GetApproval returns a single approval
+func (h *ApprovalHandler) GetApproval(c *gin.Context) {
+	approval, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, approval)
+}
+
+// Approve confirms a pending approval on behalf of the calling user
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	h.decide(c, h.manager.Approve)
+}
+
+// Reject refuses a pending approval on behalf of the calling user
+func (h *ApprovalHandler) Reject(c *gin.Context) {
+	h.decide(c, h.manager.Reject)
+}
+
+// Cancel withdraws an approval on behalf of its requester
+func (h *ApprovalHandler) Cancel(c *gin.Context) {
+	h.decide(c, h.manager.Cancel)
+}
+
+func (h *ApprovalHandler) decide(c *gin.Context, decide func(id, actor, comment string) (*approvals.Approval, error)) {
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+	}
+
+	approval, err := decide(c.Param("id"), approvals.Identity(c.Request), req.Comment)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, approval)
+}
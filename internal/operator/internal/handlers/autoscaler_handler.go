@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/autoscaler"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type AutoscalerHandler struct {
+	inspector *autoscaler.Inspector
+}
+
+func NewAutoscalerHandler(kubeConfigStore kubeconfig.ContextStore) *AutoscalerHandler {
+	return &AutoscalerHandler{
+		inspector: autoscaler.NewInspector(kubeConfigStore),
+	}
+}
+
+// GetOverview returns the detected autoscalers with their status and recent scaling events
+func (h *AutoscalerHandler) GetOverview(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	overview, err := h.inspector.Overview(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to get autoscaler overview")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get autoscaler overview: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// ListPendingPods lists the unschedulable pods that drive scale-up
+func (h *AutoscalerHandler) ListPendingPods(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	pods, err := h.inspector.PendingPods(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to list pending pods")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list pending pods: " + err.Error(),
+		})
+		return
+	}
+
+	writeList(c, "pods", pods, nil)
+}
+
+// ListScaleDownBlockers lists the pods and nodes that keep nodes from being removed
+func (h *AutoscalerHandler) ListScaleDownBlockers(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	blockers, err := h.inspector.ScaleDownBlockers(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to list scale-down blockers")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list scale-down blockers: " + err.Error(),
+		})
+		return
+	}
+
+	writeList(c, "blockers", blockers, nil)
+}
+
+// GetKarpenter returns the Karpenter NodePools and NodeClaims
+func (h *AutoscalerHandler) GetKarpenter(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	status, err := h.inspector.Karpenter(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to get Karpenter status")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get Karpenter status: " + err.Error(),
+		})
+		return
+	}
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Karpenter is not installed in cluster " + clusterName,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
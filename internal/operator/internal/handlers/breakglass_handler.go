@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/breakglass"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type BreakGlassHandler struct {
+	manager         *breakglass.Manager
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewBreakGlassHandler(kubeConfigStore kubeconfig.ContextStore) *BreakGlassHandler {
+	manager := breakglass.GetManager()
+	manager.Start()
+
+	return &BreakGlassHandler{
+		manager:         manager,
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// breakGlass reports whether the request carries a valid break-glass token for the cluster,
+// lifting the restriction for this request
+func breakGlass(c *gin.Context, cluster, restriction string) bool {
+	return breakGlassRequest(c.Request, cluster, restriction)
+}
+
+// breakGlassRequest is breakGlass for requests handled outside of gin
+func breakGlassRequest(r *http.Request, cluster, restriction string) bool {
+	header := r.Header.Get(breakglass.TokenHeader)
+	if header == "" {
+		return false
+	}
+
+	detail := r.Method + " " + r.URL.Path
+	for _, token := range strings.Split(header, ",") {
+		_, err := breakglass.GetManager().Use(strings.TrimSpace(token), cluster, restriction, detail)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, breakglass.ErrTokenInvalid) {
+			logger.Log(logger.LevelError, map[string]string{"cluster": cluster}, err, "checking break-glass token")
+		}
+	}
+	return false
+}
+
+// IssueGrant grants the calling user elevated access to a cluster for a limited time
+func (h *BreakGlassHandler) IssueGrant(c *gin.Context) {
+	var req struct {
+		Cluster         string `json:"cluster" binding:"required"`
+		Reason          string `json:"reason" binding:"required"`
+		DurationMinutes int    `json:"durationMinutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if _, err := h.kubeConfigStore.GetContext(req.Cluster); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+		return
+	}
+
+	duration := breakglass.DefaultDuration
+	if req.DurationMinutes != 0 {
+		duration = time.Duration(req.DurationMinutes) * time.Minute
+	}
+
+	grant, token, err := h.manager.Issue(req.Cluster, approvals.Identity(c.Request), req.Reason, duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"grant":  grant,
+		"token":  token,
+		"header": breakglass.TokenHeader,
+	})
+}
+
+// ListGrants lists break-glass grants, filtered by the query parameters
+func (h *BreakGlassHandler) ListGrants(c *gin.Context) {
+	grants, err := h.manager.List(breakglass.Filter{
+		Cluster: c.Query("cluster"),
+		Status:  c.Query("status"),
+		User:    c.Query("user"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "grants", grants, nil)
+}
+
+// GetGrant returns a single break-glass grant
+func (h *BreakGlassHandler) GetGrant(c *gin.Context) {
+	grant, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
+
+// ConfirmGrant confirms a break-glass grant of another user, letting it bypass approvals
+func (h *BreakGlassHandler) ConfirmGrant(c *gin.Context) {
+	grant, err := h.manager.Confirm(c.Param("id"), approvals.Identity(c.Request))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
+
+// RevokeGrant ends a break-glass grant on behalf of the calling user
+func (h *BreakGlassHandler) RevokeGrant(c *gin.Context) {
+	grant, err := h.manager.Revoke(c.Param("id"), approvals.Identity(c.Request))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
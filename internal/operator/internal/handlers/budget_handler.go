@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/gin-gonic/gin"
+)
+
+type BudgetHandler struct {
+	manager *budget.Manager
+}
+
+func NewBudgetHandler() *BudgetHandler {
+	return &BudgetHandler{
+		manager: budget.GetManager(),
+	}
+}
+
+// GetSettings returns the resource budgets of the clusters
+func (h *BudgetHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the resource budgets, applied at the next check
+func (h *BudgetHandler) UpdateSettings(c *gin.Context) {
+	var settings budget.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListUsage returns the API traffic, memory and goroutines the operator spends on each cluster
+func (h *BudgetHandler) ListUsage(c *gin.Context) {
+	usage, err := h.manager.Usage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "clusters", usage, nil)
+}
+
+// GetClusterUsage returns the usage of a single cluster
+func (h *BudgetHandler) GetClusterUsage(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	usage, err := h.manager.Usage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, clusterUsage := range usage {
+		if clusterUsage.Cluster == clusterName {
+			c.JSON(http.StatusOK, clusterUsage)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "no usage recorded for cluster " + clusterName})
+}
@@ -1,15 +1,35 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/listing"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/policy"
+	"github.com/agentkube/operator/pkg/traffic"
 	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
 )
 
-// GetCanvasNodes handles requests to retrieve graph representation for resources
+// canvasContextStore lists the clusters federated graphs search for the endpoints of services
+var canvasContextStore kubeconfig.ContextStore
+
+// InitializeCanvasCache drops cached canvas graphs as the watchers report changes
+func InitializeCanvasCache(kubeConfigStore kubeconfig.ContextStore) {
+	canvasContextStore = kubeConfigStore
+	controller.AddEventListener(canvas.InvalidateGraphs)
+}
+
+// GetCanvasNodes handles requests to retrieve graph representation for resources. crossNamespace=true
+// follows the references leaving the namespace, federated=true links services to the services of the
+// other clusters they point at.
 func GetCanvasNodes(c *gin.Context) {
 	// Get context from the cluster manager
 	if clusterManager == nil {
@@ -34,20 +54,50 @@ func GetCanvasNodes(c *gin.Context) {
 		return
 	}
 
-	// Check for attack-path query parameter
-	attackPath := c.Query("query") == "attack-path"
+	opts := canvas.GraphOptions{
+		// Check for attack-path query parameter
+		AttackPath:     c.Query("query") == "attack-path",
+		CrossNamespace: c.Query("crossNamespace") == "true",
+	}
+	// refresh=true rebuilds the graph instead of serving it from the cache
+	refresh := c.Query("refresh") == "true"
 
 	// Handle 'core' group as empty string to match k8s API expectations
 	if resource.Group == "core" {
 		resource.Group = ""
 	}
 
+	if c.Query("federated") == "true" {
+		opts.Peers = canvasPeers(clusterName)
+	}
+
+	context, response, ok := buildCanvasGraph(c, clusterName, resource, opts, refresh)
+	if !ok {
+		return
+	}
+
+	// Surface policy findings on the resources shown in the graph
+	policy.AnnotateGraph(clusterName, response)
+
+	// Overlay observed service-to-service traffic, the graph is still useful without it
+	if c.Query("overlay") == "traffic" {
+		if err := overlayTraffic(c, context, response); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"clusterName": clusterName}, err, "overlaying traffic on canvas")
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// buildCanvasGraph returns the graph of a resource with the context of its cluster, from the cache
+// unless refresh is set. Failures are written to the response.
+func buildCanvasGraph(c *gin.Context, clusterName string, resource canvas.ResourceIdentifier, opts canvas.GraphOptions, refresh bool) (*kubeconfig.Context, *canvas.GraphResponse, bool) {
 	// Get the context from the store
 	context, err := clusterManager.GetContext(clusterName)
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting context")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
-		return
+		return nil, nil, false
 	}
 
 	// Get REST config for the context
@@ -55,7 +105,7 @@ func GetCanvasNodes(c *gin.Context) {
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting REST config")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get REST config: %v", err)})
-		return
+		return nil, nil, false
 	}
 
 	// Create canvas controller
@@ -65,11 +115,13 @@ func GetCanvasNodes(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("failed to create canvas controller: %v", err),
 		})
-		return
+		return nil, nil, false
 	}
+	// Read owner references and labels from the watcher caches instead of listing the cluster
+	canvasController.WithLister(controller.NewInformerLister(clusterName))
 
 	// Get graph nodes representation
-	response, err := canvasController.GetGraphNodes(c.Request.Context(), resource, attackPath)
+	response, err := canvasController.GetCachedGraphNodes(c.Request.Context(), clusterName, resource, opts, refresh)
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{
 			"clusterName":  clusterName,
@@ -81,8 +133,335 @@ func GetCanvasNodes(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("failed to get graph nodes: %v", err),
 		})
+		return nil, nil, false
+	}
+
+	return context, response, true
+}
+
+// canvasPeers returns the clusters other than clusterName, skipping those without a usable REST config
+func canvasPeers(clusterName string) []canvas.Peer {
+	if canvasContextStore == nil {
+		return nil
+	}
+	contexts, err := canvasContextStore.GetContexts()
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"clusterName": clusterName}, err, "listing contexts for federated canvas")
+		return nil
+	}
+
+	peers := []canvas.Peer{}
+	for _, kubeContext := range contexts {
+		if kubeContext.Name == clusterName || kubeContext.Internal {
+			continue
+		}
+		restConfig, err := kubeContext.RESTConfig()
+		if err != nil {
+			continue
+		}
+		peers = append(peers, canvas.Peer{Name: kubeContext.Name, RESTConfig: restConfig})
+	}
+	return peers
+}
+
+// overlayTraffic adds the flows of the window query parameter to the graph
+func overlayTraffic(c *gin.Context, kubeContext *kubeconfig.Context, response *canvas.GraphResponse) error {
+	window, err := traffic.ParseWindow(c.Query("window"))
+	if err != nil {
+		return err
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return err
+	}
+	dependencyMap, err := traffic.Query(c.Request.Context(), clientset, "", window)
+	if err != nil {
+		return err
+	}
+	traffic.AnnotateGraph(response, dependencyMap.Flows)
+	return nil
+}
+
+// GetDataLocality handles requests for the volumes tied to nodes and the workloads they pin. With the
+// node query parameter only the workloads that can't be rescheduled once the node is drained are returned.
+func GetDataLocality(c *gin.Context) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	clusterName := c.Param("clusterName")
+	context, err := clusterManager.GetContext(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting context")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+		return
+	}
+
+	restConfig, err := context.RESTConfig()
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting REST config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get REST config: %v", err)})
+		return
+	}
+
+	canvasController, err := canvas.NewController(restConfig)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "creating canvas controller")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create canvas controller: %v", err)})
+		return
+	}
+
+	report, err := canvasController.GetDataLocality(c.Request.Context(), c.Query("namespace"))
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting data locality")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get data locality: %v", err)})
+		return
+	}
+
+	if node := c.Query("node"); node != "" {
+		writeList(c, "workloads", report.DrainImpact(node), gin.H{"node": node})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetNamespaceCanvas handles requests for the whole graph of a namespace, a page of its nodes selected
+// by the listing query parameters. The kinds parameter narrows the nodes, pods=true adds replica sets and pods,
+// policyTraffic=true the traffic network policies allow or deny between them.
+func GetNamespaceCanvas(c *gin.Context) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	clusterName := c.Param("clusterName")
+	namespace := c.Param("namespace")
+	query, err := listing.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := canvas.NamespaceGraphOptions{Pods: c.Query("pods") == "true", PolicyTraffic: c.Query("policyTraffic") == "true", Page: query}
+	if kinds := c.Query("kinds"); kinds != "" {
+		opts.Kinds = strings.Split(kinds, ",")
+	}
+
+	context, err := clusterManager.GetContext(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting context")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+		return
+	}
+
+	restConfig, err := context.RESTConfig()
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting REST config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get REST config: %v", err)})
+		return
+	}
+
+	canvasController, err := canvas.NewController(restConfig)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "creating canvas controller")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create canvas controller: %v", err)})
 		return
 	}
 
+	response, err := canvasController.GetNamespaceGraph(c.Request.Context(), namespace, opts)
+	if err != nil {
+		if errors.Is(err, listing.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName, "namespace": namespace}, err, "getting namespace graph")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get namespace graph: %v", err)})
+		return
+	}
+
+	policy.AnnotateGraph(clusterName, &response.GraphResponse)
 	c.JSON(http.StatusOK, response)
 }
+
+// SaveCanvasSnapshot saves the current graph of a resource under a name, e.g. a release
+func SaveCanvasSnapshot(c *gin.Context) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Name       string                    `json:"name" binding:"required"`
+		Resource   canvas.ResourceIdentifier `json:"resource"`
+		AttackPath bool                      `json:"attackPath"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if req.Resource.Group == "core" {
+		req.Resource.Group = ""
+	}
+
+	clusterName := c.Param("clusterName")
+	// Snapshots are of the cluster as it is, not of a cached graph
+	_, graph, ok := buildCanvasGraph(c, clusterName, req.Resource, canvas.GraphOptions{AttackPath: req.AttackPath}, true)
+	if !ok {
+		return
+	}
+
+	snapshot, err := canvas.GetSnapshotStore().Save(req.Name, clusterName, req.Resource, req.AttackPath, graph)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, snapshot.SnapshotSummary)
+}
+
+// ListCanvasSnapshots lists the saved graphs of a cluster without their nodes and edges
+func ListCanvasSnapshots(c *gin.Context) {
+	snapshots, err := canvas.GetSnapshotStore().List(c.Param("clusterName"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "snapshots", snapshots, nil)
+}
+
+// GetCanvasSnapshot returns a saved graph
+func GetCanvasSnapshot(c *gin.Context) {
+	snapshot, err := canvas.GetSnapshotStore().Get(c.Param("clusterName"), c.Param("id"))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// DeleteCanvasSnapshot removes a saved graph
+func DeleteCanvasSnapshot(c *gin.Context) {
+	if err := canvas.GetSnapshotStore().Delete(c.Param("clusterName"), c.Param("id")); err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DiffCanvasSnapshot compares the current graph of a snapshot's resource with the snapshot,
+// listing the nodes and edges added and removed since
+func DiffCanvasSnapshot(c *gin.Context) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	clusterName := c.Param("clusterName")
+	snapshot, err := canvas.GetSnapshotStore().Get(clusterName, c.Param("id"))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+
+	_, graph, ok := buildCanvasGraph(c, clusterName, snapshot.Resource, canvas.GraphOptions{AttackPath: snapshot.AttackPath}, c.Query("refresh") == "true")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, canvas.DiffGraphs(snapshot, graph))
+}
+
+func writeSnapshotError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, canvas.ErrSnapshotNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// GetResourceDrift compares a live resource to a YAML or JSON manifest, or to its last-applied
+// configuration without one, listing the fields modified, missing and to be pruned
+func GetResourceDrift(c *gin.Context) {
+	var req struct {
+		Resource canvas.ResourceIdentifier `json:"resource"`
+		Manifest string                    `json:"manifest"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if req.Resource.Group == "core" {
+		req.Resource.Group = ""
+	}
+	if req.Resource.Version == "" || req.Resource.ResourceType == "" || req.Resource.ResourceName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource needs a version, resource_type and resource_name"})
+		return
+	}
+	var manifest map[string]interface{}
+	if strings.TrimSpace(req.Manifest) != "" {
+		if err := yaml.Unmarshal([]byte(req.Manifest), &manifest); err != nil || manifest == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid manifest: %v", err)})
+			return
+		}
+	}
+
+	canvasController, ok := requestCanvasController(c)
+	if !ok {
+		return
+	}
+	report, err := canvasController.GetDrift(c.Request.Context(), req.Resource, manifest)
+	if err != nil {
+		switch {
+		case errors.Is(err, canvas.ErrNoDesiredState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case apierrors.IsNotFound(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			logger.Log(logger.LevelError, map[string]string{"clusterName": c.Param("clusterName")}, err, "detecting drift")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to detect drift: %v", err)})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// requestCanvasController returns the canvas controller of the cluster of the request, answering the
+// request when there is none
+func requestCanvasController(c *gin.Context) (*canvas.Controller, bool) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	clusterName := c.Param("clusterName")
+	context, err := clusterManager.GetContext(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting context")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+		return nil, false
+	}
+
+	restConfig, err := context.RESTConfig()
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting REST config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get REST config: %v", err)})
+		return nil, false
+	}
+
+	canvasController, err := canvas.NewController(restConfig)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "creating canvas controller")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create canvas controller: %v", err)})
+		return nil, false
+	}
+	return canvasController, true
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/carbon"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type CarbonHandler struct {
+	manager *carbon.Manager
+}
+
+func NewCarbonHandler(kubeConfigStore kubeconfig.ContextStore) *CarbonHandler {
+	manager := carbon.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &CarbonHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the footprint estimation settings
+func (h *CarbonHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the footprint estimation settings
+func (h *CarbonHandler) UpdateSettings(c *gin.Context) {
+	var settings carbon.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListProfiles returns the instance type power profiles, user profiles first
+func (h *CarbonHandler) ListProfiles(c *gin.Context) {
+	profiles, err := carbon.Profiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "profiles", profiles, nil)
+}
+
+// GetEstimate returns the current power draw and emission rate of a cluster per node and namespace
+func (h *CarbonHandler) GetEstimate(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	estimate, err := h.manager.Estimate(c.Request.Context(), clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to estimate carbon footprint")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// GetTrend returns the sampled energy and emissions of a cluster, ?groupBy=namespace&step=day&since=168h
+func (h *CarbonHandler) GetTrend(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	since := 24 * time.Hour
+	if value := c.Query("since"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a positive duration, e.g. 168h"})
+			return
+		}
+		since = duration
+	}
+
+	series, err := h.manager.Trend(clusterName, c.Query("groupBy"), c.Query("step"), time.Now().Add(-since))
+	if errors.Is(err, carbon.ErrInvalidTrend) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to read carbon footprint trend")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "series", series, gin.H{"cluster": clusterName})
+}
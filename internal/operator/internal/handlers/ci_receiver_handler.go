@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/auth"
+	"github.com/agentkube/operator/pkg/ephemeral"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/gin-gonic/gin"
+)
+
+type CIReceiverHandler struct {
+	manager *ephemeral.Manager
+}
+
+func NewCIReceiverHandler(kubeConfigStore kubeconfig.ContextStore) *CIReceiverHandler {
+	manager := ephemeral.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &CIReceiverHandler{
+		manager: manager,
+	}
+}
+
+// RegisterEnvironment adds the kubeconfig of an ephemeral environment pushed by CI, authenticated
+// by a receiver token, until its TTL expires
+func (h *CIReceiverHandler) RegisterEnvironment(c *gin.Context) {
+	token, err := auth.GetTokenFromHeaders(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ephemeral.Registration
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	environment, err := h.manager.Register(token, req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ephemeral.ErrTokenInvalid) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, environment)
+}
+
+// RemoveEnvironment removes an ephemeral environment before its TTL expires, e.g. when CI tears
+// down the preview
+func (h *CIReceiverHandler) RemoveEnvironment(c *gin.Context) {
+	token, err := auth.GetTokenFromHeaders(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.manager.Remove(token, c.Param("name")); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ephemeral.ErrTokenInvalid):
+			status = http.StatusUnauthorized
+		case errors.Is(err, ephemeral.ErrEnvironmentNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListEnvironments lists the ephemeral environments registered by CI
+func (h *CIReceiverHandler) ListEnvironments(c *gin.Context) {
+	writeList(c, "environments", h.manager.List(), nil)
+}
+
+// IssueToken creates a receiver token for a CI system, returned only in this response
+func (h *CIReceiverHandler) IssueToken(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	token, secret, err := h.manager.IssueToken(req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":  token,
+		"secret": secret,
+		"header": auth.AuthorizationHeader,
+	})
+}
+
+// ListTokens lists the receiver tokens without their secrets
+func (h *CIReceiverHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.manager.ListTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "tokens", tokens, nil)
+}
+
+// RevokeToken deletes a receiver token
+func (h *CIReceiverHandler) RevokeToken(c *gin.Context) {
+	if err := h.manager.RevokeToken(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/cloudimport"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type CloudImportHandler struct {
+	importer *cloudimport.Importer
+}
+
+func NewCloudImportHandler(kubeConfigStore kubeconfig.ContextStore) *CloudImportHandler {
+	return &CloudImportHandler{
+		importer: cloudimport.NewImporter(kubeConfigStore),
+	}
+}
+
+// ListProviders returns the cloud providers clusters can be imported from and whether their CLI and
+// token plugin are installed on the server
+func (h *CloudImportHandler) ListProviders(c *gin.Context) {
+	writeList(c, "providers", cloudimport.Providers(), nil)
+}
+
+// Discover lists the EKS, GKE or AKS clusters the credentials of the request, or the ambient ones
+// of the server, can see, without importing them
+func (h *CloudImportHandler) Discover(c *gin.Context) {
+	var req cloudimport.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	clusters, err := h.importer.Discover(c.Request.Context(), req)
+	if err != nil {
+		writeCloudImportError(c, req.Provider, err)
+		return
+	}
+
+	writeList(c, "clusters", clusters, gin.H{"provider": req.Provider})
+}
+
+// Import adds the clusters of a provider as contexts, all of them or those named in the request.
+// Their tokens are generated by the token plugin of the provider.
+func (h *CloudImportHandler) Import(c *gin.Context) {
+	var req cloudimport.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	result, err := h.importer.Import(c.Request.Context(), req)
+	if err != nil {
+		writeCloudImportError(c, req.Provider, err)
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"provider": req.Provider,
+		"contexts": strings.Join(result.Imported, ","),
+	}, nil, "Imported cloud clusters")
+
+	status := http.StatusOK
+	if len(result.Imported) > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"success":       true,
+		"message":       fmt.Sprintf("Imported %d cluster(s), skipped %d existing", len(result.Imported), len(result.Skipped)),
+		"contextsAdded": result.Imported,
+		"skipped":       result.Skipped,
+		"warnings":      result.Warnings,
+	})
+}
+
+func writeCloudImportError(c *gin.Context, provider string, err error) {
+	switch {
+	case errors.Is(err, cloudimport.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, cloudimport.ErrClusterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, cloudimport.ErrCLIUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		logger.Log(logger.LevelError, map[string]string{"provider": provider}, err, "Cloud cluster import failed")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/compliance"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type ComplianceHandler struct {
+	manager *compliance.Manager
+}
+
+func NewComplianceHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *ComplianceHandler {
+	manager := compliance.NewManager(kubeConfigStore, queue)
+
+	// Register the benchmark run processor
+	queue.RegisterProcessor(compliance.OperationRun, compliance.NewRunProcessor(manager))
+
+	return &ComplianceHandler{
+		manager: manager,
+	}
+}
+
+// RunBenchmark queues a CIS benchmark run against a cluster, through API inspection by default or
+// with kube-bench run as a Job on a node
+func (h *ComplianceHandler) RunBenchmark(c *gin.Context) {
+	var req compliance.RunRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+	}
+
+	clusterName := c.Param("clusterName")
+	// kube-bench creates a Job, API inspection only reads
+	if req.Source == compliance.SourceKubeBench && rejectReadOnly(c, clusterName) {
+		return
+	}
+
+	operation, err := h.manager.Run(clusterName, req)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, compliance.ErrInvalidSource) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"operationId": operation.ID,
+	}, nil, "Queued compliance benchmark run")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "compliance benchmark started",
+		"operationId": operation.ID,
+	})
+}
+
+// GetComplianceReport returns the latest benchmark report of a cluster
+func (h *ComplianceHandler) GetComplianceReport(c *gin.Context) {
+	report, err := h.manager.Report(c.Param("clusterName"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, compliance.ErrNoReport) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, report)
+}
+
+// ListComplianceControls lists the controls of the latest report of a cluster, filtered and sorted
+// by the query parameters
+func (h *ComplianceHandler) ListComplianceControls(c *gin.Context) {
+	report, err := h.manager.Report(c.Param("clusterName"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, compliance.ErrNoReport) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "controls", report.Controls, gin.H{
+		"cluster":   report.Cluster,
+		"benchmark": report.Benchmark,
+		"score":     report.Score,
+	})
+}
+
+// ListComplianceSummaries lists the score and totals of the latest report of every cluster
+func (h *ComplianceHandler) ListComplianceSummaries(c *gin.Context) {
+	summaries, err := h.manager.Summaries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "reports", summaries, nil)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/cost"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type CostHandler struct {
+	manager *cost.Manager
+}
+
+func NewCostHandler(kubeConfigStore kubeconfig.ContextStore) *CostHandler {
+	return &CostHandler{
+		manager: cost.NewManager(kubeConfigStore),
+	}
+}
+
+// GetSettings returns the cost estimation settings
+func (h *CostHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the cost estimation settings
+func (h *CostHandler) UpdateSettings(c *gin.Context) {
+	var settings cost.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListPrices returns the instance prices applied with the current settings, configured prices first
+func (h *CostHandler) ListPrices(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "prices", cost.Prices(settings), gin.H{"currency": settings.Currency})
+}
+
+// GetEstimate returns the monthly cost of a cluster per node, namespace and workload
+func (h *CostHandler) GetEstimate(c *gin.Context) {
+	estimate, ok := h.estimate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// ListNamespaces returns the monthly cost of the namespaces of a cluster for showback, most expensive
+// first, the unallocated capacity as the (idle) namespace
+func (h *CostHandler) ListNamespaces(c *gin.Context) {
+	estimate, ok := h.estimate(c)
+	if !ok {
+		return
+	}
+
+	writeList(c, "namespaces", estimate.Namespaces, gin.H{
+		"cluster":     estimate.Cluster,
+		"currency":    estimate.Currency,
+		"monthlyCost": estimate.MonthlyCost,
+	})
+}
+
+// ListWorkloads returns the monthly cost of the workloads of a cluster, or of a namespace with
+// ?namespace=shop, most expensive first
+func (h *CostHandler) ListWorkloads(c *gin.Context) {
+	estimate, ok := h.estimate(c)
+	if !ok {
+		return
+	}
+
+	workloads := estimate.Workloads
+	if namespace := c.Query("namespace"); namespace != "" {
+		workloads = []cost.WorkloadCost{}
+		for _, workload := range estimate.Workloads {
+			if workload.Namespace == namespace {
+				workloads = append(workloads, workload)
+			}
+		}
+	}
+
+	writeList(c, "workloads", workloads, gin.H{
+		"cluster":     estimate.Cluster,
+		"currency":    estimate.Currency,
+		"monthlyCost": estimate.MonthlyCost,
+	})
+}
+
+func (h *CostHandler) estimate(c *gin.Context) (*cost.Estimate, bool) {
+	clusterName := c.Param("clusterName")
+
+	estimate, err := h.manager.Estimate(c.Request.Context(), clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to estimate cost")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return estimate, true
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/internal/multiplexer"
+	"github.com/agentkube/operator/pkg/debugpod"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// debugTimeout bounds adding the debug container to the pod
+	debugTimeout = 30 * time.Second
+	// debugWaitTimeout bounds waiting for the debug container to start, past it the container is
+	// reported waiting and clients poll the pod
+	debugWaitTimeout = 20 * time.Second
+)
+
+type DebugHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewDebugHandler(kubeConfigStore kubeconfig.ContextStore) *DebugHandler {
+	return &DebugHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// DebugPod launches an ephemeral debug container in a running pod and returns how to connect to
+// it through the multiplexer: the attach connection of its terminal, and an EXEC message running
+// a shell in it. Debugging is refused on read-only clusters, like exec.
+func (h *DebugHandler) DebugPod(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	namespace, podName := c.Param("namespace"), c.Param("pod")
+
+	var req debugpod.Request
+	// The body is optional, a request without one launches the default debug container
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid debug request: " + err.Error()})
+			return
+		}
+	}
+	if rejectReadOnly(c, clusterName) {
+		return
+	}
+
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create clientset: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), debugTimeout+debugWaitTimeout)
+	defer cancel()
+	launchCtx, cancelLaunch := context.WithTimeout(ctx, debugTimeout)
+	defer cancelLaunch()
+	result, err := debugpod.Launch(launchCtx, clientset, namespace, podName, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, debugpod.ErrInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, debugpod.ErrPodNotRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case apierrors.IsNotFound(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":   clusterName,
+		"namespace": namespace,
+		"pod":       podName,
+		"container": result.Container,
+		"image":     result.Image,
+		"profile":   result.Profile,
+	}, nil, "launched debug container")
+
+	if err := debugpod.Wait(ctx, clientset, result, debugWaitTimeout); err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName, "pod": podName}, err, "waiting for debug container")
+	}
+
+	// The EXEC message a client sends the multiplexer for a shell in the debug container
+	execData, _ := json.Marshal(multiplexer.ExecRequest{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: result.Container,
+		Command:   []string{"sh"},
+		TTY:       true,
+	})
+	c.JSON(http.StatusCreated, gin.H{
+		"debug": result,
+		"exec":  multiplexer.Message{ClusterID: clusterName, Type: multiplexer.MessageExec, Data: string(execData)},
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/demo"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDemoClusterHandler returns the state of the demo cluster
+func GetDemoClusterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, demo.GetStatus())
+	}
+}
+
+// StartDemoClusterHandler starts the demo cluster and adds the demo context
+func StartDemoClusterHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		demoContext, err := demo.Start(kubeConfigStore)
+		if errors.Is(err, demo.ErrContextExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "starting demo cluster")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Demo cluster started",
+			"context": demoContext.Name,
+			"status":  demo.GetStatus(),
+		})
+	}
+}
+
+// ResetDemoClusterHandler brings back the seeded resources of the demo cluster
+func ResetDemoClusterHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := demo.Reset(); errors.Is(err, demo.ErrNotRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Demo cluster reset"})
+	}
+}
+
+// StopDemoClusterHandler removes the demo context and stops the demo cluster
+func StopDemoClusterHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := demo.Stop(kubeConfigStore); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Demo cluster stopped"})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/disruption"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type DisruptionHandler struct {
+	simulator *disruption.Simulator
+}
+
+func NewDisruptionHandler(kubeConfigStore kubeconfig.ContextStore) *DisruptionHandler {
+	return &DisruptionHandler{
+		simulator: disruption.NewSimulator(kubeConfigStore),
+	}
+}
+
+// SimulateDisruption simulates a node drain or zone outage and reports availability violations
+func (h *DisruptionHandler) SimulateDisruption(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req disruption.SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := h.simulator.Simulate(clusterName, req)
+	if errors.Is(err, disruption.ErrInvalidRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster":  clusterName,
+			"scenario": req.Scenario,
+		}, err, "Failed to simulate disruption")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to simulate disruption: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conditionalWrites serializes the precondition check and the write of conditional requests, so that two
+// clients holding the same ETag cannot both update an entity
+var conditionalWrites sync.Mutex
+
+// entityTag returns a strong ETag for the JSON representation of an entity
+func entityTag(entity interface{}) string {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// writeEntity responds with an entity and its ETag. A GET whose If-None-Match matches gets 304.
+func writeEntity(c *gin.Context, status int, entity interface{}) {
+	tag := entityTag(entity)
+	c.Header("ETag", tag)
+	if c.Request.Method == http.MethodGet && matchesETag(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(status, entity)
+}
+
+// preconditionFailed checks If-Match and If-None-Match against the current entity, nil when it does not
+// exist, and responds with 412 when they do not hold. "If-None-Match: *" makes a PUT create-only.
+func preconditionFailed(c *gin.Context, current interface{}) bool {
+	exists := current != nil
+	tag := ""
+	if exists {
+		tag = entityTag(current)
+	}
+
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && (!exists || !matchesETag(ifMatch, tag)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "entity was modified or does not exist, If-Match does not hold"})
+		return true
+	}
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && exists && matchesETag(ifNoneMatch, tag) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "entity already exists, If-None-Match does not hold"})
+		return true
+	}
+	return false
+}
+
+// matchesETag reports whether an If-Match or If-None-Match header lists the tag
+func matchesETag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || (tag != "" && candidate == tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatchesETag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		header string
+		tag    string
+		want   bool
+	}{
+		{name: "exact", header: `"abc"`, tag: `"abc"`, want: true},
+		{name: "weak prefix", header: `W/"abc"`, tag: `"abc"`, want: true},
+		{name: "list", header: `"xyz", W/"abc"`, tag: `"abc"`, want: true},
+		{name: "list without tag", header: `"xyz","def"`, tag: `"abc"`},
+		{name: "wildcard", header: "*", tag: `"abc"`, want: true},
+		{name: "wildcard without entity", header: "*", want: true},
+		{name: "missing entity", header: `"abc"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matchesETag(tt.header, tt.tag); got != tt.want {
+				t.Errorf("matchesETag(%q, %q) = %v, want %v", tt.header, tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+
+	entity := map[string]string{"name": "shop"}
+	tag := entityTag(entity)
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		current    interface{}
+		wantFailed bool
+	}{
+		{name: "no precondition", current: entity},
+		{name: "if-match holds", headers: map[string]string{"If-Match": tag}, current: entity},
+		{name: "if-match weak list holds", headers: map[string]string{"If-Match": `"stale", W/` + tag}, current: entity},
+		{name: "if-match stale", headers: map[string]string{"If-Match": `"stale"`}, current: entity, wantFailed: true},
+		{name: "if-match on missing entity", headers: map[string]string{"If-Match": tag}, wantFailed: true},
+		{name: "if-match wildcard on missing entity", headers: map[string]string{"If-Match": "*"}, wantFailed: true},
+		{name: "if-none-match wildcard on existing entity", headers: map[string]string{"If-None-Match": "*"}, current: entity, wantFailed: true},
+		{name: "if-none-match wildcard creates", headers: map[string]string{"If-None-Match": "*"}},
+		{name: "if-none-match other tag", headers: map[string]string{"If-None-Match": `"stale"`}, current: entity},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPut, "/entity", nil)
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+
+			if got := preconditionFailed(c, tt.current); got != tt.wantFailed {
+				t.Fatalf("preconditionFailed() = %v, want %v", got, tt.wantFailed)
+			}
+			if tt.wantFailed && recorder.Code != http.StatusPreconditionFailed {
+				t.Errorf("status = %d, want 412", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestWriteEntity(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+
+	entity := map[string]string{"name": "shop"}
+	tag := entityTag(entity)
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "get not modified", method: http.MethodGet, ifNoneMatch: tag, wantStatus: http.StatusNotModified},
+		{name: "get weak not modified", method: http.MethodGet, ifNoneMatch: "W/" + tag, wantStatus: http.StatusNotModified},
+		{name: "get modified", method: http.MethodGet, ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+		{name: "put ignores if-none-match", method: http.MethodPut, ifNoneMatch: tag, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(tt.method, "/entity", nil)
+			if tt.ifNoneMatch != "" {
+				c.Request.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			writeEntity(c, http.StatusOK, entity)
+			c.Writer.WriteHeaderNow()
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if got := recorder.Header().Get("ETag"); got != tag {
+				t.Errorf("ETag = %q, want %q", got, tag)
+			}
+			if tt.wantStatus == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Errorf("body = %q, want none", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/eventstream"
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval is how often an idle stream sends a comment, so proxies don't close it
+const keepAliveInterval = 15 * time.Second
+
+type EventStreamHandler struct {
+	broker *eventstream.Broker
+}
+
+func NewEventStreamHandler() *EventStreamHandler {
+	broker := eventstream.GetBroker()
+
+	// Stream the events the watchers dispatch to the open streams
+	controller.AddEventListener(broker.Publish)
+
+	return &EventStreamHandler{
+		broker: broker,
+	}
+}
+
+// StreamEvents streams the watcher events of a cluster as Server-Sent Events,
+// ?namespace=a,b&kind=Pod&severity=Warning,Danger. Events are sent as "event" messages in the v2
+// schema, a "dropped" message counts the events skipped when the client fell behind.
+func (h *EventStreamHandler) StreamEvents(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	filter, err := eventstream.ParseFilter(c.Query("namespace"), c.Query("kind"), c.Query("severity"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription := h.broker.Subscribe(clusterName, filter)
+	defer h.broker.Unsubscribe(subscription)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case document := <-subscription.Events:
+			if dropped := subscription.Dropped(); dropped > 0 {
+				c.SSEvent("dropped", gin.H{"count": dropped})
+			}
+			c.SSEvent("event", document)
+			return true
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recording"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -48,6 +49,11 @@ func TerminalHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
 			return
 		}
 
+		// Exec runs commands in the container, which read-only contexts do not allow
+		if rejectReadOnly(c, clusterName) {
+			return
+		}
+
 		// Upgrade connection to WebSocket
 		ws, err := shellUpgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
@@ -123,6 +129,21 @@ fi
 			return
 		}
 
+		// Record the session when session recording is enabled, sessions that cannot be recorded are refused
+		recorder, err := recording.GetManager().StartSession(recording.Session{
+			Source:    recording.SourceKubectlExec,
+			Cluster:   clusterName,
+			Namespace: namespace,
+			Pod:       podName,
+			Container: containerName,
+		}, 0, 0)
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"cluster": clusterName, "pod": podName}, err, "starting session recording")
+			sendErrorMessage(ws, fmt.Sprintf("Error starting session recording: %v", err))
+			return
+		}
+		defer recorder.Close()
+
 		// Start the command
 		if err := cmd.Start(); err != nil {
 			sendErrorMessage(ws, fmt.Sprintf("Error starting command: %v", err))
@@ -146,6 +167,7 @@ fi
 					break
 				}
 				if n > 0 {
+					recorder.Output(buf[:n])
 					msg := ShellMessage{
 						Type: "stdout",
 						Data: json.RawMessage(fmt.Sprintf("%q", string(buf[:n]))),
@@ -168,6 +190,7 @@ fi
 					break
 				}
 				if n > 0 {
+					recorder.Output(buf[:n])
 					msg := ShellMessage{
 						Type: "stderr",
 						Data: json.RawMessage(fmt.Sprintf("%q", string(buf[:n]))),
@@ -197,6 +220,7 @@ fi
 						logger.Log(logger.LevelError, nil, err, "unmarshaling stdin data")
 						continue
 					}
+					recorder.Input([]byte(data))
 					if _, err := stdin.Write([]byte(data)); err != nil {
 						logger.Log(logger.LevelError, nil, err, "writing to stdin")
 						// Don't break here, allow retrying for transient errors
@@ -214,6 +238,7 @@ fi
 						// Send stty command to resize terminal
 						sttyCmd := fmt.Sprintf("stty rows %d columns %d\n", resizeData.Height, resizeData.Width)
 						stdin.Write([]byte(sttyCmd))
+						recorder.Resize(resizeData.Width, resizeData.Height)
 						logger.Log(logger.LevelInfo, nil, nil, fmt.Sprintf("Terminal resize: %dx%d", resizeData.Width, resizeData.Height))
 					}
 
@@ -106,6 +106,11 @@ func ExternalShellHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFu
 			return
 		}
 
+		// The command runs unchecked in a terminal with the cluster context selected
+		if rejectReadOnly(c, clusterName) {
+			return
+		}
+
 		// Get context for the cluster to prepare kubectl commands
 		_, err := kubeConfigStore.GetContext(clusterName)
 		if err != nil {
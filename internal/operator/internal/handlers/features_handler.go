@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/features"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature rejects requests to the routes of a subsystem whose feature flag is disabled
+func RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !features.Enabled(name) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "feature " + name + " is disabled", "feature": name})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListFeatures returns the resolved state of every feature flag with the active profile
+func ListFeatures(c *gin.Context) {
+	store := features.GetStore()
+	states, err := store.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	config, err := store.Config()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "features", states, gin.H{"profile": config.Profile})
+}
+
+// ListFeatureProfiles returns the built-in and custom feature profiles
+func ListFeatureProfiles(c *gin.Context) {
+	config, err := features.GetStore().Config()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	names, err := features.GetStore().Profiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"active": config.Profile, "profiles": names, "custom": config.Profiles})
+}
+
+// SetFeatureProfile activates a feature profile
+func SetFeatureProfile(c *gin.Context) {
+	var req struct {
+		Profile string `json:"profile" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := features.GetStore().SetProfile(req.Profile); err != nil {
+		writeFeatureError(c, err)
+		return
+	}
+	ListFeatures(c)
+}
+
+// SaveFeatureProfile creates or replaces a custom feature profile
+func SaveFeatureProfile(c *gin.Context) {
+	var req struct {
+		Features map[string]bool `json:"features" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	profile := c.Param("name")
+	if err := features.GetStore().SaveProfile(profile, req.Features); err != nil {
+		writeFeatureError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"profile": profile, "features": req.Features})
+}
+
+// DeleteFeatureProfile removes a custom feature profile
+func DeleteFeatureProfile(c *gin.Context) {
+	if err := features.GetStore().DeleteProfile(c.Param("name")); err != nil {
+		writeFeatureError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetFeatureOverride forces a feature on or off at runtime, regardless of the profile
+func SetFeatureOverride(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := features.GetStore().SetOverride(c.Param("name"), *req.Enabled); err != nil {
+		writeFeatureError(c, err)
+		return
+	}
+	ListFeatures(c)
+}
+
+// ClearFeatureOverride returns a feature to the state of the active profile
+func ClearFeatureOverride(c *gin.Context) {
+	if err := features.GetStore().ClearOverride(c.Param("name")); err != nil {
+		writeFeatureError(c, err)
+		return
+	}
+	ListFeatures(c)
+}
+
+func writeFeatureError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, features.ErrUnknownFlag), errors.Is(err, features.ErrUnknownProfile):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, features.ErrBuiltinProfile):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/fleet"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// maxFleetManifestBytes bounds the size of an uploaded fleet manifest
+const maxFleetManifestBytes = 4 << 20
+
+// FleetClusterResult is the onboarding result of a cluster of a fleet manifest
+type FleetClusterResult struct {
+	Name          string            `json:"name"`
+	Success       bool              `json:"success"`
+	Message       string            `json:"message"`
+	ContextsAdded []string          `json:"contextsAdded,omitempty"`
+	Errors        []string          `json:"errors,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// FleetOnboardResponse reports the onboarding of every cluster of a fleet manifest
+type FleetOnboardResponse struct {
+	Total     int                  `json:"total"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+	Clusters  []FleetClusterResult `json:"clusters"`
+	// WatcherUpdated tells the watched cluster lists changed, they apply when the watchers restart
+	WatcherUpdated bool   `json:"watcherUpdated"`
+	WatcherError   string `json:"watcherError,omitempty"`
+}
+
+// OnboardFleetHandler onboards the clusters of a fleet manifest, in YAML or JSON, in one operation.
+// A cluster that fails doesn't stop the others, each gets its own result.
+func OnboardFleetHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxFleetManifestBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read manifest: " + err.Error()})
+			return
+		}
+		if len(data) > maxFleetManifestBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("manifest is larger than %d bytes", maxFleetManifestBytes)})
+			return
+		}
+		manifest, err := fleet.ParseManifest(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := FleetOnboardResponse{Total: len(manifest.Clusters), Clusters: []FleetClusterResult{}}
+		watched := map[bool][]string{}
+		for _, cluster := range manifest.Clusters {
+			result := onboardFleetCluster(c.Request.Context(), kubeConfigStore, cluster)
+			if result.Success {
+				response.Succeeded++
+				if cluster.Watch != nil {
+					watched[*cluster.Watch] = append(watched[*cluster.Watch], result.ContextsAdded...)
+				}
+			} else {
+				response.Failed++
+			}
+			response.Clusters = append(response.Clusters, result)
+		}
+
+		if len(watched) > 0 {
+			if err := updateFleetWatch(watched); err != nil {
+				logger.Log(logger.LevelError, nil, err, "updating watched clusters of the fleet")
+				response.WatcherError = err.Error()
+			} else {
+				response.WatcherUpdated = true
+			}
+		}
+
+		logger.Log(logger.LevelInfo, map[string]string{
+			"succeeded": fmt.Sprint(response.Succeeded),
+			"failed":    fmt.Sprint(response.Failed),
+		}, nil, "Onboarded fleet manifest")
+
+		status := http.StatusOK
+		if response.Succeeded == 0 {
+			status = http.StatusBadRequest
+		} else if response.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		c.JSON(status, response)
+	}
+}
+
+// ListContextLabelsHandler returns the labels of the contexts, narrowed by a label selector
+func ListContextLabelsHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		selector, err := labels.Parse(c.Query("selector"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selector: " + err.Error()})
+			return
+		}
+		selected, err := fleet.GetLabelStore().Select(selector)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read context labels: " + err.Error()})
+			return
+		}
+		// Contexts deleted outside the operator keep their labels until they are onboarded again
+		for contextName := range selected {
+			if _, err := kubeConfigStore.GetContext(contextName); err != nil {
+				delete(selected, contextName)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"contexts": selected, "count": len(selected)})
+	}
+}
+
+// onboardFleetCluster adds the contexts of a cluster of a fleet manifest and applies its settings
+func onboardFleetCluster(ctx context.Context, kubeConfigStore kubeconfig.ContextStore, cluster fleet.Cluster) FleetClusterResult {
+	result := FleetClusterResult{Name: cluster.Name, Labels: cluster.Labels}
+
+	content, err := fleetKubeconfig(ctx, kubeConfigStore, cluster)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	upload := processKubeconfigContent(content, cluster.Name, cluster.TTL, kubeConfigStore)
+	result.Success = upload.Success
+	result.Message = upload.Message
+	result.ContextsAdded = upload.ContextsAdded
+	result.Errors = upload.Errors
+
+	for _, contextName := range upload.ContextsAdded {
+		if err := fleet.GetLabelStore().Set(contextName, cluster.Labels); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Failed to label context '%s': %v", contextName, err))
+		}
+		if cluster.ReadOnly {
+			if err := readonly.GetStore().Set(contextName, true); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to mark context '%s' read-only: %v", contextName, err))
+			}
+		}
+	}
+	return result
+}
+
+// fleetKubeconfig reads the kubeconfig of a cluster from its file or its secret
+func fleetKubeconfig(ctx context.Context, kubeConfigStore kubeconfig.ContextStore, cluster fleet.Cluster) (string, error) {
+	if cluster.SecretRef == nil {
+		path := cluster.KubeconfigPath
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to expand %s: %v", path, err)
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read kubeconfig: %v", err)
+		}
+		return string(data), nil
+	}
+
+	ref := cluster.SecretRef
+	source, err := kubeConfigStore.GetContext(ref.Context)
+	if err != nil {
+		return "", fmt.Errorf("context %s of the secret is not registered", ref.Context)
+	}
+	clientset, err := source.ClientSetWithToken("")
+	if err != nil {
+		return "", fmt.Errorf("failed to create client for context %s: %v", ref.Context, err)
+	}
+	secret, err := clientset.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+	key := ref.Key
+	if key == "" {
+		key = fleet.DefaultSecretKey
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", ref.Namespace, ref.Name, key)
+	}
+	return string(data), nil
+}
+
+// updateFleetWatch adds the onboarded contexts to the watched clusters, or skips them
+func updateFleetWatch(watched map[bool][]string) error {
+	conf, err := config.New()
+	if err != nil {
+		return fmt.Errorf("failed to load watcher config: %w", err)
+	}
+	for watch, contexts := range watched {
+		fleet.ApplyWatch(conf, contexts, watch)
+	}
+	if err := conf.Write(); err != nil {
+		return fmt.Errorf("failed to write watcher config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/grafana"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type GrafanaHandler struct {
+	manager *grafana.Manager
+}
+
+func NewGrafanaHandler(kubeConfigStore kubeconfig.ContextStore) *GrafanaHandler {
+	manager := grafana.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &GrafanaHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the Grafana integration settings without the API token
+func (h *GrafanaHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings.Redacted())
+}
+
+// UpdateSettings replaces the Grafana integration settings
+func (h *GrafanaHandler) UpdateSettings(c *gin.Context) {
+	var settings grafana.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{"url": settings.URL}, nil, "Updated Grafana integration settings")
+	c.JSON(http.StatusOK, settings.Redacted())
+}
+
+// Sync provisions the dashboards of every cluster now instead of waiting for the next periodic sync
+func (h *GrafanaHandler) Sync(c *gin.Context) {
+	result, err := h.manager.Sync(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, grafana.ErrDisabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.LevelError, nil, err, "Failed to provision Grafana dashboards")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetStatus returns the result of the last dashboard provisioning run
+func (h *GrafanaHandler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"lastSync": h.manager.LastSync(),
+	})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,11 +15,16 @@ import (
 
 	"github.com/agentkube/operator/internal/multiplexer"
 	"github.com/agentkube/operator/internal/stateless"
+	"github.com/agentkube/operator/pkg/approvals"
 	"github.com/agentkube/operator/pkg/command"
 	"github.com/agentkube/operator/pkg/config"
 	"github.com/agentkube/operator/pkg/extensions"
+	"github.com/agentkube/operator/pkg/fleet"
 	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
+	"github.com/agentkube/operator/pkg/redact"
+	"github.com/agentkube/operator/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -34,9 +41,20 @@ var cmdExecutor *command.CommandExecutor
 // InitializeWebSocketHandler initializes the WebSocket handler with the given kubeconfig store
 func InitializeWebSocketHandler(kubeConfigStore kubeconfig.ContextStore, cfg config.Config) {
 	wsMultiplexer = multiplexer.NewMultiplexer(kubeConfigStore)
+	// Exec and attach sessions change the cluster, refuse them on read-only contexts
+	wsMultiplexer.SetExecAuthorizer(func(r *http.Request, clusterID string) error {
+		return readOnlyError(r, clusterID)
+	})
 	clusterManager = stateless.NewClusterManager(kubeConfigStore, cfg.EnableDynamicClusters)
 }
 
+// EnableOperationProgress lets WebSocket clients subscribe to the progress of the queue's operations
+func EnableOperationProgress(queue *utils.Queue) {
+	if wsMultiplexer != nil {
+		wsMultiplexer.SetOperationQueue(queue)
+	}
+}
+
 // InitializeCommandExecutor initializes the command executor with the given kubeconfig store
 func InitializeCommandExecutor(kubeConfigStore kubeconfig.ContextStore) {
 	cmdExecutor = command.NewCommandExecutor(kubeConfigStore)
@@ -113,11 +131,40 @@ func ProxyHandler(c *gin.Context) {
 		"fullPath":   c.Request.URL.Path,
 	}, nil, "proxying request")
 
+	// Read-only contexts only accept requests that cannot change the cluster
+	if readonly.IsMutatingRequest(c.Request.Method, path) && rejectReadOnly(c, c.Param("clusterName")) {
+		return
+	}
+
+	// Dangerous requests are held until a second user approves them
+	var body []byte
+	if c.Request.Method == http.MethodPatch || c.Request.Method == http.MethodPut {
+		body, err = io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if requireApproval(c, approvals.NewProxyAction(c.Param("clusterName"), c.Request.Method, path, body)) {
+		return
+	}
+
 	// Modify the request path to only include the part after /clusters/{clusterName}
 	c.Request.URL.Path = path
 
+	// Redact the configured annotations and labels from resources, upgraded streams carry no resources
+	var writer http.ResponseWriter = c.Writer
+	if redact.Enabled() && c.Request.Header.Get("Upgrade") == "" {
+		c.Request.Header.Del("Accept-Encoding")
+		watch := c.Query("watch")
+		redactingWriter := redact.NewResponseWriter(c.Writer, watch == "true" || watch == "1")
+		defer redactingWriter.Close()
+		writer = redactingWriter
+	}
+
 	// Proxy the request to the Kubernetes API
-	if err := context.ProxyRequest(c.Writer, c.Request); err != nil {
+	if err := context.ProxyRequest(writer, c.Request); err != nil {
 		logger.Log(logger.LevelError, map[string]string{"contextKey": contextKey}, err, "proxying request")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to proxy request"})
 		return
@@ -153,6 +200,16 @@ func KubectlHandler(c *gin.Context) {
 		return
 	}
 
+	if rejectKubectlTarget(c, req.Command) {
+		return
+	}
+	if readonly.IsMutatingKubectl(req.Command) && rejectReadOnly(c, clusterName) {
+		return
+	}
+	if requireApproval(c, approvals.NewKubectlAction([]string{clusterName}, req.Command)) {
+		return
+	}
+
 	// Create command request with the cluster context name
 	cmdReq := command.CommandRequest{
 		Context: clusterName,
@@ -172,12 +229,55 @@ func KubectlHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// KubectlFanOutHandler runs the same kubectl command across several clusters and aggregates the results
+func KubectlFanOutHandler(c *gin.Context) {
+	var req command.FanOutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Log(logger.LevelError, nil, err, "binding request")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if rejectKubectlTarget(c, req.Command) {
+		return
+	}
+	if readonly.IsMutatingKubectl(req.Command) && rejectReadOnly(c, req.Contexts...) {
+		return
+	}
+	if requireApproval(c, approvals.NewKubectlAction(req.Contexts, req.Command)) {
+		return
+	}
+
+	result, err := cmdExecutor.ExecuteFanOut(req)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"contexts": strings.Join(req.Contexts, ",")}, err, "executing fan-out command")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 type KubeconfigUploadRequest struct {
 	Content    string `json:"content" form:"content"`
 	SourceName string `json:"sourceName" form:"sourceName"`
 	TTL        int    `json:"ttl" form:"ttl"` // TTL in hours, 0 means no expiry
 }
 
+// TokenClusterRequest registers a cluster by API server URL and bearer token, without a kubeconfig
+type TokenClusterRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Server string `json:"server" binding:"required"`
+	// CertificateAuthorityData is the PEM CA bundle, raw or base64 encoded like in kubeconfig files
+	CertificateAuthorityData string `json:"certificateAuthorityData"`
+	Token                    string `json:"token" binding:"required"`
+	Namespace                string `json:"namespace"`
+	InsecureSkipTLSVerify    bool   `json:"insecureSkipTLSVerify"`
+	TTL                      int    `json:"ttl"` // TTL in hours, 0 means no expiry
+	// SkipVerify registers the cluster without checking the API server accepts the token
+	SkipVerify bool `json:"skipVerify"`
+}
+
 // KubeconfigUploadResponse represents the response for kubeconfig operations
 type KubeconfigUploadResponse struct {
 	Success       bool     `json:"success"`
@@ -319,6 +419,82 @@ func UploadKubeconfigContentHandler(kubeConfigStore kubeconfig.ContextStore) gin
 	}
 }
 
+// RegisterTokenClusterHandler adds a context from an API server URL, CA and bearer token, for
+// programmatic onboarding from provisioning pipelines
+func RegisterTokenClusterHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TokenClusterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, KubeconfigUploadResponse{
+				Success: false,
+				Message: "Invalid request format: " + err.Error(),
+			})
+			return
+		}
+
+		if err := validateNewContextName(req.Name, kubeConfigStore); err != nil {
+			c.JSON(http.StatusBadRequest, KubeconfigUploadResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		caData, err := decodeCertificateAuthority(req.CertificateAuthorityData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, KubeconfigUploadResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tokenContext, err := kubeconfig.NewTokenContext(req.Name, req.Server, caData, strings.TrimSpace(req.Token), req.Namespace, req.InsecureSkipTLSVerify)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, KubeconfigUploadResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if !req.SkipVerify {
+			clientset, err := tokenContext.ClientSetWithToken("")
+			if err == nil {
+				_, err = clientset.Discovery().ServerVersion()
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, KubeconfigUploadResponse{
+					Success: false,
+					Message: fmt.Sprintf("Failed to reach API server %s with the token: %v", req.Server, err),
+				})
+				return
+			}
+		}
+
+		if req.TTL > 0 {
+			err = kubeConfigStore.AddContextWithKeyAndTTL(tokenContext, tokenContext.Name, time.Duration(req.TTL)*time.Hour)
+		} else {
+			err = kubeConfigStore.AddContext(tokenContext)
+		}
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"contextName": tokenContext.Name}, err, "adding token context")
+			c.JSON(http.StatusInternalServerError, KubeconfigUploadResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to add context: %v", err),
+			})
+			return
+		}
+
+		logger.Log(logger.LevelInfo, map[string]string{"contextName": tokenContext.Name, "server": req.Server}, nil, "Registered cluster by token")
+		c.JSON(http.StatusCreated, KubeconfigUploadResponse{
+			Success:       true,
+			Message:       fmt.Sprintf("Registered cluster %s", tokenContext.Name),
+			ContextsAdded: []string{tokenContext.Name},
+		})
+	}
+}
+
 // ListUploadedContextsHandler lists all contexts from uploaded kubeconfigs
 func ListUploadedContextsHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -467,6 +643,16 @@ func DeleteContextHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFu
 			response.Message = fmt.Sprintf("Context '%s' deleted successfully", contextName)
 		}
 
+		if err := readonly.GetStore().Set(contextName, false); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": contextName}, err, "clearing read-only flag of deleted context")
+		}
+		if err := kubeconfig.GetRefreshHooks().Remove(contextName); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": contextName}, err, "removing refresh hook of deleted context")
+		}
+		if err := fleet.GetLabelStore().Set(contextName, nil); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": contextName}, err, "removing labels of deleted context")
+		}
+
 		c.JSON(http.StatusOK, response)
 	}
 }
@@ -562,6 +748,16 @@ func RenameContextHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFu
 			response.Message = fmt.Sprintf("Context renamed from '%s' to '%s' in all locations", oldName, request.Name)
 		}
 
+		if err := readonly.GetStore().Rename(oldName, request.Name); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": oldName}, err, "moving read-only flag of renamed context")
+		}
+		if err := kubeconfig.GetRefreshHooks().Rename(oldName, request.Name); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": oldName}, err, "moving refresh hook of renamed context")
+		}
+		if err := fleet.GetLabelStore().Rename(oldName, request.Name); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": oldName}, err, "moving labels of renamed context")
+		}
+
 		c.JSON(http.StatusOK, response)
 	}
 }
@@ -947,6 +1143,19 @@ func removeExternalPathFromSettings(pathToRemove string) error {
 	return nil
 }
 
+// decodeCertificateAuthority accepts a PEM bundle either raw or base64 encoded
+func decodeCertificateAuthority(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("certificate authority data is neither PEM nor base64 encoded PEM")
+	}
+	return decoded, nil
+}
+
 func readFileContent(file multipart.File) (string, error) {
 	content, err := io.ReadAll(file)
 	if err != nil {
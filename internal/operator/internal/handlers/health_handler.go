@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/health"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	monitor *health.Monitor
+}
+
+func NewHealthHandler(kubeConfigStore kubeconfig.ContextStore) *HealthHandler {
+	return &HealthHandler{
+		monitor: health.NewMonitor(kubeConfigStore),
+	}
+}
+
+// GetHealthOverview returns a health card of every context, or of the comma separated clusters
+// query parameter: node readiness, pending and failed pods, failed workloads and recent warning
+// events. Cards are cached briefly, refresh=true samples the clusters again.
+func (h *HealthHandler) GetHealthOverview(c *gin.Context) {
+	var clusters []string
+	for _, name := range strings.Split(c.Query("clusters"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			clusters = append(clusters, name)
+		}
+	}
+
+	overview, err := h.monitor.Overview(c.Request.Context(), clusters, c.Query("refresh") == "true")
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"clusters": strings.Join(clusters, ","),
+		}, err, "Failed to sample cluster health")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to sample cluster health: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/hibernation"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type HibernationHandler struct {
+	manager *hibernation.Manager
+}
+
+func NewHibernationHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *HibernationHandler {
+	manager := hibernation.NewManager(kubeConfigStore, queue)
+
+	// Register the hibernation processor
+	processor := hibernation.NewHibernationProcessor(manager)
+	queue.RegisterProcessor(hibernation.OperationHibernate, processor)
+	queue.RegisterProcessor(hibernation.OperationWake, processor)
+
+	return &HibernationHandler{
+		manager: manager,
+	}
+}
+
+// Hibernate records replica counts and scales the selected workloads of a cluster to zero
+func (h *HibernationHandler) Hibernate(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req hibernation.HibernateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster": clusterName,
+	}, nil, "Received hibernate request")
+
+	if requireApproval(c, approvals.NewHibernateAction(clusterName, req)) {
+		return
+	}
+
+	record, err := h.manager.Hibernate(clusterName, req)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Failed to start hibernation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "Hibernation started",
+		"operationId": record.OperationID,
+		"data":        record,
+	})
+}
+
+// Wake restores the recorded replica counts of a hibernated cluster
+func (h *HibernationHandler) Wake(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster": clusterName,
+	}, nil, "Received wake request")
+
+	record, err := h.manager.Wake(clusterName)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Failed to start wake",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "Wake started",
+		"operationId": record.OperationID,
+		"data":        record,
+	})
+}
+
+// GetHibernationStatus returns the hibernation record of a cluster
+func (h *HibernationHandler) GetHibernationStatus(c *gin.Context) {
+	record, err := h.manager.GetStatus(c.Param("clusterName"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get hibernation status",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Hibernation status retrieved",
+		"data":    record,
+	})
+}
+
+// ListHibernations returns the hibernation records of all clusters
+func (h *HibernationHandler) ListHibernations(c *gin.Context) {
+	records, err := h.manager.ListRecords()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list hibernations",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Hibernations retrieved",
+		"data":    records,
+	})
+}
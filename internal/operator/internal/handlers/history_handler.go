@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/history"
+	"github.com/agentkube/operator/pkg/redact"
+	"github.com/gin-gonic/gin"
+)
+
+type HistoryHandler struct {
+	manager *history.Manager
+}
+
+func NewHistoryHandler() *HistoryHandler {
+	manager := history.GetManager()
+
+	// Record revisions of tracked kinds as the watcher reports changes
+	controller.AddEventListener(manager.HandleEvent)
+
+	return &HistoryHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the history settings
+func (h *HistoryHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the history settings
+func (h *HistoryHandler) UpdateSettings(c *gin.Context) {
+	var settings history.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListResources lists the tracked resources of a cluster, filtered by kind and namespace
+func (h *HistoryHandler) ListResources(c *gin.Context) {
+	resources, err := h.manager.List(history.Filter{
+		Cluster:   c.Param("clusterName"),
+		Kind:      c.Query("kind"),
+		Namespace: c.Query("namespace"),
+		Name:      c.Query("name"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "resources", resources, nil)
+}
+
+// ListRevisions returns the revisions of a resource, oldest first
+func (h *HistoryHandler) ListRevisions(c *gin.Context) {
+	ref, ok := historyResource(c)
+	if !ok {
+		return
+	}
+
+	resourceHistory, err := h.manager.Get(ref)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	for _, revision := range resourceHistory.Revisions {
+		redact.Object(revision.Object)
+	}
+
+	c.JSON(http.StatusOK, resourceHistory)
+}
+
+// DiffRevisions compares two revisions of a resource given by the from and to query parameters
+func (h *HistoryHandler) DiffRevisions(c *gin.Context) {
+	ref, ok := historyResource(c)
+	if !ok {
+		return
+	}
+
+	from, errFrom := strconv.Atoi(c.Query("from"))
+	to, errTo := strconv.Atoi(c.Query("to"))
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be revision numbers"})
+		return
+	}
+
+	diff, err := h.manager.Diff(ref, from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// DeleteHistory forgets the revisions of a resource
+func (h *HistoryHandler) DeleteHistory(c *gin.Context) {
+	ref, ok := historyResource(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.Delete(ref); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "history deleted"})
+}
+
+// historyResource reads the resource of a history request from the path and query parameters
+func historyResource(c *gin.Context) (history.ResourceRef, bool) {
+	ref := history.ResourceRef{
+		Cluster:   c.Param("clusterName"),
+		Kind:      c.Query("kind"),
+		Namespace: c.Query("namespace"),
+		Name:      c.Query("name"),
+	}
+	if ref.Kind == "" || ref.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind and name are required"})
+		return ref, false
+	}
+	return ref, true
+}
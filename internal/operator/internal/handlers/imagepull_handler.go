@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/imagepull"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ImagePullDiagnosisRequest selects the pod to diagnose
+type ImagePullDiagnosisRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	Pod       string `json:"pod" binding:"required"`
+	imagepull.Options
+}
+
+// DiagnoseImagePull explains why the containers of a pod fail to pull their images. With fromNode the
+// registries are also checked from the node of the pod, which creates a short-lived probe pod.
+func DiagnoseImagePull(c *gin.Context) {
+	if clusterManager == nil {
+		logger.Log(logger.LevelError, nil, nil, "Cluster manager not initialized")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var req ImagePullDiagnosisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	clusterName := c.Param("clusterName")
+	if req.FromNode && rejectReadOnly(c, clusterName) {
+		return
+	}
+
+	context, err := clusterManager.GetContext(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting context")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+		return
+	}
+
+	clientset, err := context.ClientSetWithToken("")
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName}, err, "getting clientset")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create kubernetes clientset: %v", err)})
+		return
+	}
+
+	diagnosis, err := imagepull.Diagnose(c.Request.Context(), clientset, req.Namespace, req.Pod, req.Options)
+	switch {
+	case apierrors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, imagepull.ErrNoPullFailure):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		logger.Log(logger.LevelError, map[string]string{"clusterName": clusterName, "pod": req.Namespace + "/" + req.Pod}, err, "diagnosing image pull")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to diagnose image pull: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnosis)
+}
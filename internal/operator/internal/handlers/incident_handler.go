@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/incident"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type IncidentHandler struct {
+	manager *incident.Manager
+}
+
+func NewIncidentHandler() *IncidentHandler {
+	manager := incident.GetManager()
+
+	// Group watcher events into incidents as they are reported
+	controller.AddEventListener(manager.HandleEvent)
+
+	return &IncidentHandler{
+		manager: manager,
+	}
+}
+
+// ListIncidents lists incidents, filtered by the cluster, state and assignee query parameters
+func (h *IncidentHandler) ListIncidents(c *gin.Context) {
+	incidents, err := h.manager.List(incident.Filter{
+		Cluster:  c.Query("cluster"),
+		State:    c.Query("state"),
+		Assignee: c.Query("assignee"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "incidents", incidents, nil)
+}
+
+// GetIncident returns a single incident with its events
+func (h *IncidentHandler) GetIncident(c *gin.Context) {
+	found, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// AcknowledgeIncident marks an open incident as being worked on by the caller
+func (h *IncidentHandler) AcknowledgeIncident(c *gin.Context) {
+	updated, err := h.manager.Acknowledge(c.Param("id"), approvals.Identity(c.Request))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{"incident": updated.ID}, nil, "Incident acknowledged")
+	c.JSON(http.StatusOK, updated)
+}
+
+// ResolveIncident resolves an incident
+func (h *IncidentHandler) ResolveIncident(c *gin.Context) {
+	updated, err := h.manager.Resolve(c.Param("id"), approvals.Identity(c.Request))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{"incident": updated.ID}, nil, "Incident resolved")
+	c.JSON(http.StatusOK, updated)
+}
+
+// AssignIncident sets or clears the assignee of an incident
+func (h *IncidentHandler) AssignIncident(c *gin.Context) {
+	var req struct {
+		Assignee string `json:"assignee"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	updated, err := h.manager.Assign(c.Param("id"), req.Assignee)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/listing"
+	"github.com/gin-gonic/gin"
+)
+
+// writeList answers a list endpoint with the listing convention: the page of items selected by the
+// limit, continue, sortBy, order and filter query parameters under key, with its count, the total of
+// matching items and the continue token of the next page
+func writeList[T any](c *gin.Context, key string, items []T, extra gin.H) {
+	query, err := listing.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	writeListQuery(c, key, items, query, extra)
+}
+
+// writeListQuery is writeList with a query the endpoint parsed itself, e.g. to take out sort fields
+// it orders the items by
+func writeListQuery[T any](c *gin.Context, key string, items []T, query listing.Query, extra gin.H) {
+	page, err := listing.Apply(items, query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, listing.ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	listing.SetHeaders(c.Writer.Header(), page)
+	response := gin.H{
+		key:        page.Items,
+		"count":    len(page.Items),
+		"total":    page.Total,
+		"continue": page.Continue,
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(http.StatusOK, response)
+}
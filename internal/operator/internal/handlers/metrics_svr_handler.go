@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/agentkube/operator/pkg/kubeconfig"
@@ -21,6 +22,7 @@ func NewMetricsServerHandler(kubeConfigStore kubeconfig.ContextStore, queue *uti
 	processor := metrics.NewMetricsProcessor(manager)
 	queue.RegisterProcessor("metrics-install", processor)
 	queue.RegisterProcessor("metrics-uninstall", processor)
+	queue.RegisterProcessor("metrics-upgrade", processor)
 	
 	return &MetricsServerHandler{
 		manager: manager,
@@ -57,7 +59,18 @@ func (h *MetricsServerHandler) InstallMetricsServer(c *gin.Context) {
 		"type":    req.Type,
 	}, nil, "Received metrics server install request")
 
-	operation, err := h.manager.Install(clusterName, req.Type)
+	operation, err := h.manager.Install(clusterName, req.Type, req.InstallOptions)
+	if managedElsewhere(c, err) {
+		return
+	}
+	if errors.Is(err, metrics.ErrInvalidOptions) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid installation options",
+			"error":   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{
 			"cluster": clusterName,
@@ -129,6 +142,9 @@ func (h *MetricsServerHandler) UninstallMetricsServer(c *gin.Context) {
 	}, nil, "Received metrics server uninstall request")
 
 	operation, err := h.manager.Uninstall(clusterName)
+	if managedElsewhere(c, err) {
+		return
+	}
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{
 			"cluster": clusterName,
@@ -153,30 +169,77 @@ func (h *MetricsServerHandler) UninstallMetricsServer(c *gin.Context) {
 	})
 }
 
-func (h *MetricsServerHandler) GetOperationStatus(c *gin.Context) {
-	operationId := c.Param("operationId")
-	if operationId == "" {
+// UpgradeMetricsServer changes the version and configuration of an installed metrics server in place
+func (h *MetricsServerHandler) UpgradeMetricsServer(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req metrics.UpgradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.Type != "" && req.Type != "production" && req.Type != "local" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Operation ID is required",
+			"message": "Type must be production or local",
 		})
 		return
 	}
 
-	operation, exists := h.manager.GetQueue().GetOperation(operationId)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
+	operation, err := h.manager.Upgrade(clusterName, req.Type, req.InstallOptions)
+	if managedElsewhere(c, err) {
+		return
+	}
+	if errors.Is(err, metrics.ErrInvalidOptions) {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Operation not found",
+			"message": "Invalid upgrade options",
+			"error":   err.Error(),
 		})
 		return
 	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster": clusterName,
+		}, err, "Failed to queue metrics server upgrade")
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Operation status retrieved",
-		"data":    operation,
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start upgrade",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "Metrics server upgrade started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":  operation.Status,
+			"cluster": clusterName,
+		},
+	})
+}
+
+// managedElsewhere answers 409 with the installation when the metrics server is managed by another
+// tool, so that the client can offer to adopt or skip it
+func managedElsewhere(c *gin.Context, err error) bool {
+	var managed *metrics.ManagedElsewhereError
+	if !errors.As(err, &managed) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"success":      false,
+		"message":      "Metrics server is managed by another tool",
+		"error":        err.Error(),
+		"installation": managed.Installation,
 	})
+	return true
 }
 
 func (h *MetricsServerHandler) GetQueue() *utils.Queue {
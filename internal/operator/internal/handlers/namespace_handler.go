@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/namespaces"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceTimeout bounds the API calls of a namespace request
+const namespaceTimeout = 30 * time.Second
+
+type NamespaceHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewNamespaceHandler(kubeConfigStore kubeconfig.ContextStore) *NamespaceHandler {
+	return &NamespaceHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// CreateNamespace creates a namespace with its labels, annotations and quota
+func (h *NamespaceHandler) CreateNamespace(c *gin.Context) {
+	var req namespaces.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	namespace, err := namespaces.Create(ctx, clientset, req)
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, namespace)
+}
+
+// DeleteNamespace starts the deletion of a namespace
+func (h *NamespaceHandler) DeleteNamespace(c *gin.Context) {
+	clusterName, name := c.Param("clusterName"), c.Param("namespace")
+	if requireApproval(c, approvals.NewProxyAction(clusterName, http.MethodDelete, "/api/v1/namespaces/"+name, nil)) {
+		return
+	}
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	if err := namespaces.Delete(ctx, clientset, name); err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Namespace deletion started"})
+}
+
+// GetTermination reports why a namespace is still terminating
+func (h *NamespaceHandler) GetTermination(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	termination, err := namespaces.Inspect(ctx, clientset, c.Param("namespace"))
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, termination)
+}
+
+// FinalizeNamespace removes the finalizers of a namespace stuck in Terminating. It must be
+// confirmed with {"confirm": true}, the resources left in the namespace may be orphaned.
+func (h *NamespaceHandler) FinalizeNamespace(c *gin.Context) {
+	clusterName, name := c.Param("clusterName"), c.Param("namespace")
+	var req struct {
+		Confirm bool `json:"confirm"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if requireApproval(c, approvals.NewProxyAction(clusterName, http.MethodPut, "/api/v1/namespaces/"+name+"/finalize", nil)) {
+		return
+	}
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	result, err := namespaces.ForceFinalize(ctx, clientset, name, req.Confirm)
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	logger.Log(logger.LevelWarn, map[string]string{
+		"cluster":    clusterName,
+		"namespace":  name,
+		"user":       approvals.Identity(c.Request),
+		"finalizers": strings.Join(append(result.RemovedFinalizers, result.RemovedMetadata...), ","),
+	}, nil, "Force-finalized terminating namespace")
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetQuotaReport reports the quota usage of every namespace of a cluster in one call
+func (h *NamespaceHandler) GetQuotaReport(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	report, err := namespaces.QuotaReport(ctx, clientset)
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	writeList(c, "quotas", report.Quotas, gin.H{
+		"cluster":   c.Param("clusterName"),
+		"nearLimit": report.NearLimit,
+		"unquoted":  report.Unquoted,
+	})
+}
+
+// GetNamespaceQuotas returns the quotas, with their usage, and the limit ranges of a namespace
+func (h *NamespaceHandler) GetNamespaceQuotas(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	quotas, err := namespaces.Quotas(ctx, clientset, c.Param("namespace"))
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quotas)
+}
+
+// ApplyQuota creates or replaces a ResourceQuota of a namespace
+func (h *NamespaceHandler) ApplyQuota(c *gin.Context) {
+	var req namespaces.QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	quota, err := namespaces.ApplyQuota(ctx, clientset, c.Param("namespace"), c.Param("name"), req)
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// DeleteQuota deletes a ResourceQuota of a namespace
+func (h *NamespaceHandler) DeleteQuota(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	if err := namespaces.DeleteQuota(ctx, clientset, c.Param("namespace"), c.Param("name")); err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Resource quota deleted"})
+}
+
+// ApplyLimitRange creates or replaces a LimitRange of a namespace
+func (h *NamespaceHandler) ApplyLimitRange(c *gin.Context) {
+	var req namespaces.LimitRangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	limitRange, err := namespaces.ApplyLimitRange(ctx, clientset, c.Param("namespace"), c.Param("name"), req)
+	if err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, limitRange)
+}
+
+// DeleteLimitRange deletes a LimitRange of a namespace
+func (h *NamespaceHandler) DeleteLimitRange(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), namespaceTimeout)
+	defer cancel()
+	if err := namespaces.DeleteLimitRange(ctx, clientset, c.Param("namespace"), c.Param("name")); err != nil {
+		writeNamespaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Limit range deleted"})
+}
+
+func (h *NamespaceHandler) clientset(c *gin.Context) (*kubernetes.Clientset, bool) {
+	clusterName := c.Param("clusterName")
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return nil, false
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create clientset: " + err.Error()})
+		return nil, false
+	}
+	return clientset, true
+}
+
+func writeNamespaceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, namespaces.ErrInvalid), errors.Is(err, namespaces.ErrConfirmationRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, namespaces.ErrProtected), apierrors.IsForbidden(err):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, namespaces.ErrNotTerminating), apierrors.IsAlreadyExists(err), apierrors.IsConflict(err):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case apierrors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		logger.Log(logger.LevelError, map[string]string{"cluster": c.Param("clusterName")}, err, "Namespace request failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNamespaceDeletionRequiresApproval(t *testing.T) {
+	t.Setenv("CONFIG", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	settings := approvals.DefaultSettings()
+	settings.Enabled = true
+	if err := approvals.GetManager().UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+
+	// No context store: a request that gets past the approval guard fails the test
+	handler := NewNamespaceHandler(nil)
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		approval string
+		handle   gin.HandlerFunc
+		want     int
+	}{
+		{name: "delete", method: http.MethodDelete, handle: handler.DeleteNamespace, want: http.StatusPreconditionRequired},
+		{name: "finalize", method: http.MethodPost, body: `{"confirm":true}`, handle: handler.FinalizeNamespace, want: http.StatusPreconditionRequired},
+		{name: "delete with unknown approval", method: http.MethodDelete, approval: "unknown", handle: handler.DeleteNamespace, want: http.StatusForbidden},
+		{name: "finalize with unknown approval", method: http.MethodPost, body: `{"confirm":true}`, approval: "unknown", handle: handler.FinalizeNamespace, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(tt.method, "/cluster/prod/namespaces/payments", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			if tt.approval != "" {
+				c.Request.Header.Set(approvals.ApprovalHeader, tt.approval)
+			}
+			c.Params = gin.Params{{Key: "clusterName", Value: "prod"}, {Key: "namespace", Value: "payments"}}
+
+			tt.handle(c)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
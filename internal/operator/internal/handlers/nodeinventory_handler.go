@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/nodeinventory"
+	"github.com/gin-gonic/gin"
+)
+
+type NodeInventoryHandler struct {
+	inventory *nodeinventory.Inventory
+}
+
+func NewNodeInventoryHandler(kubeConfigStore kubeconfig.ContextStore) *NodeInventoryHandler {
+	return &NodeInventoryHandler{
+		inventory: nodeinventory.NewInventory(kubeConfigStore),
+	}
+}
+
+// GetFleetInventory returns node component versions and CVE findings across clusters.
+// The optional clusters query parameter is a comma separated list of contexts.
+func (h *NodeInventoryHandler) GetFleetInventory(c *gin.Context) {
+	var clusters []string
+	for _, name := range strings.Split(c.Query("clusters"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			clusters = append(clusters, name)
+		}
+	}
+
+	h.respond(c, clusters)
+}
+
+// GetClusterInventory returns node component versions and CVE findings for a single cluster
+func (h *NodeInventoryHandler) GetClusterInventory(c *gin.Context) {
+	h.respond(c, []string{c.Param("clusterName")})
+}
+
+func (h *NodeInventoryHandler) respond(c *gin.Context, clusters []string) {
+	result, err := h.inventory.Collect(clusters)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"clusters": strings.Join(clusters, ","),
+		}, err, "Failed to collect node inventory")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to collect node inventory: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/client"
+	internalconfig "github.com/agentkube/operator/pkg/config"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// testNotificationTimeout bounds how long a test notification may take to be delivered
+const testNotificationTimeout = 30 * time.Second
+
+// notificationSeverities maps severities to the event status dispatchers use to color messages
+var notificationSeverities = map[string]string{
+	"info":     "Normal",
+	"warning":  "Warning",
+	"critical": "Danger",
+}
+
+// TestNotificationRequest selects the dispatcher and the synthetic event sent through it
+type TestNotificationRequest struct {
+	// Dispatcher is one of the names in dispatchers.Map, empty uses the configured dispatcher
+	Dispatcher string `json:"dispatcher"`
+	// Severity is info, warning or critical
+	Severity string `json:"severity"`
+	Cluster  string `json:"cluster"`
+	Message  string `json:"message"`
+	// Event replaces the test message with a synthetic resource event, to preview how real events are rendered
+	Event *TestNotificationEvent `json:"event,omitempty"`
+	// SchemaVersion overrides the payload version pinned by the webhook dispatcher, to preview an upgrade
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+}
+
+// TestNotificationEvent is a synthetic resource event
+type TestNotificationEvent struct {
+	Kind      string `json:"kind" binding:"required"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+// TestNotificationResult is the delivery result of a test notification
+type TestNotificationResult struct {
+	Dispatcher string `json:"dispatcher"`
+	Delivered  bool   `json:"delivered"`
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// TestNotificationHandler sends a synthetic event through a dispatcher and reports whether it was delivered
+func TestNotificationHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TestNotificationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+		if req.Severity == "" {
+			req.Severity = "info"
+		}
+		status, ok := notificationSeverities[req.Severity]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be info, warning or critical"})
+			return
+		}
+		if req.Message == "" {
+			req.Message = "This is a test notification sent from Agentkube"
+		}
+		if _, err := event.ResolveSchema(req.SchemaVersion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		conf, err := config.New()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load watcher config: %v", err)})
+			return
+		}
+
+		if req.SchemaVersion != "" {
+			conf.Handler.Webhook.SchemaVersion = req.SchemaVersion
+		}
+
+		var dispatcher dispatchers.Dispatcher
+		if req.Dispatcher == "" {
+			// The same dispatcher operator notifications go through
+			if conf.Handler.Webhook.Url == "" {
+				conf.Handler.Webhook.Url = internalconfig.OperatorWebhook
+			}
+			dispatcher, err = client.NewEventHandler(conf)
+		} else {
+			dispatcher, err = client.NewDispatcher(req.Dispatcher, conf)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Dispatcher is not configured: %v", err)})
+			return
+		}
+		sender, ok := dispatcher.(dispatchers.Sender)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Dispatcher %T does not report deliveries", dispatcher)})
+			return
+		}
+
+		e := event.Event{Kind: "test-notification", Host: req.Cluster, Reason: req.Message, Status: status}
+		if req.Event != nil {
+			e = event.Event{
+				Kind:      req.Event.Kind,
+				Namespace: req.Event.Namespace,
+				Name:      req.Event.Name,
+				Reason:    req.Event.Reason,
+				Host:      req.Cluster,
+				Status:    status,
+			}
+		}
+
+		result := TestNotificationResult{Dispatcher: fmt.Sprintf("%T", dispatcher), Message: e.Message()}
+		if req.Dispatcher != "" {
+			result.Dispatcher = req.Dispatcher
+		}
+
+		start := time.Now()
+		delivered := make(chan error, 1)
+		go func() {
+			delivered <- sender.Send(e)
+		}()
+		select {
+		case err = <-delivered:
+		case <-time.After(testNotificationTimeout):
+			err = fmt.Errorf("delivery did not complete within %s", testNotificationTimeout)
+		}
+		result.DurationMs = time.Since(start).Milliseconds()
+
+		if err != nil {
+			result.Error = err.Error()
+			logger.Log(logger.LevelWarn, map[string]string{"dispatcher": result.Dispatcher}, err, "Test notification was not delivered")
+			c.JSON(http.StatusBadGateway, result)
+			return
+		}
+
+		result.Delivered = true
+		logger.Log(logger.LevelInfo, map[string]string{"dispatcher": result.Dispatcher}, nil, "Test notification delivered")
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// EventSchemaResponse lists the payload versions receivers can pin
+type EventSchemaResponse struct {
+	Latest   string               `json:"latest"`
+	Default  string               `json:"default"`
+	Versions []event.SchemaChange `json:"versions"`
+}
+
+// GetEventSchemaHandler returns the changelog of the event payload versions
+func GetEventSchemaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, EventSchemaResponse{
+			Latest:   event.LatestSchema,
+			Default:  event.DefaultSchema,
+			Versions: event.Changelog(),
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/oomkill"
+	"github.com/gin-gonic/gin"
+)
+
+type OOMKillHandler struct {
+	manager *oomkill.Manager
+}
+
+func NewOOMKillHandler(kubeConfigStore kubeconfig.ContextStore) *OOMKillHandler {
+	manager := oomkill.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &OOMKillHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the OOM detector settings
+func (h *OOMKillHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the OOM detector settings
+func (h *OOMKillHandler) UpdateSettings(c *gin.Context) {
+	var settings oomkill.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// Sample records the current memory usage and OOM kills of a cluster
+func (h *OOMKillHandler) Sample(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	if err := h.manager.Sample(c.Request.Context(), clusterName); err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to sample container memory")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Memory sampled"})
+}
+
+// ListReports returns the per-workload memory report of a cluster, ?namespace=shop&since=72h
+func (h *OOMKillHandler) ListReports(c *gin.Context) {
+	h.list(c, h.manager.Reports)
+}
+
+// ListRecommendations returns the containers whose memory limit should change, ?namespace=shop&since=72h
+func (h *OOMKillHandler) ListRecommendations(c *gin.Context) {
+	h.list(c, h.manager.Recommendations)
+}
+
+func (h *OOMKillHandler) list(c *gin.Context, reports func(clusterName, namespace string, since time.Time) ([]oomkill.WorkloadReport, error)) {
+	clusterName := c.Param("clusterName")
+
+	since := 7 * 24 * time.Hour
+	if value := c.Query("since"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a positive duration, e.g. 72h"})
+			return
+		}
+		since = duration
+	}
+
+	workloads, err := reports(clusterName, c.Query("namespace"), time.Now().Add(-since))
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to read memory reports")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "workloads", workloads, gin.H{"cluster": clusterName})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type OperationHandler struct {
+	queue *utils.Queue
+}
+
+func NewOperationHandler(queue *utils.Queue) *OperationHandler {
+	return &OperationHandler{
+		queue: queue,
+	}
+}
+
+// ListOperations returns the operations of every type, newest first, filtered by
+// ?type=, ?target=, ?status=, ?createdBy= and ?tag=
+func (h *OperationHandler) ListOperations(c *gin.Context) {
+	filters := map[string]string{}
+	for _, key := range []string{"type", "target", "status", "createdBy", "tag"} {
+		if value := c.Query(key); value != "" {
+			filters[key] = value
+		}
+	}
+
+	operations := h.queue.ListOperations(filters)
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].StartTime.After(operations[j].StartTime)
+	})
+
+	writeList(c, "operations", operations, gin.H{"stats": h.queue.GetQueueStats()})
+}
+
+// GetOperation returns an operation
+func (h *OperationHandler) GetOperation(c *gin.Context) {
+	operation, exists := h.queue.GetOperation(c.Param("operationId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Operation not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Operation status retrieved",
+		"data":    operation,
+	})
+}
+
+// CancelOperation cancels a pending operation, or a running one whose processor can stop it
+func (h *OperationHandler) CancelOperation(c *gin.Context) {
+	operation, err := h.queue.Cancel(c.Param("operationId"))
+	if err != nil {
+		writeOperationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Operation cancellation requested",
+		"data":    operation,
+	})
+}
+
+// RetryOperation queues a failed or cancelled operation again
+func (h *OperationHandler) RetryOperation(c *gin.Context) {
+	operation, err := h.queue.RetryOperation(c.Param("operationId"))
+	if err != nil {
+		writeOperationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Operation queued for retry",
+		"data":    operation,
+	})
+}
+
+func writeOperationError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, utils.ErrOperationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, utils.ErrOperationFinished), errors.Is(err, utils.ErrNotCancellable), errors.Is(err, utils.ErrNotRetryable):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/policy"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// reviewTimeout bounds a manifest review, Rego policies run the opa CLI
+const reviewTimeout = 30 * time.Second
+
+type PolicyHandler struct {
+	manager *policy.Manager
+}
+
+func NewPolicyHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *PolicyHandler {
+	manager := policy.NewManager(kubeConfigStore, queue)
+
+	// Register the policy evaluation processor
+	queue.RegisterProcessor(policy.OperationEvaluate, policy.NewEvaluationProcessor(manager))
+
+	// Evaluate bundles with onEvents set as the watcher reports changes
+	controller.AddEventListener(manager.HandleEvent)
+
+	manager.Start()
+
+	return &PolicyHandler{
+		manager: manager,
+	}
+}
+
+// ListBundles lists all policy bundles
+func (h *PolicyHandler) ListBundles(c *gin.Context) {
+	bundles, err := h.manager.ListBundles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "bundles", bundles, nil)
+}
+
+// GetBundle returns a single policy bundle
+func (h *PolicyHandler) GetBundle(c *gin.Context) {
+	bundle, err := h.manager.GetBundle(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, bundle)
+}
+
+// SaveBundle loads a bundle, or replaces the one named in the path. Policies are compiled before saving.
+// If-Match and If-None-Match make the save conditional on the stored bundle.
+func (h *PolicyHandler) SaveBundle(c *gin.Context) {
+	var bundle policy.Bundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if name := c.Param("name"); name != "" {
+		bundle.Name = name
+	}
+
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentBundle(bundle.Name)) {
+		return
+	}
+
+	saved, err := h.manager.SaveBundle(bundle)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, saved)
+}
+
+// DeleteBundle removes a policy bundle and its findings
+func (h *PolicyHandler) DeleteBundle(c *gin.Context) {
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentBundle(c.Param("name"))) {
+		return
+	}
+
+	if err := h.manager.DeleteBundle(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "policy bundle deleted"})
+}
+
+// EvaluateBundle queues an evaluation of a bundle, optionally against an explicit list of clusters
+func (h *PolicyHandler) EvaluateBundle(c *gin.Context) {
+	var req struct {
+		Clusters []string `json:"clusters"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+	}
+
+	name := c.Param("name")
+	operation, err := h.manager.Evaluate(name, req.Clusters, "user")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"bundle":      name,
+		"operationId": operation.ID,
+	}, nil, "Queued policy evaluation")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "policy evaluation started",
+		"operationId": operation.ID,
+	})
+}
+
+// ListFindings lists current policy findings, filtered by the query parameters
+func (h *PolicyHandler) ListFindings(c *gin.Context) {
+	findings, err := h.manager.Findings(policy.FindingsFilter{
+		Cluster:   c.Query("cluster"),
+		Bundle:    c.Query("bundle"),
+		Policy:    c.Query("policy"),
+		Severity:  c.Query("severity"),
+		Namespace: c.Query("namespace"),
+		Kind:      c.Query("kind"),
+		Name:      c.Query("name"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "findings", findings, nil)
+}
+
+// ReviewManifest evaluates a manifest, or a live object of a cluster, against policy bundles and
+// returns its violations, so manifests can be linted before they are applied. Nothing is stored.
+func (h *PolicyHandler) ReviewManifest(c *gin.Context) {
+	var req policy.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), reviewTimeout)
+	defer cancel()
+
+	result, err := h.manager.Review(ctx, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, policy.ErrInvalidReview):
+			status = http.StatusBadRequest
+		case errors.Is(err, policy.ErrNotFound), apierrors.IsNotFound(err):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, result)
+}
+
+// currentBundle returns the stored bundle for precondition checks, nil when there is none
+func (h *PolicyHandler) currentBundle(name string) interface{} {
+	bundle, err := h.manager.GetBundle(name)
+	if err != nil {
+		return nil
+	}
+	return bundle
+}
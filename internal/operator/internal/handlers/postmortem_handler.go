@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/postmortem"
+	"github.com/gin-gonic/gin"
+)
+
+type PostmortemHandler struct {
+	exporter *postmortem.Exporter
+}
+
+func NewPostmortemHandler(kubeConfigStore kubeconfig.ContextStore) *PostmortemHandler {
+	return &PostmortemHandler{
+		exporter: postmortem.NewExporter(kubeConfigStore),
+	}
+}
+
+// ExportBundle collects events, log excerpts, metrics, manifests and findings of the requested
+// resources over a time range and returns them as a tar.gz archive
+func (h *PostmortemHandler) ExportBundle(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var request postmortem.Request
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if err := request.Validate(time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle, err := h.exporter.Collect(c.Request.Context(), clusterName, request)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to collect postmortem bundle")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("postmortem-%s-%s.tar.gz", clusterName, request.To.UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Status(http.StatusOK)
+	if err := bundle.WriteArchive(c.Writer); err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to write postmortem bundle")
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster": clusterName,
+		"files":   fmt.Sprint(len(bundle.Manifest.Files)),
+		"errors":  fmt.Sprint(len(bundle.Manifest.Errors)),
+	}, nil, "Exported postmortem bundle")
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/priority"
+	"github.com/gin-gonic/gin"
+)
+
+type PriorityHandler struct {
+	analyzer *priority.Analyzer
+}
+
+func NewPriorityHandler(kubeConfigStore kubeconfig.ContextStore) *PriorityHandler {
+	return &PriorityHandler{
+		analyzer: priority.NewAnalyzer(kubeConfigStore),
+	}
+}
+
+// GetLandscape returns the priority classes of a cluster, the workloads without a priority class and
+// recent preemptions
+func (h *PriorityHandler) GetLandscape(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	landscape, err := h.analyzer.Landscape(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to analyze priority classes")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to analyze priority classes: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, landscape)
+}
+
+// SimulatePreemption reports which pods would be preempted to schedule a high priority workload
+func (h *PriorityHandler) SimulatePreemption(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req priority.SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := h.analyzer.Simulate(clusterName, req)
+	if errors.Is(err, priority.ErrInvalidRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to simulate preemption")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to simulate preemption: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
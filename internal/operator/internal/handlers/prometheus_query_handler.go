@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/prometheus"
+	"github.com/gin-gonic/gin"
+)
+
+type PrometheusQueryHandler struct {
+	proxy *prometheus.Proxy
+}
+
+func NewPrometheusQueryHandler(kubeConfigStore kubeconfig.ContextStore) *PrometheusQueryHandler {
+	return &PrometheusQueryHandler{
+		proxy: prometheus.NewProxy(kubeConfigStore),
+	}
+}
+
+// GetTarget returns the Prometheus service queries of a cluster are proxied to
+func (h *PrometheusQueryHandler) GetTarget(c *gin.Context) {
+	target, err := h.proxy.Target(c.Request.Context(), c.Param("clusterName"))
+	if err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// SetTarget configures the Prometheus service of a cluster, for installs discovery doesn't find
+func (h *PrometheusQueryHandler) SetTarget(c *gin.Context) {
+	var target prometheus.Target
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid prometheus target: " + err.Error()})
+		return
+	}
+	if err := h.proxy.SetTarget(c.Param("clusterName"), target); err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+	target.Configured = true
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteTarget removes the configured Prometheus service of a cluster, queries go to the
+// discovered one again
+func (h *PrometheusQueryHandler) DeleteTarget(c *gin.Context) {
+	if err := h.proxy.DeleteTarget(c.Param("clusterName")); err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Query proxies an instant query, ?query=up&time=<rfc3339 or unix>, and answers the Prometheus
+// response as is
+func (h *PrometheusQueryHandler) Query(c *gin.Context) {
+	h.query(c, prometheus.EndpointQuery)
+}
+
+// QueryRange proxies a range query, ?query=up&start=...&end=...&step=30s, and answers the
+// Prometheus response as is
+func (h *PrometheusQueryHandler) QueryRange(c *gin.Context) {
+	h.query(c, prometheus.EndpointQueryRange)
+}
+
+func (h *PrometheusQueryHandler) query(c *gin.Context, endpoint string) {
+	response, err := h.proxy.Query(c.Request.Context(), c.Param("clusterName"), endpoint, c.Request.URL.Query())
+	if err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+	c.Data(response.Status, "application/json", response.Body)
+}
+
+// ListCannedQueries returns the queries RunCannedQuery runs
+func (h *PrometheusQueryHandler) ListCannedQueries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"queries": prometheus.CannedQueries()})
+}
+
+// RunCannedQuery runs a canned query, narrowed with ?namespace=shop&pod=api-7d9f&window=10m. It is
+// an instant query, or a range query with ?start=...&end=...&step=... The answer holds the query,
+// its PromQL and the Prometheus response.
+func (h *PrometheusQueryHandler) RunCannedQuery(c *gin.Context) {
+	params := prometheus.QueryParams{Namespace: c.Query("namespace"), Pod: c.Query("pod")}
+	if value := c.Query("window"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a duration, e.g. 10m"})
+			return
+		}
+		params.Window = window
+	}
+	query, promQL, err := prometheus.RenderQuery(c.Param("id"), params)
+	if err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+
+	values := url.Values{"query": {promQL}}
+	endpoint := prometheus.EndpointQuery
+	if c.Query("start") != "" {
+		endpoint = prometheus.EndpointQueryRange
+		for _, name := range []string{"start", "end", "step"} {
+			values.Set(name, c.Query(name))
+		}
+	} else if value := c.Query("time"); value != "" {
+		values.Set("time", value)
+	}
+
+	response, err := h.proxy.Query(c.Request.Context(), c.Param("clusterName"), endpoint, values)
+	if err != nil {
+		writePrometheusError(c, err)
+		return
+	}
+	// Errors of the service proxy, e.g. without endpoints, may not be JSON
+	var body interface{} = json.RawMessage(response.Body)
+	if !json.Valid(response.Body) {
+		body = string(response.Body)
+	}
+	c.JSON(response.Status, gin.H{
+		"query":    query,
+		"promql":   promQL,
+		"target":   response.Target,
+		"response": body,
+	})
+}
+
+func writePrometheusError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, prometheus.ErrInvalidTarget), errors.Is(err, prometheus.ErrInvalidQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, prometheus.ErrNotFound), errors.Is(err, prometheus.ErrUnknownCluster):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		logger.Log(logger.LevelError, map[string]string{"cluster": c.Param("clusterName")}, err, "proxying prometheus")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
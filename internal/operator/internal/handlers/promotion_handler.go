@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/promotion"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type PromotionHandler struct {
+	manager *promotion.PromotionManager
+}
+
+func NewPromotionHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *PromotionHandler {
+	manager := promotion.NewPromotionManager(kubeConfigStore, queue)
+
+	// Register the promotion processor
+	processor := promotion.NewPromotionProcessor(manager)
+	queue.RegisterProcessor(promotion.OperationStart, processor)
+	queue.RegisterProcessor(promotion.OperationFinalize, processor)
+	queue.RegisterProcessor(promotion.OperationRollback, processor)
+
+	return &PromotionHandler{
+		manager: manager,
+	}
+}
+
+// StartPromotion starts a blue/green or canary promotion of a deployment
+func (h *PromotionHandler) StartPromotion(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req promotion.PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":    clusterName,
+		"namespace":  req.Namespace,
+		"deployment": req.Deployment,
+		"strategy":   req.Strategy,
+	}, nil, "Received promotion start request")
+
+	operation, err := h.manager.Start(clusterName, req)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster":    clusterName,
+			"namespace":  req.Namespace,
+			"deployment": req.Deployment,
+		}, err, "Failed to queue promotion")
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to start promotion",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "Promotion started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":     operation.Status,
+			"cluster":    clusterName,
+			"namespace":  req.Namespace,
+			"deployment": req.Deployment,
+			"strategy":   req.Strategy,
+		},
+	})
+}
+
+// GetPromotionStatus returns the promotion state of a deployment
+func (h *PromotionHandler) GetPromotionStatus(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	namespace := c.Param("namespace")
+	deployment := c.Param("deployment")
+
+	status, err := h.manager.GetStatus(clusterName, namespace, deployment)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster":    clusterName,
+			"namespace":  namespace,
+			"deployment": deployment,
+		}, err, "Failed to get promotion status")
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get promotion status",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Promotion status retrieved",
+		"data":    status,
+	})
+}
+
+// FinalizePromotion makes the candidate the new stable version
+func (h *PromotionHandler) FinalizePromotion(c *gin.Context) {
+	h.queueFollowUp(c, "finalize", h.manager.Finalize)
+}
+
+// RollbackPromotion discards the candidate and restores the stable version
+func (h *PromotionHandler) RollbackPromotion(c *gin.Context) {
+	h.queueFollowUp(c, "rollback", h.manager.Rollback)
+}
+
+func (h *PromotionHandler) queueFollowUp(c *gin.Context, action string, queue func(clusterName, namespace, deployment string) (*utils.Operation, error)) {
+	clusterName := c.Param("clusterName")
+	namespace := c.Param("namespace")
+	deployment := c.Param("deployment")
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":    clusterName,
+		"namespace":  namespace,
+		"deployment": deployment,
+		"action":     action,
+	}, nil, "Received promotion request")
+
+	operation, err := queue(clusterName, namespace, deployment)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster":    clusterName,
+			"namespace":  namespace,
+			"deployment": deployment,
+			"action":     action,
+		}, err, "Failed to queue promotion operation")
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to " + action + " promotion",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "Promotion " + action + " started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":     operation.Status,
+			"cluster":    clusterName,
+			"namespace":  namespace,
+			"deployment": deployment,
+		},
+	})
+}
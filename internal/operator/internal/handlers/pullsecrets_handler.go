@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/pullsecrets"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type PullSecretsHandler struct {
+	manager *pullsecrets.Manager
+}
+
+func NewPullSecretsHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *PullSecretsHandler {
+	manager := pullsecrets.NewManager(kubeConfigStore, queue)
+
+	// Register the pull secret sync processor
+	processor := pullsecrets.NewSyncProcessor(manager)
+	queue.RegisterProcessor(pullsecrets.OperationSync, processor)
+	queue.RegisterProcessor(pullsecrets.OperationPurge, processor)
+
+	return &PullSecretsHandler{
+		manager: manager,
+	}
+}
+
+// ListCredentials lists registered registry credentials
+func (h *PullSecretsHandler) ListCredentials(c *gin.Context) {
+	credentials, err := h.manager.ListCredentials()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "credentials", credentials, nil)
+}
+
+// GetCredential returns a registry credential without its password
+func (h *PullSecretsHandler) GetCredential(c *gin.Context) {
+	credential, err := h.manager.GetCredential(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// SaveCredential registers a credential, or updates the one named in the path
+func (h *PullSecretsHandler) SaveCredential(c *gin.Context) {
+	var credential pullsecrets.Credential
+	if err := c.ShouldBindJSON(&credential); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if name := c.Param("name"); name != "" {
+		credential.Name = name
+	}
+
+	saved, err := h.manager.SaveCredential(credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteCredential removes a credential and the secrets it distributed
+func (h *PullSecretsHandler) DeleteCredential(c *gin.Context) {
+	operation, err := h.manager.DeleteCredential(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "credential deleted, removing distributed secrets",
+		"operationId": operation.ID,
+	})
+}
+
+// SyncCredential distributes a credential to all of its targets
+func (h *PullSecretsHandler) SyncCredential(c *gin.Context) {
+	name := c.Param("name")
+	operation, err := h.manager.Sync(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"credential":  name,
+		"operationId": operation.ID,
+	}, nil, "Queued pull secret sync")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "sync started",
+		"operationId": operation.ID,
+	})
+}
+
+// RotateCredential replaces the password of a credential and re-syncs it
+func (h *PullSecretsHandler) RotateCredential(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	operation, err := h.manager.Rotate(name, req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"credential":  name,
+		"operationId": operation.ID,
+	}, nil, "Rotated registry credential")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "credential rotated, sync started",
+		"operationId": operation.ID,
+	})
+}
+
+// GetCredentialDrift reports namespaces whose secret differs from the registered credential
+func (h *PullSecretsHandler) GetCredentialDrift(c *gin.Context) {
+	report, err := h.manager.DetectDrift(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
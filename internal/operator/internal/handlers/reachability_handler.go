@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/reachability"
+	"github.com/gin-gonic/gin"
+)
+
+type ReachabilityHandler struct {
+	analyzer *reachability.Analyzer
+}
+
+func NewReachabilityHandler(kubeConfigStore kubeconfig.ContextStore) *ReachabilityHandler {
+	return &ReachabilityHandler{
+		analyzer: reachability.NewAnalyzer(kubeConfigStore),
+	}
+}
+
+// GetMatrix computes the reachability between the workloads of the comma-separated namespaces query
+// parameter. format=csv or format=markdown downloads it for review.
+func (h *ReachabilityHandler) GetMatrix(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	namespaces := []string{}
+	for _, namespace := range strings.Split(c.Query("namespaces"), ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" && format != "markdown" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or markdown"})
+		return
+	}
+
+	matrix, err := h.analyzer.Compute(c.Request.Context(), clusterName, namespaces)
+	if errors.Is(err, reachability.ErrInvalidRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to compute reachability matrix")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute reachability matrix: " + err.Error()})
+		return
+	}
+
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "reachability-"+clusterName+".csv"))
+		c.Status(http.StatusOK)
+		err = reachability.WriteCSV(c.Writer, matrix)
+	case "markdown":
+		c.Header("Content-Type", "text/markdown")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "reachability-"+clusterName+".md"))
+		c.Status(http.StatusOK)
+		err = reachability.WriteMarkdown(c.Writer, matrix)
+	default:
+		c.JSON(http.StatusOK, matrix)
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to write reachability matrix")
+	}
+}
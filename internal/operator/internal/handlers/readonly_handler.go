@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/agentkube/operator/pkg/breakglass"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
+	"github.com/gin-gonic/gin"
+)
+
+// rejectReadOnly answers the request and returns true when one of the contexts is read-only and
+// the request carries no break-glass token for it. It must only be called for operations that
+// change the cluster.
+func rejectReadOnly(c *gin.Context, contextNames ...string) bool {
+	if err := readOnlyError(c.Request, contextNames...); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// readOnlyError returns readonly.ErrReadOnly when one of the contexts is read-only and the
+// request carries no break-glass token for it
+func readOnlyError(r *http.Request, contextNames ...string) error {
+	var restricted []string
+	for _, name := range contextNames {
+		if readonly.IsReadOnly(name) && !breakGlassRequest(r, name, breakglass.RestrictionReadOnly) {
+			restricted = append(restricted, name)
+		}
+	}
+	err := readonly.Check(restricted...)
+	if err == nil {
+		return nil
+	}
+
+	logger.Log(logger.LevelWarn, map[string]string{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}, err, "rejected mutating request to read-only context")
+	return err
+}
+
+// rejectKubectlTarget answers the request and returns true when a kubectl command overrides the
+// context, kubeconfig, server or user it runs against
+func rejectKubectlTarget(c *gin.Context, cmd []string) bool {
+	if err := readonly.CheckKubectlTarget(cmd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// RequireWritableCluster rejects requests to routes that change the cluster named in the
+// clusterName path parameter when that context is read-only
+func RequireWritableCluster(c *gin.Context) {
+	if rejectReadOnly(c, c.Param("clusterName")) {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// contextMetadata is the operator-managed metadata of a context
+type contextMetadata struct {
+	Context  string `json:"context"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// GetContextMetadataHandler returns the operator-managed metadata of a context with its ETag
+func GetContextMetadataHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+		if _, err := kubeConfigStore.GetContext(contextName); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+
+		writeEntity(c, http.StatusOK, contextMetadata{Context: contextName, ReadOnly: readonly.IsReadOnly(contextName)})
+	}
+}
+
+// SetContextReadOnlyHandler marks a context as read-only, or makes it writable again. If-Match makes the
+// change conditional on the current metadata.
+func SetContextReadOnlyHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+
+		var req struct {
+			ReadOnly *bool `json:"readOnly"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.ReadOnly == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "readOnly is required"})
+			return
+		}
+
+		if _, err := kubeConfigStore.GetContext(contextName); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+
+		conditionalWrites.Lock()
+		defer conditionalWrites.Unlock()
+		if preconditionFailed(c, contextMetadata{Context: contextName, ReadOnly: readonly.IsReadOnly(contextName)}) {
+			return
+		}
+
+		if err := readonly.GetStore().Set(contextName, *req.ReadOnly); err != nil {
+			logger.Log(logger.LevelError, map[string]string{"context": contextName}, err, "updating read-only flag")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update context: " + err.Error()})
+			return
+		}
+
+		logger.Log(logger.LevelInfo, map[string]string{
+			"context":  contextName,
+			"readOnly": strconv.FormatBool(*req.ReadOnly),
+		}, nil, "updated context read-only flag")
+
+		writeEntity(c, http.StatusOK, contextMetadata{Context: contextName, ReadOnly: *req.ReadOnly})
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recorder"
+	"github.com/gin-gonic/gin"
+)
+
+type RecorderHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+	recorder        *recorder.Recorder
+}
+
+func NewRecorderHandler(kubeConfigStore kubeconfig.ContextStore) *RecorderHandler {
+	kubeconfig.AddTransportHook(recorder.Wrap)
+
+	return &RecorderHandler{
+		kubeConfigStore: kubeConfigStore,
+		recorder:        recorder.GetRecorder(),
+	}
+}
+
+type startAPIRecordingRequest struct {
+	Cluster      string `json:"cluster" binding:"required"`
+	MaxEntries   int    `json:"maxEntries"`
+	MaxBodyBytes int    `json:"maxBodyBytes"`
+}
+
+// ListRecordings lists the API recordings, running ones first
+func (h *RecorderHandler) ListRecordings(c *gin.Context) {
+	recordings, err := h.recorder.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "recordings", recordings, nil)
+}
+
+// StartRecording starts recording the requests made to a cluster
+func (h *RecorderHandler) StartRecording(c *gin.Context) {
+	var req startAPIRecordingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if _, err := h.kubeConfigStore.GetContext(req.Cluster); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, err := h.recorder.Start(req.Cluster, recorder.Options{
+		MaxEntries:   req.MaxEntries,
+		MaxBodyBytes: req.MaxBodyBytes,
+	})
+	if errors.Is(err, recorder.ErrAlreadyRecording) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{"cluster": req.Cluster, "recording": summary.ID}, nil, "Started API recording")
+	c.JSON(http.StatusCreated, summary)
+}
+
+// StopRecording stops a running recording and saves its bundle
+func (h *RecorderHandler) StopRecording(c *gin.Context) {
+	summary, err := h.recorder.Stop(c.Param("id"))
+	if errors.Is(err, recorder.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"recording": c.Param("id")}, err, "saving API recording")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetRecording returns the bundle of a recording, as an attachment with ?download=true
+func (h *RecorderHandler) GetRecording(c *gin.Context) {
+	id := c.Param("id")
+	bundle, err := h.recorder.Get(id)
+	if errors.Is(err, recorder.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", `attachment; filename="recording-`+id+`.json"`)
+	}
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportRecording saves a bundle recorded by another operator, e.g. attached to a bug report
+func (h *RecorderHandler) ImportRecording(c *gin.Context) {
+	var bundle recorder.Bundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	summary, err := h.recorder.Import(&bundle)
+	if errors.Is(err, recorder.ErrInvalidBundle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, summary)
+}
+
+// DeleteRecording removes a stopped recording
+func (h *RecorderHandler) DeleteRecording(c *gin.Context) {
+	err := h.recorder.Delete(c.Param("id"))
+	if errors.Is(err, recorder.ErrStillRecording) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, recorder.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "recording deleted"})
+}
+
+// ReplayRecording serves the objects of a recording from a fake cluster and adds its context
+func (h *RecorderHandler) ReplayRecording(c *gin.Context) {
+	id := c.Param("id")
+	contextName, err := h.recorder.Replay(id, h.kubeConfigStore)
+	if errors.Is(err, recorder.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, recorder.ErrReplaying) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"recording": id}, err, "replaying API recording")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Replaying recording",
+		"context": contextName,
+	})
+}
+
+// StopReplay removes the replay context of a recording and stops its fake cluster
+func (h *RecorderHandler) StopReplay(c *gin.Context) {
+	err := h.recorder.StopReplay(c.Param("id"), h.kubeConfigStore)
+	if errors.Is(err, recorder.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Replay stopped"})
+}
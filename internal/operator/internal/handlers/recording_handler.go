@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recording"
+	"github.com/gin-gonic/gin"
+)
+
+type RecordingHandler struct {
+	manager *recording.Manager
+}
+
+func NewRecordingHandler() *RecordingHandler {
+	manager := recording.GetManager()
+	manager.Start()
+
+	return &RecordingHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the session recording settings
+func (h *RecordingHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the session recording settings and applies the retention policy
+func (h *RecordingHandler) UpdateSettings(c *gin.Context) {
+	var settings recording.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"enabled":     strconv.FormatBool(settings.Enabled),
+		"recordInput": strconv.FormatBool(settings.RecordInput),
+	}, nil, "Updated session recording settings")
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListRecordings lists recorded terminal sessions, filtered by the query parameters
+func (h *RecordingHandler) ListRecordings(c *gin.Context) {
+	filter := recording.Filter{
+		Cluster:   c.Query("cluster"),
+		Namespace: c.Query("namespace"),
+		Pod:       c.Query("pod"),
+		User:      c.Query("user"),
+	}
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 timestamp"})
+			return
+		}
+		filter.Since = parsed
+	}
+
+	recordings, err := h.manager.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "recordings", recordings, nil)
+}
+
+// GetRecording returns the metadata of a recording
+func (h *RecordingHandler) GetRecording(c *gin.Context) {
+	session, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// PlaybackRecording returns the header and events of a recording for a web player
+func (h *RecordingHandler) PlaybackRecording(c *gin.Context) {
+	id := c.Param("id")
+	path, err := h.manager.FilePath(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	header, events, err := recording.ReadCast(path)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"recording": id}, err, "Failed to read session recording")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"header": header,
+		"events": events,
+	})
+}
+
+// DownloadRecording serves the asciicast v2 file of a recording, playable with asciinema
+func (h *RecordingHandler) DownloadRecording(c *gin.Context) {
+	id := c.Param("id")
+	path, err := h.manager.FilePath(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-asciicast")
+	c.FileAttachment(path, id+".cast")
+}
+
+// DeleteRecording removes a finished recording
+func (h *RecordingHandler) DeleteRecording(c *gin.Context) {
+	if err := h.manager.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "recording deleted"})
+}
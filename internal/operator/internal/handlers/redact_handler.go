@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/redact"
+	"github.com/gin-gonic/gin"
+)
+
+type RedactionHandler struct {
+	manager *redact.Manager
+}
+
+func NewRedactionHandler() *RedactionHandler {
+	return &RedactionHandler{
+		manager: redact.GetManager(),
+	}
+}
+
+// GetSettings returns the annotation and label key patterns that are redacted
+func (h *RedactionHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the redacted key patterns, they apply to the next responses and events
+func (h *RedactionHandler) UpdateSettings(c *gin.Context) {
+	var settings redact.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
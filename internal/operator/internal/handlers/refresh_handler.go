@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GetContextRefreshHandler returns the refresh hook of a context and the state of its cached credentials
+func GetContextRefreshHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+
+		kubeContext, err := kubeConfigStore.GetContext(contextName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+
+		status, err := kubeconfig.GetRefreshHooks().Status(kubeContext)
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"context": contextName}, err, "reading refresh hook")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read refresh hook: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// SetContextRefreshHandler stores the refresh hook of a context, proxied requests use its credentials
+// from then on
+func SetContextRefreshHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+
+		var hook kubeconfig.RefreshHook
+		if err := c.ShouldBindJSON(&hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+
+		kubeContext, err := kubeConfigStore.GetContext(contextName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+		if hook.Command == "" && (kubeContext.AuthInfo == nil || kubeContext.AuthInfo.Exec == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "command is required, the kubeconfig user of the context has no exec plugin"})
+			return
+		}
+
+		if err := kubeconfig.GetRefreshHooks().Set(contextName, hook); err != nil {
+			if errors.Is(err, kubeconfig.ErrInvalidRefreshHook) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			logger.Log(logger.LevelError, map[string]string{"context": contextName}, err, "storing refresh hook")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store refresh hook: " + err.Error()})
+			return
+		}
+		kubeContext.ResetProxy()
+
+		status, err := kubeconfig.GetRefreshHooks().Status(kubeContext)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read refresh hook: " + err.Error()})
+			return
+		}
+
+		logger.Log(logger.LevelInfo, map[string]string{"context": contextName, "source": status.Source}, nil, "updated context refresh hook")
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// DeleteContextRefreshHandler removes the refresh hook of a context, it uses its kubeconfig credentials again
+func DeleteContextRefreshHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+
+		kubeContext, err := kubeConfigStore.GetContext(contextName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+
+		if err := kubeconfig.GetRefreshHooks().Remove(contextName); err != nil {
+			logger.Log(logger.LevelError, map[string]string{"context": contextName}, err, "removing refresh hook")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove refresh hook: " + err.Error()})
+			return
+		}
+		kubeContext.ResetProxy()
+
+		c.JSON(http.StatusOK, gin.H{"message": "Refresh hook removed"})
+	}
+}
+
+// RunContextRefreshHandler runs the refresh hook of a context now, to test it or replace revoked credentials
+func RunContextRefreshHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextName := c.Param("name")
+
+		kubeContext, err := kubeConfigStore.GetContext(contextName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Context not found"})
+			return
+		}
+
+		status, err := kubeconfig.GetRefreshHooks().Refresh(kubeContext)
+		if err != nil {
+			if errors.Is(err, kubeconfig.ErrInvalidRefreshHook) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refresh credentials: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	}
+}
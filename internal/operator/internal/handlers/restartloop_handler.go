@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/restartloop"
+	"github.com/gin-gonic/gin"
+)
+
+type RestartLoopHandler struct {
+	manager *restartloop.Manager
+}
+
+func NewRestartLoopHandler(kubeConfigStore kubeconfig.ContextStore) *RestartLoopHandler {
+	manager := restartloop.NewManager(kubeConfigStore)
+	manager.Start()
+
+	// Analyze pod updates as the watchers report them
+	controller.AddEventListener(manager.HandleEvent)
+
+	return &RestartLoopHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the restart loop analyzer settings
+func (h *RestartLoopHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the restart loop analyzer settings
+func (h *RestartLoopHandler) UpdateSettings(c *gin.Context) {
+	var settings restartloop.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListCaptures lists the crash captures, filtered by the cluster, namespace and pod query parameters
+func (h *RestartLoopHandler) ListCaptures(c *gin.Context) {
+	captures, err := h.manager.List(restartloop.Filter{
+		Cluster:   c.Query("cluster"),
+		Namespace: c.Query("namespace"),
+		Pod:       c.Query("pod"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "captures", captures, nil)
+}
+
+// GetCapture returns a single crash capture with its logs and events
+func (h *RestartLoopHandler) GetCapture(c *gin.Context) {
+	capture, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, capture)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/history"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recorder"
+	"github.com/agentkube/operator/pkg/recording"
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	manager *retention.Manager
+}
+
+func NewRetentionHandler() *RetentionHandler {
+	manager := retention.GetManager()
+	manager.Register("recordings", recording.GetManager().RetentionSource())
+	manager.Register("api-recordings", recorder.GetRecorder().RetentionSource())
+	manager.Register("history", history.GetManager().RetentionSource())
+	manager.Register("canvas-snapshots", canvas.GetSnapshotStore().RetentionSource())
+	for _, artifact := range []string{storage.ArtifactScans, storage.ArtifactSBOMs, storage.ArtifactSnapshots} {
+		manager.Register(artifact, storage.GetManager().RetentionSource(artifact))
+	}
+	manager.Start()
+
+	return &RetentionHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the retention settings and the data types policies can apply to
+func (h *RetentionHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+		"types":    h.manager.Types(),
+	})
+}
+
+// UpdateSettings replaces the retention settings
+func (h *RetentionHandler) UpdateSettings(c *gin.Context) {
+	var settings retention.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, nil, nil, "Updated retention settings")
+	c.JSON(http.StatusOK, settings)
+}
+
+// GetUsage returns the disk usage of every data type and of the config directory
+func (h *RetentionHandler) GetUsage(c *gin.Context) {
+	usage, err := h.manager.Usage(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// Prune applies the retention policies now, whether or not scheduled pruning is enabled
+func (h *RetentionHandler) Prune(c *gin.Context) {
+	results := h.manager.Prune(c.Request.Context())
+
+	writeList(c, "results", results, nil)
+}
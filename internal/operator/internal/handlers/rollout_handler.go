@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/rollout"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type RolloutHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewRolloutHandler(kubeConfigStore kubeconfig.ContextStore) *RolloutHandler {
+	return &RolloutHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// RestartRollout restarts the pods of a Deployment, StatefulSet or DaemonSet like kubectl rollout restart
+func (h *RolloutHandler) RestartRollout(c *gin.Context) {
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	restartedAt, err := manager.Restart(c.Request.Context(), workload)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	logRollout(c, workload, "restarted rollout")
+	c.JSON(http.StatusOK, gin.H{"workload": workload, "restartedAt": restartedAt})
+}
+
+// PauseRollout pauses the rollouts of a deployment
+func (h *RolloutHandler) PauseRollout(c *gin.Context) {
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	if err := manager.Pause(c.Request.Context(), workload); err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	logRollout(c, workload, "paused rollout")
+	c.JSON(http.StatusOK, gin.H{"workload": workload, "paused": true})
+}
+
+// ResumeRollout resumes the rollouts of a paused deployment
+func (h *RolloutHandler) ResumeRollout(c *gin.Context) {
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	if err := manager.Resume(c.Request.Context(), workload); err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	logRollout(c, workload, "resumed rollout")
+	c.JSON(http.StatusOK, gin.H{"workload": workload, "paused": false})
+}
+
+// GetRolloutHistory lists the revisions of a workload, oldest first
+func (h *RolloutHandler) GetRolloutHistory(c *gin.Context) {
+	workload, manager, ok := h.workload(c, false)
+	if !ok {
+		return
+	}
+	revisions, err := manager.History(c.Request.Context(), workload)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"workload": workload, "revisions": revisions})
+}
+
+// UndoRollout rolls a workload back to the toRevision of the body, the previous revision without one
+func (h *RolloutHandler) UndoRollout(c *gin.Context) {
+	var req struct {
+		ToRevision int64 `json:"toRevision"`
+	}
+	// The body is optional, an undo without one rolls back to the previous revision
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid undo request: " + err.Error()})
+			return
+		}
+	}
+	if req.ToRevision < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "toRevision must be positive"})
+		return
+	}
+
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	revision, err := manager.Undo(c.Request.Context(), workload, req.ToRevision)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	logRollout(c, workload, "rolled back rollout")
+	c.JSON(http.StatusOK, gin.H{"workload": workload, "revision": revision})
+}
+
+// workload resolves the workload of the path parameters and a rollout manager of its cluster,
+// rejecting mutations of read-only clusters
+func (h *RolloutHandler) workload(c *gin.Context, mutates bool) (rollout.Workload, *rollout.Manager, bool) {
+	clusterName := c.Param("clusterName")
+	workload := rollout.Workload{Kind: c.Param("kind"), Namespace: c.Param("namespace"), Name: c.Param("name")}
+	switch workload.Kind {
+	case rollout.KindDeployments, rollout.KindStatefulSets, rollout.KindDaemonSets:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be deployments, statefulsets or daemonsets"})
+		return workload, nil, false
+	}
+	if mutates && rejectReadOnly(c, clusterName) {
+		return workload, nil, false
+	}
+
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return workload, nil, false
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create clientset: " + err.Error()})
+		return workload, nil, false
+	}
+	return workload, rollout.NewManager(clientset), true
+}
+
+func writeRolloutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rollout.ErrUnsupported), errors.Is(err, rollout.ErrRevisionNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, rollout.ErrPaused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case apierrors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func logRollout(c *gin.Context, workload rollout.Workload, msg string) {
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":   c.Param("clusterName"),
+		"kind":      workload.Kind,
+		"namespace": workload.Namespace,
+		"name":      workload.Name,
+	}, nil, msg)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/sbom"
+	"github.com/gin-gonic/gin"
+)
+
+type SBOMHandler struct {
+	aggregator *sbom.Aggregator
+}
+
+func NewSBOMHandler(kubeConfigStore kubeconfig.ContextStore) *SBOMHandler {
+	return &SBOMHandler{
+		aggregator: sbom.NewAggregator(kubeConfigStore),
+	}
+}
+
+// GetInventory returns the package inventory of a cluster, or of a namespace when the namespace query parameter is set
+func (h *SBOMHandler) GetInventory(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	namespace := c.Query("namespace")
+
+	inventory, err := h.aggregator.Inventory(clusterName, namespace)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"cluster":   clusterName,
+			"namespace": namespace,
+		}, err, "Failed to build SBOM inventory")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to build SBOM inventory: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory)
+}
+
+// SearchPackages finds the workloads including a package across the fleet
+func (h *SBOMHandler) SearchPackages(c *gin.Context) {
+	var req sbom.SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := h.aggregator.Search(req)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"package": req.Name,
+			"version": req.Version,
+		}, err, "Failed to search packages")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to search packages: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
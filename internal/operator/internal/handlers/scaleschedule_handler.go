@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/scaleschedule"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type ScaleScheduleHandler struct {
+	manager *scaleschedule.Manager
+}
+
+func NewScaleScheduleHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *ScaleScheduleHandler {
+	manager := scaleschedule.NewManager(kubeConfigStore, queue)
+
+	// Register the scheduled scaling processor
+	processor := scaleschedule.NewScalingProcessor(manager)
+	queue.RegisterProcessor(scaleschedule.OperationApply, processor)
+	queue.RegisterProcessor(scaleschedule.OperationRevert, processor)
+
+	manager.Start()
+
+	return &ScaleScheduleHandler{
+		manager: manager,
+	}
+}
+
+// ListProfiles lists all scheduled scaling profiles
+func (h *ScaleScheduleHandler) ListProfiles(c *gin.Context) {
+	profiles, err := h.manager.ListProfiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "profiles", profiles, nil)
+}
+
+// GetProfile returns a single scheduled scaling profile
+func (h *ScaleScheduleHandler) GetProfile(c *gin.Context) {
+	profile, err := h.manager.GetProfile(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, profile)
+}
+
+// SaveProfile creates a profile, or replaces the one named in the path, conditionally on If-Match and If-None-Match
+func (h *ScaleScheduleHandler) SaveProfile(c *gin.Context) {
+	var profile scaleschedule.Profile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if name := c.Param("name"); name != "" {
+		profile.Name = name
+	}
+
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentProfile(profile.Name)) {
+		return
+	}
+
+	saved, err := h.manager.SaveProfile(profile)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"profile": profile.Name}, err, "Failed to save scaling profile")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, saved)
+}
+
+// DeleteProfile deletes a profile, restoring any workloads it scaled
+func (h *ScaleScheduleHandler) DeleteProfile(c *gin.Context) {
+	name := c.Param("name")
+
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentProfile(name)) {
+		return
+	}
+
+	if err := h.manager.DeleteProfile(name); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "scaling profile deleted successfully"})
+}
+
+// SetOverride manually suspends or activates a profile until a given time
+func (h *ScaleScheduleHandler) SetOverride(c *gin.Context) {
+	var override scaleschedule.Override
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	profile, err := h.manager.SetOverride(c.Param("name"), override)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// ClearOverride hands a profile back to its schedule
+func (h *ScaleScheduleHandler) ClearOverride(c *gin.Context) {
+	profile, err := h.manager.ClearOverride(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// ListCalendars lists all holiday calendars
+func (h *ScaleScheduleHandler) ListCalendars(c *gin.Context) {
+	calendars, err := h.manager.ListCalendars()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "calendars", calendars, nil)
+}
+
+// GetCalendar returns a single holiday calendar
+func (h *ScaleScheduleHandler) GetCalendar(c *gin.Context) {
+	calendar := h.currentCalendar(c.Param("name"))
+	if calendar == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "calendar " + c.Param("name") + " not found"})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, calendar)
+}
+
+// SaveCalendar creates or replaces a holiday calendar, conditionally on If-Match and If-None-Match
+func (h *ScaleScheduleHandler) SaveCalendar(c *gin.Context) {
+	var calendar scaleschedule.HolidayCalendar
+	if err := c.ShouldBindJSON(&calendar); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	calendar.Name = c.Param("name")
+
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentCalendar(calendar.Name)) {
+		return
+	}
+
+	if err := h.manager.SaveCalendar(calendar); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEntity(c, http.StatusOK, calendar)
+}
+
+// DeleteCalendar deletes a holiday calendar
+func (h *ScaleScheduleHandler) DeleteCalendar(c *gin.Context) {
+	conditionalWrites.Lock()
+	defer conditionalWrites.Unlock()
+	if preconditionFailed(c, h.currentCalendar(c.Param("name"))) {
+		return
+	}
+
+	if err := h.manager.DeleteCalendar(c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "calendar deleted successfully"})
+}
+
+// currentProfile returns the stored profile for precondition checks, nil when there is none
+func (h *ScaleScheduleHandler) currentProfile(name string) interface{} {
+	profile, err := h.manager.GetProfile(name)
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// currentCalendar returns the stored calendar, nil when there is none
+func (h *ScaleScheduleHandler) currentCalendar(name string) interface{} {
+	calendars, err := h.manager.ListCalendars()
+	if err != nil {
+		return nil
+	}
+	for i := range calendars {
+		if calendars[i].Name == name {
+			return &calendars[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/agentkube/operator/pkg/approvals"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/scaling"
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type ScalingHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewScalingHandler(kubeConfigStore kubeconfig.ContextStore) *ScalingHandler {
+	return &ScalingHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// ScaleWorkload sets the replicas of a Deployment, StatefulSet or ReplicaSet. Scaling to zero
+// needs the approval a proxied patch of the scale subresource would.
+func (h *ScalingHandler) ScaleWorkload(c *gin.Context) {
+	var req struct {
+		Replicas *int32 `json:"replicas" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scale request: " + err.Error()})
+		return
+	}
+
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s/scale", workload.Namespace, workload.Kind, workload.Name)
+	body, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": *req.Replicas}})
+	if requireApproval(c, approvals.NewProxyAction(c.Param("clusterName"), http.MethodPatch, path, body)) {
+		return
+	}
+
+	result, err := manager.Scale(c.Request.Context(), workload, *req.Replicas)
+	if err != nil {
+		writeScalingError(c, err)
+		return
+	}
+	logScaling(c, workload, "scaled workload to "+strconv.Itoa(int(result.Replicas))+" replicas")
+	c.JSON(http.StatusOK, result)
+}
+
+// GetAutoscaler returns the HorizontalPodAutoscaler of a workload
+func (h *ScalingHandler) GetAutoscaler(c *gin.Context) {
+	workload, manager, ok := h.workload(c, false)
+	if !ok {
+		return
+	}
+	autoscaler, err := manager.GetAutoscaler(c.Request.Context(), workload)
+	if err != nil {
+		writeScalingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, autoscaler)
+}
+
+// SetAutoscaler creates or updates the HorizontalPodAutoscaler of a workload
+func (h *ScalingHandler) SetAutoscaler(c *gin.Context) {
+	var spec scaling.AutoscalerSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid autoscaler: " + err.Error()})
+		return
+	}
+
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	autoscaler, created, err := manager.SetAutoscaler(c.Request.Context(), workload, spec)
+	if err != nil {
+		writeScalingError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	logScaling(c, workload, "set horizontal pod autoscaler "+autoscaler.Name)
+	c.JSON(status, autoscaler)
+}
+
+// DeleteAutoscaler deletes the HorizontalPodAutoscaler of a workload
+func (h *ScalingHandler) DeleteAutoscaler(c *gin.Context) {
+	workload, manager, ok := h.workload(c, true)
+	if !ok {
+		return
+	}
+	if err := manager.DeleteAutoscaler(c.Request.Context(), workload); err != nil {
+		writeScalingError(c, err)
+		return
+	}
+	logScaling(c, workload, "deleted horizontal pod autoscaler")
+	c.Status(http.StatusNoContent)
+}
+
+// workload resolves the workload of the path parameters and a scaling manager of its cluster,
+// rejecting mutations of read-only clusters
+func (h *ScalingHandler) workload(c *gin.Context, mutates bool) (scaling.Workload, *scaling.Manager, bool) {
+	clusterName := c.Param("clusterName")
+	workload := scaling.Workload{Kind: c.Param("kind"), Namespace: c.Param("namespace"), Name: c.Param("name")}
+	if err := scaling.ValidateWorkload(workload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return workload, nil, false
+	}
+	if mutates && rejectReadOnly(c, clusterName) {
+		return workload, nil, false
+	}
+
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return workload, nil, false
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create clientset: " + err.Error()})
+		return workload, nil, false
+	}
+	return workload, scaling.NewManager(clientset), true
+}
+
+func writeScalingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scaling.ErrUnsupported), errors.Is(err, scaling.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, scaling.ErrNoAutoscaler), apierrors.IsNotFound(err):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func logScaling(c *gin.Context, workload scaling.Workload, msg string) {
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":   c.Param("clusterName"),
+		"kind":      workload.Kind,
+		"namespace": workload.Namespace,
+		"name":      workload.Name,
+	}, nil, msg)
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/logger"
 	"github.com/agentkube/operator/pkg/search"
 	searchBleve "github.com/agentkube/operator/pkg/search/bleve"
@@ -417,3 +421,50 @@ func startWatchersForCluster(clusterName string, index bleve.Index, config *rest
 		"cluster": clusterName,
 	}, nil, "started resource watchers")
 }
+
+// SearchClustersHandler searches the resources of every context, or of the comma separated
+// clusters query parameter, by name substring, label selector and kind. The hits of all clusters
+// are merged with the cluster each came from, up to max, and clusters that couldn't be searched
+// are reported alongside them.
+func SearchClustersHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		split := func(value string) []string {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items
+		}
+
+		query := search.ClusterQuery{
+			Name:          c.Query("name"),
+			LabelSelector: c.Query("labelSelector"),
+			Kind:          c.Query("kind"),
+			Namespaces:    split(c.Query("namespaces")),
+			Clusters:      split(c.Query("clusters")),
+		}
+		if value := c.Query("max"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "max must be a positive number"})
+				return
+			}
+			query.Limit = n
+		}
+
+		response, err := search.SearchClusters(c.Request.Context(), kubeConfigStore, query)
+		if err != nil {
+			if errors.Is(err, search.ErrInvalidQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			logger.Log(logger.LevelError, map[string]string{"clusters": strings.Join(query.Clusters, ",")}, err, "searching clusters")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search clusters: " + err.Error()})
+			return
+		}
+
+		writeList(c, "results", response.Results, gin.H{"clusters": response.Clusters, "truncated": response.Truncated})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/selfupdate"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type SelfUpdateHandler struct {
+	manager *selfupdate.Manager
+}
+
+func NewSelfUpdateHandler(queue *utils.Queue, inCluster bool) *SelfUpdateHandler {
+	manager := selfupdate.NewManager(queue, inCluster)
+
+	queue.RegisterProcessor(selfupdate.OperationUpgrade, selfupdate.NewProcessor(manager))
+	manager.Start()
+
+	return &SelfUpdateHandler{
+		manager: manager,
+	}
+}
+
+// GetVersion returns the version and build information of the operator
+func (h *SelfUpdateHandler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, selfupdate.Info())
+}
+
+// GetSettings returns the update check settings
+func (h *SelfUpdateHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the update check settings
+func (h *SelfUpdateHandler) UpdateSettings(c *gin.Context) {
+	var settings selfupdate.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// GetUpdateStatus returns the result of the last update check
+func (h *SelfUpdateHandler) GetUpdateStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.Status())
+}
+
+// CheckForUpdate checks the release feed now
+func (h *SelfUpdateHandler) CheckForUpdate(c *gin.Context) {
+	status, err := h.manager.Check(c.Request.Context())
+	if err != nil {
+		logger.Log(logger.LevelWarn, nil, err, "Failed to check for operator updates")
+		c.JSON(http.StatusBadGateway, status)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Upgrade queues the upgrade of the in-cluster operator, to the latest version of the channel
+// unless a version is given
+func (h *SelfUpdateHandler) Upgrade(c *gin.Context) {
+	var req struct {
+		Version string `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if req.Version == "" {
+		status := h.manager.Status()
+		if !status.UpdateAvailable {
+			c.JSON(http.StatusConflict, gin.H{"error": "no update available, check for updates first or give a version"})
+			return
+		}
+		req.Version = status.Latest.Version
+	}
+
+	operation, err := h.manager.Upgrade(req.Version, "user")
+	if errors.Is(err, selfupdate.ErrNotInCluster) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "operator upgrade to " + req.Version + " started",
+		"operationId": operation.ID,
+	})
+}
@@ -49,6 +49,11 @@ func SystemShellHandler(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc
 			return
 		}
 
+		// A shell can run any command against the cluster
+		if rejectReadOnly(c, clusterName) {
+			return
+		}
+
 		// Upgrade connection to WebSocket
 		ws, err := systemShellUpgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
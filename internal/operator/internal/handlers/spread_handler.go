@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/spread"
+	"github.com/gin-gonic/gin"
+)
+
+type SpreadHandler struct {
+	reporter *spread.Reporter
+}
+
+func NewSpreadHandler(kubeConfigStore kubeconfig.ContextStore) *SpreadHandler {
+	return &SpreadHandler{
+		reporter: spread.NewReporter(kubeConfigStore),
+	}
+}
+
+// GetSpreadReport reports how multi-replica workloads are spread over zones and nodes, optionally
+// limited to the namespace query parameter
+func (h *SpreadHandler) GetSpreadReport(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	report, err := h.reporter.Report(clusterName, c.Query("namespace"))
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to analyze topology spread")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to analyze topology spread: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/statemetrics"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type StateMetricsHandler struct {
+	manager *statemetrics.Manager
+}
+
+func NewStateMetricsHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *StateMetricsHandler {
+	manager := statemetrics.NewManager(kubeConfigStore, queue)
+
+	processor := statemetrics.NewProcessor(manager)
+	queue.RegisterProcessor(statemetrics.OperationInstall, processor)
+	queue.RegisterProcessor(statemetrics.OperationUninstall, processor)
+	manager.Start()
+
+	return &StateMetricsHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the kube-state-metrics scraping settings
+func (h *StateMetricsHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the kube-state-metrics scraping settings
+func (h *StateMetricsHandler) UpdateSettings(c *gin.Context) {
+	var settings statemetrics.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// GetStatus returns the scraping state of a cluster
+func (h *StateMetricsHandler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.Status(c.Param("clusterName")))
+}
+
+// Scrape reads kube-state-metrics of a cluster now
+func (h *StateMetricsHandler) Scrape(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	status, err := h.manager.Scrape(c.Request.Context(), clusterName)
+	if errors.Is(err, statemetrics.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kube-state-metrics is not running in the cluster, install it first"})
+		return
+	}
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to scrape kube-state-metrics")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Install queues the installation of kube-state-metrics
+func (h *StateMetricsHandler) Install(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	operation := h.manager.Install(clusterName)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "kube-state-metrics installation started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":  operation.Status,
+			"cluster": clusterName,
+		},
+	})
+}
+
+// Uninstall queues the removal of the kube-state-metrics installed by agentkube
+func (h *StateMetricsHandler) Uninstall(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	operation := h.manager.Uninstall(clusterName)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":     true,
+		"message":     "kube-state-metrics uninstallation started",
+		"operationId": operation.ID,
+		"data": gin.H{
+			"status":  operation.Status,
+			"cluster": clusterName,
+		},
+	})
+}
+
+// ListSeries returns the series of a metric, ?metric=kube_deployment_status_replicas_available&match=namespace=shop&since=1h
+func (h *StateMetricsHandler) ListSeries(c *gin.Context) {
+	metric := c.Query("metric")
+	if !statemetrics.Families[metric] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metric must be one of the kept kube-state-metrics families"})
+		return
+	}
+
+	matchers := map[string]string{}
+	for _, match := range c.QueryArray("match") {
+		key, value, ok := strings.Cut(match, "=")
+		if !ok || key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "match must be label=value"})
+			return
+		}
+		matchers[key] = value
+	}
+
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a positive duration, e.g. 30m"})
+			return
+		}
+		since = time.Now().Add(-duration)
+	}
+
+	series := h.manager.Series(c.Param("clusterName"), metric, matchers, since)
+
+	writeList(c, "series", series, gin.H{"metric": metric})
+}
+
+// ListWorkloads returns the availability of the deployments, statefulsets and daemonsets of a cluster
+func (h *StateMetricsHandler) ListWorkloads(c *gin.Context) {
+	workloads := h.manager.Workloads(c.Param("clusterName"))
+
+	writeList(c, "workloads", workloads, nil)
+}
+
+// ListJobs returns the outcome of the jobs of a cluster
+func (h *StateMetricsHandler) ListJobs(c *gin.Context) {
+	jobs := h.manager.Jobs(c.Param("clusterName"))
+
+	writeList(c, "jobs", jobs, nil)
+}
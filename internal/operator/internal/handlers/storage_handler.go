@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type StorageHandler struct {
+	manager *storage.Manager
+}
+
+func NewStorageHandler() *StorageHandler {
+	manager := storage.GetManager()
+	manager.Start()
+
+	return &StorageHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the artifact storage settings without secret keys
+func (h *StorageHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings.Redacted())
+}
+
+// UpdateSettings replaces the artifact storage settings
+func (h *StorageHandler) UpdateSettings(c *gin.Context) {
+	var settings storage.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log(logger.LevelInfo, nil, nil, "Updated artifact storage settings")
+	c.JSON(http.StatusOK, settings.Redacted())
+}
+
+// ListObjects lists the stored objects of an artifact type
+func (h *StorageHandler) ListObjects(c *gin.Context) {
+	artifact := c.Param("artifact")
+	if err := (storage.Settings{Artifacts: map[string]storage.ArtifactSettings{artifact: {}}}).Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	backend, err := h.manager.Backend(c.Request.Context(), artifact)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	objects, err := backend.List(c.Request.Context(), c.Query("prefix"))
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"artifact": artifact}, err, "Failed to list stored artifacts")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"objects": objects,
+		"count":   len(objects),
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/listing"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/tables"
+	"github.com/gin-gonic/gin"
+)
+
+type TableHandler struct {
+	renderer *tables.Renderer
+	views    *tables.ViewStore
+}
+
+func NewTableHandler(kubeConfigStore kubeconfig.ContextStore) *TableHandler {
+	return &TableHandler{
+		renderer: tables.NewRenderer(kubeConfigStore),
+		views:    tables.GetViewStore(),
+	}
+}
+
+// RenderTable lists resources of a cluster as table rows, with the server columns and the
+// custom columns of the saved view and the request
+func (h *TableHandler) RenderTable(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	var req tables.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	// Tables page on the API server, the listing limit and continue parameters are passed through
+	// and the continue token is the API server's own
+	values := c.Request.URL.Query()
+	values.Del(listing.ParamContinue)
+	query, err := listing.Parse(values)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = int64(query.Limit)
+	}
+	if req.Continue == "" {
+		req.Continue = c.Query(listing.ParamContinue)
+	}
+
+	table, err := h.renderer.Render(c.Request.Context(), clusterName, req)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"clusterName": clusterName,
+			"resource":    tables.ResourceKey(req.Group, req.Resource),
+		}, err, "rendering resource table")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render table: " + err.Error()})
+		return
+	}
+
+	if table.Continue != "" {
+		c.Header(listing.HeaderContinue, table.Continue)
+	}
+	c.JSON(http.StatusOK, table)
+}
+
+// ListViews returns the saved column layouts
+func (h *TableHandler) ListViews(c *gin.Context) {
+	views, err := h.views.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, "views", views, nil)
+}
+
+// GetView returns the saved column layout of a resource
+func (h *TableHandler) GetView(c *gin.Context) {
+	view, err := h.views.Get(c.Param("resource"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if view == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// SaveView creates or replaces the column layout of a resource
+func (h *TableHandler) SaveView(c *gin.Context) {
+	var view tables.View
+	if err := c.ShouldBindJSON(&view); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	view.Resource = c.Param("resource")
+
+	saved, err := h.views.Save(view)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteView removes the column layout of a resource
+func (h *TableHandler) DeleteView(c *gin.Context) {
+	if err := h.views.Delete(c.Param("resource")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "view deleted"})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/traffic"
+	"github.com/gin-gonic/gin"
+)
+
+type TrafficHandler struct {
+	collector *traffic.Collector
+}
+
+func NewTrafficHandler(kubeConfigStore kubeconfig.ContextStore) *TrafficHandler {
+	return &TrafficHandler{
+		collector: traffic.NewCollector(kubeConfigStore),
+	}
+}
+
+// GetDependencyMap returns the service-to-service flows observed by Istio or Hubble over the window
+// query parameter, optionally limited to the flows into the namespace query parameter
+func (h *TrafficHandler) GetDependencyMap(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	window, err := traffic.ParseWindow(c.Query("window"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dependencyMap, err := h.collector.Collect(clusterName, c.Query("namespace"), window)
+	if err != nil {
+		if errors.Is(err, traffic.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to collect service traffic")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to collect service traffic: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dependencyMap)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/metrics"
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
+)
+
+type UsageHandler struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+func NewUsageHandler(kubeConfigStore kubeconfig.ContextStore) *UsageHandler {
+	return &UsageHandler{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// ListNodeUsage returns the CPU and memory usage of the nodes of a cluster, busiest CPU first, with
+// the list query parameters: ?limit=5 is the top 5 nodes, ?sortBy=memoryPercent&order=desc&limit=5
+// the top 5 by memory share
+func (h *UsageHandler) ListNodeUsage(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+	report, err := metrics.FetchNodeUsage(c.Request.Context(), clientset)
+	if err != nil {
+		writeUsageError(c, err)
+		return
+	}
+	writeList(c, "nodes", report.Nodes, gin.H{
+		"cluster":  c.Param("clusterName"),
+		"usage":    report.Total,
+		"warnings": report.Warnings,
+	})
+}
+
+// ListPodUsage returns the CPU and memory usage of the pods of a cluster, or of a namespace with
+// ?namespace=shop, busiest CPU first. ?limit=10&sortBy=memoryBytes&order=desc is the top 10 by memory.
+func (h *UsageHandler) ListPodUsage(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+	report, err := metrics.FetchPodUsage(c.Request.Context(), clientset, c.Query("namespace"))
+	if err != nil {
+		writeUsageError(c, err)
+		return
+	}
+	writeList(c, "pods", report.Pods, gin.H{
+		"cluster": c.Param("clusterName"),
+		"usage":   report.Total,
+	})
+}
+
+// ListNamespaceUsage rolls up the CPU and memory usage of the pods of a cluster by namespace,
+// busiest CPU first
+func (h *UsageHandler) ListNamespaceUsage(c *gin.Context) {
+	clientset, ok := h.clientset(c)
+	if !ok {
+		return
+	}
+	report, err := metrics.FetchPodUsage(c.Request.Context(), clientset, "")
+	if err != nil {
+		writeUsageError(c, err)
+		return
+	}
+	writeList(c, "namespaces", report.Namespaces(), gin.H{
+		"cluster": c.Param("clusterName"),
+		"usage":   report.Total,
+	})
+}
+
+func (h *UsageHandler) clientset(c *gin.Context) (kubernetes.Interface, bool) {
+	clusterName := c.Param("clusterName")
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "context not found: " + clusterName})
+		return nil, false
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create clientset: " + err.Error()})
+		return nil, false
+	}
+	return clientset, true
+}
+
+// writeUsageError answers 503 when metrics server is missing, clients offer to install it with
+// the metrics server install endpoint
+func writeUsageError(c *gin.Context, err error) {
+	clusterName := c.Param("clusterName")
+	if errors.Is(err, metrics.ErrMetricsUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":         err.Error(),
+			"metricsServer": false,
+		})
+		return
+	}
+	logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "reading resource usage")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/usagehistory"
+	"github.com/gin-gonic/gin"
+)
+
+type UsageHistoryHandler struct {
+	manager *usagehistory.Manager
+}
+
+func NewUsageHistoryHandler(kubeConfigStore kubeconfig.ContextStore) *UsageHistoryHandler {
+	manager := usagehistory.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &UsageHistoryHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the usage history recorder settings
+func (h *UsageHistoryHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the usage history recorder settings
+func (h *UsageHistoryHandler) UpdateSettings(c *gin.Context) {
+	var settings usagehistory.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// Sample records the current node and pod usage of a cluster, answering 503 like the usage
+// endpoints without metrics server
+func (h *UsageHistoryHandler) Sample(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	if err := h.manager.Sample(c.Request.Context(), clusterName); err != nil {
+		writeUsageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Usage sampled"})
+}
+
+// ListNodes returns the sparklines of the nodes of a cluster, ?range=1h, 6h or 24h
+func (h *UsageHistoryHandler) ListNodes(c *gin.Context) {
+	rangeName, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	series, err := h.manager.Nodes(c.Param("clusterName"), rangeName)
+	h.writeSeriesList(c, "nodes", series, err)
+}
+
+// ListPods returns the sparklines of the pods of a cluster, ?namespace=shop&range=6h
+func (h *UsageHistoryHandler) ListPods(c *gin.Context) {
+	rangeName, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	series, err := h.manager.Pods(c.Param("clusterName"), c.Query("namespace"), rangeName)
+	h.writeSeriesList(c, "pods", series, err)
+}
+
+// GetNode returns the sparkline of a node, ?range=1h, 6h or 24h
+func (h *UsageHistoryHandler) GetNode(c *gin.Context) {
+	rangeName, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	series, err := h.manager.Node(c.Param("clusterName"), c.Param("name"), rangeName)
+	h.writeSeries(c, series, err)
+}
+
+// GetPod returns the sparkline of a pod, ?range=1h, 6h or 24h
+func (h *UsageHistoryHandler) GetPod(c *gin.Context) {
+	rangeName, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	series, err := h.manager.Pod(c.Param("clusterName"), c.Param("namespace"), c.Param("podName"), rangeName)
+	h.writeSeries(c, series, err)
+}
+
+func (h *UsageHistoryHandler) writeSeriesList(c *gin.Context, key string, series []usagehistory.Series, err error) {
+	clusterName := c.Param("clusterName")
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to read usage history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeList(c, key, series, gin.H{"cluster": clusterName})
+}
+
+func (h *UsageHistoryHandler) writeSeries(c *gin.Context, series *usagehistory.Series, err error) {
+	if err != nil {
+		if errors.Is(err, usagehistory.ErrNoHistory) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.LevelError, map[string]string{"cluster": c.Param("clusterName")}, err, "Failed to read usage history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// usageRange reads the range of the sparklines, 1h by default
+func usageRange(c *gin.Context) (string, bool) {
+	rangeName := c.DefaultQuery("range", "1h")
+	if _, ok := usagehistory.Ranges[rangeName]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "range must be 1h, 6h or 24h"})
+		return "", false
+	}
+	return rangeName, true
+}
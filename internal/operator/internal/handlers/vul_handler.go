@@ -2,26 +2,66 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/agentkube/operator/pkg/controller"
 	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/listing"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/posture"
+	"github.com/agentkube/operator/pkg/scanjobs"
+	"github.com/agentkube/operator/pkg/scanschedule"
+	"github.com/agentkube/operator/pkg/utils"
 	"github.com/agentkube/operator/pkg/vul"
 	"github.com/gin-gonic/gin"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
+// defaultPostureTrendDays is the trend window of the posture when no days are asked for
+const defaultPostureTrendDays = 30
+
 type VulnerabilityHandler struct {
 	kubeConfigStore kubeconfig.ContextStore
+	posture         *posture.Posture
+	// scans discovers and queues the images of clusters, nil without scanner
+	scans *scanschedule.Scheduler
+	// jobs tracks scans of images to completion, nil without scanner
+	jobs *scanjobs.Manager
 }
 
-func NewVulnerabilityHandler(kubeConfigStore kubeconfig.ContextStore) *VulnerabilityHandler {
-	return &VulnerabilityHandler{
+func NewVulnerabilityHandler(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *VulnerabilityHandler {
+	h := &VulnerabilityHandler{
 		kubeConfigStore: kubeConfigStore,
+		posture:         posture.NewPosture(kubeConfigStore, scannedSeverities),
+	}
+
+	if vul.ImgScanner != nil {
+		h.jobs = scanjobs.NewManager(queue, vul.ImgScanner.Enqueue, scanJobState)
+		queue.RegisterProcessor(scanjobs.OperationScan, h.jobs)
+
+		vul.ImgScanner.SetWorkloadResolver(h.imageWorkloads)
+		h.scans = scanschedule.NewScheduler(kubeConfigStore, vul.ImgScanner.Enqueue, vul.ImgScanner.ShouldExclude, scannedSeverities)
+		if vul.ImgScanner.Config().PullSecrets {
+			h.scans.SetCredentialSink(vul.ImgScanner.SetPullCredentials)
+		}
+		if schedule := vul.ImgScanner.Config().Schedule; schedule != nil {
+			err := h.scans.Start(schedule.Cron, schedule.Clusters, scanschedule.Target{Namespaces: schedule.Namespaces})
+			if err != nil {
+				logger.Log(logger.LevelError, map[string]string{"cron": schedule.Cron}, err, "starting scheduled image scans")
+			}
+		}
 	}
+
+	return h
 }
 
 // GetScannerStatus returns the current status of the vulnerability scanner
@@ -37,11 +77,15 @@ func (h *VulnerabilityHandler) GetScannerStatus(c *gin.Context) {
 		return
 	}
 
+	// Registry credentials are listed without their passwords and tokens
+	config := vul.ImgScanner.Config()
 	c.JSON(http.StatusOK, gin.H{
 		"status": gin.H{
 			"available":   true,
 			"initialized": vul.ImgScanner.IsEnabled(),
 		},
+		"registries":  config.Registries,
+		"pullSecrets": config.PullSecrets,
 	})
 }
 
@@ -58,6 +102,13 @@ func (h *VulnerabilityHandler) ScanImages(c *gin.Context) {
 		return
 	}
 
+	// Filters and ranks apply to the vulnerabilities of each image, results aren't paged
+	vq, _, err := parseVulnerabilityQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if vul.ImgScanner == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
 		return
@@ -89,9 +140,11 @@ func (h *VulnerabilityHandler) ScanImages(c *gin.Context) {
 	for _, img := range req.Images {
 		scan, found := vul.ImgScanner.GetScan(img)
 		if found && scan != nil {
+			vulns := convertVulnerabilities(scan)
 			result := ScanResult{
 				Image:           img,
-				Vulnerabilities: convertVulnerabilities(scan),
+				Vulnerabilities: vq.apply(vulns),
+				MaxCVSS:         maxCVSS(vulns),
 				Summary: Summary{
 					Critical: scan.Tally.Critical,
 					High:     scan.Tally.High,
@@ -123,7 +176,9 @@ func (h *VulnerabilityHandler) ScanImages(c *gin.Context) {
 	})
 }
 
-// GetImageScanResults retrieves scan results for a specific image
+// GetImageScanResults retrieves the scan results of an image. Its vulnerabilities are narrowed by
+// the severity, package and fixAvailable query parameters, sorted by cvss, severity or any of their
+// fields and paged with the listing convention. The summary counts every vulnerability.
 func (h *VulnerabilityHandler) GetImageScanResults(c *gin.Context) {
 	image := c.Query("image")
 	if image == "" {
@@ -131,6 +186,12 @@ func (h *VulnerabilityHandler) GetImageScanResults(c *gin.Context) {
 		return
 	}
 
+	vq, query, err := parseVulnerabilityQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if vul.ImgScanner == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
 		return
@@ -146,9 +207,72 @@ func (h *VulnerabilityHandler) GetImageScanResults(c *gin.Context) {
 		return
 	}
 
-	result := ScanResult{
-		Image:           image,
-		Vulnerabilities: convertVulnerabilities(scan),
+	vulns := convertVulnerabilities(scan)
+	page, err := listing.Apply(vq.apply(vulns), query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, listing.ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	listing.SetHeaders(c.Writer.Header(), page)
+	result := scanSummary(image, scan)
+	result.Vulnerabilities = page.Items
+	result.MaxCVSS = maxCVSS(vulns)
+	result.Matching = page.Total
+	result.Continue = page.Continue
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListAllScanResults lists the scanned images with their summaries, without their vulnerabilities.
+// The severity, package and fixAvailable query parameters keep the images with a matching
+// vulnerability, counted in matching. Images sort by cvss, their highest score, by severity, their
+// most severe counts first, or by any of their fields, and are paged with the listing convention.
+func (h *VulnerabilityHandler) ListAllScanResults(c *gin.Context) {
+	vq, query, err := parseVulnerabilityQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if vul.ImgScanner == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	results := []ScanResult{}
+	for _, image := range vul.ImgScanner.ScannedImages() {
+		scan, ok := vul.ImgScanner.GetScan(image)
+		if !ok {
+			continue
+		}
+		result := scanSummary(image, scan)
+		vulns := convertVulnerabilities(scan)
+		result.MaxCVSS = maxCVSS(vulns)
+		if vq.filtering() {
+			if result.Matching = len(vq.apply(vulns)); result.Matching == 0 {
+				continue
+			}
+		}
+		results = append(results, result)
+	}
+	sortScanResults(results, vq)
+
+	writeListQuery(c, "results", results, query, nil)
+}
+
+// scanSummary returns the result of a scan without its vulnerabilities
+func scanSummary(image string, scan *vul.Scan) ScanResult {
+	status := "completed"
+	if vul.ImgScanner.IsScanning(image) {
+		status = "scanning"
+	}
+	return ScanResult{
+		Image: image,
 		Summary: Summary{
 			Critical: scan.Tally.Critical,
 			High:     scan.Tally.High,
@@ -158,30 +282,187 @@ func (h *VulnerabilityHandler) GetImageScanResults(c *gin.Context) {
 			Total:    scan.Tally.Total,
 		},
 		ScanTime: time.Now().Format(time.RFC3339),
-		Status:   "completed",
+		Status:   status,
 	}
+}
 
-	c.JSON(http.StatusOK, result)
+// sortScanResults orders images by their highest CVSS score or their most severe counts
+func sortScanResults(results []ScanResult, vq vulnerabilityQuery) {
+	var less func(a, b ScanResult) bool
+	switch vq.sortBy {
+	case sortByCVSS:
+		less = func(a, b ScanResult) bool {
+			// Images without a score go last in both orders
+			if a.MaxCVSS == nil || b.MaxCVSS == nil {
+				return a.MaxCVSS != nil && b.MaxCVSS == nil
+			}
+			if vq.ascending {
+				return *a.MaxCVSS < *b.MaxCVSS
+			}
+			return *a.MaxCVSS > *b.MaxCVSS
+		}
+	case sortBySeverity:
+		less = func(a, b ScanResult) bool {
+			x := []int{a.Summary.Critical, a.Summary.High, a.Summary.Medium, a.Summary.Low}
+			y := []int{b.Summary.Critical, b.Summary.High, b.Summary.Medium, b.Summary.Low}
+			for i := range x {
+				if x[i] != y[i] {
+					if vq.ascending {
+						return x[i] < y[i]
+					}
+					return x[i] > y[i]
+				}
+			}
+			return false
+		}
+	default:
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool { return less(results[i], results[j]) })
 }
 
-// ListAllScanResults lists all vulnerability scan results with optional filtering and pagination
-func (h *VulnerabilityHandler) ListAllScanResults(c *gin.Context) {
+// GetPosture aggregates the scan results of the images running across clusters: the images ranked
+// by risk or blast radius, the totals of every cluster and their trends. The optional clusters query
+// parameter is a comma separated list of contexts, rank is risk or pods, and days the trend window,
+// 0 leaving the trends out.
+func (h *VulnerabilityHandler) GetPosture(c *gin.Context) {
 	if vul.ImgScanner == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
 		return
 	}
 
-	// TODO: Implement pagination and filtering
-	_ = c.Query("severity") // Placeholder for future filtering
+	opts := posture.Options{Rank: c.Query("rank")}
+	for _, name := range strings.Split(c.Query("clusters"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Clusters = append(opts.Clusters, name)
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		opts.Limit = n
+	}
+	days := defaultPostureTrendDays
+	if value := c.Query("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 90"})
+			return
+		}
+		days = n
+	}
+	if days > 0 {
+		opts.Since = time.Now().AddDate(0, 0, -days)
+	}
 
-	var results []ScanResult
+	report, err := h.posture.Report(opts)
+	if err != nil {
+		if errors.Is(err, posture.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.LevelError, map[string]string{"clusters": strings.Join(opts.Clusters, ",")}, err, "aggregating vulnerability posture")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate vulnerability posture: " + err.Error()})
+		return
+	}
 
-	// Since we can't directly iterate over scans map safely, we'll return empty for now
-	// In a real implementation, you'd want to implement a proper scan results store
-	c.JSON(http.StatusOK, gin.H{
-		"results": results,
-		"total":   len(results),
-	})
+	c.JSON(http.StatusOK, report)
+}
+
+// scannedSeverities returns the vulnerability counts of a scanned image. Images still scanning
+// count as unscanned, their partial results would read as clean.
+func scannedSeverities(image string) (posture.Severities, bool) {
+	if vul.ImgScanner == nil || vul.ImgScanner.IsScanning(image) {
+		return posture.Severities{}, false
+	}
+	scan, ok := vul.ImgScanner.GetScan(image)
+	if !ok {
+		return posture.Severities{}, false
+	}
+	return posture.Severities{
+		Critical: scan.Tally.Critical,
+		High:     scan.Tally.High,
+		Medium:   scan.Tally.Medium,
+		Low:      scan.Tally.Low,
+		Unknown:  scan.Tally.Unknown,
+		Total:    scan.Tally.Total,
+	}, true
+}
+
+// scanJobState returns the state of the scan of an image followed by scan jobs
+func scanJobState(image string) scanjobs.ImageState {
+	if vul.ImgScanner.IsScanning(image) {
+		return scanjobs.ImageState{Status: scanjobs.ImageScanning}
+	}
+	scan, ok := vul.ImgScanner.GetScan(image)
+	if !ok {
+		return scanjobs.ImageState{Status: scanjobs.ImageQueued}
+	}
+	if scan.Error != "" {
+		return scanjobs.ImageState{Status: scanjobs.ImageFailed, Error: scan.Error}
+	}
+	severities, _ := scannedSeverities(image)
+	return scanjobs.ImageState{Status: scanjobs.ImageCompleted, Severities: &severities}
+}
+
+// CreateScanJob queues the scan of images as a job whose progress is read by ID
+func (h *VulnerabilityHandler) CreateScanJob(c *gin.Context) {
+	var req scanjobs.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	job, err := h.jobs.Create(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetScanJob returns a scan job with the progress of each image
+func (h *VulnerabilityHandler) GetScanJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	job, err := h.jobs.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelScanJob stops a scan job, scans already started keep their results
+func (h *VulnerabilityHandler) CancelScanJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	job, err := h.jobs.Cancel(c.Param("id"))
+	switch {
+	case errors.Is(err, scanjobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
 }
 
 // GetClusterImages discovers and returns all container images in a cluster
@@ -221,15 +502,14 @@ func (h *VulnerabilityHandler) GetClusterImages(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	writeList(c, "images", images, gin.H{
 		"cluster":   clusterName,
 		"namespace": namespace,
-		"images":    images,
-		"count":     len(images),
 	})
 }
 
-// TriggerClusterImageScan triggers vulnerability scans for images found in cluster resources
+// TriggerClusterImageScan discovers the images of the pods of a cluster, optionally narrowed to a
+// namespace and labels, queues them for scanning and returns the summary of the scan
 func (h *VulnerabilityHandler) TriggerClusterImageScan(c *gin.Context) {
 	clusterName := c.Param("clusterName")
 	if clusterName == "" {
@@ -243,7 +523,7 @@ func (h *VulnerabilityHandler) TriggerClusterImageScan(c *gin.Context) {
 		return
 	}
 
-	if vul.ImgScanner == nil {
+	if vul.ImgScanner == nil || h.scans == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
 		return
 	}
@@ -256,16 +536,57 @@ func (h *VulnerabilityHandler) TriggerClusterImageScan(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement actual cluster resource scanning
-	// For now, just return a success message
+	target := scanschedule.Target{Labels: req.Labels}
+	if req.Namespace != "" {
+		target.Namespaces = []string{req.Namespace}
+	}
+	summary, err := h.scans.Scan(c.Request.Context(), clusterName, target, scanschedule.TriggerManual)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName, "namespace": req.Namespace}, err, "triggering cluster image scan")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan cluster images: " + err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Image scan triggered for cluster",
 		"cluster":      clusterName,
 		"namespace":    req.Namespace,
 		"resourceType": req.ResourceType,
+		"summary":      summary,
 	})
 }
 
+// GetScanSchedule returns the schedule of the image scans with the latest scan summary of every cluster
+func (h *VulnerabilityHandler) GetScanSchedule(c *gin.Context) {
+	if h.scans == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	status, err := h.scans.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetClusterScanSummaries returns the image scan summaries of a cluster, newest first
+func (h *VulnerabilityHandler) GetClusterScanSummaries(c *gin.Context) {
+	if h.scans == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	clusterName := c.Param("clusterName")
+	summaries, err := h.scans.Summaries(clusterName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeList(c, "summaries", summaries, gin.H{"cluster": clusterName})
+}
+
 // GetWorkloadsByImage returns all workloads using a specific image in a cluster
 func (h *VulnerabilityHandler) GetWorkloadsByImage(c *gin.Context) {
 	clusterName := c.Param("clusterName")
@@ -304,17 +625,31 @@ func (h *VulnerabilityHandler) GetWorkloadsByImage(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	workloads, err := h.discoverWorkloadsByImage(ctx, clientset, req.Image)
+	workloads, err := h.discoverWorkloadsByImage(ctx, clientset, controller.NewInformerLister(clusterName), req.Image)
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName, "image": req.Image}, err, "discovering workloads by image")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to discover workloads"})
 		return
 	}
 
+	query, err := listing.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := listing.Apply(workloads, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	listing.SetHeaders(c.Writer.Header(), page)
 	c.JSON(http.StatusOK, ImageWorkloadsResponse{
 		Image:     req.Image,
-		Workloads: workloads,
-		Count:     len(workloads),
+		Workloads: page.Items,
+		Count:     len(page.Items),
+		Total:     page.Total,
+		Continue:  page.Continue,
 	})
 }
 
@@ -344,6 +679,10 @@ type WorkloadResource struct {
 	Containers  []ContainerInfo   `json:"containers"`
 	CreatedAt   string            `json:"createdAt,omitempty"`
 	Status      string            `json:"status,omitempty"`
+	// Pods are the pods a controller runs, listed only when the cluster watchers index owner references
+	Pods []string `json:"pods,omitempty"`
+	// ControlledBy is the Kind/name of the controller of pods, replica sets and jobs, if any
+	ControlledBy string `json:"controlledBy,omitempty"`
 }
 
 type ContainerInfo struct {
@@ -356,6 +695,8 @@ type ImageWorkloadsResponse struct {
 	Image     string             `json:"image"`
 	Workloads []WorkloadResource `json:"workloads"`
 	Count     int                `json:"count"`
+	Total     int                `json:"total"`
+	Continue  string             `json:"continue"`
 }
 
 type ScanResult struct {
@@ -364,6 +705,12 @@ type ScanResult struct {
 	Summary         Summary         `json:"summary"`
 	ScanTime        string          `json:"scanTime"`
 	Status          string          `json:"status"`
+	// MaxCVSS is the highest CVSS score of the vulnerabilities of the image
+	MaxCVSS *float64 `json:"maxCvss,omitempty"`
+	// Matching counts the vulnerabilities passing the filters of the query, over every page
+	Matching int `json:"matching,omitempty"`
+	// Continue fetches the next page of vulnerabilities, empty on the last one
+	Continue string `json:"continue,omitempty"`
 }
 
 type Vulnerability struct {
@@ -532,6 +879,23 @@ func (h *VulnerabilityHandler) discoverClusterImages(ctx context.Context, client
 			imageMap[container.Image] = imageInfo
 		}
 
+		// Process ephemeral debug containers
+		for _, container := range pod.Spec.EphemeralContainers {
+			imageInfo := vul.ImageInfo{
+				Name:        container.Name,
+				Namespace:   pod.Namespace,
+				PodName:     pod.Name,
+				Container:   container.Name,
+				Labels:      pod.Labels,
+				Annotations: pod.Annotations,
+				Image:       container.Image,
+				ImageID:     "", // Will be populated from status if available
+			}
+
+			// Use image as unique key to avoid duplicates
+			imageMap[container.Image] = imageInfo
+		}
+
 		// Update with actual image IDs from pod status
 		for _, containerStatus := range pod.Status.ContainerStatuses {
 			for imageKey, imageInfo := range imageMap {
@@ -555,6 +919,18 @@ func (h *VulnerabilityHandler) discoverClusterImages(ctx context.Context, client
 				}
 			}
 		}
+
+		// Update with actual image IDs from ephemeral container status
+		for _, containerStatus := range pod.Status.EphemeralContainerStatuses {
+			for imageKey, imageInfo := range imageMap {
+				if imageInfo.Container == containerStatus.Name &&
+					imageInfo.PodName == pod.Name &&
+					imageInfo.Namespace == pod.Namespace {
+					imageInfo.ImageID = containerStatus.ImageID
+					imageMap[imageKey] = imageInfo
+				}
+			}
+		}
 	}
 
 	// Convert map to slice
@@ -565,17 +941,86 @@ func (h *VulnerabilityHandler) discoverClusterImages(ctx context.Context, client
 	return images, nil
 }
 
-// discoverWorkloadsByImage discovers all workloads (Deployments, ReplicaSets, StatefulSets, DaemonSets, Jobs, CronJobs, Pods) using a specific image
-func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, clientset *kubernetes.Clientset, targetImage string) ([]WorkloadResource, error) {
-	var workloads []WorkloadResource
+// imageWorkloads returns the workloads running an image across the clusters, as
+// cluster/namespace/kind/name. Pods and replica sets are left to the workloads managing them, pods
+// are listed only for clusters without any.
+func (h *VulnerabilityHandler) imageWorkloads(ctx context.Context, image string) []string {
+	contexts, err := h.kubeConfigStore.GetContexts()
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"image": image}, err, "listing contexts for vulnerability alert")
+		return nil
+	}
 
-	// Helper function to check if image matches
-	imageMatches := func(image string) bool {
-		return image == targetImage
+	var workloads []string
+	for _, kubeContext := range contexts {
+		if kubeContext.Internal {
+			continue
+		}
+		clientset, err := kubeContext.ClientSetWithToken("")
+		if err != nil {
+			continue
+		}
+		found, err := h.discoverWorkloadsByImage(ctx, clientset, controller.NewInformerLister(kubeContext.Name), image)
+		if err != nil {
+			continue
+		}
+
+		var managed, pods []string
+		for _, workload := range found {
+			name := fmt.Sprintf("%s/%s/%s/%s", kubeContext.Name, workload.Namespace, workload.Kind, workload.Name)
+			switch workload.Kind {
+			case "Pod":
+				pods = append(pods, name)
+			case "ReplicaSet":
+			default:
+				managed = append(managed, name)
+			}
+		}
+		if len(managed) == 0 {
+			managed = pods
+		}
+		workloads = append(workloads, managed...)
+	}
+	return workloads
+}
+
+// controlledBy returns the Kind/name of the controller of an object, empty without one
+func controlledBy(meta *metav1.ObjectMeta) string {
+	if ref := metav1.GetControllerOf(meta); ref != nil {
+		return ref.Kind + "/" + ref.Name
+	}
+	return ""
+}
+
+// workloadPods returns the names of the pods a controller runs, directly or through the replica
+// sets and jobs it owns, from the owner reference index of the cluster. Nil when the index isn't
+// synced, as listing the pods of every workload would cost a LIST each.
+func workloadPods(lister *controller.InformerLister, uid types.UID, namespace string) []string {
+	refs, ok := lister.Descendants(uid, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, namespace)
+	if !ok || len(refs) == 0 {
+		return nil
+	}
+	pods := make([]string, len(refs))
+	for i, ref := range refs {
+		pods[i] = ref.Name
 	}
+	return pods
+}
+
+// discoverWorkloadsByImage discovers all workloads (Deployments, ReplicaSets, StatefulSets, DaemonSets, Jobs, CronJobs, Pods) using a specific image
+func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, clientset *kubernetes.Clientset, lister *controller.InformerLister, targetImage string) ([]WorkloadResource, error) {
+	return h.discoverWorkloads(ctx, clientset, lister, metav1.NamespaceAll, func(image string) bool {
+		return image == targetImage
+	})
+}
+
+// discoverWorkloads discovers the workloads of a namespace, every namespace when empty, with the
+// containers whose image matches. Workloads without a matching container are left out.
+func (h *VulnerabilityHandler) discoverWorkloads(ctx context.Context, clientset *kubernetes.Clientset, lister *controller.InformerLister, namespace string, imageMatches func(image string) bool) ([]WorkloadResource, error) {
+	var workloads []WorkloadResource
 
 	// 1. Discover Pods
-	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, pod := range pods.Items {
 			var containers []ContainerInfo
@@ -615,23 +1060,41 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 				}
 			}
 
+			for _, container := range pod.Spec.EphemeralContainers {
+				if imageMatches(container.Image) {
+					imageID := ""
+					for _, status := range pod.Status.EphemeralContainerStatuses {
+						if status.Name == container.Name {
+							imageID = status.ImageID
+							break
+						}
+					}
+					containers = append(containers, ContainerInfo{
+						Name:    container.Name,
+						Image:   container.Image,
+						ImageID: imageID,
+					})
+				}
+			}
+
 			if len(containers) > 0 {
 				workloads = append(workloads, WorkloadResource{
-					Name:        pod.Name,
-					Namespace:   pod.Namespace,
-					Kind:        "Pod",
-					Labels:      pod.Labels,
-					Annotations: pod.Annotations,
-					Containers:  containers,
-					CreatedAt:   pod.CreationTimestamp.Format(time.RFC3339),
-					Status:      string(pod.Status.Phase),
+					Name:         pod.Name,
+					Namespace:    pod.Namespace,
+					Kind:         "Pod",
+					Labels:       pod.Labels,
+					Annotations:  pod.Annotations,
+					Containers:   containers,
+					CreatedAt:    pod.CreationTimestamp.Format(time.RFC3339),
+					Status:       string(pod.Status.Phase),
+					ControlledBy: controlledBy(&pod.ObjectMeta),
 				})
 			}
 		}
 	}
 
 	// 2. Discover Deployments
-	deployments, err := clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, deployment := range deployments.Items {
 			var containers []ContainerInfo
@@ -665,13 +1128,14 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 					Containers:  containers,
 					CreatedAt:   deployment.CreationTimestamp.Format(time.RFC3339),
 					Status:      status,
+					Pods:        workloadPods(lister, deployment.UID, deployment.Namespace),
 				})
 			}
 		}
 	}
 
 	// 3. Discover ReplicaSets
-	replicaSets, err := clientset.AppsV1().ReplicaSets("").List(ctx, metav1.ListOptions{})
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, rs := range replicaSets.Items {
 			var containers []ContainerInfo
@@ -697,21 +1161,23 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 			if len(containers) > 0 {
 				status := fmt.Sprintf("%d/%d ready", rs.Status.ReadyReplicas, rs.Status.Replicas)
 				workloads = append(workloads, WorkloadResource{
-					Name:        rs.Name,
-					Namespace:   rs.Namespace,
-					Kind:        "ReplicaSet",
-					Labels:      rs.Labels,
-					Annotations: rs.Annotations,
-					Containers:  containers,
-					CreatedAt:   rs.CreationTimestamp.Format(time.RFC3339),
-					Status:      status,
+					Name:         rs.Name,
+					Namespace:    rs.Namespace,
+					Kind:         "ReplicaSet",
+					Labels:       rs.Labels,
+					Annotations:  rs.Annotations,
+					Containers:   containers,
+					CreatedAt:    rs.CreationTimestamp.Format(time.RFC3339),
+					Status:       status,
+					Pods:         workloadPods(lister, rs.UID, rs.Namespace),
+					ControlledBy: controlledBy(&rs.ObjectMeta),
 				})
 			}
 		}
 	}
 
 	// 4. Discover StatefulSets
-	statefulSets, err := clientset.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{})
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, sts := range statefulSets.Items {
 			var containers []ContainerInfo
@@ -745,13 +1211,14 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 					Containers:  containers,
 					CreatedAt:   sts.CreationTimestamp.Format(time.RFC3339),
 					Status:      status,
+					Pods:        workloadPods(lister, sts.UID, sts.Namespace),
 				})
 			}
 		}
 	}
 
 	// 5. Discover DaemonSets
-	daemonSets, err := clientset.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, ds := range daemonSets.Items {
 			var containers []ContainerInfo
@@ -785,13 +1252,14 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 					Containers:  containers,
 					CreatedAt:   ds.CreationTimestamp.Format(time.RFC3339),
 					Status:      status,
+					Pods:        workloadPods(lister, ds.UID, ds.Namespace),
 				})
 			}
 		}
 	}
 
 	// 6. Discover Jobs
-	jobs, err := clientset.BatchV1().Jobs("").List(ctx, metav1.ListOptions{})
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, job := range jobs.Items {
 			var containers []ContainerInfo
@@ -824,21 +1292,23 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 					status = fmt.Sprintf("%d failed", job.Status.Failed)
 				}
 				workloads = append(workloads, WorkloadResource{
-					Name:        job.Name,
-					Namespace:   job.Namespace,
-					Kind:        "Job",
-					Labels:      job.Labels,
-					Annotations: job.Annotations,
-					Containers:  containers,
-					CreatedAt:   job.CreationTimestamp.Format(time.RFC3339),
-					Status:      status,
+					Name:         job.Name,
+					Namespace:    job.Namespace,
+					Kind:         "Job",
+					Labels:       job.Labels,
+					Annotations:  job.Annotations,
+					Containers:   containers,
+					CreatedAt:    job.CreationTimestamp.Format(time.RFC3339),
+					Status:       status,
+					Pods:         workloadPods(lister, job.UID, job.Namespace),
+					ControlledBy: controlledBy(&job.ObjectMeta),
 				})
 			}
 		}
 	}
 
 	// 7. Discover CronJobs
-	cronJobs, err := clientset.BatchV1().CronJobs("").List(ctx, metav1.ListOptions{})
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
 	if err == nil {
 		for _, cronJob := range cronJobs.Items {
 			var containers []ContainerInfo
@@ -875,6 +1345,7 @@ func (h *VulnerabilityHandler) discoverWorkloadsByImage(ctx context.Context, cli
 					Containers:  containers,
 					CreatedAt:   cronJob.CreationTimestamp.Format(time.RFC3339),
 					Status:      status,
+					Pods:        workloadPods(lister, cronJob.UID, cronJob.Namespace),
 				})
 			}
 		}
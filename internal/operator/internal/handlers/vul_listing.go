@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/listing"
+)
+
+// Vulnerability list query parameters, next to those of the listing convention
+const (
+	paramSeverity     = "severity"
+	paramPackage      = "package"
+	paramFixAvailable = "fixAvailable"
+)
+
+// Sort fields of vulnerability lists ordered by rank rather than by their JSON value. They sort
+// most severe first unless order=asc is asked for.
+const (
+	sortByCVSS     = "cvss"
+	sortBySeverity = "severity"
+)
+
+// vulnerabilitySeverityRanks orders severities, unknown and negligible ones last
+var vulnerabilitySeverityRanks = map[string]int{"critical": 5, "high": 4, "medium": 3, "low": 2, "negligible": 1}
+
+// vulnerabilityQuery narrows vulnerabilities: severities keeps the listed ones, pkg the packages
+// whose name contains it and fixAvailable those with or without a fixed version
+type vulnerabilityQuery struct {
+	severities   map[string]bool
+	pkg          string
+	fixAvailable *bool
+	// sortBy is sortByCVSS or sortBySeverity, left to the listing convention otherwise
+	sortBy    string
+	ascending bool
+}
+
+// parseVulnerabilityQuery reads the vulnerability filters and the listing convention. Sorting by
+// cvss or severity is taken out of the listing query, which can't rank severities.
+func parseVulnerabilityQuery(values url.Values) (vulnerabilityQuery, listing.Query, error) {
+	query, err := listing.Parse(values)
+	if err != nil {
+		return vulnerabilityQuery{}, listing.Query{}, err
+	}
+
+	var vq vulnerabilityQuery
+	if severities := values.Get(paramSeverity); severities != "" {
+		vq.severities = map[string]bool{}
+		for _, severity := range strings.Split(severities, ",") {
+			severity = strings.ToLower(strings.TrimSpace(severity))
+			if _, ok := vulnerabilitySeverityRanks[severity]; !ok && severity != "unknown" {
+				return vulnerabilityQuery{}, listing.Query{}, fmt.Errorf("%w: unknown severity %q", listing.ErrInvalidQuery, severity)
+			}
+			vq.severities[severity] = true
+		}
+	}
+	vq.pkg = strings.ToLower(values.Get(paramPackage))
+	if fix := values.Get(paramFixAvailable); fix != "" {
+		value, err := strconv.ParseBool(fix)
+		if err != nil {
+			return vulnerabilityQuery{}, listing.Query{}, fmt.Errorf("%w: fixAvailable must be true or false", listing.ErrInvalidQuery)
+		}
+		vq.fixAvailable = &value
+	}
+
+	switch query.SortBy {
+	case sortByCVSS, sortBySeverity:
+		vq.sortBy = query.SortBy
+		vq.ascending = strings.EqualFold(values.Get(listing.ParamOrder), "asc")
+		query.SortBy = ""
+	}
+	return vq, query, nil
+}
+
+// filtering reports whether the query narrows the vulnerabilities
+func (q vulnerabilityQuery) filtering() bool {
+	return q.severities != nil || q.pkg != "" || q.fixAvailable != nil
+}
+
+// matches reports whether a vulnerability passes the filters of the query
+func (q vulnerabilityQuery) matches(vuln Vulnerability) bool {
+	if q.severities != nil && !q.severities[strings.ToLower(vuln.Severity)] {
+		return false
+	}
+	if q.pkg != "" && !strings.Contains(strings.ToLower(vuln.PackageName), q.pkg) {
+		return false
+	}
+	if q.fixAvailable != nil && hasFix(vuln) != *q.fixAvailable {
+		return false
+	}
+	return true
+}
+
+// apply filters the vulnerabilities and sorts them by the rank of the query
+func (q vulnerabilityQuery) apply(vulns []Vulnerability) []Vulnerability {
+	filtered := make([]Vulnerability, 0, len(vulns))
+	for _, vuln := range vulns {
+		if q.matches(vuln) {
+			filtered = append(filtered, vuln)
+		}
+	}
+
+	var rank func(Vulnerability) (float64, bool)
+	switch q.sortBy {
+	case sortByCVSS:
+		rank = func(vuln Vulnerability) (float64, bool) {
+			if vuln.CVSSScore == nil {
+				return 0, false
+			}
+			return *vuln.CVSSScore, true
+		}
+	case sortBySeverity:
+		rank = func(vuln Vulnerability) (float64, bool) {
+			value, ok := vulnerabilitySeverityRanks[strings.ToLower(vuln.Severity)]
+			return float64(value), ok
+		}
+	default:
+		return filtered
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, aok := rank(filtered[i])
+		b, bok := rank(filtered[j])
+		// Vulnerabilities without a rank go last in both orders
+		if !aok || !bok {
+			return aok && !bok
+		}
+		if q.ascending {
+			return a < b
+		}
+		return a > b
+	})
+	return filtered
+}
+
+// hasFix reports whether a fixed version of the vulnerable package is known
+func hasFix(vuln Vulnerability) bool {
+	switch strings.TrimSpace(vuln.FixVersion) {
+	case "", "N/A", "(won't fix)":
+		return false
+	}
+	return true
+}
+
+// maxCVSS returns the highest CVSS score of the vulnerabilities, nil when none has one
+func maxCVSS(vulns []Vulnerability) *float64 {
+	var highest *float64
+	for _, vuln := range vulns {
+		if vuln.CVSSScore != nil && (highest == nil || *vuln.CVSSScore > *highest) {
+			score := *vuln.CVSSScore
+			highest = &score
+		}
+	}
+	return highest
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/listing"
+)
+
+func TestParseVulnerabilityQuery(t *testing.T) {
+	t.Parallel()
+
+	fixed := true
+	tests := []struct {
+		name       string
+		query      string
+		want       vulnerabilityQuery
+		wantSortBy string
+		wantErr    bool
+	}{
+		{name: "empty"},
+		{
+			name:  "filters",
+			query: "severity=Critical, high,unknown&package=OpenSSL&fixAvailable=true",
+			want: vulnerabilityQuery{
+				severities:   map[string]bool{"critical": true, "high": true, "unknown": true},
+				pkg:          "openssl",
+				fixAvailable: &fixed,
+			},
+		},
+		{name: "cvss descending", query: "sortBy=cvss", want: vulnerabilityQuery{sortBy: sortByCVSS}},
+		{name: "severity ascending", query: "sortBy=severity&order=asc", want: vulnerabilityQuery{sortBy: sortBySeverity, ascending: true}},
+		{name: "listing sort field", query: "sortBy=packageName&order=asc", wantSortBy: "packageName"},
+		{name: "invalid severity", query: "severity=high,severe", wantErr: true},
+		{name: "invalid fixAvailable", query: "fixAvailable=maybe", wantErr: true},
+		{name: "invalid sort order", query: "sortBy=cvss&order=sideways", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			got, query, err := parseVulnerabilityQuery(values)
+			if tt.wantErr {
+				if !errors.Is(err, listing.ErrInvalidQuery) {
+					t.Errorf("parseVulnerabilityQuery(%q) error = %v, want %v", tt.query, err, listing.ErrInvalidQuery)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVulnerabilityQuery(%q) error = %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVulnerabilityQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+			if query.SortBy != tt.wantSortBy {
+				t.Errorf("listing sortBy = %q, want %q", query.SortBy, tt.wantSortBy)
+			}
+		})
+	}
+}
+
+func TestVulnerabilityQueryApply(t *testing.T) {
+	t.Parallel()
+
+	score := func(value float64) *float64 { return &value }
+	vulns := []Vulnerability{
+		{ID: "CVE-1", Severity: "Medium", PackageName: "zlib", CVSSScore: score(5.3)},
+		{ID: "CVE-2", Severity: "Unknown", PackageName: "openssl", FixVersion: "3.0.8"},
+		{ID: "CVE-3", Severity: "Critical", PackageName: "openssl", CVSSScore: score(9.8), FixVersion: "3.0.7"},
+		{ID: "CVE-4", Severity: "Low", PackageName: "busybox", CVSSScore: score(2.1), FixVersion: "(won't fix)"},
+	}
+
+	tests := []struct {
+		name  string
+		query vulnerabilityQuery
+		want  []string
+	}{
+		{name: "unsorted", want: []string{"CVE-1", "CVE-2", "CVE-3", "CVE-4"}},
+		{name: "cvss descending", query: vulnerabilityQuery{sortBy: sortByCVSS}, want: []string{"CVE-3", "CVE-1", "CVE-4", "CVE-2"}},
+		{name: "cvss ascending", query: vulnerabilityQuery{sortBy: sortByCVSS, ascending: true}, want: []string{"CVE-4", "CVE-1", "CVE-3", "CVE-2"}},
+		{name: "severity descending", query: vulnerabilityQuery{sortBy: sortBySeverity}, want: []string{"CVE-3", "CVE-1", "CVE-4", "CVE-2"}},
+		{name: "severity ascending", query: vulnerabilityQuery{sortBy: sortBySeverity, ascending: true}, want: []string{"CVE-4", "CVE-1", "CVE-3", "CVE-2"}},
+		{
+			name:  "filtered",
+			query: vulnerabilityQuery{pkg: "ssl", fixAvailable: func() *bool { fix := true; return &fix }(), sortBy: sortByCVSS},
+			want:  []string{"CVE-3", "CVE-2"},
+		},
+		{name: "severity filter", query: vulnerabilityQuery{severities: map[string]bool{"low": true, "unknown": true}}, want: []string{"CVE-2", "CVE-4"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []string{}
+			for _, vuln := range tt.query.apply(vulns) {
+				got = append(got, vuln.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
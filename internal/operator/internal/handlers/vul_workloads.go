@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/vul"
+	"github.com/gin-gonic/gin"
+)
+
+// Scan states of the images of a workload
+const (
+	imageScanCompleted  = "completed"
+	imageScanScanning   = "scanning"
+	imageScanFailed     = "failed"
+	imageScanNotScanned = "not-scanned"
+)
+
+// WorkloadVulnerabilities is a workload with the vulnerabilities of all its images
+type WorkloadVulnerabilities struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status,omitempty"`
+	Images    []WorkloadImage `json:"images"`
+	// Summary counts the distinct vulnerabilities of the scanned images, a package vulnerable in
+	// two images counts once
+	Summary Summary  `json:"summary"`
+	MaxCVSS *float64 `json:"maxCvss,omitempty"`
+	// Unscanned counts the images without complete results, the summary leaves them out
+	Unscanned int `json:"unscanned"`
+}
+
+// WorkloadImage is an image of a workload with the state of its scan
+type WorkloadImage struct {
+	Image      string   `json:"image"`
+	Containers []string `json:"containers"`
+	Status     string   `json:"status"`
+	Summary    *Summary `json:"summary,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// imageScan is the scan state and vulnerabilities of an image
+type imageScan struct {
+	status string
+	vulns  []Vulnerability
+	err    string
+}
+
+// GetWorkloadVulnerabilities returns the workloads of a cluster, narrowed by the namespace query
+// parameter, with the vulnerabilities of all their container images. Workloads run by a controller
+// are left to it. They are ranked most critical first unless sortBy is given; scan=true queues
+// the images without results.
+func (h *VulnerabilityHandler) GetWorkloadVulnerabilities(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+	namespace := c.Query("namespace")
+	scan := false
+	if value := c.Query("scan"); value != "" {
+		var err error
+		if scan, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scan must be true or false"})
+			return
+		}
+	}
+
+	if vul.ImgScanner == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vulnerability scanner not available"})
+		return
+	}
+
+	kubeContext, err := h.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "getting kubeconfig context")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cluster not found or inaccessible"})
+		return
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "creating kubernetes client")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create kubernetes client"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	workloads, err := h.discoverWorkloads(ctx, clientset, controller.NewInformerLister(clusterName), namespace, func(string) bool { return true })
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName, "namespace": namespace}, err, "discovering workloads")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to discover workloads"})
+		return
+	}
+
+	results := correlateWorkloads(workloads, lookupImageScan)
+	if scan {
+		var unscanned []string
+		seen := map[string]bool{}
+		for _, workload := range results {
+			for _, image := range workload.Images {
+				if image.Status == imageScanNotScanned && !seen[image.Image] {
+					seen[image.Image] = true
+					unscanned = append(unscanned, image.Image)
+				}
+			}
+		}
+		vul.ImgScanner.Enqueue(context.Background(), unscanned...)
+	}
+
+	writeList(c, "workloads", results, gin.H{"cluster": clusterName, "namespace": namespace})
+}
+
+// lookupImageScan returns the scan state and vulnerabilities of an image from the scanner
+func lookupImageScan(image string) imageScan {
+	if vul.ImgScanner.IsScanning(image) {
+		return imageScan{status: imageScanScanning}
+	}
+	scan, ok := vul.ImgScanner.GetScan(image)
+	switch {
+	case !ok:
+		return imageScan{status: imageScanNotScanned}
+	case scan.Error != "":
+		return imageScan{status: imageScanFailed, err: scan.Error}
+	}
+	return imageScan{status: imageScanCompleted, vulns: convertVulnerabilities(scan)}
+}
+
+// correlateWorkloads summarizes the vulnerabilities of the images of the workloads not run by a
+// controller, ranked by critical, high, medium and low counts, then by the highest CVSS score
+func correlateWorkloads(workloads []WorkloadResource, lookup func(image string) imageScan) []WorkloadVulnerabilities {
+	scans := map[string]imageScan{}
+	results := []WorkloadVulnerabilities{}
+	for _, workload := range workloads {
+		if workload.ControlledBy != "" {
+			continue
+		}
+
+		result := WorkloadVulnerabilities{
+			Name:      workload.Name,
+			Namespace: workload.Namespace,
+			Kind:      workload.Kind,
+			Status:    workload.Status,
+			Images:    []WorkloadImage{},
+		}
+		byImage := map[string]int{}
+		for _, container := range workload.Containers {
+			if i, ok := byImage[container.Image]; ok {
+				result.Images[i].Containers = append(result.Images[i].Containers, container.Name)
+				continue
+			}
+			byImage[container.Image] = len(result.Images)
+			result.Images = append(result.Images, WorkloadImage{Image: container.Image, Containers: []string{container.Name}})
+		}
+
+		var vulns []Vulnerability
+		seen := map[string]bool{}
+		for i := range result.Images {
+			image := &result.Images[i]
+			scan, ok := scans[image.Image]
+			if !ok {
+				scan = lookup(image.Image)
+				scans[image.Image] = scan
+			}
+			image.Status, image.Error = scan.status, scan.err
+			if scan.status != imageScanCompleted {
+				result.Unscanned++
+				continue
+			}
+			summary := summarize(scan.vulns)
+			image.Summary = &summary
+			for _, vuln := range scan.vulns {
+				key := vuln.ID + "|" + vuln.PackageName + "|" + vuln.Version
+				if !seen[key] {
+					seen[key] = true
+					vulns = append(vulns, vuln)
+				}
+			}
+		}
+		result.Summary = summarize(vulns)
+		result.MaxCVSS = maxCVSS(vulns)
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		for _, counts := range [][2]int{
+			{a.Summary.Critical, b.Summary.Critical},
+			{a.Summary.High, b.Summary.High},
+			{a.Summary.Medium, b.Summary.Medium},
+			{a.Summary.Low, b.Summary.Low},
+		} {
+			if counts[0] != counts[1] {
+				return counts[0] > counts[1]
+			}
+		}
+		if scoreA, scoreB := cvssRank(a.MaxCVSS), cvssRank(b.MaxCVSS); scoreA != scoreB {
+			return scoreA > scoreB
+		}
+		return a.Namespace+"/"+a.Kind+"/"+a.Name < b.Namespace+"/"+b.Kind+"/"+b.Name
+	})
+	return results
+}
+
+// cvssRank ranks workloads without a CVSS score below those with one
+func cvssRank(score *float64) float64 {
+	if score == nil {
+		return -1
+	}
+	return *score
+}
+
+// summarize counts vulnerabilities by severity
+func summarize(vulns []Vulnerability) Summary {
+	var summary Summary
+	for _, vuln := range vulns {
+		switch strings.ToLower(vuln.Severity) {
+		case "critical":
+			summary.Critical++
+		case "high":
+			summary.High++
+		case "medium":
+			summary.Medium++
+		case "low":
+			summary.Low++
+		default:
+			summary.Unknown++
+		}
+		summary.Total++
+	}
+	return summary
+}
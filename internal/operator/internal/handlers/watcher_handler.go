@@ -5,9 +5,19 @@ import (
 	"net/http"
 
 	"github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/controller"
 	"github.com/gin-gonic/gin"
 )
 
+// TouchCluster records a request for the cluster of the route, starting its watchers when they
+// are lazy or were reaped as idle
+func TouchCluster(c *gin.Context) {
+	if clusterName := c.Param("clusterName"); clusterName != "" {
+		controller.Touch(clusterName)
+	}
+	c.Next()
+}
+
 // GetWatcherConfigHandler returns the current watcher configuration
 func GetWatcherConfigHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -19,13 +29,16 @@ func GetWatcherConfigHandler() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, cfg)
+		writeEntity(c, http.StatusOK, cfg)
 	}
 }
 
 // PatchWatcherConfigHandler updates the watcher configuration with provided JSON patch
 func PatchWatcherConfigHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		conditionalWrites.Lock()
+		defer conditionalWrites.Unlock()
+
 		// Load current configuration
 		cfg, err := config.New()
 		if err != nil {
@@ -35,6 +48,10 @@ func PatchWatcherConfigHandler() gin.HandlerFunc {
 			return
 		}
 
+		if preconditionFailed(c, cfg) {
+			return
+		}
+
 		// Parse patch data as map to detect which fields are actually provided
 		var patchData map[string]interface{}
 		if err := c.ShouldBindJSON(&patchData); err != nil {
@@ -55,6 +72,7 @@ func PatchWatcherConfigHandler() gin.HandlerFunc {
 			return
 		}
 
+		c.Header("ETag", entityTag(cfg))
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Watcher configuration updated successfully",
 			"config":  cfg,
@@ -62,6 +80,42 @@ func PatchWatcherConfigHandler() gin.HandlerFunc {
 	}
 }
 
+// ReplaceWatcherConfigHandler replaces the whole watcher configuration, conditionally on If-Match
+func ReplaceWatcherConfigHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var replacement config.Config
+		if err := c.ShouldBindJSON(&replacement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid watcher configuration: %v", err),
+			})
+			return
+		}
+
+		conditionalWrites.Lock()
+		defer conditionalWrites.Unlock()
+
+		current, err := config.New()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to load watcher config: %v", err),
+			})
+			return
+		}
+		if preconditionFailed(c, current) {
+			return
+		}
+
+		if err := replacement.Write(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to save configuration: %v", err),
+			})
+			return
+		}
+
+		writeEntity(c, http.StatusOK, &replacement)
+	}
+}
+
 // applyConfigPatchFromMap applies configuration patches from a map to only update provided fields
 func applyConfigPatchFromMap(target *config.Config, patchData map[string]interface{}) {
 	// Handle resource patches
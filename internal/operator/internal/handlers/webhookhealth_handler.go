@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/webhookhealth"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHealthHandler struct {
+	manager *webhookhealth.Manager
+}
+
+func NewWebhookHealthHandler(kubeConfigStore kubeconfig.ContextStore) *WebhookHealthHandler {
+	manager := webhookhealth.NewManager(kubeConfigStore)
+	manager.Start()
+
+	return &WebhookHealthHandler{
+		manager: manager,
+	}
+}
+
+// GetSettings returns the admission webhook monitoring settings
+func (h *WebhookHealthHandler) GetSettings(c *gin.Context) {
+	settings, err := h.manager.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings replaces the admission webhook monitoring settings
+func (h *WebhookHealthHandler) UpdateSettings(c *gin.Context) {
+	var settings webhookhealth.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	if err := h.manager.UpdateSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListReports returns the last webhook report of every checked cluster
+func (h *WebhookHealthHandler) ListReports(c *gin.Context) {
+	reports := h.manager.Reports()
+
+	writeList(c, "reports", reports, nil)
+}
+
+// CheckCluster inventories the admission webhooks of a cluster and probes their backends
+func (h *WebhookHealthHandler) CheckCluster(c *gin.Context) {
+	clusterName := c.Param("clusterName")
+
+	report, err := h.manager.Check(c.Request.Context(), clusterName)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to check admission webhooks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,73 @@
+package multiplexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MessageExec opens an exec session in a pod. The data of the message is an ExecRequest, the
+// multiplexer builds the exec path and query from it and negotiates the base64.binary.k8s.io
+// subprotocol with the cluster. The session then behaves like any exec connection: the client
+// sends REQUEST messages with stream frames on the exec path of the pod, as reported by the STATUS
+// message, and receives the output as DATA messages.
+const MessageExec = "EXEC"
+
+// execSubprotocol is the remote command subprotocol of EXEC sessions: frames start with the
+// ASCII digit of their channel followed by base64 encoded data
+const execSubprotocol = "base64.binary.k8s.io"
+
+// ExecRequest is the data of an EXEC message
+type ExecRequest struct {
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container,omitempty"`
+	Command   []string `json:"command"`
+	// TTY allocates a terminal, its stderr is merged into stdout
+	TTY bool `json:"tty"`
+	// Record records the session even when session recording is disabled
+	Record bool `json:"record,omitempty"`
+}
+
+// parseExecRequest reads and validates the exec request of an EXEC message
+func parseExecRequest(msg Message) (*ExecRequest, error) {
+	var req ExecRequest
+	if err := json.Unmarshal([]byte(msg.Data), &req); err != nil {
+		return nil, fmt.Errorf("invalid exec request: %v", err)
+	}
+	if errs := validation.IsDNS1123Label(req.Namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid exec namespace %q: %s", req.Namespace, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1123Subdomain(req.Pod); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid exec pod %q: %s", req.Pod, strings.Join(errs, ", "))
+	}
+	if len(req.Command) == 0 || req.Command[0] == "" {
+		return nil, fmt.Errorf("invalid exec request: a command is required")
+	}
+	return &req, nil
+}
+
+// path returns the exec subresource path of the pod
+func (r *ExecRequest) path() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/exec", r.Namespace, r.Pod)
+}
+
+// query returns the exec options, stdin and stdout always attached
+func (r *ExecRequest) query() string {
+	values := url.Values{}
+	for _, arg := range r.Command {
+		values.Add("command", arg)
+	}
+	if r.Container != "" {
+		values.Set("container", r.Container)
+	}
+	values.Set("stdin", "true")
+	values.Set("stdout", "true")
+	values.Set("stderr", strconv.FormatBool(!r.TTY))
+	values.Set("tty", strconv.FormatBool(r.TTY))
+	return values.Encode()
+}
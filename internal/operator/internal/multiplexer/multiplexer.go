@@ -12,8 +12,12 @@ import (
 	"time"
 
 	"github.com/agentkube/operator/pkg/auth"
+	"github.com/agentkube/operator/pkg/budget"
 	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recording"
+	"github.com/agentkube/operator/pkg/redact"
+	"github.com/agentkube/operator/pkg/utils"
 	"github.com/gorilla/websocket"
 	"k8s.io/client-go/rest"
 )
@@ -76,6 +80,10 @@ type Connection struct {
 	closed bool
 	// Authentication token.
 	Token *string
+	// recorder records exec and attach sessions when session recording is enabled.
+	recorder *recording.Recorder
+	// exec is the request of sessions opened with an EXEC message, nil for other connections.
+	exec *ExecRequest
 }
 
 // Message represents a WebSocket message structure.
@@ -112,6 +120,10 @@ type Multiplexer struct {
 	connectionAttempts map[string]*ConnectionThrottle
 	// throttleMutex protects connectionAttempts map
 	throttleMutex sync.RWMutex
+	// authorizeExec refuses exec and attach sessions a request may not open on a cluster
+	authorizeExec func(r *http.Request, clusterID string) error
+	// operationQueue is the queue whose operation progress clients may subscribe to
+	operationQueue *utils.Queue
 }
 
 // ConnectionThrottle tracks connection attempts for rate limiting
@@ -185,7 +197,7 @@ func (conn *WSConnLock) Close() error {
 
 // NewMultiplexer creates a new Multiplexer instance.
 func NewMultiplexer(kubeConfigStore kubeconfig.ContextStore) *Multiplexer {
-	return &Multiplexer{
+	m := &Multiplexer{
 		connections:        make(map[string]*Connection),
 		kubeConfigStore:    kubeConfigStore,
 		connectionAttempts: make(map[string]*ConnectionThrottle),
@@ -195,6 +207,28 @@ func NewMultiplexer(kubeConfigStore kubeconfig.ContextStore) *Multiplexer {
 			},
 		},
 	}
+	budget.RegisterSource("multiplexer", m.footprint)
+	return m
+}
+
+// footprint reports the connections open to each cluster, each read and monitored by a goroutine
+func (m *Multiplexer) footprint() map[string]budget.Gauge {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	gauges := map[string]budget.Gauge{}
+	for _, conn := range m.connections {
+		gauge := gauges[conn.ClusterID]
+		gauge.Connections++
+		gauge.Goroutines += 2
+		gauges[conn.ClusterID] = gauge
+	}
+	return gauges
+}
+
+// SetExecAuthorizer sets the check run before an exec or attach session is opened on a cluster
+func (m *Multiplexer) SetExecAuthorizer(authorize func(r *http.Request, clusterID string) error) {
+	m.authorizeExec = authorize
 }
 
 // updateStatus updates the status of a connection and notifies the client.
@@ -266,6 +300,7 @@ func (m *Multiplexer) establishClusterConnection(
 	query string,
 	clientConn *WSConnLock,
 	token *string,
+	exec *ExecRequest,
 ) (*Connection, error) {
 	config, err := m.getClusterConfigWithFallback(clusterID, userID)
 	if err != nil {
@@ -273,7 +308,7 @@ func (m *Multiplexer) establishClusterConnection(
 		return nil, err
 	}
 
-	connection := m.createConnection(clusterID, userID, path, query, clientConn, token)
+	connection := m.createConnection(clusterID, userID, path, query, clientConn, token, exec)
 
 	wsURL := createWebSocketURL(config.Host, path, query)
 
@@ -284,7 +319,7 @@ func (m *Multiplexer) establishClusterConnection(
 		return nil, fmt.Errorf("failed to get TLS config: %v", err)
 	}
 
-	conn, err := m.dialWebSocket(wsURL, tlsConfig, config.Host, token)
+	conn, err := m.dialWebSocket(wsURL, tlsConfig, config.Host, token, exec != nil)
 	if err != nil {
 		connection.updateStatus(StateError, err)
 
@@ -292,6 +327,11 @@ func (m *Multiplexer) establishClusterConnection(
 	}
 
 	connection.WSConn = conn
+	if err := m.startRecording(connection); err != nil {
+		conn.Close()
+		connection.updateStatus(StateError, err)
+		return nil, err
+	}
 	connection.updateStatus(StateConnected, nil)
 
 	m.mutex.Lock()
@@ -312,6 +352,7 @@ func (m *Multiplexer) establishClusterConnectionUnsafe(
 	query string,
 	clientConn *WSConnLock,
 	token *string,
+	exec *ExecRequest,
 ) (*Connection, error) {
 	config, err := m.getClusterConfigWithFallback(clusterID, userID)
 	if err != nil {
@@ -319,7 +360,7 @@ func (m *Multiplexer) establishClusterConnectionUnsafe(
 		return nil, err
 	}
 
-	connection := m.createConnection(clusterID, userID, path, query, clientConn, token)
+	connection := m.createConnection(clusterID, userID, path, query, clientConn, token, exec)
 
 	wsURL := createWebSocketURL(config.Host, path, query)
 
@@ -329,13 +370,18 @@ func (m *Multiplexer) establishClusterConnectionUnsafe(
 		return nil, fmt.Errorf("failed to get TLS config: %v", err)
 	}
 
-	conn, err := m.dialWebSocket(wsURL, tlsConfig, config.Host, token)
+	conn, err := m.dialWebSocket(wsURL, tlsConfig, config.Host, token, exec != nil)
 	if err != nil {
 		connection.updateStatus(StateError, err)
 		return nil, err
 	}
 
 	connection.WSConn = conn
+	if err := m.startRecording(connection); err != nil {
+		conn.Close()
+		connection.updateStatus(StateError, err)
+		return nil, err
+	}
 	connection.updateStatus(StateConnected, nil)
 
 	go m.monitorConnection(connection)
@@ -369,6 +415,7 @@ func (m *Multiplexer) createConnection(
 	query string,
 	clientConn *WSConnLock,
 	token *string,
+	exec *ExecRequest,
 ) *Connection {
 	return &Connection{
 		ClusterID: clusterID,
@@ -382,6 +429,7 @@ func (m *Multiplexer) createConnection(
 			LastMsg: time.Now(),
 		},
 		Token: token,
+		exec:  exec,
 	}
 }
 
@@ -391,6 +439,7 @@ func (m *Multiplexer) dialWebSocket(
 	tlsConfig *tls.Config,
 	host string,
 	token *string,
+	exec bool,
 ) (*websocket.Conn, error) {
 	dialer := websocket.Dialer{
 		TLSClientConfig:  tlsConfig,
@@ -402,6 +451,9 @@ func (m *Multiplexer) dialWebSocket(
 			"base64.binary.k8s.io",
 			"base64url.bearer.authorization.k8s.io." + base64.RawStdEncoding.EncodeToString([]byte(*token)),
 		}
+	} else if exec {
+		// EXEC sessions exchange base64 frames whether or not they carry a token
+		dialer.Subprotocols = []string{execSubprotocol}
 	}
 
 	conn, resp, err := dialer.Dial(
@@ -504,6 +556,7 @@ func (m *Multiplexer) reconnect(conn *Connection) (*Connection, error) {
 		conn.Query,
 		conn.Client,
 		conn.Token,
+		conn.exec,
 	)
 	if err != nil {
 		logger.Log(logger.LevelError, map[string]string{"clusterID": conn.ClusterID}, err, "reconnecting to cluster")
@@ -537,6 +590,9 @@ func (m *Multiplexer) HandleClientWebSocket(w http.ResponseWriter, r *http.Reque
 
 	// Track processed messages to prevent duplicate processing
 	processedMessages := make(map[string]bool)
+	// Operation progress subscriptions of this client
+	operations := newOperationSubscriptions()
+	defer operations.stopAll()
 
 	for {
 		msg, err := m.readClientMessage(clientConn)
@@ -554,6 +610,22 @@ func (m *Multiplexer) HandleClientWebSocket(w http.ResponseWriter, r *http.Reque
 			continue
 		}
 
+		// Operation progress subscriptions don't open a cluster connection
+		if isOperationMessage(msg) {
+			m.handleOperationMessage(lockClientConn, operations, msg)
+			continue
+		}
+
+		// EXEC messages open an exec session from its options rather than a raw path and query
+		var exec *ExecRequest
+		if msg.Type == MessageExec {
+			if exec, err = parseExecRequest(msg); err != nil {
+				m.handleConnectionError(lockClientConn, msg, err)
+				continue
+			}
+			msg.Path, msg.Query, msg.Data = exec.path(), exec.query(), ""
+		}
+
 		// Create a unique key for this message to prevent duplicate processing
 		msgKey := fmt.Sprintf("%s:%s:%s:%s", msg.ClusterID, msg.Path, msg.UserID, msg.Type)
 		if processedMessages[msgKey] && msg.Type == "REQUEST" {
@@ -585,7 +657,16 @@ func (m *Multiplexer) HandleClientWebSocket(w http.ResponseWriter, r *http.Reque
 			}
 		}
 
-		conn, err := m.getOrCreateConnection(msg, lockClientConn, token)
+		// Exec and attach sessions are authorized on every message, so a revoked permission or an
+		// expired approval applies to the next session of a long-lived client
+		if isExecPath(msg.Path) && m.authorizeExec != nil {
+			if err := m.authorizeExec(r, msg.ClusterID); err != nil {
+				m.handleConnectionError(lockClientConn, msg, err)
+				continue
+			}
+		}
+
+		conn, err := m.getOrCreateConnection(msg, lockClientConn, token, exec)
 		if err != nil {
 			m.handleConnectionError(lockClientConn, msg, err)
 			continue
@@ -597,6 +678,7 @@ func (m *Multiplexer) HandleClientWebSocket(w http.ResponseWriter, r *http.Reque
 				logger.Log(logger.LevelError, map[string]string{"clusterID": msg.ClusterID}, err, "writing message to cluster")
 				continue
 			}
+			recordFrame(conn, []byte(msg.Data))
 		}
 	}
 
@@ -632,7 +714,7 @@ func (m *Multiplexer) readClientMessage(clientConn *websocket.Conn) (Message, er
 }
 
 // getOrCreateConnection gets an existing connection or creates a new one if it doesn't exist.
-func (m *Multiplexer) getOrCreateConnection(msg Message, clientConn *WSConnLock, token *string) (*Connection, error) {
+func (m *Multiplexer) getOrCreateConnection(msg Message, clientConn *WSConnLock, token *string, exec *ExecRequest) (*Connection, error) {
 	connKey := m.createConnectionKey(msg.ClusterID, msg.Path, msg.UserID)
 
 	m.mutex.Lock()
@@ -646,7 +728,13 @@ func (m *Multiplexer) getOrCreateConnection(msg Message, clientConn *WSConnLock,
 		isHealthy := !conn.closed && conn.WSConn != nil && conn.Status.State == StateConnected
 		conn.mu.RUnlock()
 
-		if isHealthy {
+		switch {
+		case exec != nil:
+			// An EXEC message starts a new session with its own command, replacing the open one
+			logger.Log(logger.LevelInfo, map[string]string{"connKey": connKey}, nil, "replacing exec session")
+			m.cleanupConnectionUnsafe(conn)
+			delete(m.connections, connKey)
+		case isHealthy:
 			// Update the client connection for this existing connection
 			conn.mu.Lock()
 			conn.Client = clientConn
@@ -654,7 +742,7 @@ func (m *Multiplexer) getOrCreateConnection(msg Message, clientConn *WSConnLock,
 
 			logger.Log(logger.LevelInfo, map[string]string{"connKey": connKey}, nil, "reusing existing healthy connection")
 			return conn, nil
-		} else {
+		default:
 			// Clean up the unhealthy connection
 			logger.Log(logger.LevelInfo, map[string]string{"connKey": connKey}, nil, "cleaning up unhealthy connection before creating new one")
 			m.cleanupConnectionUnsafe(conn)
@@ -684,7 +772,7 @@ func (m *Multiplexer) getOrCreateConnection(msg Message, clientConn *WSConnLock,
 
 	// Create new connection
 	logger.Log(logger.LevelInfo, map[string]string{"connKey": connKey}, nil, "creating new cluster connection")
-	conn, err := m.establishClusterConnectionUnsafe(msg.ClusterID, msg.UserID, msg.Path, msg.Query, clientConn, token)
+	conn, err := m.establishClusterConnectionUnsafe(msg.ClusterID, msg.UserID, msg.Path, msg.Query, clientConn, token, exec)
 	if err != nil {
 		logger.Log(
 			logger.LevelError,
@@ -842,6 +930,12 @@ func (m *Multiplexer) processClusterMessage(
 		return err
 	}
 
+	// Exec and attach streams carry terminal frames rather than resources
+	if isExecPath(conn.Path) {
+		recordFrame(conn, message)
+		return m.sendDataMessage(conn, clientConn, messageType, message)
+	}
+
 	if err := m.sendIfNewResourceVersion(message, conn, clientConn, lastResourceVersion); err != nil {
 		logger.Log(logger.LevelError,
 			map[string]string{
@@ -854,7 +948,7 @@ func (m *Multiplexer) processClusterMessage(
 		return err
 	}
 
-	return m.sendDataMessage(conn, clientConn, messageType, message)
+	return m.sendDataMessage(conn, clientConn, messageType, redact.JSON(message))
 }
 
 // sendIfNewResourceVersion checks the version of a resource from an incoming message
@@ -961,6 +1055,7 @@ func (m *Multiplexer) cleanupConnection(conn *Connection) {
 	defer conn.mu.Unlock() // Ensure the mutex is unlocked even if an error occurs
 
 	conn.closed = true
+	conn.stopRecording()
 
 	if conn.WSConn != nil {
 		conn.WSConn.Close()
@@ -968,7 +1063,10 @@ func (m *Multiplexer) cleanupConnection(conn *Connection) {
 
 	m.mutex.Lock()
 	connKey := m.createConnectionKey(conn.ClusterID, conn.Path, conn.UserID)
-	delete(m.connections, connKey)
+	// The key may already hold the connection that replaced this one
+	if m.connections[connKey] == conn {
+		delete(m.connections, connKey)
+	}
 	m.mutex.Unlock()
 }
 
@@ -978,6 +1076,7 @@ func (m *Multiplexer) cleanupConnectionUnsafe(conn *Connection) {
 	defer conn.mu.Unlock()
 
 	conn.closed = true
+	conn.stopRecording()
 
 	if conn.WSConn != nil {
 		conn.WSConn.Close()
@@ -0,0 +1,146 @@
+package multiplexer
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/gorilla/websocket"
+)
+
+// Message types of operation progress subscriptions. A client sends OPERATION_SUBSCRIBE or
+// OPERATION_UNSUBSCRIBE with the operation ID as data, and receives OPERATION messages with the
+// operation as data until it finishes, followed by a COMPLETE message.
+const (
+	MessageOperationSubscribe   = "OPERATION_SUBSCRIBE"
+	MessageOperationUnsubscribe = "OPERATION_UNSUBSCRIBE"
+	MessageOperation            = "OPERATION"
+)
+
+// operationSubscription is the subscription of a client to an operation
+type operationSubscription struct {
+	stop func()
+}
+
+// operationSubscriptions are the operation progress subscriptions of a client
+type operationSubscriptions struct {
+	mu            sync.Mutex
+	subscriptions map[string]*operationSubscription
+}
+
+func newOperationSubscriptions() *operationSubscriptions {
+	return &operationSubscriptions{subscriptions: make(map[string]*operationSubscription)}
+}
+
+// SetOperationQueue sets the queue whose operations clients may subscribe to
+func (m *Multiplexer) SetOperationQueue(queue *utils.Queue) {
+	m.operationQueue = queue
+}
+
+// isOperationMessage reports whether a client message manages operation subscriptions
+func isOperationMessage(msg Message) bool {
+	return msg.Type == MessageOperationSubscribe || msg.Type == MessageOperationUnsubscribe
+}
+
+// handleOperationMessage subscribes a client to the progress of an operation, or unsubscribes it
+func (m *Multiplexer) handleOperationMessage(clientConn *WSConnLock, subscriptions *operationSubscriptions, msg Message) {
+	operationID := msg.Data
+	if msg.Type == MessageOperationUnsubscribe {
+		subscriptions.stop(operationID)
+		return
+	}
+
+	if m.operationQueue == nil {
+		m.handleConnectionError(clientConn, msg, errors.New("operation progress is not available"))
+		return
+	}
+
+	subscriptions.mu.Lock()
+	if _, exists := subscriptions.subscriptions[operationID]; exists {
+		subscriptions.mu.Unlock()
+		return
+	}
+	updates, stop, ok := m.operationQueue.Watch(operationID)
+	if !ok {
+		subscriptions.mu.Unlock()
+		m.handleConnectionError(clientConn, msg, errors.New("operation not found: "+operationID))
+		return
+	}
+	subscription := &operationSubscription{stop: stop}
+	subscriptions.subscriptions[operationID] = subscription
+	subscriptions.mu.Unlock()
+
+	go m.forwardOperation(clientConn, subscriptions, subscription, operationID, updates)
+}
+
+// forwardOperation writes the states of an operation to the client until it finishes
+func (m *Multiplexer) forwardOperation(
+	clientConn *WSConnLock,
+	subscriptions *operationSubscriptions,
+	subscription *operationSubscription,
+	operationID string,
+	updates <-chan utils.Operation,
+) {
+	path := "/operations/" + operationID
+	finished := false
+	for op := range updates {
+		data, err := json.Marshal(op)
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"operationId": operationID}, err, "marshaling operation progress")
+			continue
+		}
+		finished = op.Status == utils.StatusCompleted || op.Status == utils.StatusFailed || op.Status == utils.StatusCancelled
+
+		if err := clientConn.WriteJSON(Message{ClusterID: op.Target, Path: path, Data: string(data), Type: MessageOperation}); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				logger.Log(logger.LevelError, map[string]string{"operationId": operationID}, err, "writing operation progress to client")
+			}
+			subscriptions.forget(operationID, subscription)
+			subscription.stop()
+			return
+		}
+	}
+
+	// The channel is also closed when the client unsubscribes, only a finished operation completes
+	subscriptions.forget(operationID, subscription)
+	if finished {
+		if err := clientConn.WriteJSON(Message{Path: path, Type: "COMPLETE"}); err != nil {
+			logger.Log(logger.LevelInfo, map[string]string{"operationId": operationID}, err, "connection closed while writing complete message")
+		}
+	}
+}
+
+// stop ends a subscription
+func (s *operationSubscriptions) stop(operationID string) {
+	s.mu.Lock()
+	subscription, exists := s.subscriptions[operationID]
+	delete(s.subscriptions, operationID)
+	s.mu.Unlock()
+
+	if exists {
+		subscription.stop()
+	}
+}
+
+// forget drops a subscription whose channel is closed, unless the client subscribed again since
+func (s *operationSubscriptions) forget(operationID string, subscription *operationSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscriptions[operationID] == subscription {
+		delete(s.subscriptions, operationID)
+	}
+}
+
+// stopAll ends every subscription of a client that went away
+func (s *operationSubscriptions) stopAll() {
+	s.mu.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = make(map[string]*operationSubscription)
+	s.mu.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.stop()
+	}
+}
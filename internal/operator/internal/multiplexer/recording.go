@@ -0,0 +1,123 @@
+package multiplexer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/recording"
+)
+
+// Remote command stream channels, see k8s.io/apimachinery/pkg/util/remotecommand
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+	streamResize = 4
+)
+
+var execPathPattern = regexp.MustCompile(`^/api/v1/namespaces/([^/]+)/pods/([^/]+)/(exec|attach)$`)
+
+// isExecPath reports whether a connection path is an interactive pod exec or attach session
+func isExecPath(path string) bool {
+	return execPathPattern.MatchString(path)
+}
+
+// startRecording starts recording an exec or attach connection when session recording is enabled,
+// or when its EXEC message asked for a recording. An error means the connection must not be used.
+func (m *Multiplexer) startRecording(conn *Connection) error {
+	match := execPathPattern.FindStringSubmatch(conn.Path)
+	if match == nil {
+		return nil
+	}
+
+	values, _ := url.ParseQuery(conn.Query)
+	recorder, err := recording.GetManager().StartSession(recording.Session{
+		Source:    recording.SourceMultiplexer,
+		Cluster:   conn.ClusterID,
+		Namespace: match[1],
+		Pod:       match[2],
+		Container: values.Get("container"),
+		Command:   strings.Join(values["command"], " "),
+		User:      conn.UserID,
+		Requested: conn.exec != nil && conn.exec.Record,
+	}, 0, 0)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{
+			"clusterID": conn.ClusterID,
+			"path":      conn.Path,
+		}, err, "starting session recording")
+		return err
+	}
+
+	conn.mu.Lock()
+	conn.recorder = recorder
+	conn.mu.Unlock()
+	return nil
+}
+
+// recordFrame records a remote command frame sent to or received from the cluster
+func recordFrame(conn *Connection, data []byte) {
+	conn.mu.RLock()
+	recorder := conn.recorder
+	conn.mu.RUnlock()
+	if recorder == nil {
+		return
+	}
+
+	channel, payload, ok := decodeStreamFrame(data)
+	if !ok {
+		return
+	}
+
+	switch channel {
+	case streamStdin:
+		recorder.Input(payload)
+	case streamStdout, streamStderr:
+		recorder.Output(payload)
+	case streamResize:
+		var size struct {
+			Width  int `json:"Width"`
+			Height int `json:"Height"`
+		}
+		if err := json.Unmarshal(payload, &size); err == nil {
+			recorder.Resize(size.Width, size.Height)
+		}
+	}
+}
+
+// decodeStreamFrame splits a frame into its channel and payload. Frames of the channel.k8s.io
+// protocol start with the raw channel number, frames of base64.channel.k8s.io and
+// base64.binary.k8s.io with its ASCII digit followed by base64 encoded data.
+func decodeStreamFrame(data []byte) (byte, []byte, bool) {
+	if len(data) == 0 {
+		return 0, nil, false
+	}
+
+	channel := data[0]
+	switch {
+	case channel <= streamResize:
+		return channel, data[1:], true
+	case channel >= '0' && channel <= '0'+streamResize:
+		payload, err := base64.StdEncoding.DecodeString(string(data[1:]))
+		if err != nil {
+			return 0, nil, false
+		}
+		return channel - '0', payload, true
+	}
+	return 0, nil, false
+}
+
+// stopRecording ends the recording of a connection, the caller must hold conn.mu
+func (conn *Connection) stopRecording() {
+	if conn.recorder == nil {
+		return
+	}
+	if err := conn.recorder.Close(); err != nil {
+		logger.Log(logger.LevelError, map[string]string{"recording": conn.recorder.ID()}, err, "closing session recording")
+	}
+	conn.recorder = nil
+}
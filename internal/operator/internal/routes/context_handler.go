@@ -9,7 +9,9 @@ import (
 
 	"github.com/agentkube/operator/pkg/config"
 	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/listing"
 	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
 	"github.com/gin-gonic/gin"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -69,6 +71,8 @@ func HandleGetContexts(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc
 				source = "dynamic_cluster"
 			case kubeconfig.InCluster:
 				source = "incluster"
+			case kubeconfig.Demo:
+				source = "demo"
 			}
 
 			// Get namespace (if set)
@@ -126,6 +130,7 @@ func HandleGetContexts(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc
 					"namespace":    namespace,
 					"origin":       origin,
 					"originalName": ctx.Name,
+					"readOnly":     readonly.IsReadOnly(ctx.Name),
 					"source":       source,
 				},
 			}
@@ -133,7 +138,20 @@ func HandleGetContexts(kubeConfigStore kubeconfig.ContextStore) gin.HandlerFunc
 			simplifiedContexts = append(simplifiedContexts, simplifiedCtx)
 		}
 
-		c.JSON(200, simplifiedContexts)
+		// The contexts stay a bare array, the page metadata is carried by the listing headers
+		query, err := listing.Parse(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		page, err := listing.Apply(simplifiedContexts, query)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		listing.SetHeaders(c.Writer.Header(), page)
+		c.JSON(200, page.Items)
 	}
 }
 
@@ -161,6 +179,8 @@ func HandleGetContextByName(kubeConfigStore kubeconfig.ContextStore) gin.Handler
 			source = "dynamic_cluster"
 		case kubeconfig.InCluster:
 			source = "incluster"
+		case kubeconfig.Demo:
+			source = "demo"
 		}
 
 		// Get namespace (if set)
@@ -220,6 +240,7 @@ func HandleGetContextByName(kubeConfigStore kubeconfig.ContextStore) gin.Handler
 				"namespace":    namespace,
 				"origin":       origin,
 				"originalName": ctx.Name,
+				"readOnly":     readonly.IsReadOnly(ctx.Name),
 				"source":       source,
 			},
 		}
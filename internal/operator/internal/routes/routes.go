@@ -1,12 +1,17 @@
 package routes
 
 import (
+	"path/filepath"
+	"time"
+
 	"github.com/agentkube/operator/internal/handlers"
 	"github.com/agentkube/operator/pkg/cache"
 	"github.com/agentkube/operator/pkg/config"
 	"github.com/agentkube/operator/pkg/extensions"
+	"github.com/agentkube/operator/pkg/features"
 	"github.com/agentkube/operator/pkg/kubeconfig"
 	"github.com/agentkube/operator/pkg/portforward"
+	"github.com/agentkube/operator/pkg/selfupdate"
 	"github.com/agentkube/operator/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -20,14 +25,70 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 
 	// Initialize WebSocket handler
 	handlers.InitializeWebSocketHandler(kubeConfigStore, cfg)
+	// Initialize Canvas graph cache invalidation
+	handlers.InitializeCanvasCache(kubeConfigStore)
 	// Initialize Helm handler
 	helmHandler := handlers.NewHelmHandler(kubeConfigStore, cacheSvc)
-	// Initialize Vulnerability handler
-	vulHandler := handlers.NewVulnerabilityHandler(kubeConfigStore)
 	// Initialize Lookup handler
 	lookupHandler := handlers.NewLookupHandler(kubeConfigStore)
+	// Initialize Disruption simulation handler
+	disruptionHandler := handlers.NewDisruptionHandler(kubeConfigStore)
+	// Initialize Network reachability handler
+	reachabilityHandler := handlers.NewReachabilityHandler(kubeConfigStore)
+	// Initialize Node inventory handler
+	nodeInventoryHandler := handlers.NewNodeInventoryHandler(kubeConfigStore)
+	// Initialize Fleet health overview handler
+	healthHandler := handlers.NewHealthHandler(kubeConfigStore)
+	// Initialize SBOM aggregation handler
+	sbomHandler := handlers.NewSBOMHandler(kubeConfigStore)
+	// Initialize Session recording handler
+	recordingHandler := handlers.NewRecordingHandler()
+	// Initialize Approval workflow handler
+	approvalHandler := handlers.NewApprovalHandler()
+	// Initialize Break-glass handler
+	breakGlassHandler := handlers.NewBreakGlassHandler(kubeConfigStore)
+	// Initialize CI receiver handler for ephemeral environments
+	ciReceiverHandler := handlers.NewCIReceiverHandler(kubeConfigStore)
+	// Initialize Resource table handler
+	tableHandler := handlers.NewTableHandler(kubeConfigStore)
+	// Initialize Resource history handler
+	historyHandler := handlers.NewHistoryHandler()
+	// Initialize Live event stream handler
+	eventStreamHandler := handlers.NewEventStreamHandler()
+	// Initialize Redaction handler
+	redactionHandler := handlers.NewRedactionHandler()
 	// Initialize Workspace handler
 	workspaceHandler := handlers.NewWorkspaceHandler()
+	// Initialize Artifact storage handler
+	storageHandler := handlers.NewStorageHandler()
+	// Initialize Data retention handler
+	retentionHandler := handlers.NewRetentionHandler()
+	// Initialize Grafana dashboard provisioning handler
+	grafanaHandler := handlers.NewGrafanaHandler(kubeConfigStore)
+	// Initialize Incident handler
+	incidentHandler := handlers.NewIncidentHandler()
+	// Initialize Restart loop analyzer handler
+	restartLoopHandler := handlers.NewRestartLoopHandler(kubeConfigStore)
+	// Initialize Postmortem bundle handler
+	postmortemHandler := handlers.NewPostmortemHandler(kubeConfigStore)
+	// Initialize Admission webhook health handler
+	webhookHealthHandler := handlers.NewWebhookHealthHandler(kubeConfigStore)
+	// Initialize Energy and carbon footprint handler
+	carbonHandler := handlers.NewCarbonHandler(kubeConfigStore)
+	// Initialize Cost estimation handler
+	costHandler := handlers.NewCostHandler(kubeConfigStore)
+	// Initialize Cloud cluster import handler
+	cloudImportHandler := handlers.NewCloudImportHandler(kubeConfigStore)
+	// Initialize OOM kill and memory trend handler
+	oomKillHandler := handlers.NewOOMKillHandler(kubeConfigStore)
+	// Initialize Priority class analysis handler
+	priorityHandler := handlers.NewPriorityHandler(kubeConfigStore)
+	// Initialize Topology spread report handler
+	spreadHandler := handlers.NewSpreadHandler(kubeConfigStore)
+	// Initialize Autoscaler insight handler
+	autoscalerHandler := handlers.NewAutoscalerHandler(kubeConfigStore)
+	// Initialize Service traffic handler
+	trafficHandler := handlers.NewTrafficHandler(kubeConfigStore)
 	// Initialize Popeye scanner (shared instance to prevent race conditions)
 	popeyeScanner := extensions.NewPopeyeScanner(kubeConfigStore)
 
@@ -35,11 +96,58 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 	queueConfig := utils.QueueConfig{
 		Workers:    3,
 		MaxRetries: 3,
+		// Operations survive restarts and stay listed for a day
+		StatePath: filepath.Join(utils.ConfigDir(), "operations.json"),
+		Retention: 24 * time.Hour,
 	}
 	operationQueue := utils.NewQueue(queueConfig)
+	// Push operation progress to WebSocket subscribers
+	handlers.EnableOperationProgress(operationQueue)
+	// Initialize Operation handler
+	operationHandler := handlers.NewOperationHandler(operationQueue)
 
+	// Initialize Vulnerability handler, scan jobs run on the operation queue
+	vulHandler := handlers.NewVulnerabilityHandler(kubeConfigStore, operationQueue)
 	// Initialize Metrics Server handler
 	metricsServerHandler := handlers.NewMetricsServerHandler(kubeConfigStore, operationQueue)
+	// Initialize kube-state-metrics scraping handler
+	stateMetricsHandler := handlers.NewStateMetricsHandler(kubeConfigStore, operationQueue)
+	// Initialize Promotion handler
+	promotionHandler := handlers.NewPromotionHandler(kubeConfigStore, operationQueue)
+	// Initialize Scheduled scaling handler
+	scaleScheduleHandler := handlers.NewScaleScheduleHandler(kubeConfigStore, operationQueue)
+	// Initialize Hibernation handler
+	hibernationHandler := handlers.NewHibernationHandler(kubeConfigStore, operationQueue)
+	// Initialize Image pull secret distribution handler
+	pullSecretsHandler := handlers.NewPullSecretsHandler(kubeConfigStore, operationQueue)
+	// Initialize Policy engine handler
+	policyHandler := handlers.NewPolicyHandler(kubeConfigStore, operationQueue)
+	// Initialize CIS benchmark handler
+	complianceHandler := handlers.NewComplianceHandler(kubeConfigStore, operationQueue)
+	// Initialize Addon installer handler
+	addonHandler := handlers.NewAddonHandler(kubeConfigStore, operationQueue)
+	// Initialize Operator version and self-update handler
+	selfUpdateHandler := handlers.NewSelfUpdateHandler(operationQueue, cfg.InCluster)
+	// Initialize Resource budget handler
+	budgetHandler := handlers.NewBudgetHandler()
+	// Initialize Manifest apply handler
+	applyHandler := handlers.NewApplyHandler(kubeConfigStore)
+	// Initialize Rollout management handler
+	rolloutHandler := handlers.NewRolloutHandler(kubeConfigStore)
+	// Initialize Workload scaling and autoscaler handler
+	scalingHandler := handlers.NewScalingHandler(kubeConfigStore)
+	// Initialize Ephemeral debug container handler
+	debugHandler := handlers.NewDebugHandler(kubeConfigStore)
+	// Initialize API request recorder handler
+	recorderHandler := handlers.NewRecorderHandler(kubeConfigStore)
+	// Initialize Resource usage handler
+	usageHandler := handlers.NewUsageHandler(kubeConfigStore)
+	// Initialize Prometheus query proxy handler
+	prometheusQueryHandler := handlers.NewPrometheusQueryHandler(kubeConfigStore)
+	// Initialize Usage history handler
+	usageHistoryHandler := handlers.NewUsageHistoryHandler(kubeConfigStore)
+	// Initialize Namespace lifecycle handler
+	namespaceHandler := handlers.NewNamespaceHandler(kubeConfigStore)
 
 	// Create default gin router with Logger and Recovery middleware
 	router := gin.Default()
@@ -66,35 +174,96 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 	// API routes
 	api := apiRoot.Group("/api")
 	{
-		// API v1 routes
-		v1 := api.Group("/v1")
+		// API v1 routes, requests for a cluster keep its watchers running
+		v1 := api.Group("/v1", handlers.TouchCluster)
 		{
 			v1.GET("/status", func(c *gin.Context) {
 				c.JSON(200, gin.H{
 					"status":     "running",
 					"port":       cfg.Port,
 					"in_cluster": cfg.InCluster,
-					"version":    "1.0.0",
+					"version":    selfupdate.Info().Version,
 				})
 			})
 
+			// Operator version, update checks and in-cluster self-upgrade
+			v1.GET("/operator/version", selfUpdateHandler.GetVersion)
+			v1.GET("/operator/update/settings", selfUpdateHandler.GetSettings)
+			v1.PUT("/operator/update/settings", selfUpdateHandler.UpdateSettings)
+			v1.GET("/operator/update", selfUpdateHandler.GetUpdateStatus)
+			v1.POST("/operator/update/check", selfUpdateHandler.CheckForUpdate)
+			v1.POST("/operator/upgrade", handlers.RequireFeature(features.SelfUpgrade), selfUpdateHandler.Upgrade)
+
+			// Feature flags gating experimental subsystems, per profile with runtime overrides
+			featuresGroup := v1.Group("/features")
+			{
+				featuresGroup.GET("", handlers.ListFeatures)
+				featuresGroup.GET("/profiles", handlers.ListFeatureProfiles)
+				featuresGroup.PUT("/profile", handlers.SetFeatureProfile)
+				featuresGroup.PUT("/profiles/:name", handlers.SaveFeatureProfile)
+				featuresGroup.DELETE("/profiles/:name", handlers.DeleteFeatureProfile)
+				featuresGroup.PUT("/flags/:name", handlers.SetFeatureOverride)
+				featuresGroup.DELETE("/flags/:name", handlers.ClearFeatureOverride)
+			}
+
 			kubeconfigGroup := v1.Group("/kubeconfig")
 			{
 				// Upload kubeconfig file (multipart form)
 				kubeconfigGroup.POST("/upload-file", handlers.UploadKubeconfigFileHandler(kubeConfigStore))
 				// Upload kubeconfig content (JSON/form)
 				kubeconfigGroup.POST("/upload-content", handlers.UploadKubeconfigContentHandler(kubeConfigStore))
+				// Register a cluster by API server URL, CA and bearer token
+				kubeconfigGroup.POST("/token-clusters", handlers.RegisterTokenClusterHandler(kubeConfigStore))
+				// Discover and import EKS, GKE and AKS clusters with the provider CLIs and token plugins
+				kubeconfigGroup.GET("/cloud/providers", cloudImportHandler.ListProviders)
+				kubeconfigGroup.POST("/cloud/discover", cloudImportHandler.Discover)
+				kubeconfigGroup.POST("/cloud/import", cloudImportHandler.Import)
 				// List uploaded contexts
 				kubeconfigGroup.GET("/uploaded-contexts", handlers.ListUploadedContextsHandler(kubeConfigStore))
 				// Delete context (system or imported)
 				kubeconfigGroup.DELETE("/contexts/:name", handlers.DeleteContextHandler(kubeConfigStore))
 				// Rename context (system or imported)
 				kubeconfigGroup.PATCH("/contexts/:name", handlers.RenameContextHandler(kubeConfigStore))
+				// Operator-managed metadata of a context, with an ETag for conditional updates
+				kubeconfigGroup.GET("/contexts/:name/metadata", handlers.GetContextMetadataHandler(kubeConfigStore))
+				// Mark context as read-only, rejecting mutating requests
+				kubeconfigGroup.PUT("/contexts/:name/read-only", handlers.SetContextReadOnlyHandler(kubeConfigStore))
+				// Credential refresh hooks for contexts from cloud CLIs
+				kubeconfigGroup.GET("/contexts/:name/refresh", handlers.GetContextRefreshHandler(kubeConfigStore))
+				kubeconfigGroup.PUT("/contexts/:name/refresh", handlers.SetContextRefreshHandler(kubeConfigStore))
+				kubeconfigGroup.DELETE("/contexts/:name/refresh", handlers.DeleteContextRefreshHandler(kubeConfigStore))
+				kubeconfigGroup.POST("/contexts/:name/refresh/run", handlers.RunContextRefreshHandler(kubeConfigStore))
 
 				// Validate and add kubeconfig path
 				kubeconfigGroup.POST("/validate-path", handlers.AddKubeconfigPathHandler(kubeConfigStore))
 				// Validate and scan folder for kubeconfigs
 				kubeconfigGroup.POST("/validate-folder", handlers.AddKubeconfigFolderHandler(kubeConfigStore))
+				// Onboard the clusters of a fleet manifest with per-cluster results
+				kubeconfigGroup.POST("/fleet", handlers.OnboardFleetHandler(kubeConfigStore))
+				// Labels set on contexts by fleet onboarding, narrowed by a label selector
+				kubeconfigGroup.GET("/labels", handlers.ListContextLabelsHandler(kubeConfigStore))
+			}
+
+			// Demo cluster served from seeded in-memory resources
+			demoGroup := v1.Group("/demo")
+			{
+				demoGroup.GET("", handlers.GetDemoClusterHandler())
+				demoGroup.POST("", handlers.StartDemoClusterHandler(kubeConfigStore))
+				demoGroup.POST("/reset", handlers.ResetDemoClusterHandler())
+				demoGroup.DELETE("", handlers.StopDemoClusterHandler(kubeConfigStore))
+			}
+
+			// Sanitized recordings of cluster API requests, replayable against a fake cluster
+			apiRecordingGroup := v1.Group("/api-recordings")
+			{
+				apiRecordingGroup.GET("", recorderHandler.ListRecordings)
+				apiRecordingGroup.POST("", recorderHandler.StartRecording)
+				apiRecordingGroup.POST("/import", recorderHandler.ImportRecording)
+				apiRecordingGroup.GET("/:id", recorderHandler.GetRecording)
+				apiRecordingGroup.POST("/:id/stop", recorderHandler.StopRecording)
+				apiRecordingGroup.DELETE("/:id", recorderHandler.DeleteRecording)
+				apiRecordingGroup.POST("/:id/replay", recorderHandler.ReplayRecording)
+				apiRecordingGroup.DELETE("/:id/replay", recorderHandler.StopReplay)
 			}
 
 			// Popeye endpoints
@@ -116,9 +285,60 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 			v1.GET("/socket/clusters/:clusterName/ws", handlers.WebSocketHandler)
 			v1.GET("/socket/clusters/:clusterName/watch", handlers.WebSocketHandler)
 
+			// Server-Sent Events stream of the watcher events of a cluster, a one-way alternative to the
+			// WebSocket multiplexer. It lives under /cluster, /clusters/:clusterName/* is the API proxy.
+			v1.GET("/cluster/:clusterName/events/stream", eventStreamHandler.StreamEvents)
+
 			// Search endpoint for cluster resources
 			v1.POST("/cluster/:clusterName/search", handlers.SearchResources)
 
+			// Apply manifests with server-side apply or create and merge patch, optionally as a dry-run.
+			// It lives under /cluster, /clusters/:clusterName/* is the API proxy.
+			v1.POST("/cluster/:clusterName/apply", applyHandler.ApplyManifest)
+
+			// kubectl rollout of Deployments, StatefulSets and DaemonSets, :kind is the resource name
+			rolloutGroup := v1.Group("/cluster/:clusterName/rollouts/:kind/:namespace/:name")
+			{
+				rolloutGroup.GET("/history", rolloutHandler.GetRolloutHistory)
+				rolloutGroup.POST("/restart", rolloutHandler.RestartRollout)
+				rolloutGroup.POST("/pause", rolloutHandler.PauseRollout)
+				rolloutGroup.POST("/resume", rolloutHandler.ResumeRollout)
+				rolloutGroup.POST("/undo", rolloutHandler.UndoRollout)
+			}
+
+			// Replicas and HorizontalPodAutoscalers of Deployments, StatefulSets and ReplicaSets
+			scalingGroup := v1.Group("/cluster/:clusterName/workloads/:kind/:namespace/:name")
+			{
+				scalingGroup.PATCH("/scale", scalingHandler.ScaleWorkload)
+				scalingGroup.GET("/autoscaler", scalingHandler.GetAutoscaler)
+				scalingGroup.PUT("/autoscaler", scalingHandler.SetAutoscaler)
+				scalingGroup.DELETE("/autoscaler", scalingHandler.DeleteAutoscaler)
+			}
+
+			// Launch an ephemeral debug container in a pod, connected to through the multiplexer
+			v1.POST("/cluster/:clusterName/pods/:namespace/:pod/debug", debugHandler.DebugPod)
+
+			// Quota usage across all namespaces, for capacity dashboards
+			v1.GET("/cluster/:clusterName/quotas", namespaceHandler.GetQuotaReport)
+
+			// Namespace lifecycle, with finalizer removal for namespaces stuck in Terminating,
+			// and the quotas and limit ranges of each namespace
+			namespaceGroup := v1.Group("/cluster/:clusterName/namespaces")
+			{
+				namespaceGroup.POST("", handlers.RequireWritableCluster, namespaceHandler.CreateNamespace)
+				namespaceGroup.DELETE("/:namespace", handlers.RequireWritableCluster, namespaceHandler.DeleteNamespace)
+				namespaceGroup.GET("/:namespace/termination", namespaceHandler.GetTermination)
+				namespaceGroup.POST("/:namespace/finalize", handlers.RequireWritableCluster, namespaceHandler.FinalizeNamespace)
+				namespaceGroup.GET("/:namespace/quotas", namespaceHandler.GetNamespaceQuotas)
+				namespaceGroup.PUT("/:namespace/quotas/:name", handlers.RequireWritableCluster, namespaceHandler.ApplyQuota)
+				namespaceGroup.DELETE("/:namespace/quotas/:name", handlers.RequireWritableCluster, namespaceHandler.DeleteQuota)
+				namespaceGroup.PUT("/:namespace/limitranges/:name", handlers.RequireWritableCluster, namespaceHandler.ApplyLimitRange)
+				namespaceGroup.DELETE("/:namespace/limitranges/:name", handlers.RequireWritableCluster, namespaceHandler.DeleteLimitRange)
+			}
+
+			// Resource search across all, or the selected, contexts
+			v1.GET("/search", handlers.SearchClustersHandler(kubeConfigStore))
+
 			// Index management endpoints
 			v1.POST("/cluster/:clusterName/index", handlers.IndexCluster)
 			v1.GET("/cluster/:clusterName/index/status", handlers.GetIndexStatus)
@@ -128,6 +348,7 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 			v1.GET("/indices/clusters", handlers.ListIndexedClusters)
 
 			v1.POST("/cluster/:clusterName/kubectl", handlers.KubectlHandler)
+			v1.POST("/kubectl/fanout", handlers.KubectlFanOutHandler)
 
 			// Terminal endpoint for shell access
 			v1.GET("/exec", handlers.TerminalHandler(kubeConfigStore))
@@ -142,11 +363,55 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 
 			// Canvas endpoint
 			v1.POST("/cluster/:clusterName/canvas", handlers.GetCanvasNodes)
+			v1.GET("/cluster/:clusterName/canvas/locality", handlers.GetDataLocality)
+			v1.GET("/cluster/:clusterName/canvas/namespace/:namespace", handlers.GetNamespaceCanvas)
+			// Live-vs-desired drift of a resource, against a manifest or its last-applied configuration
+			v1.POST("/cluster/:clusterName/canvas/drift", handlers.GetResourceDrift)
+			// RBAC analysis: who can make a request, and what a subject can do
+			v1.GET("/cluster/:clusterName/rbac/who-can", handlers.GetWhoCan)
+			v1.GET("/cluster/:clusterName/rbac/permissions", handlers.GetSubjectPermissions)
+			// Named canvas snapshots, diffed against the current topology
+			v1.GET("/cluster/:clusterName/canvas/snapshots", handlers.ListCanvasSnapshots)
+			v1.POST("/cluster/:clusterName/canvas/snapshots", handlers.SaveCanvasSnapshot)
+			v1.GET("/cluster/:clusterName/canvas/snapshots/:id", handlers.GetCanvasSnapshot)
+			v1.DELETE("/cluster/:clusterName/canvas/snapshots/:id", handlers.DeleteCanvasSnapshot)
+			v1.GET("/cluster/:clusterName/canvas/snapshots/:id/diff", handlers.DiffCanvasSnapshot)
+
+			// Image pull failure diagnosis with registry and pull secret checks
+			v1.POST("/cluster/:clusterName/diagnose/image-pull", handlers.DiagnoseImagePull)
+
+			// Live service dependency map from Istio and Hubble metrics
+			v1.GET("/cluster/:clusterName/traffic", trafficHandler.GetDependencyMap)
 
 			// Deep Dependency Graph endpoint - provides extreme deep dependency analysis
 			// Supports: pods, deployments, statefulsets, daemonsets, replicasets, replicationcontrollers, jobs, cronjobs
 			v1.POST("/cluster/:clusterName/dependency", handlers.GetDependencyGraph)
 
+			// Annotation and label keys redacted from resources, graphs and events
+			v1.GET("/redaction/settings", redactionHandler.GetSettings)
+			v1.PUT("/redaction/settings", redactionHandler.UpdateSettings)
+
+			// Revision history of tracked resources, recorded from watcher events
+			v1.GET("/history/settings", historyHandler.GetSettings)
+			v1.PUT("/history/settings", historyHandler.UpdateSettings)
+			historyGroup := v1.Group("/cluster/:clusterName/history")
+			{
+				historyGroup.GET("", historyHandler.ListResources)
+				historyGroup.GET("/revisions", historyHandler.ListRevisions)
+				historyGroup.GET("/diff", historyHandler.DiffRevisions)
+				historyGroup.DELETE("/revisions", historyHandler.DeleteHistory)
+			}
+
+			// Server-side rendered resource tables and their saved column layouts
+			v1.POST("/cluster/:clusterName/table", tableHandler.RenderTable)
+			tableViewGroup := v1.Group("/table-views")
+			{
+				tableViewGroup.GET("", tableHandler.ListViews)
+				tableViewGroup.GET("/:resource", tableHandler.GetView)
+				tableViewGroup.PUT("/:resource", tableHandler.SaveView)
+				tableViewGroup.DELETE("/:resource", tableHandler.DeleteView)
+			}
+
 			v1.GET("/proxy/helm-values", helmHandler.HelmValuesProxyHandler)
 			v1.GET("/proxy/helm-versions", helmHandler.HelmVersionsProxyHandler)
 			helmGroup := v1.Group("/cluster/:clusterName/helm")
@@ -164,10 +429,10 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 				helmGroup.GET("/releases", helmHandler.ListReleasesHandler)
 				helmGroup.GET("/release", helmHandler.GetReleaseHandler)
 				helmGroup.GET("/release/history", helmHandler.GetReleaseHistoryHandler)
-				helmGroup.POST("/release/install", helmHandler.InstallReleaseHandler)
-				helmGroup.POST("/release/upgrade", helmHandler.UpgradeReleaseHandler)
-				helmGroup.POST("/release/rollback", helmHandler.RollbackReleaseHandler)
-				helmGroup.DELETE("/release", helmHandler.UninstallReleaseHandler)
+				helmGroup.POST("/release/install", handlers.RequireWritableCluster, helmHandler.InstallReleaseHandler)
+				helmGroup.POST("/release/upgrade", handlers.RequireWritableCluster, helmHandler.UpgradeReleaseHandler)
+				helmGroup.POST("/release/rollback", handlers.RequireWritableCluster, helmHandler.RollbackReleaseHandler)
+				helmGroup.DELETE("/release", handlers.RequireWritableCluster, helmHandler.UninstallReleaseHandler)
 				helmGroup.GET("/release/status", helmHandler.GetActionStatusHandler)
 			}
 
@@ -178,28 +443,68 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 				// Get pod metrics
 				metricsGroup.GET("/pods/:namespace/:podName", handlers.GetPodMetricsHandler)
 
+				// Node and pod usage from metrics.k8s.io, with namespace rollups
+				usageGroup := metricsGroup.Group("/usage")
+				{
+					usageGroup.GET("/nodes", usageHandler.ListNodeUsage)
+					usageGroup.GET("/pods", usageHandler.ListPodUsage)
+					usageGroup.GET("/namespaces", usageHandler.ListNamespaceUsage)
+				}
+
+				// Sparklines of node and pod usage recorded from metrics.k8s.io
+				historyGroup := metricsGroup.Group("/history")
+				{
+					historyGroup.POST("/sample", usageHistoryHandler.Sample)
+					historyGroup.GET("/nodes", usageHistoryHandler.ListNodes)
+					historyGroup.GET("/nodes/:name", usageHistoryHandler.GetNode)
+					historyGroup.GET("/pods", usageHistoryHandler.ListPods)
+					historyGroup.GET("/pods/:namespace/:podName", usageHistoryHandler.GetPod)
+				}
+
 				// Metrics Server endpoints
 				metricsServerGroup := metricsGroup.Group("/server")
 				{
 					metricsServerGroup.GET("/status", metricsServerHandler.GetMetricsServerStatus)
-					metricsServerGroup.POST("/install", metricsServerHandler.InstallMetricsServer)
-					metricsServerGroup.POST("/uninstall", metricsServerHandler.UninstallMetricsServer)
+					metricsServerGroup.POST("/install", handlers.RequireWritableCluster, metricsServerHandler.InstallMetricsServer)
+					metricsServerGroup.POST("/uninstall", handlers.RequireWritableCluster, metricsServerHandler.UninstallMetricsServer)
+					metricsServerGroup.POST("/upgrade", handlers.RequireWritableCluster, metricsServerHandler.UpgradeMetricsServer)
+				}
+
+				// Object state series scraped from kube-state-metrics, for clusters without Prometheus
+				stateMetricsGroup := metricsGroup.Group("/kube-state")
+				{
+					stateMetricsGroup.GET("/status", stateMetricsHandler.GetStatus)
+					stateMetricsGroup.POST("/install", handlers.RequireWritableCluster, stateMetricsHandler.Install)
+					stateMetricsGroup.POST("/uninstall", handlers.RequireWritableCluster, stateMetricsHandler.Uninstall)
+					stateMetricsGroup.POST("/scrape", stateMetricsHandler.Scrape)
+					stateMetricsGroup.GET("/series", stateMetricsHandler.ListSeries)
+					stateMetricsGroup.GET("/workloads", stateMetricsHandler.ListWorkloads)
+					stateMetricsGroup.GET("/jobs", stateMetricsHandler.ListJobs)
 				}
 
 				// Prometheus endpoints
 				prometheusGroup := metricsGroup.Group("/prometheus")
 				{
 					prometheusGroup.GET("/status", handlers.GetPrometheusStatusHandler)
-					prometheusGroup.POST("/install", handlers.InstallPrometheusHandler)
-					prometheusGroup.POST("/uninstall", handlers.UninstallPrometheusHandler)
+					prometheusGroup.POST("/install", handlers.RequireWritableCluster, handlers.InstallPrometheusHandler)
+					prometheusGroup.POST("/uninstall", handlers.RequireWritableCluster, handlers.UninstallPrometheusHandler)
+
+					// PromQL proxy to the configured or discovered Prometheus, and canned queries
+					prometheusGroup.GET("/target", prometheusQueryHandler.GetTarget)
+					prometheusGroup.PUT("/target", prometheusQueryHandler.SetTarget)
+					prometheusGroup.DELETE("/target", prometheusQueryHandler.DeleteTarget)
+					prometheusGroup.GET("/query", prometheusQueryHandler.Query)
+					prometheusGroup.GET("/query_range", prometheusQueryHandler.QueryRange)
+					prometheusGroup.GET("/queries", prometheusQueryHandler.ListCannedQueries)
+					prometheusGroup.GET("/queries/:id", prometheusQueryHandler.RunCannedQuery)
 				}
 
 				// OpenCost endpoints
 				openCostGroup := metricsGroup.Group("/opencost")
 				{
 					openCostGroup.GET("/status", handlers.GetOpenCostStatusHandler)
-					openCostGroup.POST("/install", handlers.InstallOpenCostHandler)
-					openCostGroup.POST("/uninstall", handlers.UninstallOpenCostHandler)
+					openCostGroup.POST("/install", handlers.RequireWritableCluster, handlers.InstallOpenCostHandler)
+					openCostGroup.POST("/uninstall", handlers.RequireWritableCluster, handlers.UninstallOpenCostHandler)
 				}
 			}
 
@@ -207,8 +512,8 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 			trivyGroup := v1.Group("/cluster/:clusterName/trivy")
 			{
 				// Installation and status
-				trivyGroup.POST("/install", handlers.InstallTrivyOperator)
-				trivyGroup.POST("/uninstall", handlers.UninstallTrivyOperator)
+				trivyGroup.POST("/install", handlers.RequireWritableCluster, handlers.InstallTrivyOperator)
+				trivyGroup.POST("/uninstall", handlers.RequireWritableCluster, handlers.UninstallTrivyOperator)
 				trivyGroup.GET("/status", handlers.GetTrivyStatus)
 
 				// Reports
@@ -249,6 +554,12 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 				watcherGroup.GET("/config", handlers.GetWatcherConfigHandler())
 				// Patch watcher configuration
 				watcherGroup.PATCH("/config", handlers.PatchWatcherConfigHandler())
+				// Replace watcher configuration
+				watcherGroup.PUT("/config", handlers.ReplaceWatcherConfigHandler())
+				// Send a synthetic event through a dispatcher and report the delivery result
+				watcherGroup.POST("/test-notification", handlers.TestNotificationHandler())
+				// Changelog of the event payload versions dispatchers can pin
+				watcherGroup.GET("/schema", handlers.GetEventSchemaHandler())
 			}
 
 			// Vulnerability scanning routes
@@ -259,15 +570,290 @@ func SetupRouter(cfg config.Config, kubeConfigStore kubeconfig.ContextStore, cac
 				vulGroup.POST("/scan", vulHandler.ScanImages)
 				vulGroup.GET("/results", vulHandler.GetImageScanResults)
 				vulGroup.GET("/scans", vulHandler.ListAllScanResults)
+				// Scan jobs: per-image progress of a scan, delivered to a callback URL once finished
+				vulGroup.POST("/scans", vulHandler.CreateScanJob)
+				vulGroup.GET("/scans/:id", vulHandler.GetScanJob)
+				vulGroup.POST("/scans/:id/cancel", vulHandler.CancelScanJob)
+				// Posture across clusters: images ranked by exposure-weighted risk or blast radius, with trends
+				vulGroup.GET("/posture", vulHandler.GetPosture)
+				// Scheduled scans: the cron expression, the next run and the latest summary of every cluster
+				vulGroup.GET("/schedule", vulHandler.GetScanSchedule)
 			}
 
 			// Cluster-specific vulnerability scanning routes
 			v1.GET("/cluster/:clusterName/images", vulHandler.GetClusterImages)
 			v1.POST("/cluster/:clusterName/vulnerability/scan", vulHandler.TriggerClusterImageScan)
+			v1.GET("/cluster/:clusterName/vulnerability/scan-summaries", vulHandler.GetClusterScanSummaries)
 			v1.POST("/cluster/:clusterName/vulnerability/workloads", vulHandler.GetWorkloadsByImage)
+			// Workloads with the vulnerabilities of all their images, ranked to pick which to patch first
+			v1.GET("/cluster/:clusterName/vulnerability/workloads", vulHandler.GetWorkloadVulnerabilities)
+
+			// CIS benchmark routes: per-control results with remediation and an overall score
+			v1.GET("/compliance/reports", complianceHandler.ListComplianceSummaries)
+			v1.POST("/cluster/:clusterName/compliance/runs", complianceHandler.RunBenchmark)
+			v1.GET("/cluster/:clusterName/compliance/report", complianceHandler.GetComplianceReport)
+			v1.GET("/cluster/:clusterName/compliance/controls", complianceHandler.ListComplianceControls)
+
+			// Blue/green and canary promotion routes for plain Deployments
+			promotionGroup := v1.Group("/cluster/:clusterName/promotions")
+			{
+				promotionGroup.POST("", handlers.RequireWritableCluster, promotionHandler.StartPromotion)
+				promotionGroup.GET("/:namespace/:deployment", promotionHandler.GetPromotionStatus)
+				promotionGroup.POST("/:namespace/:deployment/finalize", handlers.RequireWritableCluster, promotionHandler.FinalizePromotion)
+				promotionGroup.POST("/:namespace/:deployment/rollback", handlers.RequireWritableCluster, promotionHandler.RollbackPromotion)
+			}
+
+			// Node drain and zone outage simulation against PodDisruptionBudgets
+			v1.POST("/cluster/:clusterName/disruption/simulate", disruptionHandler.SimulateDisruption)
+			// Workload reachability matrix from NetworkPolicies, exported as CSV or Markdown
+			v1.GET("/cluster/:clusterName/reachability", reachabilityHandler.GetMatrix)
+
+			// Priority classes, recent preemptions and preemption simulation
+			v1.GET("/cluster/:clusterName/priority-classes", priorityHandler.GetLandscape)
+			v1.POST("/cluster/:clusterName/priority-classes/simulate", priorityHandler.SimulatePreemption)
+
+			// Zone and node balance of multi-replica workloads
+			v1.GET("/cluster/:clusterName/topology-spread", spreadHandler.GetSpreadReport)
+
+			// Cluster Autoscaler and Karpenter state
+			autoscalerGroup := v1.Group("/cluster/:clusterName/autoscaler")
+			{
+				autoscalerGroup.GET("", autoscalerHandler.GetOverview)
+				autoscalerGroup.GET("/pending-pods", autoscalerHandler.ListPendingPods)
+				autoscalerGroup.GET("/scale-down-blockers", autoscalerHandler.ListScaleDownBlockers)
+				autoscalerGroup.GET("/karpenter", autoscalerHandler.GetKarpenter)
+			}
+
+			// Scheduled scaling profiles and holiday calendars
+			scaleScheduleGroup := v1.Group("/scaling-schedules")
+			{
+				scaleScheduleGroup.GET("", scaleScheduleHandler.ListProfiles)
+				scaleScheduleGroup.POST("", scaleScheduleHandler.SaveProfile)
+				scaleScheduleGroup.GET("/:name", scaleScheduleHandler.GetProfile)
+				scaleScheduleGroup.PUT("/:name", scaleScheduleHandler.SaveProfile)
+				scaleScheduleGroup.DELETE("/:name", scaleScheduleHandler.DeleteProfile)
+				scaleScheduleGroup.POST("/:name/override", scaleScheduleHandler.SetOverride)
+				scaleScheduleGroup.DELETE("/:name/override", scaleScheduleHandler.ClearOverride)
+			}
+			scalingCalendarGroup := v1.Group("/scaling-calendars")
+			{
+				scalingCalendarGroup.GET("", scaleScheduleHandler.ListCalendars)
+				scalingCalendarGroup.GET("/:name", scaleScheduleHandler.GetCalendar)
+				scalingCalendarGroup.PUT("/:name", scaleScheduleHandler.SaveCalendar)
+				scalingCalendarGroup.DELETE("/:name", scaleScheduleHandler.DeleteCalendar)
+			}
+
+			// Cluster hibernation for dev environments
+			v1.GET("/hibernations", hibernationHandler.ListHibernations)
+			hibernationGroup := v1.Group("/cluster/:clusterName/hibernation")
+			{
+				hibernationGroup.GET("", hibernationHandler.GetHibernationStatus)
+				hibernationGroup.POST("/hibernate", handlers.RequireWritableCluster, hibernationHandler.Hibernate)
+				hibernationGroup.POST("/wake", handlers.RequireWritableCluster, hibernationHandler.Wake)
+			}
+
+			// One-click addon installers (cert-manager, ingress-nginx) and their status in a cluster
+			v1.GET("/addons", addonHandler.ListCatalog)
+			addonGroup := v1.Group("/cluster/:clusterName/addons")
+			{
+				addonGroup.GET("", addonHandler.ListStatuses)
+				// Inventory of well-known components, with the installer offering the missing ones
+				addonGroup.GET("/inventory", addonHandler.GetInventory)
+				addonGroup.GET("/:addon", addonHandler.GetStatus)
+				addonGroup.POST("/:addon/install", handlers.RequireWritableCluster, addonHandler.Install)
+				addonGroup.POST("/:addon/uninstall", handlers.RequireWritableCluster, addonHandler.Uninstall)
+			}
+
+			// Registry credentials distributed as imagePullSecrets
+			registryCredentialGroup := v1.Group("/registry-credentials")
+			{
+				registryCredentialGroup.GET("", pullSecretsHandler.ListCredentials)
+				registryCredentialGroup.POST("", pullSecretsHandler.SaveCredential)
+				registryCredentialGroup.GET("/:name", pullSecretsHandler.GetCredential)
+				registryCredentialGroup.PUT("/:name", pullSecretsHandler.SaveCredential)
+				registryCredentialGroup.DELETE("/:name", pullSecretsHandler.DeleteCredential)
+				registryCredentialGroup.POST("/:name/sync", pullSecretsHandler.SyncCredential)
+				registryCredentialGroup.POST("/:name/rotate", pullSecretsHandler.RotateCredential)
+				registryCredentialGroup.GET("/:name/drift", pullSecretsHandler.GetCredentialDrift)
+			}
+
+			// Node OS, kernel, runtime and kubelet inventory with CVE mapping
+			v1.GET("/nodes/inventory", nodeInventoryHandler.GetFleetInventory)
+			v1.GET("/cluster/:clusterName/nodes/inventory", nodeInventoryHandler.GetClusterInventory)
+
+			// Health cards of every cluster for the fleet overview
+			v1.GET("/health/overview", healthHandler.GetHealthOverview)
+
+			// Workload SBOM aggregation and fleet-wide package search
+			v1.GET("/cluster/:clusterName/sbom", sbomHandler.GetInventory)
+			v1.POST("/sbom/search", sbomHandler.SearchPackages)
+
+			// Policy-as-code bundles (CEL and Rego) and their findings
+			policyBundleGroup := v1.Group("/policy-bundles")
+			{
+				policyBundleGroup.GET("", policyHandler.ListBundles)
+				policyBundleGroup.POST("", policyHandler.SaveBundle)
+				policyBundleGroup.GET("/:name", policyHandler.GetBundle)
+				policyBundleGroup.PUT("/:name", policyHandler.SaveBundle)
+				policyBundleGroup.DELETE("/:name", policyHandler.DeleteBundle)
+				policyBundleGroup.POST("/:name/evaluate", policyHandler.EvaluateBundle)
+			}
+			v1.GET("/policy-findings", policyHandler.ListFindings)
+			// Lint a manifest, or a live object, against the bundles before applying it
+			v1.POST("/policy-review", policyHandler.ReviewManifest)
+
+			// Terminal session recordings (asciicast v2) and their retention settings
+			recordingGroup := v1.Group("/recordings")
+			{
+				recordingGroup.GET("", recordingHandler.ListRecordings)
+				recordingGroup.GET("/settings", recordingHandler.GetSettings)
+				recordingGroup.PUT("/settings", recordingHandler.UpdateSettings)
+				recordingGroup.GET("/:id", recordingHandler.GetRecording)
+				recordingGroup.GET("/:id/playback", recordingHandler.PlaybackRecording)
+				recordingGroup.GET("/:id/download", recordingHandler.DownloadRecording)
+				recordingGroup.DELETE("/:id", recordingHandler.DeleteRecording)
+			}
+
+			// Storage backends and retention of large artifacts (scans, SBOMs, recordings, snapshots)
+			storageGroup := v1.Group("/storage")
+			{
+				storageGroup.GET("/settings", storageHandler.GetSettings)
+				storageGroup.PUT("/settings", storageHandler.UpdateSettings)
+				storageGroup.GET("/:artifact/objects", storageHandler.ListObjects)
+			}
+
+			// Retention policies and disk usage of persisted data (recordings, history, snapshots, artifacts)
+			retentionGroup := v1.Group("/retention")
+			{
+				retentionGroup.GET("/settings", retentionHandler.GetSettings)
+				retentionGroup.PUT("/settings", retentionHandler.UpdateSettings)
+				retentionGroup.GET("/usage", retentionHandler.GetUsage)
+				retentionGroup.POST("/prune", retentionHandler.Prune)
+			}
+
+			// Grafana dashboards (events, capacity, vulnerabilities) provisioned for every cluster
+			grafanaGroup := v1.Group("/integrations/grafana")
+			{
+				grafanaGroup.GET("/settings", grafanaHandler.GetSettings)
+				grafanaGroup.PUT("/settings", grafanaHandler.UpdateSettings)
+				grafanaGroup.GET("/status", grafanaHandler.GetStatus)
+				grafanaGroup.POST("/sync", grafanaHandler.Sync)
+			}
+
+			// Incidents grouping correlated watcher events
+			incidentGroup := v1.Group("/incidents")
+			{
+				incidentGroup.GET("", incidentHandler.ListIncidents)
+				incidentGroup.GET("/:id", incidentHandler.GetIncident)
+				incidentGroup.POST("/:id/acknowledge", incidentHandler.AcknowledgeIncident)
+				incidentGroup.POST("/:id/resolve", incidentHandler.ResolveIncident)
+				incidentGroup.PUT("/:id/assignee", incidentHandler.AssignIncident)
+			}
+
+			// Crash context captured from restart looping containers
+			restartLoopGroup := v1.Group("/restart-analyzer")
+			{
+				restartLoopGroup.GET("/settings", restartLoopHandler.GetSettings)
+				restartLoopGroup.PUT("/settings", restartLoopHandler.UpdateSettings)
+				restartLoopGroup.GET("/captures", restartLoopHandler.ListCaptures)
+				restartLoopGroup.GET("/captures/:id", restartLoopHandler.GetCapture)
+			}
+
+			// Postmortem bundles of resources over a time range
+			v1.POST("/cluster/:clusterName/postmortem", postmortemHandler.ExportBundle)
+
+			// Admission webhook inventory and availability monitoring
+			admissionWebhookGroup := v1.Group("/admission-webhooks")
+			{
+				admissionWebhookGroup.GET("/settings", webhookHealthHandler.GetSettings)
+				admissionWebhookGroup.PUT("/settings", webhookHealthHandler.UpdateSettings)
+				admissionWebhookGroup.GET("/reports", webhookHealthHandler.ListReports)
+			}
+
+			// kube-state-metrics scraping settings
+			stateMetricsSettingsGroup := v1.Group("/kube-state-metrics")
+			{
+				stateMetricsSettingsGroup.GET("/settings", stateMetricsHandler.GetSettings)
+				stateMetricsSettingsGroup.PUT("/settings", stateMetricsHandler.UpdateSettings)
+			}
+
+			// Energy and carbon footprint estimation
+			carbonGroup := v1.Group("/carbon")
+			{
+				carbonGroup.GET("/settings", carbonHandler.GetSettings)
+				carbonGroup.PUT("/settings", carbonHandler.UpdateSettings)
+				carbonGroup.GET("/profiles", carbonHandler.ListProfiles)
+			}
+			v1.GET("/cluster/:clusterName/carbon", carbonHandler.GetEstimate)
+			v1.GET("/cluster/:clusterName/carbon/trend", carbonHandler.GetTrend)
+			v1.GET("/cluster/:clusterName/admission-webhooks", webhookHealthHandler.CheckCluster)
+
+			// Monthly cost estimation from node prices, requests and usage, for showback reports
+			costGroup := v1.Group("/cost")
+			{
+				costGroup.GET("/settings", costHandler.GetSettings)
+				costGroup.PUT("/settings", costHandler.UpdateSettings)
+				costGroup.GET("/prices", costHandler.ListPrices)
+			}
+			v1.GET("/cluster/:clusterName/cost", costHandler.GetEstimate)
+			v1.GET("/cluster/:clusterName/cost/namespaces", costHandler.ListNamespaces)
+			v1.GET("/cluster/:clusterName/cost/workloads", costHandler.ListWorkloads)
+
+			// API traffic, memory and goroutines spent per cluster, and the budgets pausing background work
+			v1.GET("/budgets/settings", budgetHandler.GetSettings)
+			v1.PUT("/budgets/settings", budgetHandler.UpdateSettings)
+			v1.GET("/budgets/usage", budgetHandler.ListUsage)
+			v1.GET("/cluster/:clusterName/budget/usage", budgetHandler.GetClusterUsage)
+
+			// OOM kills and memory peaks compared to container limits
+			v1.GET("/oom-detector/settings", oomKillHandler.GetSettings)
+			v1.PUT("/oom-detector/settings", oomKillHandler.UpdateSettings)
+			v1.POST("/cluster/:clusterName/memory/sample", oomKillHandler.Sample)
+			v1.GET("/cluster/:clusterName/memory/report", oomKillHandler.ListReports)
+			v1.GET("/cluster/:clusterName/memory/recommendations", oomKillHandler.ListRecommendations)
+
+			// Recording of node and pod usage for sparklines, served under the metrics of each cluster
+			v1.GET("/usage-history/settings", usageHistoryHandler.GetSettings)
+			v1.PUT("/usage-history/settings", usageHistoryHandler.UpdateSettings)
+
+			// Approvals of dangerous operations and their audit trail
+			approvalGroup := v1.Group("/approvals")
+			{
+				approvalGroup.GET("", approvalHandler.ListApprovals)
+				approvalGroup.GET("/settings", approvalHandler.GetSettings)
+				approvalGroup.PUT("/settings", approvalHandler.UpdateSettings)
+				approvalGroup.GET("/:id", approvalHandler.GetApproval)
+				approvalGroup.POST("/:id/approve", approvalHandler.Approve)
+				approvalGroup.POST("/:id/reject", approvalHandler.Reject)
+				approvalGroup.POST("/:id/cancel", approvalHandler.Cancel)
+			}
+
+			// Short-lived elevated access lifting read-only and approval restrictions on a cluster
+			breakGlassGroup := v1.Group("/break-glass")
+			{
+				breakGlassGroup.GET("", breakGlassHandler.ListGrants)
+				breakGlassGroup.POST("", breakGlassHandler.IssueGrant)
+				breakGlassGroup.GET("/:id", breakGlassHandler.GetGrant)
+				breakGlassGroup.POST("/:id/confirm", breakGlassHandler.ConfirmGrant)
+				breakGlassGroup.POST("/:id/revoke", breakGlassHandler.RevokeGrant)
+			}
+
+			// Ephemeral environments pushed by CI with a receiver token, removed when their TTL expires
+			ciGroup := v1.Group("/ci")
+			{
+				ciGroup.GET("/environments", ciReceiverHandler.ListEnvironments)
+				ciGroup.POST("/environments", ciReceiverHandler.RegisterEnvironment)
+				ciGroup.DELETE("/environments/:name", ciReceiverHandler.RemoveEnvironment)
+				ciGroup.GET("/tokens", ciReceiverHandler.ListTokens)
+				ciGroup.POST("/tokens", ciReceiverHandler.IssueToken)
+				ciGroup.DELETE("/tokens/:id", ciReceiverHandler.RevokeToken)
+			}
 
-			// Operation status endpoints
-			v1.GET("/operations/:operationId", metricsServerHandler.GetOperationStatus)
+			// Operation endpoints, shared by every operation type
+			v1.GET("/operations", operationHandler.ListOperations)
+			v1.GET("/operations/:operationId", operationHandler.GetOperation)
+			v1.POST("/operations/:operationId/cancel", operationHandler.CancelOperation)
+			v1.POST("/operations/:operationId/retry", operationHandler.RetryOperation)
 
 			// Tool lookup endpoints
 			lookupGroup := v1.Group("/lookup")
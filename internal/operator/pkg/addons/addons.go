@@ -0,0 +1,271 @@
+package addons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Operation types of the installer
+	OperationInstall   = "addon-install"
+	OperationUninstall = "addon-uninstall"
+
+	// AddonAnnotation marks the objects the installer applied with the name of their addon,
+	// uninstalling only deletes the objects carrying it
+	AddonAnnotation = "agentkube.io/addon"
+
+	// fetchTimeout bounds the download of a release manifest
+	fetchTimeout = 30 * time.Second
+)
+
+var (
+	// ErrUnknownAddon is returned for addons missing from the catalog
+	ErrUnknownAddon = errors.New("unknown addon")
+	// ErrNotManaged is returned when uninstalling an addon another tool installed
+	ErrNotManaged = errors.New("addon was not installed by agentkube")
+	// ErrUnknownCluster is returned for contexts missing from the kubeconfig store
+	ErrUnknownCluster = errors.New("context not found")
+)
+
+// Addon is a component the installer deploys from the manifest of an upstream release
+type Addon struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	// Version is the release the installer deploys
+	Version     string `json:"version"`
+	Namespace   string `json:"namespace"`
+	ManifestURL string `json:"manifestUrl"`
+	// selector finds the controller Deployment of any installation, the installer's or a chart's
+	selector string
+	// deployments must become available for an installation to be verified
+	deployments []string
+}
+
+// catalog lists the addons by name, the manifests are pinned to a release
+var catalog = map[string]Addon{
+	"cert-manager": {
+		Name:        "cert-manager",
+		DisplayName: "cert-manager",
+		Description: "Issues and renews TLS certificates from ACME, Vault or self-signed issuers",
+		Version:     "v1.15.3",
+		Namespace:   "cert-manager",
+		ManifestURL: "https://github.com/cert-manager/cert-manager/releases/download/v1.15.3/cert-manager.yaml",
+		selector:    "app.kubernetes.io/name=cert-manager,app.kubernetes.io/component=controller",
+		deployments: []string{"cert-manager", "cert-manager-cainjector", "cert-manager-webhook"},
+	},
+	"ingress-nginx": {
+		Name:        "ingress-nginx",
+		DisplayName: "Ingress NGINX Controller",
+		Description: "Routes Ingress traffic through NGINX behind a LoadBalancer Service",
+		Version:     "v1.11.2",
+		Namespace:   "ingress-nginx",
+		ManifestURL: "https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-v1.11.2/deploy/static/provider/cloud/deploy.yaml",
+		selector:    "app.kubernetes.io/name=ingress-nginx,app.kubernetes.io/component=controller",
+		deployments: []string{"ingress-nginx-controller"},
+	},
+}
+
+// Lookup returns an addon of the catalog
+func Lookup(name string) (Addon, error) {
+	addon, ok := catalog[name]
+	if !ok {
+		return Addon{}, fmt.Errorf("%w: %s", ErrUnknownAddon, name)
+	}
+	return addon, nil
+}
+
+// Catalog returns the addons, by name
+func Catalog() []Addon {
+	addons := make([]Addon, 0, len(catalog))
+	for _, addon := range catalog {
+		addons = append(addons, addon)
+	}
+	sort.Slice(addons, func(i, j int) bool { return addons[i].Name < addons[j].Name })
+	return addons
+}
+
+// Status is the state of an addon in a cluster
+type Status struct {
+	Addon     string `json:"addon"`
+	Installed bool   `json:"installed"`
+	Namespace string `json:"namespace,omitempty"`
+	// Version is read from the image tag of the controller
+	Version       string `json:"version,omitempty"`
+	Ready         bool   `json:"ready"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyReplicas"`
+	// Managed tells whether the installer deployed it, only those can be uninstalled
+	Managed bool `json:"managed"`
+	// UpgradeAvailable is set for managed installations older than the catalog version
+	UpgradeAvailable bool `json:"upgradeAvailable"`
+}
+
+// Detect finds the controller of an addon in any namespace
+func Detect(ctx context.Context, clientset kubernetes.Interface, addon Addon) (Status, error) {
+	status := Status{Addon: addon.Name}
+	deployments, err := clientset.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: addon.selector})
+	if err != nil {
+		return status, fmt.Errorf("failed to list %s deployments: %w", addon.Name, err)
+	}
+	if len(deployments.Items) == 0 {
+		return status, nil
+	}
+
+	// Prefer the installer's deployment when several installations run
+	items := deployments.Items
+	sort.Slice(items, func(i, j int) bool {
+		mi, mj := items[i].Annotations[AddonAnnotation] == addon.Name, items[j].Annotations[AddonAnnotation] == addon.Name
+		if mi != mj {
+			return mi
+		}
+		return items[i].Namespace+"/"+items[i].Name < items[j].Namespace+"/"+items[j].Name
+	})
+	deployment := items[0]
+
+	status.Installed = true
+	status.Namespace = deployment.Namespace
+	status.Version = imageVersion(firstImage(deployment.Spec.Template.Spec))
+	status.Replicas = deployment.Status.Replicas
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	status.Ready = deployment.Status.AvailableReplicas > 0
+	status.Managed = deployment.Annotations[AddonAnnotation] == addon.Name
+	status.UpgradeAvailable = status.Managed && status.Version != "" && status.Version != addon.Version
+	return status, nil
+}
+
+// imageVersion reads the tag of an image, without its digest
+func imageVersion(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	// The tag follows the last colon after the last slash, a registry port is not a tag
+	name := image[strings.LastIndex(image, "/")+1:]
+	if idx := strings.LastIndex(name, ":"); idx >= 0 {
+		return name[idx+1:]
+	}
+	return ""
+}
+
+// Manager installs and detects addons through the operation queue
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	httpClient      *http.Client
+}
+
+// NewManager creates a new addon manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		httpClient:      &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+// Statuses detects every addon of the catalog in a cluster
+func (m *Manager) Statuses(ctx context.Context, clusterName string) ([]Status, error) {
+	clientset, err := m.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, addon := range Catalog() {
+		status, err := Detect(ctx, clientset, addon)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Inventory detects the well-known components of a cluster, installable or not
+func (m *Manager) Inventory(ctx context.Context, clusterName string) ([]Detection, error) {
+	clientset, err := m.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return Inventory(ctx, clientset)
+}
+
+// Status detects an addon in a cluster
+func (m *Manager) Status(ctx context.Context, clusterName, name string) (*Status, error) {
+	addon, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := m.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := Detect(ctx, clientset, addon)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Install queues the installation of an addon in a cluster
+func (m *Manager) Install(clusterName, name string) (*utils.Operation, error) {
+	addon, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	operation := m.queue.AddOperation(OperationInstall, clusterName, "system", map[string]interface{}{
+		"addon":   addon.Name,
+		"version": addon.Version,
+	}, []string{addon.Name, "addon", "installation"})
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"addon":       addon.Name,
+		"operationId": operation.ID,
+	}, nil, "Queued addon installation")
+
+	return operation, nil
+}
+
+// Uninstall queues the removal of an addon the installer deployed. Its CustomResourceDefinitions,
+// and so the resources of their kinds, are only deleted with removeCRDs.
+func (m *Manager) Uninstall(clusterName, name string, removeCRDs bool) (*utils.Operation, error) {
+	addon, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	operation := m.queue.AddOperation(OperationUninstall, clusterName, "system", map[string]interface{}{
+		"addon":      addon.Name,
+		"removeCRDs": removeCRDs,
+	}, []string{addon.Name, "addon", "uninstallation"})
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"addon":       addon.Name,
+		"operationId": operation.ID,
+	}, nil, "Queued addon uninstallation")
+
+	return operation, nil
+}
+
+func (m *Manager) clientset(clusterName string) (*kubernetes.Clientset, error) {
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, utils.NonRetryable(fmt.Errorf("%w: %v", ErrUnknownCluster, err))
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	return clientset, nil
+}
@@ -0,0 +1,153 @@
+package addons
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func deployment(namespace, image string, managed bool, available int32) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cert-manager",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":      "cert-manager",
+				"app.kubernetes.io/component": "controller",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "controller", Image: image}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: available, AvailableReplicas: available},
+	}
+	if managed {
+		d.Annotations = map[string]string{AddonAnnotation: "cert-manager"}
+	}
+	return d
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    Status
+	}{
+		{
+			name: "not installed",
+			want: Status{Addon: "cert-manager"},
+		},
+		{
+			name:    "installed by a chart",
+			objects: []runtime.Object{deployment("security", "quay.io/jetstack/cert-manager-controller:v1.14.0", false, 1)},
+			want:    Status{Addon: "cert-manager", Installed: true, Namespace: "security", Version: "v1.14.0", Ready: true, Replicas: 1, ReadyReplicas: 1},
+		},
+		{
+			name: "managed preferred over another installation",
+			objects: []runtime.Object{
+				deployment("a-team", "quay.io/jetstack/cert-manager-controller:v1.15.3", false, 1),
+				deployment("cert-manager", "quay.io/jetstack/cert-manager-controller:v1.14.0@sha256:abc", true, 0),
+			},
+			want: Status{Addon: "cert-manager", Installed: true, Namespace: "cert-manager", Version: "v1.14.0", Replicas: 1, Managed: true, UpgradeAvailable: true},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			addon, err := Lookup("cert-manager")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Detect(context.Background(), fake.NewSimpleClientset(tt.objects...), addon)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "registry.k8s.io/ingress-nginx/controller:v1.11.2@sha256:d5f8", want: "v1.11.2"},
+		{image: "localhost:5000/cert-manager-controller", want: ""},
+		{image: "localhost:5000/cert-manager-controller:v1.15.3", want: "v1.15.3"},
+	}
+
+	for _, tt := range tests {
+		if got := imageVersion(tt.image); got != tt.want {
+			t.Errorf("imageVersion(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestInventory(t *testing.T) {
+	t.Parallel()
+
+	prometheus := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prometheus-k8s",
+			Namespace: "monitoring",
+			Labels:    map[string]string{"app.kubernetes.io/name": "prometheus", "app.kubernetes.io/version": "2.54.1"},
+		},
+		Spec:   appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "quay.io/prometheus/prometheus"}}}}},
+		Status: appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1},
+	}
+	metricsServer := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "metrics-server",
+			Namespace: "kube-system",
+			Labels:    map[string]string{"k8s-app": "metrics-server", managedByLabel: "agentkube"},
+		},
+		Spec:   appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "registry.k8s.io/metrics-server/metrics-server:v0.7.2"}}}}},
+		Status: appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1},
+	}
+
+	detections, err := Inventory(context.Background(), fake.NewSimpleClientset(prometheus, metricsServer, deployment("cert-manager", "cert-manager-controller:v1.15.3", true, 0)))
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	byName := map[string]Detection{}
+	for _, detection := range detections {
+		byName[detection.Name] = detection
+	}
+
+	tests := []struct {
+		name    string
+		health  string
+		version string
+		managed bool
+	}{
+		{name: "metrics-server", health: HealthHealthy, version: "v0.7.2", managed: true},
+		{name: "prometheus", health: HealthDegraded, version: "2.54.1"},
+		{name: "cert-manager", health: HealthUnavailable, version: "v1.15.3", managed: true},
+	}
+	for _, tt := range tests {
+		got := byName[tt.name]
+		if !got.Installed || got.Health != tt.health || got.Version != tt.version || got.Managed != tt.managed {
+			t.Errorf("%s detection = %+v, want health %s, version %s, managed %v", tt.name, got, tt.health, tt.version, tt.managed)
+		}
+	}
+	if istio := byName["istio"]; istio.Installed || istio.Health != "" {
+		t.Errorf("istio detection = %+v, want not installed", istio)
+	}
+}
@@ -0,0 +1,352 @@
+package addons
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/apply"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	// fieldManager owns the fields the installer applies
+	fieldManager = "agentkube-addons"
+	// maxManifestBytes caps the size of a downloaded release manifest
+	maxManifestBytes = 4 << 20
+	// verifyTimeout bounds the wait for the deployments of an addon to become available
+	verifyTimeout = 3 * time.Minute
+)
+
+// Processor installs and removes addons for the operation queue
+type Processor struct {
+	manager *Manager
+}
+
+// NewProcessor creates a new addon processor
+func NewProcessor(manager *Manager) *Processor {
+	return &Processor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes addon operations
+func (p *Processor) ProcessOperation(op *utils.Operation) error {
+	switch op.Type {
+	case OperationInstall:
+		return p.processInstall(op)
+	case OperationUninstall:
+		return p.processUninstall(op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *Processor) CanProcess(operationType string) bool {
+	return operationType == OperationInstall || operationType == OperationUninstall
+}
+
+// processInstall applies the release manifest of an addon, unless another tool installed it
+func (p *Processor) processInstall(op *utils.Operation) error {
+	queue := p.manager.queue
+	addon, err := operationAddon(op)
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+	clientset, err := p.manager.clientset(op.Target)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 15, "Detecting existing installation", nil)
+	status, err := Detect(ctx, clientset, addon)
+	if err != nil {
+		return err
+	}
+	if status.Installed && !status.Managed {
+		queue.UpdateOperation(op.ID, utils.StatusCompleted, 100,
+			fmt.Sprintf("%s %s already runs in namespace %s", addon.DisplayName, status.Version, status.Namespace), nil)
+		return nil
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 25, "Fetching "+addon.Version+" manifest", nil)
+	objects, err := p.manager.manifest(ctx, addon)
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 40, fmt.Sprintf("Applying %d objects", len(objects)), nil)
+	applier, err := p.applier(op.Target)
+	if err != nil {
+		return err
+	}
+	result := applier.Apply(ctx, objects, apply.Request{
+		Namespace:    addon.Namespace,
+		ServerSide:   true,
+		FieldManager: fieldManager,
+		Force:        true,
+	})
+	if result.Failed > 0 {
+		return fmt.Errorf("failed at step 'Applying objects': %s", failures(result))
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 80, "Verifying installation", nil)
+	if err := verifyInstallation(clientset, addon); err != nil {
+		return fmt.Errorf("failed at step 'Verifying installation': %w", err)
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("%s %s installation completed successfully", addon.DisplayName, addon.Version), nil)
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     op.Target,
+		"addon":       addon.Name,
+		"operationId": op.ID,
+	}, nil, "Addon installation completed")
+	return nil
+}
+
+// processUninstall deletes the objects of the release manifest the installer applied, in reverse
+// order, leaving objects of other tools alone
+func (p *Processor) processUninstall(op *utils.Operation) error {
+	queue := p.manager.queue
+	addon, err := operationAddon(op)
+	if err != nil {
+		return err
+	}
+	removeCRDs, _ := op.Data["removeCRDs"].(bool)
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+	clientset, err := p.manager.clientset(op.Target)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 15, "Detecting existing installation", nil)
+	status, err := Detect(ctx, clientset, addon)
+	if err != nil {
+		return err
+	}
+	if status.Installed && !status.Managed {
+		return utils.NonRetryable(fmt.Errorf("%w: %s runs in namespace %s", ErrNotManaged, addon.Name, status.Namespace))
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 25, "Fetching "+addon.Version+" manifest", nil)
+	objects, err := p.manager.manifest(ctx, addon)
+	if err != nil {
+		return err
+	}
+	deleter, err := p.deleter(op.Target)
+	if err != nil {
+		return err
+	}
+
+	keptCRDs := 0
+	for i := len(objects) - 1; i >= 0; i-- {
+		object := objects[i]
+		if object.GetKind() == "CustomResourceDefinition" && !removeCRDs {
+			keptCRDs++
+			continue
+		}
+		progress := 30 + 60*(len(objects)-i)/len(objects)
+		queue.UpdateOperation(op.ID, utils.StatusRunning, progress, fmt.Sprintf("Deleting %s %s", object.GetKind(), object.GetName()), nil)
+		if err := deleter.delete(ctx, object, addon); err != nil {
+			// Log warning but continue with other objects
+			logger.Log(logger.LevelWarn, map[string]string{
+				"cluster": op.Target,
+				"addon":   addon.Name,
+				"kind":    object.GetKind(),
+				"name":    object.GetName(),
+			}, err, "Failed to delete addon object during uninstallation")
+		}
+	}
+
+	message := fmt.Sprintf("%s uninstallation completed", addon.DisplayName)
+	if keptCRDs > 0 {
+		message += fmt.Sprintf(", %d CustomResourceDefinitions were kept", keptCRDs)
+	}
+	queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, message, nil)
+	return nil
+}
+
+// operationAddon reads the addon of an operation
+func operationAddon(op *utils.Operation) (Addon, error) {
+	name, _ := op.Data["addon"].(string)
+	addon, err := Lookup(name)
+	if err != nil {
+		return Addon{}, utils.NonRetryable(err)
+	}
+	return addon, nil
+}
+
+// manifest downloads the release manifest of an addon and marks its objects as the addon's
+func (m *Manager) manifest(ctx context.Context, addon Addon) ([]*unstructured.Unstructured, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addon.ManifestURL, nil)
+	if err != nil {
+		return nil, utils.NonRetryable(err)
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the %s manifest: %w", addon.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the %s manifest: %s", addon.Name, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the %s manifest: %w", addon.Name, err)
+	}
+	if len(data) > maxManifestBytes {
+		return nil, utils.NonRetryable(fmt.Errorf("the %s manifest is larger than %d bytes", addon.Name, maxManifestBytes))
+	}
+
+	objects, err := apply.Decode(string(data))
+	if err != nil {
+		return nil, utils.NonRetryable(err)
+	}
+	annotate(objects, addon)
+	return objects, nil
+}
+
+// annotate marks the objects with their addon so that uninstalling leaves the others alone
+func annotate(objects []*unstructured.Unstructured, addon Addon) {
+	for _, object := range objects {
+		annotations := object.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AddonAnnotation] = addon.Name
+		object.SetAnnotations(annotations)
+	}
+}
+
+// failures describes the objects an apply could not apply
+func failures(result *apply.Result) string {
+	var failed []string
+	for _, object := range result.Objects {
+		if object.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s %s: %s", object.Kind, object.Name, object.Error))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+func (p *Processor) applier(clusterName string) (*apply.Applier, error) {
+	kubeContext, err := p.manager.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, utils.NonRetryable(fmt.Errorf("%w: %v", ErrUnknownCluster, err))
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %w", err)
+	}
+	return apply.NewApplier(restConfig)
+}
+
+// deleter deletes manifest objects the installer applied
+type deleter struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+func (p *Processor) deleter(clusterName string) (*deleter, error) {
+	kubeContext, err := p.manager.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, utils.NonRetryable(fmt.Errorf("%w: %v", ErrUnknownCluster, err))
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %w", err)
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	return &deleter{
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
+
+// delete deletes the live object of a manifest object when it carries the addon annotation
+func (d *deleter) delete(ctx context.Context, object *unstructured.Unstructured, addon Addon) error {
+	gvk := object.GroupVersionKind()
+	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var resource dynamic.ResourceInterface = d.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := object.GetNamespace()
+		if namespace == "" {
+			namespace = addon.Namespace
+		}
+		resource = d.client.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	live, err := resource.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if live.GetAnnotations()[AddonAnnotation] != addon.Name {
+		return nil
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(ctx, object.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// verifyInstallation waits for the deployments of an addon to become available
+func verifyInstallation(clientset kubernetes.Interface, addon Addon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	for _, name := range addon.deployments {
+		err := wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+			deployment, err := clientset.AppsV1().Deployments(addon.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return deployment.Status.AvailableReplicas > 0, nil
+		})
+		if err != nil {
+			return fmt.Errorf("deployment %s failed to become ready within timeout: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package addons
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Categories of the detected components
+const (
+	CategoryMetrics      = "metrics"
+	CategoryMonitoring   = "monitoring"
+	CategoryCertificates = "certificates"
+	CategoryIngress      = "ingress"
+	CategoryServiceMesh  = "service-mesh"
+	CategoryGitOps       = "gitops"
+)
+
+// Health of a detected component, from its ready replicas
+const (
+	HealthHealthy     = "healthy"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// Workload kinds a component is detected from
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+)
+
+// managedByLabel marks the resources of the metrics-server and kube-state-metrics installers
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// probe matches the main workload of a component, as deployed by its manifests or charts
+type probe struct {
+	kind     string
+	selector string
+}
+
+// Component is a well-known cluster component the inventory detects
+type Component struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Category    string `json:"category"`
+	// Installer is the operation type installing the component, empty when agentkube can't
+	Installer string `json:"installer,omitempty"`
+	// probes are tried in order, the first matching workloads are the component's
+	probes []probe
+}
+
+// components lists the detected components by category
+var components = []Component{
+	{
+		Name: "metrics-server", DisplayName: "Metrics Server", Category: CategoryMetrics, Installer: "metrics-install",
+		probes: []probe{{KindDeployment, "k8s-app=metrics-server"}, {KindDeployment, "app.kubernetes.io/name=metrics-server"}},
+	},
+	{
+		Name: "kube-state-metrics", DisplayName: "kube-state-metrics", Category: CategoryMetrics, Installer: "kube-state-metrics-install",
+		probes: []probe{{KindDeployment, "app.kubernetes.io/name=kube-state-metrics"}, {KindDeployment, "k8s-app=kube-state-metrics"}},
+	},
+	{
+		Name: "prometheus", DisplayName: "Prometheus", Category: CategoryMonitoring,
+		probes: []probe{
+			// Prometheus Operator, then the prometheus chart before and after its label rename
+			{KindStatefulSet, "app.kubernetes.io/name=prometheus"},
+			{KindDeployment, "app.kubernetes.io/name=prometheus,app.kubernetes.io/component=server"},
+			{KindDeployment, "app=prometheus,component=server"},
+		},
+	},
+	{
+		Name: "cert-manager", DisplayName: "cert-manager", Category: CategoryCertificates, Installer: OperationInstall,
+		probes: []probe{{KindDeployment, catalog["cert-manager"].selector}},
+	},
+	{
+		Name: "ingress-nginx", DisplayName: "Ingress NGINX Controller", Category: CategoryIngress, Installer: OperationInstall,
+		probes: []probe{{KindDeployment, catalog["ingress-nginx"].selector}, {KindDaemonSet, catalog["ingress-nginx"].selector}},
+	},
+	{
+		Name: "traefik", DisplayName: "Traefik", Category: CategoryIngress,
+		probes: []probe{{KindDeployment, "app.kubernetes.io/name=traefik"}, {KindDaemonSet, "app.kubernetes.io/name=traefik"}},
+	},
+	{
+		Name: "istio", DisplayName: "Istio", Category: CategoryServiceMesh,
+		probes: []probe{{KindDeployment, "app=istiod"}},
+	},
+	{
+		Name: "linkerd", DisplayName: "Linkerd", Category: CategoryServiceMesh,
+		probes: []probe{{KindDeployment, "linkerd.io/control-plane-component=destination"}},
+	},
+	{
+		Name: "argo-cd", DisplayName: "Argo CD", Category: CategoryGitOps,
+		probes: []probe{{KindDeployment, "app.kubernetes.io/name=argocd-server"}},
+	},
+	{
+		Name: "flux", DisplayName: "Flux", Category: CategoryGitOps,
+		probes: []probe{{KindDeployment, "app.kubernetes.io/part-of=flux,app.kubernetes.io/component=source-controller"}},
+	},
+}
+
+// Detection is the state of a component in a cluster
+type Detection struct {
+	Component
+	Installed bool   `json:"installed"`
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Workload  string `json:"workload,omitempty"`
+	// Version is read from the image tag of the workload, or its app.kubernetes.io/version label
+	Version       string `json:"version,omitempty"`
+	Health        string `json:"health,omitempty"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyReplicas"`
+	// Managed tells whether agentkube installed it
+	Managed bool `json:"managed"`
+	// Instances counts the installations found, e.g. several ingress controllers of one kind
+	Instances int `json:"instances"`
+}
+
+// workload is the part of a Deployment, StatefulSet or DaemonSet detection reads
+type workload struct {
+	kind        string
+	namespace   string
+	name        string
+	labels      labels.Set
+	annotations map[string]string
+	image       string
+	desired     int32
+	ready       int32
+}
+
+func (w workload) managed() bool {
+	return w.annotations[AddonAnnotation] != "" || w.labels[managedByLabel] == "agentkube"
+}
+
+// Inventory detects the well-known components of a cluster from its workloads
+func Inventory(ctx context.Context, clientset kubernetes.Interface) ([]Detection, error) {
+	workloads, err := listWorkloads(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	detections := make([]Detection, 0, len(components))
+	for _, component := range components {
+		detections = append(detections, detect(component, workloads))
+	}
+	return detections, nil
+}
+
+// detect matches the probes of a component against the workloads of a cluster
+func detect(component Component, workloads []workload) Detection {
+	detection := Detection{Component: component}
+	for _, p := range component.probes {
+		selector, err := labels.Parse(p.selector)
+		if err != nil {
+			continue
+		}
+		var matched []workload
+		for _, w := range workloads {
+			if w.kind == p.kind && selector.Matches(w.labels) {
+				matched = append(matched, w)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		// Report the installation agentkube manages when there are several
+		sort.Slice(matched, func(i, j int) bool {
+			if matched[i].managed() != matched[j].managed() {
+				return matched[i].managed()
+			}
+			return matched[i].namespace+"/"+matched[i].name < matched[j].namespace+"/"+matched[j].name
+		})
+		w := matched[0]
+		detection.Installed = true
+		detection.Instances = len(matched)
+		detection.Namespace = w.namespace
+		detection.Kind = w.kind
+		detection.Workload = w.name
+		detection.Version = imageVersion(w.image)
+		if detection.Version == "" {
+			detection.Version = w.labels["app.kubernetes.io/version"]
+		}
+		detection.Replicas = w.desired
+		detection.ReadyReplicas = w.ready
+		detection.Managed = w.managed()
+		switch {
+		case w.ready > 0 && w.ready >= w.desired:
+			detection.Health = HealthHealthy
+		case w.ready > 0:
+			detection.Health = HealthDegraded
+		default:
+			detection.Health = HealthUnavailable
+		}
+		return detection
+	}
+	return detection
+}
+
+// listWorkloads reads the Deployments, StatefulSets and DaemonSets of every namespace
+func listWorkloads(ctx context.Context, clientset kubernetes.Interface) ([]workload, error) {
+	var workloads []workload
+
+	deployments, err := clientset.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		workloads = append(workloads, workload{
+			kind: KindDeployment, namespace: d.Namespace, name: d.Name, labels: d.Labels, annotations: d.Annotations,
+			image:   firstImage(d.Spec.Template.Spec),
+			desired: d.Status.Replicas, ready: d.Status.ReadyReplicas,
+		})
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for i := range statefulSets.Items {
+		s := &statefulSets.Items[i]
+		workloads = append(workloads, workload{
+			kind: KindStatefulSet, namespace: s.Namespace, name: s.Name, labels: s.Labels, annotations: s.Annotations,
+			image:   firstImage(s.Spec.Template.Spec),
+			desired: s.Status.Replicas, ready: s.Status.ReadyReplicas,
+		})
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for i := range daemonSets.Items {
+		d := &daemonSets.Items[i]
+		workloads = append(workloads, workload{
+			kind: KindDaemonSet, namespace: d.Namespace, name: d.Name, labels: d.Labels, annotations: d.Annotations,
+			image:   firstImage(d.Spec.Template.Spec),
+			desired: d.Status.DesiredNumberScheduled, ready: d.Status.NumberReady,
+		})
+	}
+	return workloads, nil
+}
+
+// firstImage returns the image of the first container of a pod spec
+func firstImage(spec corev1.PodSpec) string {
+	if len(spec.Containers) == 0 {
+		return ""
+	}
+	return spec.Containers[0].Image
+}
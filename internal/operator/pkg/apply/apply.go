@@ -0,0 +1,276 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/objectdiff"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	// DefaultFieldManager owns the fields applied without a field manager
+	DefaultFieldManager = "agentkube"
+	// MaxObjects caps the objects of a manifest applied in one request
+	MaxObjects = 200
+)
+
+// Operations applied to an object
+const (
+	OperationCreated    = "created"
+	OperationConfigured = "configured"
+	OperationUnchanged  = "unchanged"
+	OperationFailed     = "failed"
+)
+
+// ErrInvalidManifest is returned for manifests without objects or with objects that can't be applied
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// Request applies YAML or JSON manifests to a cluster
+type Request struct {
+	// Manifest holds the objects, as several documents or a List
+	Manifest string `json:"manifest" binding:"required"`
+	// Namespace is assumed for the namespaced objects without one, default when empty
+	Namespace string `json:"namespace,omitempty"`
+	// ServerSide applies the objects with server-side apply. Otherwise missing objects are created
+	// and existing ones merge patched with the manifest, which never removes fields.
+	ServerSide bool `json:"serverSide"`
+	// FieldManager records who owns the applied fields, DefaultFieldManager when empty
+	FieldManager string `json:"fieldManager,omitempty"`
+	// Force takes the ownership of fields managed by others, server-side apply only
+	Force bool `json:"force,omitempty"`
+	// DryRun has the API server validate and return the result without persisting it
+	DryRun bool `json:"dryRun"`
+}
+
+// ObjectResult is the outcome of applying an object
+type ObjectResult struct {
+	// Index is the position of the object in the manifest, from 0
+	Index      int    `json:"index"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Operation  string `json:"operation"`
+	// Changes are the fields the apply changed in the live object, server managed metadata and
+	// the status left out
+	Changes []objectdiff.Change `json:"changes,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// Result lists the outcome of every object of a manifest, in manifest order
+type Result struct {
+	DryRun       bool           `json:"dryRun"`
+	ServerSide   bool           `json:"serverSide"`
+	FieldManager string         `json:"fieldManager"`
+	Objects      []ObjectResult `json:"objects"`
+	Failed       int            `json:"failed"`
+}
+
+// Applier applies manifest objects to a cluster
+type Applier struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+// NewApplier creates an applier of the cluster of the REST config
+func NewApplier(restConfig *rest.Config) (*Applier, error) {
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %v", err)
+	}
+	return &Applier{
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
+
+// Decode reads the objects of YAML or JSON documents, expanding Lists
+func Decode(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+	var objects []*unstructured.Unstructured
+	for document := 1; ; document++ {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: document %d: %v", ErrInvalidManifest, document, err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		items := []map[string]interface{}{object}
+		if list, ok := object["items"].([]interface{}); ok && strings.HasSuffix(fmt.Sprint(object["kind"]), "List") {
+			items = items[:0]
+			for _, item := range list {
+				if o, ok := item.(map[string]interface{}); ok {
+					items = append(items, o)
+				}
+			}
+		}
+		for _, item := range items {
+			u := &unstructured.Unstructured{Object: item}
+			if u.GetAPIVersion() == "" || u.GetKind() == "" {
+				return nil, fmt.Errorf("%w: document %d has no apiVersion or kind", ErrInvalidManifest, document)
+			}
+			if u.GetName() == "" {
+				return nil, fmt.Errorf("%w: document %d: %s has no name, generateName can't be applied", ErrInvalidManifest, document, u.GetKind())
+			}
+			objects = append(objects, u)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("%w: the manifest holds no objects", ErrInvalidManifest)
+	}
+	if len(objects) > MaxObjects {
+		return nil, fmt.Errorf("%w: %d objects, at most %d can be applied at once", ErrInvalidManifest, len(objects), MaxObjects)
+	}
+	return objects, nil
+}
+
+// Apply applies the objects in order. An object that fails is reported in the result and doesn't
+// stop the objects after it, e.g. in a dry-run the objects of a namespace the manifest creates fail
+// as the namespace isn't persisted.
+func (a *Applier) Apply(ctx context.Context, objects []*unstructured.Unstructured, req Request) *Result {
+	fieldManager := req.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	result := &Result{DryRun: req.DryRun, ServerSide: req.ServerSide, FieldManager: fieldManager, Objects: []ObjectResult{}}
+	for idx, object := range objects {
+		objectResult := a.applyObject(ctx, object.DeepCopy(), namespace, fieldManager, req)
+		objectResult.Index = idx
+		if objectResult.Error != "" {
+			result.Failed++
+		}
+		result.Objects = append(result.Objects, objectResult)
+	}
+	return result
+}
+
+func (a *Applier) applyObject(ctx context.Context, object *unstructured.Unstructured, namespace, fieldManager string, req Request) ObjectResult {
+	result := ObjectResult{
+		APIVersion: object.GetAPIVersion(),
+		Kind:       object.GetKind(),
+		Name:       object.GetName(),
+		Operation:  OperationFailed,
+	}
+	fail := func(err error) ObjectResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	gvk := object.GroupVersionKind()
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fail(fmt.Errorf("resource type not served: %v", err))
+	}
+	var resource dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if object.GetNamespace() == "" {
+			object.SetNamespace(namespace)
+		}
+		resource = a.client.Resource(mapping.Resource).Namespace(object.GetNamespace())
+	} else {
+		object.SetNamespace("")
+		resource = a.client.Resource(mapping.Resource)
+	}
+	result.Namespace = object.GetNamespace()
+
+	live, err := resource.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live = nil
+	} else if err != nil {
+		return fail(fmt.Errorf("failed to get the live object: %v", err))
+	}
+
+	var dryRun []string
+	if req.DryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+	var applied *unstructured.Unstructured
+	switch {
+	case req.ServerSide:
+		applied, err = resource.Apply(ctx, object.GetName(), object, metav1.ApplyOptions{DryRun: dryRun, Force: req.Force, FieldManager: fieldManager})
+	case live == nil:
+		applied, err = resource.Create(ctx, object, metav1.CreateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	default:
+		var patch []byte
+		if patch, err = json.Marshal(object.Object); err == nil {
+			applied, err = resource.Patch(ctx, object.GetName(), types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRun, FieldManager: fieldManager})
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	var before map[string]interface{}
+	if live != nil {
+		before = comparable(live)
+	}
+	result.Changes = objectdiff.Diff(before, comparable(applied))
+	switch {
+	case live == nil:
+		result.Operation = OperationCreated
+	case len(result.Changes) == 0:
+		result.Operation = OperationUnchanged
+	default:
+		result.Operation = OperationConfigured
+	}
+	return result
+}
+
+// serverManagedFields are the metadata fields the API server sets, changed by every write
+var serverManagedFields = []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp"}
+
+// comparable returns the content of an object a diff should show: without its status, the
+// server managed metadata and the annotation kubectl apply keeps the last manifest in
+func comparable(object *unstructured.Unstructured) map[string]interface{} {
+	content := object.DeepCopy().Object
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range serverManagedFields {
+			delete(metadata, field)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	return content
+}
+
+// Objects returns the content of the objects, e.g. to describe them for an approval
+func Objects(objects []*unstructured.Unstructured) []map[string]interface{} {
+	contents := make([]map[string]interface{}, len(objects))
+	for i, object := range objects {
+		contents[i] = object.Object
+	}
+	return contents
+}
@@ -0,0 +1,102 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const manifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: fast
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: unchanged, namespace: shop}
+  data: {mode: slow}
+- apiVersion: v1
+  kind: Namespace
+  metadata: {name: payments, namespace: shop}
+- apiVersion: example.com/v1
+  kind: Widget
+  metadata: {name: w}
+`
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	objects, err := Decode(manifest)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(objects) != 4 {
+		t.Fatalf("Decode() = %d objects, want the ConfigMap and the 3 List items", len(objects))
+	}
+
+	for _, invalid := range []string{"---\n", "metadata: {name: web}", "apiVersion: v1\nkind: Pod\nmetadata: {generateName: web-}", "kind: [unterminated"} {
+		if _, err := Decode(invalid); !errors.Is(err, ErrInvalidManifest) {
+			t.Errorf("Decode(%q) error = %v, want ErrInvalidManifest", invalid, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	configMap := func(namespace, name, mode string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"namespace": namespace, "name": name, "resourceVersion": "7"},
+			"data":       map[string]interface{}{"mode": mode},
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), configMap("shop", "settings", "slow"), configMap("shop", "unchanged", "slow"))
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	applier := &Applier{client: client, mapper: mapper}
+
+	objects, err := Decode(manifest)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	result := applier.Apply(context.Background(), objects, Request{Namespace: "shop"})
+
+	if result.FieldManager != DefaultFieldManager || result.Failed != 1 {
+		t.Errorf("result = %+v, want the default field manager and the Widget failed", result)
+	}
+	want := []struct {
+		namespace, operation string
+		changes              int
+	}{
+		{"shop", OperationConfigured, 1},
+		{"shop", OperationUnchanged, 0},
+		{"", OperationCreated, 3},
+		{"", OperationFailed, 0},
+	}
+	for i, w := range want {
+		got := result.Objects[i]
+		if got.Index != i || got.Namespace != w.namespace || got.Operation != w.operation || len(got.Changes) != w.changes {
+			t.Errorf("object %d = %+v, want %s in %q with %d changes", i, got, w.operation, w.namespace, w.changes)
+		}
+	}
+	if change := result.Objects[0].Changes[0]; change.Path != "data.mode" || change.Old != "slow" || change.New != "fast" {
+		t.Errorf("settings change = %+v, want data.mode from slow to fast", change)
+	}
+	if objects[0].GetNamespace() != "" {
+		t.Error("Apply() modified the decoded objects")
+	}
+}
@@ -0,0 +1,622 @@
+package approvals
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/auth"
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	approvalsFileName = "approvals.json"
+	settingsFileName  = "approval-settings.json"
+
+	// ApprovalHeader carries the ID of an approved approval when a dangerous request is retried
+	ApprovalHeader = "X-Agentkube-Approval"
+
+	expiryInterval = 30 * time.Second
+)
+
+// Approval statuses
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusExpired   = "expired"
+	StatusCancelled = "cancelled"
+	StatusExecuted  = "executed"
+)
+
+var (
+	// ErrApprovalRequired is returned for dangerous actions submitted without an approval
+	ErrApprovalRequired = errors.New("operation requires approval")
+	// ErrApprovalInvalid is returned when the approval of a request cannot be used
+	ErrApprovalInvalid = errors.New("approval is not valid for this operation")
+)
+
+// RuleSettings scope a dangerous operation rule
+type RuleSettings struct {
+	Enabled bool `json:"enabled"`
+	// ProductionOnly limits the rule to contexts matching the production patterns
+	ProductionOnly bool `json:"productionOnly"`
+}
+
+// Settings control which operations need approval
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// TimeoutMinutes is how long an approval waits for a decision, and how long an approved
+	// operation may wait to be executed
+	TimeoutMinutes int `json:"timeoutMinutes"`
+	// ProductionContexts are glob patterns of production context names
+	ProductionContexts []string                `json:"productionContexts"`
+	Rules              map[string]RuleSettings `json:"rules"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:            false,
+		TimeoutMinutes:     15,
+		ProductionContexts: []string{"*prod*"},
+		Rules: map[string]RuleSettings{
+			RuleDeleteNamespace: {Enabled: true},
+			RuleDrainNode:       {Enabled: true},
+			RuleScaleToZero:     {Enabled: true, ProductionOnly: true},
+		},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.TimeoutMinutes <= 0 {
+		return fmt.Errorf("timeoutMinutes must be positive")
+	}
+	for _, pattern := range s.ProductionContexts {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid production context pattern %q: %v", pattern, err)
+		}
+	}
+	for name := range s.Rules {
+		switch name {
+		case RuleDeleteNamespace, RuleDrainNode, RuleScaleToZero:
+		default:
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+// requiresApproval reports whether a rule applies to an action on the given clusters
+func (s Settings) requiresApproval(rule string, clusters []string) bool {
+	ruleSettings, ok := s.Rules[rule]
+	if !ok || !ruleSettings.Enabled {
+		return false
+	}
+	if !ruleSettings.ProductionOnly {
+		return true
+	}
+	for _, cluster := range clusters {
+		if matchesAny(s.ProductionContexts, cluster) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditEntry records a step in the life of an approval
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Decision string    `json:"decision"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// Approval is a request to run a dangerous operation, confirmed by a second user
+type Approval struct {
+	ID          string       `json:"id"`
+	Rule        string       `json:"rule"`
+	Summary     string       `json:"summary"`
+	Action      Action       `json:"action"`
+	Fingerprint string       `json:"fingerprint"`
+	Requester   string       `json:"requester"`
+	Reason      string       `json:"reason,omitempty"`
+	Status      string       `json:"status"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	DecidedBy   string       `json:"decidedBy,omitempty"`
+	DecidedAt   *time.Time   `json:"decidedAt,omitempty"`
+	ExecutedAt  *time.Time   `json:"executedAt,omitempty"`
+	History     []AuditEntry `json:"history"`
+}
+
+// Filter narrows down an approvals listing, empty fields match everything
+type Filter struct {
+	Status    string
+	Cluster   string
+	Rule      string
+	Requester string
+}
+
+func (f Filter) matches(a Approval) bool {
+	if f.Cluster != "" {
+		found := false
+		for _, cluster := range a.Action.Clusters {
+			found = found || cluster == f.Cluster
+		}
+		if !found {
+			return false
+		}
+	}
+	return (f.Status == "" || a.Status == f.Status) &&
+		(f.Rule == "" || a.Rule == f.Rule) &&
+		(f.Requester == "" || a.Requester == f.Requester)
+}
+
+// Manager guards dangerous operations behind approvals and keeps their audit trail
+type Manager struct {
+	approvalsPath string
+	settingsPath  string
+	mutex         sync.Mutex
+	notifier      dispatchers.Dispatcher
+	notifierOnce  sync.Once
+	stopChan      chan struct{}
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared approvals manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = NewManager()
+	})
+	return globalManager
+}
+
+// NewManager creates an approvals manager backed by the agentkube config directory
+func NewManager() *Manager {
+	configDir := utils.ConfigDir()
+	return &Manager{
+		approvalsPath: filepath.Join(configDir, approvalsFileName),
+		settingsPath:  filepath.Join(configDir, settingsFileName),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Identity identifies the caller of a request by a fingerprint of its bearer token, so callers
+// cannot claim another identity. It is empty for anonymous callers.
+func Identity(r *http.Request) string {
+	if token, err := auth.GetTokenFromHeaders(r); err == nil && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:6])
+	}
+	return ""
+}
+
+// Settings returns the current approval settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new approval settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Required reports whether an action needs an approval under the current settings
+func (m *Manager) Required(action Action) (bool, error) {
+	m.mutex.Lock()
+	settings, err := m.loadSettings()
+	m.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+	rule, _ := Classify(action)
+	return settings.Enabled && rule != "" && settings.requiresApproval(rule, action.Clusters), nil
+}
+
+// Guard checks whether an action may run. Dangerous actions submitted without an approval
+// create a pending approval and return it with ErrApprovalRequired. Actions submitted with the ID
+// of an approved approval for the same action consume it and may run.
+func (m *Manager) Guard(action Action, requester, approvalID, reason string) (*Approval, error) {
+	m.mutex.Lock()
+	settings, err := m.loadSettings()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+	if !settings.Enabled {
+		m.mutex.Unlock()
+		return nil, nil
+	}
+	rule, summary := Classify(action)
+	if rule == "" || !settings.requiresApproval(rule, action.Clusters) {
+		m.mutex.Unlock()
+		return nil, nil
+	}
+
+	if approvalID != "" {
+		approval, err := m.consume(approvalID, action)
+		m.mutex.Unlock()
+		if err != nil {
+			return approval, err
+		}
+		m.notify(approval, "Executed")
+		return nil, nil
+	}
+
+	approval, err := m.create(rule, summary, action, requester, reason, settings)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	m.notify(approval, "Requested")
+	return approval, ErrApprovalRequired
+}
+
+// create stores a pending approval, the caller must hold the mutex
+func (m *Manager) create(rule, summary string, action Action, requester, reason string, settings Settings) (*Approval, error) {
+	approvals, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	approval := Approval{
+		ID:          uuid.New().String(),
+		Rule:        rule,
+		Summary:     summary,
+		Action:      action,
+		Fingerprint: action.Fingerprint(),
+		Requester:   requester,
+		Reason:      reason,
+		Status:      StatusPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(settings.TimeoutMinutes) * time.Minute),
+		History: []AuditEntry{{
+			Time:     now,
+			Actor:    actorName(requester),
+			Decision: StatusPending,
+			Comment:  reason,
+		}},
+	}
+	if err := m.save(append(approvals, approval)); err != nil {
+		return nil, err
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"approval":  approval.ID,
+		"rule":      rule,
+		"clusters":  strings.Join(action.Clusters, ","),
+		"requester": actorName(requester),
+	}, nil, "Dangerous operation is waiting for approval")
+	return &approval, nil
+}
+
+// consume marks an approved approval as executed, the caller must hold the mutex
+func (m *Manager) consume(id string, action Action) (*Approval, error) {
+	approvals, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	approval := findApproval(approvals, id)
+	if approval == nil {
+		return nil, fmt.Errorf("%w: approval %s not found", ErrApprovalInvalid, id)
+	}
+
+	now := time.Now()
+	switch {
+	case approval.Fingerprint != action.Fingerprint():
+		return approval, fmt.Errorf("%w: approval %s was granted for a different operation", ErrApprovalInvalid, id)
+	case approval.Status != StatusApproved:
+		return approval, fmt.Errorf("%w: approval %s is %s", ErrApprovalInvalid, id, approval.Status)
+	case !now.Before(approval.ExpiresAt):
+		return approval, fmt.Errorf("%w: approval %s has expired", ErrApprovalInvalid, id)
+	}
+
+	approval.Status = StatusExecuted
+	approval.ExecutedAt = &now
+	approval.History = append(approval.History, AuditEntry{
+		Time:     now,
+		Actor:    actorName(approval.Requester),
+		Decision: StatusExecuted,
+	})
+	if err := m.save(approvals); err != nil {
+		return nil, err
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"approval": approval.ID,
+		"rule":     approval.Rule,
+	}, nil, "Executing approved dangerous operation")
+	return approval, nil
+}
+
+// Approve confirms a pending approval. The approver must be identified and differ from the requester.
+// The approved operation must then be executed before the timeout elapses again.
+func (m *Manager) Approve(id, approver, comment string) (*Approval, error) {
+	return m.decide(id, approver, comment, StatusApproved)
+}
+
+// Reject refuses a pending approval
+func (m *Manager) Reject(id, approver, comment string) (*Approval, error) {
+	return m.decide(id, approver, comment, StatusRejected)
+}
+
+// Cancel withdraws a pending or approved approval, only the requester may cancel it
+func (m *Manager) Cancel(id, requester, comment string) (*Approval, error) {
+	approval, err := m.update(id, func(approval *Approval, now time.Time) error {
+		if approval.Status != StatusPending && approval.Status != StatusApproved {
+			return fmt.Errorf("approval %s is %s", id, approval.Status)
+		}
+		if approval.Requester != requester {
+			return fmt.Errorf("only the requester can cancel approval %s", id)
+		}
+		approval.Status = StatusCancelled
+		approval.History = append(approval.History, AuditEntry{
+			Time:     now,
+			Actor:    actorName(requester),
+			Decision: StatusCancelled,
+			Comment:  comment,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.notify(approval, "Cancelled")
+	return approval, nil
+}
+
+func (m *Manager) decide(id, approver, comment, status string) (*Approval, error) {
+	if approver == "" {
+		return nil, fmt.Errorf("approvers must identify themselves with a bearer token")
+	}
+
+	m.mutex.Lock()
+	settings, err := m.loadSettings()
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	approval, err := m.update(id, func(approval *Approval, now time.Time) error {
+		if approval.Status != StatusPending {
+			return fmt.Errorf("approval %s is %s", id, approval.Status)
+		}
+		if !now.Before(approval.ExpiresAt) {
+			return fmt.Errorf("approval %s has expired", id)
+		}
+		if approval.Requester == approver {
+			return fmt.Errorf("approval %s must be decided by a different user than the requester", id)
+		}
+
+		approval.Status = status
+		approval.DecidedBy = approver
+		approval.DecidedAt = &now
+		if status == StatusApproved {
+			approval.ExpiresAt = now.Add(time.Duration(settings.TimeoutMinutes) * time.Minute)
+		}
+		approval.History = append(approval.History, AuditEntry{
+			Time:     now,
+			Actor:    approver,
+			Decision: status,
+			Comment:  comment,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"approval": approval.ID,
+		"rule":     approval.Rule,
+		"decision": status,
+		"approver": approver,
+	}, nil, "Approval decided")
+	if status == StatusApproved {
+		m.notify(approval, "Approved")
+	} else {
+		m.notify(approval, "Rejected")
+	}
+	return approval, nil
+}
+
+func (m *Manager) update(id string, apply func(*Approval, time.Time) error) (*Approval, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	approvals, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	approval := findApproval(approvals, id)
+	if approval == nil {
+		return nil, fmt.Errorf("approval %s not found", id)
+	}
+	if err := apply(approval, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := m.save(approvals); err != nil {
+		return nil, err
+	}
+	result := *approval
+	return &result, nil
+}
+
+// List returns the approvals matching the filter, newest first
+func (m *Manager) List(filter Filter) ([]Approval, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	approvals, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Approval{}
+	for _, approval := range approvals {
+		if filter.matches(approval) {
+			result = append(result, approval)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// Get returns a single approval
+func (m *Manager) Get(id string) (*Approval, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	approvals, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	if approval := findApproval(approvals, id); approval != nil {
+		return approval, nil
+	}
+	return nil, fmt.Errorf("approval %s not found", id)
+}
+
+// Start runs the expiry loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+
+		m.ExpireStale()
+		for {
+			select {
+			case <-ticker.C:
+				m.ExpireStale()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the expiry loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// ExpireStale expires pending approvals nobody decided on, and approved ones that were never executed
+func (m *Manager) ExpireStale() {
+	m.mutex.Lock()
+	approvals, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		logger.Log(logger.LevelError, nil, err, "Failed to load approvals")
+		return
+	}
+
+	now := time.Now()
+	var expired []Approval
+	for i := range approvals {
+		approval := &approvals[i]
+		if (approval.Status != StatusPending && approval.Status != StatusApproved) || now.Before(approval.ExpiresAt) {
+			continue
+		}
+		approval.Status = StatusExpired
+		approval.History = append(approval.History, AuditEntry{
+			Time:     now,
+			Actor:    "system",
+			Decision: StatusExpired,
+		})
+		expired = append(expired, *approval)
+	}
+	if len(expired) > 0 {
+		err = m.save(approvals)
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to save approvals")
+		return
+	}
+	for i := range expired {
+		m.notify(&expired[i], "Expired")
+	}
+}
+
+// notify sends an approval event through the dispatcher configured for the watcher
+func (m *Manager) notify(approval *Approval, reason string) {
+	m.notifierOnce.Do(func() {
+		m.notifier = client.NewNotifier("approval")
+	})
+
+	e := event.Event{
+		Kind:      "approval",
+		Component: approval.Rule,
+		Host:      strings.Join(approval.Action.Clusters, ","),
+		Name:      approval.Summary,
+		Reason:    reason,
+		Status:    approval.ID,
+	}
+	go m.notifier.Handle(e)
+}
+
+func findApproval(approvals []Approval, id string) *Approval {
+	for i := range approvals {
+		if approvals[i].ID == id {
+			return &approvals[i]
+		}
+	}
+	return nil
+}
+
+func actorName(identity string) string {
+	if identity == "" {
+		return "anonymous"
+	}
+	return identity
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+func (m *Manager) load() ([]Approval, error) {
+	var approvals []Approval
+	if err := utils.ReadJSONFile(m.approvalsPath, &approvals); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+func (m *Manager) save(approvals []Approval) error {
+	return utils.WriteJSONFile(m.approvalsPath, approvals)
+}
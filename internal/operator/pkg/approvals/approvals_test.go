@@ -0,0 +1,68 @@
+package approvals
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/dispatchers"
+)
+
+func TestIdentityIgnoresClaimedUser(t *testing.T) {
+	t.Parallel()
+
+	request := func(token, user string) string {
+		r := httptest.NewRequest("POST", "/approvals", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.Header.Set("X-Agentkube-User", user)
+		return Identity(r)
+	}
+
+	if request("token-a", "alice") != request("token-a", "bob") {
+		t.Error("the same token should identify the same caller whatever user it claims")
+	}
+	if request("token-a", "alice") == request("token-b", "alice") {
+		t.Error("different tokens should identify different callers")
+	}
+	if got := request("", "alice"); got != "" {
+		t.Errorf("Identity() without a token = %q, want anonymous", got)
+	}
+}
+
+func TestRequesterCannotApproveOwnRequest(t *testing.T) {
+	t.Setenv("CONFIG", t.TempDir())
+
+	manager := NewManager()
+	manager.notifierOnce.Do(func() { manager.notifier = &dispatchers.Default{} })
+	settings := DefaultSettings()
+	settings.Enabled = true
+	if err := manager.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+
+	identity := func(token, user string) string {
+		r := httptest.NewRequest("POST", "/approvals", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("X-Agentkube-User", user)
+		return Identity(r)
+	}
+
+	action := NewProxyAction("prod", "DELETE", "/api/v1/namespaces/payments", nil)
+	approval, err := manager.Guard(action, identity("token-a", "alice"), "", "cleanup")
+	if !errors.Is(err, ErrApprovalRequired) || approval == nil {
+		t.Fatalf("Guard() = %v, %v, want a pending approval", approval, err)
+	}
+
+	if _, err := manager.Approve(approval.ID, identity("token-a", "bob"), "lgtm"); err == nil {
+		t.Fatal("Approve() with the requester's token claiming another user should fail")
+	}
+	approved, err := manager.Approve(approval.ID, identity("token-b", "bob"), "lgtm")
+	if err != nil {
+		t.Fatalf("Approve() by another token error = %v", err)
+	}
+	if approved.Status != StatusApproved {
+		t.Errorf("status = %q, want %q", approved.Status, StatusApproved)
+	}
+}
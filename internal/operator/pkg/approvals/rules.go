@@ -0,0 +1,280 @@
+package approvals
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/command"
+)
+
+// Dangerous operation rules
+const (
+	RuleDeleteNamespace = "delete-namespace"
+	RuleDrainNode       = "drain-node"
+	RuleScaleToZero     = "scale-to-zero"
+)
+
+// Action types
+const (
+	ActionProxy         = "proxy"
+	ActionKubectl       = "kubectl"
+	ActionKubectlFanOut = "kubectl-fanout"
+	ActionHibernate     = "hibernate"
+	ActionApply         = "apply"
+)
+
+var (
+	namespacePathPattern         = regexp.MustCompile(`^/api/v1/namespaces/([^/]+)$`)
+	namespaceFinalizePathPattern = regexp.MustCompile(`^/api/v1/namespaces/([^/]+)/finalize$`)
+	nodePathPattern              = regexp.MustCompile(`^/api/v1/nodes/([^/]+)$`)
+	workloadPathPattern          = regexp.MustCompile(`^/apis/apps/v1/namespaces/([^/]+)/(deployments|statefulsets|replicasets)/([^/]+)(/scale)?$`)
+)
+
+// Action describes an operation that may need approval. Approvals are bound to the exact action
+// they were requested for, so an approved request cannot be swapped for a different one.
+type Action struct {
+	Type     string   `json:"type"`
+	Clusters []string `json:"clusters"`
+	Method   string   `json:"method,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	// BodyHash is the sha256 of the request body, the body itself is not stored
+	BodyHash string `json:"bodyHash,omitempty"`
+	// Body is only used to classify the action
+	Body []byte `json:"-"`
+}
+
+// NewProxyAction describes a request proxied to the Kubernetes API of a cluster
+func NewProxyAction(cluster, method, path string, body []byte) Action {
+	return Action{
+		Type:     ActionProxy,
+		Clusters: []string{cluster},
+		Method:   strings.ToUpper(method),
+		Path:     path,
+		BodyHash: hashBody(body),
+		Body:     body,
+	}
+}
+
+// NewKubectlAction describes a kubectl command run against one or more contexts
+func NewKubectlAction(clusters []string, cmd []string) Action {
+	actionType := ActionKubectl
+	if len(clusters) > 1 {
+		actionType = ActionKubectlFanOut
+	}
+	return Action{
+		Type:     actionType,
+		Clusters: clusters,
+		Command:  cmd,
+	}
+}
+
+// NewHibernateAction describes scaling the workloads of a cluster to zero
+func NewHibernateAction(cluster string, request interface{}) Action {
+	body, _ := json.Marshal(request)
+	return Action{
+		Type:     ActionHibernate,
+		Clusters: []string{cluster},
+		BodyHash: hashBody(body),
+	}
+}
+
+// NewApplyAction describes applying manifest objects to a cluster
+func NewApplyAction(cluster string, objects []map[string]interface{}) Action {
+	body, _ := json.Marshal(objects)
+	return Action{
+		Type:     ActionApply,
+		Clusters: []string{cluster},
+		BodyHash: hashBody(body),
+		Body:     body,
+	}
+}
+
+// Fingerprint identifies the action an approval was granted for
+func (a Action) Fingerprint() string {
+	data, _ := json.Marshal(a)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Classify returns the dangerous operation rule the action falls under and a short description
+// of its target. The rule is empty for actions that need no approval.
+func Classify(a Action) (string, string) {
+	switch a.Type {
+	case ActionProxy:
+		return classifyProxy(a.Method, a.Path, a.Body)
+	case ActionKubectl, ActionKubectlFanOut:
+		return classifyKubectl(a.Command)
+	case ActionHibernate:
+		return RuleScaleToZero, "hibernate all workloads"
+	case ActionApply:
+		return classifyApply(a.Body)
+	}
+	return "", ""
+}
+
+func classifyProxy(method, path string, body []byte) (string, string) {
+	if match := namespacePathPattern.FindStringSubmatch(path); match != nil && method == "DELETE" {
+		return RuleDeleteNamespace, "delete namespace " + match[1]
+	}
+	if method != "PATCH" && method != "PUT" {
+		return "", ""
+	}
+	// Removing the finalizers of a terminating namespace completes its deletion
+	if match := namespaceFinalizePathPattern.FindStringSubmatch(path); match != nil && method == "PUT" {
+		return RuleDeleteNamespace, "force-finalize namespace " + match[1]
+	}
+
+	if match := nodePathPattern.FindStringSubmatch(path); match != nil {
+		// Cordoning is the first step of a drain
+		if unschedulable, ok := patchedValue(body, "spec", "unschedulable").(bool); ok && unschedulable {
+			return RuleDrainNode, "cordon node " + match[1]
+		}
+		return "", ""
+	}
+	if match := workloadPathPattern.FindStringSubmatch(path); match != nil {
+		if replicas, ok := patchedValue(body, "spec", "replicas").(float64); ok && replicas == 0 {
+			return RuleScaleToZero, fmt.Sprintf("scale %s %s/%s to 0 replicas", strings.TrimSuffix(match[2], "s"), match[1], match[3])
+		}
+	}
+	return "", ""
+}
+
+// patchedValue returns the value a request body sets at a field path. The body is either an
+// object (a full object, merge or strategic merge patch) or a JSON patch.
+func patchedValue(body []byte, fields ...string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		var current interface{} = v
+		for _, field := range fields {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			current = object[field]
+		}
+		return current
+	case []interface{}:
+		pointer := "/" + strings.Join(fields, "/")
+		var value interface{}
+		for _, op := range v {
+			operation, ok := op.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if (operation["op"] == "add" || operation["op"] == "replace") && operation["path"] == pointer {
+				value = operation["value"]
+			}
+		}
+		return value
+	}
+	return nil
+}
+
+// classifyApply checks the applied objects for workloads set to zero replicas and cordoned nodes,
+// what a proxied patch of the same objects would need approval for
+func classifyApply(body []byte) (string, string) {
+	var objects []json.RawMessage
+	if err := json.Unmarshal(body, &objects); err != nil {
+		return "", ""
+	}
+	for _, object := range objects {
+		var meta struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(object, &meta); err != nil {
+			continue
+		}
+		name := meta.Metadata.Name
+		switch meta.Kind {
+		case "Node":
+			if unschedulable, ok := patchedValue(object, "spec", "unschedulable").(bool); ok && unschedulable {
+				return RuleDrainNode, "cordon node " + name
+			}
+		case "Deployment", "StatefulSet", "ReplicaSet":
+			if replicas, ok := patchedValue(object, "spec", "replicas").(float64); ok && replicas == 0 {
+				return RuleScaleToZero, fmt.Sprintf("scale %s %s/%s to 0 replicas", strings.ToLower(meta.Kind), meta.Metadata.Namespace, name)
+			}
+		}
+	}
+	return "", ""
+}
+
+func classifyKubectl(cmd []string) (string, string) {
+	parsed := command.ParseKubectlArgs(cmd)
+	verb, args := parsed.Verb, parsed.Args
+	switch verb {
+	case "delete":
+		if namespaces := deletedNamespaces(args); len(namespaces) > 0 {
+			return RuleDeleteNamespace, "delete namespace " + strings.Join(namespaces, ", ")
+		}
+	case "drain", "cordon":
+		return RuleDrainNode, verb + " node " + strings.Join(args, ", ")
+	case "scale":
+		if parsed.Flags["--replicas"] == "0" {
+			return RuleScaleToZero, "scale " + strings.Join(args, " ") + " to 0 replicas"
+		}
+	}
+	return "", ""
+}
+
+// deletedNamespaces returns the namespaces a kubectl delete removes, from either the
+// "namespace a b" or the "namespace/a" form
+func deletedNamespaces(args []string) []string {
+	var namespaces []string
+	if len(args) > 0 && isNamespaceResource(args[0]) {
+		namespaces = append(namespaces, args[1:]...)
+		if len(namespaces) == 0 {
+			namespaces = []string{"(selected)"}
+		}
+		return namespaces
+	}
+	for _, arg := range args {
+		for _, ref := range strings.Split(arg, ",") {
+			if resource, name, ok := strings.Cut(ref, "/"); ok && isNamespaceResource(resource) {
+				namespaces = append(namespaces, name)
+			}
+		}
+	}
+	return namespaces
+}
+
+func isNamespaceResource(resource string) bool {
+	switch strings.ToLower(resource) {
+	case "ns", "namespace", "namespaces":
+		return true
+	}
+	return false
+}
+
+// matchesAny reports whether a context name matches one of the glob patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hashBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
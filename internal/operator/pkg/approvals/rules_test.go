@@ -0,0 +1,146 @@
+package approvals
+
+import (
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		action Action
+		rule   string
+	}{
+		{
+			name:   "proxy namespace delete",
+			action: NewProxyAction("prod", "DELETE", "/api/v1/namespaces/payments", nil),
+			rule:   RuleDeleteNamespace,
+		},
+		{
+			name:   "proxy namespace finalize",
+			action: NewProxyAction("prod", "PUT", "/api/v1/namespaces/payments/finalize", nil),
+			rule:   RuleDeleteNamespace,
+		},
+		{
+			name:   "proxy pod delete",
+			action: NewProxyAction("prod", "DELETE", "/api/v1/namespaces/payments/pods/api-0", nil),
+		},
+		{
+			name:   "proxy node cordon",
+			action: NewProxyAction("prod", "PATCH", "/api/v1/nodes/worker-1", []byte(`{"spec":{"unschedulable":true}}`)),
+			rule:   RuleDrainNode,
+		},
+		{
+			name:   "proxy node uncordon",
+			action: NewProxyAction("prod", "PATCH", "/api/v1/nodes/worker-1", []byte(`{"spec":{"unschedulable":false}}`)),
+		},
+		{
+			name:   "proxy scale subresource to zero",
+			action: NewProxyAction("prod", "PUT", "/apis/apps/v1/namespaces/web/deployments/api/scale", []byte(`{"spec":{"replicas":0}}`)),
+			rule:   RuleScaleToZero,
+		},
+		{
+			name:   "proxy json patch to zero",
+			action: NewProxyAction("prod", "PATCH", "/apis/apps/v1/namespaces/web/statefulsets/db", []byte(`[{"op":"replace","path":"/spec/replicas","value":0}]`)),
+			rule:   RuleScaleToZero,
+		},
+		{
+			name:   "proxy scale down",
+			action: NewProxyAction("prod", "PATCH", "/apis/apps/v1/namespaces/web/deployments/api", []byte(`{"spec":{"replicas":2}}`)),
+		},
+		{
+			name: "apply deployment with zero replicas",
+			action: NewApplyAction("prod", []map[string]interface{}{
+				{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "settings"}},
+				{"kind": "Deployment", "metadata": map[string]interface{}{"namespace": "web", "name": "api"}, "spec": map[string]interface{}{"replicas": 0}},
+			}),
+			rule: RuleScaleToZero,
+		},
+		{
+			name: "apply cordoned node",
+			action: NewApplyAction("prod", []map[string]interface{}{
+				{"kind": "Node", "metadata": map[string]interface{}{"name": "worker-1"}, "spec": map[string]interface{}{"unschedulable": true}},
+			}),
+			rule: RuleDrainNode,
+		},
+		{
+			name: "apply deployment",
+			action: NewApplyAction("prod", []map[string]interface{}{
+				{"kind": "Deployment", "metadata": map[string]interface{}{"namespace": "web", "name": "api"}, "spec": map[string]interface{}{"replicas": 2}},
+			}),
+		},
+		{
+			name:   "kubectl delete namespace",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "delete", "ns", "payments"}),
+			rule:   RuleDeleteNamespace,
+		},
+		{
+			name:   "kubectl delete namespace slash form with flags",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "--context", "prod", "delete", "namespace/payments", "--wait=false"}),
+			rule:   RuleDeleteNamespace,
+		},
+		{
+			name:   "kubectl delete pod in namespace",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "delete", "pod", "api-0", "-n", "namespace"}),
+		},
+		{
+			name:   "kubectl drain",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "drain", "worker-1", "--ignore-daemonsets"}),
+			rule:   RuleDrainNode,
+		},
+		{
+			name:   "kubectl scale to zero",
+			action: NewKubectlAction([]string{"prod", "staging"}, []string{"kubectl", "scale", "deploy/api", "--replicas", "0"}),
+			rule:   RuleScaleToZero,
+		},
+		{
+			name:   "kubectl scale up",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "scale", "deploy/api", "--replicas=3"}),
+		},
+		{
+			name:   "kubectl get",
+			action: NewKubectlAction([]string{"prod"}, []string{"kubectl", "get", "namespaces"}),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rule, summary := Classify(tt.action)
+			if rule != tt.rule {
+				t.Errorf("Classify() rule = %q (%s), want %q", rule, summary, tt.rule)
+			}
+		})
+	}
+}
+
+func TestRequiresApproval(t *testing.T) {
+	t.Parallel()
+
+	settings := DefaultSettings()
+	if !settings.requiresApproval(RuleDeleteNamespace, []string{"dev"}) {
+		t.Error("namespace deletion should need approval on every cluster")
+	}
+	if settings.requiresApproval(RuleScaleToZero, []string{"dev", "staging"}) {
+		t.Error("scaling to zero should only need approval on production clusters")
+	}
+	if !settings.requiresApproval(RuleScaleToZero, []string{"dev", "eu-prod-1"}) {
+		t.Error("scaling to zero on a production cluster should need approval")
+	}
+}
+
+func TestFingerprintBindsBody(t *testing.T) {
+	t.Parallel()
+
+	zero := NewProxyAction("prod", "PATCH", "/apis/apps/v1/namespaces/web/deployments/api", []byte(`{"spec":{"replicas":0}}`))
+	other := NewProxyAction("prod", "PATCH", "/apis/apps/v1/namespaces/web/deployments/api", []byte(`{"spec":{"replicas":0},"metadata":{"labels":{"a":"b"}}}`))
+	if zero.Fingerprint() == other.Fingerprint() {
+		t.Error("actions with different bodies should have different fingerprints")
+	}
+	if zero.Fingerprint() != NewProxyAction("prod", "patch", zero.Path, zero.Body).Fingerprint() {
+		t.Error("identical actions should have the same fingerprint")
+	}
+}
@@ -0,0 +1,536 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Autoscalers that are detected
+const (
+	ClusterAutoscaler = "cluster-autoscaler"
+	Karpenter         = "karpenter"
+)
+
+// Scale-down blocker reasons
+const (
+	BlockerNotSafeToEvict    = "not-safe-to-evict"
+	BlockerNoController      = "no-controller"
+	BlockerLocalStorage      = "local-storage"
+	BlockerSystemPodNoPDB    = "kube-system-without-pdb"
+	BlockerPDBExhausted      = "pdb-exhausted"
+	BlockerDoNotDisrupt      = "do-not-disrupt"
+	BlockerScaleDownDisabled = "scale-down-disabled"
+)
+
+const (
+	statusConfigMap             = "cluster-autoscaler-status"
+	safeToEvictAnnotation       = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+	scaleDownDisabledAnnotation = "cluster-autoscaler.kubernetes.io/scale-down-disabled"
+	doNotDisruptAnnotation      = "karpenter.sh/do-not-disrupt"
+	legacyDoNotEvictAnnotation  = "karpenter.sh/do-not-evict"
+
+	eventLookback = 6 * time.Hour
+	maxEvents     = 200
+)
+
+// autoscalerEvents are the event reasons emitted by the Cluster Autoscaler and Karpenter
+var autoscalerEvents = map[string]string{
+	"TriggeredScaleUp":           ClusterAutoscaler,
+	"NotTriggerScaleUp":          ClusterAutoscaler,
+	"ScaledUpGroup":              ClusterAutoscaler,
+	"FailedToScaleUpGroup":       ClusterAutoscaler,
+	"ScaleUpTimedOut":            ClusterAutoscaler,
+	"ScaleDown":                  ClusterAutoscaler,
+	"ScaleDownEmpty":             ClusterAutoscaler,
+	"ScaleDownFailed":            ClusterAutoscaler,
+	"Nominated":                  Karpenter,
+	"DisruptionBlocked":          Karpenter,
+	"DisruptionLaunching":        Karpenter,
+	"DisruptionTerminating":      Karpenter,
+	"DisruptionWaitingReadiness": Karpenter,
+	"Unconsolidatable":           Karpenter,
+	"InsufficientCapacityError":  Karpenter,
+	"FailedDraining":             Karpenter,
+}
+
+// Inspector reads the state of the Cluster Autoscaler and Karpenter from their CRDs, status and events
+type Inspector struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// Overview is the autoscaling state of a cluster
+type Overview struct {
+	Cluster string `json:"cluster"`
+	// Autoscalers lists the detected autoscalers
+	Autoscalers       []string                 `json:"autoscalers"`
+	ClusterAutoscaler *ClusterAutoscalerStatus `json:"clusterAutoscaler,omitempty"`
+	Karpenter         *KarpenterStatus         `json:"karpenter,omitempty"`
+	PendingPods       int                      `json:"pendingPods"`
+	Blockers          int                      `json:"blockers"`
+	Events            []Event                  `json:"events"`
+}
+
+// ClusterAutoscalerStatus is the content of the cluster-autoscaler-status ConfigMap
+type ClusterAutoscalerStatus struct {
+	Health    string    `json:"health"`
+	ScaleUp   string    `json:"scaleUp"`
+	ScaleDown string    `json:"scaleDown"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	// Raw is the unparsed status, its format differs between autoscaler versions
+	Raw string `json:"raw"`
+}
+
+// Event is an autoscaler event
+type Event struct {
+	Autoscaler string    `json:"autoscaler"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Reason     string    `json:"reason"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	Message    string    `json:"message"`
+	Count      int32     `json:"count"`
+}
+
+// PendingPod is an unschedulable pod that may drive a scale-up
+type PendingPod struct {
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	WorkloadKind string    `json:"workloadKind"`
+	Workload     string    `json:"workload"`
+	CreatedAt    time.Time `json:"createdAt"`
+	CPU          string    `json:"cpu,omitempty"`
+	Memory       string    `json:"memory,omitempty"`
+	// SchedulerMessage tells why no node fits the pod
+	SchedulerMessage string `json:"schedulerMessage"`
+	// ScaleUp is the latest autoscaler decision about the pod, e.g. TriggeredScaleUp or NotTriggerScaleUp
+	ScaleUp *Event `json:"scaleUp,omitempty"`
+}
+
+// Blocker is a pod or node preventing an autoscaler from removing a node
+type Blocker struct {
+	// Autoscaler is empty when the blocker holds for every autoscaler
+	Autoscaler string `json:"autoscaler"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Node       string `json:"node"`
+	Reason     string `json:"reason"`
+	Message    string `json:"message"`
+}
+
+// clients are the clients of a cluster and the autoscalers running in it
+type clients struct {
+	clientset   *kubernetes.Clientset
+	dynamic     dynamic.Interface
+	autoscalers []string
+	// status is the cluster-autoscaler-status ConfigMap, nil without the Cluster Autoscaler
+	status *corev1.ConfigMap
+}
+
+// NewInspector creates a new autoscaler inspector
+func NewInspector(kubeConfigStore kubeconfig.ContextStore) *Inspector {
+	return &Inspector{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+func (i *Inspector) clients(ctx context.Context, clusterName string) (*clients, error) {
+	kubeContext, err := i.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	c := &clients{clientset: clientset, dynamic: dynamicClient, autoscalers: []string{}}
+	// The status ConfigMap is written by the Cluster Autoscaler, it is missing without one or without
+	// access to kube-system
+	if status, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, statusConfigMap, metav1.GetOptions{}); err == nil {
+		c.status = status
+		c.autoscalers = append(c.autoscalers, ClusterAutoscaler)
+	}
+	if _, ok := karpenterVersion(ctx, dynamicClient); ok {
+		c.autoscalers = append(c.autoscalers, Karpenter)
+	}
+	return c, nil
+}
+
+func (c *clients) runs(autoscaler string) bool {
+	for _, detected := range c.autoscalers {
+		if detected == autoscaler {
+			return true
+		}
+	}
+	return false
+}
+
+// Overview returns the detected autoscalers, their status and recent events
+func (i *Inspector) Overview(clusterName string) (*Overview, error) {
+	ctx := context.Background()
+	c, err := i.clients(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	overview := &Overview{Cluster: clusterName, Autoscalers: c.autoscalers}
+	if c.status != nil {
+		overview.ClusterAutoscaler = parseStatus(c.status.Data["status"])
+	}
+	if c.runs(Karpenter) {
+		if overview.Karpenter, err = karpenterStatus(ctx, c.dynamic); err != nil {
+			return nil, err
+		}
+	}
+
+	if overview.Events, err = events(ctx, c.clientset, time.Now().Add(-eventLookback)); err != nil {
+		return nil, err
+	}
+	pending, err := pendingPods(ctx, c.clientset, overview.Events)
+	if err != nil {
+		return nil, err
+	}
+	overview.PendingPods = len(pending)
+	blockers, err := scaleDownBlockers(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	overview.Blockers = len(blockers)
+	return overview, nil
+}
+
+// PendingPods lists the unschedulable pods with the latest scale-up decision about them
+func (i *Inspector) PendingPods(clusterName string) ([]PendingPod, error) {
+	ctx := context.Background()
+	c, err := i.clients(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := events(ctx, c.clientset, time.Now().Add(-eventLookback))
+	if err != nil {
+		return nil, err
+	}
+	return pendingPods(ctx, c.clientset, recent)
+}
+
+// ScaleDownBlockers lists the pods and nodes keeping the detected autoscalers from removing nodes
+func (i *Inspector) ScaleDownBlockers(clusterName string) ([]Blocker, error) {
+	ctx := context.Background()
+	c, err := i.clients(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return scaleDownBlockers(ctx, c)
+}
+
+// Karpenter returns the NodePools and NodeClaims, nil when Karpenter is not installed
+func (i *Inspector) Karpenter(clusterName string) (*KarpenterStatus, error) {
+	ctx := context.Background()
+	c, err := i.clients(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if !c.runs(Karpenter) {
+		return nil, nil
+	}
+	return karpenterStatus(ctx, c.dynamic)
+}
+
+var statusLine = regexp.MustCompile(`(?m)^\s*(Health|ScaleUp|ScaleDown):\s+(\w+)`)
+
+// parseStatus reads the cluster-wide state from the status ConfigMap. Since 1.30 the status is YAML,
+// older versions write indented text.
+func parseStatus(raw string) *ClusterAutoscalerStatus {
+	status := &ClusterAutoscalerStatus{Raw: raw}
+
+	var structured struct {
+		Time        string `yaml:"time"`
+		ClusterWide struct {
+			Health struct {
+				Status string `yaml:"status"`
+			} `yaml:"health"`
+			ScaleUp struct {
+				Status string `yaml:"status"`
+			} `yaml:"scaleUp"`
+			ScaleDown struct {
+				Status string `yaml:"status"`
+			} `yaml:"scaleDown"`
+		} `yaml:"clusterWide"`
+	}
+	if err := yaml.Unmarshal([]byte(raw), &structured); err == nil && structured.ClusterWide.Health.Status != "" {
+		status.Health = structured.ClusterWide.Health.Status
+		status.ScaleUp = structured.ClusterWide.ScaleUp.Status
+		status.ScaleDown = structured.ClusterWide.ScaleDown.Status
+		status.UpdatedAt, _ = time.Parse(time.RFC3339, structured.Time)
+		return status
+	}
+
+	// Only the cluster-wide section, node groups follow it with the same fields
+	clusterWide := raw
+	if index := strings.Index(raw, "NodeGroups:"); index >= 0 {
+		clusterWide = raw[:index]
+	}
+	for _, match := range statusLine.FindAllStringSubmatch(clusterWide, -1) {
+		switch match[1] {
+		case "Health":
+			status.Health = match[2]
+		case "ScaleUp":
+			status.ScaleUp = match[2]
+		case "ScaleDown":
+			status.ScaleDown = match[2]
+		}
+	}
+	if index := strings.Index(raw, "Cluster-autoscaler status at "); index >= 0 {
+		line := strings.SplitN(raw[index+len("Cluster-autoscaler status at "):], "\n", 2)[0]
+		status.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", strings.TrimSuffix(line, ":"))
+	}
+	return status
+}
+
+// events lists the autoscaler events since the given time, most recent first
+func events(ctx context.Context, clientset *kubernetes.Clientset, since time.Time) ([]Event, error) {
+	list, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+
+	result := []Event{}
+	for _, e := range list.Items {
+		autoscaler, ok := autoscalerEvents[e.Reason]
+		if !ok {
+			continue
+		}
+		last := e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		if last.Before(since) {
+			continue
+		}
+		result = append(result, Event{
+			Autoscaler: autoscaler,
+			Time:       last,
+			Type:       e.Type,
+			Reason:     e.Reason,
+			Kind:       e.InvolvedObject.Kind,
+			Namespace:  e.InvolvedObject.Namespace,
+			Name:       e.InvolvedObject.Name,
+			Message:    e.Message,
+			Count:      e.Count,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	if len(result) > maxEvents {
+		result = result[:maxEvents]
+	}
+	return result, nil
+}
+
+// pendingPods lists unschedulable pods with the latest autoscaler event about them
+func pendingPods(ctx context.Context, clientset *kubernetes.Clientset, recent []Event) ([]PendingPod, error) {
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase=Pending",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending pods: %v", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Events are sorted most recent first, the first one of a pod is its latest
+	latest := map[string]*Event{}
+	for i := range recent {
+		e := &recent[i]
+		if e.Kind != "Pod" {
+			continue
+		}
+		if _, ok := latest[e.Namespace+"/"+e.Name]; !ok {
+			latest[e.Namespace+"/"+e.Name] = e
+		}
+	}
+
+	result := []PendingPod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		message, unschedulable := unschedulableMessage(pod)
+		if !unschedulable {
+			continue
+		}
+		kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+		pending := PendingPod{
+			Namespace:        pod.Namespace,
+			Name:             pod.Name,
+			WorkloadKind:     kind,
+			Workload:         name,
+			CreatedAt:        pod.CreationTimestamp.Time,
+			SchedulerMessage: message,
+			ScaleUp:          latest[pod.Namespace+"/"+pod.Name],
+		}
+		var cpu, memory resource.Quantity
+		for _, container := range pod.Spec.Containers {
+			cpu.Add(*container.Resources.Requests.Cpu())
+			memory.Add(*container.Resources.Requests.Memory())
+		}
+		if !cpu.IsZero() {
+			pending.CPU = cpu.String()
+		}
+		if !memory.IsZero() {
+			pending.Memory = memory.String()
+		}
+		result = append(result, pending)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+func unschedulableMessage(pod *corev1.Pod) (string, bool) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			return condition.Message, true
+		}
+	}
+	return "", false
+}
+
+// scaleDownBlockers lists what keeps the detected autoscalers from removing nodes
+func scaleDownBlockers(ctx context.Context, c *clients) ([]Blocker, error) {
+	if len(c.autoscalers) == 0 {
+		return []Blocker{}, nil
+	}
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	pdbs, err := c.clientset.PolicyV1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pod disruption budgets: %v", err)
+	}
+	return findBlockers(nodes.Items, pods.Items, pdbs.Items, c.runs(ClusterAutoscaler), c.runs(Karpenter)), nil
+}
+
+// findBlockers applies the scale-down rules of the Cluster Autoscaler and Karpenter to the nodes and
+// the pods running on them. DaemonSet and mirror pods never block.
+func findBlockers(nodes []corev1.Node, pods []corev1.Pod, pdbs []policyv1.PodDisruptionBudget, clusterAutoscaler, karpenter bool) []Blocker {
+	blockers := []Blocker{}
+	for _, node := range nodes {
+		if clusterAutoscaler && node.Annotations[scaleDownDisabledAnnotation] == "true" {
+			blockers = append(blockers, Blocker{Autoscaler: ClusterAutoscaler, Kind: "Node", Name: node.Name, Node: node.Name,
+				Reason: BlockerScaleDownDisabled, Message: "node is annotated with " + scaleDownDisabledAnnotation + "=true"})
+		}
+		if karpenter && node.Annotations[doNotDisruptAnnotation] == "true" {
+			blockers = append(blockers, Blocker{Autoscaler: Karpenter, Kind: "Node", Name: node.Name, Node: node.Name,
+				Reason: BlockerDoNotDisrupt, Message: "node is annotated with " + doNotDisruptAnnotation + "=true"})
+		}
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		owner := metav1.GetControllerOf(pod)
+		if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror || (owner != nil && owner.Kind == "DaemonSet") {
+			continue
+		}
+		add := func(autoscaler, reason, message string) {
+			blockers = append(blockers, Blocker{Autoscaler: autoscaler, Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name,
+				Node: pod.Spec.NodeName, Reason: reason, Message: message})
+		}
+
+		pdb := exhaustedPDB(pdbs, pod)
+		if pdb != "" {
+			add("", BlockerPDBExhausted, fmt.Sprintf("PodDisruptionBudget %s allows no disruption", pdb))
+		}
+
+		if clusterAutoscaler {
+			switch safeToEvict := pod.Annotations[safeToEvictAnnotation]; {
+			case safeToEvict == "false":
+				add(ClusterAutoscaler, BlockerNotSafeToEvict, "pod is annotated with "+safeToEvictAnnotation+"=false")
+			case safeToEvict == "true":
+			case owner == nil:
+				add(ClusterAutoscaler, BlockerNoController, "pod has no controller to recreate it elsewhere")
+			case hasLocalStorage(pod):
+				add(ClusterAutoscaler, BlockerLocalStorage, "pod uses emptyDir or hostPath storage")
+			case pod.Namespace == metav1.NamespaceSystem && !coveredByPDB(pdbs, pod):
+				add(ClusterAutoscaler, BlockerSystemPodNoPDB, "kube-system pod is not covered by a PodDisruptionBudget")
+			}
+		}
+		if karpenter && (pod.Annotations[doNotDisruptAnnotation] == "true" || pod.Annotations[legacyDoNotEvictAnnotation] == "true") {
+			add(Karpenter, BlockerDoNotDisrupt, "pod is annotated with "+doNotDisruptAnnotation+"=true")
+		}
+	}
+
+	sort.SliceStable(blockers, func(i, j int) bool { return blockers[i].Node < blockers[j].Node })
+	return blockers
+}
+
+func hasLocalStorage(pod *corev1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil || (volume.EmptyDir != nil && volume.EmptyDir.Medium != corev1.StorageMediumMemory) {
+			return true
+		}
+	}
+	return false
+}
+
+// exhaustedPDB returns the name of a PDB covering the pod that allows no disruption
+func exhaustedPDB(pdbs []policyv1.PodDisruptionBudget, pod *corev1.Pod) string {
+	for i := range pdbs {
+		if pdbs[i].Status.DisruptionsAllowed == 0 && pdbMatches(&pdbs[i], pod) {
+			return pdbs[i].Name
+		}
+	}
+	return ""
+}
+
+func coveredByPDB(pdbs []policyv1.PodDisruptionBudget, pod *corev1.Pod) bool {
+	for i := range pdbs {
+		if pdbMatches(&pdbs[i], pod) {
+			return true
+		}
+	}
+	return false
+}
+
+func pdbMatches(pdb *policyv1.PodDisruptionBudget, pod *corev1.Pod) bool {
+	if pdb.Namespace != pod.Namespace || pdb.Spec.Selector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+	if err != nil || selector.Empty() {
+		return false
+	}
+	return selector.Matches(labels.Set(pod.Labels))
+}
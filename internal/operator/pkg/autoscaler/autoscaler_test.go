@@ -0,0 +1,131 @@
+package autoscaler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		raw           string
+		wantHealth    string
+		wantScaleUp   string
+		wantScaleDown string
+	}{
+		{
+			name: "text",
+			raw: `Cluster-autoscaler status at 2024-01-10 08:15:02.123456789 +0000 UTC:
+Cluster-wide:
+  Health:      Healthy (ready=3 unready=0 notStarted=0 longNotStarted=0 registered=3 longUnregistered=0)
+  ScaleUp:     InProgress (ready=3 registered=3)
+  ScaleDown:   NoCandidates (candidates=0)
+
+NodeGroups:
+  Name:        pool-a
+  Health:      Unhealthy (ready=1)
+  ScaleUp:     Backoff (ready=1 cloudProviderTarget=2)
+  ScaleDown:   CandidatesPresent (candidates=1)`,
+			wantHealth:    "Healthy",
+			wantScaleUp:   "InProgress",
+			wantScaleDown: "NoCandidates",
+		},
+		{
+			name: "yaml",
+			raw: `time: 2024-01-10T08:15:02Z
+autoscalerStatus: Running
+clusterWide:
+  health:
+    status: Healthy
+  scaleUp:
+    status: Backoff
+  scaleDown:
+    status: CandidatesPresent
+nodeGroups:
+- name: pool-a
+  health:
+    status: Unhealthy`,
+			wantHealth:    "Healthy",
+			wantScaleUp:   "Backoff",
+			wantScaleDown: "CandidatesPresent",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			status := parseStatus(tt.raw)
+			if status.Health != tt.wantHealth || status.ScaleUp != tt.wantScaleUp || status.ScaleDown != tt.wantScaleDown {
+				t.Errorf("parseStatus() = %s/%s/%s, want %s/%s/%s", status.Health, status.ScaleUp, status.ScaleDown,
+					tt.wantHealth, tt.wantScaleUp, tt.wantScaleDown)
+			}
+			if status.UpdatedAt.IsZero() {
+				t.Error("parseStatus() did not read the status time")
+			}
+		})
+	}
+}
+
+func TestFindBlockers(t *testing.T) {
+	t.Parallel()
+
+	controller := true
+	owned := func(kind string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: "owner", Controller: &controller}}
+	}
+	pod := func(name, namespace string, owners []metav1.OwnerReference, annotations map[string]string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, OwnerReferences: owners, Annotations: annotations,
+				Labels: map[string]string{"app": name}},
+			Spec: corev1.PodSpec{NodeName: "node-1"},
+		}
+	}
+
+	withEmptyDir := pod("cache", "shop", owned("ReplicaSet"), nil)
+	withEmptyDir.Spec.Volumes = []corev1.Volume{{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+
+	pods := []corev1.Pod{
+		pod("bare", "shop", nil, nil),
+		pod("pinned", "shop", owned("ReplicaSet"), map[string]string{safeToEvictAnnotation: "false"}),
+		pod("allowed", "shop", nil, map[string]string{safeToEvictAnnotation: "true"}),
+		withEmptyDir,
+		pod("coredns", "kube-system", owned("ReplicaSet"), nil),
+		pod("agent", "kube-system", owned("DaemonSet"), nil),
+		pod("batch", "shop", owned("Job"), map[string]string{doNotDisruptAnnotation: "true"}),
+		pod("db", "shop", owned("StatefulSet"), nil),
+	}
+	pdbs := []policyv1.PodDisruptionBudget{{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+	}}
+	nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: map[string]string{scaleDownDisabledAnnotation: "true"}}}}
+
+	got := map[string]string{}
+	for _, blocker := range findBlockers(nodes, pods, pdbs, true, true) {
+		got[blocker.Name+"/"+blocker.Autoscaler] = blocker.Reason
+	}
+	want := map[string]string{
+		"node-1/" + ClusterAutoscaler:  BlockerScaleDownDisabled,
+		"bare/" + ClusterAutoscaler:    BlockerNoController,
+		"pinned/" + ClusterAutoscaler:  BlockerNotSafeToEvict,
+		"cache/" + ClusterAutoscaler:   BlockerLocalStorage,
+		"coredns/" + ClusterAutoscaler: BlockerSystemPodNoPDB,
+		"batch/" + Karpenter:           BlockerDoNotDisrupt,
+		"db/":                          BlockerPDBExhausted,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findBlockers() = %v, want %v", got, want)
+	}
+	for key, reason := range want {
+		if got[key] != reason {
+			t.Errorf("findBlockers()[%s] = %q, want %q", key, got[key], reason)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// karpenterVersions are the karpenter.sh API versions serving NodePools and NodeClaims, newest first
+var karpenterVersions = []string{"v1", "v1beta1"}
+
+// KarpenterStatus lists the Karpenter NodePools and the NodeClaims they launched
+type KarpenterStatus struct {
+	APIVersion string      `json:"apiVersion"`
+	NodePools  []NodePool  `json:"nodePools"`
+	NodeClaims []NodeClaim `json:"nodeClaims"`
+}
+
+// NodePool is a Karpenter NodePool with its resource usage against its limits
+type NodePool struct {
+	Name                string            `json:"name"`
+	Weight              int64             `json:"weight,omitempty"`
+	Limits              map[string]string `json:"limits,omitempty"`
+	Resources           map[string]string `json:"resources,omitempty"`
+	ConsolidationPolicy string            `json:"consolidationPolicy,omitempty"`
+	NodeClaims          int               `json:"nodeClaims"`
+	Ready               bool              `json:"ready"`
+	Conditions          []Condition       `json:"conditions"`
+}
+
+// NodeClaim is a node Karpenter launched or is launching
+type NodeClaim struct {
+	Name         string      `json:"name"`
+	NodePool     string      `json:"nodePool"`
+	NodeName     string      `json:"nodeName,omitempty"`
+	InstanceType string      `json:"instanceType,omitempty"`
+	CapacityType string      `json:"capacityType,omitempty"`
+	Zone         string      `json:"zone,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	Ready        bool        `json:"ready"`
+	Conditions   []Condition `json:"conditions"`
+}
+
+// Condition is a status condition of a Karpenter resource
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// karpenterVersion returns the karpenter.sh version serving NodePools, false without Karpenter
+func karpenterVersion(ctx context.Context, client dynamic.Interface) (string, bool) {
+	for _, version := range karpenterVersions {
+		gvr := schema.GroupVersionResource{Group: "karpenter.sh", Version: version, Resource: "nodepools"}
+		if _, err := client.Resource(gvr).List(ctx, metav1.ListOptions{Limit: 1}); err == nil {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// karpenterStatus lists the NodePools and NodeClaims of the installed Karpenter version
+func karpenterStatus(ctx context.Context, client dynamic.Interface) (*KarpenterStatus, error) {
+	version, ok := karpenterVersion(ctx, client)
+	if !ok {
+		return nil, fmt.Errorf("karpenter NodePools are not served")
+	}
+
+	pools, err := client.Resource(schema.GroupVersionResource{Group: "karpenter.sh", Version: version, Resource: "nodepools"}).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodepools: %v", err)
+	}
+	claims, err := client.Resource(schema.GroupVersionResource{Group: "karpenter.sh", Version: version, Resource: "nodeclaims"}).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodeclaims: %v", err)
+	}
+
+	status := &KarpenterStatus{
+		APIVersion: "karpenter.sh/" + version,
+		NodePools:  []NodePool{},
+		NodeClaims: []NodeClaim{},
+	}
+	claimsPerPool := map[string]int{}
+	for _, item := range claims.Items {
+		claim := nodeClaimOf(item)
+		claimsPerPool[claim.NodePool]++
+		status.NodeClaims = append(status.NodeClaims, claim)
+	}
+	for _, item := range pools.Items {
+		pool := nodePoolOf(item)
+		pool.NodeClaims = claimsPerPool[pool.Name]
+		status.NodePools = append(status.NodePools, pool)
+	}
+
+	sort.Slice(status.NodePools, func(i, j int) bool { return status.NodePools[i].Name < status.NodePools[j].Name })
+	// NodeClaims that are not ready first, they are the ones worth debugging
+	sort.SliceStable(status.NodeClaims, func(i, j int) bool {
+		a, b := status.NodeClaims[i], status.NodeClaims[j]
+		if a.Ready != b.Ready {
+			return !a.Ready
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	return status, nil
+}
+
+func nodePoolOf(item unstructured.Unstructured) NodePool {
+	pool := NodePool{Name: item.GetName()}
+	pool.Weight, _, _ = unstructured.NestedInt64(item.Object, "spec", "weight")
+	pool.Limits, _, _ = unstructured.NestedStringMap(item.Object, "spec", "limits")
+	pool.Resources, _, _ = unstructured.NestedStringMap(item.Object, "status", "resources")
+	pool.ConsolidationPolicy, _, _ = unstructured.NestedString(item.Object, "spec", "disruption", "consolidationPolicy")
+	pool.Conditions = conditionsOf(item)
+	pool.Ready = conditionTrue(pool.Conditions, "Ready")
+	return pool
+}
+
+func nodeClaimOf(item unstructured.Unstructured) NodeClaim {
+	labels := item.GetLabels()
+	claim := NodeClaim{
+		Name:         item.GetName(),
+		NodePool:     labels["karpenter.sh/nodepool"],
+		InstanceType: labels["node.kubernetes.io/instance-type"],
+		CapacityType: labels["karpenter.sh/capacity-type"],
+		Zone:         labels["topology.kubernetes.io/zone"],
+		CreatedAt:    item.GetCreationTimestamp().Time,
+	}
+	claim.NodeName, _, _ = unstructured.NestedString(item.Object, "status", "nodeName")
+	claim.Conditions = conditionsOf(item)
+	claim.Ready = conditionTrue(claim.Conditions, "Ready")
+	return claim
+}
+
+func conditionsOf(item unstructured.Unstructured) []Condition {
+	conditions := []Condition{}
+	list, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, entry := range list {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condition := Condition{}
+		condition.Type, _ = fields["type"].(string)
+		condition.Status, _ = fields["status"].(string)
+		condition.Reason, _ = fields["reason"].(string)
+		condition.Message, _ = fields["message"].(string)
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+func conditionTrue(conditions []Condition, conditionType string) bool {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
@@ -0,0 +1,454 @@
+package breakglass
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	grantsFileName = "break-glass-grants.json"
+
+	// TokenHeader carries one or more comma separated break-glass tokens
+	TokenHeader = "X-Agentkube-Break-Glass"
+
+	// DefaultDuration is how long a grant lasts when no duration is requested
+	DefaultDuration = time.Hour
+	// MaxDuration caps how long a grant may last
+	MaxDuration = 4 * time.Hour
+
+	tokenPrefix    = "bg_"
+	expiryInterval = 30 * time.Second
+)
+
+// Grant statuses
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusRevoked = "revoked"
+)
+
+// Restrictions a grant lifts. Approvals are only lifted once a different user confirmed the grant.
+const (
+	RestrictionReadOnly = "read-only"
+	RestrictionApproval = "approval"
+)
+
+// ErrTokenInvalid is returned for tokens that do not grant access to a cluster
+var ErrTokenInvalid = errors.New("break-glass token is not valid for this cluster")
+
+// Grant is a short-lived elevation of a user on a single cluster
+type Grant struct {
+	ID         string     `json:"id"`
+	Cluster    string     `json:"cluster"`
+	User       string     `json:"user"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedBy  string     `json:"revokedBy,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Uses       int        `json:"uses"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// ConfirmedBy is the second user who confirmed the grant, which lets it bypass approvals
+	ConfirmedBy string     `json:"confirmedBy,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// storedGrant keeps the token hash next to the grant, the token itself is never stored
+type storedGrant struct {
+	Grant
+	TokenHash string `json:"tokenHash"`
+}
+
+// Filter narrows down a grants listing, empty fields match everything
+type Filter struct {
+	Cluster string
+	Status  string
+	User    string
+}
+
+func (f Filter) matches(g Grant) bool {
+	return (f.Cluster == "" || g.Cluster == f.Cluster) &&
+		(f.Status == "" || g.Status == f.Status) &&
+		(f.User == "" || g.User == f.User)
+}
+
+// Manager issues break-glass grants and checks their tokens
+type Manager struct {
+	grantsPath   string
+	mutex        sync.Mutex
+	notifier     dispatchers.Dispatcher
+	notifierOnce sync.Once
+	stopChan     chan struct{}
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared break-glass manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = &Manager{
+			grantsPath: filepath.Join(utils.ConfigDir(), grantsFileName),
+			stopChan:   make(chan struct{}),
+		}
+	})
+	return globalManager
+}
+
+// Issue grants a user elevated access to a cluster and returns the grant with its token. The token
+// is only returned here, grants are looked up by its hash afterwards.
+func (m *Manager) Issue(cluster, user, reason string, duration time.Duration) (*Grant, string, error) {
+	reason = strings.TrimSpace(reason)
+	switch {
+	case cluster == "":
+		return nil, "", fmt.Errorf("cluster is required")
+	case user == "":
+		return nil, "", fmt.Errorf("break-glass access requires an identified user")
+	case reason == "":
+		return nil, "", fmt.Errorf("reason is required")
+	case duration <= 0 || duration > MaxDuration:
+		return nil, "", fmt.Errorf("duration must be between 1 minute and %s", MaxDuration)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mutex.Lock()
+	grants, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, "", err
+	}
+	now := time.Now()
+	grant := storedGrant{
+		Grant: Grant{
+			ID:        uuid.New().String(),
+			Cluster:   cluster,
+			User:      user,
+			Reason:    reason,
+			Status:    StatusActive,
+			CreatedAt: now,
+			ExpiresAt: now.Add(duration),
+		},
+		TokenHash: hashToken(token),
+	}
+	err = m.save(append(grants, grant))
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger.Log(logger.LevelWarn, map[string]string{
+		"grant":     grant.ID,
+		"cluster":   cluster,
+		"user":      user,
+		"expiresAt": grant.ExpiresAt.Format(time.RFC3339),
+	}, nil, "Break-glass access issued")
+	m.notify(&grant.Grant, "Issued")
+	return &grant.Grant, token, nil
+}
+
+// Use checks that a token grants access to a cluster and records the use. The restriction and
+// detail describe what was lifted, for the audit log.
+func (m *Manager) Use(token, cluster, restriction, detail string) (*Grant, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, ErrTokenInvalid
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	grants, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	hash := hashToken(token)
+	now := time.Now()
+	for i := range grants {
+		grant := &grants[i]
+		if grant.TokenHash != hash {
+			continue
+		}
+		if grant.Cluster != cluster || grant.Status != StatusActive || !now.Before(grant.ExpiresAt) {
+			return nil, ErrTokenInvalid
+		}
+		if restriction == RestrictionApproval && grant.ConfirmedBy == "" {
+			return nil, ErrTokenInvalid
+		}
+
+		grant.Uses++
+		grant.LastUsedAt = &now
+		if err := m.save(grants); err != nil {
+			return nil, err
+		}
+
+		logger.Log(logger.LevelWarn, map[string]string{
+			"grant":       grant.ID,
+			"cluster":     cluster,
+			"user":        grant.User,
+			"restriction": restriction,
+			"detail":      detail,
+		}, nil, "Break-glass access used")
+		result := grant.Grant
+		return &result, nil
+	}
+	return nil, ErrTokenInvalid
+}
+
+// Confirm records a second user vouching for an active grant, letting it bypass approvals. The
+// user who was granted access cannot confirm their own grant.
+func (m *Manager) Confirm(id, user string) (*Grant, error) {
+	if user == "" {
+		return nil, fmt.Errorf("confirming break-glass access requires an identified user")
+	}
+
+	m.mutex.Lock()
+	grants, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+	grant := findGrant(grants, id)
+	now := time.Now()
+	switch {
+	case grant == nil:
+		err = fmt.Errorf("grant %s not found", id)
+	case grant.Status != StatusActive || !now.Before(grant.ExpiresAt):
+		err = fmt.Errorf("grant %s is not active", id)
+	case grant.User == user:
+		err = fmt.Errorf("grant %s must be confirmed by a different user", id)
+	case grant.ConfirmedBy != "":
+		err = fmt.Errorf("grant %s is already confirmed", id)
+	}
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+
+	grant.ConfirmedBy = user
+	grant.ConfirmedAt = &now
+	err = m.save(grants)
+	result := grant.Grant
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log(logger.LevelWarn, map[string]string{
+		"grant":       id,
+		"cluster":     result.Cluster,
+		"user":        result.User,
+		"confirmedBy": user,
+	}, nil, "Break-glass access confirmed")
+	m.notify(&result, "Confirmed")
+	return &result, nil
+}
+
+// Revoke ends a grant before it expires
+func (m *Manager) Revoke(id, user string) (*Grant, error) {
+	m.mutex.Lock()
+	grants, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+	grant := findGrant(grants, id)
+	if grant == nil {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("grant %s not found", id)
+	}
+	if grant.Status != StatusActive {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("grant %s is %s", id, grant.Status)
+	}
+
+	now := time.Now()
+	grant.Status = StatusRevoked
+	grant.RevokedBy = actorName(user)
+	grant.RevokedAt = &now
+	err = m.save(grants)
+	result := grant.Grant
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"grant":     id,
+		"cluster":   result.Cluster,
+		"revokedBy": result.RevokedBy,
+	}, nil, "Break-glass access revoked")
+	m.notify(&result, "Revoked")
+	return &result, nil
+}
+
+// List returns the grants matching the filter, newest first
+func (m *Manager) List(filter Filter) ([]Grant, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	grants, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Grant{}
+	for _, grant := range grants {
+		if filter.matches(grant.Grant) {
+			result = append(result, grant.Grant)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// Get returns a single grant
+func (m *Manager) Get(id string) (*Grant, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	grants, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	if grant := findGrant(grants, id); grant != nil {
+		result := grant.Grant
+		return &result, nil
+	}
+	return nil, fmt.Errorf("grant %s not found", id)
+}
+
+// Start runs the expiry loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+
+		m.ExpireStale()
+		for {
+			select {
+			case <-ticker.C:
+				m.ExpireStale()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the expiry loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// ExpireStale marks active grants past their expiry as expired. Tokens stop working at expiry
+// regardless, this records and announces it.
+func (m *Manager) ExpireStale() {
+	m.mutex.Lock()
+	grants, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		logger.Log(logger.LevelError, nil, err, "Failed to load break-glass grants")
+		return
+	}
+
+	now := time.Now()
+	var expired []Grant
+	for i := range grants {
+		if grants[i].Status == StatusActive && !now.Before(grants[i].ExpiresAt) {
+			grants[i].Status = StatusExpired
+			expired = append(expired, grants[i].Grant)
+		}
+	}
+	if len(expired) > 0 {
+		err = m.save(grants)
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to save break-glass grants")
+		return
+	}
+	for i := range expired {
+		m.notify(&expired[i], "Expired")
+	}
+}
+
+// notify sends a break-glass event through the dispatcher configured for the watcher
+func (m *Manager) notify(grant *Grant, reason string) {
+	m.notifierOnce.Do(func() {
+		m.notifier = client.NewNotifier("break-glass")
+	})
+
+	e := event.Event{
+		Kind:   "break-glass",
+		Host:   grant.Cluster,
+		Name:   grant.User,
+		Reason: reason,
+		Status: fmt.Sprintf("%s (until %s)", grant.Reason, grant.ExpiresAt.Format(time.RFC3339)),
+	}
+	go m.notifier.Handle(e)
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	return tokenPrefix + hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func findGrant(grants []storedGrant, id string) *storedGrant {
+	for i := range grants {
+		if grants[i].ID == id {
+			return &grants[i]
+		}
+	}
+	return nil
+}
+
+func actorName(identity string) string {
+	if identity == "" {
+		return "anonymous"
+	}
+	return identity
+}
+
+func (m *Manager) load() ([]storedGrant, error) {
+	var grants []storedGrant
+	if err := utils.ReadJSONFile(m.grantsPath, &grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (m *Manager) save(grants []storedGrant) error {
+	return utils.WriteJSONFile(m.grantsPath, grants)
+}
@@ -0,0 +1,132 @@
+package breakglass
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/dispatchers"
+)
+
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+
+	m := &Manager{
+		grantsPath: filepath.Join(t.TempDir(), grantsFileName),
+		stopChan:   make(chan struct{}),
+	}
+	m.notifierOnce.Do(func() { m.notifier = &dispatchers.Default{} })
+	return m
+}
+
+func TestIssue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cluster  string
+		user     string
+		reason   string
+		duration time.Duration
+		wantErr  bool
+	}{
+		{name: "valid", cluster: "prod", user: "token:a", reason: "incident", duration: time.Hour},
+		{name: "missing cluster", user: "token:a", reason: "incident", duration: time.Hour, wantErr: true},
+		{name: "anonymous", cluster: "prod", reason: "incident", duration: time.Hour, wantErr: true},
+		{name: "blank reason", cluster: "prod", user: "token:a", reason: "  ", duration: time.Hour, wantErr: true},
+		{name: "too long", cluster: "prod", user: "token:a", reason: "incident", duration: MaxDuration + time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			grant, token, err := testManager(t).Issue(tt.cluster, tt.user, tt.reason, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Issue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (grant.Status != StatusActive || len(token) <= len(tokenPrefix)) {
+				t.Errorf("Issue() = %+v, %q, want an active grant and a token", grant, token)
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	grant, token, err := m.Issue("prod", "token:a", "incident", time.Hour)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	if _, err := m.Use(token, "prod", RestrictionReadOnly, "DELETE /pods"); err != nil {
+		t.Errorf("Use() on its cluster error = %v", err)
+	}
+	if _, err := m.Use(token, "staging", RestrictionReadOnly, "DELETE /pods"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Use() on another cluster error = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := m.Use("bg_unknown", "prod", RestrictionReadOnly, "DELETE /pods"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Use() with an unknown token error = %v, want ErrTokenInvalid", err)
+	}
+
+	// Approvals are only lifted once another user confirmed the grant
+	if _, err := m.Use(token, "prod", RestrictionApproval, "drain"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Use() of an unconfirmed grant for approvals error = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := m.Confirm(grant.ID, "token:a"); err == nil {
+		t.Error("Confirm() by the granted user should fail")
+	}
+	if _, err := m.Confirm(grant.ID, "token:b"); err != nil {
+		t.Fatalf("Confirm() by another user error = %v", err)
+	}
+	used, err := m.Use(token, "prod", RestrictionApproval, "drain")
+	if err != nil {
+		t.Fatalf("Use() of a confirmed grant for approvals error = %v", err)
+	}
+	if used.Uses != 2 || used.ConfirmedBy != "token:b" {
+		t.Errorf("Use() = %+v, want 2 uses confirmed by token:b", used)
+	}
+
+	if _, err := m.Revoke(grant.ID, "token:b"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := m.Use(token, "prod", RestrictionReadOnly, "DELETE /pods"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Use() of a revoked grant error = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	grant, token, err := m.Issue("prod", "token:a", "incident", time.Minute)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	grants, err := m.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	grants[0].ExpiresAt = time.Now().Add(-time.Second)
+	if err := m.save(grants); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	if _, err := m.Use(token, "prod", RestrictionReadOnly, "DELETE /pods"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Use() past expiry error = %v, want ErrTokenInvalid", err)
+	}
+
+	m.ExpireStale()
+	expired, err := m.Get(grant.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if expired.Status != StatusExpired {
+		t.Errorf("status after ExpireStale() = %q, want %q", expired.Status, StatusExpired)
+	}
+}
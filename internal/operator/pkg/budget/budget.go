@@ -0,0 +1,414 @@
+// Package budget accounts the API traffic, memory and goroutines the operator spends on each cluster,
+// from its watchers, multiplexer connections and background scans, and pauses the background work of
+// clusters going over their budget until they are back within it.
+package budget
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "budgets.json"
+
+	// checkInterval is how often usage is compared with the budgets
+	checkInterval = 30 * time.Second
+	// minPause keeps clusters paused for a while, so a cluster whose usage drops because it was paused
+	// doesn't resume at the next check
+	minPause = 5 * time.Minute
+)
+
+// Limits cap the usage of a cluster, zero leaves a resource unlimited
+type Limits struct {
+	RequestsPerMinute int   `json:"requestsPerMinute"`
+	BytesPerMinute    int64 `json:"bytesPerMinute"`
+	MemoryBytes       int64 `json:"memoryBytes"`
+	Goroutines        int   `json:"goroutines"`
+}
+
+// Settings configure the budgets of the clusters
+type Settings struct {
+	// Enforce pauses the background work of clusters over budget, usage is accounted either way
+	Enforce bool   `json:"enforce"`
+	Default Limits `json:"default"`
+	// Clusters overrides the default limits per context
+	Clusters map[string]Limits `json:"clusters"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Default: Limits{
+			RequestsPerMinute: 1200,
+			BytesPerMinute:    256 << 20,
+			MemoryBytes:       512 << 20,
+			Goroutines:        500,
+		},
+		Clusters: map[string]Limits{},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if err := s.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for cluster, limits := range s.Clusters {
+		if err := limits.validate(); err != nil {
+			return fmt.Errorf("cluster %s: %w", cluster, err)
+		}
+	}
+	return nil
+}
+
+func (l Limits) validate() error {
+	if l.RequestsPerMinute < 0 || l.BytesPerMinute < 0 || l.MemoryBytes < 0 || l.Goroutines < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// limitsOf returns the limits of a cluster
+func (s Settings) limitsOf(cluster string) Limits {
+	if limits, ok := s.Clusters[cluster]; ok {
+		return limits
+	}
+	return s.Default
+}
+
+// Gauge is the current footprint of a component of the operator on a cluster
+type Gauge struct {
+	Goroutines  int   `json:"goroutines"`
+	MemoryBytes int64 `json:"memoryBytes"`
+	Objects     int   `json:"objects,omitempty"`
+	Connections int   `json:"connections,omitempty"`
+}
+
+// Source reports the footprint of a component on each cluster it works on
+type Source func() map[string]Gauge
+
+// Usage is what the operator spends on a cluster, against its limits
+type Usage struct {
+	Cluster           string           `json:"cluster"`
+	RequestsPerMinute int              `json:"requestsPerMinute"`
+	BytesPerMinute    int64            `json:"bytesPerMinute"`
+	ErrorsPerMinute   int              `json:"errorsPerMinute"`
+	MemoryBytes       int64            `json:"memoryBytes"`
+	Goroutines        int              `json:"goroutines"`
+	Components        map[string]Gauge `json:"components"`
+	Limits            Limits           `json:"limits"`
+	// Exceeded lists the limits the usage is over
+	Exceeded    []string   `json:"exceeded,omitempty"`
+	Paused      bool       `json:"paused"`
+	PausedSince *time.Time `json:"pausedSince,omitempty"`
+}
+
+// over returns the limits a usage is over
+func (u Usage) over(limits Limits) []string {
+	exceeded := []string{}
+	if limits.RequestsPerMinute > 0 && u.RequestsPerMinute > limits.RequestsPerMinute {
+		exceeded = append(exceeded, "requestsPerMinute")
+	}
+	if limits.BytesPerMinute > 0 && u.BytesPerMinute > limits.BytesPerMinute {
+		exceeded = append(exceeded, "bytesPerMinute")
+	}
+	if limits.MemoryBytes > 0 && u.MemoryBytes > limits.MemoryBytes {
+		exceeded = append(exceeded, "memoryBytes")
+	}
+	if limits.Goroutines > 0 && u.Goroutines > limits.Goroutines {
+		exceeded = append(exceeded, "goroutines")
+	}
+	return exceeded
+}
+
+// Manager accounts the usage of the clusters and pauses the ones over budget
+type Manager struct {
+	settingsPath string
+	mutex        sync.Mutex
+	traffic      map[string]*traffic
+	// tasks counts the running background tasks per cluster and component
+	tasks    map[string]map[string]int
+	sources  map[string]Source
+	paused   map[string]time.Time
+	stopChan chan struct{}
+}
+
+var (
+	manager     *Manager
+	managerOnce sync.Once
+)
+
+// GetManager returns the budget manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		manager = &Manager{
+			settingsPath: filepath.Join(utils.ConfigDir(), settingsFileName),
+			traffic:      map[string]*traffic{},
+			tasks:        map[string]map[string]int{},
+			sources:      map[string]Source{},
+			paused:       map[string]time.Time{},
+			stopChan:     make(chan struct{}),
+		}
+	})
+	return manager
+}
+
+// Settings returns the current budget settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new budget settings, applied at the next check
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = map[string]Limits{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start compares usage with the budgets until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.check(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the check loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// RegisterSource adds a component reporting its footprint per cluster, replacing the source
+// registered before under the same name
+func (m *Manager) RegisterSource(component string, source Source) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sources[component] = source
+}
+
+// Track counts a background task of a component on a cluster until the returned function is called
+func (m *Manager) Track(cluster, component string) func() {
+	m.mutex.Lock()
+	if m.tasks[cluster] == nil {
+		m.tasks[cluster] = map[string]int{}
+	}
+	m.tasks[cluster][component]++
+	m.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			m.tasks[cluster][component]--
+			if m.tasks[cluster][component] <= 0 {
+				delete(m.tasks[cluster], component)
+			}
+			if len(m.tasks[cluster]) == 0 {
+				delete(m.tasks, cluster)
+			}
+		})
+	}
+}
+
+// Paused reports whether the background work of a cluster is paused for going over its budget
+func (m *Manager) Paused(cluster string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, paused := m.paused[cluster]
+	return paused
+}
+
+// Usage returns the usage of every cluster the operator spends resources on, sorted by cluster
+func (m *Manager) Usage() ([]Usage, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	return m.usage(time.Now(), settings), nil
+}
+
+func (m *Manager) usage(now time.Time, settings Settings) []Usage {
+	// Sources are called without the lock, they take the locks of their components
+	m.mutex.Lock()
+	sources := make(map[string]Source, len(m.sources))
+	for component, source := range m.sources {
+		sources[component] = source
+	}
+	m.mutex.Unlock()
+
+	gauges := map[string]map[string]Gauge{}
+	for component, source := range sources {
+		for cluster, gauge := range source() {
+			if gauges[cluster] == nil {
+				gauges[cluster] = map[string]Gauge{}
+			}
+			gauges[cluster][component] = gauge
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for cluster, components := range m.tasks {
+		for component, count := range components {
+			if gauges[cluster] == nil {
+				gauges[cluster] = map[string]Gauge{}
+			}
+			gauge := gauges[cluster][component]
+			gauge.Goroutines += count
+			gauges[cluster][component] = gauge
+		}
+	}
+	for cluster := range m.traffic {
+		if gauges[cluster] == nil {
+			gauges[cluster] = map[string]Gauge{}
+		}
+	}
+
+	usages := make([]Usage, 0, len(gauges))
+	for cluster, components := range gauges {
+		usage := Usage{
+			Cluster:    cluster,
+			Components: components,
+			Limits:     settings.limitsOf(cluster),
+		}
+		if t, ok := m.traffic[cluster]; ok {
+			usage.RequestsPerMinute, usage.BytesPerMinute, usage.ErrorsPerMinute = t.sum(now)
+		}
+		for _, gauge := range components {
+			usage.Goroutines += gauge.Goroutines
+			usage.MemoryBytes += gauge.MemoryBytes
+		}
+		usage.Exceeded = usage.over(usage.Limits)
+		if since, ok := m.paused[cluster]; ok {
+			pausedSince := since
+			usage.Paused = true
+			usage.PausedSince = &pausedSince
+		}
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Cluster < usages[j].Cluster
+	})
+	return usages
+}
+
+// check pauses the clusters over budget and resumes the ones back within it
+func (m *Manager) check(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to read resource budgets")
+		return
+	}
+	usages := m.usage(now, settings)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	exceeded := map[string][]string{}
+	for _, usage := range usages {
+		if len(usage.Exceeded) > 0 {
+			exceeded[usage.Cluster] = usage.Exceeded
+		}
+	}
+
+	if settings.Enforce {
+		for cluster, limits := range exceeded {
+			if _, paused := m.paused[cluster]; !paused {
+				m.paused[cluster] = now
+				logger.Log(logger.LevelWarn, map[string]string{
+					"cluster":  cluster,
+					"exceeded": strings.Join(limits, ","),
+				}, nil, "Pausing background work of cluster over its resource budget")
+			}
+		}
+	}
+	for cluster, since := range m.paused {
+		if !settings.Enforce || (exceeded[cluster] == nil && now.Sub(since) >= minPause) {
+			delete(m.paused, cluster)
+			logger.Log(logger.LevelInfo, map[string]string{"cluster": cluster}, nil, "Resuming background work of cluster")
+		}
+	}
+
+	// Forget the traffic of clusters that went quiet
+	for cluster, t := range m.traffic {
+		if requests, bytes, _ := t.sum(now); requests == 0 && bytes == 0 {
+			delete(m.traffic, cluster)
+		}
+	}
+}
+
+// record accounts a request sent to a cluster
+func (m *Manager) record(cluster string, now time.Time, bytes int64, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.traffic[cluster]
+	if !ok {
+		t = &traffic{}
+		m.traffic[cluster] = t
+	}
+	t.add(now, bytes, failed)
+}
+
+// recordBytes accounts response bytes read after a request was recorded
+func (m *Manager) recordBytes(cluster string, now time.Time, bytes int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t, ok := m.traffic[cluster]
+	if !ok {
+		t = &traffic{}
+		m.traffic[cluster] = t
+	}
+	t.addBytes(now, bytes)
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// Paused reports whether the background work of a cluster is paused for going over its budget
+func Paused(cluster string) bool {
+	return GetManager().Paused(cluster)
+}
+
+// Track counts a background task of a component on a cluster until the returned function is called
+func Track(cluster, component string) func() {
+	return GetManager().Track(cluster, component)
+}
+
+// RegisterSource adds a component reporting its footprint per cluster
+func RegisterSource(component string, source Source) {
+	GetManager().RegisterSource(component, source)
+}
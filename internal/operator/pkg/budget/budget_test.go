@@ -0,0 +1,93 @@
+package budget
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrafficSum(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var tr traffic
+	tr.add(start, 100, false)
+	tr.add(start.Add(15*time.Second), 50, true)
+	tr.addBytes(start.Add(45*time.Second), 1000)
+
+	tests := []struct {
+		name         string
+		at           time.Time
+		wantRequests int
+		wantBytes    int64
+		wantErrors   int
+	}{
+		{name: "within the minute", at: start.Add(50 * time.Second), wantRequests: 2, wantBytes: 1150, wantErrors: 1},
+		{name: "first bucket expired", at: start.Add(65 * time.Second), wantRequests: 1, wantBytes: 1050, wantErrors: 1},
+		{name: "all expired", at: start.Add(3 * time.Minute), wantRequests: 0, wantBytes: 0, wantErrors: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			requests, bytes, errors := tr.sum(tt.at)
+			if requests != tt.wantRequests || bytes != tt.wantBytes || errors != tt.wantErrors {
+				t.Errorf("sum = %d, %d, %d, want %d, %d, %d", requests, bytes, errors, tt.wantRequests, tt.wantBytes, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestCheckPausesAndResumes(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{
+		settingsPath: filepath.Join(t.TempDir(), settingsFileName),
+		traffic:      map[string]*traffic{},
+		tasks:        map[string]map[string]int{},
+		sources:      map[string]Source{},
+		paused:       map[string]time.Time{},
+	}
+	settings := DefaultSettings()
+	settings.Enforce = true
+	settings.Clusters["busy"] = Limits{Goroutines: 2}
+	if err := m.UpdateSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	goroutines := 3
+	m.RegisterSource("watchers", func() map[string]Gauge {
+		return map[string]Gauge{
+			"busy":  {Goroutines: goroutines},
+			"quiet": {Goroutines: goroutines},
+		}
+	})
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.check(now)
+	if !m.Paused("busy") {
+		t.Error("cluster over its budget was not paused")
+	}
+	if m.Paused("quiet") {
+		t.Error("cluster within the default budget was paused")
+	}
+
+	goroutines = 1
+	m.check(now.Add(time.Minute))
+	if !m.Paused("busy") {
+		t.Error("cluster resumed before the minimum pause")
+	}
+	m.check(now.Add(minPause))
+	if m.Paused("busy") {
+		t.Error("cluster back within its budget was not resumed")
+	}
+
+	done := m.Track("busy", "scan")
+	done()
+	done()
+	if len(m.tasks) != 0 {
+		t.Errorf("tasks = %v, want none after the task finished", m.tasks)
+	}
+}
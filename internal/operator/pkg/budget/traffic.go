@@ -0,0 +1,111 @@
+package budget
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// bucketWidth and bucketCount rate API traffic over the last minute
+	bucketWidth = 10 * time.Second
+	bucketCount = 6
+)
+
+// traffic counts the requests sent to a cluster in buckets covering the last minute
+type traffic struct {
+	buckets [bucketCount]bucket
+}
+
+type bucket struct {
+	start    time.Time
+	requests int
+	bytes    int64
+	errors   int
+}
+
+// at returns the bucket of a point in time, emptied when it last held an older period
+func (t *traffic) at(now time.Time) *bucket {
+	start := now.Truncate(bucketWidth)
+	b := &t.buckets[(start.UnixNano()/int64(bucketWidth))%bucketCount]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+func (t *traffic) add(now time.Time, bytes int64, failed bool) {
+	b := t.at(now)
+	b.requests++
+	b.bytes += bytes
+	if failed {
+		b.errors++
+	}
+}
+
+func (t *traffic) addBytes(now time.Time, bytes int64) {
+	t.at(now).bytes += bytes
+}
+
+// sum returns the requests, bytes and errors of the last minute
+func (t *traffic) sum(now time.Time) (int, int64, int) {
+	oldest := now.Truncate(bucketWidth).Add(-(bucketCount - 1) * bucketWidth)
+	requests, bytes, errors := 0, int64(0), 0
+	for _, b := range t.buckets {
+		if b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		requests += b.requests
+		bytes += b.bytes
+		errors += b.errors
+	}
+	return requests, bytes, errors
+}
+
+// Wrap is the kubeconfig transport hook accounting the requests sent to each cluster and the
+// bytes of their responses
+func Wrap(contextName string, rt http.RoundTripper) http.RoundTripper {
+	return &accountingRoundTripper{manager: GetManager(), cluster: contextName, next: rt}
+}
+
+type accountingRoundTripper struct {
+	manager *Manager
+	cluster string
+	next    http.RoundTripper
+}
+
+func (t *accountingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var sent int64
+	if req.ContentLength > 0 {
+		sent = req.ContentLength
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.manager.record(t.cluster, time.Now(), sent, true)
+		return nil, err
+	}
+	failed := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+	t.manager.record(t.cluster, time.Now(), sent, failed)
+
+	if resp.Body != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, manager: t.manager, cluster: t.cluster}
+	}
+	return resp, nil
+}
+
+// countingBody accounts the bytes of a response as they are read, so long running watches count
+// in the minute their events arrive
+type countingBody struct {
+	io.ReadCloser
+	manager *Manager
+	cluster string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.manager.recordBytes(b.cluster, time.Now(), int64(n))
+	}
+	return n, err
+}
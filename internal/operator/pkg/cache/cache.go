@@ -16,6 +16,8 @@ type Cache[T any] interface {
 	Get(ctx context.Context, key string) (T, error)
 	GetAll(ctx context.Context, selectFunc func(key string) bool) (map[string]T, error)
 	UpdateTTL(ctx context.Context, key string, ttl time.Duration) error
+	// OnExpire registers a function called with the values removed once their TTL expired.
+	OnExpire(fn func(key string, value T))
 }
 
 var (
@@ -32,6 +34,7 @@ type cacheImpl[T any] struct {
 	store           map[string]cacheValue[T]
 	lock            sync.RWMutex
 	cleanUpInterval time.Duration
+	onExpire        []func(key string, value T)
 }
 
 // New creates a new cache.
@@ -125,15 +128,33 @@ func (c *cacheImpl[T]) cleanUp() {
 		<-ticker.C
 
 		c.lock.Lock()
+		expired := map[string]T{}
 		for key, value := range c.store {
 			if !value.expiresAt.IsZero() && value.expiresAt.Before(time.Now()) {
 				delete(c.store, key)
+				expired[key] = value.value
 			}
 		}
+		onExpire := c.onExpire
 		c.lock.Unlock()
+
+		// Called without the lock, so that they can use the cache
+		for key, value := range expired {
+			for _, fn := range onExpire {
+				fn(key, value)
+			}
+		}
 	}
 }
 
+// OnExpire registers a function called with the values removed once their TTL expired.
+func (c *cacheImpl[T]) OnExpire(fn func(key string, value T)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.onExpire = append(c.onExpire, fn)
+}
+
 // UpdateTTL updates the TTL of a value in the cache.
 func (c *cacheImpl[T]) UpdateTTL(ctx context.Context, key string, ttl time.Duration) error {
 	c.lock.Lock()
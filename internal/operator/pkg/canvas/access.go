@@ -0,0 +1,442 @@
+package canvas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// ErrInvalidAccessQuery is returned for access queries missing what they ask about
+var ErrInvalidAccessQuery = errors.New("invalid access query")
+
+var (
+	rolesGVR               = schema.GroupVersionResource{Group: rbacv1.GroupName, Version: "v1", Resource: "roles"}
+	clusterRolesGVR        = schema.GroupVersionResource{Group: rbacv1.GroupName, Version: "v1", Resource: "clusterroles"}
+	roleBindingsGVR        = schema.GroupVersionResource{Group: rbacv1.GroupName, Version: "v1", Resource: "rolebindings"}
+	clusterRoleBindingsGVR = schema.GroupVersionResource{Group: rbacv1.GroupName, Version: "v1", Resource: "clusterrolebindings"}
+)
+
+// AccessQuery asks who can make a request, the way the API server authorizes it with RBAC
+type AccessQuery struct {
+	Verb string `json:"verb"`
+	// Group is the API group of the resource, empty for the core group
+	Group       string `json:"group"`
+	Resource    string `json:"resource,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+	// Name narrows the request to an object, rules limited to other resourceNames don't allow it
+	Name string `json:"name,omitempty"`
+	// Namespace of the request. Cluster-wide requests are only allowed by ClusterRoleBindings.
+	Namespace string `json:"namespace,omitempty"`
+	// NonResourceURL asks about a path such as /metrics instead of a resource
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+}
+
+// AccessSubject is a user, group or service account
+type AccessSubject struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// AccessGrant is a binding and the role it grants
+type AccessGrant struct {
+	BindingKind string `json:"bindingKind"`
+	BindingName string `json:"bindingName"`
+	// Namespace of a RoleBinding, which grants its role in that namespace only
+	Namespace string `json:"namespace,omitempty"`
+	RoleKind  string `json:"roleKind"`
+	RoleName  string `json:"roleName"`
+}
+
+// SubjectAccess is a subject allowed a request, with the bindings allowing it
+type SubjectAccess struct {
+	AccessSubject
+	Grants []AccessGrant `json:"grants"`
+}
+
+// WhoCanResponse lists the subjects allowed a request
+type WhoCanResponse struct {
+	Query    AccessQuery     `json:"query"`
+	Subjects []SubjectAccess `json:"subjects"`
+	// Warnings name the bindings of roles that don't exist, which grant nothing
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PermissionRow is what a subject may do with a resource, or a non-resource URL, in a namespace.
+// Verbs are merged across the grants of the row.
+type PermissionRow struct {
+	// Namespace the row applies in, empty for every namespace
+	Namespace      string        `json:"namespace,omitempty"`
+	APIGroup       string        `json:"apiGroup"`
+	Resource       string        `json:"resource,omitempty"`
+	ResourceNames  []string      `json:"resourceNames,omitempty"`
+	NonResourceURL string        `json:"nonResourceURL,omitempty"`
+	Verbs          []string      `json:"verbs"`
+	Grants         []AccessGrant `json:"grants"`
+}
+
+// PermissionMatrix lists what a subject can do, a row per namespace, API group and resource
+type PermissionMatrix struct {
+	Subject AccessSubject `json:"subject"`
+	// Groups the subject is known to belong to, the bindings of which apply to it too
+	Groups []string        `json:"groups"`
+	Rows   []PermissionRow `json:"rows"`
+	// ClusterAdmin is true when the subject may do everything everywhere
+	ClusterAdmin bool     `json:"clusterAdmin"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// rbacBinding is a RoleBinding or ClusterRoleBinding
+type rbacBinding struct {
+	grant    AccessGrant
+	subjects []rbacv1.Subject
+}
+
+// rbacSnapshot holds the roles and bindings of a cluster
+type rbacSnapshot struct {
+	roles        map[string][]rbacv1.PolicyRule
+	clusterRoles map[string][]rbacv1.PolicyRule
+	bindings     []rbacBinding
+}
+
+// WhoCan returns the subjects allowed a request by the roles and bindings of the cluster
+func (c *Controller) WhoCan(ctx context.Context, query AccessQuery) (*WhoCanResponse, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := c.loadRBAC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.whoCan(query), nil
+}
+
+// SubjectPermissions returns what a subject may do. The groups of users aren't known to the
+// cluster and are taken from groups, service accounts belong to their well-known groups.
+func (c *Controller) SubjectPermissions(ctx context.Context, subject AccessSubject, groups []string) (*PermissionMatrix, error) {
+	switch subject.Kind {
+	case rbacv1.ServiceAccountKind:
+		if subject.Namespace == "" {
+			return nil, fmt.Errorf("%w: a service account needs a namespace", ErrInvalidAccessQuery)
+		}
+	case rbacv1.UserKind, rbacv1.GroupKind:
+	default:
+		return nil, fmt.Errorf("%w: kind must be ServiceAccount, User or Group", ErrInvalidAccessQuery)
+	}
+	if subject.Name == "" {
+		return nil, fmt.Errorf("%w: the subject needs a name", ErrInvalidAccessQuery)
+	}
+
+	snapshot, err := c.loadRBAC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.permissionsOf(subject, groups), nil
+}
+
+// normalize validates a query, splitting resources given as resource/subresource
+func (q AccessQuery) normalize() (AccessQuery, error) {
+	if q.Verb == "" {
+		return q, fmt.Errorf("%w: verb is required", ErrInvalidAccessQuery)
+	}
+	if q.NonResourceURL != "" {
+		if q.Resource != "" {
+			return q, fmt.Errorf("%w: give either a resource or a non-resource URL", ErrInvalidAccessQuery)
+		}
+		return q, nil
+	}
+	if q.Resource == "" {
+		return q, fmt.Errorf("%w: resource or nonResourceURL is required", ErrInvalidAccessQuery)
+	}
+	if resource, subresource, ok := strings.Cut(q.Resource, "/"); ok && q.Subresource == "" {
+		q.Resource, q.Subresource = resource, subresource
+	}
+	return q, nil
+}
+
+// loadRBAC lists the roles and bindings of every namespace
+func (c *Controller) loadRBAC(ctx context.Context) (*rbacSnapshot, error) {
+	client, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	return loadRBAC(ctx, client)
+}
+
+func loadRBAC(ctx context.Context, client dynamic.Interface) (*rbacSnapshot, error) {
+	s := &rbacSnapshot{roles: map[string][]rbacv1.PolicyRule{}, clusterRoles: map[string][]rbacv1.PolicyRule{}}
+
+	var roles rbacv1.RoleList
+	if err := listInto(ctx, client, rolesGVR, &roles); err != nil {
+		return nil, err
+	}
+	for _, role := range roles.Items {
+		s.roles[role.Namespace+"/"+role.Name] = role.Rules
+	}
+
+	var clusterRoles rbacv1.ClusterRoleList
+	if err := listInto(ctx, client, clusterRolesGVR, &clusterRoles); err != nil {
+		return nil, err
+	}
+	for _, role := range clusterRoles.Items {
+		s.clusterRoles[role.Name] = role.Rules
+	}
+
+	var roleBindings rbacv1.RoleBindingList
+	if err := listInto(ctx, client, roleBindingsGVR, &roleBindings); err != nil {
+		return nil, err
+	}
+	for _, rb := range roleBindings.Items {
+		s.bindings = append(s.bindings, rbacBinding{
+			grant:    AccessGrant{BindingKind: "RoleBinding", BindingName: rb.Name, Namespace: rb.Namespace, RoleKind: rb.RoleRef.Kind, RoleName: rb.RoleRef.Name},
+			subjects: rb.Subjects,
+		})
+	}
+
+	var clusterRoleBindings rbacv1.ClusterRoleBindingList
+	if err := listInto(ctx, client, clusterRoleBindingsGVR, &clusterRoleBindings); err != nil {
+		return nil, err
+	}
+	for _, crb := range clusterRoleBindings.Items {
+		s.bindings = append(s.bindings, rbacBinding{
+			grant:    AccessGrant{BindingKind: "ClusterRoleBinding", BindingName: crb.Name, RoleKind: crb.RoleRef.Kind, RoleName: crb.RoleRef.Name},
+			subjects: crb.Subjects,
+		})
+	}
+	return s, nil
+}
+
+// listInto lists a resource of every namespace into a typed list
+func listInto(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, into interface{}) error {
+	list, err := client.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %v", gvr.Resource, err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.UnstructuredContent(), into); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", gvr.Resource, err)
+	}
+	return nil
+}
+
+// rules returns the rules of the role a binding grants, false when the role doesn't exist
+func (s *rbacSnapshot) rules(b rbacBinding) ([]rbacv1.PolicyRule, bool) {
+	if b.grant.RoleKind == "Role" {
+		rules, ok := s.roles[b.grant.Namespace+"/"+b.grant.RoleName]
+		return rules, ok
+	}
+	rules, ok := s.clusterRoles[b.grant.RoleName]
+	return rules, ok
+}
+
+// missingRole describes a binding granting a role that doesn't exist
+func missingRole(b rbacBinding) string {
+	binding := b.grant.BindingName
+	if b.grant.Namespace != "" {
+		binding = b.grant.Namespace + "/" + binding
+	}
+	return fmt.Sprintf("%s %s grants %s %s, which does not exist", b.grant.BindingKind, binding, b.grant.RoleKind, b.grant.RoleName)
+}
+
+func (s *rbacSnapshot) whoCan(query AccessQuery) *WhoCanResponse {
+	response := &WhoCanResponse{Query: query, Subjects: []SubjectAccess{}}
+	index := map[AccessSubject]int{}
+	for _, b := range s.bindings {
+		// RoleBindings grant within their namespace, and never non-resource URLs
+		if b.grant.Namespace != "" && (b.grant.Namespace != query.Namespace || query.NonResourceURL != "") {
+			continue
+		}
+		rules, ok := s.rules(b)
+		if !ok {
+			response.Warnings = append(response.Warnings, missingRole(b))
+			continue
+		}
+		if !slices.ContainsFunc(rules, func(rule rbacv1.PolicyRule) bool { return ruleAllows(rule, query) }) {
+			continue
+		}
+
+		for _, subject := range b.subjects {
+			key := accessSubject(subject, b.grant.Namespace)
+			i, ok := index[key]
+			if !ok {
+				i = len(response.Subjects)
+				index[key] = i
+				response.Subjects = append(response.Subjects, SubjectAccess{AccessSubject: key})
+			}
+			response.Subjects[i].Grants = append(response.Subjects[i].Grants, b.grant)
+		}
+	}
+
+	sort.Slice(response.Subjects, func(i, j int) bool {
+		a, b := response.Subjects[i], response.Subjects[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return response
+}
+
+func (s *rbacSnapshot) permissionsOf(subject AccessSubject, groups []string) *PermissionMatrix {
+	matrix := &PermissionMatrix{Subject: subject, Groups: subjectGroups(subject, groups), Rows: []PermissionRow{}}
+	rows := map[string]int{}
+	add := func(row PermissionRow, verbs []string, grant AccessGrant) {
+		key := strings.Join([]string{row.Namespace, row.APIGroup, row.Resource, strings.Join(row.ResourceNames, ","), row.NonResourceURL}, "|")
+		i, ok := rows[key]
+		if !ok {
+			i = len(matrix.Rows)
+			rows[key] = i
+			matrix.Rows = append(matrix.Rows, row)
+		}
+		r := &matrix.Rows[i]
+		for _, verb := range verbs {
+			if !slices.Contains(r.Verbs, verb) {
+				r.Verbs = append(r.Verbs, verb)
+			}
+		}
+		if !slices.Contains(r.Grants, grant) {
+			r.Grants = append(r.Grants, grant)
+		}
+	}
+
+	for _, b := range s.bindings {
+		if !slices.ContainsFunc(b.subjects, func(bs rbacv1.Subject) bool { return subjectMatches(bs, b.grant.Namespace, subject, matrix.Groups) }) {
+			continue
+		}
+		rules, ok := s.rules(b)
+		if !ok {
+			matrix.Warnings = append(matrix.Warnings, missingRole(b))
+			continue
+		}
+		for _, rule := range rules {
+			if b.grant.Namespace == "" {
+				for _, url := range rule.NonResourceURLs {
+					add(PermissionRow{NonResourceURL: url}, rule.Verbs, b.grant)
+				}
+			}
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					add(PermissionRow{Namespace: b.grant.Namespace, APIGroup: group, Resource: resource, ResourceNames: rule.ResourceNames}, rule.Verbs, b.grant)
+				}
+			}
+		}
+	}
+
+	for i := range matrix.Rows {
+		row := &matrix.Rows[i]
+		sort.Strings(row.Verbs)
+		if row.Namespace == "" && row.APIGroup == rbacv1.APIGroupAll && row.Resource == rbacv1.ResourceAll &&
+			len(row.ResourceNames) == 0 && slices.Contains(row.Verbs, rbacv1.VerbAll) {
+			matrix.ClusterAdmin = true
+		}
+	}
+	sort.SliceStable(matrix.Rows, func(i, j int) bool {
+		a, b := matrix.Rows[i], matrix.Rows[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.APIGroup != b.APIGroup {
+			return a.APIGroup < b.APIGroup
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.NonResourceURL < b.NonResourceURL
+	})
+	return matrix
+}
+
+// accessSubject returns the subject of a binding, service accounts of RoleBindings defaulting to
+// the namespace of the binding
+func accessSubject(subject rbacv1.Subject, bindingNamespace string) AccessSubject {
+	namespace := subject.Namespace
+	if subject.Kind != rbacv1.ServiceAccountKind {
+		namespace = ""
+	} else if namespace == "" {
+		namespace = bindingNamespace
+	}
+	return AccessSubject{Kind: subject.Kind, Name: subject.Name, Namespace: namespace}
+}
+
+// subjectGroups returns the groups the bindings of which apply to a subject
+func subjectGroups(subject AccessSubject, groups []string) []string {
+	switch subject.Kind {
+	case rbacv1.ServiceAccountKind:
+		return []string{"system:serviceaccounts", "system:serviceaccounts:" + subject.Namespace, "system:authenticated"}
+	case rbacv1.UserKind:
+		result := append([]string{}, groups...)
+		if !slices.Contains(result, "system:authenticated") {
+			result = append(result, "system:authenticated")
+		}
+		return result
+	}
+	return []string{subject.Name}
+}
+
+// subjectMatches reports whether a subject of a binding is the subject asked about, or one of its groups
+func subjectMatches(s rbacv1.Subject, bindingNamespace string, subject AccessSubject, groups []string) bool {
+	switch s.Kind {
+	case rbacv1.GroupKind:
+		return slices.Contains(groups, s.Name)
+	case rbacv1.UserKind:
+		if subject.Kind == rbacv1.ServiceAccountKind {
+			// Service accounts authenticate as users named after them
+			return s.Name == "system:serviceaccount:"+subject.Namespace+":"+subject.Name
+		}
+		return subject.Kind == rbacv1.UserKind && s.Name == subject.Name
+	case rbacv1.ServiceAccountKind:
+		return accessSubject(s, bindingNamespace) == subject
+	}
+	return false
+}
+
+// ruleAllows reports whether a rule allows a request, following the matching of the RBAC authorizer
+func ruleAllows(rule rbacv1.PolicyRule, q AccessQuery) bool {
+	if !matchesAll(rule.Verbs, q.Verb, rbacv1.VerbAll) {
+		return false
+	}
+	if q.NonResourceURL != "" {
+		for _, url := range rule.NonResourceURLs {
+			if url == rbacv1.NonResourceAll || url == q.NonResourceURL ||
+				(strings.HasSuffix(url, "*") && strings.HasPrefix(q.NonResourceURL, strings.TrimSuffix(url, "*"))) {
+				return true
+			}
+		}
+		return false
+	}
+	if !matchesAll(rule.APIGroups, q.Group, rbacv1.APIGroupAll) || !resourceMatches(rule.Resources, q.Resource, q.Subresource) {
+		return false
+	}
+	return len(rule.ResourceNames) == 0 || (q.Name != "" && slices.Contains(rule.ResourceNames, q.Name))
+}
+
+func matchesAll(values []string, value, all string) bool {
+	return slices.Contains(values, all) || slices.Contains(values, value)
+}
+
+// resourceMatches matches a resource and subresource against the resources of a rule, which may
+// be "*", "resource/subresource" or "*/subresource"
+func resourceMatches(resources []string, resource, subresource string) bool {
+	combined := resource
+	if subresource != "" {
+		combined += "/" + subresource
+	}
+	for _, r := range resources {
+		if r == rbacv1.ResourceAll || r == combined || (subresource != "" && r == "*/"+subresource) {
+			return true
+		}
+	}
+	return false
+}
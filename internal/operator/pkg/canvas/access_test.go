@@ -0,0 +1,186 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func rule(groups, resources, verbs []string, names ...string) map[string]interface{} {
+	toList := func(values []string) []interface{} {
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		return list
+	}
+	r := map[string]interface{}{"apiGroups": toList(groups), "resources": toList(resources), "verbs": toList(verbs)}
+	if len(names) > 0 {
+		r["resourceNames"] = toList(names)
+	}
+	return r
+}
+
+func testRBAC(t *testing.T) *rbacSnapshot {
+	t.Helper()
+
+	role := func(kind, namespace, name string, rules ...interface{}) *unstructured.Unstructured {
+		return storageObject("rbac.authorization.k8s.io/v1", kind, namespace, name, map[string]interface{}{"rules": rules})
+	}
+	binding := func(kind, namespace, name, roleKind, roleName string, subjects ...interface{}) *unstructured.Unstructured {
+		return storageObject("rbac.authorization.k8s.io/v1", kind, namespace, name, map[string]interface{}{
+			"roleRef":  map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": roleKind, "name": roleName},
+			"subjects": subjects,
+		})
+	}
+	subject := func(kind, name, namespace string) map[string]interface{} {
+		s := map[string]interface{}{"kind": kind, "name": name}
+		if namespace != "" {
+			s["namespace"] = namespace
+		}
+		return s
+	}
+
+	listKinds := map[schema.GroupVersionResource]string{
+		rolesGVR:               "RoleList",
+		clusterRolesGVR:        "ClusterRoleList",
+		roleBindingsGVR:        "RoleBindingList",
+		clusterRoleBindingsGVR: "ClusterRoleBindingList",
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		role("ClusterRole", "", "cluster-admin", rule([]string{"*"}, []string{"*"}, []string{"*"}),
+			map[string]interface{}{"nonResourceURLs": []interface{}{"*"}, "verbs": []interface{}{"*"}}),
+		role("ClusterRole", "", "pod-reader", rule([]string{""}, []string{"pods", "pods/log"}, []string{"get", "list"})),
+		role("Role", "shop", "deployer", rule([]string{"apps"}, []string{"deployments"}, []string{"get", "update", "patch"}),
+			rule([]string{""}, []string{"configmaps"}, []string{"get"}, "settings")),
+		role("ClusterRole", "", "scaler", rule([]string{"*"}, []string{"*/scale"}, []string{"update"})),
+		binding("ClusterRoleBinding", "", "admins", "ClusterRole", "cluster-admin", subject("Group", "platform", "")),
+		binding("ClusterRoleBinding", "", "autoscaler", "ClusterRole", "scaler", subject("ServiceAccount", "hpa", "kube-system")),
+		binding("RoleBinding", "shop", "ci-deployer", "Role", "deployer", subject("ServiceAccount", "ci", "")),
+		binding("RoleBinding", "shop", "ci-logs", "ClusterRole", "pod-reader",
+			subject("ServiceAccount", "ci", "shop"), subject("User", "alice", "")),
+		binding("RoleBinding", "payments", "all-sa-read", "ClusterRole", "pod-reader", subject("Group", "system:serviceaccounts", "")),
+		binding("RoleBinding", "shop", "stale", "Role", "removed", subject("User", "bob", "")),
+	)
+
+	snapshot, err := loadRBAC(context.Background(), client)
+	if err != nil {
+		t.Fatalf("loadRBAC() error = %v", err)
+	}
+	return snapshot
+}
+
+func subjectNames(subjects []SubjectAccess) []string {
+	names := []string{}
+	for _, s := range subjects {
+		name := s.Kind + ":" + s.Name
+		if s.Namespace != "" {
+			name = s.Kind + ":" + s.Namespace + "/" + s.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestWhoCan(t *testing.T) {
+	t.Parallel()
+
+	snapshot := testRBAC(t)
+	tests := []struct {
+		name  string
+		query AccessQuery
+		want  []string
+	}{
+		{"namespaced read", AccessQuery{Verb: "list", Resource: "pods", Namespace: "shop"},
+			[]string{"Group:platform", "ServiceAccount:shop/ci", "User:alice"}},
+		{"subresource", AccessQuery{Verb: "get", Resource: "pods/log", Namespace: "payments"},
+			[]string{"Group:platform", "Group:system:serviceaccounts"}},
+		{"cluster-wide", AccessQuery{Verb: "list", Resource: "pods"}, []string{"Group:platform"}},
+		{"wildcard subresource", AccessQuery{Verb: "update", Group: "apps", Resource: "deployments", Subresource: "scale", Namespace: "shop"},
+			[]string{"Group:platform", "ServiceAccount:kube-system/hpa"}},
+		{"resource name allowed", AccessQuery{Verb: "get", Resource: "configmaps", Name: "settings", Namespace: "shop"},
+			[]string{"Group:platform", "ServiceAccount:shop/ci"}},
+		{"resource name denied", AccessQuery{Verb: "get", Resource: "configmaps", Name: "other", Namespace: "shop"},
+			[]string{"Group:platform"}},
+		{"verb denied", AccessQuery{Verb: "delete", Group: "apps", Resource: "deployments", Namespace: "shop"},
+			[]string{"Group:platform"}},
+		{"non-resource URL", AccessQuery{Verb: "get", NonResourceURL: "/metrics"}, []string{"Group:platform"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			query, err := tt.query.normalize()
+			if err != nil {
+				t.Fatalf("normalize() error = %v", err)
+			}
+			got := snapshot.whoCan(query)
+			if names := subjectNames(got.Subjects); !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("whoCan(%+v) = %v, want %v", tt.query, names, tt.want)
+			}
+		})
+	}
+
+	if got := snapshot.whoCan(AccessQuery{Verb: "get", Resource: "secrets", Namespace: "shop"}); len(got.Warnings) != 1 {
+		t.Errorf("warnings = %v, want the binding of the removed role", got.Warnings)
+	}
+}
+
+func TestPermissionsOf(t *testing.T) {
+	t.Parallel()
+
+	snapshot := testRBAC(t)
+	matrix := snapshot.permissionsOf(AccessSubject{Kind: "ServiceAccount", Name: "ci", Namespace: "shop"}, nil)
+	if matrix.ClusterAdmin {
+		t.Error("ci is reported cluster admin")
+	}
+
+	var rows []string
+	for _, row := range matrix.Rows {
+		rows = append(rows, row.Namespace+" "+row.APIGroup+"/"+row.Resource+" "+row.NonResourceURL+" "+strings.Join(row.Verbs, ","))
+	}
+	want := []string{
+		// The binding of every service account applies to ci through its group
+		"payments /pods  get,list",
+		"payments /pods/log  get,list",
+		"shop /configmaps  get",
+		"shop /pods  get,list",
+		"shop /pods/log  get,list",
+		"shop apps/deployments  get,patch,update",
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+	for _, row := range matrix.Rows {
+		if row.Resource == "configmaps" && !reflect.DeepEqual(row.ResourceNames, []string{"settings"}) {
+			t.Errorf("configmaps row resource names = %v, want [settings]", row.ResourceNames)
+		}
+	}
+
+	admin := snapshot.permissionsOf(AccessSubject{Kind: "User", Name: "carol"}, []string{"platform"})
+	if !admin.ClusterAdmin {
+		t.Errorf("member of platform is not reported cluster admin: %+v", admin.Rows)
+	}
+}
+
+func TestAccessQueryNormalize(t *testing.T) {
+	t.Parallel()
+
+	query, err := AccessQuery{Verb: "get", Resource: "pods/exec"}.normalize()
+	if err != nil || query.Resource != "pods" || query.Subresource != "exec" {
+		t.Errorf("normalize() = %+v, %v, want pods and exec split", query, err)
+	}
+	for _, q := range []AccessQuery{{Resource: "pods"}, {Verb: "get"}, {Verb: "get", Resource: "pods", NonResourceURL: "/healthz"}} {
+		if _, err := q.normalize(); err == nil {
+			t.Errorf("normalize(%+v) succeeded, want an error", q)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Risk factors that make a resource easier to exploit once an attacker reaches it
+const (
+	// RiskPublic resources are reachable from the internet: ingresses, load balancers and services
+	// with external IPs
+	RiskPublic = "public"
+	// RiskPrivileged pods run a privileged container or one with CAP_SYS_ADMIN
+	RiskPrivileged = "privileged"
+	// RiskHostPath pods mount a directory of their node
+	RiskHostPath = "hostPath"
+	// RiskHostNamespace pods share the network, PID or IPC namespace of their node
+	RiskHostNamespace = "hostNamespace"
+	// RiskClusterAdmin roles and bindings grant full control of the cluster
+	RiskClusterAdmin = "clusterAdmin"
+)
+
+// riskWeights are what a factor adds to the risk of the edges leading to a resource, edges start
+// at a risk of 1
+var riskWeights = map[string]float64{
+	RiskPublic:        3,
+	RiskPrivileged:    4,
+	RiskHostPath:      3,
+	RiskHostNamespace: 2,
+	RiskClusterAdmin:  5,
+}
+
+// attackSteps are the resource types an attacker controlling a resource can move to: from exposed
+// services to the workloads behind them, from workloads to their secrets and service accounts, and
+// from service accounts to the permissions bound to them
+var attackSteps = map[string][]string{
+	"ingresses":           {"services"},
+	"services":            {"deployments", "statefulsets", "daemonsets", "replicasets", "jobs", "cronjobs", "pods"},
+	"deployments":         {"replicasets", "pods", "secrets", "serviceaccounts"},
+	"statefulsets":        {"pods", "secrets", "serviceaccounts"},
+	"daemonsets":          {"pods", "secrets", "serviceaccounts"},
+	"replicasets":         {"pods", "secrets", "serviceaccounts"},
+	"jobs":                {"pods", "secrets", "serviceaccounts"},
+	"cronjobs":            {"jobs", "pods", "secrets", "serviceaccounts"},
+	"pods":                {"secrets", "serviceaccounts", "nodes"},
+	"serviceaccounts":     {"rolebindings", "clusterrolebindings"},
+	"rolebindings":        {"roles", "clusterroles"},
+	"clusterrolebindings": {"clusterroles"},
+}
+
+// attackTargets are the resource types an attack path ends at
+var attackTargets = map[string]bool{"secrets": true, "nodes": true}
+
+// scoredTypes are the resource types whose objects are read for risk factors
+var scoredTypes = map[string]bool{
+	"pods":                true,
+	"services":            true,
+	"ingresses":           true,
+	"rolebindings":        true,
+	"clusterrolebindings": true,
+	"clusterroles":        true,
+}
+
+// AttackPath is the easiest exploit path of a graph, from an internet-facing resource to a secret
+// or a node
+type AttackPath struct {
+	// Nodes are the ids of the nodes along the path, from the entry to the target
+	Nodes []string `json:"nodes"`
+	// Edges are the ids of the edges along the path
+	Edges []string `json:"edges"`
+	// Risk is the sum of the risks of the edges along the path
+	Risk float64 `json:"risk"`
+}
+
+// addAttackPathScores reads the risk factors of the resources of an attack-path graph, adds the
+// nodes privileged pods can escape to and highlights the easiest exploit path
+func (c *Controller) addAttackPathScores(ctx context.Context, client dynamic.Interface, response *GraphResponse) {
+	factors := map[string][]string{}
+	escapes := map[string]string{}
+	for _, node := range response.Nodes {
+		resource, ok := nodeResource(node)
+		if !ok || !scoredTypes[resource.ResourceType] {
+			continue
+		}
+		obj, err := client.Resource(schema.GroupVersionResource{
+			Group:    resource.Group,
+			Version:  resource.Version,
+			Resource: resource.ResourceType,
+		}).Namespace(resource.Namespace).Get(ctx, resource.ResourceName, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		factors[node.ID] = riskFactors(resource.ResourceType, obj)
+		if resource.ResourceType == "pods" && canEscape(factors[node.ID]) {
+			if nodeName, _, _ := unstructured.NestedString(obj.Object, "spec", "nodeName"); nodeName != "" {
+				escapes[node.ID] = nodeName
+			}
+		}
+	}
+
+	for _, podID := range sortedKeys(escapes) {
+		nodeNode, err := c.buildResourceNode(ctx, client, ResourceIdentifier{Version: "v1", ResourceType: "nodes", ResourceName: escapes[podID]})
+		if err != nil {
+			continue
+		}
+		if !hasNode(response, nodeNode.ID) {
+			response.Nodes = append(response.Nodes, nodeNode)
+		}
+
+		// Add edge from a pod to the node it can break out to
+		response.Edges = append(response.Edges, Edge{
+			ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+			Source: podID,
+			Target: nodeNode.ID,
+			Type:   "smoothstep",
+			Label:  "can-escape-to",
+		})
+	}
+
+	scoreAttackPaths(response, factors)
+}
+
+// scoreAttackPaths annotates the resources of a graph with their risk factors and the edges an
+// attacker can follow with their risk, then highlights the easiest path from a public resource to
+// a secret or a node. The easiest path is the shortest one when every edge is as long as the
+// inverse of its risk. A cluster-admin binding or role reaches every target, the edge of that last
+// step is added to the graph when the path takes it.
+func scoreAttackPaths(response *GraphResponse, factors map[string][]string) {
+	// arc is a move of an attacker from a node to another, edge is -1 for moves without an edge
+	type arc struct {
+		from, to int
+		edge     int
+		risk     float64
+	}
+
+	index := map[string]int{}
+	types := make([]string, len(response.Nodes))
+	for i, node := range response.Nodes {
+		if _, ok := index[node.ID]; !ok {
+			index[node.ID] = i
+		}
+		if resource, ok := nodeResource(node); ok {
+			types[i] = resource.ResourceType
+		}
+	}
+	for id, nodeFactors := range factors {
+		if len(nodeFactors) > 0 {
+			markNode(response, id, "riskFactors", nodeFactors)
+		}
+	}
+	risk := func(to int) float64 {
+		total := 1.0
+		for _, factor := range factors[response.Nodes[to].ID] {
+			total += riskWeights[factor]
+		}
+		return total
+	}
+
+	arcs := make([][]arc, len(response.Nodes))
+	for i, edge := range response.Edges {
+		source, ok := index[edge.Source]
+		target, ok2 := index[edge.Target]
+		if !ok || !ok2 {
+			continue
+		}
+		edgeRisk := 0.0
+		for _, move := range [][2]int{{source, target}, {target, source}} {
+			if !canStep(types[move[0]], types[move[1]]) {
+				continue
+			}
+			r := risk(move[1])
+			arcs[move[0]] = append(arcs[move[0]], arc{from: move[0], to: move[1], edge: i, risk: r})
+			edgeRisk = math.Max(edgeRisk, r)
+		}
+		if edgeRisk > 0 {
+			setData(&response.Edges[i].Data, "risk", edgeRisk)
+		}
+	}
+	// Cluster admins reach every target without an edge of their own
+	for i, node := range response.Nodes {
+		if index[node.ID] != i || !contains(factors[node.ID], RiskClusterAdmin) {
+			continue
+		}
+		for j, target := range response.Nodes {
+			if index[target.ID] == j && attackTargets[types[j]] {
+				arcs[i] = append(arcs[i], arc{from: i, to: j, edge: -1, risk: risk(j)})
+			}
+		}
+	}
+
+	// Dijkstra from every public resource at once, graphs are small enough for a linear scan
+	dist := make([]float64, len(response.Nodes))
+	done := make([]bool, len(response.Nodes))
+	// prev holds the arc each node was reached by
+	prev := make([]*arc, len(response.Nodes))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+		if index[response.Nodes[i].ID] == i && contains(factors[response.Nodes[i].ID], RiskPublic) {
+			dist[i] = 0
+		}
+	}
+	target := -1
+	for {
+		current := -1
+		for i := range dist {
+			if !done[i] && !math.IsInf(dist[i], 1) && (current == -1 || dist[i] < dist[current]) {
+				current = i
+			}
+		}
+		if current == -1 {
+			break
+		}
+		if attackTargets[types[current]] {
+			target = current
+			break
+		}
+		done[current] = true
+		for i := range arcs[current] {
+			a := &arcs[current][i]
+			if d := dist[current] + 1/a.risk; d < dist[a.to] {
+				dist[a.to] = d
+				prev[a.to] = a
+			}
+		}
+	}
+	if target == -1 {
+		return
+	}
+
+	path := &AttackPath{Nodes: []string{response.Nodes[target].ID}, Edges: []string{}}
+	for a := prev[target]; a != nil; a = prev[a.from] {
+		edge := a.edge
+		if edge == -1 {
+			// Add edge from a cluster admin to the target it controls
+			response.Edges = append(response.Edges, Edge{
+				ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+				Source: response.Nodes[a.from].ID,
+				Target: response.Nodes[a.to].ID,
+				Type:   "smoothstep",
+				Label:  "can-access",
+				Data:   map[string]interface{}{"risk": a.risk},
+			})
+			edge = len(response.Edges) - 1
+		}
+		path.Nodes = append([]string{response.Nodes[a.from].ID}, path.Nodes...)
+		path.Edges = append([]string{response.Edges[edge].ID}, path.Edges...)
+		path.Risk += a.risk
+	}
+
+	for _, id := range path.Nodes {
+		markNode(response, id, "attackPath", true)
+	}
+	for _, id := range path.Edges {
+		for i := range response.Edges {
+			if response.Edges[i].ID == id {
+				setData(&response.Edges[i].Data, "attackPath", true)
+			}
+		}
+	}
+	response.AttackPath = path
+}
+
+// riskFactors returns the risk factors of an object of a scored type
+func riskFactors(resourceType string, obj *unstructured.Unstructured) []string {
+	factors := []string{}
+	switch resourceType {
+	case "ingresses":
+		factors = append(factors, RiskPublic)
+	case "services":
+		serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+		externalIPs, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "externalIPs")
+		if serviceType == "LoadBalancer" || len(externalIPs) > 0 {
+			factors = append(factors, RiskPublic)
+		}
+	case "pods":
+		if privilegedPod(obj) {
+			factors = append(factors, RiskPrivileged)
+		}
+		volumes, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumes")
+		for _, volume := range volumes {
+			if volumeMap, ok := volume.(map[string]interface{}); ok && volumeMap["hostPath"] != nil {
+				factors = append(factors, RiskHostPath)
+				break
+			}
+		}
+		for _, field := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+			if shared, _, _ := unstructured.NestedBool(obj.Object, "spec", field); shared {
+				factors = append(factors, RiskHostNamespace)
+				break
+			}
+		}
+	case "rolebindings", "clusterrolebindings":
+		kind, _, _ := unstructured.NestedString(obj.Object, "roleRef", "kind")
+		name, _, _ := unstructured.NestedString(obj.Object, "roleRef", "name")
+		if kind == "ClusterRole" && name == "cluster-admin" {
+			factors = append(factors, RiskClusterAdmin)
+		}
+	case "clusterroles":
+		if obj.GetName() == "cluster-admin" || grantsEverything(obj) {
+			factors = append(factors, RiskClusterAdmin)
+		}
+	}
+	return factors
+}
+
+// privilegedPod reports whether a container of a pod is privileged or adds CAP_SYS_ADMIN
+func privilegedPod(obj *unstructured.Unstructured) bool {
+	for _, group := range containerGroups {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", group.specField)
+		for _, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if privileged, _, _ := unstructured.NestedBool(containerMap, "securityContext", "privileged"); privileged {
+				return true
+			}
+			capabilities, _, _ := unstructured.NestedStringSlice(containerMap, "securityContext", "capabilities", "add")
+			if contains(capabilities, "SYS_ADMIN") || contains(capabilities, "CAP_SYS_ADMIN") || contains(capabilities, "ALL") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grantsEverything reports whether a role has a rule allowing every verb on every resource
+func grantsEverything(obj *unstructured.Unstructured) bool {
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "rules")
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		apiGroups, _, _ := unstructured.NestedStringSlice(ruleMap, "apiGroups")
+		resources, _, _ := unstructured.NestedStringSlice(ruleMap, "resources")
+		verbs, _, _ := unstructured.NestedStringSlice(ruleMap, "verbs")
+		if contains(apiGroups, "*") && contains(resources, "*") && contains(verbs, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// canEscape reports whether a pod with the given risk factors can break out to its node
+func canEscape(factors []string) bool {
+	return contains(factors, RiskPrivileged) || contains(factors, RiskHostPath)
+}
+
+func canStep(from, to string) bool {
+	return from != "" && to != "" && contains(attackSteps[from], to)
+}
+
+// nodeResource returns the resource a resource node of a graph stands for
+func nodeResource(node Node) (ResourceIdentifier, bool) {
+	resourceType, _ := node.Data["resourceType"].(string)
+	resourceName, _ := node.Data["resourceName"].(string)
+	if resourceType == "" || resourceName == "" {
+		return ResourceIdentifier{}, false
+	}
+	namespace, _ := node.Data["namespace"].(string)
+	group, _ := node.Data["group"].(string)
+	version, _ := node.Data["version"].(string)
+	return ResourceIdentifier{Namespace: namespace, Group: group, Version: version, ResourceType: resourceType, ResourceName: resourceName}, true
+}
+
+func hasNode(response *GraphResponse, id string) bool {
+	for _, node := range response.Nodes {
+		if node.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func setData(data *map[string]interface{}, key string, value interface{}) {
+	if *data == nil {
+		*data = map[string]interface{}{}
+	}
+	(*data)[key] = value
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
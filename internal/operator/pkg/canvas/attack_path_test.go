@@ -0,0 +1,228 @@
+package canvas
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func resourceTestNode(resourceType, name string) Node {
+	return Node{
+		ID:   "node-" + resourceType[:len(resourceType)-1] + "-" + name,
+		Type: "resource",
+		Data: map[string]interface{}{"resourceType": resourceType, "resourceName": name},
+	}
+}
+
+func TestScoreAttackPaths(t *testing.T) {
+	t.Parallel()
+
+	graph := func() *GraphResponse {
+		return &GraphResponse{
+			Nodes: []Node{
+				resourceTestNode("ingresses", "shop"),
+				resourceTestNode("services", "web"),
+				resourceTestNode("deployments", "web"),
+				resourceTestNode("pods", "web-a"),
+				resourceTestNode("secrets", "db"),
+				resourceTestNode("serviceaccounts", "web"),
+				resourceTestNode("clusterrolebindings", "web-admin"),
+				resourceTestNode("nodes", "worker-1"),
+			},
+			Edges: []Edge{
+				{ID: "edge-1", Source: "node-ingresse-shop", Target: "node-service-web", Label: "routes-to"},
+				{ID: "edge-2", Source: "node-service-web", Target: "node-deployment-web", Label: "exposes"},
+				{ID: "edge-3", Source: "node-deployment-web", Target: "node-pod-web-a", Label: "manages"},
+				{ID: "edge-4", Source: "node-secret-db", Target: "node-deployment-web", Label: "provides-secrets"},
+				{ID: "edge-5", Source: "node-pod-web-a", Target: "node-serviceaccount-web", Label: "uses-account"},
+				{ID: "edge-6", Source: "node-clusterrolebinding-web-admin", Target: "node-serviceaccount-web", Label: "binds-to"},
+				{ID: "edge-7", Source: "node-pod-web-a", Target: "node-node-worker-1", Label: "can-escape-to"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		factors   map[string][]string
+		dropEdge  string
+		wantNodes []string
+		wantEdges []string
+	}{
+		{
+			name:    "no public entry",
+			factors: map[string][]string{},
+		},
+		{
+			name:      "mounted secret",
+			factors:   map[string][]string{"node-ingresse-shop": {RiskPublic}},
+			wantNodes: []string{"node-ingresse-shop", "node-service-web", "node-deployment-web", "node-secret-db"},
+			wantEdges: []string{"edge-1", "edge-2", "edge-4"},
+		},
+		{
+			name: "privileged pod",
+			factors: map[string][]string{
+				"node-ingresse-shop": {RiskPublic},
+				"node-pod-web-a":     {RiskPrivileged},
+			},
+			dropEdge:  "edge-4",
+			wantNodes: []string{"node-ingresse-shop", "node-service-web", "node-deployment-web", "node-pod-web-a", "node-node-worker-1"},
+			wantEdges: []string{"edge-1", "edge-2", "edge-3", "edge-7"},
+		},
+		{
+			// Reading the mounted secret takes fewer steps than escaping to the node
+			name: "privileged pod with a mounted secret",
+			factors: map[string][]string{
+				"node-ingresse-shop": {RiskPublic},
+				"node-pod-web-a":     {RiskPrivileged},
+			},
+			wantNodes: []string{"node-ingresse-shop", "node-service-web", "node-deployment-web", "node-secret-db"},
+			wantEdges: []string{"edge-1", "edge-2", "edge-4"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			response := graph()
+			for i, edge := range response.Edges {
+				if edge.ID == tt.dropEdge {
+					response.Edges = append(response.Edges[:i], response.Edges[i+1:]...)
+					break
+				}
+			}
+			scoreAttackPaths(response, tt.factors)
+			if tt.wantNodes == nil {
+				if response.AttackPath != nil {
+					t.Fatalf("AttackPath = %+v, want none", response.AttackPath)
+				}
+				return
+			}
+			if response.AttackPath == nil {
+				t.Fatal("AttackPath = nil")
+			}
+			if !equalStrings(response.AttackPath.Nodes, tt.wantNodes) || !equalStrings(response.AttackPath.Edges, tt.wantEdges) {
+				t.Errorf("AttackPath = %+v, want nodes %v and edges %v", response.AttackPath, tt.wantNodes, tt.wantEdges)
+			}
+			for _, node := range response.Nodes {
+				if highlighted := node.Data["attackPath"] == true; highlighted != contains(tt.wantNodes, node.ID) {
+					t.Errorf("node %s highlighted = %v", node.ID, highlighted)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreAttackPathsClusterAdmin(t *testing.T) {
+	t.Parallel()
+
+	response := &GraphResponse{
+		Nodes: []Node{
+			resourceTestNode("services", "web"),
+			resourceTestNode("pods", "web-a"),
+			resourceTestNode("serviceaccounts", "web"),
+			resourceTestNode("clusterrolebindings", "web-admin"),
+			resourceTestNode("nodes", "worker-1"),
+		},
+		Edges: []Edge{
+			{ID: "edge-1", Source: "node-service-web", Target: "node-pod-web-a", Label: "exposes"},
+			{ID: "edge-2", Source: "node-pod-web-a", Target: "node-serviceaccount-web", Label: "uses-account"},
+			{ID: "edge-3", Source: "node-clusterrolebinding-web-admin", Target: "node-serviceaccount-web", Label: "binds-to"},
+		},
+	}
+	scoreAttackPaths(response, map[string][]string{
+		"node-service-web":                  {RiskPublic},
+		"node-clusterrolebinding-web-admin": {RiskClusterAdmin},
+	})
+
+	path := response.AttackPath
+	want := []string{"node-service-web", "node-pod-web-a", "node-serviceaccount-web", "node-clusterrolebinding-web-admin", "node-node-worker-1"}
+	if path == nil || !equalStrings(path.Nodes, want) {
+		t.Fatalf("AttackPath = %+v, want nodes %v", path, want)
+	}
+	added := response.Edges[len(response.Edges)-1]
+	if added.Label != "can-access" || added.Target != "node-node-worker-1" || path.Edges[3] != added.ID {
+		t.Errorf("added edge = %+v, want the cluster admin's access to the node on the path", added)
+	}
+	// Edges are weighed by the risk of the resource they lead to
+	if risk := response.Edges[2].Data["risk"]; risk != 1+riskWeights[RiskClusterAdmin] {
+		t.Errorf("binding edge risk = %v, want %v", risk, 1+riskWeights[RiskClusterAdmin])
+	}
+	if path.Risk != 9 {
+		t.Errorf("Risk = %v, want 9", path.Risk)
+	}
+}
+
+func TestRiskFactors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		resourceType string
+		obj          map[string]interface{}
+		want         []string
+	}{
+		{
+			name:         "load balancer",
+			resourceType: "services",
+			obj:          map[string]interface{}{"spec": map[string]interface{}{"type": "LoadBalancer"}},
+			want:         []string{RiskPublic},
+		},
+		{
+			name:         "cluster IP",
+			resourceType: "services",
+			obj:          map[string]interface{}{"spec": map[string]interface{}{"type": "ClusterIP"}},
+			want:         []string{},
+		},
+		{
+			name:         "privileged pod with host mounts",
+			resourceType: "pods",
+			obj: map[string]interface{}{"spec": map[string]interface{}{
+				"hostPID": true,
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app"},
+					map[string]interface{}{"name": "agent", "securityContext": map[string]interface{}{
+						"capabilities": map[string]interface{}{"add": []interface{}{"SYS_ADMIN"}},
+					}},
+				},
+				"volumes": []interface{}{map[string]interface{}{"name": "root", "hostPath": map[string]interface{}{"path": "/"}}},
+			}},
+			want: []string{RiskPrivileged, RiskHostPath, RiskHostNamespace},
+		},
+		{
+			name:         "cluster-admin binding",
+			resourceType: "clusterrolebindings",
+			obj:          map[string]interface{}{"roleRef": map[string]interface{}{"kind": "ClusterRole", "name": "cluster-admin"}},
+			want:         []string{RiskClusterAdmin},
+		},
+		{
+			name:         "wildcard role",
+			resourceType: "clusterroles",
+			obj: map[string]interface{}{"rules": []interface{}{map[string]interface{}{
+				"apiGroups": []interface{}{"*"}, "resources": []interface{}{"*"}, "verbs": []interface{}{"*"},
+			}}},
+			want: []string{RiskClusterAdmin},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := riskFactors(tt.resourceType, &unstructured.Unstructured{Object: tt.obj})
+			if !equalStrings(got, tt.want) {
+				t.Errorf("riskFactors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
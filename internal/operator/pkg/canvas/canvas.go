@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/agentkube/operator/pkg/features"
+	"github.com/agentkube/operator/pkg/redact"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -15,6 +17,7 @@ import (
 // Controller handles canvas operations
 type Controller struct {
 	restConfig *rest.Config
+	lister     MetadataLister
 }
 
 // NewController creates a new canvas controller
@@ -25,7 +28,8 @@ func NewController(restConfig *rest.Config) (*Controller, error) {
 }
 
 // GetGraphNodes retrieves the graph representation of Kubernetes resources
-func (c *Controller) GetGraphNodes(ctx context.Context, resource ResourceIdentifier, attackPath bool) (*GraphResponse, error) {
+func (c *Controller) GetGraphNodes(ctx context.Context, resource ResourceIdentifier, opts GraphOptions) (*GraphResponse, error) {
+	attackPath := opts.AttackPath
 	dynamicClient, err := dynamic.NewForConfig(c.restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
@@ -63,6 +67,8 @@ func (c *Controller) GetGraphNodes(ctx context.Context, resource ResourceIdentif
 			err = c.processCronJobGraph(ctx, dynamicClient, mainNode.ID, resource, response, attackPath)
 		case "nodes":
 			err = c.processNodeGraph(ctx, dynamicClient, mainNode.ID, resource, response, attackPath)
+		case "persistentvolumes":
+			err = c.processPersistentVolumeGraph(ctx, dynamicClient, mainNode.ID, resource, response, attackPath)
 		case "roles":
 			err = c.processRoleGraph(ctx, dynamicClient, mainNode.ID, resource, response, attackPath)
 		case "clusterroles":
@@ -89,6 +95,21 @@ func (c *Controller) GetGraphNodes(ctx context.Context, resource ResourceIdentif
 		if err != nil {
 			return nil, err
 		}
+
+		// Weigh the edges by how exploitable they are and highlight the easiest path
+		if features.Enabled(features.AttackPathScoring) {
+			c.addAttackPathScores(ctx, dynamicClient, response)
+		}
+	}
+
+	// Follow the references leaving the namespace of the resource
+	if opts.CrossNamespace && resource.Namespace != "" {
+		c.addCrossNamespaceResources(ctx, dynamicClient, resource, response)
+	}
+
+	// Link the services to what they point at in the other clusters
+	if len(opts.Peers) > 0 {
+		c.addFederatedEdges(ctx, dynamicClient, response, opts.Peers)
 	}
 
 	return response, nil
@@ -149,6 +170,12 @@ func (c *Controller) processDeploymentGraph(ctx context.Context, client dynamic.
 					continue
 				}
 			}
+
+			// Add the volumes the pod mounts
+			err = c.addVolumeNodes(ctx, client, pod, podNode.ID, response)
+			if err != nil {
+				continue
+			}
 		}
 	}
 
@@ -217,6 +244,12 @@ func (c *Controller) processStatefulSetGraph(ctx context.Context, client dynamic
 				continue
 			}
 		}
+
+		// Add the volumes the pod mounts, claims from the volume claim templates included
+		err = c.addVolumeNodes(ctx, client, pod, podNode.ID, response)
+		if err != nil {
+			continue
+		}
 	}
 
 	return nil
@@ -438,6 +471,9 @@ func (c *Controller) processNodeGraph(ctx context.Context, client dynamic.Interf
 		})
 	}
 
+	// Overlay the volumes held by this node and the pods that can't move away from it
+	c.addNodeLocality(ctx, client, parentID, resource, response)
+
 	return nil
 }
 
@@ -887,7 +923,11 @@ func (c *Controller) buildResourceNode(ctx context.Context, client dynamic.Inter
 	if err != nil {
 		return Node{}, err
 	}
+	return c.resourceNode(resource, obj), nil
+}
 
+// resourceNode returns the node of a resource already fetched
+func (c *Controller) resourceNode(resource ResourceIdentifier, obj *unstructured.Unstructured) Node {
 	// Build node data
 	data := map[string]interface{}{
 		"namespace":    resource.Namespace,
@@ -897,14 +937,18 @@ func (c *Controller) buildResourceNode(ctx context.Context, client dynamic.Inter
 		"resourceName": resource.ResourceName,
 		"status":       c.getResourceStatus(obj),
 		"createdAt":    obj.GetCreationTimestamp().String(),
-		"labels":       obj.GetLabels(),
+		"labels":       redact.Map(obj.GetLabels()),
+	}
+	// Objects applied with kubectl apply are badged when they drifted from what was applied
+	if drifted, ok := driftBadge(obj); ok {
+		data["drifted"] = drifted
 	}
 
 	return Node{
 		ID:   fmt.Sprintf("node-%s-%s", resource.ResourceType[:len(resource.ResourceType)-1], resource.ResourceName),
 		Type: "resource",
 		Data: data,
-	}, nil
+	}
 }
 
 func (c *Controller) getResourceStatus(obj *unstructured.Unstructured) map[string]interface{} {
@@ -955,18 +999,18 @@ func (c *Controller) getResourceStatus(obj *unstructured.Unstructured) map[strin
 }
 
 func (c *Controller) findReplicaSets(ctx context.Context, client dynamic.Interface, owner ResourceIdentifier) ([]ResourceIdentifier, error) {
-	rsList, err := client.Resource(schema.GroupVersionResource{
+	rsList, err := c.listMetadata(ctx, client, schema.GroupVersionResource{
 		Group:    "apps",
 		Version:  "v1",
 		Resource: "replicasets",
-	}).Namespace(owner.Namespace).List(ctx, metav1.ListOptions{})
+	}, owner.Namespace)
 
 	if err != nil {
 		return nil, err
 	}
 
 	var replicaSets []ResourceIdentifier
-	for _, rs := range rsList.Items {
+	for _, rs := range rsList {
 		for _, ownerRef := range rs.GetOwnerReferences() {
 			if ownerRef.Kind == "Deployment" && ownerRef.Name == owner.ResourceName {
 				replicaSets = append(replicaSets, ResourceIdentifier{
@@ -985,17 +1029,17 @@ func (c *Controller) findReplicaSets(ctx context.Context, client dynamic.Interfa
 }
 
 func (c *Controller) findPods(ctx context.Context, client dynamic.Interface, owner ResourceIdentifier) ([]ResourceIdentifier, error) {
-	podList, err := client.Resource(schema.GroupVersionResource{
+	podList, err := c.listMetadata(ctx, client, schema.GroupVersionResource{
 		Version:  "v1",
 		Resource: "pods",
-	}).Namespace(owner.Namespace).List(ctx, metav1.ListOptions{})
+	}, owner.Namespace)
 
 	if err != nil {
 		return nil, err
 	}
 
 	var pods []ResourceIdentifier
-	for _, pod := range podList.Items {
+	for _, pod := range podList {
 		for _, ownerRef := range pod.GetOwnerReferences() {
 			if ownerRef.Name == owner.ResourceName {
 				pods = append(pods, ResourceIdentifier{
@@ -1024,10 +1068,10 @@ func (c *Controller) findControlledPods(ctx context.Context, client dynamic.Inte
 		return nil, err
 	}
 
-	podList, err := client.Resource(schema.GroupVersionResource{
+	podList, err := c.listMetadata(ctx, client, schema.GroupVersionResource{
 		Version:  "v1",
 		Resource: "pods",
-	}).Namespace(owner.Namespace).List(ctx, metav1.ListOptions{})
+	}, owner.Namespace)
 
 	if err != nil {
 		return nil, err
@@ -1036,7 +1080,7 @@ func (c *Controller) findControlledPods(ctx context.Context, client dynamic.Inte
 	var pods []ResourceIdentifier
 	ownerUID := ownerObj.GetUID()
 
-	for _, pod := range podList.Items {
+	for _, pod := range podList {
 		for _, ref := range pod.GetOwnerReferences() {
 			if ref.UID == ownerUID {
 				pods = append(pods, ResourceIdentifier{
@@ -1071,17 +1115,17 @@ func (c *Controller) findServicePods(ctx context.Context, client dynamic.Interfa
 	}
 
 	// Find matching pods
-	podList, err := client.Resource(schema.GroupVersionResource{
+	podList, err := c.listMetadata(ctx, client, schema.GroupVersionResource{
 		Version:  "v1",
 		Resource: "pods",
-	}).Namespace(service.Namespace).List(ctx, metav1.ListOptions{})
+	}, service.Namespace)
 
 	if err != nil {
 		return nil, err
 	}
 
 	var pods []ResourceIdentifier
-	for _, pod := range podList.Items {
+	for _, pod := range podList {
 		if matchLabels(selector, pod.GetLabels()) {
 			pods = append(pods, ResourceIdentifier{
 				Namespace:    service.Namespace,
@@ -1097,18 +1141,18 @@ func (c *Controller) findServicePods(ctx context.Context, client dynamic.Interfa
 }
 
 func (c *Controller) findCronJobJobs(ctx context.Context, client dynamic.Interface, cronJob ResourceIdentifier) ([]ResourceIdentifier, error) {
-	jobList, err := client.Resource(schema.GroupVersionResource{
+	jobList, err := c.listMetadata(ctx, client, schema.GroupVersionResource{
 		Group:    "batch",
 		Version:  "v1",
 		Resource: "jobs",
-	}).Namespace(cronJob.Namespace).List(ctx, metav1.ListOptions{})
+	}, cronJob.Namespace)
 
 	if err != nil {
 		return nil, err
 	}
 
 	var jobs []ResourceIdentifier
-	for _, job := range jobList.Items {
+	for _, job := range jobList {
 		for _, ownerRef := range job.GetOwnerReferences() {
 			if ownerRef.Kind == "CronJob" && ownerRef.Name == cronJob.ResourceName {
 				jobs = append(jobs, ResourceIdentifier{
@@ -1188,7 +1232,22 @@ func (c *Controller) addAttackPathResources(ctx context.Context, client dynamic.
 	return nil
 }
 
-// addContainerNodes adds container and image details to pods
+// containerGroups are the container lists of a pod spec with their status lists. Failing init
+// containers are a frequent cause of stuck pods, so they are shown next to the regular ones.
+var containerGroups = []struct {
+	containerType string
+	specField     string
+	statusField   string
+	idPrefix      string
+	label         string
+}{
+	{"init", "initContainers", "initContainerStatuses", "init-container", "init"},
+	{"regular", "containers", "containerStatuses", "container", "contains"},
+	{"ephemeral", "ephemeralContainers", "ephemeralContainerStatuses", "ephemeral-container", "debugs"},
+}
+
+// addContainerNodes adds container and image details to pods, covering init, sidecar and
+// ephemeral containers
 func (c *Controller) addContainerNodes(ctx context.Context, client dynamic.Interface, pod ResourceIdentifier, podNodeID string, response *GraphResponse) error {
 	// Get pod object
 	podObj, err := client.Resource(schema.GroupVersionResource{
@@ -1199,69 +1258,130 @@ func (c *Controller) addContainerNodes(ctx context.Context, client dynamic.Inter
 		return err
 	}
 
-	// Extract containers from pod spec
-	containers, found, err := unstructured.NestedSlice(podObj.Object, "spec", "containers")
-	if err != nil || !found {
-		return nil
-	}
-
-	for i, container := range containers {
-		containerMap, ok := container.(map[string]interface{})
-		if !ok {
+	for _, group := range containerGroups {
+		// Extract containers from pod spec
+		containers, found, err := unstructured.NestedSlice(podObj.Object, "spec", group.specField)
+		if err != nil || !found {
 			continue
 		}
+		statuses := containerStatuses(podObj.Object, group.statusField)
 
-		containerName, _, _ := unstructured.NestedString(containerMap, "name")
-		containerImage, _, _ := unstructured.NestedString(containerMap, "image")
+		for i, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
 
-		// Create container node
-		containerNode := Node{
-			ID:   fmt.Sprintf("container-%s-%s-%d", pod.ResourceName, containerName, i),
-			Type: "container",
-			Data: map[string]interface{}{
-				"name":      containerName,
-				"image":     containerImage,
-				"podName":   pod.ResourceName,
-				"namespace": pod.Namespace,
-			},
-		}
+			containerName, _, _ := unstructured.NestedString(containerMap, "name")
+			containerImage, _, _ := unstructured.NestedString(containerMap, "image")
 
-		response.Nodes = append(response.Nodes, containerNode)
+			// Native sidecars are init containers that keep running
+			containerType := group.containerType
+			label := group.label
+			if restartPolicy, _, _ := unstructured.NestedString(containerMap, "restartPolicy"); containerType == "init" && restartPolicy == "Always" {
+				containerType, label = "sidecar", "contains"
+			}
 
-		// Add edge from pod to container
-		response.Edges = append(response.Edges, Edge{
-			ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
-			Source: podNodeID,
-			Target: containerNode.ID,
-			Type:   "smoothstep",
-			Label:  "contains",
-		})
+			// Create container node
+			containerNode := Node{
+				ID:   fmt.Sprintf("%s-%s-%s-%d", group.idPrefix, pod.ResourceName, containerName, i),
+				Type: "container",
+				Data: map[string]interface{}{
+					"name":          containerName,
+					"image":         containerImage,
+					"podName":       pod.ResourceName,
+					"namespace":     pod.Namespace,
+					"containerType": containerType,
+				},
+			}
+			if status, ok := statuses[containerName]; ok {
+				containerNode.Data["status"] = containerStatusSummary(status)
+			}
 
-		// Create image node
-		imageNode := Node{
-			ID:   fmt.Sprintf("image-%s", fmt.Sprintf("%x", containerImage)),
-			Type: "image",
-			Data: map[string]interface{}{
-				"image":     containerImage,
-				"container": containerName,
-			},
-		}
+			response.Nodes = append(response.Nodes, containerNode)
 
-		response.Nodes = append(response.Nodes, imageNode)
+			// Add edge from pod to container
+			response.Edges = append(response.Edges, Edge{
+				ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+				Source: podNodeID,
+				Target: containerNode.ID,
+				Type:   "smoothstep",
+				Label:  label,
+			})
 
-		// Add edge from container to image
-		response.Edges = append(response.Edges, Edge{
-			ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
-			Source: containerNode.ID,
-			Target: imageNode.ID,
-			Type:   "smoothstep",
-			Label:  "uses",
-		})
+			// Create image node
+			imageNode := Node{
+				ID:   fmt.Sprintf("image-%s", fmt.Sprintf("%x", containerImage)),
+				Type: "image",
+				Data: map[string]interface{}{
+					"image":     containerImage,
+					"container": containerName,
+				},
+			}
+
+			response.Nodes = append(response.Nodes, imageNode)
+
+			// Add edge from container to image
+			response.Edges = append(response.Edges, Edge{
+				ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+				Source: containerNode.ID,
+				Target: imageNode.ID,
+				Type:   "smoothstep",
+				Label:  "uses",
+			})
+		}
 	}
 
 	return nil
 }
 
+// containerStatuses indexes a status list of a pod by container name
+func containerStatuses(pod map[string]interface{}, field string) map[string]map[string]interface{} {
+	statuses := map[string]map[string]interface{}{}
+	list, _, _ := unstructured.NestedSlice(pod, "status", field)
+	for _, item := range list {
+		status, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(status, "name"); name != "" {
+			statuses[name] = status
+		}
+	}
+	return statuses
+}
+
+// containerStatusSummary reduces a container status to its state, the reason it isn't running and
+// its restarts, e.g. waiting on CrashLoopBackOff or terminated with exit code 1
+func containerStatusSummary(status map[string]interface{}) map[string]interface{} {
+	summary := map[string]interface{}{
+		"ready":        status["ready"],
+		"restartCount": status["restartCount"],
+	}
+	for _, state := range []string{"waiting", "running", "terminated"} {
+		details, found, _ := unstructured.NestedMap(status, "state", state)
+		if !found {
+			continue
+		}
+		summary["state"] = state
+		if reason, ok := details["reason"]; ok {
+			summary["reason"] = reason
+		}
+		if message, ok := details["message"]; ok {
+			summary["message"] = message
+		}
+		if exitCode, ok := details["exitCode"]; ok {
+			summary["exitCode"] = exitCode
+		}
+		break
+	}
+	if lastTerminated, found, _ := unstructured.NestedMap(status, "lastState", "terminated"); found {
+		summary["lastTerminationReason"] = lastTerminated["reason"]
+		summary["lastExitCode"] = lastTerminated["exitCode"]
+	}
+	return summary
+}
+
 // findAndAddServices finds services that expose the given resource
 func (c *Controller) findAndAddServices(ctx context.Context, client dynamic.Interface, resource ResourceIdentifier, response *GraphResponse) error {
 	// Get all services in the namespace
@@ -1487,9 +1607,12 @@ func (c *Controller) findAndAddConfigResources(ctx context.Context, client dynam
 			}
 		}
 
-		// Check envFrom for configMaps and secrets
-		containers, found, err := unstructured.NestedSlice(podObj.Object, "spec", "containers")
-		if err == nil && found {
+		// Check envFrom of every container for configMaps and secrets
+		for _, group := range containerGroups {
+			containers, found, err := unstructured.NestedSlice(podObj.Object, "spec", group.specField)
+			if err != nil || !found {
+				continue
+			}
 			for _, container := range containers {
 				containerMap, ok := container.(map[string]interface{})
 				if !ok {
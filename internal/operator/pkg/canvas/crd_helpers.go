@@ -64,26 +64,13 @@ func (c *Controller) findResourcesByOwnerUID(
 	}
 
 	for _, gvr := range resourceTypes {
-		list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		// The owner index of the watchers answers without a LIST for the resources it covers
+		owned, err := c.ownedBy(ctx, client, ownerUID, gvr, namespace)
 		if err != nil {
 			// Ignore errors for resources that might not exist in this cluster
 			continue
 		}
-
-		for _, item := range list.Items {
-			for _, owner := range item.GetOwnerReferences() {
-				if owner.UID == ownerUID {
-					ownedResources = append(ownedResources, ResourceIdentifier{
-						Namespace:    item.GetNamespace(),
-						Group:        gvr.Group,
-						Version:      gvr.Version,
-						ResourceType: gvr.Resource,
-						ResourceName: item.GetName(),
-					})
-					break
-				}
-			}
-		}
+		ownedResources = append(ownedResources, owned...)
 	}
 
 	return ownedResources, nil
@@ -0,0 +1,258 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// GraphOptions select what the graph of a resource covers beyond the resources it manages
+type GraphOptions struct {
+	// AttackPath adds the containers, services, ingresses and configuration an attacker could go through
+	AttackPath bool
+	// CrossNamespace follows the references leaving the namespace of the resource
+	CrossNamespace bool
+	// Peers are the other clusters searched for the endpoints the services of the graph point at
+	Peers []Peer
+}
+
+// addCrossNamespaceResources follows the references leaving the namespace of a resource: the
+// services ExternalName services resolve to, the ExternalName services and ingresses of other
+// namespaces pointing at the services of the graph, and the cluster role bindings and the role
+// bindings of other namespaces granting permissions to its service accounts. Nodes of other
+// namespaces are flagged crossNamespace. References that can't be read are left out.
+func (c *Controller) addCrossNamespaceResources(ctx context.Context, client dynamic.Interface, resource ResourceIdentifier, response *GraphResponse) {
+	services := map[string]string{}
+	serviceAccounts := map[string]string{}
+	pods := []ResourceIdentifier{}
+	for _, node := range response.Nodes {
+		r, ok := nodeResource(node)
+		if !ok || r.Namespace != resource.Namespace {
+			continue
+		}
+		switch r.ResourceType {
+		case "services":
+			services[r.ResourceName] = node.ID
+		case "serviceaccounts":
+			serviceAccounts[r.ResourceName] = node.ID
+		case "pods":
+			pods = append(pods, r)
+		}
+	}
+
+	c.addExternalNameTargets(ctx, client, resource.Namespace, services, response)
+	c.addExternalNameSources(ctx, client, resource.Namespace, services, response)
+
+	// Pods show the service account they run as, whose permissions may reach other namespaces
+	for _, pod := range pods {
+		podObj, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "pods"}).
+			Namespace(pod.Namespace).Get(ctx, pod.ResourceName, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(podObj.Object, "spec", "serviceAccountName")
+		if name == "" {
+			name = "default"
+		}
+		saID, ok := serviceAccounts[name]
+		if !ok {
+			saID, ok = c.crossNamespaceNode(ctx, client, ResourceIdentifier{Namespace: pod.Namespace, Version: "v1", ResourceType: "serviceaccounts", ResourceName: name}, resource.Namespace, response)
+			if !ok {
+				continue
+			}
+			serviceAccounts[name] = saID
+		}
+		addEdgeOnce(response, saID, fmt.Sprintf("node-pod-%s", pod.ResourceName), "used-by")
+	}
+
+	for _, name := range sortedKeys(serviceAccounts) {
+		sa := ResourceIdentifier{Namespace: resource.Namespace, Version: "v1", ResourceType: "serviceaccounts", ResourceName: name}
+		c.addServiceAccountGrants(ctx, client, sa, serviceAccounts[name], response)
+	}
+}
+
+// addExternalNameTargets links the ExternalName services of the graph to the services they resolve to
+func (c *Controller) addExternalNameTargets(ctx context.Context, client dynamic.Interface, namespace string, services map[string]string, response *GraphResponse) {
+	for _, name := range sortedKeys(services) {
+		service, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"}).
+			Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		targetNamespace, targetName, ok := externalNameTarget(service)
+		if !ok {
+			continue
+		}
+		target := ResourceIdentifier{Namespace: targetNamespace, Version: "v1", ResourceType: "services", ResourceName: targetName}
+		if targetID, ok := c.crossNamespaceNode(ctx, client, target, namespace, response); ok {
+			addEdgeOnce(response, services[name], targetID, "points-to")
+		}
+	}
+}
+
+// addExternalNameSources adds the ExternalName services of other namespaces resolving to the
+// services of the graph, with the ingresses routing to them
+func (c *Controller) addExternalNameSources(ctx context.Context, client dynamic.Interface, namespace string, services map[string]string, response *GraphResponse) {
+	if len(services) == 0 {
+		return
+	}
+	serviceList, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"}).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+
+	// sources holds the IDs of the ExternalName services by namespace and name
+	sources := map[string]map[string]string{}
+	namespaces := []string{}
+	for i := range serviceList.Items {
+		service := &serviceList.Items[i]
+		if service.GetNamespace() == namespace {
+			continue
+		}
+		targetNamespace, targetName, ok := externalNameTarget(service)
+		targetID, inGraph := services[targetName]
+		if !ok || targetNamespace != namespace || !inGraph {
+			continue
+		}
+		source := ResourceIdentifier{Namespace: service.GetNamespace(), Version: "v1", ResourceType: "services", ResourceName: service.GetName()}
+		sourceID, ok := c.crossNamespaceNode(ctx, client, source, namespace, response)
+		if !ok {
+			continue
+		}
+		addEdgeOnce(response, sourceID, targetID, "points-to")
+		if sources[source.Namespace] == nil {
+			sources[source.Namespace] = map[string]string{}
+			namespaces = append(namespaces, source.Namespace)
+		}
+		sources[source.Namespace][source.ResourceName] = sourceID
+	}
+
+	for _, sourceNamespace := range namespaces {
+		sourceIDs := sources[sourceNamespace]
+		ingressList, err := client.Resource(schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}).
+			Namespace(sourceNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			continue
+		}
+		for i := range ingressList.Items {
+			ingress := &ingressList.Items[i]
+			for _, backend := range ingressBackends(ingress) {
+				sourceID, ok := sourceIDs[backend]
+				if !ok {
+					continue
+				}
+				ingressResource := ResourceIdentifier{Namespace: sourceNamespace, Group: "networking.k8s.io", Version: "v1", ResourceType: "ingresses", ResourceName: ingress.GetName()}
+				if ingressID, ok := c.crossNamespaceNode(ctx, client, ingressResource, namespace, response); ok {
+					addEdgeOnce(response, ingressID, sourceID, "routes-to")
+				}
+			}
+		}
+	}
+}
+
+// addServiceAccountGrants adds the cluster role bindings of a service account and the role bindings
+// of other namespaces binding it, with the roles they grant
+func (c *Controller) addServiceAccountGrants(ctx context.Context, client dynamic.Interface, sa ResourceIdentifier, saID string, response *GraphResponse) {
+	bindings, _ := c.findClusterRoleBindingsForServiceAccount(ctx, client, sa)
+
+	roleBindingList, err := client.Resource(schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}).
+		List(ctx, metav1.ListOptions{})
+	if err == nil {
+		for i := range roleBindingList.Items {
+			rb := &roleBindingList.Items[i]
+			if rb.GetNamespace() != sa.Namespace && bindsServiceAccount(rb, sa) {
+				bindings = append(bindings, ResourceIdentifier{
+					Namespace:    rb.GetNamespace(),
+					Group:        "rbac.authorization.k8s.io",
+					Version:      "v1",
+					ResourceType: "rolebindings",
+					ResourceName: rb.GetName(),
+				})
+			}
+		}
+	}
+
+	for _, binding := range bindings {
+		bindingID, ok := c.crossNamespaceNode(ctx, client, binding, sa.Namespace, response)
+		if !ok {
+			continue
+		}
+		addEdgeOnce(response, saID, bindingID, "bound-by")
+
+		var role *ResourceIdentifier
+		if binding.ResourceType == "clusterrolebindings" {
+			role, err = c.getClusterRoleFromClusterRoleBinding(ctx, client, binding)
+		} else {
+			role, err = c.getRoleFromRoleBinding(ctx, client, binding)
+		}
+		if err != nil || role == nil {
+			continue
+		}
+		if roleID, ok := c.crossNamespaceNode(ctx, client, *role, sa.Namespace, response); ok {
+			addEdgeOnce(response, roleID, bindingID, "grant-permissions")
+		}
+	}
+}
+
+// crossNamespaceNode returns the ID of the node of a resource, adding it unless it is already in the
+// graph. Resources of namespaces other than home get IDs qualified by their namespace, as names only
+// identify resources within a namespace.
+func (c *Controller) crossNamespaceNode(ctx context.Context, client dynamic.Interface, resource ResourceIdentifier, home string, response *GraphResponse) (string, bool) {
+	node, err := c.buildResourceNode(ctx, client, resource)
+	if err != nil {
+		return "", false
+	}
+	if resource.Namespace != "" && resource.Namespace != home {
+		node.ID = fmt.Sprintf("node-%s-%s/%s", resource.ResourceType[:len(resource.ResourceType)-1], resource.Namespace, resource.ResourceName)
+		node.Data["crossNamespace"] = true
+	}
+	if !hasNode(response, node.ID) {
+		response.Nodes = append(response.Nodes, node)
+	}
+	return node.ID, true
+}
+
+// externalNameTarget returns the in-cluster service an ExternalName service resolves to, from names
+// like web.shop, web.shop.svc or web.shop.svc.cluster.local. Clusterset names resolve to other
+// clusters and are left to the federated edges.
+func externalNameTarget(service *unstructured.Unstructured) (string, string, bool) {
+	serviceType, _, _ := unstructured.NestedString(service.Object, "spec", "type")
+	host, _, _ := unstructured.NestedString(service.Object, "spec", "externalName")
+	if serviceType != "ExternalName" || host == "" {
+		return "", "", false
+	}
+
+	host = normalizeHost(host)
+	labels := strings.Split(host, ".")
+	switch {
+	case len(labels) == 2:
+	case len(labels) >= 3 && labels[2] == "svc" && !strings.HasSuffix(host, clustersetDomain):
+	default:
+		return "", "", false
+	}
+	return labels[1], labels[0], true
+}
+
+// bindsServiceAccount reports whether a binding lists a service account among its subjects
+func bindsServiceAccount(binding *unstructured.Unstructured, sa ResourceIdentifier) bool {
+	subjects, _, _ := unstructured.NestedSlice(binding.Object, "subjects")
+	for _, subject := range subjects {
+		subjectMap, ok := subject.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(subjectMap, "kind")
+		name, _, _ := unstructured.NestedString(subjectMap, "name")
+		namespace, _, _ := unstructured.NestedString(subjectMap, "namespace")
+		if kind == "ServiceAccount" && name == sa.ResourceName && namespace == sa.Namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func externalNameService(namespace, name, host string) *unstructured.Unstructured {
+	return storageObject("v1", "Service", namespace, name, map[string]interface{}{"spec": map[string]interface{}{
+		"type":         "ExternalName",
+		"externalName": host,
+	}})
+}
+
+func TestExternalNameTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		host          string
+		wantNamespace string
+		wantName      string
+		wantOK        bool
+	}{
+		{"web.shop", "shop", "web", true},
+		{"web.shop.svc", "shop", "web", true},
+		{"Web.Shop.svc.cluster.local.", "shop", "web", true},
+		{"web.shop.svc.corp.internal", "shop", "web", true},
+		{"web.shop.svc.clusterset.local", "", "", false},
+		{"api.example.com", "", "", false},
+		{"localhost", "", "", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.host, func(t *testing.T) {
+			t.Parallel()
+
+			namespace, name, ok := externalNameTarget(externalNameService("billing", "web", tt.host))
+			if namespace != tt.wantNamespace || name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("externalNameTarget(%q) = %q, %q, %v, want %q, %q, %v", tt.host, namespace, name, ok, tt.wantNamespace, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAddCrossNamespaceResources(t *testing.T) {
+	t.Parallel()
+
+	rbac := func(kind, namespace, name, role string) *unstructured.Unstructured {
+		return storageObject("rbac.authorization.k8s.io/v1", kind, namespace, name, map[string]interface{}{
+			"roleRef":  map[string]interface{}{"kind": "ClusterRole", "name": role},
+			"subjects": []interface{}{map[string]interface{}{"kind": "ServiceAccount", "name": "web", "namespace": "shop"}},
+		})
+	}
+	listKinds := map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "services"}:                                                "ServiceList",
+		{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}:                   "IngressList",
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}:        "RoleBindingList",
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}: "ClusterRoleBindingList",
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		storageObject("v1", "Pod", "shop", "web-1", map[string]interface{}{"spec": map[string]interface{}{"serviceAccountName": "web"}}),
+		storageObject("v1", "ServiceAccount", "shop", "web", nil),
+		storageObject("v1", "Service", "shop", "web", map[string]interface{}{"spec": map[string]interface{}{"selector": map[string]interface{}{"app": "web"}}}),
+		// The shop reaches the payments API through an ExternalName service
+		externalNameService("shop", "payments", "api.payments.svc.cluster.local"),
+		storageObject("v1", "Service", "payments", "api", nil),
+		// The edge namespace routes to the shop through its own ingress
+		externalNameService("edge", "web", "web.shop"),
+		storageObject("networking.k8s.io/v1", "Ingress", "edge", "public", map[string]interface{}{"spec": map[string]interface{}{
+			"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}},
+		}}),
+		rbac("ClusterRoleBinding", "", "web-view", "view"),
+		storageObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "view", nil),
+		rbac("RoleBinding", "payments", "web-reader", "view"),
+		// Role bindings of the namespace itself are not cross-namespace
+		rbac("RoleBinding", "shop", "web-local", "view"),
+	)
+
+	c := &Controller{}
+	response := &GraphResponse{}
+	for _, r := range []ResourceIdentifier{
+		{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"},
+		{Namespace: "shop", Version: "v1", ResourceType: "pods", ResourceName: "web-1"},
+		{Namespace: "shop", Version: "v1", ResourceType: "services", ResourceName: "web"},
+		{Namespace: "shop", Version: "v1", ResourceType: "services", ResourceName: "payments"},
+	} {
+		response.Nodes = append(response.Nodes, c.resourceNode(r, &unstructured.Unstructured{}))
+	}
+	c.addCrossNamespaceResources(context.Background(), client, ResourceIdentifier{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"}, response)
+
+	want := []string{
+		"node-clusterrole-view grant-permissions node-clusterrolebinding-web-view",
+		"node-clusterrole-view grant-permissions node-rolebinding-payments/web-reader",
+		"node-ingresse-edge/public routes-to node-service-edge/web",
+		"node-service-edge/web points-to node-service-web",
+		"node-service-payments points-to node-service-payments/api",
+		"node-serviceaccount-web bound-by node-clusterrolebinding-web-view",
+		"node-serviceaccount-web bound-by node-rolebinding-payments/web-reader",
+		"node-serviceaccount-web used-by node-pod-web-1",
+	}
+	if got := edgeLabels(response.Edges); !reflect.DeepEqual(got, want) {
+		t.Errorf("edges = %v, want %v", got, want)
+	}
+
+	for _, node := range response.Nodes {
+		_, flagged := node.Data["crossNamespace"]
+		r, _ := nodeResource(node)
+		if wantFlag := r.Namespace != "" && r.Namespace != "shop"; flagged != wantFlag {
+			t.Errorf("node %s crossNamespace = %v, want %v", node.ID, flagged, wantFlag)
+		}
+	}
+}
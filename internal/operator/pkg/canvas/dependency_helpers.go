@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/agentkube/operator/pkg/redact"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -23,7 +24,7 @@ func (b *DependencyGraphBuilder) buildDependencyNode(ctx context.Context, resour
 		"version":      resource.Version,
 		"resourceType": resource.ResourceType,
 		"resourceName": resource.ResourceName,
-		"labels":       obj.GetLabels(),
+		"labels":       redact.Map(obj.GetLabels()),
 		"createdAt":    obj.GetCreationTimestamp().String(),
 	}
 
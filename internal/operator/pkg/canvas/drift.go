@@ -0,0 +1,95 @@
+package canvas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/agentkube/operator/pkg/objectdiff"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Sources of the desired state of a drift report
+const (
+	DriftSourceManifest    = "manifest"
+	DriftSourceLastApplied = "last-applied"
+)
+
+// ErrNoDesiredState is returned for drift checks without a manifest of objects never applied with kubectl apply
+var ErrNoDesiredState = errors.New("no manifest given and the object has no last-applied configuration")
+
+// DriftReport lists where a live object drifted from its desired state
+type DriftReport struct {
+	Resource ResourceIdentifier `json:"resource"`
+	// Source of the desired state, the given manifest or the last-applied configuration
+	Source  string                   `json:"source"`
+	Drifted bool                     `json:"drifted"`
+	Changes []objectdiff.DriftChange `json:"changes"`
+}
+
+// GetDrift compares a live object to a manifest, or to its last-applied configuration without one.
+// Given a manifest, the fields the last-applied configuration holds and the manifest dropped are
+// reported as pruned.
+func (c *Controller) GetDrift(ctx context.Context, resource ResourceIdentifier, manifest map[string]interface{}) (*DriftReport, error) {
+	dynamicClient, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	live, err := dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    resource.Group,
+		Version:  resource.Version,
+		Resource: resource.ResourceType,
+	}).Namespace(resource.Namespace).Get(ctx, resource.ResourceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return driftReport(resource, live, manifest)
+}
+
+func driftReport(resource ResourceIdentifier, live *unstructured.Unstructured, manifest map[string]interface{}) (*DriftReport, error) {
+	lastApplied, err := lastAppliedConfiguration(live)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{Resource: resource, Source: DriftSourceManifest}
+	if manifest == nil {
+		if lastApplied == nil {
+			return nil, ErrNoDesiredState
+		}
+		report.Source = DriftSourceLastApplied
+		report.Changes = objectdiff.Drift(lastApplied, live.Object, nil)
+	} else {
+		report.Changes = objectdiff.Drift(manifest, live.Object, lastApplied)
+	}
+	report.Drifted = len(report.Changes) > 0
+	return report, nil
+}
+
+// lastAppliedConfiguration returns the manifest kubectl apply last applied to an object, nil when
+// it wasn't applied with kubectl apply
+func lastAppliedConfiguration(obj *unstructured.Unstructured) (map[string]interface{}, error) {
+	data, ok := obj.GetAnnotations()[objectdiff.LastAppliedAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var lastApplied map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &lastApplied); err != nil {
+		return nil, fmt.Errorf("invalid last-applied configuration: %v", err)
+	}
+	return lastApplied, nil
+}
+
+// driftBadge reports whether an object drifted from its last-applied configuration, ok is false
+// for objects without one
+func driftBadge(obj *unstructured.Unstructured) (drifted, ok bool) {
+	lastApplied, err := lastAppliedConfiguration(obj)
+	if err != nil || lastApplied == nil {
+		return false, false
+	}
+	return len(objectdiff.Drift(lastApplied, obj.Object, nil)) > 0, true
+}
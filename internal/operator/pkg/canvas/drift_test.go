@@ -0,0 +1,48 @@
+package canvas
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/objectdiff"
+)
+
+func TestDriftReport(t *testing.T) {
+	t.Parallel()
+
+	resource := ResourceIdentifier{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"}
+	live := storageObject("apps/v1", "Deployment", "shop", "web", map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": int64(5), "paused": true},
+	})
+	live.SetAnnotations(map[string]string{
+		objectdiff.LastAppliedAnnotation: `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"shop"},"spec":{"replicas":2,"paused":true}}`,
+	})
+
+	report, err := driftReport(resource, live, nil)
+	if err != nil {
+		t.Fatalf("driftReport() error = %v", err)
+	}
+	if report.Source != DriftSourceLastApplied || !report.Drifted || len(report.Changes) != 1 || report.Changes[0].Path != "spec.replicas" {
+		t.Errorf("driftReport() = %+v, want spec.replicas drifted from the last-applied configuration", report)
+	}
+
+	manifest := map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(5)}}
+	report, err = driftReport(resource, live, manifest)
+	if err != nil {
+		t.Fatalf("driftReport() error = %v", err)
+	}
+	if report.Source != DriftSourceManifest || len(report.Changes) != 1 || report.Changes[0].Type != objectdiff.Pruned || report.Changes[0].Path != "spec.paused" {
+		t.Errorf("driftReport() = %+v, want only spec.paused pruned by the manifest", report)
+	}
+	if drifted, ok := driftBadge(live); !ok || !drifted {
+		t.Errorf("driftBadge() = %v, %v, want a drifted badge", drifted, ok)
+	}
+
+	live.SetAnnotations(nil)
+	if _, err := driftReport(resource, live, nil); !errors.Is(err, ErrNoDesiredState) {
+		t.Errorf("driftReport() without last-applied configuration error = %v, want ErrNoDesiredState", err)
+	}
+	if _, ok := driftBadge(live); ok {
+		t.Error("driftBadge() badged an object never applied with kubectl apply")
+	}
+}
@@ -0,0 +1,113 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Exposure levels of a pod, from the most to the least reachable
+const (
+	// ExposureInternet pods are routed to by an ingress, a load balancer or an external IP
+	ExposureInternet = "internet"
+	// ExposureNode pods are reachable on a node port
+	ExposureNode = "node"
+	// ExposureCluster pods are only reachable through cluster IP services
+	ExposureCluster = "cluster"
+	// ExposureNone pods are selected by no service
+	ExposureNone = "none"
+)
+
+var exposureRanks = map[string]int{ExposureNone: 0, ExposureCluster: 1, ExposureNode: 2, ExposureInternet: 3}
+
+// MoreExposed reports whether pods of level a are more reachable than pods of level b
+func MoreExposed(a, b string) bool {
+	return exposureRanks[a] > exposureRanks[b]
+}
+
+// Exposure resolves how reachable pods are from the services and ingresses of a cluster
+type Exposure struct {
+	services []exposedService
+}
+
+type exposedService struct {
+	namespace string
+	selector  map[string]string
+	level     string
+}
+
+// GetExposure lists the services and ingresses of a namespace, or of every namespace when empty,
+// to resolve the exposure of its pods
+func (c *Controller) GetExposure(ctx context.Context, namespace string) (*Exposure, error) {
+	client, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	lists := map[string][]unstructured.Unstructured{}
+	for _, gvr := range []schema.GroupVersionResource{
+		{Version: "v1", Resource: "services"},
+		{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	} {
+		list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			// Without ingresses, or the right to list them, pods are exposed by their services alone
+			if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list %s: %v", gvr.Resource, err)
+		}
+		lists[gvr.Resource] = list.Items
+	}
+	return newExposure(lists["services"], lists["ingresses"]), nil
+}
+
+func newExposure(services, ingresses []unstructured.Unstructured) *Exposure {
+	routed := map[string]bool{}
+	for i := range ingresses {
+		for _, name := range ingressBackends(&ingresses[i]) {
+			routed[ingresses[i].GetNamespace()+"/"+name] = true
+		}
+	}
+
+	exposure := &Exposure{}
+	for i := range services {
+		service := &services[i]
+		selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+		// Services without a selector, like ExternalName ones, select no pods
+		if len(selector) == 0 {
+			continue
+		}
+		level := ExposureCluster
+		serviceType, _, _ := unstructured.NestedString(service.Object, "spec", "type")
+		externalIPs, _, _ := unstructured.NestedStringSlice(service.Object, "spec", "externalIPs")
+		switch {
+		case serviceType == "LoadBalancer" || len(externalIPs) > 0 || routed[service.GetNamespace()+"/"+service.GetName()]:
+			level = ExposureInternet
+		case serviceType == "NodePort":
+			level = ExposureNode
+		}
+		exposure.services = append(exposure.services, exposedService{
+			namespace: service.GetNamespace(),
+			selector:  selector,
+			level:     level,
+		})
+	}
+	return exposure
+}
+
+// Of returns the exposure level of a pod, the highest of the services selecting it
+func (e *Exposure) Of(namespace string, labels map[string]string) string {
+	level := ExposureNone
+	for _, service := range e.services {
+		if service.namespace == namespace && matchLabels(service.selector, labels) && MoreExposed(service.level, level) {
+			level = service.level
+		}
+	}
+	return level
+}
@@ -0,0 +1,55 @@
+package canvas
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExposureOf(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, serviceType string, selector map[string]interface{}) unstructured.Unstructured {
+		spec := map[string]interface{}{"type": serviceType}
+		if selector != nil {
+			spec["selector"] = selector
+		}
+		return testObject("Service", name, name, nil, map[string]interface{}{"spec": spec})
+	}
+	services := []unstructured.Unstructured{
+		service("web", "ClusterIP", map[string]interface{}{"app": "web"}),
+		service("api", "ClusterIP", map[string]interface{}{"app": "api"}),
+		service("api-debug", "NodePort", map[string]interface{}{"app": "api"}),
+		service("db", "ClusterIP", map[string]interface{}{"app": "db"}),
+		service("lb", "LoadBalancer", map[string]interface{}{"app": "edge"}),
+		service("external", "ExternalName", nil),
+	}
+	ingresses := []unstructured.Unstructured{testObject("Ingress", "web", "ing", nil, map[string]interface{}{"spec": map[string]interface{}{
+		"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}},
+	}})}
+	exposure := newExposure(services, ingresses)
+
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		want      string
+	}{
+		{name: "routed by an ingress", namespace: "shop", labels: map[string]string{"app": "web"}, want: ExposureInternet},
+		{name: "load balancer", namespace: "shop", labels: map[string]string{"app": "edge"}, want: ExposureInternet},
+		{name: "highest of its services", namespace: "shop", labels: map[string]string{"app": "api"}, want: ExposureNode},
+		{name: "cluster IP", namespace: "shop", labels: map[string]string{"app": "db"}, want: ExposureCluster},
+		{name: "no service", namespace: "shop", labels: map[string]string{"app": "batch"}, want: ExposureNone},
+		{name: "other namespace", namespace: "staging", labels: map[string]string{"app": "web"}, want: ExposureNone},
+		{name: "no labels", namespace: "shop", want: ExposureNone},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := exposure.Of(tt.namespace, tt.labels); got != tt.want {
+				t.Errorf("Of() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// EdgeTypeFederated is the type of the edges from a service to the services of other clusters it
+// points at
+const EdgeTypeFederated = "federated"
+
+// clustersetDomain is the domain of the services exported across clusters by the Multi-Cluster
+// Services API
+const clustersetDomain = "svc.clusterset.local"
+
+// Peer is another cluster the services of a graph may point at
+type Peer struct {
+	Name       string
+	RESTConfig *rest.Config
+}
+
+// addFederatedEdges links the services of the graph to the services of the peers they point at,
+// through ExternalName services naming a clusterset service or a load balancer of the peer, or
+// selectorless services whose endpoints are addresses of the peer. Peers that can't be listed are
+// skipped.
+func (c *Controller) addFederatedEdges(ctx context.Context, client dynamic.Interface, response *GraphResponse, peers []Peer) {
+	type localService struct {
+		nodeID    string
+		addresses []string
+	}
+	locals := []localService{}
+	for _, node := range response.Nodes {
+		r, ok := nodeResource(node)
+		if !ok || r.ResourceType != "services" || node.Data["crossNamespace"] == true {
+			continue
+		}
+		service, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"}).
+			Namespace(r.Namespace).Get(ctx, r.ResourceName, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		if addresses := c.serviceTargets(ctx, client, service); len(addresses) > 0 {
+			locals = append(locals, localService{nodeID: node.ID, addresses: addresses})
+		}
+	}
+	if len(locals) == 0 {
+		return
+	}
+
+	for _, peer := range peers {
+		peerClient, err := dynamic.NewForConfig(peer.RESTConfig)
+		if err != nil {
+			continue
+		}
+		serviceList, err := peerClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "services"}).
+			List(ctx, metav1.ListOptions{})
+		if err != nil {
+			continue
+		}
+		for _, local := range locals {
+			for _, remote := range federatedMatches(local.addresses, serviceList.Items) {
+				remoteID := c.addPeerServiceNode(peer.Name, remote, response)
+				i := addEdgeOnce(response, local.nodeID, remoteID, "federated-to")
+				response.Edges[i].Type = EdgeTypeFederated
+				setData(&response.Edges[i].Data, "cluster", peer.Name)
+			}
+		}
+	}
+}
+
+// serviceTargets returns the host names and addresses a service forwards to outside of the pods it
+// selects: the name of an ExternalName service, or the endpoint addresses of a service without selector
+func (c *Controller) serviceTargets(ctx context.Context, client dynamic.Interface, service *unstructured.Unstructured) []string {
+	if host, _, _ := unstructured.NestedString(service.Object, "spec", "externalName"); host != "" {
+		return []string{normalizeHost(host)}
+	}
+	if selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector"); len(selector) > 0 {
+		return nil
+	}
+
+	sliceList, err := client.Resource(schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}).
+		Namespace(service.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: "kubernetes.io/service-name=" + service.GetName()})
+	if err != nil {
+		return nil
+	}
+	addresses := []string{}
+	for _, slice := range sliceList.Items {
+		endpoints, _, _ := unstructured.NestedSlice(slice.Object, "endpoints")
+		for _, endpoint := range endpoints {
+			endpointMap, ok := endpoint.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			values, _, _ := unstructured.NestedStringSlice(endpointMap, "addresses")
+			for _, value := range values {
+				addresses = append(addresses, normalizeHost(value))
+			}
+		}
+	}
+	return addresses
+}
+
+// federatedMatches returns the services of a peer reachable through one of the addresses: under
+// their clusterset name, their load balancer ingresses or their external IPs
+func federatedMatches(addresses []string, services []unstructured.Unstructured) []*unstructured.Unstructured {
+	wanted := map[string]bool{}
+	for _, address := range addresses {
+		wanted[address] = true
+	}
+
+	matches := []*unstructured.Unstructured{}
+	for i := range services {
+		for _, address := range peerAddresses(&services[i]) {
+			if wanted[address] {
+				matches = append(matches, &services[i])
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// peerAddresses returns the names and addresses a service of a peer is reachable at from other clusters
+func peerAddresses(service *unstructured.Unstructured) []string {
+	addresses := []string{fmt.Sprintf("%s.%s.%s", service.GetName(), service.GetNamespace(), clustersetDomain)}
+	ingresses, _, _ := unstructured.NestedSlice(service.Object, "status", "loadBalancer", "ingress")
+	for _, ingress := range ingresses {
+		ingressMap, ok := ingress.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"ip", "hostname"} {
+			if value, _, _ := unstructured.NestedString(ingressMap, field); value != "" {
+				addresses = append(addresses, normalizeHost(value))
+			}
+		}
+	}
+	externalIPs, _, _ := unstructured.NestedStringSlice(service.Object, "spec", "externalIPs")
+	for _, ip := range externalIPs {
+		addresses = append(addresses, normalizeHost(ip))
+	}
+	return addresses
+}
+
+// addPeerServiceNode adds the node of a service of a peer, its ID is qualified by the peer as names
+// only identify services within a cluster
+func (c *Controller) addPeerServiceNode(peer string, service *unstructured.Unstructured, response *GraphResponse) string {
+	resource := ResourceIdentifier{Namespace: service.GetNamespace(), Version: "v1", ResourceType: "services", ResourceName: service.GetName()}
+	node := c.resourceNode(resource, service)
+	node.ID = fmt.Sprintf("node-service-%s:%s/%s", peer, resource.Namespace, resource.ResourceName)
+	node.Data["cluster"] = peer
+	if !hasNode(response, node.ID) {
+		response.Nodes = append(response.Nodes, node)
+	}
+	return node.ID
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
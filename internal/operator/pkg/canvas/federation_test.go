@@ -0,0 +1,53 @@
+package canvas
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFederatedMatches(t *testing.T) {
+	t.Parallel()
+
+	loadBalancer := func(name string, ingress map[string]interface{}) unstructured.Unstructured {
+		return *storageObject("v1", "Service", "shop", name, map[string]interface{}{
+			"status": map[string]interface{}{"loadBalancer": map[string]interface{}{"ingress": []interface{}{ingress}}},
+		})
+	}
+	services := []unstructured.Unstructured{
+		loadBalancer("web", map[string]interface{}{"hostname": "Web-123.elb.amazonaws.com"}),
+		loadBalancer("api", map[string]interface{}{"ip": "203.0.113.10"}),
+		*storageObject("v1", "Service", "payments", "gateway", map[string]interface{}{"spec": map[string]interface{}{
+			"externalIPs": []interface{}{"198.51.100.7"},
+		}}),
+		*storageObject("v1", "Service", "shop", "cart", nil),
+	}
+
+	tests := []struct {
+		name      string
+		addresses []string
+		want      []string
+	}{
+		{"load balancer hostname", []string{normalizeHost("web-123.elb.amazonaws.com.")}, []string{"shop/web"}},
+		{"load balancer ip", []string{"203.0.113.10"}, []string{"shop/api"}},
+		{"external ip", []string{"10.0.0.1", "198.51.100.7"}, []string{"payments/gateway"}},
+		{"clusterset name", []string{"cart.shop.svc.clusterset.local"}, []string{"shop/cart"}},
+		{"no match", []string{"10.0.0.1"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []string{}
+			for _, service := range federatedMatches(tt.addresses, services) {
+				got = append(got, service.GetNamespace()+"/"+service.GetName())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("federatedMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
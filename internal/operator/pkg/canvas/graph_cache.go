@@ -0,0 +1,106 @@
+package canvas
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/cache"
+	"github.com/agentkube/operator/pkg/event"
+)
+
+// GraphCacheTTL bounds how long a graph is served from the cache. Watcher events drop graphs sooner,
+// the TTL covers the changes the watchers don't report, e.g. of kinds they don't watch.
+const GraphCacheTTL = 2 * time.Minute
+
+// graphCache holds the graphs built by GetCachedGraphNodes, keyed by graphCacheKey
+var graphCache = cache.New[*GraphResponse]()
+
+// graphCacheKey starts with the cluster and namespace, the scope of the invalidations. Context names
+// are escaped as they may hold the separator. Graphs reaching into other namespaces or clusters are
+// only dropped by the events of their own namespace, they expire with the TTL otherwise.
+func graphCacheKey(clusterName string, resource ResourceIdentifier, opts GraphOptions) string {
+	return graphCachePrefix(clusterName, resource.Namespace) + strings.Join([]string{
+		resource.Group, resource.Version, resource.ResourceType, resource.ResourceName,
+		strconv.FormatBool(opts.AttackPath), strconv.FormatBool(opts.CrossNamespace), strconv.FormatBool(len(opts.Peers) > 0),
+	}, "|")
+}
+
+func graphCachePrefix(clusterName, namespace string) string {
+	return url.QueryEscape(clusterName) + "|" + namespace + "|"
+}
+
+// GetCachedGraphNodes returns the graph of a resource from the cache, building it when it is missing,
+// expired or refresh is set. The graph is a copy the caller may annotate.
+func (c *Controller) GetCachedGraphNodes(ctx context.Context, clusterName string, resource ResourceIdentifier, opts GraphOptions, refresh bool) (*GraphResponse, error) {
+	key := graphCacheKey(clusterName, resource, opts)
+	if !refresh {
+		if graph, err := graphCache.Get(ctx, key); err == nil {
+			return graph.clone(), nil
+		}
+	}
+
+	graph, err := c.GetGraphNodes(ctx, resource, opts)
+	if err != nil {
+		return nil, err
+	}
+	graphCache.SetWithTTL(ctx, key, graph.clone(), GraphCacheTTL)
+	return graph, nil
+}
+
+// InvalidateGraphs drops the cached graphs a watcher event may change: the graphs of its namespace
+// and of cluster-scoped resources, e.g. nodes showing their pods. Events of cluster-scoped resources
+// only drop the graphs of cluster-scoped resources, namespaced graphs showing them expire.
+func InvalidateGraphs(e event.Event) {
+	prefixes := []string{graphCachePrefix(e.Host, "")}
+	if e.Namespace != "" {
+		prefixes = append(prefixes, graphCachePrefix(e.Host, e.Namespace))
+	}
+
+	ctx := context.Background()
+	stale, _ := graphCache.GetAll(ctx, func(key string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+	for key := range stale {
+		graphCache.Delete(ctx, key)
+	}
+}
+
+// clone copies a graph down to the data of its nodes and edges, which annotations add to
+func (g *GraphResponse) clone() *GraphResponse {
+	clone := &GraphResponse{
+		Nodes: make([]Node, len(g.Nodes)),
+		Edges: make([]Edge, len(g.Edges)),
+	}
+	if g.AttackPath != nil {
+		path := *g.AttackPath
+		clone.AttackPath = &path
+	}
+	for i, node := range g.Nodes {
+		node.Data = copyData(node.Data)
+		clone.Nodes[i] = node
+	}
+	for i, edge := range g.Edges {
+		edge.Data = copyData(edge.Data)
+		clone.Edges[i] = edge
+	}
+	return clone
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		copied[key] = value
+	}
+	return copied
+}
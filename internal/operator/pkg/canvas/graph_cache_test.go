@@ -0,0 +1,82 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/event"
+)
+
+func TestInvalidateGraphs(t *testing.T) {
+	ctx := context.Background()
+	resources := map[string]ResourceIdentifier{
+		"shop deployment":  {Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"},
+		"billing service":  {Namespace: "billing", Version: "v1", ResourceType: "services", ResourceName: "api"},
+		"node":             {Version: "v1", ResourceType: "nodes", ResourceName: "node-a"},
+		"other cluster":    {Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"},
+		"cluster prefixed": {Namespace: "shop", Version: "v1", ResourceType: "services", ResourceName: "web"},
+	}
+	clusters := map[string]string{"other cluster": "staging", "cluster prefixed": "prod|shop"}
+
+	tests := []struct {
+		name      string
+		event     event.Event
+		wantStale []string
+	}{
+		{"namespaced event", event.Event{Host: "prod", Namespace: "shop", Kind: "pod"}, []string{"shop deployment", "node"}},
+		{"cluster-scoped event", event.Event{Host: "prod", Kind: "node"}, []string{"node"}},
+		{"other cluster", event.Event{Host: "dev", Namespace: "shop", Kind: "pod"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := map[string]string{}
+			for name, resource := range resources {
+				cluster, ok := clusters[name]
+				if !ok {
+					cluster = "prod"
+				}
+				keys[name] = graphCacheKey(cluster, resource, GraphOptions{})
+				graphCache.SetWithTTL(ctx, keys[name], &GraphResponse{}, GraphCacheTTL)
+			}
+
+			InvalidateGraphs(tt.event)
+
+			stale := map[string]bool{}
+			for _, name := range tt.wantStale {
+				stale[name] = true
+			}
+			for name, key := range keys {
+				_, err := graphCache.Get(ctx, key)
+				if cached := err == nil; cached == stale[name] {
+					t.Errorf("graph of %s cached = %v, want %v", name, cached, !stale[name])
+				}
+				graphCache.Delete(ctx, key)
+			}
+		})
+	}
+}
+
+func TestGraphClone(t *testing.T) {
+	t.Parallel()
+
+	graph := &GraphResponse{
+		Nodes:      []Node{{ID: "node-deployment-web", Data: map[string]interface{}{"resourceName": "web"}}},
+		Edges:      []Edge{{ID: "edge-1", Source: "node-deployment-web", Target: "node-service-web"}},
+		AttackPath: &AttackPath{Nodes: []string{"node-service-web", "node-deployment-web"}, Edges: []string{"edge-1"}, Risk: 5},
+	}
+	clone := graph.clone()
+	clone.Nodes[0].Data["policyFindings"] = []string{"privileged"}
+	clone.Edges = append(clone.Edges, Edge{ID: "traffic-1"})
+
+	if _, ok := graph.Nodes[0].Data["policyFindings"]; ok {
+		t.Errorf("annotating the clone changed the node data of the graph")
+	}
+	if len(graph.Edges) != 1 {
+		t.Errorf("graph edges = %d, want 1", len(graph.Edges))
+	}
+	if !reflect.DeepEqual(clone.AttackPath, graph.AttackPath) {
+		t.Errorf("clone attack path = %v, want %v", clone.AttackPath, graph.AttackPath)
+	}
+}
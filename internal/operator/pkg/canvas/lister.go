@@ -0,0 +1,90 @@
+package canvas
+
+import (
+	"context"
+
+	"github.com/agentkube/operator/pkg/index"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// MetadataLister lists the objects of a resource in a namespace from a local cache, such as the
+// informers of the cluster watchers, sparing the API server a LIST per graph. The objects may carry
+// their metadata only, so the graph helpers using it read nothing else.
+type MetadataLister interface {
+	// ListMetadata returns false when the resource isn't cached and synced for the namespace
+	ListMetadata(gvr schema.GroupVersionResource, namespace string) ([]metav1.Object, bool)
+}
+
+// OwnerIndex is implemented by listers that also index owner references, answering which objects an
+// owner has without listing every resource type that may hold them
+type OwnerIndex interface {
+	// Children returns false when the resource isn't indexed and synced for the namespace
+	Children(owner types.UID, gvr schema.GroupVersionResource, namespace string) ([]index.Ref, bool)
+}
+
+// WithLister makes graph generation read owner references and labels from the lister, falling
+// back to the API for the resources it doesn't cache
+func (c *Controller) WithLister(lister MetadataLister) *Controller {
+	c.lister = lister
+	return c
+}
+
+// listMetadata lists the objects of a resource in a namespace, from the lister when it caches them
+func (c *Controller) listMetadata(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) ([]metav1.Object, error) {
+	if c.lister != nil {
+		if objects, ok := c.lister.ListMetadata(gvr, namespace); ok {
+			return objects, nil
+		}
+	}
+
+	list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]metav1.Object, len(list.Items))
+	for i := range list.Items {
+		objects[i] = &list.Items[i]
+	}
+	return objects, nil
+}
+
+// ownedBy returns the objects of a resource in a namespace an owner owns, from the owner index of
+// the lister when it has one, listing the resource otherwise
+func (c *Controller) ownedBy(ctx context.Context, client dynamic.Interface, owner types.UID, gvr schema.GroupVersionResource, namespace string) ([]ResourceIdentifier, error) {
+	owned := []ResourceIdentifier{}
+	add := func(namespace, name string) {
+		owned = append(owned, ResourceIdentifier{
+			Namespace:    namespace,
+			Group:        gvr.Group,
+			Version:      gvr.Version,
+			ResourceType: gvr.Resource,
+			ResourceName: name,
+		})
+	}
+
+	if ownerIndex, ok := c.lister.(OwnerIndex); ok {
+		if refs, ok := ownerIndex.Children(owner, gvr, namespace); ok {
+			for _, ref := range refs {
+				add(ref.Namespace, ref.Name)
+			}
+			return owned, nil
+		}
+	}
+
+	objects, err := c.listMetadata(ctx, client, gvr, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		for _, ref := range object.GetOwnerReferences() {
+			if ref.UID == owner {
+				add(object.GetNamespace(), object.GetName())
+				break
+			}
+		}
+	}
+	return owned, nil
+}
@@ -0,0 +1,136 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/index"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// testLister caches the objects of the resources in the namespaces keyed resource/namespace
+type testLister map[string][]metav1.Object
+
+func (l testLister) ListMetadata(gvr schema.GroupVersionResource, namespace string) ([]metav1.Object, bool) {
+	objects, ok := l[gvr.Resource+"/"+namespace]
+	return objects, ok
+}
+
+// indexedLister also answers the children of owners, for the resources in the namespaces it caches
+type indexedLister struct {
+	testLister
+	children map[types.UID][]index.Ref
+}
+
+func (l indexedLister) Children(owner types.UID, gvr schema.GroupVersionResource, namespace string) ([]index.Ref, bool) {
+	if _, ok := l.testLister[gvr.Resource+"/"+namespace]; !ok {
+		return nil, false
+	}
+	return l.children[owner], true
+}
+
+func TestListMetadata(t *testing.T) {
+	t.Parallel()
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	listed := func(namespace, name string) *unstructured.Unstructured {
+		pod := &unstructured.Unstructured{}
+		pod.SetAPIVersion("v1")
+		pod.SetKind("Pod")
+		pod.SetNamespace(namespace)
+		pod.SetName(name)
+		return pod
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pods: "PodList"},
+		listed("shop", "listed-shop"), listed("billing", "listed-billing"))
+	lister := testLister{"pods/shop": {&metav1.ObjectMeta{Namespace: "shop", Name: "cached-shop"}}}
+
+	tests := []struct {
+		name      string
+		lister    MetadataLister
+		namespace string
+		want      []string
+	}{
+		{"cached namespace", lister, "shop", []string{"cached-shop"}},
+		{"uncached namespace", lister, "billing", []string{"listed-billing"}},
+		{"without lister", nil, "shop", []string{"listed-shop"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Controller{}
+			if tt.lister != nil {
+				c.WithLister(tt.lister)
+			}
+			objects, err := c.listMetadata(context.Background(), client, pods, tt.namespace)
+			if err != nil {
+				t.Fatalf("listMetadata() error = %v", err)
+			}
+			var names []string
+			for _, object := range objects {
+				names = append(names, object.GetName())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("listMetadata() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	t.Parallel()
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	owned := func(name string, owner types.UID) *metav1.ObjectMeta {
+		return &metav1.ObjectMeta{Namespace: "shop", Name: name, OwnerReferences: []metav1.OwnerReference{{UID: owner}}}
+	}
+	cached := testLister{"pods/shop": {owned("web-1", "rs-web"), owned("api-1", "rs-api"), owned("web-2", "rs-web")}}
+	indexed := indexedLister{
+		testLister: cached,
+		children:   map[types.UID][]index.Ref{"rs-web": {{Version: "v1", Resource: "pods", Namespace: "shop", Name: "indexed-web"}}},
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pods: "PodList"})
+
+	tests := []struct {
+		name   string
+		lister MetadataLister
+		want   []string
+	}{
+		{"owner index", indexed, []string{"indexed-web"}},
+		{"owner references of the cache", cached, []string{"web-1", "web-2"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := (&Controller{}).WithLister(tt.lister)
+			resources, err := c.ownedBy(context.Background(), client, "rs-web", pods, "shop")
+			if err != nil {
+				t.Fatalf("ownedBy() error = %v", err)
+			}
+			var names []string
+			for _, r := range resources {
+				if r.Namespace != "shop" || r.ResourceType != "pods" {
+					t.Errorf("ownedBy() resource = %+v, want a pod of shop", r)
+				}
+				names = append(names, r.ResourceName)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ownedBy() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
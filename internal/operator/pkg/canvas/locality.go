@@ -0,0 +1,531 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Kinds of volumes tied to nodes
+const (
+	LocalityLocal        = "local"
+	LocalityHostPath     = "hostPath"
+	LocalityNodeAffinity = "nodeAffinity"
+)
+
+// VolumeLocality is a persistent volume only usable from some nodes
+type VolumeLocality struct {
+	PersistentVolume string `json:"persistentVolume"`
+	// Claim is the bound claim, namespace/name
+	Claim        string `json:"claim,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+	Kind         string `json:"kind"`
+	// Nodes are the nodes the volume can be used from, empty for host paths without node affinity
+	Nodes []string `json:"nodes"`
+	// Pinned is set when a single node can use the volume
+	Pinned bool `json:"pinned"`
+}
+
+// PinnedPod is a pod whose volumes restrict the nodes it can run on
+type PinnedPod struct {
+	Name string `json:"name"`
+	Node string `json:"node,omitempty"`
+	// Nodes are the nodes every volume of the pod can be used from
+	Nodes   []string `json:"nodes"`
+	Volumes []string `json:"volumes"`
+	// Stranded is set when none of the nodes is ready and schedulable
+	Stranded bool `json:"stranded"`
+}
+
+// PinnedWorkload is a workload with pods that can't be rescheduled to any node
+type PinnedWorkload struct {
+	Namespace string      `json:"namespace"`
+	Kind      string      `json:"kind"`
+	Name      string      `json:"name"`
+	Pods      []PinnedPod `json:"pods"`
+	// Pinned is set when a pod can only run on a single node
+	Pinned   bool   `json:"pinned"`
+	Stranded bool   `json:"stranded"`
+	Reason   string `json:"reason"`
+}
+
+// NodeLocality is the data held by a node
+type NodeLocality struct {
+	Name        string   `json:"name"`
+	Ready       bool     `json:"ready"`
+	Schedulable bool     `json:"schedulable"`
+	Volumes     []string `json:"volumes"`
+	// Workloads are the workloads with a pod only able to run on this node, namespace/kind/name
+	Workloads []string `json:"workloads"`
+}
+
+// LocalityReport tells which nodes hold data and which workloads can't move away from them
+type LocalityReport struct {
+	Volumes   []VolumeLocality `json:"volumes"`
+	Nodes     []NodeLocality   `json:"nodes"`
+	Workloads []PinnedWorkload `json:"workloads"`
+}
+
+// DrainImpact returns the workloads with a pod that can't run anywhere else once the node is drained
+func (r *LocalityReport) DrainImpact(node string) []PinnedWorkload {
+	available := map[string]bool{}
+	for _, n := range r.Nodes {
+		available[n.Name] = n.Ready && n.Schedulable && n.Name != node
+	}
+
+	impacted := []PinnedWorkload{}
+	for _, workload := range r.Workloads {
+		pods := []PinnedPod{}
+		for _, pod := range workload.Pods {
+			movable := false
+			for _, n := range pod.Nodes {
+				movable = movable || available[n]
+			}
+			if !movable && contains(pod.Nodes, node) {
+				pods = append(pods, pod)
+			}
+		}
+		if len(pods) > 0 {
+			workload.Pods = pods
+			impacted = append(impacted, workload)
+		}
+	}
+	return impacted
+}
+
+// GetDataLocality reports the volumes tied to nodes and the workloads they pin, all namespaces when
+// namespace is empty
+func (c *Controller) GetDataLocality(ctx context.Context, namespace string) (*LocalityReport, error) {
+	client, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	return c.dataLocality(ctx, client, namespace)
+}
+
+func (c *Controller) dataLocality(ctx context.Context, client dynamic.Interface, namespace string) (*LocalityReport, error) {
+	list := func(resource, namespace string) ([]unstructured.Unstructured, error) {
+		items, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: resource}).
+			Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", resource, err)
+		}
+		return items.Items, nil
+	}
+
+	nodes, err := list("nodes", "")
+	if err != nil {
+		return nil, err
+	}
+	pvs, err := list("persistentvolumes", "")
+	if err != nil {
+		return nil, err
+	}
+	pvcs, err := list("persistentvolumeclaims", namespace)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := list("pods", namespace)
+	if err != nil {
+		return nil, err
+	}
+	return buildLocality(nodes, pvs, pvcs, pods), nil
+}
+
+// processPersistentVolumeGraph handles graph generation for PersistentVolumes, linking them to their
+// claim and to the nodes they can be used from
+func (c *Controller) processPersistentVolumeGraph(ctx context.Context, client dynamic.Interface, parentID string, resource ResourceIdentifier, response *GraphResponse, _ bool) error {
+	report, err := c.dataLocality(ctx, client, "")
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range report.Volumes {
+		if volume.PersistentVolume != resource.ResourceName {
+			continue
+		}
+		markNode(response, parentID, "locality", volume)
+
+		for _, name := range volume.Nodes {
+			nodeNode, err := c.buildResourceNode(ctx, client, ResourceIdentifier{Version: "v1", ResourceType: "nodes", ResourceName: name})
+			if err != nil {
+				continue
+			}
+			response.Nodes = append(response.Nodes, nodeNode)
+
+			// Add edge from volume to the nodes it is available on
+			response.Edges = append(response.Edges, Edge{
+				ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+				Source: parentID,
+				Target: nodeNode.ID,
+				Type:   "smoothstep",
+				Label:  "available-on",
+			})
+		}
+
+		if namespace, name, ok := strings.Cut(volume.Claim, "/"); ok {
+			claimNode, err := c.buildResourceNode(ctx, client, ResourceIdentifier{Namespace: namespace, Version: "v1", ResourceType: "persistentvolumeclaims", ResourceName: name})
+			if err == nil {
+				response.Nodes = append(response.Nodes, claimNode)
+				response.Edges = append(response.Edges, Edge{
+					ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+					Source: claimNode.ID,
+					Target: parentID,
+					Type:   "smoothstep",
+					Label:  "bound-to",
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// addNodeLocality adds the volumes held by a node and flags the pods pinned to it. Locality is an
+// overlay, a failure leaves the node graph as is.
+func (c *Controller) addNodeLocality(ctx context.Context, client dynamic.Interface, parentID string, resource ResourceIdentifier, response *GraphResponse) {
+	report, err := c.dataLocality(ctx, client, "")
+	if err != nil {
+		return
+	}
+
+	for _, volume := range report.Volumes {
+		if !contains(volume.Nodes, resource.ResourceName) {
+			continue
+		}
+		volumeNode, err := c.buildResourceNode(ctx, client, ResourceIdentifier{Version: "v1", ResourceType: "persistentvolumes", ResourceName: volume.PersistentVolume})
+		if err != nil {
+			continue
+		}
+		volumeNode.Data["locality"] = volume
+		response.Nodes = append(response.Nodes, volumeNode)
+
+		// Add edge from node to the volumes only reachable from a few nodes
+		response.Edges = append(response.Edges, Edge{
+			ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+			Source: parentID,
+			Target: volumeNode.ID,
+			Type:   "smoothstep",
+			Label:  "holds",
+		})
+	}
+
+	for _, workload := range report.DrainImpact(resource.ResourceName) {
+		for _, pod := range workload.Pods {
+			markNode(response, fmt.Sprintf("node-pod-%s", pod.Name), "locality", map[string]interface{}{
+				"pinned":   true,
+				"workload": workload.Kind + "/" + workload.Name,
+				"volumes":  pod.Volumes,
+				"reason":   workload.Reason,
+			})
+		}
+	}
+}
+
+// markNode sets a data key on a node already in the graph
+func markNode(response *GraphResponse, id, key string, value interface{}) {
+	for i := range response.Nodes {
+		if response.Nodes[i].ID == id {
+			response.Nodes[i].Data[key] = value
+		}
+	}
+}
+
+// buildLocality matches the node affinity of the volumes against the nodes and follows the claims to
+// the pods using them
+func buildLocality(nodes, pvs, pvcs, pods []unstructured.Unstructured) *LocalityReport {
+	report := &LocalityReport{Volumes: []VolumeLocality{}, Nodes: []NodeLocality{}, Workloads: []PinnedWorkload{}}
+
+	nodeIndex := map[string]*NodeLocality{}
+	for _, node := range nodes {
+		report.Nodes = append(report.Nodes, NodeLocality{
+			Name:        node.GetName(),
+			Ready:       nodeReady(node),
+			Schedulable: !nestedBool(node.Object, "spec", "unschedulable"),
+			Volumes:     []string{},
+			Workloads:   []string{},
+		})
+	}
+	for i := range report.Nodes {
+		nodeIndex[report.Nodes[i].Name] = &report.Nodes[i]
+	}
+
+	volumes := map[string]*VolumeLocality{}
+	for _, pv := range pvs {
+		volume, ok := volumeLocality(pv, nodes)
+		if !ok {
+			continue
+		}
+		report.Volumes = append(report.Volumes, volume)
+	}
+	for i := range report.Volumes {
+		volume := &report.Volumes[i]
+		volumes[volume.PersistentVolume] = volume
+		for _, name := range volume.Nodes {
+			if node := nodeIndex[name]; node != nil {
+				node.Volumes = append(node.Volumes, volume.PersistentVolume)
+			}
+		}
+	}
+
+	claims := map[string]string{}
+	for _, pvc := range pvcs {
+		if volumeName, _, _ := unstructured.NestedString(pvc.Object, "spec", "volumeName"); volumeName != "" {
+			claims[pvc.GetNamespace()+"/"+pvc.GetName()] = volumeName
+		}
+	}
+
+	workloads := map[string]*PinnedWorkload{}
+	keys := []string{}
+	for _, pod := range pods {
+		pinned, ok := pinnedPod(pod, claims, volumes, nodeIndex)
+		if !ok {
+			continue
+		}
+		kind, name := podWorkload(pod)
+		key := pod.GetNamespace() + "/" + kind + "/" + name
+		workload := workloads[key]
+		if workload == nil {
+			workload = &PinnedWorkload{Namespace: pod.GetNamespace(), Kind: kind, Name: name, Pods: []PinnedPod{}}
+			workloads[key] = workload
+			keys = append(keys, key)
+		}
+		workload.Pods = append(workload.Pods, pinned)
+		if len(pinned.Nodes) == 1 {
+			workload.Pinned = true
+			if node := nodeIndex[pinned.Nodes[0]]; node != nil && !contains(node.Workloads, key) {
+				node.Workloads = append(node.Workloads, key)
+			}
+		}
+		workload.Stranded = workload.Stranded || pinned.Stranded
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		workload := workloads[key]
+		workload.Reason = localityReason(workload)
+		report.Workloads = append(report.Workloads, *workload)
+	}
+	return report
+}
+
+// volumeLocality returns the nodes a persistent volume can be used from, when it is tied to some nodes
+func volumeLocality(pv unstructured.Unstructured, nodes []unstructured.Unstructured) (VolumeLocality, bool) {
+	volume := VolumeLocality{PersistentVolume: pv.GetName(), Nodes: []string{}}
+	volume.StorageClass, _, _ = unstructured.NestedString(pv.Object, "spec", "storageClassName")
+	if namespace, _, _ := unstructured.NestedString(pv.Object, "spec", "claimRef", "namespace"); namespace != "" {
+		name, _, _ := unstructured.NestedString(pv.Object, "spec", "claimRef", "name")
+		volume.Claim = namespace + "/" + name
+	}
+
+	terms, hasAffinity, _ := unstructured.NestedSlice(pv.Object, "spec", "nodeAffinity", "required", "nodeSelectorTerms")
+	switch {
+	case hasField(pv.Object, "spec", "local"):
+		volume.Kind = LocalityLocal
+	case hasField(pv.Object, "spec", "hostPath"):
+		volume.Kind = LocalityHostPath
+	case hasAffinity:
+		volume.Kind = LocalityNodeAffinity
+	default:
+		return volume, false
+	}
+
+	if hasAffinity {
+		for _, node := range nodes {
+			if matchNodeSelectorTerms(terms, node) {
+				volume.Nodes = append(volume.Nodes, node.GetName())
+			}
+		}
+		// Zonal volumes of a single zone cluster restrict nothing
+		if volume.Kind == LocalityNodeAffinity && len(volume.Nodes) == len(nodes) {
+			return volume, false
+		}
+	}
+	sort.Strings(volume.Nodes)
+	volume.Pinned = len(volume.Nodes) == 1
+	return volume, true
+}
+
+// pinnedPod returns the nodes a pod can run on given its node-bound volumes
+func pinnedPod(pod unstructured.Unstructured, claims map[string]string, volumes map[string]*VolumeLocality, nodes map[string]*NodeLocality) (PinnedPod, bool) {
+	podVolumes, _, _ := unstructured.NestedSlice(pod.Object, "spec", "volumes")
+	nodeName, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+	pinned := PinnedPod{Name: pod.GetName(), Node: nodeName, Volumes: []string{}}
+
+	var allowed map[string]bool
+	for _, v := range podVolumes {
+		volumeMap, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		claimName, _, _ := unstructured.NestedString(volumeMap, "persistentVolumeClaim", "claimName")
+		volume := volumes[claims[pod.GetNamespace()+"/"+claimName]]
+		if claimName == "" || volume == nil {
+			continue
+		}
+		pinned.Volumes = append(pinned.Volumes, volume.PersistentVolume)
+
+		volumeNodes := volume.Nodes
+		// Host paths without node affinity stay on the node they were written on
+		if len(volumeNodes) == 0 && nodeName != "" {
+			volumeNodes = []string{nodeName}
+		}
+		next := map[string]bool{}
+		for _, n := range volumeNodes {
+			if allowed == nil || allowed[n] {
+				next[n] = true
+			}
+		}
+		allowed = next
+	}
+	if len(pinned.Volumes) == 0 {
+		return pinned, false
+	}
+
+	pinned.Nodes = []string{}
+	pinned.Stranded = true
+	for n := range allowed {
+		pinned.Nodes = append(pinned.Nodes, n)
+		if node := nodes[n]; node != nil && node.Ready && node.Schedulable {
+			pinned.Stranded = false
+		}
+	}
+	sort.Strings(pinned.Nodes)
+	return pinned, true
+}
+
+// podWorkload returns the workload controlling a pod, Deployments are derived from their ReplicaSets
+func podWorkload(pod unstructured.Unstructured) (string, string) {
+	for _, ref := range pod.GetOwnerReferences() {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			if hash := pod.GetLabels()["pod-template-hash"]; hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+				return "Deployment", strings.TrimSuffix(ref.Name, "-"+hash)
+			}
+		}
+		return ref.Kind, ref.Name
+	}
+	return "Pod", pod.GetName()
+}
+
+func localityReason(workload *PinnedWorkload) string {
+	for _, pod := range workload.Pods {
+		switch {
+		case len(pod.Nodes) == 0:
+			return fmt.Sprintf("pod %s uses volumes with no common node", pod.Name)
+		case pod.Stranded:
+			return fmt.Sprintf("pod %s can only run on %s, none of them is ready and schedulable", pod.Name, strings.Join(pod.Nodes, ", "))
+		}
+	}
+	for _, pod := range workload.Pods {
+		if len(pod.Nodes) == 1 {
+			return fmt.Sprintf("pod %s can only run on node %s, where volume %s lives", pod.Name, pod.Nodes[0], strings.Join(pod.Volumes, ", "))
+		}
+	}
+	return fmt.Sprintf("pod %s can only run on %s", workload.Pods[0].Name, strings.Join(workload.Pods[0].Nodes, ", "))
+}
+
+// matchNodeSelectorTerms evaluates required node selector terms, terms are ORed and their requirements ANDed
+func matchNodeSelectorTerms(terms []interface{}, node unstructured.Unstructured) bool {
+	labels := node.GetLabels()
+	fields := map[string]string{"metadata.name": node.GetName()}
+
+	for _, t := range terms {
+		term, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		expressions, _, _ := unstructured.NestedSlice(term, "matchExpressions")
+		fieldExpressions, _, _ := unstructured.NestedSlice(term, "matchFields")
+		if len(expressions) == 0 && len(fieldExpressions) == 0 {
+			// An empty term matches no objects
+			continue
+		}
+		if matchRequirements(expressions, labels) && matchRequirements(fieldExpressions, fields) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRequirements(requirements []interface{}, values map[string]string) bool {
+	for _, r := range requirements {
+		requirement, ok := r.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		key, _, _ := unstructured.NestedString(requirement, "key")
+		operator, _, _ := unstructured.NestedString(requirement, "operator")
+		expected, _, _ := unstructured.NestedStringSlice(requirement, "values")
+		value, exists := values[key]
+
+		switch operator {
+		case "In":
+			if !exists || !contains(expected, value) {
+				return false
+			}
+		case "NotIn":
+			if exists && contains(expected, value) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		case "Gt", "Lt":
+			if !exists || len(expected) != 1 {
+				return false
+			}
+			actual, err := strconv.ParseInt(value, 10, 64)
+			bound, err2 := strconv.ParseInt(expected[0], 10, 64)
+			if err != nil || err2 != nil || (operator == "Gt" && actual <= bound) || (operator == "Lt" && actual >= bound) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func nodeReady(node unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(node.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Ready" {
+			return condition["status"] == "True"
+		}
+	}
+	return false
+}
+
+func hasField(obj map[string]interface{}, fields ...string) bool {
+	_, found, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	return found
+}
+
+func nestedBool(obj map[string]interface{}, fields ...string) bool {
+	value, _, _ := unstructured.NestedBool(obj, fields...)
+	return value
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package canvas
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testNode(name string, ready bool, labels map[string]interface{}) unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": name, "labels": labels},
+		"status": map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": status},
+		}},
+	}}
+}
+
+func testLocalPV(name, claim string, terms ...interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"local":        map[string]interface{}{"path": "/mnt/disks/" + name},
+			"claimRef":     map[string]interface{}{"namespace": "db", "name": claim},
+			"nodeAffinity": map[string]interface{}{"required": map[string]interface{}{"nodeSelectorTerms": terms}},
+		},
+	}}
+}
+
+func hostnameTerm(values ...interface{}) interface{} {
+	return map[string]interface{}{"matchExpressions": []interface{}{
+		map[string]interface{}{"key": "kubernetes.io/hostname", "operator": "In", "values": values},
+	}}
+}
+
+func TestMatchNodeSelectorTerms(t *testing.T) {
+	t.Parallel()
+
+	node := testNode("node-a", true, map[string]interface{}{"kubernetes.io/hostname": "node-a", "zone": "a", "cores": "8"})
+	expression := func(key, operator string, values ...interface{}) interface{} {
+		return map[string]interface{}{"key": key, "operator": operator, "values": values}
+	}
+
+	tests := []struct {
+		name  string
+		terms []interface{}
+		want  bool
+	}{
+		{"in", []interface{}{hostnameTerm("node-a")}, true},
+		{"not in", []interface{}{hostnameTerm("node-b")}, false},
+		{"terms are ORed", []interface{}{hostnameTerm("node-b"), hostnameTerm("node-a")}, true},
+		{"expressions are ANDed", []interface{}{map[string]interface{}{"matchExpressions": []interface{}{
+			expression("zone", "In", "a"), expression("zone", "NotIn", "a"),
+		}}}, false},
+		{"exists", []interface{}{map[string]interface{}{"matchExpressions": []interface{}{expression("zone", "Exists")}}}, true},
+		{"does not exist", []interface{}{map[string]interface{}{"matchExpressions": []interface{}{expression("gpu", "DoesNotExist")}}}, true},
+		{"greater than", []interface{}{map[string]interface{}{"matchExpressions": []interface{}{expression("cores", "Gt", "4")}}}, true},
+		{"less than", []interface{}{map[string]interface{}{"matchExpressions": []interface{}{expression("cores", "Lt", "4")}}}, false},
+		{"fields", []interface{}{map[string]interface{}{"matchFields": []interface{}{expression("metadata.name", "In", "node-a")}}}, true},
+		{"empty term", []interface{}{map[string]interface{}{}}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matchNodeSelectorTerms(tt.terms, node); got != tt.want {
+				t.Errorf("matchNodeSelectorTerms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildLocality(t *testing.T) {
+	t.Parallel()
+
+	nodes := []unstructured.Unstructured{
+		testNode("node-a", true, map[string]interface{}{"kubernetes.io/hostname": "node-a", "zone": "a"}),
+		testNode("node-b", true, map[string]interface{}{"kubernetes.io/hostname": "node-b", "zone": "a"}),
+		testNode("node-c", false, map[string]interface{}{"kubernetes.io/hostname": "node-c", "zone": "b"}),
+	}
+	zoneTerm := map[string]interface{}{"matchExpressions": []interface{}{
+		map[string]interface{}{"key": "zone", "operator": "In", "values": []interface{}{"a", "b"}},
+	}}
+	pvs := []unstructured.Unstructured{
+		testLocalPV("pv-a", "data-db-0", hostnameTerm("node-a")),
+		testLocalPV("pv-c", "data-cache-0", hostnameTerm("node-c")),
+		// A zonal volume matching every node doesn't restrict scheduling
+		{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "pv-zonal"},
+			"spec":     map[string]interface{}{"nodeAffinity": map[string]interface{}{"required": map[string]interface{}{"nodeSelectorTerms": []interface{}{zoneTerm}}}},
+		}},
+	}
+	claim := func(name, volume string) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "db"},
+			"spec":     map[string]interface{}{"volumeName": volume},
+		}}
+	}
+	pvcs := []unstructured.Unstructured{claim("data-db-0", "pv-a"), claim("data-cache-0", "pv-c")}
+	pod := func(name, owner, claim string) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": name, "namespace": "db",
+				"labels": map[string]interface{}{"pod-template-hash": "5d8f"},
+				"ownerReferences": []interface{}{map[string]interface{}{
+					"apiVersion": "apps/v1", "kind": owner, "name": "db", "uid": "1", "controller": true,
+				}},
+			},
+			"spec": map[string]interface{}{"volumes": []interface{}{
+				map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": claim}},
+			}},
+		}}
+	}
+	pods := []unstructured.Unstructured{pod("db-0", "StatefulSet", "data-db-0"), pod("cache-0", "ReplicaSet", "data-cache-0")}
+	pods[1].SetOwnerReferences(nil)
+
+	report := buildLocality(nodes, pvs, pvcs, pods)
+
+	if len(report.Volumes) != 2 {
+		t.Fatalf("got %d volumes, want 2: %+v", len(report.Volumes), report.Volumes)
+	}
+	if volume := report.Volumes[0]; volume.Kind != LocalityLocal || !volume.Pinned || volume.Claim != "db/data-db-0" {
+		t.Errorf("unexpected volume %+v", volume)
+	}
+	if len(report.Workloads) != 2 {
+		t.Fatalf("got %d workloads, want 2: %+v", len(report.Workloads), report.Workloads)
+	}
+	stranded, pinned := report.Workloads[0], report.Workloads[1]
+	if stranded.Kind != "Pod" || !stranded.Stranded {
+		t.Errorf("expected the pod on the not ready node to be stranded, got %+v", stranded)
+	}
+	if pinned.Kind != "StatefulSet" || !pinned.Pinned || pinned.Stranded {
+		t.Errorf("expected the statefulset to be pinned, got %+v", pinned)
+	}
+	if !reflect.DeepEqual(report.Nodes[0].Workloads, []string{"db/StatefulSet/db"}) {
+		t.Errorf("unexpected workloads of node-a %v", report.Nodes[0].Workloads)
+	}
+
+	impact := report.DrainImpact("node-a")
+	if len(impact) != 1 || impact[0].Name != "db" {
+		t.Errorf("unexpected drain impact %+v", impact)
+	}
+	if impact := report.DrainImpact("node-b"); len(impact) != 0 {
+		t.Errorf("expected no drain impact on node-b, got %+v", impact)
+	}
+}
@@ -0,0 +1,429 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/listing"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// DefaultNamespaceGraphLimit caps the nodes of a namespace graph page when no limit is asked for
+const DefaultNamespaceGraphLimit = 500
+
+// namespaceGraphKinds are the resources of a namespace graph, in the order of its nodes
+var namespaceGraphKinds = []schema.GroupVersionResource{
+	{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	{Version: "v1", Resource: "services"},
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	{Group: "apps", Version: "v1", Resource: "daemonsets"},
+	{Group: "batch", Version: "v1", Resource: "cronjobs"},
+	{Group: "batch", Version: "v1", Resource: "jobs"},
+	{Group: "apps", Version: "v1", Resource: "replicasets"},
+	{Version: "v1", Resource: "pods"},
+	{Version: "v1", Resource: "configmaps"},
+	{Version: "v1", Resource: "secrets"},
+	{Version: "v1", Resource: "persistentvolumeclaims"},
+	{Version: "v1", Resource: "serviceaccounts"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"},
+	{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"},
+}
+
+// podKinds outnumber the workloads managing them, they are only shown when asked for and their edges
+// go to their workload otherwise
+var podKinds = map[string]bool{"replicasets": true, "pods": true}
+
+// NamespaceGraphOptions select and page the nodes of a namespace graph
+type NamespaceGraphOptions struct {
+	// Kinds restricts the nodes to these resource types, e.g. deployments, every kind when empty
+	Kinds []string
+	// Pods adds the replica sets and pods of the workloads
+	Pods bool
+	// PolicyTraffic adds the traffic network policies allow or deny between the workloads, or the
+	// pods when shown
+	PolicyTraffic bool
+	// Page filters, sorts and pages the nodes by their JSON fields, e.g. data.resourceType
+	Page listing.Query
+}
+
+// NamespaceGraphResponse is a page of the graph of a namespace. Its edges are the ones with an end
+// on the page, so the pages of a graph add up to the whole graph.
+type NamespaceGraphResponse struct {
+	GraphResponse
+	Namespace string `json:"namespace"`
+	// Total counts the nodes matching the filters, over every page
+	Total int `json:"total"`
+	// Continue fetches the next page, empty on the last one
+	Continue string `json:"continue,omitempty"`
+}
+
+// GetNamespaceGraph returns the topology of a namespace, its workloads, services, ingresses, config
+// resources and RBAC, listing each kind once instead of fetching resources one by one
+func (c *Controller) GetNamespaceGraph(ctx context.Context, namespace string, opts NamespaceGraphOptions) (*NamespaceGraphResponse, error) {
+	client, err := dynamic.NewForConfig(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	lists := map[string][]unstructured.Unstructured{}
+	for _, gvr := range namespaceGraphKinds {
+		list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			// Kinds the user may not list, or the cluster doesn't serve, are left out of the graph
+			if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list %s: %v", gvr.Resource, err)
+		}
+		lists[gvr.Resource] = list.Items
+	}
+	// Network policies select peers by the labels of their namespace
+	if obj, err := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}).Get(ctx, namespace, metav1.GetOptions{}); err == nil {
+		lists["namespaces"] = []unstructured.Unstructured{*obj}
+	}
+	return c.namespaceGraph(namespace, lists, opts)
+}
+
+// graphObject is a resource of a namespace graph
+type graphObject struct {
+	resource ResourceIdentifier
+	obj      *unstructured.Unstructured
+	nodeID   string
+	owner    *graphObject
+	shown    bool
+}
+
+// namespaceGraph builds the graph of the listed resources of a namespace, keyed by resource type.
+// The namespaces entry holds the namespace itself, when it could be read.
+func (c *Controller) namespaceGraph(namespace string, lists map[string][]unstructured.Unstructured, opts NamespaceGraphOptions) (*NamespaceGraphResponse, error) {
+	wanted := map[string]bool{}
+	for _, kind := range opts.Kinds {
+		wanted[strings.ToLower(kind)] = true
+	}
+
+	objects := []*graphObject{}
+	byUID := map[types.UID]*graphObject{}
+	byName := map[string]*graphObject{}
+	for _, gvr := range namespaceGraphKinds {
+		items := lists[gvr.Resource]
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].GetName() < items[j].GetName()
+		})
+		for i := range items {
+			resource := ResourceIdentifier{
+				Namespace:    namespace,
+				Group:        gvr.Group,
+				Version:      gvr.Version,
+				ResourceType: gvr.Resource,
+				ResourceName: items[i].GetName(),
+			}
+			o := &graphObject{
+				resource: resource,
+				obj:      &items[i],
+				nodeID:   fmt.Sprintf("node-%s-%s", resource.ResourceType[:len(resource.ResourceType)-1], resource.ResourceName),
+				shown:    (opts.Pods || !podKinds[gvr.Resource]) && (len(wanted) == 0 || wanted[gvr.Resource]),
+			}
+			objects = append(objects, o)
+			byUID[items[i].GetUID()] = o
+			byName[gvr.Resource+"/"+resource.ResourceName] = o
+		}
+	}
+	for _, o := range objects {
+		if ref := metav1.GetControllerOf(o.obj); ref != nil {
+			o.owner = byUID[ref.UID]
+		}
+	}
+
+	edges := &edgeSet{seen: map[string]int{}}
+	for _, o := range objects {
+		switch o.resource.ResourceType {
+		case "services":
+			selector, found, err := unstructured.NestedStringMap(o.obj.Object, "spec", "selector")
+			if err != nil || !found || len(selector) == 0 {
+				break
+			}
+			for _, pod := range objects {
+				if pod.resource.ResourceType == "pods" && matchLabels(selector, pod.obj.GetLabels()) {
+					edges.add(o, pod.visible(), "exposes")
+				}
+			}
+		case "ingresses":
+			for _, name := range ingressBackends(o.obj) {
+				edges.add(o, byName["services/"+name], "routes-to")
+			}
+		case "rolebindings":
+			if kind, _, _ := unstructured.NestedString(o.obj.Object, "roleRef", "kind"); kind == "Role" {
+				name, _, _ := unstructured.NestedString(o.obj.Object, "roleRef", "name")
+				edges.add(byName["roles/"+name], o, "grant-permissions")
+			}
+			subjects, _, _ := unstructured.NestedSlice(o.obj.Object, "subjects")
+			for _, subject := range subjects {
+				subjectMap, ok := subject.(map[string]interface{})
+				if !ok || subjectMap["kind"] != "ServiceAccount" {
+					continue
+				}
+				if ns, _ := subjectMap["namespace"].(string); ns != "" && ns != namespace {
+					continue
+				}
+				name, _ := subjectMap["name"].(string)
+				edges.add(byName["serviceaccounts/"+name], o, "binds-to")
+			}
+		}
+
+		if o.owner != nil {
+			label := "manages"
+			if o.owner.resource.ResourceType == "cronjobs" {
+				label = "creates"
+			}
+			edges.add(o.owner.visible(), o.visible(), label)
+			// Config resources are linked to the top-level workload only
+			continue
+		}
+		spec, found := podSpecOf(o.obj)
+		if !found {
+			continue
+		}
+		refs := podSpecReferences(spec)
+		for _, name := range refs.configMaps {
+			edges.add(byName["configmaps/"+name], o.visible(), "configures")
+		}
+		for _, name := range refs.secrets {
+			edges.add(byName["secrets/"+name], o.visible(), "provides-secrets")
+		}
+		for _, name := range refs.claims {
+			edges.add(byName["persistentvolumeclaims/"+name], o.visible(), "used-by")
+		}
+		edges.add(byName["serviceaccounts/"+refs.serviceAccount], o.visible(), "used-by")
+	}
+	// Without the right to list network policies, whether traffic passes is unknown
+	if _, ok := lists["networkpolicies"]; ok {
+		namespaceLabels := map[string]string{corev1.LabelMetadataName: namespace}
+		for _, ns := range lists["namespaces"] {
+			for key, value := range ns.GetLabels() {
+				namespaceLabels[key] = value
+			}
+		}
+		addNetworkPolicyEdges(edges, objects, byName, namespaceLabels, opts.PolicyTraffic)
+	}
+
+	nodes := []Node{}
+	for _, o := range objects {
+		if o.shown {
+			nodes = append(nodes, c.resourceNode(o.resource, o.obj))
+		}
+	}
+
+	query := opts.Page
+	if query.Limit == 0 {
+		query.Limit = DefaultNamespaceGraphLimit
+	}
+	page, err := listing.Apply(nodes, query)
+	if err != nil {
+		return nil, err
+	}
+
+	onPage := map[string]bool{}
+	for _, node := range page.Items {
+		onPage[node.ID] = true
+	}
+	pageEdges := []Edge{}
+	for _, edge := range edges.edges {
+		if onPage[edge.Source] || onPage[edge.Target] {
+			pageEdges = append(pageEdges, edge)
+		}
+	}
+
+	return &NamespaceGraphResponse{
+		GraphResponse: GraphResponse{Nodes: page.Items, Edges: pageEdges},
+		Namespace:     namespace,
+		Total:         page.Total,
+		Continue:      page.Continue,
+	}, nil
+}
+
+// visible returns the object, or the nearest owner standing in for it when it isn't shown
+func (o *graphObject) visible() *graphObject {
+	for current := o; current != nil; current = current.owner {
+		if current.shown {
+			return current
+		}
+		if !podKinds[current.resource.ResourceType] {
+			return nil
+		}
+	}
+	return nil
+}
+
+// edgeSet collects the edges of a graph once each, with IDs stable across pages
+type edgeSet struct {
+	edges []Edge
+	// seen holds the index of every edge by its ID
+	seen map[string]int
+}
+
+// add adds an edge between two shown objects, returning its index or -1 when an end isn't shown
+func (s *edgeSet) add(source, target *graphObject, label string) int {
+	if source == nil || target == nil || source == target || !source.shown || !target.shown {
+		return -1
+	}
+	id := fmt.Sprintf("edge-%s-%s-%s", source.nodeID, target.nodeID, label)
+	if i, ok := s.seen[id]; ok {
+		return i
+	}
+	s.seen[id] = len(s.edges)
+	s.edges = append(s.edges, Edge{
+		ID:     id,
+		Source: source.nodeID,
+		Target: target.nodeID,
+		Type:   "smoothstep",
+		Label:  label,
+	})
+	return len(s.edges) - 1
+}
+
+// ingressBackends returns the names of the services an ingress routes to
+func ingressBackends(ingress *unstructured.Unstructured) []string {
+	names := []string{}
+	if name, found, _ := unstructured.NestedString(ingress.Object, "spec", "defaultBackend", "service", "name"); found {
+		names = append(names, name)
+	}
+	rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(ruleMap, "http", "paths")
+		for _, path := range paths {
+			pathMap, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, found, _ := unstructured.NestedString(pathMap, "backend", "service", "name"); found {
+				names = append(names, name)
+			} else if name, found, _ := unstructured.NestedString(pathMap, "backend", "serviceName"); found {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// podSpecOf returns the pod spec of a pod or of the pod template of a workload
+func podSpecOf(obj *unstructured.Unstructured) (map[string]interface{}, bool) {
+	var fields []string
+	switch obj.GetKind() {
+	case "Pod":
+		fields = []string{"spec"}
+	case "CronJob":
+		fields = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		fields = []string{"spec", "template", "spec"}
+	default:
+		return nil, false
+	}
+	spec, found, err := unstructured.NestedMap(obj.Object, fields...)
+	return spec, found && err == nil
+}
+
+// specReferences are the resources of its namespace a pod spec refers to
+type specReferences struct {
+	configMaps     []string
+	secrets        []string
+	claims         []string
+	serviceAccount string
+}
+
+// podSpecReferences returns the config maps, secrets, claims and service account of a pod spec
+func podSpecReferences(spec map[string]interface{}) specReferences {
+	refs := specReferences{serviceAccount: "default"}
+	if name, found, _ := unstructured.NestedString(spec, "serviceAccountName"); found && name != "" {
+		refs.serviceAccount = name
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for _, volume := range volumes {
+		volumeMap, ok := volume.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, found, _ := unstructured.NestedString(volumeMap, "configMap", "name"); found {
+			refs.configMaps = append(refs.configMaps, name)
+		}
+		if name, found, _ := unstructured.NestedString(volumeMap, "secret", "secretName"); found {
+			refs.secrets = append(refs.secrets, name)
+		}
+		if name, found, _ := unstructured.NestedString(volumeMap, "persistentVolumeClaim", "claimName"); found {
+			refs.claims = append(refs.claims, name)
+		}
+		sources, _, _ := unstructured.NestedSlice(volumeMap, "projected", "sources")
+		for _, source := range sources {
+			sourceMap, ok := source.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, found, _ := unstructured.NestedString(sourceMap, "configMap", "name"); found {
+				refs.configMaps = append(refs.configMaps, name)
+			}
+			if name, found, _ := unstructured.NestedString(sourceMap, "secret", "name"); found {
+				refs.secrets = append(refs.secrets, name)
+			}
+		}
+	}
+
+	pullSecrets, _, _ := unstructured.NestedSlice(spec, "imagePullSecrets")
+	for _, pullSecret := range pullSecrets {
+		if pullSecretMap, ok := pullSecret.(map[string]interface{}); ok {
+			if name, ok := pullSecretMap["name"].(string); ok {
+				refs.secrets = append(refs.secrets, name)
+			}
+		}
+	}
+
+	for _, group := range containerGroups {
+		containers, _, _ := unstructured.NestedSlice(spec, group.specField)
+		for _, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			envFrom, _, _ := unstructured.NestedSlice(containerMap, "envFrom")
+			for _, envSource := range envFrom {
+				envMap, ok := envSource.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if name, found, _ := unstructured.NestedString(envMap, "configMapRef", "name"); found {
+					refs.configMaps = append(refs.configMaps, name)
+				}
+				if name, found, _ := unstructured.NestedString(envMap, "secretRef", "name"); found {
+					refs.secrets = append(refs.secrets, name)
+				}
+			}
+			env, _, _ := unstructured.NestedSlice(containerMap, "env")
+			for _, envVar := range env {
+				envMap, ok := envVar.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if name, found, _ := unstructured.NestedString(envMap, "valueFrom", "configMapKeyRef", "name"); found {
+					refs.configMaps = append(refs.configMaps, name)
+				}
+				if name, found, _ := unstructured.NestedString(envMap, "valueFrom", "secretKeyRef", "name"); found {
+					refs.secrets = append(refs.secrets, name)
+				}
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,219 @@
+package canvas
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/listing"
+	"github.com/agentkube/operator/pkg/reachability"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testObject(kind, name, uid string, owner interface{}, fields map[string]interface{}) unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name, "namespace": "shop", "uid": uid}
+	if owner != nil {
+		metadata["ownerReferences"] = []interface{}{owner}
+	}
+	obj := map[string]interface{}{"kind": kind, "metadata": metadata}
+	for key, value := range fields {
+		obj[key] = value
+	}
+	return unstructured.Unstructured{Object: obj}
+}
+
+func controllerRef(kind, name, uid string) interface{} {
+	return map[string]interface{}{"kind": kind, "name": name, "uid": uid, "controller": true, "apiVersion": "v1"}
+}
+
+func testNamespaceLists() map[string][]unstructured.Unstructured {
+	template := map[string]interface{}{"spec": map[string]interface{}{
+		"serviceAccountName": "web",
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "web-config"}},
+			map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": "web-data"}},
+		},
+		"containers": []interface{}{map[string]interface{}{
+			"name": "web",
+			"env": []interface{}{map[string]interface{}{"name": "TOKEN", "valueFrom": map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{"name": "web-token", "key": "token"},
+			}}},
+		}},
+	}}
+	podSpec := template["spec"]
+
+	return map[string][]unstructured.Unstructured{
+		"ingresses": {testObject("Ingress", "web", "ing", nil, map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"http": map[string]interface{}{"paths": []interface{}{
+				map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}}},
+			}}}},
+		}})},
+		"services": {testObject("Service", "web", "svc", nil, map[string]interface{}{"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"app": "web"},
+		}})},
+		"deployments": {testObject("Deployment", "web", "deploy", nil, map[string]interface{}{"spec": map[string]interface{}{
+			"template": template,
+		}})},
+		"replicasets": {testObject("ReplicaSet", "web-1", "rs", controllerRef("Deployment", "web", "deploy"), map[string]interface{}{"spec": map[string]interface{}{
+			"template": template,
+		}})},
+		"pods": {func() unstructured.Unstructured {
+			pod := testObject("Pod", "web-1-a", "pod", controllerRef("ReplicaSet", "web-1", "rs"), map[string]interface{}{"spec": podSpec})
+			pod.SetLabels(map[string]string{"app": "web"})
+			return pod
+		}()},
+		"configmaps":             {testObject("ConfigMap", "web-config", "cm", nil, nil)},
+		"secrets":                {testObject("Secret", "web-token", "secret", nil, nil)},
+		"persistentvolumeclaims": {testObject("PersistentVolumeClaim", "web-data", "pvc", nil, nil)},
+		"serviceaccounts":        {testObject("ServiceAccount", "web", "sa", nil, nil)},
+		"roles":                  {testObject("Role", "reader", "role", nil, nil)},
+		"rolebindings": {testObject("RoleBinding", "web-reader", "rb", nil, map[string]interface{}{
+			"roleRef":  map[string]interface{}{"kind": "Role", "name": "reader"},
+			"subjects": []interface{}{map[string]interface{}{"kind": "ServiceAccount", "name": "web"}},
+		})},
+	}
+}
+
+func edgeLabels(edges []Edge) []string {
+	labels := []string{}
+	for _, edge := range edges {
+		labels = append(labels, edge.Source+" "+edge.Label+" "+edge.Target)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func TestNamespaceGraph(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		opts      NamespaceGraphOptions
+		wantNodes int
+		wantEdges []string
+	}{
+		{
+			name:      "workloads",
+			wantNodes: 9,
+			wantEdges: []string{
+				"node-configmap-web-config configures node-deployment-web",
+				"node-ingresse-web routes-to node-service-web",
+				"node-persistentvolumeclaim-web-data used-by node-deployment-web",
+				"node-role-reader grant-permissions node-rolebinding-web-reader",
+				"node-secret-web-token provides-secrets node-deployment-web",
+				"node-service-web exposes node-deployment-web",
+				"node-serviceaccount-web binds-to node-rolebinding-web-reader",
+				"node-serviceaccount-web used-by node-deployment-web",
+			},
+		},
+		{
+			name:      "pods",
+			opts:      NamespaceGraphOptions{Pods: true},
+			wantNodes: 11,
+			wantEdges: []string{
+				"node-configmap-web-config configures node-deployment-web",
+				"node-deployment-web manages node-replicaset-web-1",
+				"node-ingresse-web routes-to node-service-web",
+				"node-persistentvolumeclaim-web-data used-by node-deployment-web",
+				"node-replicaset-web-1 manages node-pod-web-1-a",
+				"node-role-reader grant-permissions node-rolebinding-web-reader",
+				"node-secret-web-token provides-secrets node-deployment-web",
+				"node-service-web exposes node-pod-web-1-a",
+				"node-serviceaccount-web binds-to node-rolebinding-web-reader",
+				"node-serviceaccount-web used-by node-deployment-web",
+			},
+		},
+		{
+			name:      "kinds",
+			opts:      NamespaceGraphOptions{Kinds: []string{"Services", "deployments"}},
+			wantNodes: 2,
+			wantEdges: []string{"node-service-web exposes node-deployment-web"},
+		},
+		{
+			name:      "page keeps the edges of its nodes",
+			opts:      NamespaceGraphOptions{Page: listing.Query{Limit: 1}},
+			wantNodes: 1,
+			wantEdges: []string{"node-ingresse-web routes-to node-service-web"},
+		},
+	}
+
+	controller := &Controller{}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := controller.namespaceGraph("shop", testNamespaceLists(), tt.opts)
+			if err != nil {
+				t.Fatalf("namespaceGraph() error = %v", err)
+			}
+			if len(got.Nodes) != tt.wantNodes {
+				t.Errorf("namespaceGraph() nodes = %d, want %d", len(got.Nodes), tt.wantNodes)
+			}
+			if labels := edgeLabels(got.Edges); !reflect.DeepEqual(labels, tt.wantEdges) {
+				t.Errorf("namespaceGraph() edges = %v, want %v", labels, tt.wantEdges)
+			}
+		})
+	}
+}
+
+func TestNamespaceGraphNetworkPolicies(t *testing.T) {
+	t.Parallel()
+
+	lists := testNamespaceLists()
+	lists["deployments"] = append(lists["deployments"], testObject("Deployment", "worker", "worker", nil, nil))
+	worker := testObject("Pod", "worker-a", "worker-pod", controllerRef("Deployment", "worker", "worker"), map[string]interface{}{"spec": map[string]interface{}{}})
+	worker.SetLabels(map[string]string{"app": "worker"})
+	lists["pods"] = append(lists["pods"], worker)
+	// web only accepts traffic from the ingress controller's namespace
+	lists["networkpolicies"] = []unstructured.Unstructured{testObject("NetworkPolicy", "web-ingress", "np", nil, map[string]interface{}{"spec": map[string]interface{}{
+		"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}},
+		"policyTypes": []interface{}{"Ingress"},
+		"ingress": []interface{}{map[string]interface{}{"from": []interface{}{map[string]interface{}{
+			"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": "ingress-nginx"}},
+		}}}},
+	}})}
+
+	controller := &Controller{}
+	got, err := controller.namespaceGraph("shop", lists, NamespaceGraphOptions{PolicyTraffic: true})
+	if err != nil {
+		t.Fatalf("namespaceGraph() error = %v", err)
+	}
+
+	want := map[string]bool{
+		"node-networkpolicie-web-ingress isolates node-deployment-web": false,
+		"node-deployment-worker denies-traffic node-deployment-web":    false,
+	}
+	for _, edge := range got.Edges {
+		key := edge.Source + " " + edge.Label + " " + edge.Target
+		if _, ok := want[key]; ok {
+			want[key] = true
+		}
+		switch {
+		case edge.Label == "denies-traffic":
+			entry, _ := edge.Data["networkPolicy"].(reachability.Entry)
+			if edge.Type != EdgeTypeDenied || entry.Allowed || !reflect.DeepEqual(entry.Policies, []string{"shop/web-ingress"}) {
+				t.Errorf("denied edge = %+v", edge)
+			}
+		case edge.Label == "allows-traffic":
+			t.Errorf("unexpected allowed edge %s, no policy isolates the worker", key)
+		case edge.Label == "exposes":
+			// The policy admits some peers, so the service still reaches its pods
+			if entry, _ := edge.Data["networkPolicy"].(reachability.Entry); !entry.Allowed {
+				t.Errorf("exposes edge = %+v, want traffic allowed", edge)
+			}
+		}
+	}
+	for key, found := range want {
+		if !found {
+			t.Errorf("missing edge %s in %v", key, edgeLabels(got.Edges))
+		}
+	}
+
+	// Without pairs the graph only links the policies
+	got, _ = controller.namespaceGraph("shop", lists, NamespaceGraphOptions{})
+	for _, edge := range got.Edges {
+		if edge.Type == EdgeTypeAllowed || edge.Type == EdgeTypeDenied {
+			t.Errorf("unexpected traffic edge %+v", edge)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package canvas
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/reachability"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Edge types of the traffic network policies allow or deny between workloads
+const (
+	EdgeTypeAllowed = "network-allowed"
+	EdgeTypeDenied  = "network-denied"
+)
+
+// policyEndpoint is the pods of a namespace graph standing for a node, the pods themselves or the
+// workload managing them
+type policyEndpoint struct {
+	object   *graphObject
+	endpoint reachability.Endpoint
+}
+
+// addNetworkPolicyEdges links the network policies of a namespace graph to the pods they isolate and
+// tells on every service edge whether the pods behind it accept traffic. With pairs set, the traffic
+// the policies allow or deny between the nodes standing for pods is added too, pairs no policy
+// isolates are left out.
+func addNetworkPolicyEdges(edges *edgeSet, objects []*graphObject, byName map[string]*graphObject, namespaceLabels map[string]string, pairs bool) {
+	policies := []networkingv1.NetworkPolicy{}
+	for _, o := range objects {
+		if o.resource.ResourceType != "networkpolicies" {
+			continue
+		}
+		var policy networkingv1.NetworkPolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.obj.Object, &policy); err != nil {
+			continue
+		}
+		policy.Namespace = o.resource.Namespace
+		policies = append(policies, policy)
+	}
+
+	endpoints := policyEndpoints(objects, namespaceLabels)
+	for _, e := range endpoints {
+		for _, direction := range []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress} {
+			for _, qualified := range reachability.Isolating(e.endpoint, policies, direction) {
+				_, name, _ := strings.Cut(qualified, "/")
+				edges.add(byName["networkpolicies/"+name], e.object, "isolates")
+			}
+		}
+	}
+
+	for _, o := range objects {
+		if o.resource.ResourceType != "services" {
+			continue
+		}
+		selector, _, _ := unstructured.NestedStringMap(o.obj.Object, "spec", "selector")
+		if len(selector) == 0 {
+			continue
+		}
+		for _, e := range endpoints {
+			if !matchLabels(selector, e.endpoint.Labels) {
+				continue
+			}
+			if i := edges.add(o, e.object, "exposes"); i >= 0 {
+				setData(&edges.edges[i].Data, "networkPolicy", reachability.Ingress(e.endpoint, policies))
+			}
+		}
+	}
+
+	if !pairs {
+		return
+	}
+	for _, from := range endpoints {
+		for _, to := range endpoints {
+			if from.object == to.object {
+				continue
+			}
+			entry := reachability.Evaluate(from.endpoint, to.endpoint, policies)
+			if entry.Allowed && len(entry.Policies) == 0 {
+				continue
+			}
+			label, edgeType := "allows-traffic", EdgeTypeAllowed
+			if !entry.Allowed {
+				label, edgeType = "denies-traffic", EdgeTypeDenied
+			}
+			if i := edges.add(from.object, to.object, label); i >= 0 {
+				edges.edges[i].Type = edgeType
+				setData(&edges.edges[i].Data, "networkPolicy", entry)
+			}
+		}
+	}
+}
+
+// policyEndpoints groups the running pods of a namespace graph by the node standing for them, the
+// labels of a group are those of its first pod. Pods on the host network are out of reach of
+// network policies.
+func policyEndpoints(objects []*graphObject, namespaceLabels map[string]string) []policyEndpoint {
+	endpoints := []policyEndpoint{}
+	seen := map[*graphObject]bool{}
+	for _, o := range objects {
+		if o.resource.ResourceType != "pods" {
+			continue
+		}
+		phase, _, _ := unstructured.NestedString(o.obj.Object, "status", "phase")
+		hostNetwork, _, _ := unstructured.NestedBool(o.obj.Object, "spec", "hostNetwork")
+		visible := o.visible()
+		if phase == string(corev1.PodSucceeded) || phase == string(corev1.PodFailed) || hostNetwork || visible == nil || seen[visible] {
+			continue
+		}
+		seen[visible] = true
+		endpoints = append(endpoints, policyEndpoint{
+			object: visible,
+			endpoint: reachability.Endpoint{
+				ID:              visible.nodeID,
+				Namespace:       o.resource.Namespace,
+				Labels:          o.obj.GetLabels(),
+				NamespaceLabels: namespaceLabels,
+			},
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].object.nodeID < endpoints[j].object.nodeID })
+	return endpoints
+}
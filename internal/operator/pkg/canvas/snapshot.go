@@ -0,0 +1,228 @@
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const snapshotsDirName = "canvas-snapshots"
+
+// ErrSnapshotNotFound is returned for snapshots that were never saved or were deleted
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a graph saved under a name, to compare the topology of a resource against later
+type Snapshot struct {
+	SnapshotSummary
+	Graph GraphResponse `json:"graph"`
+}
+
+// SnapshotSummary describes a snapshot without its graph
+type SnapshotSummary struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Cluster    string             `json:"cluster"`
+	Resource   ResourceIdentifier `json:"resource"`
+	AttackPath bool               `json:"attackPath,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Nodes      int                `json:"nodes"`
+	Edges      int                `json:"edges"`
+}
+
+// GraphDiff lists what was added to and removed from a snapshot's topology
+type GraphDiff struct {
+	Snapshot     SnapshotSummary `json:"snapshot"`
+	AddedNodes   []Node          `json:"addedNodes"`
+	RemovedNodes []Node          `json:"removedNodes"`
+	AddedEdges   []Edge          `json:"addedEdges"`
+	RemovedEdges []Edge          `json:"removedEdges"`
+}
+
+// SnapshotStore saves snapshots as one file each
+type SnapshotStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+var (
+	snapshotStore     *SnapshotStore
+	snapshotStoreOnce sync.Once
+)
+
+// GetSnapshotStore returns the shared snapshot store
+func GetSnapshotStore() *SnapshotStore {
+	snapshotStoreOnce.Do(func() {
+		snapshotStore = &SnapshotStore{dir: filepath.Join(utils.ConfigDir(), snapshotsDirName)}
+	})
+	return snapshotStore
+}
+
+// Save stores the graph of a resource under a name
+func (s *SnapshotStore) Save(name, cluster string, resource ResourceIdentifier, attackPath bool, graph *GraphResponse) (*Snapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("snapshot name is required")
+	}
+
+	snapshot := &Snapshot{
+		SnapshotSummary: SnapshotSummary{
+			ID:         uuid.NewString(),
+			Name:       name,
+			Cluster:    cluster,
+			Resource:   resource,
+			AttackPath: attackPath,
+			CreatedAt:  time.Now(),
+			Nodes:      len(graph.Nodes),
+			Edges:      len(graph.Edges),
+		},
+		Graph: *graph.clone(),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := utils.WriteJSONFileMode(s.path(snapshot.ID), snapshot, 0600); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// List returns the snapshots of a cluster, newest first
+func (s *SnapshotStore) List(cluster string) ([]SnapshotSummary, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	summaries := []SnapshotSummary{}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+		snapshot, err := s.load(id)
+		if err != nil || snapshot.Cluster != cluster {
+			continue
+		}
+		summaries = append(summaries, snapshot.SnapshotSummary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.After(summaries[j].CreatedAt)
+	})
+	return summaries, nil
+}
+
+// Get returns a snapshot of a cluster with its graph
+func (s *SnapshotStore) Get(cluster, id string) (*Snapshot, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Cluster != cluster {
+		return nil, ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+// Delete removes a snapshot of a cluster
+func (s *SnapshotStore) Delete(cluster, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if snapshot.Cluster != cluster {
+		return ErrSnapshotNotFound
+	}
+	return os.Remove(s.path(id))
+}
+
+// RetentionSource lists the snapshot files for the retention policies
+func (s *SnapshotStore) RetentionSource() retention.Source {
+	return retention.DirSource(s.dir)
+}
+
+func (s *SnapshotStore) load(id string) (*Snapshot, error) {
+	// Ids are uuids, which keeps them from naming files outside the snapshots directory
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrSnapshotNotFound
+	}
+	if _, err := os.Stat(s.path(id)); os.IsNotExist(err) {
+		return nil, ErrSnapshotNotFound
+	}
+	snapshot := &Snapshot{}
+	if err := utils.ReadJSONFile(s.path(id), snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// DiffGraphs compares the current graph of a resource with a snapshot of it. Nodes are matched by
+// id, which holds their kind and name, and edges by their ends and label, as edge ids are positional.
+func DiffGraphs(snapshot *Snapshot, current *GraphResponse) *GraphDiff {
+	diff := &GraphDiff{
+		Snapshot:     snapshot.SnapshotSummary,
+		AddedNodes:   []Node{},
+		RemovedNodes: []Node{},
+		AddedEdges:   []Edge{},
+		RemovedEdges: []Edge{},
+	}
+
+	before := make(map[string]bool, len(snapshot.Graph.Nodes))
+	for _, node := range snapshot.Graph.Nodes {
+		before[node.ID] = true
+	}
+	after := make(map[string]bool, len(current.Nodes))
+	for _, node := range current.Nodes {
+		after[node.ID] = true
+		if !before[node.ID] {
+			diff.AddedNodes = append(diff.AddedNodes, node)
+		}
+	}
+	for _, node := range snapshot.Graph.Nodes {
+		if !after[node.ID] {
+			diff.RemovedNodes = append(diff.RemovedNodes, node)
+		}
+	}
+
+	beforeEdges := make(map[string]bool, len(snapshot.Graph.Edges))
+	for _, edge := range snapshot.Graph.Edges {
+		beforeEdges[edgeKey(edge)] = true
+	}
+	afterEdges := make(map[string]bool, len(current.Edges))
+	for _, edge := range current.Edges {
+		afterEdges[edgeKey(edge)] = true
+		if !beforeEdges[edgeKey(edge)] {
+			diff.AddedEdges = append(diff.AddedEdges, edge)
+		}
+	}
+	for _, edge := range snapshot.Graph.Edges {
+		if !afterEdges[edgeKey(edge)] {
+			diff.RemovedEdges = append(diff.RemovedEdges, edge)
+		}
+	}
+	return diff
+}
+
+func edgeKey(edge Edge) string {
+	return edge.Source + "|" + edge.Target + "|" + edge.Label
+}
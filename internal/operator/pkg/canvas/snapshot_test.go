@@ -0,0 +1,81 @@
+package canvas
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	t.Parallel()
+
+	snapshot := &Snapshot{Graph: GraphResponse{
+		Nodes: []Node{{ID: "node-deployment-web"}, {ID: "node-replicaset-web-1"}, {ID: "node-configmap-settings"}},
+		Edges: []Edge{
+			{ID: "edge-1", Source: "node-deployment-web", Target: "node-replicaset-web-1", Label: "owns"},
+			{ID: "edge-2", Source: "node-deployment-web", Target: "node-configmap-settings", Label: "mounts"},
+		},
+	}}
+	current := &GraphResponse{
+		Nodes: []Node{{ID: "node-deployment-web"}, {ID: "node-replicaset-web-2"}, {ID: "node-configmap-settings"}},
+		Edges: []Edge{
+			// Edge ids are positional, the mount keeps its id of the snapshot's first edge
+			{ID: "edge-1", Source: "node-deployment-web", Target: "node-configmap-settings", Label: "mounts"},
+			{ID: "edge-2", Source: "node-deployment-web", Target: "node-replicaset-web-2", Label: "owns"},
+		},
+	}
+
+	diff := DiffGraphs(snapshot, current)
+	if len(diff.AddedNodes) != 1 || diff.AddedNodes[0].ID != "node-replicaset-web-2" {
+		t.Errorf("AddedNodes = %+v, want node-replicaset-web-2", diff.AddedNodes)
+	}
+	if len(diff.RemovedNodes) != 1 || diff.RemovedNodes[0].ID != "node-replicaset-web-1" {
+		t.Errorf("RemovedNodes = %+v, want node-replicaset-web-1", diff.RemovedNodes)
+	}
+	if len(diff.AddedEdges) != 1 || diff.AddedEdges[0].Target != "node-replicaset-web-2" {
+		t.Errorf("AddedEdges = %+v, want the edge to node-replicaset-web-2", diff.AddedEdges)
+	}
+	if len(diff.RemovedEdges) != 1 || diff.RemovedEdges[0].Target != "node-replicaset-web-1" {
+		t.Errorf("RemovedEdges = %+v, want the edge to node-replicaset-web-1", diff.RemovedEdges)
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	t.Parallel()
+
+	store := &SnapshotStore{dir: t.TempDir()}
+	resource := ResourceIdentifier{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"}
+	graph := &GraphResponse{Nodes: []Node{{ID: "node-deployment-web"}}}
+
+	if _, err := store.Save(" ", "prod", resource, false, graph); err == nil {
+		t.Error("Save() without name succeeded")
+	}
+	saved, err := store.Save("v1.2", "prod", resource, false, graph)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := store.Save("v1.2", "staging", resource, false, graph); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	summaries, err := store.List("prod")
+	if err != nil || len(summaries) != 1 || summaries[0].ID != saved.ID || summaries[0].Nodes != 1 {
+		t.Fatalf("List() = %+v, %v, want the prod snapshot", summaries, err)
+	}
+	if _, err := store.Get("staging", saved.ID); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Get() from another cluster error = %v, want %v", err, ErrSnapshotNotFound)
+	}
+	if _, err := store.Get("prod", "../secrets"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Get() with a path error = %v, want %v", err, ErrSnapshotNotFound)
+	}
+	got, err := store.Get("prod", saved.ID)
+	if err != nil || len(got.Graph.Nodes) != 1 {
+		t.Fatalf("Get() = %+v, %v, want the saved graph", got, err)
+	}
+
+	if err := store.Delete("prod", saved.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get("prod", saved.ID); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrSnapshotNotFound)
+	}
+}
@@ -0,0 +1,170 @@
+package canvas
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// defaultClassAnnotation marks the storage class used by claims without one
+const defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// addVolumeNodes adds the claims a pod mounts, the volumes bound to them and their storage classes.
+// Pods sharing a claim share its node, claims that can't be read are left out.
+func (c *Controller) addVolumeNodes(ctx context.Context, client dynamic.Interface, pod ResourceIdentifier, podNodeID string, response *GraphResponse) error {
+	podObj, err := client.Resource(schema.GroupVersionResource{
+		Version:  "v1",
+		Resource: "pods",
+	}).Namespace(pod.Namespace).Get(ctx, pod.ResourceName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, claimName := range podClaims(podObj) {
+		claim := ResourceIdentifier{Namespace: pod.Namespace, Version: "v1", ResourceType: "persistentvolumeclaims", ResourceName: claimName}
+		claimNode, claimObj, ok := c.storageNode(ctx, client, claim, response)
+		if !ok {
+			continue
+		}
+
+		// Add edge from pod to the claims it mounts
+		addEdgeOnce(response, podNodeID, claimNode, "mounts")
+
+		if volumeName, _, _ := unstructured.NestedString(claimObj.Object, "spec", "volumeName"); volumeName != "" {
+			volume := ResourceIdentifier{Version: "v1", ResourceType: "persistentvolumes", ResourceName: volumeName}
+			if volumeNode, _, ok := c.storageNode(ctx, client, volume, response); ok {
+				addEdgeOnce(response, claimNode, volumeNode, "bound-to")
+			}
+		}
+
+		// Claims without a class are left to the cluster default, which resolves once bound
+		if className, _, _ := unstructured.NestedString(claimObj.Object, "spec", "storageClassName"); className != "" {
+			class := ResourceIdentifier{Group: "storage.k8s.io", Version: "v1", ResourceType: "storageclasses", ResourceName: className}
+			if classNode, _, ok := c.storageNode(ctx, client, class, response); ok {
+				addEdgeOnce(response, claimNode, classNode, "uses-class")
+			}
+		}
+	}
+	return nil
+}
+
+// storageNode returns the ID of the node of a storage resource, adding it with its storage details
+// unless it is already in the graph
+func (c *Controller) storageNode(ctx context.Context, client dynamic.Interface, resource ResourceIdentifier, response *GraphResponse) (string, *unstructured.Unstructured, bool) {
+	obj, err := client.Resource(schema.GroupVersionResource{
+		Group:    resource.Group,
+		Version:  resource.Version,
+		Resource: resource.ResourceType,
+	}).Namespace(resource.Namespace).Get(ctx, resource.ResourceName, metav1.GetOptions{})
+	if err != nil {
+		return "", nil, false
+	}
+
+	node := c.resourceNode(resource, obj)
+	if !hasNode(response, node.ID) {
+		node.Data["storage"] = storageDetails(obj)
+		response.Nodes = append(response.Nodes, node)
+	}
+	return node.ID, obj, true
+}
+
+// addEdgeOnce links two nodes unless they are already linked with the label, e.g. pods sharing a
+// claim reach its volume a single time. It returns the index of the edge.
+func addEdgeOnce(response *GraphResponse, source, target, label string) int {
+	for i, edge := range response.Edges {
+		if edge.Source == source && edge.Target == target && edge.Label == label {
+			return i
+		}
+	}
+	response.Edges = append(response.Edges, Edge{
+		ID:     fmt.Sprintf("edge-%d", len(response.Edges)+1),
+		Source: source,
+		Target: target,
+		Type:   "smoothstep",
+		Label:  label,
+	})
+	return len(response.Edges) - 1
+}
+
+// podClaims returns the claims a pod mounts, including the ephemeral claims Kubernetes creates for it
+func podClaims(pod *unstructured.Unstructured) []string {
+	claims := []string{}
+	volumes, _, _ := unstructured.NestedSlice(pod.Object, "spec", "volumes")
+	for _, item := range volumes {
+		volume, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(volume, "persistentVolumeClaim", "claimName"); name != "" {
+			claims = append(claims, name)
+		} else if _, found, _ := unstructured.NestedMap(volume, "ephemeral"); found {
+			// Generic ephemeral volumes are backed by a claim named after the pod and the volume
+			name, _, _ := unstructured.NestedString(volume, "name")
+			claims = append(claims, pod.GetName()+"-"+name)
+		}
+	}
+	return claims
+}
+
+// storageDetails returns the capacity, access modes and binding status of claims and volumes, and
+// the provisioner and policies of storage classes
+func storageDetails(obj *unstructured.Unstructured) map[string]interface{} {
+	details := map[string]interface{}{}
+	set := func(key string, value interface{}, found bool) {
+		if found {
+			details[key] = value
+		}
+	}
+
+	switch obj.GetKind() {
+	case "PersistentVolumeClaim":
+		requested, found, _ := unstructured.NestedString(obj.Object, "spec", "resources", "requests", "storage")
+		set("requested", requested, found)
+		capacity, found, _ := unstructured.NestedString(obj.Object, "status", "capacity", "storage")
+		set("capacity", capacity, found)
+		accessModes, found, _ := unstructured.NestedStringSlice(obj.Object, "status", "accessModes")
+		if !found {
+			accessModes, found, _ = unstructured.NestedStringSlice(obj.Object, "spec", "accessModes")
+		}
+		set("accessModes", accessModes, found)
+		phase, found, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		set("phase", phase, found)
+		volumeName, found, _ := unstructured.NestedString(obj.Object, "spec", "volumeName")
+		set("volumeName", volumeName, found && volumeName != "")
+		storageClass, found, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+		set("storageClass", storageClass, found)
+		volumeMode, found, _ := unstructured.NestedString(obj.Object, "spec", "volumeMode")
+		set("volumeMode", volumeMode, found)
+	case "PersistentVolume":
+		capacity, found, _ := unstructured.NestedString(obj.Object, "spec", "capacity", "storage")
+		set("capacity", capacity, found)
+		accessModes, found, _ := unstructured.NestedStringSlice(obj.Object, "spec", "accessModes")
+		set("accessModes", accessModes, found)
+		phase, found, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		set("phase", phase, found)
+		namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "claimRef", "namespace")
+		name, found, _ := unstructured.NestedString(obj.Object, "spec", "claimRef", "name")
+		set("claim", namespace+"/"+name, found)
+		storageClass, found, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName")
+		set("storageClass", storageClass, found)
+		reclaimPolicy, found, _ := unstructured.NestedString(obj.Object, "spec", "persistentVolumeReclaimPolicy")
+		set("reclaimPolicy", reclaimPolicy, found)
+		volumeMode, found, _ := unstructured.NestedString(obj.Object, "spec", "volumeMode")
+		set("volumeMode", volumeMode, found)
+	case "StorageClass":
+		provisioner, found, _ := unstructured.NestedString(obj.Object, "provisioner")
+		set("provisioner", provisioner, found)
+		reclaimPolicy, found, _ := unstructured.NestedString(obj.Object, "reclaimPolicy")
+		set("reclaimPolicy", reclaimPolicy, found)
+		bindingMode, found, _ := unstructured.NestedString(obj.Object, "volumeBindingMode")
+		set("volumeBindingMode", bindingMode, found)
+		expansion, found, _ := unstructured.NestedBool(obj.Object, "allowVolumeExpansion")
+		set("allowVolumeExpansion", expansion, found)
+		details["default"] = obj.GetAnnotations()[defaultClassAnnotation] == "true"
+	}
+	return details
+}
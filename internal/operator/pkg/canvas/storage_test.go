@@ -0,0 +1,137 @@
+package canvas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func storageObject(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestAddVolumeNodes(t *testing.T) {
+	t.Parallel()
+
+	podSpec := func(claim string) map[string]interface{} {
+		return map[string]interface{}{"spec": map[string]interface{}{"volumes": []interface{}{
+			map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": claim}},
+			map[string]interface{}{"name": "scratch", "ephemeral": map[string]interface{}{}},
+			map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "web-config"}},
+		}}}
+	}
+	class := storageObject("storage.k8s.io/v1", "StorageClass", "", "fast", map[string]interface{}{
+		"provisioner":          "ebs.csi.aws.com",
+		"reclaimPolicy":        "Delete",
+		"volumeBindingMode":    "WaitForFirstConsumer",
+		"allowVolumeExpansion": true,
+	})
+	class.SetAnnotations(map[string]string{defaultClassAnnotation: "true"})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		storageObject("v1", "Pod", "shop", "db-0", podSpec("data-db-0")),
+		storageObject("v1", "Pod", "shop", "db-1", podSpec("data-db-0")),
+		storageObject("v1", "PersistentVolumeClaim", "shop", "data-db-0", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"accessModes":      []interface{}{"ReadWriteMany"},
+				"resources":        map[string]interface{}{"requests": map[string]interface{}{"storage": "10Gi"}},
+				"storageClassName": "fast",
+				"volumeName":       "pv-1",
+			},
+			"status": map[string]interface{}{
+				"phase":       "Bound",
+				"accessModes": []interface{}{"ReadWriteMany"},
+				"capacity":    map[string]interface{}{"storage": "16Gi"},
+			},
+		}),
+		storageObject("v1", "PersistentVolume", "", "pv-1", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"accessModes":                   []interface{}{"ReadWriteMany"},
+				"capacity":                      map[string]interface{}{"storage": "16Gi"},
+				"claimRef":                      map[string]interface{}{"namespace": "shop", "name": "data-db-0"},
+				"persistentVolumeReclaimPolicy": "Delete",
+				"storageClassName":              "fast",
+			},
+			"status": map[string]interface{}{"phase": "Bound"},
+		}),
+		class,
+	)
+
+	c := &Controller{}
+	response := &GraphResponse{}
+	for _, name := range []string{"db-0", "db-1"} {
+		pod := ResourceIdentifier{Namespace: "shop", Version: "v1", ResourceType: "pods", ResourceName: name}
+		if err := c.addVolumeNodes(context.Background(), client, pod, "node-pod-"+name, response); err != nil {
+			t.Fatalf("addVolumeNodes(%s) error = %v", name, err)
+		}
+	}
+
+	nodes := map[string]map[string]interface{}{}
+	for _, node := range response.Nodes {
+		if _, ok := nodes[node.ID]; ok {
+			t.Errorf("node %s added twice", node.ID)
+		}
+		nodes[node.ID], _ = node.Data["storage"].(map[string]interface{})
+	}
+	want := map[string]map[string]interface{}{
+		"node-persistentvolumeclaim-data-db-0": {
+			"requested":    "10Gi",
+			"capacity":     "16Gi",
+			"accessModes":  []string{"ReadWriteMany"},
+			"phase":        "Bound",
+			"volumeName":   "pv-1",
+			"storageClass": "fast",
+		},
+		"node-persistentvolume-pv-1": {
+			"capacity":      "16Gi",
+			"accessModes":   []string{"ReadWriteMany"},
+			"phase":         "Bound",
+			"claim":         "shop/data-db-0",
+			"storageClass":  "fast",
+			"reclaimPolicy": "Delete",
+		},
+		"node-storageclasse-fast": {
+			"provisioner":          "ebs.csi.aws.com",
+			"reclaimPolicy":        "Delete",
+			"volumeBindingMode":    "WaitForFirstConsumer",
+			"allowVolumeExpansion": true,
+			"default":              true,
+		},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes = %v, want %v", nodes, want)
+	}
+
+	// The ephemeral claims don't exist and are left out
+	wantEdges := []string{
+		"node-persistentvolumeclaim-data-db-0 bound-to node-persistentvolume-pv-1",
+		"node-persistentvolumeclaim-data-db-0 uses-class node-storageclasse-fast",
+		"node-pod-db-0 mounts node-persistentvolumeclaim-data-db-0",
+		"node-pod-db-1 mounts node-persistentvolumeclaim-data-db-0",
+	}
+	if got := edgeLabels(response.Edges); !reflect.DeepEqual(got, wantEdges) {
+		t.Errorf("edges = %v, want %v", got, wantEdges)
+	}
+}
+
+func TestPodClaims(t *testing.T) {
+	t.Parallel()
+
+	pod := storageObject("v1", "Pod", "shop", "web-1", map[string]interface{}{"spec": map[string]interface{}{"volumes": []interface{}{
+		map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": "web-data"}},
+		map[string]interface{}{"name": "cache", "ephemeral": map[string]interface{}{"volumeClaimTemplate": map[string]interface{}{}}},
+		map[string]interface{}{"name": "tmp", "emptyDir": map[string]interface{}{}},
+	}}})
+
+	if got, want := podClaims(pod), []string{"web-data", "web-1-cache"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("podClaims() = %v, want %v", got, want)
+	}
+}
@@ -14,6 +14,8 @@ type Edge struct {
 	Target string `json:"target"`
 	Type   string `json:"type"`
 	Label  string `json:"label"`
+	// Data carries metadata overlaid on the edge, like observed traffic
+	Data map[string]interface{} `json:"data,omitempty"`
 }
 
 // Position represents x,y coordinates of a node
@@ -26,6 +28,8 @@ type Position struct {
 type GraphResponse struct {
 	Nodes []Node `json:"nodes"`
 	Edges []Edge `json:"edges"`
+	// AttackPath is the easiest exploit path of an attack-path graph, when scoring is enabled
+	AttackPath *AttackPath `json:"attackPath,omitempty"`
 }
 
 // ResourceIdentifier represents a unique resource in Kubernetes
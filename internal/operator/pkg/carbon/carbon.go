@@ -0,0 +1,329 @@
+package carbon
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+	settingsFileName = "carbon.json"
+	trendsFileName   = "carbon-trends.json"
+
+	// tickInterval is how often the sampler checks whether a sample is due
+	tickInterval = time.Minute
+)
+
+// Settings configure the footprint estimation and the periodic sampling feeding the trends
+type Settings struct {
+	// Enabled turns on the periodic sampling, estimates on demand work regardless
+	Enabled bool `json:"enabled"`
+	// Clusters limits sampling to these contexts, empty samples every context
+	Clusters        []string `json:"clusters"`
+	IntervalMinutes int      `json:"intervalMinutes"`
+	RetentionDays   int      `json:"retentionDays"`
+	// PUE is the power usage effectiveness of the data centers, the facility overhead over the IT power
+	PUE float64 `json:"pue"`
+	// AssumedUtilization is the CPU utilization of nodes of clusters without a metrics API
+	AssumedUtilization float64 `json:"assumedUtilization"`
+	// DefaultCarbonIntensity in gCO2e/kWh applies to regions without a known intensity, 0 uses the world average
+	DefaultCarbonIntensity float64 `json:"defaultCarbonIntensity"`
+	// CarbonIntensity overrides the intensity of regions in gCO2e/kWh, e.g. with the figures of the provider
+	CarbonIntensity map[string]float64 `json:"carbonIntensity"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Clusters:           []string{},
+		IntervalMinutes:    15,
+		RetentionDays:      30,
+		PUE:                1.2,
+		AssumedUtilization: 0.5,
+		CarbonIntensity:    map[string]float64{},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.IntervalMinutes < 1 || s.IntervalMinutes > 60 {
+		return fmt.Errorf("intervalMinutes must be between 1 and 60")
+	}
+	if s.RetentionDays < 1 || s.RetentionDays > 366 {
+		return fmt.Errorf("retentionDays must be between 1 and 366")
+	}
+	if s.PUE < 1 || s.PUE > 3 {
+		return fmt.Errorf("pue must be between 1 and 3")
+	}
+	if s.AssumedUtilization < 0 || s.AssumedUtilization > 1 {
+		return fmt.Errorf("assumedUtilization must be between 0 and 1")
+	}
+	if s.DefaultCarbonIntensity < 0 {
+		return fmt.Errorf("defaultCarbonIntensity must not be negative")
+	}
+	for region, intensity := range s.CarbonIntensity {
+		if intensity < 0 {
+			return fmt.Errorf("carbon intensity of %s must not be negative", region)
+		}
+	}
+	return nil
+}
+
+// Manager estimates the energy and carbon footprint of clusters and samples it periodically into
+// hourly trends
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	trendsPath      string
+	mutex           sync.Mutex
+	// trends holds the hourly buckets of every sampled cluster, oldest first
+	trends   map[string][]Bucket
+	loaded   bool
+	lastRun  time.Time
+	stopChan chan struct{}
+}
+
+// NewManager creates a new footprint manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		trendsPath:      filepath.Join(utils.ConfigDir(), trendsFileName),
+		trends:          map[string][]Bucket{},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current footprint settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new footprint settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+	if settings.CarbonIntensity == nil {
+		settings.CarbonIntensity = map[string]float64{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start samples the configured clusters until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the sampling loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Estimate computes the current power draw and emission rate of a cluster
+func (m *Manager) Estimate(ctx context.Context, clusterName string) (*Estimate, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	return m.estimate(ctx, clusterName, settings)
+}
+
+// monitor samples the configured clusters when the interval elapsed
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load carbon footprint settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	clusters := settings.Clusters
+	if len(clusters) == 0 {
+		contexts, err := m.kubeConfigStore.GetContexts()
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to list contexts for carbon footprint sampling")
+			return
+		}
+		for _, kubeContext := range contexts {
+			clusters = append(clusters, kubeContext.Name)
+		}
+	}
+
+	interval := time.Duration(settings.IntervalMinutes) * time.Minute
+	for _, clusterName := range clusters {
+		// Clusters over their resource budget are skipped until they are resumed
+		if budget.Paused(clusterName) {
+			continue
+		}
+		estimate, err := m.estimate(context.Background(), clusterName, settings)
+		if err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to estimate carbon footprint")
+			continue
+		}
+		if err := m.record(estimate, interval, settings.RetentionDays); err != nil {
+			logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to store carbon footprint sample")
+		}
+	}
+}
+
+// estimate reads the nodes, pods and their usage from a cluster and estimates its footprint
+func (m *Manager) estimate(ctx context.Context, clusterName string, settings Settings) (*Estimate, error) {
+	defer budget.Track(clusterName, "carbon")()
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	profiles, err := Profiles()
+	if err != nil {
+		return nil, err
+	}
+
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	podList, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	// Usage is optional, clusters without metrics server get the assumed utilization
+	usageSource := UsageMetricsServer
+	nodeUsage, podUsage, err := usage(ctx, clientset)
+	if err != nil {
+		usageSource = UsageAssumed
+	}
+
+	nodes := make([]nodeInput, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		input := nodeInput{
+			Name:         node.Name,
+			InstanceType: firstLabel(node.Labels, corev1.LabelInstanceTypeStable, corev1.LabelInstanceType),
+			Region:       firstLabel(node.Labels, corev1.LabelTopologyRegion, corev1.LabelFailureDomainBetaRegion),
+			Provider:     providerOf(node.Spec.ProviderID),
+			VCPUs:        float64(node.Status.Capacity.Cpu().MilliValue()) / 1000,
+			MemoryGiB:    float64(node.Status.Capacity.Memory().Value()) / (1 << 30),
+			CPUUsage:     -1,
+		}
+		if used, ok := nodeUsage[node.Name]; ok {
+			input.CPUUsage = used
+		}
+		nodes = append(nodes, input)
+	}
+
+	pods := make([]podInput, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		input := podInput{Namespace: pod.Namespace, Node: pod.Spec.NodeName, CPUUsage: -1}
+		for _, container := range pod.Spec.Containers {
+			input.CPURequest += float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+		}
+		if used, ok := podUsage[pod.Namespace+"/"+pod.Name]; ok {
+			input.CPUUsage = used
+		}
+		pods = append(pods, input)
+	}
+
+	nodeEstimates, namespaceEstimates := estimate(nodes, pods, profiles, settings)
+	result := &Estimate{
+		Cluster:     clusterName,
+		At:          time.Now(),
+		UsageSource: usageSource,
+		PUE:         settings.PUE,
+		Nodes:       nodeEstimates,
+		Namespaces:  namespaceEstimates,
+	}
+	for _, node := range nodeEstimates {
+		result.Watts += node.Watts
+		result.GramsPerHour += node.GramsPerHour
+	}
+	return result, nil
+}
+
+// usage reads the CPU usage in cores of the nodes and pods from the metrics API
+func usage(ctx context.Context, clientset *kubernetes.Clientset) (map[string]float64, map[string]float64, error) {
+	nodeMetrics := &v1beta1.NodeMetricsList{}
+	if err := clientset.RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/nodes").Do(ctx).Into(nodeMetrics); err != nil {
+		return nil, nil, err
+	}
+	podMetrics := &v1beta1.PodMetricsList{}
+	if err := clientset.RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/pods").Do(ctx).Into(podMetrics); err != nil {
+		return nil, nil, err
+	}
+
+	nodes := make(map[string]float64, len(nodeMetrics.Items))
+	for _, item := range nodeMetrics.Items {
+		nodes[item.Name] = float64(item.Usage.Cpu().MilliValue()) / 1000
+	}
+	pods := make(map[string]float64, len(podMetrics.Items))
+	for _, item := range podMetrics.Items {
+		var used int64
+		for _, container := range item.Containers {
+			used += container.Usage.Cpu().MilliValue()
+		}
+		pods[item.Namespace+"/"+item.Name] = float64(used) / 1000
+	}
+	return nodes, pods, nil
+}
+
+func firstLabel(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := labels[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
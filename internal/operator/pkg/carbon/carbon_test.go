@@ -0,0 +1,135 @@
+package carbon
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProfileFor(t *testing.T) {
+	t.Parallel()
+
+	custom := PowerProfile{Match: "m6g.large", MinWattsPerVCPU: 0.5, MaxWattsPerVCPU: 2}
+	profiles := append([]PowerProfile{custom}, builtinProfiles...)
+
+	tests := []struct {
+		name         string
+		instanceType string
+		provider     string
+		want         string
+	}{
+		{name: "exact", instanceType: "m6g.large", provider: ProviderAWS, want: "m6g.large"},
+		{name: "family", instanceType: "m6g.xlarge", provider: ProviderAWS, want: "m6g."},
+		{name: "longest prefix", instanceType: "n2d-standard-4", provider: ProviderGCP, want: "n2d-"},
+		{name: "provider average", instanceType: "x2iedn.xlarge", provider: ProviderAWS, want: ProviderAWS},
+		{name: "unknown", instanceType: "", provider: ProviderOther, want: ProviderOther},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := profileFor(profiles, tt.instanceType, tt.provider); got.Match != tt.want {
+				t.Errorf("profileFor(%q) = %q, want %q", tt.instanceType, got.Match, tt.want)
+			}
+		})
+	}
+
+	if got := providerOf("aws:///us-east-1a/i-0123"); got != ProviderAWS {
+		t.Errorf("providerOf() = %q", got)
+	}
+	if got := providerOf("kind://docker/kind/kind-control-plane"); got != ProviderOther {
+		t.Errorf("providerOf() = %q", got)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+
+	settings := DefaultSettings()
+	settings.PUE = 1
+	settings.CarbonIntensity = map[string]float64{"lab": 100}
+	profiles := []PowerProfile{{Match: "test.", MinWattsPerVCPU: 1, MaxWattsPerVCPU: 3}}
+
+	nodes := []nodeInput{{Name: "a", InstanceType: "test.large", Region: "lab", VCPUs: 4, CPUUsage: 2}}
+	pods := []podInput{
+		{Namespace: "shop", Node: "a", CPURequest: 1, CPUUsage: 1.5},
+		{Namespace: "batch", Node: "a", CPURequest: 1, CPUUsage: 0.5},
+	}
+	nodeEstimates, namespaces := estimate(nodes, pods, profiles, settings)
+
+	// idle 4 vCPU * 1 W, half loaded: 4 * 0.5 * (3 - 1) W
+	if len(nodeEstimates) != 1 || !near(nodeEstimates[0].Watts, 8) || !near(nodeEstimates[0].GramsPerHour, 0.8) {
+		t.Fatalf("nodes = %+v", nodeEstimates)
+	}
+	want := map[string]float64{
+		"shop":        1 + 3,
+		"batch":       1 + 1,
+		NamespaceIdle: 2,
+	}
+	if len(namespaces) != len(want) {
+		t.Fatalf("namespaces = %+v", namespaces)
+	}
+	for _, namespace := range namespaces {
+		if !near(namespace.Watts, want[namespace.Namespace]) {
+			t.Errorf("namespace %s = %v W, want %v", namespace.Namespace, namespace.Watts, want[namespace.Namespace])
+		}
+	}
+	if namespaces[0].Namespace != "shop" {
+		t.Errorf("namespaces are not ordered by power: %+v", namespaces)
+	}
+
+	// Without usage the assumed utilization applies and the load follows the requests
+	nodes[0].CPUUsage = -1
+	for i := range pods {
+		pods[i].CPUUsage = -1
+	}
+	_, namespaces = estimate(nodes, pods, profiles, settings)
+	for _, namespace := range namespaces {
+		if namespace.Namespace == "shop" && !near(namespace.Watts, 1+2) {
+			t.Errorf("assumed namespace shop = %v W, want 3", namespace.Watts)
+		}
+	}
+}
+
+func TestTrend(t *testing.T) {
+	t.Parallel()
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	bucket := func(start time.Time, grams float64) Bucket {
+		return Bucket{
+			Start:      start,
+			Total:      Amount{WattHours: grams * 10, Grams: grams},
+			Nodes:      map[string]Amount{"a": {Grams: grams}},
+			Namespaces: map[string]Amount{"shop": {Grams: grams / 2}, "batch": {Grams: grams / 4}},
+		}
+	}
+	buckets := []Bucket{
+		bucket(day, 1),
+		bucket(day.Add(time.Hour), 2),
+		bucket(day.Add(25*time.Hour), 4),
+	}
+
+	series, err := trend(buckets, GroupByCluster, StepDay, time.Time{})
+	if err != nil {
+		t.Fatalf("trend() error = %v", err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 || series[0].Points[0].Grams != 3 || series[0].Total.Grams != 7 {
+		t.Errorf("daily cluster trend = %+v", series)
+	}
+
+	series, err = trend(buckets, GroupByNamespace, StepHour, day.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("trend() error = %v", err)
+	}
+	if len(series) != 2 || series[0].Key != "shop" || len(series[0].Points) != 2 || series[0].Total.Grams != 3 {
+		t.Errorf("hourly namespace trend = %+v", series)
+	}
+
+	if _, err := trend(buckets, "pod", StepHour, time.Time{}); err == nil {
+		t.Error("trend() expected an error for an unknown grouping")
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,170 @@
+package carbon
+
+import (
+	"sort"
+	"time"
+)
+
+// NamespaceIdle receives the idle power of the node capacity no pod requests
+const NamespaceIdle = "(idle)"
+
+// Usage sources of an estimate
+const (
+	UsageMetricsServer = "metrics-server"
+	// UsageAssumed means the cluster has no metrics API, the configured utilization is assumed
+	UsageAssumed = "assumed"
+)
+
+// nodeInput is what the estimate needs to know about a node
+type nodeInput struct {
+	Name         string
+	InstanceType string
+	Region       string
+	Provider     string
+	VCPUs        float64
+	MemoryGiB    float64
+	// CPUUsage is the used cores, negative when unknown
+	CPUUsage float64
+}
+
+// podInput is what the estimate needs to know about a pod
+type podInput struct {
+	Namespace  string
+	Node       string
+	CPURequest float64
+	// CPUUsage is the used cores, negative when unknown
+	CPUUsage float64
+}
+
+// NodeEstimate is the power and emissions of a node
+type NodeEstimate struct {
+	Name         string `json:"name"`
+	InstanceType string `json:"instanceType,omitempty"`
+	Region       string `json:"region,omitempty"`
+	// Profile is the power profile applied, an instance type, family prefix or provider
+	Profile     string  `json:"profile"`
+	Utilization float64 `json:"utilization"`
+	Watts       float64 `json:"watts"`
+	// CarbonIntensity is the grid intensity of the region in gCO2e/kWh
+	CarbonIntensity float64 `json:"carbonIntensity"`
+	GramsPerHour    float64 `json:"gramsPerHour"`
+}
+
+// NamespaceEstimate is the share of the node power and emissions attributed to a namespace
+type NamespaceEstimate struct {
+	Namespace    string  `json:"namespace"`
+	Watts        float64 `json:"watts"`
+	GramsPerHour float64 `json:"gramsPerHour"`
+}
+
+// Estimate is the instantaneous power and emissions of a cluster
+type Estimate struct {
+	Cluster      string              `json:"cluster"`
+	At           time.Time           `json:"at"`
+	UsageSource  string              `json:"usageSource"`
+	PUE          float64             `json:"pue"`
+	Watts        float64             `json:"watts"`
+	GramsPerHour float64             `json:"gramsPerHour"`
+	Nodes        []NodeEstimate      `json:"nodes"`
+	Namespaces   []NamespaceEstimate `json:"namespaces"`
+}
+
+// estimate computes the power of every node with the linear model of its profile, scaled by the PUE,
+// and attributes it to namespaces: the load dependent part by CPU usage, the idle part by CPU requests.
+func estimate(nodes []nodeInput, pods []podInput, profiles []PowerProfile, settings Settings) ([]NodeEstimate, []NamespaceEstimate) {
+	podsByNode := map[string][]podInput{}
+	for _, pod := range pods {
+		podsByNode[pod.Node] = append(podsByNode[pod.Node], pod)
+	}
+
+	nodeEstimates := make([]NodeEstimate, 0, len(nodes))
+	namespaces := map[string]*NamespaceEstimate{}
+	attribute := func(namespace string, watts, intensity float64) {
+		if watts <= 0 {
+			return
+		}
+		if namespaces[namespace] == nil {
+			namespaces[namespace] = &NamespaceEstimate{Namespace: namespace}
+		}
+		namespaces[namespace].Watts += watts
+		namespaces[namespace].GramsPerHour += watts / 1000 * intensity
+	}
+
+	for _, node := range nodes {
+		profile := profileFor(profiles, node.InstanceType, node.Provider)
+		utilization := settings.AssumedUtilization
+		if node.CPUUsage >= 0 && node.VCPUs > 0 {
+			utilization = clamp(node.CPUUsage/node.VCPUs, 0, 1)
+		}
+
+		idle := (node.VCPUs*profile.MinWattsPerVCPU + node.MemoryGiB*memoryWattsPerGiB) * settings.PUE
+		load := node.VCPUs * utilization * (profile.MaxWattsPerVCPU - profile.MinWattsPerVCPU) * settings.PUE
+		intensity := intensityFor(settings, node.Region)
+
+		nodeEstimates = append(nodeEstimates, NodeEstimate{
+			Name:            node.Name,
+			InstanceType:    node.InstanceType,
+			Region:          node.Region,
+			Profile:         profile.Match,
+			Utilization:     utilization,
+			Watts:           idle + load,
+			CarbonIntensity: intensity,
+			GramsPerHour:    (idle + load) / 1000 * intensity,
+		})
+
+		nodePods := podsByNode[node.Name]
+		var requested, used float64
+		for _, pod := range nodePods {
+			requested += pod.CPURequest
+			if pod.CPUUsage > 0 {
+				used += pod.CPUUsage
+			}
+		}
+		// Requests may exceed the capacity on overcommitted nodes
+		capacity := node.VCPUs
+		if requested > capacity {
+			capacity = requested
+		}
+
+		attributedIdle, attributedLoad := 0.0, 0.0
+		for _, pod := range nodePods {
+			if capacity > 0 {
+				share := idle * pod.CPURequest / capacity
+				attribute(pod.Namespace, share, intensity)
+				attributedIdle += share
+			}
+			// Without usage the load follows the requests
+			switch {
+			case used > 0:
+				share := load * clamp(pod.CPUUsage, 0, used) / used
+				attribute(pod.Namespace, share, intensity)
+				attributedLoad += share
+			case requested > 0:
+				share := load * pod.CPURequest / requested
+				attribute(pod.Namespace, share, intensity)
+				attributedLoad += share
+			}
+		}
+		attribute(NamespaceIdle, idle+load-attributedIdle-attributedLoad, intensity)
+	}
+
+	namespaceEstimates := make([]NamespaceEstimate, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		namespaceEstimates = append(namespaceEstimates, *namespace)
+	}
+	sort.Slice(nodeEstimates, func(i, j int) bool { return nodeEstimates[i].Name < nodeEstimates[j].Name })
+	sort.Slice(namespaceEstimates, func(i, j int) bool {
+		return namespaceEstimates[i].Watts > namespaceEstimates[j].Watts
+	})
+	return nodeEstimates, namespaceEstimates
+}
+
+func clamp(value, min, max float64) float64 {
+	switch {
+	case value < min:
+		return min
+	case value > max:
+		return max
+	}
+	return value
+}
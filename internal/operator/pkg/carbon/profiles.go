@@ -0,0 +1,166 @@
+package carbon
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	profilesFileName = "power-profiles.json"
+
+	// memoryWattsPerGiB is the power drawn by a GiB of memory, independent of its use
+	memoryWattsPerGiB = 0.392
+	// DefaultCarbonIntensity is the world average grid intensity in gCO2e/kWh, used for unknown regions
+	DefaultCarbonIntensity = 475
+)
+
+// Cloud providers told apart by the provider ID of the nodes
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gce"
+	ProviderAzure = "azure"
+	// ProviderOther covers on-premises and unknown providers
+	ProviderOther = "other"
+)
+
+// PowerProfile is the power drawn by a vCPU of an instance type, idle and at full load. The power
+// follows a linear model between both, memory is accounted separately.
+type PowerProfile struct {
+	// Match is an instance type, or a family prefix such as "m6g." or "n2d-"
+	Match           string  `json:"match"`
+	MinWattsPerVCPU float64 `json:"minWattsPerVCPU"`
+	MaxWattsPerVCPU float64 `json:"maxWattsPerVCPU"`
+	Description     string  `json:"description,omitempty"`
+}
+
+// builtinProfiles are estimates per CPU microarchitecture of the common instance families, after the
+// Cloud Carbon Footprint methodology. Users can extend them with ~/.agentkube/power-profiles.json.
+var builtinProfiles = []PowerProfile{
+	{Match: "m6g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton2"},
+	{Match: "c6g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton2"},
+	{Match: "r6g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton2"},
+	{Match: "t4g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton2"},
+	{Match: "m7g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton3"},
+	{Match: "c7g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton3"},
+	{Match: "r7g.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "AWS Graviton3"},
+	{Match: "m5.", MinWattsPerVCPU: 0.64, MaxWattsPerVCPU: 3.97, Description: "Intel Cascade Lake"},
+	{Match: "c5.", MinWattsPerVCPU: 0.64, MaxWattsPerVCPU: 3.97, Description: "Intel Cascade Lake"},
+	{Match: "r5.", MinWattsPerVCPU: 0.64, MaxWattsPerVCPU: 3.97, Description: "Intel Cascade Lake"},
+	{Match: "t3.", MinWattsPerVCPU: 0.64, MaxWattsPerVCPU: 3.97, Description: "Intel Cascade Lake"},
+	{Match: "m6i.", MinWattsPerVCPU: 0.66, MaxWattsPerVCPU: 4.00, Description: "Intel Ice Lake"},
+	{Match: "c6i.", MinWattsPerVCPU: 0.66, MaxWattsPerVCPU: 4.00, Description: "Intel Ice Lake"},
+	{Match: "r6i.", MinWattsPerVCPU: 0.66, MaxWattsPerVCPU: 4.00, Description: "Intel Ice Lake"},
+	{Match: "m5a.", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.64, Description: "AMD EPYC 1st gen"},
+	{Match: "m6a.", MinWattsPerVCPU: 0.45, MaxWattsPerVCPU: 2.02, Description: "AMD EPYC 3rd gen"},
+	{Match: "c6a.", MinWattsPerVCPU: 0.45, MaxWattsPerVCPU: 2.02, Description: "AMD EPYC 3rd gen"},
+	{Match: "e2-", MinWattsPerVCPU: 0.71, MaxWattsPerVCPU: 4.26, Description: "GCP E2, mixed microarchitectures"},
+	{Match: "n1-", MinWattsPerVCPU: 0.71, MaxWattsPerVCPU: 4.26, Description: "Intel Skylake"},
+	{Match: "n2-", MinWattsPerVCPU: 0.64, MaxWattsPerVCPU: 3.97, Description: "Intel Cascade Lake"},
+	{Match: "n2d-", MinWattsPerVCPU: 0.45, MaxWattsPerVCPU: 2.02, Description: "AMD EPYC 3rd gen"},
+	{Match: "t2d-", MinWattsPerVCPU: 0.45, MaxWattsPerVCPU: 2.02, Description: "AMD EPYC 3rd gen"},
+	{Match: "t2a-", MinWattsPerVCPU: 0.47, MaxWattsPerVCPU: 1.69, Description: "Ampere Altra"},
+}
+
+// providerProfiles are the average vCPU power of a provider, for instance types without a profile
+var providerProfiles = map[string]PowerProfile{
+	ProviderAWS:   {Match: ProviderAWS, MinWattsPerVCPU: 0.74, MaxWattsPerVCPU: 3.5, Description: "AWS average"},
+	ProviderGCP:   {Match: ProviderGCP, MinWattsPerVCPU: 0.71, MaxWattsPerVCPU: 4.26, Description: "GCP average"},
+	ProviderAzure: {Match: ProviderAzure, MinWattsPerVCPU: 0.78, MaxWattsPerVCPU: 3.76, Description: "Azure average"},
+	ProviderOther: {Match: ProviderOther, MinWattsPerVCPU: 0.74, MaxWattsPerVCPU: 3.5, Description: "server average"},
+}
+
+// builtinIntensities are approximate grid carbon intensities of cloud regions in gCO2e/kWh
+var builtinIntensities = map[string]float64{
+	"us-east-1":      379,
+	"us-east-2":      410,
+	"us-west-1":      322,
+	"us-west-2":      322,
+	"ca-central-1":   130,
+	"eu-west-1":      279,
+	"eu-west-2":      225,
+	"eu-west-3":      51,
+	"eu-central-1":   338,
+	"eu-north-1":     9,
+	"ap-south-1":     708,
+	"ap-southeast-1": 408,
+	"ap-southeast-2": 790,
+	"ap-northeast-1": 506,
+	"sa-east-1":      74,
+	"us-central1":    454,
+	"us-east1":       480,
+	"us-west1":       94,
+	"europe-west1":   212,
+	"europe-west4":   410,
+	"europe-north1":  127,
+	"asia-east1":     541,
+	"eastus":         379,
+	"westus2":        322,
+	"westeurope":     410,
+	"northeurope":    279,
+	"uksouth":        225,
+	"swedencentral":  9,
+}
+
+// Profiles returns the user supplied power profiles followed by the built-in ones
+func Profiles() ([]PowerProfile, error) {
+	var custom []PowerProfile
+	if err := utils.ReadJSONFile(filepath.Join(utils.ConfigDir(), profilesFileName), &custom); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]PowerProfile, 0, len(custom)+len(builtinProfiles))
+	profiles = append(profiles, custom...)
+	profiles = append(profiles, builtinProfiles...)
+	return profiles, nil
+}
+
+// profileFor returns the profile of an instance type: an exact match, else the longest matching
+// prefix, else the average of the provider. Earlier profiles win ties, so user profiles override.
+func profileFor(profiles []PowerProfile, instanceType, provider string) PowerProfile {
+	var best *PowerProfile
+	for i := range profiles {
+		profile := &profiles[i]
+		if instanceType == "" || !strings.HasPrefix(instanceType, profile.Match) {
+			continue
+		}
+		if profile.Match == instanceType {
+			return *profile
+		}
+		if best == nil || len(profile.Match) > len(best.Match) {
+			best = profile
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	if profile, ok := providerProfiles[provider]; ok {
+		return profile
+	}
+	return providerProfiles[ProviderOther]
+}
+
+// providerOf reads the provider of a node from its provider ID, e.g. aws:///us-east-1a/i-0123
+func providerOf(providerID string) string {
+	scheme, _, _ := strings.Cut(providerID, "://")
+	switch scheme {
+	case ProviderAWS, ProviderGCP, ProviderAzure:
+		return scheme
+	}
+	return ProviderOther
+}
+
+// intensityFor returns the grid carbon intensity of a region, the settings override the built-in values
+func intensityFor(settings Settings, region string) float64 {
+	if value, ok := settings.CarbonIntensity[region]; ok {
+		return value
+	}
+	if value, ok := builtinIntensities[region]; ok {
+		return value
+	}
+	if settings.DefaultCarbonIntensity > 0 {
+		return settings.DefaultCarbonIntensity
+	}
+	return DefaultCarbonIntensity
+}
@@ -0,0 +1,180 @@
+package carbon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+// Trend groupings
+const (
+	GroupByCluster   = "cluster"
+	GroupByNode      = "node"
+	GroupByNamespace = "namespace"
+)
+
+// Trend steps
+const (
+	StepHour = "hour"
+	StepDay  = "day"
+)
+
+// ErrInvalidTrend is returned for trend queries that can't be answered
+var ErrInvalidTrend = errors.New("invalid trend query")
+
+// Amount is the energy used and the carbon emitted over a period
+type Amount struct {
+	WattHours float64 `json:"wattHours"`
+	Grams     float64 `json:"grams"`
+}
+
+func (a *Amount) add(other Amount) {
+	a.WattHours += other.WattHours
+	a.Grams += other.Grams
+}
+
+// Bucket accumulates the samples of an hour
+type Bucket struct {
+	Start      time.Time         `json:"start"`
+	Total      Amount            `json:"total"`
+	Nodes      map[string]Amount `json:"nodes"`
+	Namespaces map[string]Amount `json:"namespaces"`
+}
+
+// TrendPoint is the footprint of a step
+type TrendPoint struct {
+	Start time.Time `json:"start"`
+	Amount
+}
+
+// TrendSeries is the footprint of a node, a namespace or the cluster over time
+type TrendSeries struct {
+	Key    string       `json:"key"`
+	Total  Amount       `json:"total"`
+	Points []TrendPoint `json:"points"`
+}
+
+// record adds an estimate, held for the sampling interval, to the hourly buckets of its cluster and
+// drops the buckets past the retention
+func (m *Manager) record(estimate *Estimate, interval time.Duration, retentionDays int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadTrends(); err != nil {
+		return err
+	}
+	hours := interval.Hours()
+	start := estimate.At.UTC().Truncate(time.Hour)
+
+	buckets := m.trends[estimate.Cluster]
+	if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+		buckets = append(buckets, Bucket{Start: start, Nodes: map[string]Amount{}, Namespaces: map[string]Amount{}})
+	}
+	bucket := &buckets[len(buckets)-1]
+	if bucket.Nodes == nil || bucket.Namespaces == nil {
+		bucket.Nodes, bucket.Namespaces = map[string]Amount{}, map[string]Amount{}
+	}
+
+	bucket.Total.add(Amount{WattHours: estimate.Watts * hours, Grams: estimate.GramsPerHour * hours})
+	for _, node := range estimate.Nodes {
+		amount := bucket.Nodes[node.Name]
+		amount.add(Amount{WattHours: node.Watts * hours, Grams: node.GramsPerHour * hours})
+		bucket.Nodes[node.Name] = amount
+	}
+	for _, namespace := range estimate.Namespaces {
+		amount := bucket.Namespaces[namespace.Namespace]
+		amount.add(Amount{WattHours: namespace.Watts * hours, Grams: namespace.GramsPerHour * hours})
+		bucket.Namespaces[namespace.Namespace] = amount
+	}
+
+	cutoff := start.AddDate(0, 0, -retentionDays)
+	kept := sort.Search(len(buckets), func(i int) bool { return buckets[i].Start.After(cutoff) })
+	m.trends[estimate.Cluster] = append([]Bucket(nil), buckets[kept:]...)
+
+	return utils.WriteJSONFile(m.trendsPath, m.trends)
+}
+
+// Trend returns the footprint of a cluster since the given time, per step and grouped by node,
+// namespace or for the whole cluster. Series are ordered by their total emissions.
+func (m *Manager) Trend(clusterName, groupBy, step string, since time.Time) ([]TrendSeries, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadTrends(); err != nil {
+		return nil, err
+	}
+	return trend(m.trends[clusterName], groupBy, step, since)
+}
+
+func trend(buckets []Bucket, groupBy, step string, since time.Time) ([]TrendSeries, error) {
+	var truncate func(time.Time) time.Time
+	switch step {
+	case "", StepHour:
+		truncate = func(t time.Time) time.Time { return t.Truncate(time.Hour) }
+	case StepDay:
+		truncate = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	default:
+		return nil, fmt.Errorf("%w: step must be hour or day", ErrInvalidTrend)
+	}
+
+	var amounts func(Bucket) map[string]Amount
+	switch groupBy {
+	case "", GroupByCluster:
+		amounts = func(b Bucket) map[string]Amount { return map[string]Amount{GroupByCluster: b.Total} }
+	case GroupByNode:
+		amounts = func(b Bucket) map[string]Amount { return b.Nodes }
+	case GroupByNamespace:
+		amounts = func(b Bucket) map[string]Amount { return b.Namespaces }
+	default:
+		return nil, fmt.Errorf("%w: groupBy must be cluster, node or namespace", ErrInvalidTrend)
+	}
+
+	series := map[string]*TrendSeries{}
+	for _, bucket := range buckets {
+		if bucket.Start.Before(since.Truncate(time.Hour)) {
+			continue
+		}
+		start := truncate(bucket.Start.UTC())
+		for key, amount := range amounts(bucket) {
+			s := series[key]
+			if s == nil {
+				s = &TrendSeries{Key: key, Points: []TrendPoint{}}
+				series[key] = s
+			}
+			s.Total.add(amount)
+			if n := len(s.Points); n > 0 && s.Points[n-1].Start.Equal(start) {
+				s.Points[n-1].add(amount)
+			} else {
+				s.Points = append(s.Points, TrendPoint{Start: start, Amount: amount})
+			}
+		}
+	}
+
+	result := make([]TrendSeries, 0, len(series))
+	for _, s := range series {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total.Grams != result[j].Total.Grams {
+			return result[i].Total.Grams > result[j].Total.Grams
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+func (m *Manager) loadTrends() error {
+	if m.loaded {
+		return nil
+	}
+	trends := map[string][]Bucket{}
+	if err := utils.ReadJSONFile(m.trendsPath, &trends); err != nil {
+		return err
+	}
+	m.trends = trends
+	m.loaded = true
+	return nil
+}
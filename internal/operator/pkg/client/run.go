@@ -1,17 +1,40 @@
 package client
 
 import (
+	"fmt"
+
 	config "github.com/agentkube/operator/config"
+	internalconfig "github.com/agentkube/operator/pkg/config"
 	dispatchers "github.com/agentkube/operator/pkg/dispatchers"
 	msteam "github.com/agentkube/operator/pkg/dispatchers/msteam"
+	opsgenie "github.com/agentkube/operator/pkg/dispatchers/opsgenie"
+	pagerduty "github.com/agentkube/operator/pkg/dispatchers/pagerduty"
 	slack "github.com/agentkube/operator/pkg/dispatchers/slack"
 	smtp "github.com/agentkube/operator/pkg/dispatchers/smtp"
 	webhook "github.com/agentkube/operator/pkg/dispatchers/webhook"
+	"github.com/agentkube/operator/pkg/logger"
 
 	"github.com/sirupsen/logrus"
 )
 
 func ParseEventHandler(conf *config.Config) dispatchers.Dispatcher {
+	eventHandler, err := NewEventHandler(conf)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return eventHandler
+}
+
+// NewEventHandler initializes the dispatcher selected by the handler configuration, the
+// dispatcher chain when one is configured
+func NewEventHandler(conf *config.Config) (dispatchers.Dispatcher, error) {
+	if len(conf.Handler.Chain) > 0 {
+		chain, err := NewChain(conf)
+		if err != nil {
+			return nil, err
+		}
+		return chain, nil
+	}
 
 	var eventHandler dispatchers.Dispatcher
 	switch {
@@ -25,12 +48,83 @@ func ParseEventHandler(conf *config.Config) dispatchers.Dispatcher {
 		eventHandler = new(msteam.MSTeams)
 	case len(conf.Handler.SMTP.Smarthost) > 0 || len(conf.Handler.SMTP.To) > 0:
 		eventHandler = new(smtp.SMTP)
+	case len(conf.Handler.PagerDuty.RoutingKey) > 0:
+		eventHandler = new(pagerduty.PagerDuty)
+	case len(conf.Handler.Opsgenie.ApiKey) > 0:
+		eventHandler = new(opsgenie.Opsgenie)
 	default:
 		eventHandler = new(dispatchers.Default)
 	}
 
 	if err := eventHandler.Init(conf); err != nil {
-		logrus.Fatal(err)
+		return nil, err
 	}
-	return eventHandler
+	return eventHandler, nil
+}
+
+// NewDispatcher initializes a dispatcher by its name in dispatchers.Map from the handler configuration
+func NewDispatcher(name string, conf *config.Config) (dispatchers.Dispatcher, error) {
+	var dispatcher dispatchers.Dispatcher
+	switch name {
+	case "default":
+		dispatcher = new(dispatchers.Default)
+	case "slack":
+		dispatcher = new(slack.Slack)
+	case "slackwebhook":
+		dispatcher = new(slack.SlackWebhook)
+	case "webhook":
+		dispatcher = new(webhook.Webhook)
+	case "ms-teams":
+		dispatcher = new(msteam.MSTeams)
+	case "smtp":
+		dispatcher = new(smtp.SMTP)
+	case "pagerduty":
+		dispatcher = new(pagerduty.PagerDuty)
+	case "opsgenie":
+		dispatcher = new(opsgenie.Opsgenie)
+	default:
+		return nil, fmt.Errorf("unknown dispatcher %q", name)
+	}
+
+	if err := dispatcher.Init(conf); err != nil {
+		return nil, err
+	}
+	return dispatcher, nil
+}
+
+// NewChain initializes every dispatcher of the configured chain with its filter
+func NewChain(conf *config.Config) (*dispatchers.Chain, error) {
+	chain := &dispatchers.Chain{}
+	for i, link := range conf.Handler.Chain {
+		dispatcher, err := NewDispatcher(link.Dispatcher, conf)
+		if err != nil {
+			return nil, fmt.Errorf("dispatcher chain link %d: %w", i+1, err)
+		}
+		filter, err := dispatchers.NewFilter(link)
+		if err != nil {
+			return nil, fmt.Errorf("dispatcher chain link %d: %w", i+1, err)
+		}
+		chain.Links = append(chain.Links, dispatchers.Link{Name: link.Dispatcher, Dispatcher: dispatcher, Filter: filter})
+	}
+	return chain, nil
+}
+
+// NewNotifier builds the dispatcher of the watcher configuration for operator notifications,
+// defaulting to the operator webhook. Notifications are dropped when it cannot be initialized.
+func NewNotifier(purpose string) dispatchers.Dispatcher {
+	conf, err := config.New()
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"purpose": purpose}, err, "Failed to load watcher config, notifications are disabled")
+		return &dispatchers.Default{}
+	}
+	if conf.Handler.Webhook.Url == "" {
+		conf.Handler.Webhook.Url = internalconfig.OperatorWebhook
+	}
+
+	handler, err := NewEventHandler(conf)
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"purpose": purpose}, err, "Failed to initialize dispatcher, notifications are disabled")
+		return &dispatchers.Default{}
+	}
+	return handler
 }
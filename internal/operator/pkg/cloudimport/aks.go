@@ -0,0 +1,134 @@
+package cloudimport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// aksServerID is the application ID of the AKS Microsoft Entra server, the audience of its tokens
+const aksServerID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+type aksCluster struct {
+	Name                     string          `json:"name"`
+	Location                 string          `json:"location"`
+	ResourceGroup            string          `json:"resourceGroup"`
+	CurrentKubernetesVersion string          `json:"currentKubernetesVersion"`
+	ProvisioningState        string          `json:"provisioningState"`
+	AADProfile               json.RawMessage `json:"aadProfile"`
+}
+
+// discoverAKS lists the clusters of a subscription and reads their endpoint and CA from the user
+// credentials. A service principal logs in to a throwaway az configuration, leaving the logins of the
+// server untouched. Clusters with Microsoft Entra authentication get their tokens from kubelogin, the
+// others keep the client certificate of their user credentials.
+func (i *Importer) discoverAKS(ctx context.Context, req Request) ([]Cluster, error) {
+	credentials := req.Credentials
+	var env []string
+	if credentials.ClientID != "" {
+		configDir, err := os.MkdirTemp("", "agentkube-az-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the az configuration: %w", err)
+		}
+		defer os.RemoveAll(configDir)
+		env = []string{"AZURE_CONFIG_DIR=" + configDir}
+
+		_, err = i.run(ctx, env, "az", "login", "--service-principal",
+			"--username", credentials.ClientID, "--password", credentials.ClientSecret, "--tenant", credentials.TenantID, "--output", "none")
+		if err != nil {
+			return nil, err
+		}
+	}
+	subscription := func(args ...string) []string {
+		if req.Subscription != "" {
+			args = append(args, "--subscription", req.Subscription)
+		}
+		return args
+	}
+
+	out, err := i.run(ctx, env, "az", subscription("aks", "list", "--output", "json")...)
+	if err != nil {
+		return nil, err
+	}
+	var list []aksCluster
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse the AKS clusters: %w", err)
+	}
+
+	clusters := []Cluster{}
+	for _, aks := range list {
+		if !req.selected(aks.Name) {
+			continue
+		}
+		out, err := i.run(ctx, env, "az", subscription("aks", "get-credentials",
+			"--name", aks.Name, "--resource-group", aks.ResourceGroup, "--file", "-")...)
+		if err != nil {
+			return nil, err
+		}
+		cluster, user, err := aksCredentials(out)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials of AKS cluster %s: %w", aks.Name, err)
+		}
+
+		if len(aks.AADProfile) > 0 && string(aks.AADProfile) != "null" {
+			user = &api.AuthInfo{Exec: kubeloginExec(credentials)}
+		}
+		clusters = append(clusters, Cluster{
+			Provider:      ProviderAKS,
+			Name:          aks.Name,
+			Location:      aks.Location,
+			ResourceGroup: aks.ResourceGroup,
+			Version:       aks.CurrentKubernetesVersion,
+			Status:        aks.ProvisioningState,
+			Server:        cluster.Server,
+			ContextName:   contextName(ProviderAKS, aks.ResourceGroup, aks.Name),
+			caData:        cluster.CertificateAuthorityData,
+			authInfo:      user,
+		})
+	}
+	return clusters, nil
+}
+
+// aksCredentials reads the cluster and user of the current context of a kubeconfig
+func aksCredentials(data []byte) (*api.Cluster, *api.AuthInfo, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeContext, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, nil, fmt.Errorf("no current context")
+	}
+	cluster, ok := config.Clusters[kubeContext.Cluster]
+	if !ok {
+		return nil, nil, fmt.Errorf("cluster %s not found", kubeContext.Cluster)
+	}
+	user, ok := config.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return nil, nil, fmt.Errorf("user %s not found", kubeContext.AuthInfo)
+	}
+	return cluster, user, nil
+}
+
+// kubeloginExec gets Microsoft Entra tokens with the service principal, else with the az CLI login
+func kubeloginExec(credentials Credentials) *api.ExecConfig {
+	args := []string{"get-token", "--server-id", aksServerID}
+	var env []string
+	if credentials.ClientID != "" {
+		args = append(args, "--login", "spn", "--tenant-id", credentials.TenantID, "--client-id", credentials.ClientID)
+		env = []string{"AAD_SERVICE_PRINCIPAL_CLIENT_SECRET=" + credentials.ClientSecret}
+	} else {
+		args = append(args, "--login", "azurecli")
+	}
+	return &api.ExecConfig{
+		APIVersion:      execAPIVersion,
+		Command:         "kubelogin",
+		Args:            args,
+		Env:             execEnv(env),
+		InteractiveMode: api.NeverExecInteractiveMode,
+	}
+}
@@ -0,0 +1,326 @@
+package cloudimport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Providers of managed Kubernetes clusters
+const (
+	ProviderEKS = "eks"
+	ProviderGKE = "gke"
+	ProviderAKS = "aks"
+)
+
+// commandTimeout bounds every call of a provider CLI
+const commandTimeout = 2 * time.Minute
+
+// execAPIVersion is the version of the ExecCredential the token plugins print
+const execAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+var (
+	// ErrInvalid is returned for invalid import requests
+	ErrInvalid = errors.New("invalid import request")
+	// ErrCLIUnavailable is returned when the CLI of a provider is not installed on the server
+	ErrCLIUnavailable = errors.New("provider CLI is not installed")
+	// ErrClusterNotFound is returned when a requested cluster is not found at the provider
+	ErrClusterNotFound = errors.New("cluster not found")
+)
+
+// Credentials authenticate the provider CLI and the token plugin. Without them the ambient credentials
+// of the server are used: environment variables, profiles and CLI logins. Credentials are kept in the
+// exec configuration of the imported contexts to generate tokens, short-lived ones are preferable.
+type Credentials struct {
+	// AccessKeyID, SecretAccessKey and SessionToken are AWS keys, Profile an AWS profile of the server
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	Profile         string `json:"profile,omitempty"`
+	// KeyFile is the path on the server of a GCP service account key
+	KeyFile string `json:"keyFile,omitempty"`
+	// TenantID, ClientID and ClientSecret are an Azure service principal
+	TenantID     string `json:"tenantId,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// Request selects the clusters of a provider to discover or import
+type Request struct {
+	Provider string `json:"provider" binding:"required"`
+	// Regions are the AWS regions searched for EKS clusters
+	Regions []string `json:"regions,omitempty"`
+	// Project is the GCP project of the GKE clusters
+	Project string `json:"project,omitempty"`
+	// Subscription is the Azure subscription of the AKS clusters, the default one of the CLI when empty
+	Subscription string `json:"subscription,omitempty"`
+	// Clusters limits the request to these cluster names, empty selects every cluster found
+	Clusters    []string    `json:"clusters,omitempty"`
+	Credentials Credentials `json:"credentials"`
+	// TTL is the lifetime in hours of the imported contexts, 0 means no expiry
+	TTL int `json:"ttl"`
+	// Replace overwrites existing contexts of the same name, which are skipped otherwise
+	Replace bool `json:"replace"`
+}
+
+// Validate checks the request has what its provider needs
+func (r Request) Validate() error {
+	switch r.Provider {
+	case ProviderEKS:
+		if len(r.Regions) == 0 {
+			return fmt.Errorf("%w: regions are required for EKS", ErrInvalid)
+		}
+		if (r.Credentials.AccessKeyID == "") != (r.Credentials.SecretAccessKey == "") {
+			return fmt.Errorf("%w: accessKeyId and secretAccessKey go together", ErrInvalid)
+		}
+	case ProviderGKE:
+		if r.Project == "" {
+			return fmt.Errorf("%w: project is required for GKE", ErrInvalid)
+		}
+	case ProviderAKS:
+		credentials := r.Credentials
+		set := 0
+		for _, value := range []string{credentials.TenantID, credentials.ClientID, credentials.ClientSecret} {
+			if value != "" {
+				set++
+			}
+		}
+		if set != 0 && set != 3 {
+			return fmt.Errorf("%w: tenantId, clientId and clientSecret go together", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: provider must be eks, gke or aks", ErrInvalid)
+	}
+	if r.TTL < 0 {
+		return fmt.Errorf("%w: ttl must not be negative", ErrInvalid)
+	}
+	return nil
+}
+
+// selected tells whether a cluster is part of the request
+func (r Request) selected(name string) bool {
+	if len(r.Clusters) == 0 {
+		return true
+	}
+	for _, cluster := range r.Clusters {
+		if cluster == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Cluster is a managed cluster found at a provider
+type Cluster struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	// Location is the region or zone of the cluster
+	Location      string `json:"location"`
+	Project       string `json:"project,omitempty"`
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Status        string `json:"status,omitempty"`
+	Server        string `json:"server"`
+	// ContextName is the name the cluster is imported as
+	ContextName string `json:"contextName"`
+	// Imported is set when a context of that name already exists
+	Imported bool `json:"imported"`
+
+	caData   []byte
+	authInfo *api.AuthInfo
+}
+
+// context builds the context of the cluster, authenticated by the token plugin of its provider
+func (c Cluster) context() *kubeconfig.Context {
+	return &kubeconfig.Context{
+		Name: c.ContextName,
+		KubeContext: &api.Context{
+			Cluster:  c.ContextName,
+			AuthInfo: c.ContextName,
+		},
+		Cluster: &api.Cluster{
+			Server:                   c.Server,
+			CertificateAuthorityData: c.caData,
+		},
+		AuthInfo: c.authInfo,
+		Source:   kubeconfig.DynamicCluster,
+	}
+}
+
+// ProviderStatus tells whether the tools of a provider are installed on the server
+type ProviderStatus struct {
+	Provider string `json:"provider"`
+	// CLI lists the clusters, Plugin generates the tokens of the imported contexts
+	CLI             string `json:"cli"`
+	CLIInstalled    bool   `json:"cliInstalled"`
+	Plugin          string `json:"plugin"`
+	PluginInstalled bool   `json:"pluginInstalled"`
+}
+
+// tools are the CLI and token plugin of every provider
+var tools = []ProviderStatus{
+	{Provider: ProviderEKS, CLI: "aws", Plugin: "aws"},
+	{Provider: ProviderGKE, CLI: "gcloud", Plugin: "gke-gcloud-auth-plugin"},
+	{Provider: ProviderAKS, CLI: "az", Plugin: "kubelogin"},
+}
+
+// Providers reports the providers and whether their tools are installed
+func Providers() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(tools))
+	for _, status := range tools {
+		status.CLIInstalled = installed(status.CLI)
+		status.PluginInstalled = installed(status.Plugin)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func installed(command string) bool {
+	_, err := exec.LookPath(command)
+	return err == nil
+}
+
+// runFunc runs a CLI with extra environment variables and returns its standard output
+type runFunc func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+// runCommand runs a provider CLI. Errors name the subcommand only, arguments may carry secrets.
+func runCommand(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	if !installed(name) {
+		return nil, fmt.Errorf("%w: %s", ErrCLIUnavailable, name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		subcommand := strings.Join(args[:min(len(args), 2)], " ")
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s %s failed: %s", name, subcommand, message)
+		}
+		return nil, fmt.Errorf("%s %s failed: %w", name, subcommand, err)
+	}
+	return out, nil
+}
+
+// Importer lists the managed clusters of cloud providers and adds them as contexts
+type Importer struct {
+	kubeConfigStore kubeconfig.ContextStore
+	run             runFunc
+}
+
+// NewImporter creates a new cloud cluster importer
+func NewImporter(kubeConfigStore kubeconfig.ContextStore) *Importer {
+	return &Importer{
+		kubeConfigStore: kubeConfigStore,
+		run:             runCommand,
+	}
+}
+
+// Discover lists the clusters of the request, ordered by context name
+func (i *Importer) Discover(ctx context.Context, req Request) ([]Cluster, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var clusters []Cluster
+	var err error
+	switch req.Provider {
+	case ProviderEKS:
+		clusters, err = i.discoverEKS(ctx, req)
+	case ProviderGKE:
+		clusters, err = i.discoverGKE(ctx, req)
+	case ProviderAKS:
+		clusters, err = i.discoverAKS(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range clusters {
+		if _, err := i.kubeConfigStore.GetContext(clusters[index].ContextName); err == nil {
+			clusters[index].Imported = true
+		}
+	}
+	sort.Slice(clusters, func(a, b int) bool { return clusters[a].ContextName < clusters[b].ContextName })
+	return clusters, nil
+}
+
+// Result lists the contexts an import added and those it left alone
+type Result struct {
+	Imported []string `json:"imported"`
+	// Skipped are clusters whose context already exists
+	Skipped []string `json:"skipped"`
+	// Warnings report what the imported contexts need to connect, e.g. a missing token plugin
+	Warnings []string `json:"warnings"`
+}
+
+// Import adds the clusters of the request as contexts whose tokens are generated by the provider
+// token plugin. Every requested cluster must exist.
+func (i *Importer) Import(ctx context.Context, req Request) (*Result, error) {
+	clusters, err := i.Discover(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, cluster := range clusters {
+		found[cluster.Name] = true
+	}
+	for _, name := range req.Clusters {
+		if !found[name] {
+			return nil, fmt.Errorf("%w: %s %s", ErrClusterNotFound, req.Provider, name)
+		}
+	}
+
+	result := &Result{Imported: []string{}, Skipped: []string{}, Warnings: []string{}}
+	for _, cluster := range clusters {
+		if cluster.Imported && !req.Replace {
+			result.Skipped = append(result.Skipped, cluster.ContextName)
+			continue
+		}
+		kubeContext := cluster.context()
+		if req.TTL > 0 {
+			err = i.kubeConfigStore.AddContextWithKeyAndTTL(kubeContext, kubeContext.Name, time.Duration(req.TTL)*time.Hour)
+		} else {
+			err = i.kubeConfigStore.AddContext(kubeContext)
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to add context %s: %w", kubeContext.Name, err)
+		}
+		result.Imported = append(result.Imported, kubeContext.Name)
+	}
+
+	for _, status := range tools {
+		if status.Provider == req.Provider && len(result.Imported) > 0 && !installed(status.Plugin) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s is not installed on the server, the imported contexts can't get tokens until it is", status.Plugin))
+		}
+	}
+	return result, nil
+}
+
+// execEnv turns environment variables into those of an exec plugin
+func execEnv(env []string) []api.ExecEnvVar {
+	vars := make([]api.ExecEnvVar, 0, len(env))
+	for _, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		vars = append(vars, api.ExecEnvVar{Name: name, Value: value})
+	}
+	return vars
+}
+
+// contextName builds a context name from the parts identifying a cluster
+func contextName(parts ...string) string {
+	return strings.NewReplacer("/", "-", " ", "-", ":", "-").Replace(strings.Join(parts, "_"))
+}
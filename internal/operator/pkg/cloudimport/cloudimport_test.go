@@ -0,0 +1,282 @@
+package cloudimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+// fakeStore is a context store backed by a map
+type fakeStore struct {
+	contexts map[string]*kubeconfig.Context
+}
+
+func (s *fakeStore) AddContext(c *kubeconfig.Context) error {
+	s.contexts[c.Name] = c
+	return nil
+}
+
+func (s *fakeStore) GetContexts() ([]*kubeconfig.Context, error) {
+	contexts := []*kubeconfig.Context{}
+	for _, c := range s.contexts {
+		contexts = append(contexts, c)
+	}
+	return contexts, nil
+}
+
+func (s *fakeStore) GetContext(name string) (*kubeconfig.Context, error) {
+	if c, ok := s.contexts[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("context %s not found", name)
+}
+
+func (s *fakeStore) RemoveContext(name string) error {
+	delete(s.contexts, name)
+	return nil
+}
+
+func (s *fakeStore) AddContextWithKeyAndTTL(c *kubeconfig.Context, key string, ttl time.Duration) error {
+	s.contexts[key] = c
+	return nil
+}
+
+func (s *fakeStore) UpdateTTL(string, time.Duration) error { return nil }
+
+func (s *fakeStore) Subscribe(func(kubeconfig.ContextEvent)) {}
+
+// fakeRun answers the CLI calls with canned outputs keyed by command line, and records the environment
+func fakeRun(outputs map[string]string, envs map[string][]string) runFunc {
+	return func(_ context.Context, env []string, name string, args ...string) ([]byte, error) {
+		command := name + " " + strings.Join(args, " ")
+		if envs != nil {
+			envs[command] = env
+		}
+		out, ok := outputs[command]
+		if !ok {
+			return nil, fmt.Errorf("unexpected command %q", command)
+		}
+		return []byte(out), nil
+	}
+}
+
+const aksKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod-dns.hcp.westeurope.azmk8s.io:443
+    certificate-authority-data: Y2E=
+users:
+- name: clusterUser_shop_prod
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: clusterUser_shop_prod
+`
+
+func TestRequestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr bool
+	}{
+		{name: "eks", req: Request{Provider: ProviderEKS, Regions: []string{"eu-west-1"}}},
+		{name: "eks without regions", req: Request{Provider: ProviderEKS}, wantErr: true},
+		{name: "eks key without secret", req: Request{Provider: ProviderEKS, Regions: []string{"eu-west-1"}, Credentials: Credentials{AccessKeyID: "AKIA"}}, wantErr: true},
+		{name: "gke without project", req: Request{Provider: ProviderGKE}, wantErr: true},
+		{name: "aks ambient", req: Request{Provider: ProviderAKS}},
+		{name: "aks partial service principal", req: Request{Provider: ProviderAKS, Credentials: Credentials{ClientID: "app"}}, wantErr: true},
+		{name: "unknown provider", req: Request{Provider: "doks"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("Validate() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	t.Parallel()
+
+	outputs := map[string]string{
+		"aws eks list-clusters --region eu-west-1 --output json":                                      `{"clusters":["shop","batch"]}`,
+		"aws eks describe-cluster --name shop --region eu-west-1 --output json":                       `{"cluster":{"name":"shop","version":"1.30","status":"ACTIVE","endpoint":"https://ABC.gr7.eu-west-1.eks.amazonaws.com","certificateAuthority":{"data":"Y2E="}}}`,
+		"gcloud container clusters list --project acme --format json":                                 `[{"name":"web","location":"europe-west1","endpoint":"34.1.2.3","currentMasterVersion":"1.29.4-gke.100","status":"RUNNING","masterAuth":{"clusterCaCertificate":"Y2E="}}]`,
+		"az aks list --output json":                                                                   `[{"name":"prod","location":"westeurope","resourceGroup":"shop","currentKubernetesVersion":"1.30.3","provisioningState":"Succeeded","aadProfile":null}]`,
+		"az aks get-credentials --name prod --resource-group shop --file -":                           aksKubeconfig,
+		"az login --service-principal --username app --password secret --tenant tenant --output none": "",
+	}
+
+	tests := []struct {
+		name        string
+		req         Request
+		wantContext string
+		wantServer  string
+		wantCommand string
+	}{
+		{
+			name:        "eks",
+			req:         Request{Provider: ProviderEKS, Regions: []string{"eu-west-1"}, Clusters: []string{"shop"}, Credentials: Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"}},
+			wantContext: "eks_eu-west-1_shop",
+			wantServer:  "https://ABC.gr7.eu-west-1.eks.amazonaws.com",
+			wantCommand: "aws",
+		},
+		{
+			name:        "gke",
+			req:         Request{Provider: ProviderGKE, Project: "acme", Credentials: Credentials{KeyFile: "/keys/sa.json"}},
+			wantContext: "gke_acme_europe-west1_web",
+			wantServer:  "https://34.1.2.3",
+			wantCommand: "gke-gcloud-auth-plugin",
+		},
+		{
+			name:        "aks with local accounts",
+			req:         Request{Provider: ProviderAKS},
+			wantContext: "aks_shop_prod",
+			wantServer:  "https://prod-dns.hcp.westeurope.azmk8s.io:443",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			envs := map[string][]string{}
+			importer := &Importer{kubeConfigStore: &fakeStore{contexts: map[string]*kubeconfig.Context{}}, run: fakeRun(outputs, envs)}
+
+			clusters, err := importer.Discover(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			if len(clusters) != 1 {
+				t.Fatalf("Discover() = %+v, want one cluster", clusters)
+			}
+			cluster := clusters[0]
+			if cluster.ContextName != tt.wantContext || cluster.Server != tt.wantServer || string(cluster.caData) != "ca" {
+				t.Errorf("Discover() = %+v, want context %s at %s", cluster, tt.wantContext, tt.wantServer)
+			}
+			exec := cluster.authInfo.Exec
+			if tt.wantCommand == "" {
+				if exec != nil || len(cluster.authInfo.ClientCertificateData) == 0 {
+					t.Errorf("authInfo = %+v, want the client certificate of the credentials", cluster.authInfo)
+				}
+				return
+			}
+			if exec == nil || exec.Command != tt.wantCommand {
+				t.Fatalf("authInfo = %+v, want exec %s", cluster.authInfo, tt.wantCommand)
+			}
+		})
+	}
+
+	t.Run("credentials", func(t *testing.T) {
+		t.Parallel()
+		envs := map[string][]string{}
+		importer := &Importer{kubeConfigStore: &fakeStore{contexts: map[string]*kubeconfig.Context{}}, run: fakeRun(outputs, envs)}
+
+		clusters, err := importer.Discover(context.Background(), Request{Provider: ProviderEKS, Regions: []string{"eu-west-1"}, Clusters: []string{"shop"}, Credentials: Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"AWS_ACCESS_KEY_ID=AKIA", "AWS_SECRET_ACCESS_KEY=secret"}
+		if got := envs["aws eks list-clusters --region eu-west-1 --output json"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("aws env = %v, want %v", got, want)
+		}
+		if got := clusters[0].authInfo.Exec.Env; len(got) != 2 || got[0].Name != "AWS_ACCESS_KEY_ID" {
+			t.Errorf("exec env = %v, want the keys", got)
+		}
+
+		// The service principal logs in to a throwaway az configuration
+		clusters, err = importer.Discover(context.Background(), Request{Provider: ProviderAKS, Credentials: Credentials{TenantID: "tenant", ClientID: "app", ClientSecret: "secret"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env := envs["az aks list --output json"]; len(env) != 1 || !strings.HasPrefix(env[0], "AZURE_CONFIG_DIR=") {
+			t.Errorf("az env = %v, want a throwaway configuration", env)
+		}
+		if len(clusters) != 1 || clusters[0].authInfo.Exec != nil {
+			t.Errorf("clusters = %+v, want the local account kept", clusters)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	outputs := map[string]string{
+		"gcloud container clusters list --project acme --format json": `[
+			{"name":"web","location":"europe-west1","endpoint":"34.1.2.3","masterAuth":{"clusterCaCertificate":"Y2E="}},
+			{"name":"jobs","location":"europe-west1-b","endpoint":"34.1.2.4","masterAuth":{"clusterCaCertificate":"Y2E="}}]`,
+	}
+	existing := &kubeconfig.Context{Name: "gke_acme_europe-west1_web"}
+
+	tests := []struct {
+		name         string
+		req          Request
+		wantImported []string
+		wantSkipped  []string
+		wantErr      error
+	}{
+		{
+			name:         "skips existing contexts",
+			req:          Request{Provider: ProviderGKE, Project: "acme"},
+			wantImported: []string{"gke_acme_europe-west1-b_jobs"},
+			wantSkipped:  []string{"gke_acme_europe-west1_web"},
+		},
+		{
+			name:         "replaces existing contexts",
+			req:          Request{Provider: ProviderGKE, Project: "acme", Clusters: []string{"web"}, Replace: true},
+			wantImported: []string{"gke_acme_europe-west1_web"},
+			wantSkipped:  []string{},
+		},
+		{
+			name:    "missing cluster",
+			req:     Request{Provider: ProviderGKE, Project: "acme", Clusters: []string{"web", "api"}},
+			wantErr: ErrClusterNotFound,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := &fakeStore{contexts: map[string]*kubeconfig.Context{existing.Name: existing}}
+			importer := &Importer{kubeConfigStore: store, run: fakeRun(outputs, nil)}
+
+			result, err := importer.Import(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Import() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(result.Imported, tt.wantImported) || !reflect.DeepEqual(result.Skipped, tt.wantSkipped) {
+				t.Errorf("Import() = %+v, want imported %v, skipped %v", result, tt.wantImported, tt.wantSkipped)
+			}
+			for _, name := range result.Imported {
+				c := store.contexts[name]
+				if c == nil || c.Source != kubeconfig.DynamicCluster || c.Cluster.Server == "" || c.AuthInfo.Exec == nil {
+					t.Errorf("context %s = %+v, want a dynamic context with a token plugin", name, c)
+				}
+			}
+		})
+	}
+}
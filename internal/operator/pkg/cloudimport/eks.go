@@ -0,0 +1,98 @@
+package cloudimport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+type eksList struct {
+	Clusters []string `json:"clusters"`
+}
+
+type eksDescription struct {
+	Cluster struct {
+		Name                 string `json:"name"`
+		Version              string `json:"version"`
+		Status               string `json:"status"`
+		Endpoint             string `json:"endpoint"`
+		CertificateAuthority struct {
+			Data string `json:"data"`
+		} `json:"certificateAuthority"`
+	} `json:"cluster"`
+}
+
+// awsEnv passes the AWS keys or profile to the aws CLI
+func (c Credentials) awsEnv() []string {
+	var env []string
+	if c.AccessKeyID != "" {
+		env = append(env, "AWS_ACCESS_KEY_ID="+c.AccessKeyID, "AWS_SECRET_ACCESS_KEY="+c.SecretAccessKey)
+		if c.SessionToken != "" {
+			env = append(env, "AWS_SESSION_TOKEN="+c.SessionToken)
+		}
+	}
+	if c.Profile != "" {
+		env = append(env, "AWS_PROFILE="+c.Profile)
+	}
+	return env
+}
+
+// discoverEKS lists the clusters of every region, then describes the selected ones for their endpoint
+// and CA. Tokens come from aws eks get-token.
+func (i *Importer) discoverEKS(ctx context.Context, req Request) ([]Cluster, error) {
+	env := req.Credentials.awsEnv()
+
+	clusters := []Cluster{}
+	for _, region := range req.Regions {
+		out, err := i.run(ctx, env, "aws", "eks", "list-clusters", "--region", region, "--output", "json")
+		if err != nil {
+			return nil, err
+		}
+		var list eksList
+		if err := json.Unmarshal(out, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse the EKS clusters of %s: %w", region, err)
+		}
+
+		for _, name := range list.Clusters {
+			if !req.selected(name) {
+				continue
+			}
+			out, err := i.run(ctx, env, "aws", "eks", "describe-cluster", "--name", name, "--region", region, "--output", "json")
+			if err != nil {
+				return nil, err
+			}
+			var description eksDescription
+			if err := json.Unmarshal(out, &description); err != nil {
+				return nil, fmt.Errorf("failed to parse EKS cluster %s: %w", name, err)
+			}
+			caData, err := base64.StdEncoding.DecodeString(description.Cluster.CertificateAuthority.Data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate authority of EKS cluster %s: %w", name, err)
+			}
+
+			clusters = append(clusters, Cluster{
+				Provider:    ProviderEKS,
+				Name:        name,
+				Location:    region,
+				Version:     description.Cluster.Version,
+				Status:      description.Cluster.Status,
+				Server:      description.Cluster.Endpoint,
+				ContextName: contextName(ProviderEKS, region, name),
+				caData:      caData,
+				authInfo: &api.AuthInfo{
+					Exec: &api.ExecConfig{
+						APIVersion:      execAPIVersion,
+						Command:         "aws",
+						Args:            []string{"eks", "get-token", "--cluster-name", name, "--region", region, "--output", "json"},
+						Env:             execEnv(env),
+						InteractiveMode: api.NeverExecInteractiveMode,
+					},
+				},
+			})
+		}
+	}
+	return clusters, nil
+}
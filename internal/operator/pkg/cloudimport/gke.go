@@ -0,0 +1,76 @@
+package cloudimport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+type gkeCluster struct {
+	Name                 string `json:"name"`
+	Location             string `json:"location"`
+	Endpoint             string `json:"endpoint"`
+	CurrentMasterVersion string `json:"currentMasterVersion"`
+	Status               string `json:"status"`
+	MasterAuth           struct {
+		ClusterCACertificate string `json:"clusterCaCertificate"`
+	} `json:"masterAuth"`
+}
+
+// discoverGKE lists the clusters of a project in every location. gcloud authenticates with the key
+// file when set, tokens come from gke-gcloud-auth-plugin with the same key as application default
+// credentials.
+func (i *Importer) discoverGKE(ctx context.Context, req Request) ([]Cluster, error) {
+	var env, pluginEnv, pluginArgs []string
+	if keyFile := req.Credentials.KeyFile; keyFile != "" {
+		env = []string{"CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE=" + keyFile}
+		pluginEnv = []string{"GOOGLE_APPLICATION_CREDENTIALS=" + keyFile}
+		pluginArgs = []string{"--use_application_default_credentials"}
+	}
+
+	out, err := i.run(ctx, env, "gcloud", "container", "clusters", "list", "--project", req.Project, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var list []gkeCluster
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse the GKE clusters of %s: %w", req.Project, err)
+	}
+
+	clusters := []Cluster{}
+	for _, gke := range list {
+		if !req.selected(gke.Name) {
+			continue
+		}
+		caData, err := base64.StdEncoding.DecodeString(gke.MasterAuth.ClusterCACertificate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate authority of GKE cluster %s: %w", gke.Name, err)
+		}
+
+		clusters = append(clusters, Cluster{
+			Provider:    ProviderGKE,
+			Name:        gke.Name,
+			Location:    gke.Location,
+			Project:     req.Project,
+			Version:     gke.CurrentMasterVersion,
+			Status:      gke.Status,
+			Server:      "https://" + gke.Endpoint,
+			ContextName: contextName(ProviderGKE, req.Project, gke.Location, gke.Name),
+			caData:      caData,
+			authInfo: &api.AuthInfo{
+				Exec: &api.ExecConfig{
+					APIVersion:         execAPIVersion,
+					Command:            "gke-gcloud-auth-plugin",
+					Args:               pluginArgs,
+					Env:                execEnv(pluginEnv),
+					ProvideClusterInfo: true,
+					InteractiveMode:    api.NeverExecInteractiveMode,
+				},
+			},
+		})
+	}
+	return clusters, nil
+}
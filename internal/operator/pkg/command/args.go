@@ -0,0 +1,66 @@
+package command
+
+import "strings"
+
+// kubectlValueFlags are the kubectl flags whose value may follow as a separate argument
+var kubectlValueFlags = map[string]bool{
+	"-n": true, "--namespace": true, "--context": true, "--cluster": true, "--user": true,
+	"-l": true, "--selector": true, "-o": true, "--output": true, "--kubeconfig": true,
+	"-f": true, "--filename": true, "--field-selector": true, "--timeout": true,
+	"--grace-period": true, "-c": true, "--container": true, "--replicas": true,
+	"--current-replicas": true, "--resource-version": true, "-s": true, "--server": true,
+	"--token": true, "--as": true, "--as-group": true, "--pod-selector": true,
+}
+
+// KubectlArgs is a kubectl command split into its verb, positional arguments and flags
+type KubectlArgs struct {
+	Verb  string
+	Args  []string
+	Flags map[string]string
+	// LeadingFlags are the flags given before the verb, as written
+	LeadingFlags []string
+}
+
+// IsKubectlValueFlag reports whether the value of a kubectl flag may follow as a separate argument
+func IsKubectlValueFlag(name string) bool {
+	return kubectlValueFlags[name]
+}
+
+// ParseKubectlArgs splits a kubectl command line. Flags given without a value map to an empty string.
+func ParseKubectlArgs(command []string) KubectlArgs {
+	if len(command) > 0 && command[0] == "kubectl" {
+		command = command[1:]
+	}
+
+	parsed := KubectlArgs{Flags: map[string]string{}}
+	var positional []string
+	for i := 0; i < len(command); i++ {
+		arg := command[i]
+		if arg == "--" {
+			// Everything after -- belongs to the command run in a container
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		if len(positional) == 0 {
+			parsed.LeadingFlags = append(parsed.LeadingFlags, arg)
+		}
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			parsed.Flags[name] = value
+			continue
+		}
+		if kubectlValueFlags[arg] && i+1 < len(command) {
+			parsed.Flags[arg] = command[i+1]
+			i++
+			continue
+		}
+		parsed.Flags[arg] = ""
+	}
+
+	if len(positional) > 0 {
+		parsed.Verb, parsed.Args = positional[0], positional[1:]
+	}
+	return parsed
+}
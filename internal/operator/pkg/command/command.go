@@ -3,6 +3,7 @@ package command
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -23,6 +24,8 @@ type CommandResult struct {
 	Success    bool   `json:"success"`
 	Output     string `json:"output"` // Added output field for stdout
 	Error      string `json:"error,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitCode   int    `json:"exitCode"`
 	Command    string `json:"command"`
 	ExecTimeMs int64  `json:"execTimeMs"`
 }
@@ -93,12 +96,18 @@ func (e *CommandExecutor) ExecuteKubectlCommand(req CommandRequest) (*CommandRes
 	result := &CommandResult{
 		Success:    err == nil,
 		Output:     stdout.String(), // Set output to stdout
+		Stderr:     stderr.String(),
 		Command:    cmdStr,
 		ExecTimeMs: execTime,
 	}
 
 	if err != nil {
 		result.Error = err.Error()
+		result.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
 		logger.Log(logger.LevelError, map[string]string{
 			"context": req.Context,
 			"command": cmdStr,
@@ -0,0 +1,247 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+)
+
+const (
+	defaultFanOutConcurrency = 5
+	maxFanOutConcurrency     = 20
+	maxFanOutContexts        = 100
+	// maxDiffCells bounds the LCS table of a diff, larger outputs are only reported as different
+	maxDiffCells = 4_000_000
+)
+
+// FanOutRequest runs the same kubectl command against several contexts
+type FanOutRequest struct {
+	Contexts    []string `json:"contexts"`
+	Command     []string `json:"command"`
+	Timeout     int      `json:"timeout,omitempty"`     // timeout in seconds, per context
+	Concurrency int      `json:"concurrency,omitempty"` // contexts executed at once
+}
+
+// ContextResult is the result of the command in one context
+type ContextResult struct {
+	Context string `json:"context"`
+	CommandResult
+}
+
+// OutputGroup lists the contexts that produced identical output
+type OutputGroup struct {
+	Contexts []string `json:"contexts"`
+	Hash     string   `json:"hash"`
+	Lines    int      `json:"lines"`
+}
+
+// OutputDiff is the line diff of an output group against the baseline group
+type OutputDiff struct {
+	Contexts []string `json:"contexts"`
+	// Diff lists removed ("- ") and added ("+ ") lines relative to the baseline
+	Diff      []string `json:"diff"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// FanOutResult aggregates the per-context results of a fan-out execution
+type FanOutResult struct {
+	Command   string          `json:"command"`
+	Results   []ContextResult `json:"results"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	// Groups are ordered by size, the first one is the baseline the diffs are computed against
+	Groups     []OutputGroup `json:"groups"`
+	Diffs      []OutputDiff  `json:"diffs,omitempty"`
+	ExecTimeMs int64         `json:"execTimeMs"`
+}
+
+// ExecuteFanOut runs a kubectl command across contexts concurrently, bounded by the request concurrency
+func (e *CommandExecutor) ExecuteFanOut(req FanOutRequest) (*FanOutResult, error) {
+	if len(req.Contexts) == 0 {
+		return nil, fmt.Errorf("at least one context is required")
+	}
+	if len(req.Contexts) > maxFanOutContexts {
+		return nil, fmt.Errorf("at most %d contexts can be targeted at once", maxFanOutContexts)
+	}
+	if len(req.Command) == 0 || req.Command[0] != "kubectl" {
+		return nil, fmt.Errorf("command must start with 'kubectl'")
+	}
+
+	seen := map[string]bool{}
+	for _, name := range req.Contexts {
+		if seen[name] {
+			return nil, fmt.Errorf("context %s is listed more than once", name)
+		}
+		seen[name] = true
+		if _, err := e.kubeConfigStore.GetContext(name); err != nil {
+			return nil, fmt.Errorf("context %s not found: %w", name, err)
+		}
+	}
+
+	return runFanOut(req, e.ExecuteKubectlCommand), nil
+}
+
+// commandRunner executes a command request in a single context
+type commandRunner func(CommandRequest) (*CommandResult, error)
+
+// runFanOut runs the command of a validated request in each of its contexts with run, at most
+// the request concurrency at once, and compares their outputs
+func runFanOut(req FanOutRequest, run commandRunner) *FanOutResult {
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultFanOutConcurrency
+	}
+	if concurrency > maxFanOutConcurrency {
+		concurrency = maxFanOutConcurrency
+	}
+
+	cmdStr := strings.Join(req.Command, " ")
+	logger.Log(logger.LevelInfo, map[string]string{
+		"contexts": strings.Join(req.Contexts, ","),
+		"command":  cmdStr,
+	}, nil, "executing kubectl fan-out")
+
+	startTime := time.Now()
+	results := make([]ContextResult, len(req.Contexts))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range req.Contexts {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result, err := run(CommandRequest{
+				Context: name,
+				Command: req.Command,
+				Timeout: req.Timeout,
+			})
+			if err != nil {
+				result = &CommandResult{Command: cmdStr, Error: err.Error(), ExitCode: -1}
+			}
+			results[i] = ContextResult{Context: name, CommandResult: *result}
+		}(i, name)
+	}
+	wg.Wait()
+
+	fanOut := &FanOutResult{
+		Command:    cmdStr,
+		Results:    results,
+		ExecTimeMs: time.Since(startTime).Milliseconds(),
+	}
+	for _, result := range results {
+		if result.Success {
+			fanOut.Succeeded++
+		} else {
+			fanOut.Failed++
+		}
+	}
+	fanOut.Groups, fanOut.Diffs = compareOutputs(results)
+
+	return fanOut
+}
+
+// compareOutputs groups the successful results by identical output and diffs each group against the largest one
+func compareOutputs(results []ContextResult) ([]OutputGroup, []OutputDiff) {
+	groupsByHash := map[string]*OutputGroup{}
+	outputs := map[string]string{}
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		sum := sha256.Sum256([]byte(result.Output))
+		hash := hex.EncodeToString(sum[:8])
+		group, ok := groupsByHash[hash]
+		if !ok {
+			group = &OutputGroup{Hash: hash, Lines: len(splitLines(result.Output))}
+			groupsByHash[hash] = group
+			outputs[hash] = result.Output
+		}
+		group.Contexts = append(group.Contexts, result.Context)
+	}
+
+	groups := make([]OutputGroup, 0, len(groupsByHash))
+	for _, group := range groupsByHash {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Contexts) != len(groups[j].Contexts) {
+			return len(groups[i].Contexts) > len(groups[j].Contexts)
+		}
+		return groups[i].Contexts[0] < groups[j].Contexts[0]
+	})
+	if len(groups) < 2 {
+		return groups, nil
+	}
+
+	baseline := splitLines(outputs[groups[0].Hash])
+	diffs := make([]OutputDiff, 0, len(groups)-1)
+	for _, group := range groups[1:] {
+		diff, truncated := lineDiff(baseline, splitLines(outputs[group.Hash]))
+		diffs = append(diffs, OutputDiff{Contexts: group.Contexts, Diff: diff, Truncated: truncated})
+	}
+	return groups, diffs
+}
+
+func splitLines(output string) []string {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// lineDiff returns the lines removed from a ("- ") and added in b ("+ ") based on their longest
+// common subsequence. Outputs too large to diff are reported as fully replaced and truncated.
+func lineDiff(a, b []string) ([]string, bool) {
+	if len(a)*len(b) > maxDiffCells {
+		return []string{fmt.Sprintf("- %d lines", len(a)), fmt.Sprintf("+ %d lines", len(b))}, true
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+	return diff, false
+}
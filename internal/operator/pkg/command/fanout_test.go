@@ -0,0 +1,156 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLineDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{name: "identical", a: []string{"x", "y"}, b: []string{"x", "y"}, want: nil},
+		{name: "added", a: []string{"x"}, b: []string{"x", "y"}, want: []string{"+ y"}},
+		{name: "removed", a: []string{"x", "y"}, b: []string{"y"}, want: []string{"- x"}},
+		{name: "changed", a: []string{"node-1 Ready", "node-2 Ready"}, b: []string{"node-1 Ready", "node-2 NotReady"},
+			want: []string{"- node-2 Ready", "+ node-2 NotReady"}},
+		{name: "empty baseline", a: nil, b: []string{"x"}, want: []string{"+ x"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, truncated := lineDiff(tt.a, tt.b)
+			if truncated {
+				t.Fatalf("lineDiff() unexpectedly truncated")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputs(t *testing.T) {
+	t.Parallel()
+
+	result := func(context, output string, success bool) ContextResult {
+		return ContextResult{Context: context, CommandResult: CommandResult{Success: success, Output: output}}
+	}
+
+	tests := []struct {
+		name       string
+		results    []ContextResult
+		wantGroups [][]string
+		wantDiffs  []OutputDiff
+	}{
+		{
+			name:       "identical outputs",
+			results:    []ContextResult{result("dev", "a\nb\n", true), result("prod", "a\nb\n", true)},
+			wantGroups: [][]string{{"dev", "prod"}},
+		},
+		{
+			name: "largest group is the baseline",
+			results: []ContextResult{
+				result("dev", "a\nc\n", true),
+				result("prod", "a\nb\n", true),
+				result("staging", "a\nb\n", true),
+			},
+			wantGroups: [][]string{{"prod", "staging"}, {"dev"}},
+			wantDiffs:  []OutputDiff{{Contexts: []string{"dev"}, Diff: []string{"- b", "+ c"}}},
+		},
+		{
+			name:       "ties ordered by first context",
+			results:    []ContextResult{result("prod", "b", true), result("dev", "a", true)},
+			wantGroups: [][]string{{"dev"}, {"prod"}},
+			wantDiffs:  []OutputDiff{{Contexts: []string{"prod"}, Diff: []string{"- a", "+ b"}}},
+		},
+		{
+			name:       "failed results are not grouped",
+			results:    []ContextResult{result("dev", "a", true), result("prod", "", false)},
+			wantGroups: [][]string{{"dev"}},
+		},
+		{
+			name:       "no successful results",
+			results:    []ContextResult{result("dev", "", false)},
+			wantGroups: [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			groups, diffs := compareOutputs(tt.results)
+			gotGroups := [][]string{}
+			for _, group := range groups {
+				gotGroups = append(gotGroups, group.Contexts)
+			}
+			if !reflect.DeepEqual(gotGroups, tt.wantGroups) {
+				t.Errorf("compareOutputs() groups = %v, want %v", gotGroups, tt.wantGroups)
+			}
+			if !reflect.DeepEqual(diffs, tt.wantDiffs) {
+				t.Errorf("compareOutputs() diffs = %+v, want %+v", diffs, tt.wantDiffs)
+			}
+		})
+	}
+}
+
+func TestRunFanOutConcurrency(t *testing.T) {
+	t.Parallel()
+
+	contexts := make([]string, 12)
+	for i := range contexts {
+		contexts[i] = fmt.Sprintf("cluster-%d", i)
+	}
+
+	var mutex sync.Mutex
+	running, peak := 0, 0
+	run := func(req CommandRequest) (*CommandResult, error) {
+		mutex.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		if req.Context == "cluster-3" {
+			return nil, errors.New("connection refused")
+		}
+		return &CommandResult{Success: true, Output: "ok"}, nil
+	}
+
+	result := runFanOut(FanOutRequest{Contexts: contexts, Command: []string{"kubectl", "get", "nodes"}, Concurrency: 3}, run)
+
+	if peak > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", peak)
+	}
+	if result.Succeeded != 11 || result.Failed != 1 {
+		t.Errorf("succeeded = %d, failed = %d, want 11 and 1", result.Succeeded, result.Failed)
+	}
+	for i, r := range result.Results {
+		if r.Context != contexts[i] {
+			t.Errorf("result %d context = %q, want %q", i, r.Context, contexts[i])
+		}
+	}
+	if failed := result.Results[3]; failed.Error != "connection refused" || failed.ExitCode != -1 {
+		t.Errorf("failed result = %+v, want runner error and exit code -1", failed.CommandResult)
+	}
+}
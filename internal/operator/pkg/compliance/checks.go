@@ -0,0 +1,579 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiBenchmark names the benchmark the API inspection follows
+const apiBenchmark = "CIS Kubernetes Benchmark v1.8 (API inspection)"
+
+// systemNamespaces run the cluster components, whose pods need the host access the pod checks report
+var systemNamespaces = map[string]bool{"kube-system": true, "kube-public": true, "kube-node-lease": true}
+
+// Resources a check reads, a check whose resources can't be listed warns instead of passing
+const (
+	resourcePods            = "pods"
+	resourceNamespaces      = "namespaces"
+	resourceServiceAccounts = "serviceaccounts"
+	resourceNetworkPolicies = "networkpolicies"
+	resourceRBAC            = "rbac"
+)
+
+// snapshot holds the objects the checks inspect
+type snapshot struct {
+	pods            []corev1.Pod
+	namespaces      []corev1.Namespace
+	serviceAccounts []corev1.ServiceAccount
+	networkPolicies []networkingv1.NetworkPolicy
+	roles           []rbacv1.Role
+	clusterRoles    []rbacv1.ClusterRole
+	bindings        []rbacv1.ClusterRoleBinding
+	// flags holds the command line flags of the control plane components found as pods, by component
+	flags map[string]map[string]string
+	errs  map[string]error
+}
+
+// check is a benchmark recommendation verified against the snapshot. It passes without findings;
+// with findings it fails unless run returns another status, e.g. StatusWarn for manual recommendations.
+type check struct {
+	id, section, title, remediation string
+	scored                          bool
+	needs                           []string
+	// component is the control plane component whose flags the check reads
+	component string
+	run       func(s *snapshot) (status string, findings []string)
+}
+
+// inspect lists the objects of the cluster and verifies every check, returning the errors of the
+// objects that couldn't be listed
+func inspect(ctx context.Context, clientset kubernetes.Interface) ([]Control, []string) {
+	s := collect(ctx, clientset)
+	var errs []string
+	for resource, err := range s.errs {
+		errs = append(errs, fmt.Sprintf("%s: %v", resource, err))
+	}
+	sort.Strings(errs)
+	return s.verify(checks), errs
+}
+
+// collect lists the objects the checks read, recording the lists that failed
+func collect(ctx context.Context, clientset kubernetes.Interface) *snapshot {
+	s := &snapshot{flags: map[string]map[string]string{}, errs: map[string]error{}}
+	all := metav1.ListOptions{}
+
+	if pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, all); err != nil {
+		s.errs[resourcePods] = err
+	} else {
+		s.pods = pods.Items
+		for _, pod := range pods.Items {
+			component := pod.Labels["component"]
+			if pod.Namespace != metav1.NamespaceSystem || !controlPlaneComponents[component] || len(pod.Spec.Containers) == 0 {
+				continue
+			}
+			container := pod.Spec.Containers[0]
+			s.flags[component] = parseFlags(append(append([]string{}, container.Command...), container.Args...))
+		}
+	}
+	if namespaces, err := clientset.CoreV1().Namespaces().List(ctx, all); err != nil {
+		s.errs[resourceNamespaces] = err
+	} else {
+		s.namespaces = namespaces.Items
+	}
+	if serviceAccounts, err := clientset.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, all); err != nil {
+		s.errs[resourceServiceAccounts] = err
+	} else {
+		s.serviceAccounts = serviceAccounts.Items
+	}
+	if policies, err := clientset.NetworkingV1().NetworkPolicies(metav1.NamespaceAll).List(ctx, all); err != nil {
+		s.errs[resourceNetworkPolicies] = err
+	} else {
+		s.networkPolicies = policies.Items
+	}
+
+	roles, err := clientset.RbacV1().Roles(metav1.NamespaceAll).List(ctx, all)
+	if err == nil {
+		s.roles = roles.Items
+		var clusterRoles *rbacv1.ClusterRoleList
+		if clusterRoles, err = clientset.RbacV1().ClusterRoles().List(ctx, all); err == nil {
+			s.clusterRoles = clusterRoles.Items
+			var bindings *rbacv1.ClusterRoleBindingList
+			if bindings, err = clientset.RbacV1().ClusterRoleBindings().List(ctx, all); err == nil {
+				s.bindings = bindings.Items
+			}
+		}
+	}
+	if err != nil {
+		s.errs[resourceRBAC] = err
+	}
+	return s
+}
+
+// verify runs the checks against the snapshot
+func (s *snapshot) verify(checks []check) []Control {
+	controls := make([]Control, 0, len(checks))
+	for _, c := range checks {
+		control := Control{ID: c.id, Section: c.section, Title: c.title, Scored: c.scored, Remediation: c.remediation}
+		if err := s.missing(c.needs); err != nil {
+			control.Status, control.Findings = StatusWarn, []string{err.Error()}
+		} else if _, ok := s.flags[c.component]; c.component != "" && !ok {
+			// Managed control planes don't run their components as pods
+			control.Status, control.Findings = StatusInfo, []string{c.component + " is not visible as a pod, check it on the control plane nodes with kube-bench"}
+		} else {
+			status, findings := c.run(s)
+			if len(findings) == 0 {
+				status = StatusPass
+			} else if status == "" {
+				status = StatusFail
+			}
+			control.Status, control.Findings = status, capFindings(findings)
+		}
+		controls = append(controls, control)
+	}
+	return controls
+}
+
+// missing returns the error of the first resource of needs that couldn't be listed
+func (s *snapshot) missing(needs []string) error {
+	for _, resource := range needs {
+		if err, ok := s.errs[resource]; ok {
+			return fmt.Errorf("could not list %s: %v", resource, err)
+		}
+	}
+	return nil
+}
+
+// controlPlaneComponents are the component labels of the control plane static pods of kubeadm
+var controlPlaneComponents = map[string]bool{"kube-apiserver": true, "kube-controller-manager": true, "kube-scheduler": true}
+
+// parseFlags reads --name=value and --name flags, the latter as true
+func parseFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !ok {
+			value = "true"
+		}
+		flags[name] = value
+	}
+	return flags
+}
+
+// flagCheck verifies a flag of a control plane component
+func flagCheck(id, section, component, flag, title, remediation string, scored bool, ok func(value string, set bool) bool) check {
+	return check{
+		id: id, section: section, title: title, remediation: remediation, scored: scored,
+		needs: []string{resourcePods}, component: component,
+		run: func(s *snapshot) (string, []string) {
+			value, set := s.flags[component][flag]
+			if ok(value, set) {
+				return "", nil
+			}
+			if !set {
+				return "", []string{fmt.Sprintf("%s: --%s is not set", component, flag)}
+			}
+			return "", []string{fmt.Sprintf("%s: --%s=%s", component, flag, value)}
+		},
+	}
+}
+
+// listContains reports whether a comma separated flag value holds an item
+func listContains(value, item string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.TrimSpace(v) == item {
+			return true
+		}
+	}
+	return false
+}
+
+// podCheck reports the containers or pods of the workload namespaces failing a condition
+func podCheck(id, title, remediation string, scored bool, failing func(pod *corev1.Pod) []string) check {
+	return check{
+		id: id, section: "5.2 Pod Security Standards", title: title, remediation: remediation, scored: scored,
+		needs: []string{resourcePods},
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for i := range s.pods {
+				pod := &s.pods[i]
+				if systemNamespaces[pod.Namespace] {
+					continue
+				}
+				for _, finding := range failing(pod) {
+					findings = append(findings, pod.Namespace+"/"+pod.Name+finding)
+				}
+			}
+			return "", findings
+		},
+	}
+}
+
+// containersWhere returns the containers of a pod matching a condition, as findings suffixes
+func containersWhere(pod *corev1.Pod, matches func(c *corev1.Container) bool) []string {
+	var findings []string
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for i := range containers {
+		if matches(&containers[i]) {
+			findings = append(findings, " container "+containers[i].Name)
+		}
+	}
+	return findings
+}
+
+// podWhere returns the pod as a finding when it matches a condition
+func podWhere(matches bool) []string {
+	if matches {
+		return []string{""}
+	}
+	return nil
+}
+
+// checks are the recommendations verifiable through the API
+var checks = []check{
+	flagCheck("1.2.1", "1.2 API Server", "kube-apiserver", "anonymous-auth",
+		"Ensure that the --anonymous-auth argument is set to false",
+		"Set --anonymous-auth=false in the kube-apiserver manifest, after checking health probes don't rely on anonymous access.", false,
+		func(value string, set bool) bool { return set && value == "false" }),
+	flagCheck("1.2.2", "1.2 API Server", "kube-apiserver", "token-auth-file",
+		"Ensure that the --token-auth-file parameter is not set",
+		"Remove --token-auth-file from the kube-apiserver manifest and use another authentication mechanism.", true,
+		func(_ string, set bool) bool { return !set }),
+	flagCheck("1.2.6", "1.2 API Server", "kube-apiserver", "authorization-mode",
+		"Ensure that the --authorization-mode argument is not set to AlwaysAllow",
+		"Set --authorization-mode to Node,RBAC in the kube-apiserver manifest.", true,
+		func(value string, set bool) bool { return set && !listContains(value, "AlwaysAllow") }),
+	flagCheck("1.2.7", "1.2 API Server", "kube-apiserver", "authorization-mode",
+		"Ensure that the --authorization-mode argument includes Node",
+		"Add Node to --authorization-mode in the kube-apiserver manifest.", true,
+		func(value string, _ bool) bool { return listContains(value, "Node") }),
+	flagCheck("1.2.8", "1.2 API Server", "kube-apiserver", "authorization-mode",
+		"Ensure that the --authorization-mode argument includes RBAC",
+		"Add RBAC to --authorization-mode in the kube-apiserver manifest.", true,
+		func(value string, _ bool) bool { return listContains(value, "RBAC") }),
+	flagCheck("1.2.10", "1.2 API Server", "kube-apiserver", "enable-admission-plugins",
+		"Ensure that the admission control plugin AlwaysAdmit is not set",
+		"Remove AlwaysAdmit from --enable-admission-plugins in the kube-apiserver manifest.", true,
+		func(value string, _ bool) bool { return !listContains(value, "AlwaysAdmit") }),
+	flagCheck("1.2.15", "1.2 API Server", "kube-apiserver", "enable-admission-plugins",
+		"Ensure that the admission control plugin NodeRestriction is set",
+		"Add NodeRestriction to --enable-admission-plugins in the kube-apiserver manifest and use the Node authorizer.", true,
+		func(value string, _ bool) bool { return listContains(value, "NodeRestriction") }),
+	flagCheck("1.2.16", "1.2 API Server", "kube-apiserver", "profiling",
+		"Ensure that the --profiling argument is set to false",
+		"Set --profiling=false in the kube-apiserver manifest.", true,
+		func(value string, set bool) bool { return set && value == "false" }),
+	flagCheck("1.2.17", "1.2 API Server", "kube-apiserver", "audit-log-path",
+		"Ensure that the --audit-log-path argument is set",
+		"Set --audit-log-path to the audit log file in the kube-apiserver manifest.", true,
+		func(value string, set bool) bool { return set && value != "" }),
+	flagCheck("1.3.2", "1.3 Controller Manager", "kube-controller-manager", "profiling",
+		"Ensure that the --profiling argument is set to false",
+		"Set --profiling=false in the kube-controller-manager manifest.", true,
+		func(value string, set bool) bool { return set && value == "false" }),
+	flagCheck("1.3.3", "1.3 Controller Manager", "kube-controller-manager", "use-service-account-credentials",
+		"Ensure that the --use-service-account-credentials argument is set to true",
+		"Set --use-service-account-credentials=true in the kube-controller-manager manifest.", true,
+		func(value string, set bool) bool { return set && value == "true" }),
+	flagCheck("1.4.1", "1.4 Scheduler", "kube-scheduler", "profiling",
+		"Ensure that the --profiling argument is set to false",
+		"Set --profiling=false in the kube-scheduler manifest.", true,
+		func(value string, set bool) bool { return set && value == "false" }),
+
+	{
+		id: "5.1.1", section: "5.1 RBAC and Service Accounts", needs: []string{resourceRBAC},
+		title:       "Ensure that the cluster-admin role is only used where required",
+		remediation: "Bind users and groups to narrower roles and remove the cluster-admin bindings they don't need.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for _, binding := range s.bindings {
+				if binding.RoleRef.Kind != "ClusterRole" || binding.RoleRef.Name != "cluster-admin" {
+					continue
+				}
+				for _, subject := range binding.Subjects {
+					if !strings.HasPrefix(subject.Name, "system:") {
+						findings = append(findings, fmt.Sprintf("ClusterRoleBinding %s grants cluster-admin to %s %s", binding.Name, subject.Kind, subject.Name))
+					}
+				}
+			}
+			return "", findings
+		},
+	},
+	{
+		id: "5.1.3", section: "5.1 RBAC and Service Accounts", needs: []string{resourceRBAC},
+		title:       "Minimize wildcard use in Roles and ClusterRoles",
+		remediation: "Replace wildcards in the rules of Roles and ClusterRoles with the resources and verbs they need.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for _, role := range s.clusterRoles {
+				if !strings.HasPrefix(role.Name, "system:") && role.Name != "cluster-admin" && hasWildcard(role.Rules) {
+					findings = append(findings, "ClusterRole "+role.Name)
+				}
+			}
+			for _, role := range s.roles {
+				if !systemNamespaces[role.Namespace] && hasWildcard(role.Rules) {
+					findings = append(findings, "Role "+role.Namespace+"/"+role.Name)
+				}
+			}
+			return "", findings
+		},
+	},
+	{
+		id: "5.1.5", section: "5.1 RBAC and Service Accounts", needs: []string{resourceServiceAccounts},
+		title:       "Ensure that default service accounts are not actively used",
+		remediation: "Set automountServiceAccountToken: false on the default service account of every namespace and create service accounts for workloads needing API access.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for _, sa := range s.serviceAccounts {
+				if sa.Name == "default" && !systemNamespaces[sa.Namespace] && (sa.AutomountServiceAccountToken == nil || *sa.AutomountServiceAccountToken) {
+					findings = append(findings, "ServiceAccount "+sa.Namespace+"/default mounts its token")
+				}
+			}
+			return "", findings
+		},
+	},
+	{
+		id: "5.1.6", section: "5.1 RBAC and Service Accounts", needs: []string{resourcePods, resourceServiceAccounts},
+		title:       "Ensure that Service Account Tokens are only mounted where necessary",
+		remediation: "Set automountServiceAccountToken: false on pods and service accounts that don't call the API.",
+		run: func(s *snapshot) (string, []string) {
+			disabled := map[string]bool{}
+			for _, sa := range s.serviceAccounts {
+				if sa.AutomountServiceAccountToken != nil && !*sa.AutomountServiceAccountToken {
+					disabled[sa.Namespace+"/"+sa.Name] = true
+				}
+			}
+			var findings []string
+			for _, pod := range s.pods {
+				if systemNamespaces[pod.Namespace] {
+					continue
+				}
+				serviceAccount := pod.Spec.ServiceAccountName
+				if serviceAccount == "" {
+					serviceAccount = "default"
+				}
+				automount := pod.Spec.AutomountServiceAccountToken
+				if (automount != nil && *automount) || (automount == nil && !disabled[pod.Namespace+"/"+serviceAccount]) {
+					findings = append(findings, pod.Namespace+"/"+pod.Name+" mounts the token of "+serviceAccount)
+				}
+			}
+			return StatusWarn, findings
+		},
+	},
+
+	podCheck("5.2.2", "Minimize the admission of privileged containers",
+		"Remove privileged: true from the security context of the containers, enforce the baseline Pod Security Standard.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool {
+				return c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged
+			})
+		}),
+	podCheck("5.2.3", "Minimize the admission of containers wishing to share the host process ID namespace",
+		"Remove hostPID: true from the pods, enforce the baseline Pod Security Standard.", false,
+		func(pod *corev1.Pod) []string { return podWhere(pod.Spec.HostPID) }),
+	podCheck("5.2.4", "Minimize the admission of containers wishing to share the host IPC namespace",
+		"Remove hostIPC: true from the pods, enforce the baseline Pod Security Standard.", false,
+		func(pod *corev1.Pod) []string { return podWhere(pod.Spec.HostIPC) }),
+	podCheck("5.2.5", "Minimize the admission of containers wishing to share the host network namespace",
+		"Remove hostNetwork: true from the pods, enforce the baseline Pod Security Standard.", false,
+		func(pod *corev1.Pod) []string { return podWhere(pod.Spec.HostNetwork) }),
+	podCheck("5.2.6", "Minimize the admission of containers with allowPrivilegeEscalation",
+		"Set allowPrivilegeEscalation: false in the security context of the containers.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool {
+				return c.SecurityContext == nil || c.SecurityContext.AllowPrivilegeEscalation == nil || *c.SecurityContext.AllowPrivilegeEscalation
+			})
+		}),
+	podCheck("5.2.7", "Minimize the admission of root containers",
+		"Set runAsNonRoot: true, or a non-zero runAsUser, in the security context of the pods or containers.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool { return runsAsRoot(pod, c) })
+		}),
+	podCheck("5.2.8", "Minimize the admission of containers with the NET_RAW capability",
+		"Drop NET_RAW, or ALL, from the capabilities of the containers.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool {
+				return c.SecurityContext == nil || c.SecurityContext.Capabilities == nil ||
+					!hasCapability(c.SecurityContext.Capabilities.Drop, "NET_RAW")
+			})
+		}),
+	podCheck("5.2.9", "Minimize the admission of containers with added capabilities",
+		"Remove the capabilities added to the containers unless they need them.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool {
+				return c.SecurityContext != nil && c.SecurityContext.Capabilities != nil && len(c.SecurityContext.Capabilities.Add) > 0
+			})
+		}),
+	podCheck("5.2.12", "Minimize the admission of HostPath volumes",
+		"Replace hostPath volumes with persistent volumes or emptyDir, enforce the baseline Pod Security Standard.", false,
+		func(pod *corev1.Pod) []string {
+			var findings []string
+			for _, volume := range pod.Spec.Volumes {
+				if volume.HostPath != nil {
+					findings = append(findings, " volume "+volume.Name+" mounts "+volume.HostPath.Path)
+				}
+			}
+			return findings
+		}),
+	podCheck("5.2.13", "Minimize the admission of containers which use HostPorts",
+		"Expose the containers through services instead of hostPort.", false,
+		func(pod *corev1.Pod) []string {
+			return containersWhere(pod, func(c *corev1.Container) bool {
+				for _, port := range c.Ports {
+					if port.HostPort != 0 {
+						return true
+					}
+				}
+				return false
+			})
+		}),
+
+	{
+		id: "5.3.2", section: "5.3 Network Policies and CNI", needs: []string{resourceNamespaces, resourceNetworkPolicies},
+		title:       "Ensure that all Namespaces have Network Policies defined",
+		remediation: "Add a NetworkPolicy to every namespace, e.g. one denying the ingress traffic not allowed by others.",
+		run: func(s *snapshot) (string, []string) {
+			covered := map[string]bool{}
+			for _, policy := range s.networkPolicies {
+				covered[policy.Namespace] = true
+			}
+			var findings []string
+			for _, namespace := range s.namespaces {
+				if !systemNamespaces[namespace.Name] && !covered[namespace.Name] {
+					findings = append(findings, "Namespace "+namespace.Name+" has no NetworkPolicy")
+				}
+			}
+			return "", findings
+		},
+	},
+	{
+		id: "5.4.1", section: "5.4 Secrets Management", needs: []string{resourcePods},
+		title:       "Prefer using Secrets as files over Secrets as environment variables",
+		remediation: "Mount the secrets as volumes instead of reading them into environment variables.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for i := range s.pods {
+				pod := &s.pods[i]
+				if systemNamespaces[pod.Namespace] {
+					continue
+				}
+				for _, finding := range containersWhere(pod, readsSecretEnv) {
+					findings = append(findings, pod.Namespace+"/"+pod.Name+finding)
+				}
+			}
+			return StatusWarn, findings
+		},
+	},
+	{
+		id: "5.7.2", section: "5.7 General Policies", needs: []string{resourcePods},
+		title:       "Ensure that the seccomp profile is set to docker/default in your Pod definitions",
+		remediation: "Set seccompProfile.type to RuntimeDefault in the security context of the pods.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for i := range s.pods {
+				pod := &s.pods[i]
+				if systemNamespaces[pod.Namespace] {
+					continue
+				}
+				for _, finding := range containersWhere(pod, func(c *corev1.Container) bool { return !hasSeccomp(pod, c) }) {
+					findings = append(findings, pod.Namespace+"/"+pod.Name+finding)
+				}
+			}
+			return StatusWarn, findings
+		},
+	},
+	{
+		id: "5.7.4", section: "5.7 General Policies", needs: []string{resourcePods},
+		title:       "The default namespace should not be used",
+		remediation: "Move the workloads of the default namespace to namespaces of their own.",
+		run: func(s *snapshot) (string, []string) {
+			var findings []string
+			for _, pod := range s.pods {
+				if pod.Namespace == metav1.NamespaceDefault {
+					findings = append(findings, "Pod default/"+pod.Name)
+				}
+			}
+			return "", findings
+		},
+	},
+}
+
+func hasWildcard(rules []rbacv1.PolicyRule) bool {
+	for _, rule := range rules {
+		for _, values := range [][]string{rule.Verbs, rule.Resources, rule.APIGroups} {
+			for _, value := range values {
+				if value == "*" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func hasCapability(capabilities []corev1.Capability, name corev1.Capability) bool {
+	for _, capability := range capabilities {
+		if capability == name || capability == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// runsAsRoot reports whether a container may run as root, the container security context
+// overriding the one of the pod
+func runsAsRoot(pod *corev1.Pod, c *corev1.Container) bool {
+	var nonRoot *bool
+	var user *int64
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		nonRoot, user = sc.RunAsNonRoot, sc.RunAsUser
+	}
+	if sc := c.SecurityContext; sc != nil {
+		if sc.RunAsNonRoot != nil {
+			nonRoot = sc.RunAsNonRoot
+		}
+		if sc.RunAsUser != nil {
+			user = sc.RunAsUser
+		}
+	}
+	if user != nil {
+		return *user == 0
+	}
+	return nonRoot == nil || !*nonRoot
+}
+
+// hasSeccomp reports whether a container runs with the runtime default or a local seccomp profile
+func hasSeccomp(pod *corev1.Pod, c *corev1.Container) bool {
+	profile := (*corev1.SeccompProfile)(nil)
+	if pod.Spec.SecurityContext != nil {
+		profile = pod.Spec.SecurityContext.SeccompProfile
+	}
+	if c.SecurityContext != nil && c.SecurityContext.SeccompProfile != nil {
+		profile = c.SecurityContext.SeccompProfile
+	}
+	return profile != nil && profile.Type != corev1.SeccompProfileTypeUnconfined
+}
+
+func readsSecretEnv(c *corev1.Container) bool {
+	for _, env := range c.Env {
+		if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+			return true
+		}
+	}
+	for _, source := range c.EnvFrom {
+		if source.SecretRef != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func controlPlanePod(component string, command ...string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: component + "-cp", Namespace: "kube-system", Labels: map[string]string{"component": component}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: component, Command: command}}},
+	}
+}
+
+func byID(controls []Control) map[string]Control {
+	result := map[string]Control{}
+	for _, control := range controls {
+		result[control.ID] = control
+	}
+	return result
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	hardened := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+		Spec: corev1.PodSpec{
+			AutomountServiceAccountToken: ptr.To(false),
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   ptr.To(true),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{{
+				Name: "api",
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: ptr.To(false),
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			}},
+		},
+	}
+	privileged := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			HostNetwork: true,
+			Containers: []corev1.Container{{
+				Name:            "shell",
+				SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+				Env: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "token"}, Key: "token"},
+				}}},
+			}},
+			Volumes: []corev1.Volume{{Name: "root", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/"}}}},
+		},
+	}
+	// System pods need host access and are left out of the pod checks
+	proxy := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system"},
+		Spec:       corev1.PodSpec{HostNetwork: true, Containers: []corev1.Container{{Name: "proxy"}}},
+	}
+
+	clientset := fake.NewSimpleClientset(
+		controlPlanePod("kube-apiserver", "kube-apiserver", "--anonymous-auth=false", "--authorization-mode=Node,RBAC",
+			"--enable-admission-plugins=NodeRestriction", "--profiling=false", "--token-auth-file=/etc/tokens.csv"),
+		controlPlanePod("kube-scheduler", "kube-scheduler", "--profiling"),
+		hardened, privileged, proxy,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "deny", Namespace: "shop"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "shop"}, AutomountServiceAccountToken: ptr.To(false)},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops-admin"},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+			Subjects:   []rbacv1.Subject{{Kind: "Group", Name: "system:masters"}, {Kind: "User", Name: "alice"}},
+		},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "everything", Namespace: "shop"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"*"}, Verbs: []string{"get"}}},
+		},
+	)
+
+	controls, errs := inspect(context.Background(), clientset)
+	if len(errs) != 0 {
+		t.Fatalf("inspect() errors = %v", errs)
+	}
+	got := byID(controls)
+
+	tests := []struct {
+		id       string
+		status   string
+		findings int
+	}{
+		{"1.2.1", StatusPass, 0},
+		{"1.2.2", StatusFail, 1},
+		{"1.2.6", StatusPass, 0},
+		{"1.2.8", StatusPass, 0},
+		{"1.2.15", StatusPass, 0},
+		{"1.2.17", StatusFail, 1},
+		// The controller manager doesn't run as a pod
+		{"1.3.2", StatusInfo, 1},
+		// A bare flag is true
+		{"1.4.1", StatusFail, 1},
+		{"5.1.1", StatusFail, 1},
+		{"5.1.3", StatusFail, 1},
+		{"5.1.5", StatusFail, 1},
+		{"5.1.6", StatusWarn, 1},
+		{"5.2.2", StatusFail, 1},
+		{"5.2.5", StatusFail, 1},
+		{"5.2.6", StatusFail, 1},
+		{"5.2.7", StatusFail, 1},
+		{"5.2.8", StatusFail, 1},
+		{"5.2.12", StatusFail, 1},
+		{"5.2.3", StatusPass, 0},
+		{"5.3.2", StatusFail, 1},
+		{"5.4.1", StatusWarn, 1},
+		{"5.7.2", StatusWarn, 1},
+		{"5.7.4", StatusFail, 1},
+	}
+	for _, tt := range tests {
+		control, ok := got[tt.id]
+		if !ok {
+			t.Errorf("control %s missing", tt.id)
+			continue
+		}
+		if control.Status != tt.status || len(control.Findings) != tt.findings {
+			t.Errorf("control %s = %s with findings %q, want %s with %d findings", tt.id, control.Status, control.Findings, tt.status, tt.findings)
+		}
+		if control.Remediation == "" {
+			t.Errorf("control %s has no remediation", tt.id)
+		}
+	}
+}
+
+func TestInspectListErrors(t *testing.T) {
+	t.Parallel()
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "clusterrolebindings", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	controls, errs := inspect(context.Background(), clientset)
+	if len(errs) != 1 {
+		t.Fatalf("inspect() errors = %v, want the failed RBAC list", errs)
+	}
+	got := byID(controls)
+	if got["5.1.1"].Status != StatusWarn {
+		t.Errorf("control 5.1.1 = %s, want WARN when the bindings can't be listed", got["5.1.1"].Status)
+	}
+	if got["5.7.4"].Status != StatusPass {
+		t.Errorf("control 5.7.4 = %s, want PASS without pods", got["5.7.4"].Status)
+	}
+}
+
+func TestCapFindings(t *testing.T) {
+	t.Parallel()
+
+	findings := make([]string, maxFindings+5)
+	got := capFindings(findings)
+	if len(got) != maxFindings+1 || got[maxFindings] != "and 5 more" {
+		t.Errorf("capFindings() kept %d findings ending with %q, want %d ending with the count", len(got), got[len(got)-1], maxFindings+1)
+	}
+}
@@ -0,0 +1,312 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	OperationRun = "compliance-run"
+
+	// Sources of a report: checks of the objects served by the API, or kube-bench run as a Job on a node
+	SourceAPI       = "api"
+	SourceKubeBench = "kube-bench"
+
+	reportsFileName = "compliance-reports.json"
+	runTimeout      = 15 * time.Minute
+	// maxFindings caps the objects listed on a failing control, the rest are counted
+	maxFindings = 50
+)
+
+// Control statuses, as kube-bench reports them
+const (
+	StatusPass = "PASS"
+	StatusFail = "FAIL"
+	StatusWarn = "WARN"
+	StatusInfo = "INFO"
+)
+
+var (
+	// ErrNoReport is returned for clusters never checked
+	ErrNoReport = errors.New("no compliance report for the cluster, run the benchmark first")
+	// ErrInvalidSource is returned for runs asking for an unknown source
+	ErrInvalidSource = fmt.Errorf("source must be %s or %s", SourceAPI, SourceKubeBench)
+)
+
+// Control is the result of a benchmark recommendation
+type Control struct {
+	ID      string `json:"id"`
+	Section string `json:"section"`
+	Title   string `json:"title"`
+	Status  string `json:"status"`
+	// Scored controls are automated in the benchmark, the others are manual recommendations
+	Scored      bool   `json:"scored"`
+	Remediation string `json:"remediation,omitempty"`
+	// Findings name the objects or settings failing the control
+	Findings []string `json:"findings,omitempty"`
+	// Node is the node kube-bench checked the control on
+	Node string `json:"node,omitempty"`
+}
+
+// Totals counts the controls by status
+type Totals struct {
+	Pass int `json:"pass"`
+	Fail int `json:"fail"`
+	Warn int `json:"warn"`
+	Info int `json:"info"`
+}
+
+// Report is the outcome of a benchmark run against a cluster
+type Report struct {
+	Cluster     string    `json:"cluster"`
+	Source      string    `json:"source"`
+	Benchmark   string    `json:"benchmark"`
+	OperationID string    `json:"operationId,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Totals      Totals    `json:"totals"`
+	// Score is the percentage of passing controls among those that passed or failed
+	Score    float64   `json:"score"`
+	Controls []Control `json:"controls"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// Summary is a report without its controls
+type Summary struct {
+	Cluster    string    `json:"cluster"`
+	Source     string    `json:"source"`
+	Benchmark  string    `json:"benchmark"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Totals     Totals    `json:"totals"`
+	Score      float64   `json:"score"`
+}
+
+// RunRequest selects how a cluster is checked
+type RunRequest struct {
+	// Source is SourceAPI, the default, or SourceKubeBench
+	Source string `json:"source,omitempty"`
+	// NodeName pins the kube-bench Job to a node, e.g. a control plane node
+	NodeName string `json:"nodeName,omitempty"`
+	// Image overrides the kube-bench image
+	Image string `json:"image,omitempty"`
+}
+
+// Manager runs benchmarks through the operation queue and keeps the latest report of every cluster
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	filePath        string
+	mutex           sync.Mutex
+}
+
+// NewManager creates a new compliance manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		filePath:        filepath.Join(utils.ConfigDir(), reportsFileName),
+	}
+}
+
+// Run queues a benchmark run against a cluster
+func (m *Manager) Run(clusterName string, req RunRequest) (*utils.Operation, error) {
+	if req.Source == "" {
+		req.Source = SourceAPI
+	}
+	if req.Source != SourceAPI && req.Source != SourceKubeBench {
+		return nil, ErrInvalidSource
+	}
+	if _, err := m.kubeConfigStore.GetContext(clusterName); err != nil {
+		return nil, fmt.Errorf("context %s not found: %w", clusterName, err)
+	}
+
+	data := map[string]interface{}{
+		"source":   req.Source,
+		"nodeName": req.NodeName,
+		"image":    req.Image,
+	}
+	return m.queue.AddOperation(OperationRun, clusterName, "user", data, []string{"compliance", req.Source}), nil
+}
+
+// Report returns the latest report of a cluster
+func (m *Manager) Report(clusterName string) (*Report, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reports, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	report, ok := reports[clusterName]
+	if !ok {
+		return nil, ErrNoReport
+	}
+	return report, nil
+}
+
+// Summaries returns the summary of the latest report of every cluster, sorted by cluster
+func (m *Manager) Summaries() ([]Summary, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reports, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]Summary, 0, len(reports))
+	for _, report := range reports {
+		summaries = append(summaries, Summary{
+			Cluster:    report.Cluster,
+			Source:     report.Source,
+			Benchmark:  report.Benchmark,
+			FinishedAt: report.FinishedAt,
+			Totals:     report.Totals,
+			Score:      report.Score,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Cluster < summaries[j].Cluster })
+	return summaries, nil
+}
+
+// record replaces the report of its cluster
+func (m *Manager) record(report *Report) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reports, err := m.load()
+	if err != nil {
+		return err
+	}
+	reports[report.Cluster] = report
+	return utils.WriteJSONFile(m.filePath, reports)
+}
+
+// load reads the stored reports, the caller must hold the mutex
+func (m *Manager) load() (map[string]*Report, error) {
+	reports := map[string]*Report{}
+	if err := utils.ReadJSONFile(m.filePath, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// finish totals the controls and scores the report
+func (r *Report) finish() {
+	r.Totals = Totals{}
+	for _, control := range r.Controls {
+		switch control.Status {
+		case StatusPass:
+			r.Totals.Pass++
+		case StatusFail:
+			r.Totals.Fail++
+		case StatusWarn:
+			r.Totals.Warn++
+		default:
+			r.Totals.Info++
+		}
+	}
+	r.Score = 100
+	if decided := r.Totals.Pass + r.Totals.Fail; decided > 0 {
+		r.Score = math.Round(float64(r.Totals.Pass)*1000/float64(decided)) / 10
+	}
+	r.FinishedAt = time.Now()
+}
+
+// capFindings keeps the first maxFindings findings and counts the rest
+func capFindings(findings []string) []string {
+	if len(findings) <= maxFindings {
+		return findings
+	}
+	return append(findings[:maxFindings:maxFindings], fmt.Sprintf("and %d more", len(findings)-maxFindings))
+}
+
+// RunProcessor runs the benchmarks queued by the manager
+type RunProcessor struct {
+	manager *Manager
+}
+
+// NewRunProcessor creates a new benchmark run processor
+func NewRunProcessor(manager *Manager) *RunProcessor {
+	return &RunProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation checks the cluster of the operation and records its report
+func (p *RunProcessor) ProcessOperation(op *utils.Operation) error {
+	source, _ := op.Data["source"].(string)
+	nodeName, _ := op.Data["nodeName"].(string)
+	image, _ := op.Data["image"].(string)
+
+	clientset, err := p.manager.getKubernetesClient(op.Target)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+
+	report := &Report{Cluster: op.Target, Source: source, OperationID: op.ID, StartedAt: time.Now()}
+	switch source {
+	case SourceKubeBench:
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Running kube-bench", nil)
+		report.Benchmark, report.Controls, err = runKubeBench(ctx, clientset, nodeName, image)
+		if err != nil {
+			return utils.NonRetryable(err)
+		}
+	default:
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Inspecting cluster objects", nil)
+		report.Benchmark = apiBenchmark
+		report.Controls, report.Errors = inspect(ctx, clientset)
+	}
+	report.finish()
+
+	if err := p.manager.record(report); err != nil {
+		return err
+	}
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster": op.Target,
+		"source":  source,
+		"score":   fmt.Sprintf("%.1f", report.Score),
+	}, nil, "Recorded compliance report")
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 100,
+		fmt.Sprintf("%d passed, %d failed, %d warnings, score %.1f", report.Totals.Pass, report.Totals.Fail, report.Totals.Warn, report.Score), nil)
+	return nil
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *RunProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationRun
+}
+
+// getKubernetesClient creates a kubernetes client for the given cluster
+func (m *Manager) getKubernetesClient(clusterName string) (*kubernetes.Clientset, error) {
+	ctx, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+
+	restConfig, err := ctx.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create REST config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	return clientset, nil
+}
@@ -0,0 +1,242 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	defaultKubeBenchImage = "docker.io/aquasec/kube-bench:v0.10.1"
+	kubeBenchNamespace    = metav1.NamespaceSystem
+	kubeBenchPollInterval = 5 * time.Second
+	// kubeBenchTTL removes the Job should the deferred delete fail
+	kubeBenchTTL = int32(600)
+)
+
+// kubeBenchMounts are the host paths kube-bench reads the configuration of the node components from
+var kubeBenchMounts = []struct{ name, hostPath, mountPath string }{
+	{"var-lib-etcd", "/var/lib/etcd", "/var/lib/etcd"},
+	{"var-lib-kubelet", "/var/lib/kubelet", "/var/lib/kubelet"},
+	{"var-lib-kube-scheduler", "/var/lib/kube-scheduler", "/var/lib/kube-scheduler"},
+	{"var-lib-kube-controller-manager", "/var/lib/kube-controller-manager", "/var/lib/kube-controller-manager"},
+	{"etc-systemd", "/etc/systemd", "/etc/systemd"},
+	{"lib-systemd", "/lib/systemd", "/lib/systemd"},
+	{"srv-kubernetes", "/srv/kubernetes", "/srv/kubernetes"},
+	{"etc-kubernetes", "/etc/kubernetes", "/etc/kubernetes"},
+	{"usr-bin", "/usr/bin", "/usr/local/mount-from-host/bin"},
+	{"etc-cni-netd", "/etc/cni/net.d", "/etc/cni/net.d"},
+	{"opt-cni-bin", "/opt/cni/bin", "/opt/cni/bin"},
+}
+
+// runKubeBench runs kube-bench as a Job, on nodeName if given, and parses the controls it reports
+func runKubeBench(ctx context.Context, clientset kubernetes.Interface, nodeName, image string) (string, []Control, error) {
+	if image == "" {
+		image = defaultKubeBenchImage
+	}
+
+	job, err := clientset.BatchV1().Jobs(kubeBenchNamespace).Create(ctx, kubeBenchJob(nodeName, image), metav1.CreateOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create kube-bench job: %w", err)
+	}
+	defer func() {
+		// The context may have expired, deleting gets its own
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		propagation := metav1.DeletePropagationBackground
+		clientset.BatchV1().Jobs(kubeBenchNamespace).Delete(deleteCtx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	}()
+
+	if err := waitForJob(ctx, clientset, job.Name); err != nil {
+		return "", nil, err
+	}
+
+	pods, err := clientset.CoreV1().Pods(kubeBenchNamespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list kube-bench pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", nil, errors.New("kube-bench pod not found")
+	}
+	pod := pods.Items[0]
+	logs, err := clientset.CoreV1().Pods(kubeBenchNamespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read kube-bench output: %w", err)
+	}
+
+	benchmark, controls, err := parseKubeBench(logs)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range controls {
+		controls[i].Node = pod.Spec.NodeName
+	}
+	return benchmark, controls, nil
+}
+
+// kubeBenchJob returns the Job running kube-bench with the host paths it inspects
+func kubeBenchJob(nodeName, image string) *batchv1.Job {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, m := range kubeBenchMounts {
+		volumes = append(volumes, corev1.Volume{
+			Name:         m.name,
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: m.hostPath}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: m.name, MountPath: m.mountPath, ReadOnly: true})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kube-bench-",
+			Labels:       map[string]string{"app.kubernetes.io/name": "kube-bench", "app.kubernetes.io/managed-by": "agentkube"},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To(int32(0)),
+			TTLSecondsAfterFinished: ptr.To(kubeBenchTTL),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app.kubernetes.io/name": "kube-bench"}},
+				Spec: corev1.PodSpec{
+					HostPID:       true,
+					NodeName:      nodeName,
+					RestartPolicy: corev1.RestartPolicyNever,
+					// Control plane nodes are usually tainted
+					Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers: []corev1.Container{{
+						Name:         "kube-bench",
+						Image:        image,
+						Command:      []string{"kube-bench", "run", "--json"},
+						VolumeMounts: mounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// waitForJob polls a Job until it succeeds, fails or the context ends
+func waitForJob(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	ticker := time.NewTicker(kubeBenchPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := clientset.BatchV1().Jobs(kubeBenchNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get kube-bench job: %w", err)
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return nil
+			case batchv1.JobFailed:
+				return fmt.Errorf("kube-bench job failed: %s", condition.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("kube-bench job did not finish: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// kubeBenchOutput is the JSON kube-bench writes with --json
+type kubeBenchOutput struct {
+	Controls []kubeBenchControls `json:"Controls"`
+}
+
+type kubeBenchControls struct {
+	Version  string `json:"version"`
+	NodeType string `json:"node_type"`
+	Text     string `json:"text"`
+	Tests    []struct {
+		Section string `json:"section"`
+		Desc    string `json:"desc"`
+		Results []struct {
+			TestNumber  string `json:"test_number"`
+			TestDesc    string `json:"test_desc"`
+			Status      string `json:"status"`
+			Scored      bool   `json:"scored"`
+			Remediation string `json:"remediation"`
+			Reason      string `json:"reason"`
+		} `json:"results"`
+	} `json:"tests"`
+}
+
+// parseKubeBench reads the controls of kube-bench JSON output, skipping the log lines before it.
+// Older releases print the controls of every node type as an array, newer ones wrap them with totals.
+func parseKubeBench(output []byte) (string, []Control, error) {
+	var groups []kubeBenchControls
+	parsed := false
+	var parseErr error
+	for start := bytes.IndexAny(output, "{["); start >= 0 && !parsed; {
+		output = output[start:]
+		if output[0] == '[' {
+			parseErr = json.Unmarshal(output, &groups)
+		} else {
+			var wrapped kubeBenchOutput
+			if parseErr = json.Unmarshal(output, &wrapped); parseErr == nil {
+				groups = wrapped.Controls
+			}
+		}
+		parsed = parseErr == nil
+		// Log lines such as "[INFO] ..." start like JSON, try the next candidate
+		if next := bytes.IndexAny(output[1:], "{["); next >= 0 {
+			start = next + 1
+		} else {
+			start = -1
+		}
+	}
+	if !parsed {
+		if parseErr == nil {
+			return "", nil, errors.New("kube-bench output holds no JSON")
+		}
+		return "", nil, fmt.Errorf("failed to parse kube-bench output: %w", parseErr)
+	}
+
+	var benchmark string
+	var controls []Control
+	for _, group := range groups {
+		if benchmark == "" && group.Version != "" {
+			benchmark = "CIS Kubernetes Benchmark " + group.Version
+		}
+		for _, test := range group.Tests {
+			section := strings.TrimSpace(test.Section + " " + test.Desc)
+			for _, result := range test.Results {
+				control := Control{
+					ID:          result.TestNumber,
+					Section:     section,
+					Title:       result.TestDesc,
+					Status:      strings.ToUpper(result.Status),
+					Scored:      result.Scored,
+					Remediation: strings.TrimSpace(result.Remediation),
+				}
+				if result.Reason != "" {
+					control.Findings = []string{strings.TrimSpace(result.Reason)}
+				}
+				controls = append(controls, control)
+			}
+		}
+	}
+	if len(controls) == 0 {
+		return "", nil, errors.New("kube-bench reported no controls, check the node type it detected")
+	}
+	if benchmark == "" {
+		benchmark = "CIS Kubernetes Benchmark"
+	}
+	return benchmark, controls, nil
+}
@@ -0,0 +1,79 @@
+package compliance
+
+import (
+	"testing"
+)
+
+const kubeBenchSample = `[INFO] 1 Control Plane Security Configuration
+{"Controls":[{"id":"1","version":"cis-1.8","detected_version":"1.28","text":"Control Plane Security Configuration","node_type":"master",
+"tests":[{"section":"1.2","desc":"API Server","results":[
+{"test_number":"1.2.1","test_desc":"Ensure that the --anonymous-auth argument is set to false","status":"PASS","scored":false,"remediation":"Edit the API server pod specification file."},
+{"test_number":"1.2.16","test_desc":"Ensure that the --profiling argument is set to false","status":"FAIL","scored":true,"remediation":"Set --profiling=false.","reason":"--profiling is not set"},
+{"test_number":"1.2.20","test_desc":"Ensure that the --audit-log-maxage argument is set to 30","status":"WARN","scored":true,"remediation":"Set --audit-log-maxage=30."}]}]}],
+"Totals":{"total_pass":1,"total_fail":1,"total_warn":1,"total_info":0}}`
+
+func TestParseKubeBench(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"wrapped", kubeBenchSample},
+		{"array", `[{"version":"cis-1.8","tests":[{"section":"4.2","desc":"Kubelet","results":[{"test_number":"4.2.1","status":"pass","scored":true}]}]}]`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			benchmark, controls, err := parseKubeBench([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseKubeBench() error = %v", err)
+			}
+			if benchmark != "CIS Kubernetes Benchmark cis-1.8" {
+				t.Errorf("benchmark = %q", benchmark)
+			}
+			if len(controls) == 0 || controls[0].Status != StatusPass {
+				t.Errorf("controls = %+v, want the first one passing", controls)
+			}
+		})
+	}
+
+	_, controls, _ := parseKubeBench([]byte(kubeBenchSample))
+	failed := controls[1]
+	if failed.ID != "1.2.16" || failed.Section != "1.2 API Server" || !failed.Scored ||
+		failed.Remediation != "Set --profiling=false." || len(failed.Findings) != 1 {
+		t.Errorf("failed control = %+v", failed)
+	}
+
+	for _, output := range []string{"kube-bench: no such node type", `{"Controls":[]}`} {
+		if _, _, err := parseKubeBench([]byte(output)); err == nil {
+			t.Errorf("parseKubeBench(%q) succeeded, want an error", output)
+		}
+	}
+}
+
+func TestReportFinish(t *testing.T) {
+	t.Parallel()
+
+	report := &Report{Controls: []Control{
+		{Status: StatusPass}, {Status: StatusPass}, {Status: StatusFail}, {Status: StatusWarn}, {Status: StatusInfo},
+	}}
+	report.finish()
+	if report.Totals != (Totals{Pass: 2, Fail: 1, Warn: 1, Info: 1}) {
+		t.Errorf("totals = %+v", report.Totals)
+	}
+	if report.Score != 66.7 {
+		t.Errorf("score = %v, want 66.7", report.Score)
+	}
+	if report.FinishedAt.IsZero() {
+		t.Error("finish() did not set FinishedAt")
+	}
+
+	empty := &Report{}
+	empty.finish()
+	if empty.Score != 100 {
+		t.Errorf("score without decided controls = %v, want 100", empty.Score)
+	}
+}
@@ -26,6 +26,7 @@ type Config struct {
 	DevMode               bool   `koanf:"dev"`
 	InsecureSsl           bool   `koanf:"insecure-ssl"`
 	EnableDynamicClusters bool   `koanf:"enable-dynamic-clusters"`
+	Demo                  bool   `koanf:"demo"`
 	ListenAddr            string `koanf:"listen-addr"`
 	Port                  uint   `koanf:"port"`
 	KubeConfigPath        string `koanf:"kubeconfig"`
@@ -143,6 +144,7 @@ func flagset() *flag.FlagSet {
 	f.Bool("dev", false, "Allow connections from other origins")
 	f.Bool("insecure-ssl", false, "Accept/Ignore all server SSL certificates")
 	f.Bool("enable-dynamic-clusters", false, "Enable dynamic clusters, which stores stateless clusters in the frontend.")
+	f.Bool("demo", false, "Add a demo cluster served from seeded in-memory resources")
 
 	f.String("kubeconfig", "", "Absolute path to the kubeconfig file")
 	f.String("html-static-dir", "", "Static HTML directory to serve")
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+// onContextEvent starts the watchers of the contexts added after startup and stops those of the
+// contexts removed, e.g. uploaded kubeconfigs and expired ephemeral environments
+func onContextEvent(e kubeconfig.ContextEvent) {
+	switch e.Type {
+	case kubeconfig.ContextAdded:
+		if e.Context == nil || e.Context.Internal {
+			return
+		}
+		startAddedCluster(e.Name)
+	case kubeconfig.ContextRemoved:
+		stopRemovedCluster(e.Name)
+	}
+}
+
+// startAddedCluster starts the watchers of a cluster added to the store, unless they run already
+// or are lazy, in which case its first request starts them
+func startAddedCluster(clusterName string) {
+	globalManager.usageMutex.Lock()
+	defer globalManager.usageMutex.Unlock()
+
+	setup := globalManager.setup
+	if setup == nil || setup.conf.LazyWatchers || globalManager.starting[clusterName] || isStopping() {
+		return
+	}
+	if !shouldWatchCluster(clusterName, setup.conf) || findClusterWatcher(clusterName) != nil {
+		return
+	}
+
+	globalManager.lastUsed[clusterName] = time.Now()
+	globalManager.starting[clusterName] = true
+	go startOnDemand(clusterName, setup)
+}
+
+// stopRemovedCluster stops the watchers of a cluster removed from the store
+func stopRemovedCluster(clusterName string) {
+	globalManager.usageMutex.Lock()
+	defer globalManager.usageMutex.Unlock()
+
+	globalManager.mutex.Lock()
+	var removed *ClusterWatcher
+	kept := globalManager.watchers[:0]
+	for _, w := range globalManager.watchers {
+		if cw, ok := w.(*ClusterWatcher); ok && cw.clusterName == clusterName {
+			removed = cw
+			continue
+		}
+		kept = append(kept, w)
+	}
+	globalManager.watchers = kept
+	globalManager.mutex.Unlock()
+
+	delete(globalManager.lastUsed, clusterName)
+	if removed != nil {
+		removed.Stop()
+		logrus.Infof("Stopped watchers for cluster %s, its context was removed", clusterName)
+	}
+}
@@ -2,22 +2,25 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os"
-	"os/signal"
 	"reflect"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	config "github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/budget"
 	"github.com/agentkube/operator/pkg/dispatchers"
 	event "github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/index"
 	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/redact"
+	"github.com/agentkube/operator/pkg/severity"
 	utils "github.com/agentkube/operator/pkg/utils"
 	"github.com/sirupsen/logrus"
 
@@ -35,6 +38,8 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
@@ -43,6 +48,12 @@ import (
 )
 
 const maxRetries = 5
+
+// goroutinesPerController are the reflector, event processor and worker of a watcher controller
+const goroutinesPerController = 3
+
+// sizeSampleCount is how many cached objects are encoded to estimate the memory of a watcher
+const sizeSampleCount = 20
 const V1 = "v1"
 const AUTOSCALING_V1 = "autoscaling/v1"
 const APPS_V1 = "apps/v1"
@@ -59,6 +70,18 @@ var serverStartTime time.Time
 // Global manager for shutdown coordination
 var globalManager *WatcherManager
 
+// Listeners notified of every watcher event in addition to the configured dispatcher
+var (
+	eventListeners      []func(event.Event)
+	eventListenersMutex sync.RWMutex
+)
+
+// Severity rules from the watcher config, nil when none are configured
+var (
+	severityRules      *severity.Rules
+	severityRulesMutex sync.RWMutex
+)
+
 // Event indicate the informerEvent
 type Event struct {
 	key          string
@@ -76,6 +99,7 @@ type Controller struct {
 	clientset    kubernetes.Interface
 	queue        workqueue.RateLimitingInterface
 	informer     cache.SharedIndexInformer
+	resourceType string
 	eventHandler dispatchers.Dispatcher
 	clusterName  string
 	stopCh       chan struct{}
@@ -89,6 +113,14 @@ type WatcherManager struct {
 	mutex    sync.RWMutex
 	stopCh   chan struct{}
 	done     chan struct{}
+
+	// usageMutex guards the fields below, it is taken before mutex when both are held
+	usageMutex sync.Mutex
+	// lastUsed is when each cluster was last requested, for idle reaping
+	lastUsed map[string]time.Time
+	// starting holds the clusters whose watchers are being started on demand
+	starting map[string]bool
+	setup    *watcherSetup
 }
 
 // ShutdownHandler interface for graceful shutdown
@@ -100,6 +132,8 @@ type ShutdownHandler interface {
 // ClusterWatcher manages all controllers for a single cluster
 type ClusterWatcher struct {
 	clusterName string
+	namespace   string
+	// controllers change as discovered CRDs come and go, read them through currentControllers
 	controllers []*Controller
 	stopCh      chan struct{}
 	mutex       sync.RWMutex
@@ -116,6 +150,8 @@ func init() {
 		watchers: make([]ShutdownHandler, 0),
 		stopCh:   make(chan struct{}),
 		done:     make(chan struct{}),
+		lastUsed: make(map[string]time.Time),
+		starting: make(map[string]bool),
 	}
 }
 
@@ -137,6 +173,8 @@ func Start(conf *config.Config, eventHandler dispatchers.Dispatcher, contextStor
 
 	serverStartTime = time.Now().Local()
 
+	loadSeverityRules(conf)
+
 	// Get all available contexts from the store
 	contexts, err := contextStore.GetContexts()
 	if err != nil {
@@ -146,7 +184,14 @@ func Start(conf *config.Config, eventHandler dispatchers.Dispatcher, contextStor
 
 	logrus.Infof("Found %d clusters, filtering based on configuration", len(contexts))
 
+	if conf.LazyWatchers {
+		// Touch starts the watchers of each cluster on its first request
+		contexts = nil
+		logrus.Info("Watchers start on the first request for each cluster")
+	}
+
 	// Start watchers for each cluster context
+	var started []string
 	globalManager.mutex.Lock()
 	watchedCount := 0
 	for _, ctx := range contexts {
@@ -163,26 +208,78 @@ func Start(conf *config.Config, eventHandler dispatchers.Dispatcher, contextStor
 		watcher := startClusterWatcher(ctx, conf, eventHandler, kubewatchEventsMetrics)
 		if watcher != nil {
 			globalManager.watchers = append(globalManager.watchers, watcher)
+			started = append(started, ctx.Name)
 			watchedCount++
 		}
 	}
 	globalManager.mutex.Unlock()
 
+	// Keep the setup for the watchers started on demand, clusters started now count as just used
+	globalManager.usageMutex.Lock()
+	for _, name := range started {
+		globalManager.lastUsed[name] = time.Now()
+	}
+	globalManager.setup = &watcherSetup{conf: conf, eventHandler: eventHandler, metrics: kubewatchEventsMetrics, contextStore: contextStore}
+	globalManager.usageMutex.Unlock()
+	if conf.IdleMinutes > 0 {
+		go runReaper(time.Duration(conf.IdleMinutes) * time.Minute)
+	}
+	go WatchConfig()
+	// Contexts added or removed from now on get their watchers started or stopped
+	contextStore.Subscribe(onContextEvent)
+
 	logrus.Infof("Started watchers for %d clusters (filtered from %d total)", watchedCount, len(contexts))
 
-	// Handle graceful shutdown
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGTERM)
-	signal.Notify(sigterm, syscall.SIGINT)
+	budget.RegisterSource("watchers", footprint)
 
-	select {
-	case <-sigterm:
-		logrus.Info("Received shutdown signal, gracefully shutting down watcher controllers...")
-		gracefulShutdown()
-	case <-globalManager.stopCh:
-		logrus.Info("Received internal stop signal, shutting down watcher controllers...")
-		gracefulShutdown()
+	// The server stops the watchers with Stop once the queued events are delivered
+	<-globalManager.stopCh
+	logrus.Info("Received stop signal, shutting down watcher controllers...")
+	gracefulShutdown()
+}
+
+// footprint reports the cached objects of the watchers of each cluster, with their memory estimated
+// from the encoded size of a sample of them
+func footprint() map[string]budget.Gauge {
+	globalManager.mutex.RLock()
+	defer globalManager.mutex.RUnlock()
+
+	gauges := map[string]budget.Gauge{}
+	for _, w := range globalManager.watchers {
+		cw, ok := w.(*ClusterWatcher)
+		if !ok {
+			continue
+		}
+		gauge := gauges[cw.clusterName]
+		for _, c := range cw.currentControllers() {
+			objects := c.informer.GetStore().List()
+			gauge.Objects += len(objects)
+			gauge.MemoryBytes += int64(len(objects)) * averageSize(objects)
+			gauge.Goroutines += goroutinesPerController
+		}
+		gauges[cw.clusterName] = gauge
+	}
+	return gauges
+}
+
+// averageSize returns the average encoded size of the first objects of a cache
+func averageSize(objects []interface{}) int64 {
+	sampled, total := 0, 0
+	for _, obj := range objects {
+		if sampled == sizeSampleCount {
+			break
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			continue
+		}
+		sampled++
+		total += len(data)
+	}
+	if sampled == 0 {
+		return 0
 	}
+	return int64(total / sampled)
 }
 
 // gracefulShutdown performs coordinated shutdown of all watchers
@@ -265,20 +362,45 @@ func startClusterWatcher(ctx *kubeconfig.Context, conf *config.Config, eventHand
 		return nil
 	}
 
+	// Create metadata client for resources watched metadata-only
+	metadataClient, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		logrus.Errorf("Failed to create metadata client for cluster %s: %v", ctx.Name, err)
+		return nil
+	}
+
 	// Create cluster watcher
 	clusterWatcher := &ClusterWatcher{
 		clusterName: ctx.Name,
+		namespace:   conf.Namespace,
 		stopCh:      make(chan struct{}),
 		stopped:     false,
 	}
 
 	// Start resource watchers for this cluster
-	controllers := startResourceWatchers(ctx.Name, kubeClient, dynamicClient, conf, eventHandler, kubewatchEventsMetrics, clusterWatcher.stopCh)
+	controllers := startResourceWatchers(ctx.Name, kubeClient, dynamicClient, metadataClient, conf, eventHandler, kubewatchEventsMetrics, clusterWatcher.stopCh)
 	clusterWatcher.controllers = controllers
 
+	// Watch the custom resources of the CRDs the cluster serves
+	if conf.CRDDiscovery.Enabled {
+		apiextClient, err := apiextclientset.NewForConfig(restConfig)
+		if err != nil {
+			logrus.Errorf("Failed to create apiextensions client for cluster %s, CRDs are not discovered: %v", ctx.Name, err)
+		} else {
+			startCRDDiscovery(clusterWatcher, apiextClient, kubeClient, dynamicClient, conf, eventHandler, kubewatchEventsMetrics)
+		}
+	}
+
 	return clusterWatcher
 }
 
+// currentControllers returns the controllers of the cluster at this time
+func (cw *ClusterWatcher) currentControllers() []*Controller {
+	cw.mutex.RLock()
+	defer cw.mutex.RUnlock()
+	return append([]*Controller(nil), cw.controllers...)
+}
+
 // Stop gracefully stops all controllers for this cluster
 func (cw *ClusterWatcher) Stop() {
 	cw.mutex.Lock()
@@ -291,18 +413,20 @@ func (cw *ClusterWatcher) Stop() {
 	logrus.Infof("Stopping watchers for cluster: %s", cw.clusterName)
 	cw.stopped = true
 	close(cw.stopCh)
+	index.Drop(cw.clusterName)
 }
 
 // WaitForShutdown waits for all controllers to shutdown within the timeout
 func (cw *ClusterWatcher) WaitForShutdown(timeout time.Duration) bool {
-	if len(cw.controllers) == 0 {
+	controllers := cw.currentControllers()
+	if len(controllers) == 0 {
 		return true
 	}
 
 	done := make(chan struct{})
 	go func() {
 		var wg sync.WaitGroup
-		for _, controller := range cw.controllers {
+		for _, controller := range controllers {
 			wg.Add(1)
 			go func(c *Controller) {
 				defer wg.Done()
@@ -321,7 +445,7 @@ func (cw *ClusterWatcher) WaitForShutdown(timeout time.Duration) bool {
 	}
 }
 
-func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, conf *config.Config, eventHandler dispatchers.Dispatcher, kubewatchEventsMetrics *prometheus.CounterVec, stopCh chan struct{}) []*Controller {
+func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, metadataClient metadata.Interface, conf *config.Config, eventHandler dispatchers.Dispatcher, kubewatchEventsMetrics *prometheus.CounterVec, stopCh chan struct{}) []*Controller {
 	var controllers []*Controller
 
 	// Core Events
@@ -372,19 +496,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 
 	// Pods
 	if conf.Resource.Pod {
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-					return kubeClient.CoreV1().Pods(conf.Namespace).List(context.Background(), options)
+		var informer cache.SharedIndexInformer
+		if conf.WatchesMetadataOnly("pod") {
+			informer = newMetadataInformer(metadataClient, api_v1.SchemeGroupVersion.WithResource("pods"), conf.Namespace)
+		} else {
+			informer = cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+						return kubeClient.CoreV1().Pods(conf.Namespace).List(context.Background(), options)
+					},
+					WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+						return kubeClient.CoreV1().Pods(conf.Namespace).Watch(context.Background(), options)
+					},
 				},
-				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-					return kubeClient.CoreV1().Pods(conf.Namespace).Watch(context.Background(), options)
-				},
-			},
-			&api_v1.Pod{},
-			0,
-			cache.Indexers{},
-		)
+				&api_v1.Pod{},
+				0,
+				cache.Indexers{},
+			)
+		}
 
 		controller := newResourceController(clusterName, kubeClient, eventHandler, informer, objName(api_v1.Pod{}), V1, kubewatchEventsMetrics, stopCh)
 		controllers = append(controllers, controller)
@@ -456,19 +585,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 
 	// ReplicaSets
 	if conf.Resource.ReplicaSet {
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-					return kubeClient.AppsV1().ReplicaSets(conf.Namespace).List(context.Background(), options)
+		var informer cache.SharedIndexInformer
+		if conf.WatchesMetadataOnly("replicaset") {
+			informer = newMetadataInformer(metadataClient, apps_v1.SchemeGroupVersion.WithResource("replicasets"), conf.Namespace)
+		} else {
+			informer = cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+						return kubeClient.AppsV1().ReplicaSets(conf.Namespace).List(context.Background(), options)
+					},
+					WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+						return kubeClient.AppsV1().ReplicaSets(conf.Namespace).Watch(context.Background(), options)
+					},
 				},
-				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-					return kubeClient.AppsV1().ReplicaSets(conf.Namespace).Watch(context.Background(), options)
-				},
-			},
-			&apps_v1.ReplicaSet{},
-			0,
-			cache.Indexers{},
-		)
+				&apps_v1.ReplicaSet{},
+				0,
+				cache.Indexers{},
+			)
+		}
 
 		controller := newResourceController(clusterName, kubeClient, eventHandler, informer, objName(apps_v1.ReplicaSet{}), APPS_V1, kubewatchEventsMetrics, stopCh)
 		controllers = append(controllers, controller)
@@ -561,19 +695,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 
 	// Jobs
 	if conf.Resource.Job {
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-					return kubeClient.BatchV1().Jobs(conf.Namespace).List(context.Background(), options)
-				},
-				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-					return kubeClient.BatchV1().Jobs(conf.Namespace).Watch(context.Background(), options)
+		var informer cache.SharedIndexInformer
+		if conf.WatchesMetadataOnly("job") {
+			informer = newMetadataInformer(metadataClient, batch_v1.SchemeGroupVersion.WithResource("jobs"), conf.Namespace)
+		} else {
+			informer = cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+						return kubeClient.BatchV1().Jobs(conf.Namespace).List(context.Background(), options)
+					},
+					WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+						return kubeClient.BatchV1().Jobs(conf.Namespace).Watch(context.Background(), options)
+					},
 				},
-			},
-			&batch_v1.Job{},
-			0,
-			cache.Indexers{},
-		)
+				&batch_v1.Job{},
+				0,
+				cache.Indexers{},
+			)
+		}
 
 		controller := newResourceController(clusterName, kubeClient, eventHandler, informer, objName(batch_v1.Job{}), BATCH_V1, kubewatchEventsMetrics, stopCh)
 		controllers = append(controllers, controller)
@@ -687,19 +826,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 
 	// Secrets
 	if conf.Resource.Secret {
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-					return kubeClient.CoreV1().Secrets(conf.Namespace).List(context.Background(), options)
-				},
-				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-					return kubeClient.CoreV1().Secrets(conf.Namespace).Watch(context.Background(), options)
+		var informer cache.SharedIndexInformer
+		if conf.WatchesMetadataOnly("secret") {
+			informer = newMetadataInformer(metadataClient, api_v1.SchemeGroupVersion.WithResource("secrets"), conf.Namespace)
+		} else {
+			informer = cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+						return kubeClient.CoreV1().Secrets(conf.Namespace).List(context.Background(), options)
+					},
+					WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+						return kubeClient.CoreV1().Secrets(conf.Namespace).Watch(context.Background(), options)
+					},
 				},
-			},
-			&api_v1.Secret{},
-			0,
-			cache.Indexers{},
-		)
+				&api_v1.Secret{},
+				0,
+				cache.Indexers{},
+			)
+		}
 
 		controller := newResourceController(clusterName, kubeClient, eventHandler, informer, objName(api_v1.Secret{}), V1, kubewatchEventsMetrics, stopCh)
 		controllers = append(controllers, controller)
@@ -708,19 +852,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 
 	// ConfigMaps
 	if conf.Resource.ConfigMap {
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
-					return kubeClient.CoreV1().ConfigMaps(conf.Namespace).List(context.Background(), options)
-				},
-				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
-					return kubeClient.CoreV1().ConfigMaps(conf.Namespace).Watch(context.Background(), options)
+		var informer cache.SharedIndexInformer
+		if conf.WatchesMetadataOnly("configmap") {
+			informer = newMetadataInformer(metadataClient, api_v1.SchemeGroupVersion.WithResource("configmaps"), conf.Namespace)
+		} else {
+			informer = cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+						return kubeClient.CoreV1().ConfigMaps(conf.Namespace).List(context.Background(), options)
+					},
+					WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+						return kubeClient.CoreV1().ConfigMaps(conf.Namespace).Watch(context.Background(), options)
+					},
 				},
-			},
-			&api_v1.ConfigMap{},
-			0,
-			cache.Indexers{},
-		)
+				&api_v1.ConfigMap{},
+				0,
+				cache.Indexers{},
+			)
+		}
 
 		controller := newResourceController(clusterName, kubeClient, eventHandler, informer, objName(api_v1.ConfigMap{}), V1, kubewatchEventsMetrics, stopCh)
 		controllers = append(controllers, controller)
@@ -781,6 +930,24 @@ func startResourceWatchers(clusterName string, kubeClient kubernetes.Interface,
 	return controllers
 }
 
+// newMetadataInformer returns an informer keeping only the metadata of a resource, as
+// PartialObjectMetadata without managed fields, for resources watched metadata-only
+func newMetadataInformer(client metadata.Interface, gvr schema.GroupVersionResource, namespace string) cache.SharedIndexInformer {
+	informer := metadatainformer.NewFilteredMetadataInformer(client, gvr, namespace, 0, cache.Indexers{}, nil).Informer()
+	if err := informer.SetTransform(stripManagedFields); err != nil {
+		logrus.Warnf("Failed to set transform on metadata informer for %s: %v", gvr.Resource, err)
+	}
+	return informer
+}
+
+// stripManagedFields drops the managed fields of cached objects, often the largest part of their metadata
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, ok := obj.(meta_v1.Object); ok {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
 func newResourceController(clusterName string, client kubernetes.Interface, eventHandler dispatchers.Dispatcher, informer cache.SharedIndexInformer, resourceType string, apiVersion string, kubewatchEventsMetrics *prometheus.CounterVec, stopCh chan struct{}) *Controller {
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
 	var newEvent Event
@@ -847,10 +1014,16 @@ func newResourceController(clusterName string, client kubernetes.Interface, even
 		},
 	})
 
+	// Keep the owner reference index of the cluster current, graphs read children from it
+	if gvr, ok := indexedResource(resourceType, apiVersion); ok {
+		index.ForCluster(clusterName).Track(gvr, informer)
+	}
+
 	return &Controller{
 		logger:       logrus.WithField("pkg", "watcher-"+resourceType).WithField("cluster", clusterName),
 		clientset:    client,
 		informer:     informer,
+		resourceType: resourceType,
 		queue:        queue,
 		eventHandler: eventHandler,
 		clusterName:  clusterName,
@@ -947,6 +1120,12 @@ func (c *Controller) processNextItem(ctx context.Context) bool {
 	}
 	defer c.queue.Done(newEvent)
 
+	// Events of clusters over their resource budget are dropped until the cluster is resumed
+	if budget.Paused(c.clusterName) {
+		c.queue.Forget(newEvent)
+		return true
+	}
+
 	err := c.processItem(newEvent.(Event))
 	if err == nil {
 		// No error, reset the ratelimit counters
@@ -1015,13 +1194,10 @@ func (c *Controller) processItem(newEvent Event) error {
 				Component:  c.clusterName,
 				Host:       c.clusterName,
 			}
-			c.eventHandler.Handle(kubeEvent)
+			c.dispatch(kubeEvent)
 			return nil
 		}
 	case "update":
-		/* TODOs
-		- enhance update event processing in such a way that, it send alerts about what got changed.
-		*/
 		switch newEvent.resourceType {
 		case "Backoff":
 			status = "Danger"
@@ -1040,7 +1216,7 @@ func (c *Controller) processItem(newEvent Event) error {
 			Component:  c.clusterName,
 			Host:       c.clusterName,
 		}
-		c.eventHandler.Handle(kubeEvent)
+		c.dispatch(kubeEvent)
 		return nil
 	case "delete":
 		kubeEvent := event.Event{
@@ -1054,12 +1230,63 @@ func (c *Controller) processItem(newEvent Event) error {
 			Component:  c.clusterName,
 			Host:       c.clusterName,
 		}
-		c.eventHandler.Handle(kubeEvent)
+		c.dispatch(kubeEvent)
 		return nil
 	}
 	return nil
 }
 
+// AddEventListener registers a function called with every event the watchers dispatch,
+// e.g. to evaluate policies as resources change
+func AddEventListener(listener func(event.Event)) {
+	eventListenersMutex.Lock()
+	defer eventListenersMutex.Unlock()
+	eventListeners = append(eventListeners, listener)
+}
+
+// loadSeverityRules compiles the severity rules of the config. Invalid rules are ignored, events
+// keep their built-in severities rather than going unwatched.
+func loadSeverityRules(conf *config.Config) {
+	rules, err := severity.Compile(conf.SeverityRules)
+	if err != nil {
+		logrus.Errorf("Ignoring severity rules: %v", err)
+	}
+	SetSeverityRules(rules)
+}
+
+// SetSeverityRules replaces the rules assigning the severity of the events dispatched next
+func SetSeverityRules(rules *severity.Rules) {
+	severityRulesMutex.Lock()
+	defer severityRulesMutex.Unlock()
+	severityRules = rules
+}
+
+// dispatch hands an event to the configured dispatcher and the registered listeners. Events a
+// severity rule suppresses reach the listeners only.
+func (c *Controller) dispatch(kubeEvent event.Event) {
+	severityRulesMutex.RLock()
+	notify := severityRules.Apply(&kubeEvent)
+	severityRulesMutex.RUnlock()
+	if notify {
+		c.notify(kubeEvent)
+	}
+
+	eventListenersMutex.RLock()
+	defer eventListenersMutex.RUnlock()
+	for _, listener := range eventListeners {
+		listener(kubeEvent)
+	}
+}
+
+// notify hands an event to the configured dispatcher
+func (c *Controller) notify(kubeEvent event.Event) {
+	// Events leaving the operator carry no redacted annotations or labels, listeners get the originals
+	outgoing := redact.Event(kubeEvent)
+	// The diff is of the redacted objects, so that it can't reveal redacted values
+	outgoing.Diff = event.NewDiff(outgoing.OldObj, outgoing.Obj)
+	c.eventHandler.Handle(outgoing)
+}
+
 // shouldWatchCluster determines if a cluster should be watched based on config
 func shouldWatchCluster(clusterName string, conf *config.Config) bool {
 	// If include list is specified, only watch clusters in the list
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	config "github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/dispatchers"
+)
+
+// crdDiscovery runs a controller for each custom resource of the CRDs a cluster serves that the
+// discovery patterns select, starting and stopping them as CRDs are installed and removed
+type crdDiscovery struct {
+	cw            *ClusterWatcher
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	conf          *config.Config
+	eventHandler  dispatchers.Dispatcher
+	metrics       *prometheus.CounterVec
+	// discovered holds the running controllers by CRD name, guarded by the mutex of the cluster watcher
+	discovered map[string]*discoveredCRD
+}
+
+type discoveredCRD struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+	controller *Controller
+	// removed stops the controller before its cluster watcher stops
+	removed chan struct{}
+}
+
+// startCRDDiscovery watches the CRDs of a cluster until its watcher stops
+func startCRDDiscovery(cw *ClusterWatcher, client apiextclientset.Interface, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, conf *config.Config, eventHandler dispatchers.Dispatcher, metrics *prometheus.CounterVec) {
+	for _, pattern := range append(append([]string{}, conf.CRDDiscovery.Include...), conf.CRDDiscovery.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			logrus.Warnf("Ignoring invalid CRD discovery pattern %q: %v", pattern, err)
+		}
+	}
+
+	d := &crdDiscovery{
+		cw:            cw,
+		kubeClient:    kubeClient,
+		dynamicClient: dynamicClient,
+		conf:          conf,
+		eventHandler:  eventHandler,
+		metrics:       metrics,
+		discovered:    map[string]*discoveredCRD{},
+	}
+
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+				return client.ApiextensionsV1().CustomResourceDefinitions().List(context.Background(), options)
+			},
+			WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+				return client.ApiextensionsV1().CustomResourceDefinitions().Watch(context.Background(), options)
+			},
+		},
+		&apiextv1.CustomResourceDefinition{},
+		0,
+		cache.Indexers{},
+	)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if crd, ok := obj.(*apiextv1.CustomResourceDefinition); ok {
+				d.sync(crd)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if crd, ok := obj.(*apiextv1.CustomResourceDefinition); ok {
+				d.sync(crd)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if crd, ok := obj.(*apiextv1.CustomResourceDefinition); ok {
+				d.remove(crd.Name)
+			}
+		},
+	})
+	go informer.Run(cw.stopCh)
+}
+
+// sync starts the controller of a CRD the patterns select once it is established, restarts it when
+// the watched version changes and stops it when the CRD is no longer selected or served
+func (d *crdDiscovery) sync(crd *apiextv1.CustomResourceDefinition) {
+	version, ok := watchedVersion(crd)
+	if !ok || !crdEstablished(crd) || !selectsCRD(d.conf.CRDDiscovery, crd.Name) || d.configured(crd) {
+		d.remove(crd.Name)
+		return
+	}
+	gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: version, Resource: crd.Spec.Names.Plural}
+	namespaced := crd.Spec.Scope == apiextv1.NamespaceScoped
+
+	d.cw.mutex.Lock()
+	defer d.cw.mutex.Unlock()
+	if d.cw.stopped {
+		return
+	}
+	if running, ok := d.discovered[crd.Name]; ok {
+		if running.gvr == gvr && running.namespaced == namespaced {
+			return
+		}
+		d.stopLocked(crd.Name, running)
+	}
+
+	namespace := ""
+	if namespaced {
+		namespace = d.conf.Namespace
+	}
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+				return d.dynamicClient.Resource(gvr).Namespace(namespace).List(context.Background(), options)
+			},
+			WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+				return d.dynamicClient.Resource(gvr).Namespace(namespace).Watch(context.Background(), options)
+			},
+		},
+		&unstructured.Unstructured{},
+		0,
+		cache.Indexers{},
+	)
+
+	running := &discoveredCRD{gvr: gvr, namespaced: namespaced, removed: make(chan struct{})}
+	stopCh := make(chan struct{})
+	go func(clusterStop <-chan struct{}) {
+		select {
+		case <-clusterStop:
+		case <-running.removed:
+		}
+		close(stopCh)
+	}(d.cw.stopCh)
+
+	running.controller = newResourceController(d.cw.clusterName, d.kubeClient, d.eventHandler, informer, gvr.Resource, fmt.Sprintf("%s/%s", gvr.Group, gvr.Version), d.metrics, stopCh)
+	d.discovered[crd.Name] = running
+	d.cw.controllers = append(d.cw.controllers, running.controller)
+	go running.controller.Run()
+	logrus.Infof("Watching discovered custom resource %s in cluster %s", gvr.String(), d.cw.clusterName)
+}
+
+// remove stops the controller of a CRD, if one runs
+func (d *crdDiscovery) remove(name string) {
+	d.cw.mutex.Lock()
+	defer d.cw.mutex.Unlock()
+	if running, ok := d.discovered[name]; ok {
+		d.stopLocked(name, running)
+		logrus.Infof("Stopped watching custom resource %s in cluster %s", running.gvr.String(), d.cw.clusterName)
+	}
+}
+
+func (d *crdDiscovery) stopLocked(name string, running *discoveredCRD) {
+	delete(d.discovered, name)
+	close(running.removed)
+	kept := d.cw.controllers[:0]
+	for _, c := range d.cw.controllers {
+		if c != running.controller {
+			kept = append(kept, c)
+		}
+	}
+	d.cw.controllers = kept
+}
+
+// configured reports whether the custom resources of a CRD are already watched through the config
+func (d *crdDiscovery) configured(crd *apiextv1.CustomResourceDefinition) bool {
+	for _, res := range d.conf.CustomResources {
+		if res.Group == crd.Spec.Group && res.Resource == crd.Spec.Names.Plural {
+			return true
+		}
+	}
+	return false
+}
+
+// watchedVersion returns the version a CRD is watched in: its storage version when served, else
+// the first served one
+func watchedVersion(crd *apiextv1.CustomResourceDefinition) (string, bool) {
+	served := ""
+	for _, version := range crd.Spec.Versions {
+		if !version.Served {
+			continue
+		}
+		if version.Storage {
+			return version.Name, true
+		}
+		if served == "" {
+			served = version.Name
+		}
+	}
+	return served, served != ""
+}
+
+// crdEstablished reports whether the API server serves the custom resources of a CRD
+func crdEstablished(crd *apiextv1.CustomResourceDefinition) bool {
+	for _, condition := range crd.Status.Conditions {
+		if condition.Type == apiextv1.Established {
+			return condition.Status == apiextv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// selectsCRD reports whether the discovery patterns select a CRD by its name. Exclude patterns
+// take precedence, and an empty include list selects every CRD.
+func selectsCRD(discovery config.CRDDiscovery, name string) bool {
+	if matchesPattern(discovery.Exclude, name) {
+		return false
+	}
+	return len(discovery.Include) == 0 || matchesPattern(discovery.Include, name)
+}
+
+func matchesPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
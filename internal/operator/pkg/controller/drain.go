@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/agentkube/operator/pkg/shutdown"
+)
+
+// drainPollInterval is how often DrainEvents checks the controller queues
+const drainPollInterval = 100 * time.Millisecond
+
+// DrainEvents waits until the watchers delivered the events queued for the dispatcher, or ctx is done.
+// It returns a report of the events left in each controller queue, the watchers keep running.
+func DrainEvents(ctx context.Context) []shutdown.Abandoned {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		queued := queuedEvents()
+		if len(queued) == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			var abandoned []shutdown.Abandoned
+			for id, count := range queued {
+				abandoned = append(abandoned, shutdown.Abandoned{
+					Component:   "dispatcher",
+					ID:          id,
+					Description: fmt.Sprintf("%d events not delivered", count),
+				})
+			}
+			return abandoned
+		}
+	}
+}
+
+// queuedEvents counts the events waiting in the controller queues, by cluster and resource type
+func queuedEvents() map[string]int {
+	globalManager.mutex.RLock()
+	defer globalManager.mutex.RUnlock()
+
+	queued := map[string]int{}
+	for _, w := range globalManager.watchers {
+		cw, ok := w.(*ClusterWatcher)
+		if !ok {
+			continue
+		}
+		for _, c := range cw.currentControllers() {
+			if n := c.queue.Len(); n > 0 {
+				queued[cw.clusterName+"/"+c.resourceType] += n
+			}
+		}
+	}
+	return queued
+}
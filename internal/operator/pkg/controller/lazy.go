@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	config "github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+// reapInterval is how often the watchers of idle clusters are looked for
+const reapInterval = time.Minute
+
+// watcherSetup is what Start was given, to start the watchers of a cluster on its next request
+// after they were reaped, or on its first one with lazy watchers
+type watcherSetup struct {
+	conf         *config.Config
+	eventHandler dispatchers.Dispatcher
+	metrics      *prometheus.CounterVec
+	contextStore kubeconfig.ContextStore
+}
+
+// Touch records a request for a cluster. When the watchers of the cluster are not running, because
+// they are lazy or were reaped, they are started in the background.
+func Touch(clusterName string) {
+	globalManager.usageMutex.Lock()
+	defer globalManager.usageMutex.Unlock()
+
+	globalManager.lastUsed[clusterName] = time.Now()
+
+	setup := globalManager.setup
+	if setup == nil || globalManager.starting[clusterName] || isStopping() {
+		return
+	}
+	if !shouldWatchCluster(clusterName, setup.conf) || findClusterWatcher(clusterName) != nil {
+		return
+	}
+
+	globalManager.starting[clusterName] = true
+	go startOnDemand(clusterName, setup)
+}
+
+// startOnDemand starts the watchers of a cluster after a request for it or a config reload
+func startOnDemand(clusterName string, setup *watcherSetup) {
+	defer func() {
+		globalManager.usageMutex.Lock()
+		delete(globalManager.starting, clusterName)
+		globalManager.usageMutex.Unlock()
+	}()
+
+	ctx, err := setup.contextStore.GetContext(clusterName)
+	if err != nil || ctx.Internal {
+		return
+	}
+
+	watcher := startClusterWatcher(ctx, setup.conf, setup.eventHandler, setup.metrics)
+	if watcher == nil {
+		return
+	}
+
+	globalManager.mutex.Lock()
+	defer globalManager.mutex.Unlock()
+	if isStopping() {
+		// The server shut down while the watchers started
+		watcher.Stop()
+		return
+	}
+	if _, err := setup.contextStore.GetContext(clusterName); err != nil {
+		// The context was removed while the watchers started
+		watcher.Stop()
+		return
+	}
+	globalManager.watchers = append(globalManager.watchers, watcher)
+	logrus.Infof("Started watchers for cluster %s", clusterName)
+}
+
+// findClusterWatcher returns the running watcher of a cluster, nil when there is none
+func findClusterWatcher(clusterName string) *ClusterWatcher {
+	globalManager.mutex.RLock()
+	defer globalManager.mutex.RUnlock()
+
+	for _, w := range globalManager.watchers {
+		if cw, ok := w.(*ClusterWatcher); ok && cw.clusterName == clusterName {
+			return cw
+		}
+	}
+	return nil
+}
+
+func isStopping() bool {
+	select {
+	case <-globalManager.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// runReaper stops the watchers of idle clusters until the manager stops
+func runReaper(idle time.Duration) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reapIdle(time.Now(), idle)
+		case <-globalManager.stopCh:
+			return
+		}
+	}
+}
+
+// reapIdle stops the watchers of the clusters without requests since now minus idle and drops the
+// proxy of their contexts, releasing its transport. Touch brings them back.
+func reapIdle(now time.Time, idle time.Duration) {
+	globalManager.usageMutex.Lock()
+	defer globalManager.usageMutex.Unlock()
+
+	globalManager.mutex.Lock()
+	var reaped []*ClusterWatcher
+	kept := globalManager.watchers[:0]
+	for _, w := range globalManager.watchers {
+		cw, ok := w.(*ClusterWatcher)
+		if ok && now.Sub(globalManager.lastUsed[cw.clusterName]) > idle {
+			reaped = append(reaped, cw)
+			continue
+		}
+		kept = append(kept, w)
+	}
+	globalManager.watchers = kept
+	globalManager.mutex.Unlock()
+
+	for _, cw := range reaped {
+		cw.Stop()
+		delete(globalManager.lastUsed, cw.clusterName)
+		if setup := globalManager.setup; setup != nil {
+			if ctx, err := setup.contextStore.GetContext(cw.clusterName); err == nil {
+				ctx.ResetProxy()
+			}
+		}
+		logrus.Infof("Stopped watchers for cluster %s, idle for more than %s", cw.clusterName, idle)
+	}
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"unicode"
+
+	"github.com/agentkube/operator/pkg/index"
+	apps_v1 "k8s.io/api/apps/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// listedResources maps the resources served from the watcher caches to the resource types of
+// the watchers caching them
+var listedResources = map[schema.GroupVersionResource]string{
+	api_v1.SchemeGroupVersion.WithResource("pods"):            objName(api_v1.Pod{}),
+	api_v1.SchemeGroupVersion.WithResource("services"):        objName(api_v1.Service{}),
+	api_v1.SchemeGroupVersion.WithResource("serviceaccounts"): objName(api_v1.ServiceAccount{}),
+	api_v1.SchemeGroupVersion.WithResource("configmaps"):      objName(api_v1.ConfigMap{}),
+	api_v1.SchemeGroupVersion.WithResource("secrets"):         objName(api_v1.Secret{}),
+	apps_v1.SchemeGroupVersion.WithResource("deployments"):    objName(apps_v1.Deployment{}),
+	apps_v1.SchemeGroupVersion.WithResource("replicasets"):    objName(apps_v1.ReplicaSet{}),
+	apps_v1.SchemeGroupVersion.WithResource("statefulsets"):   objName(apps_v1.StatefulSet{}),
+	apps_v1.SchemeGroupVersion.WithResource("daemonsets"):     objName(apps_v1.DaemonSet{}),
+	batch_v1.SchemeGroupVersion.WithResource("jobs"):          objName(batch_v1.Job{}),
+}
+
+// InformerLister lists objects from the informers of the watchers of a cluster, so that graph
+// generation reads local caches instead of listing the API server
+type InformerLister struct {
+	clusterName string
+}
+
+// NewInformerLister creates a lister over the watchers of a cluster. It answers nothing while the
+// cluster isn't watched, leaving callers to list the API themselves.
+func NewInformerLister(clusterName string) *InformerLister {
+	return &InformerLister{clusterName: clusterName}
+}
+
+// ListMetadata returns the cached objects of a resource in a namespace, once its watcher has
+// synced. The objects are shared with the informer and must not be modified.
+func (l *InformerLister) ListMetadata(gvr schema.GroupVersionResource, namespace string) ([]meta_v1.Object, bool) {
+	resourceType, ok := listedResources[gvr]
+	if !ok {
+		return nil, false
+	}
+	c := findController(l.clusterName, namespace, resourceType)
+	if c == nil || !c.informer.HasSynced() {
+		return nil, false
+	}
+
+	objects := []meta_v1.Object{}
+	for _, item := range c.informer.GetStore().List() {
+		object, err := meta.Accessor(item)
+		if err != nil || object.GetNamespace() != namespace {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, true
+}
+
+// Children returns the objects of a resource in the namespace, all namespaces when empty, an owner
+// owns directly, from the owner reference index of the cluster. It answers false until the watcher
+// of the resource and the informers feeding the index have synced.
+func (l *InformerLister) Children(owner types.UID, gvr schema.GroupVersionResource, namespace string) ([]index.Ref, bool) {
+	idx, ok := l.syncedIndex(gvr, namespace)
+	if !ok {
+		return nil, false
+	}
+	return filterRefs(idx.Children(owner), gvr, namespace), true
+}
+
+// Descendants returns the objects of a resource in the namespace an owner owns directly or through
+// other objects, e.g. the pods of a deployment, from the owner reference index of the cluster
+func (l *InformerLister) Descendants(owner types.UID, gvr schema.GroupVersionResource, namespace string) ([]index.Ref, bool) {
+	idx, ok := l.syncedIndex(gvr, namespace)
+	if !ok {
+		return nil, false
+	}
+	return filterRefs(idx.Descendants(owner), gvr, namespace), true
+}
+
+// syncedIndex returns the owner reference index of the cluster when it covers a resource in the namespace
+func (l *InformerLister) syncedIndex(gvr schema.GroupVersionResource, namespace string) (*index.Index, bool) {
+	resourceType, ok := listedResources[gvr]
+	if !ok {
+		// Custom resources are watched under their resource name
+		resourceType = gvr.Resource
+	}
+	c := findController(l.clusterName, namespace, resourceType)
+	if c == nil || !c.informer.HasSynced() {
+		return nil, false
+	}
+	idx, ok := index.Lookup(l.clusterName)
+	if !ok || !idx.Synced() {
+		return nil, false
+	}
+	return idx, true
+}
+
+func filterRefs(refs []index.Ref, gvr schema.GroupVersionResource, namespace string) []index.Ref {
+	filtered := []index.Ref{}
+	for _, ref := range refs {
+		if ref.GroupVersionResource() == gvr && (namespace == "" || ref.Namespace == namespace) {
+			filtered = append(filtered, ref)
+		}
+	}
+	return filtered
+}
+
+// indexedResource returns the resource a watcher indexes owner references of. Core watchers are named
+// after the kind, custom resource watchers after the resource. Events own nothing and aren't indexed.
+func indexedResource(resourceType, apiVersion string) (schema.GroupVersionResource, bool) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil || resourceType == "" || resourceType == objName(api_v1.Event{}) {
+		return schema.GroupVersionResource{}, false
+	}
+	if unicode.IsUpper(rune(resourceType[0])) {
+		plural, _ := meta.UnsafeGuessKindToResource(gv.WithKind(resourceType))
+		return plural, true
+	}
+	return gv.WithResource(resourceType), true
+}
+
+// findController returns the running controller watching a resource type of a cluster in the
+// namespace
+func findController(clusterName, namespace, resourceType string) *Controller {
+	globalManager.mutex.RLock()
+	defer globalManager.mutex.RUnlock()
+
+	for _, w := range globalManager.watchers {
+		cw, ok := w.(*ClusterWatcher)
+		if !ok || cw.clusterName != clusterName {
+			continue
+		}
+		cw.mutex.RLock()
+		stopped := cw.stopped
+		cw.mutex.RUnlock()
+		if stopped || (cw.namespace != "" && cw.namespace != namespace) {
+			return nil
+		}
+		for _, c := range cw.currentControllers() {
+			if c.resourceType == resourceType {
+				return c
+			}
+		}
+	}
+	return nil
+}
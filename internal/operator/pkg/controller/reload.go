@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	config "github.com/agentkube/operator/config"
+)
+
+// reloadDebounce lets the writes of one config change settle before it is reloaded
+const reloadDebounce = 500 * time.Millisecond
+
+// WatchConfig reloads the watcher config whenever its file changes, until the manager stops
+func WatchConfig() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.Errorf("Failed to watch the watcher config, changes need a restart: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	// Editors replace the file rather than writing it, so its directory is watched
+	file := filepath.Clean(config.GetWatcherConfigFile())
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		logrus.Errorf("Failed to watch the watcher config, changes need a restart: %v", err)
+		return
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case e := <-watcher.Events:
+			if filepath.Clean(e.Name) == file && e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				reload = time.After(reloadDebounce)
+			}
+		case <-reload:
+			reload = nil
+			conf, err := config.New()
+			if err != nil {
+				logrus.Errorf("Keeping the current watcher config, the changed one failed to load: %v", err)
+				continue
+			}
+			Reload(conf)
+		case err := <-watcher.Errors:
+			logrus.Errorf("Error watching the watcher config: %v", err)
+		case <-globalManager.stopCh:
+			return
+		}
+	}
+}
+
+// Reload applies a changed watcher config: watchers of clusters no longer watched stop, those of
+// newly watched clusters start, and all restart when the watched resources changed. Dispatchers
+// and idle reaping keep the config the watchers started with, and a watcher disabled at startup
+// needs a restart to be enabled.
+func Reload(conf *config.Config) {
+	globalManager.usageMutex.Lock()
+	defer globalManager.usageMutex.Unlock()
+
+	previous := globalManager.setup
+	if previous == nil || isStopping() {
+		return
+	}
+	setup := &watcherSetup{conf: conf, eventHandler: previous.eventHandler, metrics: previous.metrics, contextStore: previous.contextStore}
+	globalManager.setup = setup
+
+	loadSeverityRules(conf)
+
+	restart := watchedResourcesChanged(previous.conf, conf)
+
+	globalManager.mutex.Lock()
+	var stopped []*ClusterWatcher
+	kept := globalManager.watchers[:0]
+	for _, w := range globalManager.watchers {
+		cw, ok := w.(*ClusterWatcher)
+		if ok && (restart || !conf.Enabled || !shouldWatchCluster(cw.clusterName, conf)) {
+			stopped = append(stopped, cw)
+			continue
+		}
+		kept = append(kept, w)
+	}
+	globalManager.watchers = kept
+	globalManager.mutex.Unlock()
+
+	restarted := map[string]bool{}
+	for _, cw := range stopped {
+		cw.Stop()
+		if restart && conf.Enabled && shouldWatchCluster(cw.clusterName, conf) {
+			restarted[cw.clusterName] = true
+		}
+	}
+	if !conf.Enabled {
+		logrus.Infof("Watcher disabled, stopped watchers for %d clusters", len(stopped))
+		return
+	}
+
+	contexts, err := setup.contextStore.GetContexts()
+	if err != nil {
+		logrus.Errorf("Failed to get contexts from store: %v", err)
+		return
+	}
+	started := 0
+	for _, ctx := range contexts {
+		// Lazy watchers of clusters not requested yet start on their first request
+		if ctx.Internal || globalManager.starting[ctx.Name] || (conf.LazyWatchers && !restarted[ctx.Name]) {
+			continue
+		}
+		if !shouldWatchCluster(ctx.Name, conf) || findClusterWatcher(ctx.Name) != nil {
+			continue
+		}
+		globalManager.starting[ctx.Name] = true
+		go startOnDemand(ctx.Name, setup)
+		started++
+	}
+	logrus.Infof("Reloaded watcher config: stopped watchers for %d clusters, starting %d", len(stopped), started)
+}
+
+// watchedResourcesChanged reports whether the watchers of a cluster must restart to watch what
+// the config asks for
+func watchedResourcesChanged(previous, conf *config.Config) bool {
+	return previous.Resource != conf.Resource ||
+		previous.Namespace != conf.Namespace ||
+		!reflect.DeepEqual(previous.CustomResources, conf.CustomResources) ||
+		!reflect.DeepEqual(previous.MetadataOnly, conf.MetadataOnly) ||
+		!reflect.DeepEqual(previous.CRDDiscovery, conf.CRDDiscovery)
+}
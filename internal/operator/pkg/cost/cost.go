@@ -0,0 +1,225 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/metrics"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const settingsFileName = "cost.json"
+
+// Settings configure the prices the cost estimates are based on
+type Settings struct {
+	// Preset selects the instance price table: auto, aws, gce, azure or custom
+	Preset   string `json:"preset"`
+	Currency string `json:"currency"`
+	// CPUHourly and MemoryGiBHourly price the nodes of instance types without a price by their
+	// capacity, their ratio splits the price of every node between CPU and memory
+	CPUHourly       float64 `json:"cpuHourly"`
+	MemoryGiBHourly float64 `json:"memoryGiBHourly"`
+	// Discount is the share taken off the prices, e.g. 0.3 for savings plans or committed use
+	Discount float64 `json:"discount"`
+	// Prices override the preset prices of instance types, e.g. with those of another region
+	Prices []InstancePrice `json:"prices"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Preset:          PresetAuto,
+		Currency:        "USD",
+		CPUHourly:       0.031611,
+		MemoryGiBHourly: 0.004237,
+		Prices:          []InstancePrice{},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	switch s.Preset {
+	case PresetAuto, PresetCustom, ProviderAWS, ProviderGCP, ProviderAzure:
+	default:
+		return fmt.Errorf("preset must be auto, custom, aws, gce or azure")
+	}
+	if s.Currency == "" {
+		return fmt.Errorf("currency must be set")
+	}
+	if s.CPUHourly < 0 || s.MemoryGiBHourly < 0 {
+		return fmt.Errorf("cpuHourly and memoryGiBHourly must not be negative")
+	}
+	if s.CPUHourly+s.MemoryGiBHourly == 0 {
+		return fmt.Errorf("cpuHourly or memoryGiBHourly must be set to split the node prices")
+	}
+	if s.Discount < 0 || s.Discount >= 1 {
+		return fmt.Errorf("discount must be between 0 and 1")
+	}
+	for _, price := range s.Prices {
+		if price.InstanceType == "" {
+			return fmt.Errorf("prices need an instanceType")
+		}
+		if price.Hourly < 0 {
+			return fmt.Errorf("price of %s must not be negative", price.InstanceType)
+		}
+	}
+	return nil
+}
+
+// Manager estimates the cost of clusters from the prices of their nodes
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	mutex           sync.Mutex
+}
+
+// NewManager creates a new cost manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+	}
+}
+
+// Settings returns the current cost settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new cost settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Prices == nil {
+		settings.Prices = []InstancePrice{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Estimate computes the monthly cost of a cluster per node, namespace and workload, from the running
+// pods and their usage
+func (m *Manager) Estimate(ctx context.Context, clusterName string) (*Estimate, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	podList, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Usage is optional, clusters without metrics server are allocated the requests
+	usageSource := UsageMetricsServer
+	podUsage := map[string]metrics.ResourceUsage{}
+	report, err := metrics.FetchPodUsage(ctx, clientset, "")
+	if err != nil {
+		if !errors.Is(err, metrics.ErrMetricsUnavailable) {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to read pod usage for the cost estimate")
+		}
+		usageSource = UsageRequests
+	} else {
+		for _, pod := range report.Pods {
+			podUsage[pod.Namespace+"/"+pod.Name] = pod.ResourceUsage
+		}
+	}
+
+	nodes := make([]nodeInput, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		nodes = append(nodes, nodeInput{
+			Name:         node.Name,
+			InstanceType: firstLabel(node.Labels, corev1.LabelInstanceTypeStable, corev1.LabelInstanceType),
+			Provider:     providerOf(node.Spec.ProviderID),
+			VCPUs:        float64(node.Status.Capacity.Cpu().MilliValue()) / 1000,
+			MemoryGiB:    float64(node.Status.Capacity.Memory().Value()) / (1 << 30),
+		})
+	}
+
+	pods := make([]podInput, 0, len(podList.Items))
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+		input := podInput{
+			Namespace:    pod.Namespace,
+			WorkloadKind: kind,
+			Workload:     name,
+			Node:         pod.Spec.NodeName,
+			CPUUsage:     -1,
+			MemoryUsage:  -1,
+		}
+		for _, container := range pod.Spec.Containers {
+			input.CPURequest += float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+			input.MemoryRequest += float64(container.Resources.Requests.Memory().Value()) / (1 << 30)
+		}
+		if used, ok := podUsage[pod.Namespace+"/"+pod.Name]; ok {
+			input.CPUUsage = float64(used.CPUMillis) / 1000
+			input.MemoryUsage = float64(used.MemoryBytes) / (1 << 30)
+		}
+		pods = append(pods, input)
+	}
+
+	nodeCosts, namespaceCosts, workloadCosts := estimate(nodes, pods, settings)
+	result := &Estimate{
+		Cluster:     clusterName,
+		At:          time.Now(),
+		Currency:    settings.Currency,
+		UsageSource: usageSource,
+		Discount:    settings.Discount,
+		Nodes:       nodeCosts,
+		Namespaces:  namespaceCosts,
+		Workloads:   workloadCosts,
+	}
+	for _, node := range nodeCosts {
+		result.MonthlyCost += node.MonthlyCost
+		result.IdleMonthlyCost += node.IdleMonthlyCost
+	}
+	return result, nil
+}
+
+func firstLabel(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := labels[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
@@ -0,0 +1,105 @@
+package cost
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNodePrice(t *testing.T) {
+	t.Parallel()
+
+	m5 := nodeInput{InstanceType: "m5.large", Provider: ProviderAWS, VCPUs: 2, MemoryGiB: 8}
+	tests := []struct {
+		name       string
+		settings   func(*Settings)
+		node       nodeInput
+		wantHourly float64
+		wantSource string
+	}{
+		{name: "preset of the node provider", node: m5, wantHourly: 0.096, wantSource: SourcePreset},
+		{name: "preset of another provider", settings: func(s *Settings) { s.Preset = ProviderGCP }, node: m5, wantHourly: 2*0.031611 + 8*0.004237, wantSource: SourceCapacity},
+		{name: "custom price", settings: func(s *Settings) { s.Prices = []InstancePrice{{InstanceType: "m5.large", Hourly: 0.107}} }, node: m5, wantHourly: 0.107, wantSource: SourceCustom},
+		{name: "custom price of another provider", settings: func(s *Settings) {
+			s.Prices = []InstancePrice{{Provider: ProviderAzure, InstanceType: "m5.large", Hourly: 1}}
+		}, node: m5, wantHourly: 0.096, wantSource: SourcePreset},
+		{name: "custom preset", settings: func(s *Settings) { s.Preset = PresetCustom }, node: m5, wantHourly: 2*0.031611 + 8*0.004237, wantSource: SourceCapacity},
+		{name: "on-premises", node: nodeInput{Provider: ProviderOther, VCPUs: 4}, wantHourly: 4 * 0.031611, wantSource: SourceCapacity},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			settings := DefaultSettings()
+			if tt.settings != nil {
+				tt.settings(&settings)
+			}
+			hourly, source := nodePrice(settings, tt.node)
+			if !near(hourly, tt.wantHourly) || source != tt.wantSource {
+				t.Errorf("nodePrice() = %v, %q, want %v, %q", hourly, source, tt.wantHourly, tt.wantSource)
+			}
+		})
+	}
+
+	if got := providerOf("gce://project/us-central1-a/node-1"); got != ProviderGCP {
+		t.Errorf("providerOf() = %q", got)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+
+	settings := DefaultSettings()
+	settings.CPUHourly = 1
+	settings.MemoryGiBHourly = 0.25
+	settings.Prices = []InstancePrice{{InstanceType: "test.large", Hourly: 8}}
+
+	nodes := []nodeInput{
+		// 1 per core and 0.25 per GiB, the rates split the price evenly
+		{Name: "a", InstanceType: "test.large", Provider: ProviderOther, VCPUs: 4, MemoryGiB: 16},
+		// Priced by capacity: 2 * 1 + 8 * 0.25
+		{Name: "b", Provider: ProviderOther, VCPUs: 2, MemoryGiB: 8},
+	}
+	pods := []podInput{
+		{Namespace: "shop", WorkloadKind: "Deployment", Workload: "api", Node: "a", CPURequest: 1, MemoryRequest: 2, CPUUsage: 1.5, MemoryUsage: 1},
+		{Namespace: "batch", WorkloadKind: "Job", Workload: "report", Node: "a", CPURequest: 0.5, MemoryRequest: 4, CPUUsage: -1, MemoryUsage: -1},
+		// Uses more than the node has, allocated the whole capacity
+		{Namespace: "batch", WorkloadKind: "Deployment", Workload: "worker", Node: "b", CPURequest: 1, CPUUsage: 3, MemoryUsage: 0},
+	}
+	nodeCosts, namespaces, workloads := estimate(nodes, pods, settings)
+
+	if len(nodeCosts) != 2 || !near(nodeCosts[0].MonthlyCost, 8*HoursPerMonth) || !near(nodeCosts[0].CPUCoreHourly, 1) || !near(nodeCosts[0].MemoryGiBHourly, 0.25) {
+		t.Fatalf("nodes = %+v", nodeCosts)
+	}
+	if !near(nodeCosts[0].IdleMonthlyCost, (8-2-1.5)*HoursPerMonth) || !near(nodeCosts[1].IdleMonthlyCost, 2*HoursPerMonth) {
+		t.Errorf("idle = %v, %v", nodeCosts[0].IdleMonthlyCost, nodeCosts[1].IdleMonthlyCost)
+	}
+
+	wantNamespaces := []struct {
+		name    string
+		monthly float64
+	}{
+		{NamespaceIdle, (4.5 + 2) * HoursPerMonth},
+		{"batch", (1.5 + 2) * HoursPerMonth},
+		{"shop", 2 * HoursPerMonth},
+	}
+	if len(namespaces) != len(wantNamespaces) {
+		t.Fatalf("namespaces = %+v", namespaces)
+	}
+	for i, want := range wantNamespaces {
+		if namespaces[i].Namespace != want.name || !near(namespaces[i].MonthlyCost, want.monthly) {
+			t.Errorf("namespaces[%d] = %s %v, want %s %v", i, namespaces[i].Namespace, namespaces[i].MonthlyCost, want.name, want.monthly)
+		}
+	}
+
+	// Equal costs are ordered by namespace and name
+	if len(workloads) != 3 || workloads[0].Name != "worker" || !near(workloads[0].CPUCores, 2) {
+		t.Fatalf("workloads = %+v, want worker capped at the node capacity first", workloads)
+	}
+	if workloads[1].Name != "api" || !near(workloads[1].CPUCores, 1.5) || !near(workloads[1].MemoryGiB, 2) {
+		t.Errorf("workloads[1] = %+v, want api allocated its usage and requests", workloads[1])
+	}
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6
+}
@@ -0,0 +1,213 @@
+package cost
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// HoursPerMonth is the average month used to turn hourly prices into monthly costs
+const HoursPerMonth = 730
+
+// NamespaceIdle receives the cost of the node capacity no pod is allocated
+const NamespaceIdle = "(idle)"
+
+// Usage sources of an estimate
+const (
+	UsageMetricsServer = "metrics-server"
+	// UsageRequests means the cluster has no metrics API, pods are allocated their requests only
+	UsageRequests = "requests"
+)
+
+// nodeInput is what the estimate needs to know about a node
+type nodeInput struct {
+	Name         string
+	InstanceType string
+	Provider     string
+	VCPUs        float64
+	MemoryGiB    float64
+}
+
+// podInput is what the estimate needs to know about a pod
+type podInput struct {
+	Namespace     string
+	WorkloadKind  string
+	Workload      string
+	Node          string
+	CPURequest    float64
+	MemoryRequest float64
+	// CPUUsage and MemoryUsage are the used cores and GiB, negative when unknown
+	CPUUsage    float64
+	MemoryUsage float64
+}
+
+// NodeCost is the price of a node and how it splits between CPU and memory
+type NodeCost struct {
+	Name         string `json:"name"`
+	InstanceType string `json:"instanceType,omitempty"`
+	Provider     string `json:"provider"`
+	// PriceSource tells whether the price is configured, a preset or derived from the capacity
+	PriceSource     string  `json:"priceSource"`
+	HourlyCost      float64 `json:"hourlyCost"`
+	MonthlyCost     float64 `json:"monthlyCost"`
+	CPUCoreHourly   float64 `json:"cpuCoreHourly"`
+	MemoryGiBHourly float64 `json:"memoryGiBHourly"`
+	// IdleMonthlyCost is the cost of the capacity no pod is allocated
+	IdleMonthlyCost float64 `json:"idleMonthlyCost"`
+}
+
+// Allocation is the resources allocated to pods, the larger of their requests and usage, and their cost
+type Allocation struct {
+	Pods              int     `json:"pods"`
+	CPUCores          float64 `json:"cpuCores"`
+	MemoryGiB         float64 `json:"memoryGiB"`
+	CPUMonthlyCost    float64 `json:"cpuMonthlyCost"`
+	MemoryMonthlyCost float64 `json:"memoryMonthlyCost"`
+	MonthlyCost       float64 `json:"monthlyCost"`
+}
+
+func (a *Allocation) add(other Allocation) {
+	a.Pods += other.Pods
+	a.CPUCores += other.CPUCores
+	a.MemoryGiB += other.MemoryGiB
+	a.CPUMonthlyCost += other.CPUMonthlyCost
+	a.MemoryMonthlyCost += other.MemoryMonthlyCost
+	a.MonthlyCost += other.MonthlyCost
+}
+
+// NamespaceCost is the cost allocated to the pods of a namespace
+type NamespaceCost struct {
+	Namespace string `json:"namespace"`
+	Allocation
+}
+
+// WorkloadCost is the cost allocated to the pods of a workload
+type WorkloadCost struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Allocation
+}
+
+// Estimate is the monthly cost of a cluster at its current size and load, by node, namespace and workload
+type Estimate struct {
+	Cluster     string    `json:"cluster"`
+	At          time.Time `json:"at"`
+	Currency    string    `json:"currency"`
+	UsageSource string    `json:"usageSource"`
+	Discount    float64   `json:"discount"`
+	MonthlyCost float64   `json:"monthlyCost"`
+	// IdleMonthlyCost is the part of the monthly cost no pod is allocated
+	IdleMonthlyCost float64         `json:"idleMonthlyCost"`
+	Nodes           []NodeCost      `json:"nodes"`
+	Namespaces      []NamespaceCost `json:"namespaces"`
+	Workloads       []WorkloadCost  `json:"workloads"`
+}
+
+// estimate prices every node, splits its price between CPU and memory in the ratio of the rates, and
+// allocates it to the pods it runs by the larger of their requests and usage. Pods allocated more than
+// the node capacity share it, the capacity left is the idle cost.
+func estimate(nodes []nodeInput, pods []podInput, settings Settings) ([]NodeCost, []NamespaceCost, []WorkloadCost) {
+	podsByNode := map[string][]podInput{}
+	for _, pod := range pods {
+		podsByNode[pod.Node] = append(podsByNode[pod.Node], pod)
+	}
+
+	nodeCosts := make([]NodeCost, 0, len(nodes))
+	namespaces := map[string]*NamespaceCost{}
+	workloads := map[string]*WorkloadCost{}
+
+	for _, node := range nodes {
+		hourly, source := nodePrice(settings, node)
+		hourly *= 1 - settings.Discount
+		nodeCost := NodeCost{
+			Name:         node.Name,
+			InstanceType: node.InstanceType,
+			Provider:     node.Provider,
+			PriceSource:  source,
+			HourlyCost:   hourly,
+			MonthlyCost:  hourly * HoursPerMonth,
+		}
+		cpuWeight, memoryWeight := node.VCPUs*settings.CPUHourly, node.MemoryGiB*settings.MemoryGiBHourly
+		if weight := cpuWeight + memoryWeight; weight > 0 {
+			if node.VCPUs > 0 {
+				nodeCost.CPUCoreHourly = hourly * cpuWeight / weight / node.VCPUs
+			}
+			if node.MemoryGiB > 0 {
+				nodeCost.MemoryGiBHourly = hourly * memoryWeight / weight / node.MemoryGiB
+			}
+		}
+
+		nodePods := podsByNode[node.Name]
+		var cpuAllocated, memoryAllocated float64
+		for _, pod := range nodePods {
+			cpuAllocated += math.Max(pod.CPURequest, pod.CPUUsage)
+			memoryAllocated += math.Max(pod.MemoryRequest, pod.MemoryUsage)
+		}
+		// Pods can use more than the capacity in total, e.g. with overcommitted limits
+		cpuScale, memoryScale := 1.0, 1.0
+		if cpuAllocated > node.VCPUs && cpuAllocated > 0 {
+			cpuScale = node.VCPUs / cpuAllocated
+		}
+		if memoryAllocated > node.MemoryGiB && memoryAllocated > 0 {
+			memoryScale = node.MemoryGiB / memoryAllocated
+		}
+
+		allocated := 0.0
+		for _, pod := range nodePods {
+			cpu := math.Max(pod.CPURequest, pod.CPUUsage) * cpuScale
+			memory := math.Max(pod.MemoryRequest, pod.MemoryUsage) * memoryScale
+			allocation := Allocation{
+				Pods:              1,
+				CPUCores:          cpu,
+				MemoryGiB:         memory,
+				CPUMonthlyCost:    cpu * nodeCost.CPUCoreHourly * HoursPerMonth,
+				MemoryMonthlyCost: memory * nodeCost.MemoryGiBHourly * HoursPerMonth,
+			}
+			allocation.MonthlyCost = allocation.CPUMonthlyCost + allocation.MemoryMonthlyCost
+			allocated += allocation.MonthlyCost
+
+			if namespaces[pod.Namespace] == nil {
+				namespaces[pod.Namespace] = &NamespaceCost{Namespace: pod.Namespace}
+			}
+			namespaces[pod.Namespace].add(allocation)
+			key := pod.Namespace + "/" + pod.WorkloadKind + "/" + pod.Workload
+			if workloads[key] == nil {
+				workloads[key] = &WorkloadCost{Namespace: pod.Namespace, Kind: pod.WorkloadKind, Name: pod.Workload}
+			}
+			workloads[key].add(allocation)
+		}
+
+		nodeCost.IdleMonthlyCost = math.Max(nodeCost.MonthlyCost-allocated, 0)
+		if nodeCost.IdleMonthlyCost > 0 {
+			if namespaces[NamespaceIdle] == nil {
+				namespaces[NamespaceIdle] = &NamespaceCost{Namespace: NamespaceIdle}
+			}
+			namespaces[NamespaceIdle].MonthlyCost += nodeCost.IdleMonthlyCost
+		}
+		nodeCosts = append(nodeCosts, nodeCost)
+	}
+
+	namespaceCosts := make([]NamespaceCost, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		namespaceCosts = append(namespaceCosts, *namespace)
+	}
+	workloadCosts := make([]WorkloadCost, 0, len(workloads))
+	for _, workload := range workloads {
+		workloadCosts = append(workloadCosts, *workload)
+	}
+	sort.Slice(nodeCosts, func(i, j int) bool { return nodeCosts[i].Name < nodeCosts[j].Name })
+	sort.Slice(namespaceCosts, func(i, j int) bool {
+		if namespaceCosts[i].MonthlyCost != namespaceCosts[j].MonthlyCost {
+			return namespaceCosts[i].MonthlyCost > namespaceCosts[j].MonthlyCost
+		}
+		return namespaceCosts[i].Namespace < namespaceCosts[j].Namespace
+	})
+	sort.Slice(workloadCosts, func(i, j int) bool {
+		if workloadCosts[i].MonthlyCost != workloadCosts[j].MonthlyCost {
+			return workloadCosts[i].MonthlyCost > workloadCosts[j].MonthlyCost
+		}
+		return workloadCosts[i].Namespace+"/"+workloadCosts[i].Name < workloadCosts[j].Namespace+"/"+workloadCosts[j].Name
+	})
+	return nodeCosts, namespaceCosts, workloadCosts
+}
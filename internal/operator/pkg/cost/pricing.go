@@ -0,0 +1,125 @@
+package cost
+
+import (
+	"strings"
+)
+
+// Cloud providers told apart by the provider ID of the nodes, also the names of their price presets
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gce"
+	ProviderAzure = "azure"
+	// ProviderOther covers on-premises and unknown providers, priced by capacity
+	ProviderOther = "other"
+)
+
+// Presets select the price table of the nodes
+const (
+	// PresetAuto prices every node with the table of its own provider
+	PresetAuto = "auto"
+	// PresetCustom only applies the configured prices and rates
+	PresetCustom = "custom"
+)
+
+// Sources of the price of a node
+const (
+	SourceCustom = "custom"
+	SourcePreset = "preset"
+	// SourceCapacity means the instance type has no price, the node is priced by its vCPUs and memory
+	SourceCapacity = "capacity"
+)
+
+// InstancePrice is the on-demand hourly price of an instance type
+type InstancePrice struct {
+	// Provider limits the price to the nodes of a provider, empty matches any
+	Provider     string  `json:"provider,omitempty"`
+	InstanceType string  `json:"instanceType"`
+	Hourly       float64 `json:"hourly"`
+}
+
+// presetPrices are the Linux on-demand list prices in USD of common instance types, in us-east-1,
+// us-central1 and eastus. Other regions and negotiated discounts are covered by the settings.
+var presetPrices = []InstancePrice{
+	{Provider: ProviderAWS, InstanceType: "t3.medium", Hourly: 0.0416},
+	{Provider: ProviderAWS, InstanceType: "t3.large", Hourly: 0.0832},
+	{Provider: ProviderAWS, InstanceType: "t3.xlarge", Hourly: 0.1664},
+	{Provider: ProviderAWS, InstanceType: "m5.large", Hourly: 0.096},
+	{Provider: ProviderAWS, InstanceType: "m5.xlarge", Hourly: 0.192},
+	{Provider: ProviderAWS, InstanceType: "m5.2xlarge", Hourly: 0.384},
+	{Provider: ProviderAWS, InstanceType: "m5.4xlarge", Hourly: 0.768},
+	{Provider: ProviderAWS, InstanceType: "m6i.large", Hourly: 0.096},
+	{Provider: ProviderAWS, InstanceType: "m6i.xlarge", Hourly: 0.192},
+	{Provider: ProviderAWS, InstanceType: "m6i.2xlarge", Hourly: 0.384},
+	{Provider: ProviderAWS, InstanceType: "m6g.large", Hourly: 0.077},
+	{Provider: ProviderAWS, InstanceType: "m6g.xlarge", Hourly: 0.154},
+	{Provider: ProviderAWS, InstanceType: "m7g.large", Hourly: 0.0816},
+	{Provider: ProviderAWS, InstanceType: "m7g.xlarge", Hourly: 0.1632},
+	{Provider: ProviderAWS, InstanceType: "c5.large", Hourly: 0.085},
+	{Provider: ProviderAWS, InstanceType: "c5.xlarge", Hourly: 0.17},
+	{Provider: ProviderAWS, InstanceType: "c6i.xlarge", Hourly: 0.17},
+	{Provider: ProviderAWS, InstanceType: "r5.large", Hourly: 0.126},
+	{Provider: ProviderAWS, InstanceType: "r5.xlarge", Hourly: 0.252},
+	{Provider: ProviderAWS, InstanceType: "r6i.xlarge", Hourly: 0.252},
+	{Provider: ProviderGCP, InstanceType: "e2-medium", Hourly: 0.0335},
+	{Provider: ProviderGCP, InstanceType: "e2-standard-2", Hourly: 0.067},
+	{Provider: ProviderGCP, InstanceType: "e2-standard-4", Hourly: 0.134},
+	{Provider: ProviderGCP, InstanceType: "e2-standard-8", Hourly: 0.268},
+	{Provider: ProviderGCP, InstanceType: "n1-standard-1", Hourly: 0.0475},
+	{Provider: ProviderGCP, InstanceType: "n1-standard-2", Hourly: 0.095},
+	{Provider: ProviderGCP, InstanceType: "n1-standard-4", Hourly: 0.19},
+	{Provider: ProviderGCP, InstanceType: "n2-standard-2", Hourly: 0.0971},
+	{Provider: ProviderGCP, InstanceType: "n2-standard-4", Hourly: 0.1942},
+	{Provider: ProviderGCP, InstanceType: "n2-standard-8", Hourly: 0.3885},
+	{Provider: ProviderGCP, InstanceType: "n2d-standard-4", Hourly: 0.169},
+	{Provider: ProviderAzure, InstanceType: "Standard_B2s", Hourly: 0.0416},
+	{Provider: ProviderAzure, InstanceType: "Standard_B4ms", Hourly: 0.166},
+	{Provider: ProviderAzure, InstanceType: "Standard_D2s_v3", Hourly: 0.096},
+	{Provider: ProviderAzure, InstanceType: "Standard_D4s_v3", Hourly: 0.192},
+	{Provider: ProviderAzure, InstanceType: "Standard_D8s_v3", Hourly: 0.384},
+	{Provider: ProviderAzure, InstanceType: "Standard_D2s_v5", Hourly: 0.096},
+	{Provider: ProviderAzure, InstanceType: "Standard_D4s_v5", Hourly: 0.192},
+	{Provider: ProviderAzure, InstanceType: "Standard_E4s_v5", Hourly: 0.252},
+	{Provider: ProviderAzure, InstanceType: "Standard_F4s_v2", Hourly: 0.169},
+}
+
+// Prices returns the price table applied with the settings: the configured prices, then the presets
+// of the selected provider, or of every provider with PresetAuto
+func Prices(settings Settings) []InstancePrice {
+	prices := append([]InstancePrice{}, settings.Prices...)
+	for _, price := range presetPrices {
+		if settings.Preset == PresetAuto || settings.Preset == price.Provider {
+			prices = append(prices, price)
+		}
+	}
+	return prices
+}
+
+// nodePrice returns the hourly list price of a node and where it comes from. Configured prices win
+// over the presets, nodes of unknown instance types are priced by their capacity at the rates.
+func nodePrice(settings Settings, node nodeInput) (float64, string) {
+	for _, price := range settings.Prices {
+		if price.InstanceType == node.InstanceType && (price.Provider == "" || price.Provider == node.Provider) {
+			return price.Hourly, SourceCustom
+		}
+	}
+	preset := settings.Preset
+	if preset == PresetAuto {
+		preset = node.Provider
+	}
+	for _, price := range presetPrices {
+		if price.InstanceType == node.InstanceType && price.Provider == preset {
+			return price.Hourly, SourcePreset
+		}
+	}
+	return node.VCPUs*settings.CPUHourly + node.MemoryGiB*settings.MemoryGiBHourly, SourceCapacity
+}
+
+// providerOf reads the provider of a node from its provider ID, e.g. aws:///us-east-1a/i-0123
+func providerOf(providerID string) string {
+	scheme, _, _ := strings.Cut(providerID, "://")
+	switch scheme {
+	case ProviderAWS, ProviderGCP, ProviderAzure:
+		return scheme
+	}
+	return ProviderOther
+}
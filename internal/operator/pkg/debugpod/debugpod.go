@@ -0,0 +1,236 @@
+package debugpod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Debug profiles, the security settings of the debug container as kubectl debug applies them
+const (
+	// ProfileGeneral may trace the processes of the target container
+	ProfileGeneral = "general"
+	// ProfileBaseline adds no privileges
+	ProfileBaseline = "baseline"
+	// ProfileRestricted runs as non-root without any capability, for pods under the restricted
+	// pod security standard
+	ProfileRestricted = "restricted"
+	// ProfileNetAdmin may change the network of the pod and capture its traffic
+	ProfileNetAdmin = "netadmin"
+	// ProfileSysAdmin runs privileged
+	ProfileSysAdmin = "sysadmin"
+)
+
+// DefaultImage is the image of debug containers launched without one
+const DefaultImage = "busybox:1.36"
+
+// Container states reported by Wait
+const (
+	StateWaiting    = "waiting"
+	StateRunning    = "running"
+	StateTerminated = "terminated"
+)
+
+var (
+	// ErrInvalid is returned for invalid debug requests
+	ErrInvalid = errors.New("invalid debug request")
+	// ErrPodNotRunning is returned for pods debug containers can't be added to
+	ErrPodNotRunning = errors.New("pod is not running")
+)
+
+// Request launches a debug container in a pod
+type Request struct {
+	// Image defaults to DefaultImage
+	Image string `json:"image,omitempty"`
+	// TargetContainer shares its process namespace with the debug container, when the runtime
+	// supports it
+	TargetContainer string `json:"targetContainer,omitempty"`
+	// Profile defaults to ProfileGeneral
+	Profile string `json:"profile,omitempty"`
+	// Command defaults to the entrypoint of the image
+	Command []string `json:"command,omitempty"`
+	// Name defaults to a generated debugger-xxxxx name
+	Name string `json:"name,omitempty"`
+}
+
+// Result describes a launched debug container and how to connect to it
+type Result struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Profile   string `json:"profile"`
+	// State of the container once launched, see Wait
+	State string `json:"state"`
+	// Reason the container is waiting or terminated, e.g. ImagePullBackOff
+	Reason string `json:"reason,omitempty"`
+	// Attach is the multiplexer connection attaching to the terminal of the container
+	Attach Connection `json:"attach"`
+}
+
+// Connection is the path and query a multiplexer REQUEST message opens a connection with
+type Connection struct {
+	Path  string `json:"path"`
+	Query string `json:"query"`
+}
+
+var profiles = map[string]func() *corev1.SecurityContext{
+	ProfileGeneral: func() *corev1.SecurityContext {
+		return &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"SYS_PTRACE"}}}
+	},
+	ProfileBaseline: func() *corev1.SecurityContext { return nil },
+	ProfileRestricted: func() *corev1.SecurityContext {
+		return &corev1.SecurityContext{
+			RunAsNonRoot:             ptr.To(true),
+			AllowPrivilegeEscalation: ptr.To(false),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}
+	},
+	ProfileNetAdmin: func() *corev1.SecurityContext {
+		return &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"}}}
+	},
+	ProfileSysAdmin: func() *corev1.SecurityContext {
+		return &corev1.SecurityContext{Privileged: ptr.To(true)}
+	},
+}
+
+// Launch adds an ephemeral debug container to a running pod with the ephemeralcontainers
+// subresource. The container starts asynchronously, see Wait.
+func Launch(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, req Request) (*Result, error) {
+	if req.Image == "" {
+		req.Image = DefaultImage
+	}
+	if req.Profile == "" {
+		req.Profile = ProfileGeneral
+	}
+	securityContext, ok := profiles[req.Profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown profile %q, must be general, baseline, restricted, netadmin or sysadmin", ErrInvalid, req.Profile)
+	}
+	if req.Name == "" {
+		req.Name = "debugger-" + uuid.New().String()[:5]
+	}
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: container name %q: %s", ErrInvalid, req.Name, strings.Join(errs, ", "))
+	}
+
+	pods := clientset.CoreV1().Pods(namespace)
+	pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf("%w: %s/%s is %s", ErrPodNotRunning, namespace, podName, pod.Status.Phase)
+	}
+	if err := checkNames(pod, req); err != nil {
+		return nil, err
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     req.Name,
+			Image:                    req.Image,
+			Command:                  req.Command,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			SecurityContext:          securityContext(),
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		},
+		TargetContainerName: req.TargetContainer,
+	})
+	if _, err := pods.UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("container", req.Name)
+	query.Set("stdin", "true")
+	query.Set("stdout", "true")
+	query.Set("tty", "true")
+	return &Result{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: req.Name,
+		Image:     req.Image,
+		Profile:   req.Profile,
+		State:     StateWaiting,
+		Attach: Connection{
+			Path:  fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/attach", namespace, podName),
+			Query: query.Encode(),
+		},
+	}, nil
+}
+
+// Wait polls the state of a debug container until it runs, terminates or fails to start, or the
+// timeout passes, the image may take a while to pull. It sets the last state seen on the result.
+func Wait(ctx context.Context, clientset kubernetes.Interface, result *Result, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(result.Namespace).Get(ctx, result.Pod, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		result.State, result.Reason = containerState(pod, result.Container)
+		return result.State != StateWaiting || !startingReasons[result.Reason], nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return err
+	}
+	return nil
+}
+
+// startingReasons are the reasons a container waits for while it starts, other reasons are failures
+var startingReasons = map[string]bool{"": true, "ContainerCreating": true, "PodInitializing": true}
+
+// checkNames checks the target container exists and the debug container name is free
+func checkNames(pod *corev1.Pod, req Request) error {
+	names := map[string]bool{}
+	for _, c := range pod.Spec.InitContainers {
+		names[c.Name] = true
+	}
+	targetFound := req.TargetContainer == ""
+	for _, c := range pod.Spec.Containers {
+		names[c.Name] = true
+		targetFound = targetFound || c.Name == req.TargetContainer
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		names[c.Name] = true
+	}
+	if !targetFound {
+		return fmt.Errorf("%w: pod %s has no container %s", ErrInvalid, pod.Name, req.TargetContainer)
+	}
+	if names[req.Name] {
+		return fmt.Errorf("%w: pod %s already has a container %s", ErrInvalid, pod.Name, req.Name)
+	}
+	return nil
+}
+
+// containerState returns the state of an ephemeral container and the reason of its state
+func containerState(pod *corev1.Pod, container string) (string, string) {
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		if status.Name != container {
+			continue
+		}
+		switch {
+		case status.State.Running != nil:
+			return StateRunning, ""
+		case status.State.Terminated != nil:
+			return StateTerminated, status.State.Terminated.Reason
+		case status.State.Waiting != nil:
+			return StateWaiting, status.State.Waiting.Reason
+		}
+	}
+	return StateWaiting, ""
+}
@@ -0,0 +1,95 @@
+package debugpod
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func runningPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "web:1"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestLaunch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		req     Request
+		wantErr error
+	}{
+		{name: "defaults", pod: runningPod(), req: Request{}},
+		{name: "netadmin targeting app", pod: runningPod(), req: Request{Name: "netshoot", Image: "nicolaka/netshoot", TargetContainer: "app", Profile: ProfileNetAdmin}},
+		{name: "unknown profile", pod: runningPod(), req: Request{Profile: "root"}, wantErr: ErrInvalid},
+		{name: "unknown target", pod: runningPod(), req: Request{TargetContainer: "sidecar"}, wantErr: ErrInvalid},
+		{name: "name taken", pod: runningPod(), req: Request{Name: "app"}, wantErr: ErrInvalid},
+		{name: "pending pod", pod: func() *corev1.Pod {
+			pod := runningPod()
+			pod.Status.Phase = corev1.PodPending
+			return pod
+		}(), wantErr: ErrPodNotRunning},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clientset := fake.NewSimpleClientset(tt.pod)
+			result, err := Launch(context.Background(), clientset, "shop", "web", tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Launch() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Launch() error = %v", err)
+			}
+
+			pod, _ := clientset.CoreV1().Pods("shop").Get(context.Background(), "web", metav1.GetOptions{})
+			if len(pod.Spec.EphemeralContainers) != 1 {
+				t.Fatalf("ephemeral containers = %+v, want the debug container", pod.Spec.EphemeralContainers)
+			}
+			container := pod.Spec.EphemeralContainers[0]
+			if container.Name != result.Container || container.Image != result.Image || container.TargetContainerName != tt.req.TargetContainer || !container.TTY {
+				t.Errorf("ephemeral container = %+v, want the one of result %+v", container, result)
+			}
+			if result.Attach.Path != "/api/v1/namespaces/shop/pods/web/attach" {
+				t.Errorf("attach path = %s", result.Attach.Path)
+			}
+			if tt.req.Profile == ProfileNetAdmin && len(container.SecurityContext.Capabilities.Add) != 2 {
+				t.Errorf("security context = %+v, want NET_ADMIN and NET_RAW", container.SecurityContext)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+
+	pod := runningPod()
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "debugger",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}}
+	result := &Result{Namespace: "shop", Pod: "web", Container: "debugger", State: StateWaiting}
+
+	// A container failing to start ends the wait before the timeout
+	if err := Wait(context.Background(), fake.NewSimpleClientset(pod), result, time.Minute); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if result.State != StateWaiting || result.Reason != "ImagePullBackOff" {
+		t.Errorf("state = %s %s, want waiting ImagePullBackOff", result.State, result.Reason)
+	}
+}
@@ -0,0 +1,130 @@
+// Package demo runs a demo cluster inside the operator, for demos, UI development and reproducing
+// bugs without a real cluster. Its resources live in the object tracker of a fake clientset, served
+// over the Kubernetes REST API on a loopback port, so the demo context works with every client,
+// informer and proxy of the operator. Writes only change the memory of the operator, and Reset
+// brings the seeded resources back.
+package demo
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ContextName is the name of the demo context
+const ContextName = "demo"
+
+var (
+	// ErrContextExists is returned when a context not backed by the demo cluster is named demo
+	ErrContextExists = errors.New("a context named " + ContextName + " already exists")
+	// ErrNotRunning is returned when resetting a demo cluster that isn't running
+	ErrNotRunning = errors.New("the demo cluster is not running")
+)
+
+// Status is the state of the demo cluster
+type Status struct {
+	Running   bool       `json:"running"`
+	Context   string     `json:"context,omitempty"`
+	Server    string     `json:"server,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	running *Server
+)
+
+// Start runs the demo cluster and adds its context to the store. Starting a running demo cluster
+// only adds its context again.
+func Start(store kubeconfig.ContextStore) (*kubeconfig.Context, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if existing, err := store.GetContext(ContextName); err == nil && existing.Source != kubeconfig.Demo {
+		return nil, ErrContextExists
+	}
+
+	if running == nil {
+		server, err := NewServer(Objects(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		if err := server.Start(); err != nil {
+			return nil, err
+		}
+		running = server
+		logger.Log(logger.LevelInfo, map[string]string{"server": server.URL()}, nil, "Started demo cluster")
+	}
+
+	demoContext := running.Context(ContextName)
+	if err := store.AddContext(demoContext); err != nil {
+		return nil, err
+	}
+	return demoContext, nil
+}
+
+// Stop removes the demo context and stops the demo cluster, dropping the changes made to it
+func Stop(store kubeconfig.ContextStore) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if running == nil {
+		return nil
+	}
+	if existing, err := store.GetContext(ContextName); err == nil && existing.Source == kubeconfig.Demo {
+		if err := store.RemoveContext(ContextName); err != nil {
+			return err
+		}
+	}
+	err := running.Close()
+	running = nil
+	logger.Log(logger.LevelInfo, nil, err, "Stopped demo cluster")
+	return err
+}
+
+// Reset replaces the resources of the running demo cluster with freshly seeded ones
+func Reset() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if running == nil {
+		return ErrNotRunning
+	}
+	return running.Seed(Objects(time.Now()))
+}
+
+// GetStatus returns the state of the demo cluster
+func GetStatus() Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if running == nil {
+		return Status{}
+	}
+	startedAt := running.startedAt
+	return Status{
+		Running:   true,
+		Context:   ContextName,
+		Server:    running.URL(),
+		StartedAt: &startedAt,
+	}
+}
+
+// Context returns a context of the server named name, defaulting to the demo namespace
+func (s *Server) Context(name string) *kubeconfig.Context {
+	return &kubeconfig.Context{
+		Name: name,
+		KubeContext: &api.Context{
+			Cluster:   name,
+			AuthInfo:  name,
+			Namespace: Namespace,
+		},
+		Cluster:  &api.Cluster{Server: s.URL()},
+		AuthInfo: &api.AuthInfo{},
+		Source:   kubeconfig.Demo,
+	}
+}
@@ -0,0 +1,159 @@
+package demo
+
+import (
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resource is an API resource the demo cluster serves
+type resource struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	namespaced bool
+	// scalable resources serve the scale subresource
+	scalable bool
+}
+
+func (r resource) gvk() schema.GroupVersionKind {
+	return r.gvr.GroupVersion().WithKind(r.kind)
+}
+
+var resources = []resource{
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, kind: "Namespace"},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "nodes"}, kind: "Node"},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}, kind: "PersistentVolume"},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, kind: "Pod", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "services"}, kind: "Service", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}, kind: "Endpoints", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, kind: "ConfigMap", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, kind: "Secret", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, kind: "ServiceAccount", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, kind: "PersistentVolumeClaim", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "events"}, kind: "Event", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}, kind: "ResourceQuota", namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "limitranges"}, kind: "LimitRange", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, kind: "Deployment", namespaced: true, scalable: true},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, kind: "ReplicaSet", namespaced: true, scalable: true},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, kind: "StatefulSet", namespaced: true, scalable: true},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, kind: "DaemonSet", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, kind: "Job", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}, kind: "CronJob", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}, kind: "HorizontalPodAutoscaler", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}, kind: "PodDisruptionBudget", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, kind: "Ingress", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}, kind: "NetworkPolicy", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}, kind: "StorageClass"},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, kind: "Role", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, kind: "RoleBinding", namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, kind: "ClusterRole"},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, kind: "ClusterRoleBinding"},
+}
+
+// lookupResource finds a served resource of a group version
+func lookupResource(gv schema.GroupVersion, name string) (resource, bool) {
+	for _, r := range resources {
+		if r.gvr.GroupVersion() == gv && r.gvr.Resource == name {
+			return r, true
+		}
+	}
+	return resource{}, false
+}
+
+// groupVersions returns the served group versions, the core group first
+func groupVersions() []schema.GroupVersion {
+	seen := map[schema.GroupVersion]bool{}
+	gvs := []schema.GroupVersion{}
+	for _, r := range resources {
+		if gv := r.gvr.GroupVersion(); !seen[gv] {
+			seen[gv] = true
+			gvs = append(gvs, gv)
+		}
+	}
+	sort.SliceStable(gvs, func(i, j int) bool {
+		return gvs[i].Group == "" && gvs[j].Group != ""
+	})
+	return gvs
+}
+
+// apiGroupList is the discovery document of /apis
+func apiGroupList() *metav1.APIGroupList {
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	for _, gv := range groupVersions() {
+		if gv.Group == "" {
+			continue
+		}
+		version := metav1.GroupVersionForDiscovery{GroupVersion: gv.String(), Version: gv.Version}
+		list.Groups = append(list.Groups, metav1.APIGroup{
+			Name:             gv.Group,
+			Versions:         []metav1.GroupVersionForDiscovery{version},
+			PreferredVersion: version,
+		})
+	}
+	return list
+}
+
+// apiResourceList is the discovery document of a group version, with the subresources the demo
+// cluster serves
+func apiResourceList(gv schema.GroupVersion) (*metav1.APIResourceList, bool) {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: gv.String(),
+	}
+	verbs := metav1.Verbs{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+	for _, r := range resources {
+		if r.gvr.GroupVersion() != gv {
+			continue
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:         r.gvr.Resource,
+			SingularName: strings.ToLower(r.kind),
+			Namespaced:   r.namespaced,
+			Kind:         r.kind,
+			Verbs:        verbs,
+		})
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       r.gvr.Resource + "/status",
+			Namespaced: r.namespaced,
+			Kind:       r.kind,
+			Verbs:      metav1.Verbs{"get", "patch", "update"},
+		})
+		if r.scalable {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       r.gvr.Resource + "/scale",
+				Namespaced: r.namespaced,
+				Group:      "autoscaling",
+				Version:    "v1",
+				Kind:       "Scale",
+				Verbs:      metav1.Verbs{"get", "patch", "update"},
+			})
+		}
+		if r.gvr.Resource == "pods" {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       "pods/log",
+				Namespaced: true,
+				Kind:       "Pod",
+				Verbs:      metav1.Verbs{"get"},
+			})
+		}
+	}
+	return list, len(list.APIResources) > 0
+}
+
+// lookupKind finds the served resource of a kind
+func lookupKind(gvk schema.GroupVersionKind) (resource, bool) {
+	for _, r := range resources {
+		if r.gvk() == gvk {
+			return r, true
+		}
+	}
+	return resource{}, false
+}
+
+// Serves reports whether the demo server can hold objects of a kind
+func Serves(gvk schema.GroupVersionKind) bool {
+	_, ok := lookupKind(gvk)
+	return ok
+}
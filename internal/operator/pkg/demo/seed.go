@@ -0,0 +1,540 @@
+package demo
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Namespace is the namespace of the demo context, the one holding the demo application
+const Namespace = "shop"
+
+// Objects returns the resources of the demo cluster, aged relative to now: a shop application with a
+// web frontend, an API that crash loops and a database with its volume, monitoring agents, a
+// nightly job, and the events explaining their state.
+func Objects(now time.Time) []runtime.Object {
+	f := &fixtures{now: now}
+
+	f.add(f.namespace("default"), f.namespace("kube-system"), f.namespace(Namespace), f.namespace("monitoring"))
+	f.add(f.node("demo-node-1"), f.node("demo-node-2"))
+	f.add(&storagev1.StorageClass{
+		ObjectMeta:  f.meta("StorageClass", "", "standard", nil, 30*24*time.Hour),
+		Provisioner: "rancher.io/local-path",
+	})
+
+	// kube-system
+	f.deployment("kube-system", "coredns", "registry.k8s.io/coredns/coredns:v1.11.3", 2, 30*24*time.Hour, nil)
+
+	// shop
+	f.add(&corev1.ConfigMap{
+		ObjectMeta: f.meta("ConfigMap", Namespace, "web-config", map[string]string{"app": "web"}, 7*24*time.Hour),
+		Data:       map[string]string{"nginx.conf": "server {\n  listen 8080;\n  location /api/ { proxy_pass http://api; }\n}\n"},
+	})
+	f.add(&corev1.Secret{
+		ObjectMeta: f.meta("Secret", Namespace, "postgres-credentials", map[string]string{"app": "postgres"}, 7*24*time.Hour),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"username": []byte("shop"), "password": []byte("demo-password")},
+	})
+	f.add(&corev1.ServiceAccount{ObjectMeta: f.meta("ServiceAccount", Namespace, "api", nil, 7*24*time.Hour)})
+
+	web := f.deployment(Namespace, "web", "nginx:1.27", 3, 2*24*time.Hour, nil)
+	web.Spec.Template.Spec.Volumes = []corev1.Volume{{
+		Name:         "config",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web-config"}}},
+	}}
+	api := f.deployment(Namespace, "api", "ghcr.io/agentkube/demo-api:1.4.0", 2, 5*time.Hour, func(pod *corev1.Pod, i int) {
+		if i == 0 {
+			crashLoop(pod, f.now)
+		}
+	})
+	api.Spec.Template.Spec.ServiceAccountName = "api"
+	api.Status.ReadyReplicas, api.Status.AvailableReplicas = 1, 1
+	api.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type:    appsv1.DeploymentAvailable,
+		Status:  corev1.ConditionFalse,
+		Reason:  "MinimumReplicasUnavailable",
+		Message: "Deployment does not have minimum availability.",
+	}}
+
+	f.statefulSet(Namespace, "postgres", "postgres:16", 6*24*time.Hour)
+
+	f.add(f.service(Namespace, "web", map[string]string{"app": "web"}, 80, 8080))
+	f.add(f.service(Namespace, "api", map[string]string{"app": "api"}, 80, 8080))
+	postgres := f.service(Namespace, "postgres", map[string]string{"app": "postgres"}, 5432, 5432)
+	postgres.Spec.ClusterIP = corev1.ClusterIPNone
+	f.add(postgres)
+
+	pathType := networkingv1.PathTypePrefix
+	f.add(&networkingv1.Ingress{
+		ObjectMeta: f.meta("Ingress", Namespace, "shop", nil, 2*24*time.Hour),
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "shop.demo.local",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: []networkingv1.HTTPIngressPath{{
+				Path:     "/",
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+					Name: "web",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				}},
+			}}}},
+		}}},
+	})
+	f.add(&networkingv1.NetworkPolicy{
+		ObjectMeta: f.meta("NetworkPolicy", Namespace, "postgres-from-api", nil, 6*24*time.Hour),
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "postgres"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}}},
+			}},
+		},
+	})
+	minReplicas, cpuTarget := int32(3), int32(70)
+	f.add(&autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: f.meta("HorizontalPodAutoscaler", Namespace, "web", nil, 2*24*time.Hour),
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   corev1.ResourceCPU,
+					Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &cpuTarget},
+				},
+			}},
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{CurrentReplicas: 3, DesiredReplicas: 3},
+	})
+	f.cronJob(Namespace, "nightly-report", "busybox:1.36", "0 2 * * *")
+
+	// monitoring
+	f.daemonSet("monitoring", "node-exporter", "quay.io/prometheus/node-exporter:v1.8.2", 20*24*time.Hour)
+
+	return f.objects
+}
+
+// fixtures builds the demo objects, wiring owner references and pods to nodes
+type fixtures struct {
+	now     time.Time
+	objects []runtime.Object
+	pods    int
+}
+
+func (f *fixtures) add(objects ...runtime.Object) {
+	f.objects = append(f.objects, objects...)
+}
+
+// uid returns a stable uid, so owner references can be written before their owner
+func uid(kind, namespace, name string) types.UID {
+	return types.UID(uuid.NewSHA1(uuid.NameSpaceOID, []byte(kind+"/"+namespace+"/"+name)).String())
+}
+
+func (f *fixtures) meta(kind, namespace, name string, labels map[string]string, age time.Duration) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         namespace,
+		UID:               uid(kind, namespace, name),
+		Labels:            labels,
+		CreationTimestamp: metav1.NewTime(f.now.Add(-age).Truncate(time.Second)),
+		Generation:        1,
+	}
+}
+
+func ownedBy(kind, apiVersion, namespace, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		UID:        uid(kind, namespace, name),
+		Controller: &controller,
+	}}
+}
+
+func (f *fixtures) namespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: f.meta("Namespace", "", name, map[string]string{"kubernetes.io/metadata.name": name}, 30*24*time.Hour),
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}
+}
+
+func (f *fixtures) node(name string) *corev1.Node {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:    apiresource.MustParse("4"),
+		corev1.ResourceMemory: apiresource.MustParse("16Gi"),
+		corev1.ResourcePods:   apiresource.MustParse("110"),
+	}
+	return &corev1.Node{
+		ObjectMeta: f.meta("Node", "", name, map[string]string{
+			"kubernetes.io/hostname":           name,
+			"kubernetes.io/os":                 "linux",
+			"node.kubernetes.io/instance-type": "demo.large",
+		}, 30*24*time.Hour),
+		Status: corev1.NodeStatus{
+			Capacity:    capacity,
+			Allocatable: capacity,
+			Conditions: []corev1.NodeCondition{{
+				Type:               corev1.NodeReady,
+				Status:             corev1.ConditionTrue,
+				Reason:             "KubeletReady",
+				Message:            "kubelet is posting ready status",
+				LastHeartbeatTime:  metav1.NewTime(f.now),
+				LastTransitionTime: metav1.NewTime(f.now.Add(-30 * 24 * time.Hour)),
+			}},
+			NodeInfo: corev1.NodeSystemInfo{
+				KubeletVersion:          "v1.32.0",
+				ContainerRuntimeVersion: "containerd://1.7.22",
+				OSImage:                 "Debian GNU/Linux 12 (bookworm)",
+				OperatingSystem:         "linux",
+				Architecture:            "amd64",
+			},
+		},
+	}
+}
+
+func (f *fixtures) service(namespace, name string, selector map[string]string, port, targetPort int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: f.meta("Service", namespace, name, selector, 6*24*time.Hour),
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			Selector:  selector,
+			ClusterIP: "10.96.0." + strconv.Itoa(10+len(f.objects)%200),
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       port,
+				TargetPort: intstr.FromInt32(targetPort),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
+
+func container(name, image string) corev1.Container {
+	return corev1.Container{
+		Name:  name,
+		Image: image,
+		Ports: []corev1.ContainerPort{{ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    apiresource.MustParse("100m"),
+				corev1.ResourceMemory: apiresource.MustParse("128Mi"),
+			},
+			Limits: corev1.ResourceList{corev1.ResourceMemory: apiresource.MustParse("256Mi")},
+		},
+	}
+}
+
+func podTemplate(labels map[string]string, name, image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{container(name, image)}},
+	}
+}
+
+// pod returns a running pod of a template, scheduled on the demo nodes in turn
+func (f *fixtures) pod(namespace, name string, template corev1.PodTemplateSpec, owners []metav1.OwnerReference, age time.Duration) *corev1.Pod {
+	f.pods++
+	objectMeta := f.meta("Pod", namespace, name, template.Labels, age)
+	objectMeta.OwnerReferences = owners
+	spec := *template.Spec.DeepCopy()
+	spec.NodeName = "demo-node-" + strconv.Itoa(1+f.pods%2)
+
+	started := metav1.NewTime(objectMeta.CreationTimestamp.Add(5 * time.Second))
+	statuses := []corev1.ContainerStatus{}
+	for _, c := range spec.Containers {
+		statuses = append(statuses, corev1.ContainerStatus{
+			Name:         c.Name,
+			Image:        c.Image,
+			ImageID:      c.Image + "@sha256:" + string(uid("Image", "", c.Image))[:8],
+			ContainerID:  "containerd://" + string(uid("Container", namespace, name+c.Name)),
+			Ready:        true,
+			Started:      boolPtr(true),
+			State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}},
+			RestartCount: 0,
+		})
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: objectMeta,
+		Spec:       spec,
+		Status: corev1.PodStatus{
+			Phase:     corev1.PodRunning,
+			HostIP:    "192.168.49." + strconv.Itoa(1+f.pods%2),
+			PodIP:     "10.244.0." + strconv.Itoa(10+f.pods),
+			StartTime: &objectMeta.CreationTimestamp,
+			QOSClass:  corev1.PodQOSBurstable,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: objectMeta.CreationTimestamp},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: started},
+				{Type: corev1.ContainersReady, Status: corev1.ConditionTrue, LastTransitionTime: started},
+			},
+			ContainerStatuses: statuses,
+		},
+	}
+}
+
+// crashLoop turns a running pod into one whose container keeps exiting
+func crashLoop(pod *corev1.Pod, now time.Time) {
+	status := &pod.Status.ContainerStatuses[0]
+	status.Ready = false
+	status.Started = boolPtr(false)
+	status.RestartCount = 14
+	status.State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+		Reason:  "CrashLoopBackOff",
+		Message: "back-off 5m0s restarting failed container=" + status.Name + " pod=" + pod.Name,
+	}}
+	status.LastTerminationState = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		ExitCode:   1,
+		Reason:     "Error",
+		StartedAt:  metav1.NewTime(now.Add(-3 * time.Minute)),
+		FinishedAt: metav1.NewTime(now.Add(-3*time.Minute + 2*time.Second)),
+	}}
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type != corev1.PodScheduled {
+			pod.Status.Conditions[i].Status = corev1.ConditionFalse
+			pod.Status.Conditions[i].Reason = "ContainersNotReady"
+		}
+	}
+}
+
+// deployment adds a deployment with its replica set and pods. change adjusts the pods before they
+// are added.
+func (f *fixtures) deployment(namespace, name, image string, replicas int32, age time.Duration, change func(*corev1.Pod, int)) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	template := podTemplate(labels, name, image)
+	hash := string(uid("ReplicaSet", namespace, name))[:10]
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: f.meta("Deployment", namespace, name, labels, age),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: template,
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      replicas,
+			AvailableReplicas:  replicas,
+			Conditions: []appsv1.DeploymentCondition{{
+				Type:   appsv1.DeploymentAvailable,
+				Status: corev1.ConditionTrue,
+				Reason: "MinimumReplicasAvailable",
+			}},
+		},
+	}
+	f.add(deployment)
+
+	rsName := name + "-" + hash
+	rsLabels := map[string]string{"app": name, "pod-template-hash": hash}
+	rsTemplate := podTemplate(rsLabels, name, image)
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: f.meta("ReplicaSet", namespace, rsName, rsLabels, age),
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: rsLabels},
+			Template: rsTemplate,
+		},
+		Status: appsv1.ReplicaSetStatus{Replicas: replicas, ReadyReplicas: replicas, AvailableReplicas: replicas, ObservedGeneration: 1},
+	}
+	rs.OwnerReferences = ownedBy("Deployment", "apps/v1", namespace, name)
+	f.add(rs)
+
+	suffixes := []string{"x2k4p", "m8qzt", "c7vnd", "h5wrb", "j9lfs"}
+	for i := 0; i < int(replicas); i++ {
+		pod := f.pod(namespace, rsName+"-"+suffixes[i%len(suffixes)], rsTemplate, ownedBy("ReplicaSet", "apps/v1", namespace, rsName), age)
+		if change != nil {
+			change(pod, i)
+		}
+		f.add(pod)
+		if pod.Status.ContainerStatuses[0].State.Waiting != nil {
+			f.event(pod, "BackOff", "Back-off restarting failed container "+pod.Spec.Containers[0].Name+" in pod "+pod.Name, corev1.EventTypeWarning, 14)
+		}
+	}
+	return deployment
+}
+
+// statefulSet adds a single replica stateful set with its pod, claim and bound volume
+func (f *fixtures) statefulSet(namespace, name, image string, age time.Duration) {
+	labels := map[string]string{"app": name}
+	replicas := int32(1)
+	template := podTemplate(labels, name, image)
+	template.Spec.Containers[0].Ports[0].ContainerPort = 5432
+	template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/var/lib/postgresql/data"}}
+	template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{{
+		SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name + "-credentials"}},
+	}}
+	storageClass := "standard"
+	claimSpec := corev1.PersistentVolumeClaimSpec{
+		AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		StorageClassName: &storageClass,
+		Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: apiresource.MustParse("10Gi")}},
+	}
+
+	f.add(&appsv1.StatefulSet{
+		ObjectMeta: f.meta("StatefulSet", namespace, name, labels, age),
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template:    template,
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec:       claimSpec,
+			}},
+		},
+		Status: appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 1, ReadyReplicas: 1, CurrentReplicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	})
+
+	claimName := "data-" + name + "-0"
+	volumeName := "pvc-" + string(uid("PersistentVolumeClaim", namespace, claimName))
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: f.meta("PersistentVolumeClaim", namespace, claimName, labels, age),
+		Spec:       claimSpec,
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:       corev1.ClaimBound,
+			AccessModes: claimSpec.AccessModes,
+			Capacity:    claimSpec.Resources.Requests,
+		},
+	}
+	claim.Spec.VolumeName = volumeName
+	f.add(claim)
+	f.add(&corev1.PersistentVolume{
+		ObjectMeta: f.meta("PersistentVolume", "", volumeName, nil, age),
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:                      claimSpec.Resources.Requests,
+			AccessModes:                   claimSpec.AccessModes,
+			StorageClassName:              storageClass,
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			ClaimRef:                      &corev1.ObjectReference{Kind: "PersistentVolumeClaim", Namespace: namespace, Name: claimName, UID: claim.UID},
+			PersistentVolumeSource:        corev1.PersistentVolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/local-path-provisioner/" + volumeName}},
+		},
+		Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeBound},
+	})
+
+	pod := f.pod(namespace, name+"-0", template, ownedBy("StatefulSet", "apps/v1", namespace, name), age)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name:         "data",
+		VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName}},
+	})
+	f.add(pod)
+}
+
+// daemonSet adds a daemon set with a pod on every demo node
+func (f *fixtures) daemonSet(namespace, name, image string, age time.Duration) {
+	labels := map[string]string{"app": name}
+	template := podTemplate(labels, name, image)
+	template.Spec.HostNetwork = true
+	f.add(&appsv1.DaemonSet{
+		ObjectMeta: f.meta("DaemonSet", namespace, name, labels, age),
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: template,
+		},
+		Status: appsv1.DaemonSetStatus{
+			ObservedGeneration:     1,
+			CurrentNumberScheduled: 2,
+			DesiredNumberScheduled: 2,
+			NumberReady:            2,
+			NumberAvailable:        2,
+			UpdatedNumberScheduled: 2,
+		},
+	})
+	for _, suffix := range []string{"4tq8n", "zb2kc"} {
+		f.add(f.pod(namespace, name+"-"+suffix, template, ownedBy("DaemonSet", "apps/v1", namespace, name), age))
+	}
+}
+
+// cronJob adds a cron job with the job of its last run, which completed
+func (f *fixtures) cronJob(namespace, name, image, schedule string) {
+	labels := map[string]string{"app": name}
+	template := podTemplate(labels, name, image)
+	template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+	template.Spec.Containers[0].Ports = nil
+	template.Spec.Containers[0].Command = []string{"sh", "-c", "echo generating report"}
+
+	lastRun := time.Date(f.now.Year(), f.now.Month(), f.now.Day(), 2, 0, 0, 0, f.now.Location())
+	if lastRun.After(f.now) {
+		lastRun = lastRun.Add(-24 * time.Hour)
+	}
+	lastSchedule := metav1.NewTime(lastRun)
+	completed := metav1.NewTime(lastRun.Add(40 * time.Second))
+
+	f.add(&batchv1.CronJob{
+		ObjectMeta: f.meta("CronJob", namespace, name, labels, 20*24*time.Hour),
+		Spec: batchv1.CronJobSpec{
+			Schedule:    schedule,
+			JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}},
+		},
+		Status: batchv1.CronJobStatus{LastScheduleTime: &lastSchedule, LastSuccessfulTime: &completed},
+	})
+
+	jobName := name + "-" + strconv.Itoa(int(lastRun.Unix()/60))
+	job := &batchv1.Job{
+		ObjectMeta: f.meta("Job", namespace, jobName, labels, f.now.Sub(lastRun)),
+		Spec:       batchv1.JobSpec{Template: template},
+		Status: batchv1.JobStatus{
+			Succeeded:      1,
+			StartTime:      &lastSchedule,
+			CompletionTime: &completed,
+			Conditions: []batchv1.JobCondition{{
+				Type:   batchv1.JobComplete,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	job.OwnerReferences = ownedBy("CronJob", "batch/v1", namespace, name)
+	f.add(job)
+
+	pod := f.pod(namespace, jobName+"-r7d2w", template, ownedBy("Job", "batch/v1", namespace, jobName), f.now.Sub(lastRun))
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses[0].Ready = false
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		ExitCode:   0,
+		Reason:     "Completed",
+		StartedAt:  lastSchedule,
+		FinishedAt: completed,
+	}}
+	f.add(pod)
+}
+
+// event adds an event about a pod, repeated count times up to now
+func (f *fixtures) event(pod *corev1.Pod, reason, message, eventType string, count int32) {
+	name := pod.Name + "." + reason
+	f.add(&corev1.Event{
+		ObjectMeta: f.meta("Event", pod.Namespace, name, nil, time.Hour),
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Pod",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        pod.UID,
+			APIVersion: "v1",
+			FieldPath:  "spec.containers{" + pod.Spec.Containers[0].Name + "}",
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Count:          count,
+		FirstTimestamp: metav1.NewTime(f.now.Add(-time.Hour)),
+		LastTimestamp:  metav1.NewTime(f.now.Add(-time.Minute)),
+		Source:         corev1.EventSource{Component: "kubelet", Host: pod.Spec.NodeName},
+	})
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
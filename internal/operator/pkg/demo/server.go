@@ -0,0 +1,1087 @@
+package demo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/uuid"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+const maxBodySize = 10 << 20
+
+// Server serves the Kubernetes REST API from the object tracker of a fake clientset. It covers what
+// the operator and kubectl-style clients use: discovery, CRUD, patches, watches, label and field
+// selectors, and the status, scale and log subresources. No controller runs, objects change only
+// when a client writes them.
+type Server struct {
+	mu        sync.RWMutex
+	clientset *fake.Clientset
+	// reset is closed when the objects are reseeded, ending the watches of the old tracker
+	reset chan struct{}
+
+	// resourceVersion is the last resource version handed out
+	resourceVersion atomic.Int64
+
+	listener  net.Listener
+	server    *http.Server
+	startedAt time.Time
+}
+
+// NewServer creates a server holding the objects
+func NewServer(objects []runtime.Object) (*Server, error) {
+	s := &Server{}
+	if err := s.Seed(objects); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Seed replaces the objects of the server. Open watches are closed, so clients list again.
+func (s *Server) Seed(objects []runtime.Object) error {
+	clientset := fake.NewSimpleClientset()
+	for _, obj := range objects {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return err
+		}
+		res, ok := lookupKind(gvks[0])
+		if !ok {
+			return fmt.Errorf("demo cluster doesn't serve %s", gvks[0])
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		s.stamp(accessor, accessor.GetUID() == "")
+		if err := clientset.Tracker().Create(res.gvr, obj, accessor.GetNamespace()); err != nil {
+			return fmt.Errorf("failed to seed %s %s: %w", res.kind, accessor.GetName(), err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reset != nil {
+		close(s.reset)
+	}
+	s.clientset = clientset
+	s.reset = make(chan struct{})
+	return nil
+}
+
+// Clientset returns a clientset working on the objects of the server without going through HTTP
+func (s *Server) Clientset() kubernetes.Interface {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientset
+}
+
+// Start serves the API on a free loopback port
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	s.startedAt = time.Now()
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return nil
+}
+
+// URL returns the address the server listens on
+func (s *Server) URL() string {
+	if s.listener == nil {
+		return ""
+	}
+	return "http://" + s.listener.Addr().String()
+}
+
+// Close stops serving, open watches included
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) state() (k8stesting.ObjectTracker, chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientset.Tracker(), s.reset
+}
+
+// stamp sets the resource version of an object written to the tracker, and the identity of a new one
+func (s *Server) stamp(accessor metav1.Object, created bool) {
+	if created {
+		if accessor.GetUID() == "" {
+			accessor.SetUID(types.UID(uuid.NewString()))
+		}
+		if accessor.GetCreationTimestamp().Time.IsZero() {
+			accessor.SetCreationTimestamp(metav1.Now())
+		}
+	}
+	accessor.SetResourceVersion(strconv.FormatInt(s.resourceVersion.Add(1), 10))
+}
+
+// request is a resource request parsed from its path
+type request struct {
+	resource  resource
+	namespace string
+	name      string
+	// subresource is status, scale, log or finalize
+	subresource string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch path {
+	case "healthz", "livez", "readyz":
+		_, _ = w.Write([]byte("ok"))
+		return
+	case "version":
+		writeJSON(w, http.StatusOK, &version.Info{
+			Major:      "1",
+			Minor:      "32",
+			GitVersion: "v1.32.0-demo",
+			Platform:   "linux/amd64",
+		})
+		return
+	case "api":
+		writeJSON(w, http.StatusOK, &metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: []string{"v1"},
+			ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
+				{ClientCIDR: "0.0.0.0/0", ServerAddress: r.Host},
+			},
+		})
+		return
+	case "apis":
+		writeJSON(w, http.StatusOK, apiGroupList())
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	var gv schema.GroupVersion
+	var rest []string
+	switch {
+	case parts[0] == "api" && len(parts) >= 2:
+		gv, rest = schema.GroupVersion{Version: parts[1]}, parts[2:]
+	case parts[0] == "apis" && len(parts) == 2:
+		for _, group := range apiGroupList().Groups {
+			if group.Name == parts[1] {
+				group.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+				writeJSON(w, http.StatusOK, &group)
+				return
+			}
+		}
+	case parts[0] == "apis" && len(parts) >= 3:
+		gv, rest = schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:]
+	}
+	if gv.Version == "" {
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, path))
+		return
+	}
+	if len(rest) == 0 {
+		list, ok := apiResourceList(gv)
+		if !ok {
+			writeError(w, apierrors.NewNotFound(schema.GroupResource{}, path))
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	req, err := parseRequest(gv, rest)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.serve(w, r, req)
+}
+
+// parseRequest parses the path of a resource request after the group version, e.g.
+// namespaces/shop/deployments/web/scale
+func parseRequest(gv schema.GroupVersion, parts []string) (request, error) {
+	req := request{}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		if res, ok := lookupResource(gv, parts[2]); ok && res.namespaced {
+			req.namespace = parts[1]
+			parts = parts[2:]
+		}
+	}
+
+	res, ok := lookupResource(gv, parts[0])
+	if !ok || len(parts) > 3 {
+		return req, apierrors.NewNotFound(gv.WithResource(parts[0]).GroupResource(), strings.Join(parts, "/"))
+	}
+	req.resource = res
+	if len(parts) > 1 {
+		req.name = parts[1]
+	}
+	if len(parts) > 2 {
+		req.subresource = parts[2]
+	}
+	return req, nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, req request) {
+	gr := req.resource.gvr.GroupResource()
+	scale := req.subresource == "scale" && req.resource.scalable
+	switch {
+	case req.subresource != "" && req.subresource != "status" && req.subresource != "finalize" &&
+		!scale && !(req.subresource == "log" && gr.Resource == "pods"):
+		writeError(w, apierrors.NewNotFound(gr, req.name+"/"+req.subresource))
+
+	case r.Method == http.MethodGet && req.name == "" && isWatch(r):
+		s.watch(w, r, req)
+	case r.Method == http.MethodGet && req.name == "":
+		s.list(w, r, req)
+	case r.Method == http.MethodGet && req.subresource == "log":
+		s.log(w, r, req)
+	case r.Method == http.MethodGet && scale:
+		s.getScale(w, r, req)
+	case r.Method == http.MethodGet:
+		s.get(w, r, req)
+
+	case r.Method == http.MethodPost && req.name == "":
+		s.create(w, r, req)
+	case r.Method == http.MethodPut && scale:
+		s.updateScale(w, r, req)
+	case r.Method == http.MethodPut && req.name != "":
+		s.update(w, r, req)
+	case r.Method == http.MethodPatch && scale:
+		s.patchScale(w, r, req)
+	case r.Method == http.MethodPatch && req.name != "":
+		s.patch(w, r, req)
+	case r.Method == http.MethodDelete && req.name == "":
+		s.deleteCollection(w, r, req)
+	case r.Method == http.MethodDelete && req.subresource == "":
+		s.delete(w, r, req)
+
+	default:
+		writeError(w, apierrors.NewMethodNotSupported(gr, r.Method))
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, req request) {
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeObject(w, r, http.StatusOK, req.resource, obj)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, req request) {
+	sel, err := parseSelector(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list, err := s.listObjects(req, sel)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeObject(w, r, http.StatusOK, req.resource, list)
+}
+
+// listObjects lists the objects of a request matching the selector
+func (s *Server) listObjects(req request, sel selector) (runtime.Object, error) {
+	tracker, _ := s.state()
+	list, err := tracker.List(req.resource.gvr, req.resource.gvk(), req.namespace)
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	matching := []runtime.Object{}
+	for _, item := range items {
+		if sel.matches(item) {
+			matching = append(matching, item)
+		}
+	}
+	if err := meta.SetList(list, matching); err != nil {
+		return nil, err
+	}
+	if listMeta, err := meta.ListAccessor(list); err == nil {
+		listMeta.SetResourceVersion(strconv.FormatInt(s.resourceVersion.Load(), 10))
+	}
+	return list, nil
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, req request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	obj, err := decode(req.resource, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.createObject(w, r, req, obj)
+}
+
+func (s *Server) createObject(w http.ResponseWriter, r *http.Request, req request, obj runtime.Object) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if req.resource.namespaced {
+		if accessor.GetNamespace() == "" {
+			accessor.SetNamespace(req.namespace)
+		} else if accessor.GetNamespace() != req.namespace {
+			writeError(w, apierrors.NewBadRequest("the namespace of the object does not match the namespace of the request"))
+			return
+		}
+	}
+	if accessor.GetName() == "" && accessor.GetGenerateName() != "" {
+		accessor.SetName(accessor.GetGenerateName() + utilrand.String(5))
+	}
+	if accessor.GetName() == "" {
+		writeError(w, apierrors.NewBadRequest("name or generateName is required"))
+		return
+	}
+	if accessor.GetResourceVersion() != "" {
+		writeError(w, apierrors.NewBadRequest("resourceVersion should not be set on objects to be created"))
+		return
+	}
+	if accessor.GetGeneration() == 0 {
+		accessor.SetGeneration(1)
+	}
+	s.stamp(accessor, true)
+
+	if !isDryRun(r) {
+		tracker, _ := s.state()
+		if err := tracker.Create(req.resource.gvr, obj, accessor.GetNamespace()); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeObject(w, r, http.StatusCreated, req.resource, obj)
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, req request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	obj, err := decode(req.resource, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.store(w, r, req, obj)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, req request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	kind := patchType(r)
+
+	tracker, _ := s.state()
+	existing, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if apierrors.IsNotFound(err) && kind == types.ApplyPatchType && req.subresource == "" {
+		// Applying an object that doesn't exist creates it
+		obj, err := decode(req.resource, body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		s.createObject(w, r, req, obj)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	original, err := json.Marshal(existing)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	patched, err := applyPatch(kind, original, body, newObject(req.resource))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	obj := newObject(req.resource)
+	if err := json.Unmarshal(patched, obj); err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	s.store(w, r, req, obj)
+}
+
+// store replaces an existing object, or only its status for the status subresource
+func (s *Server) store(w http.ResponseWriter, r *http.Request, req request, obj runtime.Object) {
+	gr := req.resource.gvr.GroupResource()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if req.resource.namespaced && accessor.GetNamespace() == "" {
+		accessor.SetNamespace(req.namespace)
+	}
+	if accessor.GetName() != req.name || accessor.GetNamespace() != req.namespace {
+		writeError(w, apierrors.NewBadRequest("the name and namespace of the object must match the request"))
+		return
+	}
+
+	tracker, _ := s.state()
+	existing, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	existingMeta, err := meta.Accessor(existing)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if rv := accessor.GetResourceVersion(); rv != "" && rv != existingMeta.GetResourceVersion() {
+		writeError(w, apierrors.NewConflict(gr, req.name,
+			errors.New("the object has been modified; please apply your changes to the latest version and try again")))
+		return
+	}
+
+	// The status subresource changes only the status, other writes keep it
+	if req.subresource == "status" {
+		obj, err = withStatus(req.resource, existing, obj)
+	} else {
+		obj, err = withStatus(req.resource, obj, existing)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	accessor, _ = meta.Accessor(obj)
+	accessor.SetUID(existingMeta.GetUID())
+	accessor.SetCreationTimestamp(existingMeta.GetCreationTimestamp())
+	if req.subresource == "" {
+		accessor.SetGeneration(existingMeta.GetGeneration() + 1)
+	} else {
+		accessor.SetGeneration(existingMeta.GetGeneration())
+	}
+	s.stamp(accessor, false)
+
+	if !isDryRun(r) {
+		if err := tracker.Update(req.resource.gvr, obj, req.namespace); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeObject(w, r, http.StatusOK, req.resource, obj)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, req request) {
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !isDryRun(r) {
+		if err := s.deleteObject(tracker, req.resource, req.namespace, req.name); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeObject(w, r, http.StatusOK, req.resource, obj)
+}
+
+// deleteObject deletes an object, and the objects in it for a namespace
+func (s *Server) deleteObject(tracker k8stesting.ObjectTracker, res resource, namespace, name string) error {
+	if res.gvr.Group == "" && res.gvr.Resource == "namespaces" {
+		for _, namespaced := range resources {
+			if !namespaced.namespaced {
+				continue
+			}
+			list, err := tracker.List(namespaced.gvr, namespaced.gvk(), name)
+			if err != nil {
+				return err
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if accessor, err := meta.Accessor(item); err == nil {
+					_ = tracker.Delete(namespaced.gvr, name, accessor.GetName())
+				}
+			}
+		}
+	}
+	return tracker.Delete(res.gvr, namespace, name)
+}
+
+func (s *Server) deleteCollection(w http.ResponseWriter, r *http.Request, req request) {
+	sel, err := parseSelector(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list, err := s.listObjects(req, sel)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !isDryRun(r) {
+		tracker, _ := s.state()
+		items, _ := meta.ExtractList(list)
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				continue
+			}
+			if err := s.deleteObject(tracker, req.resource, accessor.GetNamespace(), accessor.GetName()); err != nil && !apierrors.IsNotFound(err) {
+				writeError(w, err)
+				return
+			}
+		}
+	}
+	writeObject(w, r, http.StatusOK, req.resource, list)
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, req request) {
+	sel, err := parseSelector(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tracker, reset := s.state()
+	watcher, err := tracker.Watch(req.resource.gvr, req.namespace)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer watcher.Stop()
+
+	var timeout <-chan time.Time
+	if seconds, err := strconv.Atoi(r.URL.Query().Get("timeoutSeconds")); err == nil && seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-reset:
+			return
+		case <-timeout:
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if !sel.matches(event.Object) {
+				continue
+			}
+			data, err := encode(r, req.resource, event.Object)
+			if err != nil {
+				return
+			}
+			line, err := json.Marshal(metav1.WatchEvent{Type: string(event.Type), Object: runtime.RawExtension{Raw: data}})
+			if err != nil {
+				return
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// demoLog is the log every demo container writes
+var demoLog = []string{
+	"starting %s",
+	"loaded configuration from /etc/%s",
+	"listening on :8080",
+	"GET /healthz 200 0.4ms",
+	"GET /api/orders 200 12.8ms",
+	"POST /api/orders 201 31.2ms",
+	"GET /healthz 200 0.3ms",
+}
+
+func (s *Server) log(w http.ResponseWriter, r *http.Request, req request) {
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	container := r.URL.Query().Get("container")
+	if container == "" {
+		container = req.name
+	}
+	timestamps := r.URL.Query().Get("timestamps") == "true"
+	start := time.Now().Add(-time.Duration(len(demoLog)) * time.Minute)
+	if accessor, err := meta.Accessor(obj); err == nil && !accessor.GetCreationTimestamp().Time.IsZero() {
+		start = accessor.GetCreationTimestamp().Time
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	for i, line := range demoLog {
+		if strings.Contains(line, "%s") {
+			line = fmt.Sprintf(line, container)
+		}
+		if timestamps {
+			line = start.Add(time.Duration(i)*time.Second).UTC().Format(time.RFC3339Nano) + " " + line
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+func (s *Server) getScale(w http.ResponseWriter, r *http.Request, req request) {
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	scale, err := scaleOf(obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scale)
+}
+
+func (s *Server) updateScale(w http.ResponseWriter, r *http.Request, req request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	scale := &autoscalingv1.Scale{}
+	if err := json.Unmarshal(body, scale); err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	s.scale(w, r, req, scale)
+}
+
+func (s *Server) patchScale(w http.ResponseWriter, r *http.Request, req request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	current, err := scaleOf(obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	original, err := json.Marshal(current)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	patched, err := applyPatch(patchType(r), original, body, &autoscalingv1.Scale{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	scale := &autoscalingv1.Scale{}
+	if err := json.Unmarshal(patched, scale); err != nil {
+		writeError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	s.scale(w, r, req, scale)
+}
+
+// scale sets the replicas of a scalable object. No controller runs, so the status follows the spec
+// at once.
+func (s *Server) scale(w http.ResponseWriter, r *http.Request, req request, scale *autoscalingv1.Scale) {
+	tracker, _ := s.state()
+	obj, err := tracker.Get(req.resource.gvr, req.namespace, req.name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if rv := scale.ResourceVersion; rv != "" && rv != accessor.GetResourceVersion() {
+		writeError(w, apierrors.NewConflict(req.resource.gvr.GroupResource(), req.name,
+			errors.New("the object has been modified; please apply your changes to the latest version and try again")))
+		return
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	replicas := int64(scale.Spec.Replicas)
+	_ = unstructured.SetNestedField(content, replicas, "spec", "replicas")
+	for _, field := range []string{"replicas", "readyReplicas", "availableReplicas", "updatedReplicas", "currentReplicas"} {
+		_ = unstructured.SetNestedField(content, replicas, "status", field)
+	}
+	scaled := newObject(req.resource)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, scaled); err != nil {
+		writeError(w, err)
+		return
+	}
+	scaledMeta, _ := meta.Accessor(scaled)
+	scaledMeta.SetGeneration(accessor.GetGeneration() + 1)
+	s.stamp(scaledMeta, false)
+
+	if !isDryRun(r) {
+		if err := tracker.Update(req.resource.gvr, scaled, req.namespace); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	result, err := scaleOf(scaled)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// scaleOf returns the scale subresource of a deployment, replica set or stateful set
+func scaleOf(obj runtime.Object) (*autoscalingv1.Scale, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	specReplicas, _, _ := unstructured.NestedInt64(content, "spec", "replicas")
+	statusReplicas, _, _ := unstructured.NestedInt64(content, "status", "replicas")
+
+	selector := ""
+	if raw, ok, _ := unstructured.NestedMap(content, "spec", "selector"); ok {
+		labelSelector := &metav1.LabelSelector{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, labelSelector); err == nil {
+			if parsed, err := metav1.LabelSelectorAsSelector(labelSelector); err == nil {
+				selector = parsed.String()
+			}
+		}
+	}
+
+	return &autoscalingv1.Scale{
+		TypeMeta: metav1.TypeMeta{Kind: "Scale", APIVersion: autoscalingv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              accessor.GetName(),
+			Namespace:         accessor.GetNamespace(),
+			UID:               accessor.GetUID(),
+			ResourceVersion:   accessor.GetResourceVersion(),
+			CreationTimestamp: accessor.GetCreationTimestamp(),
+		},
+		Spec:   autoscalingv1.ScaleSpec{Replicas: int32(specReplicas)},
+		Status: autoscalingv1.ScaleStatus{Replicas: int32(statusReplicas), Selector: selector},
+	}, nil
+}
+
+// withStatus returns obj with the status of from
+func withStatus(res resource, obj, from runtime.Object) (runtime.Object, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	fromContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(from)
+	if err != nil {
+		return nil, err
+	}
+	if status, ok := fromContent["status"]; ok {
+		content["status"] = status
+	} else {
+		delete(content, "status")
+	}
+
+	out := newObject(res)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// applyPatch applies a JSON, merge, strategic merge or apply patch to the JSON of an object.
+// Apply patches are merged without field ownership.
+func applyPatch(patchType types.PatchType, original, patch []byte, dataStruct interface{}) ([]byte, error) {
+	var patched []byte
+	var err error
+	switch patchType {
+	case types.JSONPatchType:
+		var decoded jsonpatch.Patch
+		if decoded, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = decoded.Apply(original)
+		}
+	case types.MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case types.StrategicMergePatchType:
+		patched, err = strategicpatch.StrategicMergePatch(original, patch, dataStruct)
+	case types.ApplyPatchType:
+		var patchJSON []byte
+		if patchJSON, err = yaml.YAMLToJSON(patch); err == nil {
+			patched, err = jsonpatch.MergePatch(original, patchJSON)
+		}
+	default:
+		return nil, &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusUnsupportedMediaType,
+			Reason:  metav1.StatusReasonUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported patch type %q", patchType),
+		}}
+	}
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return patched, nil
+}
+
+func patchType(r *http.Request) types.PatchType {
+	contentType := r.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return types.PatchType(strings.TrimSpace(contentType))
+}
+
+// selector is the label and field selector of a list or watch
+type selector struct {
+	labels labels.Selector
+	fields fields.Selector
+}
+
+func parseSelector(r *http.Request) (selector, error) {
+	query := r.URL.Query()
+	labelSelector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return selector{}, apierrors.NewBadRequest(err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+	if err != nil {
+		return selector{}, apierrors.NewBadRequest(err.Error())
+	}
+	return selector{labels: labelSelector, fields: fieldSelector}, nil
+}
+
+func (s selector) matches(obj runtime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	if !s.labels.Matches(labels.Set(accessor.GetLabels())) {
+		return false
+	}
+	if s.fields.Empty() {
+		return true
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return false
+	}
+	return s.fields.Matches(fieldSet(content))
+}
+
+// fieldSet looks up field selectors, e.g. spec.nodeName or involvedObject.name, in any object
+type fieldSet map[string]interface{}
+
+func (f fieldSet) Has(field string) bool {
+	_, ok, _ := unstructured.NestedFieldNoCopy(f, strings.Split(field, ".")...)
+	return ok
+}
+
+func (f fieldSet) Get(field string) string {
+	value, ok, _ := unstructured.NestedFieldNoCopy(f, strings.Split(field, ".")...)
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func isWatch(r *http.Request) bool {
+	watch := r.URL.Query().Get("watch")
+	return watch == "true" || watch == "1"
+}
+
+func isDryRun(r *http.Request) bool {
+	return len(r.URL.Query()["dryRun"]) > 0
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return body, nil
+}
+
+// decode decodes a JSON or YAML object of a resource
+func decode(res resource, body []byte) (runtime.Object, error) {
+	gvk := res.gvk()
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, &gvk, nil)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	if kind := obj.GetObjectKind().GroupVersionKind(); kind != gvk {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected %s, got %s", gvk, kind))
+	}
+	return obj, nil
+}
+
+func newObject(res resource) runtime.Object {
+	obj, err := scheme.Scheme.New(res.gvk())
+	if err != nil {
+		return &unstructured.Unstructured{}
+	}
+	return obj
+}
+
+// encode encodes an object or list as JSON, as partial object metadata when the client asks for it,
+// like the metadata informers do
+func encode(r *http.Request, res resource, obj runtime.Object) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadata") {
+		return runtime.Encode(scheme.Codecs.LegacyCodec(res.gvr.GroupVersion()), obj)
+	}
+
+	partialMeta := metav1.TypeMeta{Kind: "PartialObjectMetadata", APIVersion: metav1.SchemeGroupVersion.String()}
+	if !meta.IsListType(obj) {
+		partial, err := partialMetadata(obj)
+		if err != nil {
+			return nil, err
+		}
+		partial.TypeMeta = partialMeta
+		return json.Marshal(partial)
+	}
+
+	list := &metav1.PartialObjectMetadataList{
+		TypeMeta: metav1.TypeMeta{Kind: "PartialObjectMetadataList", APIVersion: metav1.SchemeGroupVersion.String()},
+	}
+	if listMeta, err := meta.ListAccessor(obj); err == nil {
+		list.ResourceVersion = listMeta.GetResourceVersion()
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		partial, err := partialMetadata(item)
+		if err != nil {
+			return nil, err
+		}
+		partial.TypeMeta = partialMeta
+		list.Items = append(list.Items, *partial)
+	}
+	return json.Marshal(list)
+}
+
+func partialMetadata(obj runtime.Object) (*metav1.PartialObjectMetadata, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	partial := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(data, partial); err != nil {
+		return nil, err
+	}
+	return partial, nil
+}
+
+func writeObject(w http.ResponseWriter, r *http.Request, status int, res resource, obj runtime.Object) {
+	data, err := encode(r, res, obj)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// writeError writes an error as a Status, like the API server
+func writeError(w http.ResponseWriter, err error) {
+	var apiStatus apierrors.APIStatus
+	if !errors.As(err, &apiStatus) {
+		apiStatus = apierrors.NewInternalError(err)
+	}
+	status := apiStatus.Status()
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	if status.Code == 0 {
+		status.Code = http.StatusInternalServerError
+	}
+
+	data, _ := json.Marshal(&status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(status.Code))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,191 @@
+package demo
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestParseRequest(t *testing.T) {
+	t.Parallel()
+
+	core := schema.GroupVersion{Version: "v1"}
+	apps := schema.GroupVersion{Group: "apps", Version: "v1"}
+
+	tests := []struct {
+		name        string
+		gv          schema.GroupVersion
+		path        []string
+		resource    string
+		namespace   string
+		objectName  string
+		subresource string
+		wantErr     bool
+	}{
+		{name: "cluster list", gv: core, path: []string{"pods"}, resource: "pods"},
+		{name: "namespaced list", gv: core, path: []string{"namespaces", "shop", "pods"}, resource: "pods", namespace: "shop"},
+		{name: "namespace object", gv: core, path: []string{"namespaces", "shop"}, resource: "namespaces", objectName: "shop"},
+		{name: "namespace finalize", gv: core, path: []string{"namespaces", "shop", "finalize"}, resource: "namespaces", objectName: "shop", subresource: "finalize"},
+		{name: "scale", gv: apps, path: []string{"namespaces", "shop", "deployments", "web", "scale"}, resource: "deployments", namespace: "shop", objectName: "web", subresource: "scale"},
+		{name: "cluster scoped object", gv: core, path: []string{"nodes", "demo-node-1"}, resource: "nodes", objectName: "demo-node-1"},
+		{name: "unknown resource", gv: core, path: []string{"widgets"}, wantErr: true},
+		{name: "resource of another group", gv: core, path: []string{"deployments"}, wantErr: true},
+		{name: "too deep", gv: apps, path: []string{"namespaces", "shop", "deployments", "web", "scale", "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := parseRequest(tt.gv, tt.path)
+			if tt.wantErr {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("parseRequest(%v) error = %v, want not found", tt.path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRequest(%v) error = %v", tt.path, err)
+			}
+			if req.resource.gvr.Resource != tt.resource || req.namespace != tt.namespace || req.name != tt.objectName || req.subresource != tt.subresource {
+				t.Errorf("parseRequest(%v) = %s %q %q %q, want %s %q %q %q", tt.path,
+					req.resource.gvr.Resource, req.namespace, req.name, req.subresource,
+					tt.resource, tt.namespace, tt.objectName, tt.subresource)
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T) kubernetes.Interface {
+	t.Helper()
+
+	server, err := NewServer(Objects(time.Now()))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: httpServer.URL})
+	if err != nil {
+		t.Fatalf("NewForConfig() error = %v", err)
+	}
+	return clientset
+}
+
+func TestServerReadsSeededResources(t *testing.T) {
+	t.Parallel()
+	clientset := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := clientset.Discovery().ServerVersion(); err != nil {
+		t.Fatalf("ServerVersion() error = %v", err)
+	}
+	if _, err := clientset.Discovery().ServerResourcesForGroupVersion("apps/v1"); err != nil {
+		t.Fatalf("ServerResourcesForGroupVersion(apps/v1) error = %v", err)
+	}
+
+	pods, err := clientset.CoreV1().Pods(Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=web"})
+	if err != nil {
+		t.Fatalf("listing pods: %v", err)
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("listed %d web pods, want 3", len(pods.Items))
+	}
+
+	events, err := clientset.CoreV1().Events(Namespace).List(ctx, metav1.ListOptions{FieldSelector: "reason=BackOff"})
+	if err != nil {
+		t.Fatalf("listing events: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Errorf("listed %d BackOff events, want 1", len(events.Items))
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=web"})
+	if err != nil || len(replicaSets.Items) != 1 {
+		t.Fatalf("listing web replica sets = %v, %v", replicaSets, err)
+	}
+	deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting deployment: %v", err)
+	}
+	if owner := replicaSets.Items[0].OwnerReferences[0]; owner.UID != deployment.UID {
+		t.Errorf("replica set owner uid = %s, want deployment uid %s", owner.UID, deployment.UID)
+	}
+}
+
+func TestServerWrites(t *testing.T) {
+	t.Parallel()
+	clientset := newTestClient(t)
+	ctx := context.Background()
+
+	watcher, err := clientset.CoreV1().ConfigMaps(Namespace).Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("watching configmaps: %v", err)
+	}
+	defer watcher.Stop()
+
+	created, err := clientset.CoreV1().ConfigMaps(Namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"},
+		Data:       map[string]string{"key": "value"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating configmap: %v", err)
+	}
+	if created.Name == "test-" || created.UID == "" || created.ResourceVersion == "" {
+		t.Errorf("created configmap %s uid %q resourceVersion %q, want generated name and identity", created.Name, created.UID, created.ResourceVersion)
+	}
+
+	select {
+	case event := <-watcher.ResultChan():
+		if event.Type != watch.Added || event.Object.(*corev1.ConfigMap).Name != created.Name {
+			t.Errorf("watch event = %s %v, want ADDED %s", event.Type, event.Object, created.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no watch event for the created configmap")
+	}
+
+	stale := created.DeepCopy()
+	if _, err := clientset.CoreV1().ConfigMaps(Namespace).Patch(ctx, created.Name, types.MergePatchType,
+		[]byte(`{"data":{"key":"patched"}}`), metav1.PatchOptions{}); err != nil {
+		t.Fatalf("patching configmap: %v", err)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps(Namespace).Update(ctx, stale, metav1.UpdateOptions{}); !apierrors.IsConflict(err) {
+		t.Errorf("updating a stale configmap error = %v, want conflict", err)
+	}
+
+	scale, err := clientset.AppsV1().Deployments(Namespace).GetScale(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting scale: %v", err)
+	}
+	scale.Spec.Replicas = 5
+	if _, err := clientset.AppsV1().Deployments(Namespace).UpdateScale(ctx, "web", scale, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("scaling deployment: %v", err)
+	}
+	deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting deployment: %v", err)
+	}
+	if *deployment.Spec.Replicas != 5 || deployment.Status.Replicas != 5 {
+		t.Errorf("scaled deployment replicas = %d/%d, want 5/5", *deployment.Spec.Replicas, deployment.Status.Replicas)
+	}
+
+	if err := clientset.CoreV1().Namespaces().Delete(ctx, "monitoring", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("deleting namespace: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods("monitoring").List(ctx, metav1.ListOptions{})
+	if err != nil || len(pods.Items) != 0 {
+		t.Errorf("pods left in a deleted namespace = %v, %v", pods, err)
+	}
+}
@@ -0,0 +1,99 @@
+package dispatchers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	config "github.com/agentkube/operator/config"
+	event "github.com/agentkube/operator/pkg/event"
+)
+
+// severities are the event statuses chain links filter on
+var severities = map[string]bool{"normal": true, "warning": true, "danger": true}
+
+// Filter selects the events a dispatcher of a chain receives, empty fields match every event
+type Filter struct {
+	ResourceTypes []string
+	Namespaces    []string
+	Severities    []string
+}
+
+// NewFilter builds the filter of a chain link, rejecting unknown severities
+func NewFilter(link config.ChainLink) (Filter, error) {
+	for _, severity := range link.Severities {
+		if !severities[strings.ToLower(severity)] {
+			return Filter{}, fmt.Errorf("unknown severity %q, expected Normal, Warning or Danger", severity)
+		}
+	}
+	return Filter{
+		ResourceTypes: link.ResourceTypes,
+		Namespaces:    link.Namespaces,
+		Severities:    link.Severities,
+	}, nil
+}
+
+// Matches reports whether the event passes the filter, resource types and severities compare case-insensitively
+func (f Filter) Matches(e event.Event) bool {
+	return matchesAny(f.ResourceTypes, e.Kind, strings.EqualFold) &&
+		matchesAny(f.Namespaces, e.Namespace, func(a, b string) bool { return a == b }) &&
+		matchesAny(f.Severities, e.Status, strings.EqualFold)
+}
+
+func matchesAny(values []string, value string, equal func(a, b string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Link is a dispatcher of a chain with the filter of the events it receives
+type Link struct {
+	Name       string
+	Dispatcher Dispatcher
+	Filter     Filter
+}
+
+// Chain fans events out to several dispatchers, in order, each receiving the events its filter matches
+type Chain struct {
+	Links []Link
+}
+
+// Init does nothing, the links are initialized when the chain is built
+func (c *Chain) Init(conf *config.Config) error {
+	return nil
+}
+
+// Handle hands the event to every matching dispatcher
+func (c *Chain) Handle(e event.Event) {
+	for _, link := range c.Links {
+		if link.Filter.Matches(e) {
+			link.Dispatcher.Handle(e)
+		}
+	}
+}
+
+// Send delivers the event to every matching dispatcher and returns the failed deliveries.
+// Dispatchers that don't report deliveries are handed the event and count as delivered.
+func (c *Chain) Send(e event.Event) error {
+	var errs []error
+	for _, link := range c.Links {
+		if !link.Filter.Matches(e) {
+			continue
+		}
+		sender, ok := link.Dispatcher.(Sender)
+		if !ok {
+			link.Dispatcher.Handle(e)
+			continue
+		}
+		if err := sender.Send(e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", link.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
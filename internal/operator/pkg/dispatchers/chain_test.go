@@ -0,0 +1,96 @@
+package dispatchers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	config "github.com/agentkube/operator/config"
+	event "github.com/agentkube/operator/pkg/event"
+)
+
+// recorder collects the names of the events it is sent, failing when err is set
+type recorder struct {
+	names []string
+	err   error
+}
+
+func (r *recorder) Init(c *config.Config) error { return nil }
+
+func (r *recorder) Handle(e event.Event) { _ = r.Send(e) }
+
+func (r *recorder) Send(e event.Event) error {
+	r.names = append(r.names, e.Name)
+	return r.err
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	events := []event.Event{
+		{Name: "web-deleted", Kind: "Pod", Namespace: "shop", Status: "Danger"},
+		{Name: "web-updated", Kind: "Pod", Namespace: "shop", Status: "Warning"},
+		{Name: "api-created", Kind: "Deployment", Namespace: "shop", Status: "Normal"},
+		{Name: "node-rebooted", Kind: "NodeRebooted", Status: "Danger"},
+	}
+
+	tests := []struct {
+		name string
+		link config.ChainLink
+		want []string
+	}{
+		{name: "no filters", want: []string{"web-deleted", "web-updated", "api-created", "node-rebooted"}},
+		{name: "severity", link: config.ChainLink{Severities: []string{"danger"}}, want: []string{"web-deleted", "node-rebooted"}},
+		{name: "resource type", link: config.ChainLink{ResourceTypes: []string{"pod"}}, want: []string{"web-deleted", "web-updated"}},
+		{name: "namespace and severity", link: config.ChainLink{Namespaces: []string{"shop"}, Severities: []string{"Normal", "Warning"}}, want: []string{"web-updated", "api-created"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filter, err := NewFilter(tt.link)
+			if err != nil {
+				t.Fatalf("NewFilter() error = %v", err)
+			}
+			matched, all := &recorder{}, &recorder{}
+			chain := &Chain{Links: []Link{
+				{Name: "matched", Dispatcher: matched, Filter: filter},
+				{Name: "all", Dispatcher: all},
+			}}
+			for _, e := range events {
+				chain.Handle(e)
+			}
+			if !reflect.DeepEqual(matched.names, tt.want) {
+				t.Errorf("filtered link got %v, want %v", matched.names, tt.want)
+			}
+			if len(all.names) != len(events) {
+				t.Errorf("unfiltered link got %v, want every event", all.names)
+			}
+		})
+	}
+}
+
+func TestChainSend(t *testing.T) {
+	t.Parallel()
+
+	failing := &recorder{err: errors.New("unreachable")}
+	delivered := &recorder{}
+	chain := &Chain{Links: []Link{
+		{Name: "webhook", Dispatcher: failing},
+		{Name: "slack", Dispatcher: delivered},
+	}}
+
+	err := chain.Send(event.Event{Name: "web"})
+	if err == nil || err.Error() != "webhook: unreachable" {
+		t.Errorf("Send() error = %v, want the webhook failure", err)
+	}
+	if len(delivered.names) != 1 {
+		t.Errorf("a failing link stopped the chain, slack got %v", delivered.names)
+	}
+
+	if _, err := NewFilter(config.ChainLink{Severities: []string{"critical"}}); err == nil {
+		t.Error("NewFilter() accepted an unknown severity")
+	}
+}
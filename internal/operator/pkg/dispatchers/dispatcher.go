@@ -3,6 +3,8 @@ package dispatchers
 import (
 	config "github.com/agentkube/operator/config"
 	msteam "github.com/agentkube/operator/pkg/dispatchers/msteam"
+	opsgenie "github.com/agentkube/operator/pkg/dispatchers/opsgenie"
+	pagerduty "github.com/agentkube/operator/pkg/dispatchers/pagerduty"
 	slack "github.com/agentkube/operator/pkg/dispatchers/slack"
 	smtp "github.com/agentkube/operator/pkg/dispatchers/smtp"
 	webhook "github.com/agentkube/operator/pkg/dispatchers/webhook"
@@ -14,6 +16,12 @@ type Dispatcher interface {
 	Handle(e event.Event)
 }
 
+// Sender is implemented by dispatchers that report whether an event was delivered.
+// Handle sends the same way and only logs the outcome.
+type Sender interface {
+	Send(e event.Event) error
+}
+
 // Map associates dispatcher names with their corresponding dispatcher implementations for easy lookup
 var Map = map[string]interface{}{
 	"default":      &Default{},
@@ -22,6 +30,8 @@ var Map = map[string]interface{}{
 	"webhook":      &webhook.Webhook{},
 	"ms-teams":     &msteam.MSTeams{},
 	"smtp":         &smtp.SMTP{},
+	"pagerduty":    &pagerduty.PagerDuty{},
+	"opsgenie":     &opsgenie.Opsgenie{},
 }
 
 // Default handler is a no-op fallback handler
@@ -35,3 +45,8 @@ func (d *Default) Init(c *config.Config) error {
 
 // Handle handles an event.
 func (d *Default) Handle(e event.Event) {}
+
+// Send drops the event, there is nothing to deliver it to
+func (d *Default) Send(e event.Event) error {
+	return nil
+}
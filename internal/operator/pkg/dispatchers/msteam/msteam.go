@@ -114,6 +114,13 @@ func (ms *MSTeams) Init(c *config.Config) error {
 
 // Handle handles notification.
 func (ms *MSTeams) Handle(e event.Event) {
+	if err := ms.Send(e); err != nil {
+		logrus.Printf("%s\n", err)
+	}
+}
+
+// Send posts the notification card and returns the delivery error
+func (ms *MSTeams) Send(e event.Event) error {
 	card := &TeamsMessageCard{
 		Type:    messageType,
 		Context: context,
@@ -130,9 +137,9 @@ func (ms *MSTeams) Handle(e event.Event) {
 	card.Sections = append(card.Sections, s)
 
 	if _, err := sendCard(ms, card); err != nil {
-		logrus.Printf("%s\n", err)
-		return
+		return err
 	}
 
 	logrus.Printf("Message successfully sent to MS Teams")
+	return nil
 }
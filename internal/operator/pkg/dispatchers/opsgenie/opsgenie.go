@@ -0,0 +1,189 @@
+package opsgenie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	config "github.com/agentkube/operator/config"
+	event "github.com/agentkube/operator/pkg/event"
+)
+
+var opsgenieErrMsg = `
+%s
+
+You need to set the Opsgenie API key of an API integration,
+using environment variables:
+
+export KW_OPSGENIE_APIKEY=api_key
+
+`
+
+const (
+	// DefaultURL is the API of the Opsgenie US instance
+	DefaultURL = "https://api.opsgenie.com"
+	// DefaultPriority is the priority of alerts when none is configured
+	DefaultPriority = "P3"
+)
+
+var priorities = map[string]bool{"P1": true, "P2": true, "P3": true, "P4": true, "P5": true}
+
+// Opsgenie handler implements handler.Handler interface,
+// creates alerts for Danger events and closes them on Normal events
+type Opsgenie struct {
+	ApiKey   string
+	Url      string
+	Priority string
+
+	incidents event.OpenIncidents
+}
+
+// Alert is an alert created through the Opsgenie alert API
+type Alert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Priority    string            `json:"priority,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Close is the body of an alert close request
+type Close struct {
+	Source string `json:"source,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// Init prepares Opsgenie configuration
+func (o *Opsgenie) Init(c *config.Config) error {
+	apiKey := c.Handler.Opsgenie.ApiKey
+	apiURL := c.Handler.Opsgenie.Url
+	priority := strings.ToUpper(c.Handler.Opsgenie.Priority)
+
+	if apiKey == "" {
+		apiKey = os.Getenv("KW_OPSGENIE_APIKEY")
+	}
+	if apiURL == "" {
+		apiURL = DefaultURL
+	}
+	if priority == "" {
+		priority = DefaultPriority
+	}
+
+	if apiKey == "" {
+		return fmt.Errorf(opsgenieErrMsg, "Missing Opsgenie API key")
+	}
+	if !priorities[priority] {
+		return fmt.Errorf("invalid Opsgenie priority %q, expected P1 to P5", c.Handler.Opsgenie.Priority)
+	}
+
+	o.ApiKey = apiKey
+	o.Url = strings.TrimSuffix(apiURL, "/")
+	o.Priority = priority
+	return nil
+}
+
+// Handle handles an event.
+func (o *Opsgenie) Handle(e event.Event) {
+	if err := o.Send(e); err != nil {
+		logrus.Printf("%s\n", err)
+	}
+}
+
+// Send creates or closes the alert of the event and returns the delivery error.
+// Events that neither open nor close an alert are not sent.
+func (o *Opsgenie) Send(e event.Event) error {
+	alias := aliasOf(e)
+
+	var err error
+	action := o.incidents.Action(e)
+	switch action {
+	case event.IncidentTrigger:
+		err = o.post("/v2/alerts", prepareAlert(e, o.Priority))
+	case event.IncidentResolve:
+		closePath := "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		err = o.post(closePath, &Close{Source: "agentkube", Note: e.Message()})
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	o.incidents.Record(e.DedupKey(), action)
+
+	logrus.Printf("Opsgenie alert %s successfully updated", alias)
+	return nil
+}
+
+// aliasOf is the alert alias of an event, Opsgenie deduplicates open alerts by alias
+func aliasOf(e event.Event) string {
+	return truncate(e.DedupKey(), 512)
+}
+
+func prepareAlert(e event.Event, priority string) *Alert {
+	alert := &Alert{
+		Message:     truncate(fmt.Sprintf("%s %s/%s on %s: %s", e.Kind, e.Namespace, e.Name, e.Host, e.Reason), 130),
+		Alias:       aliasOf(e),
+		Description: truncate(e.Message(), 15000),
+		Source:      "agentkube",
+		Entity:      e.Host,
+		Priority:    priority,
+		Details: map[string]string{
+			"cluster":   e.Host,
+			"namespace": e.Namespace,
+			"kind":      e.Kind,
+			"name":      e.Name,
+			"reason":    e.Reason,
+		},
+	}
+	for _, tag := range []string{e.Host, e.Namespace, e.Kind} {
+		if tag != "" {
+			alert.Tags = append(alert.Tags, tag)
+		}
+	}
+	return alert
+}
+
+func (o *Opsgenie) post(path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.Url+path, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "GenieKey "+o.ApiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed sending to Opsgenie: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resMessage, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Opsgenie responded with %s, %s", resp.Status, string(resMessage))
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes, the limits Opsgenie puts on alert fields
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
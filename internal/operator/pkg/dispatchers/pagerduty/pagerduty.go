@@ -0,0 +1,163 @@
+package pagerduty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	config "github.com/agentkube/operator/config"
+	event "github.com/agentkube/operator/pkg/event"
+)
+
+var pagerdutyErrMsg = `
+%s
+
+You need to set the PagerDuty routing key of an Events API v2 integration,
+using environment variables:
+
+export KW_PAGERDUTY_ROUTINGKEY=routing_key
+
+`
+
+// DefaultURL is the PagerDuty Events API v2 endpoint
+const DefaultURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty handler implements handler.Handler interface,
+// triggers incidents for Danger events and resolves them on Normal events
+type PagerDuty struct {
+	RoutingKey string
+	Url        string
+
+	incidents event.OpenIncidents
+}
+
+// Message is an Events API v2 event
+type Message struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *Payload `json:"payload,omitempty"`
+}
+
+// Payload describes the incident of a trigger event
+type Payload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// Init prepares PagerDuty configuration
+func (p *PagerDuty) Init(c *config.Config) error {
+	routingKey := c.Handler.PagerDuty.RoutingKey
+	url := c.Handler.PagerDuty.Url
+
+	if routingKey == "" {
+		routingKey = os.Getenv("KW_PAGERDUTY_ROUTINGKEY")
+	}
+	if url == "" {
+		url = DefaultURL
+	}
+
+	if routingKey == "" {
+		return fmt.Errorf(pagerdutyErrMsg, "Missing PagerDuty routing key")
+	}
+
+	p.RoutingKey = routingKey
+	p.Url = url
+	return nil
+}
+
+// Handle handles an event.
+func (p *PagerDuty) Handle(e event.Event) {
+	if err := p.Send(e); err != nil {
+		logrus.Printf("%s\n", err)
+	}
+}
+
+// Send triggers or resolves the incident of the event and returns the delivery error.
+// Events that neither open nor resolve an incident are not sent.
+func (p *PagerDuty) Send(e event.Event) error {
+	action := p.incidents.Action(e)
+	message := prepareMessage(e, p.RoutingKey, action)
+	if message == nil {
+		return nil
+	}
+
+	if err := postMessage(p.Url, message); err != nil {
+		return err
+	}
+	p.incidents.Record(message.DedupKey, action)
+
+	logrus.Printf("PagerDuty %s event successfully sent for %s", message.EventAction, message.DedupKey)
+	return nil
+}
+
+func prepareMessage(e event.Event, routingKey string, action event.IncidentAction) *Message {
+	message := &Message{RoutingKey: routingKey, DedupKey: e.DedupKey()}
+	switch action {
+	case event.IncidentTrigger:
+		message.EventAction = "trigger"
+		message.Payload = &Payload{
+			Summary:   truncate(e.Message(), 1024),
+			Source:    e.Host,
+			Severity:  "critical",
+			Timestamp: time.Now(),
+			Component: e.Name,
+			Group:     e.Namespace,
+			Class:     e.Kind,
+			CustomDetails: map[string]string{
+				"cluster":   e.Host,
+				"namespace": e.Namespace,
+				"kind":      e.Kind,
+				"name":      e.Name,
+				"reason":    e.Reason,
+			},
+		}
+		if message.Payload.Source == "" {
+			message.Payload.Source = "agentkube"
+		}
+	case event.IncidentResolve:
+		message.EventAction = "resolve"
+	default:
+		return nil
+	}
+	return message
+}
+
+func postMessage(url string, message *Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed sending to PagerDuty: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resMessage, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("PagerDuty responded with %s, %s", resp.Status, string(resMessage))
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes, the limit PagerDuty puts on summaries
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -69,6 +69,13 @@ func (s *Slack) Init(c *config.Config) error {
 
 // Handle handles the notification.
 func (s *Slack) Handle(e event.Event) {
+	if err := s.Send(e); err != nil {
+		logrus.Printf("%s\n", err)
+	}
+}
+
+// Send posts the notification to the channel and returns the delivery error
+func (s *Slack) Send(e event.Event) error {
 	api := slack.New(s.Token)
 	attachment := prepareSlackAttachment(e, s)
 
@@ -76,11 +83,11 @@ func (s *Slack) Handle(e event.Event) {
 		slack.MsgOptionAttachments(attachment),
 		slack.MsgOptionAsUser(true))
 	if err != nil {
-		logrus.Printf("%s\n", err)
-		return
+		return err
 	}
 
 	logrus.Printf("Message successfully sent to channel %s at %s", channelID, timestamp)
+	return nil
 }
 
 func checkMissingSlackVars(s *Slack) error {
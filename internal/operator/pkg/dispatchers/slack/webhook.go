@@ -67,7 +67,13 @@ func (m *SlackWebhook) Init(c *config.Config) error {
 
 // Handle handles an event.
 func (m *SlackWebhook) Handle(e event.Event) {
+	if err := m.Send(e); err != nil {
+		logrus.Printf("slackwebhook-handle() Error: %s\n", err)
+	}
+}
 
+// Send posts the event to the Slack webhook and returns the delivery error
+func (m *SlackWebhook) Send(e event.Event) error {
 	webhookMessage := slack.WebhookMessage{
 		Channel:   m.Channel,
 		Username:  m.Username,
@@ -80,11 +86,11 @@ func (m *SlackWebhook) Handle(e event.Event) {
 	err := slack.PostWebhook(m.Slackwebhookurl, &webhookMessage)
 
 	if err != nil {
-		logrus.Printf("slackwebhook-handle() Error: %s\n", err)
-		return
+		return err
 	}
 
 	logrus.Printf("Message successfully sent to %s at %s. Message: %s", m.Slackwebhookurl, time.Now(), webhookMessage.Text)
+	return nil
 }
 
 func checkMissingWebhookVars(s *SlackWebhook) error {
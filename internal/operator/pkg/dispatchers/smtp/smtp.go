@@ -50,16 +50,20 @@ func (s *SMTP) Init(c *config.Config) error {
 
 // Handle handles the notification.
 func (s *SMTP) Handle(e event.Event) {
-	send(s.cfg, e.Message())
+	if err := s.Send(e); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// Send emails the notification and returns the delivery error
+func (s *SMTP) Send(e event.Event) error {
+	if err := sendEmail(s.cfg, e.Message()); err != nil {
+		return err
+	}
 	logrus.Printf("Message successfully sent to %s at %s ", s.cfg.To, time.Now())
+	return nil
 }
 
 func FormatEmail(e event.Event) (string, error) {
 	return e.Message(), nil
 }
-
-func send(conf config.SMTP, msg string) {
-	if err := sendEmail(conf, msg); err != nil {
-		logrus.Error(err)
-	}
-}
@@ -34,6 +34,8 @@ Command line flags will override environment variables
 // Notify event to Webhook channel
 type Webhook struct {
 	Url string
+	// SchemaVersion is the payload version the receiver pinned
+	SchemaVersion string
 }
 
 // WebhookMessage for messages
@@ -67,6 +69,12 @@ func (m *Webhook) Init(c *config.Config) error {
 
 	m.Url = url
 
+	schemaVersion, err := event.ResolveSchema(c.Handler.Webhook.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	m.SchemaVersion = schemaVersion
+
 	if tlsSkip {
 		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	} else {
@@ -90,15 +98,20 @@ func (m *Webhook) Init(c *config.Config) error {
 
 // Handle handles an event.
 func (m *Webhook) Handle(e event.Event) {
-	webhookMessage := prepareWebhookMessage(e, m)
+	if err := m.Send(e); err != nil {
+		logrus.Printf("%s\n", err)
+	}
+}
 
-	err := postMessage(m.Url, webhookMessage)
+// Send posts the event to the webhook and returns the delivery error
+func (m *Webhook) Send(e event.Event) error {
+	err := postMessage(m.Url, m.SchemaVersion, preparePayload(e, m))
 	if err != nil {
-		logrus.Printf("%s\n", err)
-		return
+		return err
 	}
 
 	logrus.Printf("Message successfully sent to %s at %s ", m.Url, time.Now())
+	return nil
 }
 
 func checkMissingWebhookVars(s *Webhook) error {
@@ -109,6 +122,14 @@ func checkMissingWebhookVars(s *Webhook) error {
 	return nil
 }
 
+// preparePayload renders the event in the schema version of the webhook
+func preparePayload(e event.Event, m *Webhook) interface{} {
+	if m.SchemaVersion == event.SchemaV2 {
+		return e.Document(time.Now())
+	}
+	return prepareWebhookMessage(e, m)
+}
+
 func prepareWebhookMessage(e event.Event, _ *Webhook) *WebhookMessage {
 	return &WebhookMessage{
 		EventMeta: EventMeta{
@@ -123,8 +144,8 @@ func prepareWebhookMessage(e event.Event, _ *Webhook) *WebhookMessage {
 	}
 }
 
-func postMessage(url string, webhookMessage *WebhookMessage) error {
-	message, err := json.Marshal(webhookMessage)
+func postMessage(url, schemaVersion string, payload interface{}) error {
+	message, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
@@ -134,12 +155,17 @@ func postMessage(url string, webhookMessage *WebhookMessage) error {
 		return err
 	}
 	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add(event.SchemaHeader, schemaVersion)
 
-	client := &http.Client{}
-	_, err = client.Do(req)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", url, resp.Status)
+	}
 
 	return nil
 }
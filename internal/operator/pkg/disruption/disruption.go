@@ -0,0 +1,367 @@
+package disruption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ScenarioDrain = "drain"
+	ScenarioZone  = "zone"
+
+	// ZoneLabel is the well-known node label used to select nodes in a zone
+	ZoneLabel = "topology.kubernetes.io/zone"
+)
+
+// Issue types reported for a workload
+const (
+	IssueInsufficientReplicas  = "insufficient-replicas"
+	IssueMissingPDB            = "missing-pdb"
+	IssueSingleReplica         = "single-replica"
+	IssueSingleReplicaStateful = "single-replica-statefulset"
+	IssuePDBBlocksDrain        = "pdb-blocks-drain"
+	IssuePDBViolated           = "pdb-violated"
+)
+
+// ErrInvalidRequest is returned when the simulation request is incomplete or names nodes or zones
+// that do not exist
+var ErrInvalidRequest = errors.New("invalid simulation request")
+
+// Simulator simulates node drains and zone outages against PodDisruptionBudgets
+type Simulator struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// SimulationRequest describes the disruption to simulate
+type SimulationRequest struct {
+	// Scenario is "drain" for a set of nodes or "zone" for a whole zone outage
+	Scenario string   `json:"scenario" binding:"required"`
+	Nodes    []string `json:"nodes,omitempty"`
+	Zone     string   `json:"zone,omitempty"`
+	// Namespaces limits the report to the given namespaces, empty means all
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// SimulationResult is the outcome of a simulated disruption
+type SimulationResult struct {
+	Scenario    string           `json:"scenario"`
+	Nodes       []string         `json:"nodes"`
+	EvictedPods int              `json:"evictedPods"`
+	Workloads   []WorkloadImpact `json:"workloads"`
+	Violations  int              `json:"violations"`
+	Safe        bool             `json:"safe"`
+	SkippedPods int              `json:"skippedPods"` // DaemonSet and mirror pods are not evicted by a drain
+}
+
+// WorkloadImpact describes how a single workload is affected
+type WorkloadImpact struct {
+	Kind             string   `json:"kind"`
+	Name             string   `json:"name"`
+	Namespace        string   `json:"namespace"`
+	TotalReplicas    int      `json:"totalReplicas"`
+	HealthyReplicas  int      `json:"healthyReplicas"`
+	AffectedReplicas int      `json:"affectedReplicas"`
+	RemainingHealthy int      `json:"remainingHealthy"`
+	PDB              *PDBInfo `json:"pdb,omitempty"`
+	Issues           []string `json:"issues,omitempty"`
+	Messages         []string `json:"messages,omitempty"`
+}
+
+// PDBInfo summarizes the PodDisruptionBudget covering a workload
+type PDBInfo struct {
+	Name               string `json:"name"`
+	MinAvailable       string `json:"minAvailable,omitempty"`
+	MaxUnavailable     string `json:"maxUnavailable,omitempty"`
+	DisruptionsAllowed int32  `json:"disruptionsAllowed"`
+	DesiredHealthy     int32  `json:"desiredHealthy"`
+}
+
+type workloadKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// NewSimulator creates a new disruption simulator
+func NewSimulator(kubeConfigStore kubeconfig.ContextStore) *Simulator {
+	return &Simulator{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// Simulate reports which workloads would lose availability if the requested nodes went away
+func (s *Simulator) Simulate(clusterName string, req SimulationRequest) (*SimulationResult, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	kubeContext, err := s.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	ctx := context.Background()
+	nodes, err := s.targetNodes(ctx, clientset, req)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	pdbs, err := clientset.PolicyV1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pod disruption budgets: %v", err)
+	}
+
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceFilter := map[string]bool{}
+	for _, ns := range req.Namespaces {
+		namespaceFilter[ns] = true
+	}
+
+	result := &SimulationResult{
+		Scenario:  req.Scenario,
+		Nodes:     make([]string, 0, len(nodes)),
+		Workloads: []WorkloadImpact{},
+	}
+	for node := range nodes {
+		result.Nodes = append(result.Nodes, node)
+	}
+	sort.Strings(result.Nodes)
+
+	impacts := map[workloadKey]*WorkloadImpact{}
+	workloadPods := map[workloadKey][]corev1.Pod{}
+
+	for _, pod := range pods.Items {
+		if len(namespaceFilter) > 0 && !namespaceFilter[pod.Namespace] {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		kind, name := utils.WorkloadOf(&pod, replicaSetOwners)
+		onTarget := nodes[pod.Spec.NodeName]
+
+		if kind == "DaemonSet" || isMirrorPod(&pod) {
+			if onTarget {
+				result.SkippedPods++
+			}
+			continue
+		}
+
+		key := workloadKey{kind: kind, namespace: pod.Namespace, name: name}
+		impact, ok := impacts[key]
+		if !ok {
+			impact = &WorkloadImpact{Kind: kind, Name: name, Namespace: pod.Namespace}
+			impacts[key] = impact
+		}
+
+		impact.TotalReplicas++
+		healthy := isPodReady(&pod)
+		if healthy {
+			impact.HealthyReplicas++
+		}
+		if onTarget {
+			impact.AffectedReplicas++
+			result.EvictedPods++
+		} else if healthy {
+			impact.RemainingHealthy++
+		}
+		workloadPods[key] = append(workloadPods[key], pod)
+	}
+
+	for key, impact := range impacts {
+		if impact.AffectedReplicas == 0 {
+			continue
+		}
+
+		if pdb := matchingPDB(pdbs.Items, workloadPods[key]); pdb != nil {
+			impact.PDB = pdbInfo(pdb)
+		}
+		evaluate(impact, req.Scenario)
+
+		if len(impact.Issues) > 0 {
+			result.Violations++
+		}
+		result.Workloads = append(result.Workloads, *impact)
+	}
+
+	sort.Slice(result.Workloads, func(i, j int) bool {
+		a, b := result.Workloads[i], result.Workloads[j]
+		if len(a.Issues) != len(b.Issues) {
+			return len(a.Issues) > len(b.Issues)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	result.Safe = result.Violations == 0
+
+	return result, nil
+}
+
+// targetNodes resolves the set of node names affected by the scenario
+func (s *Simulator) targetNodes(ctx context.Context, clientset *kubernetes.Clientset, req SimulationRequest) (map[string]bool, error) {
+	nodes := map[string]bool{}
+
+	switch req.Scenario {
+	case ScenarioDrain:
+		for _, name := range req.Nodes {
+			if _, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{}); err != nil {
+				if apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("%w: node %s not found", ErrInvalidRequest, name)
+				}
+				return nil, fmt.Errorf("failed to get node %s: %v", name, err)
+			}
+			nodes[name] = true
+		}
+	case ScenarioZone:
+		list, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+			LabelSelector: labels.Set{ZoneLabel: req.Zone}.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list nodes in zone %s: %v", req.Zone, err)
+		}
+		if len(list.Items) == 0 {
+			return nil, fmt.Errorf("%w: no nodes found in zone %s", ErrInvalidRequest, req.Zone)
+		}
+		for _, node := range list.Items {
+			nodes[node.Name] = true
+		}
+	}
+
+	return nodes, nil
+}
+
+// validate checks that the request names the nodes or zone its scenario needs
+func (r SimulationRequest) validate() error {
+	switch r.Scenario {
+	case ScenarioDrain:
+		if len(r.Nodes) == 0 {
+			return fmt.Errorf("%w: at least one node is required for a drain simulation", ErrInvalidRequest)
+		}
+	case ScenarioZone:
+		if r.Zone == "" {
+			return fmt.Errorf("%w: zone is required for a zone outage simulation", ErrInvalidRequest)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported scenario %q, expected %q or %q", ErrInvalidRequest, r.Scenario, ScenarioDrain, ScenarioZone)
+	}
+	return nil
+}
+
+// evaluate fills in the availability issues of an affected workload
+func evaluate(impact *WorkloadImpact, scenario string) {
+	addIssue := func(issue, message string) {
+		impact.Issues = append(impact.Issues, issue)
+		impact.Messages = append(impact.Messages, message)
+	}
+
+	if impact.RemainingHealthy == 0 {
+		addIssue(IssueInsufficientReplicas, fmt.Sprintf("all %d replicas run on affected nodes, the workload would be fully unavailable", impact.AffectedReplicas))
+	}
+
+	if impact.TotalReplicas == 1 {
+		if impact.Kind == "StatefulSet" {
+			addIssue(IssueSingleReplicaStateful, "single-replica StatefulSet cannot be moved without downtime")
+		} else if impact.Kind != "Pod" {
+			addIssue(IssueSingleReplica, "single replica workload, scale to at least 2 replicas")
+		}
+	}
+
+	if impact.PDB == nil {
+		if impact.TotalReplicas > 1 {
+			addIssue(IssueMissingPDB, "no PodDisruptionBudget protects this workload")
+		}
+		return
+	}
+
+	if scenario == ScenarioDrain {
+		// Evictions beyond the allowed disruptions are refused by the API server, so the drain would hang
+		if int32(impact.AffectedReplicas) > impact.PDB.DisruptionsAllowed {
+			addIssue(IssuePDBBlocksDrain, fmt.Sprintf("drain would block: %d pods must be evicted but PDB %s allows %d disruptions",
+				impact.AffectedReplicas, impact.PDB.Name, impact.PDB.DisruptionsAllowed))
+		}
+	} else if int32(impact.RemainingHealthy) < impact.PDB.DesiredHealthy {
+		addIssue(IssuePDBViolated, fmt.Sprintf("only %d healthy replicas would remain, PDB %s requires %d",
+			impact.RemainingHealthy, impact.PDB.Name, impact.PDB.DesiredHealthy))
+	}
+}
+
+// matchingPDB returns the first PDB in the namespace whose selector matches the workload's pods
+func matchingPDB(pdbs []policyv1.PodDisruptionBudget, pods []corev1.Pod) *policyv1.PodDisruptionBudget {
+	if len(pods) == 0 {
+		return nil
+	}
+
+	for i := range pdbs {
+		pdb := &pdbs[i]
+		if pdb.Namespace != pods[0].Namespace || pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		for _, pod := range pods {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				return pdb
+			}
+		}
+	}
+	return nil
+}
+
+func pdbInfo(pdb *policyv1.PodDisruptionBudget) *PDBInfo {
+	info := &PDBInfo{
+		Name:               pdb.Name,
+		DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+		DesiredHealthy:     pdb.Status.DesiredHealthy,
+	}
+	if pdb.Spec.MinAvailable != nil {
+		info.MinAvailable = pdb.Spec.MinAvailable.String()
+	}
+	if pdb.Spec.MaxUnavailable != nil {
+		info.MaxUnavailable = pdb.Spec.MaxUnavailable.String()
+	}
+	return info
+}
+
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package disruption
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		impact   WorkloadImpact
+		scenario string
+		want     []string
+	}{
+		{
+			name:     "all replicas affected without PDB",
+			impact:   WorkloadImpact{Kind: "Deployment", TotalReplicas: 2, AffectedReplicas: 2, RemainingHealthy: 0},
+			scenario: ScenarioDrain,
+			want:     []string{IssueInsufficientReplicas, IssueMissingPDB},
+		},
+		{
+			name:     "single replica deployment",
+			impact:   WorkloadImpact{Kind: "Deployment", TotalReplicas: 1, AffectedReplicas: 1},
+			scenario: ScenarioDrain,
+			want:     []string{IssueInsufficientReplicas, IssueSingleReplica},
+		},
+		{
+			name:     "single replica statefulset",
+			impact:   WorkloadImpact{Kind: "StatefulSet", TotalReplicas: 1, AffectedReplicas: 1},
+			scenario: ScenarioZone,
+			want:     []string{IssueInsufficientReplicas, IssueSingleReplicaStateful},
+		},
+		{
+			name:     "bare pod",
+			impact:   WorkloadImpact{Kind: "Pod", TotalReplicas: 1, AffectedReplicas: 1},
+			scenario: ScenarioDrain,
+			want:     []string{IssueInsufficientReplicas},
+		},
+		{
+			name: "drain within allowed disruptions",
+			impact: WorkloadImpact{Kind: "Deployment", TotalReplicas: 3, AffectedReplicas: 1, RemainingHealthy: 2,
+				PDB: &PDBInfo{Name: "api", DisruptionsAllowed: 1, DesiredHealthy: 2}},
+			scenario: ScenarioDrain,
+			want:     nil,
+		},
+		{
+			name: "drain blocked by PDB",
+			impact: WorkloadImpact{Kind: "Deployment", TotalReplicas: 3, AffectedReplicas: 2, RemainingHealthy: 1,
+				PDB: &PDBInfo{Name: "api", DisruptionsAllowed: 1, DesiredHealthy: 2}},
+			scenario: ScenarioDrain,
+			want:     []string{IssuePDBBlocksDrain},
+		},
+		{
+			name: "zone outage violates PDB",
+			impact: WorkloadImpact{Kind: "Deployment", TotalReplicas: 3, AffectedReplicas: 2, RemainingHealthy: 1,
+				PDB: &PDBInfo{Name: "api", DisruptionsAllowed: 1, DesiredHealthy: 2}},
+			scenario: ScenarioZone,
+			want:     []string{IssuePDBViolated},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			impact := tt.impact
+			evaluate(&impact, tt.scenario)
+			if !reflect.DeepEqual(impact.Issues, tt.want) {
+				t.Errorf("evaluate() issues = %v, want %v", impact.Issues, tt.want)
+			}
+			if len(impact.Messages) != len(impact.Issues) {
+				t.Errorf("evaluate() messages = %v, want one per issue", impact.Messages)
+			}
+		})
+	}
+}
+
+func TestMatchingPDB(t *testing.T) {
+	t.Parallel()
+
+	pdb := func(name, namespace string, selector *metav1.LabelSelector) policyv1.PodDisruptionBudget {
+		return policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       policyv1.PodDisruptionBudgetSpec{Selector: selector},
+		}
+	}
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "shop", Labels: map[string]string{"app": "api"}},
+	}}
+
+	tests := []struct {
+		name string
+		pdbs []policyv1.PodDisruptionBudget
+		pods []corev1.Pod
+		want string
+	}{
+		{
+			name: "matching selector",
+			pdbs: []policyv1.PodDisruptionBudget{
+				pdb("web", "shop", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}),
+				pdb("api", "shop", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}),
+			},
+			pods: pods,
+			want: "api",
+		},
+		{
+			name: "other namespace",
+			pdbs: []policyv1.PodDisruptionBudget{pdb("api", "billing", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}})},
+			pods: pods,
+		},
+		{
+			name: "empty selector is ignored",
+			pdbs: []policyv1.PodDisruptionBudget{pdb("all", "shop", &metav1.LabelSelector{})},
+			pods: pods,
+		},
+		{
+			name: "nil selector is ignored",
+			pdbs: []policyv1.PodDisruptionBudget{pdb("none", "shop", nil)},
+			pods: pods,
+		},
+		{
+			name: "no pods",
+			pdbs: []policyv1.PodDisruptionBudget{pdb("api", "shop", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}})},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := matchingPDB(tt.pdbs, tt.pods)
+			name := ""
+			if got != nil {
+				name = got.Name
+			}
+			if name != tt.want {
+				t.Errorf("matchingPDB() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     SimulationRequest
+		wantErr bool
+	}{
+		{"drain", SimulationRequest{Scenario: ScenarioDrain, Nodes: []string{"node-1"}}, false},
+		{"drain without nodes", SimulationRequest{Scenario: ScenarioDrain}, true},
+		{"zone", SimulationRequest{Scenario: ScenarioZone, Zone: "eu-west-1a"}, false},
+		{"zone without zone", SimulationRequest{Scenario: ScenarioZone}, true},
+		{"unsupported scenario", SimulationRequest{Scenario: "reboot"}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("validate() error = %v, want ErrInvalidRequest", err)
+			}
+		})
+	}
+}
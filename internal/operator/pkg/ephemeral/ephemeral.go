@@ -0,0 +1,397 @@
+package ephemeral
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	tokensFileName = "ci-receiver-tokens.json"
+
+	// DefaultTTL is how long an environment stays registered when CI requests no TTL
+	DefaultTTL = 2 * time.Hour
+	// MaxTTL caps how long an environment stays registered without being pushed again
+	MaxTTL = 24 * time.Hour
+
+	// ContextPrefix starts the names of the contexts of ephemeral environments
+	ContextPrefix = "ci-"
+
+	tokenPrefix    = "ci_"
+	expiryInterval = 30 * time.Second
+)
+
+// ErrTokenInvalid is returned for receiver tokens that are unknown or revoked
+var ErrTokenInvalid = errors.New("CI receiver token is not valid")
+
+// ErrEnvironmentNotFound is returned when removing an environment that is not registered
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
+// environmentName is what CI may name an environment, it becomes part of context names
+var environmentName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Token authenticates a CI system pushing environments. The token itself is only returned when issued.
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Uses       int        `json:"uses"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// storedToken keeps the token hash next to the token details, the token itself is never stored
+type storedToken struct {
+	Token
+	TokenHash string `json:"tokenHash"`
+}
+
+// Registration is a kubeconfig CI pushes for an ephemeral environment
+type Registration struct {
+	// Name of the environment, e.g. pr-1234
+	Name string `json:"name" binding:"required"`
+	// Kubeconfig, raw or base64 encoded
+	Kubeconfig string `json:"kubeconfig" binding:"required"`
+	TTLMinutes int    `json:"ttlMinutes"`
+}
+
+// Environment is an ephemeral environment registered by CI, its contexts are removed when it expires
+type Environment struct {
+	Name         string    `json:"name"`
+	Contexts     []string  `json:"contexts"`
+	RegisteredBy string    `json:"registeredBy"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Manager registers the environments CI pushes and issues the tokens CI authenticates with
+type Manager struct {
+	contextStore kubeconfig.ContextStore
+	tokensPath   string
+	mutex        sync.Mutex
+	environments map[string]*Environment
+	stopChan     chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewManager creates a manager adding the contexts of environments to the store
+func NewManager(contextStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		contextStore: contextStore,
+		tokensPath:   filepath.Join(utils.ConfigDir(), tokensFileName),
+		environments: make(map[string]*Environment),
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// IssueToken creates a receiver token for a CI system and returns it with its token. The token is
+// only returned here, it is looked up by its hash afterwards.
+func (m *Manager) IssueToken(name string) (*Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tokens, err := m.loadTokens()
+	if err != nil {
+		return nil, "", err
+	}
+	stored := storedToken{
+		Token: Token{
+			ID:        uuid.New().String(),
+			Name:      name,
+			CreatedAt: time.Now(),
+		},
+		TokenHash: hashToken(token),
+	}
+	if err := m.saveTokens(append(tokens, stored)); err != nil {
+		return nil, "", err
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{"token": stored.ID, "name": name}, nil, "CI receiver token issued")
+	return &stored.Token, token, nil
+}
+
+// ListTokens returns the receiver tokens, newest first
+func (m *Manager) ListTokens() ([]Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tokens, err := m.loadTokens()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, token.Token)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// RevokeToken deletes a receiver token, environments it registered stay until they expire
+func (m *Manager) RevokeToken(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tokens, err := m.loadTokens()
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		if tokens[i].ID == id {
+			return m.saveTokens(append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return fmt.Errorf("token %s not found", id)
+}
+
+// Register adds the contexts of the kubeconfig CI pushed, named after the environment, until the
+// TTL expires. Pushing an environment again replaces its contexts and restarts its TTL.
+func (m *Manager) Register(token string, registration Registration) (*Environment, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	registeredBy, err := m.useToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !environmentName.MatchString(registration.Name) {
+		return nil, fmt.Errorf("environment name %q must be lowercase alphanumeric or '-', at most 63 characters", registration.Name)
+	}
+	ttl := DefaultTTL
+	if registration.TTLMinutes != 0 {
+		ttl = time.Duration(registration.TTLMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > MaxTTL {
+		return nil, fmt.Errorf("ttl must be between 1 minute and %s", MaxTTL)
+	}
+
+	contexts, err := loadContexts(registration.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	environment := &Environment{
+		Name:         registration.Name,
+		RegisteredBy: registeredBy,
+		RegisteredAt: now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	for i := range contexts {
+		ctx := contexts[i]
+		ctx.Name = ContextPrefix + registration.Name
+		if len(contexts) > 1 {
+			ctx.Name += "-" + contexts[i].Name
+		}
+		if err := m.contextStore.AddContextWithKeyAndTTL(&ctx, ctx.Name, ttl); err != nil {
+			m.removeContexts(environment.Contexts)
+			return nil, fmt.Errorf("adding context %s: %w", ctx.Name, err)
+		}
+		environment.Contexts = append(environment.Contexts, ctx.Name)
+	}
+
+	if previous, ok := m.environments[registration.Name]; ok {
+		m.removeContexts(stale(previous.Contexts, environment.Contexts))
+	}
+	m.environments[registration.Name] = environment
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"environment":  environment.Name,
+		"registeredBy": registeredBy,
+		"expiresAt":    environment.ExpiresAt.Format(time.RFC3339),
+	}, nil, "Ephemeral environment registered")
+	result := *environment
+	return &result, nil
+}
+
+// Remove deletes an environment and its contexts before it expires
+func (m *Manager) Remove(token, name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, err := m.useToken(token); err != nil {
+		return err
+	}
+	environment, ok := m.environments[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEnvironmentNotFound, name)
+	}
+	m.removeContexts(environment.Contexts)
+	delete(m.environments, name)
+
+	logger.Log(logger.LevelInfo, map[string]string{"environment": name}, nil, "Ephemeral environment removed")
+	return nil
+}
+
+// List returns the registered environments, the first to expire first
+func (m *Manager) List() []Environment {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := make([]Environment, 0, len(m.environments))
+	for _, environment := range m.environments {
+		result = append(result, *environment)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+	})
+	return result
+}
+
+// Start runs the expiry loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.ExpireStale(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the expiry loop
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopChan) })
+}
+
+// ExpireStale forgets the environments expired at now. Their contexts expire from the store on
+// their own, they are removed here as well so that they disappear at once.
+func (m *Manager) ExpireStale(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, environment := range m.environments {
+		if now.Before(environment.ExpiresAt) {
+			continue
+		}
+		m.removeContexts(environment.Contexts)
+		delete(m.environments, name)
+		logger.Log(logger.LevelInfo, map[string]string{"environment": name}, nil, "Ephemeral environment expired")
+	}
+}
+
+// useToken checks a receiver token and records its use, returning the name of the token. The
+// mutex must be held.
+func (m *Manager) useToken(token string) (string, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", ErrTokenInvalid
+	}
+	tokens, err := m.loadTokens()
+	if err != nil {
+		return "", err
+	}
+	hash := hashToken(token)
+	for i := range tokens {
+		if tokens[i].TokenHash != hash {
+			continue
+		}
+		now := time.Now()
+		tokens[i].Uses++
+		tokens[i].LastUsedAt = &now
+		if err := m.saveTokens(tokens); err != nil {
+			return "", err
+		}
+		return tokens[i].Name, nil
+	}
+	return "", ErrTokenInvalid
+}
+
+func (m *Manager) removeContexts(names []string) {
+	for _, name := range names {
+		if err := m.contextStore.RemoveContext(name); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"context": name}, err, "removing ephemeral context")
+		}
+	}
+}
+
+// loadContexts reads the contexts of a raw or base64 encoded kubeconfig
+func loadContexts(raw string) ([]kubeconfig.Context, error) {
+	data := []byte(raw)
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw)); err == nil {
+		data = decoded
+	}
+
+	contexts, contextErrors, err := kubeconfig.LoadContextsFromData(data, kubeconfig.DynamicCluster, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	if len(contexts) == 0 {
+		if len(contextErrors) > 0 {
+			return nil, fmt.Errorf("invalid kubeconfig: context %s: %v", contextErrors[0].ContextName, contextErrors[0].Error)
+		}
+		return nil, fmt.Errorf("kubeconfig has no contexts")
+	}
+	return contexts, nil
+}
+
+// stale returns the names of previous not in current
+func stale(previous, current []string) []string {
+	kept := make(map[string]bool, len(current))
+	for _, name := range current {
+		kept[name] = true
+	}
+	var result []string
+	for _, name := range previous {
+		if !kept[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	return tokenPrefix + hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Manager) loadTokens() ([]storedToken, error) {
+	var tokens []storedToken
+	if err := utils.ReadJSONFile(m.tokensPath, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (m *Manager) saveTokens(tokens []storedToken) error {
+	return utils.WriteJSONFileMode(m.tokensPath, tokens, 0600)
+}
@@ -0,0 +1,117 @@
+package ephemeral
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+const previewKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: preview
+  cluster:
+    server: https://preview.example.com
+contexts:
+- name: preview
+  context:
+    cluster: preview
+    user: ci
+users:
+- name: ci
+  user:
+    token: abc
+current-context: preview
+`
+
+func newTestManager(t *testing.T) (*Manager, kubeconfig.ContextStore) {
+	t.Helper()
+	store := kubeconfig.NewContextStore()
+	manager := NewManager(store)
+	manager.tokensPath = filepath.Join(t.TempDir(), tokensFileName)
+	return manager, store
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	manager, store := newTestManager(t)
+	_, token, err := manager.IssueToken("github-actions")
+	if err != nil {
+		t.Fatalf("IssueToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		registration Registration
+		wantErr      bool
+		wantErrIs    error
+	}{
+		{name: "raw kubeconfig", token: token, registration: Registration{Name: "pr-1", Kubeconfig: previewKubeconfig}},
+		{name: "base64 kubeconfig", token: token, registration: Registration{Name: "pr-2", Kubeconfig: base64.StdEncoding.EncodeToString([]byte(previewKubeconfig)), TTLMinutes: 30}},
+		{name: "unknown token", token: "ci_unknown", registration: Registration{Name: "pr-3", Kubeconfig: previewKubeconfig}, wantErr: true, wantErrIs: ErrTokenInvalid},
+		{name: "invalid name", token: token, registration: Registration{Name: "PR 4", Kubeconfig: previewKubeconfig}, wantErr: true},
+		{name: "ttl too long", token: token, registration: Registration{Name: "pr-5", Kubeconfig: previewKubeconfig, TTLMinutes: 25 * 60}, wantErr: true},
+		{name: "invalid kubeconfig", token: token, registration: Registration{Name: "pr-6", Kubeconfig: "not a kubeconfig"}, wantErr: true},
+	}
+
+	// Registrations share the manager, so they run in order
+	for _, tt := range tests {
+		environment, err := manager.Register(tt.token, tt.registration)
+		if (err != nil) != tt.wantErr || (tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs)) {
+			t.Fatalf("%s: Register() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil {
+			want := ContextPrefix + tt.registration.Name
+			if len(environment.Contexts) != 1 || environment.Contexts[0] != want {
+				t.Fatalf("%s: Contexts = %v, want [%s]", tt.name, environment.Contexts, want)
+			}
+			if environment.RegisteredBy != "github-actions" {
+				t.Errorf("%s: RegisteredBy = %s, want github-actions", tt.name, environment.RegisteredBy)
+			}
+			if _, err := store.GetContext(want); err != nil {
+				t.Errorf("%s: context %s not in store: %v", tt.name, want, err)
+			}
+		}
+	}
+
+	if got := manager.List(); len(got) != 2 || got[0].Name != "pr-2" {
+		t.Fatalf("List() = %+v, want pr-2 expiring first then pr-1", got)
+	}
+
+	manager.ExpireStale(time.Now().Add(time.Hour))
+	if got := manager.List(); len(got) != 1 || got[0].Name != "pr-1" {
+		t.Fatalf("List() after expiry = %+v, want pr-1", got)
+	}
+	if _, err := store.GetContext(ContextPrefix + "pr-2"); err == nil {
+		t.Error("context of expired environment still in store")
+	}
+
+	if err := manager.Remove(token, "pr-1"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := manager.Remove(token, "pr-1"); !errors.Is(err, ErrEnvironmentNotFound) {
+		t.Errorf("Remove() twice error = %v, want %v", err, ErrEnvironmentNotFound)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newTestManager(t)
+	issued, token, err := manager.IssueToken("gitlab")
+	if err != nil {
+		t.Fatalf("IssueToken() error = %v", err)
+	}
+	if err := manager.RevokeToken(issued.ID); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, err := manager.Register(token, Registration{Name: "pr-1", Kubeconfig: previewKubeconfig}); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Register() with revoked token error = %v, want %v", err, ErrTokenInvalid)
+	}
+}
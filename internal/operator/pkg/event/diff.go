@@ -0,0 +1,273 @@
+package event
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/objectdiff"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxDiffChanges bounds the field changes of a diff, so that large rewrites don't bloat payloads
+const maxDiffChanges = 50
+
+// podSpecPaths are where workloads keep the pod spec whose containers are compared
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// Diff describes what an update changed, for receivers to summarize it
+type Diff struct {
+	// Summary is a one-line description of the notable changes
+	Summary string `json:"summary"`
+	// Changes are the changed spec fields, by path. Environment variable values are hashed.
+	Changes   []objectdiff.Change `json:"changes"`
+	Truncated bool                `json:"truncated,omitempty"`
+	Replicas  *ReplicaChange      `json:"replicas,omitempty"`
+	Images    []ImageChange       `json:"images,omitempty"`
+	Labels    *LabelChange        `json:"labels,omitempty"`
+}
+
+// ReplicaChange is a change of the desired replicas
+type ReplicaChange struct {
+	Old int64 `json:"old"`
+	New int64 `json:"new"`
+}
+
+// ImageChange is a container whose image changed, Old is empty for added containers and New for removed ones
+type ImageChange struct {
+	Container string `json:"container"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+// LabelChange lists the labels added, removed and changed
+type LabelChange struct {
+	Added   map[string]string      `json:"added,omitempty"`
+	Removed map[string]string      `json:"removed,omitempty"`
+	Changed map[string]ValueChange `json:"changed,omitempty"`
+}
+
+// ValueChange is a value before and after an update
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// NewDiff compares two versions of an object. It returns nil when either can't be read or when
+// neither the spec nor the labels changed, e.g. for status updates.
+func NewDiff(oldObj, obj runtime.Object) *Diff {
+	if oldObj == nil || obj == nil {
+		return nil
+	}
+	oldContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(oldObj)
+	if err != nil {
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+
+	oldSpec, _ := hashEnvValues(oldContent["spec"]).(map[string]interface{})
+	spec, _ := hashEnvValues(content["spec"]).(map[string]interface{})
+	diff := &Diff{Changes: objectdiff.Diff(map[string]interface{}{"spec": oldSpec}, map[string]interface{}{"spec": spec})}
+	if len(diff.Changes) > maxDiffChanges {
+		diff.Changes = diff.Changes[:maxDiffChanges]
+		diff.Truncated = true
+	}
+
+	oldReplicas, hadReplicas := replicasOf(oldContent)
+	replicas, hasReplicas := replicasOf(content)
+	if hadReplicas && hasReplicas && oldReplicas != replicas {
+		diff.Replicas = &ReplicaChange{Old: oldReplicas, New: replicas}
+	}
+	diff.Images = imageChanges(imagesOf(oldContent), imagesOf(content))
+	diff.Labels = labelChanges(labelsOf(oldContent), labelsOf(content))
+
+	if len(diff.Changes) == 0 && diff.Labels == nil {
+		return nil
+	}
+	diff.Summary = diff.summarize()
+	return diff
+}
+
+func (d *Diff) summarize() string {
+	var parts []string
+	if d.Replicas != nil {
+		parts = append(parts, fmt.Sprintf("replicas %d → %d", d.Replicas.Old, d.Replicas.New))
+	}
+	for _, image := range d.Images {
+		switch {
+		case image.Old == "":
+			parts = append(parts, fmt.Sprintf("container %s added with %s", image.Container, image.New))
+		case image.New == "":
+			parts = append(parts, fmt.Sprintf("container %s removed", image.Container))
+		default:
+			parts = append(parts, fmt.Sprintf("image of %s %s → %s", image.Container, image.Old, image.New))
+		}
+	}
+	if d.Labels != nil {
+		parts = append(parts, fmt.Sprintf("labels %d added, %d removed, %d changed",
+			len(d.Labels.Added), len(d.Labels.Removed), len(d.Labels.Changed)))
+	}
+	// Spec changes not already described
+	other := len(d.Changes)
+	for _, change := range d.Changes {
+		if change.Path == "spec.replicas" || strings.HasSuffix(change.Path, ".image") {
+			other--
+		}
+	}
+	if other > 0 {
+		suffix := ""
+		if d.Truncated {
+			suffix = "+"
+		}
+		parts = append(parts, fmt.Sprintf("%d%s other spec fields changed", other, suffix))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hashEnvValues copies an unstructured value, replacing the values of container environment
+// variables with a hash: receivers see that a value changed without seeing it
+func hashEnvValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if env, ok := item.([]interface{}); ok && key == "env" {
+				copied[key] = hashEnvList(env)
+				continue
+			}
+			copied[key] = hashEnvValues(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = hashEnvValues(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+func hashEnvList(env []interface{}) []interface{} {
+	copied := make([]interface{}, len(env))
+	for i, item := range env {
+		variable, ok := item.(map[string]interface{})
+		if !ok {
+			copied[i] = item
+			continue
+		}
+		hashed := make(map[string]interface{}, len(variable))
+		for key, value := range variable {
+			hashed[key] = value
+		}
+		if value, ok := variable["value"].(string); ok {
+			sum := sha256.Sum256([]byte(value))
+			hashed["value"] = "sha256:" + hex.EncodeToString(sum[:])[:12]
+		}
+		copied[i] = hashed
+	}
+	return copied
+}
+
+func replicasOf(content map[string]interface{}) (int64, bool) {
+	spec, _ := content["spec"].(map[string]interface{})
+	switch replicas := spec["replicas"].(type) {
+	case int64:
+		return replicas, true
+	case float64:
+		return int64(replicas), true
+	}
+	return 0, false
+}
+
+// imagesOf returns the images of the containers of the pod spec of an object, by container name
+func imagesOf(content map[string]interface{}) map[string]string {
+	images := map[string]string{}
+	for _, path := range podSpecPaths {
+		var spec interface{} = content
+		for _, field := range path {
+			fields, _ := spec.(map[string]interface{})
+			spec = fields[field]
+		}
+		podSpec, _ := spec.(map[string]interface{})
+		for _, key := range []string{"initContainers", "containers"} {
+			containers, _ := podSpec[key].([]interface{})
+			for _, item := range containers {
+				container, _ := item.(map[string]interface{})
+				name, _ := container["name"].(string)
+				image, _ := container["image"].(string)
+				if name != "" && image != "" {
+					images[name] = image
+				}
+			}
+		}
+	}
+	return images
+}
+
+func imageChanges(old, current map[string]string) []ImageChange {
+	var changes []ImageChange
+	for name, image := range current {
+		if old[name] != image {
+			changes = append(changes, ImageChange{Container: name, Old: old[name], New: image})
+		}
+	}
+	for name, image := range old {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, ImageChange{Container: name, Old: image})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Container < changes[j].Container })
+	return changes
+}
+
+func labelsOf(content map[string]interface{}) map[string]string {
+	metadata, _ := content["metadata"].(map[string]interface{})
+	raw, _ := metadata["labels"].(map[string]interface{})
+	labels := make(map[string]string, len(raw))
+	for key, value := range raw {
+		labels[key], _ = value.(string)
+	}
+	return labels
+}
+
+func labelChanges(old, current map[string]string) *LabelChange {
+	change := &LabelChange{}
+	for key, value := range current {
+		oldValue, ok := old[key]
+		switch {
+		case !ok:
+			if change.Added == nil {
+				change.Added = map[string]string{}
+			}
+			change.Added[key] = value
+		case oldValue != value:
+			if change.Changed == nil {
+				change.Changed = map[string]ValueChange{}
+			}
+			change.Changed[key] = ValueChange{Old: oldValue, New: value}
+		}
+	}
+	for key, value := range old {
+		if _, ok := current[key]; !ok {
+			if change.Removed == nil {
+				change.Removed = map[string]string{}
+			}
+			change.Removed[key] = value
+		}
+	}
+	if change.Added == nil && change.Removed == nil && change.Changed == nil {
+		return nil
+	}
+	return change
+}
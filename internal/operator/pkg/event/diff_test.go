@@ -0,0 +1,122 @@
+package event
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func deployment(replicas int32, image, secret string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "app",
+						Image: image,
+						Env:   []corev1.EnvVar{{Name: "TOKEN", Value: secret}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func TestNewDiff(t *testing.T) {
+	t.Parallel()
+
+	base := deployment(2, "shop:1.0", "s3cret", map[string]string{"app": "web"})
+	statusOnly := base.DeepCopy()
+	statusOnly.Status.ReadyReplicas = 2
+
+	tests := []struct {
+		name         string
+		old, current runtime.Object
+		wantNil      bool
+		wantReplicas *ReplicaChange
+		wantImages   []ImageChange
+		wantLabels   *LabelChange
+	}{
+		{name: "no old object", current: base, wantNil: true},
+		{name: "status only", old: base, current: statusOnly, wantNil: true},
+		{
+			name:         "scaled",
+			old:          base,
+			current:      deployment(5, "shop:1.0", "s3cret", map[string]string{"app": "web"}),
+			wantReplicas: &ReplicaChange{Old: 2, New: 5},
+		},
+		{
+			name:       "new image",
+			old:        base,
+			current:    deployment(2, "shop:1.1", "s3cret", map[string]string{"app": "web"}),
+			wantImages: []ImageChange{{Container: "app", Old: "shop:1.0", New: "shop:1.1"}},
+		},
+		{
+			name:    "relabelled",
+			old:     base,
+			current: deployment(2, "shop:1.0", "s3cret", map[string]string{"app": "shop", "tier": "front"}),
+			wantLabels: &LabelChange{
+				Added:   map[string]string{"tier": "front"},
+				Changed: map[string]ValueChange{"app": {Old: "web", New: "shop"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewDiff(tt.old, tt.current)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("NewDiff() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("NewDiff() = nil")
+			}
+			if (got.Replicas == nil) != (tt.wantReplicas == nil) || (got.Replicas != nil && *got.Replicas != *tt.wantReplicas) {
+				t.Errorf("Replicas = %+v, want %+v", got.Replicas, tt.wantReplicas)
+			}
+			if len(got.Images) != len(tt.wantImages) || (len(got.Images) > 0 && got.Images[0] != tt.wantImages[0]) {
+				t.Errorf("Images = %+v, want %+v", got.Images, tt.wantImages)
+			}
+			if (got.Labels == nil) != (tt.wantLabels == nil) ||
+				(got.Labels != nil && (len(got.Labels.Added) != len(tt.wantLabels.Added) || len(got.Labels.Changed) != len(tt.wantLabels.Changed) || got.Labels.Changed["app"] != tt.wantLabels.Changed["app"])) {
+				t.Errorf("Labels = %+v, want %+v", got.Labels, tt.wantLabels)
+			}
+			if got.Summary == "" {
+				t.Error("Summary is empty")
+			}
+		})
+	}
+}
+
+func TestNewDiffHashesEnvValues(t *testing.T) {
+	t.Parallel()
+
+	got := NewDiff(
+		deployment(2, "shop:1.0", "s3cret", nil),
+		deployment(2, "shop:1.0", "rotated", nil),
+	)
+	if got == nil || len(got.Changes) != 1 {
+		t.Fatalf("NewDiff() = %+v, want one change", got)
+	}
+	change := got.Changes[0]
+	for _, value := range []interface{}{change.Old, change.New} {
+		s, _ := value.(string)
+		if !strings.HasPrefix(s, "sha256:") {
+			t.Errorf("env value %v is not hashed", value)
+		}
+	}
+	if change.Old == change.New {
+		t.Error("hashes of different values are equal")
+	}
+}
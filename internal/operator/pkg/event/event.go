@@ -19,6 +19,8 @@ type Event struct {
 	Name       string
 	Obj        runtime.Object
 	OldObj     runtime.Object
+	// Diff describes what an update changed, nil for other events
+	Diff *Diff
 }
 
 var m = map[string]string{
@@ -66,6 +68,57 @@ func (e *Event) Message() (msg string) {
 			"Node `%s` Rebooted : \nNodeRebooted",
 			e.Name,
 		)
+	case "approval":
+		msg = fmt.Sprintf(
+			"Approval for `%s` on `%s` has been `%s` : \n%s",
+			e.Name,
+			e.Host,
+			e.Reason,
+			e.Status,
+		)
+	case "break-glass":
+		msg = fmt.Sprintf(
+			"Break-glass access for `%s` on `%s` has been `%s` : \n%s",
+			e.Name,
+			e.Host,
+			e.Reason,
+			e.Status,
+		)
+	case "incident":
+		msg = fmt.Sprintf(
+			"Incident `%s` on `%s` has been `%s`",
+			e.Name,
+			e.Host,
+			e.Reason,
+		)
+	case "admission-webhook":
+		msg = fmt.Sprintf(
+			"Admission webhook `%s` on `%s` is `%s`",
+			e.Name,
+			e.Host,
+			e.Reason,
+		)
+	case "restart-loop":
+		msg = fmt.Sprintf(
+			"Pod `%s` in `%s` on `%s` is restart looping : \n%s",
+			e.Name,
+			e.Namespace,
+			e.Host,
+			e.Reason,
+		)
+	case "vulnerability":
+		msg = fmt.Sprintf(
+			"Image `%s` has severe vulnerabilities : \n%s",
+			e.Name,
+			e.Reason,
+		)
+	case "test-notification":
+		msg = fmt.Sprintf(
+			"Test notification with severity `%s` for `%s` : \n%s",
+			e.Status,
+			e.Host,
+			e.Reason,
+		)
 	case "Backoff":
 		msg = fmt.Sprintf(
 			"Pod `%s` in `%s` Crashed : \nCrashLoopBackOff %s",
@@ -0,0 +1,63 @@
+package event
+
+import (
+	"strings"
+	"sync"
+)
+
+// IncidentAction is what a paging dispatcher does for an event
+type IncidentAction int
+
+const (
+	// IncidentNone leaves the incidents alone
+	IncidentNone IncidentAction = iota
+	// IncidentTrigger opens an incident, or adds to the open one with the same dedup key
+	IncidentTrigger
+	// IncidentResolve resolves the open incident
+	IncidentResolve
+)
+
+// DedupKey identifies the object incidents are opened for, so that follow-up events about it
+// update or resolve the same incident
+func (e *Event) DedupKey() string {
+	return strings.Join([]string{e.Host, e.Namespace, e.Kind, e.Name}, "/")
+}
+
+// OpenIncidents tracks the incidents a paging dispatcher opened, so that Normal events only
+// resolve incidents that exist instead of calling the paging service for every Normal event.
+// It is kept in memory, incidents open when the operator restarts are resolved by hand.
+type OpenIncidents struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+// Action returns what to do for an event: Danger triggers, Normal resolves an open incident
+func (o *OpenIncidents) Action(e Event) IncidentAction {
+	switch e.Status {
+	case "Danger":
+		return IncidentTrigger
+	case "Normal":
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if o.keys[e.DedupKey()] {
+			return IncidentResolve
+		}
+	}
+	return IncidentNone
+}
+
+// Record marks the incident of a dedup key open or resolved once the paging service accepted the action
+func (o *OpenIncidents) Record(key string, action IncidentAction) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch action {
+	case IncidentTrigger:
+		if o.keys == nil {
+			o.keys = map[string]bool{}
+		}
+		o.keys[key] = true
+	case IncidentResolve:
+		delete(o.keys, key)
+	}
+}
@@ -0,0 +1,45 @@
+package event
+
+import "testing"
+
+func TestOpenIncidents(t *testing.T) {
+	t.Parallel()
+
+	pod := func(status string) Event {
+		return Event{Host: "prod", Namespace: "shop", Kind: "pod", Name: "web", Status: status}
+	}
+	other := Event{Host: "prod", Namespace: "shop", Kind: "pod", Name: "db", Status: "Normal"}
+
+	var incidents OpenIncidents
+	steps := []struct {
+		name   string
+		event  Event
+		record bool
+		want   IncidentAction
+	}{
+		{name: "normal without incident", event: pod("Normal"), want: IncidentNone},
+		{name: "warning", event: pod("Warning"), want: IncidentNone},
+		{name: "danger not delivered", event: pod("Danger"), want: IncidentTrigger},
+		{name: "normal after undelivered trigger", event: pod("Normal"), want: IncidentNone},
+		{name: "danger", event: pod("Danger"), record: true, want: IncidentTrigger},
+		{name: "normal of another object", event: other, want: IncidentNone},
+		{name: "normal resolves", event: pod("Normal"), record: true, want: IncidentResolve},
+		{name: "normal after resolve", event: pod("Normal"), want: IncidentNone},
+	}
+
+	// Steps share the incidents, so they run in order
+	for _, step := range steps {
+		action := incidents.Action(step.event)
+		if action != step.want {
+			t.Fatalf("%s: Action() = %v, want %v", step.name, action, step.want)
+		}
+		if step.record {
+			incidents.Record(step.event.DedupKey(), action)
+		}
+	}
+
+	danger := pod("Danger")
+	if key := danger.DedupKey(); key != "prod/shop/pod/web" {
+		t.Errorf("DedupKey() = %q, want prod/shop/pod/web", key)
+	}
+}
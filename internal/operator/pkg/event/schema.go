@@ -0,0 +1,111 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Versions of the payloads events are dispatched and served as
+const (
+	// SchemaV1 is the unversioned payload of the first releases, kept for receivers built against it
+	SchemaV1 = "v1"
+	// SchemaV2 is the flat event document
+	SchemaV2 = "v2"
+
+	// LatestSchema is the newest version
+	LatestSchema = SchemaV2
+	// DefaultSchema is used when a receiver pins no version, so existing receivers keep working
+	DefaultSchema = SchemaV1
+
+	// SchemaHeader carries the schema version of a payload
+	SchemaHeader = "X-Agentkube-Schema-Version"
+)
+
+// ErrUnknownSchema is returned for schema versions that don't exist
+var ErrUnknownSchema = errors.New("unknown event schema version")
+
+// SchemaChange describes what a schema version changed
+type SchemaChange struct {
+	Version  string   `json:"version"`
+	Breaking bool     `json:"breaking"`
+	Changes  []string `json:"changes"`
+}
+
+// changelog lists the schema versions, oldest first
+var changelog = []SchemaChange{
+	{
+		Version: SchemaV1,
+		Changes: []string{
+			"eventmeta holds kind, name, namespace, reason and host",
+			"text is the rendered message, time when it was sent",
+		},
+	},
+	{
+		Version:  SchemaV2,
+		Breaking: true,
+		Changes: []string{
+			"fields are flat instead of nested under eventmeta",
+			"host is renamed cluster",
+			"text is renamed message",
+			"adds schemaVersion, apiVersion, status and component",
+			"adds diff, what an update changed",
+		},
+	},
+}
+
+// Changelog returns the schema versions, oldest first
+func Changelog() []SchemaChange {
+	return append([]SchemaChange(nil), changelog...)
+}
+
+// ResolveSchema returns the version a receiver pinned, DefaultSchema when it pinned none and
+// LatestSchema for "latest"
+func ResolveSchema(version string) (string, error) {
+	switch version {
+	case "":
+		return DefaultSchema, nil
+	case "latest":
+		return LatestSchema, nil
+	}
+	for _, change := range changelog {
+		if change.Version == version {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownSchema, version)
+}
+
+// Document is an event in the v2 schema
+type Document struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Cluster       string    `json:"cluster"`
+	Namespace     string    `json:"namespace,omitempty"`
+	APIVersion    string    `json:"apiVersion,omitempty"`
+	Kind          string    `json:"kind"`
+	Name          string    `json:"name"`
+	Reason        string    `json:"reason"`
+	Status        string    `json:"status,omitempty"`
+	Component     string    `json:"component,omitempty"`
+	Message       string    `json:"message"`
+	Time          time.Time `json:"time"`
+	Diff          *Diff     `json:"diff,omitempty"`
+}
+
+// Document renders the event in the v2 schema
+func (e *Event) Document(now time.Time) Document {
+	return Document{
+		SchemaVersion: SchemaV2,
+		Cluster:       e.Host,
+		Namespace:     e.Namespace,
+		APIVersion:    e.ApiVersion,
+		Kind:          e.Kind,
+		Name:          e.Name,
+		Reason:        e.Reason,
+		Status:        e.Status,
+		Component:     e.Component,
+		Message:       e.Message(),
+		Time:          now,
+		Diff:          e.Diff,
+	}
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolveSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{version: "", want: SchemaV1},
+		{version: "latest", want: LatestSchema},
+		{version: "v2", want: SchemaV2},
+		{version: "v9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.version, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ResolveSchema(tt.version)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownSchema) {
+					t.Errorf("ResolveSchema() error = %v, want ErrUnknownSchema", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveSchema() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e := Event{Host: "prod", Namespace: "shop", Kind: "pod", Name: "api", Reason: "created", ApiVersion: "v1"}
+	got := e.Document(now)
+	want := Document{
+		SchemaVersion: SchemaV2, Cluster: "prod", Namespace: "shop", APIVersion: "v1", Kind: "pod", Name: "api",
+		Reason: "created", Message: e.Message(), Time: now,
+	}
+	if got != want {
+		t.Errorf("Document() = %+v, want %+v", got, want)
+	}
+	if latest := Changelog()[len(Changelog())-1].Version; latest != LatestSchema {
+		t.Errorf("last changelog version = %s, want LatestSchema %s", latest, LatestSchema)
+	}
+}
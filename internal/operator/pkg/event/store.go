@@ -0,0 +1,189 @@
+package event
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const storeFileName = "events.json"
+
+// Record is an event the operator produced about a live object, such as a policy finding.
+// Source names the producing feature, Labels carry its own identifiers.
+type Record struct {
+	Source     string            `json:"source"`
+	Cluster    string            `json:"cluster"`
+	Namespace  string            `json:"namespace,omitempty"`
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Resource   string            `json:"resource"`
+	Name       string            `json:"name"`
+	Reason     string            `json:"reason"`
+	Severity   string            `json:"severity,omitempty"`
+	Message    string            `json:"message"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	FirstSeen  time.Time         `json:"firstSeen"`
+	LastSeen   time.Time         `json:"lastSeen"`
+}
+
+// Filter narrows down a record listing, empty fields match everything
+type Filter struct {
+	Source    string
+	Cluster   string
+	Namespace string
+	Kind      string
+	Name      string
+	Severity  string
+	Labels    map[string]string
+}
+
+// Store keeps the current records of every source. Records are cached in memory and only
+// written back when they change.
+type Store struct {
+	filePath string
+	mutex    sync.Mutex
+	records  []Record
+	loaded   bool
+}
+
+var (
+	store     *Store
+	storeOnce sync.Once
+)
+
+// GetStore returns the event store backed by the agentkube config directory
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		store = &Store{filePath: filepath.Join(utils.ConfigDir(), storeFileName)}
+	})
+	return store
+}
+
+// List returns the records matching the filter
+func (s *Store) List(filter Filter) ([]Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	for _, r := range s.records {
+		if filter.matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// Replace swaps the records of a source on a cluster for a new set. A nil scope replaces all of
+// them, otherwise only the records inside the scope. Records that persist keep their FirstSeen.
+// It reports whether the set changed, with touch unset an unchanged set is not written back.
+func (s *Store) Replace(source, cluster string, scope func(Record) bool, records []Record, touch bool) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+
+	previous := map[string]Record{}
+	kept := make([]Record, 0, len(s.records)+len(records))
+	for _, r := range s.records {
+		if r.Source == source && r.Cluster == cluster && (scope == nil || scope(r)) {
+			previous[r.key()] = r
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	changed := len(previous) != len(records)
+	for _, r := range records {
+		r.Source = source
+		r.Cluster = cluster
+		if existing, ok := previous[r.key()]; ok {
+			r.FirstSeen = existing.FirstSeen
+		} else {
+			changed = true
+		}
+		kept = append(kept, r)
+	}
+
+	if !changed && !touch {
+		return false, nil
+	}
+	return changed, s.save(kept)
+}
+
+// Remove deletes the records of a source that match, or all of them when match is nil
+func (s *Store) Remove(source string, match func(Record) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	kept := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		if r.Source != source || (match != nil && !match(r)) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(s.records) {
+		return nil
+	}
+	return s.save(kept)
+}
+
+func (s *Store) load() error {
+	if s.loaded {
+		return nil
+	}
+	var records []Record
+	if err := utils.ReadJSONFile(s.filePath, &records); err != nil {
+		return err
+	}
+	s.records = records
+	s.loaded = true
+	return nil
+}
+
+func (s *Store) save(records []Record) error {
+	if err := utils.WriteJSONFile(s.filePath, records); err != nil {
+		return err
+	}
+	s.records = records
+	return nil
+}
+
+func (r Record) key() string {
+	keys := make([]string, 0, len(r.Labels))
+	for k := range r.Labels {
+		keys = append(keys, k+"="+r.Labels[k])
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",") + "|" + r.APIVersion + "|" + r.Kind + "|" + r.Namespace + "|" + r.Name + "|" + r.Reason + "|" + r.Message
+}
+
+func (filter Filter) matches(r Record) bool {
+	if (filter.Source != "" && r.Source != filter.Source) ||
+		(filter.Cluster != "" && r.Cluster != filter.Cluster) ||
+		(filter.Namespace != "" && r.Namespace != filter.Namespace) ||
+		(filter.Kind != "" && r.Kind != filter.Kind) ||
+		(filter.Name != "" && r.Name != filter.Name) ||
+		(filter.Severity != "" && r.Severity != filter.Severity) {
+		return false
+	}
+	for k, v := range filter.Labels {
+		if r.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package eventstream
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/redact"
+)
+
+// bufferSize is how many events a stream holds before it drops the newest ones
+const bufferSize = 256
+
+// severities are the event statuses streams filter on
+var severities = map[string]bool{"normal": true, "warning": true, "danger": true}
+
+// Filter selects the events a stream receives, empty fields match every event
+type Filter struct {
+	Namespaces []string
+	Kinds      []string
+	Severities []string
+}
+
+// ParseFilter builds a filter from comma-separated query values, rejecting unknown severities
+func ParseFilter(namespaces, kinds, statuses string) (Filter, error) {
+	filter := Filter{
+		Namespaces: splitList(namespaces),
+		Kinds:      splitList(kinds),
+		Severities: splitList(statuses),
+	}
+	for _, severity := range filter.Severities {
+		if !severities[strings.ToLower(severity)] {
+			return Filter{}, fmt.Errorf("unknown severity %q, expected Normal, Warning or Danger", severity)
+		}
+	}
+	return filter, nil
+}
+
+// Matches reports whether the event passes the filter, kinds and severities compare case-insensitively
+func (f Filter) Matches(e event.Event) bool {
+	return matchesAny(f.Namespaces, e.Namespace, func(a, b string) bool { return a == b }) &&
+		matchesAny(f.Kinds, e.Kind, strings.EqualFold) &&
+		matchesAny(f.Severities, e.Status, strings.EqualFold)
+}
+
+func matchesAny(values []string, value string, equal func(a, b string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Subscription is an open stream of the events of a cluster
+type Subscription struct {
+	// Events receives the matching events in the v2 schema
+	Events  <-chan event.Document
+	events  chan event.Document
+	cluster string
+	filter  Filter
+	dropped atomic.Int64
+}
+
+// Dropped returns how many events were dropped since the last call because the stream fell behind
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Broker fans the events the watchers dispatch out to the open streams
+type Broker struct {
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+var (
+	broker     *Broker
+	brokerOnce sync.Once
+)
+
+// GetBroker returns the shared event broker
+func GetBroker() *Broker {
+	brokerOnce.Do(func() {
+		broker = NewBroker()
+	})
+	return broker
+}
+
+// NewBroker returns a broker without streams
+func NewBroker() *Broker {
+	return &Broker{subscriptions: map[*Subscription]struct{}{}}
+}
+
+// Subscribe opens a stream of the events of a cluster that pass the filter
+func (b *Broker) Subscribe(cluster string, filter Filter) *Subscription {
+	events := make(chan event.Document, bufferSize)
+	s := &Subscription{Events: events, events: events, cluster: cluster, filter: filter}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe closes a stream, it receives no events afterwards
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subscriptions, s)
+}
+
+// Publish hands an event to the streams it matches without blocking, streams that fell behind
+// drop it. Annotations and labels are redacted as for dispatched events.
+func (b *Broker) Publish(e event.Event) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	var document *event.Document
+	for s := range b.subscriptions {
+		if s.cluster != e.Host || !s.filter.Matches(e) {
+			continue
+		}
+		if document == nil {
+			outgoing := redact.Event(e)
+			outgoing.Diff = event.NewDiff(outgoing.OldObj, outgoing.Obj)
+			doc := outgoing.Document(time.Now())
+			document = &doc
+		}
+		select {
+		case s.events <- *document:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
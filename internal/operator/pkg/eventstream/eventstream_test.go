@@ -0,0 +1,77 @@
+package eventstream
+
+import (
+	"testing"
+
+	"github.com/agentkube/operator/pkg/event"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	e := event.Event{Host: "prod", Namespace: "shop", Kind: "Pod", Status: "Warning"}
+	tests := []struct {
+		name                        string
+		namespaces, kinds, statuses string
+		want                        bool
+		wantErr                     bool
+	}{
+		{name: "empty", want: true},
+		{name: "namespace", namespaces: "default, shop", want: true},
+		{name: "other namespace", namespaces: "default", want: false},
+		{name: "kind ignores case", kinds: "pod,deployment", want: true},
+		{name: "severity ignores case", statuses: "warning,Danger", want: true},
+		{name: "other severity", statuses: "Danger", want: false},
+		{name: "unknown severity", statuses: "critical", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			filter, err := ParseFilter(tt.namespaces, tt.kinds, tt.statuses)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && filter.Matches(e) != tt.want {
+				t.Errorf("Matches() = %v, want %v", !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroker(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker()
+	prod := b.Subscribe("prod", Filter{Kinds: []string{"Pod"}})
+	staging := b.Subscribe("staging", Filter{})
+
+	b.Publish(event.Event{Host: "prod", Kind: "Pod", Name: "web", Reason: "created"})
+	b.Publish(event.Event{Host: "prod", Kind: "Service", Name: "web", Reason: "created"})
+	if got := len(prod.Events); got != 1 {
+		t.Fatalf("prod received %d events, want 1", got)
+	}
+	if document := <-prod.Events; document.Cluster != "prod" || document.Name != "web" || document.SchemaVersion != event.SchemaV2 {
+		t.Errorf("document = %+v, want the prod pod in the v2 schema", document)
+	}
+	if len(staging.Events) != 0 {
+		t.Errorf("staging received the events of prod")
+	}
+
+	// A stream that falls behind drops the newest events
+	for i := 0; i < bufferSize+3; i++ {
+		b.Publish(event.Event{Host: "prod", Kind: "Pod", Name: "web", Reason: "updated"})
+	}
+	if dropped := prod.Dropped(); dropped != 3 {
+		t.Errorf("Dropped() = %d, want 3", dropped)
+	}
+	if dropped := prod.Dropped(); dropped != 0 {
+		t.Errorf("Dropped() after reading = %d, want 0", dropped)
+	}
+
+	b.Unsubscribe(staging)
+	b.Publish(event.Event{Host: "staging", Kind: "Pod", Name: "web", Reason: "created"})
+	if len(staging.Events) != 0 {
+		t.Errorf("staging received an event after unsubscribing")
+	}
+}
@@ -0,0 +1,345 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const fileName = "features.json"
+
+// Flags of the subsystems that ship dark
+const (
+	AttackPathScoring = "attack-path-scoring"
+	AutoRemediation   = "auto-remediation"
+	AITools           = "ai-tools"
+	SelfUpgrade       = "self-upgrade"
+	KubeletStats      = "kubelet-stats"
+)
+
+// Maturity stages of a flag
+const (
+	StageAlpha = "alpha"
+	StageBeta  = "beta"
+	StageGA    = "ga"
+)
+
+// Built-in profiles
+const (
+	// ProfileDefault enables the flags that are on by default
+	ProfileDefault = "default"
+	// ProfilePreview enables every flag
+	ProfilePreview = "preview"
+)
+
+// Sources of the state of a flag
+const (
+	SourceDefault  = "default"
+	SourceProfile  = "profile"
+	SourceOverride = "override"
+)
+
+var (
+	// ErrUnknownFlag is returned for flags that aren't registered
+	ErrUnknownFlag = errors.New("unknown feature flag")
+	// ErrUnknownProfile is returned for profiles that don't exist
+	ErrUnknownProfile = errors.New("unknown feature profile")
+	// ErrBuiltinProfile is returned when changing a built-in profile
+	ErrBuiltinProfile = errors.New("built-in profiles can't be changed")
+)
+
+// Flag is a toggle of an experimental subsystem
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Stage       string `json:"stage"`
+	Default     bool   `json:"default"`
+}
+
+// flags are the registered flags
+var flags = []Flag{
+	{Name: AttackPathScoring, Description: "Score attack paths from exposed workloads to sensitive resources", Stage: StageAlpha},
+	{Name: AutoRemediation, Description: "Apply fixes for detected problems without confirmation", Stage: StageAlpha},
+	{Name: AITools, Description: "Expose cluster tools to AI assistants", Stage: StageBeta},
+	{Name: SelfUpgrade, Description: "Upgrade the in-cluster operator deployment from the release channel", Stage: StageBeta},
+	{Name: KubeletStats, Description: "Scrape the kubelet stats summary through the node proxy for container filesystem and network usage", Stage: StageBeta},
+}
+
+// Config is the feature configuration of the installation
+type Config struct {
+	// Profile is the active profile
+	Profile string `json:"profile"`
+	// Profiles are the custom profiles, mapping flags to their state. Flags a profile doesn't set keep their default.
+	Profiles map[string]map[string]bool `json:"profiles"`
+	// Overrides are set at runtime and win over the profile
+	Overrides map[string]bool `json:"overrides"`
+}
+
+// State is the resolved state of a flag
+type State struct {
+	Flag
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+}
+
+// Store persists the feature configuration
+type Store struct {
+	filePath string
+	mutex    sync.Mutex
+	config   *Config
+}
+
+var (
+	globalStore *Store
+	storeOnce   sync.Once
+)
+
+// GetStore returns the shared feature store
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		globalStore = &Store{
+			filePath: filepath.Join(utils.ConfigDir(), fileName),
+		}
+	})
+	return globalStore
+}
+
+// Enabled reports whether a feature is enabled
+func Enabled(name string) bool {
+	return GetStore().Enabled(name)
+}
+
+// Flags returns the registered flags
+func Flags() []Flag {
+	return append([]Flag(nil), flags...)
+}
+
+// Enabled reports whether a feature is enabled
+func (s *Store) Enabled(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		// Fail closed, experimental subsystems stay dark when the configuration is unreadable
+		return false
+	}
+	state, ok := resolve(*s.config, name)
+	return ok && state.Enabled
+}
+
+// List returns the resolved state of every flag
+func (s *Store) List() ([]State, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(flags))
+	for _, flag := range flags {
+		state, _ := resolve(*s.config, flag.Name)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Config returns the feature configuration
+func (s *Store) Config() (Config, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return Config{}, err
+	}
+	return copyConfig(*s.config), nil
+}
+
+// Profiles returns the names of the built-in and custom profiles
+func (s *Store) Profiles() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(s.config.Profiles))
+	for name := range s.config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{ProfileDefault, ProfilePreview}, names...), nil
+}
+
+// SetProfile activates a profile
+func (s *Store) SetProfile(profile string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.config.Profiles[profile]; !ok && !builtin(profile) {
+		return fmt.Errorf("%w: %s", ErrUnknownProfile, profile)
+	}
+	s.config.Profile = profile
+	return s.save()
+}
+
+// SaveProfile creates or replaces a custom profile
+func (s *Store) SaveProfile(profile string, toggles map[string]bool) error {
+	if builtin(profile) {
+		return fmt.Errorf("%w: %s", ErrBuiltinProfile, profile)
+	}
+	if profile == "" {
+		return errors.New("profile name is required")
+	}
+	for name := range toggles {
+		if _, ok := lookup(name); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	profileToggles := make(map[string]bool, len(toggles))
+	for name, enabled := range toggles {
+		profileToggles[name] = enabled
+	}
+	s.config.Profiles[profile] = profileToggles
+	return s.save()
+}
+
+// DeleteProfile removes a custom profile, the active profile falls back to the default one
+func (s *Store) DeleteProfile(profile string) error {
+	if builtin(profile) {
+		return fmt.Errorf("%w: %s", ErrBuiltinProfile, profile)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.config.Profiles[profile]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProfile, profile)
+	}
+	delete(s.config.Profiles, profile)
+	if s.config.Profile == profile {
+		s.config.Profile = ProfileDefault
+	}
+	return s.save()
+}
+
+// SetOverride forces the state of a flag regardless of the profile
+func (s *Store) SetOverride(name string, enabled bool) error {
+	if _, ok := lookup(name); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.config.Overrides[name] = enabled
+	return s.save()
+}
+
+// ClearOverride returns a flag to the state of the profile
+func (s *Store) ClearOverride(name string) error {
+	if _, ok := lookup(name); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	delete(s.config.Overrides, name)
+	return s.save()
+}
+
+// resolve returns the state of a flag: an override wins over the profile, which wins over the default
+func resolve(config Config, name string) (State, bool) {
+	flag, ok := lookup(name)
+	if !ok {
+		return State{}, false
+	}
+
+	state := State{Flag: flag, Enabled: flag.Default, Source: SourceDefault}
+	switch config.Profile {
+	case ProfileDefault, "":
+	case ProfilePreview:
+		state.Enabled, state.Source = true, SourceProfile
+	default:
+		if enabled, ok := config.Profiles[config.Profile][name]; ok {
+			state.Enabled, state.Source = enabled, SourceProfile
+		}
+	}
+	if enabled, ok := config.Overrides[name]; ok {
+		state.Enabled, state.Source = enabled, SourceOverride
+	}
+	return state, true
+}
+
+func lookup(name string) (Flag, bool) {
+	for _, flag := range flags {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+func builtin(profile string) bool {
+	return profile == ProfileDefault || profile == ProfilePreview
+}
+
+func copyConfig(config Config) Config {
+	copied := Config{Profile: config.Profile, Profiles: map[string]map[string]bool{}, Overrides: map[string]bool{}}
+	for profile, toggles := range config.Profiles {
+		copied.Profiles[profile] = map[string]bool{}
+		for name, enabled := range toggles {
+			copied.Profiles[profile][name] = enabled
+		}
+	}
+	for name, enabled := range config.Overrides {
+		copied.Overrides[name] = enabled
+	}
+	return copied
+}
+
+// load reads the store on first use, the caller must hold the mutex
+func (s *Store) load() error {
+	if s.config != nil {
+		return nil
+	}
+	config := Config{Profile: ProfileDefault}
+	if err := utils.ReadJSONFile(s.filePath, &config); err != nil {
+		return err
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]map[string]bool{}
+	}
+	if config.Overrides == nil {
+		config.Overrides = map[string]bool{}
+	}
+	s.config = &config
+	return nil
+}
+
+func (s *Store) save() error {
+	return utils.WriteJSONFile(s.filePath, s.config)
+}
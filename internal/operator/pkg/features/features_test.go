@@ -0,0 +1,100 @@
+package features
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		config      Config
+		flag        string
+		wantEnabled bool
+		wantSource  string
+	}{
+		{name: "default", config: Config{Profile: ProfileDefault}, flag: AutoRemediation, wantEnabled: false, wantSource: SourceDefault},
+		{name: "preview profile", config: Config{Profile: ProfilePreview}, flag: AutoRemediation, wantEnabled: true, wantSource: SourceProfile},
+		{
+			name:        "custom profile",
+			config:      Config{Profile: "staging", Profiles: map[string]map[string]bool{"staging": {AITools: true}}},
+			flag:        AITools,
+			wantEnabled: true,
+			wantSource:  SourceProfile,
+		},
+		{
+			name:        "flag not set by the profile",
+			config:      Config{Profile: "staging", Profiles: map[string]map[string]bool{"staging": {AITools: true}}},
+			flag:        AttackPathScoring,
+			wantEnabled: false,
+			wantSource:  SourceDefault,
+		},
+		{
+			name:        "override wins over the profile",
+			config:      Config{Profile: ProfilePreview, Overrides: map[string]bool{SelfUpgrade: false}},
+			flag:        SelfUpgrade,
+			wantEnabled: false,
+			wantSource:  SourceOverride,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			state, ok := resolve(tt.config, tt.flag)
+			if !ok || state.Enabled != tt.wantEnabled || state.Source != tt.wantSource {
+				t.Errorf("resolve() = %+v, %v, want enabled %v from %s", state, ok, tt.wantEnabled, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	s := &Store{filePath: filepath.Join(t.TempDir(), fileName)}
+	if s.Enabled(AITools) {
+		t.Fatal("ai-tools enabled without configuration")
+	}
+	if err := s.SaveProfile("staging", map[string]bool{AITools: true}); err != nil {
+		t.Fatalf("SaveProfile() error = %v", err)
+	}
+	if err := s.SetProfile("staging"); err != nil {
+		t.Fatalf("SetProfile() error = %v", err)
+	}
+	if !s.Enabled(AITools) {
+		t.Error("ai-tools disabled by the active profile")
+	}
+	if err := s.SetOverride(AITools, false); err != nil || s.Enabled(AITools) {
+		t.Errorf("SetOverride() error = %v, enabled = %v", err, s.Enabled(AITools))
+	}
+
+	// A new store reads the persisted configuration
+	reloaded := &Store{filePath: s.filePath}
+	config, err := reloaded.Config()
+	if err != nil || config.Profile != "staging" || config.Overrides[AITools] {
+		t.Errorf("Config() = %+v, %v", config, err)
+	}
+
+	if err := s.DeleteProfile("staging"); err != nil {
+		t.Fatalf("DeleteProfile() error = %v", err)
+	}
+	if config, _ := s.Config(); config.Profile != ProfileDefault {
+		t.Errorf("profile after deletion = %s, want %s", config.Profile, ProfileDefault)
+	}
+
+	if err := s.SetOverride("unknown", true); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("SetOverride(unknown) error = %v, want ErrUnknownFlag", err)
+	}
+	if err := s.SaveProfile(ProfilePreview, nil); !errors.Is(err, ErrBuiltinProfile) {
+		t.Errorf("SaveProfile(preview) error = %v, want ErrBuiltinProfile", err)
+	}
+	if err := s.SetProfile("missing"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("SetProfile(missing) error = %v, want ErrUnknownProfile", err)
+	}
+}
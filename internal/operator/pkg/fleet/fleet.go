@@ -0,0 +1,160 @@
+package fleet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/agentkube/operator/config"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// MaxClusters bounds the clusters of a manifest onboarded in one operation
+	MaxClusters = 500
+	// DefaultSecretKey is the secret key read when a reference names none
+	DefaultSecretKey = "kubeconfig"
+)
+
+// ErrInvalidManifest is returned for manifests that can't be onboarded
+var ErrInvalidManifest = errors.New("invalid fleet manifest")
+
+// Manifest lists the clusters of a fleet onboarded in one operation
+type Manifest struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+// Cluster is a cluster of a fleet manifest, its kubeconfig read from a file on the operator host
+// or from a secret of an already registered cluster
+type Cluster struct {
+	// Name prefixes the contexts added from the kubeconfig, like the source name of an upload
+	Name           string     `json:"name"`
+	KubeconfigPath string     `json:"kubeconfigPath,omitempty"`
+	SecretRef      *SecretRef `json:"secretRef,omitempty"`
+	// Labels are set on every context added for the cluster
+	Labels   map[string]string `json:"labels,omitempty"`
+	ReadOnly bool              `json:"readOnly,omitempty"`
+	// Watch adds the contexts to the watched clusters, or skips them. Nil leaves the watcher
+	// configuration alone.
+	Watch *bool `json:"watch,omitempty"`
+	// TTL in hours, 0 means no expiry
+	TTL int `json:"ttl,omitempty"`
+}
+
+// SecretRef points to a secret holding a kubeconfig
+type SecretRef struct {
+	// Context is the registered context the secret is read from
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+}
+
+// ParseManifest reads a manifest in YAML or JSON and validates it
+func ParseManifest(data []byte) (*Manifest, error) {
+	manifest := &Manifest{}
+	if err := yaml.UnmarshalStrict(data, manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Validate checks every cluster of the manifest, reporting all the problems found
+func (m *Manifest) Validate() error {
+	if len(m.Clusters) == 0 {
+		return fmt.Errorf("%w: no clusters", ErrInvalidManifest)
+	}
+	if len(m.Clusters) > MaxClusters {
+		return fmt.Errorf("%w: %d clusters, at most %d are onboarded at once", ErrInvalidManifest, len(m.Clusters), MaxClusters)
+	}
+
+	var problems []string
+	seen := map[string]bool{}
+	for i, cluster := range m.Clusters {
+		name := cluster.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		for _, problem := range cluster.problems() {
+			problems = append(problems, fmt.Sprintf("cluster %s: %s", name, problem))
+		}
+		if cluster.Name != "" && seen[cluster.Name] {
+			problems = append(problems, fmt.Sprintf("cluster %s: duplicate name", name))
+		}
+		seen[cluster.Name] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidManifest, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c Cluster) problems() []string {
+	var problems []string
+	if strings.TrimSpace(c.Name) == "" {
+		problems = append(problems, "name is required")
+	} else if strings.ContainsAny(c.Name, " /\\") {
+		problems = append(problems, "name contains spaces or slashes")
+	}
+
+	switch {
+	case c.KubeconfigPath == "" && c.SecretRef == nil:
+		problems = append(problems, "kubeconfigPath or secretRef is required")
+	case c.KubeconfigPath != "" && c.SecretRef != nil:
+		problems = append(problems, "kubeconfigPath and secretRef are exclusive")
+	case c.SecretRef != nil && (c.SecretRef.Context == "" || c.SecretRef.Namespace == "" || c.SecretRef.Name == ""):
+		problems = append(problems, "secretRef needs a context, namespace and name")
+	}
+
+	for key, value := range c.Labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			problems = append(problems, fmt.Sprintf("label %q: %s", key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			problems = append(problems, fmt.Sprintf("label %q value: %s", key, msg))
+		}
+	}
+	if c.TTL < 0 {
+		problems = append(problems, "ttl must not be negative")
+	}
+	return problems
+}
+
+// ApplyWatch adds contexts to the watched clusters or skips them. With an include list the
+// contexts are added to it, otherwise they are only taken off the skip list.
+func ApplyWatch(conf *config.Config, contexts []string, watch bool) {
+	for _, name := range contexts {
+		conf.SkipClusters = remove(conf.SkipClusters, name)
+		if watch {
+			if len(conf.IncludeClusters) > 0 && !contains(conf.IncludeClusters, name) {
+				conf.IncludeClusters = append(conf.IncludeClusters, name)
+			}
+			continue
+		}
+		conf.IncludeClusters = remove(conf.IncludeClusters, name)
+		conf.SkipClusters = append(conf.SkipClusters, name)
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(names []string, name string) []string {
+	kept := names[:0]
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
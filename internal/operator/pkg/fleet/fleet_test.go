@@ -0,0 +1,137 @@
+package fleet
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/operator/config"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestParseManifest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		manifest  string
+		wantErr   string
+		wantNames []string
+	}{
+		{
+			name: "yaml",
+			manifest: `
+clusters:
+- name: prod-eu
+  kubeconfigPath: ~/fleet/prod-eu.yaml
+  labels: {env: prod, region: eu}
+  watch: true
+- name: staging
+  secretRef: {context: mgmt, namespace: fleet, name: staging-kubeconfig}
+  readOnly: true
+`,
+			wantNames: []string{"prod-eu", "staging"},
+		},
+		{name: "json", manifest: `{"clusters":[{"name":"dev","kubeconfigPath":"/etc/dev.yaml"}]}`, wantNames: []string{"dev"}},
+		{name: "no clusters", manifest: `clusters: []`, wantErr: "no clusters"},
+		{name: "unknown field", manifest: `{"clusters":[{"name":"dev","path":"/etc/dev.yaml"}]}`, wantErr: "unknown field"},
+		{
+			name:     "every problem reported",
+			manifest: `{"clusters":[{"name":"a b","kubeconfigPath":"/a","secretRef":{"context":"m","namespace":"n","name":"s"}},{"kubeconfigPath":"/b","labels":{"env":"not valid!"}}]}`,
+			wantErr:  "cluster a b: name contains spaces or slashes; cluster a b: kubeconfigPath and secretRef are exclusive; cluster #2: name is required",
+		},
+		{name: "duplicate", manifest: `{"clusters":[{"name":"dev","kubeconfigPath":"/a"},{"name":"dev","kubeconfigPath":"/b"}]}`, wantErr: "duplicate name"},
+		{name: "incomplete secret", manifest: `{"clusters":[{"name":"dev","secretRef":{"context":"mgmt"}}]}`, wantErr: "secretRef needs"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			manifest, err := ParseManifest([]byte(tt.manifest))
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidManifest) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseManifest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifest() error = %v", err)
+			}
+			var names []string
+			for _, cluster := range manifest.Clusters {
+				names = append(names, cluster.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("clusters = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestApplyWatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		conf        config.Config
+		watch       bool
+		wantInclude []string
+		wantSkip    []string
+	}{
+		{name: "watch everything", conf: config.Config{SkipClusters: []string{"old", "a"}}, watch: true, wantSkip: []string{"old"}},
+		{name: "watch with include list", conf: config.Config{IncludeClusters: []string{"old"}}, watch: true, wantInclude: []string{"old", "a", "b"}},
+		{name: "skip", conf: config.Config{IncludeClusters: []string{"a", "old"}}, watch: false, wantInclude: []string{"old"}, wantSkip: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ApplyWatch(&tt.conf, []string{"a", "b"}, tt.watch)
+			if !reflect.DeepEqual(tt.conf.IncludeClusters, tt.wantInclude) || !reflect.DeepEqual(tt.conf.SkipClusters, tt.wantSkip) {
+				t.Errorf("include = %v, skip = %v, want %v and %v", tt.conf.IncludeClusters, tt.conf.SkipClusters, tt.wantInclude, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestLabelStore(t *testing.T) {
+	t.Parallel()
+
+	store := &LabelStore{filePath: filepath.Join(t.TempDir(), labelsFileName)}
+	for name, contextLabels := range map[string]map[string]string{
+		"prod-eu": {"env": "prod", "region": "eu"},
+		"prod-us": {"env": "prod", "region": "us"},
+		"dev":     {"env": "dev"},
+	} {
+		if err := store.Set(name, contextLabels); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if err := store.Rename("prod-us", "prod-us-east"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := store.Set("dev", nil); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// A fresh store reads back what was written
+	reloaded := &LabelStore{filePath: store.filePath}
+	selector, _ := labels.Parse("env=prod,region!=eu")
+	selected, err := reloaded.Select(selector)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if _, ok := selected["prod-us-east"]; !ok || len(selected) != 1 {
+		t.Errorf("Select() = %v, want prod-us-east only", selected)
+	}
+	all, _ := reloaded.Select(labels.Everything())
+	if len(all) != 2 {
+		t.Errorf("Select(everything) = %v, want the two prod contexts", all)
+	}
+}
@@ -0,0 +1,103 @@
+package fleet
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const labelsFileName = "context-labels.json"
+
+// LabelStore persists the labels of contexts, set when onboarding a fleet
+type LabelStore struct {
+	filePath string
+	mutex    sync.Mutex
+	labels   map[string]map[string]string
+}
+
+var (
+	globalLabels *LabelStore
+	labelsOnce   sync.Once
+)
+
+// GetLabelStore returns the shared context label store
+func GetLabelStore() *LabelStore {
+	labelsOnce.Do(func() {
+		globalLabels = &LabelStore{
+			filePath: filepath.Join(utils.ConfigDir(), labelsFileName),
+		}
+	})
+	return globalLabels
+}
+
+// Set replaces the labels of a context, no labels removes it
+func (s *LabelStore) Set(contextName string, contextLabels map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if len(contextLabels) == 0 {
+		delete(s.labels, contextName)
+	} else {
+		copied := make(map[string]string, len(contextLabels))
+		for key, value := range contextLabels {
+			copied[key] = value
+		}
+		s.labels[contextName] = copied
+	}
+	return utils.WriteJSONFile(s.filePath, s.labels)
+}
+
+// Rename moves the labels of a renamed context
+func (s *LabelStore) Rename(oldName, newName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	contextLabels, ok := s.labels[oldName]
+	if !ok {
+		return nil
+	}
+	delete(s.labels, oldName)
+	s.labels[newName] = contextLabels
+	return utils.WriteJSONFile(s.filePath, s.labels)
+}
+
+// Select returns the labels of the contexts matching the selector, keyed by context
+func (s *LabelStore) Select(selector labels.Selector) (map[string]map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	selected := map[string]map[string]string{}
+	for contextName, contextLabels := range s.labels {
+		if selector.Matches(labels.Set(contextLabels)) {
+			selected[contextName] = contextLabels
+		}
+	}
+	return selected, nil
+}
+
+// load reads the store on first use, the caller must hold the mutex
+func (s *LabelStore) load() error {
+	if s.labels != nil {
+		return nil
+	}
+	stored := map[string]map[string]string{}
+	if err := utils.ReadJSONFile(s.filePath, &stored); err != nil {
+		return err
+	}
+	if stored == nil {
+		stored = map[string]map[string]string{}
+	}
+	s.labels = stored
+	return nil
+}
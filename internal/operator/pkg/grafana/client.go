@@ -0,0 +1,131 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// client talks to the Grafana HTTP API with a service account token
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(settings Settings) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(settings.URL, "/"),
+		token:   settings.APIToken,
+		http:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// searchResult is an entry of /api/search
+type searchResult struct {
+	UID   string   `json:"uid"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+// ensureFolder creates the folder dashboards are provisioned into unless it exists
+func (c *client) ensureFolder(ctx context.Context, uid, title string) error {
+	status, err := c.do(ctx, http.MethodGet, "/api/folders/"+url.PathEscape(uid), nil, nil)
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+
+	_, err = c.do(ctx, http.MethodPost, "/api/folders", map[string]string{"uid": uid, "title": title}, nil)
+	return err
+}
+
+// saveDashboard creates or overwrites a dashboard by its UID
+func (c *client) saveDashboard(ctx context.Context, folderUID string, dashboard map[string]interface{}) error {
+	_, err := c.do(ctx, http.MethodPost, "/api/dashboards/db", map[string]interface{}{
+		"dashboard": dashboard,
+		"folderUid": folderUID,
+		"overwrite": true,
+		"message":   "Provisioned by Agentkube",
+	}, nil)
+	return err
+}
+
+// deleteDashboard removes a dashboard, a missing dashboard is not an error
+func (c *client) deleteDashboard(ctx context.Context, uid string) error {
+	status, err := c.do(ctx, http.MethodDelete, "/api/dashboards/uid/"+url.PathEscape(uid), nil, nil)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// searchDashboards lists the dashboards carrying a tag
+func (c *client) searchDashboards(ctx context.Context, tag string) ([]searchResult, error) {
+	var results []searchResult
+	query := url.Values{"type": {"dash-db"}, "tag": {tag}, "limit": {"5000"}}
+	if _, err := c.do(ctx, http.MethodGet, "/api/search?"+query.Encode(), nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// do sends a request and decodes the response into out. The status code is returned with API errors.
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiError) != nil || apiError.Message == "" {
+			apiError.Message = strings.TrimSpace(string(data))
+		}
+		return resp.StatusCode, fmt.Errorf("grafana %s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, apiError.Message)
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode grafana response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
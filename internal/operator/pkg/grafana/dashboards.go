@@ -0,0 +1,170 @@
+package grafana
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dashboard kinds provisioned for every cluster
+const (
+	DashboardEvents          = "events"
+	DashboardCapacity        = "capacity"
+	DashboardVulnerabilities = "vulnerabilities"
+)
+
+// Tags marking provisioned dashboards. Only dashboards carrying ProvisionedTag are ever deleted.
+const (
+	ProvisionedTag    = "agentkube-provisioned"
+	clusterTagPrefix  = "agentkube-cluster:"
+	dashboardTagAgent = "agentkube"
+)
+
+// dashboardUID derives a stable UID for the dashboard of a cluster, Grafana limits UIDs to 40 characters
+func dashboardUID(kind, cluster string) string {
+	sum := sha256.Sum256([]byte(cluster))
+	return "ak-" + kind + "-" + hex.EncodeToString(sum[:6])
+}
+
+// checksum identifies the rendered content of a dashboard so unchanged dashboards are not rewritten
+func checksum(dashboard map[string]interface{}) string {
+	data, _ := json.Marshal(dashboard)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildDashboard renders the dashboard of a kind for a cluster
+func buildDashboard(kind, cluster string, settings Settings) (map[string]interface{}, error) {
+	b := panelBuilder{datasource: settings.DatasourceUID}
+
+	var title string
+	switch kind {
+	case DashboardEvents:
+		// agentkube_events_total is exported by the operator itself and always labelled with clusterName
+		events := selector("clusterName", cluster)
+		title = "Events"
+		b.stat("Events (range)", fmt.Sprintf(`sum(increase(agentkube_events_total%s[$__range]))`, events), "short")
+		b.stat("Event rate", fmt.Sprintf(`sum(rate(agentkube_events_total%s[5m]))`, events), "ops")
+		b.timeseries("Events by resource", fmt.Sprintf(`sum by (resourceType) (rate(agentkube_events_total%s[5m]))`, events), "{{resourceType}}", "ops")
+		b.timeseries("Events by type", fmt.Sprintf(`sum by (eventType) (rate(agentkube_events_total%s[5m]))`, events), "{{eventType}}", "ops")
+	case DashboardCapacity:
+		title = "Capacity"
+		cpu := selector(settings.ClusterLabel, cluster, `resource="cpu"`)
+		memory := selector(settings.ClusterLabel, cluster, `resource="memory"`)
+		b.stat("Nodes", fmt.Sprintf(`count(kube_node_info%s)`, selector(settings.ClusterLabel, cluster)), "short")
+		b.stat("CPU requested", fmt.Sprintf(`sum(kube_pod_container_resource_requests%s) / sum(kube_node_status_allocatable%s)`, cpu, cpu), "percentunit")
+		b.stat("Memory requested", fmt.Sprintf(`sum(kube_pod_container_resource_requests%s) / sum(kube_node_status_allocatable%s)`, memory, memory), "percentunit")
+		b.timeseries("CPU allocatable and requested", fmt.Sprintf(`sum(kube_node_status_allocatable%s)`, cpu), "allocatable", "short")
+		b.target(fmt.Sprintf(`sum(kube_pod_container_resource_requests%s)`, cpu), "requested")
+		b.timeseries("Memory allocatable and requested", fmt.Sprintf(`sum(kube_node_status_allocatable%s)`, memory), "allocatable", "bytes")
+		b.target(fmt.Sprintf(`sum(kube_pod_container_resource_requests%s)`, memory), "requested")
+	case DashboardVulnerabilities:
+		// trivy_image_vulnerabilities is exported by the Trivy operator
+		title = "Vulnerabilities"
+		for _, severity := range []string{"Critical", "High", "Medium", "Low"} {
+			b.stat(severity, fmt.Sprintf(`sum(trivy_image_vulnerabilities%s)`, selector(settings.ClusterLabel, cluster, "severity="+strconv.Quote(severity))), "short")
+		}
+		b.timeseries("Vulnerabilities by severity", fmt.Sprintf(`sum by (severity) (trivy_image_vulnerabilities%s)`, selector(settings.ClusterLabel, cluster)), "{{severity}}", "short")
+		b.table("Images with critical vulnerabilities", fmt.Sprintf(`topk(20, sum by (namespace, image_repository, image_tag) (trivy_image_vulnerabilities%s))`,
+			selector(settings.ClusterLabel, cluster, `severity="Critical"`)))
+	default:
+		return nil, fmt.Errorf("unknown dashboard %q", kind)
+	}
+
+	return map[string]interface{}{
+		"uid":           dashboardUID(kind, cluster),
+		"title":         fmt.Sprintf("%s / %s", cluster, title),
+		"tags":          []string{dashboardTagAgent, ProvisionedTag, clusterTagPrefix + cluster, dashboardTagAgent + "-" + kind},
+		"timezone":      "browser",
+		"schemaVersion": 39,
+		"editable":      false,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"panels":        b.panels,
+	}, nil
+}
+
+// selector renders a PromQL label selector for the cluster, an empty label leaves the cluster out
+func selector(label, cluster string, matchers ...string) string {
+	if label != "" {
+		matchers = append([]string{label + "=" + strconv.Quote(cluster)}, matchers...)
+	}
+	if len(matchers) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// panelBuilder lays out panels on a 24 column grid, stats in a row above full width graphs
+type panelBuilder struct {
+	datasource string
+	panels     []map[string]interface{}
+	statX      int
+	y          int
+}
+
+func (b *panelBuilder) add(panelType, title string, width, height int, fieldConfig map[string]interface{}) {
+	x := 0
+	if panelType == "stat" {
+		x = b.statX
+		b.statX += width
+	} else if b.statX > 0 {
+		// Close the row of stats
+		b.y += 4
+		b.statX = 0
+	}
+
+	b.panels = append(b.panels, map[string]interface{}{
+		"id":          len(b.panels) + 1,
+		"type":        panelType,
+		"title":       title,
+		"datasource":  b.datasourceRef(),
+		"gridPos":     map[string]int{"x": x, "y": b.y, "w": width, "h": height},
+		"fieldConfig": fieldConfig,
+		"targets":     []map[string]interface{}{},
+	})
+	if panelType != "stat" {
+		b.y += height
+	}
+}
+
+func (b *panelBuilder) stat(title, expr, unit string) {
+	b.add("stat", title, 6, 4, map[string]interface{}{"defaults": map[string]string{"unit": unit}})
+	b.target(expr, "")
+}
+
+func (b *panelBuilder) timeseries(title, expr, legend, unit string) {
+	b.add("timeseries", title, 24, 8, map[string]interface{}{"defaults": map[string]string{"unit": unit}})
+	b.target(expr, legend)
+}
+
+func (b *panelBuilder) table(title, expr string) {
+	b.add("table", title, 24, 8, map[string]interface{}{"defaults": map[string]string{}})
+	panel := b.panels[len(b.panels)-1]
+	panel["targets"] = append(panel["targets"].([]map[string]interface{}), map[string]interface{}{
+		"refId":      "A",
+		"datasource": b.datasourceRef(),
+		"expr":       expr,
+		"format":     "table",
+		"instant":    true,
+	})
+}
+
+// target adds a query to the last panel
+func (b *panelBuilder) target(expr, legend string) {
+	panel := b.panels[len(b.panels)-1]
+	targets := panel["targets"].([]map[string]interface{})
+	panel["targets"] = append(targets, map[string]interface{}{
+		"refId":        string(rune('A' + len(targets))),
+		"datasource":   b.datasourceRef(),
+		"expr":         expr,
+		"legendFormat": legend,
+	})
+}
+
+func (b *panelBuilder) datasourceRef() map[string]string {
+	return map[string]string{"type": "prometheus", "uid": b.datasource}
+}
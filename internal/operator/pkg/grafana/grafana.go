@@ -0,0 +1,299 @@
+package grafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "grafana-settings.json"
+	stateFileName    = "grafana-dashboards.json"
+
+	// syncInterval keeps dashboards in line with clusters added or removed since the last sync
+	syncInterval = 10 * time.Minute
+
+	redactedToken = "********"
+)
+
+// ErrDisabled is returned when syncing while the integration is disabled
+var ErrDisabled = errors.New("grafana integration is disabled")
+
+// Settings configure the Grafana instance dashboards are provisioned into
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	// APIToken is a Grafana service account token with permission to manage dashboards and folders
+	APIToken    string `json:"apiToken,omitempty"`
+	FolderUID   string `json:"folderUid"`
+	FolderTitle string `json:"folderTitle"`
+	// DatasourceUID is the Prometheus datasource the dashboards query
+	DatasourceUID string `json:"datasourceUid"`
+	// ClusterLabel is the label identifying the cluster of a series in the datasource, empty when the
+	// datasource only holds a single cluster
+	ClusterLabel string   `json:"clusterLabel"`
+	Dashboards   []string `json:"dashboards"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		FolderUID:    "agentkube",
+		FolderTitle:  "Agentkube",
+		ClusterLabel: "cluster",
+		Dashboards:   []string{DashboardEvents, DashboardCapacity, DashboardVulnerabilities},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	for _, dashboard := range s.Dashboards {
+		switch dashboard {
+		case DashboardEvents, DashboardCapacity, DashboardVulnerabilities:
+		default:
+			return fmt.Errorf("unknown dashboard %q", dashboard)
+		}
+	}
+	if !s.Enabled {
+		return nil
+	}
+
+	parsed, err := url.Parse(s.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if s.FolderUID == "" || len(s.FolderUID) > 40 {
+		return fmt.Errorf("folderUid must be between 1 and 40 characters")
+	}
+	if s.DatasourceUID == "" {
+		return fmt.Errorf("datasourceUid is required")
+	}
+	return nil
+}
+
+// Redacted returns the settings without the API token, for API responses
+func (s Settings) Redacted() Settings {
+	if s.APIToken != "" {
+		s.APIToken = redactedToken
+	}
+	return s
+}
+
+// SyncResult summarizes a provisioning run
+type SyncResult struct {
+	Time      time.Time `json:"time"`
+	Clusters  int       `json:"clusters"`
+	Saved     []string  `json:"saved"`
+	Deleted   []string  `json:"deleted"`
+	Unchanged int       `json:"unchanged"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+// Manager provisions the dashboards of every cluster and removes those of clusters that are gone
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	statePath       string
+	mutex           sync.Mutex
+	// syncMutex serializes provisioning runs
+	syncMutex sync.Mutex
+	lastSync  *SyncResult
+	stopChan  chan struct{}
+}
+
+// NewManager creates a new Grafana provisioning manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	configDir := utils.ConfigDir()
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(configDir, settingsFileName),
+		statePath:       filepath.Join(configDir, stateFileName),
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current Grafana settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new Grafana settings. A redacted token keeps the stored one.
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, err := m.loadSettings()
+	if err != nil {
+		return err
+	}
+	if settings.APIToken == redactedToken {
+		settings.APIToken = current.APIToken
+	}
+
+	// The file holds the API token
+	return utils.WriteJSONFileMode(m.settingsPath, settings, 0600)
+}
+
+// LastSync returns the result of the last provisioning run, nil before the first one
+func (m *Manager) LastSync() *SyncResult {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.lastSync
+}
+
+// Start provisions dashboards periodically until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.Sync(context.Background()); err != nil && !errors.Is(err, ErrDisabled) {
+					logger.Log(logger.LevelWarn, nil, err, "Failed to provision Grafana dashboards")
+				}
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the provisioning loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Sync provisions the dashboards of every known cluster and removes those of clusters no longer known
+func (m *Manager) Sync(ctx context.Context) (*SyncResult, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, ErrDisabled
+	}
+
+	contexts, err := m.kubeConfigStore.GetContexts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contexts: %w", err)
+	}
+	clusters := make([]string, 0, len(contexts))
+	for _, kubeContext := range contexts {
+		clusters = append(clusters, kubeContext.Name)
+	}
+
+	m.syncMutex.Lock()
+	defer m.syncMutex.Unlock()
+
+	result, err := m.reconcile(ctx, settings, clusters)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.lastSync = result
+	m.mutex.Unlock()
+
+	if len(result.Saved) > 0 || len(result.Deleted) > 0 || len(result.Errors) > 0 {
+		logger.Log(logger.LevelInfo, map[string]string{
+			"saved":   fmt.Sprintf("%d", len(result.Saved)),
+			"deleted": fmt.Sprintf("%d", len(result.Deleted)),
+			"errors":  fmt.Sprintf("%d", len(result.Errors)),
+		}, nil, "Provisioned Grafana dashboards")
+	}
+	return result, nil
+}
+
+// reconcile makes the provisioned dashboards match the clusters. The checksums of saved dashboards are
+// kept so that unchanged dashboards still present in Grafana are not rewritten.
+func (m *Manager) reconcile(ctx context.Context, settings Settings, clusters []string) (*SyncResult, error) {
+	client := newClient(settings)
+	result := &SyncResult{Time: time.Now(), Clusters: len(clusters), Saved: []string{}, Deleted: []string{}}
+
+	if err := client.ensureFolder(ctx, settings.FolderUID, settings.FolderTitle); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	existing, err := client.searchDashboards(ctx, ProvisionedTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provisioned dashboards: %w", err)
+	}
+	present := make(map[string]bool, len(existing))
+	for _, dashboard := range existing {
+		present[dashboard.UID] = true
+	}
+
+	checksums := map[string]string{}
+	if err := utils.ReadJSONFile(m.statePath, &checksums); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(clusters)
+	desired := map[string]bool{}
+	state := map[string]string{}
+	for _, cluster := range clusters {
+		for _, kind := range settings.Dashboards {
+			dashboard, err := buildDashboard(kind, cluster, settings)
+			if err != nil {
+				return nil, err
+			}
+			uid := dashboard["uid"].(string)
+			sum := checksum(map[string]interface{}{"dashboard": dashboard, "folder": settings.FolderUID})
+			desired[uid] = true
+
+			if present[uid] && checksums[uid] == sum {
+				state[uid] = sum
+				result.Unchanged++
+				continue
+			}
+			if err := client.saveDashboard(ctx, settings.FolderUID, dashboard); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dashboard["title"], err))
+				continue
+			}
+			state[uid] = sum
+			result.Saved = append(result.Saved, uid)
+		}
+	}
+
+	for _, dashboard := range existing {
+		if desired[dashboard.UID] {
+			continue
+		}
+		if err := client.deleteDashboard(ctx, dashboard.UID); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dashboard.Title, err))
+			state[dashboard.UID] = checksums[dashboard.UID]
+			continue
+		}
+		result.Deleted = append(result.Deleted, dashboard.UID)
+	}
+
+	if err := utils.WriteJSONFile(m.statePath, state); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadSettings reads the settings file, the caller must hold the mutex
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
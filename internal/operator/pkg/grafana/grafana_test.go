@@ -0,0 +1,175 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGrafana implements the parts of the Grafana HTTP API used for provisioning
+type fakeGrafana struct {
+	mutex      sync.Mutex
+	folders    map[string]bool
+	dashboards map[string][]string
+	saves      int
+}
+
+func (f *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/folders/"):
+		if !f.folders[strings.TrimPrefix(r.URL.Path, "/api/folders/")] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/folders":
+		var folder map[string]string
+		json.NewDecoder(r.Body).Decode(&folder)
+		f.folders[folder["uid"]] = true
+		json.NewEncoder(w).Encode(folder)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/dashboards/db":
+		var body struct {
+			Dashboard struct {
+				UID  string   `json:"uid"`
+				Tags []string `json:"tags"`
+			} `json:"dashboard"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.dashboards[body.Dashboard.UID] = body.Dashboard.Tags
+		f.saves++
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/dashboards/uid/"):
+		uid := strings.TrimPrefix(r.URL.Path, "/api/dashboards/uid/")
+		if _, ok := f.dashboards[uid]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.dashboards, uid)
+		json.NewEncoder(w).Encode(map[string]string{})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/search":
+		results := []searchResult{}
+		for uid, tags := range f.dashboards {
+			for _, tag := range tags {
+				if tag == r.URL.Query().Get("tag") {
+					results = append(results, searchResult{UID: uid, Tags: tags})
+					break
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(results)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+
+	grafana := &fakeGrafana{
+		folders: map[string]bool{},
+		// A dashboard created by a user must survive provisioning
+		dashboards: map[string][]string{"user-dashboard": {"agentkube"}},
+	}
+	server := httptest.NewServer(grafana)
+	defer server.Close()
+
+	m := &Manager{statePath: filepath.Join(t.TempDir(), stateFileName)}
+	settings := DefaultSettings()
+	settings.Enabled = true
+	settings.URL = server.URL
+	settings.APIToken = "token"
+	settings.DatasourceUID = "prometheus"
+
+	ctx := context.Background()
+	result, err := m.reconcile(ctx, settings, []string{"prod", "staging"})
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if len(result.Saved) != 6 || len(result.Errors) != 0 || !grafana.folders["agentkube"] {
+		t.Fatalf("first reconcile() = %+v, want 6 dashboards saved into the folder", result)
+	}
+
+	result, err = m.reconcile(ctx, settings, []string{"prod", "staging"})
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if len(result.Saved) != 0 || result.Unchanged != 6 {
+		t.Errorf("unchanged reconcile() = %+v, want 6 unchanged dashboards", result)
+	}
+
+	result, err = m.reconcile(ctx, settings, []string{"prod"})
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if len(result.Deleted) != 3 || result.Unchanged != 3 {
+		t.Errorf("reconcile() after removing a cluster = %+v, want 3 deleted and 3 unchanged", result)
+	}
+	if _, ok := grafana.dashboards["user-dashboard"]; !ok {
+		t.Error("reconcile() deleted a dashboard it did not provision")
+	}
+	if _, ok := grafana.dashboards[dashboardUID(DashboardEvents, "staging")]; ok {
+		t.Error("reconcile() kept the dashboard of a removed cluster")
+	}
+
+	// A dashboard deleted in Grafana is provisioned again
+	delete(grafana.dashboards, dashboardUID(DashboardCapacity, "prod"))
+	result, err = m.reconcile(ctx, settings, []string{"prod"})
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if len(result.Saved) != 1 || result.Saved[0] != dashboardUID(DashboardCapacity, "prod") {
+		t.Errorf("reconcile() after a manual delete = %+v, want the capacity dashboard saved", result)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		label    string
+		matchers []string
+		want     string
+	}{
+		{name: "cluster only", label: "cluster", want: `{cluster="prod"}`},
+		{name: "cluster and matchers", label: "cluster", matchers: []string{`resource="cpu"`}, want: `{cluster="prod",resource="cpu"}`},
+		{name: "single cluster datasource", matchers: []string{`resource="cpu"`}, want: `{resource="cpu"}`},
+		{name: "nothing", want: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := selector(tt.label, "prod", tt.matchers...); got != tt.want {
+				t.Errorf("selector() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDashboardUID(t *testing.T) {
+	t.Parallel()
+
+	uid := dashboardUID(DashboardVulnerabilities, strings.Repeat("a-very-long-cluster-name", 5))
+	if len(uid) > 40 {
+		t.Errorf("dashboardUID() = %q is longer than 40 characters", uid)
+	}
+	if dashboardUID(DashboardEvents, "prod") == dashboardUID(DashboardEvents, "staging") {
+		t.Error("dashboardUID() is the same for different clusters")
+	}
+}
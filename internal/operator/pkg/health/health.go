@@ -0,0 +1,373 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/cache"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CacheTTL bounds how long the card of a cluster is served without sampling it again
+	CacheTTL = 30 * time.Second
+	// WarningWindow is how far back warning events count towards the health of a cluster
+	WarningWindow = time.Hour
+
+	// pendingGrace leaves out the pods and deployments that were just created and are still starting
+	pendingGrace = 2 * time.Minute
+	// maxListed caps the failed workloads and warnings listed on a card, the counts are complete
+	maxListed      = 5
+	sampleTimeout  = 15 * time.Second
+	maxConcurrency = 8
+)
+
+// Status of a cluster, from the worst
+const (
+	StatusUnreachable = "unreachable"
+	StatusUnhealthy   = "unhealthy"
+	StatusDegraded    = "degraded"
+	StatusHealthy     = "healthy"
+)
+
+// Overview holds the health cards of a set of clusters, ordered by cluster name
+type Overview struct {
+	Clusters []ClusterHealth `json:"clusters"`
+	// Statuses counts the clusters of each status
+	Statuses    map[string]int `json:"statuses"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+}
+
+// ClusterHealth is the health card of a cluster
+type ClusterHealth struct {
+	Cluster string `json:"cluster"`
+	Status  string `json:"status"`
+	// Reasons explain a status other than healthy
+	Reasons   []string        `json:"reasons,omitempty"`
+	Nodes     NodeHealth      `json:"nodes"`
+	Pods      PodHealth       `json:"pods"`
+	Workloads WorkloadHealth  `json:"workloads"`
+	Warnings  WarningActivity `json:"warnings"`
+	Error     string          `json:"error,omitempty"`
+	SampledAt time.Time       `json:"sampledAt"`
+}
+
+// NodeHealth counts the nodes of a cluster
+type NodeHealth struct {
+	Total int `json:"total"`
+	Ready int `json:"ready"`
+	// NotReady names the nodes without the Ready condition
+	NotReady []string `json:"notReady,omitempty"`
+}
+
+// PodHealth counts the pods of a cluster
+type PodHealth struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+	// Pending are the pods pending for longer than a scheduling grace period
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+}
+
+// WorkloadHealth counts the workloads of a cluster and lists the first failed ones
+type WorkloadHealth struct {
+	Total  int           `json:"total"`
+	Failed int           `json:"failed"`
+	Items  []WorkloadRef `json:"items,omitempty"`
+}
+
+// WorkloadRef is a failed workload
+type WorkloadRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// WarningActivity counts the warning events of the window and lists the latest ones
+type WarningActivity struct {
+	Count  int            `json:"count"`
+	Recent []WarningEvent `json:"recent,omitempty"`
+}
+
+// WarningEvent is a recent warning event
+type WarningEvent struct {
+	Namespace string    `json:"namespace,omitempty"`
+	Object    string    `json:"object"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Monitor samples the health of clusters, caching the card of each for CacheTTL
+type Monitor struct {
+	kubeConfigStore kubeconfig.ContextStore
+	cards           cache.Cache[ClusterHealth]
+}
+
+// NewMonitor creates a health monitor of the contexts of the store
+func NewMonitor(kubeConfigStore kubeconfig.ContextStore) *Monitor {
+	return &Monitor{
+		kubeConfigStore: kubeConfigStore,
+		cards:           cache.New[ClusterHealth](),
+	}
+}
+
+// Overview returns the health cards of the given clusters, or of every context when none are
+// given. Cached cards are sampled again when they expired or refresh is set.
+func (m *Monitor) Overview(ctx context.Context, clusterNames []string, refresh bool) (*Overview, error) {
+	if len(clusterNames) == 0 {
+		contexts, err := m.kubeConfigStore.GetContexts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, kubeContext := range contexts {
+			if !kubeContext.Internal {
+				clusterNames = append(clusterNames, kubeContext.Name)
+			}
+		}
+	}
+
+	cards := make([]ClusterHealth, len(clusterNames))
+	semaphore := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for idx, clusterName := range clusterNames {
+		if !refresh {
+			if card, err := m.cards.Get(ctx, clusterName); err == nil {
+				cards[idx] = card
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(idx int, clusterName string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			cards[idx] = m.sampleCluster(ctx, clusterName)
+			m.cards.SetWithTTL(ctx, clusterName, cards[idx], CacheTTL)
+		}(idx, clusterName)
+	}
+	wg.Wait()
+
+	sort.Slice(cards, func(a, b int) bool { return cards[a].Cluster < cards[b].Cluster })
+	overview := &Overview{Clusters: cards, Statuses: map[string]int{}, GeneratedAt: time.Now()}
+	for _, card := range cards {
+		overview.Statuses[card.Status]++
+	}
+	return overview, nil
+}
+
+// sampleCluster builds the card of a cluster, unreachable when it can't be sampled
+func (m *Monitor) sampleCluster(ctx context.Context, clusterName string) ClusterHealth {
+	card, err := func() (ClusterHealth, error) {
+		kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+		if err != nil {
+			return ClusterHealth{}, fmt.Errorf("failed to get context: %v", err)
+		}
+		clientset, err := kubeContext.ClientSetWithToken("")
+		if err != nil {
+			return ClusterHealth{}, fmt.Errorf("failed to create clientset: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, sampleTimeout)
+		defer cancel()
+		return sample(ctx, clientset, time.Now())
+	}()
+	if err != nil {
+		card = ClusterHealth{Status: StatusUnreachable, Error: err.Error(), SampledAt: time.Now()}
+	}
+	card.Cluster = clusterName
+	return card
+}
+
+// sample reads the nodes, pods, workloads and warning events of a cluster into its card. Nodes and
+// pods are required, the workloads and events the context can't list are left out of the card.
+func sample(ctx context.Context, clientset kubernetes.Interface, now time.Time) (ClusterHealth, error) {
+	card := ClusterHealth{SampledAt: now}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return card, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	card.Nodes.Total = len(nodes.Items)
+	for _, node := range nodes.Items {
+		if nodeReady(node) {
+			card.Nodes.Ready++
+		} else {
+			card.Nodes.NotReady = append(card.Nodes.NotReady, node.Name)
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return card, fmt.Errorf("failed to list pods: %v", err)
+	}
+	card.Pods.Total = len(pods.Items)
+	for _, pod := range pods.Items {
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			card.Pods.Running++
+		case corev1.PodPending:
+			if now.Sub(pod.CreationTimestamp.Time) > pendingGrace {
+				card.Pods.Pending++
+			}
+		case corev1.PodFailed:
+			card.Pods.Failed++
+		}
+	}
+
+	var failed []WorkloadRef
+	if deployments, err := clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{}); err == nil {
+		card.Workloads.Total += len(deployments.Items)
+		for _, d := range deployments.Items {
+			if reason := deploymentFailure(d, now); reason != "" {
+				failed = append(failed, WorkloadRef{Kind: "Deployment", Namespace: d.Namespace, Name: d.Name, Reason: reason})
+			}
+		}
+	}
+	if statefulSets, err := clientset.AppsV1().StatefulSets("").List(ctx, metav1.ListOptions{}); err == nil {
+		card.Workloads.Total += len(statefulSets.Items)
+		for _, s := range statefulSets.Items {
+			if replicas := replicasOf(s.Spec.Replicas); replicas > 0 && s.Status.ReadyReplicas == 0 {
+				failed = append(failed, WorkloadRef{Kind: "StatefulSet", Namespace: s.Namespace, Name: s.Name,
+					Reason: fmt.Sprintf("none of %d replicas ready", replicas)})
+			}
+		}
+	}
+	if daemonSets, err := clientset.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{}); err == nil {
+		card.Workloads.Total += len(daemonSets.Items)
+		for _, d := range daemonSets.Items {
+			if d.Status.NumberUnavailable > 0 {
+				failed = append(failed, WorkloadRef{Kind: "DaemonSet", Namespace: d.Namespace, Name: d.Name,
+					Reason: fmt.Sprintf("%d of %d pods unavailable", d.Status.NumberUnavailable, d.Status.DesiredNumberScheduled)})
+			}
+		}
+	}
+	if jobs, err := clientset.BatchV1().Jobs("").List(ctx, metav1.ListOptions{}); err == nil {
+		card.Workloads.Total += len(jobs.Items)
+		for _, j := range jobs.Items {
+			for _, condition := range j.Status.Conditions {
+				if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+					failed = append(failed, WorkloadRef{Kind: "Job", Namespace: j.Namespace, Name: j.Name, Reason: condition.Reason})
+				}
+			}
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		if failed[i].Namespace != failed[j].Namespace {
+			return failed[i].Namespace < failed[j].Namespace
+		}
+		return failed[i].Kind+"/"+failed[i].Name < failed[j].Kind+"/"+failed[j].Name
+	})
+	card.Workloads.Failed = len(failed)
+	card.Workloads.Items = failed[:min(len(failed), maxListed)]
+
+	events, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String(),
+	})
+	if err == nil {
+		var recent []WarningEvent
+		for _, e := range events.Items {
+			lastSeen := eventTime(e)
+			if now.Sub(lastSeen) > WarningWindow {
+				continue
+			}
+			recent = append(recent, WarningEvent{
+				Namespace: e.Namespace,
+				Object:    e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name,
+				Reason:    e.Reason,
+				Message:   e.Message,
+				Count:     max(e.Count, 1),
+				LastSeen:  lastSeen,
+			})
+		}
+		sort.Slice(recent, func(i, j int) bool { return recent[i].LastSeen.After(recent[j].LastSeen) })
+		card.Warnings.Count = len(recent)
+		card.Warnings.Recent = recent[:min(len(recent), maxListed)]
+	}
+
+	card.Status, card.Reasons = assess(card)
+	return card, nil
+}
+
+// assess derives the status of a card: unhealthy with nodes not ready or failed workloads,
+// degraded with pending or failed pods
+func assess(card ClusterHealth) (string, []string) {
+	var unhealthy, degraded []string
+	if notReady := card.Nodes.Total - card.Nodes.Ready; notReady > 0 {
+		unhealthy = append(unhealthy, fmt.Sprintf("%d of %d nodes not ready", notReady, card.Nodes.Total))
+	}
+	if card.Workloads.Failed > 0 {
+		unhealthy = append(unhealthy, fmt.Sprintf("%d failed workloads", card.Workloads.Failed))
+	}
+	if card.Pods.Pending > 0 {
+		degraded = append(degraded, fmt.Sprintf("%d pods pending", card.Pods.Pending))
+	}
+	if card.Pods.Failed > 0 {
+		degraded = append(degraded, fmt.Sprintf("%d pods failed", card.Pods.Failed))
+	}
+
+	switch {
+	case len(unhealthy) > 0:
+		return StatusUnhealthy, append(unhealthy, degraded...)
+	case len(degraded) > 0:
+		return StatusDegraded, degraded
+	default:
+		return StatusHealthy, nil
+	}
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// deploymentFailure returns why a deployment failed: it exceeded its progress deadline, or has
+// replicas and none of them available past the grace of new deployments
+func deploymentFailure(d appsv1.Deployment, now time.Time) string {
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse {
+			return condition.Reason
+		}
+	}
+	if replicas := replicasOf(d.Spec.Replicas); replicas > 0 && d.Status.AvailableReplicas == 0 && now.Sub(d.CreationTimestamp.Time) > pendingGrace {
+		return fmt.Sprintf("none of %d replicas available", replicas)
+	}
+	return ""
+}
+
+// replicasOf defaults unset replicas to 1 like the API server
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// eventTime returns when an event was last seen, falling back for events of the events.k8s.io API
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
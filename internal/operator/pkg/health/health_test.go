@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func TestSample(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	created := func(age time.Duration) metav1.ObjectMeta {
+		return metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-age))}
+	}
+	node := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}},
+		}
+	}
+	pod := func(name string, phase corev1.PodPhase, age time.Duration) *corev1.Pod {
+		meta := created(age)
+		meta.Name, meta.Namespace = name, "shop"
+		return &corev1.Pod{ObjectMeta: meta, Status: corev1.PodStatus{Phase: phase}}
+	}
+	deployment := func(name string, age time.Duration, available int32, conditions ...appsv1.DeploymentCondition) *appsv1.Deployment {
+		meta := created(age)
+		meta.Name, meta.Namespace = name, "shop"
+		return &appsv1.Deployment{
+			ObjectMeta: meta,
+			Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](2)},
+			Status:     appsv1.DeploymentStatus{AvailableReplicas: available, Conditions: conditions},
+		}
+	}
+	warning := func(name string, lastSeen time.Duration) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "shop"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: name},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "BackOff",
+			LastTimestamp:  metav1.NewTime(now.Add(-lastSeen)),
+		}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		node("a", corev1.ConditionTrue), node("b", corev1.ConditionFalse),
+		pod("web", corev1.PodRunning, time.Hour), pod("new", corev1.PodPending, time.Minute),
+		pod("stuck", corev1.PodPending, time.Hour), pod("crashed", corev1.PodFailed, time.Hour),
+		deployment("web", time.Hour, 2), deployment("starting", time.Minute, 0), deployment("down", time.Hour, 0),
+		deployment("stalled", time.Hour, 1, appsv1.DeploymentCondition{
+			Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+		}),
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "shop"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+				Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded",
+			}}},
+		},
+		warning("recent", 5*time.Minute), warning("latest", time.Minute), warning("old", 2*time.Hour),
+	)
+
+	card, err := sample(context.Background(), clientset, now)
+	if err != nil {
+		t.Fatalf("sample() error = %v", err)
+	}
+
+	if want := (NodeHealth{Total: 2, Ready: 1, NotReady: []string{"b"}}); !reflect.DeepEqual(card.Nodes, want) {
+		t.Errorf("nodes = %+v, want %+v", card.Nodes, want)
+	}
+	if want := (PodHealth{Total: 4, Running: 1, Pending: 1, Failed: 1}); card.Pods != want {
+		t.Errorf("pods = %+v, want %+v", card.Pods, want)
+	}
+
+	wantWorkloads := []WorkloadRef{
+		{Kind: "Deployment", Namespace: "shop", Name: "down", Reason: "none of 2 replicas available"},
+		{Kind: "Deployment", Namespace: "shop", Name: "stalled", Reason: "ProgressDeadlineExceeded"},
+		{Kind: "Job", Namespace: "shop", Name: "migrate", Reason: "BackoffLimitExceeded"},
+	}
+	if card.Workloads.Total != 5 || !reflect.DeepEqual(card.Workloads.Items, wantWorkloads) {
+		t.Errorf("workloads = %+v, want 5 workloads failing %+v", card.Workloads, wantWorkloads)
+	}
+
+	if card.Warnings.Count != 2 || card.Warnings.Recent[0].Object != "Pod/latest" || card.Warnings.Recent[0].Count != 1 {
+		t.Errorf("warnings = %+v, want the 2 events of the window, latest first", card.Warnings)
+	}
+
+	wantReasons := []string{"1 of 2 nodes not ready", "3 failed workloads", "1 pods pending", "1 pods failed"}
+	if card.Status != StatusUnhealthy || !reflect.DeepEqual(card.Reasons, wantReasons) {
+		t.Errorf("status = %s %v, want %s %v", card.Status, card.Reasons, StatusUnhealthy, wantReasons)
+	}
+}
+
+func TestAssess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		card ClusterHealth
+		want string
+	}{
+		{"healthy", ClusterHealth{Nodes: NodeHealth{Total: 3, Ready: 3}, Pods: PodHealth{Total: 10, Running: 10}}, StatusHealthy},
+		{"pending pods", ClusterHealth{Nodes: NodeHealth{Total: 3, Ready: 3}, Pods: PodHealth{Pending: 1}}, StatusDegraded},
+		{"node not ready", ClusterHealth{Nodes: NodeHealth{Total: 3, Ready: 2}}, StatusUnhealthy},
+		{"failed workload", ClusterHealth{Nodes: NodeHealth{Total: 1, Ready: 1}, Workloads: WorkloadHealth{Failed: 1}}, StatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, reasons := assess(tt.card); got != tt.want {
+				t.Errorf("assess() = %s %v, want %s", got, reasons, tt.want)
+			}
+		})
+	}
+}
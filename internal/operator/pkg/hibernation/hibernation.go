@@ -0,0 +1,287 @@
+package hibernation
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	OperationHibernate = "hibernation-hibernate"
+	OperationWake      = "hibernation-wake"
+
+	// ExcludeLabel keeps a workload running while its namespace hibernates
+	ExcludeLabel = "agentkube.io/hibernate-exclude"
+
+	storeFileName = "hibernations.json"
+)
+
+// Hibernation states
+const (
+	StateHibernating = "hibernating"
+	StateHibernated  = "hibernated"
+	StateWaking      = "waking"
+	StateAwake       = "awake"
+	StateFailed      = "failed"
+)
+
+// defaultExcludedNamespaces are never hibernated since the cluster itself depends on them
+var defaultExcludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// HibernateRequest selects what to hibernate in a cluster
+type HibernateRequest struct {
+	// Namespaces to hibernate, empty means every namespace of the cluster
+	Namespaces        []string `json:"namespaces,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// ExcludeWorkloads are "namespace/name" entries that keep running
+	ExcludeWorkloads []string `json:"excludeWorkloads,omitempty"`
+	// SuspendCronJobs also suspends CronJobs so they do not start pods while hibernated
+	SuspendCronJobs bool `json:"suspendCronJobs"`
+}
+
+// Record tracks the hibernation of a cluster and the state needed to restore it exactly
+type Record struct {
+	Cluster      string           `json:"cluster"`
+	State        string           `json:"state"`
+	Request      HibernateRequest `json:"request"`
+	Workloads    []WorkloadRecord `json:"workloads"`
+	HibernatedAt *time.Time       `json:"hibernatedAt,omitempty"`
+	WokenAt      *time.Time       `json:"wokenAt,omitempty"`
+	OperationID  string           `json:"operationId,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// WorkloadRecord is the pre-hibernation state of a single workload
+type WorkloadRecord struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Replicas is the recorded replica count, Suspended the recorded CronJob suspend flag
+	Replicas  int32 `json:"replicas"`
+	Suspended bool  `json:"suspended,omitempty"`
+	Restored  bool  `json:"restored"`
+}
+
+// Manager tracks hibernated clusters and queues hibernate and wake operations
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	filePath        string
+	mutex           sync.Mutex
+}
+
+// NewManager creates a new hibernation manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		filePath:        filepath.Join(utils.ConfigDir(), storeFileName),
+	}
+}
+
+// Hibernate queues an operation scaling the selected workloads of a cluster to zero
+func (m *Manager) Hibernate(clusterName string, req HibernateRequest) (*Record, error) {
+	if _, err := m.kubeConfigStore.GetContext(clusterName); err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, ok := records[clusterName]; ok {
+		switch existing.State {
+		case StateHibernating, StateHibernated, StateWaking:
+			return nil, fmt.Errorf("cluster %s is %s, wake it before hibernating again", clusterName, existing.State)
+		case StateFailed:
+			if hasUnrestored(existing) {
+				return nil, fmt.Errorf("cluster %s has workloads from a failed hibernation that were not restored, wake it first", clusterName)
+			}
+		}
+	}
+
+	op := m.queue.AddOperation(OperationHibernate, clusterName, "user", map[string]interface{}{
+		"request": req,
+	}, []string{"hibernation"})
+
+	record := &Record{
+		Cluster:     clusterName,
+		State:       StateHibernating,
+		Request:     req,
+		Workloads:   []WorkloadRecord{},
+		OperationID: op.ID,
+	}
+	records[clusterName] = record
+	if err := m.save(records); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Wake queues an operation restoring every workload recorded for the cluster
+func (m *Manager) Wake(clusterName string) (*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := records[clusterName]
+	if !ok {
+		return nil, fmt.Errorf("cluster %s is not hibernated", clusterName)
+	}
+	if record.State != StateHibernated && record.State != StateFailed {
+		return nil, fmt.Errorf("cluster %s is %s and cannot be woken now", clusterName, record.State)
+	}
+
+	op := m.queue.AddOperation(OperationWake, clusterName, "user", map[string]interface{}{}, []string{"hibernation"})
+	record.State = StateWaking
+	record.OperationID = op.ID
+	record.Error = ""
+	if err := m.save(records); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetStatus returns the hibernation record of a cluster
+func (m *Manager) GetStatus(clusterName string) (*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	if record, ok := records[clusterName]; ok {
+		return record, nil
+	}
+	return &Record{Cluster: clusterName, State: StateAwake, Workloads: []WorkloadRecord{}}, nil
+}
+
+// ListRecords returns the hibernation records of all clusters
+func (m *Manager) ListRecords() ([]*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Record, 0, len(records))
+	for _, record := range records {
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+// GetQueue returns the operation queue used by the manager
+func (m *Manager) GetQueue() *utils.Queue {
+	return m.queue
+}
+
+// updateRecord applies fn to the record of a cluster and persists it
+func (m *Manager) updateRecord(clusterName string, fn func(record *Record)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return err
+	}
+	record, ok := records[clusterName]
+	if !ok {
+		return fmt.Errorf("no hibernation record for cluster %s", clusterName)
+	}
+	fn(record)
+	return m.save(records)
+}
+
+func (m *Manager) getRecord(clusterName string) (*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	record, ok := records[clusterName]
+	if !ok {
+		return nil, fmt.Errorf("no hibernation record for cluster %s", clusterName)
+	}
+	return record, nil
+}
+
+func (m *Manager) load() (map[string]*Record, error) {
+	records := map[string]*Record{}
+	if err := utils.ReadJSONFile(m.filePath, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (m *Manager) save(records map[string]*Record) error {
+	return utils.WriteJSONFile(m.filePath, records)
+}
+
+// IsHibernated reports whether a namespace of a cluster is hibernated, or being hibernated or
+// woken. Features scaling workloads on their own skip such namespaces so they neither undo the
+// hibernation nor change the replica counts a wake restores.
+func IsHibernated(clusterName, namespace string) (bool, error) {
+	records := map[string]*Record{}
+	if err := utils.ReadJSONFile(filepath.Join(utils.ConfigDir(), storeFileName), &records); err != nil {
+		return false, err
+	}
+	record, ok := records[clusterName]
+	if !ok {
+		return false, nil
+	}
+	return record.covers(namespace), nil
+}
+
+// covers reports whether the record holds workloads of the namespace down, or is about to
+func (r *Record) covers(namespace string) bool {
+	switch r.State {
+	case StateHibernating, StateHibernated, StateWaking:
+	case StateFailed:
+		if !hasUnrestored(r) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for _, excluded := range append(append([]string{}, defaultExcludedNamespaces...), r.Request.ExcludeNamespaces...) {
+		if excluded == namespace {
+			return false
+		}
+	}
+	if len(r.Request.Namespaces) == 0 {
+		return true
+	}
+	for _, included := range r.Request.Namespaces {
+		if included == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func hasUnrestored(record *Record) bool {
+	for _, workload := range record.Workloads {
+		if !workload.Restored {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package hibernation
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func int32Ptr(v int32) *int32 { return &v }
+
+func boolPtr(v bool) *bool { return &v }
+
+func testClientset() *fake.Clientset {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "idle", Namespace: "shop"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(0)},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "shop", Labels: map[string]string{ExcludeLabel: "true"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: int32Ptr(1)},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "shop"},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "paused", Namespace: "shop"},
+			Spec:       batchv1.CronJobSpec{Suspend: boolPtr(true)},
+		},
+	)
+
+	// The object tracker does not implement the scale subresource, serve it from the workload
+	for _, resource := range []string{"deployments", "statefulsets"} {
+		gvr := appsv1.SchemeGroupVersion.WithResource(resource)
+		client.PrependReactor("get", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "scale" {
+				return false, nil, nil
+			}
+			get := action.(k8stesting.GetAction)
+			obj, err := client.Tracker().Get(gvr, get.GetNamespace(), get.GetName())
+			if err != nil {
+				return true, nil, err
+			}
+			scale := &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: get.GetName(), Namespace: get.GetNamespace()}}
+			switch workload := obj.(type) {
+			case *appsv1.Deployment:
+				scale.Spec.Replicas = *workload.Spec.Replicas
+			case *appsv1.StatefulSet:
+				scale.Spec.Replicas = *workload.Spec.Replicas
+			}
+			return true, scale, nil
+		})
+		client.PrependReactor("update", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "scale" {
+				return false, nil, nil
+			}
+			scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+			obj, err := client.Tracker().Get(gvr, scale.Namespace, scale.Name)
+			if err != nil {
+				return true, nil, err
+			}
+			switch workload := obj.(type) {
+			case *appsv1.Deployment:
+				workload.Spec.Replicas = int32Ptr(scale.Spec.Replicas)
+			case *appsv1.StatefulSet:
+				workload.Spec.Replicas = int32Ptr(scale.Spec.Replicas)
+			}
+			return true, scale, client.Tracker().Update(gvr, obj, scale.Namespace)
+		})
+	}
+	return client
+}
+
+func TestCollectWorkloads(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  HibernateRequest
+		want []WorkloadRecord
+	}{
+		{
+			name: "all namespaces",
+			req:  HibernateRequest{},
+			want: []WorkloadRecord{
+				{Kind: kindDeployment, Namespace: "shop", Name: "api", Replicas: 3},
+				{Kind: kindStatefulSet, Namespace: "shop", Name: "db", Replicas: 1},
+			},
+		},
+		{
+			name: "excluded workload",
+			req:  HibernateRequest{ExcludeWorkloads: []string{"shop/api"}},
+			want: []WorkloadRecord{
+				{Kind: kindStatefulSet, Namespace: "shop", Name: "db", Replicas: 1},
+			},
+		},
+		{
+			name: "excluded namespace",
+			req:  HibernateRequest{ExcludeNamespaces: []string{"shop"}},
+			want: []WorkloadRecord{},
+		},
+		{
+			name: "cronjobs",
+			req:  HibernateRequest{Namespaces: []string{"shop"}, SuspendCronJobs: true},
+			want: []WorkloadRecord{
+				{Kind: kindDeployment, Namespace: "shop", Name: "api", Replicas: 3},
+				{Kind: kindStatefulSet, Namespace: "shop", Name: "db", Replicas: 1},
+				{Kind: kindCronJob, Namespace: "shop", Name: "report"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := collectWorkloads(context.Background(), testClientset(), tt.req)
+			if err != nil {
+				t.Fatalf("collectWorkloads() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectWorkloads() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHibernateAndWakeRestoresExactReplicas(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := testClientset()
+
+	workloads, err := collectWorkloads(ctx, client, HibernateRequest{SuspendCronJobs: true})
+	if err != nil {
+		t.Fatalf("collectWorkloads() error = %v", err)
+	}
+	for _, workload := range workloads {
+		if err := applyWorkload(ctx, client, workload, 0, true); err != nil {
+			t.Fatalf("hibernating %s %s: %v", workload.Kind, workload.Name, err)
+		}
+	}
+
+	api, _ := client.AppsV1().Deployments("shop").Get(ctx, "api", metav1.GetOptions{})
+	if *api.Spec.Replicas != 0 {
+		t.Fatalf("api replicas after hibernate = %d, want 0", *api.Spec.Replicas)
+	}
+	report, _ := client.BatchV1().CronJobs("shop").Get(ctx, "report", metav1.GetOptions{})
+	if report.Spec.Suspend == nil || !*report.Spec.Suspend {
+		t.Fatalf("report not suspended after hibernate")
+	}
+
+	for _, workload := range workloads {
+		if err := applyWorkload(ctx, client, workload, workload.Replicas, workload.Suspended); err != nil {
+			t.Fatalf("waking %s %s: %v", workload.Kind, workload.Name, err)
+		}
+	}
+
+	api, _ = client.AppsV1().Deployments("shop").Get(ctx, "api", metav1.GetOptions{})
+	db, _ := client.AppsV1().StatefulSets("shop").Get(ctx, "db", metav1.GetOptions{})
+	report, _ = client.BatchV1().CronJobs("shop").Get(ctx, "report", metav1.GetOptions{})
+	if *api.Spec.Replicas != 3 || *db.Spec.Replicas != 1 {
+		t.Errorf("replicas after wake = api %d, db %d, want 3 and 1", *api.Spec.Replicas, *db.Spec.Replicas)
+	}
+	if report.Spec.Suspend == nil || *report.Spec.Suspend {
+		t.Errorf("report still suspended after wake")
+	}
+}
+
+func TestRecordCovers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		record    Record
+		namespace string
+		want      bool
+	}{
+		{"hibernated cluster", Record{State: StateHibernated}, "shop", true},
+		{"system namespace", Record{State: StateHibernated}, "kube-system", false},
+		{"excluded namespace", Record{State: StateHibernated, Request: HibernateRequest{ExcludeNamespaces: []string{"shop"}}}, "shop", false},
+		{"selected namespace", Record{State: StateHibernating, Request: HibernateRequest{Namespaces: []string{"shop"}}}, "shop", true},
+		{"other namespace", Record{State: StateHibernated, Request: HibernateRequest{Namespaces: []string{"shop"}}}, "billing", false},
+		{"awake", Record{State: StateAwake}, "shop", false},
+		{"failed with unrestored workloads", Record{State: StateFailed, Workloads: []WorkloadRecord{{Name: "api"}}}, "shop", true},
+		{"failed and restored", Record{State: StateFailed, Workloads: []WorkloadRecord{{Name: "api", Restored: true}}}, "shop", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.record.covers(tt.namespace); got != tt.want {
+				t.Errorf("covers(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
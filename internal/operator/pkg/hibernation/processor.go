@@ -0,0 +1,315 @@
+package hibernation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	kindDeployment  = "Deployment"
+	kindStatefulSet = "StatefulSet"
+	kindCronJob     = "CronJob"
+)
+
+// HibernationProcessor executes hibernate and wake operations
+type HibernationProcessor struct {
+	manager *Manager
+}
+
+// NewHibernationProcessor creates a new hibernation processor
+func NewHibernationProcessor(manager *Manager) *HibernationProcessor {
+	return &HibernationProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes hibernation operations
+func (p *HibernationProcessor) ProcessOperation(op *utils.Operation) error {
+	switch op.Type {
+	case OperationHibernate:
+		return p.processHibernate(op)
+	case OperationWake:
+		return p.processWake(op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *HibernationProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationHibernate || operationType == OperationWake
+}
+
+// processHibernate records the size of every selected workload, then scales it to zero
+func (p *HibernationProcessor) processHibernate(op *utils.Operation) error {
+	clusterName := op.Target
+	record, err := p.manager.getRecord(clusterName)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	clientset, err := p.getKubernetesClient(clusterName)
+	if err != nil {
+		p.fail(clusterName, err)
+		return utils.NonRetryable(err)
+	}
+
+	ctx := context.Background()
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Collecting workloads", nil)
+	workloads, err := collectWorkloads(ctx, clientset, record.Request)
+	if err != nil {
+		p.fail(clusterName, err)
+		return utils.NonRetryable(err)
+	}
+
+	// Persist the recorded state before touching the cluster so it can always be restored
+	if err := p.manager.updateRecord(clusterName, func(record *Record) {
+		record.Workloads = workloads
+	}); err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	for i, workload := range workloads {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 20+70*i/len(workloads),
+			fmt.Sprintf("Hibernating %s %s/%s", workload.Kind, workload.Namespace, workload.Name), nil)
+
+		if err := applyWorkload(ctx, clientset, workload, 0, true); err != nil {
+			err = fmt.Errorf("failed to hibernate %s %s/%s: %w", workload.Kind, workload.Namespace, workload.Name, err)
+			p.fail(clusterName, err)
+			// The recorded workloads can be restored with a wake, so do not retry blindly
+			return utils.NonRetryable(err)
+		}
+	}
+
+	now := time.Now()
+	if err := p.manager.updateRecord(clusterName, func(record *Record) {
+		record.State = StateHibernated
+		record.HibernatedAt = &now
+		record.Error = ""
+	}); err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("Hibernated %d workloads", len(workloads)), nil)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"workloads":   fmt.Sprintf("%d", len(workloads)),
+		"operationId": op.ID,
+	}, nil, "Cluster hibernated")
+
+	return nil
+}
+
+// processWake restores every recorded workload that has not been restored yet
+func (p *HibernationProcessor) processWake(op *utils.Operation) error {
+	clusterName := op.Target
+	record, err := p.manager.getRecord(clusterName)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	if err := p.manager.updateRecord(clusterName, func(record *Record) {
+		record.State = StateWaking
+	}); err != nil {
+		return err
+	}
+
+	clientset, err := p.getKubernetesClient(clusterName)
+	if err != nil {
+		p.fail(clusterName, err)
+		return err
+	}
+
+	ctx := context.Background()
+	for i, workload := range record.Workloads {
+		if workload.Restored {
+			continue
+		}
+
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10+80*i/len(record.Workloads),
+			fmt.Sprintf("Restoring %s %s/%s", workload.Kind, workload.Namespace, workload.Name), nil)
+
+		err := applyWorkload(ctx, clientset, workload, workload.Replicas, workload.Suspended)
+		if errors.IsNotFound(err) {
+			// Deleted while hibernated, there is nothing left to restore
+			logger.Log(logger.LevelWarn, map[string]string{
+				"cluster":   clusterName,
+				"namespace": workload.Namespace,
+				"name":      workload.Name,
+			}, err, "Hibernated workload no longer exists")
+		} else if err != nil {
+			err = fmt.Errorf("failed to restore %s %s/%s: %w", workload.Kind, workload.Namespace, workload.Name, err)
+			p.fail(clusterName, err)
+			return err
+		}
+
+		// Mark progress per workload so a retried wake continues where it stopped
+		index := i
+		if err := p.manager.updateRecord(clusterName, func(record *Record) {
+			record.Workloads[index].Restored = true
+		}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if err := p.manager.updateRecord(clusterName, func(record *Record) {
+		record.State = StateAwake
+		record.WokenAt = &now
+		record.Error = ""
+	}); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("Restored %d workloads", len(record.Workloads)), nil)
+	return nil
+}
+
+func (p *HibernationProcessor) fail(clusterName string, cause error) {
+	err := p.manager.updateRecord(clusterName, func(record *Record) {
+		record.State = StateFailed
+		record.Error = cause.Error()
+	})
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": clusterName}, err, "Failed to record hibernation failure")
+	}
+}
+
+// getKubernetesClient creates a kubernetes client for the given cluster
+func (p *HibernationProcessor) getKubernetesClient(clusterName string) (*kubernetes.Clientset, error) {
+	ctx, err := p.manager.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+
+	clientset, err := ctx.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	return clientset, nil
+}
+
+// collectWorkloads lists the running workloads selected by the request
+func collectWorkloads(ctx context.Context, clientset kubernetes.Interface, req HibernateRequest) ([]WorkloadRecord, error) {
+	excludedNamespaces := map[string]bool{}
+	for _, ns := range defaultExcludedNamespaces {
+		excludedNamespaces[ns] = true
+	}
+	for _, ns := range req.ExcludeNamespaces {
+		excludedNamespaces[ns] = true
+	}
+	excludedWorkloads := map[string]bool{}
+	for _, name := range req.ExcludeWorkloads {
+		excludedWorkloads[name] = true
+	}
+
+	namespaces := req.Namespaces
+	if len(namespaces) == 0 {
+		list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		for _, ns := range list.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	skip := func(namespace, name string, labels map[string]string) bool {
+		return excludedWorkloads[namespace+"/"+name] || labels[ExcludeLabel] == "true"
+	}
+
+	workloads := []WorkloadRecord{}
+	for _, namespace := range namespaces {
+		if excludedNamespaces[namespace] {
+			continue
+		}
+
+		deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments in %s: %w", namespace, err)
+		}
+		for _, deployment := range deployments.Items {
+			if skip(namespace, deployment.Name, deployment.Labels) || deployment.Spec.Replicas == nil || *deployment.Spec.Replicas == 0 {
+				continue
+			}
+			workloads = append(workloads, WorkloadRecord{
+				Kind: kindDeployment, Namespace: namespace, Name: deployment.Name, Replicas: *deployment.Spec.Replicas,
+			})
+		}
+
+		statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statefulsets in %s: %w", namespace, err)
+		}
+		for _, statefulSet := range statefulSets.Items {
+			if skip(namespace, statefulSet.Name, statefulSet.Labels) || statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas == 0 {
+				continue
+			}
+			workloads = append(workloads, WorkloadRecord{
+				Kind: kindStatefulSet, Namespace: namespace, Name: statefulSet.Name, Replicas: *statefulSet.Spec.Replicas,
+			})
+		}
+
+		if !req.SuspendCronJobs {
+			continue
+		}
+		cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cronjobs in %s: %w", namespace, err)
+		}
+		for _, cronJob := range cronJobs.Items {
+			suspended := cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+			if skip(namespace, cronJob.Name, cronJob.Labels) || suspended {
+				continue
+			}
+			workloads = append(workloads, WorkloadRecord{
+				Kind: kindCronJob, Namespace: namespace, Name: cronJob.Name, Suspended: false,
+			})
+		}
+	}
+
+	return workloads, nil
+}
+
+// applyWorkload scales a deployment or statefulset, or sets the suspend flag of a cronjob
+func applyWorkload(ctx context.Context, clientset kubernetes.Interface, workload WorkloadRecord, replicas int32, suspend bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch workload.Kind {
+		case kindDeployment:
+			scale, err := clientset.AppsV1().Deployments(workload.Namespace).GetScale(ctx, workload.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			scale.Spec.Replicas = replicas
+			_, err = clientset.AppsV1().Deployments(workload.Namespace).UpdateScale(ctx, workload.Name, scale, metav1.UpdateOptions{})
+			return err
+		case kindStatefulSet:
+			scale, err := clientset.AppsV1().StatefulSets(workload.Namespace).GetScale(ctx, workload.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			scale.Spec.Replicas = replicas
+			_, err = clientset.AppsV1().StatefulSets(workload.Namespace).UpdateScale(ctx, workload.Name, scale, metav1.UpdateOptions{})
+			return err
+		case kindCronJob:
+			cronJob, err := clientset.BatchV1().CronJobs(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			cronJob.Spec.Suspend = &suspend
+			_, err = clientset.BatchV1().CronJobs(workload.Namespace).Update(ctx, cronJob, metav1.UpdateOptions{})
+			return err
+		default:
+			return fmt.Errorf("unsupported workload kind %s", workload.Kind)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package history
+
+import "github.com/agentkube/operator/pkg/objectdiff"
+
+// Change types
+const (
+	ChangeAdded   = objectdiff.Added
+	ChangeRemoved = objectdiff.Removed
+	ChangeChanged = objectdiff.Changed
+)
+
+// ignoredAnnotations change on every rollout or apply without describing the change themselves
+var ignoredAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+	"deployment.kubernetes.io/revision":                true,
+	"deprecated.daemonset.template.generation":         true,
+}
+
+// Change is a field that differs between two revisions
+type Change = objectdiff.Change
+
+// snapshotOf keeps the parts of an object that describe its desired state: every top-level field
+// except metadata and status, plus labels and meaningful annotations
+func snapshotOf(object map[string]interface{}) map[string]interface{} {
+	snapshot := map[string]interface{}{}
+	for field, value := range object {
+		switch field {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		snapshot[field] = value
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	kept := map[string]interface{}{}
+	if labels, ok := metadata["labels"].(map[string]interface{}); ok && len(labels) > 0 {
+		kept["labels"] = labels
+	}
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		filtered := map[string]interface{}{}
+		for key, value := range annotations {
+			if !ignoredAnnotations[key] {
+				filtered[key] = value
+			}
+		}
+		if len(filtered) > 0 {
+			kept["annotations"] = filtered
+		}
+	}
+	if len(kept) > 0 {
+		snapshot["metadata"] = kept
+	}
+	return snapshot
+}
+
+// diffObjects lists the fields that differ from a to b, ordered by path
+func diffObjects(a, b map[string]interface{}) []Change {
+	return objectdiff.Diff(a, b)
+}
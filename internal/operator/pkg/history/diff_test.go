@@ -0,0 +1,97 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffObjects(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a    map[string]interface{}
+		b    map[string]interface{}
+		want []Change
+	}{
+		{
+			name: "identical",
+			a:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 2.0}},
+			b:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 2.0}},
+			want: []Change{},
+		},
+		{
+			name: "changed scalar and added field",
+			a:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 2.0}},
+			b:    map[string]interface{}{"spec": map[string]interface{}{"replicas": 3.0, "paused": true}},
+			want: []Change{
+				{Path: "spec.paused", Type: ChangeAdded, New: true},
+				{Path: "spec.replicas", Type: ChangeChanged, Old: 2.0, New: 3.0},
+			},
+		},
+		{
+			name: "list items",
+			a: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"image": "api:1"},
+				map[string]interface{}{"image": "proxy:1"},
+			}},
+			b: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"image": "api:2"},
+			}},
+			want: []Change{
+				{Path: "containers[0].image", Type: ChangeChanged, Old: "api:1", New: "api:2"},
+				{Path: "containers[1]", Type: ChangeRemoved, Old: map[string]interface{}{"image": "proxy:1"}},
+			},
+		},
+		{
+			name: "dotted keys",
+			a:    map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "api"}}},
+			b:    map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{}}},
+			want: []Change{
+				{Path: `metadata.labels["app.kubernetes.io/name"]`, Type: ChangeRemoved, Old: "api"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := diffObjects(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffObjects() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotOf(t *testing.T) {
+	t.Parallel()
+
+	object := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "api",
+			"resourceVersion": "42",
+			"labels":          map[string]interface{}{"app": "api"},
+			"annotations": map[string]interface{}{
+				"deployment.kubernetes.io/revision": "7",
+				"team":                              "payments",
+			},
+		},
+		"spec":   map[string]interface{}{"replicas": 2.0},
+		"status": map[string]interface{}{"readyReplicas": 1.0},
+	}
+
+	want := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]interface{}{"app": "api"},
+			"annotations": map[string]interface{}{"team": "payments"},
+		},
+		"spec": map[string]interface{}{"replicas": 2.0},
+	}
+	if got := snapshotOf(object); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshotOf() = %#v, want %#v", got, want)
+	}
+}
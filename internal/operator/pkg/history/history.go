@@ -0,0 +1,606 @@
+package history
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	settingsFileName = "history-settings.json"
+	historyDirName   = "history"
+	indexFileName    = "index.json"
+
+	maxRevisionsLimit = 1000
+
+	// eventQueueSize bounds the watcher events waiting to be recorded
+	eventQueueSize = 1024
+	// deletedRetention is how long the history of a deleted resource is kept
+	deletedRetention = 7 * 24 * time.Hour
+	// maxTrackedResources caps the index, the least recently changed resources are forgotten first
+	maxTrackedResources = 10000
+	pruneInterval       = time.Hour
+)
+
+// Revision change types
+const (
+	// ChangeObserved is the state of a resource when its history started, before the first change
+	ChangeObserved = "observed"
+	ChangeCreated  = "created"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+)
+
+// Settings select the tracked resources and how much history to keep
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Kinds are the tracked kinds as reported by the watcher, e.g. "Deployment"
+	Kinds []string `json:"kinds"`
+	// MaxRevisions is the number of revisions kept per resource, older ones are dropped
+	MaxRevisions int `json:"maxRevisions"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:      true,
+		Kinds:        []string{"Deployment", "StatefulSet", "DaemonSet", "Service", "Ingress", "ConfigMap"},
+		MaxRevisions: 50,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.MaxRevisions <= 0 || s.MaxRevisions > maxRevisionsLimit {
+		return fmt.Errorf("maxRevisions must be between 1 and %d", maxRevisionsLimit)
+	}
+	for _, kind := range s.Kinds {
+		if strings.TrimSpace(kind) == "" {
+			return fmt.Errorf("kinds must not be empty")
+		}
+		if strings.EqualFold(kind, "Secret") {
+			return fmt.Errorf("secrets cannot be tracked, their history would store secret data")
+		}
+	}
+	return nil
+}
+
+func (s Settings) tracks(kind string) bool {
+	for _, tracked := range s.Kinds {
+		if strings.EqualFold(tracked, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceRef identifies a tracked resource
+type ResourceRef struct {
+	Cluster    string `json:"cluster"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (r ResourceRef) key() string {
+	return strings.Join([]string{r.Cluster, strings.ToLower(r.Kind), r.Namespace, r.Name}, "/")
+}
+
+// Revision is the desired state of a resource after a change
+type Revision struct {
+	Revision        int                    `json:"revision"`
+	Time            time.Time              `json:"time"`
+	ChangeType      string                 `json:"changeType"`
+	ResourceVersion string                 `json:"resourceVersion,omitempty"`
+	Generation      int64                  `json:"generation,omitempty"`
+	Hash            string                 `json:"hash,omitempty"`
+	Object          map[string]interface{} `json:"object,omitempty"`
+}
+
+// History is the bounded list of revisions of a resource, oldest first
+type History struct {
+	ResourceRef
+	Revisions []Revision `json:"revisions"`
+}
+
+// Summary describes a tracked resource without its revisions
+type Summary struct {
+	ResourceRef
+	Revisions      int       `json:"revisions"`
+	LatestRevision int       `json:"latestRevision"`
+	LatestChange   string    `json:"latestChange"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Filter narrows down the tracked resources, empty fields match everything
+type Filter struct {
+	Cluster   string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (f Filter) matches(s Summary) bool {
+	return (f.Cluster == "" || s.Cluster == f.Cluster) &&
+		(f.Kind == "" || strings.EqualFold(s.Kind, f.Kind)) &&
+		(f.Namespace == "" || s.Namespace == f.Namespace) &&
+		(f.Name == "" || s.Name == f.Name)
+}
+
+// Diff is the difference between two revisions of a resource
+type Diff struct {
+	ResourceRef
+	From    Revision `json:"from"`
+	To      Revision `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// Manager records the revisions of tracked resources from watcher events
+type Manager struct {
+	dir          string
+	settingsPath string
+	mutex        sync.Mutex
+	settings     *Settings
+	// index summarizes every tracked resource by key, loaded on first use
+	index map[string]Summary
+	// indexDirty is set while index changes are not written yet
+	indexDirty bool
+	// events buffers watcher events for the recording worker
+	events chan event.Event
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared history manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		configDir := utils.ConfigDir()
+		globalManager = &Manager{
+			dir:          filepath.Join(configDir, historyDirName),
+			settingsPath: filepath.Join(configDir, settingsFileName),
+			events:       make(chan event.Event, eventQueueSize),
+		}
+		go globalManager.run()
+	})
+	return globalManager
+}
+
+// Settings returns the current history settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new history settings. Lowering maxRevisions trims histories as they change.
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := utils.WriteJSONFile(m.settingsPath, settings); err != nil {
+		return err
+	}
+	m.settings = &settings
+	return nil
+}
+
+// HandleEvent queues a watcher event for recording. It never blocks the watcher, events are
+// dropped while the queue is full.
+func (m *Manager) HandleEvent(e event.Event) {
+	select {
+	case m.events <- e:
+	default:
+		logger.Log(logger.LevelWarn, map[string]string{
+			"cluster": e.Host,
+			"kind":    e.Kind,
+			"name":    e.Name,
+		}, nil, "History event queue is full, dropping watcher event")
+	}
+}
+
+// run records queued events and prunes the index. The index is written once the queue drains.
+func (m *Manager) run() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-m.events:
+			m.recordEvent(e)
+			if len(m.events) == 0 {
+				m.flushIndex()
+			}
+		case <-ticker.C:
+			if err := m.prune(time.Now()); err != nil {
+				logger.Log(logger.LevelWarn, nil, err, "Failed to prune resource history")
+			}
+		}
+	}
+}
+
+// recordEvent records a revision for events of tracked kinds whose desired state changed
+func (m *Manager) recordEvent(e event.Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	settings, err := m.loadSettings()
+	if err != nil || !settings.Enabled || !settings.tracks(e.Kind) {
+		return
+	}
+
+	ref := ResourceRef{
+		Cluster:    e.Host,
+		APIVersion: e.ApiVersion,
+		Kind:       e.Kind,
+		Namespace:  e.Namespace,
+		Name:       e.Name,
+	}
+	if err := m.record(ref, e, settings); err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{
+			"cluster": ref.Cluster,
+			"kind":    ref.Kind,
+			"name":    ref.Name,
+		}, err, "Failed to record resource revision")
+	}
+}
+
+// flushIndex writes pending index changes
+func (m *Manager) flushIndex() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.indexDirty {
+		return
+	}
+	if err := m.saveIndex(); err != nil {
+		logger.Log(logger.LevelWarn, nil, err, "Failed to save resource history index")
+	}
+}
+
+// prune forgets resources deleted longer than deletedRetention ago, and the least recently
+// changed resources while the index exceeds maxTrackedResources
+func (m *Manager) prune(now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadIndex(); err != nil {
+		return err
+	}
+
+	var stale []Summary
+	remaining := make([]Summary, 0, len(m.index))
+	for _, summary := range m.index {
+		if summary.LatestChange == ChangeDeleted && now.Sub(summary.UpdatedAt) > deletedRetention {
+			stale = append(stale, summary)
+		} else {
+			remaining = append(remaining, summary)
+		}
+	}
+	if excess := len(remaining) - maxTrackedResources; excess > 0 {
+		sort.Slice(remaining, func(i, j int) bool {
+			return remaining[i].UpdatedAt.Before(remaining[j].UpdatedAt)
+		})
+		stale = append(stale, remaining[:excess]...)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	for _, summary := range stale {
+		if err := os.Remove(m.historyPath(summary.ResourceRef)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete history: %v", err)
+		}
+		delete(m.index, summary.key())
+	}
+	return m.saveIndex()
+}
+
+// record appends the revisions of an event and updates the index in memory, the caller must hold the mutex
+func (m *Manager) record(ref ResourceRef, e event.Event, settings Settings) error {
+	if err := m.loadIndex(); err != nil {
+		return err
+	}
+	summary, tracked := m.index[ref.key()]
+
+	var revisions []Revision
+	switch e.Reason {
+	case "Created":
+		revisions = append(revisions, revisionOf(ChangeCreated, e.Obj))
+	case "Updated":
+		updated := revisionOf(ChangeUpdated, e.Obj)
+		if !tracked && e.OldObj != nil {
+			// Keep the state before the first change, so it can be diffed
+			observed := revisionOf(ChangeObserved, e.OldObj)
+			if observed.Hash == updated.Hash {
+				return nil
+			}
+			revisions = append(revisions, observed)
+		}
+		revisions = append(revisions, updated)
+	case "Deleted":
+		if !tracked {
+			return nil
+		}
+		revisions = append(revisions, Revision{ChangeType: ChangeDeleted})
+	default:
+		return nil
+	}
+
+	history := &History{ResourceRef: ref}
+	if tracked {
+		loaded, err := m.loadHistory(ref)
+		if err != nil {
+			return err
+		}
+		history = loaded
+	}
+
+	now := time.Now()
+	changed := false
+	for _, revision := range revisions {
+		if revision.ChangeType != ChangeDeleted && revision.Object == nil {
+			continue
+		}
+		if latest := history.latest(); latest != nil && latest.Hash == revision.Hash && revision.ChangeType != ChangeDeleted {
+			// Status and metadata only updates leave the desired state unchanged
+			continue
+		}
+		revision.Revision = summary.LatestRevision + 1
+		revision.Time = now
+		summary.LatestRevision = revision.Revision
+		history.Revisions = append(history.Revisions, revision)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if len(history.Revisions) > settings.MaxRevisions {
+		history.Revisions = history.Revisions[len(history.Revisions)-settings.MaxRevisions:]
+	}
+
+	if err := utils.WriteJSONFile(m.historyPath(ref), history); err != nil {
+		return err
+	}
+	latest := history.latest()
+	m.index[ref.key()] = Summary{
+		ResourceRef:    ref,
+		Revisions:      len(history.Revisions),
+		LatestRevision: latest.Revision,
+		LatestChange:   latest.ChangeType,
+		UpdatedAt:      latest.Time,
+	}
+	m.indexDirty = true
+	return nil
+}
+
+// revisionOf snapshots the desired state of an object. The object is nil when it cannot be converted.
+func revisionOf(changeType string, obj runtime.Object) Revision {
+	revision := Revision{ChangeType: changeType}
+	if obj == nil {
+		return revision
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return revision
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	revision.ResourceVersion, _ = metadata["resourceVersion"].(string)
+	if generation, ok := metadata["generation"].(int64); ok {
+		revision.Generation = generation
+	}
+	revision.Object = snapshotOf(object)
+
+	data, err := json.Marshal(revision.Object)
+	if err != nil {
+		revision.Object = nil
+		return revision
+	}
+	sum := sha256.Sum256(data)
+	revision.Hash = hex.EncodeToString(sum[:])
+	return revision
+}
+
+func (h *History) latest() *Revision {
+	if len(h.Revisions) == 0 {
+		return nil
+	}
+	return &h.Revisions[len(h.Revisions)-1]
+}
+
+func (h *History) find(number int) *Revision {
+	for i := range h.Revisions {
+		if h.Revisions[i].Revision == number {
+			return &h.Revisions[i]
+		}
+	}
+	return nil
+}
+
+// List returns the tracked resources matching the filter, most recently changed first
+func (m *Manager) List(filter Filter) ([]Summary, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadIndex(); err != nil {
+		return nil, err
+	}
+	result := []Summary{}
+	for _, summary := range m.index {
+		if filter.matches(summary) {
+			result = append(result, summary)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UpdatedAt.After(result[j].UpdatedAt)
+	})
+	return result, nil
+}
+
+// Get returns the revisions of a resource
+func (m *Manager) Get(ref ResourceRef) (*History, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadIndex(); err != nil {
+		return nil, err
+	}
+	summary, ok := m.index[ref.key()]
+	if !ok {
+		return nil, fmt.Errorf("no history for %s %s", ref.Kind, qualifiedName(ref))
+	}
+	return m.loadHistory(summary.ResourceRef)
+}
+
+// Diff compares two revisions of a resource
+func (m *Manager) Diff(ref ResourceRef, from, to int) (*Diff, error) {
+	history, err := m.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRevision := history.find(from)
+	if fromRevision == nil {
+		return nil, fmt.Errorf("revision %d of %s not found", from, qualifiedName(ref))
+	}
+	toRevision := history.find(to)
+	if toRevision == nil {
+		return nil, fmt.Errorf("revision %d of %s not found", to, qualifiedName(ref))
+	}
+
+	return &Diff{
+		ResourceRef: history.ResourceRef,
+		From:        *fromRevision,
+		To:          *toRevision,
+		Changes:     diffObjects(fromRevision.Object, toRevision.Object),
+	}, nil
+}
+
+// Delete forgets the history of a resource
+func (m *Manager) Delete(ref ResourceRef) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadIndex(); err != nil {
+		return err
+	}
+	summary, ok := m.index[ref.key()]
+	if !ok {
+		return fmt.Errorf("no history for %s %s", ref.Kind, qualifiedName(ref))
+	}
+	if err := os.Remove(m.historyPath(summary.ResourceRef)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete history: %v", err)
+	}
+	delete(m.index, ref.key())
+	return m.saveIndex()
+}
+
+// RetentionSource lists the tracked resources for the retention policies, a resource's history
+// ages from its latest change
+func (m *Manager) RetentionSource() retention.Source {
+	return retention.SourceFuncs{
+		ItemsFunc: func(context.Context) ([]retention.Item, error) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+
+			if err := m.loadIndex(); err != nil {
+				return nil, err
+			}
+			items := make([]retention.Item, 0, len(m.index))
+			for key, summary := range m.index {
+				var size int64
+				if info, err := os.Stat(m.historyPath(summary.ResourceRef)); err == nil {
+					size = info.Size()
+				}
+				items = append(items, retention.Item{ID: key, Size: size, ModTime: summary.UpdatedAt})
+			}
+			return items, nil
+		},
+		DeleteFunc: func(_ context.Context, key string) error {
+			m.mutex.Lock()
+			summary, ok := m.index[key]
+			m.mutex.Unlock()
+			if !ok {
+				return nil
+			}
+			return m.Delete(summary.ResourceRef)
+		},
+	}
+}
+
+func qualifiedName(ref ResourceRef) string {
+	if ref.Namespace == "" {
+		return ref.Name
+	}
+	return ref.Namespace + "/" + ref.Name
+}
+
+// historyPath names history files by a hash of the resource key, which may contain any character
+func (m *Manager) historyPath(ref ResourceRef) string {
+	sum := sha256.Sum256([]byte(ref.key()))
+	return filepath.Join(m.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (m *Manager) loadHistory(ref ResourceRef) (*History, error) {
+	history := &History{ResourceRef: ref}
+	if err := utils.ReadJSONFile(m.historyPath(ref), history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// loadSettings returns the cached settings, the caller must hold the mutex
+func (m *Manager) loadSettings() (Settings, error) {
+	if m.settings != nil {
+		return *m.settings, nil
+	}
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	m.settings = &settings
+	return settings, nil
+}
+
+// loadIndex reads the index on first use, the caller must hold the mutex
+func (m *Manager) loadIndex() error {
+	if m.index != nil {
+		return nil
+	}
+	index := map[string]Summary{}
+	if err := utils.ReadJSONFile(filepath.Join(m.dir, indexFileName), &index); err != nil {
+		return err
+	}
+	m.index = index
+	return nil
+}
+
+// saveIndex writes the index, the caller must hold the mutex
+func (m *Manager) saveIndex() error {
+	if err := utils.WriteJSONFile(filepath.Join(m.dir, indexFileName), m.index); err != nil {
+		return err
+	}
+	m.indexDirty = false
+	return nil
+}
@@ -0,0 +1,48 @@
+package history
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{dir: t.TempDir(), index: map[string]Summary{}}
+	now := time.Now()
+	add := func(name, change string, updatedAt time.Time) ResourceRef {
+		ref := ResourceRef{Cluster: "prod", APIVersion: "apps/v1", Kind: "Deployment", Namespace: "shop", Name: name}
+		if err := os.WriteFile(m.historyPath(ref), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		m.index[ref.key()] = Summary{ResourceRef: ref, LatestChange: change, UpdatedAt: updatedAt}
+		return ref
+	}
+
+	live := add("api", ChangeUpdated, now.Add(-30*24*time.Hour))
+	recentlyDeleted := add("web", ChangeDeleted, now.Add(-time.Hour))
+	longDeleted := add("old", ChangeDeleted, now.Add(-deletedRetention-time.Hour))
+
+	if err := m.prune(now); err != nil {
+		t.Fatalf("prune() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		ref  ResourceRef
+		want bool
+	}{
+		{live, true},
+		{recentlyDeleted, true},
+		{longDeleted, false},
+	} {
+		_, indexed := m.index[tt.ref.key()]
+		_, err := os.Stat(m.historyPath(tt.ref))
+		if indexed != tt.want || (err == nil) != tt.want {
+			t.Errorf("%s kept = %v (file error %v), want %v", tt.ref.Name, indexed, err, tt.want)
+		}
+	}
+	if m.indexDirty {
+		t.Error("prune() should write the index")
+	}
+}
@@ -0,0 +1,114 @@
+package imagepull
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// dockerHubAuthority is the registry host credentials for Docker Hub images are looked up by
+const dockerHubAuthority = "index.docker.io"
+
+// RegistryCredential authenticates pulls from a registry. Password and token are secret material,
+// responses carry the credential Redacted.
+type RegistryCredential struct {
+	// Registry is the registry host, e.g. ghcr.io, or a docker config key like https://index.docker.io/v1/
+	Registry string `json:"registry"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Token is a bearer token used in place of the username and password
+	Token string `json:"token,omitempty"`
+	// Source is where the credential was found, the namespace/name of a pull secret or empty when configured
+	Source string `json:"source,omitempty"`
+}
+
+// Redacted returns the credential without its password and token
+func (c RegistryCredential) Redacted() RegistryCredential {
+	c.Password, c.Token = "", ""
+	return c
+}
+
+// Authority returns the registry host credentials for an image are looked up by, false for
+// malformed references
+func Authority(image string) (string, bool) {
+	ref, ok := parseReference(image)
+	if !ok {
+		return "", false
+	}
+	if ref.Registry == dockerHub {
+		return dockerHubAuthority, true
+	}
+	return ref.Registry, true
+}
+
+// CredentialsFor returns the credentials for the registry of an image, in order
+func CredentialsFor(credentials []RegistryCredential, image string) []RegistryCredential {
+	ref, ok := parseReference(image)
+	if !ok {
+		return nil
+	}
+	var matching []RegistryCredential
+	for _, credential := range credentials {
+		if matchesRegistry(credential.Registry, ref.Registry) {
+			matching = append(matching, credential)
+		}
+	}
+	return matching
+}
+
+// SecretCredentials returns the credentials of every registry of a pull secret, sorted by registry
+func SecretCredentials(secret *corev1.Secret) ([]RegistryCredential, error) {
+	auths, err := dockerConfigAuths(secret.Type, secret.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	source := secret.Namespace + "/" + secret.Name
+	var credentials []RegistryCredential
+	for registry, auth := range auths {
+		if username, password, ok := auth.credentials(); ok {
+			credentials = append(credentials, RegistryCredential{Registry: registry, Username: username, Password: password, Source: source})
+		}
+	}
+	sort.Slice(credentials, func(a, b int) bool { return credentials[a].Registry < credentials[b].Registry })
+	return credentials, nil
+}
+
+// PullSecretCache reads the credentials of the pull secrets of a cluster, each secret once
+type PullSecretCache struct {
+	clientset kubernetes.Interface
+	secrets   map[string][]RegistryCredential
+}
+
+// NewPullSecretCache creates a cache reading pull secrets through the clientset
+func NewPullSecretCache(clientset kubernetes.Interface) *PullSecretCache {
+	return &PullSecretCache{clientset: clientset, secrets: map[string][]RegistryCredential{}}
+}
+
+// PodCredentials returns the credentials of the imagePullSecrets of a pod, which include those of
+// its service account. Secrets that can't be read or aren't docker configs are skipped and reported.
+func (p *PullSecretCache) PodCredentials(ctx context.Context, pod *corev1.Pod) ([]RegistryCredential, []error) {
+	var credentials []RegistryCredential
+	var errs []error
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		key := pod.Namespace + "/" + ref.Name
+		cached, ok := p.secrets[key]
+		if !ok {
+			secret, err := p.clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err == nil {
+				cached, err = SecretCredentials(secret)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pull secret %s: %v", key, err))
+			}
+			// Failures are cached as well so a secret is reported once
+			p.secrets[key] = cached
+		}
+		credentials = append(credentials, cached...)
+	}
+	return credentials, errs
+}
@@ -0,0 +1,91 @@
+package imagepull
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCredentialsFor(t *testing.T) {
+	t.Parallel()
+
+	hub := RegistryCredential{Registry: "https://index.docker.io/v1/", Username: "hub"}
+	ghcr := RegistryCredential{Registry: "ghcr.io", Username: "ghcr"}
+	local := RegistryCredential{Registry: "registry.local:5000", Username: "local"}
+	credentials := []RegistryCredential{hub, ghcr, local}
+
+	tests := []struct {
+		image         string
+		want          []RegistryCredential
+		wantAuthority string
+	}{
+		{image: "nginx:1.27", want: []RegistryCredential{hub}, wantAuthority: "index.docker.io"},
+		{image: "ghcr.io/acme/api:v1", want: []RegistryCredential{ghcr}, wantAuthority: "ghcr.io"},
+		{image: "registry.local:5000/team/app", want: []RegistryCredential{local}, wantAuthority: "registry.local:5000"},
+		{image: "quay.io/org/app", wantAuthority: "quay.io"},
+		{image: "Bad/Name"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.image, func(t *testing.T) {
+			t.Parallel()
+
+			if got := CredentialsFor(credentials, tt.image); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CredentialsFor(%q) = %+v, want %+v", tt.image, got, tt.want)
+			}
+			if got, _ := Authority(tt.image); got != tt.wantAuthority {
+				t.Errorf("Authority(%q) = %q, want %q", tt.image, got, tt.wantAuthority)
+			}
+		})
+	}
+}
+
+func TestPodCredentials(t *testing.T) {
+	t.Parallel()
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "regcred"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				// ghcr.io has an auth of user:secret, quay.io no usable credentials
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"ghcr.io":{"auth":"dXNlcjpzZWNyZXQ="},"quay.io":{"username":"bot"}}}`),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "opaque"},
+			Type:       corev1.SecretTypeOpaque,
+		},
+	)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "api"},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "regcred"}, {Name: "opaque"}, {Name: "missing"}},
+		},
+	}
+
+	cache := NewPullSecretCache(clientset)
+	credentials, errs := cache.PodCredentials(context.Background(), pod)
+	want := []RegistryCredential{{Registry: "ghcr.io", Username: "user", Password: "secret", Source: "apps/regcred"}}
+	if !reflect.DeepEqual(credentials, want) {
+		t.Errorf("PodCredentials() = %+v, want %+v", credentials, want)
+	}
+	if len(errs) != 2 {
+		t.Errorf("PodCredentials() reported %d errors, want 2: %v", len(errs), errs)
+	}
+
+	// Secrets are read once
+	credentials, errs = cache.PodCredentials(context.Background(), pod)
+	if !reflect.DeepEqual(credentials, want) || len(errs) != 0 {
+		t.Errorf("cached PodCredentials() = %+v, %v, want %+v without errors", credentials, errs, want)
+	}
+
+	if redacted := credentials[0].Redacted(); redacted.Password != "" || redacted.Username != "user" {
+		t.Errorf("Redacted() = %+v, want the username only", redacted)
+	}
+}
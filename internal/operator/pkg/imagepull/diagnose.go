@@ -0,0 +1,358 @@
+package imagepull
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// pullReasons are the container waiting reasons of image pull failures
+var pullReasons = map[string]bool{
+	"ImagePullBackOff":  true,
+	"ErrImagePull":      true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// ErrNoPullFailure is returned for pods without a container failing to pull its image
+var ErrNoPullFailure = errors.New("no container of the pod is failing to pull its image")
+
+// Options tune a diagnosis
+type Options struct {
+	// Container limits the diagnosis to a container, empty diagnoses every failing one
+	Container string `json:"container,omitempty"`
+	// FromNode also checks the registries from the node of the pod with a short-lived probe pod
+	FromNode bool `json:"fromNode"`
+	// ProbeImage is the image of the probe pod, it needs sh, nslookup and wget
+	ProbeImage string `json:"probeImage,omitempty"`
+}
+
+// RegistryCheck is the reachability of a registry from the operator or a node
+type RegistryCheck struct {
+	Host string `json:"host"`
+	// Source is "operator" or the node the check ran on
+	Source string `json:"source"`
+	// Completed is unset when the check could not run, e.g. the probe pod did not start
+	Completed bool     `json:"completed"`
+	Resolved  bool     `json:"resolved"`
+	Addresses []string `json:"addresses,omitempty"`
+	Reachable bool     `json:"reachable"`
+	// HTTPStatus is the status of the registry API root, 401 when it requires credentials
+	HTTPStatus   int    `json:"httpStatus,omitempty"`
+	AuthRequired bool   `json:"authRequired"`
+	LatencyMs    int64  `json:"latencyMs,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SecretCheck is the state of an imagePullSecret of the pod
+type SecretCheck struct {
+	Name  string `json:"name"`
+	Found bool   `json:"found"`
+	Type  string `json:"type,omitempty"`
+	// Valid is set when the secret holds a docker config that parses
+	Valid bool `json:"valid"`
+	// Registries are the registries the secret has credentials for
+	Registries []string `json:"registries"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ContainerDiagnosis is the cause of a container failing to pull its image
+type ContainerDiagnosis struct {
+	Container string     `json:"container"`
+	Image     string     `json:"image"`
+	Reference *Reference `json:"reference,omitempty"`
+	// Reason is the waiting reason of the container, e.g. ImagePullBackOff
+	Reason string `json:"reason"`
+	// Message is the pull error reported by the kubelet
+	Message    string `json:"message,omitempty"`
+	Cause      string `json:"cause"`
+	Suggestion string `json:"suggestion"`
+	// CredentialSecrets are the pull secrets with credentials for the registry of the image
+	CredentialSecrets []string `json:"credentialSecrets"`
+}
+
+// Diagnosis explains why the containers of a pod can't pull their images
+type Diagnosis struct {
+	Namespace  string               `json:"namespace"`
+	Pod        string               `json:"pod"`
+	Node       string               `json:"node,omitempty"`
+	Containers []ContainerDiagnosis `json:"containers"`
+	Registries []RegistryCheck      `json:"registries"`
+	Secrets    []SecretCheck        `json:"secrets"`
+}
+
+// Diagnose finds the containers of a pod failing to pull their image, classifies the pull errors
+// and checks the registries and pull secrets to tell the concrete cause
+func Diagnose(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, options Options) (*Diagnosis, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis := &Diagnosis{
+		Namespace:  namespace,
+		Pod:        podName,
+		Node:       pod.Spec.NodeName,
+		Containers: []ContainerDiagnosis{},
+		Registries: []RegistryCheck{},
+		Secrets:    []SecretCheck{},
+	}
+
+	messages := pullMessages(ctx, clientset, pod)
+	images := podImages(pod)
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, status := range statuses {
+			waiting := status.State.Waiting
+			if waiting == nil || !pullReasons[waiting.Reason] || (options.Container != "" && options.Container != status.Name) {
+				continue
+			}
+			container := ContainerDiagnosis{
+				Container:         status.Name,
+				Image:             images[status.Name],
+				Reason:            waiting.Reason,
+				Message:           waiting.Message,
+				CredentialSecrets: []string{},
+			}
+			if message, ok := messages[container.Image]; ok {
+				container.Message = message
+			}
+			if ref, ok := parseReference(container.Image); ok {
+				container.Reference = &ref
+			}
+			diagnosis.Containers = append(diagnosis.Containers, container)
+		}
+	}
+	if len(diagnosis.Containers) == 0 {
+		return nil, ErrNoPullFailure
+	}
+
+	for _, secret := range pod.Spec.ImagePullSecrets {
+		diagnosis.Secrets = append(diagnosis.Secrets, checkSecret(ctx, clientset, namespace, secret.Name))
+	}
+
+	hosts := []string{}
+	seen := map[string]bool{}
+	for _, container := range diagnosis.Containers {
+		if container.Reference != nil && !seen[container.Reference.endpoint()] {
+			seen[container.Reference.endpoint()] = true
+			hosts = append(hosts, container.Reference.endpoint())
+		}
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		diagnosis.Registries = append(diagnosis.Registries, checkFromOperator(ctx, host))
+	}
+	if options.FromNode && pod.Spec.NodeName != "" {
+		for _, host := range hosts {
+			diagnosis.Registries = append(diagnosis.Registries, checkFromNode(ctx, clientset, namespace, pod.Spec.NodeName, host, options.ProbeImage))
+		}
+	}
+
+	for i := range diagnosis.Containers {
+		conclude(&diagnosis.Containers[i], diagnosis.Registries, diagnosis.Secrets)
+	}
+	return diagnosis, nil
+}
+
+// conclude sets the cause of a container from its pull error, refined by the registry and secret checks
+func conclude(container *ContainerDiagnosis, registries []RegistryCheck, secrets []SecretCheck) {
+	if container.Reference == nil {
+		container.Cause = CauseInvalidName
+		container.Suggestion = suggestions[CauseInvalidName]
+		return
+	}
+
+	for _, secret := range secrets {
+		for _, registry := range secret.Registries {
+			if matchesRegistry(registry, container.Reference.Registry) {
+				container.CredentialSecrets = append(container.CredentialSecrets, secret.Name)
+				break
+			}
+		}
+	}
+
+	container.Cause = classify(container.Reason + " " + container.Message)
+	// The checks tell network causes apart when the kubelet message is vague, the node pulls the
+	// image so its check comes last and wins
+	if container.Cause == CauseUnknown {
+		for _, check := range registries {
+			if check.Host != container.Reference.endpoint() || !check.Completed || check.Reachable {
+				continue
+			}
+			if !check.Resolved {
+				container.Cause = CauseDNS
+			} else if cause := classify(check.Error); cause != CauseUnknown {
+				container.Cause = cause
+			}
+		}
+	}
+	container.Suggestion = suggestions[container.Cause]
+
+	switch container.Cause {
+	case CauseUnauthorized:
+		if len(container.CredentialSecrets) == 0 {
+			container.Suggestion = fmt.Sprintf("No imagePullSecret of the pod has credentials for %s. Create one and reference it from the pod or its service account.", container.Reference.Registry)
+		} else {
+			container.Suggestion = fmt.Sprintf("The registry rejected the credentials of %s. Check they are current and grant pull access to %s.",
+				strings.Join(container.CredentialSecrets, ", "), container.Reference.Repository)
+		}
+	case CauseNotFound:
+		container.Suggestion = fmt.Sprintf("%s:%s was not found on %s. %s", container.Reference.Repository, container.Reference.Tag, container.Reference.Registry, suggestions[CauseNotFound])
+		if container.Reference.Digest != "" {
+			container.Suggestion = fmt.Sprintf("%s@%s was not found on %s. %s", container.Reference.Repository, container.Reference.Digest, container.Reference.Registry, suggestions[CauseNotFound])
+		}
+	}
+
+	// Reachable from the operator but not from the node points at the node network
+	var fromOperator, fromNode *RegistryCheck
+	for i := range registries {
+		if registries[i].Host != container.Reference.endpoint() {
+			continue
+		}
+		if registries[i].Source == sourceOperator {
+			fromOperator = &registries[i]
+		} else {
+			fromNode = &registries[i]
+		}
+	}
+	if fromOperator != nil && fromNode != nil && fromNode.Completed && fromOperator.Reachable && !fromNode.Reachable {
+		container.Suggestion += fmt.Sprintf(" The registry is reachable from the operator but not from node %s, check the egress of the node.", fromNode.Source)
+	}
+}
+
+// pullMessages returns the latest pull error event message of each image of a pod
+func pullMessages(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) map[string]string {
+	messages := map[string]string{}
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": pod.Name}.String(),
+	})
+	if err != nil {
+		return messages
+	}
+
+	items := events.Items
+	sort.SliceStable(items, func(i, j int) bool { return items[i].LastTimestamp.Before(&items[j].LastTimestamp) })
+	for _, e := range items {
+		if e.Reason != "Failed" || !strings.Contains(e.Message, "image") {
+			continue
+		}
+		for _, image := range podImages(pod) {
+			if strings.Contains(e.Message, `"`+image+`"`) {
+				messages[image] = e.Message
+			}
+		}
+	}
+	return messages
+}
+
+// podImages maps the containers of a pod to their images
+func podImages(pod *corev1.Pod) map[string]string {
+	images := map[string]string{}
+	for _, container := range pod.Spec.InitContainers {
+		images[container.Name] = container.Image
+	}
+	for _, container := range pod.Spec.Containers {
+		images[container.Name] = container.Image
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		images[container.Name] = container.Image
+	}
+	return images
+}
+
+// checkSecret reads an imagePullSecret and lists the registries it has credentials for
+func checkSecret(ctx context.Context, clientset kubernetes.Interface, namespace, name string) SecretCheck {
+	check := SecretCheck{Name: name, Registries: []string{}}
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		check.Error = fmt.Sprintf("secret %s does not exist in namespace %s", name, namespace)
+		return check
+	}
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Found = true
+	check.Type = string(secret.Type)
+
+	registries, err := dockerConfigRegistries(secret.Type, secret.Data)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Valid = true
+	check.Registries = registries
+	return check
+}
+
+// dockerAuth is an entry of a docker config
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// credentials returns the username and password of the entry, decoding auth when they aren't set
+func (a dockerAuth) credentials() (string, string, bool) {
+	if a.Username != "" && a.Password != "" {
+		return a.Username, a.Password, true
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if user, password, ok := strings.Cut(string(decoded), ":"); err == nil && ok && user != "" && password != "" {
+		return user, password, true
+	}
+	return "", "", false
+}
+
+// dockerConfigAuths parses the docker config of a pull secret into its entries by registry
+func dockerConfigAuths(secretType corev1.SecretType, data map[string][]byte) (map[string]dockerAuth, error) {
+	var auths map[string]dockerAuth
+	switch secretType {
+	case corev1.SecretTypeDockerConfigJson:
+		var config struct {
+			Auths map[string]dockerAuth `json:"auths"`
+		}
+		if err := json.Unmarshal(data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", corev1.DockerConfigJsonKey, err)
+		}
+		auths = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", corev1.DockerConfigKey, err)
+		}
+	default:
+		return nil, fmt.Errorf("secret type %s is not a docker config, use %s", secretType, corev1.SecretTypeDockerConfigJson)
+	}
+	return auths, nil
+}
+
+// dockerConfigRegistries parses the docker config of a pull secret and returns the registries with
+// usable credentials
+func dockerConfigRegistries(secretType corev1.SecretType, data map[string][]byte) ([]string, error) {
+	auths, err := dockerConfigAuths(secretType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	registries := []string{}
+	for registry, auth := range auths {
+		if _, _, ok := auth.credentials(); ok {
+			registries = append(registries, registry)
+		}
+	}
+	if len(registries) == 0 {
+		return nil, errors.New("the docker config has no username and password for any registry")
+	}
+	sort.Strings(registries)
+	return registries, nil
+}
@@ -0,0 +1,159 @@
+package imagepull
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultProbeImage = "busybox:1.36"
+	// probeTimeout bounds the wait for the probe pod, including the pull of its image
+	probeTimeout  = 90 * time.Second
+	probeInterval = 2 * time.Second
+)
+
+// validHost guards the registry host interpolated in the probe script
+var validHost = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+// httpStatusLine matches the status busybox wget reports for failed requests
+var httpStatusLine = regexp.MustCompile(`HTTP/[0-9.]+ ([0-9]{3})`)
+
+// checkFromNode runs a probe pod on the host network of a node that resolves the registry host and
+// calls the root of its API, then deletes it
+func checkFromNode(ctx context.Context, clientset kubernetes.Interface, namespace, nodeName, host, image string) RegistryCheck {
+	check := RegistryCheck{Host: host, Source: nodeName}
+	if !validHost.MatchString(host) {
+		check.Error = fmt.Sprintf("invalid registry host %q", host)
+		return check
+	}
+	if image == "" {
+		image = defaultProbeImage
+	}
+
+	hostname := host
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		hostname = host[:i]
+	}
+	deadline := int64(probeTimeout.Seconds())
+	probe := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "agentkube-pull-probe-",
+			Namespace:    namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "agentkube"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:              nodeName,
+			HostNetwork:           true,
+			DNSPolicy:             corev1.DNSClusterFirstWithHostNet,
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+			Tolerations:           []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   image,
+				Command: []string{"sh", "-c", probeScript(hostname, host)},
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(namespace).Create(ctx, probe, metav1.CreateOptions{})
+	if err != nil {
+		check.Error = fmt.Sprintf("failed to create probe pod: %v", err)
+		return check
+	}
+	defer func() {
+		// The request context may be done, the probe pod is deleted regardless
+		deleteCtx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+		_ = clientset.CoreV1().Pods(namespace).Delete(deleteCtx, created.Name, metav1.DeleteOptions{})
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(waitCtx, created.Name, metav1.GetOptions{})
+		if err == nil && (pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed) {
+			break
+		}
+		if err == nil {
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Waiting != nil && pullReasons[status.State.Waiting.Reason] {
+					check.Error = fmt.Sprintf("the node can't pull the probe image %s: %s", image, status.State.Waiting.Message)
+					return check
+				}
+			}
+		}
+		select {
+		case <-waitCtx.Done():
+			check.Error = "the probe pod did not complete in time"
+			return check
+		case <-ticker.C:
+		}
+	}
+
+	logs, err := clientset.CoreV1().Pods(namespace).GetLogs(created.Name, &corev1.PodLogOptions{Container: "probe"}).DoRaw(ctx)
+	if err != nil {
+		check.Error = fmt.Sprintf("failed to read probe logs: %v", err)
+		return check
+	}
+	parseProbe(&check, string(logs))
+	return check
+}
+
+// probeScript resolves the host then requests the registry API root, printing markers parseProbe reads
+func probeScript(hostname, host string) string {
+	return fmt.Sprintf(`if nslookup %[1]s >/dev/null 2>&1; then echo "dns=ok"; else echo "dns=fail"; fi
+wget -S -q -T 10 -O /dev/null https://%[2]s/v2/ 2>&1
+echo "exit=$?"`, hostname, host)
+}
+
+// parseProbe reads the output of the probe script into a check
+func parseProbe(check *RegistryCheck, output string) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	check.Completed = true
+	check.Resolved = strings.Contains(output, "dns=ok")
+
+	body := []string{}
+	exitCode := -1
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "dns=ok" || line == "dns=fail":
+		case strings.HasPrefix(line, "exit="):
+			exitCode, _ = strconv.Atoi(strings.TrimPrefix(line, "exit="))
+		case line != "":
+			body = append(body, line)
+		}
+	}
+
+	if match := httpStatusLine.FindStringSubmatch(output); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		check.HTTPStatus = status
+		check.Reachable, check.AuthRequired = registryStatus(status, "")
+		// -S prints the response headers, a bearer challenge serves anonymous pulls
+		if strings.Contains(strings.ToLower(output), "www-authenticate: bearer") {
+			check.AuthRequired = false
+		}
+		return
+	}
+	if exitCode == 0 {
+		check.Reachable = true
+		check.HTTPStatus = 200
+		return
+	}
+	if !check.Resolved && len(body) == 0 {
+		check.Error = "the registry host does not resolve from the node"
+		return
+	}
+	check.Error = strings.Join(body, "; ")
+}
@@ -0,0 +1,142 @@
+package imagepull
+
+import (
+	"strings"
+)
+
+// Causes of an image pull failure
+const (
+	CauseNotFound          = "image-not-found"
+	CauseUnauthorized      = "unauthorized"
+	CauseDNS               = "dns-resolution"
+	CauseTimeout           = "network-timeout"
+	CauseConnectionRefused = "connection-refused"
+	CauseTLS               = "tls-certificate"
+	CauseRateLimited       = "rate-limited"
+	CauseInvalidName       = "invalid-image-name"
+	CausePlatform          = "platform-mismatch"
+	CauseUnknown           = "unknown"
+)
+
+// dockerHub is the registry of image references without a registry host
+const dockerHub = "docker.io"
+
+// Reference is an image reference split into its parts
+type Reference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// parseReference splits an image reference the way the container runtime resolves it: the first
+// component is a registry when it holds a dot, a port or is localhost, otherwise Docker Hub
+func parseReference(image string) (Reference, bool) {
+	if image == "" || strings.ContainsAny(image, " \t\n") || image != strings.TrimSpace(image) {
+		return Reference{}, false
+	}
+
+	ref := Reference{Registry: dockerHub}
+	remainder := image
+	if name, digest, ok := strings.Cut(remainder, "@"); ok {
+		if !strings.Contains(digest, ":") {
+			return Reference{}, false
+		}
+		ref.Digest, remainder = digest, name
+	}
+
+	if first, rest, ok := strings.Cut(remainder, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, remainder = first, rest
+	}
+	// A colon after the last slash separates the tag
+	if i := strings.LastIndex(remainder, ":"); i > strings.LastIndex(remainder, "/") {
+		ref.Tag, remainder = remainder[i+1:], remainder[:i]
+		if ref.Tag == "" {
+			return Reference{}, false
+		}
+	}
+	if remainder == "" || remainder != strings.ToLower(remainder) || strings.HasPrefix(remainder, "/") || strings.HasSuffix(remainder, "/") {
+		return Reference{}, false
+	}
+	if ref.Registry == dockerHub && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+	ref.Repository = remainder
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, true
+}
+
+// endpoint returns the host serving the registry API
+func (r Reference) endpoint() string {
+	if r.Registry == dockerHub {
+		return "registry-1.docker.io"
+	}
+	return r.Registry
+}
+
+// registryAliases are the keys a docker config may use for a registry
+func registryAliases(registry string) []string {
+	if registry == dockerHub {
+		return []string{"docker.io", "index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/", "https://index.docker.io/v1", "https://registry-1.docker.io"}
+	}
+	return []string{registry}
+}
+
+// matchesRegistry reports whether a docker config key, e.g. https://ghcr.io/v1/, is the registry
+func matchesRegistry(key, registry string) bool {
+	host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	for _, alias := range registryAliases(registry) {
+		aliasHost := strings.TrimPrefix(alias, "https://")
+		aliasHost, _, _ = strings.Cut(aliasHost, "/")
+		if strings.EqualFold(host, aliasHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// causePatterns classify the pull error messages of the container runtimes, in order
+var causePatterns = []struct {
+	cause    string
+	patterns []string
+}{
+	{CauseInvalidName, []string{"invalid reference format", "invalidimagename", "couldn't parse image reference"}},
+	{CauseRateLimited, []string{"toomanyrequests", "rate limit", "429 too many requests"}},
+	{CausePlatform, []string{"no matching manifest for", "does not match the specified platform"}},
+	{CauseUnauthorized, []string{"unauthorized", "authentication required", "access denied", "denied:", "403 forbidden", "insufficient_scope", "no basic auth credentials"}},
+	{CauseNotFound, []string{"not found", "manifest unknown", "repository does not exist", "name unknown", "404"}},
+	{CauseDNS, []string{"no such host", "server misbehaving", "temporary failure in name resolution"}},
+	{CauseTLS, []string{"x509:", "certificate", "tls: "}},
+	{CauseTimeout, []string{"i/o timeout", "deadline exceeded", "tls handshake timeout", "timed out"}},
+	{CauseConnectionRefused, []string{"connection refused", "no route to host", "network is unreachable", "connection reset"}},
+}
+
+// classify returns the cause of a pull error message
+func classify(message string) string {
+	lower := strings.ToLower(message)
+	for _, c := range causePatterns {
+		for _, pattern := range c.patterns {
+			if strings.Contains(lower, pattern) {
+				return c.cause
+			}
+		}
+	}
+	return CauseUnknown
+}
+
+// suggestions are the fixes of each cause
+var suggestions = map[string]string{
+	CauseNotFound:          "Check the image name and tag exist in the registry, e.g. a typo or a tag that was never pushed or was deleted.",
+	CauseUnauthorized:      "Add an imagePullSecret with credentials for the registry to the pod or its service account, or refresh expired credentials.",
+	CauseDNS:               "The registry host doesn't resolve. Check the registry name and the DNS configuration of the nodes.",
+	CauseTimeout:           "The registry can't be reached in time. Check egress firewall rules, proxies and NAT of the nodes.",
+	CauseConnectionRefused: "The registry refuses connections or has no route. Check the registry port, egress rules and that the registry is up.",
+	CauseTLS:               "The registry certificate isn't trusted by the nodes. Install the CA on the nodes or configure the runtime for the registry.",
+	CauseRateLimited:       "The registry rate limits pulls. Authenticate pulls with an imagePullSecret, or mirror the image to a private registry.",
+	CauseInvalidName:       "The image reference is malformed. Fix the image field, repositories must be lowercase and tags can't be empty.",
+	CausePlatform:          "The image has no variant for the node architecture. Build a multi-arch image or schedule on matching nodes.",
+	CauseUnknown:           "Inspect the pod events for the full pull error.",
+}
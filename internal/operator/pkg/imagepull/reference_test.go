@@ -0,0 +1,111 @@
+package imagepull
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		image  string
+		want   Reference
+		wantOK bool
+	}{
+		{image: "nginx", want: Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}, wantOK: true},
+		{image: "bitnami/redis:7.2", want: Reference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2"}, wantOK: true},
+		{image: "ghcr.io/acme/api:v1.4.0", want: Reference{Registry: "ghcr.io", Repository: "acme/api", Tag: "v1.4.0"}, wantOK: true},
+		{image: "registry.local:5000/team/app", want: Reference{Registry: "registry.local:5000", Repository: "team/app", Tag: "latest"}, wantOK: true},
+		{image: "localhost/app:dev", want: Reference{Registry: "localhost", Repository: "app", Tag: "dev"}, wantOK: true},
+		{image: "quay.io/org/app@sha256:abc", want: Reference{Registry: "quay.io", Repository: "org/app", Digest: "sha256:abc"}, wantOK: true},
+		{image: "Acme/App:1"},
+		{image: "nginx:"},
+		{image: "nginx @sha256:abc"},
+		{image: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.image, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseReference(tt.image)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseReference(%q) = %+v, %v, want %+v, %v", tt.image, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{`Failed to pull image "acme/api:v2": rpc error: code = NotFound desc = failed to resolve reference "docker.io/acme/api:v2": docker.io/acme/api:v2: not found`, CauseNotFound},
+		{`failed to authorize: failed to fetch anonymous token: unexpected status: 401 Unauthorized`, CauseUnauthorized},
+		{`dial tcp: lookup registry.internal on 10.96.0.10:53: no such host`, CauseDNS},
+		{`dial tcp 10.0.0.5:443: i/o timeout`, CauseTimeout},
+		{`dial tcp 10.0.0.5:443: connect: connection refused`, CauseConnectionRefused},
+		{`x509: certificate signed by unknown authority`, CauseTLS},
+		{`toomanyrequests: You have reached your pull rate limit`, CauseRateLimited},
+		{`no matching manifest for linux/arm64 in the manifest list entries`, CausePlatform},
+		{`InvalidImageName`, CauseInvalidName},
+		{`Back-off pulling image "nginx"`, CauseUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := classify(tt.message); got != tt.want {
+			t.Errorf("classify(%q) = %s, want %s", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesRegistry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key      string
+		registry string
+		want     bool
+	}{
+		{"https://index.docker.io/v1/", "docker.io", true},
+		{"docker.io", "docker.io", true},
+		{"ghcr.io", "docker.io", false},
+		{"https://GHCR.io/v1/", "ghcr.io", true},
+		{"registry.local:5000", "registry.local:5000", true},
+		{"registry.local", "registry.local:5000", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesRegistry(tt.key, tt.registry); got != tt.want {
+			t.Errorf("matchesRegistry(%q, %q) = %v, want %v", tt.key, tt.registry, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status       int
+		challenge    string
+		reachable    bool
+		authRequired bool
+	}{
+		{200, "", true, false},
+		{401, `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`, true, false},
+		{401, `Basic realm="Registry"`, true, true},
+		{404, "", true, false},
+		{503, "", false, false},
+	}
+
+	for _, tt := range tests {
+		reachable, authRequired := registryStatus(tt.status, tt.challenge)
+		if reachable != tt.reachable || authRequired != tt.authRequired {
+			t.Errorf("registryStatus(%d, %q) = %v, %v, want %v, %v", tt.status, tt.challenge, reachable, authRequired, tt.reachable, tt.authRequired)
+		}
+	}
+}
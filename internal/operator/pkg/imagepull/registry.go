@@ -0,0 +1,70 @@
+package imagepull
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// sourceOperator is the source of the checks run from the operator
+	sourceOperator = "operator"
+
+	checkTimeout = 10 * time.Second
+)
+
+// checkFromOperator resolves the registry host and calls the root of its API from the operator
+func checkFromOperator(ctx context.Context, host string) RegistryCheck {
+	check := RegistryCheck{Host: host, Source: sourceOperator, Completed: true}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	addresses, err := net.DefaultResolver.LookupHost(ctx, hostname)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Resolved = true
+	check.Addresses = addresses
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/v2/", nil)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	start := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer response.Body.Close()
+
+	check.HTTPStatus = response.StatusCode
+	check.Reachable, check.AuthRequired = registryStatus(response.StatusCode, response.Header.Get("WWW-Authenticate"))
+	return check
+}
+
+// registryStatus interprets the status of the registry API root: 200 when it serves anonymous
+// requests, 401 with a basic challenge when it requires credentials. Bearer challenges are answered
+// by token services that also serve anonymous pulls of public images.
+func registryStatus(status int, challenge string) (reachable, authRequired bool) {
+	switch {
+	case status == http.StatusOK:
+		return true, false
+	case status == http.StatusUnauthorized:
+		return true, challenge == "" || !strings.HasPrefix(strings.ToLower(challenge), "bearer")
+	case status < http.StatusInternalServerError:
+		// A server answered, e.g. a mirror without the v2 API root
+		return true, false
+	}
+	return false, false
+}
@@ -0,0 +1,312 @@
+package incident
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+)
+
+// waitingReasons are the container waiting reasons that open an incident
+var waitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// signal is a watcher event reduced to what correlation needs
+type signal struct {
+	Cluster   string
+	Namespace string
+	Kind      string
+	Name      string
+	Reason    string
+	Message   string
+	Severity  string
+	// Node is the node the resource runs on, linking it to an incident of that node
+	Node string
+	// Workload is "Kind/name" of the workload owning the resource, empty when it has none
+	Workload string
+	// Opens is set for signals that open an incident on their own. The others only join one,
+	// e.g. pod deletions are routine unless their node is failing.
+	Opens bool
+}
+
+// podInfo is what is remembered of a pod to correlate its events
+type podInfo struct {
+	Node     string
+	Workload string
+}
+
+// signalFromEvent extracts the signal of a watcher event and keeps the pod cache current
+func (m *Manager) signalFromEvent(e event.Event) (signal, bool) {
+	base := signal{Cluster: e.Host, Severity: SeverityWarning, Opens: true}
+
+	switch obj := e.Obj.(type) {
+	case *corev1.Event:
+		if obj.Type != corev1.EventTypeWarning && obj.Reason != "NodeNotReady" {
+			return signal{}, false
+		}
+		base.Namespace, base.Kind, base.Name = obj.InvolvedObject.Namespace, obj.InvolvedObject.Kind, obj.InvolvedObject.Name
+		base.Reason, base.Message = obj.Reason, obj.Message
+		return m.describe(base, obj.Source.Host), true
+	case *eventsv1.Event:
+		if obj.Type != corev1.EventTypeWarning && obj.Reason != "NodeNotReady" {
+			return signal{}, false
+		}
+		base.Namespace, base.Kind, base.Name = obj.Regarding.Namespace, obj.Regarding.Kind, obj.Regarding.Name
+		base.Reason, base.Message = obj.Reason, obj.Note
+		return m.describe(base, obj.DeprecatedSource.Host), true
+	case *corev1.Pod:
+		key := podKey(e.Host, obj.Namespace, obj.Name)
+		info := podInfo{Node: obj.Spec.NodeName, Workload: workloadOf(obj)}
+		base.Namespace, base.Kind, base.Name = obj.Namespace, "Pod", obj.Name
+		base.Node, base.Workload = info.Node, info.Workload
+
+		if e.Reason == "Deleted" {
+			delete(m.pods, key)
+			base.Reason, base.Message, base.Opens = "Deleted", "Pod was deleted", false
+			return base, true
+		}
+		m.rememberPod(key, info)
+
+		old, _ := e.OldObj.(*corev1.Pod)
+		if reason, message, ok := containerFailure(obj, old); ok {
+			base.Reason, base.Message = reason, message
+			if reason == "OOMKilled" {
+				base.Severity = SeverityCritical
+			}
+			return base, true
+		}
+		return signal{}, false
+	case *corev1.Node:
+		old, _ := e.OldObj.(*corev1.Node)
+		if old == nil || e.Reason == "Deleted" {
+			return signal{}, false
+		}
+		wasReady, ready := nodeReady(old), nodeReady(obj)
+		if wasReady == ready {
+			return signal{}, false
+		}
+		base.Kind, base.Name, base.Node = "Node", obj.Name, obj.Name
+		if ready {
+			base.Reason, base.Message, base.Severity, base.Opens = "NodeReady", "Node is Ready again", SeverityInfo, false
+		} else {
+			base.Reason, base.Message, base.Severity = "NodeNotReady", "Node is not Ready", SeverityCritical
+		}
+		return base, true
+	}
+	return signal{}, false
+}
+
+// describe completes the signal of a Kubernetes event from the involved object
+func (m *Manager) describe(s signal, sourceHost string) signal {
+	switch s.Kind {
+	case "Node":
+		s.Node = s.Name
+		if s.Reason == "NodeNotReady" {
+			s.Severity = SeverityCritical
+		}
+	case "Pod":
+		if info, ok := m.pods[podKey(s.Cluster, s.Namespace, s.Name)]; ok {
+			s.Node, s.Workload = info.Node, info.Workload
+		} else {
+			s.Node = sourceHost
+		}
+		if s.Reason == "OOMKilling" || s.Reason == "Evicted" {
+			s.Severity = SeverityCritical
+		}
+	}
+	return s
+}
+
+// rememberPod caches where a pod runs and what owns it, forgetting everything once the cache is full
+func (m *Manager) rememberPod(key string, info podInfo) {
+	if _, ok := m.pods[key]; !ok && len(m.pods) >= maxTrackedPods {
+		m.pods = map[string]podInfo{}
+	}
+	m.pods[key] = info
+}
+
+func podKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+// workloadOf returns the workload owning a pod, resolving ReplicaSets to their Deployment
+func workloadOf(pod *corev1.Pod) string {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		if hash := pod.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+		return owner.Kind + "/" + owner.Name
+	}
+	return ""
+}
+
+// containerFailure reports a container that started failing since the previous version of the pod.
+// Init containers are checked first, a failing one keeps the pod from ever starting.
+func containerFailure(pod, old *corev1.Pod) (string, string, bool) {
+	previous := map[string]corev1.ContainerStatus{}
+	if old != nil {
+		for _, status := range append(append([]corev1.ContainerStatus{}, old.Status.InitContainerStatuses...), old.Status.ContainerStatuses...) {
+			previous[status.Name] = status
+		}
+	}
+
+	for _, group := range []struct {
+		label    string
+		statuses []corev1.ContainerStatus
+	}{
+		{"init container", pod.Status.InitContainerStatuses},
+		{"container", pod.Status.ContainerStatuses},
+	} {
+		for _, status := range group.statuses {
+			before, known := previous[status.Name]
+			if waiting := status.State.Waiting; waiting != nil && waitingReasons[waiting.Reason] {
+				if known && before.State.Waiting != nil && before.State.Waiting.Reason == waiting.Reason {
+					continue
+				}
+				return waiting.Reason, fmt.Sprintf("%s %s: %s", group.label, status.Name, waiting.Message), true
+			}
+			if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+				if known && before.RestartCount == status.RestartCount {
+					continue
+				}
+				return "OOMKilled", fmt.Sprintf("%s %s was killed for exceeding its memory limit", group.label, status.Name), true
+			}
+			// Init containers of pods that don't restart fail once and leave the pod stuck in Init:Error
+			if terminated := status.State.Terminated; group.label == "init container" && terminated != nil && terminated.ExitCode != 0 {
+				if known && before.State.Terminated != nil {
+					continue
+				}
+				return "InitContainerFailed", fmt.Sprintf("init container %s exited with code %d: %s", status.Name, terminated.ExitCode, terminated.Reason), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// correlate adds a signal to the open incident it belongs to, or opens one. Signals join an open
+// incident of their node first, then of their workload or resource, within the correlation window.
+// It returns the incident and whether it was opened, nil when the signal was dropped.
+// The caller must hold the mutex.
+func (m *Manager) correlate(s signal, now time.Time) (*Incident, bool) {
+	resourceKey := s.Cluster + "/" + s.Namespace + "/" + s.Kind + "/" + s.Name
+	if s.Workload != "" {
+		resourceKey = s.Cluster + "/" + s.Namespace + "/" + s.Workload
+	}
+	nodeKey := ""
+	if s.Node != "" {
+		nodeKey = s.Cluster + "//Node/" + s.Node
+	}
+	if s.Kind == "Node" {
+		resourceKey = nodeKey
+	}
+
+	for _, key := range []string{nodeKey, resourceKey} {
+		if key == "" {
+			continue
+		}
+		if incident := m.openIncident(key, now); incident != nil {
+			incident.add(s, now)
+			return incident, false
+		}
+	}
+	if !s.Opens {
+		return nil, false
+	}
+
+	subject := s.Kind + "/" + s.Name
+	if s.Workload != "" {
+		subject = s.Workload
+	}
+	if s.Namespace != "" {
+		subject = s.Namespace + "/" + subject
+	}
+	incident := &Incident{
+		ID:        uuid.New().String(),
+		Key:       resourceKey,
+		Title:     fmt.Sprintf("%s: %s", subject, s.Reason),
+		Cluster:   s.Cluster,
+		State:     StateOpen,
+		Severity:  s.Severity,
+		Events:    []EventRef{},
+		Resources: []string{},
+		OpenedAt:  now,
+	}
+	incident.add(s, now)
+	m.incidents = append(m.incidents, incident)
+	return incident, true
+}
+
+// openIncident returns the unresolved incident of a key that saw an event within the window
+func (m *Manager) openIncident(key string, now time.Time) *Incident {
+	for i := len(m.incidents) - 1; i >= 0; i-- {
+		incident := m.incidents[i]
+		if incident.Key == key && incident.State != StateResolved && now.Sub(incident.LastSeen) <= correlationWindow {
+			return incident
+		}
+	}
+	return nil
+}
+
+// add records a signal in the incident, repeated signals of a resource only count up
+func (i *Incident) add(s signal, now time.Time) {
+	i.LastSeen = now
+	i.EventCount++
+	if severityRank[s.Severity] > severityRank[i.Severity] {
+		i.Severity = s.Severity
+	}
+
+	resource := strings.TrimPrefix(s.Namespace+"/"+s.Kind+"/"+s.Name, "/")
+	found := false
+	for _, existing := range i.Resources {
+		if existing == resource {
+			found = true
+			break
+		}
+	}
+	if !found && len(i.Resources) < maxResources {
+		i.Resources = append(i.Resources, resource)
+	}
+
+	for index := range i.Events {
+		ref := &i.Events[index]
+		if ref.Kind == s.Kind && ref.Namespace == s.Namespace && ref.Name == s.Name && ref.Reason == s.Reason {
+			ref.Count++
+			ref.LastSeen = now
+			ref.Message = s.Message
+			return
+		}
+	}
+	if len(i.Events) < maxEvents {
+		i.Events = append(i.Events, EventRef{
+			Kind:      s.Kind,
+			Namespace: s.Namespace,
+			Name:      s.Name,
+			Reason:    s.Reason,
+			Message:   s.Message,
+			Count:     1,
+			FirstSeen: now,
+			LastSeen:  now,
+		})
+	}
+}
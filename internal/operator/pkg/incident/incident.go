@@ -0,0 +1,393 @@
+package incident
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	incidentsFileName = "incidents.json"
+
+	// correlationWindow is how long after its last event an incident still collects new events
+	correlationWindow = 15 * time.Minute
+	// autoResolveAfter resolves incidents that saw no event for this long
+	autoResolveAfter    = 24 * time.Hour
+	maintenanceInterval = 10 * time.Minute
+
+	// eventQueueSize bounds the watcher events waiting to be correlated
+	eventQueueSize = 1024
+	maxIncidents   = 1000
+	maxEvents      = 100
+	maxResources   = 200
+	maxTrackedPods = 50000
+)
+
+// Incident states
+const (
+	StateOpen         = "open"
+	StateAcknowledged = "acknowledged"
+	StateResolved     = "resolved"
+)
+
+// Incident severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// Incident groups correlated events of a workload, resource or node
+type Incident struct {
+	ID string `json:"id"`
+	// Key identifies what the incident is about, events with the same key are grouped
+	Key            string     `json:"key"`
+	Title          string     `json:"title"`
+	Cluster        string     `json:"cluster"`
+	State          string     `json:"state"`
+	Severity       string     `json:"severity"`
+	Assignee       string     `json:"assignee,omitempty"`
+	Resources      []string   `json:"resources"`
+	Events         []EventRef `json:"events"`
+	EventCount     int        `json:"eventCount"`
+	OpenedAt       time.Time  `json:"openedAt"`
+	LastSeen       time.Time  `json:"lastSeen"`
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	ResolvedBy     string     `json:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// EventRef is an event of an incident, repeats of the same event are counted
+type EventRef struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message,omitempty"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Filter selects incidents, empty fields match everything
+type Filter struct {
+	Cluster  string
+	State    string
+	Assignee string
+}
+
+// Manager groups watcher events into incidents and tracks their state
+type Manager struct {
+	filePath  string
+	mutex     sync.Mutex
+	incidents []*Incident
+	loaded    bool
+	dirty     bool
+	// events buffers watcher events for the correlation worker
+	events chan event.Event
+	// pods is only accessed by the correlation worker
+	pods map[string]podInfo
+
+	notifier     dispatchers.Dispatcher
+	notifierOnce sync.Once
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared incident manager, starting its correlation worker
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = &Manager{
+			filePath: filepath.Join(utils.ConfigDir(), incidentsFileName),
+			events:   make(chan event.Event, eventQueueSize),
+			pods:     map[string]podInfo{},
+		}
+		go globalManager.run()
+	})
+	return globalManager
+}
+
+// HandleEvent queues a watcher event for correlation. It never blocks the watcher, events are
+// dropped while the queue is full.
+func (m *Manager) HandleEvent(e event.Event) {
+	select {
+	case m.events <- e:
+	default:
+		logger.Log(logger.LevelWarn, map[string]string{
+			"cluster": e.Host,
+			"kind":    e.Kind,
+			"name":    e.Name,
+		}, nil, "Incident event queue is full, dropping watcher event")
+	}
+}
+
+// run correlates queued events and resolves quiet incidents. Incidents are written once the queue drains.
+func (m *Manager) run() {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-m.events:
+			m.correlateEvent(e)
+			if len(m.events) == 0 {
+				m.flush()
+			}
+		case <-ticker.C:
+			m.resolveQuiet(time.Now())
+			m.flush()
+		}
+	}
+}
+
+// correlateEvent groups an event into an incident and notifies about opened incidents
+func (m *Manager) correlateEvent(e event.Event) {
+	s, ok := m.signalFromEvent(e)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	if err := m.load(); err != nil {
+		m.mutex.Unlock()
+		logger.Log(logger.LevelError, nil, err, "Failed to load incidents")
+		return
+	}
+	incident, opened := m.correlate(s, time.Now())
+	var snapshot Incident
+	if incident != nil {
+		m.dirty = true
+		snapshot = incident.clone()
+	}
+	m.mutex.Unlock()
+
+	if opened {
+		m.notify(&snapshot, "opened")
+	}
+}
+
+// List returns the incidents matching the filter, most recent first
+func (m *Manager) List(filter Filter) ([]Incident, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	list := []Incident{}
+	for _, incident := range m.incidents {
+		if (filter.Cluster == "" || incident.Cluster == filter.Cluster) &&
+			(filter.State == "" || incident.State == filter.State) &&
+			(filter.Assignee == "" || incident.Assignee == filter.Assignee) {
+			list = append(list, incident.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list, nil
+}
+
+// Get returns a single incident
+func (m *Manager) Get(id string) (*Incident, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	incident, err := m.find(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := incident.clone()
+	return &copied, nil
+}
+
+// Acknowledge marks an open incident as being worked on
+func (m *Manager) Acknowledge(id, user string) (*Incident, error) {
+	return m.update(id, "acknowledged", func(incident *Incident, now time.Time) error {
+		if incident.State != StateOpen {
+			return fmt.Errorf("incident %s is %s", id, incident.State)
+		}
+		incident.State = StateAcknowledged
+		incident.AcknowledgedBy = user
+		incident.AcknowledgedAt = &now
+		return nil
+	})
+}
+
+// Resolve closes an incident, later events open a new one
+func (m *Manager) Resolve(id, user string) (*Incident, error) {
+	return m.update(id, "resolved", func(incident *Incident, now time.Time) error {
+		if incident.State == StateResolved {
+			return fmt.Errorf("incident %s is already resolved", id)
+		}
+		incident.State = StateResolved
+		incident.ResolvedBy = user
+		incident.ResolvedAt = &now
+		return nil
+	})
+}
+
+// Assign sets the assignee of an incident, an empty assignee unassigns it
+func (m *Manager) Assign(id, assignee string) (*Incident, error) {
+	change := "assigned to " + assignee
+	if assignee == "" {
+		change = "unassigned"
+	}
+	return m.update(id, change, func(incident *Incident, now time.Time) error {
+		incident.Assignee = assignee
+		return nil
+	})
+}
+
+// clone copies an incident so it can be used without holding the mutex
+func (i *Incident) clone() Incident {
+	copied := *i
+	copied.Resources = append([]string{}, i.Resources...)
+	copied.Events = append([]EventRef{}, i.Events...)
+	return copied
+}
+
+// update changes an incident, saves it and notifies about the change
+func (m *Manager) update(id, change string, fn func(incident *Incident, now time.Time) error) (*Incident, error) {
+	m.mutex.Lock()
+	incident, err := m.find(id)
+	if err == nil {
+		err = fn(incident, time.Now())
+	}
+	if err == nil {
+		err = m.save()
+	}
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+	copied := incident.clone()
+	m.mutex.Unlock()
+
+	m.notify(&copied, change)
+	return &copied, nil
+}
+
+// resolveQuiet resolves incidents that saw no event for autoResolveAfter
+func (m *Manager) resolveQuiet(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.load(); err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load incidents")
+		return
+	}
+	for _, incident := range m.incidents {
+		if incident.State != StateResolved && now.Sub(incident.LastSeen) > autoResolveAfter {
+			resolvedAt := now
+			incident.State = StateResolved
+			incident.ResolvedBy = "system"
+			incident.ResolvedAt = &resolvedAt
+			m.dirty = true
+		}
+	}
+}
+
+// flush writes pending incident changes
+func (m *Manager) flush() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.dirty {
+		return
+	}
+	if err := m.save(); err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to save incidents")
+	}
+}
+
+func (m *Manager) notify(incident *Incident, change string) {
+	m.notifierOnce.Do(func() {
+		m.notifier = client.NewNotifier("incidents")
+	})
+
+	status := "Warning"
+	switch {
+	case incident.State == StateResolved:
+		status = "Normal"
+	case incident.Severity == SeverityCritical:
+		status = "Danger"
+	}
+	e := event.Event{
+		Kind:   "incident",
+		Host:   incident.Cluster,
+		Name:   incident.Title,
+		Reason: change,
+		Status: status,
+	}
+	go m.notifier.Handle(e)
+}
+
+// find returns an incident by ID, the caller must hold the mutex
+func (m *Manager) find(id string) (*Incident, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	for _, incident := range m.incidents {
+		if incident.ID == id {
+			return incident, nil
+		}
+	}
+	return nil, fmt.Errorf("incident %s not found", id)
+}
+
+// load reads the incidents once, the caller must hold the mutex
+func (m *Manager) load() error {
+	if m.loaded {
+		return nil
+	}
+	var incidents []*Incident
+	if err := utils.ReadJSONFile(m.filePath, &incidents); err != nil {
+		return err
+	}
+	m.incidents = incidents
+	m.loaded = true
+	return nil
+}
+
+// save trims and writes the incidents, the caller must hold the mutex
+func (m *Manager) save() error {
+	m.trim()
+	if err := utils.WriteJSONFile(m.filePath, m.incidents); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+// trim drops the oldest resolved incidents, then the oldest ones, beyond maxIncidents
+func (m *Manager) trim() {
+	excess := len(m.incidents) - maxIncidents
+	if excess <= 0 {
+		return
+	}
+	kept := make([]*Incident, 0, maxIncidents)
+	for _, incident := range m.incidents {
+		if excess > 0 && incident.State == StateResolved {
+			excess--
+			continue
+		}
+		kept = append(kept, incident)
+	}
+	if len(kept) > maxIncidents {
+		kept = kept[len(kept)-maxIncidents:]
+	}
+	m.incidents = kept
+}
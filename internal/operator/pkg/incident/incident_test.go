@@ -0,0 +1,155 @@
+package incident
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/dispatchers"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+
+	m := &Manager{
+		filePath: filepath.Join(t.TempDir(), incidentsFileName),
+		pods:     map[string]podInfo{},
+		loaded:   true,
+	}
+	m.notifierOnce.Do(func() { m.notifier = &dispatchers.Default{} })
+	return m
+}
+
+func TestCorrelate(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	now := time.Now()
+
+	crash := signal{Cluster: "prod", Namespace: "shop", Kind: "Pod", Name: "web-6d4cf56db6-abcde", Workload: "Deployment/web",
+		Reason: "CrashLoopBackOff", Severity: SeverityWarning, Node: "node-1", Opens: true}
+	incident, opened := m.correlate(crash, now)
+	if !opened || incident == nil || incident.Key != "prod/shop/Deployment/web" {
+		t.Fatalf("correlate() = %+v, %v, want a new incident of the deployment", incident, opened)
+	}
+
+	// Another pod of the same workload joins the incident
+	sibling := crash
+	sibling.Name = "web-6d4cf56db6-fghij"
+	if joined, opened := m.correlate(sibling, now.Add(time.Minute)); opened || joined != incident {
+		t.Errorf("correlate() of a sibling pod opened %v, want it to join the incident", opened)
+	}
+	// Repeats of an event are counted instead of listed again
+	if _, opened := m.correlate(sibling, now.Add(2*time.Minute)); opened {
+		t.Error("correlate() of a repeated event opened a new incident")
+	}
+	if len(incident.Events) != 2 || incident.EventCount != 3 || incident.Events[1].Count != 2 {
+		t.Errorf("incident events = %+v (%d), want 2 entries of 3 events", incident.Events, incident.EventCount)
+	}
+
+	// Outside of the correlation window a new incident is opened
+	if _, opened := m.correlate(crash, now.Add(2*time.Minute+correlationWindow+time.Second)); !opened {
+		t.Error("correlate() after the correlation window should open a new incident")
+	}
+
+	// Routine signals do not open incidents
+	deleted := signal{Cluster: "prod", Namespace: "shop", Kind: "Pod", Name: "api-1", Reason: "Deleted", Node: "node-2"}
+	if dropped, _ := m.correlate(deleted, now); dropped != nil {
+		t.Errorf("correlate() of a routine pod deletion = %+v, want it dropped", dropped)
+	}
+}
+
+func TestCorrelateNodeCausalChain(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	now := time.Now()
+
+	notReady := signal{Cluster: "prod", Kind: "Node", Name: "node-2", Node: "node-2", Reason: "NodeNotReady", Severity: SeverityCritical, Opens: true}
+	nodeIncident, opened := m.correlate(notReady, now)
+	if !opened {
+		t.Fatal("correlate() of a NotReady node should open an incident")
+	}
+
+	// Pods deleted and failing on the node join the node incident instead of opening their own
+	deleted := signal{Cluster: "prod", Namespace: "shop", Kind: "Pod", Name: "api-1", Workload: "Deployment/api", Reason: "Deleted", Node: "node-2"}
+	failing := signal{Cluster: "prod", Namespace: "shop", Kind: "Pod", Name: "db-0", Workload: "StatefulSet/db", Reason: "FailedMount",
+		Severity: SeverityWarning, Node: "node-2", Opens: true}
+	for _, s := range []signal{deleted, failing} {
+		if incident, opened := m.correlate(s, now.Add(time.Minute)); opened || incident != nodeIncident {
+			t.Errorf("correlate(%s) opened %v, want it to join the node incident", s.Name, opened)
+		}
+	}
+	if len(nodeIncident.Resources) != 3 || len(m.incidents) != 1 {
+		t.Errorf("node incident resources = %v with %d incidents, want 3 resources in 1 incident", nodeIncident.Resources, len(m.incidents))
+	}
+
+	// A pod on another node is unrelated
+	elsewhere := failing
+	elsewhere.Node = "node-3"
+	if _, opened := m.correlate(elsewhere, now.Add(time.Minute)); !opened {
+		t.Error("correlate() of a pod on a healthy node should open its own incident")
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	incident, _ := m.correlate(signal{Cluster: "prod", Kind: "Node", Name: "node-1", Node: "node-1", Reason: "NodeNotReady",
+		Severity: SeverityCritical, Opens: true}, time.Now())
+
+	if _, err := m.Resolve("missing", "token:a"); err == nil {
+		t.Error("Resolve() of an unknown incident should fail")
+	}
+	acknowledged, err := m.Acknowledge(incident.ID, "token:a")
+	if err != nil || acknowledged.State != StateAcknowledged || acknowledged.AcknowledgedBy != "token:a" {
+		t.Fatalf("Acknowledge() = %+v, %v", acknowledged, err)
+	}
+	if _, err := m.Acknowledge(incident.ID, "token:a"); err == nil {
+		t.Error("Acknowledge() of an acknowledged incident should fail")
+	}
+	if assigned, err := m.Assign(incident.ID, "alice"); err != nil || assigned.Assignee != "alice" {
+		t.Errorf("Assign() = %+v, %v", assigned, err)
+	}
+	if resolved, err := m.Resolve(incident.ID, "token:b"); err != nil || resolved.State != StateResolved {
+		t.Fatalf("Resolve() = %+v, %v", resolved, err)
+	}
+
+	// Resolved incidents no longer collect events
+	if _, opened := m.correlate(signal{Cluster: "prod", Kind: "Node", Name: "node-1", Node: "node-1", Reason: "NodeNotReady",
+		Severity: SeverityCritical, Opens: true}, time.Now()); !opened {
+		t.Error("correlate() after resolving should open a new incident")
+	}
+
+	m.resolveQuiet(time.Now().Add(autoResolveAfter + time.Minute))
+	open, err := m.List(Filter{State: StateOpen})
+	if err != nil || len(open) != 0 {
+		t.Errorf("List() of open incidents after resolveQuiet() = %d, %v, want none", len(open), err)
+	}
+}
+
+func TestContainerFailureOfInitContainers(t *testing.T) {
+	t.Parallel()
+
+	pod := func(init corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{Name: "migrate", State: init}},
+			ContainerStatuses:     []corev1.ContainerStatus{{Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}}},
+		}}
+	}
+	crashing := pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off"}})
+	failed := pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}})
+	running := pod(corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+
+	if reason, message, ok := containerFailure(crashing, running); !ok || reason != "CrashLoopBackOff" || message != "init container migrate: back-off" {
+		t.Errorf("containerFailure() of a crash looping init container = %q, %q, %v", reason, message, ok)
+	}
+	if reason, _, ok := containerFailure(failed, running); !ok || reason != "InitContainerFailed" {
+		t.Errorf("containerFailure() of a failed init container = %q, %v, want InitContainerFailed", reason, ok)
+	}
+	if _, _, ok := containerFailure(failed, failed); ok {
+		t.Error("containerFailure() reported an init container that already failed")
+	}
+}
@@ -0,0 +1,225 @@
+package index
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Ref identifies an indexed object
+type Ref struct {
+	Group     string    `json:"group"`
+	Version   string    `json:"version"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+}
+
+// GroupVersionResource returns the resource of the object
+func (r Ref) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// Index maps the UIDs of owners to the objects naming them in their owner references, so that the
+// children of an object are found without listing every resource type that may hold them
+type Index struct {
+	mutex sync.RWMutex
+	// children holds the objects owned by each owner, by their UID
+	children map[types.UID]map[types.UID]Ref
+	// owners holds the owners of each object, to unlink it when its references change
+	owners map[types.UID][]types.UID
+	// sources report whether the informers feeding the index have synced
+	sources []func() bool
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{
+		children: map[types.UID]map[types.UID]Ref{},
+		owners:   map[types.UID][]types.UID{},
+	}
+}
+
+// Set indexes an object under its owners, replacing the owners it was indexed under before
+func (i *Index) Set(ref Ref, owners []types.UID) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.unlink(ref.UID)
+	if len(owners) == 0 {
+		return
+	}
+	for _, owner := range owners {
+		if i.children[owner] == nil {
+			i.children[owner] = map[types.UID]Ref{}
+		}
+		i.children[owner][ref.UID] = ref
+	}
+	i.owners[ref.UID] = owners
+}
+
+// Delete removes an object from the index. Its own children stay indexed until they are deleted,
+// as the garbage collector removes them after their owner.
+func (i *Index) Delete(uid types.UID) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.unlink(uid)
+}
+
+// unlink removes an object from the children of its owners, the caller must hold the mutex
+func (i *Index) unlink(uid types.UID) {
+	for _, owner := range i.owners[uid] {
+		delete(i.children[owner], uid)
+		if len(i.children[owner]) == 0 {
+			delete(i.children, owner)
+		}
+	}
+	delete(i.owners, uid)
+}
+
+// Children returns the objects an owner owns directly, sorted by resource, namespace and name
+func (i *Index) Children(owner types.UID) []Ref {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	refs := make([]Ref, 0, len(i.children[owner]))
+	for _, ref := range i.children[owner] {
+		refs = append(refs, ref)
+	}
+	sortRefs(refs)
+	return refs
+}
+
+// Descendants returns the objects an owner owns directly or through other objects, e.g. the pods of a
+// deployment through its replica sets, sorted by resource, namespace and name
+func (i *Index) Descendants(owner types.UID) []Ref {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	refs := []Ref{}
+	seen := map[types.UID]bool{owner: true}
+	queue := []types.UID{owner}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for uid, ref := range i.children[current] {
+			// Owner references may form cycles, each object is visited once
+			if seen[uid] {
+				continue
+			}
+			seen[uid] = true
+			refs = append(refs, ref)
+			queue = append(queue, uid)
+		}
+	}
+	sortRefs(refs)
+	return refs
+}
+
+// Len returns how many objects with owners are indexed
+func (i *Index) Len() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return len(i.owners)
+}
+
+// Synced reports whether every informer feeding the index has synced
+func (i *Index) Synced() bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for _, synced := range i.sources {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Track feeds the index from the events of an informer of a resource
+func (i *Index) Track(gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	i.mutex.Lock()
+	i.sources = append(i.sources, informer.HasSynced)
+	i.mutex.Unlock()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { i.setObject(gvr, obj) },
+		UpdateFunc: func(_, obj interface{}) { i.setObject(gvr, obj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if accessor, err := meta.Accessor(obj); err == nil {
+				i.Delete(accessor.GetUID())
+			}
+		},
+	})
+}
+
+func (i *Index) setObject(gvr schema.GroupVersionResource, obj interface{}) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	owners := make([]types.UID, 0, len(accessor.GetOwnerReferences()))
+	for _, owner := range accessor.GetOwnerReferences() {
+		owners = append(owners, owner.UID)
+	}
+	i.Set(Ref{
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Namespace: accessor.GetNamespace(),
+		Name:      accessor.GetName(),
+		UID:       accessor.GetUID(),
+	}, owners)
+}
+
+func sortRefs(refs []Ref) {
+	sort.Slice(refs, func(a, b int) bool {
+		if refs[a].Resource != refs[b].Resource {
+			return refs[a].Resource < refs[b].Resource
+		}
+		if refs[a].Namespace != refs[b].Namespace {
+			return refs[a].Namespace < refs[b].Namespace
+		}
+		return refs[a].Name < refs[b].Name
+	})
+}
+
+var (
+	clusters      = map[string]*Index{}
+	clustersMutex sync.Mutex
+)
+
+// ForCluster returns the index of a cluster, creating it when the cluster has none
+func ForCluster(clusterName string) *Index {
+	clustersMutex.Lock()
+	defer clustersMutex.Unlock()
+
+	idx, ok := clusters[clusterName]
+	if !ok {
+		idx = New()
+		clusters[clusterName] = idx
+	}
+	return idx
+}
+
+// Lookup returns the index of a cluster, false when its watchers don't maintain one
+func Lookup(clusterName string) (*Index, bool) {
+	clustersMutex.Lock()
+	defer clustersMutex.Unlock()
+	idx, ok := clusters[clusterName]
+	return idx, ok
+}
+
+// Drop removes the index of a cluster once its watchers stop, as it no longer follows the cluster
+func Drop(clusterName string) {
+	clustersMutex.Lock()
+	defer clustersMutex.Unlock()
+	delete(clusters, clusterName)
+}
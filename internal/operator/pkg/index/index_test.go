@@ -0,0 +1,89 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func pod(name string) Ref {
+	return Ref{Version: "v1", Resource: "pods", Namespace: "shop", Name: name, UID: types.UID(name)}
+}
+
+func replicaSet(name string) Ref {
+	return Ref{Group: "apps", Version: "v1", Resource: "replicasets", Namespace: "shop", Name: name, UID: types.UID(name)}
+}
+
+func names(refs []Ref) []string {
+	result := []string{}
+	for _, ref := range refs {
+		result = append(result, ref.Name)
+	}
+	return result
+}
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+
+	idx := New()
+	idx.Set(replicaSet("web-1"), []types.UID{"web"})
+	idx.Set(replicaSet("web-2"), []types.UID{"web"})
+	idx.Set(pod("web-1-a"), []types.UID{"web-1"})
+	idx.Set(pod("web-2-a"), []types.UID{"web-2"})
+	idx.Set(pod("web-2-b"), []types.UID{"web-2"})
+	// Objects without owners aren't indexed
+	idx.Set(pod("standalone"), nil)
+
+	if got, want := names(idx.Children("web")), []string{"web-1", "web-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Children(web) = %v, want %v", got, want)
+	}
+	if got, want := names(idx.Descendants("web")), []string{"web-1-a", "web-2-a", "web-2-b", "web-1", "web-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Descendants(web) = %v, want %v", got, want)
+	}
+	if got := idx.Len(); got != 5 {
+		t.Errorf("Len() = %d, want 5", got)
+	}
+
+	// Adoption moves a pod to its new owner
+	idx.Set(pod("web-2-b"), []types.UID{"web-1"})
+	if got, want := names(idx.Children("web-1")), []string{"web-1-a", "web-2-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Children(web-1) after adoption = %v, want %v", got, want)
+	}
+	if got, want := names(idx.Children("web-2")), []string{"web-2-a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Children(web-2) after adoption = %v, want %v", got, want)
+	}
+
+	idx.Delete("web-2-a")
+	if got := idx.Children("web-2"); len(got) != 0 {
+		t.Errorf("Children(web-2) after delete = %v, want none", names(got))
+	}
+}
+
+func TestDescendantsCycle(t *testing.T) {
+	t.Parallel()
+
+	idx := New()
+	idx.Set(replicaSet("a"), []types.UID{"b"})
+	idx.Set(replicaSet("b"), []types.UID{"a"})
+
+	if got, want := names(idx.Descendants("a")), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Descendants(a) = %v, want %v", got, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := Lookup("registry-test"); ok {
+		t.Fatal("Lookup() found an index before ForCluster()")
+	}
+	idx := ForCluster("registry-test")
+	if got, ok := Lookup("registry-test"); !ok || got != idx {
+		t.Errorf("Lookup() = %p, %v, want %p, true", got, ok, idx)
+	}
+	Drop("registry-test")
+	if _, ok := Lookup("registry-test"); ok {
+		t.Error("Lookup() found an index after Drop()")
+	}
+}
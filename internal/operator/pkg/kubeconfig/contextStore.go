@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/agentkube/operator/pkg/cache"
@@ -18,19 +19,61 @@ type ContextStore interface {
 	RemoveContext(name string) error
 	AddContextWithKeyAndTTL(agentkubeContext *Context, key string, ttl time.Duration) error
 	UpdateTTL(key string, ttl time.Duration) error
+	Subscribe(listener func(ContextEvent))
+}
+
+// ContextEventType is how the contexts of a store changed.
+type ContextEventType string
+
+const (
+	// ContextAdded is sent when a context is added or replaced.
+	ContextAdded ContextEventType = "added"
+	// ContextRemoved is sent when a context is removed or its TTL expired.
+	ContextRemoved ContextEventType = "removed"
+)
+
+// ContextEvent is a change of the contexts of a store, Name is the key of the context.
+type ContextEvent struct {
+	Type    ContextEventType
+	Name    string
+	Context *Context
 }
 
 type contextStore struct {
-	cache cache.Cache[*Context]
+	cache          cache.Cache[*Context]
+	listeners      []func(ContextEvent)
+	listenersMutex sync.RWMutex
 }
 
 // NewContextStore creates a new ContextStore.
 func NewContextStore() ContextStore {
 	cache := cache.New[*Context]()
 
-	return &contextStore{
+	store := &contextStore{
 		cache: cache,
 	}
+	cache.OnExpire(func(key string, value *Context) {
+		store.notify(ContextEvent{Type: ContextRemoved, Name: key, Context: value})
+	})
+
+	return store
+}
+
+// Subscribe registers a function called after each change of the contexts.
+func (c *contextStore) Subscribe(listener func(ContextEvent)) {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *contextStore) notify(event ContextEvent) {
+	c.listenersMutex.RLock()
+	defer c.listenersMutex.RUnlock()
+
+	for _, listener := range c.listeners {
+		listener(event)
+	}
 }
 
 // AddContext adds a context to the store.
@@ -60,7 +103,13 @@ func (c *contextStore) AddContext(agentkubeContext *Context) error {
 		}
 	}
 
-	return c.cache.Set(context.Background(), name, agentkubeContext)
+	if err := c.cache.Set(context.Background(), name, agentkubeContext); err != nil {
+		return err
+	}
+
+	c.notify(ContextEvent{Type: ContextAdded, Name: name, Context: agentkubeContext})
+
+	return nil
 }
 
 // GetContexts returns all contexts in the store.
@@ -101,18 +150,30 @@ func (c *contextStore) RemoveContext(name string) error {
 	contextMap, _ := c.cache.GetAll(context.Background(), nil)
 	logger.Log(logger.LevelInfo, map[string]string{"cacheSizeBefore": fmt.Sprintf("%d", len(contextMap))}, nil, "RemoveContext: Cache size before deletion")
 	
+	removed, getErr := c.cache.Get(context.Background(), name)
+
 	err := c.cache.Delete(context.Background(), name)
 	
 	// Get cache size after deletion
 	contextMapAfter, _ := c.cache.GetAll(context.Background(), nil)
 	logger.Log(logger.LevelInfo, map[string]string{"cacheSizeAfter": fmt.Sprintf("%d", len(contextMapAfter))}, nil, "RemoveContext: Cache size after deletion")
+
+	if err == nil && getErr == nil {
+		c.notify(ContextEvent{Type: ContextRemoved, Name: name, Context: removed})
+	}
 	
 	return err
 }
 
 // AddContextWithKeyAndTTL adds a context to the store with a ttl.
 func (c *contextStore) AddContextWithKeyAndTTL(agentkubeContext *Context, key string, ttl time.Duration) error {
-	return c.cache.SetWithTTL(context.Background(), key, agentkubeContext, ttl)
+	if err := c.cache.SetWithTTL(context.Background(), key, agentkubeContext, ttl); err != nil {
+		return err
+	}
+
+	c.notify(ContextEvent{Type: ContextAdded, Name: key, Context: agentkubeContext})
+
+	return nil
 }
 
 // UpdateTTL updates the ttl of a context.
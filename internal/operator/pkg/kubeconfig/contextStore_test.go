@@ -0,0 +1,44 @@
+package kubeconfig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContextStoreSubscribe(t *testing.T) {
+	t.Parallel()
+
+	store := NewContextStore()
+	var events []ContextEvent
+	store.Subscribe(func(e ContextEvent) {
+		events = append(events, e)
+	})
+
+	if err := store.AddContext(&Context{Name: "prod"}); err != nil {
+		t.Fatalf("AddContext() error = %v", err)
+	}
+	if err := store.AddContextWithKeyAndTTL(&Context{Name: "preview"}, "ci-preview", time.Hour); err != nil {
+		t.Fatalf("AddContextWithKeyAndTTL() error = %v", err)
+	}
+	if err := store.RemoveContext("prod"); err != nil {
+		t.Fatalf("RemoveContext() error = %v", err)
+	}
+	// Removing a context that is not there changes nothing
+	if err := store.RemoveContext("prod"); err != nil {
+		t.Fatalf("RemoveContext() error = %v", err)
+	}
+
+	want := []ContextEvent{
+		{Type: ContextAdded, Name: "prod"},
+		{Type: ContextAdded, Name: "ci-preview"},
+		{Type: ContextRemoved, Name: "prod"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want %+v", events, want)
+	}
+	for i := range want {
+		if events[i].Type != want[i].Type || events[i].Name != want[i].Name || events[i].Context == nil {
+			t.Errorf("event %d = %+v, want %+v with its context", i, events[i], want[i])
+		}
+	}
+}
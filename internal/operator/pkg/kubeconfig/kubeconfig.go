@@ -10,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/agentkube/operator/pkg/logger"
 	"gopkg.in/yaml.v2"
@@ -19,6 +20,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	certutil "k8s.io/client-go/util/cert"
 )
 
 const InClusterContextName = "main"
@@ -27,6 +29,7 @@ const (
 	KubeConfig = 1 << iota
 	DynamicCluster
 	InCluster
+	Demo
 )
 
 // Context contains all information related to a kubernetes context.
@@ -172,19 +175,64 @@ func (c *Context) RESTConfig() (*rest.Config, error) {
 		return nil, errors.New("clientConfig is nil")
 	}
 
-	return clientConfig.ClientConfig()
+	restConf, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Contexts with a refresh hook get their credentials from it on every request
+	if err := GetRefreshHooks().wrap(c, restConf); err != nil {
+		return nil, err
+	}
+	c.wrapTransport(restConf)
+
+	return restConf, nil
+}
+
+// TransportHook wraps the transport of the REST configs and the proxy of a context, e.g. to record the
+// requests sent to its cluster
+type TransportHook func(contextName string, rt http.RoundTripper) http.RoundTripper
+
+var (
+	transportHookMutex sync.RWMutex
+	transportHooks     []TransportHook
+)
+
+// AddTransportHook adds a hook wrapping the transports of the REST configs built from now on, hooks
+// added later wrap the ones added before
+func AddTransportHook(hook TransportHook) {
+	transportHookMutex.Lock()
+	defer transportHookMutex.Unlock()
+	transportHooks = append(transportHooks, hook)
 }
 
-// ProxyRequest proxies the given request to the cluster.
+func (c *Context) wrapTransport(restConf *rest.Config) {
+	transportHookMutex.RLock()
+	hooks := append([]TransportHook{}, transportHooks...)
+	transportHookMutex.RUnlock()
+
+	name := c.Name
+	for _, hook := range hooks {
+		hook := hook
+		restConf.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return hook(name, rt)
+		})
+	}
+}
+
+// ProxyRequest proxies the given request to the cluster. The proxy is set up on the first request,
+// and again after ResetProxy.
 func (c *Context) ProxyRequest(writer http.ResponseWriter, request *http.Request) error {
-	if c.proxy == nil {
+	proxy := c.proxy
+	if proxy == nil {
 		err := c.SetupProxy()
 		if err != nil {
 			return err
 		}
+		proxy = c.proxy
 	}
 
-	c.proxy.ServeHTTP(writer, request)
+	proxy.ServeHTTP(writer, request)
 
 	return nil
 }
@@ -198,6 +246,9 @@ func (c *Context) ClientSetWithToken(token string) (*kubernetes.Clientset, error
 
 	if token != "" {
 		restConf.BearerToken = token
+		// An explicit token replaces the credentials of a refresh hook
+		restConf.WrapTransport = nil
+		c.wrapTransport(restConf)
 	}
 
 	return kubernetes.NewForConfig(restConf)
@@ -212,6 +263,8 @@ func (c *Context) SourceStr() string {
 		return "dynamic_cluster"
 	case InCluster:
 		return "incluster"
+	case Demo:
+		return "demo"
 	default:
 		return "unknown"
 	}
@@ -242,6 +295,18 @@ func (c *Context) SetupProxy() error {
 	return nil
 }
 
+// checkServer validates the server URL the proxy is built for, without building its transport
+func (c *Context) checkServer() error {
+	_, err := url.Parse(c.Cluster.Server)
+	return err
+}
+
+// ResetProxy drops the reverse proxy of the context, the next proxied request builds it again with
+// the current credentials settings.
+func (c *Context) ResetProxy() {
+	c.proxy = nil
+}
+
 // ContextLoadError represents an error associated with a specific context.
 type ContextLoadError struct {
 	ContextName string
@@ -724,7 +789,7 @@ func convertToContext(contextName string, clientConfig *api.Config, source int,
 	}
 
 	if !skipProxySetup {
-		err := newContext.SetupProxy()
+		err := newContext.checkServer()
 		if err != nil {
 			return Context{}, ContextError{ContextName: contextName, Reason: fmt.Sprintf("couldn't setup proxy: %v", err)}
 		}
@@ -759,7 +824,7 @@ func LoadContextsFromAPIConfig(config *api.Config, skipProxySetup bool) ([]Conte
 		}
 
 		if !skipProxySetup {
-			err := context.SetupProxy()
+			err := context.checkServer()
 			if err != nil {
 				errors = append(errors, fmt.Errorf("couldnt setup proxy for context: %q, err:%q", contextName, err))
 				continue
@@ -810,6 +875,49 @@ func GetInClusterContext() (*Context, error) {
 	}, nil
 }
 
+// NewTokenContext builds a context from an API server URL, its CA and a bearer token, without a
+// kubeconfig file. caData is PEM, and may be omitted only when insecureSkipTLSVerify is set.
+func NewTokenContext(name, server string, caData []byte, token, namespace string, insecureSkipTLSVerify bool) (*Context, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil || serverURL.Host == "" {
+		return nil, ClusterError{ClusterName: name, Reason: fmt.Sprintf("invalid server URL %q", server)}
+	}
+	if serverURL.Scheme != "https" {
+		return nil, ClusterError{ClusterName: name, Reason: "server URL must use https"}
+	}
+	if token == "" {
+		return nil, UserError{UserName: name, Reason: "token is required"}
+	}
+	if len(caData) == 0 && !insecureSkipTLSVerify {
+		return nil, ClusterError{ClusterName: name, Reason: "certificate authority data is required unless TLS verification is skipped"}
+	}
+	if len(caData) > 0 {
+		if _, err := certutil.ParseCertsPEM(caData); err != nil {
+			return nil, ClusterError{ClusterName: name, Reason: fmt.Sprintf("invalid certificate authority data: %v", err)}
+		}
+	}
+
+	name = makeDNSFriendly(name)
+
+	return &Context{
+		Name: name,
+		KubeContext: &api.Context{
+			Cluster:   name,
+			AuthInfo:  name,
+			Namespace: namespace,
+		},
+		Cluster: &api.Cluster{
+			Server:                   server,
+			CertificateAuthorityData: caData,
+			InsecureSkipTLSVerify:    insecureSkipTLSVerify,
+		},
+		AuthInfo: &api.AuthInfo{
+			Token: token,
+		},
+		Source: DynamicCluster,
+	}, nil
+}
+
 // LoadAndStoreKubeConfigs loads contexts from the given kubeconfig files and
 // stores them in the given context store.
 // It stores the valid contexts and returns the errors if any.
@@ -0,0 +1,403 @@
+package kubeconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	refreshHooksFileName = "context-refresh.json"
+
+	defaultRefreshTimeout = 30 * time.Second
+	maxRefreshTimeout     = 5 * time.Minute
+	// defaultTokenLifetime is how long credentials without an expiration timestamp are cached
+	defaultTokenLifetime = 10 * time.Minute
+	// refreshMargin renews credentials before they expire, so requests in flight never carry a stale token
+	refreshMargin = time.Minute
+)
+
+// ErrInvalidRefreshHook is returned for hooks that cannot run
+var ErrInvalidRefreshHook = errors.New("invalid refresh hook")
+
+// RefreshHook fetches fresh credentials of a context by running a command on the server. The command
+// prints an ExecCredential, like kubectl credential plugins do, or a bare token. Without a command the
+// exec plugin of the context's kubeconfig user runs instead.
+type RefreshHook struct {
+	Command        string            `json:"command,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"`
+}
+
+// Validate checks the timeout of the hook
+func (h RefreshHook) Validate() error {
+	if h.TimeoutSeconds < 0 || time.Duration(h.TimeoutSeconds)*time.Second > maxRefreshTimeout {
+		return fmt.Errorf("%w: timeoutSeconds must be between 0 and %d", ErrInvalidRefreshHook, int(maxRefreshTimeout.Seconds()))
+	}
+	return nil
+}
+
+func (h RefreshHook) timeout() time.Duration {
+	if h.TimeoutSeconds == 0 {
+		return defaultRefreshTimeout
+	}
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+// RefreshStatus is the state of the cached credentials of a context, never the credentials themselves
+type RefreshStatus struct {
+	Context     string       `json:"context"`
+	Hook        *RefreshHook `json:"hook"`
+	Source      string       `json:"source"`
+	Cached      bool         `json:"cached"`
+	RefreshedAt *time.Time   `json:"refreshedAt,omitempty"`
+	ExpiresAt   *time.Time   `json:"expiresAt,omitempty"`
+	LastError   string       `json:"lastError,omitempty"`
+}
+
+// cachedCredential is the last token fetched for a context. Its mutex serialises refreshes, so
+// concurrent requests run the command once.
+type cachedCredential struct {
+	mutex       sync.Mutex
+	token       string
+	refreshedAt time.Time
+	expiresAt   time.Time
+	lastError   string
+}
+
+func (c *cachedCredential) valid(now time.Time) bool {
+	return c.token != "" && now.Add(refreshMargin).Before(c.expiresAt)
+}
+
+// RefreshHooks persists the refresh hooks per context and caches the credentials they fetch
+type RefreshHooks struct {
+	filePath    string
+	mutex       sync.Mutex
+	hooks       map[string]RefreshHook
+	credentials map[string]*cachedCredential
+}
+
+var (
+	globalRefreshHooks *RefreshHooks
+	refreshHooksOnce   sync.Once
+)
+
+// GetRefreshHooks returns the shared refresh hook store
+func GetRefreshHooks() *RefreshHooks {
+	refreshHooksOnce.Do(func() {
+		globalRefreshHooks = &RefreshHooks{
+			filePath:    filepath.Join(utils.ConfigDir(), refreshHooksFileName),
+			credentials: map[string]*cachedCredential{},
+		}
+	})
+	return globalRefreshHooks
+}
+
+// Get returns the hook of a context
+func (r *RefreshHooks) Get(contextName string) (RefreshHook, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return RefreshHook{}, false, err
+	}
+	hook, ok := r.hooks[contextName]
+	return hook, ok, nil
+}
+
+// Set stores the hook of a context and drops its cached credentials
+func (r *RefreshHooks) Set(contextName string, hook RefreshHook) error {
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	r.hooks[contextName] = hook
+	delete(r.credentials, contextName)
+	return r.save()
+}
+
+// Remove deletes the hook of a context
+func (r *RefreshHooks) Remove(contextName string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	if _, ok := r.hooks[contextName]; !ok {
+		return nil
+	}
+	delete(r.hooks, contextName)
+	delete(r.credentials, contextName)
+	return r.save()
+}
+
+// Rename moves the hook of a renamed context
+func (r *RefreshHooks) Rename(oldName, newName string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	hook, ok := r.hooks[oldName]
+	if !ok {
+		return nil
+	}
+	delete(r.hooks, oldName)
+	delete(r.credentials, oldName)
+	r.hooks[newName] = hook
+	return r.save()
+}
+
+// Status reports the hook and the cached credentials of a context
+func (r *RefreshHooks) Status(c *Context) (RefreshStatus, error) {
+	hook, ok, err := r.Get(c.Name)
+	if err != nil {
+		return RefreshStatus{}, err
+	}
+	status := RefreshStatus{Context: c.Name}
+	if !ok {
+		return status, nil
+	}
+	status.Hook = &hook
+	status.Source = hookSource(hook)
+
+	credential := r.credential(c.Name)
+	credential.mutex.Lock()
+	defer credential.mutex.Unlock()
+	status.Cached = credential.valid(time.Now())
+	if !credential.refreshedAt.IsZero() {
+		refreshedAt, expiresAt := credential.refreshedAt, credential.expiresAt
+		status.RefreshedAt, status.ExpiresAt = &refreshedAt, &expiresAt
+	}
+	status.LastError = credential.lastError
+	return status, nil
+}
+
+// Refresh runs the hook of a context now, regardless of the cached credentials
+func (r *RefreshHooks) Refresh(c *Context) (RefreshStatus, error) {
+	hook, ok, err := r.Get(c.Name)
+	if err != nil {
+		return RefreshStatus{}, err
+	}
+	if !ok {
+		return RefreshStatus{}, fmt.Errorf("%w: context %s has no refresh hook", ErrInvalidRefreshHook, c.Name)
+	}
+	r.invalidate(c.Name)
+	if _, err := r.token(c, hook); err != nil {
+		return RefreshStatus{}, err
+	}
+	return r.Status(c)
+}
+
+// wrap makes the REST config of a context send the credentials of its hook, the config keeps its TLS
+// settings but drops the credentials of the kubeconfig
+func (r *RefreshHooks) wrap(c *Context, config *rest.Config) error {
+	hook, ok, err := r.Get(c.Name)
+	if err != nil || !ok {
+		return err
+	}
+	if hook.Command == "" && (c.AuthInfo == nil || c.AuthInfo.Exec == nil) {
+		return fmt.Errorf("%w: context %s has no command and its kubeconfig user has no exec plugin", ErrInvalidRefreshHook, c.Name)
+	}
+
+	config.ExecProvider = nil
+	config.AuthProvider = nil
+	config.BearerToken = ""
+	config.BearerTokenFile = ""
+	config.Username, config.Password = "", ""
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		return &refreshingRoundTripper{hooks: r, context: c, hook: hook, next: rt}
+	}
+	return nil
+}
+
+// refreshingRoundTripper sets the hook's token on requests without credentials of their own
+type refreshingRoundTripper struct {
+	hooks   *RefreshHooks
+	context *Context
+	hook    RefreshHook
+	next    http.RoundTripper
+}
+
+func (t *refreshingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+	token, err := t.hooks.token(t.context, t.hook)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// The token was revoked or expired early, the next request fetches a new one
+		t.hooks.invalidate(t.context.Name)
+	}
+	return resp, err
+}
+
+func (r *RefreshHooks) credential(contextName string) *cachedCredential {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	credential, ok := r.credentials[contextName]
+	if !ok {
+		credential = &cachedCredential{}
+		r.credentials[contextName] = credential
+	}
+	return credential
+}
+
+func (r *RefreshHooks) invalidate(contextName string) {
+	credential := r.credential(contextName)
+	credential.mutex.Lock()
+	credential.token = ""
+	credential.mutex.Unlock()
+}
+
+// token returns the cached token of a context, running the hook when it is missing or about to expire
+func (r *RefreshHooks) token(c *Context, hook RefreshHook) (string, error) {
+	credential := r.credential(c.Name)
+	credential.mutex.Lock()
+	defer credential.mutex.Unlock()
+
+	now := time.Now()
+	if credential.valid(now) {
+		return credential.token, nil
+	}
+
+	token, expiresAt, err := runHook(c, hook)
+	if err != nil {
+		credential.lastError = err.Error()
+		logger.Log(logger.LevelError, map[string]string{"context": c.Name}, err, "Failed to refresh context credentials")
+		return "", err
+	}
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(defaultTokenLifetime)
+	}
+	credential.token, credential.refreshedAt, credential.expiresAt, credential.lastError = token, now, expiresAt, ""
+	return token, nil
+}
+
+// execInfo is the KUBERNETES_EXEC_INFO passed to credential plugins, they must not prompt on a server
+const execInfo = `{"apiVersion":"%s","kind":"ExecCredential","spec":{"interactive":false}}`
+
+// runHook runs the command of the hook, or the exec plugin of the kubeconfig user, with a timeout
+func runHook(c *Context, hook RefreshHook) (string, time.Time, error) {
+	command, args, env := hook.Command, hook.Args, os.Environ()
+	apiVersion := "client.authentication.k8s.io/v1"
+	if command == "" {
+		if c.AuthInfo == nil || c.AuthInfo.Exec == nil {
+			return "", time.Time{}, fmt.Errorf("%w: context %s has no command and its kubeconfig user has no exec plugin", ErrInvalidRefreshHook, c.Name)
+		}
+		plugin := c.AuthInfo.Exec
+		command, args = plugin.Command, plugin.Args
+		for _, variable := range plugin.Env {
+			env = append(env, variable.Name+"="+variable.Value)
+		}
+		if plugin.APIVersion != "" {
+			apiVersion = plugin.APIVersion
+		}
+	}
+	for name, value := range hook.Env {
+		env = append(env, name+"="+value)
+	}
+	env = append(env, "KUBERNETES_EXEC_INFO="+fmt.Sprintf(execInfo, apiVersion))
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", time.Time{}, fmt.Errorf("refresh command %s timed out after %s", command, hook.timeout())
+		}
+		return "", time.Time{}, fmt.Errorf("refresh command %s failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseCredential(stdout.Bytes())
+}
+
+// parseCredential reads the token and its expiry from an ExecCredential, or a bare token
+func parseCredential(output []byte) (string, time.Time, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return "", time.Time{}, errors.New("refresh command printed no credentials")
+	}
+	if output[0] != '{' {
+		return string(output), time.Time{}, nil
+	}
+
+	var credential struct {
+		Kind   string `json:"kind"`
+		Status *struct {
+			Token               string     `json:"token"`
+			ExpirationTimestamp *time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(output, &credential); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse ExecCredential: %v", err)
+	}
+	if credential.Kind != "ExecCredential" || credential.Status == nil {
+		return "", time.Time{}, errors.New("refresh command printed no ExecCredential status")
+	}
+	if credential.Status.Token == "" {
+		return "", time.Time{}, errors.New("ExecCredential has no token, client certificates are not supported by refresh hooks")
+	}
+	var expiresAt time.Time
+	if credential.Status.ExpirationTimestamp != nil {
+		expiresAt = *credential.Status.ExpirationTimestamp
+	}
+	return credential.Status.Token, expiresAt, nil
+}
+
+func hookSource(hook RefreshHook) string {
+	if hook.Command != "" {
+		return "command"
+	}
+	return "kubeconfig-exec"
+}
+
+// load reads the hooks on first use, the caller must hold the mutex
+func (r *RefreshHooks) load() error {
+	if r.hooks != nil {
+		return nil
+	}
+	hooks := map[string]RefreshHook{}
+	if err := utils.ReadJSONFile(r.filePath, &hooks); err != nil {
+		return err
+	}
+	r.hooks = hooks
+	return nil
+}
+
+// save writes the hooks, owner-only since their environment may hold secrets
+func (r *RefreshHooks) save() error {
+	return utils.WriteJSONFileMode(r.filePath, r.hooks, 0600)
+}
@@ -0,0 +1,91 @@
+package kubeconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCredential(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		output     string
+		wantToken  string
+		wantExpiry bool
+		wantErr    bool
+	}{
+		{
+			name:       "exec credential",
+			output:     `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"abc","expirationTimestamp":"2030-01-01T00:00:00Z"}}`,
+			wantToken:  "abc",
+			wantExpiry: true,
+		},
+		{
+			name:      "exec credential without expiry",
+			output:    `{"kind":"ExecCredential","status":{"token":"abc"}}`,
+			wantToken: "abc",
+		},
+		{
+			name:      "bare token",
+			output:    "  ya29.token\n",
+			wantToken: "ya29.token",
+		},
+		{
+			name:    "client certificate only",
+			output:  `{"kind":"ExecCredential","status":{"clientCertificateData":"cert","clientKeyData":"key"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			output:  "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, expiresAt, err := parseCredential([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if token != tt.wantToken {
+				t.Errorf("parseCredential() token = %q, want %q", token, tt.wantToken)
+			}
+			if expiresAt.IsZero() == tt.wantExpiry {
+				t.Errorf("parseCredential() expiresAt = %v, want expiry %v", expiresAt, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	t.Parallel()
+
+	context := &Context{Name: "eks"}
+
+	token, _, err := runHook(context, RefreshHook{
+		Command: "sh",
+		Args:    []string{"-c", `echo "$TOKEN_PREFIX-$KUBERNETES_EXEC_INFO" | cut -d'{' -f1`},
+		Env:     map[string]string{"TOKEN_PREFIX": "fresh"},
+	})
+	if err != nil {
+		t.Fatalf("runHook() error = %v", err)
+	}
+	if token != "fresh-" {
+		t.Errorf("runHook() token = %q, want %q", token, "fresh-")
+	}
+
+	start := time.Now()
+	_, _, err = runHook(context, RefreshHook{Command: "sleep", Args: []string{"5"}, TimeoutSeconds: 1})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runHook() error = %v, want a timeout", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("runHook() took %s, the timeout did not stop the command", time.Since(start))
+	}
+}
@@ -0,0 +1,311 @@
+package listing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// List query parameters shared by every list endpoint
+const (
+	ParamLimit    = "limit"
+	ParamContinue = "continue"
+	ParamSortBy   = "sortBy"
+	ParamOrder    = "order"
+	ParamFilter   = "filter"
+)
+
+// Response headers carrying the page metadata, so that endpoints answering a bare array keep their shape
+const (
+	HeaderTotalCount = "X-Total-Count"
+	HeaderContinue   = "X-Continue"
+)
+
+// Filter operators
+const (
+	OpEquals    = "="
+	OpNotEquals = "!="
+	OpContains  = "~"
+)
+
+// MaxLimit bounds the page size
+const MaxLimit = 1000
+
+const continuePrefix = "offset:"
+
+// ErrInvalidQuery is returned for malformed list query parameters
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// Query is the list convention: ?limit=50&continue=<token>&sortBy=name&order=desc&filter=namespace=default.
+// Fields are the JSON names of the listed items, nested fields are joined with dots. Repeated filters
+// must all match.
+type Query struct {
+	Limit      int
+	Offset     int
+	SortBy     string
+	Descending bool
+	Filters    []Filter
+}
+
+// Filter compares a field of the items with a value, case-insensitively for OpContains
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Page is a page of a list
+type Page[T any] struct {
+	Items []T
+	// Total counts the items matching the filters, over every page
+	Total int
+	// Continue fetches the next page, empty on the last one
+	Continue string
+}
+
+// Parse reads the list query parameters
+func Parse(values url.Values) (Query, error) {
+	query := Query{SortBy: values.Get(ParamSortBy)}
+
+	if limit := values.Get(ParamLimit); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 0 || value > MaxLimit {
+			return Query{}, fmt.Errorf("%w: limit must be between 0 and %d", ErrInvalidQuery, MaxLimit)
+		}
+		query.Limit = value
+	}
+
+	if token := values.Get(ParamContinue); token != "" {
+		offset, err := decodeContinue(token)
+		if err != nil {
+			return Query{}, err
+		}
+		query.Offset = offset
+	}
+
+	switch order := strings.ToLower(values.Get(ParamOrder)); order {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return Query{}, fmt.Errorf("%w: order must be asc or desc", ErrInvalidQuery)
+	}
+
+	for _, expression := range values[ParamFilter] {
+		filter, err := parseFilter(expression)
+		if err != nil {
+			return Query{}, err
+		}
+		query.Filters = append(query.Filters, filter)
+	}
+	return query, nil
+}
+
+// parseFilter reads field=value, field!=value or field~value
+func parseFilter(expression string) (Filter, error) {
+	index := strings.IndexAny(expression, "=!~")
+	if index <= 0 {
+		return Filter{}, fmt.Errorf("%w: filter %q must be field=value, field!=value or field~value", ErrInvalidQuery, expression)
+	}
+	filter := Filter{Field: expression[:index]}
+	switch rest := expression[index:]; {
+	case strings.HasPrefix(rest, OpNotEquals):
+		filter.Operator, filter.Value = OpNotEquals, rest[len(OpNotEquals):]
+	case strings.HasPrefix(rest, OpEquals):
+		filter.Operator, filter.Value = OpEquals, rest[len(OpEquals):]
+	case strings.HasPrefix(rest, OpContains):
+		filter.Operator, filter.Value = OpContains, rest[len(OpContains):]
+	default:
+		return Filter{}, fmt.Errorf("%w: filter %q has no operator", ErrInvalidQuery, expression)
+	}
+	return filter, nil
+}
+
+// Apply filters, sorts and pages the items. Items keep their order when no sort field is given, or
+// when they have the same value for it.
+func Apply[T any](items []T, query Query) (Page[T], error) {
+	if len(query.Filters) == 0 && query.SortBy == "" {
+		return page(items, query), nil
+	}
+
+	type entry struct {
+		item   T
+		fields map[string]interface{}
+	}
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		fields, err := fieldsOf(item)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		if matches(fields, query.Filters) {
+			entries = append(entries, entry{item: item, fields: fields})
+		}
+	}
+
+	if query.SortBy != "" {
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, aok := lookup(entries[i].fields, query.SortBy)
+			b, bok := lookup(entries[j].fields, query.SortBy)
+			// Items without the field go last in both orders
+			if !aok || !bok {
+				return aok && !bok
+			}
+			if query.Descending {
+				return compare(b, a) < 0
+			}
+			return compare(a, b) < 0
+		})
+	}
+
+	filtered := make([]T, 0, len(entries))
+	for _, e := range entries {
+		filtered = append(filtered, e.item)
+	}
+	return page(filtered, query), nil
+}
+
+// SetHeaders writes the page metadata headers
+func SetHeaders[T any](header http.Header, p Page[T]) {
+	header.Set(HeaderTotalCount, strconv.Itoa(p.Total))
+	if p.Continue != "" {
+		header.Set(HeaderContinue, p.Continue)
+	}
+}
+
+func page[T any](items []T, query Query) Page[T] {
+	p := Page[T]{Total: len(items)}
+	if query.Offset >= len(items) {
+		p.Items = []T{}
+		return p
+	}
+	end := len(items)
+	if query.Limit > 0 && query.Offset+query.Limit < end {
+		end = query.Offset + query.Limit
+		p.Continue = encodeContinue(end)
+	}
+	p.Items = items[query.Offset:end]
+	return p
+}
+
+func encodeContinue(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(continuePrefix + strconv.Itoa(offset)))
+}
+
+func decodeContinue(token string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil && strings.HasPrefix(string(raw), continuePrefix) {
+		if offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), continuePrefix)); err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: continue token is not valid for this list", ErrInvalidQuery)
+}
+
+// fieldsOf returns the JSON fields of an item
+func fieldsOf(item interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode list item: %v", err)
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%w: list items have no fields to sort or filter by", ErrInvalidQuery)
+	}
+	return fields, nil
+}
+
+// lookup returns the value of a dotted field path
+func lookup(fields map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = fields
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func matches(fields map[string]interface{}, filters []Filter) bool {
+	for _, filter := range filters {
+		value, ok := lookup(fields, filter.Field)
+		text := ""
+		if ok {
+			text = stringOf(value)
+		}
+		switch filter.Operator {
+		case OpEquals:
+			if !ok || text != filter.Value {
+				return false
+			}
+		case OpNotEquals:
+			if ok && text == filter.Value {
+				return false
+			}
+		case OpContains:
+			if !ok || !strings.Contains(strings.ToLower(text), strings.ToLower(filter.Value)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stringOf renders a JSON value for filters, arrays are joined by commas
+func stringOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, element := range v {
+			parts = append(parts, stringOf(element))
+		}
+		return strings.Join(parts, ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// compare orders numbers numerically, booleans false first and anything else by its text, which
+// orders RFC 3339 timestamps chronologically
+func compare(a, b interface{}) int {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(strings.ToLower(stringOf(a)), strings.ToLower(stringOf(b)))
+}
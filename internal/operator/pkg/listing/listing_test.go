@@ -0,0 +1,129 @@
+package listing
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+type item struct {
+	Name     string            `json:"name"`
+	Severity int               `json:"severity"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    Query
+		wantErr bool
+	}{
+		{name: "empty", query: "", want: Query{}},
+		{
+			name:  "full",
+			query: "limit=10&sortBy=name&order=desc&filter=labels.team=core&filter=name!=a&filter=name~web",
+			want: Query{Limit: 10, SortBy: "name", Descending: true, Filters: []Filter{
+				{Field: "labels.team", Operator: OpEquals, Value: "core"},
+				{Field: "name", Operator: OpNotEquals, Value: "a"},
+				{Field: "name", Operator: OpContains, Value: "web"},
+			}},
+		},
+		{name: "value with equals", query: "filter=" + url.QueryEscape("selector=app=web"), want: Query{Filters: []Filter{
+			{Field: "selector", Operator: OpEquals, Value: "app=web"},
+		}}},
+		{name: "negative limit", query: "limit=-1", wantErr: true},
+		{name: "limit too large", query: "limit=5000", wantErr: true},
+		{name: "bad order", query: "order=up", wantErr: true},
+		{name: "filter without field", query: "filter==a", wantErr: true},
+		{name: "filter without operator", query: "filter=name", wantErr: true},
+		{name: "foreign continue token", query: "continue=abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			values, _ := url.ParseQuery(tt.query)
+			got, err := Parse(values)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("Parse() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got.Limit != tt.want.Limit || got.SortBy != tt.want.SortBy || got.Descending != tt.want.Descending || len(got.Filters) != len(tt.want.Filters) {
+				t.Fatalf("Parse() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got.Filters {
+				if got.Filters[i] != tt.want.Filters[i] {
+					t.Errorf("Parse() filter %d = %+v, want %+v", i, got.Filters[i], tt.want.Filters[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	items := []item{
+		{Name: "web", Severity: 3, Labels: map[string]string{"team": "core"}},
+		{Name: "api", Severity: 10, Labels: map[string]string{"team": "core"}},
+		{Name: "db", Severity: 1},
+		{Name: "web-canary", Severity: 3, Labels: map[string]string{"team": "edge"}},
+	}
+
+	names := func(p Page[item]) []string {
+		out := []string{}
+		for _, i := range p.Items {
+			out = append(out, i.Name)
+		}
+		return out
+	}
+
+	sorted, err := Apply(items, Query{SortBy: "severity", Descending: true})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := names(sorted); got[0] != "api" || got[1] != "web" || got[2] != "web-canary" || got[3] != "db" {
+		t.Errorf("Apply() sorted = %v, want numeric order with ties kept", got)
+	}
+
+	filtered, _ := Apply(items, Query{Filters: []Filter{{Field: "labels.team", Operator: OpEquals, Value: "core"}}})
+	if got := names(filtered); len(got) != 2 || filtered.Total != 2 {
+		t.Errorf("Apply() filtered = %v (total %d), want web and api", got, filtered.Total)
+	}
+
+	missing, _ := Apply(items, Query{SortBy: "labels.team"})
+	if got := names(missing); got[3] != "db" {
+		t.Errorf("Apply() = %v, want items without the field last", got)
+	}
+
+	// Walk the pages with the continue tokens
+	query := Query{Limit: 3, Filters: []Filter{{Field: "name", Operator: OpNotEquals, Value: "db"}}}
+	first, _ := Apply(items, query)
+	if len(first.Items) != 3 || first.Total != 3 || first.Continue != "" {
+		t.Errorf("Apply() first page = %+v, want the 3 matching items and no continue token", first)
+	}
+	query.Limit = 2
+	first, _ = Apply(items, query)
+	if len(first.Items) != 2 || first.Continue == "" {
+		t.Fatalf("Apply() first page = %+v, want 2 items and a continue token", first)
+	}
+	values := url.Values{ParamLimit: {"2"}, ParamContinue: {first.Continue}, ParamFilter: {"name!=db"}}
+	next, err := Parse(values)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	second, _ := Apply(items, next)
+	if got := names(second); len(got) != 1 || got[0] != "web-canary" || second.Continue != "" || second.Total != 3 {
+		t.Errorf("Apply() second page = %v (%+v), want web-canary only", got, second)
+	}
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Summary is the part of the kubelet stats summary read for the filesystem and network usage that
+// metrics server doesn't report
+type Summary struct {
+	Pods []PodStats `json:"pods"`
+}
+
+// PodStats are the stats of a pod in the kubelet summary
+type PodStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Containers []ContainerStats `json:"containers"`
+	Network    *NetworkStats    `json:"network,omitempty"`
+}
+
+// ContainerStats are the filesystem stats of a container in the kubelet summary
+type ContainerStats struct {
+	Name   string   `json:"name"`
+	Rootfs *FsStats `json:"rootfs,omitempty"`
+	Logs   *FsStats `json:"logs,omitempty"`
+}
+
+// FsStats is the usage of a filesystem in the kubelet summary
+type FsStats struct {
+	UsedBytes *uint64 `json:"usedBytes,omitempty"`
+}
+
+// NetworkStats are the cumulative counters of the network interfaces of a pod
+type NetworkStats struct {
+	Time    metav1.Time `json:"time"`
+	RxBytes *uint64     `json:"rxBytes,omitempty"`
+	TxBytes *uint64     `json:"txBytes,omitempty"`
+}
+
+// PodUsage is the filesystem and network usage of a pod read from the kubelet
+type PodUsage struct {
+	// FilesystemBytes is what each container wrote to its writable layer and logs, by container name
+	FilesystemBytes map[string]int64
+	// Network is false when the kubelet reports no counters, e.g. for host network pods
+	Network bool
+	// RxBytes and TxBytes are cumulative since the pod started
+	RxBytes int64
+	TxBytes int64
+	Time    time.Time
+}
+
+// FetchSummary reads the stats summary of a node's kubelet through the API server node proxy,
+// which needs the nodes/proxy permission
+func FetchSummary(ctx context.Context, clientset kubernetes.Interface, nodeName string) (*Summary, error) {
+	data, err := clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats summary of node %s: %w", nodeName, err)
+	}
+	summary := &Summary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, fmt.Errorf("failed to parse stats summary of node %s: %w", nodeName, err)
+	}
+	return summary, nil
+}
+
+// KubeletUsage reads the usage of the pods of the nodes, keyed by namespace/pod. The nodes that
+// can't be read are reported in the error, along with the usage of the others.
+func KubeletUsage(ctx context.Context, clientset kubernetes.Interface, nodeNames []string) (map[string]PodUsage, error) {
+	usage := map[string]PodUsage{}
+	var errs []error
+	for _, nodeName := range nodeNames {
+		summary, err := FetchSummary(ctx, clientset, nodeName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for key, pod := range summary.Usage() {
+			usage[key] = pod
+		}
+	}
+	return usage, errors.Join(errs...)
+}
+
+// Usage returns the usage of the pods of the summary, keyed by namespace/pod
+func (s *Summary) Usage() map[string]PodUsage {
+	usage := make(map[string]PodUsage, len(s.Pods))
+	for _, pod := range s.Pods {
+		podUsage := PodUsage{FilesystemBytes: map[string]int64{}}
+		for _, container := range pod.Containers {
+			podUsage.FilesystemBytes[container.Name] = usedBytes(container.Rootfs) + usedBytes(container.Logs)
+		}
+		if network := pod.Network; network != nil && network.RxBytes != nil && network.TxBytes != nil {
+			podUsage.Network = true
+			podUsage.RxBytes = int64(*network.RxBytes)
+			podUsage.TxBytes = int64(*network.TxBytes)
+			podUsage.Time = network.Time.Time
+		}
+		usage[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = podUsage
+	}
+	return usage
+}
+
+// BytesPerSecond is the throughput between two readings of a cumulative counter, 0 when the
+// counter was reset by a pod restart
+func BytesPerSecond(previous, current int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || current < previous {
+		return 0
+	}
+	return float64(current-previous) / elapsed.Seconds()
+}
+
+func usedBytes(stats *FsStats) int64 {
+	if stats == nil || stats.UsedBytes == nil {
+		return 0
+	}
+	return int64(*stats.UsedBytes)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummaryUsage(t *testing.T) {
+	t.Parallel()
+
+	data := `{"node":{"nodeName":"node-a"},"pods":[
+		{"podRef":{"name":"api","namespace":"shop"},
+		 "containers":[{"name":"app","rootfs":{"usedBytes":4096},"logs":{"usedBytes":1024}},{"name":"proxy"}],
+		 "network":{"time":"2024-05-01T10:00:00Z","rxBytes":2000,"txBytes":500}},
+		{"podRef":{"name":"agent","namespace":"kube-system"},"containers":[{"name":"agent","rootfs":{"usedBytes":10}}],"network":{"time":"2024-05-01T10:00:00Z"}}
+	]}`
+	summary := &Summary{}
+	if err := json.Unmarshal([]byte(data), summary); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	usage := summary.Usage()
+	api := usage["shop/api"]
+	if !reflect.DeepEqual(api.FilesystemBytes, map[string]int64{"app": 5120, "proxy": 0}) {
+		t.Errorf("shop/api filesystem = %v", api.FilesystemBytes)
+	}
+	if !api.Network || api.RxBytes != 2000 || api.TxBytes != 500 || !api.Time.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("shop/api network = %+v", api)
+	}
+	if agent := usage["kube-system/agent"]; agent.Network {
+		t.Errorf("kube-system/agent network = %+v, want none without counters", agent)
+	}
+}
+
+func TestBytesPerSecond(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		previous, current int64
+		elapsed           time.Duration
+		want              float64
+	}{
+		{"growing counter", 1000, 7000, time.Minute, 100},
+		{"reset counter", 7000, 1000, time.Minute, 0},
+		{"same reading", 1000, 1000, 0, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := BytesPerSecond(tt.previous, tt.current, tt.elapsed); got != tt.want {
+				t.Errorf("BytesPerSecond() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
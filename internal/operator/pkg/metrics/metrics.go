@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/agentkube/operator/pkg/features"
 	"github.com/agentkube/operator/pkg/logger"
 	"github.com/agentkube/operator/pkg/prometheus"
 	v1 "k8s.io/api/core/v1"
@@ -46,6 +47,10 @@ type PodMetrics struct {
 	CPU    CPUMetrics    `json:"cpu"`
 	Memory MemoryMetrics `json:"memory"`
 
+	// Filesystem and network usage, read from the kubelet when the kubelet-stats feature is enabled
+	Filesystem *FilesystemMetrics `json:"filesystem,omitempty"`
+	Network    *NetworkMetrics    `json:"network,omitempty"`
+
 	// Container-specific metrics
 	Containers []ContainerMetrics `json:"containers"`
 
@@ -76,9 +81,16 @@ type MemoryMetrics struct {
 
 // ContainerMetrics contains metrics for a container
 type ContainerMetrics struct {
-	Name   string        `json:"name"`
-	CPU    CPUMetrics    `json:"cpu"`
-	Memory MemoryMetrics `json:"memory"`
+	Name       string             `json:"name"`
+	CPU        CPUMetrics         `json:"cpu"`
+	Memory     MemoryMetrics      `json:"memory"`
+	Filesystem *FilesystemMetrics `json:"filesystem,omitempty"`
+}
+
+// FilesystemMetrics contains the bytes written to the writable layer and logs of containers
+type FilesystemMetrics struct {
+	UsedBytes int64   `json:"usedBytes"`
+	UsedMiB   float64 `json:"usedMiB"`
 }
 
 // HistoricalMetrics contains a single point of historical metrics data
@@ -92,6 +104,21 @@ type HistoricalMetrics struct {
 type NetworkMetrics struct {
 	RxBytes int64 `json:"rxBytes"`
 	TxBytes int64 `json:"txBytes"`
+	// Throughput since the previous refresh of the pod
+	RxBytesPerSecond float64 `json:"rxBytesPerSecond,omitempty"`
+	TxBytesPerSecond float64 `json:"txBytesPerSecond,omitempty"`
+
+	// sampledAt is when the kubelet read the counters
+	sampledAt time.Time
+}
+
+// kubeletUsageTTL is how long the stats summary of a node is reused for its pods
+const kubeletUsageTTL = 30 * time.Second
+
+// nodeUsage is the kubelet stats of the pods of a node, keyed by namespace/pod
+type nodeUsage struct {
+	fetchedAt time.Time
+	pods      map[string]PodUsage
 }
 
 // MetricsController is responsible for fetching metrics from various sources
@@ -107,6 +134,9 @@ type MetricsController struct {
 	updateInterval int
 	// Maximum time to consider metrics valid in seconds
 	metricsValidDuration int
+	// kubeletUsage caches the kubelet stats of each node, shared by the pods on it
+	kubeletUsage   map[string]nodeUsage
+	kubeletUsageMu sync.Mutex
 }
 
 // MetricsOptions contains configuration options for the metrics controller
@@ -142,6 +172,7 @@ func NewMetricsController(config *rest.Config, options *MetricsOptions) (*Metric
 		clientset:            clientset,
 		promClient:           promClient,
 		metrics:              make(map[string]*PodMetrics),
+		kubeletUsage:         make(map[string]nodeUsage),
 		maxHistoryPoints:     options.MaxHistoryPoints,
 		updateInterval:       options.UpdateInterval,
 		metricsValidDuration: options.MetricsValidDuration,
@@ -207,6 +238,13 @@ func (mc *MetricsController) refreshPodMetrics(ctx context.Context, namespace, p
 	} else {
 		// Enrich metrics with pod resource requests and limits
 		mc.enrichWithResourceRequests(metrics, pod)
+
+		// Metrics server lacks filesystem and network usage, the kubelet has them
+		if features.Enabled(features.KubeletStats) && pod.Spec.NodeName != "" {
+			if err := mc.enrichWithKubeletStats(ctx, metrics, pod); err != nil {
+				logger.Log(logger.LevelWarn, nil, err, "reading kubelet stats")
+			}
+		}
 	}
 
 	// Update timestamp
@@ -228,6 +266,13 @@ func (mc *MetricsController) refreshPodMetrics(ctx context.Context, namespace, p
 		// Copy existing history
 		metrics.History = append(existingMetrics.History, newHistoryPoint)
 
+		// Network throughput is taken between the counters of two refreshes
+		if metrics.Network != nil && existingMetrics.Network != nil {
+			elapsed := metrics.Network.sampledAt.Sub(existingMetrics.Network.sampledAt)
+			metrics.Network.RxBytesPerSecond = BytesPerSecond(existingMetrics.Network.RxBytes, metrics.Network.RxBytes, elapsed)
+			metrics.Network.TxBytesPerSecond = BytesPerSecond(existingMetrics.Network.TxBytes, metrics.Network.TxBytes, elapsed)
+		}
+
 		// Trim history if needed
 		if len(metrics.History) > mc.maxHistoryPoints {
 			metrics.History = metrics.History[len(metrics.History)-mc.maxHistoryPoints:]
@@ -620,6 +665,53 @@ func (mc *MetricsController) enrichWithResourceRequests(metrics *PodMetrics, pod
 	}
 }
 
+// enrichWithKubeletStats adds the filesystem usage of the containers and the network counters of
+// the pod from the stats summary of its node
+func (mc *MetricsController) enrichWithKubeletStats(ctx context.Context, metrics *PodMetrics, pod *v1.Pod) error {
+	usage, err := mc.nodeKubeletUsage(ctx, pod.Spec.NodeName)
+	if err != nil {
+		return err
+	}
+	podUsage, ok := usage[pod.Namespace+"/"+pod.Name]
+	if !ok {
+		return nil
+	}
+
+	var total int64
+	for j, container := range metrics.Containers {
+		used, ok := podUsage.FilesystemBytes[container.Name]
+		if !ok {
+			continue
+		}
+		total += used
+		metrics.Containers[j].Filesystem = &FilesystemMetrics{UsedBytes: used, UsedMiB: float64(used) / (1024 * 1024)}
+	}
+	metrics.Filesystem = &FilesystemMetrics{UsedBytes: total, UsedMiB: float64(total) / (1024 * 1024)}
+
+	if podUsage.Network {
+		metrics.Network = &NetworkMetrics{RxBytes: podUsage.RxBytes, TxBytes: podUsage.TxBytes, sampledAt: podUsage.Time}
+	}
+	return nil
+}
+
+// nodeKubeletUsage returns the kubelet stats of the pods of a node, read at most once per
+// kubeletUsageTTL
+func (mc *MetricsController) nodeKubeletUsage(ctx context.Context, nodeName string) (map[string]PodUsage, error) {
+	mc.kubeletUsageMu.Lock()
+	defer mc.kubeletUsageMu.Unlock()
+
+	if cached, ok := mc.kubeletUsage[nodeName]; ok && time.Since(cached.fetchedAt) < kubeletUsageTTL {
+		return cached.pods, nil
+	}
+	summary, err := FetchSummary(ctx, mc.clientset, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	pods := summary.Usage()
+	mc.kubeletUsage[nodeName] = nodeUsage{fetchedAt: time.Now(), pods: pods}
+	return pods, nil
+}
+
 // parseFloat parses a string to float64
 func parseFloat(value string) (float64, error) {
 	var f float64
@@ -641,6 +733,14 @@ func (mc *MetricsController) CleanupCache() {
 			delete(mc.metrics, key)
 		}
 	}
+
+	mc.kubeletUsageMu.Lock()
+	defer mc.kubeletUsageMu.Unlock()
+	for nodeName, cached := range mc.kubeletUsage {
+		if time.Since(cached.fetchedAt) >= kubeletUsageTTL {
+			delete(mc.kubeletUsage, nodeName)
+		}
+	}
 }
 
 // StartCacheCleanup starts a background goroutine to periodically clean the cache
@@ -31,6 +31,13 @@ type MetricsServerManager struct {
 // InstallRequest represents the installation request payload
 type InstallRequest struct {
 	Type string `json:"type" binding:"required"` // "production" or "local"
+	InstallOptions
+}
+
+// UpgradeRequest represents the upgrade request payload, the install type is kept when empty
+type UpgradeRequest struct {
+	Type string `json:"type,omitempty"`
+	InstallOptions
 }
 
 // MetricsServerStatus represents the status of metrics server
@@ -43,6 +50,8 @@ type MetricsServerStatus struct {
 	Deployment     *DeploymentInfo `json:"deployment,omitempty"`
 	Service        *ServiceInfo    `json:"service,omitempty"`
 	Components     []ComponentInfo `json:"components,omitempty"`
+	// Installation tells who manages the metrics server, it may run outside kube-system
+	Installation *Installation `json:"installation,omitempty"`
 }
 
 // DeploymentInfo contains deployment details
@@ -84,7 +93,7 @@ func NewMetricsServerManager(kubeConfigStore kubeconfig.ContextStore, queue *uti
 
 // GetStatus checks the current status of metrics server in the cluster
 func (m *MetricsServerManager) GetStatus(clusterName string) (*MetricsServerStatus, error) {
-	clientset, _, err := m.getKubernetesClients(clusterName)
+	clientset, restConfig, err := m.getKubernetesClients(clusterName)
 	if err != nil {
 		return &MetricsServerStatus{
 			Installed: false,
@@ -107,6 +116,12 @@ func (m *MetricsServerManager) GetStatus(clusterName string) (*MetricsServerStat
 				Type:   "Deployment",
 				Status: "NotFound",
 			})
+			// Another tool may run it in a different namespace
+			installation, detectErr := detectInstallation(context.Background(), clientset, restConfig.(*rest.Config))
+			if detectErr != nil {
+				logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, detectErr, "Failed to detect metrics server installation")
+			}
+			status.Installation = installation
 			return status, nil
 		}
 		status.Error = fmt.Sprintf("Error checking deployment: %v", err)
@@ -115,6 +130,8 @@ func (m *MetricsServerManager) GetStatus(clusterName string) (*MetricsServerStat
 
 	status.Installed = true
 	status.Ready = deployment.Status.ReadyReplicas > 0 && deployment.Status.ReadyReplicas == deployment.Status.Replicas
+	installation := classify(deployment.Namespace, deployment.Name, deployment.Labels, deployment.Annotations)
+	status.Installation = &installation
 
 	// Extract version and args from deployment
 	if len(deployment.Spec.Template.Spec.Containers) > 0 {
@@ -179,11 +196,20 @@ func (m *MetricsServerManager) GetStatus(clusterName string) (*MetricsServerStat
 	return status, nil
 }
 
-// Install installs metrics server in the cluster using client-go
-func (m *MetricsServerManager) Install(clusterName string, installType string) (*utils.Operation, error) {
+// Install installs metrics server in the cluster using client-go. An existing deployment is
+// updated to the options.
+func (m *MetricsServerManager) Install(clusterName string, installType string, options InstallOptions) (*utils.Operation, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if err := m.checkExisting(clusterName, options.OnExisting); err != nil {
+		return nil, err
+	}
+
 	// Queue the installation operation
 	data := map[string]interface{}{
 		"installType": installType,
+		"options":     options,
 	}
 	tags := []string{"metrics-server", "installation"}
 
@@ -198,8 +224,47 @@ func (m *MetricsServerManager) Install(clusterName string, installType string) (
 	return operation, nil
 }
 
+// Upgrade changes the version and configuration of the metrics server installed in the cluster
+func (m *MetricsServerManager) Upgrade(clusterName string, installType string, options InstallOptions) (*utils.Operation, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if options.OnExisting == ExistingSkip {
+		return nil, fmt.Errorf("%w: an upgrade can't skip the existing installation", ErrInvalidOptions)
+	}
+	if err := m.checkExisting(clusterName, options.OnExisting); err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"installType": installType,
+		"options":     options,
+	}
+	tags := []string{"metrics-server", "upgrade"}
+
+	operation := m.queue.AddOperation("metrics-upgrade", clusterName, "system", data, tags)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"image":       options.image(),
+		"operationId": operation.ID,
+	}, nil, "Queued metrics server upgrade")
+
+	return operation, nil
+}
+
 // Uninstall removes metrics server from the cluster
 func (m *MetricsServerManager) Uninstall(clusterName string) (*utils.Operation, error) {
+	// Never remove resources another tool expects to own
+	installation, err := m.Detect(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if installation != nil && !installation.Removable() {
+		installation.Reason = "uninstall it with " + installation.ManagedBy
+		return nil, &ManagedElsewhereError{Installation: *installation}
+	}
+
 	// Queue the uninstallation operation
 	data := map[string]interface{}{}
 	tags := []string{"metrics-server", "uninstallation"}
@@ -214,6 +279,17 @@ func (m *MetricsServerManager) Uninstall(clusterName string) (*utils.Operation,
 	return operation, nil
 }
 
+// checkExisting refuses to queue an install over a metrics server managed by another tool,
+// unless the decision is to adopt or skip it
+func (m *MetricsServerManager) checkExisting(clusterName string, decision OnExisting) error {
+	installation, err := m.Detect(clusterName)
+	if err != nil {
+		return err
+	}
+	_, err = CheckExisting(installation, decision)
+	return err
+}
+
 // getKubernetesClients creates kubernetes clients for the given cluster
 func (m *MetricsServerManager) getKubernetesClients(clusterName string) (*kubernetes.Clientset, interface{}, error) {
 	ctx, err := m.kubeConfigStore.GetContext(clusterName)
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultImage is the metrics server image repository
+	DefaultImage = "registry.k8s.io/metrics-server/metrics-server"
+	// DefaultVersion is the metrics server version installed when none is requested
+	DefaultVersion = "v0.8.0"
+	// MaxReplicas bounds the replica count of the deployment
+	MaxReplicas = 10
+)
+
+// ErrInvalidOptions is returned for install options that can't be applied
+var ErrInvalidOptions = errors.New("invalid metrics server options")
+
+var versionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+
+// managedArgs are set by the installer, extra args may not change them
+var managedArgs = map[string]bool{
+	"--cert-dir":    true,
+	"--secure-port": true,
+}
+
+// InstallOptions customizes the metrics server deployment. Zero values keep the defaults.
+type InstallOptions struct {
+	// Image is the image repository, without tag
+	Image string `json:"image,omitempty"`
+	// Version is the image tag, e.g. v0.7.2
+	Version  string `json:"version,omitempty"`
+	Replicas int32  `json:"replicas,omitempty"`
+	// NodeSelector is merged over kubernetes.io/os=linux
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	// ExtraArgs are added to the container args, replacing a default arg of the same flag,
+	// e.g. --kubelet-request-timeout=10s or --metric-resolution=30s
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+	// HighAvailability runs at least 2 replicas on distinct nodes, protected by a PodDisruptionBudget
+	HighAvailability bool `json:"highAvailability,omitempty"`
+	// OnExisting decides what happens to a metrics server managed by another tool
+	OnExisting OnExisting `json:"onExisting,omitempty"`
+}
+
+// Validate checks the options
+func (o InstallOptions) Validate() error {
+	// A colon after the last slash is a tag, before it a registry port
+	if o.Image != "" && (strings.ContainsAny(o.Image, "@ ") || strings.Contains(o.Image[strings.LastIndex(o.Image, "/")+1:], ":")) {
+		return fmt.Errorf("%w: image must be a repository without tag or digest, set the version instead", ErrInvalidOptions)
+	}
+	if o.Version != "" && !versionPattern.MatchString(o.Version) {
+		return fmt.Errorf("%w: version %q must look like v0.8.0", ErrInvalidOptions, o.Version)
+	}
+	if o.Replicas < 0 || o.Replicas > MaxReplicas {
+		return fmt.Errorf("%w: replicas must be between 1 and %d", ErrInvalidOptions, MaxReplicas)
+	}
+	if o.HighAvailability && o.Replicas == 1 {
+		return fmt.Errorf("%w: high availability needs at least 2 replicas", ErrInvalidOptions)
+	}
+	switch o.OnExisting {
+	case ExistingFail, ExistingAdopt, ExistingSkip:
+	default:
+		return fmt.Errorf("%w: onExisting must be adopt or skip", ErrInvalidOptions)
+	}
+	for _, arg := range o.ExtraArgs {
+		flag := argFlag(arg)
+		if !strings.HasPrefix(flag, "--") || len(flag) < 3 {
+			return fmt.Errorf("%w: extra arg %q must be a --flag", ErrInvalidOptions, arg)
+		}
+		if managedArgs[flag] {
+			return fmt.Errorf("%w: %s is managed by the installer", ErrInvalidOptions, flag)
+		}
+	}
+	return nil
+}
+
+// image returns the image reference to deploy
+func (o InstallOptions) image() string {
+	image, version := o.Image, o.Version
+	if image == "" {
+		image = DefaultImage
+	}
+	if version == "" {
+		version = DefaultVersion
+	}
+	return image + ":" + version
+}
+
+// replicas returns the replica count to deploy
+func (o InstallOptions) replicas() int32 {
+	switch {
+	case o.Replicas > 0:
+		return o.Replicas
+	case o.HighAvailability:
+		return 2
+	}
+	return 1
+}
+
+// nodeSelector returns the node selector of the pods
+func (o InstallOptions) nodeSelector() map[string]string {
+	selector := map[string]string{"kubernetes.io/os": "linux"}
+	for k, v := range o.NodeSelector {
+		selector[k] = v
+	}
+	return selector
+}
+
+// args returns the container args, the extra args replace defaults of the same flag
+func (o InstallOptions) args(installType string) []string {
+	args := []string{
+		"--cert-dir=/tmp",
+		"--secure-port=10250",
+		"--kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname",
+		"--kubelet-use-node-status-port",
+		"--metric-resolution=15s",
+	}
+
+	// Add insecure TLS for local development
+	if strings.ToLower(installType) == "local" {
+		args = append(args, "--kubelet-insecure-tls")
+	}
+
+	for _, extra := range o.ExtraArgs {
+		replaced := false
+		for i, arg := range args {
+			if argFlag(arg) == argFlag(extra) {
+				args[i] = extra
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			args = append(args, extra)
+		}
+	}
+	return args
+}
+
+func argFlag(arg string) string {
+	flag, _, _ := strings.Cut(arg, "=")
+	return flag
+}
+
+// optionsOf reads the install options of an operation
+func optionsOf(op *utils.Operation) (InstallOptions, error) {
+	var options InstallOptions
+	if op.Data == nil {
+		return options, nil
+	}
+	switch value := op.Data["options"].(type) {
+	case nil:
+		return options, nil
+	case InstallOptions:
+		return value, nil
+	default:
+		// Operations decoded from JSON carry the options as a map
+		data, err := json.Marshal(value)
+		if err != nil {
+			return options, err
+		}
+		if err := json.Unmarshal(data, &options); err != nil {
+			return options, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+		}
+		return options, nil
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+func TestInstallOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options InstallOptions
+		wantErr bool
+	}{
+		{name: "defaults", options: InstallOptions{}},
+		{name: "custom", options: InstallOptions{Image: "registry.local:5000/mirror/metrics-server", Version: "v0.7.2", Replicas: 3, HighAvailability: true, ExtraArgs: []string{"--kubelet-request-timeout=10s"}}},
+		{name: "tagged image", options: InstallOptions{Image: "registry.k8s.io/metrics-server/metrics-server:v0.7.2"}, wantErr: true},
+		{name: "digest image", options: InstallOptions{Image: "metrics-server@sha256:abc"}, wantErr: true},
+		{name: "bad version", options: InstallOptions{Version: "latest"}, wantErr: true},
+		{name: "too many replicas", options: InstallOptions{Replicas: 11}, wantErr: true},
+		{name: "single replica HA", options: InstallOptions{Replicas: 1, HighAvailability: true}, wantErr: true},
+		{name: "positional arg", options: InstallOptions{ExtraArgs: []string{"-v=2"}}, wantErr: true},
+		{name: "managed arg", options: InstallOptions{ExtraArgs: []string{"--secure-port=4443"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.options.Validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("Validate() error = %v, want ErrInvalidOptions", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestInstallOptionsDeployment(t *testing.T) {
+	t.Parallel()
+
+	defaults := InstallOptions{}
+	if got := defaults.image(); got != DefaultImage+":"+DefaultVersion {
+		t.Errorf("image() = %s", got)
+	}
+	if got := defaults.replicas(); got != 1 {
+		t.Errorf("replicas() = %d, want 1", got)
+	}
+	if got := (InstallOptions{HighAvailability: true}).replicas(); got != 2 {
+		t.Errorf("replicas() = %d, want 2 in high availability mode", got)
+	}
+
+	options := InstallOptions{
+		NodeSelector: map[string]string{"node-role": "infra"},
+		ExtraArgs:    []string{"--metric-resolution=30s", "--kubelet-request-timeout=10s"},
+	}
+	args := strings.Join(options.args("local"), " ")
+	if !strings.Contains(args, "--metric-resolution=30s") || strings.Contains(args, "--metric-resolution=15s") {
+		t.Errorf("args() = %s, want the default resolution replaced", args)
+	}
+	if !strings.Contains(args, "--kubelet-request-timeout=10s") || !strings.Contains(args, "--kubelet-insecure-tls") {
+		t.Errorf("args() = %s, want the extra arg and insecure TLS", args)
+	}
+	if selector := options.nodeSelector(); selector["kubernetes.io/os"] != "linux" || selector["node-role"] != "infra" {
+		t.Errorf("nodeSelector() = %v", selector)
+	}
+}
+
+func TestOptionsOf(t *testing.T) {
+	t.Parallel()
+
+	// Options survive a JSON round trip of the operation data
+	op := &utils.Operation{Data: map[string]interface{}{
+		"options": map[string]interface{}{"version": "v0.7.2", "replicas": float64(3), "extraArgs": []interface{}{"--v=2"}},
+	}}
+	options, err := optionsOf(op)
+	if err != nil {
+		t.Fatalf("optionsOf() error = %v", err)
+	}
+	if options.Version != "v0.7.2" || options.Replicas != 3 || len(options.ExtraArgs) != 1 {
+		t.Errorf("optionsOf() = %+v", options)
+	}
+}
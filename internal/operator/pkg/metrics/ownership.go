@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// ManagedByLabel marks the resources created by the installer
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the ManagedByLabel value of the installer
+	ManagedByValue = "agentkube"
+	// MetricsAPIService serves metrics.k8s.io
+	MetricsAPIService = "v1beta1.metrics.k8s.io"
+)
+
+// Tools an existing installation can be managed by
+const (
+	ManagedByHelm         = "helm"
+	ManagedByAddonManager = "addon-manager"
+	ManagedByEKS          = "eks-addon"
+	ManagedByAKS          = "aks"
+	ManagedByUnknown      = "unknown"
+)
+
+// OnExisting decides what an install does with a metrics server managed by another tool
+type OnExisting string
+
+const (
+	// ExistingFail refuses to install, reporting the existing installation
+	ExistingFail OnExisting = ""
+	// ExistingAdopt takes over the existing installation and reconciles it to the options
+	ExistingAdopt OnExisting = "adopt"
+	// ExistingSkip leaves the existing installation untouched
+	ExistingSkip OnExisting = "skip"
+)
+
+const (
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	addonManagerModeLabel          = "addonmanager.kubernetes.io/mode"
+)
+
+// ErrManagedElsewhere is returned when the metrics server of a cluster is managed by another tool
+var ErrManagedElsewhere = errors.New("metrics server is managed by another tool")
+
+// ManagedElsewhereError reports the installation that blocks an operation
+type ManagedElsewhereError struct {
+	Installation Installation
+}
+
+func (e *ManagedElsewhereError) Error() string {
+	message := fmt.Sprintf("metrics server in %s/%s is managed by %s", e.Installation.Namespace, e.Installation.Name, e.Installation.ManagedBy)
+	if e.Installation.Release != "" {
+		message += " (release " + e.Installation.Release + ")"
+	}
+	if e.Installation.Reason != "" {
+		message += ": " + e.Installation.Reason
+	}
+	return message
+}
+
+// Is matches ErrManagedElsewhere
+func (e *ManagedElsewhereError) Is(target error) bool {
+	return target == ErrManagedElsewhere
+}
+
+// Installation is a metrics server found in a cluster
+type Installation struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ManagedBy is agentkube, helm, addon-manager, eks-addon, aks, unknown or the managed-by label
+	ManagedBy string `json:"managedBy"`
+	// Release is the Helm release, namespace/name
+	Release string `json:"release,omitempty"`
+	// Adoptable tells whether the installer can take the installation over
+	Adoptable bool `json:"adoptable"`
+	// Reason explains why the installation can't be adopted, or what adopting it implies
+	Reason string `json:"reason,omitempty"`
+}
+
+// Managed reports whether the installer manages the installation
+func (i Installation) Managed() bool {
+	return i.ManagedBy == ManagedByValue
+}
+
+// Removable reports whether uninstalling leaves no other tool with missing resources
+func (i Installation) Removable() bool {
+	return i.Managed() || (i.ManagedBy == ManagedByUnknown && i.Adoptable)
+}
+
+// CheckExisting applies the OnExisting decision to an installation found in the cluster, it returns
+// whether the install must be skipped
+func CheckExisting(installation *Installation, decision OnExisting) (bool, error) {
+	if installation == nil || installation.Managed() {
+		return false, nil
+	}
+	switch decision {
+	case ExistingSkip:
+		return true, nil
+	case ExistingAdopt:
+		if installation.Adoptable {
+			return false, nil
+		}
+	}
+	return false, &ManagedElsewhereError{Installation: *installation}
+}
+
+// classify tells who manages a metrics server from the labels and annotations of its deployment
+func classify(namespace, name string, labels, annotations map[string]string) Installation {
+	installation := Installation{Namespace: namespace, Name: name, Adoptable: true}
+
+	managedBy := labels[ManagedByLabel]
+	switch {
+	case managedBy == ManagedByValue:
+		installation.ManagedBy = ManagedByValue
+	case annotations[helmReleaseNameAnnotation] != "" || managedBy == "Helm":
+		installation.ManagedBy = ManagedByHelm
+		if release := annotations[helmReleaseNameAnnotation]; release != "" {
+			installation.Release = annotations[helmReleaseNamespaceAnnotation] + "/" + release
+		}
+		installation.Reason = "the Helm release keeps its manifest, upgrading or uninstalling it would undo the adoption"
+	case labels[addonManagerModeLabel] != "":
+		installation.ManagedBy = ManagedByAddonManager
+		if labels[addonManagerModeLabel] == "Reconcile" {
+			installation.Adoptable = false
+			installation.Reason = "the addon manager reconciles it and would revert any change"
+		}
+	case labels["eks.amazonaws.com/component"] != "" || managedBy == "EKS":
+		installation.ManagedBy = ManagedByEKS
+		installation.Adoptable = false
+		installation.Reason = "it is an EKS add-on, configure it through the add-on"
+	case labels["kubernetes.azure.com/managedby"] == "aks":
+		installation.ManagedBy = ManagedByAKS
+		installation.Adoptable = false
+		installation.Reason = "it is managed by AKS"
+	case managedBy != "":
+		installation.ManagedBy = managedBy
+		installation.Reason = managedBy + " may revert the changes of the installer"
+	default:
+		installation.ManagedBy = ManagedByUnknown
+		installation.Reason = "it was applied from a manifest or by an earlier installer version"
+	}
+
+	if installation.Adoptable && (namespace != MetricsServerNamespace || name != MetricsServerName) {
+		installation.Adoptable = false
+		installation.Reason = fmt.Sprintf("only %s/%s can be adopted, uninstall it or keep it", MetricsServerNamespace, MetricsServerName)
+	}
+	return installation
+}
+
+var apiServiceGVR = schema.GroupVersionResource{
+	Group:    "apiregistration.k8s.io",
+	Version:  "v1",
+	Resource: "apiservices",
+}
+
+// Detect finds the metrics server installed in a cluster, nil when there is none
+func (m *MetricsServerManager) Detect(clusterName string) (*Installation, error) {
+	clientset, restConfig, err := m.getKubernetesClients(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return detectInstallation(context.Background(), clientset, restConfig.(*rest.Config))
+}
+
+// detectInstallation finds the metrics server serving metrics.k8s.io, or the one in kube-system
+func detectInstallation(ctx context.Context, clientset *kubernetes.Clientset, restConfig *rest.Config) (*Installation, error) {
+	namespace, name := MetricsServerNamespace, MetricsServerName
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	apiService, err := dynamicClient.Resource(apiServiceGVR).Get(ctx, MetricsAPIService, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		serviceNamespace, _, _ := unstructured.NestedString(apiService.Object, "spec", "service", "namespace")
+		serviceName, _, _ := unstructured.NestedString(apiService.Object, "spec", "service", "name")
+		if serviceNamespace != "" && serviceName != "" {
+			namespace, name = serviceNamespace, serviceName
+		}
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("failed to get APIService %s: %w", MetricsAPIService, err)
+	}
+
+	deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		installation := classify(namespace, deployment.Name, deployment.Labels, deployment.Annotations)
+		return &installation, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Charts name the deployment after the release, find it by its labels
+	for _, selector := range []string{"app.kubernetes.io/name=metrics-server", ComponentLabel + "=" + ComponentValue} {
+		deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		if len(deployments.Items) > 0 {
+			found := deployments.Items[0]
+			installation := classify(namespace, found.Name, found.Labels, found.Annotations)
+			return &installation, nil
+		}
+	}
+	return nil, nil
+}
+
+// adoptInstallation labels the resources of an existing metrics server as managed by the installer
+// and drops their Helm release annotations
+func adoptInstallation(ctx context.Context, clientset *kubernetes.Clientset, restConfig *rest.Config) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:%q},"annotations":{%q:null,%q:null}}}`,
+		ManagedByLabel, ManagedByValue, helmReleaseNameAnnotation, helmReleaseNamespaceAnnotation))
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	type target struct {
+		gvr       schema.GroupVersionResource
+		namespace string
+		names     []string
+	}
+	targets := []target{
+		{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, MetricsServerNamespace, []string{MetricsServerName}},
+		{schema.GroupVersionResource{Version: "v1", Resource: "services"}, MetricsServerNamespace, []string{MetricsServerName}},
+		{schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, MetricsServerNamespace, []string{MetricsServerName}},
+		{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, MetricsServerNamespace, []string{"metrics-server-auth-reader"}},
+		{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, "", []string{"system:aggregated-metrics-reader", "system:metrics-server"}},
+		{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, "", []string{"metrics-server:system:auth-delegator", "system:metrics-server"}},
+		{apiServiceGVR, "", []string{MetricsAPIService}},
+	}
+
+	for _, t := range targets {
+		for _, name := range t.names {
+			var resource dynamic.ResourceInterface = dynamicClient.Resource(t.gvr)
+			if t.namespace != "" {
+				resource = dynamicClient.Resource(t.gvr).Namespace(t.namespace)
+			}
+			_, err := resource.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to adopt %s %s: %w", t.gvr.Resource, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		namespace     string
+		labels        map[string]string
+		annotations   map[string]string
+		wantManagedBy string
+		wantRelease   string
+		wantAdoptable bool
+	}{
+		{name: "installer", namespace: MetricsServerNamespace, labels: map[string]string{ManagedByLabel: ManagedByValue}, wantManagedBy: ManagedByValue, wantAdoptable: true},
+		{
+			name:          "helm",
+			namespace:     MetricsServerNamespace,
+			labels:        map[string]string{ManagedByLabel: "Helm"},
+			annotations:   map[string]string{helmReleaseNameAnnotation: "metrics-server", helmReleaseNamespaceAnnotation: "kube-system"},
+			wantManagedBy: ManagedByHelm,
+			wantRelease:   "kube-system/metrics-server",
+			wantAdoptable: true,
+		},
+		{name: "reconciled addon", namespace: MetricsServerNamespace, labels: map[string]string{addonManagerModeLabel: "Reconcile"}, wantManagedBy: ManagedByAddonManager},
+		{name: "ensured addon", namespace: MetricsServerNamespace, labels: map[string]string{addonManagerModeLabel: "EnsureExists"}, wantManagedBy: ManagedByAddonManager, wantAdoptable: true},
+		{name: "eks addon", namespace: MetricsServerNamespace, labels: map[string]string{"eks.amazonaws.com/component": "metrics-server"}, wantManagedBy: ManagedByEKS},
+		{name: "other tool", namespace: MetricsServerNamespace, labels: map[string]string{ManagedByLabel: "argocd"}, wantManagedBy: "argocd", wantAdoptable: true},
+		{name: "manifest", namespace: MetricsServerNamespace, wantManagedBy: ManagedByUnknown, wantAdoptable: true},
+		{name: "other namespace", namespace: "monitoring", labels: map[string]string{ManagedByLabel: "Helm"}, wantManagedBy: ManagedByHelm},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := classify(tt.namespace, MetricsServerName, tt.labels, tt.annotations)
+			if got.ManagedBy != tt.wantManagedBy || got.Release != tt.wantRelease || got.Adoptable != tt.wantAdoptable {
+				t.Errorf("classify() = %+v, want managed by %s, release %q, adoptable %v", got, tt.wantManagedBy, tt.wantRelease, tt.wantAdoptable)
+			}
+		})
+	}
+}
+
+func TestCheckExisting(t *testing.T) {
+	t.Parallel()
+
+	helm := &Installation{Namespace: MetricsServerNamespace, Name: MetricsServerName, ManagedBy: ManagedByHelm, Adoptable: true}
+	eks := &Installation{Namespace: MetricsServerNamespace, Name: MetricsServerName, ManagedBy: ManagedByEKS}
+	owned := &Installation{ManagedBy: ManagedByValue, Adoptable: true}
+
+	tests := []struct {
+		name         string
+		installation *Installation
+		decision     OnExisting
+		wantSkip     bool
+		wantErr      bool
+	}{
+		{name: "none", installation: nil},
+		{name: "owned", installation: owned},
+		{name: "foreign without decision", installation: helm, wantErr: true},
+		{name: "adopt", installation: helm, decision: ExistingAdopt},
+		{name: "skip", installation: helm, decision: ExistingSkip, wantSkip: true},
+		{name: "adopt not adoptable", installation: eks, decision: ExistingAdopt, wantErr: true},
+		{name: "skip not adoptable", installation: eks, decision: ExistingSkip, wantSkip: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			skip, err := CheckExisting(tt.installation, tt.decision)
+			if skip != tt.wantSkip {
+				t.Errorf("CheckExisting() skip = %v, want %v", skip, tt.wantSkip)
+			}
+			if tt.wantErr != errors.Is(err, ErrManagedElsewhere) {
+				t.Errorf("CheckExisting() error = %v, want ErrManagedElsewhere %v", err, tt.wantErr)
+			}
+		})
+	}
+}
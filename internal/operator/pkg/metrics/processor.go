@@ -3,13 +3,13 @@ package metrics
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/agentkube/operator/pkg/logger"
 	"github.com/agentkube/operator/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -21,6 +21,7 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 )
 
 // MetricsProcessor handles the actual installation/uninstallation of metrics server
@@ -42,6 +43,8 @@ func (p *MetricsProcessor) ProcessOperation(op *utils.Operation) error {
 		return p.processInstall(op)
 	case "metrics-uninstall":
 		return p.processUninstall(op)
+	case "metrics-upgrade":
+		return p.processUpgrade(op)
 	default:
 		return fmt.Errorf("unsupported operation type: %s", op.Type)
 	}
@@ -49,7 +52,7 @@ func (p *MetricsProcessor) ProcessOperation(op *utils.Operation) error {
 
 // CanProcess returns true if this processor can handle the operation type
 func (p *MetricsProcessor) CanProcess(operationType string) bool {
-	return operationType == "metrics-install" || operationType == "metrics-uninstall"
+	return operationType == "metrics-install" || operationType == "metrics-uninstall" || operationType == "metrics-upgrade"
 }
 
 // processInstall handles the installation of metrics server
@@ -62,10 +65,15 @@ func (p *MetricsProcessor) processInstall(op *utils.Operation) error {
 			installType = t
 		}
 	}
+	options, err := optionsOf(op)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
 
 	logger.Log(logger.LevelInfo, map[string]string{
 		"cluster":     clusterName,
 		"type":        installType,
+		"image":       options.image(),
 		"operationId": op.ID,
 	}, nil, "Starting metrics server installation")
 
@@ -78,6 +86,17 @@ func (p *MetricsProcessor) processInstall(op *utils.Operation) error {
 		return fmt.Errorf("failed to create kubernetes clients: %w", err)
 	}
 
+	// The cluster may have changed since the install was requested
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 15, "Detecting existing installation", nil)
+	skip, err := p.prepareExisting(clientset, restConfig.(*rest.Config), options.OnExisting)
+	if err != nil {
+		return err
+	}
+	if skip {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Metrics server is managed by another tool, installation skipped", nil)
+		return nil
+	}
+
 	// Install components step by step
 	steps := []struct {
 		name     string
@@ -89,7 +108,8 @@ func (p *MetricsProcessor) processInstall(op *utils.Operation) error {
 		{"Creating RoleBinding", 40, func() error { return p.createRoleBinding(clientset) }},
 		{"Creating ClusterRoleBindings", 50, func() error { return p.createClusterRoleBindings(clientset) }},
 		{"Creating Service", 60, func() error { return p.createService(clientset) }},
-		{"Creating Deployment", 70, func() error { return p.createDeployment(clientset, installType) }},
+		{"Creating Deployment", 70, func() error { return p.createDeployment(clientset, installType, options) }},
+		{"Configuring PodDisruptionBudget", 75, func() error { return p.applyDisruptionBudget(clientset, options) }},
 		{"Creating APIService", 80, func() error { return p.createAPIService(restConfig) }},
 		{"Verifying installation", 90, func() error { return p.verifyInstallation(clientset) }},
 	}
@@ -136,6 +156,7 @@ func (p *MetricsProcessor) processUninstall(op *utils.Operation) error {
 		fn       func() error
 	}{
 		{"Deleting Deployment", 20, func() error { return p.deleteDeployment(clientset) }},
+		{"Deleting PodDisruptionBudget", 22, func() error { return p.deleteDisruptionBudget(clientset) }},
 		{"Deleting APIService", 25, func() error { return p.deleteAPIService(restConfig) }},
 		{"Deleting Service", 30, func() error { return p.deleteService(clientset) }},
 		{"Deleting ClusterRoleBindings", 40, func() error { return p.deleteClusterRoleBindings(clientset) }},
@@ -166,6 +187,106 @@ func (p *MetricsProcessor) processUninstall(op *utils.Operation) error {
 	return nil
 }
 
+// processUpgrade changes the version and configuration of an installed metrics server in place
+func (p *MetricsProcessor) processUpgrade(op *utils.Operation) error {
+	clusterName := op.Target
+	options, err := optionsOf(op)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"image":       options.image(),
+		"operationId": op.ID,
+	}, nil, "Starting metrics server upgrade")
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+
+	clientset, restConfig, err := p.manager.getKubernetesClients(clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clients: %w", err)
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 15, "Detecting existing installation", nil)
+	if _, err := p.prepareExisting(clientset, restConfig.(*rest.Config), options.OnExisting); err != nil {
+		return err
+	}
+
+	existing, err := clientset.AppsV1().Deployments(MetricsServerNamespace).Get(
+		context.Background(), MetricsServerName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return utils.NonRetryable(fmt.Errorf("metrics server is not installed"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get metrics server deployment: %w", err)
+	}
+
+	// Keep the kubelet TLS mode of the installation unless the upgrade sets it
+	installType := "production"
+	if t, ok := op.Data["installType"].(string); ok && t != "" {
+		installType = t
+	} else if len(existing.Spec.Template.Spec.Containers) > 0 {
+		for _, arg := range existing.Spec.Template.Spec.Containers[0].Args {
+			if arg == "--kubelet-insecure-tls" {
+				installType = "local"
+			}
+		}
+	}
+
+	steps := []struct {
+		name     string
+		progress int
+		fn       func() error
+	}{
+		{"Updating Deployment", 30, func() error { return p.createDeployment(clientset, installType, options) }},
+		{"Configuring PodDisruptionBudget", 50, func() error { return p.applyDisruptionBudget(clientset, options) }},
+		{"Verifying rollout", 70, func() error { return p.verifyInstallation(clientset) }},
+	}
+
+	for _, step := range steps {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, step.progress, step.name, nil)
+		if err := step.fn(); err != nil {
+			return fmt.Errorf("failed at step '%s': %w", step.name, err)
+		}
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Metrics server upgrade completed successfully", nil)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"operationId": op.ID,
+	}, nil, "Metrics server upgrade completed")
+
+	return nil
+}
+
+// prepareExisting applies the OnExisting decision to the metrics server found in the cluster,
+// adopting it when asked. It returns whether the operation must be skipped.
+func (p *MetricsProcessor) prepareExisting(clientset *kubernetes.Clientset, restConfig *rest.Config, decision OnExisting) (bool, error) {
+	installation, err := detectInstallation(context.Background(), clientset, restConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect existing installation: %w", err)
+	}
+	skip, err := CheckExisting(installation, decision)
+	if err != nil {
+		return false, utils.NonRetryable(err)
+	}
+	if skip || installation == nil || installation.Managed() {
+		return skip, nil
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"namespace": installation.Namespace,
+		"name":      installation.Name,
+		"managedBy": installation.ManagedBy,
+	}, nil, "Adopting existing metrics server installation")
+	if err := adoptInstallation(context.Background(), clientset, restConfig); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
 // createServiceAccount creates the metrics server service account
 func (p *MetricsProcessor) createServiceAccount(clientset *kubernetes.Clientset) error {
 	sa := &corev1.ServiceAccount{
@@ -174,6 +295,7 @@ func (p *MetricsProcessor) createServiceAccount(clientset *kubernetes.Clientset)
 			Namespace: MetricsServerNamespace,
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 	}
@@ -194,6 +316,7 @@ func (p *MetricsProcessor) createClusterRoles(clientset *kubernetes.Clientset) e
 			Name: "system:aggregated-metrics-reader",
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 				"rbac.authorization.k8s.io/aggregate-to-admin": "true",
 				"rbac.authorization.k8s.io/aggregate-to-edit":  "true",
 				"rbac.authorization.k8s.io/aggregate-to-view":  "true",
@@ -220,6 +343,7 @@ func (p *MetricsProcessor) createClusterRoles(clientset *kubernetes.Clientset) e
 			Name: "system:metrics-server",
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		Rules: []rbacv1.PolicyRule{
@@ -253,6 +377,7 @@ func (p *MetricsProcessor) createRoleBinding(clientset *kubernetes.Clientset) er
 			Namespace: MetricsServerNamespace,
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		RoleRef: rbacv1.RoleRef{
@@ -285,6 +410,7 @@ func (p *MetricsProcessor) createClusterRoleBindings(clientset *kubernetes.Clien
 			Name: "metrics-server:system:auth-delegator",
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		RoleRef: rbacv1.RoleRef{
@@ -313,6 +439,7 @@ func (p *MetricsProcessor) createClusterRoleBindings(clientset *kubernetes.Clien
 			Name: "system:metrics-server",
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		RoleRef: rbacv1.RoleRef{
@@ -346,6 +473,7 @@ func (p *MetricsProcessor) createService(clientset *kubernetes.Clientset) error
 			Namespace: MetricsServerNamespace,
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		Spec: corev1.ServiceSpec{
@@ -372,29 +500,39 @@ func (p *MetricsProcessor) createService(clientset *kubernetes.Clientset) error
 	return nil
 }
 
-// createDeployment creates the metrics server deployment
-func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, installType string) error {
-	// Base args for metrics server
-	args := []string{
-		"--cert-dir=/tmp",
-		"--secure-port=10250",
-		"--kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname",
-		"--kubelet-use-node-status-port",
-		"--metric-resolution=15s",
-	}
-
-	// Add insecure TLS for local development
-	if strings.ToLower(installType) == "local" {
-		args = append(args, "--kubelet-insecure-tls")
+// createDeployment creates the metrics server deployment, or updates an existing one to the options
+func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, installType string, options InstallOptions) error {
+	args := options.args(installType)
+	replicas := options.replicas()
+
+	maxUnavailable := intstr.FromInt32(0)
+	var affinity *corev1.Affinity
+	if options.HighAvailability {
+		// Replicas run on distinct nodes, one at a time may be replaced
+		maxUnavailable = intstr.FromInt32(1)
+		affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+					{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								ComponentLabel: ComponentValue,
+							},
+						},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+				},
+			},
+		}
 	}
 
-	replicas := int32(1)
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      MetricsServerName,
 			Namespace: MetricsServerNamespace,
 			Labels: map[string]string{
 				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
@@ -406,7 +544,7 @@ func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, ins
 			},
 			Strategy: appsv1.DeploymentStrategy{
 				RollingUpdate: &appsv1.RollingUpdateDeployment{
-					MaxUnavailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 0},
+					MaxUnavailable: &maxUnavailable,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
@@ -420,7 +558,7 @@ func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, ins
 					Containers: []corev1.Container{
 						{
 							Name:            MetricsServerName,
-							Image:           "registry.k8s.io/metrics-server/metrics-server:v0.8.0",
+							Image:           options.image(),
 							ImagePullPolicy: corev1.PullIfNotPresent,
 							Args:            args,
 							Ports: []corev1.ContainerPort{
@@ -479,9 +617,9 @@ func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, ins
 							},
 						},
 					},
-					NodeSelector: map[string]string{
-						"kubernetes.io/os": "linux",
-					},
+					NodeSelector:      options.nodeSelector(),
+					Tolerations:       options.Tolerations,
+					Affinity:          affinity,
 					PriorityClassName: "system-cluster-critical",
 					Volumes: []corev1.Volume{
 						{
@@ -498,10 +636,75 @@ func (p *MetricsProcessor) createDeployment(clientset *kubernetes.Clientset, ins
 
 	_, err := clientset.AppsV1().Deployments(MetricsServerNamespace).Create(
 		context.Background(), deployment, metav1.CreateOptions{})
-	if err != nil && !errors.IsAlreadyExists(err) {
+	if err == nil || !errors.IsAlreadyExists(err) {
 		return err
 	}
-	return nil
+
+	// Patch the existing deployment to the requested version and configuration
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := clientset.AppsV1().Deployments(MetricsServerNamespace).Get(
+			context.Background(), MetricsServerName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		existing.Labels[ComponentLabel] = ComponentValue
+		existing.Labels[ManagedByLabel] = ManagedByValue
+		// The selector is immutable
+		deployment.Spec.Selector = existing.Spec.Selector
+		existing.Spec = deployment.Spec
+		_, err = clientset.AppsV1().Deployments(MetricsServerNamespace).Update(
+			context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// applyDisruptionBudget keeps one replica available during voluntary disruptions in high
+// availability mode, and removes the budget otherwise
+func (p *MetricsProcessor) applyDisruptionBudget(clientset *kubernetes.Clientset, options InstallOptions) error {
+	if !options.HighAvailability {
+		return p.deleteDisruptionBudget(clientset)
+	}
+
+	minAvailable := intstr.FromInt32(1)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      MetricsServerName,
+			Namespace: MetricsServerNamespace,
+			Labels: map[string]string{
+				ComponentLabel: ComponentValue,
+				ManagedByLabel: ManagedByValue,
+			},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					ComponentLabel: ComponentValue,
+				},
+			},
+		},
+	}
+
+	_, err := clientset.PolicyV1().PodDisruptionBudgets(MetricsServerNamespace).Create(
+		context.Background(), pdb, metav1.CreateOptions{})
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := clientset.PolicyV1().PodDisruptionBudgets(MetricsServerNamespace).Get(
+			context.Background(), MetricsServerName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Spec = pdb.Spec
+		_, err = clientset.PolicyV1().PodDisruptionBudgets(MetricsServerNamespace).Update(
+			context.Background(), existing, metav1.UpdateOptions{})
+		return err
+	})
 }
 
 // createAPIService creates the APIService for metrics server
@@ -528,6 +731,7 @@ func (p *MetricsProcessor) createAPIService(restConfig interface{}) error {
 				"name": "v1beta1.metrics.k8s.io",
 				"labels": map[string]interface{}{
 					ComponentLabel: ComponentValue,
+					ManagedByLabel: ManagedByValue,
 				},
 			},
 			"spec": map[string]interface{}{
@@ -606,6 +810,15 @@ func (p *MetricsProcessor) deleteDeployment(clientset *kubernetes.Clientset) err
 	return nil
 }
 
+func (p *MetricsProcessor) deleteDisruptionBudget(clientset *kubernetes.Clientset) error {
+	err := clientset.PolicyV1().PodDisruptionBudgets(MetricsServerNamespace).Delete(
+		context.Background(), MetricsServerName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 func (p *MetricsProcessor) deleteService(clientset *kubernetes.Clientset) error {
 	err := clientset.CoreV1().Services(MetricsServerNamespace).Delete(
 		context.Background(), MetricsServerName, metav1.DeleteOptions{})
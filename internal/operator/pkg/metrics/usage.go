@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// ErrMetricsUnavailable is returned when the cluster doesn't serve the metrics.k8s.io API, because
+// metrics server isn't installed or isn't ready yet
+var ErrMetricsUnavailable = errors.New("metrics.k8s.io is not available, metrics server is not installed or not ready")
+
+// metricsAPIPath is the resource metrics API served by metrics server
+const metricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+
+// ResourceUsage is the CPU and memory in use, as last scraped by metrics server
+type ResourceUsage struct {
+	CPUMillis   int64 `json:"cpuMillis"`
+	MemoryBytes int64 `json:"memoryBytes"`
+}
+
+func (u *ResourceUsage) add(other ResourceUsage) {
+	u.CPUMillis += other.CPUMillis
+	u.MemoryBytes += other.MemoryBytes
+}
+
+// NodeResourceUsage is the usage of a node, against what pods may use on it
+type NodeResourceUsage struct {
+	Name string `json:"name"`
+	ResourceUsage
+	// Allocatable, CPUPercent and MemoryPercent are missing when the node couldn't be read
+	Allocatable   *ResourceUsage `json:"allocatable,omitempty"`
+	CPUPercent    *float64       `json:"cpuPercent,omitempty"`
+	MemoryPercent *float64       `json:"memoryPercent,omitempty"`
+	Timestamp     time.Time      `json:"timestamp"`
+	Window        string         `json:"window"`
+}
+
+// PodResourceUsage is the usage of a pod, summed over its containers
+type PodResourceUsage struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	ResourceUsage
+	Containers []ContainerResourceUsage `json:"containers"`
+	Timestamp  time.Time                `json:"timestamp"`
+	Window     string                   `json:"window"`
+}
+
+// ContainerResourceUsage is the usage of a container of a pod
+type ContainerResourceUsage struct {
+	Name string `json:"name"`
+	ResourceUsage
+}
+
+// NamespaceResourceUsage rolls up the usage of the pods of a namespace
+type NamespaceResourceUsage struct {
+	Namespace string `json:"namespace"`
+	Pods      int    `json:"pods"`
+	ResourceUsage
+}
+
+// NodeUsageReport is the usage of the nodes of a cluster, busiest CPU first
+type NodeUsageReport struct {
+	Nodes []NodeResourceUsage `json:"nodes"`
+	Total ResourceUsage       `json:"total"`
+	// Warnings report what is missing from the report, e.g. the allocatable resources of nodes
+	// that couldn't be listed
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PodUsageReport is the usage of the pods of a cluster or namespace, busiest CPU first
+type PodUsageReport struct {
+	Pods  []PodResourceUsage `json:"pods"`
+	Total ResourceUsage      `json:"total"`
+}
+
+// FetchNodeUsage reads the usage of every node from metrics server, with the share of the
+// allocatable resources of the node it represents. Nodes that can't be listed only lose the
+// percentages, reported in the warnings.
+func FetchNodeUsage(ctx context.Context, clientset kubernetes.Interface) (*NodeUsageReport, error) {
+	list := &v1beta1.NodeMetricsList{}
+	if err := getMetrics(ctx, clientset, metricsAPIPath+"/nodes", list); err != nil {
+		return nil, err
+	}
+
+	report := &NodeUsageReport{}
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("failed to list nodes, allocatable resources are omitted: %v", err))
+		nodes = &corev1.NodeList{}
+	}
+	report.Nodes = nodeResourceUsages(list.Items, nodes.Items)
+	for _, node := range report.Nodes {
+		report.Total.add(node.ResourceUsage)
+	}
+	return report, nil
+}
+
+// FetchPodUsage reads the usage of the pods of a namespace from metrics server, or of every pod
+// when the namespace is empty
+func FetchPodUsage(ctx context.Context, clientset kubernetes.Interface, namespace string) (*PodUsageReport, error) {
+	path := metricsAPIPath + "/pods"
+	if namespace != "" {
+		path = fmt.Sprintf("%s/namespaces/%s/pods", metricsAPIPath, namespace)
+	}
+	list := &v1beta1.PodMetricsList{}
+	if err := getMetrics(ctx, clientset, path, list); err != nil {
+		return nil, err
+	}
+
+	report := &PodUsageReport{Pods: podUsage(list.Items)}
+	for _, pod := range report.Pods {
+		report.Total.add(pod.ResourceUsage)
+	}
+	return report, nil
+}
+
+// Namespaces rolls up the usage of the pods of the report by namespace, busiest CPU first
+func (r *PodUsageReport) Namespaces() []NamespaceResourceUsage {
+	byNamespace := map[string]*NamespaceResourceUsage{}
+	for _, pod := range r.Pods {
+		rollup, ok := byNamespace[pod.Namespace]
+		if !ok {
+			rollup = &NamespaceResourceUsage{Namespace: pod.Namespace}
+			byNamespace[pod.Namespace] = rollup
+		}
+		rollup.Pods++
+		rollup.add(pod.ResourceUsage)
+	}
+
+	namespaces := make([]NamespaceResourceUsage, 0, len(byNamespace))
+	for _, rollup := range byNamespace {
+		namespaces = append(namespaces, *rollup)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return busier(namespaces[i].ResourceUsage, namespaces[j].ResourceUsage, namespaces[i].Namespace, namespaces[j].Namespace)
+	})
+	return namespaces
+}
+
+// getMetrics reads a list of the resource metrics API, telling a cluster without metrics server
+// from other failures
+func getMetrics(ctx context.Context, clientset kubernetes.Interface, path string, into interface{}) error {
+	data, err := clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+			return fmt.Errorf("%w: %v", ErrMetricsUnavailable, err)
+		}
+		return fmt.Errorf("failed to get resource metrics: %w", err)
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("failed to parse resource metrics: %w", err)
+	}
+	return nil
+}
+
+func nodeResourceUsages(metrics []v1beta1.NodeMetrics, nodes []corev1.Node) []NodeResourceUsage {
+	allocatable := make(map[string]corev1.ResourceList, len(nodes))
+	for _, node := range nodes {
+		allocatable[node.Name] = node.Status.Allocatable
+	}
+
+	usage := make([]NodeResourceUsage, 0, len(metrics))
+	for _, m := range metrics {
+		node := NodeResourceUsage{
+			Name:          m.Name,
+			ResourceUsage: usageOf(m.Usage),
+			Timestamp:     m.Timestamp.Time,
+			Window:        m.Window.Duration.String(),
+		}
+		if resources, ok := allocatable[m.Name]; ok {
+			node.Allocatable = &ResourceUsage{
+				CPUMillis:   resources.Cpu().MilliValue(),
+				MemoryBytes: resources.Memory().Value(),
+			}
+			node.CPUPercent = percent(node.CPUMillis, node.Allocatable.CPUMillis)
+			node.MemoryPercent = percent(node.MemoryBytes, node.Allocatable.MemoryBytes)
+		}
+		usage = append(usage, node)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return busier(usage[i].ResourceUsage, usage[j].ResourceUsage, usage[i].Name, usage[j].Name)
+	})
+	return usage
+}
+
+func podUsage(metrics []v1beta1.PodMetrics) []PodResourceUsage {
+	usage := make([]PodResourceUsage, 0, len(metrics))
+	for _, m := range metrics {
+		pod := PodResourceUsage{
+			Namespace:  m.Namespace,
+			Name:       m.Name,
+			Containers: make([]ContainerResourceUsage, 0, len(m.Containers)),
+			Timestamp:  m.Timestamp.Time,
+			Window:     m.Window.Duration.String(),
+		}
+		for _, container := range m.Containers {
+			containerUsage := usageOf(container.Usage)
+			pod.Containers = append(pod.Containers, ContainerResourceUsage{Name: container.Name, ResourceUsage: containerUsage})
+			pod.add(containerUsage)
+		}
+		usage = append(usage, pod)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return busier(usage[i].ResourceUsage, usage[j].ResourceUsage, usage[i].Namespace+"/"+usage[i].Name, usage[j].Namespace+"/"+usage[j].Name)
+	})
+	return usage
+}
+
+func usageOf(resources corev1.ResourceList) ResourceUsage {
+	return ResourceUsage{CPUMillis: resources.Cpu().MilliValue(), MemoryBytes: resources.Memory().Value()}
+}
+
+// busier orders by CPU then memory descending, then by name for a stable order
+func busier(a, b ResourceUsage, aName, bName string) bool {
+	if a.CPUMillis != b.CPUMillis {
+		return a.CPUMillis > b.CPUMillis
+	}
+	if a.MemoryBytes != b.MemoryBytes {
+		return a.MemoryBytes > b.MemoryBytes
+	}
+	return aName < bName
+}
+
+// percent returns used as a percentage of total rounded to a tenth, nil when total is unknown
+func percent(used, total int64) *float64 {
+	if total <= 0 {
+		return nil
+	}
+	value := float64(used*1000/total) / 10
+	return &value
+}
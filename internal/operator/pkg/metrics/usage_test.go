@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func TestNodeUsage(t *testing.T) {
+	t.Parallel()
+
+	data := `{"kind":"NodeMetricsList","items":[
+		{"metadata":{"name":"node-a"},"timestamp":"2024-05-01T10:00:00Z","window":"20s","usage":{"cpu":"500m","memory":"1Gi"}},
+		{"metadata":{"name":"node-b"},"timestamp":"2024-05-01T10:00:00Z","window":"20s","usage":{"cpu":"1500m","memory":"512Mi"}}
+	]}`
+	list := &v1beta1.NodeMetricsList{}
+	if err := json.Unmarshal([]byte(data), list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	nodes := []corev1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("4Gi"),
+		}},
+	}}
+
+	usage := nodeResourceUsages(list.Items, nodes)
+	if len(usage) != 2 || usage[0].Name != "node-b" || usage[1].Name != "node-a" {
+		t.Fatalf("nodeResourceUsages() = %+v, want node-b then node-a", usage)
+	}
+	a := usage[1]
+	if a.CPUMillis != 500 || a.MemoryBytes != 1<<30 || a.Window != "20s" {
+		t.Errorf("node-a usage = %+v", a)
+	}
+	if a.CPUPercent == nil || *a.CPUPercent != 25 || a.MemoryPercent == nil || *a.MemoryPercent != 25 {
+		t.Errorf("node-a percentages = %v %v, want 25 25", a.CPUPercent, a.MemoryPercent)
+	}
+	if b := usage[0]; b.Allocatable != nil || b.CPUPercent != nil {
+		t.Errorf("node-b = %+v, want no percentages without the node", b)
+	}
+}
+
+func TestPodUsageNamespaces(t *testing.T) {
+	t.Parallel()
+
+	data := `{"kind":"PodMetricsList","items":[
+		{"metadata":{"name":"api","namespace":"shop"},"window":"15s","containers":[
+			{"name":"app","usage":{"cpu":"200m","memory":"100Mi"}},{"name":"proxy","usage":{"cpu":"50m","memory":"20Mi"}}]},
+		{"metadata":{"name":"worker","namespace":"shop"},"window":"15s","containers":[{"name":"app","usage":{"cpu":"100m","memory":"300Mi"}}]},
+		{"metadata":{"name":"coredns","namespace":"kube-system"},"window":"15s","containers":[{"name":"coredns","usage":{"cpu":"5m","memory":"30Mi"}}]}
+	]}`
+	list := &v1beta1.PodMetricsList{}
+	if err := json.Unmarshal([]byte(data), list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	report := &PodUsageReport{Pods: podUsage(list.Items)}
+	var names []string
+	for _, pod := range report.Pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"shop/api", "shop/worker", "kube-system/coredns"}) {
+		t.Errorf("pods = %v, want busiest CPU first", names)
+	}
+	if api := report.Pods[0]; api.CPUMillis != 250 || api.MemoryBytes != 120<<20 || len(api.Containers) != 2 {
+		t.Errorf("shop/api = %+v, want the sum of its containers", api)
+	}
+
+	want := []NamespaceResourceUsage{
+		{Namespace: "shop", Pods: 2, ResourceUsage: ResourceUsage{CPUMillis: 350, MemoryBytes: 420 << 20}},
+		{Namespace: "kube-system", Pods: 1, ResourceUsage: ResourceUsage{CPUMillis: 5, MemoryBytes: 30 << 20}},
+	}
+	if got := report.Namespaces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Namespaces() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		used, total int64
+		want        *float64
+	}{
+		{name: "share", used: 1, total: 3, want: floatPtr(33.3)},
+		{name: "over allocatable", used: 3, total: 2, want: floatPtr(150)},
+		{name: "unknown total", used: 1, total: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := percent(tt.used, tt.total); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("percent(%d, %d) = %v, want %v", tt.used, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,233 @@
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// QuotaName is the ResourceQuota created with a namespace
+const QuotaName = "namespace-quota"
+
+var (
+	// ErrInvalid is returned for invalid namespace requests
+	ErrInvalid = errors.New("invalid namespace request")
+	// ErrProtected is returned when deleting or finalizing a namespace the cluster can't run without
+	ErrProtected = errors.New("namespace is protected")
+	// ErrNotTerminating is returned when finalizing a namespace that is not being deleted
+	ErrNotTerminating = errors.New("namespace is not terminating")
+	// ErrConfirmationRequired is returned when finalizing a namespace without confirming it
+	ErrConfirmationRequired = errors.New("removing the finalizers of a namespace must be confirmed")
+)
+
+// protected are the namespaces of the cluster itself
+var protected = map[string]bool{
+	metav1.NamespaceDefault:   true,
+	metav1.NamespaceSystem:    true,
+	metav1.NamespacePublic:    true,
+	corev1.NamespaceNodeLease: true,
+}
+
+// CreateRequest creates a namespace, with a ResourceQuota when Quota is set
+type CreateRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Quota holds the hard limits of the ResourceQuota, e.g. {"requests.cpu": "4", "pods": "50"}
+	Quota map[string]string `json:"quota,omitempty"`
+}
+
+// Validate checks the name, labels, annotations and quota of the request
+func (r CreateRequest) Validate() error {
+	if errs := validation.IsDNS1123Label(r.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: name %q: %s", ErrInvalid, r.Name, errs[0])
+	}
+	for key, value := range r.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("%w: label %q: %s", ErrInvalid, key, errs[0])
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("%w: label %q value: %s", ErrInvalid, key, errs[0])
+		}
+	}
+	for key := range r.Annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("%w: annotation %q: %s", ErrInvalid, key, errs[0])
+		}
+	}
+	if _, err := hardLimits(r.Quota); err != nil {
+		return err
+	}
+	return nil
+}
+
+// hardLimits parses the quantities of a quota
+func hardLimits(quota map[string]string) (corev1.ResourceList, error) {
+	hard := corev1.ResourceList{}
+	for name, value := range quota {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: quota %s: %v", ErrInvalid, name, err)
+		}
+		if quantity.Sign() < 0 {
+			return nil, fmt.Errorf("%w: quota %s must not be negative", ErrInvalid, name)
+		}
+		hard[corev1.ResourceName(name)] = quantity
+	}
+	return hard, nil
+}
+
+// Create creates a namespace and its quota. The namespace is deleted again when its quota is
+// refused, so that a failed request leaves nothing behind.
+func Create(ctx context.Context, clientset kubernetes.Interface, req CreateRequest) (*corev1.Namespace, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	hard, _ := hardLimits(req.Quota)
+
+	namespace, err := clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: req.Name, Labels: req.Labels, Annotations: req.Annotations},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(hard) == 0 {
+		return namespace, nil
+	}
+
+	_, err = clientset.CoreV1().ResourceQuotas(req.Name).Create(ctx, &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: QuotaName, Namespace: req.Name},
+		Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		if deleteErr := clientset.CoreV1().Namespaces().Delete(ctx, req.Name, metav1.DeleteOptions{}); deleteErr != nil {
+			return nil, fmt.Errorf("failed to create the quota: %w, and to delete the namespace again: %v", err, deleteErr)
+		}
+		return nil, fmt.Errorf("failed to create the quota, the namespace was deleted again: %w", err)
+	}
+	return namespace, nil
+}
+
+// Delete starts the deletion of a namespace, which terminates once its content is removed
+func Delete(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	if protected[name] {
+		return fmt.Errorf("%w: %s", ErrProtected, name)
+	}
+	return clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// Termination describes why a namespace is still terminating
+type Termination struct {
+	Name        string `json:"name"`
+	Terminating bool   `json:"terminating"`
+	// DeletionTimestamp is when the deletion was requested
+	DeletionTimestamp *time.Time `json:"deletionTimestamp,omitempty"`
+	// TerminatingFor is how long the namespace has been terminating, in seconds
+	TerminatingFor int64 `json:"terminatingForSeconds,omitempty"`
+	// Finalizers are the spec finalizers, removed through the finalize subresource
+	Finalizers []string `json:"finalizers"`
+	// MetadataFinalizers are set by controllers on the namespace object itself
+	MetadataFinalizers []string `json:"metadataFinalizers"`
+	// Conditions explain what blocks the deletion, e.g. an unavailable API service or
+	// resources whose own finalizers are not removed
+	Conditions []corev1.NamespaceCondition `json:"conditions"`
+}
+
+// Inspect reports the deletion state of a namespace
+func Inspect(ctx context.Context, clientset kubernetes.Interface, name string) (*Termination, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return termination(namespace, time.Now()), nil
+}
+
+func termination(namespace *corev1.Namespace, now time.Time) *Termination {
+	t := &Termination{
+		Name:               namespace.Name,
+		Terminating:        namespace.DeletionTimestamp != nil,
+		Finalizers:         []string{},
+		MetadataFinalizers: append([]string{}, namespace.Finalizers...),
+		Conditions:         []corev1.NamespaceCondition{},
+	}
+	for _, finalizer := range namespace.Spec.Finalizers {
+		t.Finalizers = append(t.Finalizers, string(finalizer))
+	}
+	if namespace.DeletionTimestamp != nil {
+		deletion := namespace.DeletionTimestamp.Time
+		t.DeletionTimestamp = &deletion
+		t.TerminatingFor = int64(now.Sub(deletion).Seconds())
+	}
+	for _, condition := range namespace.Status.Conditions {
+		// Conditions that are false no longer block the deletion
+		if condition.Status == corev1.ConditionTrue {
+			t.Conditions = append(t.Conditions, condition)
+		}
+	}
+	sort.Slice(t.Conditions, func(i, j int) bool { return t.Conditions[i].Type < t.Conditions[j].Type })
+	return t
+}
+
+// FinalizeResult lists the finalizers removed from a namespace
+type FinalizeResult struct {
+	Name              string   `json:"name"`
+	RemovedFinalizers []string `json:"removedFinalizers"`
+	RemovedMetadata   []string `json:"removedMetadataFinalizers"`
+	// Conditions are what blocked the deletion, the resources they name may be left in etcd
+	Conditions []corev1.NamespaceCondition `json:"conditions"`
+}
+
+// ForceFinalize removes the finalizers of a namespace stuck in Terminating: the spec finalizers
+// through the finalize subresource, then those of the object. The namespace is deleted without
+// waiting for its content to be cleaned up, so resources the namespace controller could not
+// delete, e.g. those of an unavailable API service, may be left orphaned. Only done when confirmed.
+func ForceFinalize(ctx context.Context, clientset kubernetes.Interface, name string, confirm bool) (*FinalizeResult, error) {
+	if protected[name] {
+		return nil, fmt.Errorf("%w: %s", ErrProtected, name)
+	}
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if namespace.DeletionTimestamp == nil {
+		return nil, fmt.Errorf("%w: delete %s first", ErrNotTerminating, name)
+	}
+	if !confirm {
+		return nil, ErrConfirmationRequired
+	}
+
+	state := termination(namespace, time.Now())
+	result := &FinalizeResult{
+		Name:              name,
+		RemovedFinalizers: state.Finalizers,
+		RemovedMetadata:   state.MetadataFinalizers,
+		Conditions:        state.Conditions,
+	}
+	if len(namespace.Spec.Finalizers) > 0 {
+		namespace.Spec.Finalizers = nil
+		if _, err := clientset.CoreV1().Namespaces().Finalize(ctx, namespace, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return result, nil
+			}
+			return nil, fmt.Errorf("failed to finalize the namespace: %w", err)
+		}
+	}
+	if len(namespace.Finalizers) > 0 {
+		patch := []byte(`{"metadata":{"finalizers":null}}`)
+		_, err := clientset.CoreV1().Namespaces().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to remove the metadata finalizers: %w", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,147 @@
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateRequestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     CreateRequest
+		wantErr bool
+	}{
+		{name: "valid", req: CreateRequest{Name: "shop", Labels: map[string]string{"team": "payments"}, Quota: map[string]string{"requests.cpu": "4", "pods": "50"}}},
+		{name: "invalid name", req: CreateRequest{Name: "Shop_1"}, wantErr: true},
+		{name: "invalid label value", req: CreateRequest{Name: "shop", Labels: map[string]string{"team": "pay ments"}}, wantErr: true},
+		{name: "invalid quantity", req: CreateRequest{Name: "shop", Quota: map[string]string{"requests.cpu": "four"}}, wantErr: true},
+		{name: "negative quantity", req: CreateRequest{Name: "shop", Quota: map[string]string{"pods": "-1"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("Validate() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestForceFinalize(t *testing.T) {
+	t.Parallel()
+
+	deletion := metav1.NewTime(time.Now().Add(-time.Hour))
+	stuck := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name, DeletionTimestamp: &deletion, Finalizers: []string{"example.com/cleanup"}},
+			Spec:       corev1.NamespaceSpec{Finalizers: []corev1.FinalizerName{corev1.FinalizerKubernetes}},
+			Status: corev1.NamespaceStatus{
+				Phase: corev1.NamespaceTerminating,
+				Conditions: []corev1.NamespaceCondition{
+					{Type: corev1.NamespaceDeletionDiscoveryFailure, Status: corev1.ConditionTrue, Message: "metrics.k8s.io/v1beta1: the server is currently unable to handle the request"},
+					{Type: corev1.NamespaceDeletionContentFailure, Status: corev1.ConditionFalse},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		confirm   bool
+		wantErr   error
+	}{
+		{name: "stuck", namespace: stuck("shop"), confirm: true},
+		{name: "not confirmed", namespace: stuck("shop"), wantErr: ErrConfirmationRequired},
+		{name: "not terminating", namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}, confirm: true, wantErr: ErrNotTerminating},
+		{name: "protected", namespace: stuck("kube-system"), confirm: true, wantErr: ErrProtected},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clientset := fake.NewSimpleClientset(tt.namespace)
+			result, err := ForceFinalize(context.Background(), clientset, tt.namespace.Name, tt.confirm)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ForceFinalize() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(result.RemovedFinalizers) != 1 || len(result.RemovedMetadata) != 1 || len(result.Conditions) != 1 {
+				t.Errorf("ForceFinalize() = %+v, want a finalizer of each kind and the true condition", result)
+			}
+			namespace, err := clientset.CoreV1().Namespaces().Get(context.Background(), tt.namespace.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(namespace.Spec.Finalizers) != 0 || len(namespace.Finalizers) != 0 {
+				t.Errorf("finalizers left: spec %v, metadata %v", namespace.Spec.Finalizers, namespace.Finalizers)
+			}
+		})
+	}
+}
+
+func TestQuotaReport(t *testing.T) {
+	t.Parallel()
+
+	quota := func(namespace string, hard, used corev1.ResourceList) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: namespace},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "batch"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}},
+		quota("shop",
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("4"), corev1.ResourcePods: resource.MustParse("10")},
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1500m"), corev1.ResourcePods: resource.MustParse("10")}),
+		quota("batch",
+			corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("8Gi")},
+			corev1.ResourceList{corev1.ResourceRequestsMemory: resource.MustParse("2Gi")}),
+	)
+
+	report, err := QuotaReport(context.Background(), clientset)
+	if err != nil {
+		t.Fatalf("QuotaReport() error = %v", err)
+	}
+	if len(report.Quotas) != 2 || report.Quotas[0].Namespace != "shop" || report.Quotas[0].MaxPercent != 100 {
+		t.Fatalf("QuotaReport() quotas = %+v, want shop first at 100%%", report.Quotas)
+	}
+	want := []ResourceUsage{
+		{Resource: "pods", Hard: "10", Used: "10", Percent: 100},
+		{Resource: "requests.cpu", Hard: "4", Used: "1500m", Percent: 37.5},
+	}
+	if !reflect.DeepEqual(report.Quotas[0].Resources, want) {
+		t.Errorf("shop resources = %+v, want %+v", report.Quotas[0].Resources, want)
+	}
+	if report.Quotas[1].MaxPercent != 25 {
+		t.Errorf("batch maxPercent = %v, want 25", report.Quotas[1].MaxPercent)
+	}
+	if report.NearLimit != 1 || !reflect.DeepEqual(report.Unquoted, []string{"sandbox"}) {
+		t.Errorf("QuotaReport() nearLimit = %d, unquoted = %v", report.NearLimit, report.Unquoted)
+	}
+}
@@ -0,0 +1,236 @@
+package namespaces
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NearLimitPercent is the usage from which a quota is reported near its limit
+const NearLimitPercent = 90
+
+// ResourceUsage is the use of a resource against its hard limit
+type ResourceUsage struct {
+	Resource string  `json:"resource"`
+	Hard     string  `json:"hard"`
+	Used     string  `json:"used"`
+	Percent  float64 `json:"percent"`
+}
+
+// QuotaUsage is the use of the resources of a ResourceQuota, the most used first
+type QuotaUsage struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Scopes    []string        `json:"scopes,omitempty"`
+	Resources []ResourceUsage `json:"resources"`
+	// MaxPercent is the usage of the most used resource
+	MaxPercent float64 `json:"maxPercent"`
+}
+
+// UsageReport is the quota usage of every namespace of a cluster
+type UsageReport struct {
+	Quotas []QuotaUsage `json:"quotas"`
+	// NearLimit counts the quotas with a resource used at NearLimitPercent or more
+	NearLimit int `json:"nearLimit"`
+	// Unquoted lists the namespaces without any ResourceQuota
+	Unquoted []string `json:"unquoted"`
+}
+
+// NamespaceQuotas are the quotas and limit ranges of a namespace
+type NamespaceQuotas struct {
+	Namespace   string              `json:"namespace"`
+	Quotas      []QuotaUsage        `json:"quotas"`
+	LimitRanges []corev1.LimitRange `json:"limitRanges"`
+}
+
+// QuotaRequest sets the hard limits of a ResourceQuota
+type QuotaRequest struct {
+	// Hard holds the limits by resource, e.g. {"requests.cpu": "4", "pods": "50"}
+	Hard   map[string]string `json:"hard" binding:"required"`
+	Scopes []string          `json:"scopes,omitempty"`
+}
+
+// LimitRangeRequest sets the limits of a LimitRange
+type LimitRangeRequest struct {
+	Limits []corev1.LimitRangeItem `json:"limits" binding:"required"`
+}
+
+// limitTypes are the kinds of objects a LimitRange constrains
+var limitTypes = map[corev1.LimitType]bool{
+	corev1.LimitTypePod:                   true,
+	corev1.LimitTypeContainer:             true,
+	corev1.LimitTypePersistentVolumeClaim: true,
+}
+
+// usage computes the use of every resource of a quota against its hard limit
+func usage(quota *corev1.ResourceQuota) QuotaUsage {
+	u := QuotaUsage{Namespace: quota.Namespace, Name: quota.Name, Resources: []ResourceUsage{}}
+	for _, scope := range quota.Spec.Scopes {
+		u.Scopes = append(u.Scopes, string(scope))
+	}
+	// The spec is read as the status only mirrors it once the quota controller caught up
+	for name, hard := range quota.Spec.Hard {
+		used := quota.Status.Used[name]
+		resourceUsage := ResourceUsage{Resource: string(name), Hard: hard.String(), Used: used.String()}
+		switch {
+		case hard.Sign() > 0:
+			resourceUsage.Percent = math.Round(used.AsApproximateFloat64()/hard.AsApproximateFloat64()*1000) / 10
+		case used.Sign() > 0:
+			// Nothing is allowed and something is used, e.g. after the limit was lowered
+			resourceUsage.Percent = 100
+		}
+		u.Resources = append(u.Resources, resourceUsage)
+		u.MaxPercent = math.Max(u.MaxPercent, resourceUsage.Percent)
+	}
+	sort.Slice(u.Resources, func(i, j int) bool {
+		if u.Resources[i].Percent != u.Resources[j].Percent {
+			return u.Resources[i].Percent > u.Resources[j].Percent
+		}
+		return u.Resources[i].Resource < u.Resources[j].Resource
+	})
+	return u
+}
+
+// QuotaReport reports the quota usage of every namespace of a cluster, the most used quotas first
+func QuotaReport(ctx context.Context, clientset kubernetes.Interface) (*UsageReport, error) {
+	quotas, err := clientset.CoreV1().ResourceQuotas(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+	namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	report := &UsageReport{Quotas: []QuotaUsage{}, Unquoted: []string{}}
+	quoted := map[string]bool{}
+	for i := range quotas.Items {
+		u := usage(&quotas.Items[i])
+		if u.MaxPercent >= NearLimitPercent {
+			report.NearLimit++
+		}
+		quoted[u.Namespace] = true
+		report.Quotas = append(report.Quotas, u)
+	}
+	sortQuotas(report.Quotas)
+	for _, namespace := range namespaceList.Items {
+		if !quoted[namespace.Name] {
+			report.Unquoted = append(report.Unquoted, namespace.Name)
+		}
+	}
+	sort.Strings(report.Unquoted)
+	return report, nil
+}
+
+func sortQuotas(quotas []QuotaUsage) {
+	sort.Slice(quotas, func(i, j int) bool {
+		if quotas[i].MaxPercent != quotas[j].MaxPercent {
+			return quotas[i].MaxPercent > quotas[j].MaxPercent
+		}
+		return quotas[i].Namespace+"/"+quotas[i].Name < quotas[j].Namespace+"/"+quotas[j].Name
+	})
+}
+
+// Quotas returns the quotas, with their usage, and the limit ranges of a namespace
+func Quotas(ctx context.Context, clientset kubernetes.Interface, namespace string) (*NamespaceQuotas, error) {
+	if _, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+	quotas, err := clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+	limitRanges, err := clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limit ranges: %w", err)
+	}
+
+	result := &NamespaceQuotas{Namespace: namespace, Quotas: []QuotaUsage{}, LimitRanges: limitRanges.Items}
+	for i := range quotas.Items {
+		result.Quotas = append(result.Quotas, usage(&quotas.Items[i]))
+	}
+	sortQuotas(result.Quotas)
+	if result.LimitRanges == nil {
+		result.LimitRanges = []corev1.LimitRange{}
+	}
+	return result, nil
+}
+
+// ApplyQuota creates or replaces the hard limits and scopes of a ResourceQuota
+func ApplyQuota(ctx context.Context, clientset kubernetes.Interface, namespace, name string, req QuotaRequest) (*corev1.ResourceQuota, error) {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: name %q: %s", ErrInvalid, name, errs[0])
+	}
+	if len(req.Hard) == 0 {
+		return nil, fmt.Errorf("%w: a quota needs at least one hard limit", ErrInvalid)
+	}
+	hard, err := hardLimits(req.Hard)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]corev1.ResourceQuotaScope, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, corev1.ResourceQuotaScope(scope))
+	}
+
+	quotas := clientset.CoreV1().ResourceQuotas(namespace)
+	quota, err := quotas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return quotas.Create(ctx, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard, Scopes: scopes},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	quota.Spec.Hard = hard
+	quota.Spec.Scopes = scopes
+	return quotas.Update(ctx, quota, metav1.UpdateOptions{})
+}
+
+// DeleteQuota deletes a ResourceQuota
+func DeleteQuota(ctx context.Context, clientset kubernetes.Interface, namespace, name string) error {
+	return clientset.CoreV1().ResourceQuotas(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// ApplyLimitRange creates or replaces the limits of a LimitRange
+func ApplyLimitRange(ctx context.Context, clientset kubernetes.Interface, namespace, name string, req LimitRangeRequest) (*corev1.LimitRange, error) {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: name %q: %s", ErrInvalid, name, errs[0])
+	}
+	if len(req.Limits) == 0 {
+		return nil, fmt.Errorf("%w: a limit range needs at least one limit", ErrInvalid)
+	}
+	for i, limit := range req.Limits {
+		if !limitTypes[limit.Type] {
+			return nil, fmt.Errorf("%w: limit %d: type must be Pod, Container or PersistentVolumeClaim", ErrInvalid, i)
+		}
+	}
+
+	limitRanges := clientset.CoreV1().LimitRanges(namespace)
+	limitRange, err := limitRanges.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return limitRanges.Create(ctx, &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.LimitRangeSpec{Limits: req.Limits},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	limitRange.Spec.Limits = req.Limits
+	return limitRanges.Update(ctx, limitRange, metav1.UpdateOptions{})
+}
+
+// DeleteLimitRange deletes a LimitRange
+func DeleteLimitRange(ctx context.Context, clientset kubernetes.Interface, namespace, name string) error {
+	return clientset.CoreV1().LimitRanges(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
@@ -0,0 +1,230 @@
+package nodeinventory
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+// Node components advisories are matched against
+const (
+	ComponentKubelet    = "kubelet"
+	ComponentKubeProxy  = "kube-proxy"
+	ComponentContainerd = "containerd"
+	ComponentCRIO       = "cri-o"
+	ComponentDocker     = "docker"
+	ComponentKernel     = "kernel"
+	// ComponentRunc is not part of the node status, its advisories are listed for reference and
+	// only match when a runc version is known. The containerd version does not tell which runc runs.
+	ComponentRunc = "runc"
+
+	advisoriesFileName = "node-advisories.json"
+)
+
+// Advisory describes a known vulnerability in a node level component
+type Advisory struct {
+	ID        string `json:"id"`
+	Component string `json:"component"`
+	Severity  string `json:"severity"`
+	Summary   string `json:"summary"`
+	URL       string `json:"url,omitempty"`
+	// OS limits the advisory to nodes of an operating system, e.g. "windows", empty means any
+	OS       string         `json:"os,omitempty"`
+	Affected []VersionRange `json:"affected"`
+}
+
+// VersionRange is a half-open range of affected versions, [Introduced, Fixed)
+type VersionRange struct {
+	// Introduced is the first affected version, empty means all earlier versions
+	Introduced string `json:"introduced,omitempty"`
+	// Fixed is the first version with the fix, empty means not fixed yet
+	Fixed string `json:"fixed,omitempty"`
+}
+
+// builtinAdvisories is a curated list of high impact host level CVEs. Users can extend it
+// with ~/.agentkube/node-advisories.json using the same format.
+var builtinAdvisories = []Advisory{
+	{
+		ID:        "CVE-2021-25741",
+		Component: ComponentKubelet,
+		Severity:  "High",
+		Summary:   "Symlink exchange can allow host filesystem access through subPath volume mounts",
+		URL:       "https://github.com/kubernetes/kubernetes/issues/104980",
+		Affected: []VersionRange{
+			{Fixed: "1.19.15"},
+			{Introduced: "1.20.0", Fixed: "1.20.11"},
+			{Introduced: "1.21.0", Fixed: "1.21.5"},
+			{Introduced: "1.22.0", Fixed: "1.22.2"},
+		},
+	},
+	{
+		ID:        "CVE-2023-3676",
+		Component: ComponentKubelet,
+		Severity:  "High",
+		Summary:   "Insufficient input sanitization on Windows nodes leads to privilege escalation",
+		URL:       "https://github.com/kubernetes/kubernetes/issues/119339",
+		OS:        "windows",
+		Affected: []VersionRange{
+			{Fixed: "1.24.17"},
+			{Introduced: "1.25.0", Fixed: "1.25.13"},
+			{Introduced: "1.26.0", Fixed: "1.26.8"},
+			{Introduced: "1.27.0", Fixed: "1.27.5"},
+			{Introduced: "1.28.0", Fixed: "1.28.1"},
+		},
+	},
+	{
+		ID:        "CVE-2023-5528",
+		Component: ComponentKubelet,
+		Severity:  "High",
+		Summary:   "Insufficient input sanitization in in-tree storage plugin leads to privilege escalation on Windows nodes",
+		URL:       "https://github.com/kubernetes/kubernetes/issues/121879",
+		OS:        "windows",
+		Affected: []VersionRange{
+			{Fixed: "1.25.16"},
+			{Introduced: "1.26.0", Fixed: "1.26.11"},
+			{Introduced: "1.27.0", Fixed: "1.27.8"},
+			{Introduced: "1.28.0", Fixed: "1.28.4"},
+		},
+	},
+	{
+		ID:        "CVE-2022-23648",
+		Component: ComponentContainerd,
+		Severity:  "High",
+		Summary:   "Crafted image volume configuration can expose host files to containers",
+		URL:       "https://github.com/containerd/containerd/security/advisories/GHSA-crp2-qrr5-8pq7",
+		Affected: []VersionRange{
+			{Fixed: "1.4.13"},
+			{Introduced: "1.5.0", Fixed: "1.5.10"},
+			{Introduced: "1.6.0", Fixed: "1.6.1"},
+		},
+	},
+	{
+		ID:        "CVE-2024-21626",
+		Component: ComponentRunc,
+		Severity:  "High",
+		Summary:   "runc leaks a host file descriptor allowing container escape (Leaky Vessels)",
+		URL:       "https://github.com/opencontainers/runc/security/advisories/GHSA-xr7r-f8xq-vfvv",
+		OS:        "linux",
+		Affected: []VersionRange{
+			{Introduced: "1.0.0-rc93", Fixed: "1.1.12"},
+		},
+	},
+	{
+		ID:        "CVE-2022-0811",
+		Component: ComponentCRIO,
+		Severity:  "High",
+		Summary:   "Kernel parameter injection through pod sysctls allows container escape (cr8escape)",
+		URL:       "https://github.com/cri-o/cri-o/security/advisories/GHSA-6x2m-w449-qwx7",
+		Affected: []VersionRange{
+			{Introduced: "1.19.0", Fixed: "1.19.6"},
+			{Introduced: "1.20.0", Fixed: "1.20.7"},
+			{Introduced: "1.21.0", Fixed: "1.21.6"},
+			{Introduced: "1.22.0", Fixed: "1.22.3"},
+			{Introduced: "1.23.0", Fixed: "1.23.2"},
+		},
+	},
+	{
+		ID:        "CVE-2022-0847",
+		Component: ComponentKernel,
+		Severity:  "High",
+		Summary:   "Dirty Pipe: overwriting data in read-only files allows privilege escalation",
+		URL:       "https://dirtypipe.cm4all.com/",
+		OS:        "linux",
+		Affected: []VersionRange{
+			{Introduced: "5.8", Fixed: "5.10.102"},
+			{Introduced: "5.11", Fixed: "5.15.25"},
+			{Introduced: "5.16", Fixed: "5.16.11"},
+		},
+	},
+	{
+		ID:        "CVE-2024-1086",
+		Component: ComponentKernel,
+		Severity:  "High",
+		Summary:   "Use-after-free in netfilter nf_tables allows local privilege escalation",
+		URL:       "https://nvd.nist.gov/vuln/detail/CVE-2024-1086",
+		OS:        "linux",
+		Affected: []VersionRange{
+			{Introduced: "3.15", Fixed: "5.10.209"},
+			{Introduced: "5.11", Fixed: "5.15.149"},
+			{Introduced: "5.16", Fixed: "6.1.76"},
+			{Introduced: "6.2", Fixed: "6.6.15"},
+			{Introduced: "6.7", Fixed: "6.7.3"},
+		},
+	},
+}
+
+// loadAdvisories returns the built-in advisories merged with the user supplied ones
+func loadAdvisories() ([]Advisory, error) {
+	var custom []Advisory
+	if err := utils.ReadJSONFile(filepath.Join(utils.ConfigDir(), advisoriesFileName), &custom); err != nil {
+		return nil, err
+	}
+
+	advisories := make([]Advisory, 0, len(builtinAdvisories)+len(custom))
+	advisories = append(advisories, builtinAdvisories...)
+	advisories = append(advisories, custom...)
+	return advisories, nil
+}
+
+// appliesTo reports whether the advisory concerns nodes of the operating system
+func (a Advisory) appliesTo(os string) bool {
+	return a.OS == "" || os == "" || strings.EqualFold(a.OS, os)
+}
+
+// matches reports whether version falls inside any affected range of the advisory
+func (a Advisory) matches(version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, r := range a.Affected {
+		if r.Introduced != "" && compareVersions(version, r.Introduced) < 0 {
+			continue
+		}
+		if r.Fixed != "" && compareVersions(version, r.Fixed) >= 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// compareVersions compares the dotted numeric prefixes of two versions, ignoring a leading
+// "v" and any suffix such as "-eks-1234" or "+k3s1"
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+~_ "); i >= 0 {
+		version = version[:i]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
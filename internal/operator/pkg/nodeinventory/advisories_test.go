@@ -0,0 +1,99 @@
+package nodeinventory
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.28.1", "1.28.1", 0},
+		{"v1.28.1", "1.28.1", 0},
+		{"1.28.1", "1.28.10", -1},
+		{"1.28", "1.28.0", 0},
+		{"1.29.0", "1.28.9", 1},
+		{"v1.27.4-eks-8ccc7ba", "1.27.5", -1},
+		{"v1.28.2+k3s1", "1.28.2", 0},
+		{"5.15.0-1051-azure", "5.15.25", -1},
+		{"1.0.0-rc93", "1.0.0", 0},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAdvisoryMatches(t *testing.T) {
+	t.Parallel()
+
+	advisory := Advisory{Affected: []VersionRange{
+		{Fixed: "1.19.15"},
+		{Introduced: "1.20.0", Fixed: "1.20.11"},
+		{Introduced: "1.22.0"},
+	}}
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.18.3", true},
+		{"1.19.15", false},
+		{"1.20.0", true},
+		{"v1.20.10-eks-1", true},
+		{"1.20.11", false},
+		{"1.21.4", false},
+		{"1.22.0", true},
+		{"1.30.1", true},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := advisory.matches(tt.version); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestAdvisoryAppliesTo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		advisoryOS string
+		nodeOS     string
+		want       bool
+	}{
+		{"", "linux", true},
+		{"windows", "windows", true},
+		{"windows", "linux", false},
+		{"linux", "Linux", true},
+		{"windows", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := (Advisory{OS: tt.advisoryOS}).appliesTo(tt.nodeOS); got != tt.want {
+			t.Errorf("Advisory{OS: %q}.appliesTo(%q) = %v, want %v", tt.advisoryOS, tt.nodeOS, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinWindowsAdvisories(t *testing.T) {
+	t.Parallel()
+
+	for _, advisory := range builtinAdvisories {
+		switch advisory.ID {
+		case "CVE-2023-3676", "CVE-2023-5528":
+			if advisory.appliesTo("linux") {
+				t.Errorf("%s applies to linux nodes, want windows only", advisory.ID)
+			}
+		case "CVE-2024-21626":
+			if advisory.Component != ComponentRunc {
+				t.Errorf("%s component = %s, want %s", advisory.ID, advisory.Component, ComponentRunc)
+			}
+		}
+	}
+}
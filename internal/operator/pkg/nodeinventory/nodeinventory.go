@@ -0,0 +1,243 @@
+package nodeinventory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Inventory lists node level component versions across clusters
+type Inventory struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// FleetInventory is the node inventory of a set of clusters
+type FleetInventory struct {
+	Clusters   []ClusterInventory `json:"clusters"`
+	Components []ComponentSummary `json:"components"`
+	// Vulnerable counts nodes with at least one matching advisory
+	Vulnerable int `json:"vulnerable"`
+	TotalNodes int `json:"totalNodes"`
+}
+
+// ClusterInventory is the node inventory of a single cluster
+type ClusterInventory struct {
+	Cluster string          `json:"cluster"`
+	Nodes   []NodeInventory `json:"nodes"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// NodeInventory holds the host level versions reported by a node
+type NodeInventory struct {
+	Name                    string        `json:"name"`
+	OSImage                 string        `json:"osImage"`
+	OperatingSystem         string        `json:"operatingSystem"`
+	Architecture            string        `json:"architecture"`
+	KernelVersion           string        `json:"kernelVersion"`
+	ContainerRuntime        string        `json:"containerRuntime"`
+	ContainerRuntimeVersion string        `json:"containerRuntimeVersion"`
+	KubeletVersion          string        `json:"kubeletVersion"`
+	KubeProxyVersion        string        `json:"kubeProxyVersion,omitempty"`
+	Findings                []NodeFinding `json:"findings"`
+}
+
+// NodeFinding is an advisory matching a component of a node
+type NodeFinding struct {
+	Advisory  Advisory `json:"advisory"`
+	Component string   `json:"component"`
+	Version   string   `json:"version"`
+	// Confidence is "low" for kernel matches since distributions backport fixes without bumping the upstream version
+	Confidence string `json:"confidence"`
+}
+
+// ComponentSummary counts the nodes running each version of a component across the fleet
+type ComponentSummary struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	// OperatingSystem of the nodes, advisories differ between Linux and Windows builds
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+	Nodes           int    `json:"nodes"`
+	// Advisories are the IDs of advisories affecting this version
+	Advisories []string `json:"advisories,omitempty"`
+}
+
+// NewInventory creates a new node inventory
+func NewInventory(kubeConfigStore kubeconfig.ContextStore) *Inventory {
+	return &Inventory{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// Collect inventories the nodes of the given clusters, or of every known context when none are given
+func (i *Inventory) Collect(clusterNames []string) (*FleetInventory, error) {
+	if len(clusterNames) == 0 {
+		contexts, err := i.kubeConfigStore.GetContexts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, ctx := range contexts {
+			clusterNames = append(clusterNames, ctx.Name)
+		}
+	}
+
+	advisories, err := loadAdvisories()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ClusterInventory, len(clusterNames))
+	var wg sync.WaitGroup
+	for idx, clusterName := range clusterNames {
+		wg.Add(1)
+		go func(idx int, clusterName string) {
+			defer wg.Done()
+			results[idx] = i.collectCluster(clusterName, advisories)
+		}(idx, clusterName)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(a, b int) bool { return results[a].Cluster < results[b].Cluster })
+
+	fleet := &FleetInventory{Clusters: results}
+	summaries := map[string]*ComponentSummary{}
+	for _, cluster := range results {
+		for _, node := range cluster.Nodes {
+			fleet.TotalNodes++
+			if len(node.Findings) > 0 {
+				fleet.Vulnerable++
+			}
+			for component, version := range node.componentVersions() {
+				if version == "" {
+					continue
+				}
+				key := component + "@" + version + "/" + node.OperatingSystem
+				summary, ok := summaries[key]
+				if !ok {
+					summary = &ComponentSummary{Component: component, Version: version, OperatingSystem: node.OperatingSystem}
+					for _, advisory := range advisories {
+						if advisory.Component == component && advisory.appliesTo(node.OperatingSystem) && advisory.matches(version) {
+							summary.Advisories = append(summary.Advisories, advisory.ID)
+						}
+					}
+					summaries[key] = summary
+				}
+				summary.Nodes++
+			}
+		}
+	}
+
+	fleet.Components = make([]ComponentSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		fleet.Components = append(fleet.Components, *summary)
+	}
+	sort.Slice(fleet.Components, func(a, b int) bool {
+		x, y := fleet.Components[a], fleet.Components[b]
+		if x.Component != y.Component {
+			return x.Component < y.Component
+		}
+		if c := compareVersions(x.Version, y.Version); c != 0 {
+			return c < 0
+		}
+		return x.OperatingSystem < y.OperatingSystem
+	})
+
+	return fleet, nil
+}
+
+// collectCluster lists the nodes of a cluster and matches their components against the advisories
+func (i *Inventory) collectCluster(clusterName string, advisories []Advisory) ClusterInventory {
+	result := ClusterInventory{Cluster: clusterName, Nodes: []NodeInventory{}}
+
+	kubeContext, err := i.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to get context: %v", err)
+		return result
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create clientset: %v", err)
+		return result
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to list nodes: %v", err)
+		return result
+	}
+
+	for _, node := range nodes.Items {
+		inventory := nodeInventory(&node)
+		for component, version := range inventory.componentVersions() {
+			for _, advisory := range advisories {
+				if advisory.Component != component || !advisory.appliesTo(inventory.OperatingSystem) || !advisory.matches(version) {
+					continue
+				}
+				confidence := "high"
+				if component == ComponentKernel {
+					confidence = "low"
+				}
+				inventory.Findings = append(inventory.Findings, NodeFinding{
+					Advisory:   advisory,
+					Component:  component,
+					Version:    version,
+					Confidence: confidence,
+				})
+			}
+		}
+		sort.Slice(inventory.Findings, func(a, b int) bool {
+			return inventory.Findings[a].Advisory.ID < inventory.Findings[b].Advisory.ID
+		})
+		result.Nodes = append(result.Nodes, inventory)
+	}
+
+	sort.Slice(result.Nodes, func(a, b int) bool { return result.Nodes[a].Name < result.Nodes[b].Name })
+	return result
+}
+
+func nodeInventory(node *corev1.Node) NodeInventory {
+	info := node.Status.NodeInfo
+	runtime, runtimeVersion := splitRuntimeVersion(info.ContainerRuntimeVersion)
+
+	return NodeInventory{
+		Name:                    node.Name,
+		OSImage:                 info.OSImage,
+		OperatingSystem:         info.OperatingSystem,
+		Architecture:            info.Architecture,
+		KernelVersion:           info.KernelVersion,
+		ContainerRuntime:        runtime,
+		ContainerRuntimeVersion: runtimeVersion,
+		KubeletVersion:          info.KubeletVersion,
+		KubeProxyVersion:        info.KubeProxyVersion,
+		Findings:                []NodeFinding{},
+	}
+}
+
+// componentVersions maps advisory components to the versions running on the node
+func (n NodeInventory) componentVersions() map[string]string {
+	versions := map[string]string{
+		ComponentKubelet: n.KubeletVersion,
+		ComponentKernel:  n.KernelVersion,
+	}
+	if n.KubeProxyVersion != "" {
+		versions[ComponentKubeProxy] = n.KubeProxyVersion
+	}
+	if n.ContainerRuntime != "" {
+		versions[n.ContainerRuntime] = n.ContainerRuntimeVersion
+	}
+	return versions
+}
+
+// splitRuntimeVersion splits "containerd://1.7.2" into its runtime name and version
+func splitRuntimeVersion(value string) (string, string) {
+	runtime, version, found := strings.Cut(value, "://")
+	if !found {
+		return "", value
+	}
+	return runtime, version
+}
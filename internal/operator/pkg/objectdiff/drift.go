@@ -0,0 +1,242 @@
+package objectdiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Drift types
+const (
+	// Modified is a field whose live value differs from the desired one
+	Modified = "modified"
+	// Missing is a desired field the live object doesn't have
+	Missing = "missing"
+	// Pruned is a field dropped from the desired state since it was last applied that is still live,
+	// an apply would remove it
+	Pruned = "pruned"
+)
+
+// LastAppliedAnnotation holds the manifest kubectl apply last applied to an object
+const LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ignoredPaths are the fields set by the API server, never part of a desired state
+var ignoredPaths = map[string]bool{
+	"status":                     true,
+	"metadata.resourceVersion":   true,
+	"metadata.uid":               true,
+	"metadata.generation":        true,
+	"metadata.creationTimestamp": true,
+	"metadata.managedFields":     true,
+	joinPath("metadata.annotations", LastAppliedAnnotation): true,
+}
+
+// identityPaths name an object rather than being part of its state, manifests often leave the
+// namespace out. They are never reported pruned.
+var identityPaths = map[string]bool{
+	"apiVersion":         true,
+	"kind":               true,
+	"metadata.name":      true,
+	"metadata.namespace": true,
+}
+
+// quantityFields hold resource quantities by resource name, e.g. the limits of a container
+var quantityFields = map[string]bool{
+	"limits": true, "requests": true, "hard": true, "capacity": true,
+	"default": true, "defaultRequest": true, "max": true, "min": true,
+}
+
+// DriftChange is a field where a live object drifted from its desired state
+type DriftChange struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Desired interface{} `json:"desired,omitempty"`
+	Live    interface{} `json:"live,omitempty"`
+	// LastApplied is the value last applied, for pruned fields
+	LastApplied interface{} `json:"lastApplied,omitempty"`
+}
+
+// Drift compares a live object to its desired state, both unstructured, and to the state last
+// applied when known, ordered by path. Only the fields of the desired state are compared, the live
+// object holds many more the API server defaulted. Lists of objects with a name, e.g. containers,
+// are matched by name, other lists by position.
+func Drift(desired, live, lastApplied map[string]interface{}) []DriftChange {
+	changes := []DriftChange{}
+	driftValues("", "", false, desired, live, &changes)
+	if lastApplied != nil {
+		prunedValues("", lastApplied, desired, live, &changes)
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// driftValues compares a desired value to the live one. field is the key of the values in their
+// map, quantities is set for the values of a map of resource quantities.
+func driftValues(path, field string, quantities bool, desired, live interface{}, changes *[]DriftChange) {
+	if ignoredPaths[path] || isEmpty(desired) {
+		return
+	}
+	if live == nil {
+		// The API server drops zero values of optional fields, e.g. a desired hostNetwork: false
+		if !isZero(desired) {
+			*changes = append(*changes, DriftChange{Path: path, Type: Missing, Desired: desired})
+		}
+		return
+	}
+
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(d) {
+			driftValues(joinPath(path, key), key, quantityFields[field], d[key], l[key], changes)
+		}
+		return
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			break
+		}
+		if _, ok := byName(d); ok {
+			liveNamed, _ := byName(l)
+			for _, item := range d {
+				name := itemName(item)
+				driftValues(fmt.Sprintf("%s[name=%s]", path, name), "", false, item, liveNamed[name], changes)
+			}
+			return
+		}
+		if len(d) == len(l) {
+			for i := range d {
+				driftValues(fmt.Sprintf("%s[%d]", path, i), "", false, d[i], l[i], changes)
+			}
+			return
+		}
+	default:
+		if equalScalars(desired, live, quantities) {
+			return
+		}
+	}
+	*changes = append(*changes, DriftChange{Path: path, Type: Modified, Desired: desired, Live: live})
+}
+
+// prunedValues reports the fields of the last applied state the desired state dropped and that
+// are still live. Lists are compared as a whole, the fields of their items aren't pruned one by one.
+func prunedValues(path string, lastApplied, desired, live interface{}, changes *[]DriftChange) {
+	if ignoredPaths[path] || identityPaths[path] || live == nil {
+		return
+	}
+	a, aIsMap := lastApplied.(map[string]interface{})
+	l, lIsMap := live.(map[string]interface{})
+	if desired == nil && !(aIsMap && lIsMap) {
+		*changes = append(*changes, DriftChange{Path: path, Type: Pruned, Live: live, LastApplied: lastApplied})
+		return
+	}
+	// Maps dropped as a whole are pruned field by field, the live map may hold fields never applied
+	d, dIsMap := desired.(map[string]interface{})
+	if desired == nil {
+		d, dIsMap = map[string]interface{}{}, true
+	}
+	if !aIsMap || !dIsMap || !lIsMap {
+		return
+	}
+	for _, key := range sortedKeys(a) {
+		prunedValues(joinPath(path, key), a[key], d[key], l[key], changes)
+	}
+}
+
+// equalScalars compares scalar values, numbers whatever their decoded type and, when quantities
+// is set, resource quantities in any notation, e.g. a desired cpu of 0.5 and a live one of 500m
+func equalScalars(a, b interface{}, quantities bool) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	af, aIsNumber := toFloat(a)
+	bf, bIsNumber := toFloat(b)
+	if aIsNumber && bIsNumber {
+		return af == bf
+	}
+	if !quantities {
+		return false
+	}
+	aq, err := resource.ParseQuantity(fmt.Sprint(a))
+	if err != nil {
+		return false
+	}
+	bq, err := resource.ParseQuantity(fmt.Sprint(b))
+	return err == nil && aq.Cmp(bq) == 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// isEmpty reports values equivalent to an absent field, that the API server drops
+func isEmpty(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(value) == 0
+	case []interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+func isZero(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return !value
+	case string:
+		return value == ""
+	}
+	f, ok := toFloat(v)
+	return ok && f == 0
+}
+
+// byName indexes a list of objects by their name, ok is false unless every item has one
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	named := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		name := itemName(item)
+		if name == "" {
+			return nil, false
+		}
+		named[name] = item
+	}
+	return named, true
+}
+
+func itemName(item interface{}) string {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := object["name"].(string)
+	return name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,111 @@
+package objectdiff
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func object(t *testing.T, manifest string) map[string]interface{} {
+	t.Helper()
+
+	var o map[string]interface{}
+	if err := yaml.Unmarshal([]byte(manifest), &o); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	return o
+}
+
+func TestDrift(t *testing.T) {
+	t.Parallel()
+
+	lastApplied := object(t, `
+metadata:
+  name: web
+  labels: {app: web, tier: front}
+spec:
+  replicas: 2
+  paused: false
+  template:
+    spec:
+      containers:
+      - name: app
+        image: web:1.0
+        resources:
+          limits: {cpu: 500m, memory: 1Gi}
+`)
+	desired := object(t, `
+metadata:
+  name: web
+  labels: {app: web}
+spec:
+  replicas: 2
+  paused: false
+  template:
+    spec:
+      containers:
+      - name: app
+        image: web:1.1
+        resources:
+          limits: {cpu: 0.5, memory: 1Gi}
+      - name: sidecar
+        image: proxy:2
+`)
+	live := object(t, `
+metadata:
+  name: web
+  resourceVersion: "42"
+  labels: {app: web, tier: front}
+  annotations: {kubectl.kubernetes.io/last-applied-configuration: "{}"}
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: app
+        image: web:1.0
+        imagePullPolicy: IfNotPresent
+        resources:
+          limits: {cpu: 500m, memory: 1Gi}
+status:
+  replicas: 5
+`)
+
+	got := Drift(desired, live, lastApplied)
+	want := []DriftChange{
+		{Path: "metadata.labels.tier", Type: Pruned, Live: "front", LastApplied: "front"},
+		{Path: "spec.replicas", Type: Modified, Desired: float64(2), Live: float64(5)},
+		{Path: "spec.template.spec.containers[name=app].image", Type: Modified, Desired: "web:1.1", Live: "web:1.0"},
+		{Path: "spec.template.spec.containers[name=sidecar]", Type: Missing, Desired: map[string]interface{}{"name": "sidecar", "image": "proxy:2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Drift() = %+v, want %+v", got, want)
+	}
+
+	if changes := Drift(live, live, nil); len(changes) != 0 {
+		t.Errorf("Drift() of an object with itself = %+v, want no changes", changes)
+	}
+}
+
+func TestEqualScalars(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b       interface{}
+		quantities bool
+		want       bool
+	}{
+		{int64(2), float64(2), false, true},
+		{"0.5", "500m", true, true},
+		{float64(1), "1000m", true, true},
+		{"0.5", "500m", false, false},
+		{"1.2", "1.20", false, false},
+		{"web", "web", false, true},
+	}
+	for _, tt := range tests {
+		if got := equalScalars(tt.a, tt.b, tt.quantities); got != tt.want {
+			t.Errorf("equalScalars(%v, %v, %v) = %v, want %v", tt.a, tt.b, tt.quantities, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package objectdiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change types
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is a field that differs between two versions of an object
+type Change struct {
+	// Path of the field, e.g. "spec.template.spec.containers[0].image"
+	Path string      `json:"path"`
+	Type string      `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Diff lists the fields that differ from a to b, unstructured values, ordered by path
+func Diff(a, b map[string]interface{}) []Change {
+	changes := []Change{}
+	diffValues("", a, b, &changes)
+	return changes
+}
+
+func diffValues(path string, a, b interface{}, changes *[]Change) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, Change{Path: path, Type: Added, New: b})
+		return
+	case b == nil:
+		*changes = append(*changes, Change{Path: path, Type: Removed, Old: a})
+		return
+	}
+
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(aMap)+len(bMap))
+		for key := range aMap {
+			keys = append(keys, key)
+		}
+		for key := range bMap {
+			if _, ok := aMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffValues(joinPath(path, key), aMap[key], bMap[key], changes)
+		}
+		return
+	}
+
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if aIsList && bIsList {
+		for i := 0; i < len(aList) || i < len(bList); i++ {
+			var aItem, bItem interface{}
+			if i < len(aList) {
+				aItem = aList[i]
+			}
+			if i < len(bList) {
+				bItem = bList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), aItem, bItem, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, Type: Changed, Old: a, New: b})
+	}
+}
+
+// joinPath appends a field to a path, quoting fields containing dots such as annotation keys
+func joinPath(path, field string) string {
+	if strings.ContainsAny(field, ".[]") {
+		return fmt.Sprintf("%s[%q]", path, field)
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
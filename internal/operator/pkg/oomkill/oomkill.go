@@ -0,0 +1,493 @@
+package oomkill
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/agentkube/operator/pkg/features"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/metrics"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+	settingsFileName = "oom-detector.json"
+	historyFileName  = "oom-history.json"
+
+	// tickInterval is how often the sampler checks whether a sample is due
+	tickInterval = time.Minute
+)
+
+// Settings configure the periodic sampling of container memory and OOM kills
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Clusters limits sampling to these contexts, empty samples every context
+	Clusters        []string `json:"clusters"`
+	IntervalMinutes int      `json:"intervalMinutes"`
+	RetentionDays   int      `json:"retentionDays"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Clusters:        []string{},
+		IntervalMinutes: 5,
+		RetentionDays:   7,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.IntervalMinutes < 1 || s.IntervalMinutes > 60 {
+		return fmt.Errorf("intervalMinutes must be between 1 and 60")
+	}
+	if s.RetentionDays < 1 || s.RetentionDays > 90 {
+		return fmt.Errorf("retentionDays must be between 1 and 90")
+	}
+	return nil
+}
+
+// Manager samples the memory usage and OOM kills of containers into hourly peaks per workload and
+// reports how their limits compare
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	historyPath     string
+	mutex           sync.Mutex
+	// history is keyed by cluster/namespace/kind/name
+	history  map[string]*WorkloadHistory
+	loaded   bool
+	lastRun  time.Time
+	stopChan chan struct{}
+}
+
+// NewManager creates a new OOM kill detector
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		historyPath:     filepath.Join(utils.ConfigDir(), historyFileName),
+		history:         map[string]*WorkloadHistory{},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current detector settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new detector settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start samples the configured clusters until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the sampling loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Sample records the current memory usage and OOM kills of a cluster
+func (m *Manager) Sample(ctx context.Context, clusterName string) error {
+	settings, err := m.Settings()
+	if err != nil {
+		return err
+	}
+	return m.sample(ctx, clusterName, settings, time.Now())
+}
+
+// Reports returns the memory report of the workloads of a cluster since the given time, all
+// namespaces when namespace is empty. Workloads closest to trouble come first.
+func (m *Manager) Reports(clusterName, namespace string, since time.Time) ([]WorkloadReport, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadHistory(); err != nil {
+		return nil, err
+	}
+	reports := []WorkloadReport{}
+	for _, history := range m.history {
+		if history.Cluster == clusterName && (namespace == "" || history.Namespace == namespace) {
+			reports = append(reports, report(history, since))
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if statusRank[reports[i].Status] != statusRank[reports[j].Status] {
+			return statusRank[reports[i].Status] > statusRank[reports[j].Status]
+		}
+		if reports[i].OOMKills != reports[j].OOMKills {
+			return reports[i].OOMKills > reports[j].OOMKills
+		}
+		return reports[i].Namespace+"/"+reports[i].Kind+"/"+reports[i].Name < reports[j].Namespace+"/"+reports[j].Kind+"/"+reports[j].Name
+	})
+	return reports, nil
+}
+
+// Recommendations returns the reports of the workloads with a container whose limit should change,
+// keeping only those containers. They are the memory input of right-sizing.
+func (m *Manager) Recommendations(clusterName, namespace string, since time.Time) ([]WorkloadReport, error) {
+	reports, err := m.Reports(clusterName, namespace, since)
+	if err != nil {
+		return nil, err
+	}
+	recommended := []WorkloadReport{}
+	for _, r := range reports {
+		containers := []ContainerReport{}
+		for _, container := range r.Containers {
+			if container.Recommendation != nil {
+				containers = append(containers, container)
+			}
+		}
+		if len(containers) > 0 {
+			r.Containers = containers
+			recommended = append(recommended, r)
+		}
+	}
+	return recommended, nil
+}
+
+// monitor samples the configured clusters when the interval elapsed
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load OOM detector settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	clusters := settings.Clusters
+	if len(clusters) == 0 {
+		contexts, err := m.kubeConfigStore.GetContexts()
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to list contexts for OOM detection")
+			return
+		}
+		for _, kubeContext := range contexts {
+			clusters = append(clusters, kubeContext.Name)
+		}
+	}
+
+	for _, clusterName := range clusters {
+		// Clusters over their resource budget are skipped until they are resumed
+		if budget.Paused(clusterName) {
+			continue
+		}
+		if err := m.sample(context.Background(), clusterName, settings, now); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to sample container memory")
+		}
+	}
+}
+
+// sample reads the pods and their memory usage from a cluster and records them
+func (m *Manager) sample(ctx context.Context, clusterName string, settings Settings, now time.Time) error {
+	defer budget.Track(clusterName, "oomkill")()
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	podList, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	// Usage is optional, OOM kills and limits are still recorded without metrics server
+	usage, err := memoryUsage(ctx, clientset)
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to read container memory usage")
+	}
+	// Filesystem and network usage come from the kubelets, the nodes that can't be read are skipped
+	var stats map[string]metrics.PodUsage
+	if features.Enabled(features.KubeletStats) {
+		stats, err = metrics.KubeletUsage(ctx, clientset, nodesOf(podList.Items))
+		if err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to read kubelet stats")
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadHistory(); err != nil {
+		return err
+	}
+	for i := range podList.Items {
+		m.record(clusterName, &podList.Items[i], usage, stats, now)
+	}
+	m.prune(clusterName, now.AddDate(0, 0, -settings.RetentionDays))
+
+	return utils.WriteJSONFile(m.historyPath, m.history)
+}
+
+// record adds the usage and the OOM kills of a pod to the history of its workload, the caller
+// must hold the mutex
+func (m *Manager) record(clusterName string, pod *corev1.Pod, usage map[string]int64, stats map[string]metrics.PodUsage, now time.Time) {
+	kind, name := workloadOf(pod)
+	key := clusterName + "/" + pod.Namespace + "/" + kind + "/" + name
+	history := m.history[key]
+	if history == nil {
+		history = &WorkloadHistory{
+			Cluster:    clusterName,
+			Namespace:  pod.Namespace,
+			Kind:       kind,
+			Name:       name,
+			Containers: map[string]*ContainerHistory{},
+			Kills:      map[string]time.Time{},
+		}
+		m.history[key] = history
+	}
+	if history.Kills == nil {
+		history.Kills = map[string]time.Time{}
+	}
+
+	containerOf := func(name string) *ContainerHistory {
+		container := history.Containers[name]
+		if container == nil {
+			container = &ContainerHistory{Container: name, Buckets: []Bucket{}, OOMKills: []time.Time{}}
+			history.Containers[name] = container
+		}
+		return container
+	}
+
+	// Native sidecars run alongside the containers and have limits of their own
+	containers := append([]corev1.Container{}, pod.Spec.Containers...)
+	for _, initContainer := range pod.Spec.InitContainers {
+		if initContainer.RestartPolicy != nil && *initContainer.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			containers = append(containers, initContainer)
+		}
+	}
+
+	hour := now.UTC().Truncate(time.Hour)
+	podStats := stats[pod.Namespace+"/"+pod.Name]
+	for _, spec := range containers {
+		container := containerOf(spec.Name)
+		container.LimitBytes = spec.Resources.Limits.Memory().Value()
+		container.RequestBytes = spec.Resources.Requests.Memory().Value()
+
+		if used, ok := usage[pod.Namespace+"/"+pod.Name+"/"+spec.Name]; ok {
+			bucket := container.bucket(hour)
+			if used > bucket.PeakBytes {
+				bucket.PeakBytes = used
+			}
+		}
+		if written, ok := podStats.FilesystemBytes[spec.Name]; ok {
+			bucket := container.bucket(hour)
+			if written > bucket.PeakFilesystemBytes {
+				bucket.PeakFilesystemBytes = written
+			}
+		}
+	}
+	if podStats.Network {
+		history.recordNetwork(pod.Name, podStats, hour)
+	}
+
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		for _, terminated := range []*corev1.ContainerStateTerminated{status.LastTerminationState.Terminated, status.State.Terminated} {
+			if terminated == nil || terminated.Reason != "OOMKilled" {
+				continue
+			}
+			finishedAt := terminated.FinishedAt.Time
+			if finishedAt.IsZero() {
+				finishedAt = now
+			}
+			killKey := pod.Name + "/" + status.Name + "/" + finishedAt.UTC().Format(time.RFC3339)
+			if _, counted := history.Kills[killKey]; counted {
+				continue
+			}
+			history.Kills[killKey] = finishedAt
+			container := containerOf(status.Name)
+			container.OOMKills = append(container.OOMKills, finishedAt)
+		}
+	}
+}
+
+// recordNetwork adds the throughput of a pod since its previous counters to the bucket of the hour
+func (h *WorkloadHistory) recordNetwork(pod string, usage metrics.PodUsage, hour time.Time) {
+	if h.Network == nil {
+		h.Network = &NetworkHistory{Counters: map[string]NetworkCounter{}, Buckets: []NetworkBucket{}}
+	}
+	previous, seen := h.Network.Counters[pod]
+	h.Network.Counters[pod] = NetworkCounter{At: usage.Time, RxBytes: usage.RxBytes, TxBytes: usage.TxBytes}
+	if !seen {
+		return
+	}
+
+	elapsed := usage.Time.Sub(previous.At)
+	rx := metrics.BytesPerSecond(previous.RxBytes, usage.RxBytes, elapsed)
+	tx := metrics.BytesPerSecond(previous.TxBytes, usage.TxBytes, elapsed)
+	buckets := h.Network.Buckets
+	if n := len(buckets); n == 0 || !buckets[n-1].Start.Equal(hour) {
+		h.Network.Buckets = append(buckets, NetworkBucket{Start: hour})
+	}
+	bucket := &h.Network.Buckets[len(h.Network.Buckets)-1]
+	bucket.PeakRxBytesPerSecond = math.Max(bucket.PeakRxBytesPerSecond, rx)
+	bucket.PeakTxBytesPerSecond = math.Max(bucket.PeakTxBytesPerSecond, tx)
+}
+
+// prune drops the samples and kills of a cluster older than the cutoff, and the workloads left
+// without any, the caller must hold the mutex
+func (m *Manager) prune(clusterName string, cutoff time.Time) {
+	for key, history := range m.history {
+		if history.Cluster != clusterName {
+			continue
+		}
+		for killKey, at := range history.Kills {
+			if at.Before(cutoff) {
+				delete(history.Kills, killKey)
+			}
+		}
+		for name, container := range history.Containers {
+			buckets := container.Buckets[:0]
+			for _, bucket := range container.Buckets {
+				if !bucket.Start.Before(cutoff) {
+					buckets = append(buckets, bucket)
+				}
+			}
+			container.Buckets = buckets
+			kills := container.OOMKills[:0]
+			for _, kill := range container.OOMKills {
+				if !kill.Before(cutoff) {
+					kills = append(kills, kill)
+				}
+			}
+			container.OOMKills = kills
+			if len(container.Buckets) == 0 && len(container.OOMKills) == 0 {
+				delete(history.Containers, name)
+			}
+		}
+		if network := history.Network; network != nil {
+			for pod, counter := range network.Counters {
+				if counter.At.Before(cutoff) {
+					delete(network.Counters, pod)
+				}
+			}
+			buckets := network.Buckets[:0]
+			for _, bucket := range network.Buckets {
+				if !bucket.Start.Before(cutoff) {
+					buckets = append(buckets, bucket)
+				}
+			}
+			network.Buckets = buckets
+		}
+		if len(history.Containers) == 0 {
+			delete(m.history, key)
+		}
+	}
+}
+
+// memoryUsage reads the working set of every container from the metrics API, keyed by
+// namespace/pod/container
+func memoryUsage(ctx context.Context, clientset *kubernetes.Clientset) (map[string]int64, error) {
+	podMetrics := &v1beta1.PodMetricsList{}
+	if err := clientset.RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/pods").Do(ctx).Into(podMetrics); err != nil {
+		return nil, err
+	}
+	usage := map[string]int64{}
+	for _, item := range podMetrics.Items {
+		for _, container := range item.Containers {
+			usage[item.Namespace+"/"+item.Name+"/"+container.Name] = container.Usage.Memory().Value()
+		}
+	}
+	return usage, nil
+}
+
+// nodesOf returns the nodes the pods are scheduled on
+func nodesOf(pods []corev1.Pod) []string {
+	seen := map[string]bool{}
+	nodes := []string{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && !seen[pod.Spec.NodeName] {
+			seen[pod.Spec.NodeName] = true
+			nodes = append(nodes, pod.Spec.NodeName)
+		}
+	}
+	return nodes
+}
+
+// workloadOf returns the kind and name of the workload controlling a pod, the pod itself without one
+func workloadOf(pod *corev1.Pod) (string, string) {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		if hash := pod.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+		return owner.Kind, owner.Name
+	}
+	return "Pod", pod.Name
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+func (m *Manager) loadHistory() error {
+	if m.loaded {
+		return nil
+	}
+	history := map[string]*WorkloadHistory{}
+	if err := utils.ReadJSONFile(m.historyPath, &history); err != nil {
+		return err
+	}
+	m.history = history
+	m.loaded = true
+	return nil
+}
@@ -0,0 +1,303 @@
+package oomkill
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Container memory states
+const (
+	StatusOK = "ok"
+	// StatusAtRisk means the observed peak is close to the limit
+	StatusAtRisk    = "at-risk"
+	StatusOOMKilled = "oom-killed"
+	// StatusOverProvisioned means the peak stays far below the limit
+	StatusOverProvisioned = "over-provisioned"
+	// StatusUnbounded means the container has no memory limit
+	StatusUnbounded = "unbounded"
+)
+
+const (
+	mib = 1 << 20
+
+	// atRiskRatio is the peak to limit ratio from which a container is at risk
+	atRiskRatio = 0.9
+	// overProvisionedRatio is the peak to limit ratio below which a limit can be lowered
+	overProvisionedRatio = 0.5
+	// minHoursForDecrease is how much history is needed before recommending a lower limit
+	minHoursForDecrease = 24
+
+	// peakHeadroom is the percentage of the observed peak given as limit to containers that weren't killed
+	peakHeadroom = 125
+	// oomGrowth is the percentage a limit grows after a kill, the sampled peak misses the spike before it
+	oomGrowth = 150
+	// requestHeadroom is the percentage of the p95 of the hourly peaks given as request
+	requestHeadroom = 110
+)
+
+// Bucket is the memory peak of a container over an hour
+type Bucket struct {
+	Start     time.Time `json:"start"`
+	PeakBytes int64     `json:"peakBytes"`
+	// PeakFilesystemBytes is the most the container had written to its writable layer and logs,
+	// sampled from the kubelet
+	PeakFilesystemBytes int64 `json:"peakFilesystemBytes,omitempty"`
+}
+
+// ContainerHistory is what is recorded of a container of a workload, across its pods
+type ContainerHistory struct {
+	Container    string      `json:"container"`
+	LimitBytes   int64       `json:"limitBytes"`
+	RequestBytes int64       `json:"requestBytes"`
+	Buckets      []Bucket    `json:"buckets"`
+	OOMKills     []time.Time `json:"oomKills"`
+}
+
+// WorkloadHistory is the memory history of the containers of a workload
+type WorkloadHistory struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	// Containers are keyed by container name
+	Containers map[string]*ContainerHistory `json:"containers"`
+	// Kills holds the terminations already counted by pod/container/finishedAt, to count each kill once
+	Kills map[string]time.Time `json:"kills"`
+	// Network is sampled from the kubelet, nil until it is
+	Network *NetworkHistory `json:"network,omitempty"`
+}
+
+// NetworkHistory is the network throughput of the pods of a workload
+type NetworkHistory struct {
+	// Counters are the last cumulative counters read of each pod, throughput is taken between two reads
+	Counters map[string]NetworkCounter `json:"counters"`
+	Buckets  []NetworkBucket           `json:"buckets"`
+}
+
+// NetworkCounter is a reading of the cumulative network counters of a pod
+type NetworkCounter struct {
+	At      time.Time `json:"at"`
+	RxBytes int64     `json:"rxBytes"`
+	TxBytes int64     `json:"txBytes"`
+}
+
+// NetworkBucket is the highest throughput of a pod of a workload over an hour
+type NetworkBucket struct {
+	Start                time.Time `json:"start"`
+	PeakRxBytesPerSecond float64   `json:"peakRxBytesPerSecond"`
+	PeakTxBytesPerSecond float64   `json:"peakTxBytesPerSecond"`
+}
+
+// ContainerReport compares the limit of a container to its observed memory peaks and OOM kills
+type ContainerReport struct {
+	Container    string `json:"container"`
+	LimitBytes   int64  `json:"limitBytes"`
+	RequestBytes int64  `json:"requestBytes"`
+	PeakBytes    int64  `json:"peakBytes"`
+	// PeakFilesystemBytes is the most written to the writable layer and logs, 0 without kubelet stats
+	PeakFilesystemBytes int64 `json:"peakFilesystemBytes,omitempty"`
+	// P95Bytes is the 95th percentile of the hourly peaks
+	P95Bytes int64 `json:"p95Bytes"`
+	// LimitUtilization is the peak over the limit, 0 without limit
+	LimitUtilization float64         `json:"limitUtilization"`
+	OOMKills         int             `json:"oomKills"`
+	OOMKillsPerDay   float64         `json:"oomKillsPerDay"`
+	LastOOMKill      *time.Time      `json:"lastOOMKill,omitempty"`
+	HoursObserved    int             `json:"hoursObserved"`
+	Status           string          `json:"status"`
+	Recommendation   *Recommendation `json:"recommendation,omitempty"`
+}
+
+// Recommendation is a memory limit and request adjustment for a container
+type Recommendation struct {
+	LimitBytes   int64  `json:"limitBytes"`
+	RequestBytes int64  `json:"requestBytes"`
+	Reason       string `json:"reason"`
+}
+
+// WorkloadReport is the memory report of a workload
+type WorkloadReport struct {
+	Cluster    string            `json:"cluster"`
+	Namespace  string            `json:"namespace"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	OOMKills   int               `json:"oomKills"`
+	Status     string            `json:"status"`
+	Containers []ContainerReport `json:"containers"`
+	// Peak network throughput of a single pod, 0 without kubelet stats
+	PeakRxBytesPerSecond float64 `json:"peakRxBytesPerSecond,omitempty"`
+	PeakTxBytesPerSecond float64 `json:"peakTxBytesPerSecond,omitempty"`
+}
+
+var statusRank = map[string]int{StatusOK: 0, StatusOverProvisioned: 1, StatusUnbounded: 2, StatusAtRisk: 3, StatusOOMKilled: 4}
+
+// report analyzes the history of a workload since the given time
+func report(history *WorkloadHistory, since time.Time) WorkloadReport {
+	result := WorkloadReport{
+		Cluster:    history.Cluster,
+		Namespace:  history.Namespace,
+		Kind:       history.Kind,
+		Name:       history.Name,
+		Status:     StatusOK,
+		Containers: []ContainerReport{},
+	}
+
+	names := make([]string, 0, len(history.Containers))
+	for name := range history.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		container := containerReport(history.Containers[name], since)
+		result.OOMKills += container.OOMKills
+		if statusRank[container.Status] > statusRank[result.Status] {
+			result.Status = container.Status
+		}
+		result.Containers = append(result.Containers, container)
+	}
+
+	if history.Network != nil {
+		for _, bucket := range history.Network.Buckets {
+			if bucket.Start.Before(since) {
+				continue
+			}
+			result.PeakRxBytesPerSecond = math.Max(result.PeakRxBytesPerSecond, bucket.PeakRxBytesPerSecond)
+			result.PeakTxBytesPerSecond = math.Max(result.PeakTxBytesPerSecond, bucket.PeakTxBytesPerSecond)
+		}
+	}
+	return result
+}
+
+func containerReport(history *ContainerHistory, since time.Time) ContainerReport {
+	result := ContainerReport{
+		Container:    history.Container,
+		LimitBytes:   history.LimitBytes,
+		RequestBytes: history.RequestBytes,
+	}
+
+	peaks := []int64{}
+	for _, bucket := range history.Buckets {
+		if bucket.Start.Before(since) {
+			continue
+		}
+		if bucket.PeakFilesystemBytes > result.PeakFilesystemBytes {
+			result.PeakFilesystemBytes = bucket.PeakFilesystemBytes
+		}
+		// Hours only sampled from the kubelet hold no memory usage
+		if bucket.PeakBytes == 0 {
+			continue
+		}
+		peaks = append(peaks, bucket.PeakBytes)
+		if bucket.PeakBytes > result.PeakBytes {
+			result.PeakBytes = bucket.PeakBytes
+		}
+	}
+	result.HoursObserved = len(peaks)
+	result.P95Bytes = percentile(peaks, 0.95)
+
+	for _, kill := range history.OOMKills {
+		if kill.Before(since) {
+			continue
+		}
+		result.OOMKills++
+		if result.LastOOMKill == nil || kill.After(*result.LastOOMKill) {
+			last := kill
+			result.LastOOMKill = &last
+		}
+	}
+	if result.HoursObserved > 0 {
+		result.OOMKillsPerDay = float64(result.OOMKills) * 24 / float64(result.HoursObserved)
+	}
+	if result.LimitBytes > 0 {
+		result.LimitUtilization = float64(result.PeakBytes) / float64(result.LimitBytes)
+	}
+
+	result.Status, result.Recommendation = recommend(result)
+	return result
+}
+
+// bucket returns the bucket of the hour, appending it on the first sample of the hour
+func (c *ContainerHistory) bucket(hour time.Time) *Bucket {
+	if n := len(c.Buckets); n > 0 && c.Buckets[n-1].Start.Equal(hour) {
+		return &c.Buckets[n-1]
+	}
+	c.Buckets = append(c.Buckets, Bucket{Start: hour})
+	return &c.Buckets[len(c.Buckets)-1]
+}
+
+// recommend classifies a container and proposes a limit covering its peaks with headroom, and a
+// request at the p95 of its hourly peaks. Killed containers always get a higher limit.
+func recommend(c ContainerReport) (string, *Recommendation) {
+	request := scale(c.P95Bytes, requestHeadroom)
+	switch {
+	case c.OOMKills > 0:
+		limit := scale(maxInt64(c.LimitBytes, c.PeakBytes), oomGrowth)
+		if limit == 0 {
+			return StatusOOMKilled, nil
+		}
+		return StatusOOMKilled, &Recommendation{
+			LimitBytes:   limit,
+			RequestBytes: minInt64(maxInt64(request, c.RequestBytes), limit),
+			Reason:       "the container was OOM killed, raise the limit above the observed peak",
+		}
+	case c.LimitBytes == 0:
+		if c.HoursObserved == 0 {
+			return StatusUnbounded, nil
+		}
+		return StatusUnbounded, &Recommendation{
+			LimitBytes:   scale(c.PeakBytes, peakHeadroom),
+			RequestBytes: request,
+			Reason:       "the container has no memory limit, bound it above the observed peak",
+		}
+	case c.LimitUtilization >= atRiskRatio:
+		limit := scale(c.PeakBytes, peakHeadroom)
+		return StatusAtRisk, &Recommendation{
+			LimitBytes:   limit,
+			RequestBytes: minInt64(maxInt64(request, c.RequestBytes), limit),
+			Reason:       "the observed peak is close to the limit",
+		}
+	case c.HoursObserved >= minHoursForDecrease && c.LimitUtilization < overProvisionedRatio:
+		return StatusOverProvisioned, &Recommendation{
+			LimitBytes:   scale(c.PeakBytes, peakHeadroom),
+			RequestBytes: request,
+			Reason:       "the observed peak stays far below the limit",
+		}
+	}
+	return StatusOK, nil
+}
+
+// percentile returns the nearest-rank percentile of the values
+func percentile(values []int64, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// scale applies a percentage to bytes and rounds up to a whole MiB
+func scale(bytes, percent int64) int64 {
+	scaled := bytes * percent / 100
+	return (scaled + mib - 1) / mib * mib
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
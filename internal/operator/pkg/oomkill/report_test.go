@@ -0,0 +1,162 @@
+package oomkill
+
+import (
+	"testing"
+	"time"
+)
+
+func hourlyPeaks(start time.Time, peaks ...int64) []Bucket {
+	buckets := make([]Bucket, 0, len(peaks))
+	for i, peak := range peaks {
+		buckets = append(buckets, Bucket{Start: start.Add(time.Duration(i) * time.Hour), PeakBytes: peak})
+	}
+	return buckets
+}
+
+func repeat(value int64, n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestContainerReport(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		history     ContainerHistory
+		wantStatus  string
+		wantLimit   int64
+		wantRequest int64
+	}{
+		{
+			name:       "healthy",
+			history:    ContainerHistory{LimitBytes: 512 * mib, Buckets: hourlyPeaks(start, repeat(300*mib, 30)...)},
+			wantStatus: StatusOK,
+		},
+		{
+			name: "killed",
+			history: ContainerHistory{LimitBytes: 256 * mib, RequestBytes: 128 * mib,
+				Buckets: hourlyPeaks(start, 200*mib, 240*mib), OOMKills: []time.Time{start.Add(90 * time.Minute)}},
+			wantStatus:  StatusOOMKilled,
+			wantLimit:   384 * mib,
+			wantRequest: 264 * mib,
+		},
+		{
+			name:        "close to the limit",
+			history:     ContainerHistory{LimitBytes: 100 * mib, Buckets: hourlyPeaks(start, 80*mib, 95*mib)},
+			wantStatus:  StatusAtRisk,
+			wantLimit:   119 * mib,
+			wantRequest: 105 * mib,
+		},
+		{
+			name:        "over-provisioned",
+			history:     ContainerHistory{LimitBytes: 2048 * mib, Buckets: hourlyPeaks(start, repeat(400*mib, 24)...)},
+			wantStatus:  StatusOverProvisioned,
+			wantLimit:   500 * mib,
+			wantRequest: 440 * mib,
+		},
+		{
+			name:       "over-provisioned without enough history",
+			history:    ContainerHistory{LimitBytes: 2048 * mib, Buckets: hourlyPeaks(start, repeat(400*mib, 6)...)},
+			wantStatus: StatusOK,
+		},
+		{
+			name:        "unbounded",
+			history:     ContainerHistory{Buckets: hourlyPeaks(start, 100*mib)},
+			wantStatus:  StatusUnbounded,
+			wantLimit:   125 * mib,
+			wantRequest: 110 * mib,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := containerReport(&tt.history, start)
+			if got.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if tt.wantLimit == 0 {
+				if got.Recommendation != nil {
+					t.Errorf("recommendation = %+v, want none", got.Recommendation)
+				}
+				return
+			}
+			if got.Recommendation == nil {
+				t.Fatal("recommendation = nil")
+			}
+			if got.Recommendation.LimitBytes != tt.wantLimit || got.Recommendation.RequestBytes != tt.wantRequest {
+				t.Errorf("recommendation = %d/%d MiB, want %d/%d MiB", got.Recommendation.LimitBytes/mib,
+					got.Recommendation.RequestBytes/mib, tt.wantLimit/mib, tt.wantRequest/mib)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	history := &WorkloadHistory{
+		Cluster: "prod", Namespace: "shop", Kind: "Deployment", Name: "api",
+		Containers: map[string]*ContainerHistory{
+			"app": {Container: "app", LimitBytes: 256 * mib, Buckets: hourlyPeaks(start, 250*mib),
+				OOMKills: []time.Time{start.Add(-48 * time.Hour), start.Add(time.Hour), start.Add(2 * time.Hour)}},
+			"proxy": {Container: "proxy", LimitBytes: 128 * mib, Buckets: hourlyPeaks(start, 20*mib)},
+		},
+	}
+
+	got := report(history, start)
+	if got.Status != StatusOOMKilled || got.OOMKills != 2 || len(got.Containers) != 2 {
+		t.Fatalf("report() = %+v, want two kills since the start", got)
+	}
+	app := got.Containers[0]
+	if app.Container != "app" || app.LastOOMKill == nil || !app.LastOOMKill.Equal(start.Add(2*time.Hour)) || app.OOMKillsPerDay != 48 {
+		t.Errorf("app report = %+v", app)
+	}
+}
+
+func TestReportKubeletStats(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	buckets := hourlyPeaks(start, 100*mib, 0)
+	buckets[0].PeakFilesystemBytes = 30 * mib
+	buckets[1].PeakFilesystemBytes = 50 * mib
+	history := &WorkloadHistory{
+		Containers: map[string]*ContainerHistory{"app": {Container: "app", LimitBytes: 256 * mib, Buckets: buckets}},
+		Network: &NetworkHistory{Buckets: []NetworkBucket{
+			{Start: start.Add(-time.Hour), PeakRxBytesPerSecond: 9000},
+			{Start: start, PeakRxBytesPerSecond: 2000, PeakTxBytesPerSecond: 300},
+			{Start: start.Add(time.Hour), PeakRxBytesPerSecond: 1000, PeakTxBytesPerSecond: 800},
+		}},
+	}
+
+	got := report(history, start)
+	if got.PeakRxBytesPerSecond != 2000 || got.PeakTxBytesPerSecond != 800 {
+		t.Errorf("network peaks = %v/%v, want 2000/800 since the start", got.PeakRxBytesPerSecond, got.PeakTxBytesPerSecond)
+	}
+	app := got.Containers[0]
+	// The second hour only has filesystem usage and doesn't count as a memory sample
+	if app.PeakFilesystemBytes != 50*mib || app.HoursObserved != 1 || app.P95Bytes != 100*mib {
+		t.Errorf("app report = %+v", app)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+
+	values := []int64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	if got := percentile(values, 0.95); got != 19 {
+		t.Errorf("percentile() = %d, want 19", got)
+	}
+	if got := percentile(nil, 0.95); got != 0 {
+		t.Errorf("percentile() of no values = %d, want 0", got)
+	}
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BaselineBundle names the built-in bundle manifests are reviewed against when no bundle is enabled
+const BaselineBundle = "baseline"
+
+// podSpecPaths locates the pod spec of the kinds running pods, by apiVersion
+var podSpecPaths = []struct {
+	apiVersion string
+	kinds      []string
+	path       string
+}{
+	{"v1", []string{"Pod"}, "object.spec"},
+	{"apps/v1", []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}, "object.spec.template.spec"},
+	{"batch/v1", []string{"Job"}, "object.spec.template.spec"},
+	{"batch/v1", []string{"CronJob"}, "object.spec.jobTemplate.spec.template.spec"},
+}
+
+// baselineRules are CEL expressions over the pod spec, written with %[1]s for its path.
+// everyContainer expands to a condition every container and init container of the spec must meet.
+var baselineRules = []struct {
+	name, severity, message, expression string
+}{
+	{
+		"privileged-containers", "High", "containers must not run privileged",
+		everyContainer("!has(c.securityContext) || !has(c.securityContext.privileged) || !c.securityContext.privileged"),
+	},
+	{
+		"host-namespaces", "High", "pods must not share the host network, PID or IPC namespaces",
+		"!(has(%[1]s.hostNetwork) && %[1]s.hostNetwork) && !(has(%[1]s.hostPID) && %[1]s.hostPID) && !(has(%[1]s.hostIPC) && %[1]s.hostIPC)",
+	},
+	{
+		"privilege-escalation", "Medium", "containers must set allowPrivilegeEscalation to false",
+		everyContainer("has(c.securityContext) && has(c.securityContext.allowPrivilegeEscalation) && !c.securityContext.allowPrivilegeEscalation"),
+	},
+	{
+		"run-as-non-root", "Medium", "pods or all their containers must set runAsNonRoot",
+		"(has(%[1]s.securityContext) && has(%[1]s.securityContext.runAsNonRoot) && %[1]s.securityContext.runAsNonRoot) || (" +
+			everyContainer("has(c.securityContext) && has(c.securityContext.runAsNonRoot) && c.securityContext.runAsNonRoot") + ")",
+	},
+	{
+		"resource-limits", "Medium", "containers must set cpu and memory limits",
+		everyContainer("has(c.resources) && has(c.resources.limits) && 'cpu' in c.resources.limits && 'memory' in c.resources.limits"),
+	},
+	{
+		"hostpath-volumes", "Medium", "pods must not mount hostPath volumes",
+		"!has(%[1]s.volumes) || %[1]s.volumes.all(v, !has(v.hostPath))",
+	},
+	{
+		"pinned-image-tags", "Low", "container images must be pinned to a tag other than latest, or a digest",
+		everyContainer("c.image.contains('@') || (c.image.matches(':[^/:]+$') && !c.image.endsWith(':latest'))"),
+	},
+}
+
+func everyContainer(condition string) string {
+	return fmt.Sprintf("%%[1]s.containers.all(c, %[1]s) && (!has(%%[1]s.initContainers) || %%[1]s.initContainers.all(c, %[1]s))", condition)
+}
+
+// baselineBundle is the compiled built-in bundle, checking the pods of every kind running them
+var baselineBundle = sync.OnceValues(func() (*compiledBundle, error) {
+	bundle := &Bundle{
+		Name:        BaselineBundle,
+		Description: "Built-in checks of the pods run by workloads: privileges, host access, resource limits and image tags",
+		Language:    LanguageCEL,
+		Enabled:     true,
+	}
+	for _, rule := range baselineRules {
+		for _, spec := range podSpecPaths {
+			bundle.Policies = append(bundle.Policies, Policy{
+				Name:       rule.name,
+				Severity:   rule.severity,
+				Message:    rule.message,
+				Match:      Match{APIVersion: spec.apiVersion, Kinds: spec.kinds},
+				Expression: fmt.Sprintf(rule.expression, spec.path),
+			})
+		}
+	}
+	return compileBundle(bundle)
+})
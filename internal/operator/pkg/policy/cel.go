@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// celCostLimit bounds the work of a single evaluation so a comprehension over a large object
+// cannot stall the engine
+const celCostLimit = 1000000
+
+// celEnvironment declares the "object" variable policies are written against, with the string
+// and set extensions also available in Kubernetes validation rules
+var celEnvironment = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+		ext.Sets(),
+	)
+})
+
+// compileCEL type-checks a CEL expression and plans it for evaluation
+func compileCEL(expression string) (cel.Program, error) {
+	env, err := celEnvironment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if output := ast.OutputType(); !output.IsExactType(cel.BoolType) && !output.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression must evaluate to bool, got %s", output)
+	}
+
+	return env.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+// evalCEL evaluates a compiled expression against an object and requires a boolean result
+func evalCEL(program cel.Program, object map[string]interface{}) (bool, error) {
+	result, _, err := program.Eval(map[string]interface{}{"object": object})
+	if err != nil {
+		return false, err
+	}
+	b, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to bool, got %s", result.Type().TypeName())
+	}
+	return b, nil
+}
@@ -0,0 +1,95 @@
+package policy
+
+import "testing"
+
+func TestEvalCEL(t *testing.T) {
+	t.Parallel()
+
+	object := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"team": "payments"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":            "app",
+							"image":           "registry.example.com/web:1.2.3",
+							"securityContext": map[string]interface{}{"runAsNonRoot": true},
+						},
+						map[string]interface{}{
+							"name":  "sidecar",
+							"image": "envoy:latest",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{name: "comparison", expression: "object.spec.replicas >= 2", want: true},
+		{name: "int and double", expression: "object.spec.replicas == 3.0", want: true},
+		{name: "arithmetic precedence", expression: "1 + 2 * 3 == 7", want: true},
+		{name: "has present", expression: "has(object.metadata.labels)", want: true},
+		{name: "has missing", expression: "has(object.metadata.annotations)", want: false},
+		{name: "in map", expression: "'team' in object.metadata.labels", want: true},
+		{name: "in list", expression: "object.metadata.name in ['web', 'api']", want: true},
+		{name: "index", expression: "object.metadata.labels['team'] == 'payments'", want: true},
+		{name: "all fails", expression: "object.spec.template.spec.containers.all(c, has(c.securityContext) && c.securityContext.runAsNonRoot)", want: false},
+		{name: "exists", expression: "object.spec.template.spec.containers.exists(c, c.image.endsWith(':latest'))", want: true},
+		{name: "exists_one", expression: "object.spec.template.spec.containers.exists_one(c, c.name.startsWith('s'))", want: true},
+		{name: "filter and size", expression: "object.spec.template.spec.containers.filter(c, !c.image.contains('/')).size() == 1", want: true},
+		{name: "map", expression: "object.spec.template.spec.containers.map(c, c.name) == ['app', 'sidecar']", want: true},
+		{name: "matches", expression: "object.metadata.name.matches('^w[a-z]+$')", want: true},
+		{name: "conditional", expression: "object.spec.replicas > 5 ? false : true", want: true},
+		{name: "or absorbs error", expression: "object.spec.missing == 1 || true", want: true},
+		{name: "and absorbs error", expression: "object.spec.missing == 1 && false", want: false},
+		{name: "missing key", expression: "object.spec.missing == 1", wantErr: true},
+		{name: "non bool result", expression: "object.spec.replicas", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			program, err := compileCEL(tt.expression)
+			if err != nil {
+				t.Fatalf("compileCEL(%q) error = %v", tt.expression, err)
+			}
+			got, err := evalCEL(program, object)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evalCEL(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("evalCEL(%q) = %v, want %v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileCELErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, expression := range []string{
+		"object.spec.",
+		"has(object)",
+		"(1 + 2",
+		"'unterminated",
+		"object.spec.containers.all(1, true)",
+		"1 + 2",
+	} {
+		if _, err := compileCEL(expression); err == nil {
+			t.Errorf("compileCEL(%q) expected an error", expression)
+		}
+	}
+}
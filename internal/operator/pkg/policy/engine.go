@@ -0,0 +1,409 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	evaluationTimeout = 10 * time.Minute
+	// maxRunErrors caps the evaluation errors kept on a bundle's last run
+	maxRunErrors = 20
+)
+
+// evaluator checks objects against a single compiled policy
+type evaluator interface {
+	// evaluate returns the result of each object, in order
+	evaluate(ctx context.Context, objects []map[string]interface{}) ([]objectResult, error)
+}
+
+type objectResult struct {
+	violations []string
+	err        error
+}
+
+type compiledPolicy struct {
+	Policy
+	evaluator evaluator
+	selector  labels.Selector
+}
+
+type compiledBundle struct {
+	bundle   *Bundle
+	policies []*compiledPolicy
+}
+
+// compileBundle compiles every policy of a bundle, reporting the first invalid one
+func compileBundle(bundle *Bundle) (*compiledBundle, error) {
+	compiled := &compiledBundle{bundle: bundle}
+	for _, policy := range bundle.Policies {
+		cp := &compiledPolicy{Policy: policy, selector: labels.Everything()}
+		if policy.Match.LabelSelector != "" {
+			selector, err := labels.Parse(policy.Match.LabelSelector)
+			if err != nil {
+				return nil, fmt.Errorf("policy %q: invalid label selector: %v", policy.Name, err)
+			}
+			cp.selector = selector
+		}
+
+		switch bundle.Language {
+		case LanguageRego:
+			ev, err := newRegoEvaluator(policy.Module)
+			if err != nil {
+				return nil, fmt.Errorf("policy %q: %v", policy.Name, err)
+			}
+			cp.evaluator = ev
+		default:
+			program, err := compileCEL(policy.Expression)
+			if err != nil {
+				return nil, fmt.Errorf("policy %q: invalid expression: %v", policy.Name, err)
+			}
+			cp.evaluator = &celEvaluator{program: program, expression: policy.Expression, message: policy.Message}
+		}
+		compiled.policies = append(compiled.policies, cp)
+	}
+	return compiled, nil
+}
+
+// celEvaluator reports a violation for every object the expression is false for
+type celEvaluator struct {
+	program    cel.Program
+	expression string
+	message    string
+}
+
+func (e *celEvaluator) evaluate(_ context.Context, objects []map[string]interface{}) ([]objectResult, error) {
+	results := make([]objectResult, len(objects))
+	for i, object := range objects {
+		ok, err := evalCEL(e.program, object)
+		if err != nil {
+			results[i].err = err
+			continue
+		}
+		if !ok {
+			message := e.message
+			if message == "" {
+				message = "failed expression: " + e.expression
+			}
+			results[i].violations = []string{message}
+		}
+	}
+	return results, nil
+}
+
+// matchesNamespace reports whether objects of the namespace are in scope of the policy
+func (p *compiledPolicy) matchesNamespace(namespace string) bool {
+	for _, excluded := range p.Match.ExcludedNamespaces {
+		if namespace == excluded {
+			return false
+		}
+	}
+	if len(p.Match.Namespaces) == 0 || namespace == "" {
+		return true
+	}
+	for _, ns := range p.Match.Namespaces {
+		if namespace == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *compiledPolicy) matchesKind(apiVersion, kind string) bool {
+	if apiVersion != p.Match.APIVersion {
+		return false
+	}
+	for _, k := range p.Match.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// findingsFor turns the evaluation results of objects into findings
+func (p *compiledPolicy) findingsFor(bundleName, clusterName, resource string, objects []map[string]interface{}, results []objectResult, now time.Time) ([]Finding, []string) {
+	var findings []Finding
+	var errs []string
+	for i, result := range results {
+		object := objects[i]
+		namespace, name := objectKey(object)
+		if result.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s %s: %v", p.Name, strings.ToLower(stringField(object, "kind")), joinKey(namespace, name), result.err))
+			continue
+		}
+		for _, message := range result.violations {
+			findings = append(findings, Finding{
+				Bundle:     bundleName,
+				Policy:     p.Name,
+				Severity:   p.Severity,
+				Message:    message,
+				Cluster:    clusterName,
+				Namespace:  namespace,
+				APIVersion: stringField(object, "apiVersion"),
+				Kind:       stringField(object, "kind"),
+				Resource:   resource,
+				Name:       name,
+				FirstSeen:  now,
+				LastSeen:   now,
+			})
+		}
+	}
+	return findings, errs
+}
+
+// evaluateCluster evaluates every policy of the bundle against the live objects of a cluster
+func (m *Manager) evaluateCluster(ctx context.Context, compiled *compiledBundle, clusterName string) ([]Finding, int, []string, error) {
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create discovery client: %v", err)
+	}
+
+	var findings []Finding
+	var errs []string
+	evaluated := 0
+	now := time.Now()
+	for _, policy := range compiled.policies {
+		resources, err := resolveResources(discoveryClient, policy.Match)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", policy.Name, err))
+			continue
+		}
+
+		for _, resource := range resources {
+			objects, err := listObjects(ctx, dynamicClient, resource, policy)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", policy.Name, err))
+				continue
+			}
+			if len(objects) == 0 {
+				continue
+			}
+
+			results, err := policy.evaluator.evaluate(ctx, objects)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", policy.Name, err))
+				continue
+			}
+			evaluated += len(objects)
+			policyFindings, policyErrs := policy.findingsFor(compiled.bundle.Name, clusterName, resource.gvr.Resource, objects, results, now)
+			findings = append(findings, policyFindings...)
+			errs = append(errs, policyErrs...)
+		}
+	}
+	return findings, evaluated, errs, nil
+}
+
+type matchedResource struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+// resolveResources maps the kinds of a match to the resources serving them
+func resolveResources(discoveryClient discovery.DiscoveryInterface, match Match) ([]matchedResource, error) {
+	gv, err := schema.ParseGroupVersion(match.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion %q: %v", match.APIVersion, err)
+	}
+	list, err := discoveryClient.ServerResourcesForGroupVersion(match.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %v", match.APIVersion, err)
+	}
+
+	var resources []matchedResource
+	for _, kind := range match.Kinds {
+		found := false
+		for _, r := range list.APIResources {
+			if r.Kind == kind && !strings.Contains(r.Name, "/") {
+				resources = append(resources, matchedResource{gvr: gv.WithResource(r.Name), namespaced: r.Namespaced})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("kind %s not served by %s", kind, match.APIVersion)
+		}
+	}
+	return resources, nil
+}
+
+func listObjects(ctx context.Context, client dynamic.Interface, resource matchedResource, policy *compiledPolicy) ([]map[string]interface{}, error) {
+	namespaces := []string{metav1.NamespaceAll}
+	if resource.namespaced && len(policy.Match.Namespaces) > 0 {
+		namespaces = policy.Match.Namespaces
+	}
+
+	var objects []map[string]interface{}
+	for _, namespace := range namespaces {
+		list, err := client.Resource(resource.gvr).Namespace(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: policy.Match.LabelSelector,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", resource.gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			if !policy.matchesNamespace(item.GetNamespace()) {
+				continue
+			}
+			objects = append(objects, item.Object)
+		}
+	}
+	return objects, nil
+}
+
+// EvaluationProcessor runs queued policy evaluations
+type EvaluationProcessor struct {
+	manager *Manager
+}
+
+// NewEvaluationProcessor creates a new policy evaluation processor
+func NewEvaluationProcessor(manager *Manager) *EvaluationProcessor {
+	return &EvaluationProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation evaluates a bundle against each of its clusters and replaces their findings
+func (p *EvaluationProcessor) ProcessOperation(op *utils.Operation) error {
+	name, _ := op.Data["bundle"].(string)
+	bundle, err := p.manager.GetBundle(name)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+	compiled, err := compileBundle(bundle)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	clusters := stringsFromData(op.Data["clusters"])
+	if len(clusters) == 0 {
+		contexts, err := p.manager.kubeConfigStore.GetContexts()
+		if err != nil {
+			return fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, ctx := range contexts {
+			if !ctx.Internal {
+				clusters = append(clusters, ctx.Name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), evaluationTimeout)
+	defer cancel()
+
+	run := RunInfo{OperationID: op.ID, Clusters: clusters}
+	failed := 0
+	for i, clusterName := range clusters {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, i*100/len(clusters),
+			fmt.Sprintf("Evaluating bundle %s against %s", name, clusterName), nil)
+
+		findings, evaluated, errs, err := p.manager.evaluateCluster(ctx, compiled, clusterName)
+		if err != nil {
+			failed++
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", clusterName, err))
+			logger.Log(logger.LevelError, map[string]string{
+				"bundle":  name,
+				"cluster": clusterName,
+			}, err, "Failed to evaluate policy bundle")
+			continue
+		}
+
+		if err := p.manager.findings.replace(name, clusterName, nil, findings); err != nil {
+			return err
+		}
+		run.Evaluated += evaluated
+		run.Findings += len(findings)
+		for _, e := range errs {
+			run.Errors = append(run.Errors, clusterName+": "+e)
+		}
+	}
+
+	if len(run.Errors) > maxRunErrors {
+		run.Errors = append(run.Errors[:maxRunErrors], fmt.Sprintf("%d more errors", len(run.Errors)-maxRunErrors))
+	}
+	run.Time = time.Now()
+	p.manager.recordRun(name, run)
+
+	if failed > 0 && failed == len(clusters) {
+		return utils.NonRetryable(fmt.Errorf("evaluation failed on every cluster"))
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 100,
+		fmt.Sprintf("Evaluated %d objects, %d findings", run.Evaluated, run.Findings), nil)
+	return nil
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *EvaluationProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationEvaluate
+}
+
+func objectKey(object map[string]interface{}) (string, string) {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	return namespace, name
+}
+
+func joinKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+func stringField(object map[string]interface{}, field string) string {
+	value, _ := object[field].(string)
+	return value
+}
+
+// stringsFromData reads a string list from operation data, which may have been round-tripped through JSON
+func stringsFromData(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// resourceForKind guesses the resource name of a kind when discovery is not at hand
+func resourceForKind(apiVersion, kind string) string {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return ""
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gv.WithKind(kind))
+	return plural.Resource
+}
@@ -0,0 +1,302 @@
+package policy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/logger"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	findingsSource = "policy"
+	findingReason  = "PolicyViolation"
+
+	bundleLabel = "bundle"
+	policyLabel = "policy"
+)
+
+// Finding is a policy violation of a live object
+type Finding struct {
+	Bundle     string    `json:"bundle"`
+	Policy     string    `json:"policy"`
+	Severity   string    `json:"severity"`
+	Message    string    `json:"message"`
+	Cluster    string    `json:"cluster"`
+	Namespace  string    `json:"namespace,omitempty"`
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Resource   string    `json:"resource"`
+	Name       string    `json:"name"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// FindingsFilter narrows down a findings listing, empty fields match everything
+type FindingsFilter struct {
+	Cluster   string
+	Bundle    string
+	Policy    string
+	Severity  string
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// FindingsStore keeps the current findings of every bundle as records of the event store
+type FindingsStore struct {
+	events *event.Store
+}
+
+// NewFindingsStore creates a findings store on top of the shared event store
+func NewFindingsStore() *FindingsStore {
+	return &FindingsStore{events: event.GetStore()}
+}
+
+// List returns the findings matching the filter, most severe first
+func (s *FindingsStore) List(filter FindingsFilter) ([]Finding, error) {
+	records, err := s.events.List(filter.eventFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]Finding, 0, len(records))
+	for _, r := range records {
+		findings = append(findings, findingFromRecord(r))
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if severityRank(findings[i].Severity) != severityRank(findings[j].Severity) {
+			return severityRank(findings[i].Severity) > severityRank(findings[j].Severity)
+		}
+		return findings[i].LastSeen.After(findings[j].LastSeen)
+	})
+	return findings, nil
+}
+
+// replace swaps the findings of a bundle on a cluster for a new set. A nil scope replaces all of
+// them, otherwise only the findings inside the scope. Findings that persist keep their FirstSeen.
+func (s *FindingsStore) replace(bundle, cluster string, scope func(Finding) bool, findings []Finding) error {
+	_, err := s.replaceChanged(bundle, cluster, scope, findings, true)
+	return err
+}
+
+// replaceChanged is replace that reports whether the set of findings changed. With touch unset
+// an unchanged set is not written back, which keeps per-event updates cheap.
+func (s *FindingsStore) replaceChanged(bundle, cluster string, scope func(Finding) bool, findings []Finding, touch bool) (bool, error) {
+	records := make([]event.Record, 0, len(findings))
+	for _, f := range findings {
+		records = append(records, f.record())
+	}
+	return s.events.Replace(findingsSource, cluster, func(r event.Record) bool {
+		return r.Labels[bundleLabel] == bundle && (scope == nil || scope(findingFromRecord(r)))
+	}, records, touch)
+}
+
+func (s *FindingsStore) removeBundle(bundle string) error {
+	return s.events.Remove(findingsSource, func(r event.Record) bool {
+		return r.Labels[bundleLabel] == bundle
+	})
+}
+
+func (f Finding) record() event.Record {
+	return event.Record{
+		Source:     findingsSource,
+		Cluster:    f.Cluster,
+		Namespace:  f.Namespace,
+		APIVersion: f.APIVersion,
+		Kind:       f.Kind,
+		Resource:   f.Resource,
+		Name:       f.Name,
+		Reason:     findingReason,
+		Severity:   f.Severity,
+		Message:    f.Message,
+		Labels:     map[string]string{bundleLabel: f.Bundle, policyLabel: f.Policy},
+		FirstSeen:  f.FirstSeen,
+		LastSeen:   f.LastSeen,
+	}
+}
+
+func findingFromRecord(r event.Record) Finding {
+	return Finding{
+		Bundle:     r.Labels[bundleLabel],
+		Policy:     r.Labels[policyLabel],
+		Severity:   r.Severity,
+		Message:    r.Message,
+		Cluster:    r.Cluster,
+		Namespace:  r.Namespace,
+		APIVersion: r.APIVersion,
+		Kind:       r.Kind,
+		Resource:   r.Resource,
+		Name:       r.Name,
+		FirstSeen:  r.FirstSeen,
+		LastSeen:   r.LastSeen,
+	}
+}
+
+func (filter FindingsFilter) eventFilter() event.Filter {
+	labels := map[string]string{}
+	if filter.Bundle != "" {
+		labels[bundleLabel] = filter.Bundle
+	}
+	if filter.Policy != "" {
+		labels[policyLabel] = filter.Policy
+	}
+	return event.Filter{
+		Source:    findingsSource,
+		Cluster:   filter.Cluster,
+		Namespace: filter.Namespace,
+		Kind:      filter.Kind,
+		Name:      filter.Name,
+		Severity:  filter.Severity,
+		Labels:    labels,
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "Critical":
+		return 4
+	case "High":
+		return 3
+	case "Medium":
+		return 2
+	case "Low":
+		return 1
+	}
+	return 0
+}
+
+// AnnotateGraph attaches the policy findings of each resource node to its data under "policyFindings"
+func AnnotateGraph(clusterName string, graph *canvas.GraphResponse) {
+	if graph == nil {
+		return
+	}
+	findings, err := NewFindingsStore().List(FindingsFilter{Cluster: clusterName})
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to load policy findings for canvas")
+		return
+	}
+	if len(findings) == 0 {
+		return
+	}
+
+	byResource := map[string][]Finding{}
+	for _, f := range findings {
+		key := f.Resource + "|" + f.Namespace + "|" + f.Name
+		byResource[key] = append(byResource[key], f)
+	}
+	for i := range graph.Nodes {
+		data := graph.Nodes[i].Data
+		resourceType, _ := data["resourceType"].(string)
+		namespace, _ := data["namespace"].(string)
+		name, _ := data["resourceName"].(string)
+		if nodeFindings, ok := byResource[resourceType+"|"+namespace+"|"+name]; ok {
+			data["policyFindings"] = nodeFindings
+		}
+	}
+}
+
+// HandleEvent queues the object of a watcher event for re-evaluation against bundles evaluated
+// on events. It never blocks the watcher, events are dropped while the queue is full.
+func (m *Manager) HandleEvent(e event.Event) {
+	select {
+	case m.events <- e:
+	default:
+		logger.Log(logger.LevelWarn, map[string]string{
+			"cluster": e.Host,
+			"kind":    e.Kind,
+			"name":    e.Name,
+		}, nil, "Policy event queue is full, dropping watcher event")
+	}
+}
+
+// processEvents evaluates queued watcher events until Stop is called
+func (m *Manager) processEvents() {
+	for {
+		select {
+		case e := <-m.events:
+			m.evaluateEvent(e)
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+func (m *Manager) evaluateEvent(e event.Event) {
+	m.compiledMutex.RLock()
+	bundles := make([]*compiledBundle, 0, len(m.compiled))
+	for _, compiled := range m.compiled {
+		bundles = append(bundles, compiled)
+	}
+	m.compiledMutex.RUnlock()
+	if len(bundles) == 0 {
+		return
+	}
+
+	var object map[string]interface{}
+	if e.Reason != "Deleted" && e.Obj != nil {
+		converted, err := runtime.DefaultUnstructuredConverter.ToUnstructured(e.Obj)
+		if err != nil {
+			return
+		}
+		object = converted
+		// Typed informer objects carry no type meta
+		object["apiVersion"] = e.ApiVersion
+		object["kind"] = e.Kind
+	}
+
+	clusterName := e.Host
+	for _, compiled := range bundles {
+		if !clusterInScope(compiled.bundle.Clusters, clusterName) {
+			continue
+		}
+		for _, policy := range compiled.policies {
+			if !policy.matchesKind(e.ApiVersion, e.Kind) || !policy.matchesNamespace(e.Namespace) {
+				continue
+			}
+			m.evaluateEventObject(compiled.bundle.Name, clusterName, policy, e, object)
+		}
+	}
+}
+
+func (m *Manager) evaluateEventObject(bundleName, clusterName string, policy *compiledPolicy, e event.Event, object map[string]interface{}) {
+	scope := func(f Finding) bool {
+		return f.Policy == policy.Name && f.APIVersion == e.ApiVersion && f.Kind == e.Kind &&
+			f.Namespace == e.Namespace && f.Name == e.Name
+	}
+
+	var findings []Finding
+	if object != nil {
+		if policy.selector.Matches(objectLabels(object)) {
+			objects := []map[string]interface{}{object}
+			results, err := policy.evaluator.evaluate(context.Background(), objects)
+			if err != nil {
+				logger.Log(logger.LevelWarn, map[string]string{
+					"bundle": bundleName,
+					"policy": policy.Name,
+				}, err, "Failed to evaluate policy on watcher event")
+				return
+			}
+			findings, _ = policy.findingsFor(bundleName, clusterName, resourceForKind(e.ApiVersion, e.Kind), objects, results, time.Now())
+		}
+	}
+
+	if _, err := m.findings.replaceChanged(bundleName, clusterName, scope, findings, false); err != nil {
+		logger.Log(logger.LevelError, map[string]string{"bundle": bundleName}, err, "Failed to store policy findings")
+	}
+}
+
+func clusterInScope(clusters []string, clusterName string) bool {
+	if len(clusters) == 0 {
+		return true
+	}
+	for _, c := range clusters {
+		if c == clusterName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,416 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	LanguageCEL  = "cel"
+	LanguageRego = "rego"
+
+	OperationEvaluate = "policy-evaluate"
+
+	bundlesFileName   = "policy-bundles.json"
+	reconcileInterval = time.Minute
+	minSchedule       = time.Minute
+	eventQueueSize    = 1024
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Bundle is a named set of policies written in one language
+type Bundle struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Language    string   `json:"language"`
+	Policies    []Policy `json:"policies"`
+	// Clusters to evaluate, empty means every context
+	Clusters []string `json:"clusters,omitempty"`
+	// Schedule is the evaluation interval as a Go duration, e.g. "30m". Empty means on demand only.
+	Schedule string `json:"schedule,omitempty"`
+	// OnEvents re-evaluates objects as the watcher reports changes to them
+	OnEvents  bool      `json:"onEvents"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	LastRun   *RunInfo  `json:"lastRun,omitempty"`
+}
+
+// Policy is a single rule evaluated against every matching object
+type Policy struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	// Message is reported for CEL violations, Rego policies report their own messages
+	Message string `json:"message,omitempty"`
+	Match   Match  `json:"match"`
+	// Expression is a CEL expression over "object" that must be true for compliant objects
+	Expression string `json:"expression,omitempty"`
+	// Module is a Rego module defining a "deny" set of messages, with the object as input
+	Module string `json:"module,omitempty"`
+}
+
+// Match selects the objects a policy applies to
+type Match struct {
+	// APIVersion of the matched kinds, e.g. "apps/v1" or "v1"
+	APIVersion         string   `json:"apiVersion"`
+	Kinds              []string `json:"kinds"`
+	Namespaces         []string `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	LabelSelector      string   `json:"labelSelector,omitempty"`
+}
+
+// RunInfo records the outcome of the last evaluation of a bundle
+type RunInfo struct {
+	Time        time.Time `json:"time"`
+	OperationID string    `json:"operationId"`
+	Clusters    []string  `json:"clusters"`
+	Evaluated   int       `json:"evaluated"`
+	Findings    int       `json:"findings"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// Manager stores policy bundles and schedules their evaluation
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	findings        *FindingsStore
+	filePath        string
+	mutex           sync.Mutex
+	stopChan        chan struct{}
+	// events buffers watcher events for the evaluation worker
+	events chan event.Event
+
+	// compiled caches the evaluators of enabled bundles for watcher events
+	compiled      map[string]*compiledBundle
+	compiledMutex sync.RWMutex
+}
+
+// NewManager creates a new policy manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	m := &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		findings:        NewFindingsStore(),
+		filePath:        filepath.Join(utils.ConfigDir(), bundlesFileName),
+		stopChan:        make(chan struct{}),
+		events:          make(chan event.Event, eventQueueSize),
+		compiled:        map[string]*compiledBundle{},
+	}
+
+	bundles, err := m.load()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load policy bundles")
+		return m
+	}
+	for _, bundle := range bundles {
+		m.refreshCompiled(bundle)
+	}
+	return m
+}
+
+// ListBundles returns all policy bundles
+func (m *Manager) ListBundles() ([]Bundle, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	bundles, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Bundle, 0, len(bundles))
+	for _, bundle := range bundles {
+		list = append(list, *bundle)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// GetBundle returns a policy bundle by name
+func (m *Manager) GetBundle(name string) (*Bundle, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	bundles, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	bundle, ok := bundles[name]
+	if !ok {
+		return nil, fmt.Errorf("policy bundle %q not found", name)
+	}
+	return bundle, nil
+}
+
+// SaveBundle validates and compiles a bundle, then creates or replaces it
+func (m *Manager) SaveBundle(bundle Bundle) (*Bundle, error) {
+	if err := validateBundle(&bundle); err != nil {
+		return nil, err
+	}
+	if _, err := compileBundle(&bundle); err != nil {
+		return nil, err
+	}
+	for _, cluster := range bundle.Clusters {
+		if _, err := m.kubeConfigStore.GetContext(cluster); err != nil {
+			return nil, fmt.Errorf("context %s not found: %w", cluster, err)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	bundles, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	bundle.CreatedAt = now
+	bundle.LastRun = nil
+	if existing, ok := bundles[bundle.Name]; ok {
+		bundle.CreatedAt = existing.CreatedAt
+		bundle.LastRun = existing.LastRun
+	}
+	bundle.UpdatedAt = now
+
+	bundles[bundle.Name] = &bundle
+	if err := m.save(bundles); err != nil {
+		return nil, err
+	}
+	m.refreshCompiled(&bundle)
+	return &bundle, nil
+}
+
+// DeleteBundle removes a bundle and its findings
+func (m *Manager) DeleteBundle(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	bundles, err := m.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := bundles[name]; !ok {
+		return fmt.Errorf("policy bundle %q not found", name)
+	}
+	delete(bundles, name)
+	if err := m.save(bundles); err != nil {
+		return err
+	}
+
+	m.compiledMutex.Lock()
+	delete(m.compiled, name)
+	m.compiledMutex.Unlock()
+
+	return m.findings.removeBundle(name)
+}
+
+// Evaluate queues an evaluation of a bundle against the given clusters, or its configured clusters when none are given
+func (m *Manager) Evaluate(name string, clusters []string, createdBy string) (*utils.Operation, error) {
+	bundle, err := m.GetBundle(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		clusters = bundle.Clusters
+	}
+
+	op := m.queue.AddOperation(OperationEvaluate, name, createdBy, map[string]interface{}{
+		"bundle":   name,
+		"clusters": clusters,
+	}, []string{"policy", name})
+	return op, nil
+}
+
+// Findings returns the stored findings matching the filter
+func (m *Manager) Findings(filter FindingsFilter) ([]Finding, error) {
+	return m.findings.List(filter)
+}
+
+// GetQueue returns the operation queue used by the manager
+func (m *Manager) GetQueue() *utils.Queue {
+	return m.queue
+}
+
+// Start runs the evaluation scheduler and the watcher event worker until Stop is called
+func (m *Manager) Start() {
+	go m.processEvents()
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Reconcile()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the evaluation scheduler and the watcher event worker
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Reconcile queues evaluations of scheduled bundles that are due
+func (m *Manager) Reconcile() {
+	bundles, err := m.ListBundles()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load policy bundles")
+		return
+	}
+
+	now := time.Now()
+	for _, bundle := range bundles {
+		if !bundle.Enabled || bundle.Schedule == "" {
+			continue
+		}
+		interval, err := time.ParseDuration(bundle.Schedule)
+		if err != nil {
+			continue
+		}
+		if bundle.LastRun != nil && now.Sub(bundle.LastRun.Time) < interval {
+			continue
+		}
+		if m.evaluationPending(bundle.Name) {
+			continue
+		}
+
+		op, err := m.Evaluate(bundle.Name, nil, "scheduler")
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"bundle": bundle.Name}, err, "Failed to queue policy evaluation")
+			continue
+		}
+		logger.Log(logger.LevelInfo, map[string]string{
+			"bundle":      bundle.Name,
+			"operationId": op.ID,
+		}, nil, "Queued scheduled policy evaluation")
+	}
+}
+
+// evaluationPending reports whether an evaluation of the bundle is already queued or running
+func (m *Manager) evaluationPending(name string) bool {
+	for _, op := range m.queue.GetOperationsByTarget(name) {
+		if op.Type == OperationEvaluate && (op.Status == utils.StatusPending || op.Status == utils.StatusRunning) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRun stores the outcome of an evaluation on the bundle
+func (m *Manager) recordRun(name string, run RunInfo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	bundles, err := m.load()
+	if err != nil {
+		return
+	}
+	bundle, ok := bundles[name]
+	if !ok {
+		// The bundle was deleted while the evaluation ran
+		return
+	}
+	bundle.LastRun = &run
+	if err := m.save(bundles); err != nil {
+		logger.Log(logger.LevelError, map[string]string{"bundle": name}, err, "Failed to record policy evaluation")
+	}
+}
+
+func (m *Manager) refreshCompiled(bundle *Bundle) {
+	m.compiledMutex.Lock()
+	defer m.compiledMutex.Unlock()
+
+	if !bundle.Enabled || !bundle.OnEvents {
+		delete(m.compiled, bundle.Name)
+		return
+	}
+	compiled, err := compileBundle(bundle)
+	if err != nil {
+		logger.Log(logger.LevelError, map[string]string{"bundle": bundle.Name}, err, "Failed to compile policy bundle")
+		delete(m.compiled, bundle.Name)
+		return
+	}
+	m.compiled[bundle.Name] = compiled
+}
+
+func (m *Manager) load() (map[string]*Bundle, error) {
+	bundles := map[string]*Bundle{}
+	if err := utils.ReadJSONFile(m.filePath, &bundles); err != nil {
+		return nil, err
+	}
+	return bundles, nil
+}
+
+func (m *Manager) save(bundles map[string]*Bundle) error {
+	return utils.WriteJSONFile(m.filePath, bundles)
+}
+
+func validateBundle(bundle *Bundle) error {
+	if !namePattern.MatchString(bundle.Name) {
+		return fmt.Errorf("bundle name must be a valid DNS label")
+	}
+	if bundle.Name == BaselineBundle {
+		return fmt.Errorf("bundle name %q is reserved for the built-in bundle", BaselineBundle)
+	}
+	if bundle.Language == "" {
+		bundle.Language = LanguageCEL
+	}
+	if bundle.Language != LanguageCEL && bundle.Language != LanguageRego {
+		return fmt.Errorf("language must be %q or %q", LanguageCEL, LanguageRego)
+	}
+	if len(bundle.Policies) == 0 {
+		return fmt.Errorf("bundle must contain at least one policy")
+	}
+	if bundle.Schedule != "" {
+		interval, err := time.ParseDuration(bundle.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule %q: %v", bundle.Schedule, err)
+		}
+		if interval < minSchedule {
+			return fmt.Errorf("schedule must be at least %s", minSchedule)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range bundle.Policies {
+		policy := &bundle.Policies[i]
+		if policy.Name == "" {
+			return fmt.Errorf("policy %d has no name", i)
+		}
+		if seen[policy.Name] {
+			return fmt.Errorf("duplicate policy name %q", policy.Name)
+		}
+		seen[policy.Name] = true
+		if policy.Severity == "" {
+			policy.Severity = "Medium"
+		}
+		if policy.Match.APIVersion == "" || len(policy.Match.Kinds) == 0 {
+			return fmt.Errorf("policy %q must match an apiVersion and at least one kind", policy.Name)
+		}
+		switch bundle.Language {
+		case LanguageCEL:
+			if policy.Expression == "" {
+				return fmt.Errorf("policy %q has no expression", policy.Name)
+			}
+		case LanguageRego:
+			if policy.Module == "" {
+				return fmt.Errorf("policy %q has no module", policy.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// opaBinary is the Open Policy Agent CLI used to evaluate Rego modules
+const opaBinary = "opa"
+
+var regoPackagePattern = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z_][A-Za-z0-9_.]*)`)
+
+// regoEvaluator evaluates a Rego module with the opa CLI. The module must define a "deny" set of
+// messages (strings or objects with a "msg" field), following the conftest convention.
+type regoEvaluator struct {
+	module string
+	query  string
+}
+
+func newRegoEvaluator(module string) (*regoEvaluator, error) {
+	match := regoPackagePattern.FindStringSubmatch(module)
+	if match == nil {
+		return nil, fmt.Errorf("rego module has no package declaration")
+	}
+
+	// All objects are evaluated in one opa process, each bound as input in turn
+	query := fmt.Sprintf("results := [[i, msgs] | some i; input.objects[i]; msgs := data.%s.deny with input as input.objects[i]]", match[1])
+	return &regoEvaluator{module: module, query: query}, nil
+}
+
+func (e *regoEvaluator) evaluate(ctx context.Context, objects []map[string]interface{}) ([]objectResult, error) {
+	if _, err := exec.LookPath(opaBinary); err != nil {
+		return nil, fmt.Errorf("opa binary not found in PATH, install Open Policy Agent to evaluate Rego bundles")
+	}
+
+	modulePath, err := writeTempModule(e.module)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(modulePath)
+
+	input, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, opaBinary, "eval", "--format", "json", "--stdin-input", "--data", modulePath, e.query)
+	cmd.Env = os.Environ()
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("opa eval failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var output struct {
+		Result []struct {
+			Bindings struct {
+				Results [][]interface{} `json:"results"`
+			} `json:"bindings"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("failed to decode opa output: %v", err)
+	}
+
+	results := make([]objectResult, len(objects))
+	if len(output.Result) == 0 {
+		return results, nil
+	}
+	for _, pair := range output.Result[0].Bindings.Results {
+		if len(pair) != 2 {
+			continue
+		}
+		index, ok := pair[0].(float64)
+		if !ok || int(index) < 0 || int(index) >= len(objects) {
+			continue
+		}
+		messages, _ := pair[1].([]interface{})
+		for _, message := range messages {
+			results[int(index)].violations = append(results[int(index)].violations, regoMessage(message))
+		}
+	}
+	return results, nil
+}
+
+// regoMessage renders a deny entry, which is either a string or an object with a msg field
+func regoMessage(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if msg, ok := v["msg"].(string); ok {
+			return msg
+		}
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+func writeTempModule(module string) (string, error) {
+	file, err := os.CreateTemp("", "agentkube-policy-*.rego")
+	if err != nil {
+		return "", fmt.Errorf("failed to create module file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(module); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write module file: %v", err)
+	}
+	return file.Name(), nil
+}
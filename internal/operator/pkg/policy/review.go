@@ -0,0 +1,310 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// ErrInvalidReview is returned for review requests without a manifest or object to review
+	ErrInvalidReview = errors.New("invalid review")
+	// ErrNotFound is returned for unknown bundles and contexts named by a review
+	ErrNotFound = errors.New("not found")
+)
+
+// ReviewRequest is a manifest, or a live object, to check against policy bundles before it is applied
+type ReviewRequest struct {
+	// Manifest holds YAML or JSON objects, as several documents or a List
+	Manifest string `json:"manifest,omitempty"`
+	// Namespace is assumed for the manifest objects without one, as with kubectl apply -n
+	Namespace string `json:"namespace,omitempty"`
+	// Cluster and Object name a live object to review instead of a manifest
+	Cluster string     `json:"cluster,omitempty"`
+	Object  *ObjectRef `json:"object,omitempty"`
+	// Bundles to review against. Empty means the enabled bundles, or the built-in BaselineBundle
+	// when none is enabled, which can also be named explicitly.
+	Bundles []string `json:"bundles,omitempty"`
+}
+
+// ObjectRef names a live object
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Violation is a policy an object of a review fails
+type Violation struct {
+	Bundle     string `json:"bundle"`
+	Policy     string `json:"policy"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Document is the position of the object in the manifest, from 1
+	Document int `json:"document,omitempty"`
+}
+
+// ReviewResult lists the violations of the reviewed objects, most severe first
+type ReviewResult struct {
+	// Allowed is true without violations. Policies that couldn't be evaluated are reported
+	// as errors and don't deny.
+	Allowed    bool        `json:"allowed"`
+	Bundles    []string    `json:"bundles"`
+	Objects    int         `json:"objects"`
+	Violations []Violation `json:"violations"`
+	Errors     []string    `json:"errors,omitempty"`
+}
+
+// reviewedObject is an object of a review with its position in the manifest
+type reviewedObject struct {
+	object   map[string]interface{}
+	document int
+}
+
+// Review evaluates a manifest, or a live object, against policy bundles without storing findings
+func (m *Manager) Review(ctx context.Context, req ReviewRequest) (*ReviewResult, error) {
+	var objects []reviewedObject
+	switch {
+	case req.Object != nil && req.Manifest != "":
+		return nil, fmt.Errorf("%w: give either a manifest or an object", ErrInvalidReview)
+	case req.Object != nil:
+		object, err := m.fetchObject(ctx, req.Cluster, *req.Object)
+		if err != nil {
+			return nil, err
+		}
+		objects = []reviewedObject{{object: object}}
+	case strings.TrimSpace(req.Manifest) != "":
+		decoded, err := decodeManifest(req.Manifest, req.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		objects = decoded
+	default:
+		return nil, fmt.Errorf("%w: a manifest or an object is required", ErrInvalidReview)
+	}
+
+	bundles, err := m.reviewBundles(req.Bundles)
+	if err != nil {
+		return nil, err
+	}
+	return reviewObjects(ctx, bundles, objects), nil
+}
+
+// reviewBundles compiles the named bundles, or the enabled ones falling back to the built-in bundle
+func (m *Manager) reviewBundles(names []string) ([]*compiledBundle, error) {
+	m.mutex.Lock()
+	stored, err := m.load()
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*Bundle
+	if len(names) == 0 {
+		for _, bundle := range stored {
+			if bundle.Enabled {
+				selected = append(selected, bundle)
+			}
+		}
+		sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+		if len(selected) == 0 {
+			names = []string{BaselineBundle}
+		}
+	}
+
+	var compiled []*compiledBundle
+	for _, name := range names {
+		if name == BaselineBundle {
+			baseline, err := baselineBundle()
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile the built-in bundle: %v", err)
+			}
+			compiled = append(compiled, baseline)
+			continue
+		}
+		bundle, ok := stored[name]
+		if !ok {
+			return nil, fmt.Errorf("policy bundle %q %w", name, ErrNotFound)
+		}
+		selected = append(selected, bundle)
+	}
+	for _, bundle := range selected {
+		cb, err := compileBundle(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("bundle %s: %v", bundle.Name, err)
+		}
+		compiled = append(compiled, cb)
+	}
+	return compiled, nil
+}
+
+// reviewObjects evaluates every policy of the bundles against the objects it matches
+func reviewObjects(ctx context.Context, bundles []*compiledBundle, objects []reviewedObject) *ReviewResult {
+	result := &ReviewResult{Bundles: []string{}, Objects: len(objects), Violations: []Violation{}}
+	for _, compiled := range bundles {
+		bundleName := compiled.bundle.Name
+		result.Bundles = append(result.Bundles, bundleName)
+
+		for _, policy := range compiled.policies {
+			var matched []reviewedObject
+			for _, o := range objects {
+				namespace, _ := objectKey(o.object)
+				if policy.matchesKind(stringField(o.object, "apiVersion"), stringField(o.object, "kind")) &&
+					policy.matchesNamespace(namespace) && policy.selector.Matches(objectLabels(o.object)) {
+					matched = append(matched, o)
+				}
+			}
+			if len(matched) == 0 {
+				continue
+			}
+
+			inputs := make([]map[string]interface{}, len(matched))
+			for i, o := range matched {
+				inputs[i] = o.object
+			}
+			results, err := policy.evaluator.evaluate(ctx, inputs)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %v", bundleName, policy.Name, err))
+				continue
+			}
+			for i, r := range results {
+				object := matched[i].object
+				namespace, name := objectKey(object)
+				kind := stringField(object, "kind")
+				if r.err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %s %s: %v", bundleName, policy.Name, strings.ToLower(kind), joinKey(namespace, name), r.err))
+					continue
+				}
+				for _, message := range r.violations {
+					result.Violations = append(result.Violations, Violation{
+						Bundle:     bundleName,
+						Policy:     policy.Name,
+						Severity:   policy.Severity,
+						Message:    message,
+						APIVersion: stringField(object, "apiVersion"),
+						Kind:       kind,
+						Namespace:  namespace,
+						Name:       name,
+						Document:   matched[i].document,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result.Violations, func(i, j int) bool {
+		return severityRank(result.Violations[i].Severity) > severityRank(result.Violations[j].Severity)
+	})
+	result.Allowed = len(result.Violations) == 0
+	return result
+}
+
+// decodeManifest reads the objects of YAML or JSON documents, expanding Lists
+func decodeManifest(manifest, namespace string) ([]reviewedObject, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(manifest)), 4096)
+	var objects []reviewedObject
+	for document := 1; ; document++ {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: document %d: %v", ErrInvalidReview, document, err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		items := []map[string]interface{}{object}
+		if list, ok := object["items"].([]interface{}); ok && strings.HasSuffix(stringField(object, "kind"), "List") {
+			items = items[:0]
+			for _, item := range list {
+				if o, ok := item.(map[string]interface{}); ok {
+					items = append(items, o)
+				}
+			}
+		}
+		for _, item := range items {
+			if stringField(item, "apiVersion") == "" || stringField(item, "kind") == "" {
+				return nil, fmt.Errorf("%w: document %d has no apiVersion or kind", ErrInvalidReview, document)
+			}
+			if ns, _ := objectKey(item); ns == "" && namespace != "" {
+				metadata, ok := item["metadata"].(map[string]interface{})
+				if !ok {
+					metadata = map[string]interface{}{}
+					item["metadata"] = metadata
+				}
+				metadata["namespace"] = namespace
+			}
+			objects = append(objects, reviewedObject{object: item, document: document})
+		}
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("%w: the manifest holds no objects", ErrInvalidReview)
+	}
+	return objects, nil
+}
+
+// fetchObject reads a live object of a cluster
+func (m *Manager) fetchObject(ctx context.Context, clusterName string, ref ObjectRef) (map[string]interface{}, error) {
+	if clusterName == "" || ref.APIVersion == "" || ref.Kind == "" || ref.Name == "" {
+		return nil, fmt.Errorf("%w: the object needs a cluster, apiVersion, kind and name", ErrInvalidReview)
+	}
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context %s %w", clusterName, ErrNotFound)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %v", err)
+	}
+
+	resources, err := resolveResources(discoveryClient, Match{APIVersion: ref.APIVersion, Kinds: []string{ref.Kind}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReview, err)
+	}
+	namespace := ""
+	if resources[0].namespaced {
+		namespace = ref.Namespace
+	}
+	object, err := dynamicClient.Resource(resources[0].gvr).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", ref.Kind, joinKey(namespace, ref.Name), err)
+	}
+	return object.Object, nil
+}
+
+// objectLabels returns the labels of an unstructured object
+func objectLabels(object map[string]interface{}) labels.Set {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	objectLabels, _ := metadata["labels"].(map[string]interface{})
+	set := labels.Set{}
+	for k, v := range objectLabels {
+		if s, ok := v.(string); ok {
+			set[k] = s
+		}
+	}
+	return set
+}
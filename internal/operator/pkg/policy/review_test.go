@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const reviewManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      securityContext:
+        runAsNonRoot: true
+      containers:
+      - name: app
+        image: registry.example.com/web:1.2.3
+        securityContext:
+          allowPrivilegeEscalation: false
+        resources:
+          limits: {cpu: 500m, memory: 256Mi}
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: debug, namespace: tools}
+  spec:
+    hostNetwork: true
+    containers:
+    - name: shell
+      image: busybox
+      securityContext: {privileged: true}
+- apiVersion: v1
+  kind: ConfigMap
+  metadata: {name: settings}
+`
+
+func TestDecodeManifest(t *testing.T) {
+	t.Parallel()
+
+	objects, err := decodeManifest(reviewManifest, "shop")
+	if err != nil {
+		t.Fatalf("decodeManifest() error = %v", err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("decodeManifest() = %d objects, want the Deployment and the 2 List items", len(objects))
+	}
+
+	tests := []struct {
+		document  int
+		namespace string
+		name      string
+	}{
+		{1, "shop", "web"},
+		{2, "tools", "debug"},
+		{2, "shop", "settings"},
+	}
+	for i, tt := range tests {
+		namespace, name := objectKey(objects[i].object)
+		if objects[i].document != tt.document || namespace != tt.namespace || name != tt.name {
+			t.Errorf("object %d = document %d %s/%s, want document %d %s/%s", i, objects[i].document, namespace, name, tt.document, tt.namespace, tt.name)
+		}
+	}
+
+	for _, manifest := range []string{"---\n", "metadata: {name: web}", "kind: [unterminated"} {
+		if _, err := decodeManifest(manifest, ""); !errors.Is(err, ErrInvalidReview) {
+			t.Errorf("decodeManifest(%q) error = %v, want ErrInvalidReview", manifest, err)
+		}
+	}
+}
+
+func TestReviewBaseline(t *testing.T) {
+	t.Parallel()
+
+	baseline, err := baselineBundle()
+	if err != nil {
+		t.Fatalf("baselineBundle() error = %v", err)
+	}
+	objects, err := decodeManifest(reviewManifest, "")
+	if err != nil {
+		t.Fatalf("decodeManifest() error = %v", err)
+	}
+
+	result := reviewObjects(context.Background(), []*compiledBundle{baseline}, objects)
+	if result.Allowed || len(result.Errors) != 0 {
+		t.Fatalf("reviewObjects() allowed = %v, errors = %v, want violations without errors", result.Allowed, result.Errors)
+	}
+
+	got := map[string]bool{}
+	for _, v := range result.Violations {
+		if v.Name != "debug" || v.Document != 2 {
+			t.Errorf("violation %+v, want only the debug pod of document 2 to fail", v)
+		}
+		got[v.Policy] = true
+	}
+	for _, policy := range []string{"privileged-containers", "host-namespaces", "privilege-escalation", "run-as-non-root", "resource-limits", "pinned-image-tags"} {
+		if !got[policy] {
+			t.Errorf("debug pod does not violate %s", policy)
+		}
+	}
+	if got["hostpath-volumes"] {
+		t.Error("debug pod violates hostpath-volumes without volumes")
+	}
+	if result.Violations[0].Severity != "High" {
+		t.Errorf("first violation severity = %s, want the most severe first", result.Violations[0].Severity)
+	}
+}
+
+func TestValidateBundleReservedName(t *testing.T) {
+	t.Parallel()
+
+	bundle := Bundle{Name: BaselineBundle, Policies: []Policy{{Name: "p", Match: Match{APIVersion: "v1", Kinds: []string{"Pod"}}, Expression: "true"}}}
+	if err := validateBundle(&bundle); err == nil {
+		t.Error("validateBundle() accepted the name of the built-in bundle")
+	}
+}
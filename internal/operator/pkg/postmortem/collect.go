@@ -0,0 +1,355 @@
+package postmortem
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/history"
+	"github.com/agentkube/operator/pkg/incident"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// collector gathers the data of a bundle from a single cluster
+type collector struct {
+	cluster   string
+	request   Request
+	clientset *kubernetes.Clientset
+	dynamic   dynamic.Interface
+	bundle    *Bundle
+}
+
+// Collect gathers the postmortem data of the requested resources. Parts that cannot be collected
+// are listed in the manifest errors, an error is only returned when the cluster is unreachable.
+func (e *Exporter) Collect(ctx context.Context, clusterName string, request Request) (*Bundle, error) {
+	kubeContext, err := e.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, collectTimeout)
+	defer cancel()
+
+	c := &collector{
+		cluster:   clusterName,
+		request:   request,
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		bundle: &Bundle{Manifest: Manifest{
+			Cluster:     clusterName,
+			From:        request.From,
+			To:          request.To,
+			GeneratedAt: time.Now(),
+			Resources:   request.Resources,
+			Files:       []string{},
+		}},
+	}
+
+	keys := map[string]bool{}
+	for _, resource := range request.Resources {
+		for _, key := range c.collectResource(ctx, resource) {
+			keys[key] = true
+		}
+	}
+	c.collectIncidents(keys)
+	return c.bundle, nil
+}
+
+// collectResource adds the manifest, events, findings, logs and metrics of a resource and its pods.
+// It returns the incident keys of the resource and its pods.
+func (c *collector) collectResource(ctx context.Context, resource Resource) []string {
+	dir := resource.dir()
+	keys := []string{resource.key()}
+
+	object := c.collectManifest(ctx, resource, dir)
+	c.collectFindings(resource, dir)
+
+	events := c.events(ctx, resource)
+	pods := c.pods(ctx, resource, object)
+	for _, pod := range pods {
+		podResource := Resource{APIVersion: "v1", Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+		keys = append(keys, podResource.key())
+		if resource.Kind != "Pod" {
+			events = append(events, c.events(ctx, podResource)...)
+		}
+		c.collectLogs(ctx, pod, dir)
+	}
+	sort.Slice(events, func(i, j int) bool { return eventTime(events[i]).Before(eventTime(events[j])) })
+	c.bundle.addJSON(path.Join(dir, "events.json"), events)
+
+	if len(pods) > 0 {
+		c.collectMetrics(ctx, pods, dir)
+	}
+	return keys
+}
+
+// collectManifest adds the manifest of the resource at the end of the time range, from its history
+// when it is tracked and from the cluster otherwise. It returns the object for finding its pods.
+func (c *collector) collectManifest(ctx context.Context, resource Resource, dir string) map[string]interface{} {
+	ref := history.ResourceRef{
+		Cluster:    c.cluster,
+		APIVersion: resource.APIVersion,
+		Kind:       resource.Kind,
+		Namespace:  resource.Namespace,
+		Name:       resource.Name,
+	}
+	if resourceHistory, err := history.GetManager().Get(ref); err == nil {
+		if revision := revisionAt(resourceHistory, c.request.To); revision != nil {
+			revisionTime := revision.Time
+			c.bundle.addJSON(path.Join(dir, "manifest.json"), ManifestSnapshot{
+				Source:     "history",
+				Revision:   revision.Revision,
+				Time:       &revisionTime,
+				ChangeType: revision.ChangeType,
+				Object:     revision.Object,
+			})
+			return revision.Object
+		}
+	}
+
+	object, err := c.live(ctx, resource)
+	if err != nil {
+		c.bundle.fail("manifest of %s %s: %v", resource.Kind, resource.key(), err)
+		return nil
+	}
+	c.bundle.addJSON(path.Join(dir, "manifest.json"), ManifestSnapshot{Source: "live", Object: object.Object})
+	return object.Object
+}
+
+// live gets the current state of a resource
+func (c *collector) live(ctx context.Context, resource Resource) (*unstructured.Unstructured, error) {
+	apiVersion := resource.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAPIVersions[resource.Kind]
+	}
+	if apiVersion == "" {
+		return nil, fmt.Errorf("apiVersion is required for kind %s", resource.Kind)
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	gvr, _ := meta.UnsafeGuessKindToResource(gv.WithKind(resource.Kind))
+
+	if resource.Namespace == "" {
+		return c.dynamic.Resource(gvr).Get(ctx, resource.Name, metav1.GetOptions{})
+	}
+	return c.dynamic.Resource(gvr).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+}
+
+// defaultAPIVersions lets requests omit the apiVersion of common kinds
+var defaultAPIVersions = map[string]string{
+	"Pod":                   "v1",
+	"Service":               "v1",
+	"Node":                  "v1",
+	"ConfigMap":             "v1",
+	"PersistentVolumeClaim": "v1",
+	"Deployment":            "apps/v1",
+	"StatefulSet":           "apps/v1",
+	"DaemonSet":             "apps/v1",
+	"ReplicaSet":            "apps/v1",
+	"Job":                   "batch/v1",
+	"CronJob":               "batch/v1",
+	"Ingress":               "networking.k8s.io/v1",
+}
+
+// events lists the Kubernetes events of a resource within the time range
+func (c *collector) events(ctx context.Context, resource Resource) []corev1.Event {
+	selector := fields.Set{"involvedObject.kind": resource.Kind, "involvedObject.name": resource.Name}
+	list, err := c.clientset.CoreV1().Events(resource.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: selector.AsSelector().String(),
+	})
+	if err != nil {
+		c.bundle.fail("events of %s %s: %v", resource.Kind, resource.key(), err)
+		return nil
+	}
+
+	events := []corev1.Event{}
+	for _, e := range list.Items {
+		first := e.FirstTimestamp.Time
+		if first.IsZero() {
+			first = e.EventTime.Time
+		}
+		if overlaps(first, eventTime(e), c.request.From, c.request.To) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// eventTime is when an event was last seen
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
+
+// pods returns the pod itself or the pods selected by a workload
+func (c *collector) pods(ctx context.Context, resource Resource, object map[string]interface{}) []corev1.Pod {
+	if resource.Kind == "Pod" {
+		pod, err := c.clientset.CoreV1().Pods(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+		if err != nil {
+			c.bundle.fail("pod %s: %v", resource.key(), err)
+			return nil
+		}
+		return []corev1.Pod{*pod}
+	}
+
+	matchLabels, found, _ := unstructured.NestedStringMap(object, "spec", "selector", "matchLabels")
+	if !found || len(matchLabels) == 0 || resource.Namespace == "" {
+		return nil
+	}
+	list, err := c.clientset.CoreV1().Pods(resource.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(matchLabels).String(),
+	})
+	if err != nil {
+		c.bundle.fail("pods of %s %s: %v", resource.Kind, resource.key(), err)
+		return nil
+	}
+	pods := list.Items
+	if len(pods) > maxPodsPerResource {
+		c.bundle.fail("%s %s has %d pods, only %d are included", resource.Kind, resource.key(), len(pods), maxPodsPerResource)
+		pods = pods[:maxPodsPerResource]
+	}
+	return pods
+}
+
+// collectLogs adds the log excerpts of the containers of a pod, including the previous instance of
+// restarted containers
+func (c *collector) collectLogs(ctx context.Context, pod corev1.Pod, dir string) {
+	since := metav1.NewTime(c.request.From)
+	tailLines := c.request.LogTailLines
+	limitBytes := int64(logLimitBytes)
+
+	restarts := map[string]int32{}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			restarts[status.Name] = status.RestartCount
+		}
+	}
+
+	containers := make([]corev1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	containers = append(append(containers, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		instances := []bool{false}
+		if restarts[container.Name] > 0 {
+			instances = append(instances, true)
+		}
+		for _, previous := range instances {
+			name := fmt.Sprintf("%s-%s.log", pod.Name, container.Name)
+			if previous {
+				name = fmt.Sprintf("%s-%s.previous.log", pod.Name, container.Name)
+			}
+
+			stream, err := c.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container:  container.Name,
+				Previous:   previous,
+				Timestamps: true,
+				SinceTime:  &since,
+				TailLines:  &tailLines,
+				LimitBytes: &limitBytes,
+			}).Stream(ctx)
+			if err != nil {
+				c.bundle.fail("logs of %s/%s container %s: %v", pod.Namespace, pod.Name, container.Name, err)
+				continue
+			}
+			excerpt, err := logExcerpt(stream, c.request.To)
+			stream.Close()
+			if err != nil {
+				c.bundle.fail("logs of %s/%s container %s: %v", pod.Namespace, pod.Name, container.Name, err)
+			}
+			c.bundle.add(path.Join(dir, "logs", name), excerpt)
+		}
+	}
+}
+
+// collectMetrics adds the current resource usage of the pods. The metrics server keeps no history,
+// the snapshot is taken at export time.
+func (c *collector) collectMetrics(ctx context.Context, pods []corev1.Pod, dir string) {
+	snapshots := []v1beta1.PodMetrics{}
+	for _, pod := range pods {
+		url := fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s", pod.Namespace, pod.Name)
+		result := v1beta1.PodMetrics{}
+		if err := c.clientset.RESTClient().Get().AbsPath(url).Do(ctx).Into(&result); err != nil {
+			c.bundle.fail("metrics of %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		snapshots = append(snapshots, result)
+	}
+	c.bundle.addJSON(path.Join(dir, "metrics.json"), snapshots)
+}
+
+// collectFindings adds the diagnosis results recorded for the resource, e.g. policy violations
+func (c *collector) collectFindings(resource Resource, dir string) {
+	records, err := event.GetStore().List(event.Filter{
+		Cluster:   c.cluster,
+		Namespace: resource.Namespace,
+		Kind:      resource.Kind,
+		Name:      resource.Name,
+	})
+	if err != nil {
+		c.bundle.fail("findings of %s %s: %v", resource.Kind, resource.key(), err)
+		return
+	}
+
+	findings := []event.Record{}
+	for _, record := range records {
+		if !record.FirstSeen.After(c.request.To) {
+			findings = append(findings, record)
+		}
+	}
+	c.bundle.addJSON(path.Join(dir, "findings.json"), findings)
+}
+
+// collectIncidents adds the incidents active in the time range that involve one of the resources
+func (c *collector) collectIncidents(keys map[string]bool) {
+	incidents, err := incident.GetManager().List(incident.Filter{Cluster: c.cluster})
+	if err != nil {
+		c.bundle.fail("incidents: %v", err)
+		return
+	}
+
+	related := []incident.Incident{}
+	for _, i := range incidents {
+		if !overlaps(i.OpenedAt, i.LastSeen, c.request.From, c.request.To) {
+			continue
+		}
+		for _, resource := range i.Resources {
+			if keys[resource] {
+				related = append(related, i)
+				break
+			}
+		}
+	}
+	c.bundle.addJSON("incidents.json", related)
+}
@@ -0,0 +1,230 @@
+package postmortem
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/history"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+const (
+	maxResources       = 50
+	maxPodsPerResource = 10
+	maxRange           = 30 * 24 * time.Hour
+
+	defaultLogTailLines = 500
+	maxLogTailLines     = 5000
+	// logLimitBytes bounds the log excerpt of a single container
+	logLimitBytes = 1 << 20
+
+	collectTimeout = 2 * time.Minute
+)
+
+// Request selects the time range and resources of a postmortem bundle
+type Request struct {
+	From time.Time `json:"from" binding:"required"`
+	// To defaults to now
+	To        time.Time  `json:"to"`
+	Resources []Resource `json:"resources" binding:"required"`
+	// LogTailLines bounds the log excerpt of each container, defaults to 500
+	LogTailLines int64 `json:"logTailLines,omitempty"`
+}
+
+// Resource is a resource the bundle collects data about. Workloads include the data of their pods.
+type Resource struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Manifest describes the content of a bundle, it is the first file of the archive
+type Manifest struct {
+	Cluster     string     `json:"cluster"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	GeneratedAt time.Time  `json:"generatedAt"`
+	Resources   []Resource `json:"resources"`
+	Files       []string   `json:"files"`
+	// Errors lists what could not be collected, a bundle is exported even when parts are missing
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ManifestSnapshot is the manifest of a resource as it was at the end of the time range
+type ManifestSnapshot struct {
+	// Source is "history" for a recorded revision and "live" when the resource has no history
+	Source     string                 `json:"source"`
+	Revision   int                    `json:"revision,omitempty"`
+	Time       *time.Time             `json:"time,omitempty"`
+	ChangeType string                 `json:"changeType,omitempty"`
+	Object     map[string]interface{} `json:"object"`
+}
+
+// Bundle is the collected postmortem data, written out as a tar.gz archive
+type Bundle struct {
+	Manifest Manifest
+	files    []bundleFile
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// Exporter collects postmortem bundles from the clusters of the kubeconfig store
+type Exporter struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// NewExporter creates an exporter
+func NewExporter(kubeConfigStore kubeconfig.ContextStore) *Exporter {
+	return &Exporter{kubeConfigStore: kubeConfigStore}
+}
+
+// Validate checks the request and fills in defaults
+func (r *Request) Validate(now time.Time) error {
+	if r.To.IsZero() {
+		r.To = now
+	}
+	if !r.From.Before(r.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if r.To.Sub(r.From) > maxRange {
+		return fmt.Errorf("time range must not exceed %s", maxRange)
+	}
+	if len(r.Resources) == 0 || len(r.Resources) > maxResources {
+		return fmt.Errorf("between 1 and %d resources are required", maxResources)
+	}
+	for _, resource := range r.Resources {
+		if resource.Kind == "" || resource.Name == "" {
+			return fmt.Errorf("resources require a kind and a name")
+		}
+		for _, part := range []string{resource.Kind, resource.Namespace, resource.Name} {
+			if strings.ContainsAny(part, "/\\") || part == ".." {
+				return fmt.Errorf("invalid resource %s/%s", resource.Kind, resource.Name)
+			}
+		}
+	}
+	if r.LogTailLines == 0 {
+		r.LogTailLines = defaultLogTailLines
+	}
+	if r.LogTailLines < 0 || r.LogTailLines > maxLogTailLines {
+		return fmt.Errorf("logTailLines must be between 1 and %d", maxLogTailLines)
+	}
+	return nil
+}
+
+// dir is the archive directory holding the files of a resource
+func (r Resource) dir() string {
+	if r.Namespace == "" {
+		return path.Join("resources", strings.ToLower(r.Kind), r.Name)
+	}
+	return path.Join("resources", strings.ToLower(r.Kind), r.Namespace, r.Name)
+}
+
+// key is how incidents refer to a resource
+func (r Resource) key() string {
+	return strings.TrimPrefix(r.Namespace+"/"+r.Kind+"/"+r.Name, "/")
+}
+
+func (b *Bundle) add(name string, data []byte) {
+	b.files = append(b.files, bundleFile{name: name, data: data})
+	b.Manifest.Files = append(b.Manifest.Files, name)
+}
+
+func (b *Bundle) addJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.fail("encoding %s: %v", name, err)
+		return
+	}
+	b.add(name, data)
+}
+
+// fail records a part of the bundle that could not be collected
+func (b *Bundle) fail(format string, args ...interface{}) {
+	b.Manifest.Errors = append(b.Manifest.Errors, fmt.Sprintf(format, args...))
+}
+
+// WriteArchive writes the bundle as a tar.gz archive, manifest.json first
+func (b *Bundle) WriteArchive(w io.Writer) error {
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	files := append([]bundleFile{{name: "manifest.json", data: manifest}}, b.files...)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(file.data)),
+			ModTime: b.Manifest.GeneratedAt,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// revisionAt returns the revision a resource was at the given time, nil when it did not exist yet.
+// A deletion returns the last revision before it, the resource was deleted in the time range.
+func revisionAt(h *history.History, at time.Time) *history.Revision {
+	index := -1
+	for i := range h.Revisions {
+		if h.Revisions[i].Time.After(at) {
+			break
+		}
+		index = i
+	}
+	for ; index >= 0; index-- {
+		if h.Revisions[index].Object != nil {
+			return &h.Revisions[index]
+		}
+	}
+	return nil
+}
+
+// logExcerpt keeps the timestamped log lines up to the end of the time range. Lines without a
+// parsable timestamp belong to the line before them.
+func logExcerpt(logs io.Reader, to time.Time) ([]byte, error) {
+	var excerpt strings.Builder
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), logLimitBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if stamp, _, ok := strings.Cut(line, " "); ok {
+			if at, err := time.Parse(time.RFC3339Nano, stamp); err == nil && at.After(to) {
+				break
+			}
+		}
+		excerpt.WriteString(line)
+		excerpt.WriteByte('\n')
+	}
+	return []byte(excerpt.String()), scanner.Err()
+}
+
+// overlaps reports whether [first, last] intersects [from, to]
+func overlaps(first, last, from, to time.Time) bool {
+	if last.IsZero() {
+		last = first
+	}
+	return !first.After(to) && !last.Before(from)
+}
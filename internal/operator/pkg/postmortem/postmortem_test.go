@@ -0,0 +1,154 @@
+package postmortem
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/history"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deployment := []Resource{{Kind: "Deployment", Namespace: "shop", Name: "cart"}}
+
+	tests := []struct {
+		name    string
+		request Request
+		wantErr bool
+	}{
+		{name: "defaults", request: Request{From: now.Add(-time.Hour), Resources: deployment}},
+		{name: "from after to", request: Request{From: now, To: now.Add(-time.Hour), Resources: deployment}, wantErr: true},
+		{name: "range too long", request: Request{From: now.Add(-31 * 24 * time.Hour), Resources: deployment}, wantErr: true},
+		{name: "no resources", request: Request{From: now.Add(-time.Hour)}, wantErr: true},
+		{name: "missing name", request: Request{From: now.Add(-time.Hour), Resources: []Resource{{Kind: "Pod"}}}, wantErr: true},
+		{name: "path in name", request: Request{From: now.Add(-time.Hour), Resources: []Resource{{Kind: "Pod", Namespace: "..", Name: "x"}}}, wantErr: true},
+		{name: "too many log lines", request: Request{From: now.Add(-time.Hour), Resources: deployment, LogTailLines: 10000}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.request.Validate(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (!tt.request.To.Equal(now) || tt.request.LogTailLines != defaultLogTailLines) {
+				t.Errorf("Validate() = %+v, want the defaults filled in", tt.request)
+			}
+		})
+	}
+}
+
+func TestRevisionAt(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	object := map[string]interface{}{"kind": "Deployment"}
+	h := &history.History{Revisions: []history.Revision{
+		{Revision: 1, Time: start, ChangeType: history.ChangeCreated, Object: object},
+		{Revision: 2, Time: start.Add(time.Hour), ChangeType: history.ChangeUpdated, Object: object},
+		{Revision: 3, Time: start.Add(2 * time.Hour), ChangeType: history.ChangeDeleted},
+	}}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{name: "before creation", at: start.Add(-time.Minute), want: 0},
+		{name: "first revision", at: start.Add(30 * time.Minute), want: 1},
+		{name: "exact revision time", at: start.Add(time.Hour), want: 2},
+		{name: "after deletion", at: start.Add(3 * time.Hour), want: 2},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := 0
+			if revision := revisionAt(h, tt.at); revision != nil {
+				got = revision.Revision
+			}
+			if got != tt.want {
+				t.Errorf("revisionAt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogExcerpt(t *testing.T) {
+	t.Parallel()
+
+	logs := strings.Join([]string{
+		"2026-03-01T12:00:00.000000001Z starting",
+		"2026-03-01T12:30:00Z panic: out of range",
+		"goroutine 1 [running]:",
+		"2026-03-01T13:00:00.5Z restarted",
+	}, "\n")
+
+	excerpt, err := logExcerpt(strings.NewReader(logs), time.Date(2026, 3, 1, 12, 59, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("logExcerpt() error = %v", err)
+	}
+	want := "2026-03-01T12:00:00.000000001Z starting\n2026-03-01T12:30:00Z panic: out of range\ngoroutine 1 [running]:\n"
+	if string(excerpt) != want {
+		t.Errorf("logExcerpt() = %q, want %q", excerpt, want)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	t.Parallel()
+
+	resource := Resource{Kind: "Deployment", Namespace: "shop", Name: "cart"}
+	bundle := &Bundle{Manifest: Manifest{Cluster: "prod", Resources: []Resource{resource}, Files: []string{}}}
+	bundle.addJSON(resource.dir()+"/events.json", []string{})
+	bundle.add(resource.dir()+"/logs/cart-1-app.log", []byte("line\n"))
+	bundle.fail("metrics of shop/cart-1: %s", "not available")
+
+	var buf bytes.Buffer
+	if err := bundle.WriteArchive(&buf); err != nil {
+		t.Fatalf("WriteArchive() error = %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	archive := tar.NewReader(gz)
+	var names []string
+	var manifest Manifest
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading archive: %v", err)
+		}
+		names = append(names, header.Name)
+		if header.Name == "manifest.json" {
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				t.Fatalf("decoding manifest: %v", err)
+			}
+		}
+	}
+
+	want := []string{"manifest.json", "resources/deployment/shop/cart/events.json", "resources/deployment/shop/cart/logs/cart-1-app.log"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("archive files = %v, want %v", names, want)
+	}
+	if len(manifest.Files) != 2 || len(manifest.Errors) != 1 {
+		t.Errorf("manifest = %+v, want 2 files and 1 error", manifest)
+	}
+}
@@ -0,0 +1,395 @@
+package posture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	trendsFileName = "vulnerability-posture.json"
+
+	// DefaultLimit caps the ranked images of a report when no limit is asked for
+	DefaultLimit = 20
+	// MaxLimit bounds the ranked images of a report
+	MaxLimit = 500
+
+	// collectTimeout bounds listing the pods, services and ingresses of a cluster
+	collectTimeout = 30 * time.Second
+)
+
+// Image rankings
+const (
+	// RankRisk orders images by their severities weighted by the exposure of the pods running them
+	RankRisk = "risk"
+	// RankPods orders images by their blast radius, the number of running pods
+	RankPods = "pods"
+)
+
+// ErrInvalidQuery is returned for posture queries that can't be answered
+var ErrInvalidQuery = errors.New("invalid posture query")
+
+// Severity weights of the risk score, a critical vulnerability outweighs many low ones
+var severityWeights = Severities{Critical: 10, High: 5, Medium: 2, Low: 1}
+
+// Exposure weights of the risk score, a pod reachable from the internet counts for four unexposed ones
+var exposureWeights = map[string]float64{
+	canvas.ExposureInternet: 4,
+	canvas.ExposureNode:     2,
+	canvas.ExposureCluster:  1.5,
+	canvas.ExposureNone:     1,
+}
+
+// Severities counts vulnerabilities by severity
+type Severities struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+	Total    int `json:"total"`
+}
+
+func (s *Severities) add(other Severities) {
+	s.Critical += other.Critical
+	s.High += other.High
+	s.Medium += other.Medium
+	s.Low += other.Low
+	s.Unknown += other.Unknown
+	s.Total += other.Total
+}
+
+func (s Severities) weight() float64 {
+	return float64(s.Critical*severityWeights.Critical + s.High*severityWeights.High +
+		s.Medium*severityWeights.Medium + s.Low*severityWeights.Low)
+}
+
+// ScanLookup returns the vulnerabilities found in an image, false while it isn't scanned
+type ScanLookup func(image string) (Severities, bool)
+
+// Options narrow and rank a report
+type Options struct {
+	// Clusters limits the report to these contexts, empty reports every context
+	Clusters []string
+	// Rank is RankRisk or RankPods, RankRisk when empty
+	Rank string
+	// Limit caps the ranked images, DefaultLimit when 0
+	Limit int
+	// Since starts the trends, they are left out when zero
+	Since time.Time
+}
+
+// Report is the vulnerability posture of a set of clusters
+type Report struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Totals counts the vulnerabilities of the distinct images running across the clusters
+	Totals   Severities       `json:"totals"`
+	Clusters []ClusterPosture `json:"clusters"`
+	// Images are the vulnerable images, ranked and capped by the options
+	Images []ImagePosture `json:"images"`
+	// TotalImages counts the vulnerable images before the cap
+	TotalImages int            `json:"totalImages"`
+	Trends      []ClusterTrend `json:"trends,omitempty"`
+}
+
+// ClusterPosture totals the vulnerabilities of the distinct images running in a cluster
+type ClusterPosture struct {
+	Cluster string `json:"cluster"`
+	Severities
+	Images int `json:"images"`
+	// Unscanned counts the running images without scan results, they are left out of the totals
+	Unscanned   int    `json:"unscanned"`
+	Pods        int    `json:"pods"`
+	ExposedPods int    `json:"exposedPods"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ImagePosture is a vulnerable image and the pods running it across the clusters
+type ImagePosture struct {
+	Image string `json:"image"`
+	Severities
+	// Pods is the blast radius of the image, the running pods with a container of it
+	Pods int `json:"pods"`
+	// ExposedPods counts the pods reachable from outside their cluster, through an ingress, a
+	// load balancer, an external IP or a node port
+	ExposedPods int `json:"exposedPods"`
+	// Exposure is the highest exposure of the pods
+	Exposure string   `json:"exposure"`
+	Clusters []string `json:"clusters"`
+	// Score weighs the severities by the exposure of every pod
+	Score float64 `json:"score"`
+}
+
+// RunningPod is a running pod with the images of its containers
+type RunningPod struct {
+	Cluster   string
+	Namespace string
+	Name      string
+	Images    []string
+	Exposure  string
+}
+
+// Posture aggregates the scan results of the images running across clusters
+type Posture struct {
+	kubeConfigStore kubeconfig.ContextStore
+	lookup          ScanLookup
+	trendsPath      string
+	mutex           sync.Mutex
+	// trends holds the hourly points of every reported cluster, oldest first
+	trends map[string][]TrendPoint
+	loaded bool
+}
+
+// NewPosture creates a posture reading scan results through lookup
+func NewPosture(kubeConfigStore kubeconfig.ContextStore, lookup ScanLookup) *Posture {
+	return &Posture{
+		kubeConfigStore: kubeConfigStore,
+		lookup:          lookup,
+		trendsPath:      filepath.Join(utils.ConfigDir(), trendsFileName),
+		trends:          map[string][]TrendPoint{},
+	}
+}
+
+// Report collects the running pods of the clusters, ranks their images and records the cluster
+// totals into the trends
+func (p *Posture) Report(opts Options) (*Report, error) {
+	switch opts.Rank {
+	case "", RankRisk, RankPods:
+	default:
+		return nil, fmt.Errorf("%w: rank must be risk or pods", ErrInvalidQuery)
+	}
+	if opts.Limit < 0 || opts.Limit > MaxLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+	}
+
+	clusterNames := opts.Clusters
+	if len(clusterNames) == 0 {
+		contexts, err := p.kubeConfigStore.GetContexts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, ctx := range contexts {
+			if !ctx.Internal {
+				clusterNames = append(clusterNames, ctx.Name)
+			}
+		}
+	}
+
+	pods := make([][]RunningPod, len(clusterNames))
+	errs := make([]error, len(clusterNames))
+	var wg sync.WaitGroup
+	for idx, clusterName := range clusterNames {
+		wg.Add(1)
+		go func(idx int, clusterName string) {
+			defer wg.Done()
+			pods[idx], errs[idx] = p.collectCluster(clusterName)
+		}(idx, clusterName)
+	}
+	wg.Wait()
+
+	var running []RunningPod
+	for _, clusterPods := range pods {
+		running = append(running, clusterPods...)
+	}
+	report := aggregate(running, p.lookup, opts)
+	report.GeneratedAt = time.Now()
+
+	reported := map[string]int{}
+	for idx, cluster := range report.Clusters {
+		reported[cluster.Cluster] = idx
+	}
+	for idx, clusterName := range clusterNames {
+		if _, ok := reported[clusterName]; !ok {
+			report.Clusters = append(report.Clusters, ClusterPosture{Cluster: clusterName})
+			reported[clusterName] = len(report.Clusters) - 1
+		}
+		if errs[idx] != nil {
+			report.Clusters[reported[clusterName]].Error = errs[idx].Error()
+		}
+	}
+	sort.Slice(report.Clusters, func(a, b int) bool { return report.Clusters[a].Cluster < report.Clusters[b].Cluster })
+
+	if err := p.record(report); err != nil {
+		logger.Log(logger.LevelError, nil, err, "recording vulnerability posture trends")
+	}
+	if !opts.Since.IsZero() {
+		trends, err := p.Trends(clusterNames, opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		report.Trends = trends
+	}
+	return report, nil
+}
+
+// collectCluster lists the running pods of a cluster with the exposure of each
+func (p *Posture) collectCluster(clusterName string) ([]RunningPod, error) {
+	kubeContext, err := p.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	canvasController, err := canvas.NewController(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create canvas controller: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	list, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase=" + string(corev1.PodRunning),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	exposure, err := canvasController.GetExposure(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]RunningPod, 0, len(list.Items))
+	for _, pod := range list.Items {
+		running := RunningPod{
+			Cluster:   clusterName,
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Exposure:  exposure.Of(pod.Namespace, pod.Labels),
+		}
+		for _, container := range pod.Spec.InitContainers {
+			running.Images = append(running.Images, container.Image)
+		}
+		for _, container := range pod.Spec.Containers {
+			running.Images = append(running.Images, container.Image)
+		}
+		pods = append(pods, running)
+	}
+	return pods, nil
+}
+
+// aggregate totals the scan results of the images of the pods per cluster and ranks the vulnerable
+// images
+func aggregate(pods []RunningPod, lookup ScanLookup, opts Options) *Report {
+	report := &Report{Clusters: []ClusterPosture{}, Images: []ImagePosture{}}
+	clusters := map[string]*ClusterPosture{}
+	clusterImages := map[string]map[string]bool{}
+	images := map[string]*ImagePosture{}
+	imageClusters := map[string]map[string]bool{}
+	scanned := map[string]bool{}
+
+	for _, pod := range pods {
+		cluster := clusters[pod.Cluster]
+		if cluster == nil {
+			cluster = &ClusterPosture{Cluster: pod.Cluster}
+			clusters[pod.Cluster] = cluster
+			clusterImages[pod.Cluster] = map[string]bool{}
+		}
+		cluster.Pods++
+		if exposed(pod.Exposure) {
+			cluster.ExposedPods++
+		}
+
+		// A pod running an image in several containers counts once in its blast radius
+		podImages := map[string]bool{}
+		for _, image := range pod.Images {
+			if podImages[image] {
+				continue
+			}
+			podImages[image] = true
+
+			severities, ok := lookup(image)
+			if !clusterImages[pod.Cluster][image] {
+				clusterImages[pod.Cluster][image] = true
+				cluster.Images++
+				if ok {
+					cluster.Severities.add(severities)
+				} else {
+					cluster.Unscanned++
+				}
+			}
+			if !ok || severities.Total == 0 {
+				continue
+			}
+			if !scanned[image] {
+				scanned[image] = true
+				report.Totals.add(severities)
+			}
+
+			img := images[image]
+			if img == nil {
+				img = &ImagePosture{Image: image, Severities: severities, Exposure: canvas.ExposureNone}
+				images[image] = img
+				imageClusters[image] = map[string]bool{}
+			}
+			img.Pods++
+			if exposed(pod.Exposure) {
+				img.ExposedPods++
+			}
+			if canvas.MoreExposed(pod.Exposure, img.Exposure) {
+				img.Exposure = pod.Exposure
+			}
+			img.Score += severities.weight() * exposureWeight(pod.Exposure)
+			if !imageClusters[image][pod.Cluster] {
+				imageClusters[image][pod.Cluster] = true
+				img.Clusters = append(img.Clusters, pod.Cluster)
+			}
+		}
+	}
+
+	for _, cluster := range clusters {
+		report.Clusters = append(report.Clusters, *cluster)
+	}
+	for _, img := range images {
+		sort.Strings(img.Clusters)
+		report.Images = append(report.Images, *img)
+	}
+	sort.Slice(report.Images, func(a, b int) bool {
+		x, y := report.Images[a], report.Images[b]
+		if opts.Rank == RankPods && x.Pods != y.Pods {
+			return x.Pods > y.Pods
+		}
+		if x.Score != y.Score {
+			return x.Score > y.Score
+		}
+		return x.Image < y.Image
+	})
+	report.TotalImages = len(report.Images)
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	if len(report.Images) > limit {
+		report.Images = report.Images[:limit]
+	}
+	return report
+}
+
+// exposed reports whether a pod is reachable from outside its cluster
+func exposed(exposure string) bool {
+	return canvas.MoreExposed(exposure, canvas.ExposureCluster)
+}
+
+func exposureWeight(exposure string) float64 {
+	if weight, ok := exposureWeights[exposure]; ok {
+		return weight
+	}
+	return exposureWeights[canvas.ExposureNone]
+}
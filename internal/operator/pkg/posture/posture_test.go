@@ -0,0 +1,122 @@
+package posture
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/canvas"
+)
+
+func testLookup(image string) (Severities, bool) {
+	scans := map[string]Severities{
+		"web:1":     {Critical: 1, High: 2, Total: 3},
+		"worker:1":  {Critical: 1, High: 2, Total: 3},
+		"sidecar:1": {Low: 4, Total: 4},
+		"clean:1":   {},
+	}
+	severities, ok := scans[image]
+	return severities, ok
+}
+
+func TestAggregate(t *testing.T) {
+	t.Parallel()
+
+	pods := []RunningPod{
+		{Cluster: "prod", Namespace: "shop", Name: "web-a", Images: []string{"web:1", "sidecar:1"}, Exposure: canvas.ExposureInternet},
+		{Cluster: "prod", Namespace: "shop", Name: "worker-a", Images: []string{"worker:1", "sidecar:1", "sidecar:1"}, Exposure: canvas.ExposureNone},
+		{Cluster: "prod", Namespace: "shop", Name: "worker-b", Images: []string{"worker:1", "clean:1"}, Exposure: canvas.ExposureNone},
+		{Cluster: "staging", Namespace: "shop", Name: "worker-a", Images: []string{"worker:1", "new:1"}, Exposure: canvas.ExposureCluster},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		// web runs once, exposed to the internet: 20 * 4 beats worker's 20 * (1 + 1 + 1.5)
+		{name: "risk", opts: Options{}, want: []string{"web:1", "worker:1", "sidecar:1"}},
+		{name: "blast radius", opts: Options{Rank: RankPods}, want: []string{"worker:1", "sidecar:1", "web:1"}},
+		{name: "limit", opts: Options{Limit: 1}, want: []string{"web:1"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			report := aggregate(pods, testLookup, tt.opts)
+			if len(report.Images) != len(tt.want) {
+				t.Fatalf("Images = %+v, want %v", report.Images, tt.want)
+			}
+			for i, image := range tt.want {
+				if report.Images[i].Image != image {
+					t.Errorf("Images[%d] = %s, want %s", i, report.Images[i].Image, image)
+				}
+			}
+			if report.TotalImages != 3 {
+				t.Errorf("TotalImages = %d, want 3", report.TotalImages)
+			}
+		})
+	}
+
+	report := aggregate(pods, testLookup, Options{})
+	if want := (Severities{Critical: 2, High: 4, Low: 4, Total: 10}); report.Totals != want {
+		t.Errorf("Totals = %+v, want %+v", report.Totals, want)
+	}
+	worker := report.Images[1]
+	if worker.Pods != 3 || worker.ExposedPods != 0 || worker.Exposure != canvas.ExposureCluster || len(worker.Clusters) != 2 {
+		t.Errorf("worker:1 = %+v, want 3 pods in 2 clusters, exposed in its cluster", worker)
+	}
+	for _, cluster := range report.Clusters {
+		switch cluster.Cluster {
+		case "prod":
+			if cluster.Images != 4 || cluster.Unscanned != 0 || cluster.Pods != 3 || cluster.ExposedPods != 1 || cluster.Total != 10 {
+				t.Errorf("prod = %+v", cluster)
+			}
+		case "staging":
+			if cluster.Images != 2 || cluster.Unscanned != 1 || cluster.Total != 3 {
+				t.Errorf("staging = %+v", cluster)
+			}
+		}
+	}
+}
+
+func TestTrends(t *testing.T) {
+	t.Parallel()
+
+	p := &Posture{trendsPath: filepath.Join(t.TempDir(), trendsFileName), trends: map[string][]TrendPoint{}}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	reports := []*Report{
+		{GeneratedAt: now.Add(-trendRetention - time.Hour), Clusters: []ClusterPosture{{Cluster: "prod", Severities: Severities{Total: 9}}}},
+		{GeneratedAt: now.Add(-time.Hour), Clusters: []ClusterPosture{{Cluster: "prod", Severities: Severities{Total: 7}}}},
+		{GeneratedAt: now.Add(10 * time.Minute), Clusters: []ClusterPosture{{Cluster: "prod", Severities: Severities{Total: 5}}}},
+		// The last report of an hour replaces the earlier ones, failed clusters keep their point
+		{GeneratedAt: now.Add(20 * time.Minute), Clusters: []ClusterPosture{
+			{Cluster: "prod", Severities: Severities{Total: 4}},
+			{Cluster: "staging", Error: "failed to list pods"},
+		}},
+	}
+	for _, report := range reports {
+		if err := p.record(report); err != nil {
+			t.Fatalf("record() error = %v", err)
+		}
+	}
+
+	// Trends are read back from the file
+	p = &Posture{trendsPath: p.trendsPath}
+	trends, err := p.Trends([]string{"staging", "prod"}, now.Add(-trendRetention*2))
+	if err != nil {
+		t.Fatalf("Trends() error = %v", err)
+	}
+	if len(trends) != 2 || trends[0].Cluster != "prod" || len(trends[1].Points) != 0 {
+		t.Fatalf("Trends() = %+v, want prod and an empty staging", trends)
+	}
+	points := trends[0].Points
+	if len(points) != 2 || points[0].Total != 7 || points[1].Total != 4 || !points[1].Start.Equal(now) {
+		t.Errorf("prod points = %+v, want 7 an hour ago and 4 now", points)
+	}
+
+	trends, _ = p.Trends([]string{"prod"}, now.Add(5*time.Minute))
+	if len(trends[0].Points) != 1 {
+		t.Errorf("Trends() since now = %+v, want the point of this hour", trends[0].Points)
+	}
+}
@@ -0,0 +1,88 @@
+package posture
+
+import (
+	"sort"
+	"time"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+// trendRetention is how long the hourly totals of a cluster are kept
+const trendRetention = 90 * 24 * time.Hour
+
+// TrendPoint is the vulnerability totals of a cluster at the last report of an hour
+type TrendPoint struct {
+	Start time.Time `json:"start"`
+	Severities
+	Unscanned int `json:"unscanned"`
+}
+
+// ClusterTrend is the vulnerability totals of a cluster over time
+type ClusterTrend struct {
+	Cluster string       `json:"cluster"`
+	Points  []TrendPoint `json:"points"`
+}
+
+// record stores the totals of the clusters of a report in the point of its hour, replacing the
+// totals of an earlier report of that hour, and drops the points past the retention. Clusters that
+// failed to report keep their last point.
+func (p *Posture) record(report *Report) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.loadTrends(); err != nil {
+		return err
+	}
+	start := report.GeneratedAt.UTC().Truncate(time.Hour)
+	cutoff := start.Add(-trendRetention)
+	for _, cluster := range report.Clusters {
+		if cluster.Error != "" {
+			continue
+		}
+		point := TrendPoint{Start: start, Severities: cluster.Severities, Unscanned: cluster.Unscanned}
+		points := p.trends[cluster.Cluster]
+		if n := len(points); n > 0 && points[n-1].Start.Equal(start) {
+			points[n-1] = point
+		} else {
+			points = append(points, point)
+		}
+		kept := sort.Search(len(points), func(i int) bool { return points[i].Start.After(cutoff) })
+		p.trends[cluster.Cluster] = append([]TrendPoint(nil), points[kept:]...)
+	}
+	return utils.WriteJSONFile(p.trendsPath, p.trends)
+}
+
+// Trends returns the hourly totals of the clusters since the given time
+func (p *Posture) Trends(clusterNames []string, since time.Time) ([]ClusterTrend, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.loadTrends(); err != nil {
+		return nil, err
+	}
+	trends := make([]ClusterTrend, 0, len(clusterNames))
+	for _, clusterName := range clusterNames {
+		trend := ClusterTrend{Cluster: clusterName, Points: []TrendPoint{}}
+		for _, point := range p.trends[clusterName] {
+			if !point.Start.Before(since.Truncate(time.Hour)) {
+				trend.Points = append(trend.Points, point)
+			}
+		}
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool { return trends[i].Cluster < trends[j].Cluster })
+	return trends, nil
+}
+
+func (p *Posture) loadTrends() error {
+	if p.loaded {
+		return nil
+	}
+	trends := map[string][]TrendPoint{}
+	if err := utils.ReadJSONFile(p.trendsPath, &trends); err != nil {
+		return err
+	}
+	p.trends = trends
+	p.loaded = true
+	return nil
+}
@@ -0,0 +1,240 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// preemptionLookback is how far back preemption events are reported, the API server usually keeps
+	// events for an hour only
+	preemptionLookback = 24 * time.Hour
+	maxPreemptions     = 200
+)
+
+// ErrInvalidRequest is returned when the simulation request is incomplete or names a priority class
+// that does not exist
+var ErrInvalidRequest = errors.New("invalid simulation request")
+
+// Analyzer reports the priority classes of a cluster and simulates preemption
+type Analyzer struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// ClassSummary is a PriorityClass with the pods and workloads using it
+type ClassSummary struct {
+	Name             string `json:"name"`
+	Value            int32  `json:"value"`
+	GlobalDefault    bool   `json:"globalDefault"`
+	PreemptionPolicy string `json:"preemptionPolicy"`
+	Description      string `json:"description,omitempty"`
+	// System classes ship with Kubernetes and are reserved for critical components
+	System    bool `json:"system"`
+	Pods      int  `json:"pods"`
+	Workloads int  `json:"workloads"`
+}
+
+// Workload is a top-level controller of pods
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Pods      int    `json:"pods"`
+	// Priority is the priority its pods got, from the global default class when there is one
+	Priority int32 `json:"priority"`
+}
+
+// Preemption is a pod evicted by the scheduler to make room for a higher priority pod
+type Preemption struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+}
+
+// Landscape is the priority class overview of a cluster
+type Landscape struct {
+	Cluster      string         `json:"cluster"`
+	Classes      []ClassSummary `json:"classes"`
+	DefaultClass string         `json:"defaultClass,omitempty"`
+	// WithoutPriority lists workloads whose pods do not name a priority class
+	WithoutPriority []Workload   `json:"withoutPriority"`
+	Preemptions     []Preemption `json:"preemptions"`
+}
+
+// NewAnalyzer creates a new priority analyzer
+func NewAnalyzer(kubeConfigStore kubeconfig.ContextStore) *Analyzer {
+	return &Analyzer{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+func (a *Analyzer) clientset(clusterName string) (*kubernetes.Clientset, error) {
+	kubeContext, err := a.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+	return clientset, nil
+}
+
+// Landscape lists the priority classes with their usage, the workloads without a priority class and
+// recent preemptions
+func (a *Analyzer) Landscape(clusterName string) (*Landscape, error) {
+	clientset, err := a.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	classes, err := clientset.SchedulingV1().PriorityClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list priority classes: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	landscape := &Landscape{
+		Cluster:         clusterName,
+		Classes:         []ClassSummary{},
+		WithoutPriority: []Workload{},
+		Preemptions:     []Preemption{},
+	}
+	summaries := map[string]*ClassSummary{}
+	for _, class := range classes.Items {
+		summary := &ClassSummary{
+			Name:          class.Name,
+			Value:         class.Value,
+			GlobalDefault: class.GlobalDefault,
+			// Unset means PreemptLowerPriority
+			PreemptionPolicy: string(corev1.PreemptLowerPriority),
+			Description:      class.Description,
+			System:           class.Name == "system-cluster-critical" || class.Name == "system-node-critical",
+		}
+		if class.PreemptionPolicy != nil {
+			summary.PreemptionPolicy = string(*class.PreemptionPolicy)
+		}
+		if class.GlobalDefault {
+			landscape.DefaultClass = class.Name
+		}
+		summaries[class.Name] = summary
+	}
+
+	classWorkloads := map[string]map[string]bool{}
+	unprioritized := map[string]*Workload{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+		key := kind + "/" + pod.Namespace + "/" + name
+
+		if summary, ok := summaries[pod.Spec.PriorityClassName]; ok {
+			summary.Pods++
+			if classWorkloads[summary.Name] == nil {
+				classWorkloads[summary.Name] = map[string]bool{}
+			}
+			classWorkloads[summary.Name][key] = true
+			continue
+		}
+		if pod.Spec.PriorityClassName != "" {
+			// The class was deleted after the pod was admitted
+			continue
+		}
+
+		workload, ok := unprioritized[key]
+		if !ok {
+			workload = &Workload{Kind: kind, Namespace: pod.Namespace, Name: name, Priority: podPriority(pod)}
+			unprioritized[key] = workload
+		}
+		workload.Pods++
+	}
+
+	for name, summary := range summaries {
+		summary.Workloads = len(classWorkloads[name])
+		landscape.Classes = append(landscape.Classes, *summary)
+	}
+	sort.Slice(landscape.Classes, func(i, j int) bool { return landscape.Classes[i].Value > landscape.Classes[j].Value })
+
+	for _, workload := range unprioritized {
+		landscape.WithoutPriority = append(landscape.WithoutPriority, *workload)
+	}
+	sort.Slice(landscape.WithoutPriority, func(i, j int) bool {
+		a, b := landscape.WithoutPriority[i], landscape.WithoutPriority[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Kind+"/"+a.Name < b.Kind+"/"+b.Name
+	})
+
+	landscape.Preemptions, err = preemptions(ctx, clientset, time.Now().Add(-preemptionLookback))
+	if err != nil {
+		return nil, err
+	}
+	return landscape, nil
+}
+
+// preemptions lists the Preempted events of victim pods since the given time, most recent first
+func preemptions(ctx context.Context, clientset *kubernetes.Clientset, since time.Time) ([]Preemption, error) {
+	events, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"reason": "Preempted", "involvedObject.kind": "Pod"}.AsSelector().String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preemption events: %v", err)
+	}
+
+	result := []Preemption{}
+	for _, e := range events.Items {
+		last := e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		if last.Before(since) {
+			continue
+		}
+		count := e.Count
+		if count == 0 {
+			count = 1
+		}
+		result = append(result, Preemption{
+			Time:      last,
+			Namespace: e.InvolvedObject.Namespace,
+			Pod:       e.InvolvedObject.Name,
+			Message:   e.Message,
+			Count:     count,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	if len(result) > maxPreemptions {
+		result = result[:maxPreemptions]
+	}
+	return result, nil
+}
+
+func podPriority(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package priority
+
+import (
+	"testing"
+)
+
+func pod(name string, priority int32, cpu int64) runningPod {
+	return runningPod{victim: Victim{Namespace: "default", Pod: name, Priority: priority}, cpu: cpu}
+}
+
+func TestSimulate(t *testing.T) {
+	t.Parallel()
+
+	const gib = 1 << 30
+
+	tests := []struct {
+		name              string
+		nodes             func() []*nodeState
+		demand            demand
+		replicas          int
+		wantNodes         []string
+		wantVictims       [][]string
+		wantUnschedulable int
+	}{
+		{
+			name: "fits without preemption",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 4000, memory: 8 * gib, pods: 110, running: []runningPod{pod("batch", 0, 3000)}},
+					{name: "b", cpu: 4000, memory: 8 * gib, pods: 110},
+				}
+			},
+			demand:      demand{cpu: 2000, priority: 1000, preempt: true},
+			replicas:    1,
+			wantNodes:   []string{"b"},
+			wantVictims: [][]string{{}},
+		},
+		{
+			name: "preempts the lowest priority pods and reprieves the rest",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 4000, memory: 8 * gib, pods: 110, running: []runningPod{
+						pod("batch", 0, 1500), pod("web", 500, 1500), pod("cache", 100, 1000),
+					}},
+				}
+			},
+			demand:      demand{cpu: 1500, priority: 1000, preempt: true},
+			replicas:    1,
+			wantNodes:   []string{"a"},
+			wantVictims: [][]string{{"batch"}},
+		},
+		{
+			name: "prefers the node with the least important victims",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 2000, memory: 8 * gib, pods: 110, running: []runningPod{pod("web", 500, 2000)}},
+					{name: "b", cpu: 2000, memory: 8 * gib, pods: 110, running: []runningPod{pod("batch-1", 0, 1000), pod("batch-2", 0, 1000)}},
+				}
+			},
+			demand:      demand{cpu: 2000, priority: 1000, preempt: true},
+			replicas:    1,
+			wantNodes:   []string{"b"},
+			wantVictims: [][]string{{"batch-1", "batch-2"}},
+		},
+		{
+			name: "never preempts with PreemptionPolicy Never",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 2000, memory: 8 * gib, pods: 110, running: []runningPod{pod("batch", 0, 2000)}},
+				}
+			},
+			demand:            demand{cpu: 1000, priority: 1000},
+			replicas:          1,
+			wantUnschedulable: 1,
+		},
+		{
+			name: "equal priority pods are not preempted",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 2000, memory: 8 * gib, pods: 110, running: []runningPod{pod("peer", 1000, 2000)}},
+				}
+			},
+			demand:            demand{cpu: 1000, priority: 1000, preempt: true},
+			replicas:          1,
+			wantUnschedulable: 1,
+		},
+		{
+			name: "replicas share the freed capacity",
+			nodes: func() []*nodeState {
+				return []*nodeState{
+					{name: "a", cpu: 2000, memory: 8 * gib, pods: 110, running: []runningPod{pod("batch", 0, 2000)}},
+				}
+			},
+			demand:            demand{cpu: 1000, priority: 1000, preempt: true},
+			replicas:          3,
+			wantNodes:         []string{"a", "a"},
+			wantVictims:       [][]string{{"batch"}, {}},
+			wantUnschedulable: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			placements, unschedulable := simulate(tt.nodes(), tt.demand, tt.replicas)
+			if unschedulable != tt.wantUnschedulable || len(placements) != len(tt.wantNodes) {
+				t.Fatalf("simulate() = %+v, %d unschedulable, want nodes %v and %d unschedulable", placements, unschedulable, tt.wantNodes, tt.wantUnschedulable)
+			}
+			for i, placement := range placements {
+				if placement.Node != tt.wantNodes[i] {
+					t.Errorf("replica %d placed on %s, want %s", placement.Replica, placement.Node, tt.wantNodes[i])
+				}
+				victims := []string{}
+				for _, victim := range placement.Victims {
+					victims = append(victims, victim.Pod)
+				}
+				if len(victims) != len(tt.wantVictims[i]) {
+					t.Errorf("replica %d victims = %v, want %v", placement.Replica, victims, tt.wantVictims[i])
+					continue
+				}
+				for j := range victims {
+					if victims[j] != tt.wantVictims[i][j] {
+						t.Errorf("replica %d victims = %v, want %v", placement.Replica, victims, tt.wantVictims[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
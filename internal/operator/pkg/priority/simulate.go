@@ -0,0 +1,387 @@
+package priority
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const maxSimulatedReplicas = 1000
+
+// SimulationRequest describes the high priority workload whose scheduling is simulated
+type SimulationRequest struct {
+	// PriorityClassName sets the priority and preemption policy of the pods, Priority is used without it
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	Priority          *int32 `json:"priority,omitempty"`
+	Replicas          int    `json:"replicas" binding:"required"`
+	// CPU and Memory are the requests of a single replica, e.g. "500m" and "1Gi"
+	CPU          string              `json:"cpu,omitempty"`
+	Memory       string              `json:"memory,omitempty"`
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// SimulationResult lists where the replicas would run and which pods would be preempted for them
+type SimulationResult struct {
+	Priority         int32       `json:"priority"`
+	PreemptionPolicy string      `json:"preemptionPolicy"`
+	Scheduled        int         `json:"scheduled"`
+	Unschedulable    int         `json:"unschedulable"`
+	Placements       []Placement `json:"placements"`
+	Victims          int         `json:"victims"`
+	// AffectedWorkloads sums up the victims per workload
+	AffectedWorkloads []Workload `json:"affectedWorkloads"`
+}
+
+// Placement is the node a replica would be scheduled on and the pods preempted to make room
+type Placement struct {
+	Replica int      `json:"replica"`
+	Node    string   `json:"node"`
+	Victims []Victim `json:"victims"`
+}
+
+// Victim is a pod that would be preempted
+type Victim struct {
+	Namespace         string `json:"namespace"`
+	Pod               string `json:"pod"`
+	WorkloadKind      string `json:"workloadKind"`
+	Workload          string `json:"workload"`
+	Priority          int32  `json:"priority"`
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// runningPod is a pod taking up node resources
+type runningPod struct {
+	victim Victim
+	cpu    int64
+	memory int64
+}
+
+// nodeState is the allocatable capacity of a node and the pods running on it
+type nodeState struct {
+	name    string
+	cpu     int64
+	memory  int64
+	pods    int64
+	running []runningPod
+}
+
+// demand is what a single replica of the simulated workload needs
+type demand struct {
+	cpu      int64
+	memory   int64
+	priority int32
+	preempt  bool
+}
+
+// Simulate places the replicas of a high priority workload on the nodes it may run on, preempting
+// lower priority pods like the scheduler would. PodDisruptionBudgets, affinities and topology spread
+// constraints are not taken into account.
+func (a *Analyzer) Simulate(clusterName string, req SimulationRequest) (*SimulationResult, error) {
+	if req.Replicas < 1 || req.Replicas > maxSimulatedReplicas {
+		return nil, fmt.Errorf("%w: replicas must be between 1 and %d", ErrInvalidRequest, maxSimulatedReplicas)
+	}
+	var d demand
+	for _, request := range []struct {
+		name  string
+		value string
+		into  *int64
+		milli bool
+	}{{"cpu", req.CPU, &d.cpu, true}, {"memory", req.Memory, &d.memory, false}} {
+		if request.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(request.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s: %v", ErrInvalidRequest, request.name, err)
+		}
+		if request.milli {
+			*request.into = quantity.MilliValue()
+		} else {
+			*request.into = quantity.Value()
+		}
+	}
+
+	clientset, err := a.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	result := &SimulationResult{PreemptionPolicy: string(corev1.PreemptLowerPriority)}
+	switch {
+	case req.PriorityClassName != "":
+		class, err := clientset.SchedulingV1().PriorityClasses().Get(ctx, req.PriorityClassName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: priority class %s does not exist", ErrInvalidRequest, req.PriorityClassName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get priority class %s: %v", req.PriorityClassName, err)
+		}
+		result.Priority = class.Value
+		if class.PreemptionPolicy != nil {
+			result.PreemptionPolicy = string(*class.PreemptionPolicy)
+		}
+	case req.Priority != nil:
+		result.Priority = *req.Priority
+	default:
+		return nil, fmt.Errorf("%w: priorityClassName or priority is required", ErrInvalidRequest)
+	}
+	d.priority = result.Priority
+	d.preempt = result.PreemptionPolicy != string(corev1.PreemptNever)
+
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := map[string]*nodeState{}
+	selector := labels.SelectorFromSet(req.NodeSelector)
+	for _, node := range nodeList.Items {
+		if !eligible(&node, selector, req.Tolerations) {
+			continue
+		}
+		allocatable := node.Status.Allocatable
+		nodes[node.Name] = &nodeState{
+			name:   node.Name,
+			cpu:    allocatable.Cpu().MilliValue(),
+			memory: allocatable.Memory().Value(),
+			pods:   allocatable.Pods().Value(),
+		}
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		node, ok := nodes[pod.Spec.NodeName]
+		if !ok || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+		cpu, memory := podRequests(pod)
+		node.running = append(node.running, runningPod{
+			victim: Victim{
+				Namespace:         pod.Namespace,
+				Pod:               pod.Name,
+				WorkloadKind:      kind,
+				Workload:          name,
+				Priority:          podPriority(pod),
+				PriorityClassName: pod.Spec.PriorityClassName,
+			},
+			cpu:    cpu,
+			memory: memory,
+		})
+	}
+
+	states := make([]*nodeState, 0, len(nodes))
+	for _, node := range nodes {
+		states = append(states, node)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].name < states[j].name })
+
+	result.Placements, result.Unschedulable = simulate(states, d, req.Replicas)
+	result.Scheduled = len(result.Placements)
+
+	affected := map[string]*Workload{}
+	result.AffectedWorkloads = []Workload{}
+	for _, placement := range result.Placements {
+		result.Victims += len(placement.Victims)
+		for _, victim := range placement.Victims {
+			key := victim.WorkloadKind + "/" + victim.Namespace + "/" + victim.Workload
+			workload, ok := affected[key]
+			if !ok {
+				workload = &Workload{Kind: victim.WorkloadKind, Namespace: victim.Namespace, Name: victim.Workload, Priority: victim.Priority}
+				affected[key] = workload
+			}
+			workload.Pods++
+		}
+	}
+	for _, workload := range affected {
+		result.AffectedWorkloads = append(result.AffectedWorkloads, *workload)
+	}
+	sort.Slice(result.AffectedWorkloads, func(i, j int) bool {
+		return result.AffectedWorkloads[i].Pods > result.AffectedWorkloads[j].Pods
+	})
+	return result, nil
+}
+
+// simulate places the replicas one by one. A replica goes to the node with the most free CPU it fits
+// on, otherwise to the node needing the least important victims, as the scheduler's preemption picks
+// the node whose highest priority victim is lowest, then the one with the fewest victims.
+func simulate(nodes []*nodeState, d demand, replicas int) ([]Placement, int) {
+	placements := []Placement{}
+	unschedulable := 0
+	incoming := runningPod{victim: Victim{Priority: d.priority}, cpu: d.cpu, memory: d.memory}
+
+	for replica := 1; replica <= replicas; replica++ {
+		var target *nodeState
+		var targetVictims []runningPod
+		var mostFree int64 = -1
+		for _, node := range nodes {
+			freeCPU, freeMemory, freePods := node.free()
+			if fits(d, freeCPU, freeMemory, freePods) && freeCPU > mostFree {
+				target, mostFree = node, freeCPU
+			}
+		}
+
+		if target == nil && d.preempt {
+			for _, node := range nodes {
+				victims, ok := selectVictims(node, d)
+				if ok && (target == nil || betterVictims(victims, targetVictims)) {
+					target, targetVictims = node, victims
+				}
+			}
+		}
+		if target == nil {
+			unschedulable++
+			continue
+		}
+
+		placement := Placement{Replica: replica, Node: target.name, Victims: []Victim{}}
+		for _, victim := range targetVictims {
+			placement.Victims = append(placement.Victims, victim.victim)
+			target.remove(victim.victim)
+		}
+		target.running = append(target.running, incoming)
+		placements = append(placements, placement)
+	}
+	return placements, unschedulable
+}
+
+// selectVictims removes every lower priority pod, then reprieves as many as possible starting with
+// the highest priority ones. It fails when the replica does not fit even without them.
+func selectVictims(node *nodeState, d demand) ([]runningPod, bool) {
+	freeCPU, freeMemory, freePods := node.free()
+	lower := []runningPod{}
+	for _, pod := range node.running {
+		if pod.victim.Priority < d.priority {
+			lower = append(lower, pod)
+			freeCPU += pod.cpu
+			freeMemory += pod.memory
+			freePods++
+		}
+	}
+	if len(lower) == 0 || !fits(d, freeCPU, freeMemory, freePods) {
+		return nil, false
+	}
+
+	sort.SliceStable(lower, func(i, j int) bool { return lower[i].victim.Priority > lower[j].victim.Priority })
+	victims := []runningPod{}
+	for _, pod := range lower {
+		if fits(d, freeCPU-pod.cpu, freeMemory-pod.memory, freePods-1) {
+			freeCPU, freeMemory, freePods = freeCPU-pod.cpu, freeMemory-pod.memory, freePods-1
+			continue
+		}
+		victims = append(victims, pod)
+	}
+	return victims, true
+}
+
+// betterVictims tells whether preempting a is preferable to preempting b
+func betterVictims(a, b []runningPod) bool {
+	highestA, highestB := highestPriority(a), highestPriority(b)
+	if highestA != highestB {
+		return highestA < highestB
+	}
+	return len(a) < len(b)
+}
+
+func highestPriority(pods []runningPod) int32 {
+	var highest int32
+	for i, pod := range pods {
+		if i == 0 || pod.victim.Priority > highest {
+			highest = pod.victim.Priority
+		}
+	}
+	return highest
+}
+
+func fits(d demand, freeCPU, freeMemory, freePods int64) bool {
+	return d.cpu <= freeCPU && d.memory <= freeMemory && freePods >= 1
+}
+
+// free returns the CPU, memory and pod slots not requested by the running pods
+func (n *nodeState) free() (int64, int64, int64) {
+	cpu, memory := n.cpu, n.memory
+	for _, pod := range n.running {
+		cpu -= pod.cpu
+		memory -= pod.memory
+	}
+	return cpu, memory, n.pods - int64(len(n.running))
+}
+
+func (n *nodeState) remove(victim Victim) {
+	for i, pod := range n.running {
+		if pod.victim == victim {
+			n.running = append(n.running[:i], n.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// eligible tells whether the simulated pods may be scheduled on a node
+func eligible(node *corev1.Node, selector labels.Selector, tolerations []corev1.Toleration) bool {
+	if node.Spec.Unschedulable || !selector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	ready := false
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	if !ready {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// podRequests returns the CPU in millicores and memory in bytes the scheduler reserves for a pod:
+// the sum of its containers or its largest init container, whichever is higher, plus the overhead
+func podRequests(pod *corev1.Pod) (int64, int64) {
+	var cpu, memory int64
+	for _, container := range pod.Spec.Containers {
+		cpu += container.Resources.Requests.Cpu().MilliValue()
+		memory += container.Resources.Requests.Memory().Value()
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if value := container.Resources.Requests.Cpu().MilliValue(); value > cpu {
+			cpu = value
+		}
+		if value := container.Resources.Requests.Memory().Value(); value > memory {
+			memory = value
+		}
+	}
+	cpu += pod.Spec.Overhead.Cpu().MilliValue()
+	memory += pod.Spec.Overhead.Memory().Value()
+	return cpu, memory
+}
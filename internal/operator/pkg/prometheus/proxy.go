@@ -0,0 +1,251 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const targetsFileName = "prometheus-targets.json"
+
+// Prometheus HTTP API endpoints the proxy serves
+const (
+	EndpointQuery      = "query"
+	EndpointQueryRange = "query_range"
+)
+
+var (
+	// ErrNotFound is returned for clusters without a configured Prometheus where none was discovered
+	ErrNotFound = errors.New("prometheus not found")
+	// ErrUnknownCluster is returned for clusters missing from the kubeconfig store
+	ErrUnknownCluster = errors.New("context not found")
+	// ErrInvalidTarget is returned for invalid Prometheus targets
+	ErrInvalidTarget = errors.New("invalid prometheus target")
+	// ErrInvalidQuery is returned for queries the proxy doesn't forward
+	ErrInvalidQuery = errors.New("invalid prometheus query")
+)
+
+// discoveryNamespaces and discoveryServices are where Prometheus is looked up, in order
+var (
+	discoveryNamespaces = []string{"monitoring", "prometheus", "kube-prometheus-stack", "observability", "istio-system"}
+	discoveryServices   = []string{"prometheus-operated", "prometheus-server", "prometheus", "kube-prometheus-stack-prometheus"}
+)
+
+// queryParams are the parameters forwarded for each endpoint, others are dropped
+var queryParams = map[string][]string{
+	EndpointQuery:      {"query", "time", "timeout"},
+	EndpointQueryRange: {"query", "start", "end", "step", "timeout"},
+}
+
+// Target is the Prometheus service of a cluster, reached through the API server service proxy
+type Target struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	// Port is the number or name of the service port
+	Port string `json:"port"`
+	// Scheme is http or https, http when empty
+	Scheme string `json:"scheme,omitempty"`
+	// Configured is false for targets found by discovery
+	Configured bool `json:"configured"`
+}
+
+// Validate checks the target names a service
+func (t Target) Validate() error {
+	if errs := validation.IsDNS1123Label(t.Namespace); len(errs) > 0 {
+		return fmt.Errorf("%w: namespace %q: %s", ErrInvalidTarget, t.Namespace, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsDNS1035Label(t.Service); len(errs) > 0 {
+		return fmt.Errorf("%w: service %q: %s", ErrInvalidTarget, t.Service, strings.Join(errs, ", "))
+	}
+	if t.Port == "" {
+		return fmt.Errorf("%w: a port is required", ErrInvalidTarget)
+	}
+	if port, err := strconv.Atoi(t.Port); err == nil {
+		if errs := validation.IsValidPortNum(port); len(errs) > 0 {
+			return fmt.Errorf("%w: port %s: %s", ErrInvalidTarget, t.Port, strings.Join(errs, ", "))
+		}
+	} else if errs := validation.IsValidPortName(t.Port); len(errs) > 0 {
+		return fmt.Errorf("%w: port %q: %s", ErrInvalidTarget, t.Port, strings.Join(errs, ", "))
+	}
+	if t.Scheme != "" && t.Scheme != "http" && t.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrInvalidTarget)
+	}
+	return nil
+}
+
+// Response is the answer of Prometheus to a proxied query, passed through as is
+type Response struct {
+	// Status is the HTTP status of the answer, Prometheus answers 400 for invalid queries and 422
+	// for queries that fail to execute
+	Status int
+	Body   []byte
+	Target *Target
+}
+
+// Proxy forwards PromQL queries to the Prometheus of each cluster, the configured one or else the
+// one discovered under its common service names
+type Proxy struct {
+	kubeConfigStore kubeconfig.ContextStore
+	targetsPath     string
+	mutex           sync.Mutex
+}
+
+// NewProxy creates a new Prometheus query proxy
+func NewProxy(kubeConfigStore kubeconfig.ContextStore) *Proxy {
+	return &Proxy{
+		kubeConfigStore: kubeConfigStore,
+		targetsPath:     filepath.Join(utils.ConfigDir(), targetsFileName),
+	}
+}
+
+// Target returns the Prometheus queries of a cluster go to
+func (p *Proxy) Target(ctx context.Context, clusterName string) (*Target, error) {
+	clientset, err := p.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return p.target(ctx, clusterName, clientset)
+}
+
+// SetTarget configures the Prometheus of a cluster, instead of discovering it
+func (p *Proxy) SetTarget(clusterName string, target Target) error {
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	target.Configured = true
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	targets, err := p.loadTargets()
+	if err != nil {
+		return err
+	}
+	targets[clusterName] = target
+	return utils.WriteJSONFile(p.targetsPath, targets)
+}
+
+// DeleteTarget goes back to discovering the Prometheus of a cluster
+func (p *Proxy) DeleteTarget(clusterName string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	targets, err := p.loadTargets()
+	if err != nil {
+		return err
+	}
+	delete(targets, clusterName)
+	return utils.WriteJSONFile(p.targetsPath, targets)
+}
+
+// Query forwards a query to an endpoint of the Prometheus HTTP API of a cluster. Only the
+// parameters of the endpoint are forwarded.
+func (p *Proxy) Query(ctx context.Context, clusterName, endpoint string, params url.Values) (*Response, error) {
+	allowed, ok := queryParams[endpoint]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown endpoint %q", ErrInvalidQuery, endpoint)
+	}
+	if params.Get("query") == "" {
+		return nil, fmt.Errorf("%w: a query is required", ErrInvalidQuery)
+	}
+
+	clientset, err := p.clientset(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := p.target(ctx, clusterName, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := target.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	req := clientset.CoreV1().RESTClient().Get().
+		Namespace(target.Namespace).
+		Resource("services").
+		Name(utilnet.JoinSchemeNamePort(scheme, target.Service, target.Port)).
+		SubResource("proxy").
+		Suffix("api", "v1", endpoint)
+	for _, name := range allowed {
+		for _, value := range params[name] {
+			req = req.Param(name, value)
+		}
+	}
+
+	response := &Response{Target: target}
+	result := req.Do(ctx).StatusCode(&response.Status)
+	// Prometheus errors are answered as is, only failing to reach the API server is an error
+	response.Body, err = result.Raw()
+	if err != nil && response.Status == 0 {
+		return nil, fmt.Errorf("failed to query prometheus: %w", err)
+	}
+	return response, nil
+}
+
+func (p *Proxy) target(ctx context.Context, clusterName string, clientset kubernetes.Interface) (*Target, error) {
+	p.mutex.Lock()
+	targets, err := p.loadTargets()
+	p.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if target, ok := targets[clusterName]; ok {
+		return &target, nil
+	}
+	return Discover(ctx, clientset)
+}
+
+func (p *Proxy) clientset(clusterName string) (*kubernetes.Clientset, error) {
+	kubeContext, err := p.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, clusterName)
+	}
+	return kubeContext.ClientSetWithToken("")
+}
+
+// loadTargets reads the configured targets by cluster, the caller must hold the mutex
+func (p *Proxy) loadTargets() (map[string]Target, error) {
+	targets := map[string]Target{}
+	if err := utils.ReadJSONFile(p.targetsPath, &targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// Discover looks up the Prometheus service in the namespaces Prometheus is usually installed in
+func Discover(ctx context.Context, clientset kubernetes.Interface) (*Target, error) {
+	for _, namespace := range discoveryNamespaces {
+		for _, name := range discoveryServices {
+			service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil || len(service.Spec.Ports) == 0 {
+				continue
+			}
+			return &Target{Namespace: namespace, Service: name, Port: webPort(service)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no service %s in namespaces %s, configure the prometheus target of the cluster",
+		ErrNotFound, strings.Join(discoveryServices, ", "), strings.Join(discoveryNamespaces, ", "))
+}
+
+// webPort prefers the port named after the Prometheus web endpoint
+func webPort(service *corev1.Service) string {
+	for _, port := range service.Spec.Ports {
+		if port.Name == "web" || port.Name == "http-web" || port.Port == 9090 {
+			return strconv.Itoa(int(port.Port))
+		}
+	}
+	return strconv.Itoa(int(service.Spec.Ports[0].Port))
+}
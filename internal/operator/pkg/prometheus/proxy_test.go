@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscover(t *testing.T) {
+	t.Parallel()
+
+	service := func(namespace, name string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       corev1.ServiceSpec{Ports: ports},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects []*corev1.Service
+		want    Target
+		wantErr error
+	}{
+		{
+			name: "operator prefers the web port",
+			objects: []*corev1.Service{
+				service("monitoring", "prometheus-operated", corev1.ServicePort{Name: "reloader", Port: 8080}, corev1.ServicePort{Name: "web", Port: 9090}),
+				service("monitoring", "prometheus-server", corev1.ServicePort{Port: 80}),
+			},
+			want: Target{Namespace: "monitoring", Service: "prometheus-operated", Port: "9090"},
+		},
+		{
+			name:    "community chart",
+			objects: []*corev1.Service{service("prometheus", "prometheus-server", corev1.ServicePort{Name: "http", Port: 80})},
+			want:    Target{Namespace: "prometheus", Service: "prometheus-server", Port: "80"},
+		},
+		{
+			name:    "other namespace",
+			objects: []*corev1.Service{service("metrics", "prometheus", corev1.ServicePort{Port: 9090})},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clientset := fake.NewSimpleClientset()
+			for _, object := range tt.objects {
+				if _, err := clientset.CoreV1().Services(object.Namespace).Create(context.Background(), object, metav1.CreateOptions{}); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+
+			target, err := Discover(context.Background(), clientset)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Discover() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			if *target != tt.want {
+				t.Errorf("Discover() = %+v, want %+v", *target, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		target  Target
+		wantErr bool
+	}{
+		{name: "port number", target: Target{Namespace: "monitoring", Service: "prometheus", Port: "9090"}},
+		{name: "port name over https", target: Target{Namespace: "monitoring", Service: "thanos-query", Port: "http", Scheme: "https"}},
+		{name: "missing port", target: Target{Namespace: "monitoring", Service: "prometheus"}, wantErr: true},
+		{name: "port out of range", target: Target{Namespace: "monitoring", Service: "prometheus", Port: "70000"}, wantErr: true},
+		{name: "invalid service", target: Target{Namespace: "monitoring", Service: "prometheus/api", Port: "9090"}, wantErr: true},
+		{name: "unknown scheme", target: Target{Namespace: "monitoring", Service: "prometheus", Port: "9090", Scheme: "grpc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.target.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTarget) {
+				t.Errorf("Validate() error = %v, want ErrInvalidTarget", err)
+			}
+		})
+	}
+}
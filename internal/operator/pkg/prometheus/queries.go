@@ -0,0 +1,147 @@
+package prometheus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultWindow is the range canned queries compute rates and increases over
+const DefaultWindow = 5 * time.Minute
+
+// Exporters the series of canned queries come from
+const (
+	ExporterCAdvisor         = "cadvisor"
+	ExporterKubeStateMetrics = "kube-state-metrics"
+)
+
+// CannedQuery is a PromQL query the UI runs by ID instead of embedding PromQL. Its series are per
+// pod, narrowed to a namespace or pod by QueryParams.
+type CannedQuery struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Unit of the values: count, ratio, bytes, cores or per-second
+	Unit string `json:"unit"`
+	// Exporter the series come from, the query returns nothing when it isn't scraped
+	Exporter string `json:"exporter"`
+	// expr builds the query from the selector matchers and the range of the window, e.g. [300s]
+	expr func(matchers []string, window string) string
+}
+
+// QueryParams narrow a canned query
+type QueryParams struct {
+	Namespace string
+	Pod       string
+	// Window defaults to DefaultWindow
+	Window time.Duration
+}
+
+var cannedQueries = []CannedQuery{
+	{
+		ID:          "pod-restarts",
+		Title:       "Pod restarts",
+		Description: "Container restarts of each pod over the window",
+		Unit:        "count",
+		Exporter:    ExporterKubeStateMetrics,
+		expr: func(matchers []string, window string) string {
+			return fmt.Sprintf("sum by (namespace, pod) (increase(%s%s))", selector("kube_pod_container_status_restarts_total", matchers), window)
+		},
+	},
+	{
+		ID:          "cpu-throttling",
+		Title:       "CPU throttling",
+		Description: "Share of the CPU periods each pod was throttled in, because of its CPU limits",
+		Unit:        "ratio",
+		Exporter:    ExporterCAdvisor,
+		expr: func(matchers []string, window string) string {
+			matchers = append(matchers, `container!=""`)
+			return fmt.Sprintf("sum by (namespace, pod) (increase(%s%s)) / sum by (namespace, pod) (increase(%s%s))",
+				selector("container_cpu_cfs_throttled_periods_total", matchers), window,
+				selector("container_cpu_cfs_periods_total", matchers), window)
+		},
+	},
+	{
+		ID:          "network-errors",
+		Title:       "Network errors",
+		Description: "Receive and transmit errors per second of the network interfaces of each pod",
+		Unit:        "per-second",
+		Exporter:    ExporterCAdvisor,
+		expr: func(matchers []string, window string) string {
+			return fmt.Sprintf("sum by (namespace, pod) (rate(%s%s)) + sum by (namespace, pod) (rate(%s%s))",
+				selector("container_network_receive_errors_total", matchers), window,
+				selector("container_network_transmit_errors_total", matchers), window)
+		},
+	},
+	{
+		ID:          "cpu-usage",
+		Title:       "CPU usage",
+		Description: "CPU cores used by each pod, averaged over the window",
+		Unit:        "cores",
+		Exporter:    ExporterCAdvisor,
+		expr: func(matchers []string, window string) string {
+			matchers = append(matchers, `container!=""`)
+			return fmt.Sprintf("sum by (namespace, pod) (rate(%s%s))", selector("container_cpu_usage_seconds_total", matchers), window)
+		},
+	},
+	{
+		ID:          "memory-usage",
+		Title:       "Memory usage",
+		Description: "Working set memory of each pod, what the OOM killer compares with memory limits",
+		Unit:        "bytes",
+		Exporter:    ExporterCAdvisor,
+		expr: func(matchers []string, window string) string {
+			matchers = append(matchers, `container!=""`)
+			return fmt.Sprintf("sum by (namespace, pod) (%s)", selector("container_memory_working_set_bytes", matchers))
+		},
+	},
+}
+
+// CannedQueries returns the canned queries
+func CannedQueries() []CannedQuery {
+	return append([]CannedQuery{}, cannedQueries...)
+}
+
+// RenderQuery returns a canned query and its PromQL narrowed by the params
+func RenderQuery(id string, params QueryParams) (*CannedQuery, string, error) {
+	var query *CannedQuery
+	for i := range cannedQueries {
+		if cannedQueries[i].ID == id {
+			query = &cannedQueries[i]
+			break
+		}
+	}
+	if query == nil {
+		return nil, "", fmt.Errorf("%w: unknown canned query %q", ErrInvalidQuery, id)
+	}
+
+	var matchers []string
+	if params.Namespace != "" {
+		if errs := validation.IsDNS1123Label(params.Namespace); len(errs) > 0 {
+			return nil, "", fmt.Errorf("%w: namespace %q: %s", ErrInvalidQuery, params.Namespace, strings.Join(errs, ", "))
+		}
+		matchers = append(matchers, fmt.Sprintf("namespace=%q", params.Namespace))
+	}
+	if params.Pod != "" {
+		if errs := validation.IsDNS1123Subdomain(params.Pod); len(errs) > 0 {
+			return nil, "", fmt.Errorf("%w: pod %q: %s", ErrInvalidQuery, params.Pod, strings.Join(errs, ", "))
+		}
+		matchers = append(matchers, fmt.Sprintf("pod=%q", params.Pod))
+	}
+
+	window := params.Window
+	if window == 0 {
+		window = DefaultWindow
+	}
+	// Prometheus needs at least two samples in the window, scrape intervals are rarely over 30s
+	if window < time.Minute {
+		return nil, "", fmt.Errorf("%w: window must be at least 1m", ErrInvalidQuery)
+	}
+	return query, query.expr(matchers, fmt.Sprintf("[%ds]", int(window.Seconds()))), nil
+}
+
+func selector(metric string, matchers []string) string {
+	return metric + "{" + strings.Join(matchers, ",") + "}"
+}
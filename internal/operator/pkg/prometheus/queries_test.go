@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenderQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		id      string
+		params  QueryParams
+		want    string
+		wantErr error
+	}{
+		{
+			name: "restarts of the cluster",
+			id:   "pod-restarts",
+			want: `sum by (namespace, pod) (increase(kube_pod_container_status_restarts_total{}[300s]))`,
+		},
+		{
+			name:   "throttling of a pod",
+			id:     "cpu-throttling",
+			params: QueryParams{Namespace: "shop", Pod: "api-7d9f", Window: 10 * time.Minute},
+			want: `sum by (namespace, pod) (increase(container_cpu_cfs_throttled_periods_total{namespace="shop",pod="api-7d9f",container!=""}[600s]))` +
+				` / sum by (namespace, pod) (increase(container_cpu_cfs_periods_total{namespace="shop",pod="api-7d9f",container!=""}[600s]))`,
+		},
+		{
+			name:   "memory of a namespace",
+			id:     "memory-usage",
+			params: QueryParams{Namespace: "shop"},
+			want:   `sum by (namespace, pod) (container_memory_working_set_bytes{namespace="shop",container!=""})`,
+		},
+		{name: "unknown query", id: "disk-usage", wantErr: ErrInvalidQuery},
+		{name: "injected namespace", id: "pod-restarts", params: QueryParams{Namespace: `shop"}`}, wantErr: ErrInvalidQuery},
+		{name: "window too short", id: "cpu-usage", params: QueryParams{Window: 30 * time.Second}, wantErr: ErrInvalidQuery},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			query, promQL, err := RenderQuery(tt.id, tt.params)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RenderQuery() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderQuery() error = %v", err)
+			}
+			if query.ID != tt.id || promQL != tt.want {
+				t.Errorf("RenderQuery() = %s %s, want %s", query.ID, promQL, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,741 @@
+package promotion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	trackCandidate = "candidate"
+
+	rolloutTimeout = 10 * time.Minute
+)
+
+// PromotionProcessor runs queued promotion operations
+type PromotionProcessor struct {
+	manager *PromotionManager
+}
+
+// NewPromotionProcessor creates a new promotion processor
+func NewPromotionProcessor(manager *PromotionManager) *PromotionProcessor {
+	return &PromotionProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes promotion operations
+func (p *PromotionProcessor) ProcessOperation(op *utils.Operation) error {
+	switch op.Type {
+	case OperationStart:
+		return p.processStart(op)
+	case OperationFinalize:
+		return p.processFinalize(op)
+	case OperationRollback:
+		return p.processRollback(op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *PromotionProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationStart || operationType == OperationFinalize || operationType == OperationRollback
+}
+
+// processStart records the promotion and hands it to runStart. Promotions wait on rollouts and
+// monitoring windows for minutes, so they run outside the queue workers shared with other operations.
+func (p *PromotionProcessor) processStart(op *utils.Operation) error {
+	req, err := requestFromOperation(op)
+	if err != nil {
+		return utils.NonRetryable(fmt.Errorf("invalid promotion request: %w", err))
+	}
+
+	clientset, err := p.manager.getKubernetesClient(op.Target)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	stable, err := clientset.AppsV1().Deployments(req.Namespace).Get(ctx, req.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %w", req.Namespace, req.Deployment, err)
+	}
+
+	// A retry after a partial start must not record the candidate replicas as the original count
+	if stable.Annotations[StrategyAnnotation] != "" && stable.Annotations[PhaseAnnotation] != PhaseDeploying {
+		return utils.NonRetryable(fmt.Errorf("a promotion is already in progress for %s/%s", req.Namespace, req.Deployment))
+	}
+
+	serviceSelector, err := originalServiceSelector(ctx, clientset, req.Namespace, req.Service)
+	if err != nil {
+		return err
+	}
+	labels, err := candidateLabels(stable, serviceSelector)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	originalReplicas := int32(1)
+	if stable.Spec.Replicas != nil {
+		originalReplicas = *stable.Spec.Replicas
+	}
+	if value, err := strconv.Atoi(stable.Annotations[OriginalReplicasAnnotation]); err == nil {
+		originalReplicas = int32(value)
+	}
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     op.Target,
+		"namespace":   req.Namespace,
+		"deployment":  req.Deployment,
+		"strategy":    req.Strategy,
+		"operationId": op.ID,
+	}, nil, "Starting promotion")
+
+	candidateName := req.Deployment + "-" + trackCandidate
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Recording promotion state", nil)
+	if err := updateDeploymentAnnotations(ctx, clientset, req.Namespace, req.Deployment, map[string]string{
+		StrategyAnnotation:         req.Strategy,
+		CandidateAnnotation:        candidateName,
+		PhaseAnnotation:            PhaseDeploying,
+		WeightAnnotation:           "0",
+		OriginalReplicasAnnotation: strconv.Itoa(int(originalReplicas)),
+		ServiceAnnotation:          req.Service,
+	}); err != nil {
+		return fmt.Errorf("failed to record promotion state: %w", err)
+	}
+
+	go p.runStart(ctx, clientset, op, req, stable, candidateName, labels, originalReplicas)
+	return utils.ErrDetached
+}
+
+// runStart shifts traffic to the candidate and completes the start operation, rolling back on failure
+func (p *PromotionProcessor) runStart(ctx context.Context, clientset *kubernetes.Clientset, op *utils.Operation, req PromotionRequest, stable *appsv1.Deployment, candidateName string, labels map[string]string, originalReplicas int32) {
+	var err error
+	if req.Strategy == StrategyBlueGreen {
+		err = p.startBlueGreen(ctx, clientset, op, req, stable, candidateName, labels, originalReplicas)
+	} else {
+		err = p.startCanary(ctx, clientset, op, req, stable, candidateName, labels, originalReplicas)
+	}
+	if err == nil {
+		return
+	}
+
+	logger.Log(logger.LevelError, map[string]string{
+		"cluster":     op.Target,
+		"namespace":   req.Namespace,
+		"deployment":  req.Deployment,
+		"operationId": op.ID,
+	}, err, "Promotion failed, rolling back")
+
+	if rollbackErr := p.rollback(ctx, clientset, op, req.Namespace, req.Deployment); rollbackErr != nil {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusFailed, 0, "Promotion failed and could not be rolled back",
+			fmt.Errorf("promotion failed: %v, rollback failed: %w", err, rollbackErr))
+		return
+	}
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusFailed, 0, "Promotion rolled back", fmt.Errorf("promotion rolled back: %w", err))
+}
+
+// startBlueGreen brings the candidate up at full size and then switches the service selector to it
+func (p *PromotionProcessor) startBlueGreen(ctx context.Context, clientset *kubernetes.Clientset, op *utils.Operation, req PromotionRequest, stable *appsv1.Deployment, candidateName string, labels map[string]string, replicas int32) error {
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 20, "Pinning service to stable pods", nil)
+	stableHash, err := currentPodTemplateHash(ctx, clientset, stable)
+	if err != nil {
+		return err
+	}
+	if err := p.pinService(ctx, clientset, req.Namespace, req.Service, map[string]string{
+		appsv1.DefaultDeploymentUniqueLabelKey: stableHash,
+	}); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 30, "Creating candidate deployment", nil)
+	if err := createCandidate(ctx, clientset, stable, candidateName, req.Images, labels, replicas); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 50, "Waiting for candidate to become ready", nil)
+	if err := waitForReady(ctx, clientset, req.Namespace, candidateName, replicas); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 70, "Switching service to candidate", nil)
+	if err := p.pinService(ctx, clientset, req.Namespace, req.Service, map[string]string{
+		TrackLabel: trackCandidate,
+	}); err != nil {
+		return err
+	}
+	if err := updateDeploymentAnnotations(ctx, clientset, req.Namespace, req.Deployment, map[string]string{
+		PhaseAnnotation:  PhaseSwitched,
+		WeightAnnotation: "100",
+	}); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 85, "Monitoring candidate", nil)
+	if err := monitorCandidate(ctx, clientset, req.Namespace, candidateName, req.StepIntervalSeconds, req.MaxRestarts); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Traffic switched to candidate, awaiting finalize or rollback", nil)
+	return nil
+}
+
+// startCanary shifts traffic step by step by moving replicas from the stable to the candidate deployment
+func (p *PromotionProcessor) startCanary(ctx context.Context, clientset *kubernetes.Clientset, op *utils.Operation, req PromotionRequest, stable *appsv1.Deployment, candidateName string, labels map[string]string, replicas int32) error {
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 20, "Creating candidate deployment", nil)
+	if err := createCandidate(ctx, clientset, stable, candidateName, req.Images, labels, 0); err != nil {
+		return err
+	}
+
+	for i, weight := range req.Steps {
+		progress := 20 + (i+1)*70/len(req.Steps)
+		candidateReplicas, stableReplicas := splitReplicas(replicas, weight)
+		effective := effectiveWeight(candidateReplicas, stableReplicas)
+
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, progress, fmt.Sprintf("Shifting %d%% of traffic to candidate", effective), nil)
+		if err := updateDeploymentAnnotations(ctx, clientset, req.Namespace, req.Deployment, map[string]string{
+			PhaseAnnotation:  PhaseShifting,
+			WeightAnnotation: strconv.Itoa(effective),
+		}); err != nil {
+			return err
+		}
+
+		// Scale the candidate up before scaling the stable deployment down to keep capacity
+		if err := scaleDeployment(ctx, clientset, req.Namespace, candidateName, candidateReplicas); err != nil {
+			return err
+		}
+		if err := waitForReady(ctx, clientset, req.Namespace, candidateName, candidateReplicas); err != nil {
+			return err
+		}
+		if err := scaleDeployment(ctx, clientset, req.Namespace, req.Deployment, stableReplicas); err != nil {
+			return err
+		}
+
+		if err := monitorCandidate(ctx, clientset, req.Namespace, candidateName, req.StepIntervalSeconds, req.MaxRestarts); err != nil {
+			return fmt.Errorf("candidate unhealthy at %d%%: %w", weight, err)
+		}
+	}
+
+	if err := updateDeploymentAnnotations(ctx, clientset, req.Namespace, req.Deployment, map[string]string{
+		PhaseAnnotation: PhasePromoted,
+	}); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Canary reached final step, awaiting finalize or rollback", nil)
+	return nil
+}
+
+// processFinalize makes the candidate the new stable version and removes it
+func (p *PromotionProcessor) processFinalize(op *utils.Operation) error {
+	namespace, deployment := targetFromOperation(op)
+
+	clientset, err := p.manager.getKubernetesClient(op.Target)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	stable, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %w", namespace, deployment, err)
+	}
+	if stable.Annotations[StrategyAnnotation] == "" {
+		return utils.NonRetryable(fmt.Errorf("no promotion in progress for %s/%s", namespace, deployment))
+	}
+	// A retried finalize finds its own phase
+	if phase := stable.Annotations[PhaseAnnotation]; !canFinalize(phase) && phase != PhaseFinalizing {
+		return utils.NonRetryable(fmt.Errorf("promotion of %s/%s is %s and cannot be finalized yet", namespace, deployment, phase))
+	}
+
+	candidateName := stable.Annotations[CandidateAnnotation]
+	candidate, err := clientset.AppsV1().Deployments(namespace).Get(ctx, candidateName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get candidate deployment %s/%s: %w", namespace, candidateName, err)
+	}
+
+	replicas := originalReplicas(stable)
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 20, "Updating stable deployment to candidate version", nil)
+	if err := updateDeploymentAnnotations(ctx, clientset, namespace, deployment, map[string]string{
+		PhaseAnnotation: PhaseFinalizing,
+	}); err != nil {
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i, container := range current.Spec.Template.Spec.Containers {
+			for _, candidateContainer := range candidate.Spec.Template.Spec.Containers {
+				if candidateContainer.Name == container.Name {
+					current.Spec.Template.Spec.Containers[i].Image = candidateContainer.Image
+				}
+			}
+		}
+		current.Spec.Replicas = &replicas
+		_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update stable deployment: %w", err)
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 50, "Waiting for stable deployment rollout", nil)
+	if err := waitForRollout(ctx, clientset, namespace, deployment); err != nil {
+		return err
+	}
+
+	if err := p.cleanup(ctx, clientset, op, stable); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Promotion finalized", nil)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     op.Target,
+		"namespace":   namespace,
+		"deployment":  deployment,
+		"operationId": op.ID,
+	}, nil, "Promotion finalized")
+
+	return nil
+}
+
+// processRollback discards the candidate and restores the stable version
+func (p *PromotionProcessor) processRollback(op *utils.Operation) error {
+	namespace, deployment := targetFromOperation(op)
+
+	clientset, err := p.manager.getKubernetesClient(op.Target)
+	if err != nil {
+		return err
+	}
+
+	if err := p.rollback(context.Background(), clientset, op, namespace, deployment); err != nil {
+		return err
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Promotion rolled back", nil)
+	return nil
+}
+
+// rollback scales the stable deployment back up before removing the candidate
+func (p *PromotionProcessor) rollback(ctx context.Context, clientset *kubernetes.Clientset, op *utils.Operation, namespace, deployment string) error {
+	if err := updateDeploymentAnnotations(ctx, clientset, namespace, deployment, map[string]string{
+		PhaseAnnotation: PhaseRollingBack,
+	}); err != nil {
+		return err
+	}
+
+	stable, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %w", namespace, deployment, err)
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 40, "Restoring stable replicas", nil)
+	replicas := originalReplicas(stable)
+	if err := scaleDeployment(ctx, clientset, namespace, deployment, replicas); err != nil {
+		return err
+	}
+	if err := waitForReady(ctx, clientset, namespace, deployment, replicas); err != nil {
+		return err
+	}
+
+	return p.cleanup(ctx, clientset, op, stable)
+}
+
+// cleanup restores the service selector, deletes the candidate and clears the promotion state
+func (p *PromotionProcessor) cleanup(ctx context.Context, clientset *kubernetes.Clientset, op *utils.Operation, stable *appsv1.Deployment) error {
+	namespace := stable.Namespace
+
+	if service := stable.Annotations[ServiceAnnotation]; service != "" {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 70, "Restoring service selector", nil)
+		if err := restoreService(ctx, clientset, namespace, service); err != nil {
+			return err
+		}
+	}
+
+	if candidateName := stable.Annotations[CandidateAnnotation]; candidateName != "" {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 80, "Deleting candidate deployment", nil)
+		err := clientset.AppsV1().Deployments(namespace).Delete(ctx, candidateName, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete candidate deployment: %w", err)
+		}
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 90, "Clearing promotion state", nil)
+	return updateDeploymentAnnotations(ctx, clientset, namespace, stable.Name, map[string]string{
+		StrategyAnnotation:         "",
+		CandidateAnnotation:        "",
+		PhaseAnnotation:            "",
+		WeightAnnotation:           "",
+		OriginalReplicasAnnotation: "",
+		ServiceAnnotation:          "",
+	})
+}
+
+// pinService narrows the service selector with extra labels, remembering the original selector
+func (p *PromotionProcessor) pinService(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, extra map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get service %s/%s: %w", namespace, name, err)
+		}
+
+		original := svc.Spec.Selector
+		if raw, ok := svc.Annotations[OriginalSelectorAnnotation]; ok {
+			if err := json.Unmarshal([]byte(raw), &original); err != nil {
+				return fmt.Errorf("invalid original selector on service %s/%s: %w", namespace, name, err)
+			}
+		} else {
+			raw, err := json.Marshal(original)
+			if err != nil {
+				return err
+			}
+			if svc.Annotations == nil {
+				svc.Annotations = map[string]string{}
+			}
+			svc.Annotations[OriginalSelectorAnnotation] = string(raw)
+		}
+
+		selector := map[string]string{}
+		for k, v := range original {
+			selector[k] = v
+		}
+		for k, v := range extra {
+			selector[k] = v
+		}
+		svc.Spec.Selector = selector
+
+		_, err = clientset.CoreV1().Services(namespace).Update(ctx, svc, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// restoreService puts back the selector recorded by pinService
+func restoreService(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to get service %s/%s: %w", namespace, name, err)
+		}
+
+		raw, ok := svc.Annotations[OriginalSelectorAnnotation]
+		if !ok {
+			return nil
+		}
+		var original map[string]string
+		if err := json.Unmarshal([]byte(raw), &original); err != nil {
+			return fmt.Errorf("invalid original selector on service %s/%s: %w", namespace, name, err)
+		}
+		svc.Spec.Selector = original
+		delete(svc.Annotations, OriginalSelectorAnnotation)
+
+		_, err = clientset.CoreV1().Services(namespace).Update(ctx, svc, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// createCandidate duplicates the stable deployment with the new images and a candidate track label
+func createCandidate(ctx context.Context, clientset *kubernetes.Clientset, stable *appsv1.Deployment, name string, images map[string]string, labels map[string]string, replicas int32) error {
+	template := stable.Spec.Template.DeepCopy()
+	template.Labels = labels
+	for i, container := range template.Spec.Containers {
+		if image, ok := images[container.Name]; ok {
+			template.Spec.Containers[i].Image = image
+		}
+	}
+
+	selector := stable.Spec.Selector.DeepCopy()
+	selector.MatchLabels = map[string]string{}
+	for key := range stable.Spec.Selector.MatchLabels {
+		selector.MatchLabels[key] = template.Labels[key]
+	}
+	selector.MatchLabels[TrackLabel] = trackCandidate
+	selector.MatchLabels[PromotionOfLabel] = stable.Name
+
+	candidate := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: stable.Namespace,
+			Labels: map[string]string{
+				PromotionOfLabel: stable.Name,
+				TrackLabel:       trackCandidate,
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: selector,
+			Template: *template,
+			Strategy: stable.Spec.Strategy,
+		},
+	}
+
+	_, err := clientset.AppsV1().Deployments(stable.Namespace).Create(ctx, candidate, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// Left over from a previous attempt, bring it in line with this request
+		return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			existing, err := clientset.AppsV1().Deployments(stable.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			existing.Spec.Replicas = &replicas
+			existing.Spec.Template = *template
+			_, err = clientset.AppsV1().Deployments(stable.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create candidate deployment: %w", err)
+	}
+	return nil
+}
+
+// candidateLabels returns the pod labels of the candidate: the stable labels plus the track and
+// promotion labels. Selector labels the service does not route on get a candidate value so the
+// stable deployment does not select candidate pods. The selectors would overlap if the service
+// routes on every stable selector label, which is rejected.
+func candidateLabels(stable *appsv1.Deployment, serviceSelector map[string]string) (map[string]string, error) {
+	labels := map[string]string{}
+	for key, value := range stable.Spec.Template.Labels {
+		labels[key] = value
+	}
+
+	expressionKeys := map[string]bool{}
+	for _, expression := range stable.Spec.Selector.MatchExpressions {
+		expressionKeys[expression.Key] = true
+	}
+	distinct := false
+	for key, value := range stable.Spec.Selector.MatchLabels {
+		if _, routed := serviceSelector[key]; routed || expressionKeys[key] {
+			continue
+		}
+		labels[key] = value + "-" + trackCandidate
+		distinct = true
+	}
+	if !distinct {
+		return nil, fmt.Errorf("the selector of deployment %s/%s only uses labels the service routes on, add a label to it the service does not select on", stable.Namespace, stable.Name)
+	}
+
+	labels[TrackLabel] = trackCandidate
+	labels[PromotionOfLabel] = stable.Name
+	return labels, nil
+}
+
+// originalServiceSelector returns the selector of a service before the promotion pinned it
+func originalServiceSelector(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (map[string]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service %s/%s: %w", namespace, name, err)
+	}
+	if raw, ok := svc.Annotations[OriginalSelectorAnnotation]; ok {
+		var original map[string]string
+		if err := json.Unmarshal([]byte(raw), &original); err != nil {
+			return nil, fmt.Errorf("invalid original selector on service %s/%s: %w", namespace, name, err)
+		}
+		return original, nil
+	}
+	return svc.Spec.Selector, nil
+}
+
+// currentPodTemplateHash finds the pod-template-hash of the stable deployment's active ReplicaSet
+func currentPodTemplateHash(ctx context.Context, clientset *kubernetes.Clientset, deployment *appsv1.Deployment) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector on deployment %s: %w", deployment.Name, err)
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	revision := deployment.Annotations["deployment.kubernetes.io/revision"]
+	for _, rs := range replicaSets.Items {
+		if !metav1.IsControlledBy(&rs, deployment) {
+			continue
+		}
+		if rs.Annotations["deployment.kubernetes.io/revision"] == revision {
+			if hash := rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" {
+				return hash, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no active replicaset found for deployment %s, wait for its rollout to finish", deployment.Name)
+}
+
+// monitorCandidate watches candidate pods for the given interval and fails on excessive restarts
+func monitorCandidate(ctx context.Context, clientset *kubernetes.Clientset, namespace, candidateName string, intervalSeconds, maxRestarts int) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(intervalSeconds)*time.Second)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(timeoutCtx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s,%s=%s", TrackLabel, trackCandidate, PromotionOfLabel, strings.TrimSuffix(candidateName, "-"+trackCandidate)),
+		})
+		if err != nil {
+			return false, nil
+		}
+
+		restarts := 0
+		for _, pod := range pods.Items {
+			for _, status := range pod.Status.ContainerStatuses {
+				restarts += int(status.RestartCount)
+			}
+		}
+		if restarts > maxRestarts {
+			return false, fmt.Errorf("candidate pods restarted %d times, limit is %d", restarts, maxRestarts)
+		}
+		return false, nil
+	})
+	if err != nil && timeoutCtx.Err() != nil && ctx.Err() == nil {
+		// The monitoring window elapsed without problems
+		return nil
+	}
+	return err
+}
+
+// waitForReady waits until the deployment has the expected number of ready, updated replicas
+func waitForReady(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, replicas int32) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(timeoutCtx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.UpdatedReplicas >= replicas &&
+			deployment.Status.ReadyReplicas >= replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s did not become ready: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// waitForRollout waits until all replicas of the deployment run the latest template
+func waitForRollout(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(timeoutCtx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.UpdatedReplicas == replicas &&
+			deployment.Status.Replicas == replicas &&
+			deployment.Status.AvailableReplicas == replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s did not finish rolling out: %w", namespace, name, err)
+	}
+	return nil
+}
+
+func scaleDeployment(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, replicas int32) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		scale, err := clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get scale of %s/%s: %w", namespace, name, err)
+		}
+		scale.Spec.Replicas = replicas
+		_, err = clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// updateDeploymentAnnotations sets the given annotations, removing those with an empty value
+func updateDeploymentAnnotations(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, annotations map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			if v == "" {
+				delete(deployment.Annotations, k)
+			} else {
+				deployment.Annotations[k] = v
+			}
+		}
+		_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// splitReplicas divides the original replica count between candidate and stable for a traffic weight.
+// Below 100% both keep at least one replica, a single replica deployment runs one of each.
+func splitReplicas(total int32, weight int) (candidate int32, stable int32) {
+	if weight >= 100 {
+		return total, 0
+	}
+	if total < 2 {
+		return 1, 1
+	}
+	candidate = int32((int(total)*weight + 50) / 100)
+	if candidate < 1 {
+		candidate = 1
+	}
+	if candidate > total-1 {
+		candidate = total - 1
+	}
+	return candidate, total - candidate
+}
+
+// effectiveWeight is the share of traffic the candidate receives with the given replicas
+func effectiveWeight(candidate, stable int32) int {
+	if candidate+stable == 0 {
+		return 0
+	}
+	return int(candidate * 100 / (candidate + stable))
+}
+
+func originalReplicas(stable *appsv1.Deployment) int32 {
+	if value, err := strconv.Atoi(stable.Annotations[OriginalReplicasAnnotation]); err == nil {
+		return int32(value)
+	}
+	if stable.Spec.Replicas != nil {
+		return *stable.Spec.Replicas
+	}
+	return 1
+}
+
+func targetFromOperation(op *utils.Operation) (string, string) {
+	namespace, _ := op.Data["namespace"].(string)
+	deployment, _ := op.Data["deployment"].(string)
+	return namespace, deployment
+}
@@ -0,0 +1,360 @@
+package promotion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	StrategyBlueGreen = "bluegreen"
+	StrategyCanary    = "canary"
+
+	OperationStart    = "promotion-start"
+	OperationFinalize = "promotion-finalize"
+	OperationRollback = "promotion-rollback"
+
+	// TrackLabel distinguishes candidate pods from the stable ones
+	TrackLabel = "agentkube.io/track"
+	// PromotionOfLabel links a candidate deployment to the stable deployment it promotes
+	PromotionOfLabel = "agentkube.io/promotion-of"
+
+	// Annotations recording promotion state on the stable deployment and service,
+	// so an in-flight promotion survives operator restarts
+	StrategyAnnotation         = "agentkube.io/promotion-strategy"
+	CandidateAnnotation        = "agentkube.io/promotion-candidate"
+	PhaseAnnotation            = "agentkube.io/promotion-phase"
+	WeightAnnotation           = "agentkube.io/promotion-weight"
+	OriginalReplicasAnnotation = "agentkube.io/promotion-original-replicas"
+	OriginalSelectorAnnotation = "agentkube.io/promotion-original-selector"
+	ServiceAnnotation          = "agentkube.io/promotion-service"
+
+	defaultStepIntervalSeconds = 60
+	defaultMaxRestarts         = 3
+)
+
+// Promotion phases stored in PhaseAnnotation
+const (
+	PhaseDeploying   = "deploying"
+	PhaseShifting    = "shifting"
+	PhaseSwitched    = "switched"
+	PhasePromoted    = "promoted"
+	PhaseFinalizing  = "finalizing"
+	PhaseRollingBack = "rolling-back"
+)
+
+// PromotionManager handles blue/green and canary promotions of plain Deployments.
+// Traffic is shifted with native objects only: blue/green switches the Service
+// selector to the candidate track, canary shifts weight by replica ratio between
+// the stable and candidate deployments behind the same Service.
+type PromotionManager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+}
+
+// PromotionRequest represents a request to start a promotion
+type PromotionRequest struct {
+	Strategy  string `json:"strategy" binding:"required"` // "bluegreen" or "canary"
+	Namespace string `json:"namespace" binding:"required"`
+	// Deployment is the stable deployment being promoted
+	Deployment string `json:"deployment" binding:"required"`
+	// Service routes traffic to the deployment
+	Service string `json:"service" binding:"required"`
+	// Images maps container names to the new image for the candidate
+	Images map[string]string `json:"images" binding:"required"`
+	// Steps are canary traffic weights in percent, e.g. [10, 50, 100]
+	Steps []int `json:"steps,omitempty"`
+	// StepIntervalSeconds is how long each canary step is monitored before moving on
+	StepIntervalSeconds int `json:"stepIntervalSeconds,omitempty"`
+	// MaxRestarts is the number of candidate container restarts that triggers an automatic rollback
+	MaxRestarts int `json:"maxRestarts,omitempty"`
+}
+
+// PromotionStatus represents the current state of a promotion
+type PromotionStatus struct {
+	Namespace        string            `json:"namespace"`
+	Deployment       string            `json:"deployment"`
+	Active           bool              `json:"active"`
+	Strategy         string            `json:"strategy,omitempty"`
+	Phase            string            `json:"phase,omitempty"`
+	Weight           int               `json:"weight"`
+	Candidate        *DeploymentState  `json:"candidate,omitempty"`
+	Stable           DeploymentState   `json:"stable"`
+	Service          string            `json:"service,omitempty"`
+	ServiceSelector  map[string]string `json:"serviceSelector,omitempty"`
+	OriginalReplicas int32             `json:"originalReplicas,omitempty"`
+}
+
+// DeploymentState summarizes a deployment taking part in a promotion
+type DeploymentState struct {
+	Name          string            `json:"name"`
+	Replicas      int32             `json:"replicas"`
+	ReadyReplicas int32             `json:"readyReplicas"`
+	Images        map[string]string `json:"images"`
+}
+
+// NewPromotionManager creates a new promotion manager
+func NewPromotionManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *PromotionManager {
+	return &PromotionManager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+	}
+}
+
+// Start validates the request and queues a promotion start operation
+func (m *PromotionManager) Start(clusterName string, req PromotionRequest) (*utils.Operation, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	clientset, err := m.getKubernetesClient(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	stable, err := clientset.AppsV1().Deployments(req.Namespace).Get(context.Background(), req.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s/%s: %w", req.Namespace, req.Deployment, err)
+	}
+
+	if strategy := stable.Annotations[StrategyAnnotation]; strategy != "" {
+		return nil, fmt.Errorf("a %s promotion is already in progress for %s/%s, finalize or roll it back first", strategy, req.Namespace, req.Deployment)
+	}
+	if pending := m.pendingOperation(clusterName, req.Namespace, req.Deployment); pending != nil {
+		return nil, fmt.Errorf("operation %s is already %s for %s/%s", pending.ID, pending.Status, req.Namespace, req.Deployment)
+	}
+	if stable.Spec.Replicas != nil && *stable.Spec.Replicas == 0 {
+		return nil, fmt.Errorf("deployment %s/%s is scaled to zero, there is no traffic to shift", req.Namespace, req.Deployment)
+	}
+
+	for container := range req.Images {
+		if !hasContainer(stable, container) {
+			return nil, fmt.Errorf("container %q not found in deployment %s/%s", container, req.Namespace, req.Deployment)
+		}
+	}
+
+	op := m.queue.AddOperation(OperationStart, clusterName, "user", map[string]interface{}{
+		"request":    req,
+		"namespace":  req.Namespace,
+		"deployment": req.Deployment,
+	}, []string{"promotion", req.Strategy})
+
+	return op, nil
+}
+
+// Finalize queues an operation that makes the candidate the new stable version
+func (m *PromotionManager) Finalize(clusterName, namespace, deployment string) (*utils.Operation, error) {
+	return m.queueFollowUp(OperationFinalize, clusterName, namespace, deployment)
+}
+
+// Rollback queues an operation that discards the candidate and restores the stable version
+func (m *PromotionManager) Rollback(clusterName, namespace, deployment string) (*utils.Operation, error) {
+	return m.queueFollowUp(OperationRollback, clusterName, namespace, deployment)
+}
+
+func (m *PromotionManager) queueFollowUp(operationType, clusterName, namespace, deployment string) (*utils.Operation, error) {
+	status, err := m.GetStatus(clusterName, namespace, deployment)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Active {
+		return nil, fmt.Errorf("no promotion in progress for %s/%s", namespace, deployment)
+	}
+	// The start operation keeps scaling until it is done, a follow-up must not race with it
+	if pending := m.pendingOperation(clusterName, namespace, deployment); pending != nil {
+		return nil, fmt.Errorf("operation %s is still %s for %s/%s, wait for it to finish", pending.ID, pending.Status, namespace, deployment)
+	}
+	if operationType == OperationFinalize && !canFinalize(status.Phase) {
+		return nil, fmt.Errorf("promotion of %s/%s is %s, it can only be finalized once traffic is switched or the canary is promoted", namespace, deployment, status.Phase)
+	}
+
+	op := m.queue.AddOperation(operationType, clusterName, "user", map[string]interface{}{
+		"namespace":  namespace,
+		"deployment": deployment,
+	}, []string{"promotion", status.Strategy})
+
+	return op, nil
+}
+
+// pendingOperation returns the pending or running promotion operation of a deployment, if any
+func (m *PromotionManager) pendingOperation(clusterName, namespace, deployment string) *utils.Operation {
+	for _, op := range m.queue.ListOperations(map[string]string{"target": clusterName, "tag": "promotion"}) {
+		if op.Status != utils.StatusPending && op.Status != utils.StatusRunning {
+			continue
+		}
+		if opNamespace, opDeployment := targetFromOperation(op); opNamespace == namespace && opDeployment == deployment {
+			return op
+		}
+	}
+	return nil
+}
+
+// canFinalize reports whether a promotion in the given phase has shifted all traffic to the candidate
+func canFinalize(phase string) bool {
+	return phase == PhaseSwitched || phase == PhasePromoted
+}
+
+// GetStatus reads the promotion state recorded on the stable deployment
+func (m *PromotionManager) GetStatus(clusterName, namespace, deployment string) (*PromotionStatus, error) {
+	clientset, err := m.getKubernetesClient(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	stable, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deployment, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s/%s: %w", namespace, deployment, err)
+	}
+
+	status := &PromotionStatus{
+		Namespace:  namespace,
+		Deployment: deployment,
+		Stable:     deploymentState(stable),
+		Strategy:   stable.Annotations[StrategyAnnotation],
+		Phase:      stable.Annotations[PhaseAnnotation],
+		Service:    stable.Annotations[ServiceAnnotation],
+	}
+	status.Active = status.Strategy != ""
+	status.Weight, _ = strconv.Atoi(stable.Annotations[WeightAnnotation])
+
+	if replicas, err := strconv.Atoi(stable.Annotations[OriginalReplicasAnnotation]); err == nil {
+		status.OriginalReplicas = int32(replicas)
+	}
+
+	if candidateName := stable.Annotations[CandidateAnnotation]; candidateName != "" {
+		candidate, err := clientset.AppsV1().Deployments(namespace).Get(ctx, candidateName, metav1.GetOptions{})
+		if err == nil {
+			state := deploymentState(candidate)
+			status.Candidate = &state
+		} else if !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get candidate deployment %s/%s: %w", namespace, candidateName, err)
+		}
+	}
+
+	if status.Service != "" {
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, status.Service, metav1.GetOptions{})
+		if err == nil {
+			status.ServiceSelector = svc.Spec.Selector
+		}
+	}
+
+	return status, nil
+}
+
+// GetQueue returns the operation queue used by the manager
+func (m *PromotionManager) GetQueue() *utils.Queue {
+	return m.queue
+}
+
+// getKubernetesClient creates a kubernetes client for the given cluster
+func (m *PromotionManager) getKubernetesClient(clusterName string) (*kubernetes.Clientset, error) {
+	ctx, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+
+	restConfig, err := ctx.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create REST config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	return clientset, nil
+}
+
+// validate checks the request and fills in defaults
+func (r *PromotionRequest) validate() error {
+	switch r.Strategy {
+	case StrategyBlueGreen:
+	case StrategyCanary:
+		if len(r.Steps) == 0 {
+			r.Steps = []int{10, 50, 100}
+		}
+		last := 0
+		for _, step := range r.Steps {
+			if step <= 0 || step > 100 {
+				return fmt.Errorf("canary steps must be between 1 and 100, got %d", step)
+			}
+			if step <= last {
+				return fmt.Errorf("canary steps must be increasing")
+			}
+			last = step
+		}
+	default:
+		return fmt.Errorf("unsupported strategy %q, expected %q or %q", r.Strategy, StrategyBlueGreen, StrategyCanary)
+	}
+
+	// The candidate labels are chosen so the service selects candidate pods
+	if r.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if len(r.Images) == 0 {
+		return fmt.Errorf("at least one container image is required")
+	}
+	if r.StepIntervalSeconds <= 0 {
+		r.StepIntervalSeconds = defaultStepIntervalSeconds
+	}
+	if r.MaxRestarts <= 0 {
+		r.MaxRestarts = defaultMaxRestarts
+	}
+
+	return nil
+}
+
+// requestFromOperation extracts the promotion request stored in the operation data
+func requestFromOperation(op *utils.Operation) (PromotionRequest, error) {
+	var req PromotionRequest
+	if op.Data == nil {
+		return req, fmt.Errorf("operation has no data")
+	}
+
+	switch v := op.Data["request"].(type) {
+	case PromotionRequest:
+		return v, nil
+	default:
+		// Data may have been round-tripped through JSON
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return req, err
+		}
+		err = json.Unmarshal(raw, &req)
+		return req, err
+	}
+}
+
+func deploymentState(deployment *appsv1.Deployment) DeploymentState {
+	state := DeploymentState{
+		Name:          deployment.Name,
+		ReadyReplicas: deployment.Status.ReadyReplicas,
+		Images:        map[string]string{},
+	}
+	if deployment.Spec.Replicas != nil {
+		state.Replicas = *deployment.Spec.Replicas
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		state.Images[container.Name] = container.Image
+	}
+	return state
+}
+
+func hasContainer(deployment *appsv1.Deployment, name string) bool {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package promotion
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSplitReplicas(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		total     int32
+		weight    int
+		candidate int32
+		stable    int32
+	}{
+		{"single replica keeps stable", 1, 10, 1, 1},
+		{"single replica full weight", 1, 100, 1, 0},
+		{"small step keeps one candidate", 10, 1, 1, 9},
+		{"rounds to nearest", 10, 14, 1, 9},
+		{"rounds half up", 4, 50, 2, 2},
+		{"high step keeps one stable", 3, 90, 2, 1},
+		{"full weight", 5, 100, 5, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			candidate, stable := splitReplicas(tt.total, tt.weight)
+			if candidate != tt.candidate || stable != tt.stable {
+				t.Errorf("splitReplicas(%d, %d) = %d, %d, want %d, %d", tt.total, tt.weight, candidate, stable, tt.candidate, tt.stable)
+			}
+		})
+	}
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		candidate int32
+		stable    int32
+		want      int
+	}{
+		{1, 1, 50},
+		{1, 9, 10},
+		{2, 1, 66},
+		{5, 0, 100},
+		{0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := effectiveWeight(tt.candidate, tt.stable); got != tt.want {
+			t.Errorf("effectiveWeight(%d, %d) = %d, want %d", tt.candidate, tt.stable, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	images := map[string]string{"api": "api:2"}
+	tests := []struct {
+		name    string
+		req     PromotionRequest
+		wantErr bool
+	}{
+		{"blue/green", PromotionRequest{Strategy: StrategyBlueGreen, Service: "api", Images: images}, false},
+		{"canary with default steps", PromotionRequest{Strategy: StrategyCanary, Service: "api", Images: images}, false},
+		{"missing service", PromotionRequest{Strategy: StrategyCanary, Images: images}, true},
+		{"missing images", PromotionRequest{Strategy: StrategyBlueGreen, Service: "api"}, true},
+		{"unknown strategy", PromotionRequest{Strategy: "rolling", Service: "api", Images: images}, true},
+		{"step out of range", PromotionRequest{Strategy: StrategyCanary, Service: "api", Images: images, Steps: []int{10, 120}}, true},
+		{"decreasing steps", PromotionRequest{Strategy: StrategyCanary, Service: "api", Images: images, Steps: []int{50, 10}}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.req.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanFinalize(t *testing.T) {
+	t.Parallel()
+
+	for phase, want := range map[string]bool{
+		PhaseDeploying:   false,
+		PhaseShifting:    false,
+		PhaseSwitched:    true,
+		PhasePromoted:    true,
+		PhaseRollingBack: false,
+	} {
+		if got := canFinalize(phase); got != want {
+			t.Errorf("canFinalize(%q) = %v, want %v", phase, got, want)
+		}
+	}
+}
+
+func TestCandidateLabels(t *testing.T) {
+	t.Parallel()
+
+	deployment := func(selector *metav1.LabelSelector) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: selector,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "api", "version": "v1", "team": "payments"}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		selector        *metav1.LabelSelector
+		serviceSelector map[string]string
+		want            map[string]string
+		wantErr         bool
+	}{
+		{
+			name:            "selector label not routed by service",
+			selector:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api", "version": "v1"}},
+			serviceSelector: map[string]string{"app": "api"},
+			want: map[string]string{
+				"app": "api", "version": "v1-candidate", "team": "payments",
+				TrackLabel: trackCandidate, PromotionOfLabel: "api",
+			},
+		},
+		{
+			name:            "service routes on every selector label",
+			selector:        &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+			serviceSelector: map[string]string{"app": "api"},
+			wantErr:         true,
+		},
+		{
+			name: "label used by a selector expression",
+			selector: &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"app": "api", "version": "v1"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "version", Operator: metav1.LabelSelectorOpIn, Values: []string{"v1"}}},
+			},
+			serviceSelector: map[string]string{"app": "api"},
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := candidateLabels(deployment(tt.selector), tt.serviceSelector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("candidateLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidateLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package pullsecrets
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	OperationSync  = "pullsecret-sync"
+	OperationPurge = "pullsecret-purge"
+
+	// ManagedByLabel marks secrets created by the distribution manager
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "agentkube"
+	// CredentialLabel names the credential a secret was rendered from
+	CredentialLabel = "agentkube.io/registry-credential"
+	// ChecksumAnnotation holds the checksum of the rendered docker config, used for drift detection
+	ChecksumAnnotation = "agentkube.io/registry-credential-checksum"
+
+	storeFileName = "registry-credentials.json"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Credential is a centrally registered registry credential and where it is distributed
+type Credential struct {
+	Name     string `json:"name"`
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// SecretName is the name of the imagePullSecret created in each namespace
+	SecretName string    `json:"secretName,omitempty"`
+	Targets    []Target  `json:"targets"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"createdAt"`
+	RotatedAt  time.Time `json:"rotatedAt"`
+	LastSync   *SyncInfo `json:"lastSync,omitempty"`
+}
+
+// Target selects the namespaces of a cluster that receive the secret
+type Target struct {
+	Cluster string `json:"cluster"`
+	// Namespaces to sync into, empty means every namespace
+	Namespaces []string `json:"namespaces,omitempty"`
+	// PatchServiceAccount adds the secret to the imagePullSecrets of the default service account
+	PatchServiceAccount bool `json:"patchServiceAccount"`
+}
+
+// SyncInfo records the outcome of the last sync
+type SyncInfo struct {
+	Time        time.Time `json:"time"`
+	OperationID string    `json:"operationId"`
+	Version     int       `json:"version"`
+	Synced      int       `json:"synced"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// Manager stores registry credentials and distributes them as imagePullSecrets
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	filePath        string
+	mutex           sync.Mutex
+}
+
+// NewManager creates a new pull secret distribution manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		filePath:        filepath.Join(utils.ConfigDir(), storeFileName),
+	}
+}
+
+// ListCredentials returns all credentials with their passwords redacted
+func (m *Manager) ListCredentials() ([]Credential, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	credentials, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Credential, 0, len(credentials))
+	for _, credential := range credentials {
+		list = append(list, credential.redacted())
+	}
+	return list, nil
+}
+
+// GetCredential returns a credential with its password redacted
+func (m *Manager) GetCredential(name string) (*Credential, error) {
+	credential, err := m.getCredential(name)
+	if err != nil {
+		return nil, err
+	}
+	redacted := credential.redacted()
+	return &redacted, nil
+}
+
+// SaveCredential creates or updates a credential. An empty password keeps the stored one.
+func (m *Manager) SaveCredential(credential Credential) (*Credential, error) {
+	if !namePattern.MatchString(credential.Name) {
+		return nil, fmt.Errorf("credential name must be a valid DNS label")
+	}
+	if credential.Registry == "" || credential.Username == "" {
+		return nil, fmt.Errorf("registry and username are required")
+	}
+	if credential.SecretName == "" {
+		credential.SecretName = "agentkube-" + credential.Name
+	}
+	if !namePattern.MatchString(credential.SecretName) {
+		return nil, fmt.Errorf("secret name must be a valid DNS label")
+	}
+	for _, target := range credential.Targets {
+		if _, err := m.kubeConfigStore.GetContext(target.Cluster); err != nil {
+			return nil, fmt.Errorf("context %s not found: %w", target.Cluster, err)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	credentials, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	existing, exists := credentials[credential.Name]
+	if exists {
+		credential.CreatedAt = existing.CreatedAt
+		credential.LastSync = existing.LastSync
+		credential.Version = existing.Version
+		credential.RotatedAt = existing.RotatedAt
+		if credential.Password == "" {
+			credential.Password = existing.Password
+		} else if credential.Password != existing.Password {
+			credential.Version++
+			credential.RotatedAt = now
+		}
+	} else {
+		if credential.Password == "" {
+			return nil, fmt.Errorf("password is required")
+		}
+		credential.CreatedAt = now
+		credential.RotatedAt = now
+		credential.Version = 1
+	}
+
+	credentials[credential.Name] = &credential
+	if err := m.save(credentials); err != nil {
+		return nil, err
+	}
+
+	// Secrets left behind by a renamed secret or a removed target are purged, the rest is kept
+	if exists && len(existing.Targets) > 0 &&
+		(existing.SecretName != credential.SecretName || !reflect.DeepEqual(existing.Targets, credential.Targets)) {
+		data := map[string]interface{}{"credential": existing.redacted()}
+		if existing.SecretName == credential.SecretName {
+			data["keep"] = credential.redacted()
+		}
+		m.queue.AddOperation(OperationPurge, credential.Name, "user", data, []string{"pull-secrets", credential.Name})
+	}
+
+	redacted := credential.redacted()
+	return &redacted, nil
+}
+
+// Rotate replaces the password of a credential and queues a sync of every target
+func (m *Manager) Rotate(name, password string) (*utils.Operation, error) {
+	if password == "" {
+		return nil, fmt.Errorf("password is required")
+	}
+
+	m.mutex.Lock()
+	credentials, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+	credential, ok := credentials[name]
+	if !ok {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("credential %q not found", name)
+	}
+	credential.Password = password
+	credential.Version++
+	credential.RotatedAt = time.Now()
+	err = m.save(credentials)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Sync(name)
+}
+
+// Sync queues an operation creating or updating the secret in every target namespace
+func (m *Manager) Sync(name string) (*utils.Operation, error) {
+	credential, err := m.getCredential(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(credential.Targets) == 0 {
+		return nil, fmt.Errorf("credential %q has no targets", name)
+	}
+
+	op := m.queue.AddOperation(OperationSync, name, "user", map[string]interface{}{
+		"credential": name,
+	}, []string{"pull-secrets", name})
+	return op, nil
+}
+
+// DeleteCredential removes a credential and queues removal of its secrets from every target
+func (m *Manager) DeleteCredential(name string) (*utils.Operation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	credentials, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	credential, ok := credentials[name]
+	if !ok {
+		return nil, fmt.Errorf("credential %q not found", name)
+	}
+
+	// The purge works from a copy since the credential is gone from the store once it runs
+	op := m.queue.AddOperation(OperationPurge, name, "user", map[string]interface{}{
+		"credential": credential.redacted(),
+	}, []string{"pull-secrets", name})
+
+	delete(credentials, name)
+	if err := m.save(credentials); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// GetQueue returns the operation queue used by the manager
+func (m *Manager) GetQueue() *utils.Queue {
+	return m.queue
+}
+
+func (m *Manager) getCredential(name string) (*Credential, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	credentials, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	credential, ok := credentials[name]
+	if !ok {
+		return nil, fmt.Errorf("credential %q not found", name)
+	}
+	return credential, nil
+}
+
+func (m *Manager) recordSync(name string, info SyncInfo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	credentials, err := m.load()
+	if err != nil {
+		return
+	}
+	if credential, ok := credentials[name]; ok {
+		credential.LastSync = &info
+		m.save(credentials)
+	}
+}
+
+func (m *Manager) load() (map[string]*Credential, error) {
+	credentials := map[string]*Credential{}
+	if err := utils.ReadJSONFile(m.filePath, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (m *Manager) save(credentials map[string]*Credential) error {
+	return utils.WriteJSONFileMode(m.filePath, credentials, 0600)
+}
+
+// dockerConfigJSON renders the .dockerconfigjson payload of the credential
+func (c *Credential) dockerConfigJSON() ([]byte, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+	return json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			c.Registry: map[string]string{
+				"username": c.Username,
+				"password": c.Password,
+				"email":    c.Email,
+				"auth":     auth,
+			},
+		},
+	})
+}
+
+// targetFor returns the target distributing the credential to a namespace of a cluster, if any
+func (c *Credential) targetFor(cluster, namespace string) *Target {
+	if c == nil {
+		return nil
+	}
+	for i, target := range c.Targets {
+		if target.Cluster != cluster {
+			continue
+		}
+		if len(target.Namespaces) == 0 {
+			return &c.Targets[i]
+		}
+		for _, ns := range target.Namespaces {
+			if ns == namespace {
+				return &c.Targets[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (c Credential) redacted() Credential {
+	c.Password = ""
+	return c
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
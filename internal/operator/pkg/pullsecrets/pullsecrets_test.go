@@ -0,0 +1,116 @@
+package pullsecrets
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTargetFor(t *testing.T) {
+	t.Parallel()
+
+	credential := &Credential{Targets: []Target{
+		{Cluster: "dev"},
+		{Cluster: "prod", Namespaces: []string{"shop"}, PatchServiceAccount: true},
+	}}
+
+	tests := []struct {
+		name      string
+		cluster   string
+		namespace string
+		want      *Target
+	}{
+		{"every namespace", "dev", "billing", &credential.Targets[0]},
+		{"listed namespace", "prod", "shop", &credential.Targets[1]},
+		{"unlisted namespace", "prod", "billing", nil},
+		{"other cluster", "staging", "shop", nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := credential.targetFor(tt.cluster, tt.namespace); got != tt.want {
+				t.Errorf("targetFor(%q, %q) = %v, want %v", tt.cluster, tt.namespace, got, tt.want)
+			}
+		})
+	}
+
+	var none *Credential
+	if got := none.targetFor("dev", "shop"); got != nil {
+		t.Errorf("targetFor() on nil credential = %v, want nil", got)
+	}
+}
+
+func TestPurgeNamespace(t *testing.T) {
+	t.Parallel()
+
+	credential := &Credential{Name: "registry", SecretName: "agentkube-registry"}
+	secret := func(namespace, owner string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      credential.SecretName,
+			Namespace: namespace,
+			Labels:    map[string]string{CredentialLabel: owner},
+		}}
+	}
+	serviceAccount := func(namespace string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: namespace},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: credential.SecretName}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		secret        *corev1.Secret
+		kept          *Target
+		wantSecret    bool
+		wantReference bool
+	}{
+		{"own secret", secret("shop", "registry"), nil, false, false},
+		{"secret of another credential", secret("shop", "other"), nil, true, true},
+		{"unlabeled secret", secret("shop", ""), nil, true, true},
+		{"still distributed without patching", secret("shop", "registry"), &Target{Cluster: "dev"}, true, false},
+		{"still distributed and patched", secret("shop", "registry"), &Target{Cluster: "dev", PatchServiceAccount: true}, true, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			client := fake.NewSimpleClientset(tt.secret, serviceAccount("shop"))
+			target := Target{Cluster: "dev", PatchServiceAccount: true}
+			if err := purgeNamespace(ctx, client, credential, target, tt.kept, "shop"); err != nil {
+				t.Fatalf("purgeNamespace() error = %v", err)
+			}
+
+			_, err := client.CoreV1().Secrets("shop").Get(ctx, credential.SecretName, metav1.GetOptions{})
+			if exists := !errors.IsNotFound(err); exists != tt.wantSecret {
+				t.Errorf("secret exists = %v, want %v", exists, tt.wantSecret)
+			}
+			sa, err := client.CoreV1().ServiceAccounts("shop").Get(ctx, "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get service account: %v", err)
+			}
+			if referenced := len(sa.ImagePullSecrets) == 1; referenced != tt.wantReference {
+				t.Errorf("service account references secret = %v, want %v", referenced, tt.wantReference)
+			}
+		})
+	}
+
+	t.Run("missing secret", func(t *testing.T) {
+		t.Parallel()
+
+		client := fake.NewSimpleClientset()
+		if err := purgeNamespace(context.Background(), client, credential, Target{Cluster: "dev"}, nil, "shop"); err != nil {
+			t.Errorf("purgeNamespace() error = %v, want nil", err)
+		}
+	})
+}
@@ -0,0 +1,422 @@
+package pullsecrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Drift states reported per namespace
+const (
+	DriftInSync                = "in-sync"
+	DriftMissing               = "missing"
+	DriftModified              = "modified"
+	DriftServiceAccountMissing = "service-account-unpatched"
+	DriftError                 = "error"
+)
+
+// DriftReport compares the secrets in the clusters with the registered credential
+type DriftReport struct {
+	Credential string           `json:"credential"`
+	Version    int              `json:"version"`
+	InSync     bool             `json:"inSync"`
+	Namespaces []NamespaceDrift `json:"namespaces"`
+	Summary    map[string]int   `json:"summary"`
+}
+
+// NamespaceDrift is the drift state of the secret in one namespace
+type NamespaceDrift struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	State     string `json:"state"`
+	Message   string `json:"message,omitempty"`
+}
+
+// SyncProcessor executes pull secret sync and purge operations
+type SyncProcessor struct {
+	manager *Manager
+}
+
+// NewSyncProcessor creates a new pull secret sync processor
+func NewSyncProcessor(manager *Manager) *SyncProcessor {
+	return &SyncProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes pull secret operations
+func (p *SyncProcessor) ProcessOperation(op *utils.Operation) error {
+	switch op.Type {
+	case OperationSync:
+		return p.processSync(op)
+	case OperationPurge:
+		return p.processPurge(op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *SyncProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationSync || operationType == OperationPurge
+}
+
+// processSync creates or updates the secret in every target namespace
+func (p *SyncProcessor) processSync(op *utils.Operation) error {
+	name, _ := op.Data["credential"].(string)
+	credential, err := p.manager.getCredential(name)
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+
+	payload, err := credential.dockerConfigJSON()
+	if err != nil {
+		return utils.NonRetryable(fmt.Errorf("failed to render docker config: %w", err))
+	}
+
+	ctx := context.Background()
+	info := SyncInfo{OperationID: op.ID, Version: credential.Version}
+	for i, target := range credential.Targets {
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10+80*i/len(credential.Targets),
+			fmt.Sprintf("Syncing secret %s to cluster %s", credential.SecretName, target.Cluster), nil)
+
+		if err := readonly.Check(target.Cluster); err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("%s: %v", target.Cluster, err))
+			continue
+		}
+		clientset, namespaces, err := p.resolveTarget(ctx, target)
+		if err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("%s: %v", target.Cluster, err))
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			if err := applySecret(ctx, clientset, credential, namespace, payload); err != nil {
+				info.Errors = append(info.Errors, fmt.Sprintf("%s/%s: %v", target.Cluster, namespace, err))
+				continue
+			}
+			if target.PatchServiceAccount {
+				if err := patchServiceAccount(ctx, clientset, namespace, credential.SecretName); err != nil {
+					info.Errors = append(info.Errors, fmt.Sprintf("%s/%s: failed to patch service account: %v", target.Cluster, namespace, err))
+					continue
+				}
+			}
+			info.Synced++
+		}
+	}
+
+	info.Time = time.Now()
+	p.manager.recordSync(name, info)
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"credential":  name,
+		"synced":      fmt.Sprintf("%d", info.Synced),
+		"errors":      fmt.Sprintf("%d", len(info.Errors)),
+		"operationId": op.ID,
+	}, nil, "Pull secret sync finished")
+
+	if len(info.Errors) > 0 {
+		return fmt.Errorf("failed to sync %d namespaces: %s", len(info.Errors), info.Errors[0])
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("Synced %d namespaces", info.Synced), nil)
+	return nil
+}
+
+// processPurge removes the secrets of a deleted credential, or those a changed credential no longer
+// distributes. Namespaces the changed credential still covers, given as "keep", are left alone.
+func (p *SyncProcessor) processPurge(op *utils.Operation) error {
+	credential, err := credentialFromOperation(op, "credential")
+	if err != nil {
+		return utils.NonRetryable(err)
+	}
+	var keep *Credential
+	if _, ok := op.Data["keep"]; ok {
+		if keep, err = credentialFromOperation(op, "keep"); err != nil {
+			return utils.NonRetryable(err)
+		}
+	}
+
+	ctx := context.Background()
+	var failures []string
+	for _, target := range credential.Targets {
+		if err := readonly.Check(target.Cluster); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", target.Cluster, err))
+			continue
+		}
+		clientset, namespaces, err := p.resolveTarget(ctx, target)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", target.Cluster, err))
+			continue
+		}
+		for _, namespace := range namespaces {
+			if err := purgeNamespace(ctx, clientset, credential, target, keep.targetFor(target.Cluster, namespace), namespace); err != nil {
+				failures = append(failures, fmt.Sprintf("%s/%s: %v", target.Cluster, namespace, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to purge %d namespaces: %s", len(failures), failures[0])
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "Removed distributed secrets", nil)
+	return nil
+}
+
+// purgeNamespace removes the secret of a credential from a namespace and unpatches the default
+// service account. Secrets not labeled with the credential were not created by it and are kept.
+// kept is the target that still distributes the same secret to the namespace, if any.
+func purgeNamespace(ctx context.Context, clientset kubernetes.Interface, credential *Credential, target Target, kept *Target, namespace string) error {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, credential.SecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if secret.Labels[CredentialLabel] != credential.Name {
+		return nil
+	}
+
+	if target.PatchServiceAccount && (kept == nil || !kept.PatchServiceAccount) {
+		if err := unpatchServiceAccount(ctx, clientset, namespace, credential.SecretName); err != nil {
+			return err
+		}
+	}
+	if kept != nil {
+		return nil
+	}
+
+	// The precondition keeps a secret recreated meanwhile by someone else
+	err = clientset.CoreV1().Secrets(namespace).Delete(ctx, credential.SecretName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &secret.UID},
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// DetectDrift compares every target namespace with the registered credential
+func (m *Manager) DetectDrift(name string) (*DriftReport, error) {
+	credential, err := m.getCredential(name)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := credential.dockerConfigJSON()
+	if err != nil {
+		return nil, err
+	}
+	expected := checksum(payload)
+
+	report := &DriftReport{
+		Credential: name,
+		Version:    credential.Version,
+		Namespaces: []NamespaceDrift{},
+		Summary:    map[string]int{},
+	}
+
+	ctx := context.Background()
+	processor := &SyncProcessor{manager: m}
+	for _, target := range credential.Targets {
+		clientset, namespaces, err := processor.resolveTarget(ctx, target)
+		if err != nil {
+			report.Namespaces = append(report.Namespaces, NamespaceDrift{
+				Cluster: target.Cluster, State: DriftError, Message: err.Error(),
+			})
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			drift := NamespaceDrift{Cluster: target.Cluster, Namespace: namespace, State: DriftInSync}
+
+			secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, credential.SecretName, metav1.GetOptions{})
+			switch {
+			case errors.IsNotFound(err):
+				drift.State = DriftMissing
+			case err != nil:
+				drift.State = DriftError
+				drift.Message = err.Error()
+			case !bytes.Equal(secret.Data[corev1.DockerConfigJsonKey], payload) || secret.Annotations[ChecksumAnnotation] != expected:
+				drift.State = DriftModified
+				drift.Message = "secret content differs from the registered credential"
+			case target.PatchServiceAccount:
+				patched, err := serviceAccountReferences(ctx, clientset, namespace, credential.SecretName)
+				if err != nil {
+					drift.State = DriftError
+					drift.Message = err.Error()
+				} else if !patched {
+					drift.State = DriftServiceAccountMissing
+				}
+			}
+
+			report.Summary[drift.State]++
+			report.Namespaces = append(report.Namespaces, drift)
+		}
+	}
+
+	report.InSync = report.Summary[DriftInSync] == len(report.Namespaces)
+	return report, nil
+}
+
+// resolveTarget creates a client for the target cluster and expands its namespaces
+func (p *SyncProcessor) resolveTarget(ctx context.Context, target Target) (*kubernetes.Clientset, []string, error) {
+	kubeContext, err := p.manager.kubeConfigStore.GetContext(target.Cluster)
+	if err != nil {
+		return nil, nil, fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	if len(target.Namespaces) > 0 {
+		return clientset, target.Namespaces, nil
+	}
+
+	list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	namespaces := make([]string, 0, len(list.Items))
+	for _, ns := range list.Items {
+		if ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		namespaces = append(namespaces, ns.Name)
+	}
+	return clientset, namespaces, nil
+}
+
+// applySecret creates the secret or updates it when its content differs
+func applySecret(ctx context.Context, clientset *kubernetes.Clientset, credential *Credential, namespace string, payload []byte) error {
+	secrets := clientset.CoreV1().Secrets(namespace)
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credential.SecretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				ManagedByLabel:  ManagedByValue,
+				CredentialLabel: credential.Name,
+			},
+			Annotations: map[string]string{
+				ChecksumAnnotation: checksum(payload),
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: payload,
+		},
+	}
+
+	_, err := secrets.Create(ctx, desired, metav1.CreateOptions{})
+	if err == nil || !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := secrets.Get(ctx, credential.SecretName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if existing.Labels[CredentialLabel] != credential.Name {
+			return fmt.Errorf("secret %s/%s exists and is not managed by credential %s", namespace, credential.SecretName, credential.Name)
+		}
+		existing.Data = desired.Data
+		existing.Labels = desired.Labels
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[ChecksumAnnotation] = desired.Annotations[ChecksumAnnotation]
+		_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// patchServiceAccount adds the secret to the imagePullSecrets of the default service account
+func patchServiceAccount(ctx context.Context, clientset *kubernetes.Clientset, namespace, secretName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, "default", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, ref := range sa.ImagePullSecrets {
+			if ref.Name == secretName {
+				return nil
+			}
+		}
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+		_, err = clientset.CoreV1().ServiceAccounts(namespace).Update(ctx, sa, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// unpatchServiceAccount removes the secret from the imagePullSecrets of the default service account
+func unpatchServiceAccount(ctx context.Context, clientset kubernetes.Interface, namespace, secretName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, "default", metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		refs := make([]corev1.LocalObjectReference, 0, len(sa.ImagePullSecrets))
+		for _, ref := range sa.ImagePullSecrets {
+			if ref.Name != secretName {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == len(sa.ImagePullSecrets) {
+			return nil
+		}
+		sa.ImagePullSecrets = refs
+		_, err = clientset.CoreV1().ServiceAccounts(namespace).Update(ctx, sa, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func serviceAccountReferences(ctx context.Context, clientset *kubernetes.Clientset, namespace, secretName string) (bool, error) {
+	sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, "default", metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == secretName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// credentialFromOperation extracts a credential copy stored under key in a purge operation
+func credentialFromOperation(op *utils.Operation, key string) (*Credential, error) {
+	switch v := op.Data[key].(type) {
+	case Credential:
+		return &v, nil
+	default:
+		// Data may have been round-tripped through JSON
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var credential Credential
+		if err := json.Unmarshal(raw, &credential); err != nil {
+			return nil, err
+		}
+		return &credential, nil
+	}
+}
@@ -0,0 +1,108 @@
+package reachability
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteCSV writes one row per pair of workloads, for spreadsheets
+func WriteCSV(w io.Writer, matrix *Matrix) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"from", "to", "allowed", "ports", "policies", "reason"}); err != nil {
+		return err
+	}
+	for _, entry := range matrix.Entries {
+		ports := "all"
+		if len(entry.Ports) > 0 {
+			ports = strings.Join(entry.Ports, " ")
+		}
+		record := []string{entry.From, entry.To, fmt.Sprint(entry.Allowed), ports, strings.Join(entry.Policies, " "), entry.Reason}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteMarkdown writes the matrix as a grid of sources by destinations followed by the blocked
+// pairs and the policies involved, for review meetings
+func WriteMarkdown(w io.Writer, matrix *Matrix) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Network reachability of %s\n\n", strings.Join(matrix.Namespaces, ", "))
+	if matrix.Cluster != "" {
+		fmt.Fprintf(&b, "Cluster: %s\n\n", matrix.Cluster)
+	}
+	fmt.Fprintf(&b, "%d allowed and %d blocked pairs between %d workloads. Rows are sources, columns destinations.\n\n",
+		matrix.Allowed, matrix.Blocked, len(matrix.Workloads))
+
+	if len(matrix.Workloads) > 0 {
+		b.WriteString("| from \\ to |")
+		for i := range matrix.Workloads {
+			fmt.Fprintf(&b, " %d |", i+1)
+		}
+		b.WriteString("\n|---|")
+		b.WriteString(strings.Repeat("---|", len(matrix.Workloads)))
+		b.WriteString("\n")
+
+		entries := map[string]Entry{}
+		for _, entry := range matrix.Entries {
+			entries[entry.From+"\x00"+entry.To] = entry
+		}
+		for i, from := range matrix.Workloads {
+			fmt.Fprintf(&b, "| %d. %s |", i+1, escape(from.ID))
+			for _, to := range matrix.Workloads {
+				entry := entries[from.ID+"\x00"+to.ID]
+				switch {
+				case !entry.Allowed:
+					b.WriteString(" blocked |")
+				case len(entry.Ports) > 0:
+					fmt.Fprintf(&b, " %s |", escape(strings.Join(entry.Ports, ", ")))
+				default:
+					b.WriteString(" allowed |")
+				}
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Workloads\n\n| workload | pods | services | ingress isolated | egress isolated |\n|---|---|---|---|---|\n")
+	for _, workload := range matrix.Workloads {
+		fmt.Fprintf(&b, "| %s | %d | %s | %s | %s |\n", escape(workload.ID), workload.Pods,
+			escape(strings.Join(workload.Services, ", ")), yesNo(workload.IngressIsolated), yesNo(workload.EgressIsolated))
+	}
+
+	b.WriteString("\n## Blocked\n\n")
+	blocked := false
+	for _, entry := range matrix.Entries {
+		if entry.Allowed {
+			continue
+		}
+		blocked = true
+		fmt.Fprintf(&b, "- %s → %s: %s", entry.From, entry.To, entry.Reason)
+		if len(entry.Policies) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(entry.Policies, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if !blocked {
+		b.WriteString("Nothing is blocked.\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,457 @@
+package reachability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ErrInvalidRequest is returned when no namespace is selected or a selected namespace doesn't exist
+var ErrInvalidRequest = errors.New("invalid reachability request")
+
+// Analyzer computes the effective reachability between workloads from NetworkPolicies
+type Analyzer struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// Workload is a group of pods sharing an owner, a row and a column of the matrix
+type Workload struct {
+	// ID is namespace/kind/name
+	ID        string   `json:"id"`
+	Namespace string   `json:"namespace"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Pods      int      `json:"pods"`
+	Services  []string `json:"services"`
+	// IngressIsolated and EgressIsolated are set when policies select the workload for a direction,
+	// only the traffic they allow passes in that direction
+	IngressIsolated bool `json:"ingressIsolated"`
+	EgressIsolated  bool `json:"egressIsolated"`
+
+	labels          map[string]string
+	namespaceLabels map[string]string
+}
+
+// Entry is the reachability of a workload from another
+type Entry struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Allowed bool   `json:"allowed"`
+	// Ports the traffic is allowed on, empty for every port
+	Ports []string `json:"ports,omitempty"`
+	// Policies are the policies allowing the traffic, or the isolating policies blocking it
+	Policies []string `json:"policies"`
+	Reason   string   `json:"reason"`
+}
+
+// Matrix is the reachability between every pair of workloads of the selected namespaces
+type Matrix struct {
+	Cluster    string     `json:"cluster"`
+	Namespaces []string   `json:"namespaces"`
+	Workloads  []Workload `json:"workloads"`
+	Entries    []Entry    `json:"entries"`
+	Allowed    int        `json:"allowed"`
+	Blocked    int        `json:"blocked"`
+}
+
+// namespaceState is what the matrix is computed from in a namespace
+type namespaceState struct {
+	namespace corev1.Namespace
+	pods      []corev1.Pod
+	policies  []networkingv1.NetworkPolicy
+	services  []corev1.Service
+}
+
+// NewAnalyzer creates a new reachability analyzer
+func NewAnalyzer(kubeConfigStore kubeconfig.ContextStore) *Analyzer {
+	return &Analyzer{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// Compute returns the reachability matrix of the workloads of the namespaces. Only pod to pod
+// traffic is covered, ipBlock peers are ignored.
+func (a *Analyzer) Compute(ctx context.Context, clusterName string, namespaces []string) (*Matrix, error) {
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("%w: at least one namespace is required", ErrInvalidRequest)
+	}
+
+	kubeContext, err := a.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	states := []namespaceState{}
+	replicaSetOwners := map[string]string{}
+	for _, name := range namespaces {
+		namespace, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: namespace %s not found", ErrInvalidRequest, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace %s: %v", name, err)
+		}
+		pods, err := clientset.CoreV1().Pods(name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in %s: %v", name, err)
+		}
+		policies, err := clientset.NetworkingV1().NetworkPolicies(name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list network policies in %s: %v", name, err)
+		}
+		services, err := clientset.CoreV1().Services(name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services in %s: %v", name, err)
+		}
+		owners, err := utils.ReplicaSetOwners(ctx, clientset, name)
+		if err != nil {
+			return nil, err
+		}
+		for key, owner := range owners {
+			replicaSetOwners[key] = owner
+		}
+		states = append(states, namespaceState{
+			namespace: *namespace,
+			pods:      pods.Items,
+			policies:  policies.Items,
+			services:  services.Items,
+		})
+	}
+
+	matrix := compute(states, replicaSetOwners)
+	matrix.Cluster = clusterName
+	return matrix, nil
+}
+
+// compute builds the matrix of the namespaces
+func compute(states []namespaceState, replicaSetOwners map[string]string) *Matrix {
+	matrix := &Matrix{Namespaces: []string{}, Workloads: []Workload{}, Entries: []Entry{}}
+	policies := map[string][]networkingv1.NetworkPolicy{}
+
+	for _, state := range states {
+		namespace := state.namespace.Name
+		matrix.Namespaces = append(matrix.Namespaces, namespace)
+		policies[namespace] = state.policies
+		namespaceLabels := map[string]string{corev1.LabelMetadataName: namespace}
+		for key, value := range state.namespace.Labels {
+			namespaceLabels[key] = value
+		}
+
+		workloads := map[string]*Workload{}
+		for i := range state.pods {
+			pod := &state.pods[i]
+			if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed || pod.Spec.HostNetwork {
+				continue
+			}
+			kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+			id := namespace + "/" + kind + "/" + name
+			workload, ok := workloads[id]
+			if !ok {
+				// The pods of a workload share the labels of its template
+				workload = &Workload{
+					ID: id, Namespace: namespace, Kind: kind, Name: name,
+					Services: []string{}, labels: pod.Labels, namespaceLabels: namespaceLabels,
+				}
+				workloads[id] = workload
+			}
+			workload.Pods++
+		}
+
+		for _, workload := range workloads {
+			for _, service := range state.services {
+				if len(service.Spec.Selector) > 0 && labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(workload.labels)) {
+					workload.Services = append(workload.Services, service.Name)
+				}
+			}
+			sort.Strings(workload.Services)
+			workload.IngressIsolated = len(selecting(state.policies, workload, networkingv1.PolicyTypeIngress)) > 0
+			workload.EgressIsolated = len(selecting(state.policies, workload, networkingv1.PolicyTypeEgress)) > 0
+			matrix.Workloads = append(matrix.Workloads, *workload)
+		}
+	}
+	sort.Slice(matrix.Workloads, func(i, j int) bool { return matrix.Workloads[i].ID < matrix.Workloads[j].ID })
+
+	for i := range matrix.Workloads {
+		for j := range matrix.Workloads {
+			from, to := &matrix.Workloads[i], &matrix.Workloads[j]
+			entry := evaluate(from, to, policies[from.Namespace], policies[to.Namespace])
+			if entry.Allowed {
+				matrix.Allowed++
+			} else {
+				matrix.Blocked++
+			}
+			matrix.Entries = append(matrix.Entries, entry)
+		}
+	}
+	return matrix
+}
+
+// evaluate tells whether from reaches to: the egress policies of from and the ingress policies of
+// to must both allow the traffic
+func evaluate(from, to *Workload, fromPolicies, toPolicies []networkingv1.NetworkPolicy) Entry {
+	entry := Entry{From: from.ID, To: to.ID, Policies: []string{}}
+
+	egress := allowed(fromPolicies, from, to, networkingv1.PolicyTypeEgress)
+	ingress := allowed(toPolicies, to, from, networkingv1.PolicyTypeIngress)
+	switch {
+	case !egress.allowed:
+		entry.Policies = egress.isolating
+		entry.Reason = fmt.Sprintf("egress of %s is isolated and no policy allows %s", from.ID, to.ID)
+	case !ingress.allowed:
+		entry.Policies = ingress.isolating
+		entry.Reason = fmt.Sprintf("ingress of %s is isolated and no policy allows %s", to.ID, from.ID)
+	default:
+		ports, ok := intersect(egress.ports, ingress.ports)
+		if !ok {
+			entry.Policies = append(append(entry.Policies, egress.allowing...), ingress.allowing...)
+			entry.Reason = "the ports allowed for egress and ingress don't overlap"
+			break
+		}
+		entry.Allowed = true
+		entry.Ports = ports
+		entry.Policies = append(append(entry.Policies, egress.allowing...), ingress.allowing...)
+		switch {
+		case len(entry.Policies) == 0:
+			entry.Reason = "no policy isolates either workload"
+		case len(ports) > 0:
+			entry.Reason = "allowed on " + strings.Join(ports, ", ")
+		default:
+			entry.Reason = "allowed on every port"
+		}
+	}
+	sort.Strings(entry.Policies)
+	return entry
+}
+
+// Endpoint is a group of pods sharing their labels, an end of the traffic Evaluate checks
+type Endpoint struct {
+	ID        string
+	Namespace string
+	Labels    map[string]string
+	// NamespaceLabels are the labels of the namespace of the pods, with kubernetes.io/metadata.name
+	NamespaceLabels map[string]string
+}
+
+func (e Endpoint) workload() *Workload {
+	return &Workload{ID: e.ID, Namespace: e.Namespace, labels: e.Labels, namespaceLabels: e.NamespaceLabels}
+}
+
+// Evaluate tells whether the pods of from reach the pods of to, the policies may be of both
+// namespaces
+func Evaluate(from, to Endpoint, policies []networkingv1.NetworkPolicy) Entry {
+	return evaluate(from.workload(), to.workload(), policies, policies)
+}
+
+// Isolating returns the policies selecting the pods of an endpoint for a direction, as namespace/name
+func Isolating(endpoint Endpoint, policies []networkingv1.NetworkPolicy, direction networkingv1.PolicyType) []string {
+	names := []string{}
+	for _, policy := range selecting(policies, endpoint.workload(), direction) {
+		names = append(names, policy.Namespace+"/"+policy.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ingress tells whether the pods of an endpoint accept traffic at all, from any peer: they do when
+// no policy isolates them or an isolating policy has an ingress rule
+func Ingress(to Endpoint, policies []networkingv1.NetworkPolicy) Entry {
+	entry := Entry{To: to.ID, Policies: []string{}}
+	isolating := selecting(policies, to.workload(), networkingv1.PolicyTypeIngress)
+	if len(isolating) == 0 {
+		entry.Allowed = true
+		entry.Reason = "no policy isolates the pods"
+		return entry
+	}
+	for _, policy := range isolating {
+		if len(policy.Spec.Ingress) > 0 {
+			entry.Allowed = true
+			entry.Policies = append(entry.Policies, policy.Namespace+"/"+policy.Name)
+		}
+	}
+	if entry.Allowed {
+		entry.Reason = "only the peers the policies allow reach the pods"
+	} else {
+		for _, policy := range isolating {
+			entry.Policies = append(entry.Policies, policy.Namespace+"/"+policy.Name)
+		}
+		entry.Reason = "ingress of the pods is isolated and no policy allows any traffic"
+	}
+	sort.Strings(entry.Policies)
+	return entry
+}
+
+// verdict is the outcome of the policies of one direction
+type verdict struct {
+	allowed   bool
+	isolating []string
+	allowing  []string
+	// ports is nil when every port is allowed
+	ports []string
+}
+
+// allowed evaluates the policies selecting subject for a direction against peer
+func allowed(policies []networkingv1.NetworkPolicy, subject, peer *Workload, direction networkingv1.PolicyType) verdict {
+	isolating := selecting(policies, subject, direction)
+	if len(isolating) == 0 {
+		return verdict{allowed: true}
+	}
+
+	result := verdict{isolating: []string{}, allowing: []string{}, ports: []string{}}
+	allPorts := false
+	for _, policy := range isolating {
+		result.isolating = append(result.isolating, policy.Namespace+"/"+policy.Name)
+		matched := false
+		if direction == networkingv1.PolicyTypeIngress {
+			for _, rule := range policy.Spec.Ingress {
+				if peersMatch(rule.From, policy.Namespace, peer) {
+					matched = true
+					allPorts = collectPorts(rule.Ports, &result.ports) || allPorts
+				}
+			}
+		} else {
+			for _, rule := range policy.Spec.Egress {
+				if peersMatch(rule.To, policy.Namespace, peer) {
+					matched = true
+					allPorts = collectPorts(rule.Ports, &result.ports) || allPorts
+				}
+			}
+		}
+		if matched {
+			result.allowed = true
+			result.allowing = append(result.allowing, policy.Namespace+"/"+policy.Name)
+		}
+	}
+	if allPorts {
+		result.ports = nil
+	}
+	return result
+}
+
+// selecting returns the policies selecting the workload for a direction
+func selecting(policies []networkingv1.NetworkPolicy, workload *Workload, direction networkingv1.PolicyType) []networkingv1.NetworkPolicy {
+	selected := []networkingv1.NetworkPolicy{}
+	for _, policy := range policies {
+		if policy.Namespace != workload.Namespace || !hasType(policy, direction) {
+			continue
+		}
+		if selectorMatches(&policy.Spec.PodSelector, workload.labels) {
+			selected = append(selected, policy)
+		}
+	}
+	return selected
+}
+
+// hasType tells whether a policy applies to a direction. Without policyTypes policies always apply
+// to ingress and to egress when they have egress rules.
+func hasType(policy networkingv1.NetworkPolicy, direction networkingv1.PolicyType) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return direction == networkingv1.PolicyTypeIngress || len(policy.Spec.Egress) > 0
+	}
+	for _, policyType := range policy.Spec.PolicyTypes {
+		if policyType == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// peersMatch tells whether the peers of a rule include the workload, a rule without peers matches
+// every workload
+func peersMatch(peers []networkingv1.NetworkPolicyPeer, policyNamespace string, workload *Workload) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		switch {
+		case peer.IPBlock != nil:
+			continue
+		case peer.NamespaceSelector != nil:
+			if !selectorMatches(peer.NamespaceSelector, workload.namespaceLabels) {
+				continue
+			}
+		case workload.Namespace != policyNamespace:
+			// A pod selector alone selects pods of the namespace of the policy
+			continue
+		}
+		if peer.PodSelector == nil || selectorMatches(peer.PodSelector, workload.labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectorMatches(selector *metav1.LabelSelector, set map[string]string) bool {
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return parsed.Matches(labels.Set(set))
+}
+
+// collectPorts adds the ports of a rule, returning whether it allows every port
+func collectPorts(ports []networkingv1.NetworkPolicyPort, collected *[]string) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	for _, port := range ports {
+		protocol := corev1.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		value := "*"
+		if port.Port != nil {
+			value = port.Port.String()
+			if port.EndPort != nil {
+				value += fmt.Sprintf("-%d", *port.EndPort)
+			}
+		}
+		formatted := string(protocol) + "/" + value
+		if !contains(*collected, formatted) {
+			*collected = append(*collected, formatted)
+		}
+	}
+	return false
+}
+
+// intersect combines the ports allowed for egress and ingress, nil standing for every port. Ports
+// are compared as written, named ports and ranges only match when spelled the same way.
+func intersect(egress, ingress []string) ([]string, bool) {
+	switch {
+	case egress == nil && ingress == nil:
+		return nil, true
+	case egress == nil:
+		return ingress, true
+	case ingress == nil:
+		return egress, true
+	}
+	ports := []string{}
+	for _, port := range ingress {
+		if contains(egress, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports, len(ports) > 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package reachability
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testPod(namespace, name string, labels map[string]string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func testPolicy(namespace, name string, selector map[string]string, types []networkingv1.PolicyType) networkingv1.NetworkPolicy {
+	return networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selector},
+			PolicyTypes: types,
+		},
+	}
+}
+
+func testNamespaces(policies ...networkingv1.NetworkPolicy) []namespaceState {
+	states := []namespaceState{
+		{
+			namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"team": "shop"}}},
+			pods: []corev1.Pod{
+				testPod("shop", "web", map[string]string{"app": "web"}),
+				testPod("shop", "db", map[string]string{"app": "db"}),
+			},
+			services: []corev1.Service{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "db"}},
+			}},
+		},
+		{
+			namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}},
+			pods:      []corev1.Pod{testPod("monitoring", "prometheus", map[string]string{"app": "prometheus"})},
+		},
+	}
+	for _, policy := range policies {
+		for i := range states {
+			if states[i].namespace.Name == policy.Namespace {
+				states[i].policies = append(states[i].policies, policy)
+			}
+		}
+	}
+	return states
+}
+
+func TestCompute(t *testing.T) {
+	t.Parallel()
+
+	ingress := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt32(5432)
+
+	denyDB := testPolicy("shop", "deny-db", map[string]string{"app": "db"}, ingress)
+
+	allowWeb := testPolicy("shop", "allow-web", map[string]string{"app": "db"}, ingress)
+	allowWeb.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+		From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+		Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+	}}
+
+	allowMonitoring := testPolicy("shop", "allow-monitoring", map[string]string{"app": "db"}, ingress)
+	allowMonitoring.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+		From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: "monitoring"}}}},
+	}}
+
+	denyEgress := testPolicy("monitoring", "deny-egress", map[string]string{}, []networkingv1.PolicyType{networkingv1.PolicyTypeEgress})
+
+	type pair struct{ from, to string }
+	const (
+		web        = "shop/Pod/web"
+		db         = "shop/Pod/db"
+		prometheus = "monitoring/Pod/prometheus"
+	)
+
+	tests := []struct {
+		name     string
+		policies []networkingv1.NetworkPolicy
+		// want lists the entries checked, the others aren't
+		want map[pair]Entry
+	}{
+		{
+			name: "no policies",
+			want: map[pair]Entry{
+				{web, db}:        {Allowed: true, Policies: []string{}},
+				{prometheus, db}: {Allowed: true, Policies: []string{}},
+			},
+		},
+		{
+			name:     "default deny",
+			policies: []networkingv1.NetworkPolicy{denyDB},
+			want: map[pair]Entry{
+				{web, db}: {Policies: []string{"shop/deny-db"}},
+				{db, web}: {Allowed: true, Policies: []string{}},
+			},
+		},
+		{
+			name:     "pod selector with port",
+			policies: []networkingv1.NetworkPolicy{denyDB, allowWeb},
+			want: map[pair]Entry{
+				{web, db}:        {Allowed: true, Ports: []string{"TCP/5432"}, Policies: []string{"shop/allow-web"}},
+				{prometheus, db}: {Policies: []string{"shop/allow-web", "shop/deny-db"}},
+			},
+		},
+		{
+			name:     "namespace selector",
+			policies: []networkingv1.NetworkPolicy{allowMonitoring},
+			want: map[pair]Entry{
+				{prometheus, db}: {Allowed: true, Policies: []string{"shop/allow-monitoring"}},
+				{web, db}:        {Policies: []string{"shop/allow-monitoring"}},
+			},
+		},
+		{
+			name:     "egress isolation",
+			policies: []networkingv1.NetworkPolicy{denyEgress},
+			want: map[pair]Entry{
+				{prometheus, web}: {Policies: []string{"monitoring/deny-egress"}},
+				{web, prometheus}: {Allowed: true, Policies: []string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			matrix := compute(testNamespaces(tt.policies...), nil)
+			if len(matrix.Workloads) != 3 || len(matrix.Entries) != 9 {
+				t.Fatalf("compute() = %d workloads and %d entries, want 3 and 9", len(matrix.Workloads), len(matrix.Entries))
+			}
+			if matrix.Allowed+matrix.Blocked != 9 {
+				t.Errorf("compute() allowed %d + blocked %d, want 9", matrix.Allowed, matrix.Blocked)
+			}
+			entries := map[pair]Entry{}
+			for _, entry := range matrix.Entries {
+				entries[pair{entry.From, entry.To}] = entry
+			}
+			for key, want := range tt.want {
+				got := entries[key]
+				if got.Allowed != want.Allowed || !reflect.DeepEqual(got.Ports, want.Ports) || !reflect.DeepEqual(got.Policies, want.Policies) {
+					t.Errorf("%s -> %s = %+v, want allowed %v, ports %v, policies %v", key.from, key.to, got, want.Allowed, want.Ports, want.Policies)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	t.Parallel()
+
+	matrix := compute(testNamespaces(testPolicy("shop", "deny-db", map[string]string{"app": "db"}, nil)), nil)
+	var db Workload
+	for _, workload := range matrix.Workloads {
+		if workload.ID == "shop/Pod/db" {
+			db = workload
+		}
+	}
+	if !reflect.DeepEqual(db.Services, []string{"db"}) {
+		t.Errorf("db services = %v, want [db]", db.Services)
+	}
+	// Without policyTypes a policy isolates ingress, and egress only with egress rules
+	if !db.IngressIsolated || db.EgressIsolated {
+		t.Errorf("db isolation = ingress %v egress %v, want ingress only", db.IngressIsolated, db.EgressIsolated)
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	matrix := compute(testNamespaces(testPolicy("shop", "deny-db", map[string]string{"app": "db"}, nil)), nil)
+
+	var csv bytes.Buffer
+	if err := WriteCSV(&csv, matrix); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	if lines := strings.Count(csv.String(), "\n"); lines != 10 {
+		t.Errorf("WriteCSV() wrote %d lines, want a header and 9 rows", lines)
+	}
+
+	var markdown bytes.Buffer
+	if err := WriteMarkdown(&markdown, matrix); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	for _, want := range []string{"| from \\ to | 1 | 2 | 3 |", "blocked", "shop/deny-db"} {
+		if !strings.Contains(markdown.String(), want) {
+			t.Errorf("WriteMarkdown() misses %q:\n%s", want, markdown.String())
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package readonly
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/command"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const contextsFileName = "read-only-contexts.json"
+
+var (
+	// ErrReadOnly is returned for mutating operations against a read-only context
+	ErrReadOnly = errors.New("context is read-only")
+	// ErrTargetOverride is returned for kubectl commands that choose their own cluster or credentials
+	ErrTargetOverride = errors.New("kubectl command must not override its target")
+)
+
+var (
+	// execPathPattern matches subresources that run commands in a container, upgraded from GET requests
+	execPathPattern = regexp.MustCompile(`^/api/v1/namespaces/[^/]+/pods/[^/]+/(exec|attach)$`)
+	// reviewPathPattern matches access and token reviews, which are created but change nothing
+	reviewPathPattern = regexp.MustCompile(`^/apis/(authorization|authentication)\.k8s\.io/[^/]+/(namespaces/[^/]+/)?[a-z]+reviews$`)
+)
+
+// readOnlyKubectlVerbs are the kubectl commands that never change a cluster
+var readOnlyKubectlVerbs = map[string]bool{
+	"get": true, "describe": true, "logs": true, "top": true, "explain": true, "events": true,
+	"api-resources": true, "api-versions": true, "version": true, "cluster-info": true,
+	"diff": true, "wait": true, "port-forward": true, "completion": true, "options": true, "help": true,
+}
+
+// readOnlyKubectlSubcommands are the read-only subcommands of otherwise mutating kubectl commands
+var readOnlyKubectlSubcommands = map[string]map[string]bool{
+	"auth":    {"can-i": true, "whoami": true},
+	"rollout": {"status": true, "history": true},
+	"config": {"view": true, "current-context": true, "get-contexts": true, "get-clusters": true,
+		"get-users": true},
+}
+
+// kubectlTargetFlags select the cluster or credentials kubectl runs against, which would let a
+// command escape the context it is checked for
+var kubectlTargetFlags = map[string]bool{
+	"--context": true, "--kubeconfig": true, "--server": true, "-s": true, "--user": true, "--cluster": true,
+}
+
+// kubectlLeadingBoolFlags are the global kubectl flags without a value that may precede the verb
+var kubectlLeadingBoolFlags = map[string]bool{
+	"--insecure-skip-tls-verify": true, "--match-server-version": true, "--warnings-as-errors": true,
+	"--disable-compression": true,
+}
+
+// Store persists the contexts marked read-only
+type Store struct {
+	filePath string
+	mutex    sync.Mutex
+	contexts map[string]bool
+}
+
+var (
+	globalStore *Store
+	storeOnce   sync.Once
+)
+
+// GetStore returns the shared read-only context store
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		globalStore = &Store{
+			filePath: filepath.Join(utils.ConfigDir(), contextsFileName),
+		}
+	})
+	return globalStore
+}
+
+// IsReadOnly reports whether a context is marked read-only
+func IsReadOnly(contextName string) bool {
+	return GetStore().IsReadOnly(contextName)
+}
+
+// Check returns ErrReadOnly when any of the contexts is read-only
+func Check(contextNames ...string) error {
+	var readOnly []string
+	for _, name := range contextNames {
+		if IsReadOnly(name) {
+			readOnly = append(readOnly, name)
+		}
+	}
+	if len(readOnly) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s only allows read operations", ErrReadOnly, strings.Join(readOnly, ", "))
+}
+
+// IsReadOnly reports whether a context is marked read-only
+func (s *Store) IsReadOnly(contextName string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		// Fail closed, a context is better unusable than unexpectedly writable
+		return true
+	}
+	return s.contexts[contextName]
+}
+
+// Set marks or unmarks a context as read-only
+func (s *Store) Set(contextName string, readOnly bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if readOnly {
+		s.contexts[contextName] = true
+	} else {
+		delete(s.contexts, contextName)
+	}
+	return s.save()
+}
+
+// Rename moves the read-only flag of a renamed context
+func (s *Store) Rename(oldName, newName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if !s.contexts[oldName] {
+		return nil
+	}
+	delete(s.contexts, oldName)
+	s.contexts[newName] = true
+	return s.save()
+}
+
+// List returns the read-only contexts
+func (s *Store) List() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(s.contexts))
+	for name := range s.contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load reads the store on first use, the caller must hold the mutex
+func (s *Store) load() error {
+	if s.contexts != nil {
+		return nil
+	}
+	var names []string
+	if err := utils.ReadJSONFile(s.filePath, &names); err != nil {
+		return err
+	}
+	s.contexts = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.contexts[name] = true
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	names := make([]string, 0, len(s.contexts))
+	for name := range s.contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return utils.WriteJSONFile(s.filePath, names)
+}
+
+// IsMutatingRequest reports whether a request proxied to the Kubernetes API may change the cluster
+func IsMutatingRequest(method, path string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return execPathPattern.MatchString(path)
+	case http.MethodPost:
+		return !reviewPathPattern.MatchString(path)
+	}
+	return true
+}
+
+// IsMutatingKubectl reports whether a kubectl command may change the cluster. Unknown commands
+// are treated as mutating, and dry runs of mutating commands as read-only. Unknown flags before
+// the verb may take the next argument as their value, so the verb cannot be trusted after them.
+func IsMutatingKubectl(cmd []string) bool {
+	parsed := command.ParseKubectlArgs(cmd)
+	for _, flag := range parsed.LeadingFlags {
+		if !strings.Contains(flag, "=") && !command.IsKubectlValueFlag(flag) && !kubectlLeadingBoolFlags[flag] {
+			return true
+		}
+	}
+	if parsed.Verb == "" || readOnlyKubectlVerbs[parsed.Verb] {
+		return false
+	}
+	if subcommands, ok := readOnlyKubectlSubcommands[parsed.Verb]; ok && len(parsed.Args) > 0 && subcommands[parsed.Args[0]] {
+		return false
+	}
+	if dryRun, ok := parsed.Flags["--dry-run"]; ok && dryRun != "none" && dryRun != "false" {
+		return false
+	}
+	return true
+}
+
+// CheckKubectlTarget returns ErrTargetOverride when a kubectl command selects its own context,
+// kubeconfig, server or user instead of the context it is run for
+func CheckKubectlTarget(cmd []string) error {
+	parsed := command.ParseKubectlArgs(cmd)
+	var flags []string
+	for flag := range parsed.Flags {
+		if kubectlTargetFlags[flag] {
+			flags = append(flags, flag)
+		}
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	sort.Strings(flags)
+	return fmt.Errorf("%w: %s", ErrTargetOverride, strings.Join(flags, ", "))
+}
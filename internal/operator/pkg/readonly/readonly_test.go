@@ -0,0 +1,103 @@
+package readonly
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsMutatingRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "list pods", method: "GET", path: "/api/v1/namespaces/web/pods", want: false},
+		{name: "exec into pod", method: "GET", path: "/api/v1/namespaces/web/pods/api-0/exec", want: true},
+		{name: "access review", method: "POST", path: "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", want: false},
+		{name: "create deployment", method: "POST", path: "/apis/apps/v1/namespaces/web/deployments", want: true},
+		{name: "patch node", method: "PATCH", path: "/api/v1/nodes/worker-1", want: true},
+		{name: "delete pod", method: "DELETE", path: "/api/v1/namespaces/web/pods/api-0", want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsMutatingRequest(tt.method, tt.path); got != tt.want {
+				t.Errorf("IsMutatingRequest(%s, %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMutatingKubectl(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		command []string
+		want    bool
+	}{
+		{name: "get", command: []string{"kubectl", "get", "pods", "-n", "web"}, want: false},
+		{name: "get with leading flags", command: []string{"kubectl", "-n", "web", "logs", "api-0"}, want: false},
+		{name: "leading flag with inline value", command: []string{"kubectl", "--request-timeout=5s", "get", "pods"}, want: false},
+		{name: "leading boolean flag", command: []string{"kubectl", "--insecure-skip-tls-verify", "get", "pods"}, want: false},
+		{name: "unknown leading flag", command: []string{"kubectl", "--frobnicate", "get", "delete", "ns", "web"}, want: true},
+		{name: "rollout status", command: []string{"kubectl", "rollout", "status", "deploy/api"}, want: false},
+		{name: "rollout restart", command: []string{"kubectl", "rollout", "restart", "deploy/api"}, want: true},
+		{name: "auth can-i", command: []string{"kubectl", "auth", "can-i", "delete", "pods"}, want: false},
+		{name: "apply", command: []string{"kubectl", "apply", "-f", "app.yaml"}, want: true},
+		{name: "apply dry run", command: []string{"kubectl", "apply", "-f", "app.yaml", "--dry-run=server"}, want: false},
+		{name: "apply dry run none", command: []string{"kubectl", "apply", "-f", "app.yaml", "--dry-run=none"}, want: true},
+		{name: "exec", command: []string{"kubectl", "exec", "api-0", "--", "get"}, want: true},
+		{name: "unknown verb", command: []string{"kubectl", "frobnicate"}, want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsMutatingKubectl(tt.command); got != tt.want {
+				t.Errorf("IsMutatingKubectl(%v) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckKubectlTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		command []string
+		wantErr bool
+	}{
+		{name: "no override", command: []string{"kubectl", "get", "pods", "-n", "web"}},
+		{name: "context", command: []string{"kubectl", "--context", "prod", "delete", "pod", "api-0"}, wantErr: true},
+		{name: "context inline", command: []string{"kubectl", "delete", "pod", "api-0", "--context=prod"}, wantErr: true},
+		{name: "kubeconfig", command: []string{"kubectl", "--kubeconfig", "/tmp/admin", "get", "pods"}, wantErr: true},
+		{name: "server", command: []string{"kubectl", "-s", "https://10.0.0.1:6443", "get", "pods"}, wantErr: true},
+		{name: "user", command: []string{"kubectl", "get", "pods", "--user=admin"}, wantErr: true},
+		{name: "flag of the container command", command: []string{"kubectl", "exec", "api-0", "--", "app", "--context", "x"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := CheckKubectlTarget(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckKubectlTarget(%v) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrTargetOverride) {
+				t.Errorf("CheckKubectlTarget(%v) error = %v, want ErrTargetOverride", tt.command, err)
+			}
+		})
+	}
+}
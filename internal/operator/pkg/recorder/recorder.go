@@ -0,0 +1,450 @@
+// Package recorder records the requests the operator sends to a cluster and their responses,
+// sanitized, into bundles that can be attached to bug reports. A bundle replays against a fake
+// cluster seeded with the objects its responses returned, so maintainers see what the canvas and the
+// handlers saw.
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/selfupdate"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	recordingsDirName = "recordings"
+
+	// BundleVersion is the format version of the bundles written by this operator
+	BundleVersion = 1
+
+	defaultMaxEntries   = 2000
+	defaultMaxBodyBytes = 1 << 20
+	maxMaxEntries       = 20000
+	maxMaxBodyBytes     = 16 << 20
+)
+
+var (
+	// ErrNotFound is returned for unknown recordings
+	ErrNotFound = errors.New("recording not found")
+	// ErrAlreadyRecording is returned when starting a second recording of a cluster
+	ErrAlreadyRecording = errors.New("the cluster is already being recorded")
+	// ErrStillRecording is returned when deleting a recording that hasn't been stopped
+	ErrStillRecording = errors.New("the recording is still running")
+	// ErrInvalidBundle is returned when importing a bundle this operator can't read
+	ErrInvalidBundle = errors.New("invalid recording bundle")
+)
+
+// Options limit what a recording keeps
+type Options struct {
+	// MaxEntries is the number of requests recorded, later requests are only counted
+	MaxEntries int `json:"maxEntries,omitempty"`
+	// MaxBodyBytes is the size kept of each request and response body
+	MaxBodyBytes int `json:"maxBodyBytes,omitempty"`
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = defaultMaxEntries
+	}
+	if o.MaxEntries > maxMaxEntries {
+		o.MaxEntries = maxMaxEntries
+	}
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if o.MaxBodyBytes > maxMaxBodyBytes {
+		o.MaxBodyBytes = maxMaxBodyBytes
+	}
+	return o
+}
+
+// Entry is a recorded request and its response
+type Entry struct {
+	Seq             int               `json:"seq"`
+	Time            time.Time         `json:"time"`
+	DurationMs      int64             `json:"durationMs"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	RequestBody     string            `json:"requestBody,omitempty"`
+	Status          int               `json:"status,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBody    string            `json:"responseBody,omitempty"`
+	// Truncated is set when a body was longer than MaxBodyBytes
+	Truncated bool `json:"truncated,omitempty"`
+	// Omitted explains why a body wasn't recorded, e.g. binary content
+	Omitted string `json:"omitted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Bundle is a recording with its entries, the file attached to bug reports
+type Bundle struct {
+	Version         int        `json:"version"`
+	ID              string     `json:"id"`
+	Cluster         string     `json:"cluster"`
+	OperatorVersion string     `json:"operatorVersion,omitempty"`
+	StartedAt       time.Time  `json:"startedAt"`
+	StoppedAt       *time.Time `json:"stoppedAt,omitempty"`
+	Options         Options    `json:"options"`
+	// Dropped counts the requests sent after MaxEntries was reached
+	Dropped int     `json:"dropped,omitempty"`
+	Entries []Entry `json:"entries"`
+}
+
+// Summary describes a recording without its entries
+type Summary struct {
+	ID        string     `json:"id"`
+	Cluster   string     `json:"cluster"`
+	Recording bool       `json:"recording"`
+	StartedAt time.Time  `json:"startedAt"`
+	StoppedAt *time.Time `json:"stoppedAt,omitempty"`
+	Entries   int        `json:"entries"`
+	Dropped   int        `json:"dropped,omitempty"`
+	// Replay is the context replaying the recording, if any
+	Replay string `json:"replay,omitempty"`
+}
+
+func (b *Bundle) summary() Summary {
+	return Summary{
+		ID:        b.ID,
+		Cluster:   b.Cluster,
+		Recording: b.StoppedAt == nil,
+		StartedAt: b.StartedAt,
+		StoppedAt: b.StoppedAt,
+		Entries:   len(b.Entries),
+		Dropped:   b.Dropped,
+	}
+}
+
+// Recorder holds the running recordings, one per cluster, and the stopped ones saved as bundles
+type Recorder struct {
+	dir     string
+	mutex   sync.Mutex
+	active  map[string]*session
+	replays map[string]*replay
+}
+
+var (
+	globalRecorder *Recorder
+	recorderOnce   sync.Once
+)
+
+// GetRecorder returns the shared recorder
+func GetRecorder() *Recorder {
+	recorderOnce.Do(func() {
+		globalRecorder = &Recorder{
+			dir:     filepath.Join(utils.ConfigDir(), recordingsDirName),
+			active:  map[string]*session{},
+			replays: map[string]*replay{},
+		}
+	})
+	return globalRecorder
+}
+
+// Start records the requests sent to a cluster until Stop
+func (r *Recorder) Start(cluster string, opts Options) (Summary, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.active[cluster]; ok {
+		return Summary{}, ErrAlreadyRecording
+	}
+	s := &session{
+		bundle: Bundle{
+			Version:         BundleVersion,
+			ID:              uuid.NewString(),
+			Cluster:         cluster,
+			OperatorVersion: selfupdate.Info().Version,
+			StartedAt:       time.Now(),
+			Options:         opts.withDefaults(),
+			Entries:         []Entry{},
+		},
+		pending: map[*recordingBody]struct{}{},
+	}
+	r.active[cluster] = s
+	return s.bundle.summary(), nil
+}
+
+// Stop ends a recording and saves its bundle. Responses still being read, such as open watches, are
+// recorded as far as they got.
+func (r *Recorder) Stop(id string) (Summary, error) {
+	r.mutex.Lock()
+	var s *session
+	for cluster, candidate := range r.active {
+		if candidate.id() == id {
+			s = candidate
+			delete(r.active, cluster)
+			break
+		}
+	}
+	r.mutex.Unlock()
+	if s == nil {
+		return Summary{}, ErrNotFound
+	}
+
+	bundle := s.stop()
+	if err := utils.WriteJSONFileMode(r.path(bundle.ID), bundle, 0600); err != nil {
+		return Summary{}, err
+	}
+	return bundle.summary(), nil
+}
+
+// List returns the running and saved recordings, newest first
+func (r *Recorder) List() ([]Summary, error) {
+	r.mutex.Lock()
+	summaries := []Summary{}
+	for _, s := range r.active {
+		bundle := s.snapshot()
+		summaries = append(summaries, bundle.summary())
+	}
+	replays := map[string]string{}
+	for id, rp := range r.replays {
+		replays[id] = rp.context
+	}
+	r.mutex.Unlock()
+
+	files, err := os.ReadDir(r.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		bundle, err := r.load(id)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, bundle.summary())
+	}
+
+	for i := range summaries {
+		summaries[i].Replay = replays[summaries[i].ID]
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].StartedAt.After(summaries[j].StartedAt)
+	})
+	return summaries, nil
+}
+
+// Get returns the bundle of a recording, a snapshot of the entries so far while it runs
+func (r *Recorder) Get(id string) (*Bundle, error) {
+	r.mutex.Lock()
+	for _, s := range r.active {
+		if s.id() == id {
+			r.mutex.Unlock()
+			bundle := s.snapshot()
+			return &bundle, nil
+		}
+	}
+	r.mutex.Unlock()
+
+	return r.load(id)
+}
+
+// Delete removes a saved recording
+func (r *Recorder) Delete(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, s := range r.active {
+		if s.id() == id {
+			return ErrStillRecording
+		}
+	}
+	if !validID(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(r.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RetentionSource lists the saved recordings not being replayed for the retention policies
+func (r *Recorder) RetentionSource() retention.Source {
+	return retention.SourceFuncs{
+		ItemsFunc: func(context.Context) ([]retention.Item, error) {
+			summaries, err := r.List()
+			if err != nil {
+				return nil, err
+			}
+			items := []retention.Item{}
+			for _, s := range summaries {
+				if s.Recording || s.Replay != "" {
+					continue
+				}
+				info, err := os.Stat(r.path(s.ID))
+				if err != nil {
+					continue
+				}
+				items = append(items, retention.Item{ID: s.ID, Size: info.Size(), ModTime: info.ModTime()})
+			}
+			return items, nil
+		},
+		DeleteFunc: func(_ context.Context, id string) error {
+			if err := r.Delete(id); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// Import saves a bundle from a bug report under a new id
+func (r *Recorder) Import(bundle *Bundle) (Summary, error) {
+	if bundle.Version < 1 || bundle.Version > BundleVersion {
+		return Summary{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, bundle.Version)
+	}
+	if bundle.Cluster == "" {
+		return Summary{}, fmt.Errorf("%w: cluster is required", ErrInvalidBundle)
+	}
+
+	bundle.ID = uuid.NewString()
+	if bundle.StoppedAt == nil {
+		stoppedAt := bundle.StartedAt
+		if n := len(bundle.Entries); n > 0 {
+			stoppedAt = bundle.Entries[n-1].Time
+		}
+		bundle.StoppedAt = &stoppedAt
+	}
+	if bundle.Entries == nil {
+		bundle.Entries = []Entry{}
+	}
+	if err := utils.WriteJSONFileMode(r.path(bundle.ID), bundle, 0600); err != nil {
+		return Summary{}, err
+	}
+	return bundle.summary(), nil
+}
+
+// session returns the running recording of a cluster
+func (r *Recorder) session(cluster string) *session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.active[cluster]
+}
+
+func (r *Recorder) load(id string) (*Bundle, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	if _, err := os.Stat(r.path(id)); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	bundle := &Bundle{}
+	if err := utils.ReadJSONFile(r.path(id), bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func (r *Recorder) path(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// validID keeps ids from naming files outside the recordings directory
+func validID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
+
+// session is a running recording
+type session struct {
+	mutex   sync.Mutex
+	bundle  Bundle
+	next    int
+	stopped bool
+	// pending are the response bodies still being read
+	pending map[*recordingBody]struct{}
+}
+
+func (s *session) id() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bundle.ID
+}
+
+// reserve numbers a request, it returns false once the recording is full or stopped
+func (s *session) reserve() (int, Options, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return 0, s.bundle.Options, false
+	}
+	if s.next >= s.bundle.Options.MaxEntries {
+		s.bundle.Dropped++
+		return 0, s.bundle.Options, false
+	}
+	s.next++
+	return s.next, s.bundle.Options, true
+}
+
+func (s *session) add(entry Entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.stopped {
+		s.bundle.Entries = append(s.bundle.Entries, entry)
+	}
+}
+
+func (s *session) track(body *recordingBody, open bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if open {
+		s.pending[body] = struct{}{}
+	} else {
+		delete(s.pending, body)
+	}
+}
+
+func (s *session) stop() Bundle {
+	s.mutex.Lock()
+	pending := make([]*recordingBody, 0, len(s.pending))
+	for body := range s.pending {
+		pending = append(pending, body)
+	}
+	s.mutex.Unlock()
+
+	for _, body := range pending {
+		body.finish()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopped = true
+	stoppedAt := time.Now()
+	s.bundle.StoppedAt = &stoppedAt
+	return s.sortedBundle()
+}
+
+func (s *session) snapshot() Bundle {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sortedBundle()
+}
+
+// sortedBundle copies the bundle with its entries in request order, the caller holds the mutex
+func (s *session) sortedBundle() Bundle {
+	bundle := s.bundle
+	bundle.Entries = append([]Entry{}, s.bundle.Entries...)
+	sort.Slice(bundle.Entries, func(i, j int) bool {
+		return bundle.Entries[i].Seq < bundle.Entries[j].Seq
+	})
+	return bundle
+}
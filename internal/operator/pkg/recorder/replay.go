@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/demo"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ErrReplaying is returned when replaying a recording twice
+var ErrReplaying = errors.New("the recording is already being replayed")
+
+// replay is a fake cluster serving the objects of a recording
+type replay struct {
+	server  *demo.Server
+	context string
+}
+
+// ReplayContextName returns the name of the context replaying a recording
+func ReplayContextName(id string) string {
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return "replay-" + id
+}
+
+// Replay serves the objects of a recording from a fake cluster, in the state the recorded responses
+// last showed them, and adds a context for it to the store
+func (r *Recorder) Replay(id string, store kubeconfig.ContextStore) (string, error) {
+	bundle, err := r.Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.replays[id]; ok {
+		return "", ErrReplaying
+	}
+
+	server, err := demo.NewServer(Objects(bundle))
+	if err != nil {
+		return "", err
+	}
+	if err := server.Start(); err != nil {
+		return "", err
+	}
+	name := ReplayContextName(id)
+	if err := store.AddContext(server.Context(name)); err != nil {
+		server.Close()
+		return "", err
+	}
+	r.replays[id] = &replay{server: server, context: name}
+	return name, nil
+}
+
+// StopReplay removes the context replaying a recording and stops its fake cluster
+func (r *Recorder) StopReplay(id string, store kubeconfig.ContextStore) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rp, ok := r.replays[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.replays, id)
+	if err := store.RemoveContext(rp.context); err != nil {
+		rp.server.Close()
+		return err
+	}
+	return rp.server.Close()
+}
+
+// Objects returns the objects of the successful responses of a recording, each in the last state a
+// response showed, without the ones deleted later. Kinds the fake cluster doesn't serve, and bodies
+// cut by the size limit, are left out.
+func Objects(bundle *Bundle) []runtime.Object {
+	state := map[string]runtime.Object{}
+	order := []string{}
+	upsert := func(obj runtime.Object, key string) {
+		if _, ok := state[key]; !ok {
+			order = append(order, key)
+		}
+		state[key] = obj
+	}
+
+	for _, entry := range bundle.Entries {
+		if entry.Status < http.StatusOK || entry.Status >= http.StatusMultipleChoices || entry.ResponseBody == "" {
+			continue
+		}
+
+		if isWatchEntry(entry) {
+			for _, line := range strings.Split(entry.ResponseBody, "\n") {
+				var event struct {
+					Type   string          `json:"type"`
+					Object json.RawMessage `json:"object"`
+				}
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					continue
+				}
+				for _, content := range objectsOf(event.Object) {
+					if obj, key, ok := typed(content); ok {
+						if event.Type == "DELETED" {
+							delete(state, key)
+						} else if event.Type == "ADDED" || event.Type == "MODIFIED" {
+							upsert(obj, key)
+						}
+					}
+				}
+			}
+			continue
+		}
+
+		for _, content := range objectsOf(json.RawMessage(entry.ResponseBody)) {
+			if obj, key, ok := typed(content); ok {
+				if entry.Method == http.MethodDelete {
+					delete(state, key)
+				} else {
+					upsert(obj, key)
+				}
+			}
+		}
+	}
+
+	objects := []runtime.Object{}
+	for _, key := range order {
+		if obj, ok := state[key]; ok {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+func isWatchEntry(entry Entry) bool {
+	query, err := url.ParseQuery(entry.Query)
+	if err != nil {
+		return false
+	}
+	watch := query.Get("watch")
+	return watch == "true" || watch == "1"
+}
+
+// objectsOf returns the object of a response body, or the items of a list with their kind set
+func objectsOf(data json.RawMessage) []map[string]interface{} {
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil
+	}
+	kind, _ := content["kind"].(string)
+	items, isList := content["items"].([]interface{})
+	if !isList || !strings.HasSuffix(kind, "List") {
+		return []map[string]interface{}{content}
+	}
+
+	apiVersion, _ := content["apiVersion"].(string)
+	objects := []map[string]interface{}{}
+	for _, item := range items {
+		if itemContent, ok := item.(map[string]interface{}); ok {
+			if _, ok := itemContent["kind"]; !ok {
+				itemContent["kind"] = strings.TrimSuffix(kind, "List")
+			}
+			if _, ok := itemContent["apiVersion"]; !ok {
+				itemContent["apiVersion"] = apiVersion
+			}
+			objects = append(objects, itemContent)
+		}
+	}
+	return objects
+}
+
+// typed converts an object to its typed form, for the kinds the fake cluster serves
+func typed(content map[string]interface{}) (runtime.Object, string, bool) {
+	u := &unstructured.Unstructured{Object: content}
+	gvk := u.GroupVersionKind()
+	if u.GetName() == "" || !demo.Serves(gvk) {
+		return nil, "", false
+	}
+	obj, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return nil, "", false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj); err != nil {
+		return nil, "", false
+	}
+	return obj, objectKey(gvk, u.GetNamespace(), u.GetName()), true
+}
+
+func objectKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	return gvk.GroupKind().String() + "/" + namespace + "/" + name
+}
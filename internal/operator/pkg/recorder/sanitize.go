@@ -0,0 +1,195 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	redacted = "REDACTED"
+
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// redactedData replaces secret data, still valid base64 so the secrets decode on replay
+var redactedData = base64.StdEncoding.EncodeToString([]byte(redacted))
+
+var (
+	// requestHeaders and responseHeaders are the headers recorded, credentials and cookies never are
+	requestHeaders  = []string{"Accept", "Content-Type", "Upgrade"}
+	responseHeaders = []string{"Content-Type", "Content-Encoding"}
+)
+
+// sensitiveKeys are redacted wherever they hold a string, e.g. in kubeconfigs and token reviews
+var sensitiveKeys = map[string]bool{
+	"token": true, "password": true, "bearerToken": true, "client-key-data": true,
+	"access-token": true, "id-token": true, "refresh-token": true,
+}
+
+func sanitizeHeaders(header http.Header, allowed []string) map[string]string {
+	kept := map[string]string{}
+	for _, name := range allowed {
+		if value := header.Get(name); value != "" {
+			kept[name] = value
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+func sanitizeQuery(query url.Values) string {
+	return query.Encode()
+}
+
+// sanitizeBody returns the recorded form of a body: JSON and YAML with secret data and credentials
+// redacted, text as is, and nothing for binary content, along with whether the body was cut at limit
+// and why it was omitted
+func sanitizeBody(contentType string, body []byte, limit int) (string, bool, string) {
+	if len(body) == 0 {
+		return "", false, ""
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	switch {
+	case strings.Contains(mediaType, "json"):
+		return sanitizeJSON(body, limit)
+	case strings.Contains(mediaType, "yaml"):
+		converted, err := yaml.YAMLToJSON(body)
+		if err != nil {
+			return "", false, "YAML that could not be sanitized"
+		}
+		return sanitizeJSON(converted, limit)
+	case strings.HasPrefix(mediaType, "text/"):
+		text, truncated := cut(string(body), limit)
+		return text, truncated, ""
+	default:
+		return "", false, "binary content " + mediaType
+	}
+}
+
+// sanitizeJSON sanitizes a JSON document, or the lines of a watch stream. Bodies cut by the size
+// limit keep their complete lines, a document that doesn't parse is omitted rather than recorded
+// unsanitized.
+func sanitizeJSON(body []byte, limit int) (string, bool, string) {
+	var document interface{}
+	if err := unmarshal(body, &document); err == nil {
+		data, err := json.Marshal(sanitizeValue(document, false))
+		if err != nil {
+			return "", false, "JSON that could not be sanitized"
+		}
+		text, truncated := cut(string(data), limit)
+		return text, truncated, ""
+	}
+
+	lines := []string{}
+	truncated := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event interface{}
+		if err := unmarshal(line, &event); err != nil {
+			truncated = true
+			break
+		}
+		data, err := json.Marshal(sanitizeValue(event, false))
+		if err != nil {
+			truncated = true
+			break
+		}
+		lines = append(lines, string(data))
+	}
+	if len(lines) == 0 {
+		return "", truncated, "JSON that could not be sanitized"
+	}
+	text, cutText := cut(strings.Join(lines, "\n"), limit)
+	return text, truncated || cutText, ""
+}
+
+// unmarshal decodes a single JSON document, keeping numbers as they were written
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("trailing data after JSON document")
+	}
+	return nil
+}
+
+// sanitizeValue redacts the data of secrets and credential fields, and drops managed fields. secret
+// is set for the items of a secret list, which don't carry their kind.
+func sanitizeValue(v interface{}, secret bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		kind, _ := value["kind"].(string)
+		isSecret := kind == "Secret" || (secret && kind == "")
+
+		if metadata, ok := value["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "managedFields")
+			if annotations, ok := metadata["annotations"].(map[string]interface{}); ok && isSecret {
+				if _, ok := annotations[lastAppliedAnnotation]; ok {
+					annotations[lastAppliedAnnotation] = redacted
+				}
+			}
+		}
+
+		for key, child := range value {
+			switch {
+			case isSecret && (key == "data" || key == "stringData"):
+				value[key] = redactValues(child, key == "data")
+			case sensitiveKeys[key]:
+				if _, ok := child.(string); ok {
+					value[key] = redacted
+				}
+			case key == "items":
+				value[key] = sanitizeValue(child, kind == "SecretList")
+			default:
+				value[key] = sanitizeValue(child, false)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = sanitizeValue(value[i], secret)
+		}
+	}
+	return v
+}
+
+func redactValues(v interface{}, encoded bool) interface{} {
+	values, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for key := range values {
+		if encoded {
+			values[key] = redactedData
+		} else {
+			values[key] = redacted
+		}
+	}
+	return values
+}
+
+func cut(text string, limit int) (string, bool) {
+	if limit > 0 && len(text) > limit {
+		return text[:limit], true
+	}
+	return text, false
+}
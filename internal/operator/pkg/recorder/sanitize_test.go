@@ -0,0 +1,117 @@
+package recorder
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		limit         int
+		want          string
+		wantTruncated bool
+		wantOmitted   bool
+	}{
+		{
+			name:        "secret data is redacted",
+			contentType: "application/json",
+			body:        `{"kind":"Secret","metadata":{"name":"db","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"}},"data":{"password":"aHVudGVyMg=="},"stringData":{"user":"admin"}}`,
+			want:        `{"data":{"password":"UkVEQUNURUQ="},"kind":"Secret","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"REDACTED"},"name":"db"},"stringData":{"user":"REDACTED"}}`,
+		},
+		{
+			name:        "secret list items are redacted",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"kind":"SecretList","items":[{"metadata":{"name":"db"},"data":{"password":"aHVudGVyMg=="}}]}`,
+			want:        `{"items":[{"data":{"password":"UkVEQUNURUQ="},"metadata":{"name":"db"}}],"kind":"SecretList"}`,
+		},
+		{
+			name:        "config map data and numbers are kept, managed fields dropped",
+			contentType: "application/json",
+			body:        `{"kind":"ConfigMap","metadata":{"name":"app","generation":9007199254740993,"managedFields":[{"manager":"kubectl"}]},"data":{"password":"plain"}}`,
+			want:        `{"data":{"password":"REDACTED"},"kind":"ConfigMap","metadata":{"generation":9007199254740993,"name":"app"}}`,
+		},
+		{
+			name:        "watch events are sanitized line by line",
+			contentType: "application/json",
+			body:        "{\"type\":\"ADDED\",\"object\":{\"kind\":\"Secret\",\"data\":{\"k\":\"dg==\"}}}\n{\"type\":\"DELETED\",\"object\":{\"kind\":\"Pod\"}}\n",
+			want:        "{\"object\":{\"data\":{\"k\":\"UkVEQUNURUQ=\"},\"kind\":\"Secret\"},\"type\":\"ADDED\"}\n{\"object\":{\"kind\":\"Pod\"},\"type\":\"DELETED\"}",
+		},
+		{
+			name:          "a cut watch stream keeps its complete events",
+			contentType:   "application/json",
+			body:          "{\"type\":\"ADDED\",\"object\":{\"kind\":\"Pod\"}}\n{\"type\":\"ADDED\",\"obj",
+			want:          `{"object":{"kind":"Pod"},"type":"ADDED"}`,
+			wantTruncated: true,
+		},
+		{
+			name:          "a cut document is omitted",
+			contentType:   "application/json",
+			body:          `{"kind":"Secret","data":{"k":"dg`,
+			wantTruncated: true,
+			wantOmitted:   true,
+		},
+		{
+			name:        "yaml is converted to json",
+			contentType: "application/yaml",
+			body:        "kind: Secret\nstringData:\n  token: abc\n",
+			want:        `{"kind":"Secret","stringData":{"token":"REDACTED"}}`,
+		},
+		{
+			name:          "text is cut at the limit",
+			contentType:   "text/plain",
+			body:          "line one\nline two\n",
+			limit:         8,
+			want:          "line one",
+			wantTruncated: true,
+		},
+		{
+			name:        "binary content is omitted",
+			contentType: "application/vnd.kubernetes.protobuf",
+			body:        "k8s\x00",
+			wantOmitted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, truncated, omitted := sanitizeBody(tt.contentType, []byte(tt.body), tt.limit)
+			if got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if (omitted != "") != tt.wantOmitted {
+				t.Errorf("omitted = %q, want omitted %v", omitted, tt.wantOmitted)
+			}
+		})
+	}
+}
+
+func TestSanitizeHeaders(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("Cookie", "session=secret")
+	header.Set("Accept", "application/json")
+
+	got := sanitizeHeaders(header, requestHeaders)
+	if len(got) != 1 || got["Accept"] != "application/json" {
+		t.Errorf("headers = %v, want only Accept", got)
+	}
+	for _, value := range got {
+		if strings.Contains(value, "secret") {
+			t.Errorf("credentials were recorded: %v", got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package recorder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Wrap is the kubeconfig transport hook recording the requests of clusters with a running recording.
+// Other requests go through untouched.
+func Wrap(contextName string, rt http.RoundTripper) http.RoundTripper {
+	return &recordingRoundTripper{recorder: GetRecorder(), cluster: contextName, next: rt}
+}
+
+type recordingRoundTripper struct {
+	recorder *Recorder
+	cluster  string
+	next     http.RoundTripper
+}
+
+func (t *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.recorder.session(t.cluster)
+	if s == nil {
+		return t.next.RoundTrip(req)
+	}
+	seq, opts, ok := s.reserve()
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	entry := Entry{
+		Seq:            seq,
+		Time:           time.Now(),
+		Method:         req.Method,
+		Path:           req.URL.Path,
+		Query:          sanitizeQuery(req.URL.Query()),
+		RequestHeaders: sanitizeHeaders(req.Header, requestHeaders),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		entry.RequestBody, entry.Truncated, entry.Omitted = sanitizeBody(req.Header.Get("Content-Type"), body, opts.MaxBodyBytes)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		entry.Error = err.Error()
+		s.add(entry)
+		return nil, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeaders = sanitizeHeaders(resp.Header, responseHeaders)
+
+	// Upgraded connections carry exec and port-forward streams, which aren't recorded
+	if resp.StatusCode == http.StatusSwitchingProtocols || resp.Body == nil {
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			entry.Omitted = "upgraded connection"
+		}
+		s.add(entry)
+		return resp, nil
+	}
+
+	body := &recordingBody{ReadCloser: resp.Body, session: s, entry: entry, limit: opts.MaxBodyBytes}
+	s.track(body, true)
+	resp.Body = body
+	return resp, nil
+}
+
+// recordingBody keeps what is read of a response body, the entry is recorded at the end of the body
+// or when it is closed, whichever comes first
+type recordingBody struct {
+	io.ReadCloser
+	session *session
+	limit   int
+
+	mutex     sync.Mutex
+	entry     Entry
+	buf       bytes.Buffer
+	truncated bool
+	done      bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.mutex.Lock()
+	if !b.done && n > 0 {
+		if room := b.limit - b.buf.Len(); room > 0 {
+			if n > room {
+				b.buf.Write(p[:room])
+				b.truncated = true
+			} else {
+				b.buf.Write(p[:n])
+			}
+		} else {
+			b.truncated = true
+		}
+	}
+	b.mutex.Unlock()
+
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+// finish records the entry with the body read so far, once
+func (b *recordingBody) finish() {
+	b.mutex.Lock()
+	if b.done {
+		b.mutex.Unlock()
+		return
+	}
+	b.done = true
+	entry := b.entry
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	body := b.buf.Bytes()
+	if entry.ResponseHeaders["Content-Encoding"] == "gzip" {
+		// Proxied responses keep the encoding the browser asked for, the recording is decompressed
+		body = gunzip(body)
+	}
+	responseBody, truncated, omitted := sanitizeBody(entry.ResponseHeaders["Content-Type"], body, b.limit)
+	entry.ResponseBody = responseBody
+	entry.Truncated = entry.Truncated || truncated || b.truncated
+	if omitted != "" {
+		entry.Omitted = omitted
+	}
+	b.mutex.Unlock()
+
+	b.session.track(b, false)
+	b.session.add(entry)
+}
+
+// gunzip decompresses as much of a possibly truncated gzip body as it can
+func gunzip(data []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	decompressed, _ := io.ReadAll(reader)
+	return decompressed
+}
@@ -0,0 +1,255 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Asciicast v2 event codes
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Header is the first line of an asciicast v2 file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a single asciicast event, serialized in the cast file as [time, code, data]
+type Event struct {
+	Time float64 `json:"time"`
+	Type string  `json:"type"`
+	Data string  `json:"data"`
+}
+
+// Recorder appends the events of one terminal session to its cast file. A nil Recorder is valid
+// and records nothing, so callers do not need to check whether recording is enabled.
+type Recorder struct {
+	manager     *Manager
+	session     Session
+	file        *os.File
+	start       time.Time
+	recordInput bool
+	maxSize     int64
+	// pending holds the bytes of an incomplete UTF-8 sequence per event code
+	pending map[string][]byte
+	mutex   sync.Mutex
+	closed  bool
+}
+
+func newRecorder(manager *Manager, session Session, path string, width, height int, settings Settings) (*Recorder, error) {
+	if width <= 0 || height <= 0 {
+		width, height = defaultWidth, defaultHeight
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %v", err)
+	}
+
+	header, err := json.Marshal(Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: session.StartedAt.Unix(),
+		Title:     session.Title(),
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(append(header, '\n')); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write recording header: %v", err)
+	}
+
+	session.Size = int64(len(header) + 1)
+	return &Recorder{
+		manager:     manager,
+		session:     session,
+		file:        file,
+		start:       session.StartedAt,
+		recordInput: settings.RecordInput,
+		maxSize:     int64(settings.MaxRecordingSizeMB) * 1024 * 1024,
+		pending:     map[string][]byte{},
+	}, nil
+}
+
+// ID returns the recording ID, or an empty string for a nil recorder
+func (r *Recorder) ID() string {
+	if r == nil {
+		return ""
+	}
+	return r.session.ID
+}
+
+// Output records terminal output
+func (r *Recorder) Output(data []byte) {
+	r.write(EventOutput, data)
+}
+
+// Input records keystrokes sent to the terminal when input recording is enabled
+func (r *Recorder) Input(data []byte) {
+	if r == nil || !r.recordInput {
+		return
+	}
+	r.write(EventInput, data)
+}
+
+// Resize records a terminal size change
+func (r *Recorder) Resize(width, height int) {
+	if width <= 0 || height <= 0 {
+		return
+	}
+	r.write(EventResize, []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+func (r *Recorder) write(code string, data []byte) {
+	if r == nil || len(data) == 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || r.session.Truncated {
+		return
+	}
+
+	data = append(r.pending[code], data...)
+	data, r.pending[code] = splitIncompleteRune(data)
+	if len(data) == 0 {
+		return
+	}
+
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, err := json.Marshal([]interface{}{elapsed, code, string(data)})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if r.maxSize > 0 && r.session.Size+int64(len(line)) > r.maxSize {
+		r.session.Truncated = true
+		return
+	}
+	if _, err := r.file.Write(line); err != nil {
+		r.session.Truncated = true
+		return
+	}
+	r.session.Size += int64(len(line))
+}
+
+// Close ends the recording and stores its final metadata. It is safe to call more than once.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	if r.closed {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	err := r.file.Close()
+
+	endedAt := time.Now()
+	r.session.EndedAt = &endedAt
+	r.session.Duration = math.Round(endedAt.Sub(r.start).Seconds()*1000) / 1000
+	session := r.session
+	r.mutex.Unlock()
+
+	if finishErr := r.manager.finish(session); err == nil {
+		err = finishErr
+	}
+	return err
+}
+
+func (r *Recorder) size() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.session.Size
+}
+
+// splitIncompleteRune splits off a trailing incomplete UTF-8 sequence, which is completed by the
+// next chunk of the stream. Recording it as is would replace it with U+FFFD.
+func splitIncompleteRune(data []byte) ([]byte, []byte) {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i], append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+	}
+	return data, nil
+}
+
+// ReadCast parses an asciicast v2 file into its header and events
+func ReadCast(path string) (*Header, []Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("recording is empty")
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("invalid recording header: %v", err)
+	}
+
+	events := []Event{}
+	for line := 2; scanner.Scan(); line++ {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil || len(raw) != 3 {
+			return nil, nil, fmt.Errorf("invalid recording event on line %d", line)
+		}
+		var event Event
+		if err := json.Unmarshal(raw[0], &event.Time); err != nil {
+			return nil, nil, fmt.Errorf("invalid event time on line %d", line)
+		}
+		if err := json.Unmarshal(raw[1], &event.Type); err != nil {
+			return nil, nil, fmt.Errorf("invalid event code on line %d", line)
+		}
+		if err := json.Unmarshal(raw[2], &event.Data); err != nil {
+			return nil, nil, fmt.Errorf("invalid event data on line %d", line)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read recording: %v", err)
+	}
+	return &header, events, nil
+}
+
+// formatSize renders a byte count for log messages
+func formatSize(size int64) string {
+	return strconv.FormatFloat(float64(size)/(1024*1024), 'f', 1, 64) + "MB"
+}
@@ -0,0 +1,151 @@
+package recording
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitIncompleteRune(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		complete string
+		rest     []byte
+	}{
+		{name: "ascii", data: []byte("ls -la\r\n"), complete: "ls -la\r\n"},
+		{name: "complete multibyte", data: []byte("héllo ✓"), complete: "héllo ✓"},
+		{name: "split two byte rune", data: []byte("h\xc3"), complete: "h", rest: []byte{0xc3}},
+		{name: "split three byte rune", data: []byte("ok \xe2\x9c"), complete: "ok ", rest: []byte{0xe2, 0x9c}},
+		{name: "invalid byte is kept", data: []byte("a\xffb"), complete: "a\xffb"},
+		{name: "empty", data: nil, complete: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			complete, rest := splitIncompleteRune(tt.data)
+			if string(complete) != tt.complete {
+				t.Errorf("complete = %q, want %q", complete, tt.complete)
+			}
+			if string(rest) != string(tt.rest) {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	t.Setenv("CONFIG", t.TempDir())
+
+	manager := NewManager()
+	settings := DefaultSettings()
+	settings.Enabled = true
+	settings.RecordInput = true
+	if err := manager.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+
+	recorder, err := manager.StartSession(Session{Cluster: "kind", Namespace: "default", Pod: "web", Container: "app"}, 120, 40)
+	if err != nil || recorder == nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	recorder.Input([]byte("echo ✓\r"))
+	recorder.Output([]byte("\xe2\x9c"))
+	recorder.Output([]byte("\x93\r\n"))
+	recorder.Resize(100, 30)
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	path, err := manager.FilePath(recorder.ID())
+	if err != nil {
+		t.Fatalf("FilePath: %v", err)
+	}
+	header, events, err := ReadCast(path)
+	if err != nil {
+		t.Fatalf("ReadCast: %v", err)
+	}
+	if header.Version != 2 || header.Width != 120 || header.Height != 40 {
+		t.Errorf("header = %+v, want version 2 with a 120x40 terminal", header)
+	}
+
+	want := []Event{
+		{Type: EventInput, Data: "echo ✓\r"},
+		{Type: EventOutput, Data: "✓\r\n"},
+		{Type: EventResize, Data: "100x30"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i].Type != want[i].Type || events[i].Data != want[i].Data {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+
+	session, err := manager.Get(recorder.ID())
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if session.Active || session.EndedAt == nil || session.Size == 0 {
+		t.Errorf("session = %+v, want a finished recording with a size", session)
+	}
+}
+
+func TestStartSessionFailsClosed(t *testing.T) {
+	t.Setenv("CONFIG", t.TempDir())
+
+	manager := NewManager()
+	// A recordings directory below a regular file cannot be created
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	manager.dir = filepath.Join(blocker, "recordings")
+
+	settings := DefaultSettings()
+	settings.Enabled = true
+	if err := manager.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	if _, err := manager.StartSession(Session{Cluster: "kind", Pod: "web"}, 0, 0); err == nil {
+		t.Errorf("StartSession() error = nil, want the session refused")
+	}
+
+	settings.AllowUnrecorded = true
+	if err := manager.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	recorder, err := manager.StartSession(Session{Cluster: "kind", Pod: "web"}, 0, 0)
+	if err != nil || recorder != nil {
+		t.Errorf("StartSession() = %v, %v, want an unrecorded session", recorder, err)
+	}
+}
+
+func TestStartSessionRequested(t *testing.T) {
+	t.Setenv("CONFIG", t.TempDir())
+
+	manager := NewManager()
+	if recorder, err := manager.StartSession(Session{Cluster: "kind", Pod: "web"}, 0, 0); err != nil || recorder != nil {
+		t.Fatalf("StartSession() = %v, %v, want no recording while recording is disabled", recorder, err)
+	}
+
+	recorder, err := manager.StartSession(Session{Cluster: "kind", Pod: "web", Requested: true}, 0, 0)
+	if err != nil || recorder == nil {
+		t.Fatalf("StartSession() = %v, %v, want the requested session recorded", recorder, err)
+	}
+	recorder.Output([]byte("ok\r\n"))
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	session, err := manager.Get(recorder.ID())
+	if err != nil || !session.Requested || session.Active {
+		t.Errorf("Get() = %+v, %v, want a finished requested recording", session, err)
+	}
+}
@@ -0,0 +1,594 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/storage"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	recordingsDirName = "recordings"
+	indexFileName     = "recordings.json"
+	settingsFileName  = "recording-settings.json"
+
+	retentionInterval = time.Hour
+)
+
+// Session sources
+const (
+	SourceMultiplexer = "multiplexer"
+	SourceKubectlExec = "kubectl-exec"
+)
+
+// Settings control whether terminal sessions are recorded and how long recordings are kept
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// RecordInput also records keystrokes, which may include secrets typed into the terminal
+	RecordInput bool `json:"recordInput"`
+	// RetentionDays removes recordings older than this many days, 0 keeps them forever
+	RetentionDays int `json:"retentionDays"`
+	// MaxTotalSizeMB removes the oldest recordings once all of them exceed this size, 0 disables the limit
+	MaxTotalSizeMB int `json:"maxTotalSizeMB"`
+	// MaxRecordingSizeMB stops recording a session past this size, 0 disables the limit
+	MaxRecordingSizeMB int `json:"maxRecordingSizeMB"`
+	// AllowUnrecorded lets sessions continue when their recording cannot be started, by default
+	// they are refused
+	AllowUnrecorded bool `json:"allowUnrecorded"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:            false,
+		RecordInput:        false,
+		RetentionDays:      90,
+		MaxTotalSizeMB:     1024,
+		MaxRecordingSizeMB: 100,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.RetentionDays < 0 {
+		return fmt.Errorf("retentionDays must not be negative")
+	}
+	if s.MaxTotalSizeMB < 0 {
+		return fmt.Errorf("maxTotalSizeMB must not be negative")
+	}
+	if s.MaxRecordingSizeMB < 0 {
+		return fmt.Errorf("maxRecordingSizeMB must not be negative")
+	}
+	return nil
+}
+
+// Session describes a recorded terminal session
+type Session struct {
+	ID        string     `json:"id"`
+	Source    string     `json:"source"`
+	Cluster   string     `json:"cluster"`
+	Namespace string     `json:"namespace,omitempty"`
+	Pod       string     `json:"pod,omitempty"`
+	Container string     `json:"container,omitempty"`
+	Command   string     `json:"command,omitempty"`
+	User      string     `json:"user,omitempty"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	// Duration is the session length in seconds, set once the session ends
+	Duration float64 `json:"duration,omitempty"`
+	Size     int64   `json:"size"`
+	// Truncated is set when the session outgrew the maximum recording size
+	Truncated bool `json:"truncated,omitempty"`
+	Active    bool `json:"active"`
+	// Requested is set for sessions the client asked to record, they are recorded even when
+	// recording is disabled
+	Requested bool `json:"requested,omitempty"`
+}
+
+// Title is the asciicast title of the session
+func (s Session) Title() string {
+	target := s.Pod
+	if s.Container != "" {
+		target += "/" + s.Container
+	}
+	if s.Namespace != "" {
+		target = s.Namespace + "/" + target
+	}
+	return fmt.Sprintf("%s: %s", s.Cluster, target)
+}
+
+// Filter narrows down a recordings listing, empty fields match everything
+type Filter struct {
+	Cluster   string
+	Namespace string
+	Pod       string
+	User      string
+	Since     time.Time
+}
+
+func (f Filter) matches(s Session) bool {
+	return (f.Cluster == "" || s.Cluster == f.Cluster) &&
+		(f.Namespace == "" || s.Namespace == f.Namespace) &&
+		(f.Pod == "" || s.Pod == f.Pod) &&
+		(f.User == "" || s.User == f.User) &&
+		(f.Since.IsZero() || !s.StartedAt.Before(f.Since))
+}
+
+// Manager stores terminal session recordings and applies the retention policy
+type Manager struct {
+	dir          string
+	indexPath    string
+	settingsPath string
+	mutex        sync.Mutex
+	active       map[string]*Recorder
+	stopChan     chan struct{}
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared recording manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = NewManager()
+	})
+	return globalManager
+}
+
+// NewManager creates a recording manager backed by the agentkube config directory
+func NewManager() *Manager {
+	configDir := utils.ConfigDir()
+	return &Manager{
+		dir:          filepath.Join(configDir, recordingsDirName),
+		indexPath:    filepath.Join(configDir, indexFileName),
+		settingsPath: filepath.Join(configDir, settingsFileName),
+		active:       map[string]*Recorder{},
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Settings returns the current recording settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new recording settings and applies the retention policy right away
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	err := utils.WriteJSONFile(m.settingsPath, settings)
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.ApplyRetention()
+	return nil
+}
+
+// StartSession starts recording a terminal session. It returns a nil recorder when recording is disabled
+// and the session didn't request one, and an error the session must be refused for when the recording
+// cannot be started.
+func (m *Manager) StartSession(session Session, width, height int) (*Recorder, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	settings, err := m.loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled && !session.Requested {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return nil, unrecorded(settings, session, fmt.Errorf("failed to create recordings directory: %v", err))
+	}
+
+	session.ID = uuid.New().String()
+	session.StartedAt = time.Now()
+	session.Active = true
+	recorder, err := newRecorder(m, session, m.castPath(session.ID), width, height, settings)
+	if err != nil {
+		return nil, unrecorded(settings, session, err)
+	}
+
+	sessions, err := m.load()
+	if err == nil {
+		err = m.save(append(sessions, recorder.session))
+	}
+	if err != nil {
+		recorder.file.Close()
+		os.Remove(m.castPath(session.ID))
+		return nil, unrecorded(settings, session, err)
+	}
+	m.active[session.ID] = recorder
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"recording": session.ID,
+		"cluster":   session.Cluster,
+		"namespace": session.Namespace,
+		"pod":       session.Pod,
+	}, nil, "Started terminal session recording")
+	return recorder, nil
+}
+
+// finish stores the final metadata of a recording once its session ends
+func (m *Manager) finish(session Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.active, session.ID)
+	session.Active = false
+
+	sessions, err := m.load()
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if sessions[i].ID == session.ID {
+			sessions[i] = session
+			if err := m.save(sessions); err != nil {
+				return err
+			}
+			go m.offload(session.ID)
+			return nil
+		}
+	}
+	// The recording was removed while the session was still running
+	return nil
+}
+
+// List returns the recordings matching the filter, newest first
+func (m *Manager) List(filter Filter) ([]Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sessions, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Session{}
+	for _, s := range sessions {
+		if filter.matches(s) {
+			result = append(result, m.withLiveState(s))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.After(result[j].StartedAt)
+	})
+	return result, nil
+}
+
+// Get returns a single recording
+func (m *Manager) Get(id string) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sessions, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if s.ID == id {
+			s = m.withLiveState(s)
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("recording %s not found", id)
+}
+
+// FilePath returns the cast file of a recording, fetching it back from remote storage if needed
+func (m *Manager) FilePath(id string) (string, error) {
+	if _, err := m.Get(id); err != nil {
+		return "", err
+	}
+	path := m.castPath(id)
+	if _, err := os.Stat(path); os.IsNotExist(err) && storage.GetManager().IsRemote(storage.ArtifactRecordings) {
+		if err := m.fetch(id); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// Delete removes a finished recording
+func (m *Manager) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.active[id]; ok {
+		return fmt.Errorf("recording %s is still in progress", id)
+	}
+
+	sessions, err := m.load()
+	if err != nil {
+		return err
+	}
+	for i, s := range sessions {
+		if s.ID == id {
+			if err := m.save(append(sessions[:i], sessions[i+1:]...)); err != nil {
+				return err
+			}
+			return m.removeCast(id)
+		}
+	}
+	return fmt.Errorf("recording %s not found", id)
+}
+
+// RetentionSource lists the finished recordings for the retention policies
+func (m *Manager) RetentionSource() retention.Source {
+	return retention.SourceFuncs{
+		ItemsFunc: func(context.Context) ([]retention.Item, error) {
+			sessions, err := m.List(Filter{})
+			if err != nil {
+				return nil, err
+			}
+			items := []retention.Item{}
+			for _, s := range sessions {
+				if s.Active {
+					continue
+				}
+				modTime := s.StartedAt
+				if s.EndedAt != nil {
+					modTime = *s.EndedAt
+				}
+				items = append(items, retention.Item{ID: s.ID, Size: s.Size, ModTime: modTime})
+			}
+			return items, nil
+		},
+		DeleteFunc: func(_ context.Context, id string) error {
+			return m.Delete(id)
+		},
+	}
+}
+
+// Start runs the retention loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+
+		m.ApplyRetention()
+		for {
+			select {
+			case <-ticker.C:
+				m.ApplyRetention()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the retention loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// ApplyRetention removes recordings past the retention period, then the oldest recordings until
+// the total size fits the limit. Recordings left open by a previous process are marked as ended.
+func (m *Manager) ApplyRetention() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	settings, err := m.loadSettings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load recording settings")
+		return
+	}
+	sessions, err := m.load()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load recordings")
+		return
+	}
+
+	for i := range sessions {
+		s := &sessions[i]
+		if _, ok := m.active[s.ID]; ok || !s.Active {
+			continue
+		}
+		s.Active = false
+		if info, err := os.Stat(m.castPath(s.ID)); err == nil {
+			endedAt := info.ModTime()
+			s.EndedAt = &endedAt
+			s.Duration = endedAt.Sub(s.StartedAt).Seconds()
+			s.Size = info.Size()
+		}
+	}
+
+	// Oldest first, so size based removal drops the oldest recordings
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+
+	var cutoff time.Time
+	if settings.RetentionDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -settings.RetentionDays)
+	}
+	var totalSize int64
+	for _, s := range sessions {
+		totalSize += s.Size
+	}
+	maxTotal := int64(settings.MaxTotalSizeMB) * 1024 * 1024
+
+	kept := make([]Session, 0, len(sessions))
+	var removed []string
+	for _, s := range sessions {
+		_, active := m.active[s.ID]
+		expired := !cutoff.IsZero() && s.StartedAt.Before(cutoff)
+		oversized := maxTotal > 0 && totalSize > maxTotal
+		if !active && (expired || oversized) {
+			totalSize -= s.Size
+			removed = append(removed, s.ID)
+			continue
+		}
+		kept = append(kept, s)
+	}
+
+	if err := m.save(kept); err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to save recordings")
+		return
+	}
+	for _, id := range removed {
+		if err := m.removeCast(id); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"recording": id}, err, "Failed to remove recording file")
+		}
+	}
+	if len(removed) > 0 {
+		logger.Log(logger.LevelInfo, map[string]string{
+			"removed":    strings.Join(removed, ","),
+			"totalSize":  formatSize(totalSize),
+			"maxTotalMB": fmt.Sprint(settings.MaxTotalSizeMB),
+		}, nil, "Applied terminal recording retention")
+	}
+}
+
+// withLiveState reports the current size of recordings that are still in progress
+func (m *Manager) withLiveState(s Session) Session {
+	if recorder, ok := m.active[s.ID]; ok {
+		s.Size = recorder.size()
+		s.Active = true
+	}
+	return s
+}
+
+func (m *Manager) castPath(id string) string {
+	return filepath.Join(m.dir, id+".cast")
+}
+
+// offload moves a finished cast file to remote storage when recordings are stored remotely
+func (m *Manager) offload(id string) {
+	if !storage.GetManager().IsRemote(storage.ArtifactRecordings) {
+		return
+	}
+	ctx := context.Background()
+	backend, err := storage.GetManager().Backend(ctx, storage.ArtifactRecordings)
+	if err == nil {
+		err = putFile(ctx, backend, id+".cast", m.castPath(id))
+	}
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"recording": id}, err, "Failed to offload recording, keeping it locally")
+		return
+	}
+	if err := os.Remove(m.castPath(id)); err != nil && !os.IsNotExist(err) {
+		logger.Log(logger.LevelWarn, map[string]string{"recording": id}, err, "Failed to remove offloaded recording file")
+	}
+}
+
+// fetch downloads an offloaded cast file back into the recordings directory
+func (m *Manager) fetch(id string) error {
+	ctx := context.Background()
+	backend, err := storage.GetManager().Backend(ctx, storage.ArtifactRecordings)
+	if err != nil {
+		return err
+	}
+	reader, err := backend.Get(ctx, id+".cast")
+	if err != nil {
+		return fmt.Errorf("failed to fetch recording: %w", err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to fetch recording: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.castPath(id))
+}
+
+// removeCast removes the cast file of a recording locally and from remote storage
+func (m *Manager) removeCast(id string) error {
+	if err := os.Remove(m.castPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove recording file: %v", err)
+	}
+	if !storage.GetManager().IsRemote(storage.ArtifactRecordings) {
+		return nil
+	}
+	ctx := context.Background()
+	backend, err := storage.GetManager().Backend(ctx, storage.ArtifactRecordings)
+	if err != nil {
+		return err
+	}
+	if err := backend.Delete(ctx, id+".cast"); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to remove stored recording: %v", err)
+	}
+	return nil
+}
+
+func putFile(ctx context.Context, backend storage.Backend, key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, key, file, info.Size())
+}
+
+// unrecorded returns the error of a session whose recording failed to start, or nil after logging
+// it when the settings allow unrecorded sessions
+func unrecorded(settings Settings, session Session, err error) error {
+	if !settings.AllowUnrecorded {
+		return fmt.Errorf("failed to start session recording: %v", err)
+	}
+	logger.Log(logger.LevelWarn, map[string]string{
+		"cluster": session.Cluster,
+		"pod":     session.Pod,
+	}, err, "Continuing terminal session without recording")
+	return nil
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+func (m *Manager) load() ([]Session, error) {
+	var sessions []Session
+	if err := utils.ReadJSONFile(m.indexPath, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m *Manager) save(sessions []Session) error {
+	return utils.WriteJSONFile(m.indexPath, sessions)
+}
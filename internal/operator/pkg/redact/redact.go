@@ -0,0 +1,267 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	settingsFileName = "redaction.json"
+
+	// Redacted replaces the values of redacted annotations and labels
+	Redacted = "REDACTED"
+)
+
+// Settings configure the annotation and label keys whose values never leave the operator
+type Settings struct {
+	// Patterns match annotation and label keys, case-insensitively. A * matches any characters,
+	// e.g. vault.hashicorp.com/* or *token*.
+	Patterns []string `json:"patterns"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{Patterns: []string{}}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	for _, pattern := range s.Patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("patterns must not be empty")
+		}
+	}
+	return nil
+}
+
+// compile turns the patterns into one expression, nil when there are none
+func (s Settings) compile() *regexp.Regexp {
+	if len(s.Patterns) == 0 {
+		return nil
+	}
+	alternatives := make([]string, 0, len(s.Patterns))
+	for _, pattern := range s.Patterns {
+		alternatives = append(alternatives, strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSpace(pattern)), `\*`, ".*"))
+	}
+	return regexp.MustCompile("(?i)^(?:" + strings.Join(alternatives, "|") + ")$")
+}
+
+// Manager holds the redaction settings, compiled once as they apply to every response
+type Manager struct {
+	settingsPath string
+	mutex        sync.RWMutex
+	loaded       bool
+	keys         *regexp.Regexp
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared redaction manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = &Manager{
+			settingsPath: filepath.Join(utils.ConfigDir(), settingsFileName),
+		}
+	})
+	return globalManager
+}
+
+// Settings returns the current redaction settings
+func (m *Manager) Settings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// UpdateSettings stores new redaction settings, they apply to the next responses
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Patterns == nil {
+		settings.Patterns = []string{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := utils.WriteJSONFile(m.settingsPath, settings); err != nil {
+		return err
+	}
+	m.keys, m.loaded = settings.compile(), true
+	return nil
+}
+
+// matcher returns the compiled patterns, loading them on first use. Unreadable settings redact
+// nothing rather than failing every response.
+func (m *Manager) matcher() *regexp.Regexp {
+	m.mutex.RLock()
+	keys, loaded := m.keys, m.loaded
+	m.mutex.RUnlock()
+	if loaded {
+		return keys
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.loaded {
+		settings, err := m.Settings()
+		if err == nil {
+			m.keys = settings.compile()
+		}
+		m.loaded = true
+	}
+	return m.keys
+}
+
+// Enabled tells whether any key is redacted
+func Enabled() bool {
+	return GetManager().matcher() != nil
+}
+
+// Map returns the annotations or labels with the values of redacted keys replaced, a copy when any is
+func Map(values map[string]string) map[string]string {
+	keys := GetManager().matcher()
+	if keys == nil {
+		return values
+	}
+	var redacted map[string]string
+	for key := range values {
+		if !keys.MatchString(key) {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]string, len(values))
+			for k, v := range values {
+				redacted[k] = v
+			}
+		}
+		redacted[key] = Redacted
+	}
+	if redacted == nil {
+		return values
+	}
+	return redacted
+}
+
+// Object redacts the annotations and labels of a resource in place: of the object, of the items of
+// a list, of the object of a watch event and of pod templates. It returns whether anything changed.
+func Object(obj map[string]interface{}) bool {
+	keys := GetManager().matcher()
+	if keys == nil {
+		return false
+	}
+	return redactObject(keys, obj)
+}
+
+func redactObject(keys *regexp.Regexp, obj map[string]interface{}) bool {
+	changed := redactMetadata(keys, obj)
+	if object, ok := obj["object"].(map[string]interface{}); ok {
+		changed = redactObject(keys, object) || changed
+	}
+	if items, ok := obj["items"].([]interface{}); ok {
+		for _, item := range items {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				changed = redactObject(keys, itemMap) || changed
+			}
+		}
+	}
+	// Table rows carry their object when asked for
+	if rows, ok := obj["rows"].([]interface{}); ok {
+		for _, row := range rows {
+			if rowMap, ok := row.(map[string]interface{}); ok {
+				if object, ok := rowMap["object"].(map[string]interface{}); ok {
+					changed = redactObject(keys, object) || changed
+				}
+			}
+		}
+	}
+	if spec, ok := obj["spec"].(map[string]interface{}); ok {
+		if template, ok := spec["template"].(map[string]interface{}); ok {
+			changed = redactObject(keys, template) || changed
+		}
+		if jobTemplate, ok := spec["jobTemplate"].(map[string]interface{}); ok {
+			changed = redactObject(keys, jobTemplate) || changed
+		}
+	}
+	return changed
+}
+
+func redactMetadata(keys *regexp.Regexp, obj map[string]interface{}) bool {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	changed := false
+	for _, field := range []string{"annotations", "labels"} {
+		values, ok := metadata[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range values {
+			if value != Redacted && keys.MatchString(key) {
+				values[key] = Redacted
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// JSON redacts a JSON encoded resource, list or watch event. Anything else is returned as is.
+func JSON(data []byte) []byte {
+	keys := GetManager().matcher()
+	if keys == nil {
+		return data
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	if !redactObject(keys, obj) {
+		return data
+	}
+	redacted, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// Event returns the event with the annotations and labels of its objects redacted, copying the
+// objects so the watchers keep the originals
+func Event(e event.Event) event.Event {
+	if !Enabled() {
+		return e
+	}
+	if e.Obj != nil {
+		e.Obj = e.Obj.DeepCopyObject()
+		redactAccessor(e.Obj)
+	}
+	if e.OldObj != nil {
+		e.OldObj = e.OldObj.DeepCopyObject()
+		redactAccessor(e.OldObj)
+	}
+	return e
+}
+
+func redactAccessor(obj interface{}) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	accessor.SetAnnotations(Map(accessor.GetAnnotations()))
+	accessor.SetLabels(Map(accessor.GetLabels()))
+}
@@ -0,0 +1,159 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var testPatterns = []string{"vault.hashicorp.com/*", "*TOKEN*"}
+
+func init() {
+	manager := GetManager()
+	manager.keys, manager.loaded = Settings{Patterns: testPatterns}.compile(), true
+}
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	keys := Settings{Patterns: testPatterns}.compile()
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"vault.hashicorp.com/agent-inject-token", true},
+		{"vault.hashicorp.com/role", true},
+		{"example.com/api-token", true},
+		{"example.com/Token", true},
+		{"app.kubernetes.io/name", false},
+		{"vault.hashicorp.com", false},
+		{"vaultXhashicorp.com/role", false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+			if got := keys.MatchString(tt.key); got != tt.want {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+
+	if keys := (Settings{}).compile(); keys != nil {
+		t.Errorf("compile() without patterns = %v, want nil", keys)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "object",
+			in:   `{"metadata":{"name":"web","annotations":{"api-token":"s3cr3t","team":"shop"},"labels":{"app":"web"}}}`,
+			want: `{"metadata":{"name":"web","annotations":{"api-token":"REDACTED","team":"shop"},"labels":{"app":"web"}}}`,
+		},
+		{
+			name: "list with pod templates",
+			in:   `{"kind":"DeploymentList","items":[{"metadata":{"name":"web"},"spec":{"template":{"metadata":{"annotations":{"vault.hashicorp.com/role":"web"}}}}}]}`,
+			want: `{"kind":"DeploymentList","items":[{"metadata":{"name":"web"},"spec":{"template":{"metadata":{"annotations":{"vault.hashicorp.com/role":"REDACTED"}}}}}]}`,
+		},
+		{
+			name: "watch event",
+			in:   `{"type":"MODIFIED","object":{"metadata":{"labels":{"token":"abc"}}}}`,
+			want: `{"type":"MODIFIED","object":{"metadata":{"labels":{"token":"REDACTED"}}}}`,
+		},
+		{
+			name: "table rows",
+			in:   `{"kind":"Table","rows":[{"cells":["web"],"object":{"metadata":{"annotations":{"token":"abc"}}}}]}`,
+			want: `{"kind":"Table","rows":[{"cells":["web"],"object":{"metadata":{"annotations":{"token":"REDACTED"}}}}]}`,
+		},
+		{name: "nothing to redact", in: `{"metadata":{"labels":{"app":"web"}}}`, want: `{"metadata":{"labels":{"app":"web"}}}`},
+		{name: "not JSON", in: `not json`, want: `not json`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assertJSON(t, string(JSON([]byte(tt.in))), tt.want)
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]string{"app": "web", "token": "abc"}
+	got := Map(labels)
+	if want := map[string]string{"app": "web", "token": Redacted}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+	if labels["token"] != "abc" {
+		t.Errorf("Map() changed its argument")
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	t.Parallel()
+
+	event := `{"object":{"metadata":{"annotations":{"token":"abc"}}},"type":"ADDED"}`
+	redactedEvent := `{"object":{"metadata":{"annotations":{"token":"REDACTED"}}},"type":"ADDED"}`
+
+	recorder := httptest.NewRecorder()
+	writer := NewResponseWriter(recorder, true)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Content-Length", "1000")
+	writer.WriteHeader(http.StatusOK)
+	// Events arrive in chunks that don't follow their lines
+	writer.Write([]byte(event + "\n" + event[:10]))
+	if got := recorder.Body.String(); got != redactedEvent+"\n" {
+		t.Errorf("streamed %q, want %q", got, redactedEvent+"\n")
+	}
+	writer.Write([]byte(event[10:] + "\n"))
+	writer.Close()
+	if got := recorder.Body.String(); got != redactedEvent+"\n"+redactedEvent+"\n" {
+		t.Errorf("streamed %q, want two redacted events", got)
+	}
+	if recorder.Header().Get("Content-Length") != "" {
+		t.Errorf("Content-Length kept on a redacted response")
+	}
+
+	recorder = httptest.NewRecorder()
+	writer = NewResponseWriter(recorder, false)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write([]byte(event[:20]))
+	writer.Write([]byte(event[20:]))
+	writer.Close()
+	assertJSON(t, recorder.Body.String(), redactedEvent)
+
+	recorder = httptest.NewRecorder()
+	writer = NewResponseWriter(recorder, false)
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.Write([]byte("token: abc"))
+	writer.Close()
+	if got := recorder.Body.String(); got != "token: abc" {
+		t.Errorf("rewrote a text response to %q", got)
+	}
+}
+
+func assertJSON(t *testing.T, got, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+		return
+	}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil || !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
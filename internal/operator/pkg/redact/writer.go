@@ -0,0 +1,89 @@
+package redact
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// ResponseWriter redacts the JSON responses of the cluster proxy. Watch responses are redacted event
+// by event as they stream, one JSON document per line, other responses once complete on Close.
+type ResponseWriter struct {
+	http.ResponseWriter
+	stream      bool
+	wroteHeader bool
+	active      bool
+	buffer      bytes.Buffer
+}
+
+// NewResponseWriter wraps w, stream is set for watch requests
+func NewResponseWriter(w http.ResponseWriter, stream bool) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, stream: stream}
+}
+
+// WriteHeader starts redacting JSON responses, whose length changes with redaction
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	// Compressed responses aren't rewritten, the proxy asks for uncompressed ones
+	if strings.Contains(header.Get("Content-Type"), "json") && header.Get("Content-Encoding") == "" {
+		w.active = true
+		header.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *ResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.active {
+		return w.ResponseWriter.Write(p)
+	}
+	w.buffer.Write(p)
+	if w.stream {
+		if err := w.writeLines(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends the complete events of a watch
+func (w *ResponseWriter) Flush() {
+	if w.active && w.stream {
+		w.writeLines()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close sends what is left of the response
+func (w *ResponseWriter) Close() error {
+	if !w.active || w.buffer.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(JSON(w.buffer.Bytes()))
+	w.buffer.Reset()
+	return err
+}
+
+// writeLines sends the complete lines of the buffer, keeping a partial last line
+func (w *ResponseWriter) writeLines() error {
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			return nil
+		}
+		line := append(JSON(data[:end]), '\n')
+		w.buffer.Next(end + 1)
+		if _, err := w.ResponseWriter.Write(line); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,532 @@
+package restartloop
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const (
+	settingsFileName = "restart-analyzer.json"
+	capturesFileName = "restart-captures.json"
+
+	// eventSource names the records this analyzer writes to the event store
+	eventSource = "restart-analyzer"
+	eventReason = "RestartLoop"
+
+	// eventQueueSize bounds the watcher events waiting to be analyzed
+	eventQueueSize = 1024
+	maxCaptures    = 500
+	maxPodEvents   = 10
+	// maxLogBytes caps a log snippet, a few long lines must not bloat notifications
+	maxLogBytes = 8 * 1024
+	// captureTimeout bounds the API calls collecting the context of a crash
+	captureTimeout = 20 * time.Second
+)
+
+// Settings configure when restarting containers are captured
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Clusters limits the analysis to these contexts, empty analyzes every watched context
+	Clusters []string `json:"clusters"`
+	// RestartThreshold is the restart count from which a container is considered looping
+	RestartThreshold int32 `json:"restartThreshold"`
+	// LogLines is how many lines of the previous container logs are captured
+	LogLines int64 `json:"logLines"`
+	// CooldownMinutes is how long a container isn't captured again after a capture
+	CooldownMinutes int `json:"cooldownMinutes"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:          true,
+		Clusters:         []string{},
+		RestartThreshold: 5,
+		LogLines:         30,
+		CooldownMinutes:  30,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.RestartThreshold < 1 {
+		return fmt.Errorf("restartThreshold must be positive")
+	}
+	if s.LogLines < 1 || s.LogLines > 500 {
+		return fmt.Errorf("logLines must be between 1 and 500")
+	}
+	if s.CooldownMinutes < 0 || s.CooldownMinutes > 7*24*60 {
+		return fmt.Errorf("cooldownMinutes must be between 0 and 10080")
+	}
+	return nil
+}
+
+// PodEvent is a Kubernetes event of the captured pod
+type PodEvent struct {
+	Type     string    `json:"type"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Capture is the crash context of a container that exceeded the restart threshold
+type Capture struct {
+	ID        string `json:"id"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	// Workload is "Kind/name" of the controller owning the pod, empty when it has none
+	Workload     string `json:"workload,omitempty"`
+	Node         string `json:"node,omitempty"`
+	RestartCount int32  `json:"restartCount"`
+	ExitCode     int32  `json:"exitCode"`
+	Signal       int32  `json:"signal,omitempty"`
+	// Reason is the reason of the last termination, e.g. Error or OOMKilled
+	Reason     string     `json:"reason,omitempty"`
+	Message    string     `json:"message,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Logs are the last lines of the previous container instance
+	Logs string `json:"logs"`
+	// LogError explains why the logs could not be read
+	LogError   string     `json:"logError,omitempty"`
+	Events     []PodEvent `json:"events"`
+	CapturedAt time.Time  `json:"capturedAt"`
+}
+
+// Filter selects captures, empty fields match everything
+type Filter struct {
+	Cluster   string
+	Namespace string
+	Pod       string
+}
+
+// restart is a container of a pod update that restarted past the threshold
+type restart struct {
+	Container    string
+	RestartCount int32
+	Terminated   *corev1.ContainerStateTerminated
+}
+
+// Manager captures the logs, exit code and events of restart looping containers as pods are
+// updated and notifies with them
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	capturesPath    string
+	mutex           sync.Mutex
+	captures        []Capture
+	loaded          bool
+	// events buffers watcher events for the analysis worker
+	events chan event.Event
+	// captured is when each container was last captured, only accessed by the analysis worker
+	captured map[string]time.Time
+
+	notifier     dispatchers.Dispatcher
+	notifierOnce sync.Once
+}
+
+// NewManager creates a restart loop analyzer
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		capturesPath:    filepath.Join(utils.ConfigDir(), capturesFileName),
+		events:          make(chan event.Event, eventQueueSize),
+		captured:        map[string]time.Time{},
+	}
+}
+
+// Settings returns the current analyzer settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new analyzer settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start runs the analysis worker
+func (m *Manager) Start() {
+	go func() {
+		for e := range m.events {
+			m.analyze(e)
+		}
+	}()
+}
+
+// HandleEvent queues a watcher event for analysis. It never blocks the watcher, events are
+// dropped while the queue is full.
+func (m *Manager) HandleEvent(e event.Event) {
+	if _, ok := e.Obj.(*corev1.Pod); !ok || e.Reason != "Updated" {
+		return
+	}
+	select {
+	case m.events <- e:
+	default:
+		logger.Log(logger.LevelWarn, map[string]string{
+			"cluster": e.Host,
+			"name":    e.Name,
+		}, nil, "Restart analyzer queue is full, dropping watcher event")
+	}
+}
+
+// List returns the captures matching the filter, most recent first
+func (m *Manager) List(filter Filter) ([]Capture, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadCaptures(); err != nil {
+		return nil, err
+	}
+	list := []Capture{}
+	for _, capture := range m.captures {
+		if (filter.Cluster == "" || capture.Cluster == filter.Cluster) &&
+			(filter.Namespace == "" || capture.Namespace == filter.Namespace) &&
+			(filter.Pod == "" || capture.Pod == filter.Pod) {
+			list = append(list, capture)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CapturedAt.After(list[j].CapturedAt) })
+	return list, nil
+}
+
+// Get returns a single capture
+func (m *Manager) Get(id string) (*Capture, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.loadCaptures(); err != nil {
+		return nil, err
+	}
+	for _, capture := range m.captures {
+		if capture.ID == id {
+			return &capture, nil
+		}
+	}
+	return nil, fmt.Errorf("capture %s not found", id)
+}
+
+// analyze captures the containers of a pod update that restarted past the threshold
+func (m *Manager) analyze(e event.Event) {
+	pod := e.Obj.(*corev1.Pod)
+	old, _ := e.OldObj.(*corev1.Pod)
+
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load restart analyzer settings")
+		return
+	}
+	if !settings.Enabled || (len(settings.Clusters) > 0 && !contains(settings.Clusters, e.Host)) {
+		return
+	}
+
+	now := time.Now()
+	cooldown := time.Duration(settings.CooldownMinutes) * time.Minute
+	for _, r := range restarts(pod, old, settings.RestartThreshold) {
+		key := e.Host + "/" + pod.Namespace + "/" + pod.Name + "/" + r.Container
+		if last, ok := m.captured[key]; ok && now.Sub(last) < cooldown {
+			continue
+		}
+		m.captured[key] = now
+
+		capture := m.capture(e.Host, pod, r, settings)
+		if err := m.store(capture); err != nil {
+			logger.Log(logger.LevelError, map[string]string{"cluster": e.Host, "pod": pod.Namespace + "/" + pod.Name}, err, "Failed to store restart capture")
+		}
+		m.notify(capture)
+	}
+	m.forget(now, cooldown)
+}
+
+// restarts returns the containers that restarted with this update and reached the threshold
+func restarts(pod, old *corev1.Pod, threshold int32) []restart {
+	previous := map[string]int32{}
+	if old != nil {
+		for _, status := range append(append([]corev1.ContainerStatus{}, old.Status.InitContainerStatuses...), old.Status.ContainerStatuses...) {
+			previous[status.Name] = status.RestartCount
+		}
+	}
+
+	result := []restart{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if status.RestartCount < threshold || status.RestartCount <= previous[status.Name] {
+			continue
+		}
+		terminated := status.LastTerminationState.Terminated
+		if terminated == nil {
+			terminated = status.State.Terminated
+		}
+		result = append(result, restart{Container: status.Name, RestartCount: status.RestartCount, Terminated: terminated})
+	}
+	return result
+}
+
+// capture reads the previous logs and the events of a restarting container. Failures are recorded
+// in the capture, the exit code alone is worth reporting.
+func (m *Manager) capture(clusterName string, pod *corev1.Pod, r restart, settings Settings) Capture {
+	capture := Capture{
+		ID:           uuid.New().String(),
+		Cluster:      clusterName,
+		Namespace:    pod.Namespace,
+		Pod:          pod.Name,
+		Container:    r.Container,
+		Workload:     workloadOf(pod),
+		Node:         pod.Spec.NodeName,
+		RestartCount: r.RestartCount,
+		Events:       []PodEvent{},
+		CapturedAt:   time.Now(),
+	}
+	if r.Terminated != nil {
+		capture.ExitCode = r.Terminated.ExitCode
+		capture.Signal = r.Terminated.Signal
+		capture.Reason = r.Terminated.Reason
+		capture.Message = r.Terminated.Message
+		if !r.Terminated.FinishedAt.IsZero() {
+			finishedAt := r.Terminated.FinishedAt.Time
+			capture.FinishedAt = &finishedAt
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		capture.LogError = fmt.Sprintf("context not found: %v", err)
+		return capture
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		capture.LogError = fmt.Sprintf("failed to create kubernetes clientset: %v", err)
+		return capture
+	}
+
+	tailLines := settings.LogLines
+	logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: r.Container,
+		Previous:  true,
+		TailLines: &tailLines,
+	}).DoRaw(ctx)
+	if err != nil {
+		capture.LogError = err.Error()
+	}
+	capture.Logs = truncateLogs(string(logs))
+
+	eventList, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod.Name,
+		}.String(),
+	})
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName, "pod": pod.Namespace + "/" + pod.Name}, err, "Failed to list events of restarting pod")
+		return capture
+	}
+	capture.Events = podEvents(eventList.Items)
+	return capture
+}
+
+// podEvents returns the most recent events, oldest first
+func podEvents(items []corev1.Event) []PodEvent {
+	events := make([]PodEvent, 0, len(items))
+	for _, item := range items {
+		lastSeen := item.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = item.EventTime.Time
+		}
+		events = append(events, PodEvent{
+			Type:     item.Type,
+			Reason:   item.Reason,
+			Message:  item.Message,
+			Count:    item.Count,
+			LastSeen: lastSeen,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].LastSeen.Before(events[j].LastSeen) })
+	if len(events) > maxPodEvents {
+		events = events[len(events)-maxPodEvents:]
+	}
+	return events
+}
+
+// truncateLogs keeps the end of the logs within maxLogBytes, starting on a whole line
+func truncateLogs(logs string) string {
+	if len(logs) <= maxLogBytes {
+		return logs
+	}
+	logs = logs[len(logs)-maxLogBytes:]
+	if i := strings.IndexByte(logs, '\n'); i >= 0 {
+		logs = logs[i+1:]
+	}
+	return logs
+}
+
+// store saves a capture and records it in the event store, next to the other operator events
+func (m *Manager) store(capture Capture) error {
+	m.mutex.Lock()
+	err := m.loadCaptures()
+	if err == nil {
+		m.captures = append(m.captures, capture)
+		if len(m.captures) > maxCaptures {
+			m.captures = m.captures[len(m.captures)-maxCaptures:]
+		}
+		err = utils.WriteJSONFile(m.capturesPath, m.captures)
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	record := event.Record{
+		Namespace:  capture.Namespace,
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Resource:   "pods",
+		Name:       capture.Pod,
+		Reason:     eventReason,
+		Severity:   "critical",
+		Message:    Summary(capture),
+		Labels: map[string]string{
+			"container": capture.Container,
+			"capture":   capture.ID,
+			"exitCode":  strconv.Itoa(int(capture.ExitCode)),
+		},
+		FirstSeen: capture.CapturedAt,
+		LastSeen:  capture.CapturedAt,
+	}
+	_, err = event.GetStore().Replace(eventSource, capture.Cluster, func(r event.Record) bool {
+		return r.Namespace == capture.Namespace && r.Name == capture.Pod && r.Labels["container"] == capture.Container
+	}, []event.Record{record}, true)
+	return err
+}
+
+// Summary describes a capture in one line
+func Summary(capture Capture) string {
+	summary := fmt.Sprintf("Container %s restarted %d times, last exit code %d", capture.Container, capture.RestartCount, capture.ExitCode)
+	if capture.Reason != "" {
+		summary += " (" + capture.Reason + ")"
+	}
+	return summary
+}
+
+// Details formats the crash context of a capture for notifications
+func Details(capture Capture) string {
+	var b strings.Builder
+	b.WriteString(Summary(capture))
+	if capture.Message != "" {
+		fmt.Fprintf(&b, "\nTermination message: %s", capture.Message)
+	}
+	if capture.Workload != "" {
+		fmt.Fprintf(&b, "\nWorkload: %s", capture.Workload)
+	}
+	if capture.Node != "" {
+		fmt.Fprintf(&b, "\nNode: %s", capture.Node)
+	}
+	if len(capture.Events) > 0 {
+		b.WriteString("\nEvents:")
+		for _, e := range capture.Events {
+			fmt.Fprintf(&b, "\n  %s %s (x%d): %s", e.Type, e.Reason, e.Count, e.Message)
+		}
+	}
+	switch {
+	case capture.Logs != "":
+		fmt.Fprintf(&b, "\nPrevious logs:\n```\n%s\n```", strings.TrimRight(capture.Logs, "\n"))
+	case capture.LogError != "":
+		fmt.Fprintf(&b, "\nPrevious logs unavailable: %s", capture.LogError)
+	}
+	return b.String()
+}
+
+func (m *Manager) notify(capture Capture) {
+	m.notifierOnce.Do(func() {
+		m.notifier = client.NewNotifier("restart-analyzer")
+	})
+
+	e := event.Event{
+		Kind:      "restart-loop",
+		Host:      capture.Cluster,
+		Namespace: capture.Namespace,
+		Name:      capture.Pod,
+		Reason:    Details(capture),
+		Status:    "Danger",
+	}
+	go m.notifier.Handle(e)
+}
+
+// forget drops the cooldowns that expired, only called by the analysis worker
+func (m *Manager) forget(now time.Time, cooldown time.Duration) {
+	for key, last := range m.captured {
+		if now.Sub(last) >= cooldown {
+			delete(m.captured, key)
+		}
+	}
+}
+
+// workloadOf returns "Kind/name" of the controller of a pod
+func workloadOf(pod *corev1.Pod) string {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return owner.Kind + "/" + owner.Name
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+func (m *Manager) loadCaptures() error {
+	if m.loaded {
+		return nil
+	}
+	var captures []Capture
+	if err := utils.ReadJSONFile(m.capturesPath, &captures); err != nil {
+		return err
+	}
+	m.captures = captures
+	m.loaded = true
+	return nil
+}
@@ -0,0 +1,90 @@
+package restartloop
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testPod(restarts ...int32) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Name, pod.Namespace = "api-0", "shop"
+	for i, count := range restarts {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:         []string{"app", "sidecar"}[i],
+			RestartCount: count,
+			LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+			},
+		})
+	}
+	return pod
+}
+
+func TestRestarts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		old  *corev1.Pod
+		want []string
+	}{
+		{"below threshold", testPod(4), testPod(3), []string{}},
+		{"crossing threshold", testPod(5, 0), testPod(4, 0), []string{"app"}},
+		{"restart past threshold", testPod(9, 7), testPod(8, 7), []string{"app"}},
+		{"no new restart", testPod(9), testPod(9), []string{}},
+		{"first seen", testPod(6, 6), nil, []string{"app", "sidecar"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := []string{}
+			for _, r := range restarts(tt.pod, tt.old, 5) {
+				got = append(got, r.Container)
+				if r.Terminated == nil || r.Terminated.ExitCode != 137 {
+					t.Errorf("restart of %s has termination %+v, want exit code 137", r.Container, r.Terminated)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("restarts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateLogs(t *testing.T) {
+	t.Parallel()
+
+	logs := strings.Repeat("0123456789\n", maxLogBytes/5)
+	truncated := truncateLogs(logs)
+	if len(truncated) > maxLogBytes || !strings.HasPrefix(truncated, "0123456789\n") || !strings.HasSuffix(logs, truncated) {
+		t.Errorf("truncateLogs() kept %d bytes not starting on a line", len(truncated))
+	}
+	if short := "panic: boom\n"; truncateLogs(short) != short {
+		t.Error("truncateLogs() changed logs within the limit")
+	}
+}
+
+func TestDetails(t *testing.T) {
+	t.Parallel()
+
+	details := Details(Capture{
+		Container:    "app",
+		RestartCount: 6,
+		ExitCode:     1,
+		Reason:       "Error",
+		Workload:     "StatefulSet/api",
+		Events:       []PodEvent{{Type: "Warning", Reason: "BackOff", Count: 12, Message: "Back-off restarting failed container"}},
+		Logs:         "connecting to db\npanic: connection refused\n",
+	})
+	for _, want := range []string{"restarted 6 times, last exit code 1 (Error)", "Workload: StatefulSet/api", "Warning BackOff (x12)", "panic: connection refused\n```"} {
+		if !strings.Contains(details, want) {
+			t.Errorf("Details() = %q, missing %q", details, want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "retention.json"
+
+	// tickInterval is how often the pruning loop checks whether a run is due
+	tickInterval = time.Minute
+	// maxPaths caps the largest entries of the config directory reported by Usage
+	maxPaths = 20
+)
+
+// Item is a unit of persisted data, pruned as a whole, e.g. a recording or a scan
+type Item struct {
+	ID   string
+	Size int64
+	// ModTime is when the item last changed, its age counts from it
+	ModTime time.Time
+}
+
+// Source lists and deletes the items of a data type. Items in use, like running recordings, are
+// left out of the listing.
+type Source interface {
+	Items(ctx context.Context) ([]Item, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// SourceFuncs adapts a pair of functions to a Source
+type SourceFuncs struct {
+	ItemsFunc  func(ctx context.Context) ([]Item, error)
+	DeleteFunc func(ctx context.Context, id string) error
+}
+
+// Items lists the items through ItemsFunc
+func (f SourceFuncs) Items(ctx context.Context) ([]Item, error) {
+	return f.ItemsFunc(ctx)
+}
+
+// Delete deletes an item through DeleteFunc
+func (f SourceFuncs) Delete(ctx context.Context, id string) error {
+	return f.DeleteFunc(ctx, id)
+}
+
+// Policy limits the data kept of a type, a zero limit is disabled
+type Policy struct {
+	// MaxAgeDays removes items unchanged for this many days
+	MaxAgeDays int `json:"maxAgeDays"`
+	// MaxSizeMB removes the oldest items once all of them exceed this size
+	MaxSizeMB int `json:"maxSizeMB"`
+}
+
+// Settings configure the retention of every data type, types without a policy are kept forever
+type Settings struct {
+	// Enabled runs the scheduled pruning, pruning on demand works regardless
+	Enabled         bool              `json:"enabled"`
+	IntervalMinutes int               `json:"intervalMinutes"`
+	Policies        map[string]Policy `json:"policies"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		IntervalMinutes: 60,
+		Policies:        map[string]Policy{},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.IntervalMinutes < 5 || s.IntervalMinutes > 7*24*60 {
+		return fmt.Errorf("intervalMinutes must be between 5 and %d", 7*24*60)
+	}
+	for dataType, policy := range s.Policies {
+		if policy.MaxAgeDays < 0 || policy.MaxSizeMB < 0 {
+			return fmt.Errorf("%s: limits must not be negative", dataType)
+		}
+	}
+	return nil
+}
+
+// Usage is the disk used by the operator, per data type and per entry of its config directory
+type Usage struct {
+	Dir        string      `json:"dir"`
+	TotalBytes int64       `json:"totalBytes"`
+	Types      []TypeUsage `json:"types"`
+	// Paths are the largest entries of the config directory, including data without a policy
+	Paths []PathUsage `json:"paths"`
+}
+
+// TypeUsage is the data kept of a type and the policy limiting it
+type TypeUsage struct {
+	Type   string     `json:"type"`
+	Items  int        `json:"items"`
+	Bytes  int64      `json:"bytes"`
+	Oldest *time.Time `json:"oldest,omitempty"`
+	Policy Policy     `json:"policy"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// PathUsage is the size of a file or directory of the config directory
+type PathUsage struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Result is what pruning removed of a data type
+type Result struct {
+	Type       string `json:"type"`
+	Removed    int    `json:"removed"`
+	FreedBytes int64  `json:"freedBytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Manager applies the retention policies to the registered data types
+type Manager struct {
+	settingsPath string
+	dir          string
+	mutex        sync.Mutex
+	settings     *Settings
+	sources      map[string]Source
+	lastRun      time.Time
+	stopChan     chan struct{}
+	stopOnce     sync.Once
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared retention manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		configDir := utils.ConfigDir()
+		globalManager = &Manager{
+			settingsPath: filepath.Join(configDir, settingsFileName),
+			dir:          configDir,
+			sources:      map[string]Source{},
+			stopChan:     make(chan struct{}),
+		}
+	})
+	return globalManager
+}
+
+// Register adds a data type the policies apply to, replacing the source registered before under
+// the same name
+func (m *Manager) Register(dataType string, source Source) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sources[dataType] = source
+}
+
+// Types returns the registered data types, sorted
+func (m *Manager) Types() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	types := make([]string, 0, len(m.sources))
+	for dataType := range m.sources {
+		types = append(types, dataType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Settings returns the current retention settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new retention settings, policies must name registered data types
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if settings.Policies == nil {
+		settings.Policies = map[string]Policy{}
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for dataType := range settings.Policies {
+		if _, ok := m.sources[dataType]; !ok {
+			return fmt.Errorf("unknown data type %q", dataType)
+		}
+	}
+	if err := utils.WriteJSONFile(m.settingsPath, settings); err != nil {
+		return err
+	}
+	m.settings = &settings
+	return nil
+}
+
+// Start prunes the data types on the configured interval until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the pruning loop
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopChan) })
+}
+
+// monitor prunes when scheduled pruning is enabled and the interval elapsed
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load retention settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	for _, result := range m.Prune(context.Background()) {
+		if result.Error != "" {
+			logger.Log(logger.LevelWarn, map[string]string{"type": result.Type}, fmt.Errorf("%s", result.Error), "Failed to apply retention")
+		} else if result.Removed > 0 {
+			logger.Log(logger.LevelInfo, map[string]string{
+				"type":       result.Type,
+				"removed":    fmt.Sprintf("%d", result.Removed),
+				"freedBytes": fmt.Sprintf("%d", result.FreedBytes),
+			}, nil, "Pruned expired data")
+		}
+	}
+}
+
+// Prune removes the items of every data type with a policy past its limits
+func (m *Manager) Prune(ctx context.Context) []Result {
+	settings, err := m.Settings()
+	if err != nil {
+		return []Result{{Error: err.Error()}}
+	}
+	sources := m.registered()
+
+	results := []Result{}
+	now := time.Now()
+	for _, dataType := range sortedKeys(settings.Policies) {
+		source, ok := sources[dataType]
+		if !ok {
+			continue
+		}
+		result := Result{Type: dataType}
+		items, err := source.Items(ctx)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		for _, item := range expired(items, settings.Policies[dataType], now) {
+			if err := source.Delete(ctx, item.ID); err != nil {
+				result.Error = fmt.Sprintf("failed to delete %s: %v", item.ID, err)
+				break
+			}
+			result.Removed++
+			result.FreedBytes += item.Size
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Usage reports the data kept of every registered type and the size of the config directory
+func (m *Manager) Usage(ctx context.Context) (*Usage, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	sources := m.registered()
+
+	usage := &Usage{Dir: m.dir, Types: []TypeUsage{}, Paths: []PathUsage{}}
+	for _, dataType := range sortedKeys(sources) {
+		typeUsage := TypeUsage{Type: dataType, Policy: settings.Policies[dataType]}
+		items, err := sources[dataType].Items(ctx)
+		if err != nil {
+			typeUsage.Error = err.Error()
+		}
+		for _, item := range items {
+			typeUsage.Items++
+			typeUsage.Bytes += item.Size
+			if typeUsage.Oldest == nil || item.ModTime.Before(*typeUsage.Oldest) {
+				modTime := item.ModTime
+				typeUsage.Oldest = &modTime
+			}
+		}
+		usage.Types = append(usage.Types, typeUsage)
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		size, err := diskSize(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		usage.TotalBytes += size
+		usage.Paths = append(usage.Paths, PathUsage{Path: entry.Name(), Bytes: size})
+	}
+	sort.Slice(usage.Paths, func(i, j int) bool {
+		if usage.Paths[i].Bytes != usage.Paths[j].Bytes {
+			return usage.Paths[i].Bytes > usage.Paths[j].Bytes
+		}
+		return usage.Paths[i].Path < usage.Paths[j].Path
+	})
+	if len(usage.Paths) > maxPaths {
+		usage.Paths = usage.Paths[:maxPaths]
+	}
+	return usage, nil
+}
+
+func (m *Manager) registered() map[string]Source {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sources := make(map[string]Source, len(m.sources))
+	for dataType, source := range m.sources {
+		sources[dataType] = source
+	}
+	return sources
+}
+
+// loadSettings returns the cached settings, the caller must hold the mutex
+func (m *Manager) loadSettings() (Settings, error) {
+	if m.settings != nil {
+		return *m.settings, nil
+	}
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	m.settings = &settings
+	return settings, nil
+}
+
+// expired returns the items past the limits of a policy: those older than its age, then the
+// oldest of the rest until they fit its size
+func expired(items []Item, policy Policy, now time.Time) []Item {
+	sorted := append([]Item(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ModTime.Before(sorted[j].ModTime) })
+
+	var total int64
+	for _, item := range sorted {
+		total += item.Size
+	}
+	maxBytes := int64(policy.MaxSizeMB) << 20
+	cutoff := now.AddDate(0, 0, -policy.MaxAgeDays)
+
+	var removed []Item
+	for _, item := range sorted {
+		tooOld := policy.MaxAgeDays > 0 && item.ModTime.Before(cutoff)
+		tooLarge := policy.MaxSizeMB > 0 && total > maxBytes
+		if !tooOld && !tooLarge {
+			break
+		}
+		removed = append(removed, item)
+		total -= item.Size
+	}
+	return removed
+}
+
+// diskSize returns the size of a file, or of the files below a directory
+func diskSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed while walking no longer count
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,125 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	items := []Item{
+		{ID: "new", Size: 1 << 20, ModTime: now.Add(-time.Hour)},
+		{ID: "old", Size: 1 << 20, ModTime: now.AddDate(0, 0, -40)},
+		{ID: "recent", Size: 2 << 20, ModTime: now.AddDate(0, 0, -2)},
+		{ID: "older", Size: 1 << 20, ModTime: now.AddDate(0, 0, -10)},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{name: "no limits", policy: Policy{}, want: nil},
+		{name: "age", policy: Policy{MaxAgeDays: 7}, want: []string{"old", "older"}},
+		{name: "size", policy: Policy{MaxSizeMB: 3}, want: []string{"old", "older"}},
+		{name: "size keeps the newest", policy: Policy{MaxSizeMB: 2}, want: []string{"old", "older", "recent"}},
+		{name: "age and size", policy: Policy{MaxAgeDays: 30, MaxSizeMB: 4}, want: []string{"old"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := expired(items, tt.policy, now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expired() = %+v, want %v", got, tt.want)
+			}
+			for i, id := range tt.want {
+				if got[i].ID != id {
+					t.Errorf("expired()[%d] = %s, want %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	snapshots := filepath.Join(dir, "snapshots")
+	now := time.Now()
+	files := map[string]time.Time{
+		"old.json":   now.AddDate(0, 0, -10),
+		"new.json":   now,
+		".tmp-1234":  now.AddDate(0, 0, -10),
+		"index.tmp":  now.AddDate(0, 0, -10),
+		"a/old.json": now.AddDate(0, 0, -10),
+	}
+	for name, modTime := range files {
+		path := filepath.Join(snapshots, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("snapshot"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Manager{settingsPath: filepath.Join(dir, settingsFileName), dir: dir, sources: map[string]Source{}}
+	m.Register("snapshots", DirSource(snapshots))
+	m.Register("missing", DirSource(filepath.Join(dir, "missing")))
+	if err := m.UpdateSettings(Settings{IntervalMinutes: 60, Policies: map[string]Policy{"unknown": {MaxAgeDays: 1}}}); err == nil {
+		t.Error("UpdateSettings() with an unknown type succeeded")
+	}
+	if err := m.UpdateSettings(Settings{IntervalMinutes: 60, Policies: map[string]Policy{"snapshots": {MaxAgeDays: 7}}}); err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+
+	results := m.Prune(context.Background())
+	if len(results) != 1 || results[0].Removed != 2 || results[0].FreedBytes != 16 || results[0].Error != "" {
+		t.Fatalf("Prune() = %+v, want 2 snapshots removed", results)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(snapshots, name))
+		if removed := name == "old.json" || name == "a/old.json"; removed != os.IsNotExist(err) {
+			t.Errorf("%s removed = %v, want %v", name, os.IsNotExist(err), removed)
+		}
+	}
+
+	usage, err := m.Usage(context.Background())
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	if len(usage.Types) != 2 || usage.Types[1].Type != "snapshots" || usage.Types[1].Items != 1 || usage.Types[0].Items != 0 {
+		t.Errorf("Usage().Types = %+v, want one snapshot and no missing items", usage.Types)
+	}
+	found := false
+	for _, path := range usage.Paths {
+		found = found || path == PathUsage{Path: "snapshots", Bytes: 24}
+	}
+	if !found || usage.TotalBytes <= 24 {
+		t.Errorf("Usage() = %+v, want the 24 bytes of snapshots and the settings", usage)
+	}
+}
+
+func TestDirSourceDelete(t *testing.T) {
+	t.Parallel()
+
+	source := DirSource(t.TempDir())
+	for _, id := range []string{"../escape", ".", ""} {
+		if err := source.Delete(context.Background(), id); err == nil {
+			t.Errorf("Delete(%q) succeeded", id)
+		}
+	}
+	if err := source.Delete(context.Background(), "gone.json"); err != nil {
+		t.Errorf("Delete() of a missing item error = %v", err)
+	}
+}
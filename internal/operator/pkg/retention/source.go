@@ -0,0 +1,58 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirSource keeps its items as the files below a directory, for stores without an index
+type dirSource struct {
+	dir string
+}
+
+// DirSource returns a source whose items are the files below dir, by their relative path
+func DirSource(dir string) Source {
+	return &dirSource{dir: dir}
+}
+
+func (s *dirSource) Items(_ context.Context) ([]Item, error) {
+	items := []Item{}
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Temporary files are being written
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp") || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		items = append(items, Item{ID: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return items, err
+}
+
+func (s *dirSource) Delete(_ context.Context, id string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(id))
+	if rel, err := filepath.Rel(s.dir, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("invalid item %q", id)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of workloads with rollouts, by resource name
+const (
+	KindDeployments  = "deployments"
+	KindStatefulSets = "statefulsets"
+	KindDaemonSets   = "daemonsets"
+)
+
+const (
+	// RestartedAtAnnotation is set on the pod template to restart a workload, like kubectl rollout restart
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	// ChangeCauseAnnotation describes the change that created a revision
+	ChangeCauseAnnotation = "kubernetes.io/change-cause"
+
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+var (
+	// ErrUnsupported is returned for kinds without rollouts, or operations the kind doesn't support
+	ErrUnsupported = errors.New("unsupported rollout operation")
+	// ErrRevisionNotFound is returned for undos to a revision the workload doesn't have
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrPaused is returned for restarts of paused deployments, they would only restart once resumed
+	ErrPaused = errors.New("deployment is paused, resume it first")
+)
+
+// Workload names the workload of a rollout
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Revision is a revision of the pod template of a workload
+type Revision struct {
+	Revision int64 `json:"revision"`
+	// Name of the ReplicaSet or ControllerRevision holding the revision
+	Name        string    `json:"name"`
+	ChangeCause string    `json:"changeCause,omitempty"`
+	Images      []string  `json:"images"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Current is the revision the workload rolls out
+	Current bool `json:"current"`
+}
+
+// Manager implements the kubectl rollout commands with the API of a cluster
+type Manager struct {
+	clientset kubernetes.Interface
+}
+
+// NewManager creates a rollout manager of the cluster of the clientset
+func NewManager(clientset kubernetes.Interface) *Manager {
+	return &Manager{clientset: clientset}
+}
+
+// Restart rolls out the pods of a workload again by setting the restartedAt annotation of its
+// pod template, returning when the restart was requested
+func (m *Manager) Restart(ctx context.Context, w Workload) (time.Time, error) {
+	if w.Kind == KindDeployments {
+		deployment, err := m.clientset.AppsV1().Deployments(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return time.Time{}, err
+		}
+		if deployment.Spec.Paused {
+			return time.Time{}, ErrPaused
+		}
+	}
+
+	restartedAt := time.Now().UTC().Truncate(time.Second)
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{RestartedAtAnnotation: restartedAt.Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	return restartedAt, m.patch(ctx, w, types.StrategicMergePatchType, patch)
+}
+
+// Pause stops the rollouts of a deployment, the changes of its template wait until it is resumed
+func (m *Manager) Pause(ctx context.Context, w Workload) error {
+	return m.setPaused(ctx, w, true)
+}
+
+// Resume rolls out the changes a paused deployment held back
+func (m *Manager) Resume(ctx context.Context, w Workload) error {
+	return m.setPaused(ctx, w, false)
+}
+
+func (m *Manager) setPaused(ctx context.Context, w Workload, paused bool) error {
+	if w.Kind != KindDeployments {
+		return fmt.Errorf("%w: only deployments can be paused and resumed", ErrUnsupported)
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"paused": paused}})
+	return m.patch(ctx, w, types.StrategicMergePatchType, patch)
+}
+
+// History lists the revisions of a workload, oldest first: the ReplicaSets of a deployment, the
+// ControllerRevisions of a StatefulSet or DaemonSet
+func (m *Manager) History(ctx context.Context, w Workload) ([]Revision, error) {
+	revisions, _, err := m.history(ctx, w)
+	return revisions, err
+}
+
+// Undo rolls a workload back to a revision, the one before the current when toRevision is 0,
+// returning the revision rolled back to
+func (m *Manager) Undo(ctx context.Context, w Workload, toRevision int64) (*Revision, error) {
+	revisions, templates, err := m.history(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+
+	target := -1
+	if toRevision == 0 {
+		for i := range revisions {
+			if revisions[i].Current && i > 0 {
+				target = i - 1
+			}
+		}
+		if target < 0 {
+			return nil, fmt.Errorf("%w: %s/%s has no previous revision", ErrRevisionNotFound, w.Namespace, w.Name)
+		}
+	} else {
+		for i := range revisions {
+			if revisions[i].Revision == toRevision {
+				target = i
+			}
+		}
+		if target < 0 {
+			return nil, fmt.Errorf("%w: %s/%s has no revision %d", ErrRevisionNotFound, w.Namespace, w.Name, toRevision)
+		}
+	}
+	if revisions[target].Current {
+		return &revisions[target], nil
+	}
+
+	if err := m.patch(ctx, w, types.StrategicMergePatchType, templates[target]); err != nil {
+		return nil, err
+	}
+	return &revisions[target], nil
+}
+
+// history returns the revisions of a workload with the patch restoring the template of each
+func (m *Manager) history(ctx context.Context, w Workload) ([]Revision, [][]byte, error) {
+	switch w.Kind {
+	case KindDeployments:
+		return m.deploymentHistory(ctx, w)
+	case KindStatefulSets:
+		statefulSet, err := m.clientset.AppsV1().StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		current := statefulSet.Status.UpdateRevision
+		return m.controllerRevisions(ctx, w.Namespace, statefulSet.UID, statefulSet.Spec.Selector, func(names []string) string { return current })
+	case KindDaemonSets:
+		daemonSet, err := m.clientset.AppsV1().DaemonSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		// DaemonSets don't report their revision, the latest one is rolled out
+		return m.controllerRevisions(ctx, w.Namespace, daemonSet.UID, daemonSet.Spec.Selector, func(names []string) string { return names[len(names)-1] })
+	}
+	return nil, nil, fmt.Errorf("%w: %s have no rollouts", ErrUnsupported, w.Kind)
+}
+
+func (m *Manager) deploymentHistory(ctx context.Context, w Workload) ([]Revision, [][]byte, error) {
+	deployment, err := m.clientset.AppsV1().Deployments(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid selector: %v", err)
+	}
+	replicaSets, err := m.clientset.AppsV1().ReplicaSets(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list replicasets: %v", err)
+	}
+
+	var owned []appsv1.ReplicaSet
+	for _, rs := range replicaSets.Items {
+		if owner := metav1.GetControllerOf(&rs); owner != nil && owner.UID == deployment.UID {
+			owned = append(owned, rs)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return revisionOf(owned[i].Annotations) < revisionOf(owned[j].Annotations) })
+
+	current := revisionOf(deployment.Annotations)
+	revisions := make([]Revision, 0, len(owned))
+	templates := make([][]byte, 0, len(owned))
+	for _, rs := range owned {
+		revision := revisionOf(rs.Annotations)
+		revisions = append(revisions, Revision{
+			Revision:    revision,
+			Name:        rs.Name,
+			ChangeCause: rs.Annotations[ChangeCauseAnnotation],
+			Images:      images(rs.Spec.Template.Spec),
+			CreatedAt:   rs.CreationTimestamp.Time,
+			Current:     revision == current,
+		})
+
+		// The hash label the deployment controller adds to the template of its ReplicaSets isn't
+		// part of the deployment template
+		template := rs.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{ChangeCauseAnnotation: changeCauseOrNull(rs.Annotations)},
+			},
+			"spec": map[string]interface{}{"template": template},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		templates = append(templates, patch)
+	}
+	return revisions, templates, nil
+}
+
+// controllerRevisions lists the revisions of a StatefulSet or DaemonSet, current picks the name of
+// the current revision from the names of all of them, oldest first
+func (m *Manager) controllerRevisions(ctx context.Context, namespace string, uid types.UID, labelSelector *metav1.LabelSelector, current func([]string) string) ([]Revision, [][]byte, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid selector: %v", err)
+	}
+	list, err := m.clientset.AppsV1().ControllerRevisions(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list controller revisions: %v", err)
+	}
+
+	var owned []appsv1.ControllerRevision
+	for _, cr := range list.Items {
+		if owner := metav1.GetControllerOf(&cr); owner != nil && owner.UID == uid {
+			owned = append(owned, cr)
+		}
+	}
+	if len(owned) == 0 {
+		return []Revision{}, nil, nil
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].Revision < owned[j].Revision })
+
+	names := make([]string, len(owned))
+	for i, cr := range owned {
+		names[i] = cr.Name
+	}
+	currentName := current(names)
+
+	revisions := make([]Revision, 0, len(owned))
+	templates := make([][]byte, 0, len(owned))
+	for _, cr := range owned {
+		// The data of a revision is the patch of the pod template the controller restores it with
+		var data struct {
+			Spec struct {
+				Template corev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(cr.Data.Raw, &data); err != nil {
+			return nil, nil, fmt.Errorf("invalid controller revision %s: %v", cr.Name, err)
+		}
+		revisions = append(revisions, Revision{
+			Revision:    cr.Revision,
+			Name:        cr.Name,
+			ChangeCause: cr.Annotations[ChangeCauseAnnotation],
+			Images:      images(data.Spec.Template.Spec),
+			CreatedAt:   cr.CreationTimestamp.Time,
+			Current:     cr.Name == currentName,
+		})
+		templates = append(templates, cr.Data.Raw)
+	}
+	return revisions, templates, nil
+}
+
+func (m *Manager) patch(ctx context.Context, w Workload, patchType types.PatchType, patch []byte) error {
+	var err error
+	switch w.Kind {
+	case KindDeployments:
+		_, err = m.clientset.AppsV1().Deployments(w.Namespace).Patch(ctx, w.Name, patchType, patch, metav1.PatchOptions{})
+	case KindStatefulSets:
+		_, err = m.clientset.AppsV1().StatefulSets(w.Namespace).Patch(ctx, w.Name, patchType, patch, metav1.PatchOptions{})
+	case KindDaemonSets:
+		_, err = m.clientset.AppsV1().DaemonSets(w.Namespace).Patch(ctx, w.Name, patchType, patch, metav1.PatchOptions{})
+	default:
+		return fmt.Errorf("%w: %s have no rollouts", ErrUnsupported, w.Kind)
+	}
+	return err
+}
+
+func revisionOf(annotations map[string]string) int64 {
+	revision, _ := strconv.ParseInt(annotations[revisionAnnotation], 10, 64)
+	return revision
+}
+
+// changeCauseOrNull returns the change cause of a revision, or nil to drop the one of the
+// deployment when the revision has none
+func changeCauseOrNull(annotations map[string]string) interface{} {
+	if cause, ok := annotations[ChangeCauseAnnotation]; ok {
+		return cause
+	}
+	return nil
+}
+
+func images(spec corev1.PodSpec) []string {
+	images := []string{}
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
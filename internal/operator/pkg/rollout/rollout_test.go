@@ -0,0 +1,157 @@
+package rollout
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var labels = map[string]string{"app": "web"}
+
+func template(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: image}}},
+	}
+}
+
+func owner(kind, uid string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: "web", UID: types.UID(uid), Controller: &controller}}
+}
+
+func testDeployment() (*appsv1.Deployment, []*appsv1.ReplicaSet) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid", Annotations: map[string]string{revisionAnnotation: "2"}},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: template("web:2"),
+		},
+	}
+	replicaSet := func(name, revision, image string) *appsv1.ReplicaSet {
+		tmpl := template(image)
+		tmpl.Labels = map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: name}
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "web-" + name, Namespace: "shop", Labels: labels, OwnerReferences: owner("Deployment", "web-uid"),
+				Annotations: map[string]string{revisionAnnotation: revision, ChangeCauseAnnotation: "deploy " + image},
+			},
+			Spec: appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}, Template: tmpl},
+		}
+	}
+	return deployment, []*appsv1.ReplicaSet{replicaSet("b", "2", "web:2"), replicaSet("a", "1", "web:1")}
+}
+
+func TestDeploymentRollout(t *testing.T) {
+	t.Parallel()
+
+	deployment, replicaSets := testDeployment()
+	// A ReplicaSet matching the selector that another deployment owns isn't a revision
+	stranger := replicaSets[1].DeepCopy()
+	stranger.Name, stranger.OwnerReferences[0].UID = "other", "other-uid"
+	clientset := fake.NewSimpleClientset(deployment, replicaSets[0], replicaSets[1], stranger)
+	manager := NewManager(clientset)
+	ctx := context.Background()
+	w := Workload{Kind: KindDeployments, Namespace: "shop", Name: "web"}
+
+	history, err := manager.History(ctx, w)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	var got []int64
+	for _, revision := range history {
+		got = append(got, revision.Revision)
+	}
+	if !reflect.DeepEqual(got, []int64{1, 2}) || !history[1].Current || history[0].ChangeCause != "deploy web:1" {
+		t.Fatalf("History() = %+v, want revisions 1 and 2, 2 current", history)
+	}
+
+	restartedAt, err := manager.Restart(ctx, w)
+	if err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	restarted, _ := clientset.AppsV1().Deployments("shop").Get(ctx, "web", metav1.GetOptions{})
+	if restarted.Spec.Template.Annotations[RestartedAtAnnotation] != restartedAt.Format(time.RFC3339) {
+		t.Errorf("template annotations = %v, want %s set", restarted.Spec.Template.Annotations, RestartedAtAnnotation)
+	}
+
+	revision, err := manager.Undo(ctx, w, 0)
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	undone, _ := clientset.AppsV1().Deployments("shop").Get(ctx, "web", metav1.GetOptions{})
+	if revision.Revision != 1 || undone.Spec.Template.Spec.Containers[0].Image != "web:1" {
+		t.Errorf("Undo() = revision %d image %s, want revision 1 image web:1", revision.Revision, undone.Spec.Template.Spec.Containers[0].Image)
+	}
+	if _, ok := undone.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+		t.Errorf("template labels = %v, want no pod-template-hash", undone.Spec.Template.Labels)
+	}
+	if _, err := manager.Undo(ctx, w, 7); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("Undo(7) error = %v, want ErrRevisionNotFound", err)
+	}
+
+	if err := manager.Pause(ctx, w); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if _, err := manager.Restart(ctx, w); !errors.Is(err, ErrPaused) {
+		t.Errorf("Restart() of a paused deployment error = %v, want ErrPaused", err)
+	}
+	if err := manager.Resume(ctx, w); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	resumed, _ := clientset.AppsV1().Deployments("shop").Get(ctx, "web", metav1.GetOptions{})
+	if resumed.Spec.Paused {
+		t.Errorf("deployment still paused after Resume()")
+	}
+}
+
+func TestStatefulSetRollout(t *testing.T) {
+	t.Parallel()
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "web-uid"},
+		Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}, Template: template("web:2")},
+		Status:     appsv1.StatefulSetStatus{UpdateRevision: "web-2"},
+	}
+	revision := func(name string, number int64, image string) *appsv1.ControllerRevision {
+		return &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: labels, OwnerReferences: owner("StatefulSet", "web-uid")},
+			Data: runtime.RawExtension{Raw: []byte(`{"spec":{"template":{"$patch":"replace","metadata":{"labels":{"app":"web"}},` +
+				`"spec":{"containers":[{"name":"web","image":"` + image + `"}]}}}}`)},
+			Revision: number,
+		}
+	}
+	clientset := fake.NewSimpleClientset(statefulSet, revision("web-2", 2, "web:2"), revision("web-1", 1, "web:1"))
+	manager := NewManager(clientset)
+	ctx := context.Background()
+	w := Workload{Kind: KindStatefulSets, Namespace: "shop", Name: "web"}
+
+	history, err := manager.History(ctx, w)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(history) != 2 || !history[1].Current || !reflect.DeepEqual(history[0].Images, []string{"web:1"}) {
+		t.Fatalf("History() = %+v, want revisions 1 and 2, 2 current", history)
+	}
+
+	if _, err := manager.Undo(ctx, w, 1); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	undone, _ := clientset.AppsV1().StatefulSets("shop").Get(ctx, "web", metav1.GetOptions{})
+	if image := undone.Spec.Template.Spec.Containers[0].Image; image != "web:1" {
+		t.Errorf("image = %s after Undo(1), want web:1", image)
+	}
+
+	if err := manager.Pause(ctx, w); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Pause() of a statefulset error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,295 @@
+package sbom
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	"github.com/agentkube/operator/pkg/vul"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ImageStatusCataloged = "cataloged"
+	ImageStatusPending   = "pending"
+	// ImageStatusUnavailable means the image scanner is disabled or not initialized
+	ImageStatusUnavailable = "unavailable"
+
+	listTimeout = 30 * time.Second
+)
+
+// Aggregator rolls the SBOMs of running images up to namespace and cluster level dependency inventories
+type Aggregator struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// Workload is a top-level controller running an image
+type Workload struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+// ImageSummary is an image found in the scope with the workloads running it
+type ImageSummary struct {
+	Image     string     `json:"image"`
+	Status    string     `json:"status"`
+	Packages  int        `json:"packages"`
+	Workloads []Workload `json:"workloads"`
+}
+
+// PackageUsage is a package version with every image and workload that includes it
+type PackageUsage struct {
+	vul.Package
+	Images    []string   `json:"images"`
+	Workloads []Workload `json:"workloads"`
+}
+
+// Inventory is the dependency inventory of a cluster or namespace
+type Inventory struct {
+	Cluster   string         `json:"cluster"`
+	Namespace string         `json:"namespace,omitempty"`
+	Images    []ImageSummary `json:"images"`
+	Packages  []PackageUsage `json:"packages"`
+	// Pending counts images whose SBOM is not available yet, the inventory is partial while it is non zero
+	Pending int `json:"pending"`
+}
+
+// SearchRequest looks for a package across clusters
+type SearchRequest struct {
+	Clusters  []string `json:"clusters"`
+	Namespace string   `json:"namespace"`
+	// Name matches package names case-insensitively as a substring, e.g. "log4j"
+	Name string `json:"name" binding:"required"`
+	// Version matches package versions as a prefix, e.g. "2." for every 2.x release
+	Version string `json:"version"`
+	// Type restricts matches to a package type such as java-archive or go-module
+	Type string `json:"type"`
+}
+
+// SearchResult lists the matching packages and the clusters that could not be searched
+type SearchResult struct {
+	Matches []PackageUsage    `json:"matches"`
+	Pending int               `json:"pending"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// NewAggregator creates a new SBOM aggregator
+func NewAggregator(kubeConfigStore kubeconfig.ContextStore) *Aggregator {
+	return &Aggregator{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// Inventory builds the dependency inventory of a cluster, optionally limited to a namespace.
+// Images without an SBOM are queued for cataloging and reported as pending.
+func (a *Aggregator) Inventory(clusterName, namespace string) (*Inventory, error) {
+	images, err := a.runningImages(clusterName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{
+		Cluster:   clusterName,
+		Namespace: namespace,
+		Images:    []ImageSummary{},
+	}
+	usages := map[string]*PackageUsage{}
+	for _, image := range sortedImages(images) {
+		summary := ImageSummary{Image: image, Workloads: images[image]}
+		packages, status := imagePackages(image)
+		summary.Status = status
+		summary.Packages = len(packages)
+		if status != ImageStatusCataloged {
+			inventory.Pending++
+		}
+		for _, p := range packages {
+			addUsage(usages, p, image, images[image])
+		}
+		inventory.Images = append(inventory.Images, summary)
+	}
+
+	inventory.Packages = sortedUsages(usages)
+	return inventory, nil
+}
+
+// Search finds the workloads including a package across clusters, or every known context when none are given
+func (a *Aggregator) Search(req SearchRequest) (*SearchResult, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("package name is required")
+	}
+
+	clusters := req.Clusters
+	if len(clusters) == 0 {
+		contexts, err := a.kubeConfigStore.GetContexts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, ctx := range contexts {
+			clusters = append(clusters, ctx.Name)
+		}
+	}
+
+	result := &SearchResult{Errors: map[string]string{}}
+	usages := map[string]*PackageUsage{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, clusterName := range clusters {
+		wg.Add(1)
+		go func(clusterName string) {
+			defer wg.Done()
+
+			images, err := a.runningImages(clusterName, req.Namespace)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				result.Errors[clusterName] = err.Error()
+				return
+			}
+			for image, workloads := range images {
+				packages, status := imagePackages(image)
+				if status != ImageStatusCataloged {
+					result.Pending++
+				}
+				for _, p := range packages {
+					if req.matches(p) {
+						addUsage(usages, p, image, workloads)
+					}
+				}
+			}
+		}(clusterName)
+	}
+	wg.Wait()
+
+	result.Matches = sortedUsages(usages)
+	return result, nil
+}
+
+func (r SearchRequest) matches(p vul.Package) bool {
+	if !strings.Contains(strings.ToLower(p.Name), strings.ToLower(strings.TrimSpace(r.Name))) {
+		return false
+	}
+	if r.Version != "" && !strings.HasPrefix(p.Version, r.Version) {
+		return false
+	}
+	return r.Type == "" || p.Type == r.Type
+}
+
+// runningImages maps every image running in the scope to the workloads using it
+func (a *Aggregator) runningImages(clusterName, namespace string) (map[string][]Workload, error) {
+	kubeContext, err := a.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	images := map[string][]Workload{}
+	seen := map[string]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		kind, name := utils.WorkloadOf(pod, replicaSetOwners)
+		workload := Workload{Cluster: clusterName, Namespace: pod.Namespace, Kind: kind, Name: name}
+
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			key := container.Image + "|" + workload.Namespace + "/" + kind + "/" + name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			images[container.Image] = append(images[container.Image], workload)
+		}
+	}
+
+	if vul.ImgScanner != nil && vul.ImgScanner.IsEnabled() {
+		var missing []string
+		for image := range images {
+			if _, ok := vul.ImgScanner.GetScan(image); !ok {
+				missing = append(missing, image)
+			}
+		}
+		if len(missing) > 0 {
+			vul.ImgScanner.Enqueue(context.Background(), missing...)
+		}
+	}
+
+	return images, nil
+}
+
+// imagePackages returns the SBOM of an image from the image scanner cache
+func imagePackages(image string) ([]vul.Package, string) {
+	if vul.ImgScanner == nil || !vul.ImgScanner.IsEnabled() {
+		return nil, ImageStatusUnavailable
+	}
+	packages, ok := vul.ImgScanner.GetPackages(image)
+	if !ok {
+		return nil, ImageStatusPending
+	}
+	return packages, ImageStatusCataloged
+}
+
+func addUsage(usages map[string]*PackageUsage, p vul.Package, image string, workloads []Workload) {
+	key := p.Type + "|" + p.Name + "|" + p.Version
+	usage, ok := usages[key]
+	if !ok {
+		usage = &PackageUsage{Package: p}
+		usages[key] = usage
+	}
+	for _, existing := range usage.Images {
+		if existing == image {
+			return
+		}
+	}
+	usage.Images = append(usage.Images, image)
+	usage.Workloads = append(usage.Workloads, workloads...)
+}
+
+func sortedImages(images map[string][]Workload) []string {
+	names := make([]string, 0, len(images))
+	for image := range images {
+		names = append(names, image)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedUsages(usages map[string]*PackageUsage) []PackageUsage {
+	list := make([]PackageUsage, 0, len(usages))
+	for _, usage := range usages {
+		sort.Strings(usage.Images)
+		list = append(list, *usage)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
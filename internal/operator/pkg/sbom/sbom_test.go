@@ -0,0 +1,82 @@
+package sbom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/vul"
+)
+
+func TestAggregateUsages(t *testing.T) {
+	t.Parallel()
+
+	api := Workload{Cluster: "prod", Namespace: "shop", Kind: "Deployment", Name: "api"}
+	worker := Workload{Cluster: "prod", Namespace: "shop", Kind: "Deployment", Name: "worker"}
+	log4j := vul.Package{Name: "log4j-core", Version: "2.14.1", Type: "java-archive"}
+	openssl := vul.Package{Name: "openssl", Version: "3.0.2", Type: "deb"}
+
+	usages := map[string]*PackageUsage{}
+	addUsage(usages, log4j, "shop/api:2", []Workload{api})
+	addUsage(usages, openssl, "shop/api:2", []Workload{api})
+	addUsage(usages, log4j, "shop/worker:1", []Workload{worker})
+	// The same image seen again, e.g. from a second cluster pass, adds nothing
+	addUsage(usages, log4j, "shop/api:2", []Workload{api})
+
+	want := []PackageUsage{
+		{Package: log4j, Images: []string{"shop/api:2", "shop/worker:1"}, Workloads: []Workload{api, worker}},
+		{Package: openssl, Images: []string{"shop/api:2"}, Workloads: []Workload{api}},
+	}
+	if got := sortedUsages(usages); !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedUsages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSortedUsagesOrdersVersions(t *testing.T) {
+	t.Parallel()
+
+	usages := map[string]*PackageUsage{}
+	addUsage(usages, vul.Package{Name: "zlib", Version: "1.3"}, "a", nil)
+	addUsage(usages, vul.Package{Name: "openssl", Version: "3.0.2"}, "a", nil)
+	addUsage(usages, vul.Package{Name: "openssl", Version: "1.1.1"}, "b", nil)
+
+	var got []string
+	for _, usage := range sortedUsages(usages) {
+		got = append(got, usage.Name+"@"+usage.Version)
+	}
+	want := []string{"openssl@1.1.1", "openssl@3.0.2", "zlib@1.3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedUsages() = %v, want %v", got, want)
+	}
+}
+
+func TestSearchRequestMatches(t *testing.T) {
+	t.Parallel()
+
+	log4j := vul.Package{Name: "log4j-core", Version: "2.14.1", Type: "java-archive"}
+
+	tests := []struct {
+		name string
+		req  SearchRequest
+		want bool
+	}{
+		{"substring", SearchRequest{Name: "log4j"}, true},
+		{"case insensitive", SearchRequest{Name: "LOG4J"}, true},
+		{"surrounding spaces", SearchRequest{Name: " log4j "}, true},
+		{"other package", SearchRequest{Name: "openssl"}, false},
+		{"version prefix", SearchRequest{Name: "log4j", Version: "2."}, true},
+		{"other version", SearchRequest{Name: "log4j", Version: "2.17"}, false},
+		{"type", SearchRequest{Name: "log4j", Type: "java-archive"}, true},
+		{"other type", SearchRequest{Name: "log4j", Type: "go-module"}, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.req.matches(log4j); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
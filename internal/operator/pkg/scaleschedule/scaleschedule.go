@@ -0,0 +1,492 @@
+package scaleschedule
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+
+	OverrideSuspend  = "suspend"  // keep workloads at their normal size until the override expires
+	OverrideActivate = "activate" // apply the scaled size now regardless of the windows
+
+	// OriginalReplicasAnnotation records the replica count to restore when a window ends
+	OriginalReplicasAnnotation = "agentkube.io/scheduled-scaling-original-replicas"
+	// ProfileAnnotation records which profile scaled the workload
+	ProfileAnnotation = "agentkube.io/scheduled-scaling-profile"
+	// ExcludeLabel opts a workload out of namespace-wide profiles
+	ExcludeLabel = "agentkube.io/scheduled-scaling-exclude"
+
+	storeFileName = "scaling-schedules.json"
+)
+
+var (
+	timeOfDayPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	namePattern      = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
+	weekdays         = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+)
+
+// Profile scales a workload, or every workload in a namespace, during time windows
+type Profile struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// Kind and Workload select a single workload, leave Workload empty to target the whole namespace
+	Kind     string `json:"kind,omitempty"`
+	Workload string `json:"workload,omitempty"`
+	// Exclusions are workload names skipped by namespace-wide profiles
+	Exclusions []string `json:"exclusions,omitempty"`
+	Windows    []Window `json:"windows"`
+	Timezone   string   `json:"timezone,omitempty"`
+	// HolidayCalendars name calendars whose dates are treated as one window spanning the whole day
+	HolidayCalendars []string  `json:"holidayCalendars,omitempty"`
+	HolidayReplicas  int32     `json:"holidayReplicas"`
+	Enabled          bool      `json:"enabled"`
+	Override         *Override `json:"override,omitempty"`
+	Status           Status    `json:"status"`
+}
+
+// Window is a recurring weekly time range during which workloads run at Replicas
+type Window struct {
+	Days []string `json:"days"` // mon, tue, ... sun
+	// Start and End are "HH:MM" in the profile timezone, an End before Start wraps past midnight
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Replicas int32  `json:"replicas"`
+}
+
+// Override temporarily replaces the schedule of a profile
+type Override struct {
+	Mode     string    `json:"mode"`
+	Replicas int32     `json:"replicas"`
+	Until    time.Time `json:"until"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Status tracks what the scheduler last did for a profile
+type Status struct {
+	Active          bool       `json:"active"`
+	Replicas        int32      `json:"replicas"`
+	Reason          string     `json:"reason,omitempty"`
+	LastTransition  *time.Time `json:"lastTransition,omitempty"`
+	LastOperationID string     `json:"lastOperationId,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+}
+
+// HolidayCalendar is a named list of dates in YYYY-MM-DD form
+type HolidayCalendar struct {
+	Name  string   `json:"name"`
+	Dates []string `json:"dates"`
+}
+
+type storeData struct {
+	Profiles  []Profile         `json:"profiles"`
+	Calendars []HolidayCalendar `json:"calendars"`
+}
+
+// desiredState is the outcome of evaluating a profile at a point in time
+type desiredState struct {
+	active   bool
+	replicas int32
+	reason   string
+}
+
+// Manager stores scaling profiles and runs the scheduler that applies them
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	filePath        string
+	mutex           sync.Mutex
+	stopChan        chan struct{}
+}
+
+// NewManager creates a new scheduled scaling manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		filePath:        filepath.Join(utils.ConfigDir(), storeFileName),
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// ListProfiles returns all profiles
+func (m *Manager) ListProfiles() ([]Profile, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	return data.Profiles, nil
+}
+
+// GetProfile returns a profile by name
+func (m *Manager) GetProfile(name string) (*Profile, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range data.Profiles {
+		if data.Profiles[i].Name == name {
+			return &data.Profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("scaling profile %q not found", name)
+}
+
+// SaveProfile creates or replaces a profile, keeping the status of an existing one
+func (m *Manager) SaveProfile(profile Profile) (*Profile, error) {
+	if err := m.validateProfile(&profile); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	data, err := m.load()
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+
+	replaced := false
+	for i := range data.Profiles {
+		if data.Profiles[i].Name == profile.Name {
+			profile.Status = data.Profiles[i].Status
+			if profile.Override == nil {
+				profile.Override = data.Profiles[i].Override
+			}
+			data.Profiles[i] = profile
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		profile.Status = Status{}
+		data.Profiles = append(data.Profiles, profile)
+	}
+
+	err = m.save(data)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	m.Reconcile()
+	return &profile, nil
+}
+
+// DeleteProfile removes a profile, restoring its workloads first if it is active or about to be
+func (m *Manager) DeleteProfile(name string) error {
+	profile, err := m.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	if applied := m.cancelApplies(name); profile.Status.Active || applied {
+		m.queue.AddOperation(OperationRevert, profile.Cluster, "system", map[string]interface{}{
+			"profile": *profile,
+		}, []string{"scheduled-scaling", profile.Name})
+	}
+
+	return m.update(name, func(data *storeData, index int) {
+		data.Profiles = append(data.Profiles[:index], data.Profiles[index+1:]...)
+	})
+}
+
+// cancelApplies cancels the pending apply operations of a profile and reports whether any were
+// pending or running. A pending apply may be a retry that already scaled some workloads down.
+func (m *Manager) cancelApplies(name string) bool {
+	found := false
+	for _, op := range m.queue.ListOperations(map[string]string{"type": OperationApply, "tag": name}) {
+		switch op.Status {
+		case utils.StatusPending:
+			m.queue.CancelOperation(op.ID)
+			found = true
+		case utils.StatusRunning:
+			found = true
+		}
+	}
+	return found
+}
+
+// SetOverride installs a manual override on a profile and reconciles it immediately
+func (m *Manager) SetOverride(name string, override Override) (*Profile, error) {
+	if override.Mode != OverrideSuspend && override.Mode != OverrideActivate {
+		return nil, fmt.Errorf("unsupported override mode %q, expected %q or %q", override.Mode, OverrideSuspend, OverrideActivate)
+	}
+	if override.Replicas < 0 {
+		return nil, fmt.Errorf("override replicas cannot be negative")
+	}
+	if !override.Until.After(time.Now()) {
+		return nil, fmt.Errorf("override must end in the future")
+	}
+
+	if err := m.update(name, func(data *storeData, index int) {
+		data.Profiles[index].Override = &override
+	}); err != nil {
+		return nil, err
+	}
+
+	m.Reconcile()
+	return m.GetProfile(name)
+}
+
+// ClearOverride removes the manual override of a profile
+func (m *Manager) ClearOverride(name string) (*Profile, error) {
+	if err := m.update(name, func(data *storeData, index int) {
+		data.Profiles[index].Override = nil
+	}); err != nil {
+		return nil, err
+	}
+
+	m.Reconcile()
+	return m.GetProfile(name)
+}
+
+// ListCalendars returns all holiday calendars
+func (m *Manager) ListCalendars() ([]HolidayCalendar, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	return data.Calendars, nil
+}
+
+// SaveCalendar creates or replaces a holiday calendar
+func (m *Manager) SaveCalendar(calendar HolidayCalendar) error {
+	if !namePattern.MatchString(calendar.Name) {
+		return fmt.Errorf("calendar name can only contain letters, numbers, hyphens, and underscores")
+	}
+	for _, date := range calendar.Dates {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid holiday date %q, expected YYYY-MM-DD", date)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return err
+	}
+	for i := range data.Calendars {
+		if data.Calendars[i].Name == calendar.Name {
+			data.Calendars[i] = calendar
+			return m.save(data)
+		}
+	}
+	data.Calendars = append(data.Calendars, calendar)
+	return m.save(data)
+}
+
+// DeleteCalendar removes a holiday calendar
+func (m *Manager) DeleteCalendar(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return err
+	}
+	for _, profile := range data.Profiles {
+		for _, calendar := range profile.HolidayCalendars {
+			if calendar == name {
+				return fmt.Errorf("calendar %q is used by profile %q", name, profile.Name)
+			}
+		}
+	}
+	for i := range data.Calendars {
+		if data.Calendars[i].Name == name {
+			data.Calendars = append(data.Calendars[:i], data.Calendars[i+1:]...)
+			return m.save(data)
+		}
+	}
+	return fmt.Errorf("calendar %q not found", name)
+}
+
+// GetQueue returns the operation queue used by the manager
+func (m *Manager) GetQueue() *utils.Queue {
+	return m.queue
+}
+
+// update applies fn to the named profile and persists the result
+func (m *Manager) update(name string, fn func(data *storeData, index int)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		return err
+	}
+	for i := range data.Profiles {
+		if data.Profiles[i].Name == name {
+			fn(data, i)
+			return m.save(data)
+		}
+	}
+	return fmt.Errorf("scaling profile %q not found", name)
+}
+
+func (m *Manager) load() (*storeData, error) {
+	data := &storeData{Profiles: []Profile{}, Calendars: []HolidayCalendar{}}
+	if err := utils.ReadJSONFile(m.filePath, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (m *Manager) save(data *storeData) error {
+	return utils.WriteJSONFile(m.filePath, data)
+}
+
+func (m *Manager) validateProfile(profile *Profile) error {
+	if !namePattern.MatchString(profile.Name) {
+		return fmt.Errorf("profile name can only contain letters, numbers, hyphens, and underscores")
+	}
+	if profile.Cluster == "" || profile.Namespace == "" {
+		return fmt.Errorf("cluster and namespace are required")
+	}
+	if _, err := m.kubeConfigStore.GetContext(profile.Cluster); err != nil {
+		return fmt.Errorf("context not found: %w", err)
+	}
+
+	if profile.Workload != "" {
+		if profile.Kind == "" {
+			profile.Kind = KindDeployment
+		}
+		if profile.Kind != KindDeployment && profile.Kind != KindStatefulSet {
+			return fmt.Errorf("unsupported kind %q, expected %q or %q", profile.Kind, KindDeployment, KindStatefulSet)
+		}
+	}
+
+	if profile.Timezone == "" {
+		profile.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(profile.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", profile.Timezone, err)
+	}
+
+	if len(profile.Windows) == 0 && len(profile.HolidayCalendars) == 0 {
+		return fmt.Errorf("at least one window or holiday calendar is required")
+	}
+	for i, window := range profile.Windows {
+		if len(window.Days) == 0 {
+			return fmt.Errorf("window %d: at least one day is required", i)
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("window %d: invalid day %q", i, day)
+			}
+		}
+		if !timeOfDayPattern.MatchString(window.Start) || !timeOfDayPattern.MatchString(window.End) {
+			return fmt.Errorf("window %d: start and end must be in HH:MM form", i)
+		}
+		if window.Start == window.End {
+			return fmt.Errorf("window %d: start and end must differ", i)
+		}
+		if window.Replicas < 0 {
+			return fmt.Errorf("window %d: replicas cannot be negative", i)
+		}
+	}
+	if profile.HolidayReplicas < 0 {
+		return fmt.Errorf("holiday replicas cannot be negative")
+	}
+
+	return nil
+}
+
+// evaluate decides whether the profile should be active at now
+func evaluate(profile *Profile, calendars []HolidayCalendar, now time.Time) desiredState {
+	if override := profile.Override; override != nil && now.Before(override.Until) {
+		if override.Mode == OverrideSuspend {
+			return desiredState{active: false, reason: "suspended by override"}
+		}
+		return desiredState{active: true, replicas: override.Replicas, reason: "activated by override"}
+	}
+
+	location, err := time.LoadLocation(profile.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	date := local.Format("2006-01-02")
+	for _, name := range profile.HolidayCalendars {
+		for _, calendar := range calendars {
+			if calendar.Name != name {
+				continue
+			}
+			for _, holiday := range calendar.Dates {
+				if holiday == date {
+					return desiredState{active: true, replicas: profile.HolidayReplicas, reason: "holiday in calendar " + name}
+				}
+			}
+		}
+	}
+
+	minutes := local.Hour()*60 + local.Minute()
+	for _, window := range profile.Windows {
+		if windowContains(window, local.Weekday(), minutes) {
+			return desiredState{
+				active:   true,
+				replicas: window.Replicas,
+				reason:   fmt.Sprintf("window %s %s-%s", strings.Join(window.Days, ","), window.Start, window.End),
+			}
+		}
+	}
+
+	return desiredState{active: false, reason: "outside scheduled windows"}
+}
+
+// windowContains reports whether the weekday and minute of day fall inside the window
+func windowContains(window Window, weekday time.Weekday, minutes int) bool {
+	start := parseTimeOfDay(window.Start)
+	end := parseTimeOfDay(window.End)
+	previous := (weekday + 6) % 7
+
+	for _, day := range window.Days {
+		d, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			continue
+		}
+		if start < end {
+			if d == weekday && minutes >= start && minutes < end {
+				return true
+			}
+			continue
+		}
+		// The window wraps past midnight into the following day
+		if (d == weekday && minutes >= start) || (d == previous && minutes < end) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTimeOfDay(value string) int {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,67 @@
+package scaleschedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	profile := &Profile{
+		Name:     "dev-nights",
+		Timezone: "UTC",
+		Windows: []Window{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "20:00", End: "07:00", Replicas: 0},
+			{Days: []string{"sat", "sun"}, Start: "00:00", End: "23:59", Replicas: 1},
+		},
+		HolidayCalendars: []string{"company"},
+		HolidayReplicas:  0,
+	}
+	calendars := []HolidayCalendar{{Name: "company", Dates: []string{"2026-12-25"}}}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		active   bool
+		replicas int32
+	}{
+		{"weekday daytime", time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC), false, 0},
+		{"weekday evening", time.Date(2026, 10, 14, 21, 0, 0, 0, time.UTC), true, 0},
+		{"wrapped into next morning", time.Date(2026, 10, 15, 6, 59, 0, 0, time.UTC), true, 0},
+		{"wrapped window ends", time.Date(2026, 10, 15, 7, 0, 0, 0, time.UTC), false, 0},
+		{"saturday", time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), true, 1},
+		{"holiday", time.Date(2026, 12, 25, 12, 0, 0, 0, time.UTC), true, 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			got := evaluate(profile, calendars, test.now)
+			if got.active != test.active || got.replicas != test.replicas {
+				t.Errorf("evaluate() = active %v replicas %d, want active %v replicas %d (%s)",
+					got.active, got.replicas, test.active, test.replicas, got.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateOverride(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 14, 21, 0, 0, 0, time.UTC)
+	profile := &Profile{
+		Timezone: "UTC",
+		Windows:  []Window{{Days: []string{"wed"}, Start: "20:00", End: "22:00", Replicas: 0}},
+		Override: &Override{Mode: OverrideSuspend, Until: now.Add(time.Hour)},
+	}
+
+	if got := evaluate(profile, nil, now); got.active {
+		t.Errorf("suspended profile should not be active")
+	}
+
+	profile.Override.Until = now.Add(-time.Minute)
+	if got := evaluate(profile, nil, now); !got.active {
+		t.Errorf("expired override should fall back to the schedule")
+	}
+}
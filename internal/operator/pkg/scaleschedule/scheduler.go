@@ -0,0 +1,492 @@
+package scaleschedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/agentkube/operator/pkg/hibernation"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/readonly"
+	"github.com/agentkube/operator/pkg/utils"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	OperationApply  = "scheduled-scale-apply"
+	OperationRevert = "scheduled-scale-revert"
+
+	reconcileInterval = time.Minute
+	// applyWaitTimeout bounds how long a revert waits for a running apply of the same profile
+	applyWaitTimeout = 2 * time.Minute
+)
+
+// workloadRef identifies a scalable workload
+type workloadRef struct {
+	kind        string
+	name        string
+	replicas    int32
+	annotations map[string]string
+	// excluded is set when the workload opts out of namespace-wide profiles with ExcludeLabel
+	excluded bool
+}
+
+// Start runs the scheduler loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+
+		m.Reconcile()
+		for {
+			select {
+			case <-ticker.C:
+				m.Reconcile()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Reconcile queues apply or revert operations for profiles whose desired state changed
+func (m *Manager) Reconcile() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, err := m.load()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load scaling profiles")
+		return
+	}
+
+	now := time.Now()
+	changed := false
+	for i := range data.Profiles {
+		profile := &data.Profiles[i]
+
+		// Expired overrides are dropped so the schedule takes over again
+		if profile.Override != nil && !now.Before(profile.Override.Until) {
+			profile.Override = nil
+			changed = true
+		}
+
+		if profile.Status.LastOperationID != "" {
+			if op, exists := m.queue.GetOperation(profile.Status.LastOperationID); exists &&
+				(op.Status == utils.StatusPending || op.Status == utils.StatusRunning) {
+				continue
+			}
+		}
+
+		// A wake restores the replica counts recorded at hibernation, scaling meanwhile would be lost
+		if hibernated, err := hibernation.IsHibernated(profile.Cluster, profile.Namespace); err != nil || hibernated {
+			if err != nil {
+				logger.Log(logger.LevelWarn, map[string]string{"profile": profile.Name}, err, "Failed to check hibernation state")
+			}
+			continue
+		}
+
+		desired := desiredState{active: false, reason: "profile disabled"}
+		if profile.Enabled {
+			desired = evaluate(profile, data.Calendars, now)
+		}
+
+		if desired.active == profile.Status.Active && (!desired.active || desired.replicas == profile.Status.Replicas) {
+			continue
+		}
+
+		operationType := OperationRevert
+		if desired.active {
+			operationType = OperationApply
+		}
+
+		op := m.queue.AddOperation(operationType, profile.Cluster, "scheduler", map[string]interface{}{
+			"profile":  *profile,
+			"replicas": desired.replicas,
+			"reason":   desired.reason,
+		}, []string{"scheduled-scaling", profile.Name})
+
+		profile.Status.LastOperationID = op.ID
+		changed = true
+
+		logger.Log(logger.LevelInfo, map[string]string{
+			"profile":     profile.Name,
+			"cluster":     profile.Cluster,
+			"namespace":   profile.Namespace,
+			"operation":   operationType,
+			"reason":      desired.reason,
+			"operationId": op.ID,
+		}, nil, "Queued scheduled scaling operation")
+	}
+
+	if changed {
+		if err := m.save(data); err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to save scaling profiles")
+		}
+	}
+}
+
+// recordResult stores the outcome of an apply or revert operation on the profile status
+func (m *Manager) recordResult(name string, active bool, replicas int32, reason string, opErr error) {
+	err := m.update(name, func(data *storeData, index int) {
+		status := &data.Profiles[index].Status
+		if opErr != nil {
+			status.LastError = opErr.Error()
+			return
+		}
+		now := time.Now()
+		status.Active = active
+		status.Replicas = replicas
+		status.Reason = reason
+		status.LastTransition = &now
+		status.LastError = ""
+	})
+	if err != nil {
+		// The profile may have been deleted while the operation ran
+		logger.Log(logger.LevelWarn, map[string]string{"profile": name}, err, "Failed to record scheduled scaling result")
+	}
+}
+
+// ScalingProcessor executes scheduled scaling operations
+type ScalingProcessor struct {
+	manager *Manager
+}
+
+// NewScalingProcessor creates a new scheduled scaling processor
+func NewScalingProcessor(manager *Manager) *ScalingProcessor {
+	return &ScalingProcessor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes scheduled scaling operations
+func (p *ScalingProcessor) ProcessOperation(op *utils.Operation) error {
+	profile, err := profileFromOperation(op)
+	if err != nil {
+		return utils.NonRetryable(fmt.Errorf("invalid scheduled scaling operation: %w", err))
+	}
+	reason, _ := op.Data["reason"].(string)
+
+	if err := readonly.Check(profile.Cluster); err != nil {
+		p.manager.recordResult(profile.Name, false, 0, reason, err)
+		return utils.NonRetryable(err)
+	}
+	// Operations queued before the namespace was hibernated must not touch it
+	hibernated, err := hibernation.IsHibernated(profile.Cluster, profile.Namespace)
+	if err == nil && hibernated {
+		err = utils.NonRetryable(fmt.Errorf("namespace %s of cluster %s is hibernated", profile.Namespace, profile.Cluster))
+	}
+	if err != nil {
+		p.manager.recordResult(profile.Name, false, 0, reason, err)
+		return err
+	}
+
+	clientset, err := p.getKubernetesClient(profile.Cluster)
+	if err != nil {
+		p.manager.recordResult(profile.Name, false, 0, reason, err)
+		return err
+	}
+
+	switch op.Type {
+	case OperationApply:
+		replicas := replicasFromOperation(op)
+		err = p.apply(op, clientset, profile, replicas)
+		p.manager.recordResult(profile.Name, true, replicas, reason, err)
+	case OperationRevert:
+		err = p.revert(op, clientset, profile)
+		p.manager.recordResult(profile.Name, false, 0, reason, err)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+
+	return err
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *ScalingProcessor) CanProcess(operationType string) bool {
+	return operationType == OperationApply || operationType == OperationRevert
+}
+
+// apply records the current size of each target and scales it to replicas
+func (p *ScalingProcessor) apply(op *utils.Operation, clientset *kubernetes.Clientset, profile *Profile, replicas int32) error {
+	ctx := context.Background()
+	workloads, err := targetWorkloads(ctx, clientset, profile)
+	if err != nil {
+		return err
+	}
+
+	for i, workload := range workloads {
+		// A profile deleted meanwhile has a revert queued, stop scaling down
+		if _, err := p.manager.GetProfile(profile.Name); err != nil {
+			return utils.NonRetryable(fmt.Errorf("profile %s was removed while scaling", profile.Name))
+		}
+
+		p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 10+80*i/len(workloads),
+			fmt.Sprintf("Scaling %s %s to %d", workload.kind, workload.name, replicas), nil)
+
+		annotations := map[string]string{ProfileAnnotation: profile.Name}
+		if _, recorded := workload.annotations[OriginalReplicasAnnotation]; !recorded {
+			annotations[OriginalReplicasAnnotation] = strconv.Itoa(int(workload.replicas))
+		}
+		if err := setAnnotations(ctx, clientset, profile.Namespace, workload.kind, workload.name, annotations); err != nil {
+			return fmt.Errorf("failed to record replicas of %s %s: %w", workload.kind, workload.name, err)
+		}
+		if err := scaleWorkload(ctx, clientset, profile.Namespace, workload.kind, workload.name, replicas); err != nil {
+			return fmt.Errorf("failed to scale %s %s: %w", workload.kind, workload.name, err)
+		}
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("Scaled %d workloads to %d replicas", len(workloads), replicas), nil)
+	return nil
+}
+
+// revert restores every workload scaled by the profile to its recorded size. It finds them by
+// their annotations, so workloads excluded after they were scaled down are restored as well.
+func (p *ScalingProcessor) revert(op *utils.Operation, clientset *kubernetes.Clientset, profile *Profile) error {
+	p.waitForApplies(profile.Name)
+
+	ctx := context.Background()
+	workloads, err := listWorkloads(ctx, clientset, profile.Namespace)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, workload := range workloads {
+		if workload.annotations[ProfileAnnotation] != profile.Name {
+			continue
+		}
+
+		original, err := strconv.Atoi(workload.annotations[OriginalReplicasAnnotation])
+		if err == nil {
+			p.manager.queue.UpdateOperation(op.ID, utils.StatusRunning, 50,
+				fmt.Sprintf("Restoring %s %s to %d", workload.kind, workload.name, original), nil)
+			if err := scaleWorkload(ctx, clientset, profile.Namespace, workload.kind, workload.name, int32(original)); err != nil {
+				return fmt.Errorf("failed to restore %s %s: %w", workload.kind, workload.name, err)
+			}
+		}
+		if err := setAnnotations(ctx, clientset, profile.Namespace, workload.kind, workload.name, map[string]string{
+			ProfileAnnotation:          "",
+			OriginalReplicasAnnotation: "",
+		}); err != nil {
+			return fmt.Errorf("failed to clear annotations of %s %s: %w", workload.kind, workload.name, err)
+		}
+		restored++
+	}
+
+	p.manager.queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, fmt.Sprintf("Restored %d workloads", restored), nil)
+	return nil
+}
+
+// waitForApplies waits for a running apply of the profile to finish so the revert sees every
+// workload it scaled
+func (p *ScalingProcessor) waitForApplies(name string) {
+	deadline := time.Now().Add(applyWaitTimeout)
+	for time.Now().Before(deadline) {
+		running := p.manager.queue.ListOperations(map[string]string{
+			"type":   OperationApply,
+			"tag":    name,
+			"status": string(utils.StatusRunning),
+		})
+		if len(running) == 0 {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// getKubernetesClient creates a kubernetes client for the given cluster
+func (p *ScalingProcessor) getKubernetesClient(clusterName string) (*kubernetes.Clientset, error) {
+	ctx, err := p.manager.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("context not found: %w", err)
+	}
+
+	clientset, err := ctx.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	return clientset, nil
+}
+
+// targetWorkloads resolves the workloads a profile applies to
+func targetWorkloads(ctx context.Context, clientset *kubernetes.Clientset, profile *Profile) ([]workloadRef, error) {
+	all, err := listWorkloads(ctx, clientset, profile.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{}
+	for _, name := range profile.Exclusions {
+		excluded[name] = true
+	}
+
+	var targets []workloadRef
+	for _, workload := range all {
+		if profile.Workload != "" {
+			if workload.kind == profile.Kind && workload.name == profile.Workload {
+				return []workloadRef{workload}, nil
+			}
+			continue
+		}
+		if excluded[workload.name] || workload.excluded {
+			continue
+		}
+		// Workloads already owned by another profile are left to it
+		if owner := workload.annotations[ProfileAnnotation]; owner != "" && owner != profile.Name {
+			continue
+		}
+		targets = append(targets, workload)
+	}
+
+	if profile.Workload != "" {
+		return nil, fmt.Errorf("%s %s/%s not found", profile.Kind, profile.Namespace, profile.Workload)
+	}
+	return targets, nil
+}
+
+// listWorkloads lists the deployments and statefulsets of a namespace
+func listWorkloads(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]workloadRef, error) {
+	var workloads []workloadRef
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deployment := range deployments.Items {
+		workloads = append(workloads, workloadRef{
+			kind:        KindDeployment,
+			name:        deployment.Name,
+			replicas:    replicasOrDefault(deployment.Spec.Replicas),
+			annotations: deployment.Annotations,
+			excluded:    deployment.Labels[ExcludeLabel] == "true",
+		})
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		workloads = append(workloads, workloadRef{
+			kind:        KindStatefulSet,
+			name:        statefulSet.Name,
+			replicas:    replicasOrDefault(statefulSet.Spec.Replicas),
+			annotations: statefulSet.Annotations,
+			excluded:    statefulSet.Labels[ExcludeLabel] == "true",
+		})
+	}
+
+	return workloads, nil
+}
+
+func scaleWorkload(ctx context.Context, clientset *kubernetes.Clientset, namespace, kind, name string, replicas int32) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var scale *autoscalingv1.Scale
+		var err error
+		if kind == KindStatefulSet {
+			scale, err = clientset.AppsV1().StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		} else {
+			scale, err = clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		}
+		if err != nil {
+			return err
+		}
+
+		scale.Spec.Replicas = replicas
+		if kind == KindStatefulSet {
+			_, err = clientset.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		} else {
+			_, err = clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		}
+		return err
+	})
+}
+
+// setAnnotations sets the given annotations on a workload, removing those with an empty value
+func setAnnotations(ctx context.Context, clientset *kubernetes.Clientset, namespace, kind, name string, annotations map[string]string) error {
+	apply := func(meta *metav1.ObjectMeta) {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			if v == "" {
+				delete(meta.Annotations, k)
+			} else {
+				meta.Annotations[k] = v
+			}
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if kind == KindStatefulSet {
+			statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			apply(&statefulSet.ObjectMeta)
+			_, err = clientset.AppsV1().StatefulSets(namespace).Update(ctx, statefulSet, metav1.UpdateOptions{})
+			return err
+		}
+
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		apply(&deployment.ObjectMeta)
+		_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// profileFromOperation extracts the profile stored in the operation data
+func profileFromOperation(op *utils.Operation) (*Profile, error) {
+	if op.Data == nil {
+		return nil, fmt.Errorf("operation has no data")
+	}
+
+	switch v := op.Data["profile"].(type) {
+	case Profile:
+		return &v, nil
+	default:
+		// Data may have been round-tripped through JSON
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var profile Profile
+		if err := json.Unmarshal(raw, &profile); err != nil {
+			return nil, err
+		}
+		return &profile, nil
+	}
+}
+
+func replicasFromOperation(op *utils.Operation) int32 {
+	switch v := op.Data["replicas"].(type) {
+	case int32:
+		return v
+	case int:
+		return int32(v)
+	case float64:
+		return int32(v)
+	}
+	return 0
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
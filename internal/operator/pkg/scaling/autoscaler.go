@@ -0,0 +1,200 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultCPUUtilization is the target of autoscalers set without metrics
+const defaultCPUUtilization = 80
+
+// ErrNoAutoscaler is returned for workloads without a HorizontalPodAutoscaler
+var ErrNoAutoscaler = errors.New("the workload has no horizontal pod autoscaler")
+
+// AutoscalerSpec is the HorizontalPodAutoscaler of a workload
+type AutoscalerSpec struct {
+	// MinReplicas defaults to 1, scaling to zero needs an alpha feature gate
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	MaxReplicas int32 `json:"maxReplicas"`
+	// Metrics default to an average CPU utilization of 80% when empty, the default of the API server
+	Metrics []MetricTarget `json:"metrics,omitempty"`
+}
+
+// MetricTarget is the per pod average of a resource the autoscaler keeps the workload at, either
+// a utilization of the requests or a quantity
+type MetricTarget struct {
+	// Resource is cpu or memory
+	Resource string `json:"resource"`
+	// AverageUtilization is a percentage of the requests of the containers
+	AverageUtilization int32 `json:"averageUtilization,omitempty"`
+	// AverageValue is a quantity, e.g. 500m or 512Mi
+	AverageValue string `json:"averageValue,omitempty"`
+}
+
+// Validate checks the replica bounds and the metric targets of the spec
+func (s AutoscalerSpec) Validate() error {
+	if s.MinReplicas < 0 {
+		return fmt.Errorf("%w: minReplicas can't be negative", ErrInvalid)
+	}
+	if s.MaxReplicas < 1 || s.MaxReplicas > MaxReplicas {
+		return fmt.Errorf("%w: maxReplicas must be between 1 and %d", ErrInvalid, MaxReplicas)
+	}
+	if s.MinReplicas > s.MaxReplicas {
+		return fmt.Errorf("%w: minReplicas %d is above maxReplicas %d", ErrInvalid, s.MinReplicas, s.MaxReplicas)
+	}
+
+	seen := map[string]bool{}
+	for _, metric := range s.Metrics {
+		if metric.Resource != string(corev1.ResourceCPU) && metric.Resource != string(corev1.ResourceMemory) {
+			return fmt.Errorf("%w: metric resource %q must be cpu or memory", ErrInvalid, metric.Resource)
+		}
+		if seen[metric.Resource] {
+			return fmt.Errorf("%w: %s has several targets", ErrInvalid, metric.Resource)
+		}
+		seen[metric.Resource] = true
+
+		if (metric.AverageUtilization != 0) == (metric.AverageValue != "") {
+			return fmt.Errorf("%w: %s needs either an averageUtilization or an averageValue", ErrInvalid, metric.Resource)
+		}
+		if metric.AverageUtilization < 0 {
+			return fmt.Errorf("%w: %s averageUtilization must be positive", ErrInvalid, metric.Resource)
+		}
+		if metric.AverageValue != "" {
+			quantity, err := resource.ParseQuantity(metric.AverageValue)
+			if err != nil || quantity.Sign() <= 0 {
+				return fmt.Errorf("%w: %s averageValue %q is not a positive quantity", ErrInvalid, metric.Resource, metric.AverageValue)
+			}
+		}
+	}
+	return nil
+}
+
+// GetAutoscaler returns the HorizontalPodAutoscaler targeting a workload
+func (m *Manager) GetAutoscaler(ctx context.Context, w Workload) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	if err := ValidateWorkload(w); err != nil {
+		return nil, err
+	}
+	autoscaler, err := m.autoscalerOf(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+	if autoscaler == nil {
+		return nil, ErrNoAutoscaler
+	}
+	return autoscaler, nil
+}
+
+// SetAutoscaler creates the HorizontalPodAutoscaler of a workload, named after it, or updates the
+// bounds and metrics of the one targeting it. Utilization targets need requests of the resource
+// on every container, the autoscaler can't compute a utilization otherwise.
+func (m *Manager) SetAutoscaler(ctx context.Context, w Workload, spec AutoscalerSpec) (*autoscalingv2.HorizontalPodAutoscaler, bool, error) {
+	if err := ValidateWorkload(w); err != nil {
+		return nil, false, err
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, false, err
+	}
+	if len(spec.Metrics) == 0 {
+		spec.Metrics = []MetricTarget{{Resource: string(corev1.ResourceCPU), AverageUtilization: defaultCPUUtilization}}
+	}
+	_, template, err := m.spec(ctx, w)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkRequests(template, spec.Metrics); err != nil {
+		return nil, false, err
+	}
+
+	existing, err := m.autoscalerOf(ctx, w)
+	if err != nil {
+		return nil, false, err
+	}
+	autoscalers := m.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.Namespace)
+	if existing != nil {
+		applySpec(existing, spec)
+		updated, err := autoscalers.Update(ctx, existing, metav1.UpdateOptions{})
+		return updated, false, err
+	}
+
+	autoscaler := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: w.Name, Namespace: w.Namespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: kinds[w.Kind], Name: w.Name},
+		},
+	}
+	applySpec(autoscaler, spec)
+	created, err := autoscalers.Create(ctx, autoscaler, metav1.CreateOptions{})
+	return created, true, err
+}
+
+// DeleteAutoscaler deletes the HorizontalPodAutoscaler targeting a workload, its replicas stay as
+// the autoscaler last set them
+func (m *Manager) DeleteAutoscaler(ctx context.Context, w Workload) error {
+	autoscaler, err := m.GetAutoscaler(ctx, w)
+	if err != nil {
+		return err
+	}
+	return m.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.Namespace).Delete(ctx, autoscaler.Name, metav1.DeleteOptions{})
+}
+
+// autoscalerOf finds the HorizontalPodAutoscaler targeting a workload, nil when there is none
+func (m *Manager) autoscalerOf(ctx context.Context, w Workload) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	list, err := m.clientset.AutoscalingV2().HorizontalPodAutoscalers(w.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list horizontal pod autoscalers: %v", err)
+	}
+	for i := range list.Items {
+		target := list.Items[i].Spec.ScaleTargetRef
+		if target.Kind == kinds[w.Kind] && target.Name == w.Name && strings.HasPrefix(target.APIVersion, "apps/") {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func applySpec(autoscaler *autoscalingv2.HorizontalPodAutoscaler, spec AutoscalerSpec) {
+	minReplicas := spec.MinReplicas
+	if minReplicas == 0 {
+		minReplicas = 1
+	}
+	autoscaler.Spec.MinReplicas = &minReplicas
+	autoscaler.Spec.MaxReplicas = spec.MaxReplicas
+
+	autoscaler.Spec.Metrics = nil
+	for _, metric := range spec.Metrics {
+		target := autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType}
+		if metric.AverageUtilization != 0 {
+			utilization := metric.AverageUtilization
+			target = autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &utilization}
+		} else {
+			quantity := resource.MustParse(metric.AverageValue)
+			target.AverageValue = &quantity
+		}
+		autoscaler.Spec.Metrics = append(autoscaler.Spec.Metrics, autoscalingv2.MetricSpec{
+			Type:     autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{Name: corev1.ResourceName(metric.Resource), Target: target},
+		})
+	}
+}
+
+// checkRequests checks every container requests the resources of the utilization targets
+func checkRequests(template *corev1.PodTemplateSpec, metrics []MetricTarget) error {
+	for _, metric := range metrics {
+		if metric.AverageUtilization == 0 {
+			continue
+		}
+		for _, container := range template.Spec.Containers {
+			if _, ok := container.Resources.Requests[corev1.ResourceName(metric.Resource)]; !ok {
+				return fmt.Errorf("%w: container %s has no %s request, a utilization target needs one", ErrInvalid, container.Name, metric.Resource)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package scaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kinds of scalable workloads, by resource name
+const (
+	KindDeployments  = "deployments"
+	KindStatefulSets = "statefulsets"
+	KindReplicaSets  = "replicasets"
+)
+
+// MaxReplicas caps the replicas a workload or autoscaler is set to, a guard against typos
+const MaxReplicas = 1000
+
+var (
+	// ErrUnsupported is returned for kinds that can't be scaled
+	ErrUnsupported = errors.New("unsupported workload kind")
+	// ErrInvalid is returned for invalid replica counts and autoscaler specs
+	ErrInvalid = errors.New("invalid scaling request")
+)
+
+// kinds maps the resource names of the scalable workloads to their kind
+var kinds = map[string]string{
+	KindDeployments:  "Deployment",
+	KindStatefulSets: "StatefulSet",
+	KindReplicaSets:  "ReplicaSet",
+}
+
+// Workload names a scalable workload
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ScaleResult is the outcome of scaling a workload
+type ScaleResult struct {
+	Workload Workload `json:"workload"`
+	Previous int32    `json:"previous"`
+	Replicas int32    `json:"replicas"`
+	// Autoscaler names the HorizontalPodAutoscaler of the workload, it will override the replicas
+	Autoscaler string `json:"autoscaler,omitempty"`
+}
+
+// Manager scales the workloads of a cluster and manages their HorizontalPodAutoscalers
+type Manager struct {
+	clientset kubernetes.Interface
+}
+
+// NewManager creates a scaling manager of the cluster of the clientset
+func NewManager(clientset kubernetes.Interface) *Manager {
+	return &Manager{clientset: clientset}
+}
+
+// ValidateWorkload checks the kind of a workload can be scaled
+func ValidateWorkload(w Workload) error {
+	if _, ok := kinds[w.Kind]; !ok {
+		return fmt.Errorf("%w: %s, must be deployments, statefulsets or replicasets", ErrUnsupported, w.Kind)
+	}
+	return nil
+}
+
+// Scale sets the replicas of a workload with a merge patch of spec.replicas
+func (m *Manager) Scale(ctx context.Context, w Workload, replicas int32) (*ScaleResult, error) {
+	if err := ValidateWorkload(w); err != nil {
+		return nil, err
+	}
+	if replicas < 0 || replicas > MaxReplicas {
+		return nil, fmt.Errorf("%w: replicas must be between 0 and %d", ErrInvalid, MaxReplicas)
+	}
+
+	current, _, err := m.spec(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+	// The API server defaults unset replicas to 1
+	previous := int32(1)
+	if current != nil {
+		previous = *current
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}})
+	apps := m.clientset.AppsV1()
+	switch w.Kind {
+	case KindDeployments:
+		_, err = apps.Deployments(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case KindStatefulSets:
+		_, err = apps.StatefulSets(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case KindReplicaSets:
+		_, err = apps.ReplicaSets(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScaleResult{Workload: w, Previous: previous, Replicas: replicas}
+	if autoscaler, err := m.autoscalerOf(ctx, w); err == nil && autoscaler != nil {
+		result.Autoscaler = autoscaler.Name
+	}
+	return result, nil
+}
+
+// spec returns the desired replicas, nil when unset, and the pod template of a workload
+func (m *Manager) spec(ctx context.Context, w Workload) (*int32, *corev1.PodTemplateSpec, error) {
+	apps := m.clientset.AppsV1()
+	switch w.Kind {
+	case KindDeployments:
+		deployment, err := apps.Deployments(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return deployment.Spec.Replicas, &deployment.Spec.Template, nil
+	case KindStatefulSets:
+		statefulSet, err := apps.StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return statefulSet.Spec.Replicas, &statefulSet.Spec.Template, nil
+	case KindReplicaSets:
+		replicaSet, err := apps.ReplicaSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return replicaSet.Spec.Replicas, &replicaSet.Spec.Template, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrUnsupported, w.Kind)
+}
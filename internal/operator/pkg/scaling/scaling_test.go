@@ -0,0 +1,134 @@
+package scaling
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func testDeployment(requests corev1.ResourceList) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](3),
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:      "web",
+				Resources: corev1.ResourceRequirements{Requests: requests},
+			}}}},
+		},
+	}
+}
+
+var web = Workload{Kind: KindDeployments, Namespace: "shop", Name: "web"}
+
+func TestScale(t *testing.T) {
+	t.Parallel()
+
+	clientset := fake.NewSimpleClientset(testDeployment(nil), &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-hpa", Namespace: "shop"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"},
+		},
+	})
+	manager := NewManager(clientset)
+	ctx := context.Background()
+
+	result, err := manager.Scale(ctx, web, 5)
+	if err != nil {
+		t.Fatalf("Scale() error = %v", err)
+	}
+	if result.Previous != 3 || result.Replicas != 5 || result.Autoscaler != "web-hpa" {
+		t.Errorf("Scale() = %+v, want 3 to 5 replicas overridden by web-hpa", result)
+	}
+	scaled, _ := clientset.AppsV1().Deployments("shop").Get(ctx, "web", metav1.GetOptions{})
+	if *scaled.Spec.Replicas != 5 {
+		t.Errorf("replicas = %d, want 5", *scaled.Spec.Replicas)
+	}
+
+	if _, err := manager.Scale(ctx, web, -1); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Scale(-1) error = %v, want ErrInvalid", err)
+	}
+	if _, err := manager.Scale(ctx, Workload{Kind: "daemonsets", Namespace: "shop", Name: "web"}, 1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Scale() of a daemonset error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestAutoscalerSpecValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		spec    AutoscalerSpec
+		wantErr bool
+	}{
+		{"defaults", AutoscalerSpec{MaxReplicas: 3}, false},
+		{"cpu and memory", AutoscalerSpec{MinReplicas: 2, MaxReplicas: 10, Metrics: []MetricTarget{
+			{Resource: "cpu", AverageUtilization: 70}, {Resource: "memory", AverageValue: "512Mi"},
+		}}, false},
+		{"no max", AutoscalerSpec{MinReplicas: 2}, true},
+		{"min above max", AutoscalerSpec{MinReplicas: 5, MaxReplicas: 3}, true},
+		{"unknown resource", AutoscalerSpec{MaxReplicas: 3, Metrics: []MetricTarget{{Resource: "gpu", AverageUtilization: 50}}}, true},
+		{"two targets", AutoscalerSpec{MaxReplicas: 3, Metrics: []MetricTarget{{Resource: "cpu", AverageUtilization: 50, AverageValue: "1"}}}, true},
+		{"no target", AutoscalerSpec{MaxReplicas: 3, Metrics: []MetricTarget{{Resource: "cpu"}}}, true},
+		{"invalid quantity", AutoscalerSpec{MaxReplicas: 3, Metrics: []MetricTarget{{Resource: "memory", AverageValue: "lots"}}}, true},
+		{"duplicate resource", AutoscalerSpec{MaxReplicas: 3, Metrics: []MetricTarget{
+			{Resource: "cpu", AverageUtilization: 50}, {Resource: "cpu", AverageValue: "500m"},
+		}}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetAutoscaler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(testDeployment(corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}))
+	manager := NewManager(clientset)
+
+	created, isNew, err := manager.SetAutoscaler(ctx, web, AutoscalerSpec{MaxReplicas: 4})
+	if err != nil || !isNew {
+		t.Fatalf("SetAutoscaler() = %v, %v, want a new autoscaler", isNew, err)
+	}
+	if *created.Spec.MinReplicas != 1 || *created.Spec.Metrics[0].Resource.Target.AverageUtilization != defaultCPUUtilization {
+		t.Errorf("created spec = %+v, want 1 min replica and the default cpu target", created.Spec)
+	}
+
+	updated, isNew, err := manager.SetAutoscaler(ctx, web, AutoscalerSpec{MinReplicas: 2, MaxReplicas: 8, Metrics: []MetricTarget{{Resource: "memory", AverageValue: "1Gi"}}})
+	if err != nil || isNew {
+		t.Fatalf("SetAutoscaler() = %v, %v, want the autoscaler updated", isNew, err)
+	}
+	if updated.Spec.MaxReplicas != 8 || len(updated.Spec.Metrics) != 1 || updated.Spec.Metrics[0].Resource.Name != corev1.ResourceMemory {
+		t.Errorf("updated spec = %+v, want 8 max replicas and a memory target", updated.Spec)
+	}
+
+	// The containers request no memory, a utilization of it can't be computed
+	_, _, err = manager.SetAutoscaler(ctx, web, AutoscalerSpec{MaxReplicas: 4, Metrics: []MetricTarget{{Resource: "memory", AverageUtilization: 60}}})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("SetAutoscaler() without memory requests error = %v, want ErrInvalid", err)
+	}
+
+	if err := manager.DeleteAutoscaler(ctx, web); err != nil {
+		t.Fatalf("DeleteAutoscaler() error = %v", err)
+	}
+	if _, err := manager.GetAutoscaler(ctx, web); !errors.Is(err, ErrNoAutoscaler) {
+		t.Errorf("GetAutoscaler() after delete error = %v, want ErrNoAutoscaler", err)
+	}
+}
@@ -0,0 +1,84 @@
+package scanjobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+)
+
+const (
+	// callbackTimeout bounds a single delivery attempt
+	callbackTimeout = 10 * time.Second
+	// callbackAttempts is how often a failed delivery is tried, backing off between attempts
+	callbackAttempts = 3
+)
+
+// Delivery is the outcome of posting a finished job to its callback URL
+type Delivery struct {
+	Delivered  bool      `json:"delivered"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// callbackClient posts finished jobs to their callback URLs
+type callbackClient struct {
+	client  *http.Client
+	backoff time.Duration
+}
+
+func newCallbackClient() *callbackClient {
+	return &callbackClient{
+		client:  &http.Client{Timeout: callbackTimeout},
+		backoff: 2 * time.Second,
+	}
+}
+
+// post sends the job as JSON until a 2xx response or the attempts run out
+func (c *callbackClient) post(url string, job *Job) Delivery {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return Delivery{Error: err.Error(), Time: time.Now()}
+	}
+
+	var delivery Delivery
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * c.backoff)
+		}
+		delivery = Delivery{Attempts: attempt, Time: time.Now()}
+
+		resp, err := c.client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			delivery.Error = err.Error()
+			continue
+		}
+		resp.Body.Close()
+		delivery.StatusCode = resp.StatusCode
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			delivery.Delivered = true
+			return delivery
+		}
+		delivery.Error = fmt.Sprintf("callback responded %s", resp.Status)
+	}
+	return delivery
+}
+
+// deliver posts a finished job to its callback URL, if any, and records the outcome on the job
+func (m *Manager) deliver(id string) {
+	job, err := m.Get(id)
+	if err != nil || job.CallbackURL == "" {
+		return
+	}
+
+	delivery := m.callback.post(job.CallbackURL, job)
+	if !delivery.Delivered {
+		logger.Log(logger.LevelWarn, map[string]string{"job": id, "url": job.CallbackURL}, fmt.Errorf("%s", delivery.Error), "Failed to deliver scan job callback")
+	}
+	m.queue.UpdateOperationData(id, map[string]interface{}{"callback": delivery})
+}
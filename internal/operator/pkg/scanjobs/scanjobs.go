@@ -0,0 +1,302 @@
+package scanjobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/posture"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	OperationScan = "image-scan"
+
+	// jobTimeout bounds following the scans of a job, images not scanned by then fail
+	jobTimeout = 15 * time.Minute
+	// pollInterval is how often the progress of the scans is read
+	pollInterval = 2 * time.Second
+)
+
+// Image scan statuses within a job
+const (
+	ImageQueued    = "queued"
+	ImageScanning  = "scanning"
+	ImageCompleted = "completed"
+	ImageFailed    = "failed"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("scan job not found")
+	// ErrFinished is returned when cancelling a job that already ended
+	ErrFinished = errors.New("scan job already finished")
+)
+
+// Enqueuer queues images for scanning, images scanned before keep their results
+type Enqueuer func(ctx context.Context, images ...string)
+
+// StateLookup returns the state of the scan of an image, queued until the scanner picked it up
+type StateLookup func(image string) ImageState
+
+// Request asks for the scan of images, CallbackURL receives the job once it ended
+type Request struct {
+	Images      []string `json:"images"`
+	CallbackURL string   `json:"callbackUrl,omitempty"`
+}
+
+// ImageState is the progress of the scan of an image of a job
+type ImageState struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Severities are set once the scan completed
+	Severities *posture.Severities `json:"severities,omitempty"`
+}
+
+// done reports whether the scan of the image ended
+func (s ImageState) done() bool {
+	return s.Status == ImageCompleted || s.Status == ImageFailed
+}
+
+// Job is a scan of images tracked through the operation queue
+type Job struct {
+	ID          string                `json:"id"`
+	Status      utils.OperationStatus `json:"status"`
+	Progress    int                   `json:"progress"`
+	Message     string                `json:"message,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	StartTime   time.Time             `json:"startTime"`
+	EndTime     *time.Time            `json:"endTime,omitempty"`
+	CallbackURL string                `json:"callbackUrl,omitempty"`
+	Images      []ImageState          `json:"images"`
+	// Callback is the delivery of the job to the callback URL, once attempted
+	Callback *Delivery `json:"callback,omitempty"`
+}
+
+// Manager creates scan jobs on the operation queue and follows their scans
+type Manager struct {
+	queue    *utils.Queue
+	enqueue  Enqueuer
+	state    StateLookup
+	callback *callbackClient
+	mutex    sync.Mutex
+	// cancels stops the jobs being followed, by job ID
+	cancels      map[string]context.CancelFunc
+	pollInterval time.Duration
+}
+
+// NewManager creates a scan job manager queueing images through enqueue and following them through state
+func NewManager(queue *utils.Queue, enqueue Enqueuer, state StateLookup) *Manager {
+	return &Manager{
+		queue:        queue,
+		enqueue:      enqueue,
+		state:        state,
+		callback:     newCallbackClient(),
+		cancels:      map[string]context.CancelFunc{},
+		pollInterval: pollInterval,
+	}
+}
+
+// Create validates a request and queues its job
+func (m *Manager) Create(req Request) (*Job, error) {
+	images := make([]string, 0, len(req.Images))
+	seen := map[string]bool{}
+	for _, image := range req.Images {
+		if image == "" || seen[image] {
+			continue
+		}
+		seen[image] = true
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("images list cannot be empty")
+	}
+	if req.CallbackURL != "" {
+		parsed, err := url.Parse(req.CallbackURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("callbackUrl must be an http or https URL")
+		}
+	}
+
+	states := make([]ImageState, 0, len(images))
+	for _, image := range images {
+		states = append(states, ImageState{Image: image, Status: ImageQueued})
+	}
+	op := m.queue.AddOperation(OperationScan, fmt.Sprintf("%d images", len(images)), "user", map[string]interface{}{
+		"images":      images,
+		"callbackUrl": req.CallbackURL,
+		"states":      states,
+	}, []string{"vulnerability"})
+	// A job refused by the queue never reaches the processor
+	if op.Status == utils.StatusFailed {
+		go m.deliver(op.ID)
+	}
+	return jobOf(op), nil
+}
+
+// Get returns a scan job
+func (m *Manager) Get(id string) (*Job, error) {
+	op, ok := m.queue.GetOperation(id)
+	if !ok || op.Type != OperationScan {
+		return nil, ErrNotFound
+	}
+	return jobOf(op), nil
+}
+
+// Cancel stops a job. Scans already started finish in the background and keep their results,
+// the job stops following them.
+func (m *Manager) Cancel(id string) (*Job, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.queue.CancelOperation(id) {
+		go m.deliver(id)
+		return m.Get(id)
+	}
+	if !m.CancelRunning(id) {
+		if job.EndTime != nil {
+			return nil, ErrFinished
+		}
+		return nil, fmt.Errorf("scan job is starting, retry the cancellation")
+	}
+	return job, nil
+}
+
+// CancelRunning stops following the scans of a running job, which then ends as cancelled
+func (m *Manager) CancelRunning(id string) bool {
+	m.mutex.Lock()
+	cancel, ok := m.cancels[id]
+	m.mutex.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// ProcessOperation queues the images of a job and follows their scans outside the worker
+func (m *Manager) ProcessOperation(op *utils.Operation) error {
+	var images []string
+	if err := decodeData(op.Data["images"], &images); err != nil || len(images) == 0 {
+		return utils.NonRetryable(fmt.Errorf("invalid scan job images: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	m.mutex.Lock()
+	m.cancels[op.ID] = cancel
+	m.mutex.Unlock()
+
+	m.enqueue(ctx, images...)
+	go m.follow(ctx, op.ID, images)
+	return utils.ErrDetached
+}
+
+// CanProcess reports whether the operation is a scan job
+func (m *Manager) CanProcess(operationType string) bool {
+	return operationType == OperationScan
+}
+
+// follow records the progress of the scans of a job until they ended, the job timed out or was
+// cancelled, then delivers the job to its callback
+func (m *Manager) follow(ctx context.Context, id string, images []string) {
+	defer func() {
+		m.mutex.Lock()
+		if cancel, ok := m.cancels[id]; ok {
+			cancel()
+			delete(m.cancels, id)
+		}
+		m.mutex.Unlock()
+		m.deliver(id)
+	}()
+
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		states, finished, failed := m.progress(images)
+		m.queue.UpdateOperationData(id, map[string]interface{}{"states": states})
+		if finished == len(images) {
+			switch {
+			case failed == len(images):
+				m.queue.UpdateOperation(id, utils.StatusFailed, 100, "Every image scan failed", nil)
+			case failed > 0:
+				m.queue.UpdateOperation(id, utils.StatusCompleted, 100, fmt.Sprintf("Scanned %d images, %d failed", len(images), failed), nil)
+			default:
+				m.queue.UpdateOperation(id, utils.StatusCompleted, 100, fmt.Sprintf("Scanned %d images", len(images)), nil)
+			}
+			return
+		}
+		m.queue.UpdateOperation(id, utils.StatusRunning, finished*100/len(images), fmt.Sprintf("Scanned %d of %d images", finished, len(images)), nil)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				for i := range states {
+					if !states[i].done() {
+						states[i].Status, states[i].Error = ImageFailed, "scan did not finish in time"
+					}
+				}
+				m.queue.UpdateOperationData(id, map[string]interface{}{"states": states})
+				m.queue.UpdateOperation(id, utils.StatusFailed, finished*100/len(images), "Scan job timed out", ctx.Err())
+				return
+			}
+			m.queue.UpdateOperation(id, utils.StatusCancelled, finished*100/len(images), "Scan job cancelled by user", nil)
+			return
+		}
+	}
+}
+
+// progress reads the states of the images with the number of scans that ended and failed
+func (m *Manager) progress(images []string) ([]ImageState, int, int) {
+	states := make([]ImageState, 0, len(images))
+	finished, failed := 0, 0
+	for _, image := range images {
+		state := m.state(image)
+		state.Image = image
+		if state.done() {
+			finished++
+		}
+		if state.Status == ImageFailed {
+			failed++
+		}
+		states = append(states, state)
+	}
+	return states, finished, failed
+}
+
+// jobOf reads a job from its operation
+func jobOf(op *utils.Operation) *Job {
+	job := &Job{
+		ID:        op.ID,
+		Status:    op.Status,
+		Progress:  op.Progress,
+		Message:   op.Message,
+		Error:     op.Error,
+		StartTime: op.StartTime,
+		EndTime:   op.EndTime,
+		Images:    []ImageState{},
+	}
+	job.CallbackURL, _ = op.Data["callbackUrl"].(string)
+	_ = decodeData(op.Data["states"], &job.Images)
+	if op.Data["callback"] != nil {
+		job.Callback = &Delivery{}
+		_ = decodeData(op.Data["callback"], job.Callback)
+	}
+	return job
+}
+
+// decodeData reads an operation data value into v, whether it holds the typed value or its JSON
+// decoding
+func decodeData(value interface{}, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
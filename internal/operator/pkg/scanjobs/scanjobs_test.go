@@ -0,0 +1,182 @@
+package scanjobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/posture"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+// fakeScanner scans images when released, failing those in fail
+type fakeScanner struct {
+	mutex  sync.Mutex
+	queued map[string]bool
+	done   map[string]bool
+	fail   map[string]bool
+}
+
+func (f *fakeScanner) enqueue(_ context.Context, images ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, image := range images {
+		f.queued[image] = true
+	}
+}
+
+func (f *fakeScanner) finish(images ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, image := range images {
+		f.done[image] = true
+	}
+}
+
+func (f *fakeScanner) state(image string) ImageState {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch {
+	case f.done[image] && f.fail[image]:
+		return ImageState{Status: ImageFailed, Error: "pull failed"}
+	case f.done[image]:
+		return ImageState{Status: ImageCompleted, Severities: &posture.Severities{High: 1, Total: 1}}
+	case f.queued[image]:
+		return ImageState{Status: ImageScanning}
+	}
+	return ImageState{Status: ImageQueued}
+}
+
+func newTestManager(t *testing.T, scanner *fakeScanner) *Manager {
+	t.Helper()
+	queue := utils.NewQueue(utils.QueueConfig{Workers: 1})
+	t.Cleanup(queue.Stop)
+	m := NewManager(queue, scanner.enqueue, scanner.state)
+	m.pollInterval = 10 * time.Millisecond
+	m.callback.backoff = time.Millisecond
+	queue.RegisterProcessor(OperationScan, m)
+	return m
+}
+
+func waitFor(t *testing.T, m *Manager, id string, done func(*Job) bool) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", id, err)
+		}
+		if done(job) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach the expected state", id)
+	return nil
+}
+
+func TestJobCompletes(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan Job, 1)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails and is retried
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var job Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			t.Errorf("decoding callback: %v", err)
+		}
+		received <- job
+	}))
+	defer server.Close()
+
+	scanner := &fakeScanner{queued: map[string]bool{}, done: map[string]bool{}, fail: map[string]bool{"broken:1": true}}
+	m := newTestManager(t, scanner)
+	job, err := m.Create(Request{Images: []string{"nginx:1.25", "broken:1", "nginx:1.25"}, CallbackURL: server.URL})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(job.Images) != 2 || job.Images[0].Status != ImageQueued {
+		t.Fatalf("Create() images = %+v, want 2 distinct queued images", job.Images)
+	}
+
+	waitFor(t, m, job.ID, func(j *Job) bool { return j.Status == utils.StatusRunning && j.Images[0].Status == ImageScanning })
+	scanner.finish("nginx:1.25", "broken:1")
+
+	select {
+	case got := <-received:
+		if got.Status != utils.StatusCompleted || got.Progress != 100 {
+			t.Errorf("callback job is %s at %d%%, want completed at 100%%", got.Status, got.Progress)
+		}
+		if got.Images[0].Severities == nil || got.Images[0].Severities.High != 1 || got.Images[1].Error != "pull failed" {
+			t.Errorf("callback images = %+v, want the results and failures of the scans", got.Images)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+
+	job = waitFor(t, m, job.ID, func(j *Job) bool { return j.Callback != nil })
+	if !job.Callback.Delivered || job.Callback.Attempts != 2 {
+		t.Errorf("callback = %+v, want delivered on the second attempt", job.Callback)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	scanner := &fakeScanner{queued: map[string]bool{}, done: map[string]bool{}}
+	m := newTestManager(t, scanner)
+	job, err := m.Create(Request{Images: []string{"nginx:1.25"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	waitFor(t, m, job.ID, func(j *Job) bool { return j.Status == utils.StatusRunning })
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	waitFor(t, m, job.ID, func(j *Job) bool { return j.Status == utils.StatusCancelled })
+
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel() of a cancelled job error = %v, want ErrFinished", err)
+	}
+	if _, err := m.Cancel("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel() of an unknown job error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"no images", Request{}},
+		{"empty image", Request{Images: []string{""}}},
+		{"relative callback", Request{Images: []string{"nginx"}, CallbackURL: "/hooks/scans"}},
+		{"callback scheme", Request{Images: []string{"nginx"}, CallbackURL: "ftp://example.com/scans"}},
+	}
+
+	m := NewManager(utils.NewQueue(utils.QueueConfig{}), nil, nil)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := m.Create(tt.req); err == nil {
+				t.Errorf("Create(%+v) succeeded, want an error", tt.req)
+			}
+		})
+	}
+}
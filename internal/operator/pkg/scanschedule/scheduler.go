@@ -0,0 +1,410 @@
+package scanschedule
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/imagepull"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/posture"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	summariesFileName = "image-scan-summaries.json"
+
+	// maxSummaries bounds the summaries kept for each cluster, the oldest are dropped first
+	maxSummaries = 30
+	// discoverTimeout bounds listing the pods of a cluster
+	discoverTimeout = 30 * time.Second
+)
+
+// Scan triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Enqueuer queues images for scanning, images scanned before keep their results
+type Enqueuer func(ctx context.Context, images ...string)
+
+// Excluder reports whether the images of a pod are left out of the scans
+type Excluder func(namespace string, labels map[string]string) bool
+
+// CredentialSink receives the registry credentials of the pull secrets of the pods running an image
+type CredentialSink func(image string, credentials []imagepull.RegistryCredential)
+
+// Target narrows the pods of a cluster whose images are scanned
+type Target struct {
+	// Namespaces are the namespaces scanned, every namespace when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Labels select the pods scanned, every pod when empty
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Summary records a scan of the images running in a cluster. The severities, scanned and pending
+// counts are those of the images when the summary is read, as scans finish in the background.
+type Summary struct {
+	Cluster    string    `json:"cluster"`
+	Trigger    string    `json:"trigger"`
+	Target     Target    `json:"target"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Images are the distinct images of the pods found, sorted
+	Images []string `json:"images"`
+	Pods   int      `json:"pods"`
+	// Excluded counts the pods left out by the exclusions of the scanner
+	Excluded int    `json:"excluded"`
+	Error    string `json:"error,omitempty"`
+	posture.Severities
+	Scanned int `json:"scanned"`
+	Pending int `json:"pending"`
+}
+
+// Status is the schedule of the scans with the latest summary of every cluster
+type Status struct {
+	Cron    string     `json:"cron,omitempty"`
+	NextRun *time.Time `json:"nextRun,omitempty"`
+	// Clusters holds the latest summary of every scanned cluster, sorted by cluster
+	Clusters []Summary `json:"clusters"`
+}
+
+type storeData struct {
+	// Summaries holds the summaries of every cluster, oldest first
+	Summaries map[string][]Summary `json:"summaries"`
+}
+
+// Scheduler discovers the images running in clusters, periodically or when asked, queues them
+// for scanning and records a summary of each scan
+type Scheduler struct {
+	kubeConfigStore kubeconfig.ContextStore
+	enqueue         Enqueuer
+	exclude         Excluder
+	lookup          posture.ScanLookup
+	// credentials receives the pull credentials of the images discovered, nil leaves pull secrets unread
+	credentials CredentialSink
+	filePath    string
+	mutex       sync.Mutex
+	stopChan    chan struct{}
+	// cron and next describe the schedule once started
+	cron    string
+	next    time.Time
+	running map[string]bool
+}
+
+// NewScheduler creates a scheduler queueing images through enqueue and reading their results
+// through lookup
+func NewScheduler(kubeConfigStore kubeconfig.ContextStore, enqueue Enqueuer, exclude Excluder, lookup posture.ScanLookup) *Scheduler {
+	return &Scheduler{
+		kubeConfigStore: kubeConfigStore,
+		enqueue:         enqueue,
+		exclude:         exclude,
+		lookup:          lookup,
+		filePath:        filepath.Join(utils.ConfigDir(), summariesFileName),
+		stopChan:        make(chan struct{}),
+		running:         map[string]bool{},
+	}
+}
+
+// SetCredentialSink makes discoveries read the imagePullSecrets of the pods and hand the
+// credentials of each image to sink before queueing it
+func (s *Scheduler) SetCredentialSink(sink CredentialSink) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.credentials = sink
+}
+
+// Start scans the clusters whenever the cron expression matches until Stop is called. Clusters
+// lists the contexts scanned, every context when empty.
+func (s *Scheduler) Start(expression string, clusters []string, target Target) error {
+	cron, err := ParseCron(expression)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.cron = expression
+	s.mutex.Unlock()
+
+	go func() {
+		for {
+			next := cron.Next(time.Now())
+			if next.IsZero() {
+				logger.Log(logger.LevelWarn, map[string]string{"cron": expression}, nil, "Image scan schedule never runs")
+				return
+			}
+			s.mutex.Lock()
+			s.next = next
+			s.mutex.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				s.scanClusters(clusters, target)
+			case <-s.stopChan:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the schedule
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+}
+
+// scanClusters scans the clusters one after the other, recording the failures in their summaries
+func (s *Scheduler) scanClusters(clusters []string, target Target) {
+	if len(clusters) == 0 {
+		contexts, err := s.kubeConfigStore.GetContexts()
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to list contexts for scheduled image scans")
+			return
+		}
+		for _, ctx := range contexts {
+			if !ctx.Internal {
+				clusters = append(clusters, ctx.Name)
+			}
+		}
+	}
+
+	for _, cluster := range clusters {
+		summary, err := s.Scan(context.Background(), cluster, target, TriggerSchedule)
+		if err != nil {
+			logger.Log(logger.LevelError, map[string]string{"cluster": cluster}, err, "Scheduled image scan failed")
+			continue
+		}
+		logger.Log(logger.LevelInfo, map[string]string{
+			"cluster": cluster,
+			"images":  fmt.Sprintf("%d", len(summary.Images)),
+		}, nil, "Queued scheduled image scan")
+	}
+}
+
+// Scan discovers the images of the pods of a cluster, queues them for scanning and records the
+// summary. A failed discovery is recorded as well and returned. Clusters already being discovered
+// are refused.
+func (s *Scheduler) Scan(ctx context.Context, cluster string, target Target, trigger string) (*Summary, error) {
+	s.mutex.Lock()
+	if s.running[cluster] {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("images of cluster %s are already being discovered", cluster)
+	}
+	s.running[cluster] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.running, cluster)
+		s.mutex.Unlock()
+	}()
+
+	summary := Summary{Cluster: cluster, Trigger: trigger, Target: target, StartedAt: time.Now(), Images: []string{}}
+	s.mutex.Lock()
+	sink := s.credentials
+	s.mutex.Unlock()
+	credentials, err := s.discoverCluster(ctx, &summary, sink != nil)
+	if err != nil {
+		summary.Error = err.Error()
+	} else {
+		for image, imageCredentials := range credentials {
+			sink(image, imageCredentials)
+		}
+		s.enqueue(ctx, summary.Images...)
+	}
+	summary.FinishedAt = time.Now()
+
+	if recordErr := s.record(summary); recordErr != nil {
+		logger.Log(logger.LevelError, map[string]string{"cluster": cluster}, recordErr, "Failed to record image scan summary")
+	}
+	s.tally(&summary)
+	return &summary, err
+}
+
+func (s *Scheduler) discoverCluster(ctx context.Context, summary *Summary, readPullSecrets bool) (map[string][]imagepull.RegistryCredential, error) {
+	kubeContext, err := s.kubeConfigStore.GetContext(summary.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	var pullSecrets *imagepull.PullSecretCache
+	if readPullSecrets {
+		pullSecrets = imagepull.NewPullSecretCache(clientset)
+	}
+	ctx, cancel := context.WithTimeout(ctx, discoverTimeout)
+	defer cancel()
+	return discoverImages(ctx, clientset, summary, s.exclude, pullSecrets)
+}
+
+// discoverImages lists the pods of the target and fills the images, pods and exclusions of the
+// summary. With pullSecrets it returns the credentials of the pull secrets of the pods for the
+// registry of each image; unreadable secrets are logged and skipped.
+func discoverImages(ctx context.Context, clientset kubernetes.Interface, summary *Summary, exclude Excluder, pullSecrets *imagepull.PullSecretCache) (map[string][]imagepull.RegistryCredential, error) {
+	namespaces := summary.Target.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	listOptions := metav1.ListOptions{}
+	if len(summary.Target.Labels) > 0 {
+		listOptions.LabelSelector = labels.SelectorFromSet(summary.Target.Labels).String()
+	}
+
+	images := map[string]bool{}
+	credentials := map[string][]imagepull.RegistryCredential{}
+	for _, namespace := range namespaces {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		for _, pod := range pods.Items {
+			if exclude != nil && exclude(pod.Namespace, pod.Labels) {
+				summary.Excluded++
+				continue
+			}
+			summary.Pods++
+			for _, container := range pod.Spec.InitContainers {
+				images[container.Image] = true
+			}
+			for _, container := range pod.Spec.Containers {
+				images[container.Image] = true
+			}
+			if pullSecrets != nil {
+				addPodCredentials(ctx, pullSecrets, &pod, credentials)
+			}
+		}
+	}
+
+	for image := range images {
+		summary.Images = append(summary.Images, image)
+	}
+	sort.Strings(summary.Images)
+	return credentials, nil
+}
+
+// addPodCredentials adds the pull secret credentials of a pod to those of the images it runs
+func addPodCredentials(ctx context.Context, pullSecrets *imagepull.PullSecretCache, pod *corev1.Pod, credentials map[string][]imagepull.RegistryCredential) {
+	podCredentials, errs := pullSecrets.PodCredentials(ctx, pod)
+	for _, err := range errs {
+		logger.Log(logger.LevelWarn, map[string]string{"pod": pod.Namespace + "/" + pod.Name}, err, "Skipping pull secret of scanned images")
+	}
+	if len(podCredentials) == 0 {
+		return
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, credential := range imagepull.CredentialsFor(podCredentials, container.Image) {
+			if !slices.Contains(credentials[container.Image], credential) {
+				credentials[container.Image] = append(credentials[container.Image], credential)
+			}
+		}
+	}
+}
+
+// tally totals the results of the images of a summary available now
+func (s *Scheduler) tally(summary *Summary) {
+	summary.Severities = posture.Severities{}
+	summary.Scanned, summary.Pending = 0, 0
+	for _, image := range summary.Images {
+		severities, ok := s.lookup(image)
+		if !ok {
+			summary.Pending++
+			continue
+		}
+		summary.Scanned++
+		summary.Critical += severities.Critical
+		summary.High += severities.High
+		summary.Medium += severities.Medium
+		summary.Low += severities.Low
+		summary.Unknown += severities.Unknown
+		summary.Total += severities.Total
+	}
+}
+
+// Status returns the schedule and the latest summary of every cluster
+func (s *Scheduler) Status() (*Status, error) {
+	s.mutex.Lock()
+	status := &Status{Cron: s.cron, Clusters: []Summary{}}
+	if !s.next.IsZero() {
+		next := s.next
+		status.NextRun = &next
+	}
+	data, err := s.load()
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, summaries := range data.Summaries {
+		if len(summaries) == 0 {
+			continue
+		}
+		latest := summaries[len(summaries)-1]
+		s.tally(&latest)
+		status.Clusters = append(status.Clusters, latest)
+	}
+	sort.Slice(status.Clusters, func(a, b int) bool { return status.Clusters[a].Cluster < status.Clusters[b].Cluster })
+	return status, nil
+}
+
+// Summaries returns the summaries of a cluster, newest first
+func (s *Scheduler) Summaries(cluster string) ([]Summary, error) {
+	s.mutex.Lock()
+	data, err := s.load()
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := data.Summaries[cluster]
+	summaries := make([]Summary, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		summary := stored[i]
+		s.tally(&summary)
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// record appends a summary to those of its cluster, dropping the oldest beyond maxSummaries
+func (s *Scheduler) record(summary Summary) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	summaries := append(data.Summaries[summary.Cluster], summary)
+	if len(summaries) > maxSummaries {
+		summaries = summaries[len(summaries)-maxSummaries:]
+	}
+	data.Summaries[summary.Cluster] = summaries
+	return utils.WriteJSONFile(s.filePath, data)
+}
+
+// load reads the stored summaries, the caller must hold the mutex
+func (s *Scheduler) load() (*storeData, error) {
+	data := &storeData{}
+	if err := utils.ReadJSONFile(s.filePath, data); err != nil {
+		return nil, err
+	}
+	if data.Summaries == nil {
+		data.Summaries = map[string][]Summary{}
+	}
+	return data, nil
+}
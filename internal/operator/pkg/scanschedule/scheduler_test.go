@@ -0,0 +1,142 @@
+package scanschedule
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/imagepull"
+	"github.com/agentkube/operator/pkg/posture"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPod(namespace, name string, labels map[string]string, images ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox:1.36"}}
+	for i, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+	}
+	return pod
+}
+
+func TestDiscoverImages(t *testing.T) {
+	t.Parallel()
+
+	clientset := fake.NewSimpleClientset(
+		testPod("shop", "web-1", map[string]string{"app": "web"}, "nginx:1.25", "envoy:1.30"),
+		testPod("shop", "web-2", map[string]string{"app": "web"}, "nginx:1.25"),
+		testPod("shop", "api-1", map[string]string{"app": "api"}, "api:2.0"),
+		testPod("kube-system", "dns", map[string]string{"app": "dns"}, "coredns:1.11"),
+	)
+	excludeSystem := func(namespace string, _ map[string]string) bool { return namespace == "kube-system" }
+
+	tests := []struct {
+		name         string
+		target       Target
+		wantImages   []string
+		wantPods     int
+		wantExcluded int
+	}{
+		{"every namespace", Target{}, []string{"api:2.0", "busybox:1.36", "envoy:1.30", "nginx:1.25"}, 3, 1},
+		{"namespace", Target{Namespaces: []string{"kube-system"}}, []string{}, 0, 1},
+		{"labels", Target{Labels: map[string]string{"app": "web"}}, []string{"busybox:1.36", "envoy:1.30", "nginx:1.25"}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			summary := &Summary{Target: tt.target, Images: []string{}}
+			if _, err := discoverImages(context.Background(), clientset, summary, excludeSystem, nil); err != nil {
+				t.Fatalf("discoverImages() error = %v", err)
+			}
+			if !reflect.DeepEqual(summary.Images, tt.wantImages) || summary.Pods != tt.wantPods || summary.Excluded != tt.wantExcluded {
+				t.Errorf("discoverImages() = %v, %d pods, %d excluded, want %v, %d pods, %d excluded",
+					summary.Images, summary.Pods, summary.Excluded, tt.wantImages, tt.wantPods, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestDiscoverImageCredentials(t *testing.T) {
+	t.Parallel()
+
+	api := testPod("shop", "api-1", nil, "ghcr.io/acme/api:2.0", "nginx:1.25")
+	api.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "ghcr"}}
+	clientset := fake.NewSimpleClientset(
+		api,
+		testPod("shop", "web-1", nil, "ghcr.io/acme/web:1.0"),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "ghcr"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"ghcr.io":{"username":"bot","password":"secret"}}}`)},
+		},
+	)
+
+	summary := &Summary{Images: []string{}}
+	credentials, err := discoverImages(context.Background(), clientset, summary, nil, imagepull.NewPullSecretCache(clientset))
+	if err != nil {
+		t.Fatalf("discoverImages() error = %v", err)
+	}
+	// Only the images of pods with the secret, from its registry, get the credential
+	want := map[string][]imagepull.RegistryCredential{
+		"ghcr.io/acme/api:2.0": {{Registry: "ghcr.io", Username: "bot", Password: "secret", Source: "shop/ghcr"}},
+	}
+	if !reflect.DeepEqual(credentials, want) {
+		t.Errorf("discoverImages() credentials = %+v, want %+v", credentials, want)
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(image string) (posture.Severities, bool) {
+		if image == "nginx:1.25" {
+			return posture.Severities{Critical: 1, High: 2, Total: 3}, true
+		}
+		return posture.Severities{}, false
+	}
+	s := &Scheduler{lookup: lookup, filePath: filepath.Join(t.TempDir(), summariesFileName), running: map[string]bool{}}
+
+	for i := 0; i < maxSummaries+2; i++ {
+		summary := Summary{Cluster: "prod", Trigger: fmt.Sprintf("run-%d", i), Images: []string{"nginx:1.25", "api:2.0"}}
+		if err := s.record(summary); err != nil {
+			t.Fatalf("record() error = %v", err)
+		}
+	}
+	if err := s.record(Summary{Cluster: "dev", Trigger: TriggerManual, Error: "failed to list pods"}); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+
+	summaries, err := s.Summaries("prod")
+	if err != nil {
+		t.Fatalf("Summaries() error = %v", err)
+	}
+	if len(summaries) != maxSummaries {
+		t.Fatalf("Summaries() kept %d, want %d", len(summaries), maxSummaries)
+	}
+	latest := summaries[0]
+	if want := fmt.Sprintf("run-%d", maxSummaries+1); latest.Trigger != want {
+		t.Errorf("Summaries()[0] = %s, want the newest %s", latest.Trigger, want)
+	}
+	if latest.Scanned != 1 || latest.Pending != 1 || latest.Critical != 1 || latest.Total != 3 {
+		t.Errorf("Summaries()[0] tally = %+v, want 1 scanned, 1 pending, 1 critical of 3", latest)
+	}
+
+	status, err := s.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	var clusters []string
+	for _, summary := range status.Clusters {
+		clusters = append(clusters, summary.Cluster)
+	}
+	if want := []string{"dev", "prod"}; !reflect.DeepEqual(clusters, want) {
+		t.Errorf("Status() clusters = %v, want %v", clusters, want)
+	}
+}
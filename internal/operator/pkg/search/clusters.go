@@ -0,0 +1,241 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// DefaultClusterLimit caps the hits of a search across clusters without a limit
+	DefaultClusterLimit = 500
+	// MaxClusterLimit is the largest limit a search across clusters accepts
+	MaxClusterLimit = 5000
+
+	clusterSearchTimeout     = 20 * time.Second
+	clusterSearchConcurrency = 8
+)
+
+// ErrInvalidQuery is returned for searches across clusters with an invalid filter
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// ClusterQuery filters the resources searched across clusters. At least one of Name,
+// LabelSelector and Kind is required.
+type ClusterQuery struct {
+	// Name matches the resources whose name contains it, ignoring case
+	Name string
+	// LabelSelector is a Kubernetes label selector, evaluated by the API servers
+	LabelSelector string
+	// Kind is a standard resource type, by kind, plural or singular name, e.g. Deployment or deployments
+	Kind string
+	// Namespaces limits namespaced resources to these namespaces, all of them when empty
+	Namespaces []string
+	// Clusters are the contexts to search, all of them when empty
+	Clusters []string
+	Limit    int
+}
+
+// ClusterSearchResult is a resource matching a search across clusters
+type ClusterSearchResult struct {
+	Cluster string `json:"cluster"`
+	SearchResult
+	Kind   string            `json:"kind"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ClusterSearchStatus is the outcome of a search in one cluster
+type ClusterSearchStatus struct {
+	Cluster string `json:"cluster"`
+	Matches int    `json:"matches"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ClusterSearchResponse holds the merged results of a search across clusters, ordered by
+// cluster, resource type, namespace and name
+type ClusterSearchResponse struct {
+	Results  []ClusterSearchResult `json:"results"`
+	Clusters []ClusterSearchStatus `json:"clusters"`
+	// Truncated is true when more resources matched than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// SearchClusters queries the contexts of the store concurrently for the resources matching the
+// query. A cluster that can't be searched is reported in the response and doesn't fail the search.
+func SearchClusters(ctx context.Context, kubeConfigStore kubeconfig.ContextStore, query ClusterQuery) (*ClusterSearchResponse, error) {
+	query.Name = strings.ToLower(strings.TrimSpace(query.Name))
+	query.Kind = strings.TrimSpace(query.Kind)
+	if query.Name == "" && strings.TrimSpace(query.LabelSelector) == "" && query.Kind == "" {
+		return nil, fmt.Errorf("%w: a name, label selector or kind is required", ErrInvalidQuery)
+	}
+	if _, err := labels.Parse(query.LabelSelector); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if query.Limit < 0 || query.Limit > MaxClusterLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxClusterLimit)
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultClusterLimit
+	}
+
+	clusterNames := query.Clusters
+	if len(clusterNames) == 0 {
+		contexts, err := kubeConfigStore.GetContexts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list contexts: %v", err)
+		}
+		for _, kubeContext := range contexts {
+			if !kubeContext.Internal {
+				clusterNames = append(clusterNames, kubeContext.Name)
+			}
+		}
+	}
+
+	results := make([][]ClusterSearchResult, len(clusterNames))
+	errs := make([]error, len(clusterNames))
+	semaphore := make(chan struct{}, clusterSearchConcurrency)
+	var wg sync.WaitGroup
+	for idx, clusterName := range clusterNames {
+		wg.Add(1)
+		go func(idx int, clusterName string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			clusterCtx, cancel := context.WithTimeout(ctx, clusterSearchTimeout)
+			defer cancel()
+			results[idx], errs[idx] = searchCluster(clusterCtx, kubeConfigStore, clusterName, query)
+		}(idx, clusterName)
+	}
+	wg.Wait()
+
+	return mergeClusterResults(clusterNames, results, errs, query.Limit), nil
+}
+
+// searchCluster lists the resources of a cluster matching the query, up to its limit
+func searchCluster(ctx context.Context, kubeConfigStore kubeconfig.ContextStore, clusterName string, query ClusterQuery) ([]ClusterSearchResult, error) {
+	kubeContext, err := kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	controller, err := NewController(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	allResources, err := controller.getStandardResources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get standard resources: %v", err)
+	}
+	resources := resourcesOfKind(allResources, query.Kind)
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("resource type %s is not served by the cluster", query.Kind)
+	}
+
+	namespaces := query.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var results []ClusterSearchResult
+	for _, resource := range resources {
+		gvr := schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+		resourceNamespaces := namespaces
+		if !resource.Namespaced {
+			resourceNamespaces = []string{metav1.NamespaceAll}
+		}
+		for _, namespace := range resourceNamespaces {
+			list, err := controller.dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: query.LabelSelector})
+			if err != nil {
+				// Resources the context isn't allowed to list are skipped, like in single cluster searches
+				if ctx.Err() != nil {
+					return results, ctx.Err()
+				}
+				continue
+			}
+			for _, item := range list.Items {
+				if query.Name != "" && !strings.Contains(strings.ToLower(item.GetName()), query.Name) {
+					continue
+				}
+				results = append(results, ClusterSearchResult{
+					Cluster: clusterName,
+					SearchResult: SearchResult{
+						Namespace:    item.GetNamespace(),
+						Group:        resource.Group,
+						Version:      resource.Version,
+						ResourceType: resource.Resource,
+						ResourceName: item.GetName(),
+						Namespaced:   resource.Namespaced,
+					},
+					Kind:   resource.Kind,
+					Labels: item.GetLabels(),
+				})
+				// One more than the limit tells the merge the results are truncated
+				if len(results) > query.Limit {
+					return results, nil
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// resourcesOfKind returns the resources named by kind, by kind, plural or singular name.
+// An empty kind selects all of them.
+func resourcesOfKind(resources []APIResource, kind string) []APIResource {
+	if kind == "" {
+		return resources
+	}
+	var matched []APIResource
+	for _, resource := range resources {
+		if strings.EqualFold(resource.Kind, kind) || strings.EqualFold(resource.Resource, kind) ||
+			strings.EqualFold(strings.TrimSuffix(resource.Resource, "s"), kind) {
+			matched = append(matched, resource)
+		}
+	}
+	return matched
+}
+
+// mergeClusterResults orders the results of the clusters and caps them to the limit
+func mergeClusterResults(clusterNames []string, results [][]ClusterSearchResult, errs []error, limit int) *ClusterSearchResponse {
+	response := &ClusterSearchResponse{Results: []ClusterSearchResult{}, Clusters: []ClusterSearchStatus{}}
+	for idx, clusterName := range clusterNames {
+		status := ClusterSearchStatus{Cluster: clusterName, Matches: min(len(results[idx]), limit)}
+		if errs[idx] != nil {
+			status.Error = errs[idx].Error()
+		}
+		response.Clusters = append(response.Clusters, status)
+		response.Results = append(response.Results, results[idx]...)
+	}
+
+	sort.Slice(response.Clusters, func(i, j int) bool { return response.Clusters[i].Cluster < response.Clusters[j].Cluster })
+	sort.Slice(response.Results, func(i, j int) bool {
+		a, b := response.Results[i], response.Results[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.ResourceType != b.ResourceType {
+			return a.ResourceType < b.ResourceType
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.ResourceName < b.ResourceName
+	})
+	if len(response.Results) > limit {
+		response.Results = response.Results[:limit]
+		response.Truncated = true
+	}
+	return response
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResourcesOfKind(t *testing.T) {
+	t.Parallel()
+
+	resources := []APIResource{
+		{Group: "apps", Version: "v1", Resource: "deployments", Kind: "Deployment", Namespaced: true},
+		{Group: "", Version: "v1", Resource: "pods", Kind: "Pod", Namespaced: true},
+		{Group: "", Version: "v1", Resource: "nodes", Kind: "Node"},
+	}
+	tests := []struct {
+		kind string
+		want []string
+	}{
+		{"", []string{"deployments", "pods", "nodes"}},
+		{"Deployment", []string{"deployments"}},
+		{"pods", []string{"pods"}},
+		{"node", []string{"nodes"}},
+		{"replicasets", nil},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.kind, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, resource := range resourcesOfKind(resources, tt.kind) {
+				got = append(got, resource.Resource)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resourcesOfKind(%q) = %v, want %v", tt.kind, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeClusterResults(t *testing.T) {
+	t.Parallel()
+
+	hit := func(cluster, resourceType, namespace, name string) ClusterSearchResult {
+		return ClusterSearchResult{Cluster: cluster, SearchResult: SearchResult{ResourceType: resourceType, Namespace: namespace, ResourceName: name}}
+	}
+	results := [][]ClusterSearchResult{
+		{hit("prod", "pods", "shop", "web-2"), hit("prod", "deployments", "shop", "web"), hit("prod", "pods", "shop", "web-1")},
+		nil,
+		{hit("dev", "pods", "shop", "web-1")},
+	}
+	errs := []error{nil, errors.New("connection refused"), nil}
+
+	response := mergeClusterResults([]string{"prod", "staging", "dev"}, results, errs, 3)
+	var got []string
+	for _, r := range response.Results {
+		got = append(got, r.Cluster+" "+r.ResourceType+" "+r.ResourceName)
+	}
+	want := []string{"dev pods web-1", "prod deployments web", "prod pods web-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+	if !response.Truncated {
+		t.Error("results above the limit are not reported truncated")
+	}
+
+	wantClusters := []ClusterSearchStatus{
+		{Cluster: "dev", Matches: 1},
+		{Cluster: "prod", Matches: 3},
+		{Cluster: "staging", Error: "connection refused"},
+	}
+	if !reflect.DeepEqual(response.Clusters, wantClusters) {
+		t.Errorf("clusters = %+v, want %+v", response.Clusters, wantClusters)
+	}
+
+	if response := mergeClusterResults([]string{"dev"}, results[2:], errs[2:], 3); response.Truncated || len(response.Results) != 1 {
+		t.Errorf("merge below the limit = %+v, want 1 result, not truncated", response)
+	}
+}
@@ -0,0 +1,350 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/features"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "operator-updates.json"
+
+	// tickInterval is how often the monitor checks whether an update check is due
+	tickInterval = time.Minute
+
+	// DefaultURL is the release feed, in the shape of the GitHub releases API
+	DefaultURL = "https://api.github.com/repos/agentkube/agentkube/releases"
+)
+
+// Update channels
+const (
+	// ChannelStable only offers releases
+	ChannelStable = "stable"
+	// ChannelBeta also offers prereleases
+	ChannelBeta = "beta"
+)
+
+// ErrNotInCluster is returned for upgrades of an operator that doesn't run in a cluster
+var ErrNotInCluster = errors.New("self-upgrade is only available when the operator runs in-cluster")
+
+// Settings configure the update checks
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	Channel string `json:"channel"`
+	// URL is the release feed, in the shape of the GitHub releases API
+	URL           string `json:"url"`
+	IntervalHours int    `json:"intervalHours"`
+	// AutoUpgrade upgrades an in-cluster operator as soon as an update is found
+	AutoUpgrade bool `json:"autoUpgrade"`
+	// Image is the repository upgrades pull from, empty keeps the repository of the running image
+	Image string `json:"image,omitempty"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Enabled:       true,
+		Channel:       ChannelStable,
+		URL:           DefaultURL,
+		IntervalHours: 24,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.Channel != ChannelStable && s.Channel != ChannelBeta {
+		return fmt.Errorf("channel must be %s or %s", ChannelStable, ChannelBeta)
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if s.IntervalHours < 1 || s.IntervalHours > 24*30 {
+		return fmt.Errorf("intervalHours must be between 1 and 720")
+	}
+	return nil
+}
+
+// Release is an operator build offered by the release feed
+type Release struct {
+	Version     string    `json:"version"`
+	Prerelease  bool      `json:"prerelease"`
+	URL         string    `json:"url,omitempty"`
+	PublishedAt time.Time `json:"publishedAt"`
+	Notes       string    `json:"notes,omitempty"`
+}
+
+// Status is the result of the last update check
+type Status struct {
+	Current         BuildInfo  `json:"current"`
+	InCluster       bool       `json:"inCluster"`
+	Channel         string     `json:"channel"`
+	Latest          *Release   `json:"latest,omitempty"`
+	UpdateAvailable bool       `json:"updateAvailable"`
+	CheckedAt       *time.Time `json:"checkedAt,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// Manager checks the release feed for newer operator builds and upgrades in-cluster operators
+// through the operation queue
+type Manager struct {
+	queue        *utils.Queue
+	inCluster    bool
+	settingsPath string
+	httpClient   *http.Client
+	mutex        sync.Mutex
+	status       Status
+	lastRun      time.Time
+	stopChan     chan struct{}
+}
+
+// NewManager creates a new update manager
+func NewManager(queue *utils.Queue, inCluster bool) *Manager {
+	return &Manager{
+		queue:        queue,
+		inCluster:    inCluster,
+		settingsPath: filepath.Join(utils.ConfigDir(), settingsFileName),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		status:       Status{Current: Info(), InCluster: inCluster},
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Settings returns the current update settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new update settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.AutoUpgrade && !m.inCluster {
+		return ErrNotInCluster
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Status returns the result of the last update check
+func (m *Manager) Status() Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.status
+}
+
+// Start checks for updates on the configured interval until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the update checks
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Check fetches the release feed and reports whether a newer build is available on the channel
+func (m *Manager) Check(ctx context.Context) (Status, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return Status{}, err
+	}
+
+	now := time.Now()
+	status := Status{Current: Info(), InCluster: m.inCluster, Channel: settings.Channel, CheckedAt: &now}
+	releases, err := m.fetchReleases(ctx, settings.URL)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Latest = latestRelease(releases, settings.Channel)
+		status.UpdateAvailable = newer(status.Latest, status.Current.Version)
+	}
+
+	m.mutex.Lock()
+	m.status = status
+	m.mutex.Unlock()
+	return status, err
+}
+
+// Upgrade queues the upgrade of the in-cluster operator deployment to a version
+func (m *Manager) Upgrade(targetVersion, createdBy string) (*utils.Operation, error) {
+	if !m.inCluster {
+		return nil, ErrNotInCluster
+	}
+	if !features.Enabled(features.SelfUpgrade) {
+		return nil, fmt.Errorf("self-upgrade is disabled, enable the %s feature", features.SelfUpgrade)
+	}
+	if _, ok := parseVersion(targetVersion); !ok {
+		return nil, fmt.Errorf("invalid version %q", targetVersion)
+	}
+	for _, op := range m.queue.GetOperationsByType(OperationUpgrade) {
+		if op.Status == utils.StatusPending || op.Status == utils.StatusRunning {
+			return nil, fmt.Errorf("an upgrade to %v is already in progress", op.Data["version"])
+		}
+	}
+
+	operation := m.queue.AddOperation(OperationUpgrade, "operator", createdBy, map[string]interface{}{
+		"version": targetVersion,
+	}, []string{"operator", "upgrade"})
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"version":     targetVersion,
+		"operationId": operation.ID,
+	}, nil, "Queued operator upgrade")
+	return operation, nil
+}
+
+// monitor checks for updates when the interval elapsed, and upgrades when configured to
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load operator update settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalHours)*time.Hour
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	status, err := m.Check(context.Background())
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"url": settings.URL}, err, "Failed to check for operator updates")
+		return
+	}
+	if !status.UpdateAvailable {
+		return
+	}
+	logger.Log(logger.LevelInfo, map[string]string{
+		"current": status.Current.Version,
+		"latest":  status.Latest.Version,
+	}, nil, "Operator update available")
+
+	if settings.AutoUpgrade && m.inCluster {
+		if _, err := m.Upgrade(status.Latest.Version, "system"); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"version": status.Latest.Version}, err, "Failed to queue operator upgrade")
+		}
+	}
+}
+
+// githubRelease is a release of the GitHub releases API
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	HTMLURL     string    `json:"html_url"`
+	PublishedAt time.Time `json:"published_at"`
+	Body        string    `json:"body"`
+}
+
+// fetchReleases reads the release feed, skipping drafts and tags that aren't versions
+func (m *Manager) fetchReleases(ctx context.Context, feedURL string) ([]Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release feed returned %s", resp.Status)
+	}
+
+	var feed []githubRelease
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid release feed: %w", err)
+	}
+
+	releases := []Release{}
+	for _, r := range feed {
+		if r.Draft {
+			continue
+		}
+		if _, ok := parseVersion(r.TagName); !ok {
+			continue
+		}
+		releases = append(releases, Release{
+			Version:     r.TagName,
+			Prerelease:  r.Prerelease,
+			URL:         r.HTMLURL,
+			PublishedAt: r.PublishedAt,
+			Notes:       r.Body,
+		})
+	}
+	return releases, nil
+}
+
+// latestRelease returns the newest release of a channel, nil when there is none
+func latestRelease(releases []Release, channel string) *Release {
+	var latest *Release
+	var latestVersion semver
+	for i := range releases {
+		release := &releases[i]
+		v, ok := parseVersion(release.Version)
+		if !ok || (channel == ChannelStable && (release.Prerelease || len(v.prerelease) > 0)) {
+			continue
+		}
+		if latest == nil || compareVersions(v, latestVersion) > 0 {
+			latest, latestVersion = release, v
+		}
+	}
+	return latest
+}
+
+// newer reports whether a release is newer than the running version. Development builds aren't
+// versions and are never offered updates.
+func newer(release *Release, current string) bool {
+	if release == nil {
+		return false
+	}
+	currentVersion, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	releaseVersion, _ := parseVersion(release.Version)
+	return compareVersions(releaseVersion, currentVersion) > 0
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
@@ -0,0 +1,91 @@
+package selfupdate
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.2.3", "v1.2.3-beta.1", 1},
+		{"v1.2.3-beta.2", "v1.2.3-beta.10", -1},
+		{"v1.2.3-rc.1", "v1.2.3-beta.1", 1},
+		{"v1.2.3-beta", "v1.2.3-beta.1", -1},
+		{"v1.2.3-4-gabcdef-dirty", "v1.2.3", 0},
+		{"v1.2.3+build.5", "v1.2.3", 0},
+	}
+
+	for _, tt := range tests {
+		a, okA := parseVersion(tt.a)
+		b, okB := parseVersion(tt.b)
+		if !okA || !okB {
+			t.Fatalf("parseVersion(%q, %q) failed", tt.a, tt.b)
+		}
+		if got := compareVersions(a, b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"dev", "", "1.2", "v1.2.x", "v1.2.3-"} {
+		if _, ok := parseVersion(invalid); ok {
+			t.Errorf("parseVersion(%q) succeeded, want failure", invalid)
+		}
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	t.Parallel()
+
+	releases := []Release{
+		{Version: "v1.4.0"},
+		{Version: "v1.5.0-beta.1", Prerelease: true},
+		{Version: "v1.3.2"},
+		{Version: "v1.5.0-rc.1"},
+	}
+
+	tests := []struct {
+		channel string
+		current string
+		want    string
+		newer   bool
+	}{
+		{ChannelStable, "v1.3.2", "v1.4.0", true},
+		{ChannelStable, "v1.4.0", "v1.4.0", false},
+		{ChannelBeta, "v1.4.0", "v1.5.0-rc.1", true},
+		{ChannelStable, "dev", "v1.4.0", false},
+	}
+
+	for _, tt := range tests {
+		got := latestRelease(releases, tt.channel)
+		if got == nil || got.Version != tt.want {
+			t.Errorf("latestRelease(%s) = %+v, want %s", tt.channel, got, tt.want)
+			continue
+		}
+		if newer(got, tt.current) != tt.newer {
+			t.Errorf("newer(%s, %s) = %v, want %v", got.Version, tt.current, !tt.newer, tt.newer)
+		}
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"ghcr.io/agentkube/operator:v1.2.3":        "ghcr.io/agentkube/operator",
+		"registry.local:5000/agentkube/operator":   "registry.local:5000/agentkube/operator",
+		"agentkube/operator@sha256:abc":            "agentkube/operator",
+		"registry.local:5000/operator:v1@sha256:a": "registry.local:5000/operator",
+	}
+	for image, want := range tests {
+		if got := imageRepository(image); got != want {
+			t.Errorf("imageRepository(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
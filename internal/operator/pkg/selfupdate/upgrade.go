@@ -0,0 +1,183 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// OperationUpgrade is the operation type of operator upgrades
+	OperationUpgrade = "operator-upgrade"
+
+	// UpgradedFromAnnotation records the image an upgrade replaced, to roll back by hand
+	UpgradedFromAnnotation = "agentkube.io/upgraded-from"
+
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Processor upgrades the in-cluster operator deployment for the operation queue
+type Processor struct {
+	manager *Manager
+}
+
+// NewProcessor creates a new operator upgrade processor
+func NewProcessor(manager *Manager) *Processor {
+	return &Processor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes operator upgrade operations
+func (p *Processor) ProcessOperation(op *utils.Operation) error {
+	if op.Type != OperationUpgrade {
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+	return p.processUpgrade(op)
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *Processor) CanProcess(operationType string) bool {
+	return operationType == OperationUpgrade
+}
+
+// processUpgrade points the operator deployment at the image of the target version. The rollout
+// of the deployment then replaces the pod running this operator, so the operation completes as
+// soon as the deployment is updated.
+func (p *Processor) processUpgrade(op *utils.Operation) error {
+	queue := p.manager.queue
+	targetVersion, _ := op.Data["version"].(string)
+	settings, err := p.manager.Settings()
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return utils.NonRetryable(fmt.Errorf("%w: %v", ErrNotInCluster, err))
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 30, "Finding the operator deployment", nil)
+	ctx := context.Background()
+	namespace, deploymentName, containerName, err := ownDeployment(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 60, "Updating the operator image", nil)
+	var previousImage, image string
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range deployment.Spec.Template.Spec.Containers {
+			container := &deployment.Spec.Template.Spec.Containers[i]
+			if container.Name != containerName {
+				continue
+			}
+			previousImage = container.Image
+			repository := settings.Image
+			if repository == "" {
+				repository = imageRepository(container.Image)
+			}
+			image = repository + ":" + targetVersion
+			if image == previousImage {
+				return nil
+			}
+			container.Image = image
+			if deployment.Spec.Template.Annotations == nil {
+				deployment.Spec.Template.Annotations = map[string]string{}
+			}
+			deployment.Spec.Template.Annotations[UpgradedFromAnnotation] = previousImage
+			_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+			return err
+		}
+		return utils.NonRetryable(fmt.Errorf("container %s not found in deployment %s/%s", containerName, namespace, deploymentName))
+	})
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperationData(op.ID, map[string]interface{}{
+		"deployment":    namespace + "/" + deploymentName,
+		"previousImage": previousImage,
+		"image":         image,
+	})
+	if image == previousImage {
+		queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "The operator already runs "+image, nil)
+		return nil
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusCompleted, 100,
+		fmt.Sprintf("Deployment %s/%s updated to %s, the rollout replaces the operator pod", namespace, deploymentName, image), nil)
+	logger.Log(logger.LevelInfo, map[string]string{
+		"deployment":    namespace + "/" + deploymentName,
+		"previousImage": previousImage,
+		"image":         image,
+	}, nil, "Operator upgrade rolled out")
+	return nil
+}
+
+// ownDeployment finds the deployment and container running this operator from the pod it runs in
+func ownDeployment(ctx context.Context, clientset kubernetes.Interface) (namespace, deployment, container string, err error) {
+	data, err := os.ReadFile(namespaceFile)
+	if err != nil {
+		return "", "", "", utils.NonRetryable(fmt.Errorf("failed to read the operator namespace: %w", err))
+	}
+	namespace = strings.TrimSpace(string(data))
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName, _ = os.Hostname()
+	}
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get the operator pod %s/%s: %w", namespace, podName, err)
+	}
+
+	switch {
+	case len(pod.Spec.Containers) == 1:
+		container = pod.Spec.Containers[0].Name
+	case os.Getenv("CONTAINER_NAME") != "":
+		container = os.Getenv("CONTAINER_NAME")
+	default:
+		return "", "", "", utils.NonRetryable(fmt.Errorf("the operator pod has several containers, set CONTAINER_NAME to the operator container"))
+	}
+
+	replicaSet := metav1.GetControllerOf(pod)
+	if replicaSet == nil || replicaSet.Kind != "ReplicaSet" {
+		return "", "", "", utils.NonRetryable(fmt.Errorf("the operator pod %s is not managed by a deployment", podName))
+	}
+	rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, replicaSet.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get replicaset %s: %w", replicaSet.Name, err)
+	}
+	owner := metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return "", "", "", utils.NonRetryable(fmt.Errorf("the operator pod %s is not managed by a deployment", podName))
+	}
+	return namespace, owner.Name, container, nil
+}
+
+// imageRepository strips the tag and digest of an image reference
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
@@ -0,0 +1,141 @@
+package selfupdate
+
+import (
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Build information of the running operator, set by main from the values linked with -ldflags
+var (
+	version   = "dev"
+	buildTime = ""
+)
+
+// SetBuild records the version and build time the binary was linked with
+func SetBuild(v, t string) {
+	if v != "" {
+		version = v
+	}
+	buildTime = t
+}
+
+// BuildInfo describes the running operator build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Info returns the build information of the running operator
+func Info() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// semver is a parsed semantic version
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// describeSuffix is what git describe appends to the tag of builds after it, e.g. -4-gabcdef-dirty
+var describeSuffix = regexp.MustCompile(`(-[0-9]+-g[0-9a-f]+)?(-dirty)?$`)
+
+// parseVersion parses versions like v1.2.3 and 1.2.3-beta.1, build metadata is ignored. Versions
+// of git describe such as v1.2.3-4-gabcdef parse as the tag they were built after.
+func parseVersion(s string) (semver, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s = describeSuffix.ReplaceAllString(s, "")
+	s, _, _ = strings.Cut(s, "+")
+	core, prerelease, hasPrerelease := strings.Cut(s, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		numbers[i] = n
+	}
+
+	v := semver{major: numbers[0], minor: numbers[1], patch: numbers[2]}
+	if hasPrerelease {
+		if prerelease == "" {
+			return semver{}, false
+		}
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	return v, true
+}
+
+// compareVersions returns -1, 0 or 1 as a is older, the same or newer than b, following the
+// precedence rules of semantic versioning
+func compareVersions(a, b semver) int {
+	for _, pair := range [][2]int{{a.major, b.major}, {a.minor, b.minor}, {a.patch, b.patch}} {
+		if c := compareInts(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+
+	// A release is newer than its prereleases
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, y := a.prerelease[i], b.prerelease[i]
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			if c := compareInts(xn, yn); c != 0 {
+				return c
+			}
+		case xErr == nil:
+			// Numeric identifiers have lower precedence than alphanumeric ones
+			return -1
+		case yErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(a.prerelease), len(b.prerelease))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package severity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	config "github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/event"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// statuses are the severities rules assign, by lowercase name
+var statuses = map[string]string{"normal": "Normal", "warning": "Warning", "danger": "Danger"}
+
+// compiledRule is a checked severity rule
+type compiledRule struct {
+	kinds      []string
+	reasons    []string
+	namespaces []string
+	labels     map[string]string
+	fields     []fieldMatch
+	severity   string
+	suppress   bool
+}
+
+// fieldMatch is a value expected at a path of an object
+type fieldMatch struct {
+	path  []string
+	value string
+}
+
+// Rules assign severities to events, the first matching rule applies
+type Rules struct {
+	rules []compiledRule
+}
+
+// Compile checks the configured rules. A rule must either suppress events or assign a known severity.
+func Compile(conf []config.SeverityRule) (*Rules, error) {
+	rules := &Rules{}
+	for i, c := range conf {
+		rule := compiledRule{
+			kinds:      c.Kinds,
+			reasons:    c.Reasons,
+			namespaces: c.Namespaces,
+			labels:     c.Labels,
+			suppress:   c.Suppress,
+		}
+		if !c.Suppress {
+			status, ok := statuses[strings.ToLower(c.Severity)]
+			if !ok {
+				return nil, fmt.Errorf("severity rule %d: unknown severity %q, expected Normal, Warning or Danger", i, c.Severity)
+			}
+			rule.severity = status
+		}
+		for path, value := range c.Fields {
+			segments := strings.Split(path, ".")
+			for _, segment := range segments {
+				if segment == "" {
+					return nil, fmt.Errorf("severity rule %d: invalid field path %q", i, path)
+				}
+			}
+			rule.fields = append(rule.fields, fieldMatch{path: segments, value: value})
+		}
+		rules.rules = append(rules.rules, rule)
+	}
+	return rules, nil
+}
+
+// Apply sets the severity of the event from the first rule it matches. It returns false when
+// the rule suppresses the event. Events matching no rule are left as they are.
+func (r *Rules) Apply(e *event.Event) bool {
+	if r == nil {
+		return true
+	}
+	for _, rule := range r.rules {
+		if !rule.matches(e) {
+			continue
+		}
+		if rule.suppress {
+			return false
+		}
+		e.Status = rule.severity
+		return true
+	}
+	return true
+}
+
+// Len returns the number of rules
+func (r *Rules) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.rules)
+}
+
+func (rule compiledRule) matches(e *event.Event) bool {
+	if !matchesAny(rule.kinds, e.Kind, strings.EqualFold) ||
+		!matchesAny(rule.reasons, e.Reason, strings.EqualFold) ||
+		!matchesAny(rule.namespaces, e.Namespace, func(a, b string) bool { return a == b }) {
+		return false
+	}
+	if len(rule.labels) > 0 {
+		accessor, err := meta.Accessor(e.Obj)
+		if err != nil {
+			return false
+		}
+		labels := accessor.GetLabels()
+		for key, value := range rule.labels {
+			if actual, ok := labels[key]; !ok || actual != value {
+				return false
+			}
+		}
+	}
+	if len(rule.fields) > 0 {
+		if e.Obj == nil {
+			return false
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(e.Obj)
+		if err != nil {
+			return false
+		}
+		for _, field := range rule.fields {
+			value, ok := lookup(content, field.path)
+			if !ok || fmt.Sprint(value) != field.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookup returns the value at a path of map keys and list indexes
+func lookup(content interface{}, segments []string) (interface{}, bool) {
+	value := content
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func matchesAny(values []string, value string, equal func(a, b string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package severity
+
+import (
+	"testing"
+
+	config "github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/event"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rules   []config.SeverityRule
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "severity", rules: []config.SeverityRule{{Kinds: []string{"Pod"}, Severity: "danger"}}},
+		{name: "suppress without severity", rules: []config.SeverityRule{{Suppress: true}}},
+		{name: "missing severity", rules: []config.SeverityRule{{Kinds: []string{"Pod"}}}, wantErr: true},
+		{name: "unknown severity", rules: []config.SeverityRule{{Severity: "critical"}}, wantErr: true},
+		{name: "invalid field path", rules: []config.SeverityRule{{Severity: "Normal", Fields: map[string]string{"status..phase": "Failed"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Compile(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	rules, err := Compile([]config.SeverityRule{
+		{Namespaces: []string{"scratch"}, Suppress: true},
+		{Kinds: []string{"pod"}, Fields: map[string]string{"status.phase": "Failed"}, Severity: "Danger"},
+		{Kinds: []string{"Pod"}, Reasons: []string{"Deleted"}, Labels: map[string]string{"tier": "batch"}, Severity: "Normal"},
+		{Fields: map[string]string{"spec.containers.0.name": "sidecar"}, Severity: "Normal"},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	pod := func(namespace, reason, phase string, labels map[string]string, container string) event.Event {
+		return event.Event{
+			Kind:      "Pod",
+			Namespace: namespace,
+			Reason:    reason,
+			Status:    "Warning",
+			Obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: container}}},
+				Status:     corev1.PodStatus{Phase: corev1.PodPhase(phase)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		event      event.Event
+		wantNotify bool
+		wantStatus string
+	}{
+		{name: "suppressed namespace", event: pod("scratch", "Updated", "Failed", nil, "app"), wantNotify: false, wantStatus: "Warning"},
+		{name: "field match", event: pod("shop", "Updated", "Failed", nil, "app"), wantNotify: true, wantStatus: "Danger"},
+		{name: "label and reason match", event: pod("shop", "Deleted", "Running", map[string]string{"tier": "batch"}, "app"), wantNotify: true, wantStatus: "Normal"},
+		{name: "label mismatch", event: pod("shop", "Deleted", "Running", map[string]string{"tier": "web"}, "app"), wantNotify: true, wantStatus: "Warning"},
+		{name: "list index", event: pod("shop", "Updated", "Running", nil, "sidecar"), wantNotify: true, wantStatus: "Normal"},
+		{name: "no object", event: event.Event{Kind: "Pod", Namespace: "shop", Reason: "Updated", Status: "Warning"}, wantNotify: true, wantStatus: "Warning"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			e := tt.event
+			if notify := rules.Apply(&e); notify != tt.wantNotify {
+				t.Errorf("Apply() = %v, want %v", notify, tt.wantNotify)
+			}
+			if e.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", e.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package shutdown
+
+import (
+	"path/filepath"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	journalFileName = "operation-journal.json"
+	// maxJournalReports bounds the shutdowns kept in the journal, oldest dropped first
+	maxJournalReports = 20
+)
+
+// journalPath is a variable for tests
+var journalPath = func() string {
+	return filepath.Join(utils.ConfigDir(), journalFileName)
+}
+
+// Journal returns the reports of the last shutdowns, oldest first
+func Journal() ([]Report, error) {
+	var reports []Report
+	if err := utils.ReadJSONFile(journalPath(), &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func appendJournal(report Report) error {
+	reports, err := Journal()
+	if err != nil {
+		// A corrupt journal is replaced rather than blocking the shutdown
+		reports = nil
+	}
+	reports = append(reports, report)
+	if len(reports) > maxJournalReports {
+		reports = reports[len(reports)-maxJournalReports:]
+	}
+	// Checkpoints carry operation data, which may be sensitive
+	return utils.WriteJSONFileMode(journalPath(), reports, 0600)
+}
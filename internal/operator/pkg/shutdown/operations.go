@@ -0,0 +1,29 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+// DrainOperations drains the operation queues, checkpointing the operations they abandon with
+// what is needed to resubmit them
+func DrainOperations(ctx context.Context) []Abandoned {
+	var abandoned []Abandoned
+	for _, op := range utils.DrainQueues(ctx) {
+		abandoned = append(abandoned, Abandoned{
+			Component:   "operations",
+			ID:          op.ID,
+			Description: fmt.Sprintf("%s on %s at %d%%: %s", op.Type, op.Target, op.Progress, op.Message),
+			Checkpoint: map[string]interface{}{
+				"type":      op.Type,
+				"target":    op.Target,
+				"createdBy": op.CreatedBy,
+				"data":      op.Data,
+				"tags":      op.Tags,
+			},
+		})
+	}
+	return abandoned
+}
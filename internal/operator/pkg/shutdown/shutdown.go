@@ -0,0 +1,124 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+)
+
+// Priority orders the draining of in-flight work at shutdown, lower values drain first and
+// later priorities get the time the earlier ones left
+type Priority int
+
+const (
+	// PriorityOperations are cluster operations, which leave clusters half-changed when abandoned
+	PriorityOperations Priority = iota
+	// PriorityDeliveries are dispatcher deliveries of events already observed
+	PriorityDeliveries
+	// PriorityScans are scans, which can be rerun
+	PriorityScans
+)
+
+// Abandoned is in-flight work that did not finish before the shutdown deadline
+type Abandoned struct {
+	Component   string `json:"component"`
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description"`
+	// Checkpoint holds what is needed to resubmit the work
+	Checkpoint map[string]interface{} `json:"checkpoint,omitempty"`
+}
+
+// Drainer finishes the in-flight work of a component before ctx is done and returns what it abandoned
+type Drainer func(ctx context.Context) []Abandoned
+
+type registration struct {
+	name     string
+	priority Priority
+	drain    Drainer
+}
+
+var (
+	registrations []registration
+	mutex         sync.Mutex
+)
+
+// Register adds a component drained at shutdown
+func Register(name string, priority Priority, drain Drainer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	registrations = append(registrations, registration{name: name, priority: priority, drain: drain})
+}
+
+// Report is the outcome of a shutdown, kept in the operation journal
+type Report struct {
+	StartedAt time.Time `json:"startedAt"`
+	Duration  string    `json:"duration"`
+	// Drained lists the components that finished their in-flight work
+	Drained   []string    `json:"drained"`
+	Abandoned []Abandoned `json:"abandoned"`
+}
+
+// Drain drains the registered components within the timeout, in priority order and the components
+// of a priority concurrently. Abandoned work is logged and the report appended to the operation journal.
+func Drain(timeout time.Duration) Report {
+	mutex.Lock()
+	pending := append([]registration(nil), registrations...)
+	mutex.Unlock()
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].priority < pending[j].priority })
+
+	report := drain(pending, timeout)
+
+	for _, abandoned := range report.Abandoned {
+		logger.Log(logger.LevelWarn, map[string]string{"component": abandoned.Component, "id": abandoned.ID}, nil,
+			"Abandoned at shutdown: "+abandoned.Description)
+	}
+	logger.Log(logger.LevelInfo, map[string]string{
+		"drained":   fmt.Sprintf("%v", report.Drained),
+		"abandoned": fmt.Sprintf("%d", len(report.Abandoned)),
+		"duration":  report.Duration,
+	}, nil, "In-flight work drained")
+
+	if err := appendJournal(report); err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to write the shutdown report to the operation journal")
+	}
+	return report
+}
+
+func drain(pending []registration, timeout time.Duration) Report {
+	report := Report{StartedAt: time.Now(), Drained: []string{}, Abandoned: []Abandoned{}}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for start := 0; start < len(pending); {
+		end := start
+		for end < len(pending) && pending[end].priority == pending[start].priority {
+			end++
+		}
+
+		results := make([][]Abandoned, end-start)
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i-start] = pending[i].drain(ctx)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, abandoned := range results {
+			if len(abandoned) == 0 {
+				report.Drained = append(report.Drained, pending[start+i].name)
+			}
+			report.Abandoned = append(report.Abandoned, abandoned...)
+		}
+		start = end
+	}
+
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	return report
+}
@@ -0,0 +1,63 @@
+package shutdown
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	dir := t.TempDir()
+	journalPath = func() string { return filepath.Join(dir, journalFileName) }
+
+	var (
+		mutex sync.Mutex
+		order []string
+	)
+	drainer := func(name string, abandon bool) Drainer {
+		return func(ctx context.Context) []Abandoned {
+			if abandon {
+				<-ctx.Done()
+			}
+			mutex.Lock()
+			order = append(order, name)
+			mutex.Unlock()
+			if abandon {
+				return []Abandoned{{Component: name, Description: "still running"}}
+			}
+			return nil
+		}
+	}
+
+	report := drain([]registration{
+		{name: "operations", priority: PriorityOperations, drain: drainer("operations", false)},
+		{name: "dispatcher", priority: PriorityDeliveries, drain: drainer("dispatcher", true)},
+		{name: "image-scans", priority: PriorityScans, drain: drainer("image-scans", false)},
+	}, 100*time.Millisecond)
+
+	if want := []string{"operations", "dispatcher", "image-scans"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("drained in order %v, want %v", order, want)
+	}
+	if want := []string{"operations", "image-scans"}; !reflect.DeepEqual(report.Drained, want) {
+		t.Errorf("Drained = %v, want %v", report.Drained, want)
+	}
+	if len(report.Abandoned) != 1 || report.Abandoned[0].Component != "dispatcher" {
+		t.Errorf("Abandoned = %+v, want the dispatcher", report.Abandoned)
+	}
+
+	for i := 0; i < maxJournalReports+2; i++ {
+		if err := appendJournal(report); err != nil {
+			t.Fatalf("appendJournal() error = %v", err)
+		}
+	}
+	reports, err := Journal()
+	if err != nil {
+		t.Fatalf("Journal() error = %v", err)
+	}
+	if len(reports) != maxJournalReports {
+		t.Errorf("Journal() kept %d reports, want %d", len(reports), maxJournalReports)
+	}
+}
@@ -0,0 +1,334 @@
+package spread
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Issue types reported for a workload
+const (
+	IssueSingleNode     = "single-node"
+	IssueSingleZone     = "single-zone"
+	IssueZoneSkew       = "zone-skew"
+	IssueNodeSkew       = "node-skew"
+	IssueNoSpreadPolicy = "no-spread-constraints"
+)
+
+const unknownZone = "unknown"
+
+// generatedLabels are pod labels set by controllers per revision or per pod, they do not select
+// every pod of a workload
+var generatedLabels = map[string]bool{
+	"pod-template-hash":                        true,
+	"controller-revision-hash":                 true,
+	"statefulset.kubernetes.io/pod-name":       true,
+	"apps.kubernetes.io/pod-index":             true,
+	"pod-template-generation":                  true,
+	"batch.kubernetes.io/controller-uid":       true,
+	"batch.kubernetes.io/job-name":             true,
+	"batch.kubernetes.io/job-completion-index": true,
+	"controller-uid":                           true,
+	"job-name":                                 true,
+}
+
+// patchableKinds are the workloads whose pod template can be patched with spread constraints
+var patchableKinds = map[string]bool{"Deployment": true, "StatefulSet": true, "ReplicaSet": true}
+
+// Reporter analyses how the pods of multi-replica workloads are spread over zones and nodes
+type Reporter struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// Report is the spread of the multi-replica workloads of a cluster
+type Report struct {
+	Cluster string `json:"cluster"`
+	// Zones are the zones of the schedulable nodes
+	Zones     []string         `json:"zones"`
+	Nodes     int              `json:"nodes"`
+	Workloads []WorkloadSpread `json:"workloads"`
+	// Concentrated counts workloads running in a single failure domain
+	Concentrated int `json:"concentrated"`
+}
+
+// WorkloadSpread is the distribution of the running pods of a workload
+type WorkloadSpread struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Pods      int            `json:"pods"`
+	Zones     map[string]int `json:"zones"`
+	Nodes     map[string]int `json:"nodes"`
+	ZoneSkew  int            `json:"zoneSkew"`
+	NodeSkew  int            `json:"nodeSkew"`
+	// Constraints are the topology keys the pods already spread over
+	Constraints []string `json:"constraints"`
+	Issues      []string `json:"issues"`
+	Messages    []string `json:"messages"`
+	// Patch is a strategic merge patch adding the missing spread constraints to the pod template
+	Patch map[string]interface{} `json:"patch,omitempty"`
+}
+
+// NewReporter creates a new topology spread reporter
+func NewReporter(kubeConfigStore kubeconfig.ContextStore) *Reporter {
+	return &Reporter{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// Report analyses the workloads with at least two running pods, of a namespace or all namespaces
+func (r *Reporter) Report(clusterName, namespace string) (*Report, error) {
+	kubeContext, err := r.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	ctx := context.Background()
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	replicaSetOwners, err := utils.ReplicaSetOwners(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeZones := map[string]string{}
+	zones := map[string]bool{}
+	schedulable := 0
+	for _, node := range nodes.Items {
+		zone := zoneOf(&node)
+		nodeZones[node.Name] = zone
+		if !node.Spec.Unschedulable {
+			zones[zone] = true
+			schedulable++
+		}
+	}
+
+	report := &Report{Cluster: clusterName, Zones: []string{}, Nodes: schedulable, Workloads: []WorkloadSpread{}}
+	for zone := range zones {
+		report.Zones = append(report.Zones, zone)
+	}
+	sort.Strings(report.Zones)
+
+	type workloadKey struct{ kind, namespace, name string }
+	workloadPods := map[workloadKey][]corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		kind, name := utils.WorkloadOf(&pod, replicaSetOwners)
+		// DaemonSets run on every node by design
+		if kind == "DaemonSet" || kind == "Pod" {
+			continue
+		}
+		key := workloadKey{kind, pod.Namespace, name}
+		workloadPods[key] = append(workloadPods[key], pod)
+	}
+
+	for key, pods := range workloadPods {
+		if len(pods) < 2 {
+			continue
+		}
+		spread := analyze(pods, nodeZones, report.Zones, schedulable)
+		spread.Kind, spread.Namespace, spread.Name = key.kind, key.namespace, key.name
+		if !patchableKinds[key.kind] {
+			spread.Patch = nil
+		}
+		if hasIssue(spread, IssueSingleNode) || hasIssue(spread, IssueSingleZone) {
+			report.Concentrated++
+		}
+		report.Workloads = append(report.Workloads, spread)
+	}
+
+	sort.Slice(report.Workloads, func(i, j int) bool {
+		a, b := report.Workloads[i], report.Workloads[j]
+		if len(a.Issues) != len(b.Issues) {
+			return len(a.Issues) > len(b.Issues)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
+
+// analyze computes the spread of the pods of a workload over zones and nodes and suggests
+// constraints for the topologies they are not spread over yet
+func analyze(pods []corev1.Pod, nodeZones map[string]string, zones []string, nodes int) WorkloadSpread {
+	spread := WorkloadSpread{
+		Pods:        len(pods),
+		Zones:       map[string]int{},
+		Nodes:       map[string]int{},
+		Constraints: []string{},
+		Issues:      []string{},
+		Messages:    []string{},
+	}
+	addIssue := func(issue, message string) {
+		spread.Issues = append(spread.Issues, issue)
+		spread.Messages = append(spread.Messages, message)
+	}
+
+	for _, pod := range pods {
+		spread.Nodes[pod.Spec.NodeName]++
+		zone, ok := nodeZones[pod.Spec.NodeName]
+		if !ok {
+			zone = unknownZone
+		}
+		spread.Zones[zone]++
+	}
+
+	constrained := map[string]bool{}
+	for _, constraint := range pods[0].Spec.TopologySpreadConstraints {
+		constrained[constraint.TopologyKey] = true
+	}
+	if affinity := pods[0].Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+		for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			constrained[term.TopologyKey] = true
+		}
+		for _, term := range affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			constrained[term.PodAffinityTerm.TopologyKey] = true
+		}
+	}
+	for key := range constrained {
+		spread.Constraints = append(spread.Constraints, key)
+	}
+	sort.Strings(spread.Constraints)
+
+	// Skew is measured over every zone, zones without pods count as zero like the scheduler does
+	zoneCounts := make([]int, 0, len(zones))
+	for _, zone := range zones {
+		zoneCounts = append(zoneCounts, spread.Zones[zone])
+	}
+	spread.ZoneSkew = skew(zoneCounts)
+	nodeCounts := make([]int, 0, len(spread.Nodes))
+	for _, count := range spread.Nodes {
+		nodeCounts = append(nodeCounts, count)
+	}
+	// Nodes without pods are only counted when there are fewer used nodes than pods
+	if len(spread.Nodes) < nodes && len(spread.Nodes) < spread.Pods {
+		nodeCounts = append(nodeCounts, 0)
+	}
+	spread.NodeSkew = skew(nodeCounts)
+
+	multiZone := len(zones) > 1
+	switch {
+	case len(spread.Nodes) == 1 && nodes > 1:
+		addIssue(IssueSingleNode, fmt.Sprintf("all %d pods run on node %s, a single node failure takes the workload down", spread.Pods, pods[0].Spec.NodeName))
+	case spread.NodeSkew > 1:
+		addIssue(IssueNodeSkew, fmt.Sprintf("pods are unevenly spread over nodes, skew %d", spread.NodeSkew))
+	}
+	switch {
+	case multiZone && len(spread.Zones) == 1:
+		for zone := range spread.Zones {
+			addIssue(IssueSingleZone, fmt.Sprintf("all %d pods run in zone %s, a zone outage takes the workload down", spread.Pods, zone))
+		}
+	case multiZone && spread.ZoneSkew > 1:
+		addIssue(IssueZoneSkew, fmt.Sprintf("pods are unevenly spread over %d zones, skew %d", len(zones), spread.ZoneSkew))
+	}
+
+	missing := []string{}
+	if multiZone && !constrained[corev1.LabelTopologyZone] {
+		missing = append(missing, corev1.LabelTopologyZone)
+	}
+	if nodes > 1 && !constrained[corev1.LabelHostname] {
+		missing = append(missing, corev1.LabelHostname)
+	}
+	if len(missing) > 0 && len(constrained) == 0 {
+		addIssue(IssueNoSpreadPolicy, "pods have no topology spread constraints or pod anti-affinity")
+	}
+	if len(missing) > 0 && len(spread.Issues) > 0 {
+		spread.Patch = suggestPatch(pods, missing)
+	}
+	return spread
+}
+
+// suggestPatch builds a strategic merge patch adding soft spread constraints for the topology keys,
+// selecting the pods by the labels they all share
+func suggestPatch(pods []corev1.Pod, topologyKeys []string) map[string]interface{} {
+	matchLabels := map[string]string{}
+	for key, value := range pods[0].Labels {
+		if !generatedLabels[key] {
+			matchLabels[key] = value
+		}
+	}
+	for _, pod := range pods[1:] {
+		for key, value := range matchLabels {
+			if pod.Labels[key] != value {
+				delete(matchLabels, key)
+			}
+		}
+	}
+	if len(matchLabels) == 0 {
+		return nil
+	}
+
+	constraints := make([]corev1.TopologySpreadConstraint, 0, len(topologyKeys))
+	for _, key := range topologyKeys {
+		constraints = append(constraints, corev1.TopologySpreadConstraint{
+			MaxSkew:     1,
+			TopologyKey: key,
+			// ScheduleAnyway never leaves pods pending, the scheduler only prefers balanced placements
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: matchLabels},
+		})
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"topologySpreadConstraints": constraints,
+				},
+			},
+		},
+	}
+}
+
+func skew(counts []int) int {
+	if len(counts) == 0 {
+		return 0
+	}
+	min, max := counts[0], counts[0]
+	for _, count := range counts[1:] {
+		if count < min {
+			min = count
+		}
+		if count > max {
+			max = count
+		}
+	}
+	return max - min
+}
+
+func zoneOf(node *corev1.Node) string {
+	if zone := node.Labels[corev1.LabelTopologyZone]; zone != "" {
+		return zone
+	}
+	if zone := node.Labels[corev1.LabelFailureDomainBetaZone]; zone != "" {
+		return zone
+	}
+	return unknownZone
+}
+
+func hasIssue(spread WorkloadSpread, issue string) bool {
+	for _, existing := range spread.Issues {
+		if existing == issue {
+			return true
+		}
+	}
+	return false
+}
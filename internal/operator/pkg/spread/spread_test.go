@@ -0,0 +1,98 @@
+package spread
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podOn(node string, hash string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "cart", "pod-template-hash": hash}},
+		Spec:       corev1.PodSpec{NodeName: node},
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+
+	nodeZones := map[string]string{"a1": "zone-a", "a2": "zone-a", "b1": "zone-b", "c1": "zone-c"}
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+
+	spreadPod := podOn("a1", "1")
+	spreadPod.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone},
+		{MaxSkew: 1, TopologyKey: corev1.LabelHostname},
+	}
+
+	tests := []struct {
+		name       string
+		pods       []corev1.Pod
+		wantIssues []string
+		wantSkew   int
+		wantPatch  int
+	}{
+		{
+			name:       "single node",
+			pods:       []corev1.Pod{podOn("a1", "1"), podOn("a1", "1"), podOn("a1", "2")},
+			wantIssues: []string{IssueSingleNode, IssueSingleZone, IssueNoSpreadPolicy},
+			wantSkew:   3,
+			wantPatch:  2,
+		},
+		{
+			name:       "single zone on two nodes",
+			pods:       []corev1.Pod{podOn("a1", "1"), podOn("a2", "1")},
+			wantIssues: []string{IssueSingleZone, IssueNoSpreadPolicy},
+			wantSkew:   2,
+			wantPatch:  2,
+		},
+		{
+			name:       "balanced without constraints",
+			pods:       []corev1.Pod{podOn("a1", "1"), podOn("b1", "1"), podOn("c1", "1")},
+			wantIssues: []string{IssueNoSpreadPolicy},
+			wantPatch:  2,
+		},
+		{
+			name:       "balanced with constraints",
+			pods:       []corev1.Pod{spreadPod, podOn("b1", "1"), podOn("c1", "1")},
+			wantIssues: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			spread := analyze(tt.pods, nodeZones, zones, 4)
+			if len(spread.Issues) != len(tt.wantIssues) {
+				t.Fatalf("analyze() issues = %v, want %v", spread.Issues, tt.wantIssues)
+			}
+			for i := range tt.wantIssues {
+				if spread.Issues[i] != tt.wantIssues[i] {
+					t.Errorf("analyze() issues = %v, want %v", spread.Issues, tt.wantIssues)
+					break
+				}
+			}
+			if spread.ZoneSkew != tt.wantSkew {
+				t.Errorf("analyze() zone skew = %d, want %d", spread.ZoneSkew, tt.wantSkew)
+			}
+
+			if tt.wantPatch == 0 {
+				if spread.Patch != nil {
+					t.Errorf("analyze() patch = %v, want none", spread.Patch)
+				}
+				return
+			}
+			template := spread.Patch["spec"].(map[string]interface{})["template"].(map[string]interface{})
+			constraints := template["spec"].(map[string]interface{})["topologySpreadConstraints"].([]corev1.TopologySpreadConstraint)
+			if len(constraints) != tt.wantPatch {
+				t.Fatalf("analyze() patch has %d constraints, want %d", len(constraints), tt.wantPatch)
+			}
+			if labels := constraints[0].LabelSelector.MatchLabels; len(labels) != 1 || labels["app"] != "cart" {
+				t.Errorf("analyze() patch selects %v, want app=cart without pod-template-hash", labels)
+			}
+		})
+	}
+}
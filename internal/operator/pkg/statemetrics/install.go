@@ -0,0 +1,428 @@
+package statemetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Namespace and Name of the kube-state-metrics resources created by the installer
+	Namespace = "kube-system"
+	Name      = "kube-state-metrics"
+	// Image is the kube-state-metrics image installed
+	Image = "registry.k8s.io/kube-state-metrics/kube-state-metrics:v2.13.0"
+
+	// ManagedByLabel marks the resources created by the installer
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the ManagedByLabel value of the installer
+	ManagedByValue = "agentkube"
+
+	// Operation types of the installer
+	OperationInstall   = "kube-state-metrics-install"
+	OperationUninstall = "kube-state-metrics-uninstall"
+
+	metricsPort = 8080
+)
+
+// resources are the objects kube-state-metrics exposes to the store, with their API groups
+var resources = []struct {
+	group    string
+	resource string
+	ksmName  string
+}{
+	{"apps", "deployments", "deployments"},
+	{"apps", "statefulsets", "statefulsets"},
+	{"apps", "daemonsets", "daemonsets"},
+	{"batch", "jobs", "jobs"},
+	{"", "pods", "pods"},
+	{"", "nodes", "nodes"},
+	{"", "persistentvolumeclaims", "persistentvolumeclaims"},
+	{"autoscaling", "horizontalpodautoscalers", "horizontalpodautoscalers"},
+}
+
+// Install queues the installation of kube-state-metrics in a cluster
+func (m *Manager) Install(clusterName string) *utils.Operation {
+	operation := m.queue.AddOperation(OperationInstall, clusterName, "system", map[string]interface{}{}, []string{"kube-state-metrics", "installation"})
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"operationId": operation.ID,
+	}, nil, "Queued kube-state-metrics installation")
+
+	return operation
+}
+
+// Uninstall queues the removal of the kube-state-metrics installed by the installer
+func (m *Manager) Uninstall(clusterName string) *utils.Operation {
+	operation := m.queue.AddOperation(OperationUninstall, clusterName, "system", map[string]interface{}{}, []string{"kube-state-metrics", "uninstallation"})
+
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     clusterName,
+		"operationId": operation.ID,
+	}, nil, "Queued kube-state-metrics uninstallation")
+
+	return operation
+}
+
+// Processor installs and removes kube-state-metrics for the operation queue
+type Processor struct {
+	manager *Manager
+}
+
+// NewProcessor creates a new kube-state-metrics processor
+func NewProcessor(manager *Manager) *Processor {
+	return &Processor{
+		manager: manager,
+	}
+}
+
+// ProcessOperation processes kube-state-metrics operations
+func (p *Processor) ProcessOperation(op *utils.Operation) error {
+	switch op.Type {
+	case OperationInstall:
+		return p.processInstall(op)
+	case OperationUninstall:
+		return p.processUninstall(op)
+	default:
+		return fmt.Errorf("unsupported operation type: %s", op.Type)
+	}
+}
+
+// CanProcess returns true if this processor can handle the operation type
+func (p *Processor) CanProcess(operationType string) bool {
+	return operationType == OperationInstall || operationType == OperationUninstall
+}
+
+func (p *Processor) clientset(clusterName string) (*kubernetes.Clientset, error) {
+	kubeContext, err := p.manager.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, utils.NonRetryable(fmt.Errorf("context not found: %w", err))
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+	return clientset, nil
+}
+
+// processInstall deploys kube-state-metrics, unless the cluster already runs one
+func (p *Processor) processInstall(op *utils.Operation) error {
+	queue := p.manager.queue
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+	clientset, err := p.clientset(op.Target)
+	if err != nil {
+		return err
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 15, "Detecting existing installation", nil)
+	source, err := findSource(context.Background(), clientset)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if source != nil && !source.Managed {
+		queue.UpdateOperation(op.ID, utils.StatusCompleted, 100,
+			fmt.Sprintf("kube-state-metrics already runs in %s/%s, scraping uses it", source.Namespace, source.Name), nil)
+		return nil
+	}
+	// Never update resources of another tool that happen to use the same names
+	if err := checkManaged(context.Background(), clientset); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		name     string
+		progress int
+		fn       func() error
+	}{
+		{"Creating ServiceAccount", 20, func() error { return createServiceAccount(clientset) }},
+		{"Creating ClusterRole", 30, func() error { return createClusterRole(clientset) }},
+		{"Creating ClusterRoleBinding", 40, func() error { return createClusterRoleBinding(clientset) }},
+		{"Creating Deployment", 60, func() error { return createDeployment(clientset) }},
+		{"Creating Service", 70, func() error { return createService(clientset) }},
+		{"Verifying installation", 80, func() error { return verifyInstallation(clientset) }},
+	}
+	for _, step := range steps {
+		queue.UpdateOperation(op.ID, utils.StatusRunning, step.progress, step.name, nil)
+		if err := step.fn(); err != nil {
+			return fmt.Errorf("failed at step '%s': %w", step.name, err)
+		}
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "kube-state-metrics installation completed successfully", nil)
+	logger.Log(logger.LevelInfo, map[string]string{
+		"cluster":     op.Target,
+		"operationId": op.ID,
+	}, nil, "kube-state-metrics installation completed")
+	return nil
+}
+
+// processUninstall removes the resources of the installer, leaving other installations alone
+func (p *Processor) processUninstall(op *utils.Operation) error {
+	queue := p.manager.queue
+	queue.UpdateOperation(op.ID, utils.StatusRunning, 10, "Creating Kubernetes clients", nil)
+	clientset, err := p.clientset(op.Target)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := checkManaged(ctx, clientset); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		name     string
+		progress int
+		fn       func() error
+	}{
+		{"Deleting Service", 20, func() error {
+			return clientset.CoreV1().Services(Namespace).Delete(ctx, Name, metav1.DeleteOptions{})
+		}},
+		{"Deleting Deployment", 40, func() error {
+			return clientset.AppsV1().Deployments(Namespace).Delete(ctx, Name, metav1.DeleteOptions{})
+		}},
+		{"Deleting ClusterRoleBinding", 60, func() error {
+			return clientset.RbacV1().ClusterRoleBindings().Delete(ctx, Name, metav1.DeleteOptions{})
+		}},
+		{"Deleting ClusterRole", 70, func() error {
+			return clientset.RbacV1().ClusterRoles().Delete(ctx, Name, metav1.DeleteOptions{})
+		}},
+		{"Deleting ServiceAccount", 80, func() error {
+			return clientset.CoreV1().ServiceAccounts(Namespace).Delete(ctx, Name, metav1.DeleteOptions{})
+		}},
+	}
+	for _, step := range steps {
+		queue.UpdateOperation(op.ID, utils.StatusRunning, step.progress, step.name, nil)
+		if err := step.fn(); err != nil && !apierrors.IsNotFound(err) {
+			// Log warning but continue with other steps
+			logger.Log(logger.LevelWarn, map[string]string{
+				"cluster": op.Target,
+				"step":    step.name,
+			}, err, "Failed to delete component during uninstallation")
+		}
+	}
+
+	queue.UpdateOperation(op.ID, utils.StatusCompleted, 100, "kube-state-metrics uninstallation completed", nil)
+	return nil
+}
+
+// checkManaged refuses to change a kube-state-metrics deployed by another tool under the installer names
+func checkManaged(ctx context.Context, clientset *kubernetes.Clientset) error {
+	deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, Name, metav1.GetOptions{})
+	if err == nil && deployment.Labels[ManagedByLabel] != ManagedByValue {
+		return utils.NonRetryable(fmt.Errorf("kube-state-metrics in %s/%s was not installed by agentkube", Namespace, Name))
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	service, err := clientset.CoreV1().Services(Namespace).Get(ctx, Name, metav1.GetOptions{})
+	if err == nil && service.Labels[ManagedByLabel] != ManagedByValue {
+		return utils.NonRetryable(fmt.Errorf("service %s/%s was not created by agentkube", Namespace, Name))
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func labels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name": Name,
+		ManagedByLabel:           ManagedByValue,
+	}
+}
+
+func createServiceAccount(clientset *kubernetes.Clientset) error {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace, Labels: labels()},
+	}
+	_, err := clientset.CoreV1().ServiceAccounts(Namespace).Create(context.Background(), sa, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createClusterRole grants list and watch on the resources exposed to the store
+func createClusterRole(clientset *kubernetes.Clientset) error {
+	byGroup := map[string][]string{}
+	groups := []string{}
+	for _, r := range resources {
+		if _, ok := byGroup[r.group]; !ok {
+			groups = append(groups, r.group)
+		}
+		byGroup[r.group] = append(byGroup[r.group], r.resource)
+	}
+	rules := []rbacv1.PolicyRule{}
+	for _, group := range groups {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: byGroup[group],
+			Verbs:     []string{"list", "watch"},
+		})
+	}
+
+	role := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Labels: labels()},
+		Rules:      rules,
+	}
+	_, err := clientset.RbacV1().ClusterRoles().Create(context.Background(), role, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.RbacV1().ClusterRoles().Update(context.Background(), role, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+func createClusterRoleBinding(clientset *kubernetes.Clientset) error {
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Labels: labels()},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     Name,
+		},
+		Subjects: []rbacv1.Subject{{Kind: "ServiceAccount", Name: Name, Namespace: Namespace}},
+	}
+	_, err := clientset.RbacV1().ClusterRoleBindings().Create(context.Background(), binding, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createDeployment runs kube-state-metrics limited to the resources and families the store keeps
+func createDeployment(clientset *kubernetes.Clientset) error {
+	ksmResources := make([]string, 0, len(resources))
+	for _, r := range resources {
+		ksmResources = append(ksmResources, r.ksmName)
+	}
+	families := make([]string, 0, len(Families))
+	for family := range Families {
+		families = append(families, family)
+	}
+	// A stable order keeps reinstalls from rolling the pods
+	sort.Strings(families)
+
+	replicas := int32(1)
+	runAsNonRoot := true
+	readOnlyRootFilesystem := true
+	allowPrivilegeEscalation := false
+	runAsUser := int64(65534)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace, Labels: labels()},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app.kubernetes.io/name": Name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: Name,
+					NodeSelector:       map[string]string{"kubernetes.io/os": "linux"},
+					Containers: []corev1.Container{
+						{
+							Name:  Name,
+							Image: Image,
+							Args: []string{
+								fmt.Sprintf("--port=%d", metricsPort),
+								"--resources=" + strings.Join(ksmResources, ","),
+								"--metric-allowlist=" + strings.Join(families, ","),
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: "http-metrics", ContainerPort: metricsPort, Protocol: corev1.ProtocolTCP},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("256Mi"),
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt(metricsPort)},
+								},
+								InitialDelaySeconds: 5,
+								TimeoutSeconds:      5,
+							},
+							SecurityContext: &corev1.SecurityContext{
+								RunAsNonRoot:             &runAsNonRoot,
+								RunAsUser:                &runAsUser,
+								ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+								AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+								Capabilities: &corev1.Capabilities{
+									Drop: []corev1.Capability{"ALL"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := clientset.AppsV1().Deployments(Namespace).Create(context.Background(), deployment, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.AppsV1().Deployments(Namespace).Update(context.Background(), deployment, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+func createService(clientset *kubernetes.Clientset) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace, Labels: labels()},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app.kubernetes.io/name": Name},
+			Ports: []corev1.ServicePort{
+				{Name: "http-metrics", Port: metricsPort, TargetPort: intstr.FromString("http-metrics"), Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+	_, err := clientset.CoreV1().Services(Namespace).Create(context.Background(), service, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// verifyInstallation waits for the deployment to become available
+func verifyInstallation(clientset *kubernetes.Clientset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return deployment.Status.AvailableReplicas > 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment failed to become ready within timeout: %w", err)
+	}
+	return nil
+}
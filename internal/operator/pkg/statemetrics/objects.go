@@ -0,0 +1,154 @@
+package statemetrics
+
+import (
+	"sort"
+	"time"
+)
+
+// Workload kinds
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+)
+
+// workloadMetrics are the desired and ready replica metrics of a workload kind, with the label naming
+// the object
+var workloadMetrics = []struct {
+	kind    string
+	label   string
+	desired string
+	ready   string
+}{
+	{KindDeployment, "deployment", "kube_deployment_spec_replicas", "kube_deployment_status_replicas_available"},
+	{KindStatefulSet, "statefulset", "kube_statefulset_replicas", "kube_statefulset_status_replicas_ready"},
+	{KindDaemonSet, "daemonset", "kube_daemonset_status_desired_number_scheduled", "kube_daemonset_status_number_ready"},
+}
+
+// WorkloadState is the availability of a deployment, statefulset or daemonset
+type WorkloadState struct {
+	Kind      string  `json:"kind"`
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Desired   float64 `json:"desired"`
+	Ready     float64 `json:"ready"`
+	Available bool    `json:"available"`
+	// Availability is the share of scrapes in the retention window where every desired replica was ready
+	Availability float64 `json:"availability"`
+	// UnavailableSince is the first scrape of the current unavailability
+	UnavailableSince *time.Time `json:"unavailableSince,omitempty"`
+}
+
+// JobState is the outcome of a job
+type JobState struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Active    float64 `json:"active"`
+	Succeeded float64 `json:"succeeded"`
+	// FailedPods counts the pods of the job that failed
+	FailedPods float64 `json:"failedPods"`
+	// Failed is set once the job reached its Failed condition
+	Failed bool `json:"failed"`
+}
+
+// workloads derives the availability of the workloads from the last scrapes
+func (s *store) workloads() []WorkloadState {
+	states := []WorkloadState{}
+	for _, metrics := range workloadMetrics {
+		ready := map[string]*Series{}
+		for _, series := range s.ofMetric(metrics.ready) {
+			ready[series.Labels["namespace"]+"/"+series.Labels[metrics.label]] = series
+		}
+
+		for _, desired := range s.ofMetric(metrics.desired) {
+			namespace, name := desired.Labels["namespace"], desired.Labels[metrics.label]
+			state := WorkloadState{Kind: metrics.kind, Namespace: namespace, Name: name}
+			state.Desired, _ = desired.latest()
+			if readySeries := ready[namespace+"/"+name]; readySeries != nil {
+				state.Ready, _ = readySeries.latest()
+				state.Availability, state.UnavailableSince = availability(desired, readySeries)
+			}
+			state.Available = state.Ready >= state.Desired
+			states = append(states, state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Kind != states[j].Kind {
+			return states[i].Kind < states[j].Kind
+		}
+		if states[i].Namespace != states[j].Namespace {
+			return states[i].Namespace < states[j].Namespace
+		}
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// availability pairs the desired and ready points of the same scrapes, returning the available share
+// and the start of the current unavailability
+func availability(desired, ready *Series) (float64, *time.Time) {
+	desiredAt := make(map[time.Time]float64, len(desired.Points))
+	for _, point := range desired.Points {
+		desiredAt[point.Time] = point.Value
+	}
+
+	var since *time.Time
+	total, available := 0, 0
+	for _, point := range ready.Points {
+		want, ok := desiredAt[point.Time]
+		if !ok {
+			continue
+		}
+		total++
+		if point.Value >= want {
+			available++
+			since = nil
+		} else if since == nil {
+			at := point.Time
+			since = &at
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(available) / float64(total), since
+}
+
+// jobs derives the outcome of the jobs from the last scrape
+func (s *store) jobs() []JobState {
+	byName := map[string]*JobState{}
+	state := func(series *Series) *JobState {
+		key := series.Labels["namespace"] + "/" + series.Labels["job_name"]
+		if byName[key] == nil {
+			byName[key] = &JobState{Namespace: series.Labels["namespace"], Name: series.Labels["job_name"]}
+		}
+		return byName[key]
+	}
+
+	for _, series := range s.ofMetric("kube_job_status_active") {
+		state(series).Active, _ = series.latest()
+	}
+	for _, series := range s.ofMetric("kube_job_status_succeeded") {
+		state(series).Succeeded, _ = series.latest()
+	}
+	for _, series := range s.ofMetric("kube_job_status_failed") {
+		state(series).FailedPods, _ = series.latest()
+	}
+	for _, series := range s.ofMetric("kube_job_failed") {
+		if value, _ := series.latest(); series.Labels["condition"] == "true" && value == 1 {
+			state(series).Failed = true
+		}
+	}
+
+	jobs := make([]JobState, 0, len(byName))
+	for _, job := range byName {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Namespace != jobs[j].Namespace {
+			return jobs[i].Namespace < jobs[j].Namespace
+		}
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
@@ -0,0 +1,139 @@
+package statemetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Families are the kube-state-metrics metric families kept in the store
+var Families = map[string]bool{
+	"kube_deployment_spec_replicas":                        true,
+	"kube_deployment_status_replicas_available":            true,
+	"kube_deployment_status_replicas_unavailable":          true,
+	"kube_statefulset_replicas":                            true,
+	"kube_statefulset_status_replicas_ready":               true,
+	"kube_daemonset_status_desired_number_scheduled":       true,
+	"kube_daemonset_status_number_ready":                   true,
+	"kube_job_status_active":                               true,
+	"kube_job_status_succeeded":                            true,
+	"kube_job_status_failed":                               true,
+	"kube_job_failed":                                      true,
+	"kube_pod_status_phase":                                true,
+	"kube_pod_container_status_restarts_total":             true,
+	"kube_node_status_condition":                           true,
+	"kube_persistentvolumeclaim_status_phase":              true,
+	"kube_horizontalpodautoscaler_status_current_replicas": true,
+}
+
+// sample is a single value of the exposition
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// maxLineSize bounds a line of the exposition, label sets of large objects can be long
+const maxLineSize = 1 << 20
+
+// parseText reads the samples of the wanted families from the Prometheus text exposition format.
+// Comments, timestamps and NaN values are skipped.
+func parseText(r io.Reader, families map[string]bool) ([]sample, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	samples := []sample{}
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		end := strings.IndexAny(line, "{ \t")
+		if end <= 0 {
+			return nil, fmt.Errorf("line %d: missing value", lineNumber)
+		}
+		name := line[:end]
+		if !families[name] {
+			continue
+		}
+
+		labels := map[string]string{}
+		rest := line[end:]
+		if rest[0] == '{' {
+			var err error
+			labels, rest, err = parseLabels(rest[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing value", lineNumber)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", lineNumber, fields[0])
+		}
+		if math.IsNaN(value) {
+			continue
+		}
+		samples = append(samples, sample{name: name, labels: labels, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// parseLabels reads a label set up to its closing brace, returning the rest of the line
+func parseLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated label set")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		equals := strings.IndexByte(s, '=')
+		if equals <= 0 || len(s) < equals+2 || s[equals+1] != '"' {
+			return nil, "", fmt.Errorf("invalid label in %q", s)
+		}
+		key := strings.TrimSpace(s[:equals])
+		s = s[equals+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+			case c == '"':
+				labels[key] = value.String()
+				s = s[i+1:]
+				closed = true
+			default:
+				value.WriteByte(c)
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value of label %s", key)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package statemetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	settingsFileName = "kube-state-metrics.json"
+
+	// tickInterval is how often the scraper checks whether a scrape is due
+	tickInterval = 15 * time.Second
+	// scrapeTimeout bounds a scrape, the exposition of large clusters takes a while to stream
+	scrapeTimeout = 30 * time.Second
+)
+
+// ErrNotFound is returned when no kube-state-metrics service runs in a cluster
+var ErrNotFound = errors.New("kube-state-metrics not found")
+
+// serviceSelectors find kube-state-metrics services, the first is used by the installer and the charts
+var serviceSelectors = []string{
+	"app.kubernetes.io/name=kube-state-metrics",
+	"k8s-app=kube-state-metrics",
+}
+
+// Settings configure the periodic kube-state-metrics scraping
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Clusters limits scraping to these contexts, empty scrapes every context running kube-state-metrics
+	Clusters         []string `json:"clusters"`
+	IntervalSeconds  int      `json:"intervalSeconds"`
+	RetentionMinutes int      `json:"retentionMinutes"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Clusters:         []string{},
+		IntervalSeconds:  60,
+		RetentionMinutes: 360,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.IntervalSeconds < 15 || s.IntervalSeconds > 3600 {
+		return fmt.Errorf("intervalSeconds must be between 15 and 3600")
+	}
+	if s.RetentionMinutes < 10 || s.RetentionMinutes > 24*60 {
+		return fmt.Errorf("retentionMinutes must be between 10 and 1440")
+	}
+	if s.RetentionMinutes*60 < s.IntervalSeconds {
+		return fmt.Errorf("retentionMinutes must cover at least one interval")
+	}
+	return nil
+}
+
+// Source is the kube-state-metrics service scraped in a cluster
+type Source struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Port      string `json:"port"`
+	// Managed tells whether the installer deployed it
+	Managed bool `json:"managed"`
+}
+
+// Status is the scraping state of a cluster
+type Status struct {
+	Cluster    string     `json:"cluster"`
+	Source     *Source    `json:"source,omitempty"`
+	LastScrape *time.Time `json:"lastScrape,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	Series     int        `json:"series"`
+	// DroppedSamples counts the samples of new series refused once the store held MaxSeries
+	DroppedSamples int `json:"droppedSamples"`
+}
+
+// clusterState is the store and scraping state of a cluster
+type clusterState struct {
+	store      *store
+	source     *Source
+	lastScrape time.Time
+	lastError  string
+}
+
+// Manager scrapes kube-state-metrics into an in-memory store, giving object-level time series to
+// clusters without a Prometheus stack
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	queue           *utils.Queue
+	settingsPath    string
+	mutex           sync.Mutex
+	clusters        map[string]*clusterState
+	lastRun         time.Time
+	stopChan        chan struct{}
+}
+
+// NewManager creates a new kube-state-metrics manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore, queue *utils.Queue) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		queue:           queue,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		clusters:        map[string]*clusterState{},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current scraping settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new scraping settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start scrapes the configured clusters until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scraping loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Scrape reads kube-state-metrics of a cluster into the store
+func (m *Manager) Scrape(ctx context.Context, clusterName string) (*Status, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	err = m.scrape(ctx, clusterName, settings)
+	status := m.Status(clusterName)
+	return &status, err
+}
+
+// Status returns the scraping state of a cluster
+func (m *Manager) Status(clusterName string) Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := Status{Cluster: clusterName}
+	state := m.clusters[clusterName]
+	if state == nil {
+		return status
+	}
+	status.Source = state.source
+	status.LastError = state.lastError
+	status.Series = len(state.store.series)
+	status.DroppedSamples = state.store.dropped
+	if !state.lastScrape.IsZero() {
+		lastScrape := state.lastScrape
+		status.LastScrape = &lastScrape
+	}
+	return status
+}
+
+// Series returns the series of a kube-state-metrics metric whose labels include the matchers, with
+// the points since the given time
+func (m *Manager) Series(clusterName, metric string, matchers map[string]string, since time.Time) []Series {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state := m.clusters[clusterName]
+	if state == nil {
+		return []Series{}
+	}
+	return state.store.query(metric, matchers, since)
+}
+
+// Workloads returns the availability of the deployments, statefulsets and daemonsets of a cluster
+func (m *Manager) Workloads(clusterName string) []WorkloadState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state := m.clusters[clusterName]
+	if state == nil {
+		return []WorkloadState{}
+	}
+	return state.store.workloads()
+}
+
+// Jobs returns the outcome of the jobs of a cluster
+func (m *Manager) Jobs(clusterName string) []JobState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state := m.clusters[clusterName]
+	if state == nil {
+		return []JobState{}
+	}
+	return state.store.jobs()
+}
+
+// monitor scrapes the configured clusters when the interval elapsed
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load kube-state-metrics settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalSeconds)*time.Second
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	clusters := settings.Clusters
+	explicit := len(clusters) > 0
+	if !explicit {
+		contexts, err := m.kubeConfigStore.GetContexts()
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to list contexts for kube-state-metrics scraping")
+			return
+		}
+		for _, kubeContext := range contexts {
+			clusters = append(clusters, kubeContext.Name)
+		}
+	}
+
+	for _, clusterName := range clusters {
+		// Clusters over their resource budget are skipped until they are resumed
+		if budget.Paused(clusterName) {
+			continue
+		}
+		err := m.scrape(context.Background(), clusterName, settings)
+		// Clusters without kube-state-metrics are only worth a warning when they were asked for
+		if err != nil && (explicit || !errors.Is(err, ErrNotFound)) {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to scrape kube-state-metrics")
+		}
+	}
+}
+
+// scrape reads the exposition of the kube-state-metrics service of a cluster and records it
+func (m *Manager) scrape(ctx context.Context, clusterName string, settings Settings) error {
+	defer budget.Track(clusterName, "statemetrics")()
+
+	ctx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+	defer cancel()
+
+	source, samples, err := m.fetch(ctx, clusterName)
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state := m.clusters[clusterName]
+	if state == nil {
+		if err != nil {
+			// Keep no state for clusters that were never scraped
+			return err
+		}
+		state = &clusterState{store: newStore()}
+		m.clusters[clusterName] = state
+	}
+	if err != nil {
+		state.lastError = err.Error()
+		return err
+	}
+	state.source = source
+	state.lastScrape = now
+	state.lastError = ""
+	state.store.add(now, samples, time.Duration(settings.RetentionMinutes)*time.Minute)
+	return nil
+}
+
+// fetch finds the kube-state-metrics service of a cluster and reads its metrics through the API server proxy
+func (m *Manager) fetch(ctx context.Context, clusterName string) (*Source, []sample, error) {
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	source, err := findSource(ctx, clientset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stream, err := clientset.CoreV1().Services(source.Namespace).
+		ProxyGet("http", source.Name, source.Port, "metrics", nil).Stream(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scrape %s/%s: %w", source.Namespace, source.Name, err)
+	}
+	defer stream.Close()
+
+	samples, err := parseText(stream, Families)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metrics of %s/%s: %w", source.Namespace, source.Name, err)
+	}
+	return source, samples, nil
+}
+
+// findSource finds the kube-state-metrics service of a cluster, preferring the one of the installer
+func findSource(ctx context.Context, clientset *kubernetes.Clientset) (*Source, error) {
+	services := []corev1.Service{}
+	for _, selector := range serviceSelectors {
+		list, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list kube-state-metrics services: %w", err)
+		}
+		services = append(services, list.Items...)
+	}
+	if len(services) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Labels[ManagedByLabel] == ManagedByValue && services[j].Labels[ManagedByLabel] != ManagedByValue
+	})
+
+	service := services[0]
+	source := &Source{
+		Namespace: service.Namespace,
+		Name:      service.Name,
+		Managed:   service.Labels[ManagedByLabel] == ManagedByValue,
+	}
+	// The charts expose the object metrics on http-metrics and the self metrics on telemetry
+	for _, port := range service.Spec.Ports {
+		if port.Name == "http-metrics" || port.Name == "http" {
+			source.Port = port.Name
+			break
+		}
+	}
+	if source.Port == "" {
+		if len(service.Spec.Ports) == 0 {
+			return nil, fmt.Errorf("kube-state-metrics service %s/%s has no port", service.Namespace, service.Name)
+		}
+		source.Port = strconv.Itoa(int(service.Spec.Ports[0].Port))
+	}
+	return source, nil
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
@@ -0,0 +1,149 @@
+package statemetrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const exposition = `# HELP kube_deployment_spec_replicas Number of desired pods for a deployment.
+# TYPE kube_deployment_spec_replicas gauge
+kube_deployment_spec_replicas{namespace="shop",deployment="cart"} 3
+kube_deployment_status_replicas_available{namespace="shop",deployment="cart"} 2
+kube_job_status_failed{namespace="batch",job_name="report",reason="BackoffLimitExceeded"} 4
+kube_job_failed{namespace="batch",job_name="report",condition="true"} 1
+kube_job_failed{namespace="batch",job_name="report",condition="false"} 0
+kube_pod_info{namespace="shop",pod="cart-1"} 1
+kube_pod_status_phase{namespace="shop",pod="cart-1",phase="Running"} 1 1700000000000
+kube_node_status_condition{node="a",condition="Ready",status="true",note="say \"hi\"\\n"} NaN
+`
+
+func TestParseText(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseText(strings.NewReader(exposition), Families)
+	if err != nil {
+		t.Fatalf("parseText() error = %v", err)
+	}
+	// kube_pod_info is not kept and the NaN sample is skipped
+	if len(samples) != 6 {
+		t.Fatalf("parseText() returned %d samples, want 6: %+v", len(samples), samples)
+	}
+	if samples[0].name != "kube_deployment_spec_replicas" || samples[0].labels["deployment"] != "cart" || samples[0].value != 3 {
+		t.Errorf("first sample = %+v", samples[0])
+	}
+	if samples[5].labels["phase"] != "Running" || samples[5].value != 1 {
+		t.Errorf("timestamped sample = %+v", samples[5])
+	}
+
+	labels, rest, err := parseLabels(`a="x\"y",b="1\\n"} 2`)
+	if err != nil || labels["a"] != `x"y` || labels["b"] != `1\n` || rest != " 2" {
+		t.Errorf("parseLabels() = %v, %q, %v", labels, rest, err)
+	}
+
+	for _, invalid := range []string{
+		`kube_job_status_failed{namespace="a" 1`,
+		`kube_job_status_failed{namespace="a"}`,
+		`kube_job_status_failed 1x`,
+	} {
+		if _, err := parseText(strings.NewReader(invalid), Families); err == nil {
+			t.Errorf("parseText(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	deployment := func(desired, available float64, extra ...sample) []sample {
+		labels := map[string]string{"namespace": "shop", "deployment": "cart"}
+		return append([]sample{
+			{name: "kube_deployment_spec_replicas", labels: labels, value: desired},
+			{name: "kube_deployment_status_replicas_available", labels: labels, value: available},
+		}, extra...)
+	}
+	gone := sample{name: "kube_deployment_spec_replicas", labels: map[string]string{"namespace": "shop", "deployment": "old"}, value: 1}
+
+	s := newStore()
+	retention := 11 * time.Minute
+	s.add(start, deployment(3, 3, gone), retention)
+	s.add(start.Add(5*time.Minute), deployment(3, 3), retention)
+	s.add(start.Add(10*time.Minute), deployment(3, 1), retention)
+	s.add(start.Add(15*time.Minute), deployment(3, 2), retention)
+
+	// The first scrape left the window, taking the series of the deleted deployment with it
+	if len(s.series) != 2 {
+		t.Fatalf("store has %d series, want 2", len(s.series))
+	}
+	series := s.query("kube_deployment_status_replicas_available", map[string]string{"deployment": "cart"}, time.Time{})
+	if len(series) != 1 || len(series[0].Points) != 3 {
+		t.Fatalf("query() = %+v", series)
+	}
+	if series := s.query("kube_deployment_status_replicas_available", nil, start.Add(12*time.Minute)); len(series[0].Points) != 1 {
+		t.Errorf("query() since = %+v", series)
+	}
+	if series := s.query("kube_deployment_status_replicas_available", map[string]string{"deployment": "api"}, time.Time{}); len(series) != 0 {
+		t.Errorf("query() with other labels = %+v", series)
+	}
+
+	workloads := s.workloads()
+	if len(workloads) != 1 {
+		t.Fatalf("workloads() = %+v", workloads)
+	}
+	w := workloads[0]
+	if w.Kind != KindDeployment || w.Desired != 3 || w.Ready != 2 || w.Available {
+		t.Errorf("workload = %+v", w)
+	}
+	if w.Availability < 0.33 || w.Availability > 0.34 {
+		t.Errorf("availability = %v, want 1/3", w.Availability)
+	}
+	if w.UnavailableSince == nil || !w.UnavailableSince.Equal(start.Add(10*time.Minute)) {
+		t.Errorf("unavailableSince = %v", w.UnavailableSince)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseText(strings.NewReader(exposition), Families)
+	if err != nil {
+		t.Fatalf("parseText() error = %v", err)
+	}
+	s := newStore()
+	s.add(time.Now(), samples, time.Hour)
+
+	jobs := s.jobs()
+	if len(jobs) != 1 {
+		t.Fatalf("jobs() = %+v", jobs)
+	}
+	if job := jobs[0]; job.Namespace != "batch" || job.Name != "report" || job.FailedPods != 4 || !job.Failed {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		change  func(*Settings)
+		wantErr bool
+	}{
+		{name: "defaults", change: func(*Settings) {}},
+		{name: "interval too short", change: func(s *Settings) { s.IntervalSeconds = 5 }, wantErr: true},
+		{name: "retention too long", change: func(s *Settings) { s.RetentionMinutes = 2000 }, wantErr: true},
+		{name: "retention shorter than interval", change: func(s *Settings) { s.IntervalSeconds, s.RetentionMinutes = 3600, 30 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			settings := DefaultSettings()
+			tt.change(&settings)
+			if err := settings.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
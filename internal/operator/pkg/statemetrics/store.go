@@ -0,0 +1,133 @@
+package statemetrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxSeries bounds the series kept per cluster, samples of new series are dropped beyond it
+const MaxSeries = 50000
+
+// Point is a sample of a series
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Series is the time series of a metric with a label set
+type Series struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+// latest returns the last value of the series
+func (s *Series) latest() (float64, bool) {
+	if len(s.Points) == 0 {
+		return 0, false
+	}
+	return s.Points[len(s.Points)-1].Value, true
+}
+
+// store keeps the series scraped from a cluster. Series of deleted objects stop receiving samples and
+// are dropped once their last point leaves the retention window.
+type store struct {
+	series map[string]*Series
+	// dropped counts the samples of new series refused because the store was full
+	dropped int
+}
+
+func newStore() *store {
+	return &store{series: map[string]*Series{}}
+}
+
+// add appends a scrape to the store and expires the points older than the retention
+func (s *store) add(at time.Time, samples []sample, retention time.Duration) {
+	for _, smp := range samples {
+		key := seriesKey(smp.name, smp.labels)
+		series, ok := s.series[key]
+		if !ok {
+			if len(s.series) >= MaxSeries {
+				s.dropped++
+				continue
+			}
+			series = &Series{Metric: smp.name, Labels: smp.labels}
+			s.series[key] = series
+		}
+		series.Points = append(series.Points, Point{Time: at, Value: smp.value})
+	}
+
+	cutoff := at.Add(-retention)
+	for key, series := range s.series {
+		expired := sort.Search(len(series.Points), func(i int) bool { return series.Points[i].Time.After(cutoff) })
+		if expired == len(series.Points) {
+			delete(s.series, key)
+			continue
+		}
+		if expired > 0 {
+			series.Points = append([]Point(nil), series.Points[expired:]...)
+		}
+	}
+}
+
+// query returns copies of the series of a metric whose labels include the matchers, ordered by labels.
+// Points before since are left out.
+func (s *store) query(metric string, matchers map[string]string, since time.Time) []Series {
+	result := []Series{}
+	for _, series := range s.series {
+		if series.Metric != metric || !matchLabels(series.Labels, matchers) {
+			continue
+		}
+		copied := Series{Metric: series.Metric, Labels: series.Labels, Points: []Point{}}
+		for _, point := range series.Points {
+			if !point.Time.Before(since) {
+				copied.Points = append(copied.Points, point)
+			}
+		}
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return seriesKey("", result[i].Labels) < seriesKey("", result[j].Labels)
+	})
+	return result
+}
+
+// ofMetric returns the series of a metric, they are shared with the store
+func (s *store) ofMetric(metric string) []*Series {
+	result := []*Series{}
+	for _, series := range s.series {
+		if series.Metric == metric {
+			result = append(result, series)
+		}
+	}
+	return result
+}
+
+func matchLabels(labels, matchers map[string]string) bool {
+	for key, value := range matchers {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesKey identifies a series by its metric and sorted labels
+func seriesKey(metric string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(metric)
+	for _, key := range keys {
+		b.WriteString("\x00")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(labels[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcsBackend stores objects in a Google Cloud Storage bucket
+type gcsBackend struct {
+	bucket   *gcs.BucketHandle
+	prefix   string
+	artifact string
+}
+
+func newGCSBackend(ctx context.Context, config BackendConfig, artifact string) (*gcsBackend, error) {
+	var opts []option.ClientOption
+	if config.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(config.CredentialsFile))
+	}
+	client, err := gcs.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	return &gcsBackend{bucket: client.Bucket(config.Bucket), prefix: config.Prefix, artifact: artifact}, nil
+}
+
+func (b *gcsBackend) object(key string) (*gcs.ObjectHandle, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.bucket.Object(objectName(b.prefix, b.artifact, key)), nil
+}
+
+func (b *gcsBackend) Put(ctx context.Context, key string, r io.Reader, _ int64) error {
+	object, err := b.object(key)
+	if err != nil {
+		return err
+	}
+	writer := object.NewWriter(ctx)
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (b *gcsBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := b.object(key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := object.NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return reader, err
+}
+
+func (b *gcsBackend) Delete(ctx context.Context, key string) error {
+	object, err := b.object(key)
+	if err != nil {
+		return err
+	}
+	if err := object.Delete(ctx); err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *gcsBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := objectName(b.prefix, b.artifact, "") + "/"
+	objects := []Object{}
+	it := b.bucket.Objects(ctx, &gcs.Query{Prefix: root + prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, Object{
+			Key:          strings.TrimPrefix(attrs.Name, root),
+			Size:         attrs.Size,
+			LastModified: attrs.Updated,
+		})
+	}
+	return objects, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const defaultS3Endpoint = "s3.amazonaws.com"
+
+// s3Backend stores objects in an S3 compatible bucket
+type s3Backend struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	artifact string
+}
+
+func newS3Backend(config BackendConfig, artifact string) (*s3Backend, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+
+	// Without static keys, use the usual AWS environment, shared credentials and instance roles
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	if config.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, "")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !config.Insecure,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+	return &s3Backend{client: client, bucket: config.Bucket, prefix: config.Prefix, artifact: artifact}, nil
+}
+
+func (b *s3Backend) name(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return objectName(b.prefix, b.artifact, key), nil
+}
+
+func (b *s3Backend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	name, err := b.name(key)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.PutObject(ctx, b.bucket, name, r, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (b *s3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := b.name(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := b.client.GetObject(ctx, b.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, stat it to report missing objects now
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (b *s3Backend) Delete(ctx context.Context, key string) error {
+	name, err := b.name(key)
+	if err != nil {
+		return err
+	}
+	return b.client.RemoveObject(ctx, b.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (b *s3Backend) List(ctx context.Context, prefix string) ([]Object, error) {
+	root := objectName(b.prefix, b.artifact, "") + "/"
+	objects := []Object{}
+	for info := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: root + prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, Object{
+			Key:          strings.TrimPrefix(info.Key, root),
+			Size:         info.Size,
+			LastModified: info.LastModified,
+		})
+	}
+	return objects, nil
+}
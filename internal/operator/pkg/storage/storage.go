@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/retention"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "storage-settings.json"
+	artifactsDirName = "artifacts"
+
+	pruneInterval = time.Hour
+)
+
+// Backend types
+const (
+	BackendLocal = "local"
+	// BackendS3 also covers S3 compatible stores such as MinIO through a custom endpoint
+	BackendS3  = "s3"
+	BackendGCS = "gcs"
+)
+
+// Artifact types stored through a backend
+const (
+	ArtifactScans      = "scans"
+	ArtifactSBOMs      = "sboms"
+	ArtifactRecordings = "recordings"
+	ArtifactSnapshots  = "snapshots"
+)
+
+// ErrNotFound is returned for keys that are not stored
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Backend stores artifacts under keys. Keys are slash separated and relative to the artifact type.
+type Backend interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// BackendConfig selects and configures the backend of an artifact type
+type BackendConfig struct {
+	Type   string `json:"type"`
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix is prepended to every key in the bucket
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint of an S3 compatible store, empty means AWS S3
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	// Insecure talks plain HTTP to the endpoint, e.g. to a local MinIO
+	Insecure        bool   `json:"insecure,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	// CredentialsFile is a GCS service account key, empty uses the application default credentials
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+}
+
+// ArtifactSettings configure where an artifact type is stored and for how long
+type ArtifactSettings struct {
+	Backend BackendConfig `json:"backend"`
+	// RetentionDays removes objects older than this many days, 0 keeps them forever
+	RetentionDays int `json:"retentionDays"`
+}
+
+// Settings configure the storage of every artifact type, unconfigured types are stored locally
+type Settings struct {
+	Artifacts map[string]ArtifactSettings `json:"artifacts"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{Artifacts: map[string]ArtifactSettings{}}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	for artifact, settings := range s.Artifacts {
+		switch artifact {
+		case ArtifactScans, ArtifactSBOMs, ArtifactRecordings, ArtifactSnapshots:
+		default:
+			return fmt.Errorf("unknown artifact type %q", artifact)
+		}
+		if settings.RetentionDays < 0 {
+			return fmt.Errorf("%s: retentionDays must not be negative", artifact)
+		}
+		if err := settings.Backend.validate(); err != nil {
+			return fmt.Errorf("%s: %v", artifact, err)
+		}
+	}
+	return nil
+}
+
+func (c BackendConfig) validate() error {
+	switch c.Type {
+	case "", BackendLocal:
+		return nil
+	case BackendS3, BackendGCS:
+		if c.Bucket == "" {
+			return fmt.Errorf("bucket is required for %s backends", c.Type)
+		}
+		if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+			return fmt.Errorf("accessKeyId and secretAccessKey must be set together")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown backend type %q", c.Type)
+}
+
+// Redacted returns the settings without secret access keys, for API responses
+func (s Settings) Redacted() Settings {
+	redacted := Settings{Artifacts: make(map[string]ArtifactSettings, len(s.Artifacts))}
+	for artifact, settings := range s.Artifacts {
+		if settings.Backend.SecretAccessKey != "" {
+			settings.Backend.SecretAccessKey = "********"
+		}
+		redacted.Artifacts[artifact] = settings
+	}
+	return redacted
+}
+
+func (s Settings) artifact(artifact string) ArtifactSettings {
+	settings := s.Artifacts[artifact]
+	if settings.Backend.Type == "" {
+		settings.Backend.Type = BackendLocal
+	}
+	return settings
+}
+
+// Manager resolves the backend of each artifact type and applies retention
+type Manager struct {
+	settingsPath string
+	localDir     string
+	mutex        sync.Mutex
+	settings     *Settings
+	backends     map[string]Backend
+	stopChan     chan struct{}
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager returns the shared storage manager
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		configDir := utils.ConfigDir()
+		globalManager = &Manager{
+			settingsPath: filepath.Join(configDir, settingsFileName),
+			localDir:     filepath.Join(configDir, artifactsDirName),
+			backends:     map[string]Backend{},
+			stopChan:     make(chan struct{}),
+		}
+	})
+	return globalManager
+}
+
+// Settings returns the current storage settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new storage settings. A redacted secret keeps the stored one.
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if settings.Artifacts == nil {
+		settings.Artifacts = map[string]ArtifactSettings{}
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, err := m.loadSettings()
+	if err != nil {
+		return err
+	}
+	for artifact, artifactSettings := range settings.Artifacts {
+		if artifactSettings.Backend.SecretAccessKey == "********" {
+			artifactSettings.Backend.SecretAccessKey = current.Artifacts[artifact].Backend.SecretAccessKey
+			settings.Artifacts[artifact] = artifactSettings
+		}
+	}
+
+	// The file holds backend credentials
+	if err := utils.WriteJSONFileMode(m.settingsPath, settings, 0600); err != nil {
+		return err
+	}
+	m.settings = &settings
+	m.backends = map[string]Backend{}
+	return nil
+}
+
+// Backend returns the backend configured for an artifact type
+func (m *Manager) Backend(ctx context.Context, artifact string) (Backend, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if backend, ok := m.backends[artifact]; ok {
+		return backend, nil
+	}
+	settings, err := m.loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	backend, err := m.newBackend(ctx, artifact, settings.artifact(artifact).Backend)
+	if err != nil {
+		return nil, err
+	}
+	m.backends[artifact] = backend
+	return backend, nil
+}
+
+// IsRemote reports whether an artifact type is stored outside of the local filesystem
+func (m *Manager) IsRemote(artifact string) bool {
+	settings, err := m.Settings()
+	if err != nil {
+		return false
+	}
+	return settings.artifact(artifact).Backend.Type != BackendLocal
+}
+
+func (m *Manager) newBackend(ctx context.Context, artifact string, config BackendConfig) (Backend, error) {
+	switch config.Type {
+	case "", BackendLocal:
+		return newLocalBackend(filepath.Join(m.localDir, artifact)), nil
+	case BackendS3:
+		return newS3Backend(config, artifact)
+	case BackendGCS:
+		return newGCSBackend(ctx, config, artifact)
+	}
+	return nil, fmt.Errorf("unknown backend type %q", config.Type)
+}
+
+// Start runs the retention loop until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.ApplyRetention(context.Background())
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the retention loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// ApplyRetention removes the objects of every artifact type older than its retention
+func (m *Manager) ApplyRetention(ctx context.Context) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load storage settings")
+		return
+	}
+
+	for artifact, artifactSettings := range settings.Artifacts {
+		if artifactSettings.RetentionDays == 0 {
+			continue
+		}
+		removed, err := m.prune(ctx, artifact, time.Now().AddDate(0, 0, -artifactSettings.RetentionDays))
+		if err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"artifact": artifact}, err, "Failed to apply artifact retention")
+			continue
+		}
+		if removed > 0 {
+			logger.Log(logger.LevelInfo, map[string]string{
+				"artifact": artifact,
+				"removed":  fmt.Sprintf("%d", removed),
+			}, nil, "Removed expired artifacts")
+		}
+	}
+}
+
+// prune deletes the objects of an artifact type last modified before the cutoff
+func (m *Manager) prune(ctx context.Context, artifact string, cutoff time.Time) (int, error) {
+	backend, err := m.Backend(ctx, artifact)
+	if err != nil {
+		return 0, err
+	}
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, object := range objects {
+		if !object.LastModified.Before(cutoff) {
+			continue
+		}
+		if err := backend.Delete(ctx, object.Key); err != nil && !errors.Is(err, ErrNotFound) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RetentionSource lists the stored objects of an artifact type for the retention policies, which
+// apply on top of the retention days of the artifact type
+func (m *Manager) RetentionSource(artifact string) retention.Source {
+	return retention.SourceFuncs{
+		ItemsFunc: func(ctx context.Context) ([]retention.Item, error) {
+			backend, err := m.Backend(ctx, artifact)
+			if err != nil {
+				return nil, err
+			}
+			objects, err := backend.List(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			items := make([]retention.Item, 0, len(objects))
+			for _, object := range objects {
+				items = append(items, retention.Item{ID: object.Key, Size: object.Size, ModTime: object.LastModified})
+			}
+			return items, nil
+		},
+		DeleteFunc: func(ctx context.Context, key string) error {
+			backend, err := m.Backend(ctx, artifact)
+			if err != nil {
+				return err
+			}
+			if err := backend.Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// loadSettings returns the cached settings, the caller must hold the mutex
+func (m *Manager) loadSettings() (Settings, error) {
+	if m.settings != nil {
+		return *m.settings, nil
+	}
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	m.settings = &settings
+	return settings, nil
+}
+
+// cleanKey rejects keys that could escape the artifact root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return cleaned, nil
+}
+
+// objectName joins the bucket prefix, the artifact type and a key
+func objectName(prefix, artifact, key string) string {
+	return strings.TrimPrefix(path.Join(prefix, artifact, key), "/")
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+
+	dir := t.TempDir()
+	return &Manager{
+		settingsPath: filepath.Join(dir, settingsFileName),
+		localDir:     filepath.Join(dir, artifactsDirName),
+		backends:     map[string]Backend{},
+		stopChan:     make(chan struct{}),
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "abc.cast", want: "abc.cast"},
+		{key: "prod/abc.json", want: "prod/abc.json"},
+		{key: "/abc.cast", want: "abc.cast"},
+		{key: "../abc.cast", wantErr: true},
+		{key: "prod/../../abc.cast", wantErr: true},
+		{key: "prod\\abc.cast", wantErr: true},
+		{key: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := cleanKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cleanKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cleanKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  bool
+	}{
+		{name: "default", settings: DefaultSettings()},
+		{name: "s3", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			ArtifactRecordings: {Backend: BackendConfig{Type: BackendS3, Bucket: "casts"}, RetentionDays: 30},
+		}}},
+		{name: "unknown artifact", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			"logs": {},
+		}}, wantErr: true},
+		{name: "unknown backend", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			ArtifactScans: {Backend: BackendConfig{Type: "azure", Bucket: "scans"}},
+		}}, wantErr: true},
+		{name: "missing bucket", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			ArtifactSBOMs: {Backend: BackendConfig{Type: BackendGCS}},
+		}}, wantErr: true},
+		{name: "half credentials", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			ArtifactSnapshots: {Backend: BackendConfig{Type: BackendS3, Bucket: "snaps", AccessKeyID: "key"}},
+		}}, wantErr: true},
+		{name: "negative retention", settings: Settings{Artifacts: map[string]ArtifactSettings{
+			ArtifactScans: {RetentionDays: -1},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.settings.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateSettingsKeepsRedactedSecret(t *testing.T) {
+	t.Parallel()
+
+	m := testManager(t)
+	settings := Settings{Artifacts: map[string]ArtifactSettings{
+		ArtifactScans: {Backend: BackendConfig{Type: BackendS3, Bucket: "scans", AccessKeyID: "key", SecretAccessKey: "secret"}},
+	}}
+	if err := m.UpdateSettings(settings); err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+
+	redacted := settings.Redacted()
+	if got := redacted.Artifacts[ArtifactScans].Backend.SecretAccessKey; got == "secret" {
+		t.Fatalf("Redacted() kept the secret access key")
+	}
+	if err := m.UpdateSettings(redacted); err != nil {
+		t.Fatalf("UpdateSettings() with redacted settings error = %v", err)
+	}
+
+	stored, err := m.Settings()
+	if err != nil {
+		t.Fatalf("Settings() error = %v", err)
+	}
+	if got := stored.Artifacts[ArtifactScans].Backend.SecretAccessKey; got != "secret" {
+		t.Errorf("stored secret access key = %q, want %q", got, "secret")
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := testManager(t)
+	backend, err := m.Backend(ctx, ArtifactScans)
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+
+	if err := backend.Put(ctx, "prod/scan.json", strings.NewReader("{}"), 2); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	reader, err := backend.Get(ctx, "prod/scan.json")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "{}" {
+		t.Errorf("Get() = %q, %v, want %q", data, err, "{}")
+	}
+
+	objects, err := backend.List(ctx, "prod/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "prod/scan.json" || objects[0].Size != 2 {
+		t.Errorf("List() = %+v, want prod/scan.json of 2 bytes", objects)
+	}
+
+	if err := backend.Put(ctx, "../escape.json", strings.NewReader("{}"), 2); err == nil {
+		t.Error("Put() outside of the artifact directory should fail")
+	}
+	if err := backend.Delete(ctx, "prod/scan.json"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := backend.Get(ctx, "prod/scan.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := testManager(t)
+	backend, err := m.Backend(ctx, ArtifactRecordings)
+	if err != nil {
+		t.Fatalf("Backend() error = %v", err)
+	}
+	for _, key := range []string{"old.cast", "new.cast"} {
+		if err := backend.Put(ctx, key, strings.NewReader("cast"), 4); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	old := time.Now().AddDate(0, 0, -10)
+	if err := os.Chtimes(filepath.Join(m.localDir, ArtifactRecordings, "old.cast"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := m.prune(ctx, ArtifactRecordings, time.Now().AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("prune() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("prune() removed %d objects, want 1", removed)
+	}
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "new.cast" {
+		t.Errorf("List() after prune() = %+v, want only new.cast", objects)
+	}
+}
@@ -0,0 +1,367 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// tableAccept asks the API server for a server-side rendered Table, as kubectl get does
+const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+
+// Request selects the resources to render and the columns to add
+type Request struct {
+	Group         string `json:"group"`
+	Version       string `json:"version" binding:"required"`
+	Resource      string `json:"resource" binding:"required"`
+	Namespace     string `json:"namespace,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+	FieldSelector string `json:"fieldSelector,omitempty"`
+	Limit         int64  `json:"limit,omitempty"`
+	Continue      string `json:"continue,omitempty"`
+	// Columns are added after the server columns and the columns of the saved view
+	Columns []Column `json:"columns,omitempty"`
+	// HiddenColumns are server columns to leave out, in addition to those of the saved view
+	HiddenColumns []string `json:"hiddenColumns,omitempty"`
+	// IgnoreView renders the table without the saved view of the resource
+	IgnoreView bool `json:"ignoreView,omitempty"`
+	// Wide keeps server columns with a priority above zero
+	Wide bool `json:"wide,omitempty"`
+}
+
+// TableColumn describes a column of a rendered table
+type TableColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Priority    int32  `json:"priority"`
+	// Custom marks columns evaluated from a JSONPath instead of rendered by the server
+	Custom bool `json:"custom"`
+}
+
+// ObjectReference identifies the object a row was rendered from
+type ObjectReference struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid"`
+	ResourceVersion   string            `json:"resourceVersion"`
+	CreationTimestamp metav1.Time       `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels,omitempty"`
+}
+
+// Row is a rendered object, with one cell per column
+type Row struct {
+	Cells  []interface{}   `json:"cells"`
+	Object ObjectReference `json:"object"`
+}
+
+// Table is a list of resources rendered as rows
+type Table struct {
+	Resource           string        `json:"resource"`
+	Columns            []TableColumn `json:"columns"`
+	Rows               []Row         `json:"rows"`
+	ResourceVersion    string        `json:"resourceVersion"`
+	Continue           string        `json:"continue,omitempty"`
+	RemainingItemCount *int64        `json:"remainingItemCount,omitempty"`
+	// Errors lists custom column values that could not be evaluated
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Renderer renders the resources of a cluster as tables
+type Renderer struct {
+	kubeConfigStore kubeconfig.ContextStore
+	views           *ViewStore
+}
+
+// NewRenderer creates a new table renderer
+func NewRenderer(kubeConfigStore kubeconfig.ContextStore) *Renderer {
+	return &Renderer{
+		kubeConfigStore: kubeConfigStore,
+		views:           GetViewStore(),
+	}
+}
+
+// Render lists resources of a cluster as a server-side Table, adding the custom columns of the
+// saved view and the request
+func (r *Renderer) Render(ctx context.Context, clusterName string, req Request) (*Table, error) {
+	if req.Group == "core" {
+		req.Group = ""
+	}
+	resourceKey := ResourceKey(req.Group, req.Resource)
+
+	columns := req.Columns
+	hidden := req.HiddenColumns
+	if !req.IgnoreView {
+		view, err := r.views.Get(resourceKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load view: %v", err)
+		}
+		if view != nil {
+			columns = append(append([]Column{}, view.Columns...), req.Columns...)
+			hidden = append(append([]string{}, view.HiddenColumns...), req.HiddenColumns...)
+		}
+	}
+	if err := validateColumns(columns); err != nil {
+		return nil, err
+	}
+
+	serverTable, err := r.fetchTable(ctx, clusterName, req, len(columns) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := renderTable(serverTable, columns, hidden, req.Wide)
+	if err != nil {
+		return nil, err
+	}
+	table.Resource = resourceKey
+	return table, nil
+}
+
+// fetchTable requests the Table rendering of a list. Full objects are only included when custom
+// columns need them, otherwise the server sends their metadata.
+func (r *Renderer) fetchTable(ctx context.Context, clusterName string, req Request, includeObjects bool) (*metav1.Table, error) {
+	kubeContext, err := r.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context: %v", err)
+	}
+	restConfig, err := kubeContext.RESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	includeObject := string(metav1.IncludeMetadata)
+	if includeObjects {
+		includeObject = string(metav1.IncludeObject)
+	}
+
+	request := clientset.CoreV1().RESTClient().Get().
+		AbsPath(listPath(req)).
+		SetHeader("Accept", tableAccept).
+		Param("includeObject", includeObject)
+	if req.LabelSelector != "" {
+		request = request.Param("labelSelector", req.LabelSelector)
+	}
+	if req.FieldSelector != "" {
+		request = request.Param("fieldSelector", req.FieldSelector)
+	}
+	if req.Limit > 0 {
+		request = request.Param("limit", strconv.FormatInt(req.Limit, 10))
+	}
+	if req.Continue != "" {
+		request = request.Param("continue", req.Continue)
+	}
+
+	data, err := request.DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", req.Resource, err)
+	}
+
+	var table metav1.Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to decode table: %v", err)
+	}
+	if table.Kind != "Table" {
+		return nil, fmt.Errorf("the API server did not render %s as a table", req.Resource)
+	}
+	return &table, nil
+}
+
+// listPath returns the API path listing a resource, across namespaces when none is given
+func listPath(req Request) string {
+	path := "/api/" + req.Version
+	if req.Group != "" {
+		path = "/apis/" + req.Group + "/" + req.Version
+	}
+	if req.Namespace != "" {
+		path += "/namespaces/" + req.Namespace
+	}
+	return path + "/" + req.Resource
+}
+
+// renderTable converts a server-side Table, dropping hidden columns and evaluating custom ones
+func renderTable(serverTable *metav1.Table, columns []Column, hidden []string, wide bool) (*Table, error) {
+	hiddenNames := map[string]bool{}
+	for _, name := range hidden {
+		hiddenNames[strings.ToLower(name)] = true
+	}
+
+	table := &Table{
+		Columns:            []TableColumn{},
+		Rows:               make([]Row, 0, len(serverTable.Rows)),
+		ResourceVersion:    serverTable.ResourceVersion,
+		Continue:           serverTable.Continue,
+		RemainingItemCount: serverTable.RemainingItemCount,
+	}
+
+	var kept []int
+	for i, column := range serverTable.ColumnDefinitions {
+		if hiddenNames[strings.ToLower(column.Name)] || (column.Priority > 0 && !wide) {
+			continue
+		}
+		kept = append(kept, i)
+		table.Columns = append(table.Columns, TableColumn{
+			Name:        column.Name,
+			Type:        column.Type,
+			Format:      column.Format,
+			Description: column.Description,
+			Priority:    column.Priority,
+		})
+	}
+
+	parsers := make([]*jsonpath.JSONPath, len(columns))
+	for i, column := range columns {
+		parser, err := parseJSONPath(column.Name, column.JSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", column.Name, err)
+		}
+		parsers[i] = parser
+		table.Columns = append(table.Columns, TableColumn{
+			Name:        column.Name,
+			Type:        column.Type,
+			Description: column.Description,
+			Priority:    column.Priority,
+			Custom:      true,
+		})
+	}
+
+	now := time.Now()
+	for _, serverRow := range serverTable.Rows {
+		var object map[string]interface{}
+		if len(serverRow.Object.Raw) > 0 {
+			if err := json.Unmarshal(serverRow.Object.Raw, &object); err != nil {
+				return nil, fmt.Errorf("failed to decode row object: %v", err)
+			}
+		}
+
+		row := Row{
+			Cells:  make([]interface{}, 0, len(table.Columns)),
+			Object: objectReference(serverRow.Object.Raw),
+		}
+		for _, i := range kept {
+			var cell interface{}
+			if i < len(serverRow.Cells) {
+				cell = serverRow.Cells[i]
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		for i, column := range columns {
+			cell, err := evaluateColumn(parsers[i], column.Type, object, now)
+			if err != nil {
+				table.Errors = append(table.Errors, fmt.Sprintf("%s %s: %v", column.Name, row.Object.Name, err))
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// parseJSONPath parses a column expression, accepting the relaxed ".spec.field" form of
+// additionalPrinterColumns as well as full "{...}" templates
+func parseJSONPath(name, expression string) (*jsonpath.JSONPath, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, fmt.Errorf("jsonPath is required")
+	}
+	if !strings.HasPrefix(expression, "{") {
+		if !strings.HasPrefix(expression, ".") {
+			expression = "." + expression
+		}
+		expression = "{" + expression + "}"
+	}
+
+	parser := jsonpath.New(name).AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, fmt.Errorf("invalid jsonPath: %v", err)
+	}
+	return parser, nil
+}
+
+// evaluateColumn returns the cell of a custom column, nil when the object has no value for it.
+// Several matches are joined with commas, as kubectl custom columns do.
+func evaluateColumn(parser *jsonpath.JSONPath, columnType string, object map[string]interface{}, now time.Time) (interface{}, error) {
+	if object == nil {
+		return nil, nil
+	}
+	results, err := parser.FindResults(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			if value.IsValid() && value.CanInterface() {
+				values = append(values, value.Interface())
+			}
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		return convertCell(columnType, values[0], now), nil
+	}
+
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(convertCell(columnType, value, now))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// convertCell converts a value to the column type. Dates render as ages, as the API server does.
+func convertCell(columnType string, value interface{}, now time.Time) interface{} {
+	switch columnType {
+	case TypeInteger:
+		if number, ok := value.(float64); ok {
+			return int64(number)
+		}
+	case TypeDate:
+		if text, ok := value.(string); ok {
+			if t, err := time.Parse(time.RFC3339, text); err == nil {
+				return duration.HumanDuration(now.Sub(t))
+			}
+		}
+	case TypeString:
+		switch value.(type) {
+		case string:
+		case map[string]interface{}, []interface{}:
+			data, _ := json.Marshal(value)
+			return string(data)
+		default:
+			return fmt.Sprint(value)
+		}
+	}
+	return value
+}
+
+func objectReference(raw []byte) ObjectReference {
+	var object metav1.PartialObjectMetadata
+	if len(raw) == 0 || json.Unmarshal(raw, &object) != nil {
+		return ObjectReference{}
+	}
+	return ObjectReference{
+		Name:              object.Name,
+		Namespace:         object.Namespace,
+		UID:               string(object.UID),
+		ResourceVersion:   object.ResourceVersion,
+		CreationTimestamp: object.CreationTimestamp,
+		Labels:            object.Labels,
+	}
+}
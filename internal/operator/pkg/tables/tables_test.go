@@ -0,0 +1,123 @@
+package tables
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRenderTable(t *testing.T) {
+	t.Parallel()
+
+	serverTable := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string"},
+			{Name: "Ready", Type: "string"},
+			{Name: "Age", Type: "string"},
+			{Name: "Node", Type: "string", Priority: 1},
+		},
+		Rows: []metav1.TableRow{{
+			Cells: []interface{}{"api-0", "1/1", "5m", "worker-1"},
+			Object: runtime.RawExtension{Raw: []byte(`{
+				"metadata": {"name": "api-0", "namespace": "web", "uid": "1234"},
+				"spec": {"containers": [{"image": "api:1"}, {"image": "proxy:2"}]},
+				"status": {"restartCount": 3, "conditions": [{"type": "Ready", "status": "True"}]}
+			}`)},
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		columns []Column
+		hidden  []string
+		wide    bool
+		header  []string
+		cells   []interface{}
+	}{
+		{
+			name:   "server columns",
+			header: []string{"Name", "Ready", "Age"},
+			cells:  []interface{}{"api-0", "1/1", "5m"},
+		},
+		{
+			name:   "wide with hidden column",
+			hidden: []string{"age"},
+			wide:   true,
+			header: []string{"Name", "Ready", "Node"},
+			cells:  []interface{}{"api-0", "1/1", "worker-1"},
+		},
+		{
+			name: "custom columns",
+			columns: []Column{
+				{Name: "Images", Type: TypeString, JSONPath: ".spec.containers[*].image"},
+				{Name: "Restarts", Type: TypeInteger, JSONPath: "status.restartCount"},
+				{Name: "Condition", Type: TypeString, JSONPath: "{.status.conditions[?(@.type=='Ready')].status}"},
+				{Name: "Missing", Type: TypeString, JSONPath: ".spec.nodeName"},
+			},
+			hidden: []string{"Ready", "Age"},
+			header: []string{"Name", "Images", "Restarts", "Condition", "Missing"},
+			cells:  []interface{}{"api-0", "api:1,proxy:2", int64(3), "True", nil},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			table, err := renderTable(serverTable, tt.columns, tt.hidden, tt.wide)
+			if err != nil {
+				t.Fatalf("renderTable() error = %v", err)
+			}
+
+			var header []string
+			for _, column := range table.Columns {
+				header = append(header, column.Name)
+			}
+			if !reflect.DeepEqual(header, tt.header) {
+				t.Errorf("columns = %v, want %v", header, tt.header)
+			}
+			if !reflect.DeepEqual(table.Rows[0].Cells, tt.cells) {
+				t.Errorf("cells = %#v, want %#v", table.Rows[0].Cells, tt.cells)
+			}
+			if table.Rows[0].Object.Namespace != "web" {
+				t.Errorf("object namespace = %q, want web", table.Rows[0].Object.Namespace)
+			}
+		})
+	}
+}
+
+func TestValidateColumns(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		columns []Column
+		wantErr bool
+	}{
+		{name: "valid", columns: []Column{{Name: "Replicas", Type: TypeInteger, JSONPath: ".spec.replicas"}}},
+		{name: "unknown type", columns: []Column{{Name: "Replicas", Type: "int", JSONPath: ".spec.replicas"}}, wantErr: true},
+		{name: "invalid path", columns: []Column{{Name: "Replicas", Type: TypeInteger, JSONPath: "{.spec.replicas"}}, wantErr: true},
+		{
+			name: "duplicate name",
+			columns: []Column{
+				{Name: "Replicas", Type: TypeInteger, JSONPath: ".spec.replicas"},
+				{Name: "replicas", Type: TypeInteger, JSONPath: ".status.replicas"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := validateColumns(tt.columns); (err != nil) != tt.wantErr {
+				t.Errorf("validateColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
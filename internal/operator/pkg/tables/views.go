@@ -0,0 +1,189 @@
+package tables
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const viewsFileName = "table-views.json"
+
+// Column types, the same as the additionalPrinterColumns of a CustomResourceDefinition
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+)
+
+// Column is a user-defined column evaluated against each object with a JSONPath expression
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// JSONPath selects the value, e.g. ".spec.replicas" or "{.status.conditions[?(@.type=='Ready')].status}"
+	JSONPath    string `json:"jsonPath"`
+	Description string `json:"description,omitempty"`
+	// Priority above zero marks columns shown in wide views only, as the API server does
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// View is the saved column layout of a resource
+type View struct {
+	// Resource is the plural resource name, qualified with its group for non-core resources,
+	// e.g. "pods" or "deployments.apps"
+	Resource string   `json:"resource"`
+	Columns  []Column `json:"columns"`
+	// HiddenColumns are the server columns left out of the table
+	HiddenColumns []string  `json:"hiddenColumns,omitempty"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Validate checks the view for invalid columns
+func (v View) Validate() error {
+	if v.Resource == "" {
+		return fmt.Errorf("resource is required")
+	}
+	return validateColumns(v.Columns)
+}
+
+func validateColumns(columns []Column) error {
+	names := map[string]bool{}
+	for _, column := range columns {
+		if column.Name == "" {
+			return fmt.Errorf("column name is required")
+		}
+		if names[strings.ToLower(column.Name)] {
+			return fmt.Errorf("duplicate column %q", column.Name)
+		}
+		names[strings.ToLower(column.Name)] = true
+
+		switch column.Type {
+		case TypeString, TypeInteger, TypeNumber, TypeBoolean, TypeDate:
+		default:
+			return fmt.Errorf("column %q has unknown type %q", column.Name, column.Type)
+		}
+		if _, err := parseJSONPath(column.Name, column.JSONPath); err != nil {
+			return fmt.Errorf("column %q: %v", column.Name, err)
+		}
+	}
+	return nil
+}
+
+// ResourceKey names the view of a resource
+func ResourceKey(group, resource string) string {
+	if group == "" || group == "core" {
+		return resource
+	}
+	return resource + "." + group
+}
+
+// ViewStore persists the saved views, keyed by resource
+type ViewStore struct {
+	filePath string
+	mutex    sync.Mutex
+}
+
+var (
+	globalViews *ViewStore
+	viewsOnce   sync.Once
+)
+
+// GetViewStore returns the shared view store
+func GetViewStore() *ViewStore {
+	viewsOnce.Do(func() {
+		globalViews = &ViewStore{
+			filePath: filepath.Join(utils.ConfigDir(), viewsFileName),
+		}
+	})
+	return globalViews
+}
+
+// List returns every saved view ordered by resource
+func (s *ViewStore) List() ([]View, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	views, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]View, 0, len(views))
+	for _, view := range views {
+		result = append(result, view)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Resource < result[j].Resource
+	})
+	return result, nil
+}
+
+// Get returns the view of a resource, or nil when none is saved
+func (s *ViewStore) Get(resource string) (*View, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	views, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	view, ok := views[resource]
+	if !ok {
+		return nil, nil
+	}
+	return &view, nil
+}
+
+// Save creates or replaces the view of a resource
+func (s *ViewStore) Save(view View) (*View, error) {
+	if err := view.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	views, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	view.UpdatedAt = time.Now()
+	views[view.Resource] = view
+	if err := s.save(views); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// Delete removes the view of a resource
+func (s *ViewStore) Delete(resource string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	views, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := views[resource]; !ok {
+		return fmt.Errorf("view for %s not found", resource)
+	}
+	delete(views, resource)
+	return s.save(views)
+}
+
+func (s *ViewStore) load() (map[string]View, error) {
+	views := map[string]View{}
+	if err := utils.ReadJSONFile(s.filePath, &views); err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+func (s *ViewStore) save(views map[string]View) error {
+	return utils.WriteJSONFile(s.filePath, views)
+}
@@ -0,0 +1,161 @@
+package traffic
+
+import (
+	"fmt"
+
+	"github.com/agentkube/operator/pkg/canvas"
+)
+
+// EdgeType is the canvas edge type of observed traffic
+const EdgeType = "traffic"
+
+// workloadTypes are the canvas resource types flows are reported for, meshes name workloads after
+// their controller
+var workloadTypes = map[string]bool{"deployments": true, "statefulsets": true, "daemonsets": true}
+
+// Summary aggregates the flows into or out of a workload
+type Summary struct {
+	Flows       int     `json:"flows"`
+	RequestRate float64 `json:"requestRate"`
+	ErrorRate   float64 `json:"errorRate"`
+	MaxP95Ms    float64 `json:"maxP95Ms"`
+}
+
+func (s *Summary) add(flow Flow) {
+	failed := s.ErrorRate*s.RequestRate + flow.ErrorRate*flow.RequestRate
+	s.Flows++
+	s.RequestRate = round(s.RequestRate + flow.RequestRate)
+	if s.RequestRate > 0 {
+		s.ErrorRate = round(failed / s.RequestRate)
+	}
+	if flow.P95Ms > s.MaxP95Ms {
+		s.MaxP95Ms = flow.P95Ms
+	}
+}
+
+// AnnotateGraph overlays the flows on a canvas graph: workload and service nodes get their inbound
+// and outbound traffic, and every flow from or to a workload of the graph becomes a traffic edge.
+// Peers missing from the graph are added as workload nodes.
+func AnnotateGraph(graph *canvas.GraphResponse, flows []Flow) {
+	if graph == nil || len(flows) == 0 {
+		return
+	}
+
+	workloadNodes := map[Workload]string{}
+	serviceNodes := map[Workload]string{}
+	for _, node := range graph.Nodes {
+		resourceType, _ := node.Data["resourceType"].(string)
+		namespace, _ := node.Data["namespace"].(string)
+		name, _ := node.Data["resourceName"].(string)
+		workload := Workload{Namespace: namespace, Name: name}
+		switch {
+		case workloadTypes[resourceType]:
+			workloadNodes[workload] = node.ID
+		case resourceType == "services":
+			serviceNodes[workload] = node.ID
+		}
+	}
+
+	// Peers are kept apart so that flows between two peers stay out of the graph
+	peers := map[Workload]string{}
+	inbound := map[string]*Summary{}
+	outbound := map[string]*Summary{}
+	for _, flow := range flows {
+		if serviceID, ok := serviceNodes[Workload{Namespace: flow.Destination.Namespace, Name: flow.Service}]; ok && flow.Service != "" {
+			summary(inbound, serviceID).add(flow)
+		}
+
+		sourceID, hasSource := workloadNodes[flow.Source]
+		destinationID, hasDestination := workloadNodes[flow.Destination]
+		if !hasSource && !hasDestination {
+			continue
+		}
+		if !hasSource {
+			sourceID = peer(graph, peers, flow.Source)
+		}
+		if !hasDestination {
+			destinationID = peer(graph, peers, flow.Destination)
+		}
+		summary(outbound, sourceID).add(flow)
+		summary(inbound, destinationID).add(flow)
+		graph.Edges = append(graph.Edges, edge(fmt.Sprintf("edge-%d", len(graph.Edges)+1), sourceID, destinationID, flow))
+	}
+
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		traffic := map[string]interface{}{}
+		if s, ok := inbound[node.ID]; ok {
+			traffic["inbound"] = s
+		}
+		if s, ok := outbound[node.ID]; ok {
+			traffic["outbound"] = s
+		}
+		if len(traffic) > 0 {
+			node.Data["traffic"] = traffic
+		}
+	}
+}
+
+// Graph builds a canvas graph of the flows alone, one node per workload
+func Graph(flows []Flow) *canvas.GraphResponse {
+	graph := &canvas.GraphResponse{Nodes: []canvas.Node{}, Edges: []canvas.Edge{}}
+	workloadNodes := map[Workload]string{}
+	for _, flow := range flows {
+		sourceID := peer(graph, workloadNodes, flow.Source)
+		destinationID := peer(graph, workloadNodes, flow.Destination)
+		graph.Edges = append(graph.Edges, edge(fmt.Sprintf("edge-%d", len(graph.Edges)+1), sourceID, destinationID, flow))
+	}
+	return graph
+}
+
+func summary(summaries map[string]*Summary, key string) *Summary {
+	if s, ok := summaries[key]; ok {
+		return s
+	}
+	s := &Summary{}
+	summaries[key] = s
+	return s
+}
+
+// peer returns the node of a workload seen in the traffic only, adding it on first use
+func peer(graph *canvas.GraphResponse, peers map[Workload]string, workload Workload) string {
+	if id, ok := peers[workload]; ok {
+		return id
+	}
+	id := fmt.Sprintf("node-workload-%s-%s", workload.Namespace, workload.Name)
+	graph.Nodes = append(graph.Nodes, canvas.Node{
+		ID:   id,
+		Type: "workload",
+		Data: map[string]interface{}{
+			"namespace":    workload.Namespace,
+			"resourceName": workload.Name,
+		},
+	})
+	peers[workload] = id
+	return id
+}
+
+func edge(id, source, target string, flow Flow) canvas.Edge {
+	label := fmt.Sprintf("%.1f rps", flow.RequestRate)
+	if flow.P95Ms > 0 {
+		label += fmt.Sprintf(", p95 %.0fms", flow.P95Ms)
+	}
+	if flow.ErrorRate > 0 {
+		label += fmt.Sprintf(", %.1f%% errors", flow.ErrorRate*100)
+	}
+	return canvas.Edge{
+		ID:     id,
+		Source: source,
+		Target: target,
+		Type:   EdgeType,
+		Label:  label,
+		Data: map[string]interface{}{
+			"requestRate": flow.RequestRate,
+			"errorRate":   flow.ErrorRate,
+			"p50Ms":       flow.P50Ms,
+			"p95Ms":       flow.P95Ms,
+			"p99Ms":       flow.P99Ms,
+			"reporter":    flow.Reporter,
+		},
+	}
+}
@@ -0,0 +1,397 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/canvas"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Traffic sources
+const (
+	SourceIstio  = "istio"
+	SourceHubble = "hubble"
+	SourcePixie  = "pixie"
+)
+
+// Source states
+const (
+	StatusAvailable   = "available"
+	StatusNoData      = "no-data"
+	StatusUnsupported = "unsupported"
+)
+
+const (
+	defaultWindow = 5 * time.Minute
+	minWindow     = time.Minute
+	maxWindow     = time.Hour
+)
+
+// ErrInvalidRequest is returned for windows outside the supported range
+var ErrInvalidRequest = errors.New("invalid traffic request")
+
+// prometheusNamespaces and prometheusServices are where Prometheus is looked up, in order
+var (
+	prometheusNamespaces = []string{"monitoring", "prometheus", "kube-prometheus-stack", "observability", "istio-system"}
+	prometheusServices   = []string{"prometheus-operated", "prometheus-server", "prometheus", "kube-prometheus-stack-prometheus"}
+)
+
+// Collector reads service-to-service traffic from the metrics of service meshes and eBPF agents
+type Collector struct {
+	kubeConfigStore kubeconfig.ContextStore
+}
+
+// Map is the live dependency map of a cluster over a time window
+type Map struct {
+	Cluster    string         `json:"cluster"`
+	Window     string         `json:"window"`
+	Prometheus string         `json:"prometheus"`
+	Sources    []SourceStatus `json:"sources"`
+	Flows      []Flow         `json:"flows"`
+	// Graph draws the flows as a canvas graph
+	Graph *canvas.GraphResponse `json:"graph"`
+}
+
+// SourceStatus tells whether a traffic source contributed flows
+type SourceStatus struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Flows   int    `json:"flows"`
+	Message string `json:"message,omitempty"`
+}
+
+// Workload is an endpoint of a flow
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Flow is the traffic from one workload to another
+type Flow struct {
+	Source      Workload `json:"source"`
+	Destination Workload `json:"destination"`
+	// Service is the destination service, only reported by Istio
+	Service     string  `json:"service,omitempty"`
+	RequestRate float64 `json:"requestRate"`
+	ErrorRate   float64 `json:"errorRate"`
+	P50Ms       float64 `json:"p50Ms"`
+	P95Ms       float64 `json:"p95Ms"`
+	P99Ms       float64 `json:"p99Ms"`
+	Reporter    string  `json:"reporter"`
+}
+
+// prometheus is a Prometheus server reached through the API server service proxy
+type prometheus struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	port      string
+}
+
+// query describes the metrics of a traffic source. The labels are the source namespace, source
+// workload, destination namespace and destination workload.
+type query struct {
+	source   string
+	requests string
+	buckets  string
+	matchers []string
+	failed   string
+	labels   [4]string
+	service  string
+	// scale converts the histogram unit to milliseconds
+	scale float64
+}
+
+var queries = []query{
+	{
+		source:   SourceIstio,
+		requests: "istio_requests_total",
+		buckets:  "istio_request_duration_milliseconds_bucket",
+		matchers: []string{`reporter="destination"`},
+		failed:   `response_code=~"5.."`,
+		labels:   [4]string{"source_workload_namespace", "source_workload", "destination_workload_namespace", "destination_workload"},
+		service:  "destination_service_name",
+		scale:    1,
+	},
+	{
+		// Hubble needs the http metric with labelsContext=source_namespace,source_workload,destination_namespace,destination_workload
+		source:   SourceHubble,
+		requests: "hubble_http_requests_total",
+		buckets:  "hubble_http_request_duration_seconds_bucket",
+		failed:   `status=~"5.."`,
+		labels:   [4]string{"source_namespace", "source_workload", "destination_namespace", "destination_workload"},
+		scale:    1000,
+	},
+}
+
+// NewCollector creates a new traffic collector
+func NewCollector(kubeConfigStore kubeconfig.ContextStore) *Collector {
+	return &Collector{
+		kubeConfigStore: kubeConfigStore,
+	}
+}
+
+// ParseWindow parses the rate window of the queries, 5m by default
+func ParseWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultWindow, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if window < minWindow || window > maxWindow {
+		return 0, fmt.Errorf("%w: window must be between %s and %s", ErrInvalidRequest, minWindow, maxWindow)
+	}
+	return window, nil
+}
+
+// Collect builds the dependency map of a cluster, limited to flows into the namespace when set
+func (c *Collector) Collect(clusterName, namespace string, window time.Duration) (*Map, error) {
+	kubeContext, err := c.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context for cluster %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	dependencyMap, err := Query(context.Background(), clientset, namespace, window)
+	if err != nil {
+		return nil, err
+	}
+	dependencyMap.Cluster = clusterName
+	return dependencyMap, nil
+}
+
+// Query reads the flows of every available source from the Prometheus server of the cluster
+func Query(ctx context.Context, clientset *kubernetes.Clientset, namespace string, window time.Duration) (*Map, error) {
+	server, err := findPrometheus(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	dependencyMap := &Map{
+		Window:     window.String(),
+		Prometheus: server.namespace + "/" + server.name,
+		Sources:    []SourceStatus{},
+		Flows:      []Flow{},
+	}
+	for _, q := range queries {
+		flows, err := server.flows(ctx, q, namespace, window)
+		status := SourceStatus{Name: q.source, Status: StatusAvailable, Flows: len(flows)}
+		switch {
+		case err != nil:
+			status.Status, status.Message = StatusNoData, err.Error()
+		case len(flows) == 0:
+			status.Status = StatusNoData
+		}
+		dependencyMap.Sources = append(dependencyMap.Sources, status)
+		dependencyMap.Flows = append(dependencyMap.Flows, flows...)
+	}
+	if pixieInstalled(ctx, clientset) {
+		dependencyMap.Sources = append(dependencyMap.Sources, SourceStatus{
+			Name:    SourcePixie,
+			Status:  StatusUnsupported,
+			Message: "Pixie keeps its data in the cluster and exports no Prometheus metrics, enable Istio or Hubble metrics instead",
+		})
+	}
+
+	sort.Slice(dependencyMap.Flows, func(i, j int) bool {
+		return dependencyMap.Flows[i].RequestRate > dependencyMap.Flows[j].RequestRate
+	})
+	dependencyMap.Graph = Graph(dependencyMap.Flows)
+	return dependencyMap, nil
+}
+
+// findPrometheus looks up the Prometheus service in the namespaces Prometheus is usually installed in
+func findPrometheus(ctx context.Context, clientset *kubernetes.Clientset) (*prometheus, error) {
+	for _, namespace := range prometheusNamespaces {
+		for _, name := range prometheusServices {
+			service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil || len(service.Spec.Ports) == 0 {
+				continue
+			}
+			return &prometheus{clientset: clientset, namespace: namespace, name: name, port: servicePort(service)}, nil
+		}
+	}
+	return nil, fmt.Errorf("prometheus service not found in namespaces %s", strings.Join(prometheusNamespaces, ", "))
+}
+
+// servicePort prefers the port named after the Prometheus web endpoint
+func servicePort(service *corev1.Service) string {
+	for _, port := range service.Spec.Ports {
+		if port.Name == "web" || port.Name == "http-web" || port.Port == 9090 {
+			return strconv.Itoa(int(port.Port))
+		}
+	}
+	return strconv.Itoa(int(service.Spec.Ports[0].Port))
+}
+
+// pixieInstalled detects the Pixie Vizier in its default namespace
+func pixieInstalled(ctx context.Context, clientset *kubernetes.Clientset) bool {
+	_, err := clientset.CoreV1().Namespaces().Get(ctx, "pl", metav1.GetOptions{})
+	return err == nil
+}
+
+// flows queries the request rate, error rate and latency percentiles of a source and joins them
+// per pair of workloads
+func (p *prometheus) flows(ctx context.Context, q query, namespace string, window time.Duration) ([]Flow, error) {
+	matchers := append([]string{}, q.matchers...)
+	if namespace != "" {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", q.labels[2], namespace))
+	}
+	by := strings.Join(q.labels[:], ",")
+	if q.service != "" {
+		by += "," + q.service
+	}
+	rangeVector := fmt.Sprintf("[%ds]", int(window.Seconds()))
+
+	rates, err := p.vector(ctx, fmt.Sprintf("sum by (%s) (rate(%s%s))", by, selector(q.requests, matchers...), rangeVector))
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, nil
+	}
+	failures, err := p.vector(ctx, fmt.Sprintf("sum by (%s) (rate(%s%s))", by, selector(q.requests, append(matchers, q.failed)...), rangeVector))
+	if err != nil {
+		return nil, err
+	}
+	buckets := fmt.Sprintf("sum by (le,%s) (rate(%s%s))", by, selector(q.buckets, matchers...), rangeVector)
+	quantiles := map[float64][]sample{}
+	for _, quantile := range []float64{0.5, 0.95, 0.99} {
+		if quantiles[quantile], err = p.vector(ctx, fmt.Sprintf("histogram_quantile(%g, %s)", quantile, buckets)); err != nil {
+			return nil, err
+		}
+	}
+	return join(q, rates, failures, quantiles), nil
+}
+
+func selector(metric string, matchers ...string) string {
+	return metric + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// sample is an instant vector element of a query result
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// vector runs an instant query through the service proxy
+func (p *prometheus) vector(ctx context.Context, promQL string) ([]sample, error) {
+	body, err := p.clientset.CoreV1().Services(p.namespace).
+		ProxyGet("http", p.name, p.port, "api/v1/query", map[string]string{"query": promQL}).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prometheus: %v", err)
+	}
+	return parseVector(body)
+}
+
+func parseVector(body []byte) ([]sample, error) {
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  []interface{}     `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse prometheus response: %v", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", result.Error)
+	}
+
+	samples := make([]sample, 0, len(result.Data.Result))
+	for _, series := range result.Data.Result {
+		if len(series.Value) < 2 {
+			continue
+		}
+		raw, ok := series.Value[1].(string)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		// NaN comes from quantiles over empty buckets
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		samples = append(samples, sample{labels: series.Metric, value: value})
+	}
+	return samples, nil
+}
+
+// join merges the series of the queries into one flow per pair of workloads. Series with unknown
+// endpoints, like traffic from outside the mesh, are skipped.
+func join(q query, rates, failures []sample, quantiles map[float64][]sample) []Flow {
+	key := func(labels map[string]string) string {
+		return strings.Join([]string{labels[q.labels[0]], labels[q.labels[1]], labels[q.labels[2]], labels[q.labels[3]], labels[q.service]}, "|")
+	}
+
+	index := map[string]int{}
+	flows := []Flow{}
+	for _, rate := range rates {
+		source := Workload{Namespace: rate.labels[q.labels[0]], Name: rate.labels[q.labels[1]]}
+		destination := Workload{Namespace: rate.labels[q.labels[2]], Name: rate.labels[q.labels[3]]}
+		if !known(source) || !known(destination) || rate.value == 0 {
+			continue
+		}
+		index[key(rate.labels)] = len(flows)
+		flows = append(flows, Flow{
+			Source:      source,
+			Destination: destination,
+			Service:     rate.labels[q.service],
+			RequestRate: round(rate.value),
+			Reporter:    q.source,
+		})
+	}
+
+	for _, failure := range failures {
+		if i, ok := index[key(failure.labels)]; ok && flows[i].RequestRate > 0 {
+			flows[i].ErrorRate = round(failure.value / flows[i].RequestRate)
+		}
+	}
+	for quantile, samples := range quantiles {
+		for _, s := range samples {
+			i, ok := index[key(s.labels)]
+			if !ok {
+				continue
+			}
+			switch quantile {
+			case 0.5:
+				flows[i].P50Ms = round(s.value * q.scale)
+			case 0.95:
+				flows[i].P95Ms = round(s.value * q.scale)
+			case 0.99:
+				flows[i].P99Ms = round(s.value * q.scale)
+			}
+		}
+	}
+	return flows
+}
+
+func known(workload Workload) bool {
+	return workload.Name != "" && workload.Name != "unknown" && workload.Namespace != "" && workload.Namespace != "unknown"
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
@@ -0,0 +1,111 @@
+package traffic
+
+import (
+	"testing"
+
+	"github.com/agentkube/operator/pkg/canvas"
+)
+
+func TestJoin(t *testing.T) {
+	t.Parallel()
+
+	istio := queries[0]
+	labels := func(source, destination string) map[string]string {
+		return map[string]string{
+			"source_workload_namespace":      "shop",
+			"source_workload":                source,
+			"destination_workload_namespace": "shop",
+			"destination_workload":           destination,
+			"destination_service_name":       destination,
+		}
+	}
+
+	rates, err := parseVector([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"source_workload_namespace":"shop","source_workload":"frontend","destination_workload_namespace":"shop","destination_workload":"cart","destination_service_name":"cart"},"value":[1700000000,"20"]},
+		{"metric":{"source_workload_namespace":"unknown","source_workload":"unknown","destination_workload_namespace":"shop","destination_workload":"frontend","destination_service_name":"frontend"},"value":[1700000000,"5"]}
+	]}}`))
+	if err != nil {
+		t.Fatalf("parseVector() error = %v", err)
+	}
+	failures := []sample{{labels: labels("frontend", "cart"), value: 1}}
+	quantiles := map[float64][]sample{
+		0.5:  {{labels: labels("frontend", "cart"), value: 12}},
+		0.95: {{labels: labels("frontend", "cart"), value: 40}},
+	}
+
+	flows := join(istio, rates, failures, quantiles)
+	if len(flows) != 1 {
+		t.Fatalf("join() = %d flows, want 1 without the unknown source", len(flows))
+	}
+	flow := flows[0]
+	if flow.Source.Name != "frontend" || flow.Destination.Name != "cart" || flow.Service != "cart" {
+		t.Errorf("join() flow = %s -> %s (%s), want frontend -> cart (cart)", flow.Source.Name, flow.Destination.Name, flow.Service)
+	}
+	if flow.RequestRate != 20 || flow.ErrorRate != 0.05 || flow.P50Ms != 12 || flow.P95Ms != 40 {
+		t.Errorf("join() flow = %+v, want 20 rps, 5%% errors, p50 12ms and p95 40ms", flow)
+	}
+}
+
+func TestParseVectorSkipsNaN(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseVector([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"le":"+Inf"},"value":[1700000000,"NaN"]},
+		{"metric":{},"value":[1700000000,"0.25"]}
+	]}}`))
+	if err != nil {
+		t.Fatalf("parseVector() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].value != 0.25 {
+		t.Errorf("parseVector() = %+v, want the 0.25 sample only", samples)
+	}
+
+	if _, err := parseVector([]byte(`{"status":"error","error":"parse error"}`)); err == nil {
+		t.Error("parseVector() error = nil for a failed query")
+	}
+}
+
+func TestAnnotateGraph(t *testing.T) {
+	t.Parallel()
+
+	node := func(id, resourceType, name string) canvas.Node {
+		return canvas.Node{ID: id, Type: "resource", Data: map[string]interface{}{
+			"resourceType": resourceType, "namespace": "shop", "resourceName": name,
+		}}
+	}
+	graph := &canvas.GraphResponse{
+		Nodes: []canvas.Node{node("node-deployment-cart", "deployments", "cart"), node("node-service-cart", "services", "cart")},
+		Edges: []canvas.Edge{{ID: "edge-1", Source: "node-service-cart", Target: "node-deployment-cart"}},
+	}
+	flows := []Flow{
+		{Source: Workload{"shop", "frontend"}, Destination: Workload{"shop", "cart"}, Service: "cart", RequestRate: 30, ErrorRate: 0.1, P95Ms: 50},
+		{Source: Workload{"shop", "cart"}, Destination: Workload{"shop", "redis"}, RequestRate: 60, P95Ms: 2},
+		{Source: Workload{"shop", "frontend"}, Destination: Workload{"shop", "catalog"}, RequestRate: 10},
+	}
+
+	AnnotateGraph(graph, flows)
+
+	if len(graph.Edges) != 3 {
+		t.Fatalf("AnnotateGraph() = %d edges, want the existing edge and 2 traffic edges", len(graph.Edges))
+	}
+	// frontend and redis are added as peers, catalog is unrelated to the graph
+	if len(graph.Nodes) != 4 {
+		t.Fatalf("AnnotateGraph() = %d nodes, want 4", len(graph.Nodes))
+	}
+	traffic, ok := graph.Nodes[0].Data["traffic"].(map[string]interface{})
+	if !ok {
+		t.Fatal("AnnotateGraph() did not annotate the deployment")
+	}
+	if in := traffic["inbound"].(*Summary); in.RequestRate != 30 || in.ErrorRate != 0.1 || in.MaxP95Ms != 50 {
+		t.Errorf("AnnotateGraph() inbound = %+v", in)
+	}
+	if out := traffic["outbound"].(*Summary); out.RequestRate != 60 {
+		t.Errorf("AnnotateGraph() outbound = %+v", out)
+	}
+	if _, ok := graph.Nodes[1].Data["traffic"]; !ok {
+		t.Error("AnnotateGraph() did not annotate the service")
+	}
+	if edge := graph.Edges[1]; edge.Type != EdgeType || edge.Label != "30.0 rps, p95 50ms, 10.0% errors" {
+		t.Errorf("AnnotateGraph() edge = %+v", edge)
+	}
+}
@@ -0,0 +1,93 @@
+package usagehistory
+
+import "time"
+
+// Sample is the usage of a node or pod at a time, keyed tersely since rings hold a day of them
+type Sample struct {
+	// Time is in unix seconds
+	Time        int64 `json:"t"`
+	CPUMillis   int64 `json:"c"`
+	MemoryBytes int64 `json:"m"`
+}
+
+// Ring keeps the last samples of a series, overwriting the oldest once full
+type Ring struct {
+	Samples []Sample `json:"samples"`
+	// Head is the index of the oldest sample once the ring is full
+	Head int `json:"head"`
+}
+
+// add appends a sample, dropping the oldest past capacity. The capacity follows the sampling
+// interval, a ring recorded at another interval is resized.
+func (r *Ring) add(sample Sample, capacity int) {
+	if len(r.Samples) < capacity {
+		if r.Head != 0 {
+			r.Samples, r.Head = r.ordered(), 0
+		}
+		r.Samples = append(r.Samples, sample)
+		return
+	}
+	if len(r.Samples) > capacity {
+		ordered := r.ordered()
+		r.Samples, r.Head = append([]Sample{}, ordered[len(ordered)-capacity:]...), 0
+	}
+	r.Samples[r.Head] = sample
+	r.Head = (r.Head + 1) % capacity
+}
+
+// ordered returns the samples oldest first
+func (r *Ring) ordered() []Sample {
+	ordered := make([]Sample, 0, len(r.Samples))
+	ordered = append(ordered, r.Samples[r.Head:]...)
+	return append(ordered, r.Samples[:r.Head]...)
+}
+
+// latest returns the time of the newest sample, zero for an empty ring
+func (r *Ring) latest() time.Time {
+	if len(r.Samples) == 0 {
+		return time.Time{}
+	}
+	index := r.Head - 1
+	if index < 0 {
+		index = len(r.Samples) - 1
+	}
+	return time.Unix(r.Samples[index].Time, 0)
+}
+
+// Point is a point of a sparkline, the average of the samples of a step
+type Point struct {
+	Time        time.Time `json:"time"`
+	CPUMillis   int64     `json:"cpuMillis"`
+	MemoryBytes int64     `json:"memoryBytes"`
+}
+
+// points averages the samples since a time into steps, a step without samples has no point
+func (r *Ring) points(since time.Time, step time.Duration) []Point {
+	points := []Point{}
+	var sum Point
+	var count int64
+	var stepStart time.Time
+	flush := func() {
+		if count > 0 {
+			points = append(points, Point{Time: stepStart, CPUMillis: sum.CPUMillis / count, MemoryBytes: sum.MemoryBytes / count})
+		}
+		sum, count = Point{}, 0
+	}
+
+	for _, sample := range r.ordered() {
+		at := time.Unix(sample.Time, 0)
+		if at.Before(since) {
+			continue
+		}
+		start := since.Add(at.Sub(since) / step * step)
+		if !start.Equal(stepStart) {
+			flush()
+			stepStart = start
+		}
+		sum.CPUMillis += sample.CPUMillis
+		sum.MemoryBytes += sample.MemoryBytes
+		count++
+	}
+	flush()
+	return points
+}
@@ -0,0 +1,73 @@
+package usagehistory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func times(samples []Sample) []int64 {
+	times := []int64{}
+	for _, sample := range samples {
+		times = append(times, sample.Time)
+	}
+	return times
+}
+
+func TestRingAdd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		capacities []int
+		want       []int64
+	}{
+		{name: "not full", capacities: []int{4, 4, 4}, want: []int64{1, 2, 3}},
+		{name: "wraps around", capacities: []int{3, 3, 3, 3, 3}, want: []int64{3, 4, 5}},
+		{name: "shrinks", capacities: []int{4, 4, 4, 4, 4, 2}, want: []int64{5, 6}},
+		{name: "grows after wrapping", capacities: []int{2, 2, 2, 4, 4}, want: []int64{2, 3, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ring := &Ring{}
+			for i, capacity := range tt.capacities {
+				ring.add(Sample{Time: int64(i + 1)}, capacity)
+			}
+			if got := times(ring.ordered()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("samples = %v, want %v", got, tt.want)
+			}
+			if latest := ring.latest().Unix(); latest != int64(len(tt.capacities)) {
+				t.Errorf("latest() = %d, want %d", latest, len(tt.capacities))
+			}
+		})
+	}
+}
+
+func TestRingPoints(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ring := &Ring{}
+	// A sample a minute for 10 minutes, in a ring that wrapped
+	for i := 0; i < 12; i++ {
+		at := start.Add(time.Duration(i-2) * time.Minute)
+		ring.add(Sample{Time: at.Unix(), CPUMillis: int64(i * 10), MemoryBytes: 1000}, 10)
+	}
+
+	points := ring.points(start.Add(4*time.Minute), 5*time.Minute)
+	want := []Point{
+		// Samples at 4m, 5m, 6m, 7m and 8m, the step before the sample at 9m
+		{Time: start.Add(4 * time.Minute), CPUMillis: 80, MemoryBytes: 1000},
+		{Time: start.Add(9 * time.Minute), CPUMillis: 110, MemoryBytes: 1000},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("points() = %+v, want %+v", points, want)
+	}
+	if points := (&Ring{}).points(start, time.Minute); len(points) != 0 {
+		t.Errorf("points() of an empty ring = %+v", points)
+	}
+}
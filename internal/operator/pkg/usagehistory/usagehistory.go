@@ -0,0 +1,451 @@
+package usagehistory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/metrics"
+	"github.com/agentkube/operator/pkg/shutdown"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "usage-history.json"
+	historyDirName   = "usage-history"
+
+	// Retention is how far back series go, the longest sparkline range
+	Retention = 24 * time.Hour
+	// MaxPoints bounds the points of a sparkline, samples are averaged into as many steps
+	MaxPoints = 60
+
+	// tickInterval is how often the recorder checks which clusters are due for a sample
+	tickInterval = 15 * time.Second
+	// flushInterval is how often recorded series are written to disk, samples since the last flush
+	// are lost when the operator crashes
+	flushInterval = 10 * time.Minute
+)
+
+// Ranges of the sparklines
+var Ranges = map[string]time.Duration{"1h": time.Hour, "6h": 6 * time.Hour, "24h": 24 * time.Hour}
+
+// Kinds of series
+const (
+	KindNode = "node"
+	KindPod  = "pod"
+)
+
+// ErrNoHistory is returned for nodes and pods without recorded samples
+var ErrNoHistory = errors.New("no usage history")
+
+// Settings configure the sampling of metrics.k8s.io usage into the history
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Clusters limits recording to these contexts, empty records every context
+	Clusters        []string `json:"clusters"`
+	IntervalSeconds int      `json:"intervalSeconds"`
+	// ClusterIntervals overrides the interval of some clusters, in seconds
+	ClusterIntervals map[string]int `json:"clusterIntervals"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Clusters:         []string{},
+		IntervalSeconds:  60,
+		ClusterIntervals: map[string]int{},
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if err := validateInterval(s.IntervalSeconds); err != nil {
+		return fmt.Errorf("intervalSeconds %v", err)
+	}
+	for cluster, interval := range s.ClusterIntervals {
+		if err := validateInterval(interval); err != nil {
+			return fmt.Errorf("interval of cluster %s %v", cluster, err)
+		}
+	}
+	return nil
+}
+
+func validateInterval(seconds int) error {
+	// Metrics server scrapes every 15s by default, sampling faster reads the same values
+	if seconds < 15 || seconds > 3600 {
+		return fmt.Errorf("must be between 15 and 3600")
+	}
+	return nil
+}
+
+// interval returns the sampling interval of a cluster
+func (s Settings) interval(clusterName string) time.Duration {
+	if seconds, ok := s.ClusterIntervals[clusterName]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(s.IntervalSeconds) * time.Second
+}
+
+// Series is a sparkline of a node or pod
+type Series struct {
+	Kind      string  `json:"kind"`
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	Range     string  `json:"range"`
+	Step      string  `json:"step"`
+	Points    []Point `json:"points"`
+}
+
+// clusterHistory holds the series of a cluster keyed by node/<name> and pod/<namespace>/<name>
+type clusterHistory struct {
+	series     map[string]*Ring
+	lastSample time.Time
+	dirty      bool
+}
+
+// Manager samples the node and pod usage of clusters from metrics.k8s.io into ring buffers
+// kept on disk, for sparklines without Prometheus
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	historyDir      string
+	mutex           sync.Mutex
+	clusters        map[string]*clusterHistory
+	lastFlush       time.Time
+	stopChan        chan struct{}
+}
+
+// NewManager creates a new usage history recorder
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		historyDir:      filepath.Join(utils.ConfigDir(), historyDirName),
+		clusters:        map[string]*clusterHistory{},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current recorder settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new recorder settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+	if settings.ClusterIntervals == nil {
+		settings.ClusterIntervals = map[string]int{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Start records the configured clusters until Stop is called, and flushes the series on shutdown
+func (m *Manager) Start() {
+	shutdown.Register("usage-history", shutdown.PriorityScans, m.drain)
+
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the recording loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Sample records the current usage of a cluster
+func (m *Manager) Sample(ctx context.Context, clusterName string) error {
+	settings, err := m.Settings()
+	if err != nil {
+		return err
+	}
+	return m.sample(ctx, clusterName, settings, time.Now())
+}
+
+// Nodes returns the sparklines of the nodes of a cluster over a range
+func (m *Manager) Nodes(clusterName, rangeName string) ([]Series, error) {
+	return m.list(clusterName, KindNode+"/", rangeName)
+}
+
+// Pods returns the sparklines of the pods of a cluster over a range, all namespaces when
+// namespace is empty
+func (m *Manager) Pods(clusterName, namespace, rangeName string) ([]Series, error) {
+	prefix := KindPod + "/"
+	if namespace != "" {
+		prefix += namespace + "/"
+	}
+	return m.list(clusterName, prefix, rangeName)
+}
+
+// Node returns the sparkline of a node over a range
+func (m *Manager) Node(clusterName, name, rangeName string) (*Series, error) {
+	return m.get(clusterName, KindNode+"/"+name, rangeName)
+}
+
+// Pod returns the sparkline of a pod over a range
+func (m *Manager) Pod(clusterName, namespace, name, rangeName string) (*Series, error) {
+	return m.get(clusterName, KindPod+"/"+namespace+"/"+name, rangeName)
+}
+
+func (m *Manager) list(clusterName, prefix, rangeName string) ([]Series, error) {
+	window, ok := Ranges[rangeName]
+	if !ok {
+		return nil, fmt.Errorf("range must be 1h, 6h or 24h")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	history, err := m.history(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-window)
+	series := []Series{}
+	for key, ring := range history.series {
+		if strings.HasPrefix(key, prefix) && !ring.latest().Before(since) {
+			series = append(series, seriesOf(key, ring, rangeName, since, window))
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Namespace+"/"+series[i].Name < series[j].Namespace+"/"+series[j].Name
+	})
+	return series, nil
+}
+
+func (m *Manager) get(clusterName, key, rangeName string) (*Series, error) {
+	window, ok := Ranges[rangeName]
+	if !ok {
+		return nil, fmt.Errorf("range must be 1h, 6h or 24h")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	history, err := m.history(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	ring, ok := history.series[key]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoHistory, key)
+	}
+	series := seriesOf(key, ring, rangeName, time.Now().Add(-window), window)
+	return &series, nil
+}
+
+// monitor samples the clusters whose interval elapsed, and flushes the series periodically
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load usage history settings")
+		return
+	}
+
+	if settings.Enabled {
+		clusters := settings.Clusters
+		if len(clusters) == 0 {
+			contexts, err := m.kubeConfigStore.GetContexts()
+			if err != nil {
+				logger.Log(logger.LevelError, nil, err, "Failed to list contexts for usage history")
+				return
+			}
+			for _, kubeContext := range contexts {
+				clusters = append(clusters, kubeContext.Name)
+			}
+		}
+
+		for _, clusterName := range clusters {
+			// Clusters over their resource budget are skipped until they are resumed
+			if budget.Paused(clusterName) || !m.due(clusterName, settings.interval(clusterName), now) {
+				continue
+			}
+			if err := m.sample(context.Background(), clusterName, settings, now); err != nil {
+				logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to sample usage history")
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	flush := now.Sub(m.lastFlush) >= flushInterval
+	if flush {
+		m.lastFlush = now
+	}
+	m.mutex.Unlock()
+	if flush {
+		m.flush()
+	}
+}
+
+// due reports whether the interval of a cluster elapsed since its last sample
+func (m *Manager) due(clusterName string, interval time.Duration, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	history, err := m.history(clusterName)
+	if err != nil {
+		logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to load usage history")
+		return false
+	}
+	return now.Sub(history.lastSample) >= interval
+}
+
+// sample reads the node and pod usage of a cluster and adds it to its series
+func (m *Manager) sample(ctx context.Context, clusterName string, settings Settings, now time.Time) error {
+	defer budget.Track(clusterName, "usagehistory")()
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return fmt.Errorf("context not found: %w", err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes clientset: %w", err)
+	}
+
+	nodes, err := metrics.FetchNodeUsage(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	pods, err := metrics.FetchPodUsage(ctx, clientset, "")
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	history, err := m.history(clusterName)
+	if err != nil {
+		return err
+	}
+	capacity := int(Retention / settings.interval(clusterName))
+	for _, node := range nodes.Nodes {
+		history.add(KindNode+"/"+node.Name, Sample{Time: now.Unix(), CPUMillis: node.CPUMillis, MemoryBytes: node.MemoryBytes}, capacity)
+	}
+	for _, pod := range pods.Pods {
+		history.add(KindPod+"/"+pod.Namespace+"/"+pod.Name, Sample{Time: now.Unix(), CPUMillis: pod.CPUMillis, MemoryBytes: pod.MemoryBytes}, capacity)
+	}
+	history.prune(now.Add(-Retention))
+	history.lastSample = now
+	history.dirty = true
+	return nil
+}
+
+func (h *clusterHistory) add(key string, sample Sample, capacity int) {
+	ring, ok := h.series[key]
+	if !ok {
+		ring = &Ring{}
+		h.series[key] = ring
+	}
+	ring.add(sample, capacity)
+}
+
+// prune drops the series of nodes and pods gone since the cutoff
+func (h *clusterHistory) prune(cutoff time.Time) {
+	for key, ring := range h.series {
+		if ring.latest().Before(cutoff) {
+			delete(h.series, key)
+		}
+	}
+}
+
+// flush writes the series of the clusters sampled since the last flush
+func (m *Manager) flush() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for clusterName, history := range m.clusters {
+		if !history.dirty {
+			continue
+		}
+		if err := utils.WriteJSONFile(m.historyPath(clusterName), history.series); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to write usage history")
+			continue
+		}
+		history.dirty = false
+	}
+}
+
+// drain flushes the series at shutdown
+func (m *Manager) drain(ctx context.Context) []shutdown.Abandoned {
+	m.flush()
+	return nil
+}
+
+// history returns the series of a cluster, read from disk the first time, the caller must hold
+// the mutex
+func (m *Manager) history(clusterName string) (*clusterHistory, error) {
+	if history, ok := m.clusters[clusterName]; ok {
+		return history, nil
+	}
+	series := map[string]*Ring{}
+	if err := utils.ReadJSONFile(m.historyPath(clusterName), &series); err != nil {
+		return nil, err
+	}
+	history := &clusterHistory{series: series}
+	for _, ring := range series {
+		if latest := ring.latest(); latest.After(history.lastSample) {
+			history.lastSample = latest
+		}
+	}
+	m.clusters[clusterName] = history
+	return history, nil
+}
+
+// historyPath names the history file of a cluster after a hash, context names hold characters
+// file names can't
+func (m *Manager) historyPath(clusterName string) string {
+	sum := sha256.Sum256([]byte(clusterName))
+	return filepath.Join(m.historyDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// seriesOf averages a ring over a range into at most MaxPoints points
+func seriesOf(key string, ring *Ring, rangeName string, since time.Time, window time.Duration) Series {
+	series := Series{Range: rangeName}
+	parts := strings.SplitN(key, "/", 3)
+	series.Kind = parts[0]
+	if len(parts) == 3 {
+		series.Namespace, series.Name = parts[1], parts[2]
+	} else {
+		series.Name = parts[1]
+	}
+	step := window / MaxPoints
+	series.Step = step.String()
+	series.Points = ring.points(since, step)
+	return series
+}
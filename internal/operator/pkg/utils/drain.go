@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// drainPollInterval is how often draining queues check for running operations
+const drainPollInterval = 100 * time.Millisecond
+
+// liveQueues are the queues created and not stopped, drained together at shutdown
+var (
+	liveQueues      = map[*Queue]struct{}{}
+	liveQueuesMutex sync.Mutex
+)
+
+func trackQueue(q *Queue) {
+	liveQueuesMutex.Lock()
+	defer liveQueuesMutex.Unlock()
+	liveQueues[q] = struct{}{}
+}
+
+func untrackQueue(q *Queue) {
+	liveQueuesMutex.Lock()
+	defer liveQueuesMutex.Unlock()
+	delete(liveQueues, q)
+}
+
+// DrainQueues drains every live queue concurrently and returns the operations they abandoned
+func DrainQueues(ctx context.Context) []Operation {
+	liveQueuesMutex.Lock()
+	queues := make([]*Queue, 0, len(liveQueues))
+	for q := range liveQueues {
+		queues = append(queues, q)
+	}
+	liveQueuesMutex.Unlock()
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		abandoned []Operation
+	)
+	for _, q := range queues {
+		wg.Add(1)
+		go func(q *Queue) {
+			defer wg.Done()
+			ops := q.Drain(ctx)
+			mutex.Lock()
+			abandoned = append(abandoned, ops...)
+			mutex.Unlock()
+		}(q)
+	}
+	wg.Wait()
+	return abandoned
+}
+
+// Drain stops the queue from accepting operations, cancels the pending ones and waits for the
+// running ones until ctx is done. It returns the operations that did not run or finish, cancelled
+// with their data kept so that they can be resubmitted.
+func (q *Queue) Drain(ctx context.Context) []Operation {
+	// Save the final state, the operator exits before the save loop runs again
+	defer q.saveState()
+
+	q.mutex.Lock()
+	q.draining = true
+	abandoned := q.cancelPendingLocked()
+	q.mutex.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		q.mutex.Lock()
+		// Operations failing while draining are not retried
+		abandoned = append(abandoned, q.cancelPendingLocked()...)
+		running := 0
+		for _, op := range q.operations {
+			if op.Status == StatusRunning {
+				running++
+			}
+		}
+		if running == 0 {
+			q.mutex.Unlock()
+			return abandoned
+		}
+		q.mutex.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			q.mutex.Lock()
+			defer q.mutex.Unlock()
+			for _, op := range q.operations {
+				if op.Status == StatusRunning {
+					abandoned = append(abandoned, q.abandonLocked(op, "Abandoned at shutdown while running"))
+				}
+			}
+			return abandoned
+		}
+	}
+}
+
+// cancelPendingLocked cancels the operations that have not started, the queue mutex must be held
+func (q *Queue) cancelPendingLocked() []Operation {
+	var cancelled []Operation
+	for _, op := range q.operations {
+		if op.Status == StatusPending {
+			cancelled = append(cancelled, q.abandonLocked(op, "Cancelled at shutdown before it started"))
+		}
+	}
+	return cancelled
+}
+
+// abandonLocked cancels an operation and returns a copy of it, the queue mutex must be held
+func (q *Queue) abandonLocked(op *Operation, message string) Operation {
+	op.Status = StatusCancelled
+	op.Message = message
+	endTime := time.Now()
+	op.EndTime = &endTime
+	q.notifyLocked(op)
+	return snapshot(op)
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		finishRunning bool
+		wantAbandoned int
+	}{
+		{name: "running operation finishes", finishRunning: true, wantAbandoned: 1},
+		{name: "running operation outlives the deadline", wantAbandoned: 2},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			queue := &Queue{
+				operations: make(map[string]*Operation),
+				workChan:   make(chan string, 2),
+				stopChan:   make(chan bool),
+				processors: make(map[string]OperationProcessor),
+			}
+			processor := &stepProcessor{queue: queue, release: make(chan struct{})}
+			queue.RegisterProcessor("test", processor)
+			running := queue.AddOperation("test", "cluster", "tester", map[string]interface{}{"chart": "nginx"}, nil)
+
+			// One worker takes the first operation, the second stays pending behind it
+			go queue.worker()
+			defer queue.Stop()
+			for op, _ := queue.GetOperation(running.ID); op.Progress != 50; op, _ = queue.GetOperation(running.ID) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			pending := queue.AddOperation("test", "cluster", "tester", nil, nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			if tt.finishRunning {
+				time.AfterFunc(50*time.Millisecond, func() { close(processor.release) })
+			} else {
+				defer close(processor.release)
+			}
+
+			abandoned := queue.Drain(ctx)
+			if len(abandoned) != tt.wantAbandoned {
+				t.Fatalf("Drain() abandoned %d operations, want %d: %+v", len(abandoned), tt.wantAbandoned, abandoned)
+			}
+			for _, op := range abandoned {
+				if op.Status != StatusCancelled {
+					t.Errorf("abandoned operation %s is %s, want cancelled", op.ID, op.Status)
+				}
+				if op.ID == running.ID && op.Data["chart"] != "nginx" {
+					t.Errorf("abandoned operation lost its data: %v", op.Data)
+				}
+			}
+			if op, _ := queue.GetOperation(pending.ID); op.Status != StatusCancelled {
+				t.Errorf("pending operation is %s, want cancelled", op.Status)
+			}
+
+			if op := queue.AddOperation("test", "cluster", "tester", nil, nil); op.Status != StatusFailed {
+				t.Errorf("operation added while draining is %s, want failed", op.Status)
+			}
+		})
+	}
+}
@@ -59,6 +59,8 @@ func GetObjectMetaData(obj interface{}) (objectMeta meta_v1.ObjectMeta) {
 		objectMeta = object.ObjectMeta
 	case *events_v1.Event:
 		objectMeta = object.ObjectMeta
+	case *meta_v1.PartialObjectMetadata:
+		objectMeta = object.ObjectMeta
 	}
 	return objectMeta
 }
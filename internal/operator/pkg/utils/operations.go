@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// saveInterval is how often changed operations are written to the state file
+const saveInterval = time.Second
+
+var (
+	// ErrOperationNotFound is returned for unknown operation IDs
+	ErrOperationNotFound = errors.New("operation not found")
+	// ErrOperationFinished is returned when cancelling an operation that already finished
+	ErrOperationFinished = errors.New("operation already finished")
+	// ErrNotCancellable is returned when cancelling a running operation whose processor can't stop it
+	ErrNotCancellable = errors.New("running operation can't be cancelled")
+	// ErrNotRetryable is returned when retrying an operation that didn't fail or was not cancelled
+	ErrNotRetryable = errors.New("operation can't be retried")
+)
+
+// CancellableProcessor is implemented by processors that can stop their running operations.
+// Pending operations are cancelled by the queue whatever their processor.
+type CancellableProcessor interface {
+	// CancelRunning asks a running operation to stop and reports whether it will. The processor
+	// finishes the operation as cancelled once it stopped.
+	CancelRunning(id string) bool
+}
+
+// Cancel cancels a pending operation, or asks the processor of a running one to stop it
+func (q *Queue) Cancel(id string) (*Operation, error) {
+	if q.CancelOperation(id) {
+		op, _ := q.GetOperation(id)
+		return op, nil
+	}
+
+	q.mutex.RLock()
+	op, exists := q.operations[id]
+	var status OperationStatus
+	var processor OperationProcessor
+	if exists {
+		status = op.Status
+		processor = q.processors[op.Type]
+	}
+	q.mutex.RUnlock()
+
+	switch {
+	case !exists:
+		return nil, ErrOperationNotFound
+	case isFinished(status):
+		return nil, ErrOperationFinished
+	}
+	cancellable, ok := processor.(CancellableProcessor)
+	if !ok || !cancellable.CancelRunning(id) {
+		return nil, ErrNotCancellable
+	}
+	q.UpdateOperationData(id, map[string]interface{}{"cancelRequested": true})
+	current, _ := q.GetOperation(id)
+	return current, nil
+}
+
+// RetryOperation queues a failed or cancelled operation again with its data, under the same ID
+func (q *Queue) RetryOperation(id string) (*Operation, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	op, exists := q.operations[id]
+	if !exists {
+		return nil, ErrOperationNotFound
+	}
+	if op.Status != StatusFailed && op.Status != StatusCancelled {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotRetryable, op.Status)
+	}
+	if _, ok := q.processors[op.Type]; !ok {
+		return nil, fmt.Errorf("%w: no processor for operation type %s", ErrNotRetryable, op.Type)
+	}
+	if q.draining {
+		return nil, fmt.Errorf("%w: operator is shutting down", ErrNotRetryable)
+	}
+
+	select {
+	case q.workChan <- op.ID:
+	default:
+		return nil, fmt.Errorf("%w: queue is full", ErrNotRetryable)
+	}
+	op.Status = StatusPending
+	op.Progress = 0
+	op.Message = "Retrying operation"
+	op.Error = ""
+	op.RetryCount = 0
+	op.StartTime = time.Now()
+	op.EndTime = nil
+	delete(op.Data, "cancelRequested")
+	q.notifyLocked(op)
+
+	retried := snapshot(op)
+	return &retried, nil
+}
+
+// restoreState reads the operations saved by the previous run. Operations still pending or
+// running then were stopped with the operator, they are cancelled and can be retried.
+func (q *Queue) restoreState() error {
+	var ops []Operation
+	if err := ReadJSONFile(q.statePath, &ops); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i := range ops {
+		op := ops[i]
+		if !isFinished(op.Status) {
+			op.Status = StatusCancelled
+			op.Message = "Interrupted by an operator restart"
+			endTime := time.Now()
+			op.EndTime = &endTime
+		}
+		q.operations[op.ID] = &op
+	}
+	return nil
+}
+
+// saveLoop writes the changed operations to the state file until the queue stops
+func (q *Queue) saveLoop() {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.saveState()
+		case <-q.stopChan:
+			q.saveState()
+			return
+		}
+	}
+}
+
+// saveState writes the operations to the state file when they changed since the last write
+func (q *Queue) saveState() {
+	if q.statePath == "" {
+		return
+	}
+	// Serializes writes between the save loop and draining
+	q.saveMutex.Lock()
+	defer q.saveMutex.Unlock()
+
+	q.mutex.Lock()
+	if !q.dirty {
+		q.mutex.Unlock()
+		return
+	}
+	ops := make([]Operation, 0, len(q.operations))
+	for _, op := range q.operations {
+		ops = append(ops, snapshot(op))
+	}
+	q.dirty = false
+	q.mutex.Unlock()
+
+	if err := WriteJSONFile(q.statePath, ops); err != nil {
+		q.mutex.Lock()
+		q.dirty = true
+		q.mutex.Unlock()
+	}
+}
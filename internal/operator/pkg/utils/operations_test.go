@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type cancelProcessor struct {
+	stepProcessor
+	cancelled bool
+}
+
+func (p *cancelProcessor) CancelRunning(id string) bool {
+	p.cancelled = true
+	return true
+}
+
+func newTestQueue(statePath string) *Queue {
+	return &Queue{
+		operations: make(map[string]*Operation),
+		workChan:   make(chan string, 2),
+		stopChan:   make(chan bool),
+		processors: make(map[string]OperationProcessor),
+		statePath:  statePath,
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		status    OperationStatus
+		processor OperationProcessor
+		wantErr   error
+	}{
+		{name: "pending", status: StatusPending, processor: &stepProcessor{}},
+		{name: "running with cancellable processor", status: StatusRunning, processor: &cancelProcessor{}},
+		{name: "running", status: StatusRunning, processor: &stepProcessor{}, wantErr: ErrNotCancellable},
+		{name: "finished", status: StatusCompleted, processor: &stepProcessor{}, wantErr: ErrOperationFinished},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			queue := newTestQueue("")
+			queue.RegisterProcessor("test", tt.processor)
+			queue.operations["op"] = &Operation{ID: "op", Type: "test", Status: tt.status}
+
+			_, err := queue.Cancel("op")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Cancel() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := queue.Cancel("missing"); !errors.Is(err, ErrOperationNotFound) {
+				t.Errorf("Cancel() of an unknown operation error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryOperation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  OperationStatus
+		wantErr error
+	}{
+		{name: "failed", status: StatusFailed},
+		{name: "cancelled", status: StatusCancelled},
+		{name: "completed", status: StatusCompleted, wantErr: ErrNotRetryable},
+		{name: "running", status: StatusRunning, wantErr: ErrNotRetryable},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			queue := newTestQueue("")
+			queue.RegisterProcessor("test", &stepProcessor{})
+			endTime := time.Now()
+			queue.operations["op"] = &Operation{ID: "op", Type: "test", Status: tt.status, Error: "boom", RetryCount: 3, EndTime: &endTime}
+
+			op, err := queue.RetryOperation("op")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RetryOperation() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if op.Status != StatusPending || op.Error != "" || op.RetryCount != 0 || op.EndTime != nil {
+				t.Errorf("RetryOperation() = %+v, want a reset pending operation", op)
+			}
+			if queued := <-queue.workChan; queued != "op" {
+				t.Errorf("RetryOperation() queued %q", queued)
+			}
+		})
+	}
+}
+
+func TestStateRestore(t *testing.T) {
+	t.Parallel()
+
+	statePath := filepath.Join(t.TempDir(), "operations.json")
+	saved := newTestQueue(statePath)
+	for id, status := range map[string]OperationStatus{"done": StatusCompleted, "pending": StatusPending, "running": StatusRunning} {
+		saved.operations[id] = &Operation{ID: id, Type: "test", Status: status, Data: map[string]interface{}{"cluster": "prod"}}
+	}
+	saved.dirty = true
+	saved.saveState()
+
+	restored := newTestQueue(statePath)
+	if err := restored.restoreState(); err != nil {
+		t.Fatalf("restoreState() error = %v", err)
+	}
+	want := map[string]OperationStatus{"done": StatusCompleted, "pending": StatusCancelled, "running": StatusCancelled}
+	for id, status := range want {
+		op, ok := restored.GetOperation(id)
+		if !ok {
+			t.Fatalf("operation %s was not restored", id)
+		}
+		if op.Status != status || op.Data["cluster"] != "prod" {
+			t.Errorf("restored %s = %+v, want status %s", id, op, status)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package utils
+
+// watcher receives the progress of an operation. The channel holds the latest state only.
+type watcher struct {
+	updates chan Operation
+}
+
+// isFinished reports whether an operation reached a final status
+func isFinished(status OperationStatus) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusCancelled
+}
+
+// Watch returns a channel receiving the state of an operation now and after every change, and
+// a function to stop watching. The channel is closed once the operation is finished or watching
+// stops. A slow reader skips intermediate states but always receives the final one.
+func (q *Queue) Watch(id string) (<-chan Operation, func(), bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	op, exists := q.operations[id]
+	if !exists {
+		return nil, nil, false
+	}
+
+	w := &watcher{updates: make(chan Operation, 1)}
+	w.updates <- snapshot(op)
+	if isFinished(op.Status) {
+		close(w.updates)
+		return w.updates, func() {}, true
+	}
+
+	if q.watchers == nil {
+		q.watchers = make(map[string][]*watcher)
+	}
+	q.watchers[id] = append(q.watchers[id], w)
+
+	stop := func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		q.removeWatcherLocked(id, w)
+	}
+	return w.updates, stop, true
+}
+
+// notifyLocked sends the state of an operation to its watchers and marks it to be saved, the
+// queue mutex must be held
+func (q *Queue) notifyLocked(op *Operation) {
+	q.dirty = true
+	watchers := q.watchers[op.ID]
+	if len(watchers) == 0 {
+		return
+	}
+
+	state := snapshot(op)
+	for _, w := range watchers {
+		// Replace a state the watcher has not read yet, sends happen under the mutex only
+		select {
+		case <-w.updates:
+		default:
+		}
+		w.updates <- state
+	}
+
+	if isFinished(op.Status) {
+		for _, w := range watchers {
+			close(w.updates)
+		}
+		delete(q.watchers, op.ID)
+	}
+}
+
+// removeWatcherLocked stops a watcher, the queue mutex must be held
+func (q *Queue) removeWatcherLocked(id string, w *watcher) {
+	watchers := q.watchers[id]
+	for i, existing := range watchers {
+		if existing == w {
+			close(w.updates)
+			q.watchers[id] = append(watchers[:i:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(q.watchers[id]) == 0 {
+		delete(q.watchers, id)
+	}
+}
+
+// dropWatchersLocked closes the watchers of a removed operation, the queue mutex must be held
+func (q *Queue) dropWatchersLocked(id string) {
+	for _, w := range q.watchers[id] {
+		close(w.updates)
+	}
+	delete(q.watchers, id)
+}
+
+// snapshot copies an operation so that it can be read without the queue mutex
+func snapshot(op *Operation) Operation {
+	opCopy := *op
+	if op.Data != nil {
+		opCopy.Data = make(map[string]interface{}, len(op.Data))
+		for k, v := range op.Data {
+			opCopy.Data[k] = v
+		}
+	}
+	if op.Tags != nil {
+		opCopy.Tags = make([]string, len(op.Tags))
+		copy(opCopy.Tags, op.Tags)
+	}
+	return opCopy
+}
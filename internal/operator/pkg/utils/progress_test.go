@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type stepProcessor struct {
+	queue   *Queue
+	release chan struct{}
+	err     error
+}
+
+func (p *stepProcessor) ProcessOperation(op *Operation) error {
+	p.queue.UpdateOperation(op.ID, StatusRunning, 50, "halfway", nil)
+	<-p.release
+	return p.err
+}
+
+func (p *stepProcessor) CanProcess(operationType string) bool {
+	return true
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus OperationStatus
+	}{
+		{name: "completed", wantStatus: StatusCompleted},
+		{name: "failed", err: NonRetryable(errors.New("boom")), wantStatus: StatusFailed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			queue := &Queue{
+				operations: make(map[string]*Operation),
+				workChan:   make(chan string, 1),
+				stopChan:   make(chan bool),
+				processors: make(map[string]OperationProcessor),
+			}
+			processor := &stepProcessor{queue: queue, release: make(chan struct{}), err: tt.err}
+			queue.RegisterProcessor("test", processor)
+			op := queue.AddOperation("test", "cluster", "tester", nil, nil)
+
+			updates, stop, ok := queue.Watch(op.ID)
+			if !ok {
+				t.Fatal("Watch() did not find the operation")
+			}
+			defer stop()
+			if first := <-updates; first.Status != StatusPending {
+				t.Errorf("Watch() first state = %s, want pending", first.Status)
+			}
+
+			go queue.worker()
+			defer queue.Stop()
+
+			deadline := time.After(5 * time.Second)
+			var last Operation
+			for {
+				select {
+				case state, open := <-updates:
+					if !open {
+						if last.Status != tt.wantStatus {
+							t.Errorf("Watch() final state = %s, want %s", last.Status, tt.wantStatus)
+						}
+						return
+					}
+					last = state
+					if state.Progress == 50 {
+						close(processor.release)
+					}
+				case <-deadline:
+					t.Fatalf("Watch() did not finish, last state = %+v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchFinishedOperation(t *testing.T) {
+	t.Parallel()
+
+	queue := &Queue{operations: map[string]*Operation{
+		"done": {ID: "done", Status: StatusCompleted, Progress: 100},
+	}}
+
+	updates, _, ok := queue.Watch("done")
+	if !ok {
+		t.Fatal("Watch() did not find the operation")
+	}
+	if state := <-updates; state.Status != StatusCompleted {
+		t.Errorf("Watch() state = %s, want completed", state.Status)
+	}
+	if _, open := <-updates; open {
+		t.Error("Watch() channel is still open for a finished operation")
+	}
+
+	if _, _, ok := queue.Watch("missing"); ok {
+		t.Error("Watch() found a missing operation")
+	}
+}
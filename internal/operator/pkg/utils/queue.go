@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/agentkube/operator/pkg/logger"
 	"github.com/google/uuid"
 )
 
@@ -36,6 +38,32 @@ type Operation struct {
 	Tags        []string               `json:"tags,omitempty"`        // For categorization and filtering
 }
 
+// NonRetryableError marks an operation failure that must not be retried,
+// e.g. when the processor has already rolled back its own changes
+type NonRetryableError struct {
+	Err error
+}
+
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// NonRetryable wraps err so the queue fails the operation without retrying
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NonRetryableError{Err: err}
+}
+
+// ErrDetached is returned by processors that continue an operation outside the worker, e.g. to
+// wait on a cluster without holding a worker. The processor then completes or fails it itself.
+var ErrDetached = errors.New("operation continues outside the queue worker")
+
 // OperationProcessor defines the interface for processing operations
 type OperationProcessor interface {
 	ProcessOperation(op *Operation) error
@@ -50,12 +78,23 @@ type Queue struct {
 	workChan   chan string
 	stopChan   chan bool
 	processors map[string]OperationProcessor // Map of operation type to processor
+	// watchers receive the progress of operations, by operation ID
+	watchers   map[string][]*watcher
+	// draining rejects new operations while the queue is drained at shutdown
+	draining   bool
+	// statePath persists the operations across restarts when set, dirty marks unsaved changes
+	statePath  string
+	dirty      bool
+	saveMutex  sync.Mutex
+	retention  time.Duration
 }
 
 // QueueConfig holds configuration for the queue
 type QueueConfig struct {
 	Workers    int
 	MaxRetries int
+	StatePath  string        // File the operations are saved to, none by default
+	Retention  time.Duration // How long finished operations are kept, 1 hour by default
 }
 
 // NewQueue creates a new operation queue
@@ -66,6 +105,9 @@ func NewQueue(config QueueConfig) *Queue {
 	if config.MaxRetries <= 0 {
 		config.MaxRetries = 3 // Default to 3 retries
 	}
+	if config.Retention <= 0 {
+		config.Retention = time.Hour
+	}
 
 	q := &Queue{
 		operations: make(map[string]*Operation),
@@ -73,6 +115,16 @@ func NewQueue(config QueueConfig) *Queue {
 		workChan:   make(chan string, config.Workers*2), // Buffer for better throughput
 		stopChan:   make(chan bool),
 		processors: make(map[string]OperationProcessor),
+		statePath:  config.StatePath,
+		retention:  config.Retention,
+	}
+
+	// Restore the operations of the previous run before accepting new ones
+	if q.statePath != "" {
+		if err := q.restoreState(); err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"path": q.statePath}, err, "Failed to restore operations")
+		}
+		go q.saveLoop()
 	}
 
 	// Start worker goroutines
@@ -83,6 +135,7 @@ func NewQueue(config QueueConfig) *Queue {
 	// Start cleanup goroutine
 	go q.cleanup()
 
+	trackQueue(q)
 	return q
 }
 
@@ -113,6 +166,15 @@ func (q *Queue) AddOperation(operationType, target, createdBy string, data map[s
 	}
 
 	q.operations[op.ID] = op
+	q.dirty = true
+
+	if q.draining {
+		op.Status = StatusFailed
+		op.Error = "Operator is shutting down, operation was not queued"
+		endTime := time.Now()
+		op.EndTime = &endTime
+		return op
+	}
 
 	// Queue for processing
 	select {
@@ -260,6 +322,7 @@ func (q *Queue) UpdateOperation(id string, status OperationStatus, progress int,
 		endTime := time.Now()
 		op.EndTime = &endTime
 	}
+	q.notifyLocked(op)
 }
 
 // UpdateOperationData updates the data field of an operation
@@ -279,6 +342,7 @@ func (q *Queue) UpdateOperationData(id string, data map[string]interface{}) {
 	for k, v := range data {
 		op.Data[k] = v
 	}
+	q.notifyLocked(op)
 }
 
 // CancelOperation cancels a pending or running operation
@@ -296,6 +360,7 @@ func (q *Queue) CancelOperation(id string) bool {
 		op.Message = "Operation cancelled by user"
 		endTime := time.Now()
 		op.EndTime = &endTime
+		q.notifyLocked(op)
 		return true
 	}
 
@@ -309,6 +374,8 @@ func (q *Queue) RemoveOperation(id string) {
 	defer q.mutex.Unlock()
 
 	delete(q.operations, id)
+	q.dirty = true
+	q.dropWatchersLocked(id)
 }
 
 // worker processes operations from the work channel
@@ -332,8 +399,8 @@ func (q *Queue) processOperation(opID string) {
 		return
 	}
 
-	// Check if operation was cancelled
-	if op.Status == StatusCancelled {
+	// Skip operations cancelled, or already picked up after a retry, while queued
+	if op.Status != StatusPending {
 		q.mutex.Unlock()
 		return
 	}
@@ -342,6 +409,7 @@ func (q *Queue) processOperation(opID string) {
 	op.Status = StatusRunning
 	op.Progress = 10
 	operationType := op.Type
+	q.notifyLocked(op)
 	q.mutex.Unlock()
 
 	// Find processor for this operation type
@@ -356,6 +424,9 @@ func (q *Queue) processOperation(opID string) {
 
 	// Process the operation
 	err := processor.ProcessOperation(op)
+	if errors.Is(err, ErrDetached) {
+		return
+	}
 	if err != nil {
 		q.handleOperationError(op, err)
 	} else {
@@ -371,11 +442,13 @@ func (q *Queue) handleOperationError(op *Operation, err error) {
 	op.RetryCount++
 	op.Error = err.Error()
 
-	if op.RetryCount < op.MaxRetries {
+	var nonRetryable *NonRetryableError
+	if op.RetryCount < op.MaxRetries && !errors.As(err, &nonRetryable) {
 		// Retry the operation
 		op.Status = StatusPending
 		op.Progress = 0
 		op.Message = "Retrying operation"
+		q.notifyLocked(op)
 
 		// Re-queue with exponential backoff
 		go func() {
@@ -391,12 +464,16 @@ func (q *Queue) handleOperationError(op *Operation, err error) {
 			}
 		}()
 	} else {
-		// Max retries reached, mark as failed
+		// Max retries reached or error is not retryable, mark as failed
 		op.Status = StatusFailed
 		op.Progress = 0
 		op.Message = "Max retries exceeded"
+		if nonRetryable != nil {
+			op.Message = "Operation failed"
+		}
 		endTime := time.Now()
 		op.EndTime = &endTime
+		q.notifyLocked(op)
 	}
 }
 
@@ -415,22 +492,24 @@ func (q *Queue) cleanup() {
 	}
 }
 
-// cleanupOldOperations removes operations older than 1 hour that are completed or failed
+// cleanupOldOperations removes finished operations older than the retention
 func (q *Queue) cleanupOldOperations() {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	cutoff := time.Now().Add(-1 * time.Hour)
+	cutoff := time.Now().Add(-q.retention)
 	for id, op := range q.operations {
 		if (op.Status == StatusCompleted || op.Status == StatusFailed || op.Status == StatusCancelled) &&
 			op.StartTime.Before(cutoff) {
 			delete(q.operations, id)
+			q.dirty = true
 		}
 	}
 }
 
 // Stop stops the queue and all workers
 func (q *Queue) Stop() {
+	untrackQueue(q)
 	close(q.stopChan)
 	close(q.workChan)
 }
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ConfigDir returns the agentkube config directory (~/.agentkube, or $CONFIG when set), creating it if needed
+func ConfigDir() string {
+	if configDir := os.Getenv("CONFIG"); configDir != "" {
+		return configDir
+	}
+
+	var home string
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("USERPROFILE")
+	} else {
+		home = os.Getenv("HOME")
+	}
+
+	agentKubeDir := filepath.Join(home, ".agentkube")
+	if _, err := os.Stat(agentKubeDir); os.IsNotExist(err) {
+		os.MkdirAll(agentKubeDir, 0755)
+	}
+	return agentKubeDir
+}
+
+// ReadJSONFile decodes the JSON file at path into v. A missing or empty file leaves v untouched.
+func ReadJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteJSONFile encodes v as indented JSON and atomically replaces the file at path
+func WriteJSONFile(path string, v interface{}) error {
+	return WriteJSONFileMode(path, v, 0644)
+}
+
+// WriteJSONFileMode is WriteJSONFile with explicit file permissions, e.g. 0600 for files holding credentials
+func WriteJSONFileMode(path string, v interface{}, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
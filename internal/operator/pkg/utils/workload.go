@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ReplicaSetOwners maps namespace/replicaset to the deployment that owns it, for all namespaces when namespace is empty
+func ReplicaSetOwners(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]string, error) {
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %v", err)
+	}
+
+	owners := map[string]string{}
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if owner := metav1.GetControllerOf(rs); owner != nil && owner.Kind == "Deployment" {
+			owners[rs.Namespace+"/"+rs.Name] = owner.Name
+		}
+	}
+	return owners, nil
+}
+
+// WorkloadOf resolves the kind and name of the top-level controller of a pod, given the
+// replicaset owners from ReplicaSetOwners. Pods without a controller are their own workload.
+func WorkloadOf(pod *corev1.Pod, replicaSetOwners map[string]string) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod", pod.Name
+	}
+	if owner.Kind == "ReplicaSet" {
+		if deployment, ok := replicaSetOwners[pod.Namespace+"/"+owner.Name]; ok {
+			return "Deployment", deployment
+		}
+	}
+	return owner.Kind, owner.Name
+}
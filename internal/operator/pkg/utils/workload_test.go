@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestReplicaSetOwners(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "api-7d9f", Namespace: "shop", OwnerReferences: controllerRef("Deployment", "api")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5c4b", Namespace: "web", OwnerReferences: controllerRef("Deployment", "web")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "shop"}},
+	)
+
+	tests := []struct {
+		name      string
+		namespace string
+		want      map[string]string
+	}{
+		{"all namespaces", "", map[string]string{"shop/api-7d9f": "api", "web/web-5c4b": "web"}},
+		{"single namespace", "shop", map[string]string{"shop/api-7d9f": "api"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ReplicaSetOwners(context.Background(), client, tt.namespace)
+			if err != nil {
+				t.Fatalf("ReplicaSetOwners() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReplicaSetOwners() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkloadOf(t *testing.T) {
+	t.Parallel()
+
+	owners := map[string]string{"shop/api-7d9f": "api"}
+	tests := []struct {
+		name     string
+		pod      corev1.Pod
+		wantKind string
+		wantName string
+	}{
+		{"bare pod", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "shop"}}, "Pod", "debug"},
+		{"deployment", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-7d9f-x", Namespace: "shop", OwnerReferences: controllerRef("ReplicaSet", "api-7d9f")}}, "Deployment", "api"},
+		{"orphaned replicaset", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "old-x", Namespace: "shop", OwnerReferences: controllerRef("ReplicaSet", "old")}}, "ReplicaSet", "old"},
+		{"replicaset of another namespace", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-7d9f-x", Namespace: "web", OwnerReferences: controllerRef("ReplicaSet", "api-7d9f")}}, "ReplicaSet", "api-7d9f"},
+		{"statefulset", corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "shop", OwnerReferences: controllerRef("StatefulSet", "db")}}, "StatefulSet", "db"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kind, name := WorkloadOf(&tt.pod, owners)
+			if kind != tt.wantKind || name != tt.wantName {
+				t.Errorf("WorkloadOf() = %s %s, want %s %s", kind, name, tt.wantKind, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package vul
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/event"
+)
+
+const (
+	// defaultTopCVEs caps the vulnerability IDs of an alert when the configuration sets none
+	defaultTopCVEs = 5
+	// maxAlertWorkloads caps the workloads listed in an alert, the rest are counted
+	maxAlertWorkloads = 10
+	// alertTimeout bounds finding the workloads running a vulnerable image
+	alertTimeout = 30 * time.Second
+)
+
+// severityRanks orders the severities alerts are raised for, negligible and unknown ones never alert
+var severityRanks = map[string]int{"Low": 1, "Medium": 2, "High": 3, "Critical": 4}
+
+// Alerts notify through the dispatchers of the watcher configuration when a scan finds
+// vulnerabilities at or above a severity
+type Alerts struct {
+	// Severity is the lowest severity alerted on: Critical, High, Medium or Low. Critical when empty.
+	Severity string `json:"severity,omitempty"`
+	// TopCVEs caps the vulnerability IDs listed in an alert, the most severe first
+	TopCVEs int `json:"topCves,omitempty"`
+}
+
+// WorkloadResolver returns the workloads running an image, e.g. cluster/namespace/Deployment/name
+type WorkloadResolver func(ctx context.Context, image string) []string
+
+// finding is what an alert reports of a scan
+type finding struct {
+	// counts holds the vulnerabilities at or above the threshold by severity
+	counts map[string]int
+	// highest is the highest severity found
+	highest string
+	cves    []string
+}
+
+// SetWorkloadResolver sets how alerts find the workloads running a vulnerable image
+func (s *imageScanner) SetWorkloadResolver(resolve WorkloadResolver) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.workloads = resolve
+}
+
+// alert notifies when a completed scan found vulnerabilities at or above the alert severity
+func (s *imageScanner) alert(img string, sc *Scan) {
+	if s.config.Alerts == nil {
+		return
+	}
+	s.mx.RLock()
+	found, ok := findAlert(sc.Table.Rows, *s.config.Alerts)
+	resolve := s.workloads
+	s.mx.RUnlock()
+	if !ok {
+		return
+	}
+
+	// The context of the scan ends with the enqueueing, resolving gets its own
+	var workloads []string
+	if resolve != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		workloads = resolve(ctx, img)
+		cancel()
+	}
+
+	s.notifierOnce.Do(func() {
+		s.notifier = client.NewNotifier("image-scans")
+	})
+	go s.notifier.Handle(alertEvent(img, found, workloads))
+}
+
+// findAlert returns the vulnerabilities of the rows at or above the alert severity, false when
+// there are none
+func findAlert(rows []row, alerts Alerts) (finding, bool) {
+	threshold, ok := severityRanks[alerts.Severity]
+	if !ok {
+		threshold = severityRanks["Critical"]
+	}
+	topCVEs := alerts.TopCVEs
+	if topCVEs <= 0 {
+		topCVEs = defaultTopCVEs
+	}
+
+	found := finding{counts: map[string]int{}}
+	var alerting []row
+	for _, r := range rows {
+		rank := severityRanks[r.Severity()]
+		if rank == 0 || rank < threshold {
+			continue
+		}
+		found.counts[r.Severity()]++
+		if rank > severityRanks[found.highest] {
+			found.highest = r.Severity()
+		}
+		alerting = append(alerting, r)
+	}
+	if len(alerting) == 0 {
+		return finding{}, false
+	}
+
+	sort.SliceStable(alerting, func(a, b int) bool {
+		x, y := severityRanks[alerting[a].Severity()], severityRanks[alerting[b].Severity()]
+		if x != y {
+			return x > y
+		}
+		return alerting[a].Vulnerability() < alerting[b].Vulnerability()
+	})
+	seen := map[string]bool{}
+	for _, r := range alerting {
+		if len(found.cves) == topCVEs {
+			break
+		}
+		if !seen[r.Vulnerability()] {
+			seen[r.Vulnerability()] = true
+			found.cves = append(found.cves, r.Vulnerability())
+		}
+	}
+	return found, true
+}
+
+// alertEvent builds the event dispatched for a vulnerable image
+func alertEvent(img string, found finding, workloads []string) event.Event {
+	var counts []string
+	for _, severity := range []string{"Critical", "High", "Medium", "Low"} {
+		if n := found.counts[severity]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, severity))
+		}
+	}
+	reason := fmt.Sprintf("%s vulnerabilities, top %s", strings.Join(counts, ", "), strings.Join(found.cves, ", "))
+
+	switch {
+	case len(workloads) == 0:
+		reason += "; no running workload found"
+	case len(workloads) > maxAlertWorkloads:
+		reason += fmt.Sprintf("; used by %s and %d more", strings.Join(workloads[:maxAlertWorkloads], ", "), len(workloads)-maxAlertWorkloads)
+	default:
+		reason += "; used by " + strings.Join(workloads, ", ")
+	}
+
+	status := "Warning"
+	if found.highest == "Critical" {
+		status = "Danger"
+	}
+	return event.Event{
+		Kind:   "vulnerability",
+		Name:   img,
+		Reason: reason,
+		Status: status,
+	}
+}
@@ -0,0 +1,68 @@
+package vul
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindAlert(t *testing.T) {
+	t.Parallel()
+
+	rows := []row{
+		newRow("openssl", "3.0.1", "3.0.7", "deb", "CVE-2022-3602", "High"),
+		newRow("openssl", "3.0.1", "3.0.7", "deb", "CVE-2022-3786", "Critical"),
+		newRow("zlib", "1.2.11", "1.2.12", "deb", "CVE-2018-25032", "Critical"),
+		newRow("curl", "7.80", "7.81", "deb", "CVE-2021-22945", "Medium"),
+		newRow("libc", "2.31", naValue, "deb", "CVE-2019-1010022", "Negligible"),
+	}
+
+	tests := []struct {
+		name       string
+		alerts     Alerts
+		wantOK     bool
+		wantCounts map[string]int
+		wantCVEs   []string
+	}{
+		{"critical by default", Alerts{}, true, map[string]int{"Critical": 2}, []string{"CVE-2018-25032", "CVE-2022-3786"}},
+		{"high and above", Alerts{Severity: "High"}, true, map[string]int{"Critical": 2, "High": 1}, []string{"CVE-2018-25032", "CVE-2022-3786", "CVE-2022-3602"}},
+		{"capped", Alerts{Severity: "Low", TopCVEs: 1}, true, map[string]int{"Critical": 2, "High": 1, "Medium": 1}, []string{"CVE-2018-25032"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			found, ok := findAlert(rows, tt.alerts)
+			if ok != tt.wantOK || !reflect.DeepEqual(found.counts, tt.wantCounts) || !reflect.DeepEqual(found.cves, tt.wantCVEs) {
+				t.Errorf("findAlert() = %v, %v, %v, want %v, %v, %v", found.counts, found.cves, ok, tt.wantCounts, tt.wantCVEs, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := findAlert(rows[3:], Alerts{Severity: "High"}); ok {
+		t.Error("findAlert() alerted on vulnerabilities below the severity")
+	}
+}
+
+func TestAlertEvent(t *testing.T) {
+	t.Parallel()
+
+	found := finding{counts: map[string]int{"Critical": 1, "High": 2}, highest: "Critical", cves: []string{"CVE-1", "CVE-2"}}
+	workloads := make([]string, maxAlertWorkloads+2)
+	for i := range workloads {
+		workloads[i] = "prod/shop/Deployment/web"
+	}
+
+	e := alertEvent("nginx:1.25", found, workloads)
+	if e.Kind != "vulnerability" || e.Name != "nginx:1.25" || e.Status != "Danger" {
+		t.Errorf("alertEvent() = %+v, want a Danger vulnerability event of nginx:1.25", e)
+	}
+	want := "1 Critical, 2 High vulnerabilities, top CVE-1, CVE-2; used by "
+	if len(e.Reason) < len(want) || e.Reason[:len(want)] != want {
+		t.Errorf("alertEvent() reason = %q, want prefix %q", e.Reason, want)
+	}
+	if suffix := "and 2 more"; e.Reason[len(e.Reason)-len(suffix):] != suffix {
+		t.Errorf("alertEvent() reason = %q, want suffix %q", e.Reason, suffix)
+	}
+}
@@ -0,0 +1,51 @@
+package vul
+
+import (
+	"github.com/anchore/stereoscope/pkg/image"
+
+	"github.com/agentkube/operator/pkg/imagepull"
+)
+
+// SetPullCredentials sets the credentials of the pull secrets of the pods running an image, used
+// for its registry after the configured ones. They are kept in memory only.
+func (s *imageScanner) SetPullCredentials(img string, credentials []imagepull.RegistryCredential) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(credentials) == 0 {
+		delete(s.pullCredentials, img)
+		return
+	}
+	s.pullCredentials[img] = credentials
+}
+
+// registryCredentials returns the credentials to pull an image with, the configured ones of its
+// registry first
+func (s *imageScanner) registryCredentials(img string) []image.RegistryCredentials {
+	authority, ok := imagepull.Authority(img)
+	if !ok {
+		return nil
+	}
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	var credentials []image.RegistryCredentials
+	for _, credential := range append(imagepull.CredentialsFor(s.config.Registries, img), s.pullCredentials[img]...) {
+		credentials = append(credentials, image.RegistryCredentials{
+			Authority: authority,
+			Username:  credential.Username,
+			Password:  credential.Password,
+			Token:     credential.Token,
+		})
+	}
+	return credentials
+}
+
+// redacted returns the configuration without the secret material of its registry credentials
+func (cfg ImageScans) redacted() ImageScans {
+	registries := make([]imagepull.RegistryCredential, 0, len(cfg.Registries))
+	for _, credential := range cfg.Registries {
+		registries = append(registries, credential.Redacted())
+	}
+	cfg.Registries = registries
+	return cfg
+}
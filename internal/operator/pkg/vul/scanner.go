@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -26,8 +27,13 @@ import (
 	"github.com/anchore/grype/grype/pkg"
 	"github.com/anchore/grype/grype/vex"
 	"github.com/anchore/grype/grype/vulnerability"
+	"github.com/anchore/stereoscope/pkg/image"
 	"github.com/anchore/syft/syft"
 	"github.com/anchore/syft/syft/cataloging"
+
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/imagepull"
+	"github.com/agentkube/operator/pkg/shutdown"
 )
 
 const (
@@ -43,6 +49,25 @@ var ImgScanner *imageScanner
 type ImageScans struct {
 	Enable     bool       `json:"enable"`
 	Exclusions Exclusions `json:"exclusions"`
+	// Schedule scans the images running in the clusters periodically, nil scans on demand only
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// Alerts notify of scans finding severe vulnerabilities, nil disables them
+	Alerts *Alerts `json:"alerts,omitempty"`
+	// Registries authenticate pulls from private registries. Their passwords and tokens are never
+	// returned by the API.
+	Registries []imagepull.RegistryCredential `json:"registries,omitempty"`
+	// PullSecrets reuses the imagePullSecrets of the pods running the images of cluster scans
+	PullSecrets bool `json:"pullSecrets,omitempty"`
+}
+
+// Schedule is a periodic scan of the images running in clusters
+type Schedule struct {
+	// Cron is a five field cron expression, or a descriptor like @daily, in local time
+	Cron string `json:"cron"`
+	// Clusters are the contexts scanned, every context when empty
+	Clusters []string `json:"clusters,omitempty"`
+	// Namespaces are the namespaces scanned, every namespace when empty
+	Namespaces []string `json:"namespaces,omitempty"`
 }
 
 type Exclusions struct {
@@ -60,6 +85,14 @@ type imageScanner struct {
 	initialized  bool
 	config       ImageScans
 	log          *slog.Logger
+	// running holds the images being scanned and when their scan started
+	running map[string]time.Time
+	// workloads finds the workloads running the images alerted on
+	workloads    WorkloadResolver
+	notifier     dispatchers.Dispatcher
+	notifierOnce sync.Once
+	// pullCredentials holds the pull secret credentials of the images by image
+	pullCredentials map[string][]imagepull.RegistryCredential
 }
 
 type Scans map[string]*Scan
@@ -68,6 +101,19 @@ type Scan struct {
 	ID    string
 	Table *table
 	Tally tally
+	// Packages is the SBOM of the image, nil until cataloging finished
+	Packages []Package
+	// Error is why the scan failed, its results are partial then
+	Error string
+}
+
+// Package is a single SBOM entry of a scanned image
+type Package struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Type     string   `json:"type"`
+	PURL     string   `json:"purl,omitempty"`
+	Licenses []string `json:"licenses,omitempty"`
 }
 
 type table struct {
@@ -94,9 +140,11 @@ type tally struct {
 // NewImageScanner creates a new image scanner like K9s
 func NewImageScanner(cfg ImageScans, l *slog.Logger) *imageScanner {
 	return &imageScanner{
-		scans:  make(Scans),
-		config: cfg,
-		log:    l.With("subsys", "vul"),
+		scans:           make(Scans),
+		running:         make(map[string]time.Time),
+		config:          cfg,
+		log:             l.With("subsys", "vul"),
+		pullCredentials: make(map[string][]imagepull.RegistryCredential),
 	}
 }
 
@@ -151,6 +199,40 @@ func (s *imageScanner) Stop() {
 	}
 }
 
+// Drain waits for the running scans until ctx is done and returns the images still scanning,
+// which are scanned again when next enqueued
+func (s *imageScanner) Drain(ctx context.Context) []shutdown.Abandoned {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mx.RLock()
+		running := len(s.running)
+		s.mx.RUnlock()
+		if running == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.mx.Lock()
+			defer s.mx.Unlock()
+			var abandoned []shutdown.Abandoned
+			for img, started := range s.running {
+				// The partial result would read as a clean image
+				delete(s.scans, img)
+				abandoned = append(abandoned, shutdown.Abandoned{
+					Component:   "image-scans",
+					ID:          img,
+					Description: fmt.Sprintf("scan of %s running for %s", img, time.Since(started).Round(time.Second)),
+					Checkpoint:  map[string]interface{}{"image": img},
+				})
+			}
+			return abandoned
+		}
+	}
+}
+
 // validateDBLoad validates database load like K9s
 func validateDBLoad(loadErr error, status *vulnerability.ProviderStatus) error {
 	if loadErr != nil {
@@ -172,12 +254,60 @@ func (s *imageScanner) GetScan(img string) (*Scan, bool) {
 	return sc, ok
 }
 
+// ScannedImages returns the images with scan results, including those still scanning, sorted
+func (s *imageScanner) ScannedImages() []string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	images := make([]string, 0, len(s.scans))
+	for img := range s.scans {
+		images = append(images, img)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// IsScanning reports whether the scan of an image is still running, its results are partial until then
+func (s *imageScanner) IsScanning(img string) bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	_, ok := s.running[img]
+	return ok
+}
+
 func (s *imageScanner) setScan(img string, sc *Scan) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 	s.scans[img] = sc
 }
 
+// GetPackages returns the SBOM of a scanned image, false while the image is not cataloged yet
+func (s *imageScanner) GetPackages(img string) ([]Package, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	sc, ok := s.scans[img]
+	if !ok || sc.Packages == nil {
+		return nil, false
+	}
+	return sc.Packages, true
+}
+
+func (s *imageScanner) setPackages(sc *Scan, packages []pkg.Package) {
+	sbom := make([]Package, 0, len(packages))
+	for _, p := range packages {
+		sbom = append(sbom, Package{
+			Name:     p.Name,
+			Version:  p.Version,
+			Type:     string(p.Type),
+			PURL:     p.PURL,
+			Licenses: p.Licenses,
+		})
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	sc.Packages = sbom
+}
+
 func (s *imageScanner) ShouldExclude(ns string, lbls map[string]string) bool {
 	return s.config.ShouldExclude(ns, lbls)
 }
@@ -186,6 +316,11 @@ func (s *imageScanner) IsEnabled() bool {
 	return s.config.Enable
 }
 
+// Config returns the configuration the scanner was created with, registry credentials redacted
+func (s *imageScanner) Config() ImageScans {
+	return s.config.redacted()
+}
+
 func (s *imageScanner) isInitialized() bool {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
@@ -213,6 +348,15 @@ func (s *imageScanner) scanWorker(ctx context.Context, img string) {
 	defer s.log.Debug("ScanWorker bailing out!")
 
 	s.log.Info("ScanWorker processing image", "image", img)
+	s.mx.Lock()
+	s.running[img] = time.Now()
+	s.mx.Unlock()
+	defer func() {
+		s.mx.Lock()
+		delete(s.running, img)
+		s.mx.Unlock()
+	}()
+
 	sc := newScan(img)
 	s.setScan(img, sc)
 	if err := s.scan(ctx, img, sc); err != nil {
@@ -220,8 +364,12 @@ func (s *imageScanner) scanWorker(ctx context.Context, img string) {
 			"image", img,
 			"error", err,
 		)
+		s.mx.Lock()
+		sc.Error = err.Error()
+		s.mx.Unlock()
 	} else {
 		s.log.Info("Scan completed successfully", "image", img)
+		s.alert(img, sc)
 	}
 }
 
@@ -237,7 +385,7 @@ func (s *imageScanner) scan(_ context.Context, img string, sc *Scan) error {
 	s.log.Info("Starting vulnerability scan", "image", img)
 
 	var errs error
-	packages, pkgContext, _, err := pkg.Provide(img, getProviderConfig(s.opts))
+	packages, pkgContext, _, err := pkg.Provide(img, getProviderConfig(s.opts, s.registryCredentials(img)))
 	if err != nil {
 		s.log.Error("Failed to catalog packages", "image", img, "error", err)
 		errs = errors.Join(errs, fmt.Errorf("failed to catalog %s: %w", img, err))
@@ -245,6 +393,7 @@ func (s *imageScanner) scan(_ context.Context, img string, sc *Scan) error {
 	}
 
 	s.log.Info("Cataloged packages", "image", img, "packages", len(packages))
+	s.setPackages(sc, packages)
 
 	vexProcessor, err := vex.NewProcessor(vex.ProcessorOptions{
 		Documents:   s.opts.VexDocuments,
@@ -281,8 +430,8 @@ func (s *imageScanner) scan(_ context.Context, img string, sc *Scan) error {
 	return errs
 }
 
-// getProviderConfig creates provider config like K9s
-func getProviderConfig(opts *options.Grype) pkg.ProviderConfig {
+// getProviderConfig creates provider config like K9s, pulling with the registry credentials
+func getProviderConfig(opts *options.Grype, credentials []image.RegistryCredentials) pkg.ProviderConfig {
 	// Create default SBOM configuration like K9s does
 	cfg := syft.DefaultCreateSBOMConfig()
 	cfg.Packages.JavaArchive.IncludeIndexedArchives = opts.Search.IncludeIndexedArchives
@@ -291,10 +440,13 @@ func getProviderConfig(opts *options.Grype) pkg.ProviderConfig {
 	// Handle packages with missing version information
 	cfg.Compliance.MissingVersion = cataloging.ComplianceActionDrop
 
+	registryOptions := opts.Registry.ToOptions()
+	registryOptions.Credentials = append(registryOptions.Credentials, credentials...)
+
 	return pkg.ProviderConfig{
 		SyftProviderConfig: pkg.SyftProviderConfig{
 			SBOMOptions:            cfg,
-			RegistryOptions:        opts.Registry.ToOptions(),
+			RegistryOptions:        registryOptions,
 			Platform:               opts.Platform,
 			Name:                   opts.Name,
 			DefaultImagePullSource: opts.DefaultImagePullSource,
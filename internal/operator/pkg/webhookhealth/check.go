@@ -0,0 +1,292 @@
+package webhookhealth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// probeTimeout bounds a single webhook probe, webhooks may not take longer than 30s anyway
+	probeTimeout = 30 * time.Second
+
+	// slowFraction of the webhook timeout marks a webhook as degraded, it is close to timing out
+	slowFraction = 0.8
+)
+
+// webhookConfig is the part of a webhook shared by mutating and validating webhooks
+type webhookConfig struct {
+	name           string
+	clientConfig   admissionregistrationv1.WebhookClientConfig
+	failurePolicy  *admissionregistrationv1.FailurePolicyType
+	timeoutSeconds *int32
+}
+
+// check inventories and probes the webhooks of a cluster
+func (m *Manager) check(ctx context.Context, clusterName string, settings Settings) (*Report, error) {
+	defer budget.Track(clusterName, "webhookhealth")()
+
+	kubeContext, err := m.kubeConfigStore.GetContext(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context %s: %v", clusterName, err)
+	}
+	clientset, err := kubeContext.ClientSetWithToken("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	admission := clientset.AdmissionregistrationV1()
+	mutating, err := admission.MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mutating webhook configurations: %v", err)
+	}
+	validating, err := admission.ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list validating webhook configurations: %v", err)
+	}
+
+	report := &Report{Cluster: clusterName, CheckedAt: time.Now(), Webhooks: []Webhook{}}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			config := webhookConfig{webhook.Name, webhook.ClientConfig, webhook.FailurePolicy, webhook.TimeoutSeconds}
+			report.Webhooks = append(report.Webhooks, probe(ctx, clientset, configuration.Name, "mutating", config))
+		}
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			config := webhookConfig{webhook.Name, webhook.ClientConfig, webhook.FailurePolicy, webhook.TimeoutSeconds}
+			report.Webhooks = append(report.Webhooks, probe(ctx, clientset, configuration.Name, "validating", config))
+		}
+	}
+
+	for i := range report.Webhooks {
+		evaluate(&report.Webhooks[i], settings.LatencyThresholdMs)
+		switch report.Webhooks[i].Status {
+		case StatusHealthy:
+			report.Healthy++
+		case StatusDegraded:
+			report.Degraded++
+		case StatusDown:
+			report.Down++
+		default:
+			report.Unknown++
+		}
+	}
+	// Critical webhooks first
+	sort.SliceStable(report.Webhooks, func(i, j int) bool {
+		return severityRank[report.Webhooks[i].Severity] > severityRank[report.Webhooks[j].Severity]
+	})
+	return report, nil
+}
+
+var severityRank = map[string]int{"": 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// probe collects the facts about a webhook: whether its backend exists and how fast it answers
+func probe(ctx context.Context, clientset *kubernetes.Clientset, configuration, webhookType string, config webhookConfig) Webhook {
+	webhook := Webhook{
+		Configuration: configuration,
+		Type:          webhookType,
+		Name:          config.name,
+		// The API server defaults are Fail and 10 seconds
+		FailurePolicy:  string(admissionregistrationv1.Fail),
+		TimeoutSeconds: 10,
+		Problems:       []string{},
+	}
+	if config.failurePolicy != nil {
+		webhook.FailurePolicy = string(*config.failurePolicy)
+	}
+	if config.timeoutSeconds != nil {
+		webhook.TimeoutSeconds = *config.timeoutSeconds
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if config.clientConfig.URL != nil {
+		webhook.URL = *config.clientConfig.URL
+		probeURL(ctx, &webhook, config.clientConfig.CABundle)
+		return webhook
+	}
+	if config.clientConfig.Service == nil {
+		webhook.ProbeError = "webhook has neither a service nor a URL"
+		return webhook
+	}
+
+	ref := config.clientConfig.Service
+	webhook.Service = &ServiceRef{Namespace: ref.Namespace, Name: ref.Name, Port: 443}
+	if ref.Port != nil {
+		webhook.Service.Port = *ref.Port
+	}
+	if ref.Path != nil {
+		webhook.Service.Path = *ref.Path
+	}
+	probeService(ctx, clientset, &webhook)
+	return webhook
+}
+
+// probeService checks the service and its ready endpoints, then calls the webhook through the API
+// server service proxy, the same path the API server takes to reach it
+func probeService(ctx context.Context, clientset *kubernetes.Clientset, webhook *Webhook) {
+	ref := webhook.Service
+	service, err := clientset.CoreV1().Services(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		webhook.ProbeError = fmt.Sprintf("failed to get service: %v", err)
+		webhook.inconclusive = !apierrors.IsNotFound(err)
+		return
+	}
+	webhook.ServiceExists = true
+
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		// ExternalName services have no endpoints, only the probe tells whether they work
+		webhook.ReadyEndpoints = -1
+	} else {
+		slices, err := clientset.DiscoveryV1().EndpointSlices(ref.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + ref.Name,
+		})
+		if err != nil {
+			webhook.ProbeError = fmt.Sprintf("failed to list endpoints: %v", err)
+			webhook.inconclusive = true
+			return
+		}
+		webhook.ReadyEndpoints = readyEndpoints(slices.Items)
+	}
+
+	start := time.Now()
+	_, err = clientset.CoreV1().Services(ref.Namespace).
+		ProxyGet("https", ref.Name, strconv.Itoa(int(ref.Port)), ref.Path, nil).
+		DoRaw(ctx)
+	webhook.LatencyMs = time.Since(start).Milliseconds()
+	if reached(err) {
+		webhook.Reachable = true
+		return
+	}
+	webhook.ProbeError = err.Error()
+}
+
+// reached tells whether a proxied probe got an answer from the webhook. Webhooks only handle POSTed
+// AdmissionReviews, any answer to the GET counts, while gateway errors come from the proxy itself.
+func reached(err error) bool {
+	if err == nil {
+		return true
+	}
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	switch status.Status().Code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return false
+	}
+	return true
+}
+
+// readyEndpoints counts the ready endpoints of a service
+func readyEndpoints(slices []discoveryv1.EndpointSlice) int {
+	ready := 0
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			// A nil condition means ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready
+}
+
+// probeURL calls a webhook configured with a URL, trusting its CA bundle. The webhook may only be
+// reachable from the API server network, an unreachable URL is a problem but not a certain outage.
+func probeURL(ctx context.Context, webhook *Webhook, caBundle []byte) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caBundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			webhook.ProbeError = "caBundle holds no valid certificate"
+			return
+		}
+		tlsConfig.RootCAs = pool
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webhook.URL, nil)
+	if err != nil {
+		webhook.ProbeError = err.Error()
+		return
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	webhook.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		webhook.ProbeError = err.Error()
+		return
+	}
+	resp.Body.Close()
+	webhook.Reachable = true
+}
+
+// evaluate derives the status, severity and problems of a webhook from its probe. A webhook that is
+// down while its failure policy is Fail rejects every request it matches, which is critical.
+func evaluate(webhook *Webhook, latencyThresholdMs int64) {
+	if webhook.inconclusive {
+		webhook.Status = StatusUnknown
+		webhook.Problems = append(webhook.Problems, "webhook could not be checked: "+webhook.ProbeError)
+		return
+	}
+
+	down := false
+	if webhook.Service != nil {
+		switch {
+		case !webhook.ServiceExists:
+			down = true
+			webhook.Problems = append(webhook.Problems, fmt.Sprintf("service %s/%s does not exist", webhook.Service.Namespace, webhook.Service.Name))
+		case webhook.ReadyEndpoints == 0:
+			down = true
+			webhook.Problems = append(webhook.Problems, fmt.Sprintf("service %s/%s has no ready endpoints", webhook.Service.Namespace, webhook.Service.Name))
+		}
+	}
+	if !down && !webhook.Reachable {
+		// URL webhooks may only be reachable from the API server network
+		down = webhook.Service != nil
+		webhook.Problems = append(webhook.Problems, "webhook is not reachable: "+webhook.ProbeError)
+	}
+
+	slow := false
+	if webhook.Reachable {
+		timeoutMs := int64(webhook.TimeoutSeconds) * 1000
+		if webhook.LatencyMs > latencyThresholdMs {
+			slow = true
+			webhook.Problems = append(webhook.Problems, fmt.Sprintf("webhook answered in %dms, above the %dms threshold", webhook.LatencyMs, latencyThresholdMs))
+		}
+		if float64(webhook.LatencyMs) > float64(timeoutMs)*slowFraction {
+			slow = true
+			webhook.Problems = append(webhook.Problems, fmt.Sprintf("webhook answered in %dms, close to its %ds timeout", webhook.LatencyMs, webhook.TimeoutSeconds))
+		}
+	}
+
+	failClosed := webhook.FailurePolicy == string(admissionregistrationv1.Fail)
+	switch {
+	case down && failClosed:
+		webhook.Status, webhook.Severity = StatusDown, SeverityCritical
+		webhook.Problems = append(webhook.Problems, "failurePolicy is Fail, requests matching this webhook are rejected")
+	case down:
+		webhook.Status, webhook.Severity = StatusDown, SeverityWarning
+	case slow || !webhook.Reachable:
+		webhook.Status, webhook.Severity = StatusDegraded, SeverityWarning
+	default:
+		webhook.Status = StatusHealthy
+	}
+}
@@ -0,0 +1,312 @@
+package webhookhealth
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentkube/operator/pkg/budget"
+	"github.com/agentkube/operator/pkg/client"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	"github.com/agentkube/operator/pkg/logger"
+	"github.com/agentkube/operator/pkg/utils"
+)
+
+const (
+	settingsFileName = "admission-webhooks.json"
+
+	// tickInterval is how often the monitor checks whether a run is due
+	tickInterval = time.Minute
+)
+
+// Webhook health states
+const (
+	StatusHealthy  = "healthy"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+	// StatusUnknown means the backend could not be inspected, e.g. for lack of permissions
+	StatusUnknown = "unknown"
+)
+
+// Problem severities
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Settings configure the periodic webhook monitoring that alerts through the dispatchers
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Clusters limits monitoring to these contexts, empty monitors every context
+	Clusters        []string `json:"clusters"`
+	IntervalMinutes int      `json:"intervalMinutes"`
+	// LatencyThresholdMs marks webhooks answering slower than this as degraded
+	LatencyThresholdMs int64 `json:"latencyThresholdMs"`
+}
+
+// DefaultSettings returns the settings used until they are configured
+func DefaultSettings() Settings {
+	return Settings{
+		Clusters:           []string{},
+		IntervalMinutes:    5,
+		LatencyThresholdMs: 1000,
+	}
+}
+
+// Validate checks the settings for invalid values
+func (s Settings) Validate() error {
+	if s.IntervalMinutes < 1 || s.IntervalMinutes > 24*60 {
+		return fmt.Errorf("intervalMinutes must be between 1 and 1440")
+	}
+	if s.LatencyThresholdMs < 1 {
+		return fmt.Errorf("latencyThresholdMs must be positive")
+	}
+	return nil
+}
+
+// ServiceRef is the in-cluster service backing a webhook
+type ServiceRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Port      int32  `json:"port"`
+	Path      string `json:"path,omitempty"`
+}
+
+// Webhook is the health of a single webhook of a Mutating or ValidatingWebhookConfiguration
+type Webhook struct {
+	Configuration  string      `json:"configuration"`
+	Type           string      `json:"type"`
+	Name           string      `json:"name"`
+	FailurePolicy  string      `json:"failurePolicy"`
+	TimeoutSeconds int32       `json:"timeoutSeconds"`
+	Service        *ServiceRef `json:"service,omitempty"`
+	URL            string      `json:"url,omitempty"`
+	// ServiceExists and ReadyEndpoints are only set for service backed webhooks, ReadyEndpoints is -1
+	// for ExternalName services
+	ServiceExists  bool  `json:"serviceExists"`
+	ReadyEndpoints int   `json:"readyEndpoints"`
+	Reachable      bool  `json:"reachable"`
+	LatencyMs      int64 `json:"latencyMs"`
+	// ProbeError is why the webhook could not be reached
+	ProbeError string   `json:"probeError,omitempty"`
+	Status     string   `json:"status"`
+	Severity   string   `json:"severity,omitempty"`
+	Problems   []string `json:"problems"`
+
+	// inconclusive is set when the probe failed for reasons unrelated to the webhook
+	inconclusive bool
+}
+
+// Report is the webhook inventory of a cluster with the health of every webhook
+type Report struct {
+	Cluster   string    `json:"cluster"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Webhooks  []Webhook `json:"webhooks"`
+	Healthy   int       `json:"healthy"`
+	Degraded  int       `json:"degraded"`
+	Down      int       `json:"down"`
+	Unknown   int       `json:"unknown"`
+}
+
+// Manager checks admission webhooks on demand and periodically, alerting when a webhook goes down
+type Manager struct {
+	kubeConfigStore kubeconfig.ContextStore
+	settingsPath    string
+	mutex           sync.Mutex
+	reports         map[string]*Report
+	// statuses is the last known status of the webhooks per cluster, to alert on changes only
+	statuses map[string]map[string]string
+	lastRun  time.Time
+	stopChan chan struct{}
+
+	notifier     dispatchers.Dispatcher
+	notifierOnce sync.Once
+}
+
+// NewManager creates a new admission webhook health manager
+func NewManager(kubeConfigStore kubeconfig.ContextStore) *Manager {
+	return &Manager{
+		kubeConfigStore: kubeConfigStore,
+		settingsPath:    filepath.Join(utils.ConfigDir(), settingsFileName),
+		reports:         map[string]*Report{},
+		statuses:        map[string]map[string]string{},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Settings returns the current monitoring settings
+func (m *Manager) Settings() (Settings, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.loadSettings()
+}
+
+// UpdateSettings stores new monitoring settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Clusters == nil {
+		settings.Clusters = []string{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return utils.WriteJSONFile(m.settingsPath, settings)
+}
+
+// Reports returns the last report of every checked cluster
+func (m *Manager) Reports() []Report {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reports := make([]Report, 0, len(m.reports))
+	for _, report := range m.reports {
+		reports = append(reports, *report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Cluster < reports[j].Cluster })
+	return reports
+}
+
+// Start monitors the configured clusters until Stop is called
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.monitor(now)
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the monitoring loop
+func (m *Manager) Stop() {
+	close(m.stopChan)
+}
+
+// Check inventories and probes the webhooks of a cluster, alerting about webhooks that changed status
+func (m *Manager) Check(ctx context.Context, clusterName string) (*Report, error) {
+	settings, err := m.Settings()
+	if err != nil {
+		return nil, err
+	}
+	report, err := m.check(ctx, clusterName, settings)
+	if err != nil {
+		return nil, err
+	}
+	m.record(report)
+	return report, nil
+}
+
+// monitor checks the configured clusters when the interval elapsed
+func (m *Manager) monitor(now time.Time) {
+	settings, err := m.Settings()
+	if err != nil {
+		logger.Log(logger.LevelError, nil, err, "Failed to load admission webhook settings")
+		return
+	}
+
+	m.mutex.Lock()
+	due := settings.Enabled && now.Sub(m.lastRun) >= time.Duration(settings.IntervalMinutes)*time.Minute
+	if due {
+		m.lastRun = now
+	}
+	m.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	clusters := settings.Clusters
+	if len(clusters) == 0 {
+		contexts, err := m.kubeConfigStore.GetContexts()
+		if err != nil {
+			logger.Log(logger.LevelError, nil, err, "Failed to list contexts for admission webhook monitoring")
+			return
+		}
+		for _, kubeContext := range contexts {
+			clusters = append(clusters, kubeContext.Name)
+		}
+	}
+
+	for _, clusterName := range clusters {
+		// Clusters over their resource budget are skipped until they are resumed
+		if budget.Paused(clusterName) {
+			continue
+		}
+		report, err := m.check(context.Background(), clusterName, settings)
+		if err != nil {
+			logger.Log(logger.LevelWarn, map[string]string{"cluster": clusterName}, err, "Failed to check admission webhooks")
+			continue
+		}
+		m.record(report)
+	}
+}
+
+// record keeps the report and alerts about webhooks whose status changed since the last check
+func (m *Manager) record(report *Report) {
+	m.mutex.Lock()
+	changed := []Webhook{}
+	previous := m.statuses[report.Cluster]
+	statuses := map[string]string{}
+	for _, webhook := range report.Webhooks {
+		key := webhook.Type + "/" + webhook.Configuration + "/" + webhook.Name
+		statuses[key] = webhook.Status
+		status, known := previous[key]
+		// A healthy webhook seen for the first time is not worth an alert
+		if status != webhook.Status && (known || webhook.Status != StatusHealthy) {
+			changed = append(changed, webhook)
+		}
+	}
+	m.statuses[report.Cluster] = statuses
+	m.reports[report.Cluster] = report
+	m.mutex.Unlock()
+
+	for _, webhook := range changed {
+		m.notify(report.Cluster, webhook)
+	}
+}
+
+func (m *Manager) notify(clusterName string, webhook Webhook) {
+	m.notifierOnce.Do(func() {
+		m.notifier = client.NewNotifier("admission-webhooks")
+	})
+
+	status := "Normal"
+	switch webhook.Severity {
+	case SeverityCritical:
+		status = "Danger"
+	case SeverityWarning:
+		status = "Warning"
+	}
+	reason := webhook.Status
+	if len(webhook.Problems) > 0 {
+		reason += ": " + webhook.Problems[0]
+	}
+	e := event.Event{
+		Kind:   "admission-webhook",
+		Host:   clusterName,
+		Name:   webhook.Configuration + "/" + webhook.Name,
+		Reason: reason,
+		Status: status,
+	}
+	go m.notifier.Handle(e)
+}
+
+func (m *Manager) loadSettings() (Settings, error) {
+	settings := DefaultSettings()
+	if err := utils.ReadJSONFile(m.settingsPath, &settings); err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
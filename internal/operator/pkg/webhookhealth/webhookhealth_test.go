@@ -0,0 +1,156 @@
+package webhookhealth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/dispatchers"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	service := &ServiceRef{Namespace: "policy", Name: "gatekeeper", Port: 443}
+
+	tests := []struct {
+		name         string
+		webhook      Webhook
+		wantStatus   string
+		wantSeverity string
+	}{
+		{
+			name:       "healthy",
+			webhook:    Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, Service: service, ServiceExists: true, ReadyEndpoints: 2, Reachable: true, LatencyMs: 20},
+			wantStatus: StatusHealthy,
+		},
+		{
+			name:         "fail closed without endpoints",
+			webhook:      Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, Service: service, ServiceExists: true, Reachable: false},
+			wantStatus:   StatusDown,
+			wantSeverity: SeverityCritical,
+		},
+		{
+			name:         "fail open without service",
+			webhook:      Webhook{FailurePolicy: "Ignore", TimeoutSeconds: 10, Service: service},
+			wantStatus:   StatusDown,
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "endpoints but unreachable",
+			webhook:      Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, Service: service, ServiceExists: true, ReadyEndpoints: 1, ProbeError: "connection refused"},
+			wantStatus:   StatusDown,
+			wantSeverity: SeverityCritical,
+		},
+		{
+			name:         "slow",
+			webhook:      Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, Service: service, ServiceExists: true, ReadyEndpoints: 1, Reachable: true, LatencyMs: 1500},
+			wantStatus:   StatusDegraded,
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "close to timeout",
+			webhook:      Webhook{FailurePolicy: "Ignore", TimeoutSeconds: 1, Service: service, ServiceExists: true, ReadyEndpoints: 1, Reachable: true, LatencyMs: 900},
+			wantStatus:   StatusDegraded,
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:         "unreachable URL",
+			webhook:      Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, URL: "https://webhook.example.com", ProbeError: "no such host"},
+			wantStatus:   StatusDegraded,
+			wantSeverity: SeverityWarning,
+		},
+		{
+			name:       "forbidden",
+			webhook:    Webhook{FailurePolicy: "Fail", TimeoutSeconds: 10, Service: service, ProbeError: "forbidden", inconclusive: true},
+			wantStatus: StatusUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			webhook := tt.webhook
+			evaluate(&webhook, 1000)
+			if webhook.Status != tt.wantStatus || webhook.Severity != tt.wantSeverity {
+				t.Errorf("evaluate() = %s/%s %v, want %s/%s", webhook.Status, webhook.Severity, webhook.Problems, tt.wantStatus, tt.wantSeverity)
+			}
+			if webhook.Status != StatusHealthy && len(webhook.Problems) == 0 {
+				t.Error("evaluate() reported no problem for an unhealthy webhook")
+			}
+		})
+	}
+}
+
+func TestReadyEndpoints(t *testing.T) {
+	t.Parallel()
+
+	ready, notReady := true, false
+	slices := []discoveryv1.EndpointSlice{
+		{Endpoints: []discoveryv1.Endpoint{{Conditions: discoveryv1.EndpointConditions{Ready: &ready}}, {}}},
+		{Endpoints: []discoveryv1.Endpoint{{Conditions: discoveryv1.EndpointConditions{Ready: &notReady}}}},
+	}
+	if got := readyEndpoints(slices); got != 2 {
+		t.Errorf("readyEndpoints() = %d, want 2", got)
+	}
+}
+
+func TestReached(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "answered", want: true},
+		{name: "webhook rejected the GET", err: apierrors.NewMethodNotSupported(schema.GroupResource{Resource: "services"}, "GET"), want: true},
+		{name: "no endpoints", err: apierrors.NewServiceUnavailable("no endpoints available for service"), want: false},
+		{name: "network error", err: errors.New("connection reset"), want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := reached(tt.err); got != tt.want {
+				t.Errorf("reached() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAlertsOnChanges(t *testing.T) {
+	t.Parallel()
+
+	m := &Manager{reports: map[string]*Report{}, statuses: map[string]map[string]string{}}
+	m.notifierOnce.Do(func() { m.notifier = &dispatchers.Default{} })
+
+	webhook := Webhook{Type: "validating", Configuration: "gatekeeper", Name: "check.gatekeeper.sh", Status: StatusHealthy}
+	report := func(status string) *Report {
+		w := webhook
+		w.Status = status
+		return &Report{Cluster: "prod", Webhooks: []Webhook{w}}
+	}
+
+	m.record(report(StatusHealthy))
+	if got := m.statuses["prod"]["validating/gatekeeper/check.gatekeeper.sh"]; got != StatusHealthy {
+		t.Fatalf("status after first check = %q, want healthy", got)
+	}
+	m.record(report(StatusDown))
+	if got := m.statuses["prod"]["validating/gatekeeper/check.gatekeeper.sh"]; got != StatusDown {
+		t.Errorf("status after outage = %q, want down", got)
+	}
+	m.record(&Report{Cluster: "prod", Webhooks: []Webhook{}})
+	if len(m.statuses["prod"]) != 0 {
+		t.Errorf("statuses = %v, want removed webhooks forgotten", m.statuses["prod"])
+	}
+	if len(m.Reports()) != 1 {
+		t.Errorf("Reports() = %v, want the last report of prod", m.Reports())
+	}
+}
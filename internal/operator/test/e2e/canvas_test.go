@@ -0,0 +1,70 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/agentkube/operator/pkg/canvas"
+)
+
+func TestCanvasGraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  canvas.ResourceIdentifier
+		wantNodes []string
+		wantEdges [][3]string
+	}{
+		{
+			name:      "deployment",
+			resource:  canvas.ResourceIdentifier{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "web"},
+			wantNodes: []string{"node-deployment-web", "node-replicaset-web-7d9f6c8b5", "node-pod-web-7d9f6c8b5-x2k4p"},
+			wantEdges: [][3]string{
+				{"node-deployment-web", "node-replicaset-web-7d9f6c8b5", "manages"},
+				{"node-replicaset-web-7d9f6c8b5", "node-pod-web-7d9f6c8b5-x2k4p", "manages"},
+			},
+		},
+		{
+			name:      "service",
+			resource:  canvas.ResourceIdentifier{Namespace: "shop", Group: "core", Version: "v1", ResourceType: "services", ResourceName: "web"},
+			wantNodes: []string{"node-service-web", "node-pod-web-7d9f6c8b5-x2k4p"},
+			wantEdges: [][3]string{{"node-service-web", "node-pod-web-7d9f6c8b5-x2k4p", "routes-to"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var graph canvas.GraphResponse
+			testOperator.JSON(t, http.MethodPost, testOperator.ClusterPath("/canvas"), tt.resource, http.StatusOK, &graph)
+
+			nodes := map[string]bool{}
+			for _, node := range graph.Nodes {
+				nodes[node.ID] = true
+			}
+			for _, id := range tt.wantNodes {
+				if !nodes[id] {
+					t.Errorf("graph has no node %s, nodes: %v", id, nodes)
+				}
+			}
+
+			edges := map[[3]string]bool{}
+			for _, edge := range graph.Edges {
+				edges[[3]string{edge.Source, edge.Target, edge.Label}] = true
+			}
+			for _, edge := range tt.wantEdges {
+				if !edges[edge] {
+					t.Errorf("graph has no %s edge from %s to %s", edge[2], edge[0], edge[1])
+				}
+			}
+		})
+	}
+}
+
+func TestCanvasUnknownResource(t *testing.T) {
+	resource := canvas.ResourceIdentifier{Namespace: "shop", Group: "apps", Version: "v1", ResourceType: "deployments", ResourceName: "missing"}
+	if status, body := testOperator.Do(t, http.MethodPost, testOperator.ClusterPath("/canvas"), resource); status == http.StatusOK {
+		t.Errorf("canvas of a missing deployment = %d, want an error: %s", status, body)
+	}
+}
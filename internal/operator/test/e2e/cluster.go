@@ -0,0 +1,112 @@
+//go:build e2e
+
+// Package e2e runs the operator API against a real API server. The cluster comes from envtest
+// binaries, a kind cluster or an existing kubeconfig context, chosen with E2E_CLUSTER:
+//
+//	E2E_CLUSTER=envtest  KUBEBUILDER_ASSETS=/path/to/bin  go test -tags e2e ./test/e2e/...
+//	E2E_CLUSTER=kind     go test -tags e2e ./test/e2e/...
+//	E2E_CLUSTER=existing KUBECONFIG=~/.kube/config E2E_CONTEXT=dev go test -tags e2e ./test/e2e/...
+//
+// envtest runs only etcd and kube-apiserver: objects are stored but no controller or kubelet acts
+// on them, so the fixtures seed every object a test expects, down to the pods.
+package e2e
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster providers
+const (
+	ProviderEnvtest  = "envtest"
+	ProviderKind     = "kind"
+	ProviderExisting = "existing"
+)
+
+// Cluster is a Kubernetes API server the tests run against
+type Cluster struct {
+	Provider string
+	// Context is the kubeconfig context of the cluster, the clusterName of the operator routes
+	Context    string
+	Kubeconfig string
+	Config     *rest.Config
+	Clientset  kubernetes.Interface
+	Dynamic    dynamic.Interface
+
+	stop func() error
+}
+
+// StartCluster starts the cluster of the provider selected with E2E_CLUSTER, envtest by default,
+// keeping its files in workDir
+func StartCluster(workDir string) (*Cluster, error) {
+	provider := os.Getenv("E2E_CLUSTER")
+	if provider == "" {
+		provider = ProviderEnvtest
+	}
+
+	var cluster *Cluster
+	var err error
+	switch provider {
+	case ProviderEnvtest:
+		cluster, err = startEnvtest(workDir)
+	case ProviderKind:
+		cluster, err = startKind(workDir)
+	case ProviderExisting:
+		cluster, err = existingCluster()
+	default:
+		return nil, fmt.Errorf("unknown E2E_CLUSTER %q, use %s, %s or %s", provider, ProviderEnvtest, ProviderKind, ProviderExisting)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cluster.Provider = provider
+
+	if err := cluster.connect(); err != nil {
+		cluster.Stop()
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// Stop tears the cluster down, existing clusters are left alone
+func (c *Cluster) Stop() error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop()
+}
+
+// connect builds the clients of the cluster from its kubeconfig
+func (c *Cluster) connect() error {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.Kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: c.Context},
+	).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig %s: %w", c.Kubeconfig, err)
+	}
+	c.Config = config
+
+	if c.Clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return err
+	}
+	if c.Dynamic, err = dynamic.NewForConfig(config); err != nil {
+		return err
+	}
+	return nil
+}
+
+// existingCluster uses a context of the kubeconfig at KUBECONFIG
+func existingCluster() (*Cluster, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	contextName := os.Getenv("E2E_CONTEXT")
+	if kubeconfig == "" || contextName == "" {
+		return nil, fmt.Errorf("E2E_CLUSTER=%s needs KUBECONFIG and E2E_CONTEXT", ProviderExisting)
+	}
+	return &Cluster{Context: contextName, Kubeconfig: kubeconfig}, nil
+}
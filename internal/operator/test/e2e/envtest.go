@@ -0,0 +1,215 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	envtestContext = "e2e-envtest"
+	startTimeout   = 60 * time.Second
+)
+
+// startEnvtest runs etcd and kube-apiserver from KUBEBUILDER_ASSETS, the binaries setup-envtest
+// downloads, with a static admin token
+func startEnvtest(workDir string) (*Cluster, error) {
+	assets := os.Getenv("KUBEBUILDER_ASSETS")
+	if assets == "" {
+		return nil, errors.New("envtest needs KUBEBUILDER_ASSETS, e.g. KUBEBUILDER_ASSETS=$(setup-envtest use -p path)")
+	}
+
+	etcdPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	apiPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	etcdURL := "http://127.0.0.1:" + strconv.Itoa(etcdPort)
+	etcd := exec.Command(filepath.Join(assets, "etcd"),
+		"--data-dir", filepath.Join(workDir, "etcd"),
+		"--listen-client-urls", etcdURL,
+		"--advertise-client-urls", etcdURL,
+		"--listen-peer-urls", "http://127.0.0.1:"+strconv.Itoa(peerPort),
+		"--unsafe-no-fsync",
+	)
+	etcd.Stdout = logFile(workDir, "etcd.log")
+	etcd.Stderr = etcd.Stdout
+	if err := etcd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start etcd: %w", err)
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		stopProcesses(etcd)
+		return nil, err
+	}
+	tokenFile := filepath.Join(workDir, "tokens.csv")
+	if err := os.WriteFile(tokenFile, []byte(token+",admin,admin,system:masters\n"), 0600); err != nil {
+		stopProcesses(etcd)
+		return nil, err
+	}
+	keyFile := filepath.Join(workDir, "service-account.key")
+	if err := writeServiceAccountKey(keyFile); err != nil {
+		stopProcesses(etcd)
+		return nil, err
+	}
+
+	apiServer := exec.Command(filepath.Join(assets, "kube-apiserver"),
+		"--etcd-servers", etcdURL,
+		"--cert-dir", filepath.Join(workDir, "certs"),
+		"--bind-address", "127.0.0.1",
+		"--secure-port", strconv.Itoa(apiPort),
+		"--service-cluster-ip-range", "10.0.0.0/24",
+		"--allow-privileged=true",
+		"--authorization-mode", "RBAC",
+		"--token-auth-file", tokenFile,
+		"--service-account-issuer", "https://kubernetes.default.svc",
+		"--service-account-key-file", keyFile,
+		"--service-account-signing-key-file", keyFile,
+		"--disable-admission-plugins", "ServiceAccount",
+	)
+	apiServer.Stdout = logFile(workDir, "kube-apiserver.log")
+	apiServer.Stderr = apiServer.Stdout
+	if err := apiServer.Start(); err != nil {
+		stopProcesses(etcd)
+		return nil, fmt.Errorf("failed to start kube-apiserver: %w", err)
+	}
+
+	server := "https://127.0.0.1:" + strconv.Itoa(apiPort)
+	if err := waitReady(server, token); err != nil {
+		stopProcesses(apiServer, etcd)
+		return nil, fmt.Errorf("%w, see %s", err, filepath.Join(workDir, "kube-apiserver.log"))
+	}
+
+	kubeconfig := filepath.Join(workDir, "kubeconfig")
+	config := clientcmdapi.NewConfig()
+	config.Clusters[envtestContext] = &clientcmdapi.Cluster{Server: server, InsecureSkipTLSVerify: true}
+	config.AuthInfos[envtestContext] = &clientcmdapi.AuthInfo{Token: token}
+	config.Contexts[envtestContext] = &clientcmdapi.Context{Cluster: envtestContext, AuthInfo: envtestContext, Namespace: "default"}
+	config.CurrentContext = envtestContext
+	if err := clientcmd.WriteToFile(*config, kubeconfig); err != nil {
+		stopProcesses(apiServer, etcd)
+		return nil, err
+	}
+
+	return &Cluster{
+		Context:    envtestContext,
+		Kubeconfig: kubeconfig,
+		stop: func() error {
+			stopProcesses(apiServer, etcd)
+			return nil
+		},
+	}, nil
+}
+
+// waitReady polls the readiness endpoint of the API server
+func waitReady(server, token string) error {
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/readyz", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("kube-apiserver did not become ready in time")
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func stopProcesses(commands ...*exec.Cmd) {
+	for _, cmd := range commands {
+		if cmd.Process == nil {
+			continue
+		}
+		_ = cmd.Process.Signal(os.Interrupt)
+		done := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeServiceAccountKey writes the key the API server signs and verifies service account tokens with
+func writeServiceAccountKey(path string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// logFile opens a log of the fixture processes, the output is discarded when it can't be created
+func logFile(workDir, name string) io.Writer {
+	f, err := os.OpenFile(filepath.Join(workDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return io.Discard
+	}
+	return f
+}
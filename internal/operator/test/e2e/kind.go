@@ -0,0 +1,48 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const defaultKindCluster = "agentkube-e2e"
+
+// startKind creates a kind cluster, named E2E_KIND_CLUSTER or agentkube-e2e. An existing cluster of
+// that name is reused, and kept after the tests when E2E_KEEP_CLUSTER is set.
+func startKind(workDir string) (*Cluster, error) {
+	name := os.Getenv("E2E_KIND_CLUSTER")
+	if name == "" {
+		name = defaultKindCluster
+	}
+	kubeconfig := filepath.Join(workDir, "kubeconfig")
+
+	created := false
+	if err := kind("get", "kubeconfig", "--name", name); err != nil {
+		if err := kind("create", "cluster", "--name", name, "--kubeconfig", kubeconfig, "--wait", "120s"); err != nil {
+			return nil, fmt.Errorf("failed to create kind cluster %s: %w", name, err)
+		}
+		created = true
+	} else if err := kind("export", "kubeconfig", "--name", name, "--kubeconfig", kubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to export kubeconfig of kind cluster %s: %w", name, err)
+	}
+
+	cluster := &Cluster{Context: "kind-" + name, Kubeconfig: kubeconfig}
+	if created && os.Getenv("E2E_KEEP_CLUSTER") == "" {
+		cluster.stop = func() error {
+			return kind("delete", "cluster", "--name", name)
+		}
+	}
+	return cluster, nil
+}
+
+func kind(args ...string) error {
+	cmd := exec.Command("kind", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("kind %v: %w: %s", args, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	testCluster  *Cluster
+	testOperator *Operator
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run starts the cluster and the operator shared by the tests and seeds the fixtures
+func run(m *testing.M) int {
+	workDir, err := os.MkdirTemp("", "agentkube-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(workDir)
+
+	testCluster, err = StartCluster(workDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "starting cluster: %v\n", err)
+		return 1
+	}
+	defer testCluster.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := testCluster.Seed(ctx, "shop.yaml"); err != nil {
+		fmt.Fprintf(os.Stderr, "seeding fixtures: %v\n", err)
+		return 1
+	}
+
+	testOperator, err = StartOperator(testCluster, filepath.Join(workDir, "config"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "starting operator: %v\n", err)
+		return 1
+	}
+	defer testOperator.Stop()
+
+	return m.Run()
+}
@@ -0,0 +1,73 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/internal/multiplexer"
+	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMultiplexerWatch(t *testing.T) {
+	conn, _, err := websocket.DefaultDialer.Dial(testOperator.WebSocketURL("/wsMultiplexer"), nil)
+	if err != nil {
+		t.Fatalf("dialing multiplexer: %v", err)
+	}
+	defer conn.Close()
+
+	request := multiplexer.Message{
+		ClusterID: testCluster.Context,
+		Path:      "/api/v1/namespaces/shop/configmaps",
+		Query:     "watch=true",
+		UserID:    "e2e",
+		Type:      "REQUEST",
+	}
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("sending watch request: %v", err)
+	}
+
+	// The watch is opened asynchronously, keep creating until an event comes back
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "e2e-watch-" + time.Now().Format("150405.000000"), Namespace: "shop"}}
+			_, _ = testCluster.Clientset.CoreV1().ConfigMaps("shop").Create(ctx, configMap, metav1.CreateOptions{})
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	for {
+		var message multiplexer.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("no watch event received: %v", err)
+		}
+		if message.Type != "DATA" || message.Path != request.Path {
+			continue
+		}
+
+		var event struct {
+			Type   string `json:"type"`
+			Object struct {
+				Metadata metav1.ObjectMeta `json:"metadata"`
+			} `json:"object"`
+		}
+		if err := json.Unmarshal([]byte(message.Data), &event); err != nil {
+			t.Fatalf("decoding watch event: %v: %s", err, message.Data)
+		}
+		if event.Type == "ADDED" && strings.HasPrefix(event.Object.Metadata.Name, "e2e-watch-") {
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/operator/internal/routes"
+	"github.com/agentkube/operator/pkg/cache"
+	"github.com/agentkube/operator/pkg/config"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+)
+
+// Operator is the operator API served in-process against the test cluster
+type Operator struct {
+	URL     string
+	Cluster *Cluster
+	server  *httptest.Server
+}
+
+// StartOperator serves the operator routes with the cluster as its only context. The operator keeps
+// its settings and state in configDir instead of ~/.agentkube.
+func StartOperator(cluster *Cluster, configDir string) (*Operator, error) {
+	if err := os.Setenv("CONFIG", configDir); err != nil {
+		return nil, err
+	}
+
+	store := kubeconfig.NewContextStore()
+	if err := kubeconfig.LoadAndStoreKubeConfigs(store, cluster.Kubeconfig, kubeconfig.KubeConfig); err != nil {
+		return nil, fmt.Errorf("failed to load the cluster kubeconfig: %w", err)
+	}
+	if _, err := store.GetContext(cluster.Context); err != nil {
+		return nil, fmt.Errorf("context %s not found in %s: %w", cluster.Context, cluster.Kubeconfig, err)
+	}
+
+	router := routes.SetupRouter(config.Config{Port: 0}, store, cache.New[interface{}]())
+	server := httptest.NewServer(router)
+	return &Operator{URL: server.URL, Cluster: cluster, server: server}, nil
+}
+
+// Stop stops serving the operator API
+func (o *Operator) Stop() {
+	o.server.Close()
+}
+
+// WebSocketURL returns the ws:// URL of an operator path
+func (o *Operator) WebSocketURL(path string) string {
+	return "ws" + strings.TrimPrefix(o.URL, "http") + path
+}
+
+// Do sends a request to the operator API, body is encoded as JSON unless nil, and returns the
+// status and the response body
+func (o *Operator) Do(t *testing.T, method, path string, body interface{}) (int, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, o.URL+path, reader)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response of %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// JSON sends a request to the operator API, fails the test unless it answers with the wanted status,
+// and decodes the response into out when it isn't nil
+func (o *Operator) JSON(t *testing.T, method, path string, body interface{}, wantStatus int, out interface{}) {
+	t.Helper()
+
+	status, data := o.Do(t, method, path, body)
+	if status != wantStatus {
+		t.Fatalf("%s %s = %d, want %d: %s", method, path, status, wantStatus, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("decoding response of %s %s: %v: %s", method, path, err, data)
+		}
+	}
+}
+
+// ClusterPath returns an operator path of the test cluster, e.g. ClusterPath("/canvas")
+func (o *Operator) ClusterPath(path string) string {
+	return "/api/v1/cluster/" + o.Cluster.Context + path
+}
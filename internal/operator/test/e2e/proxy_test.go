@@ -0,0 +1,31 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	var pods struct {
+		Kind  string `json:"kind"`
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	path := "/api/v1/clusters/" + testCluster.Context + "/api/v1/namespaces/shop/pods"
+	testOperator.JSON(t, http.MethodGet, path, nil, http.StatusOK, &pods)
+
+	if pods.Kind != "PodList" || len(pods.Items) != 1 || pods.Items[0].Metadata.Name != "web-7d9f6c8b5-x2k4p" {
+		t.Errorf("proxied pod list = %+v, want the seeded pod", pods)
+	}
+}
+
+func TestProxyUnknownCluster(t *testing.T) {
+	if status, body := testOperator.Do(t, http.MethodGet, "/api/v1/clusters/missing/api/v1/namespaces", nil); status == http.StatusOK {
+		t.Errorf("proxy to an unknown cluster = %d, want an error: %s", status, body)
+	}
+}
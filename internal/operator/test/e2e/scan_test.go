@@ -0,0 +1,87 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/pkg/vul"
+)
+
+func TestClusterImages(t *testing.T) {
+	var images struct {
+		Images []vul.ImageInfo `json:"images"`
+	}
+	testOperator.JSON(t, http.MethodGet, testOperator.ClusterPath("/images?namespace=shop"), nil, http.StatusOK, &images)
+
+	found := false
+	for _, image := range images.Images {
+		found = found || image.Image == "nginx:1.27" && image.PodName == "web-7d9f6c8b5-x2k4p"
+	}
+	if !found {
+		t.Errorf("images = %+v, want nginx:1.27 of pod web-7d9f6c8b5-x2k4p", images.Images)
+	}
+}
+
+func TestWorkloadsByImage(t *testing.T) {
+	var workloads struct {
+		Workloads []struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"workloads"`
+	}
+	testOperator.JSON(t, http.MethodPost, testOperator.ClusterPath("/vulnerability/workloads"),
+		map[string]string{"image": "nginx:1.27"}, http.StatusOK, &workloads)
+
+	found := false
+	for _, workload := range workloads.Workloads {
+		found = found || workload.Kind == "Deployment" && workload.Name == "web"
+	}
+	if !found {
+		t.Errorf("workloads = %+v, want deployment web", workloads.Workloads)
+	}
+}
+
+// TestImageScan downloads the vulnerability database and pulls the image, set E2E_SCANS to run it
+func TestImageScan(t *testing.T) {
+	if os.Getenv("E2E_SCANS") == "" {
+		t.Skip("set E2E_SCANS to scan images")
+	}
+
+	scanner := vul.NewImageScanner(vul.ImageScans{Enable: true}, slog.Default())
+	scanner.Init("agentkube-e2e", "dev")
+	vul.ImgScanner = scanner
+	defer func() {
+		scanner.Stop()
+		vul.ImgScanner = nil
+	}()
+
+	deadline := time.Now().Add(10 * time.Minute)
+	for {
+		var response struct {
+			Results []struct {
+				Status  string `json:"status"`
+				Summary struct {
+					Total int `json:"total"`
+				} `json:"summary"`
+			} `json:"results"`
+		}
+		testOperator.JSON(t, http.MethodPost, "/api/v1/vulnerability/scan",
+			map[string]interface{}{"images": []string{"nginx:1.27"}}, http.StatusOK, &response)
+		if len(response.Results) == 1 && response.Results[0].Status == "completed" {
+			if response.Results[0].Summary.Total == 0 {
+				t.Error("scan of nginx:1.27 found no vulnerabilities")
+			}
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("scan of nginx:1.27 did not complete in time")
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,113 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// Seed creates the objects of a fixture file of testdata. The status of the objects is written too,
+// since no controller or kubelet sets it on envtest. Owner references name their owner, the uid is
+// resolved from the objects created before.
+func (c *Cluster) Seed(ctx context.Context, fixture string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.Clientset.Discovery()))
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	uids := map[string]string{}
+	created := []*unstructured.Unstructured{}
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return created, fmt.Errorf("invalid fixture %s: %w", fixture, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		result, err := c.apply(ctx, mapper, obj, uids)
+		if err != nil {
+			return created, fmt.Errorf("failed to seed %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		uids[ownerKey(result.GetKind(), result.GetNamespace(), result.GetName())] = string(result.GetUID())
+		created = append(created, result)
+	}
+	return created, nil
+}
+
+// apply creates or replaces an object and its status
+func (c *Cluster) apply(ctx context.Context, mapper meta.RESTMapper, obj *unstructured.Unstructured, uids map[string]string) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	var client dynamic.ResourceInterface = c.Dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace("default")
+		}
+		client = c.Dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+	resolveOwners(obj, uids)
+
+	status, hasStatus := obj.Object["status"]
+	result, err := client.Create(ctx, obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		existing, getErr := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return nil, getErr
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		result, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if hasStatus {
+		result.Object["status"] = status
+		if updated, err := client.UpdateStatus(ctx, result, metav1.UpdateOptions{}); err == nil {
+			result = updated
+		} else if !apierrors.IsNotFound(err) && !apierrors.IsMethodNotSupported(err) {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// resolveOwners fills the uid of owner references to objects seeded before
+func resolveOwners(obj *unstructured.Unstructured, uids map[string]string) {
+	owners := obj.GetOwnerReferences()
+	for i := range owners {
+		if uid, ok := uids[ownerKey(owners[i].Kind, obj.GetNamespace(), owners[i].Name)]; ok {
+			owners[i].UID = types.UID(uid)
+		}
+	}
+	obj.SetOwnerReferences(owners)
+}
+
+func ownerKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
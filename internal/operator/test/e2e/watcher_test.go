@@ -0,0 +1,63 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/operator/config"
+	"github.com/agentkube/operator/pkg/controller"
+	"github.com/agentkube/operator/pkg/dispatchers"
+	"github.com/agentkube/operator/pkg/event"
+	"github.com/agentkube/operator/pkg/kubeconfig"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWatcherDispatchesCreatedEvents(t *testing.T) {
+	store := kubeconfig.NewContextStore()
+	if err := kubeconfig.LoadAndStoreKubeConfigs(store, testCluster.Kubeconfig, kubeconfig.KubeConfig); err != nil {
+		t.Fatalf("loading kubeconfig: %v", err)
+	}
+
+	events := make(chan event.Event, 100)
+	controller.AddEventListener(func(e event.Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+
+	conf := &config.Config{Enabled: true, Resource: config.Resource{ConfigMap: true}}
+	go controller.Start(conf, &dispatchers.Default{}, store)
+	defer controller.Stop()
+
+	// Only objects created after the watcher started are reported, at a one second resolution
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2 * time.Second):
+			}
+			configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{GenerateName: "e2e-watcher-", Namespace: "shop"}}
+			_, _ = testCluster.Clientset.CoreV1().ConfigMaps("shop").Create(ctx, configMap, metav1.CreateOptions{})
+		}
+	}()
+
+	for {
+		select {
+		case e := <-events:
+			if e.Reason == "Created" && e.Host == testCluster.Context && strings.Contains(e.Name, "e2e-watcher-") {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("no created event dispatched for the new configmaps")
+		}
+	}
+}